@@ -10,7 +10,16 @@
 package glusterfs
 
 import (
+	"fmt"
+	"sort"
+
 	wdb "github.com/heketi/heketi/pkg/db"
+	"github.com/heketi/heketi/pkg/faults"
+)
+
+const (
+	// Allocator used when none is set in the configuration
+	DefaultAllocator = "simple"
 )
 
 type Allocator interface {
@@ -22,3 +31,94 @@ type Allocator interface {
 	GetNodes(db wdb.RODB, clusterId, brickId string) (<-chan string,
 		chan<- struct{}, <-chan error)
 }
+
+// AllocatorFactory creates a new allocator
+type AllocatorFactory func() (Allocator, error)
+
+var (
+	// Allocators which can be selected in the configuration file
+	allocatorFactories = map[string]AllocatorFactory{
+		"simple": func() (Allocator, error) {
+			return NewSimpleAllocator(), nil
+		},
+		"capacity": func() (Allocator, error) {
+			return NewCapacityAllocator(), nil
+		},
+	}
+)
+
+// generateDevices returns the channels of the GetNodes method of an
+// allocator proposing the devices in order, or failing with the error
+func generateDevices(devices []string, err error) (<-chan string,
+	chan<- struct{}, <-chan error) {
+
+	// Initialize channels
+	device, done := make(chan string), make(chan struct{})
+
+	// Make sure to make a buffered channel for the error, so we can
+	// set it and return
+	errc := make(chan error, 1)
+
+	if err != nil {
+		errc <- err
+		close(device)
+		return device, done, errc
+	}
+
+	// Start generator in a new goroutine
+	go func() {
+		var err error
+		defer func() {
+			errc <- err
+			close(device)
+		}()
+
+		for _, d := range devices {
+			if err = faults.Check(FaultAllocatorClose); err != nil {
+				return
+			}
+			select {
+			case device <- d:
+			case <-done:
+				return
+			}
+		}
+
+	}()
+
+	return device, done, errc
+}
+
+// RegisterAllocator makes an allocator available under the name used
+// to select it with the "allocator" setting of the configuration file.
+// It must be called before the app is created.
+func RegisterAllocator(name string, factory AllocatorFactory) error {
+	if name == "" || factory == nil {
+		return fmt.Errorf("Invalid allocator registration")
+	}
+	if _, ok := allocatorFactories[name]; ok {
+		return fmt.Errorf("Allocator %v is already registered", name)
+	}
+	allocatorFactories[name] = factory
+	return nil
+}
+
+// NewAllocator creates an allocator of the named implementation
+func NewAllocator(name string) (Allocator, error) {
+	factory, ok := allocatorFactories[name]
+	if !ok {
+		return nil, fmt.Errorf("Unknown allocator %v, must be one of %v",
+			name, AllocatorNames())
+	}
+	return factory()
+}
+
+// AllocatorNames returns the names of the registered allocators
+func AllocatorNames() []string {
+	names := make([]string, 0, len(allocatorFactories))
+	for name := range allocatorFactories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
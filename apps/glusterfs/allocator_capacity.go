@@ -0,0 +1,81 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"sort"
+
+	"github.com/boltdb/bolt"
+	wdb "github.com/heketi/heketi/pkg/db"
+)
+
+// CapacityAllocator proposes the online devices of a cluster with the
+// most free space first, so that devices of different sizes fill up
+// evenly. Unlike the simple allocator it keeps no state.
+type CapacityAllocator struct{}
+
+// Create a new capacity allocator
+func NewCapacityAllocator() *CapacityAllocator {
+	return &CapacityAllocator{}
+}
+
+// capacityDevices returns the online devices of the online nodes of
+// the cluster, the devices with the most free space first
+func capacityDevices(tx *bolt.Tx, clusterId string) ([]string, error) {
+	cluster, err := NewClusterEntryFromId(tx, clusterId)
+	if err != nil {
+		return nil, err
+	}
+
+	devices := []*DeviceEntry{}
+	for _, nodeId := range cluster.Info.Nodes {
+		node, err := NewNodeEntryFromId(tx, nodeId)
+		if err != nil {
+			return nil, err
+		}
+		if !node.isOnline() {
+			continue
+		}
+		for _, deviceId := range node.Devices {
+			device, err := NewDeviceEntryFromId(tx, deviceId)
+			if err != nil {
+				return nil, err
+			}
+			if device.isOnline() {
+				devices = append(devices, device)
+			}
+		}
+	}
+
+	sort.Slice(devices, func(i, j int) bool {
+		ai, aj := devices[i].StorageAvailable(), devices[j].StorageAvailable()
+		if ai != aj {
+			return ai > aj
+		}
+		return devices[i].Info.Id < devices[j].Info.Id
+	})
+	ids := make([]string, 0, len(devices))
+	for _, device := range devices {
+		ids = append(ids, device.Info.Id)
+	}
+	return ids, nil
+}
+
+func (c *CapacityAllocator) GetNodes(db wdb.RODB, clusterId,
+	brickId string) (<-chan string, chan<- struct{}, <-chan error) {
+
+	var devices []string
+	err := db.View(func(tx *bolt.Tx) error {
+		var err error
+		devices, err = capacityDevices(tx, clusterId)
+		return err
+	})
+	return generateDevices(devices, err)
+}
@@ -0,0 +1,99 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"os"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/heketi/pkg/utils"
+	"github.com/heketi/tests"
+)
+
+func TestCapacityAllocatorGetNodesEmpty(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	a := NewCapacityAllocator()
+	ch, done, errc := a.GetNodes(app.db, utils.GenUUID(), utils.GenUUID())
+	defer func() { close(done) }()
+
+	for d := range ch {
+		tests.Assert(t, false, "expected no device, got:", d)
+	}
+	err := <-errc
+	tests.Assert(t, err == ErrNotFound, err)
+}
+
+func TestCapacityAllocatorGetNodes(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	err := setupSampleDbWithTopology(app,
+		1,      // clusters
+		2,      // nodes_per_cluster
+		3,      // devices_per_node,
+		600*GB, // disksize)
+	)
+	tests.Assert(t, err == nil)
+
+	// One device has more free space and one less, one is offline
+	var clusterId, larger, smaller, offline string
+	err = app.db.Update(func(tx *bolt.Tx) error {
+		clusters, err := ClusterList(tx)
+		if err != nil {
+			return err
+		}
+		clusterId = clusters[0]
+		cluster, err := NewClusterEntryFromId(tx, clusterId)
+		tests.Assert(t, err == nil)
+		node, err := cluster.NodeEntryFromClusterIndex(tx, 1)
+		tests.Assert(t, err == nil)
+
+		for i, change := range []func(d *DeviceEntry){
+			func(d *DeviceEntry) { d.Info.Storage.Free += 100 * GB },
+			func(d *DeviceEntry) { d.Info.Storage.Free -= 100 * GB },
+			func(d *DeviceEntry) { d.State = api.EntryStateOffline },
+		} {
+			device, err := NewDeviceEntryFromId(tx, node.Devices[i])
+			tests.Assert(t, err == nil)
+			change(device)
+			if err := device.Save(tx); err != nil {
+				return err
+			}
+		}
+		larger, smaller, offline = node.Devices[0], node.Devices[1], node.Devices[2]
+		return nil
+	})
+	tests.Assert(t, err == nil)
+
+	a := NewCapacityAllocator()
+	ch, done, errc := a.GetNodes(app.db, clusterId, utils.GenUUID())
+	defer func() { close(done) }()
+
+	devices := []string{}
+	for d := range ch {
+		tests.Assert(t, d != offline)
+		devices = append(devices, d)
+	}
+	err = <-errc
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, len(devices) == 5, devices)
+	tests.Assert(t, devices[0] == larger, devices)
+	tests.Assert(t, devices[4] == smaller, devices)
+}
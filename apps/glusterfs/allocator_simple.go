@@ -144,44 +144,19 @@ func (s *SimpleAllocator) getDeviceList(clusterId, brickId string) (SimpleDevice
 func (s *SimpleAllocator) GetNodes(db wdb.RODB, clusterId,
 	brickId string) (<-chan string, chan<- struct{}, <-chan error) {
 
-	// Initialize channels
-	device, done := make(chan string), make(chan struct{})
-
-	// Make sure to make a buffered channel for the error, so we can
-	// set it and return
-	errc := make(chan error, 1)
-
 	if err := db.View(s.loadRingFromDB); err != nil {
-		errc <- err
-		close(device)
-		return device, done, errc
+		return generateDevices(nil, err)
 	}
 
 	// Get the list of devices for this brick id
 	devicelist, err := s.getDeviceList(clusterId, brickId)
-
 	if err != nil {
-		errc <- err
-		close(device)
-		return device, done, errc
+		return generateDevices(nil, err)
 	}
 
-	// Start generator in a new goroutine
-	go func() {
-		defer func() {
-			errc <- nil
-			close(device)
-		}()
-
-		for _, d := range devicelist {
-			select {
-			case device <- d.deviceId:
-			case <-done:
-				return
-			}
-		}
-
-	}()
-
-	return device, done, errc
+	ids := make([]string, 0, len(devicelist))
+	for _, d := range devicelist {
+		ids = append(ids, d.deviceId)
+	}
+	return generateDevices(ids, nil)
 }
@@ -0,0 +1,56 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"testing"
+
+	"github.com/heketi/tests"
+)
+
+func TestNewAllocator(t *testing.T) {
+	a, err := NewAllocator(DefaultAllocator)
+	tests.Assert(t, err == nil, err)
+	_, ok := a.(*SimpleAllocator)
+	tests.Assert(t, ok)
+
+	a, err = NewAllocator("capacity")
+	tests.Assert(t, err == nil, err)
+	_, ok = a.(*CapacityAllocator)
+	tests.Assert(t, ok)
+
+	_, err = NewAllocator("unknown")
+	tests.Assert(t, err != nil)
+}
+
+func TestRegisterAllocator(t *testing.T) {
+	defer delete(allocatorFactories, "test")
+
+	mock := NewSimpleAllocator()
+	err := RegisterAllocator("test", func() (Allocator, error) {
+		return mock, nil
+	})
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, len(AllocatorNames()) == 3, AllocatorNames())
+
+	a, err := NewAllocator("test")
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, a == Allocator(mock))
+
+	// Names can only be registered once
+	err = RegisterAllocator("test", func() (Allocator, error) {
+		return mock, nil
+	})
+	tests.Assert(t, err != nil)
+	err = RegisterAllocator(DefaultAllocator, func() (Allocator, error) {
+		return mock, nil
+	})
+	tests.Assert(t, err != nil)
+}
@@ -11,18 +11,22 @@ package glusterfs
 
 import (
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/boltdb/bolt"
 	"github.com/gorilla/mux"
 	"github.com/heketi/heketi/executors"
+	"github.com/heketi/heketi/executors/apiexec"
 	"github.com/heketi/heketi/executors/kubeexec"
 	"github.com/heketi/heketi/executors/mockexec"
 	"github.com/heketi/heketi/executors/sshexec"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
 	"github.com/heketi/heketi/pkg/utils"
 	"github.com/heketi/rest"
 )
@@ -46,12 +50,43 @@ var (
 
 type App struct {
 	asyncManager *rest.AsyncHttpManager
+	asyncSteps   *asyncStepManager
 	db           *bolt.DB
 	dbReadOnly   bool
 	executor     executors.Executor
 	_allocator   Allocator
 	conf         *GlusterFSConfig
 
+	// Closed to stop the periodic jobs
+	stop chan struct{}
+
+	// Result of the last topology load
+	topologyLoad topologyLoadState
+
+	// Result of the last block volume reconcile
+	blockReconcile blockReconcileState
+
+	// Result of the last peer repair of every cluster
+	peerRepairs peerRepairResults
+
+	// Teardowns of the volumes and block volumes being deleted
+	deletes *deleteQueue
+
+	// Failovers of the unreachable devices queued by the health checks
+	failovers sync.WaitGroup
+
+	// Endpoints the events are posted to, if any
+	webhooks *webhookNotifier
+
+	// Last events, as returned by the event feed
+	events *eventFeed
+
+	// Limits of the operations running at the same time, if any
+	throttle *operationThrottle
+
+	// Orders the clusters of the volume creates not listing clusters
+	clusters *clusterSelector
+
 	// For testing only.  Keep access to the object
 	// not through the interface
 	xo *mockexec.MockExecutor
@@ -70,8 +105,17 @@ func NewApp(configIo io.Reader) *App {
 	// Setup loglevel
 	app.setLogLevel(app.conf.Loglevel)
 
+	// Setup the format of the messages of all the loggers
+	if app.conf.LogFormat != "" {
+		if err := utils.SetLogFormat(app.conf.LogFormat); err != nil {
+			logger.Err(err)
+			return nil
+		}
+	}
+
 	// Setup asynchronous manager
 	app.asyncManager = rest.NewAsyncHttpManager(ASYNC_ROUTE)
+	app.asyncSteps = newAsyncStepManager()
 
 	// Setup executor
 	var err error
@@ -92,6 +136,22 @@ func NewApp(configIo io.Reader) *App {
 	}
 	logger.Info("Loaded %v executor", app.conf.Executor)
 
+	// Use the management api of glusterd, falling back to the cli
+	if app.conf.ApiConfig.Enabled && app.xo == nil {
+		app.executor, err = apiexec.NewApiExecutor(&app.conf.ApiConfig, app.executor)
+		if err != nil {
+			logger.Err(err)
+			return nil
+		}
+		logger.Info("Using the glusterd management api")
+	}
+
+	// Check the allocator exists before it is needed
+	if _, err := NewAllocator(app.AllocatorName()); err != nil {
+		logger.Err(err)
+		return nil
+	}
+
 	// Set db is set in the configuration file
 	if app.conf.DBfile != "" {
 		dbfilename = app.conf.DBfile
@@ -135,13 +195,43 @@ func NewApp(configIo io.Reader) *App {
 		}
 	}
 
-	// Abort the application if there are pending operations in the db.
-	// In the immediate future we need to prevent incomplete operations
-	// from piling up in the db. If there are any pending ops in the db
-	// (meaning heketi was uncleanly terminated during the op) we are
-	// simply going to refuse to start and provide offline tooling to
-	// repair the situation. In the long term we may gain the ability to
-	// auto-rollback or even try to resume some operations.
+	// The names of the volume groups and logical volumes are needed by
+	// the intents and pending operations cleaned up below
+	app.setLvmNamePrefix()
+
+	// Let the executor know which cluster each node belongs to
+	app.setHostClusters()
+	app.setHostResolution()
+	app.setCommandOutputRecording()
+
+	// Intents in the db are executor calls that heketi may have been
+	// terminated in the middle of. They are finished first, as cleaning
+	// up the pending operations may depend on their outcome.
+	if !app.dbReadOnly {
+		remaining, err := ResolveIntents(app.db, app.executor)
+		if err != nil {
+			logger.LogError("Unable to resolve intents: %v", err)
+		} else if remaining > 0 {
+			logger.LogError("Unable to resolve %v intents", remaining)
+		}
+	}
+
+	// Pending operations in the db mean heketi was uncleanly terminated
+	// during the op. The operations are rolled back, or resumed when they
+	// support it, before serving requests.
+	if HasPendingOperations(app.db) && !app.dbReadOnly {
+		remaining, err := CleanupPendingOperations(app.db, app.executor)
+		if err != nil {
+			logger.LogError("Unable to clean up pending operations: %v", err)
+		} else if remaining > 0 {
+			logger.LogError("Unable to clean up %v pending operations", remaining)
+		}
+	}
+
+	// Abort the application if pending operations remain in the db.
+	// We need to prevent incomplete operations from piling up in the db,
+	// so we refuse to start and provide offline tooling to repair the
+	// situation.
 	if HasPendingOperations(app.db) {
 		e := errors.New(
 			"Heketi terminated while performing one or more operations." +
@@ -162,6 +252,40 @@ func NewApp(configIo io.Reader) *App {
 
 	// Set block settings
 	app.setBlockSettings()
+	app.setVolumeSettings()
+
+	// Set request limits
+	app.setRequestLimits()
+
+	// Queue of the teardowns of deleted volumes
+	app.deletes = newDeleteQueue(DeleteQueueWorkers)
+
+	// Round robin turns of the cluster selection
+	app.clusters = &clusterSelector{}
+
+	// Endpoints of the events
+	app.events = newEventFeed(EventFeedSize)
+	app.setWebhooks()
+
+	// Limits of the concurrent operations
+	app.setThrottle()
+
+	// Deletes waiting for their confirmation when the server stopped
+	if !app.dbReadOnly {
+		if err := app.resumePendingDeletes(); err != nil {
+			logger.LogError("Unable to resume the pending deletes: %v", err)
+		}
+	}
+
+	app.startVolumeOptionsChecker()
+	app.startVolumeIOStatsSampler()
+	app.startCanary()
+	app.startCapacitySampler()
+	app.startBlockHostingVolumeReaper()
+	app.startBrickGc()
+	app.startNodeHealthChecker()
+	app.startDeviceHealthChecker()
+	app.startSnapshotOverheadRefresher()
 
 	// Show application has loaded
 	logger.Info("GlusterFS Application Loaded")
@@ -169,23 +293,68 @@ func NewApp(configIo io.Reader) *App {
 	return app
 }
 
+// runPeriodically calls fn every interval seconds until the app is closed
+func (a *App) runPeriodically(interval int, fn func()) {
+	if a.stop == nil {
+		a.stop = make(chan struct{})
+	}
+
+	go func(stop <-chan struct{}) {
+		ticker := time.NewTicker(time.Duration(interval) * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				fn()
+			case <-stop:
+				return
+			}
+		}
+	}(a.stop)
+}
+
 func (a *App) setLogLevel(level string) {
 	switch level {
-	case "none":
+	case api.LogLevelNone:
 		logger.SetLevel(utils.LEVEL_NOLOG)
-	case "critical":
+	case api.LogLevelCritical:
 		logger.SetLevel(utils.LEVEL_CRITICAL)
-	case "error":
+	case api.LogLevelError:
 		logger.SetLevel(utils.LEVEL_ERROR)
-	case "warning":
+	case api.LogLevelWarning:
 		logger.SetLevel(utils.LEVEL_WARNING)
-	case "info":
+	case api.LogLevelInfo:
 		logger.SetLevel(utils.LEVEL_INFO)
-	case "debug":
+	case api.LogLevelDebug:
 		logger.SetLevel(utils.LEVEL_DEBUG)
 	}
 }
 
+func (a *App) setHostClusters() {
+	mapper, ok := a.executor.(executors.HostClusterMapper)
+	if !ok {
+		return
+	}
+
+	err := a.db.View(func(tx *bolt.Tx) error {
+		nodes, err := NodeList(tx)
+		if err != nil {
+			return err
+		}
+		for _, id := range nodes {
+			node, err := NewNodeEntryFromId(tx, id)
+			if err != nil {
+				return err
+			}
+			mapper.SetHostCluster(node.ManageHostName(), node.Info.ClusterId)
+		}
+		return nil
+	})
+	if err != nil {
+		logger.LogError("Unable to map nodes to clusters: %v", err)
+	}
+}
+
 func (a *App) setFromEnvironmentalVariable() {
 	var err error
 	env := os.Getenv("HEKETI_AUTO_CREATE_BLOCK_HOSTING_VOLUME")
@@ -205,6 +374,41 @@ func (a *App) setFromEnvironmentalVariable() {
 	}
 }
 
+func (a *App) setLvmNamePrefix() {
+	if err := utils.ValidateLvmNamePrefix(a.conf.LvmNamePrefix); err != nil {
+		logger.LogError("Ignoring lvm_name_prefix: %v", err)
+		a.conf.LvmNamePrefix = ""
+	}
+
+	prefix := ""
+	var err error
+	if a.dbReadOnly {
+		err = a.db.View(func(tx *bolt.Tx) error {
+			entry, err := NewDbAttributeEntryFromKey(tx, DB_LVM_NAME_PREFIX)
+			if err == nil {
+				prefix = entry.Value
+			} else if err == ErrNotFound {
+				err = nil
+			}
+			return err
+		})
+	} else {
+		err = a.db.Update(func(tx *bolt.Tx) error {
+			var err error
+			prefix, err = recordLvmNamePrefix(tx, a.conf.LvmNamePrefix)
+			return err
+		})
+	}
+	if err != nil {
+		logger.LogError("Unable to get the lvm name prefix of the db: %v", err)
+	}
+	if prefix != a.conf.LvmNamePrefix {
+		logger.Warning("Ignoring lvm_name_prefix %v, the db uses %v",
+			a.conf.LvmNamePrefix, prefix)
+	}
+	utils.SetLvmNamePrefix(prefix)
+}
+
 func (a *App) setAdvSettings() {
 	if a.conf.BrickMaxNum != 0 {
 		logger.Info("Adv: Max bricks per volume set to %v", a.conf.BrickMaxNum)
@@ -226,6 +430,150 @@ func (a *App) setAdvSettings() {
 		// Convert to KB
 		BrickMinSize = uint64(a.conf.BrickMinSize) * 1024 * 1024
 	}
+	if a.conf.BrickMinSizeMb != 0 {
+		logger.Info("Adv: Min brick size %v MB", a.conf.BrickMinSizeMb)
+
+		// From volume_entry.go
+		// Convert to KB
+		BrickMinSize = uint64(a.conf.BrickMinSizeMb) * 1024
+	}
+	if len(a.conf.BrickMinSizeMbByDurability) != 0 {
+		sizes := map[api.DurabilityType]uint64{}
+		for t, mb := range a.conf.BrickMinSizeMbByDurability {
+			switch durability := api.DurabilityType(t); {
+			case durability != api.DurabilityReplicate &&
+				durability != api.DurabilityEC &&
+				durability != api.DurabilityDistributeOnly:
+				logger.LogError("Adv: Ignoring min brick size of unknown "+
+					"durability type %v", t)
+			case mb <= 0:
+				logger.LogError("Adv: Ignoring min brick size %v MB of %v "+
+					"volumes", mb, t)
+			default:
+				logger.Info("Adv: Min brick size of %v volumes %v MB", t, mb)
+				sizes[durability] = uint64(mb) * 1024
+			}
+		}
+		BrickMinSizeByDurability = sizes
+	}
+	switch a.conf.BrickZonePolicy {
+	case "":
+	case BrickZonePolicyNone, BrickZonePolicyBestEffort, BrickZonePolicyStrict:
+		logger.Info("Adv: Brick zone policy set to %v", a.conf.BrickZonePolicy)
+		BrickZonePolicy = a.conf.BrickZonePolicy
+	default:
+		logger.LogError("Adv: Ignoring unknown brick zone policy %v",
+			a.conf.BrickZonePolicy)
+	}
+	switch a.conf.ClusterSelectionPolicy {
+	case "":
+	case ClusterSelectionOrdered, ClusterSelectionFreeCapacity,
+		ClusterSelectionLeastVolumes, ClusterSelectionRoundRobin:
+		logger.Info("Adv: Cluster selection policy set to %v",
+			a.conf.ClusterSelectionPolicy)
+		ClusterSelectionPolicy = a.conf.ClusterSelectionPolicy
+	default:
+		logger.LogError("Adv: Ignoring unknown cluster selection policy %v",
+			a.conf.ClusterSelectionPolicy)
+	}
+	if a.conf.OperationHistoryDays > 0 {
+		logger.Info("Adv: Operation history kept for %v days",
+			a.conf.OperationHistoryDays)
+		OperationHistoryDays = a.conf.OperationHistoryDays
+	}
+	if a.conf.CommandOutputDays > 0 {
+		logger.Info("Adv: Output of failed commands kept for %v days",
+			a.conf.CommandOutputDays)
+		CommandOutputDays = a.conf.CommandOutputDays
+	}
+	if a.conf.AuditLogDays > 0 {
+		logger.Info("Adv: Audit log kept for %v days", a.conf.AuditLogDays)
+		AuditLogDays = a.conf.AuditLogDays
+	}
+	if a.conf.IdempotencyKeyHours > 0 {
+		logger.Info("Adv: Idempotency keys kept for %v hours",
+			a.conf.IdempotencyKeyHours)
+		IdempotencyKeyHours = a.conf.IdempotencyKeyHours
+	}
+	if a.conf.BrickRestartHealTimeout > 0 {
+		logger.Info("Adv: Heal timeout of brick restarts set to %v seconds",
+			a.conf.BrickRestartHealTimeout)
+		BrickRestartHealTimeout = a.conf.BrickRestartHealTimeout
+	}
+	if a.conf.BrickReplaceHealTimeout > 0 {
+		logger.Info("Adv: Heal timeout of brick replaces set to %v seconds",
+			a.conf.BrickReplaceHealTimeout)
+		BrickReplaceHealTimeout = a.conf.BrickReplaceHealTimeout
+	}
+	if a.conf.DeleteWorkers > 0 {
+		logger.Info("Adv: %v volumes torn down at the same time",
+			a.conf.DeleteWorkers)
+		DeleteQueueWorkers = a.conf.DeleteWorkers
+	}
+	if a.conf.NodeHealthCheckInterval > 0 {
+		logger.Info("Adv: Glusterd checked on every node every %v seconds",
+			a.conf.NodeHealthCheckInterval)
+		NodeHealthCheckInterval = a.conf.NodeHealthCheckInterval
+	}
+	if a.conf.DeviceHealthCheckInterval > 0 {
+		logger.Info("Adv: Devices of every online node checked every %v seconds",
+			a.conf.DeviceHealthCheckInterval)
+		DeviceHealthCheckInterval = a.conf.DeviceHealthCheckInterval
+	}
+	if a.conf.DeviceFailureTimeout > 0 {
+		logger.Info("Adv: Devices unreachable for %v seconds taken offline",
+			a.conf.DeviceFailureTimeout)
+		DeviceFailureTimeout = a.conf.DeviceFailureTimeout
+	}
+	if a.conf.SnapshotOverheadInterval > 0 {
+		logger.Info("Adv: Snapshot overhead of the devices refreshed every %v seconds",
+			a.conf.SnapshotOverheadInterval)
+		SnapshotOverheadInterval = a.conf.SnapshotOverheadInterval
+	}
+	if a.conf.DeviceAutoFailover {
+		logger.Info("Adv: Bricks of the unreachable devices replaced")
+		DeviceAutoFailover = a.conf.DeviceAutoFailover
+	}
+	if a.conf.DeleteConfirmationTimeout > 0 {
+		logger.Info("Adv: Volume deletes wait %v seconds for their confirmation",
+			a.conf.DeleteConfirmationTimeout)
+		DeleteConfirmationTimeout = a.conf.DeleteConfirmationTimeout
+	}
+	if a.conf.MaxOperations > 0 {
+		logger.Info("Adv: %v operations running at the same time",
+			a.conf.MaxOperations)
+		ThrottleMaxOperations = a.conf.MaxOperations
+	}
+	if a.conf.MaxClusterOperations > 0 {
+		logger.Info("Adv: %v operations running at the same time per cluster",
+			a.conf.MaxClusterOperations)
+		ThrottleMaxClusterOperations = a.conf.MaxClusterOperations
+	}
+	if a.conf.MaxNodeOperations > 0 {
+		logger.Info("Adv: %v operations running at the same time per node",
+			a.conf.MaxNodeOperations)
+		ThrottleMaxNodeOperations = a.conf.MaxNodeOperations
+	}
+	if a.conf.OperationQueueSize > 0 {
+		logger.Info("Adv: %v operations waiting to run at most",
+			a.conf.OperationQueueSize)
+		ThrottleQueueSize = a.conf.OperationQueueSize
+	}
+	if a.conf.OperationRetryAfter > 0 {
+		logger.Info("Adv: Requests rejected by a full queue retried after %v seconds",
+			a.conf.OperationRetryAfter)
+		ThrottleRetryAfter = a.conf.OperationRetryAfter
+	}
+	if a.conf.CapacitySampleInterval > 0 {
+		logger.Info("Adv: Capacity of the clusters sampled every %v seconds",
+			a.conf.CapacitySampleInterval)
+		CapacitySampleInterval = a.conf.CapacitySampleInterval
+	}
+	if a.conf.CapacityHistoryDays > 0 {
+		logger.Info("Adv: Capacity samples kept for %v days",
+			a.conf.CapacityHistoryDays)
+		CapacityHistoryDays = a.conf.CapacityHistoryDays
+	}
 }
 
 func (a *App) setBlockSettings() {
@@ -241,6 +589,97 @@ func (a *App) setBlockSettings() {
 		// Should be in GB as this is input for block hosting volume create
 		BlockHostingVolumeSize = a.conf.BlockHostingVolumeSize
 	}
+	if a.conf.DeleteBlockHostingVolumes {
+		logger.Info("Block: Auto Delete Block Hosting Volume set to %v", a.conf.DeleteBlockHostingVolumes)
+		DeleteBlockHostingVolumes = a.conf.DeleteBlockHostingVolumes
+	}
+	if a.conf.BlockHostingVolumeDeleteGrace > 0 {
+		logger.Info("Block: Empty Block Hosting Volume deleted after %v seconds", a.conf.BlockHostingVolumeDeleteGrace)
+		BlockHostingVolumeDeleteGrace = a.conf.BlockHostingVolumeDeleteGrace
+	}
+}
+
+func (a *App) setVolumeSettings() {
+	if a.conf.VolumeDefaultUid != 0 {
+		logger.Info("Volume: Default brick root owner uid set to %v", a.conf.VolumeDefaultUid)
+		VolumeDefaultUid = a.conf.VolumeDefaultUid
+	}
+	if a.conf.VolumeDefaultGid != 0 {
+		logger.Info("Volume: Default brick root group id set to %v", a.conf.VolumeDefaultGid)
+		VolumeDefaultGid = a.conf.VolumeDefaultGid
+	}
+	if a.conf.VolumeDefaultPermissions != "" {
+		if _, err := strconv.ParseUint(a.conf.VolumeDefaultPermissions, 8, 32); err != nil {
+			logger.LogError("Volume: Ignoring invalid default brick root permissions %v",
+				a.conf.VolumeDefaultPermissions)
+		} else {
+			logger.Info("Volume: Default brick root permissions set to %v", a.conf.VolumeDefaultPermissions)
+			VolumeDefaultPermissions = a.conf.VolumeDefaultPermissions
+		}
+	}
+	if a.conf.VolumeDefaultSelinuxContext != "" {
+		logger.Info("Volume: Default brick root SELinux context set to %v", a.conf.VolumeDefaultSelinuxContext)
+		VolumeDefaultSelinuxContext = a.conf.VolumeDefaultSelinuxContext
+	}
+	if a.conf.SelinuxBrickContext != "" {
+		logger.Info("Volume: SELinux context of checked bricks set to %v", a.conf.SelinuxBrickContext)
+		SelinuxBrickContext = a.conf.SelinuxBrickContext
+	}
+	if a.conf.SelinuxBooleans != nil {
+		logger.Info("Volume: SELinux booleans set to %v", a.conf.SelinuxBooleans)
+		SelinuxBooleans = a.conf.SelinuxBooleans
+	}
+	if a.conf.CanaryInterval > 0 {
+		logger.Info("Volume: Canary run every %v seconds", a.conf.CanaryInterval)
+		CanaryInterval = a.conf.CanaryInterval
+	}
+	if a.conf.BrickGcInterval > 0 {
+		logger.Info("Volume: Devices scanned for orphaned bricks every %v seconds", a.conf.BrickGcInterval)
+		BrickGcInterval = a.conf.BrickGcInterval
+	}
+	if a.conf.BrickGcCleanup {
+		logger.Info("Volume: Orphaned bricks found by the scans deleted")
+		BrickGcCleanup = a.conf.BrickGcCleanup
+	}
+	if a.conf.VolumeOptionsCheckInterval > 0 {
+		logger.Info("Volume: Options checked every %v seconds", a.conf.VolumeOptionsCheckInterval)
+		VolumeOptionsCheckInterval = a.conf.VolumeOptionsCheckInterval
+	}
+	if a.conf.VolumeIOStatsInterval > 0 {
+		logger.Info("Volume: IO sampled every %v seconds", a.conf.VolumeIOStatsInterval)
+		VolumeIOStatsInterval = a.conf.VolumeIOStatsInterval
+	}
+	if a.conf.VolumeIOStatsSamples > 0 {
+		logger.Info("Volume: %v IO samples kept", a.conf.VolumeIOStatsSamples)
+		VolumeIOStatsSamples = a.conf.VolumeIOStatsSamples
+	}
+}
+
+func (a *App) setRequestLimits() {
+	if a.conf.RequestMaxSize > 0 {
+		logger.Info("Limits: Max request size %v bytes", a.conf.RequestMaxSize)
+		RequestMaxSize = a.conf.RequestMaxSize
+	}
+	if a.conf.NameMaxLength > 0 {
+		logger.Info("Limits: Max name length %v", a.conf.NameMaxLength)
+		NameMaxLength = a.conf.NameMaxLength
+	}
+	if a.conf.VolumeMaxSize > 0 {
+		logger.Info("Limits: Max volume size %v GB", a.conf.VolumeMaxSize)
+		VolumeMaxSize = a.conf.VolumeMaxSize
+	}
+	if a.conf.ClustersMaxNum > 0 {
+		logger.Info("Limits: Max clusters per request %v", a.conf.ClustersMaxNum)
+		ClustersMaxNum = a.conf.ClustersMaxNum
+	}
+	if a.conf.HostnamesMaxNum > 0 {
+		logger.Info("Limits: Max hostnames per node %v", a.conf.HostnamesMaxNum)
+		HostnamesMaxNum = a.conf.HostnamesMaxNum
+	}
+	if a.conf.DbImportMaxSize > 0 {
+		logger.Info("Limits: Max db import size %v bytes", a.conf.DbImportMaxSize)
+		DbImportMaxSize = a.conf.DbImportMaxSize
+	}
 }
 
 // Register Routes
@@ -253,7 +692,7 @@ func (a *App) SetRoutes(router *mux.Router) error {
 			Name:        "Async",
 			Method:      "GET",
 			Pattern:     ASYNC_ROUTE + "/{id:[A-Fa-f0-9]+}",
-			HandlerFunc: a.asyncManager.HandlerStatus},
+			HandlerFunc: a.AsyncStatus},
 
 		// Cluster
 		rest.Route{
@@ -266,6 +705,111 @@ func (a *App) SetRoutes(router *mux.Router) error {
 			Method:      "POST",
 			Pattern:     "/clusters/{id:[A-Fa-f0-9]+}/flags",
 			HandlerFunc: a.ClusterSetFlags},
+		rest.Route{
+			Name:        "ClusterPutFlags",
+			Method:      "PUT",
+			Pattern:     "/clusters/{id:[A-Fa-f0-9]+}/flags",
+			HandlerFunc: a.ClusterSetFlags},
+		rest.Route{
+			Name:        "ClusterSetStandby",
+			Method:      "POST",
+			Pattern:     "/clusters/{id:[A-Fa-f0-9]+}/standby",
+			HandlerFunc: a.ClusterSetStandby},
+		rest.Route{
+			Name:        "ClusterPromote",
+			Method:      "POST",
+			Pattern:     "/clusters/{id:[A-Fa-f0-9]+}/promote",
+			HandlerFunc: a.ClusterPromote},
+		rest.Route{
+			Name:        "ClusterPeerRepair",
+			Method:      "POST",
+			Pattern:     "/clusters/{id:[A-Fa-f0-9]+}/peers/repair",
+			HandlerFunc: a.ClusterPeerRepair},
+		rest.Route{
+			Name:        "ClusterPeerRepairResult",
+			Method:      "GET",
+			Pattern:     "/clusters/{id:[A-Fa-f0-9]+}/peers/repair",
+			HandlerFunc: a.ClusterPeerRepairResult},
+		rest.Route{
+			Name:        "ClusterOptions",
+			Method:      "GET",
+			Pattern:     "/clusters/{id:[A-Fa-f0-9]+}/options",
+			HandlerFunc: a.ClusterOptions},
+		rest.Route{
+			Name:        "ClusterSetOptions",
+			Method:      "PUT",
+			Pattern:     "/clusters/{id:[A-Fa-f0-9]+}/options",
+			HandlerFunc: a.ClusterSetOptions},
+		rest.Route{
+			Name:        "ClusterCanary",
+			Method:      "POST",
+			Pattern:     "/clusters/{id:[A-Fa-f0-9]+}/canary",
+			HandlerFunc: a.ClusterCanary},
+		rest.Route{
+			Name:        "ClusterCanaryResult",
+			Method:      "GET",
+			Pattern:     "/clusters/{id:[A-Fa-f0-9]+}/canary",
+			HandlerFunc: a.ClusterCanaryResult},
+		rest.Route{
+			Name:        "ClusterRebalance",
+			Method:      "POST",
+			Pattern:     "/clusters/{id:[A-Fa-f0-9]+}/rebalance",
+			HandlerFunc: a.ClusterRebalance},
+		rest.Route{
+			Name:        "ClusterZoneRebalance",
+			Method:      "POST",
+			Pattern:     "/clusters/{id:[A-Fa-f0-9]+}/zones/rebalance",
+			HandlerFunc: a.ClusterZoneRebalance},
+		rest.Route{
+			Name:        "ClusterPlacementScores",
+			Method:      "GET",
+			Pattern:     "/clusters/{id:[A-Fa-f0-9]+}/scores",
+			HandlerFunc: a.ClusterPlacementScores},
+		rest.Route{
+			Name:        "ClusterCapacityForecast",
+			Method:      "GET",
+			Pattern:     "/clusters/{id:[A-Fa-f0-9]+}/forecast",
+			HandlerFunc: a.ClusterCapacityForecast},
+		rest.Route{
+			Name:        "StorageClassReport",
+			Method:      "POST",
+			Pattern:     "/storageclass/report",
+			HandlerFunc: a.StorageClassReport},
+		rest.Route{
+			Name:        "CapacityReport",
+			Method:      "GET",
+			Pattern:     "/capacity",
+			HandlerFunc: a.CapacityReport},
+		rest.Route{
+			Name:        "TopologyLoad",
+			Method:      "POST",
+			Pattern:     "/topology",
+			HandlerFunc: a.TopologyLoad},
+		rest.Route{
+			Name:        "TopologyLoadResult",
+			Method:      "GET",
+			Pattern:     "/topology/load",
+			HandlerFunc: a.TopologyLoadResult},
+		rest.Route{
+			Name:        "TopologyDiff",
+			Method:      "POST",
+			Pattern:     "/topology/diff",
+			HandlerFunc: a.TopologyDiff},
+		rest.Route{
+			Name:        "TopologyDiffResult",
+			Method:      "GET",
+			Pattern:     "/topology/diff",
+			HandlerFunc: a.TopologyDiffResult},
+		rest.Route{
+			Name:        "PlacementPolicyExport",
+			Method:      "GET",
+			Pattern:     "/placementpolicy",
+			HandlerFunc: a.PlacementPolicyExport},
+		rest.Route{
+			Name:        "PlacementPolicyImport",
+			Method:      "PUT",
+			Pattern:     "/placementpolicy",
+			HandlerFunc: a.PlacementPolicyImport},
 		rest.Route{
 			Name:        "ClusterInfo",
 			Method:      "GET",
@@ -303,6 +847,31 @@ func (a *App) SetRoutes(router *mux.Router) error {
 			Method:      "POST",
 			Pattern:     "/nodes/{id:[A-Fa-f0-9]+}/state",
 			HandlerFunc: a.NodeSetState},
+		rest.Route{
+			Name:        "NodeSetTags",
+			Method:      "POST",
+			Pattern:     "/nodes/{id:[A-Fa-f0-9]+}/tags",
+			HandlerFunc: a.NodeSetTags},
+		rest.Route{
+			Name:        "NodeRemove",
+			Method:      "POST",
+			Pattern:     "/nodes/{id:[A-Fa-f0-9]+}/remove",
+			HandlerFunc: a.NodeRemove},
+		rest.Route{
+			Name:        "NodeRemoveStatus",
+			Method:      "GET",
+			Pattern:     "/nodes/{id:[A-Fa-f0-9]+}/remove",
+			HandlerFunc: a.NodeRemoveStatus},
+		rest.Route{
+			Name:        "NodeRestartBricks",
+			Method:      "POST",
+			Pattern:     "/nodes/{id:[A-Fa-f0-9]+}/restart-bricks",
+			HandlerFunc: a.NodeRestartBricks},
+		rest.Route{
+			Name:        "NodeRestartBricksStatus",
+			Method:      "GET",
+			Pattern:     "/nodes/{id:[A-Fa-f0-9]+}/restart-bricks",
+			HandlerFunc: a.NodeRestartBricksStatus},
 
 		// Devices
 		rest.Route{
@@ -325,11 +894,41 @@ func (a *App) SetRoutes(router *mux.Router) error {
 			Method:      "POST",
 			Pattern:     "/devices/{id:[A-Fa-f0-9]+}/state",
 			HandlerFunc: a.DeviceSetState},
+		rest.Route{
+			Name:        "DeviceSetTags",
+			Method:      "POST",
+			Pattern:     "/devices/{id:[A-Fa-f0-9]+}/tags",
+			HandlerFunc: a.DeviceSetTags},
+		rest.Route{
+			Name:        "DeviceSetEnclosure",
+			Method:      "POST",
+			Pattern:     "/devices/{id:[A-Fa-f0-9]+}/enclosure",
+			HandlerFunc: a.DeviceSetEnclosure},
+		rest.Route{
+			Name:        "DeviceRemove",
+			Method:      "POST",
+			Pattern:     "/devices/{id:[A-Fa-f0-9]+}/remove",
+			HandlerFunc: a.DeviceRemove},
+		rest.Route{
+			Name:        "DeviceReplaceBricks",
+			Method:      "POST",
+			Pattern:     "/devices/{id:[A-Fa-f0-9]+}/bricks/replace",
+			HandlerFunc: a.DeviceReplaceBricks},
 		rest.Route{
 			Name:        "DeviceResync",
 			Method:      "GET",
 			Pattern:     "/devices/{id:[A-Fa-f0-9]+}/resync",
 			HandlerFunc: a.DeviceResync},
+		rest.Route{
+			Name:        "DeviceResyncReport",
+			Method:      "POST",
+			Pattern:     "/devices/{id:[A-Fa-f0-9]+}/resync",
+			HandlerFunc: a.DeviceResyncReport},
+		rest.Route{
+			Name:        "DeviceLvm",
+			Method:      "GET",
+			Pattern:     "/devices/{id:[A-Fa-f0-9]+}/lvm",
+			HandlerFunc: a.DeviceLvm},
 
 		// Volume
 		rest.Route{
@@ -337,27 +936,158 @@ func (a *App) SetRoutes(router *mux.Router) error {
 			Method:      "POST",
 			Pattern:     "/volumes",
 			HandlerFunc: a.VolumeCreate},
+		rest.Route{
+			Name:        "VolumeSimulate",
+			Method:      "POST",
+			Pattern:     "/volumes/simulate",
+			HandlerFunc: a.VolumeSimulate},
+		rest.Route{
+			Name:        "VolumeSearch",
+			Method:      "GET",
+			Pattern:     "/volumes/search",
+			HandlerFunc: a.VolumeSearch},
 		rest.Route{
 			Name:        "VolumeInfo",
 			Method:      "GET",
-			Pattern:     "/volumes/{id:[A-Fa-f0-9]+}",
-			HandlerFunc: a.VolumeInfo},
+			Pattern:     "/volumes/{id:[A-Fa-f0-9-]+}",
+			HandlerFunc: a.withVolumeGlusterId(a.VolumeInfo)},
 		rest.Route{
 			Name:        "VolumeExpand",
 			Method:      "POST",
-			Pattern:     "/volumes/{id:[A-Fa-f0-9]+}/expand",
-			HandlerFunc: a.VolumeExpand},
+			Pattern:     "/volumes/{id:[A-Fa-f0-9-]+}/expand",
+			HandlerFunc: a.withVolumeGlusterId(a.VolumeExpand)},
+		rest.Route{
+			Name:        "VolumeRestore",
+			Method:      "POST",
+			Pattern:     "/volumes/{id:[A-Fa-f0-9-]+}/restore",
+			HandlerFunc: a.withVolumeGlusterId(a.VolumeRestore)},
+		rest.Route{
+			Name:        "VolumeOptionsCheck",
+			Method:      "POST",
+			Pattern:     "/volumes/{id:[A-Fa-f0-9-]+}/options/check",
+			HandlerFunc: a.withVolumeGlusterId(a.VolumeOptionsCheck)},
+		rest.Route{
+			Name:        "VolumeBrickOrderCheck",
+			Method:      "POST",
+			Pattern:     "/volumes/{id:[A-Fa-f0-9-]+}/bricks/check",
+			HandlerFunc: a.withVolumeGlusterId(a.VolumeBrickOrderCheck)},
+		rest.Route{
+			Name:        "VolumeHealInfo",
+			Method:      "GET",
+			Pattern:     "/volumes/{id:[A-Fa-f0-9-]+}/healinfo",
+			HandlerFunc: a.withVolumeGlusterId(a.VolumeHealInfo)},
+		rest.Route{
+			Name:        "VolumeSetOptions",
+			Method:      "PUT",
+			Pattern:     "/volumes/{id:[A-Fa-f0-9-]+}/options",
+			HandlerFunc: a.withVolumeGlusterId(a.VolumeSetOptions)},
+		rest.Route{
+			Name:        "VolumeSetQuota",
+			Method:      "PUT",
+			Pattern:     "/volumes/{id:[A-Fa-f0-9-]+}/quota",
+			HandlerFunc: a.withVolumeGlusterId(a.VolumeSetQuota)},
+		rest.Route{
+			Name:        "VolumeIOStats",
+			Method:      "GET",
+			Pattern:     "/volumes/{id:[A-Fa-f0-9-]+}/iostats",
+			HandlerFunc: a.withVolumeGlusterId(a.VolumeIOStats)},
 		rest.Route{
 			Name:        "VolumeDelete",
 			Method:      "DELETE",
-			Pattern:     "/volumes/{id:[A-Fa-f0-9]+}",
-			HandlerFunc: a.VolumeDelete},
+			Pattern:     "/volumes/{id:[A-Fa-f0-9-]+}",
+			HandlerFunc: a.withVolumeGlusterId(a.VolumeDelete)},
+		rest.Route{
+			Name:        "VolumeDeleteConfirm",
+			Method:      "POST",
+			Pattern:     "/volumes/{id:[A-Fa-f0-9-]+}/delete/confirm",
+			HandlerFunc: a.withVolumeGlusterId(a.VolumeDeleteConfirm)},
+		rest.Route{
+			Name:        "VolumeDeleteCancel",
+			Method:      "POST",
+			Pattern:     "/volumes/{id:[A-Fa-f0-9-]+}/delete/cancel",
+			HandlerFunc: a.withVolumeGlusterId(a.VolumeDeleteCancel)},
 		rest.Route{
 			Name:        "VolumeList",
 			Method:      "GET",
 			Pattern:     "/volumes",
 			HandlerFunc: a.VolumeList},
 
+		// Snapshots
+		rest.Route{
+			Name:        "SnapshotCreate",
+			Method:      "POST",
+			Pattern:     "/volumes/{id:[A-Fa-f0-9-]+}/snapshot",
+			HandlerFunc: a.withVolumeGlusterId(a.SnapshotCreate)},
+		rest.Route{
+			Name:        "VolumeSnapshotList",
+			Method:      "GET",
+			Pattern:     "/volumes/{id:[A-Fa-f0-9-]+}/snapshots",
+			HandlerFunc: a.withVolumeGlusterId(a.VolumeSnapshotList)},
+		rest.Route{
+			Name:        "SnapshotInfo",
+			Method:      "GET",
+			Pattern:     "/snapshots/{id:[A-Fa-f0-9]+}",
+			HandlerFunc: a.SnapshotInfo},
+		rest.Route{
+			Name:        "SnapshotDelete",
+			Method:      "DELETE",
+			Pattern:     "/snapshots/{id:[A-Fa-f0-9]+}",
+			HandlerFunc: a.SnapshotDelete},
+		rest.Route{
+			Name:        "SnapshotClone",
+			Method:      "POST",
+			Pattern:     "/snapshots/{id:[A-Fa-f0-9]+}/clone",
+			HandlerFunc: a.SnapshotClone},
+
+		// Replications
+		rest.Route{
+			Name:        "ReplicationCreate",
+			Method:      "POST",
+			Pattern:     "/volumes/{id:[A-Fa-f0-9-]+}/replication",
+			HandlerFunc: a.withVolumeGlusterId(a.ReplicationCreate)},
+		rest.Route{
+			Name:        "ReplicationList",
+			Method:      "GET",
+			Pattern:     "/replications",
+			HandlerFunc: a.ReplicationList},
+		rest.Route{
+			Name:        "ReplicationInfo",
+			Method:      "GET",
+			Pattern:     "/replications/{id:[A-Fa-f0-9]+}",
+			HandlerFunc: a.ReplicationInfo},
+		rest.Route{
+			Name:        "ReplicationFailover",
+			Method:      "POST",
+			Pattern:     "/replications/{id:[A-Fa-f0-9]+}/failover",
+			HandlerFunc: a.ReplicationFailover},
+		rest.Route{
+			Name:        "ReplicationPromote",
+			Method:      "POST",
+			Pattern:     "/replications/{id:[A-Fa-f0-9]+}/promote",
+			HandlerFunc: a.ReplicationPromote},
+		rest.Route{
+			Name:        "ReplicationDelete",
+			Method:      "DELETE",
+			Pattern:     "/replications/{id:[A-Fa-f0-9]+}",
+			HandlerFunc: a.ReplicationDelete},
+
+		// Bricks
+		rest.Route{
+			Name:        "BrickList",
+			Method:      "GET",
+			Pattern:     "/bricks",
+			HandlerFunc: a.BrickList},
+		rest.Route{
+			Name:        "BrickReplace",
+			Method:      "POST",
+			Pattern:     "/bricks/{id:[A-Fa-f0-9]+}/replace",
+			HandlerFunc: a.BrickReplace},
+		rest.Route{
+			Name:        "BrickGc",
+			Method:      "POST",
+			Pattern:     "/bricks/gc",
+			HandlerFunc: a.BrickGc},
+
 		// BlockVolumes
 		rest.Route{
 			Name:        "BlockVolumeCreate",
@@ -374,11 +1104,41 @@ func (a *App) SetRoutes(router *mux.Router) error {
 			Method:      "DELETE",
 			Pattern:     "/blockvolumes/{id:[A-Fa-f0-9]+}",
 			HandlerFunc: a.BlockVolumeDelete},
+		rest.Route{
+			Name:        "BlockVolumeExpand",
+			Method:      "PUT",
+			Pattern:     "/blockvolumes/{id:[A-Fa-f0-9]+}/expand",
+			HandlerFunc: a.BlockVolumeExpand},
+		rest.Route{
+			Name:        "BlockVolumeClone",
+			Method:      "POST",
+			Pattern:     "/blockvolumes/{id:[A-Fa-f0-9]+}/clone",
+			HandlerFunc: a.BlockVolumeClone},
+		rest.Route{
+			Name:        "BlockVolumeAuthRotate",
+			Method:      "POST",
+			Pattern:     "/blockvolumes/{id:[A-Fa-f0-9]+}/auth/rotate",
+			HandlerFunc: a.BlockVolumeAuthRotate},
+		rest.Route{
+			Name:        "BlockVolumeHaCount",
+			Method:      "POST",
+			Pattern:     "/blockvolumes/{id:[A-Fa-f0-9]+}/hacount",
+			HandlerFunc: a.BlockVolumeHaCount},
 		rest.Route{
 			Name:        "BlockVolumeList",
 			Method:      "GET",
 			Pattern:     "/blockvolumes",
 			HandlerFunc: a.BlockVolumeList},
+		rest.Route{
+			Name:        "BlockVolumeReconcile",
+			Method:      "POST",
+			Pattern:     "/blockvolumes/reconcile",
+			HandlerFunc: a.BlockVolumeReconcile},
+		rest.Route{
+			Name:        "BlockVolumeReconcileResult",
+			Method:      "GET",
+			Pattern:     "/blockvolumes/reconcile",
+			HandlerFunc: a.BlockVolumeReconcileResult},
 
 		// Backup
 		rest.Route{
@@ -393,20 +1153,122 @@ func (a *App) SetRoutes(router *mux.Router) error {
 			Method:      "GET",
 			Pattern:     "/db/dump",
 			HandlerFunc: a.DbDump},
+		rest.Route{
+			Name:        "DbStats",
+			Method:      "GET",
+			Pattern:     "/db/stats",
+			HandlerFunc: a.DbStats},
+		rest.Route{
+			Name:        "DbCheck",
+			Method:      "GET",
+			Pattern:     "/db/check",
+			HandlerFunc: a.DbCheck},
+
+		// Operations
+		rest.Route{
+			Name:        "OperationList",
+			Method:      "GET",
+			Pattern:     "/operations",
+			HandlerFunc: a.OperationList},
+		rest.Route{
+			Name:        "OperationHistory",
+			Method:      "GET",
+			Pattern:     "/operations/history",
+			HandlerFunc: a.OperationHistory},
+		rest.Route{
+			Name:        "CommandOutputList",
+			Method:      "GET",
+			Pattern:     "/operations/outputs",
+			HandlerFunc: a.CommandOutputList},
+		rest.Route{
+			Name:        "CommandOutputInfo",
+			Method:      "GET",
+			Pattern:     "/operations/outputs/{id:[A-Fa-f0-9]+}",
+			HandlerFunc: a.CommandOutputInfo},
+
+		// Audit log
+		rest.Route{
+			Name:        "AuditLog",
+			Method:      "GET",
+			Pattern:     "/auditlog",
+			HandlerFunc: a.AuditLog},
+
+		// Tenants
+		rest.Route{
+			Name:        "TenantList",
+			Method:      "GET",
+			Pattern:     "/tenants",
+			HandlerFunc: a.TenantList},
+		rest.Route{
+			Name:        "TenantSet",
+			Method:      "PUT",
+			Pattern:     "/tenants/{name:[a-zA-Z0-9_.@-]+}",
+			HandlerFunc: a.TenantSet},
+		rest.Route{
+			Name:        "TenantInfo",
+			Method:      "GET",
+			Pattern:     "/tenants/{name:[a-zA-Z0-9_.@-]+}",
+			HandlerFunc: a.TenantInfo},
+		rest.Route{
+			Name:        "TenantUsage",
+			Method:      "GET",
+			Pattern:     "/tenants/{name:[a-zA-Z0-9_.@-]+}/usage",
+			HandlerFunc: a.TenantUsage},
+
+		// Events
+		rest.Route{
+			Name:        "EventList",
+			Method:      "GET",
+			Pattern:     "/events",
+			HandlerFunc: a.EventList},
+		rest.Route{
+			Name:        "TenantDelete",
+			Method:      "DELETE",
+			Pattern:     "/tenants/{name:[a-zA-Z0-9_.@-]+}",
+			HandlerFunc: a.TenantDelete},
+
+		// Logging
+		rest.Route{
+			Name:        "LogLevel",
+			Method:      "GET",
+			Pattern:     "/admin/logging",
+			HandlerFunc: a.LogLevel},
+		rest.Route{
+			Name:        "LogLevelSet",
+			Method:      "PUT",
+			Pattern:     "/admin/logging",
+			HandlerFunc: a.LogLevelSet},
 	}
 
 	// Register all routes from the App
 	for _, route := range routes {
 
+		// The requests changing the state of the server are audited
+		var handler http.Handler = route.HandlerFunc
+		if route.Method != "GET" {
+			handler = a.auditHandler(route.Name, true, handler)
+		}
+
 		// Add routes from the table
 		router.
 			Methods(route.Method).
 			Path(route.Pattern).
 			Name(route.Name).
-			Handler(route.HandlerFunc)
+			Handler(requestIdHandler(
+				limitRequestSize(handler, &RequestMaxSize)))
 
 	}
 
+	// The db import takes the dump of a whole db
+	router.
+		Methods("POST").
+		Path("/db/import").
+		Name("DbImport").
+		Handler(requestIdHandler(
+			limitRequestSize(
+				a.auditHandler("DbImport", false, http.HandlerFunc(a.DbImport)),
+				&DbImportMaxSize)))
+
 	// Set default error handler
 	router.NotFoundHandler = http.HandlerFunc(a.NotFoundHandler)
 
@@ -415,6 +1277,14 @@ func (a *App) SetRoutes(router *mux.Router) error {
 
 func (a *App) Close() {
 
+	if a.stop != nil {
+		close(a.stop)
+	}
+
+	if a.webhooks != nil {
+		a.webhooks.close()
+	}
+
 	// Close the DB
 	a.db.Close()
 	logger.Info("Closed")
@@ -472,18 +1342,19 @@ func (a *App) ClearAllocator() {
 // newAllocator returns a newly created allocator based on the
 // configuration of the app.
 func (a *App) newAllocator() Allocator {
-	var alloc Allocator
-	switch {
-	case a.conf.Allocator == "simple" || a.conf.Allocator == "":
-		a.conf.Allocator = "simple"
-		if r := NewSimpleAllocator(); r != nil {
-			alloc = r
-		} else {
-			panic(errors.New("failed to set up simple allocator"))
-		}
-	default:
-		panic(errors.New("cannot load invalid allocator: " + a.conf.Allocator))
+	alloc, err := NewAllocator(a.AllocatorName())
+	if err != nil {
+		panic(fmt.Errorf("cannot load allocator: %v", err))
 	}
-	logger.Info("Loaded %v allocator", a.conf.Allocator)
+	logger.Info("Loaded %v allocator", a.AllocatorName())
 	return alloc
 }
+
+// AllocatorName returns the name of the allocator selected in
+// the configuration of this app.
+func (a *App) AllocatorName() string {
+	if a.conf.Allocator == "" {
+		return DefaultAllocator
+	}
+	return a.conf.Allocator
+}
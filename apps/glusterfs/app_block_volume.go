@@ -22,6 +22,12 @@ import (
 
 func (a *App) BlockVolumeCreate(w http.ResponseWriter, r *http.Request) {
 
+	idem, ok := a.idempotentRequest(w, r, idempotentBlockVolume)
+	if !ok {
+		return
+	}
+	defer idem.done()
+
 	var msg api.BlockVolumeCreateRequest
 	err := utils.GetJsonFromRequest(r, &msg)
 	if err != nil {
@@ -30,15 +36,18 @@ func (a *App) BlockVolumeCreate(w http.ResponseWriter, r *http.Request) {
 	}
 
 	err = msg.Validate()
+	if err == nil {
+		err = validateBlockVolumeCreateLimits(&msg)
+	}
 	if err != nil {
 		http.Error(w, "validation failed: "+err.Error(), http.StatusBadRequest)
-		logger.LogError("validation failed: " + err.Error())
+		requestLogger(r).LogError("validation failed: " + err.Error())
 		return
 	}
 
-	if msg.Size < 1 {
+	if msg.Size < 1 && msg.SizeMiB < 1 {
 		http.Error(w, "Invalid volume size", http.StatusBadRequest)
-		logger.LogError("Invalid volume size")
+		requestLogger(r).LogError("Invalid volume size")
 		return
 	}
 
@@ -53,7 +62,7 @@ func (a *App) BlockVolumeCreate(w http.ResponseWriter, r *http.Request) {
 			return err
 		}
 		if len(clusters) == 0 {
-			err := logger.LogError("No clusters configured")
+			err := requestLogger(r).LogError("No clusters configured")
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return ErrNotFound
 		}
@@ -62,7 +71,7 @@ func (a *App) BlockVolumeCreate(w http.ResponseWriter, r *http.Request) {
 		for _, clusterid := range msg.Clusters {
 			_, err := NewClusterEntryFromId(tx, clusterid)
 			if err != nil {
-				err := logger.LogError("Cluster id %v not found", clusterid)
+				err := requestLogger(r).LogError("Cluster id %v not found", clusterid)
 				http.Error(w, err.Error(), http.StatusBadRequest)
 				return err
 			}
@@ -76,23 +85,39 @@ func (a *App) BlockVolumeCreate(w http.ResponseWriter, r *http.Request) {
 
 	blockVolume := NewBlockVolumeEntryFromRequest(&msg)
 
+	tenant, ok := a.requestTenant(w, r)
+	if !ok {
+		return
+	}
+	blockVolume.Info.Tenant = tenant
+
 	bvc := NewBlockVolumeCreateOperation(blockVolume, a.db)
 	if err := AsyncHttpOperation(a, w, r, bvc); err != nil {
+		if tenantQuotaExceeded(w, err) {
+			return
+		}
 		http.Error(w,
 			fmt.Sprintf("Failed to allocate new block volume: %v", err),
 			http.StatusInternalServerError)
 		return
 	}
+	idem.record(a.db, blockVolume.Info.Id)
 }
 
 func (a *App) BlockVolumeList(w http.ResponseWriter, r *http.Request) {
 
+	opts, err := listOptions(r, "cluster", "name", "volume")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	var list api.BlockVolumeListResponse
 
-	err := a.db.View(func(tx *bolt.Tx) error {
+	err = a.db.View(func(tx *bolt.Tx) error {
 		var err error
 
-		list.BlockVolumes, err = ListCompleteBlockVolumes(tx)
+		list.BlockVolumes, list.Total, err = ListBlockVolumes(tx, opts)
 		if err != nil {
 			return err
 		}
@@ -101,7 +126,7 @@ func (a *App) BlockVolumeList(w http.ResponseWriter, r *http.Request) {
 	})
 
 	if err != nil {
-		logger.Err(err)
+		requestLogger(r).Err(err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -174,10 +199,311 @@ func (a *App) BlockVolumeDelete(w http.ResponseWriter, r *http.Request) {
 	}
 
 	vdel := NewBlockVolumeDeleteOperation(blockVolume, a.db)
-	if err := AsyncHttpOperation(a, w, r, vdel); err != nil {
+	if err := a.asyncHttpQueuedDelete(w, r, blockVolume.Info.Id, vdel); err != nil {
+		if err == ErrConflict {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
 		http.Error(w,
 			fmt.Sprintf("Failed to set up block volume delete: %v", err),
 			http.StatusInternalServerError)
 		return
 	}
 }
+
+func (a *App) BlockVolumeExpand(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	var msg api.BlockVolumeExpandRequest
+	err := utils.GetJsonFromRequest(r, &msg)
+	if err != nil {
+		http.Error(w, "request unable to be parsed", 422)
+		return
+	}
+
+	err = msg.Validate()
+	if err == nil {
+		err = validateBlockVolumeExpandLimits(&msg)
+	}
+	if err != nil {
+		http.Error(w, "validation failed: "+err.Error(), http.StatusBadRequest)
+		requestLogger(r).LogError("validation failed: " + err.Error())
+		return
+	}
+
+	var blockVolume *BlockVolumeEntry
+	err = a.db.View(func(tx *bolt.Tx) error {
+		var err error
+		blockVolume, err = NewBlockVolumeEntryFromId(tx, id)
+		if err == ErrNotFound || !blockVolume.Visible() {
+			http.Error(w, "Id not found", http.StatusNotFound)
+			return ErrNotFound
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	if msg.NewSize <= blockVolume.Info.Size {
+		err := requestLogger(r).LogError("New size %v GiB of block volume %v "+
+			"must be larger than its size %v GiB",
+			msg.NewSize, id, blockVolume.Info.Size)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	bve := NewBlockVolumeExpandOperation(blockVolume, a.db,
+		msg.NewSize-blockVolume.Info.Size)
+	if err := AsyncHttpOperation(a, w, r, bve); err != nil {
+		if tenantQuotaExceeded(w, err) {
+			return
+		}
+		if err == ErrConflict {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if err == ErrNoSpace {
+			http.Error(w,
+				"Block hosting volume does not have enough free space",
+				http.StatusConflict)
+			return
+		}
+		http.Error(w,
+			fmt.Sprintf("Failed to expand block volume: %v", err),
+			http.StatusInternalServerError)
+		return
+	}
+}
+
+func (a *App) BlockVolumeClone(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	var msg api.BlockVolumeCloneRequest
+	err := utils.GetJsonFromRequest(r, &msg)
+	if err != nil {
+		http.Error(w, "request unable to be parsed", 422)
+		return
+	}
+
+	err = msg.Validate()
+	if err == nil {
+		err = validateBlockVolumeCloneLimits(&msg)
+	}
+	if err != nil {
+		http.Error(w, "validation failed: "+err.Error(), http.StatusBadRequest)
+		requestLogger(r).LogError("validation failed: " + err.Error())
+		return
+	}
+
+	var blockVolume *BlockVolumeEntry
+	err = a.db.View(func(tx *bolt.Tx) error {
+		var err error
+		blockVolume, err = NewBlockVolumeEntryFromId(tx, id)
+		if err == ErrNotFound || (err == nil && !blockVolume.Visible()) {
+			http.Error(w, "Id not found", http.StatusNotFound)
+			return ErrNotFound
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	requestLogger(r).Info("Cloning block volume %v", id)
+	bvc := NewBlockVolumeCloneOperation(blockVolume, &msg, a.db)
+	if err := AsyncHttpOperation(a, w, r, bvc); err != nil {
+		if tenantQuotaExceeded(w, err) {
+			return
+		}
+		if err == ErrConflict {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if err == ErrNoSpace {
+			http.Error(w,
+				"Block hosting volume does not have enough free space",
+				http.StatusConflict)
+			return
+		}
+		http.Error(w,
+			fmt.Sprintf("Failed to clone block volume: %v", err),
+			http.StatusInternalServerError)
+		return
+	}
+}
+
+func (a *App) BlockVolumeAuthRotate(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	err := a.db.View(func(tx *bolt.Tx) error {
+		blockVolume, err := NewBlockVolumeEntryFromId(tx, id)
+		if err == ErrNotFound || (err == nil && !blockVolume.Visible()) {
+			http.Error(w, "Id not found", http.StatusNotFound)
+			return ErrNotFound
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	requestLogger(r).Info("Rotating credentials of block volume %v", id)
+	blockVolume, err := RotateBlockVolumeAuth(a.db, a.requestExecutor(r), id)
+	switch {
+	case err == ErrAuthDisabled:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case err == ErrConflict:
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w,
+			fmt.Sprintf("Failed to rotate block volume credentials: %v", err),
+			http.StatusInternalServerError)
+		return
+	}
+
+	var info *api.BlockVolumeInfoResponse
+	err = a.db.View(func(tx *bolt.Tx) error {
+		var err error
+		info, err = blockVolume.NewInfoResponse(tx)
+		return err
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(info); err != nil {
+		panic(err)
+	}
+}
+
+func (a *App) BlockVolumeHaCount(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	var msg api.BlockVolumeHaCountRequest
+	err := utils.GetJsonFromRequest(r, &msg)
+	if err != nil {
+		http.Error(w, "request unable to be parsed", 422)
+		return
+	}
+
+	err = msg.Validate()
+	if err != nil {
+		http.Error(w, "validation failed: "+err.Error(), http.StatusBadRequest)
+		requestLogger(r).LogError("validation failed: " + err.Error())
+		return
+	}
+
+	err = a.db.View(func(tx *bolt.Tx) error {
+		blockVolume, err := NewBlockVolumeEntryFromId(tx, id)
+		if err == ErrNotFound || (err == nil && !blockVolume.Visible()) {
+			http.Error(w, "Id not found", http.StatusNotFound)
+			return ErrNotFound
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	requestLogger(r).Info("Changing hacount of block volume %v to %v", id, msg.Hacount)
+	blockVolume, err := UpdateBlockVolumeHaCount(a.db, a.requestExecutor(r), id, &msg)
+	if _, ok := err.(*blockHostsError); ok {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if err == ErrConflict {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	} else if err != nil {
+		http.Error(w,
+			fmt.Sprintf("Failed to change block volume hacount: %v", err),
+			http.StatusInternalServerError)
+		return
+	}
+
+	var info *api.BlockVolumeInfoResponse
+	err = a.db.View(func(tx *bolt.Tx) error {
+		var err error
+		info, err = blockVolume.NewInfoResponse(tx)
+		return err
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(info); err != nil {
+		panic(err)
+	}
+}
+
+func (a *App) BlockVolumeReconcile(w http.ResponseWriter, r *http.Request) {
+
+	var msg api.BlockVolumeReconcileRequest
+	err := utils.GetJsonFromRequest(r, &msg)
+	if err != nil {
+		http.Error(w, "request unable to be parsed", 422)
+		return
+	}
+
+	err = msg.Validate()
+	if err != nil {
+		http.Error(w, "validation failed: "+err.Error(), http.StatusBadRequest)
+		requestLogger(r).LogError("validation failed: " + err.Error())
+		return
+	}
+
+	if !a.blockReconcile.start() {
+		http.Error(w, "A block volume reconcile is in progress", http.StatusConflict)
+		return
+	}
+
+	requestLogger(r).Info("Reconciling block volumes [action: %v]", msg.Action)
+	a.asyncHttpRedirectFunc(w, r, func() (string, error) {
+		resp, err := ReconcileBlockVolumes(a.db, a.requestExecutor(r), msg.Action)
+		a.blockReconcile.finish(resp)
+		if err != nil {
+			return "", err
+		}
+		requestLogger(r).Info("Reconciled %v block hosting volumes", len(resp.Volumes))
+		return "/blockvolumes/reconcile", nil
+	})
+}
+
+func (a *App) BlockVolumeReconcileResult(w http.ResponseWriter, r *http.Request) {
+	resp := a.blockReconcile.last()
+	if resp == nil {
+		http.Error(w, "No block volume reconcile has completed", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		panic(err)
+	}
+}
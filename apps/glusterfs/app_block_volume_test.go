@@ -11,17 +11,21 @@ package glusterfs
 
 import (
 	"bytes"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/boltdb/bolt"
 	"github.com/gorilla/mux"
+	client "github.com/heketi/heketi/client/api/go-client"
+	"github.com/heketi/heketi/executors"
 	"github.com/heketi/heketi/pkg/glusterfs/api"
 	"github.com/heketi/heketi/pkg/utils"
 	"github.com/heketi/tests"
@@ -277,6 +281,51 @@ func TestBlockVolumeCreate(t *testing.T) {
 	tests.Assert(t, info.Auth == false)
 }
 
+func TestBlockVolumeCreateSizeMiB(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	c := client.NewClientNoAuth(ts.URL)
+	tests.Assert(t, c != nil)
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		3,    // nodes_per_cluster
+		1,    // devices_per_node,
+		5*TB, // disksize)
+	)
+	tests.Assert(t, err == nil)
+
+	var sizeMiB int
+	mockCreate := app.xo.MockBlockVolumeCreate
+	app.xo.MockBlockVolumeCreate = func(host string,
+		bv *executors.BlockVolumeRequest) (*executors.BlockVolumeInfo, error) {
+		sizeMiB = bv.SizeMiB
+		return mockCreate(host, bv)
+	}
+
+	req := &api.BlockVolumeCreateRequest{}
+	req.SizeMiB = 512
+	info, err := c.BlockVolumeCreate(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, sizeMiB == 512, sizeMiB)
+	tests.Assert(t, info.SizeMiB == 512, info.SizeMiB)
+	tests.Assert(t, info.Size == 1, info.Size)
+
+	// The block hosting volume accounts the size in whole GiB
+	vol, err := c.VolumeInfo(info.BlockHostingVolume)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, vol.BlockInfo.FreeSize == vol.Size-1, vol.BlockInfo.FreeSize)
+}
+
 func TestBlockVolumeInfoIdNotFound(t *testing.T) {
 	tmpfile := tests.Tempfile()
 	defer os.Remove(tmpfile)
@@ -591,3 +640,411 @@ func TestBlockVolumeDelete(t *testing.T) {
 	tests.Assert(t, r.StatusCode == http.StatusNotFound)
 	tests.Assert(t, err == nil)
 }
+
+func TestBlockVolumeExpand(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	c := client.NewClientNoAuth(ts.URL)
+	tests.Assert(t, c != nil)
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		3,    // nodes_per_cluster
+		1,    // devices_per_node,
+		5*TB, // disksize)
+	)
+	tests.Assert(t, err == nil)
+
+	req := &api.BlockVolumeCreateRequest{}
+	req.SizeMiB = 512
+	info, err := c.BlockVolumeCreate(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, info.Size == 1, info.Size)
+
+	var expanded string
+	var newSize int
+	app.xo.MockBlockVolumeExpand = func(host string,
+		blockHostingVolumeName string, blockVolumeName string, size int) error {
+		expanded = blockHostingVolumeName + "/" + blockVolumeName
+		newSize = size
+		return nil
+	}
+
+	info, err = c.BlockVolumeExpand(info.Id,
+		&api.BlockVolumeExpandRequest{NewSize: 5})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, info.Size == 5, info.Size)
+	tests.Assert(t, info.SizeMiB == 0, info.SizeMiB)
+	tests.Assert(t, newSize == 5, newSize)
+
+	vol, err := c.VolumeInfo(info.BlockHostingVolume)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, expanded == vol.Name+"/"+info.Name, expanded)
+	tests.Assert(t, vol.BlockInfo.FreeSize == vol.Size-5, vol.BlockInfo.FreeSize)
+
+	// The new size must be larger
+	_, err = c.BlockVolumeExpand(info.Id,
+		&api.BlockVolumeExpandRequest{NewSize: 5})
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	// The block hosting volume does not have the space
+	_, err = c.BlockVolumeExpand(info.Id,
+		&api.BlockVolumeExpandRequest{NewSize: vol.Size + 1})
+	tests.Assert(t, err != nil, "expected err != nil")
+	tests.Assert(t, utils.GetStatusCodeFromError(err) == http.StatusConflict, err)
+
+	// Failures of gluster-block give the reserved space back
+	app.xo.MockBlockVolumeExpand = func(host string,
+		blockHostingVolumeName string, blockVolumeName string, size int) error {
+		return fmt.Errorf("failed to resize")
+	}
+	_, err = c.BlockVolumeExpand(info.Id,
+		&api.BlockVolumeExpandRequest{NewSize: 10})
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	info, err = c.BlockVolumeInfo(info.Id)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, info.Size == 5, info.Size)
+	vol, err = c.VolumeInfo(info.BlockHostingVolume)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, vol.BlockInfo.FreeSize == vol.Size-5, vol.BlockInfo.FreeSize)
+
+	err = app.db.View(func(tx *bolt.Tx) error {
+		ops, err := PendingOperationList(tx)
+		tests.Assert(t, len(ops) == 0, ops)
+		return err
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	_, err = c.BlockVolumeExpand("abc",
+		&api.BlockVolumeExpandRequest{NewSize: 10})
+	tests.Assert(t, err != nil, "expected err != nil")
+	tests.Assert(t, utils.GetStatusCodeFromError(err) == http.StatusNotFound, err)
+}
+
+func TestBlockVolumeClone(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	c := client.NewClientNoAuth(ts.URL)
+	tests.Assert(t, c != nil)
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		3,    // nodes_per_cluster
+		1,    // devices_per_node,
+		5*TB, // disksize)
+	)
+	tests.Assert(t, err == nil)
+
+	req := &api.BlockVolumeCreateRequest{}
+	req.Size = 10
+	req.Auth = true
+	source, err := c.BlockVolumeCreate(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	var cloned *executors.BlockVolumeCloneRequest
+	app.xo.MockBlockVolumeClone = func(host string,
+		clone *executors.BlockVolumeCloneRequest) (*executors.BlockVolumeInfo, error) {
+		cloned = clone
+		return app.xo.MockBlockVolumeCreate(host, &clone.BlockVolumeRequest)
+	}
+
+	info, err := c.BlockVolumeClone(source.Id,
+		&api.BlockVolumeCloneRequest{Name: "clone1"})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, info.Id != source.Id)
+	tests.Assert(t, info.Name == "clone1", info.Name)
+	tests.Assert(t, info.Size == 10, info.Size)
+	tests.Assert(t, info.CloneOf == source.Id, info.CloneOf)
+	tests.Assert(t, info.BlockHostingVolume == source.BlockHostingVolume)
+	tests.Assert(t, info.Hacount == source.Hacount, info.Hacount)
+	tests.Assert(t, info.BlockVolume.Password != "")
+
+	vol, err := c.VolumeInfo(info.BlockHostingVolume)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, cloned.Source == source.Name, cloned.Source)
+	tests.Assert(t, cloned.Name == "clone1", cloned.Name)
+	tests.Assert(t, cloned.GlusterVolumeName == vol.Name, cloned.GlusterVolumeName)
+	tests.Assert(t, vol.BlockInfo.FreeSize == vol.Size-20, vol.BlockInfo.FreeSize)
+	tests.Assert(t, len(vol.BlockInfo.BlockVolumes) == 2, vol.BlockInfo.BlockVolumes)
+
+	list, err := c.BlockVolumeList()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(list.BlockVolumes) == 2, list.BlockVolumes)
+
+	err = app.db.View(func(tx *bolt.Tx) error {
+		ids, total, err := ListBlockVolumes(tx, &api.ListOptions{
+			Volume:     vol.Id,
+			NamePrefix: "clone",
+		})
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, total == 1 && ids[0] == info.Id, ids)
+
+		ids, total, err = ListBlockVolumes(tx, &api.ListOptions{Cluster: vol.Cluster})
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, total == 2, ids)
+		return nil
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// The name of the clone is already used on the block hosting volume
+	_, err = c.BlockVolumeClone(source.Id,
+		&api.BlockVolumeCloneRequest{Name: "clone1"})
+	tests.Assert(t, err != nil, "expected err != nil")
+	tests.Assert(t, utils.GetStatusCodeFromError(err) == http.StatusConflict, err)
+
+	// Failures of the copy remove the clone
+	app.xo.MockBlockVolumeClone = func(host string,
+		clone *executors.BlockVolumeCloneRequest) (*executors.BlockVolumeInfo, error) {
+		return nil, fmt.Errorf("failed to copy")
+	}
+	_, err = c.BlockVolumeClone(source.Id, &api.BlockVolumeCloneRequest{})
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	vol, err = c.VolumeInfo(info.BlockHostingVolume)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, vol.BlockInfo.FreeSize == vol.Size-20, vol.BlockInfo.FreeSize)
+	list, err = c.BlockVolumeList()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(list.BlockVolumes) == 2, list.BlockVolumes)
+
+	err = app.db.View(func(tx *bolt.Tx) error {
+		ops, err := PendingOperationList(tx)
+		tests.Assert(t, len(ops) == 0, ops)
+		return err
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	_, err = c.BlockVolumeClone("12345", &api.BlockVolumeCloneRequest{})
+	tests.Assert(t, err != nil, "expected err != nil")
+	tests.Assert(t, utils.GetStatusCodeFromError(err) == http.StatusNotFound, err)
+}
+
+func TestBlockVolumeAuthRotate(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	c := client.NewClientNoAuth(ts.URL)
+	tests.Assert(t, c != nil)
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		3,    // nodes_per_cluster
+		1,    // devices_per_node,
+		5*TB, // disksize)
+	)
+	tests.Assert(t, err == nil)
+
+	req := &api.BlockVolumeCreateRequest{}
+	req.Size = 1
+	noauth, err := c.BlockVolumeCreate(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	req.Auth = true
+	info, err := c.BlockVolumeCreate(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	var rotated string
+	app.xo.MockBlockVolumeAuthRotate = func(host string,
+		blockHostingVolumeName string,
+		blockVolumeName string) (*executors.BlockVolumeInfo, error) {
+
+		rotated = blockVolumeName
+		return &executors.BlockVolumeInfo{
+			Name:     blockVolumeName,
+			Username: "newuser",
+			Password: "newpassword",
+		}, nil
+	}
+
+	bv, err := c.BlockVolumeAuthRotate(info.Id)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, rotated == info.Name, rotated)
+	tests.Assert(t, bv.BlockVolume.Username == "newuser", bv.BlockVolume.Username)
+	tests.Assert(t, bv.BlockVolume.Password == "newpassword", bv.BlockVolume.Password)
+	bv, err = c.BlockVolumeInfo(info.Id)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, bv.BlockVolume.Password == "newpassword", bv.BlockVolume.Password)
+
+	// Block volumes without auth have no credentials to rotate
+	rotated = ""
+	_, err = c.BlockVolumeAuthRotate(noauth.Id)
+	tests.Assert(t, err != nil, "expected err != nil")
+	tests.Assert(t, strings.Contains(err.Error(), "auth enabled"), err)
+	tests.Assert(t, rotated == "", rotated)
+
+	// Credentials are kept when gluster-block fails
+	app.xo.MockBlockVolumeAuthRotate = func(host string,
+		blockHostingVolumeName string,
+		blockVolumeName string) (*executors.BlockVolumeInfo, error) {
+		return nil, fmt.Errorf("bzzt")
+	}
+	_, err = c.BlockVolumeAuthRotate(info.Id)
+	tests.Assert(t, err != nil, "expected err != nil")
+	bv, err = c.BlockVolumeInfo(info.Id)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, bv.BlockVolume.Password == "newpassword", bv.BlockVolume.Password)
+
+	_, err = c.BlockVolumeAuthRotate("abc")
+	tests.Assert(t, err != nil, "expected err != nil")
+}
+
+func TestBlockVolumeHaCount(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	c := client.NewClientNoAuth(ts.URL)
+	tests.Assert(t, c != nil)
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		4,    // nodes_per_cluster
+		1,    // devices_per_node,
+		5*TB, // disksize)
+	)
+	tests.Assert(t, err == nil)
+
+	req := &api.BlockVolumeCreateRequest{}
+	req.Size = 1
+	info, err := c.BlockVolumeCreate(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(info.BlockVolume.Hosts) == 4, info.BlockVolume.Hosts)
+	portals := info.BlockVolume.Hosts
+
+	var modified []string
+	app.xo.MockBlockVolumeModifyHa = func(host string,
+		blockHostingVolumeName string, blockVolumeName string,
+		hacount int, blockHosts []string) error {
+
+		tests.Assert(t, blockVolumeName == info.Name, blockVolumeName)
+		tests.Assert(t, hacount == len(blockHosts), hacount, blockHosts)
+		modified = blockHosts
+		return nil
+	}
+
+	// Portals are removed from the end
+	bv, err := c.BlockVolumeHaCount(info.Id,
+		&api.BlockVolumeHaCountRequest{Hacount: 2})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, reflect.DeepEqual(modified, portals[:2]), modified)
+	tests.Assert(t, bv.Hacount == 2, bv.Hacount)
+	tests.Assert(t, reflect.DeepEqual(bv.BlockVolume.Hosts, portals[:2]),
+		bv.BlockVolume.Hosts)
+
+	// and added from the block hosting volume
+	bv, err = c.BlockVolumeHaCount(info.Id,
+		&api.BlockVolumeHaCountRequest{Hacount: 4})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, reflect.DeepEqual(bv.BlockVolume.Hosts, portals),
+		bv.BlockVolume.Hosts)
+	bv, err = c.BlockVolumeInfo(info.Id)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, bv.Hacount == 4, bv.Hacount)
+
+	// Portals given in the request
+	hosts := []string{portals[3], portals[1]}
+	bv, err = c.BlockVolumeHaCount(info.Id,
+		&api.BlockVolumeHaCountRequest{Hacount: 2, Hosts: hosts})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, reflect.DeepEqual(bv.BlockVolume.Hosts, hosts),
+		bv.BlockVolume.Hosts)
+
+	// Nothing is done if the portals do not change
+	modified = nil
+	_, err = c.BlockVolumeHaCount(info.Id,
+		&api.BlockVolumeHaCountRequest{Hacount: 2, Hosts: hosts})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, modified == nil, modified)
+
+	// Portals must be nodes of the cluster
+	_, err = c.BlockVolumeHaCount(info.Id, &api.BlockVolumeHaCountRequest{
+		Hacount: 2, Hosts: []string{portals[0], "unknown"}})
+	tests.Assert(t, err != nil, "expected err != nil")
+	tests.Assert(t, utils.GetStatusCodeFromError(err) == http.StatusBadRequest, err)
+
+	// The number of portals must match the hacount
+	_, err = c.BlockVolumeHaCount(info.Id, &api.BlockVolumeHaCountRequest{
+		Hacount: 3, Hosts: hosts})
+	tests.Assert(t, err != nil, "expected err != nil")
+	tests.Assert(t, utils.GetStatusCodeFromError(err) == http.StatusBadRequest, err)
+
+	// Unhealthy nodes are skipped, unless given in the request
+	var unhealthy string
+	app.db.View(func(tx *bolt.Tx) error {
+		unhealthy, err = GetManageHostnameFromStorageHostname(tx, portals[3])
+		return err
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	app.xo.MockGlusterdCheck = func(host string) error {
+		if host == unhealthy {
+			return fmt.Errorf("glusterd down")
+		}
+		return nil
+	}
+	bv, err = c.BlockVolumeHaCount(info.Id,
+		&api.BlockVolumeHaCountRequest{Hacount: 3})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, reflect.DeepEqual(bv.BlockVolume.Hosts,
+		[]string{portals[1], portals[0], portals[2]}), bv.BlockVolume.Hosts)
+	_, err = c.BlockVolumeHaCount(info.Id,
+		&api.BlockVolumeHaCountRequest{Hacount: 4})
+	tests.Assert(t, err != nil, "expected err != nil")
+	tests.Assert(t, utils.GetStatusCodeFromError(err) == http.StatusBadRequest, err)
+	_, err = c.BlockVolumeHaCount(info.Id,
+		&api.BlockVolumeHaCountRequest{Hacount: 2, Hosts: hosts})
+	tests.Assert(t, err != nil, "expected err != nil")
+	tests.Assert(t, strings.Contains(err.Error(), "not healthy"), err)
+
+	// The portals are kept when gluster-block fails
+	app.xo.MockBlockVolumeModifyHa = func(host string,
+		blockHostingVolumeName string, blockVolumeName string,
+		hacount int, blockHosts []string) error {
+		return fmt.Errorf("bzzt")
+	}
+	before, err := c.BlockVolumeInfo(info.Id)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	_, err = c.BlockVolumeHaCount(info.Id,
+		&api.BlockVolumeHaCountRequest{Hacount: 1})
+	tests.Assert(t, err != nil, "expected err != nil")
+	after, err := c.BlockVolumeInfo(info.Id)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, reflect.DeepEqual(before, after), before, after)
+
+	_, err = c.BlockVolumeHaCount("abc",
+		&api.BlockVolumeHaCountRequest{Hacount: 1})
+	tests.Assert(t, err != nil, "expected err != nil")
+	tests.Assert(t, utils.GetStatusCodeFromError(err) == http.StatusNotFound, err)
+}
@@ -0,0 +1,184 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/gorilla/mux"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/heketi/pkg/utils"
+)
+
+func (a *App) BrickList(w http.ResponseWriter, r *http.Request) {
+
+	opts, err := listOptions(r, "cluster", "volume", "node", "device")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var list api.BrickListResponse
+
+	err = a.db.View(func(tx *bolt.Tx) error {
+		var err error
+
+		list.Bricks, list.Total, err = ListBricks(tx, opts)
+		return err
+	})
+	if err != nil {
+		requestLogger(r).Err(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Send list back
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(list); err != nil {
+		panic(err)
+	}
+}
+
+func (a *App) BrickReplace(w http.ResponseWriter, r *http.Request) {
+	// Get the id from the URL
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	var volume *VolumeEntry
+	var brick *BrickEntry
+	err := a.db.View(func(tx *bolt.Tx) error {
+		var err error
+		brick, err = NewBrickEntryFromId(tx, id)
+		if err == ErrNotFound {
+			http.Error(w, "Id not found", http.StatusNotFound)
+			return err
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+
+		volume, err = NewVolumeEntryFromId(tx, brick.Info.VolumeId)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	// The replace may wait for the volume to heal onto the new brick
+	query := r.URL.Query()
+	waitHeal := false
+	if v := query.Get("wait_for_heal"); v != "" {
+		waitHeal, err = strconv.ParseBool(v)
+		if err != nil {
+			http.Error(w, "invalid wait_for_heal: "+v, http.StatusBadRequest)
+			return
+		}
+	}
+	healTimeout := BrickReplaceHealTimeout
+	if v := query.Get("heal_timeout"); v != "" {
+		healTimeout, err = strconv.Atoi(v)
+		if err != nil || healTimeout < 1 {
+			http.Error(w, "invalid heal_timeout: "+v, http.StatusBadRequest)
+			return
+		}
+	}
+	if waitHeal && volume.Info.Durability.Type == api.DurabilityDistributeOnly {
+		http.Error(w, ErrNoSelfHeal.Error(), http.StatusBadRequest)
+		return
+	}
+
+	allocator := a.replaceAllocator(w, r, volume.Info.Cluster, []string{id})
+	if allocator == nil {
+		return
+	}
+
+	if !a.throttle.admit() {
+		tooManyOperations(w)
+		return
+	}
+
+	// Replace the brick, reporting each step to the async endpoint
+	requestLogger(r).Info("Replacing brick %v of volume %v", id, volume.Info.Id)
+	clusters := []string{volume.Info.Cluster}
+	nodes := []string{brick.Info.NodeId}
+	a.asyncHttpRedirectWithStepsFunc(w, r, func(step func(string)) (string, error) {
+		// The heal is waited for once the operation left the throttle
+		err := func() error {
+			if a.throttle != nil {
+				step(api.OperationStepQueued)
+				a.throttle.acquire(clusters, nodes)
+				defer a.throttle.release(clusters, nodes)
+			}
+			return volume.replaceBrickInVolumeWithProgress(a.db, a.requestExecutor(r),
+				allocator, id, brickReplaceStepFunc(step))
+		}()
+		if err != nil {
+			requestLogger(r).LogError("Failed to replace brick %v: %v", id, err)
+			return "", err
+		}
+		requestLogger(r).Info("Replaced brick %v of volume %v", id, volume.Info.Id)
+		a.notify(api.EventBrickReplaced, id, volume.Info.Tenant,
+			fmt.Sprintf("Replaced brick %v of volume %v", id, volume.Info.Id))
+
+		if waitHeal {
+			err = waitVolumeHeal(a.db, a.requestExecutor(r), volume.Info.Id,
+				time.Duration(healTimeout)*time.Second, step)
+			if err != nil {
+				requestLogger(r).LogError("Brick %v replaced, volume %v not healed: %v",
+					id, volume.Info.Id, err)
+				return "", err
+			}
+			requestLogger(r).Info("Volume %v healed after the replace of brick %v",
+				volume.Info.Id, id)
+		}
+		return "/volumes/" + volume.Info.Id, nil
+	})
+}
+
+func (a *App) BrickGc(w http.ResponseWriter, r *http.Request) {
+
+	var msg api.BrickGcRequest
+	err := utils.GetJsonFromRequest(r, &msg)
+	if err != nil {
+		http.Error(w, "request unable to be parsed", 422)
+		return
+	}
+
+	err = msg.Validate()
+	if err != nil {
+		http.Error(w, "validation failed: "+err.Error(), http.StatusBadRequest)
+		requestLogger(r).LogError("validation failed: " + err.Error())
+		return
+	}
+
+	requestLogger(r).Info("Scanning devices for orphaned bricks [action: %v]", msg.Action)
+	resp, err := GcBricks(a.db, a.requestExecutor(r), msg.Action)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Write msg
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		panic(err)
+	}
+}
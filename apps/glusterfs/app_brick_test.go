@@ -0,0 +1,272 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/gorilla/mux"
+	client "github.com/heketi/heketi/client/api/go-client"
+	"github.com/heketi/heketi/executors"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/heketi/pkg/utils"
+	"github.com/heketi/tests"
+)
+
+// sampleBrick returns the first brick of the db and its volume
+func sampleBrick(t *testing.T, app *App) (*BrickEntry, *VolumeEntry) {
+	var brick *BrickEntry
+	var volume *VolumeEntry
+	app.db.View(func(tx *bolt.Tx) error {
+		bl, err := BrickList(tx)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, len(bl) > 0)
+		brick, err = NewBrickEntryFromId(tx, bl[0])
+		tests.Assert(t, err == nil)
+		volume, err = NewVolumeEntryFromId(tx, brick.Info.VolumeId)
+		tests.Assert(t, err == nil)
+		return nil
+	})
+	return brick, volume
+}
+
+func TestBrickReplaceSteps(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	sampleNodeWithBricks(t, app, 4)
+	brick, volume := sampleBrick(t, app)
+
+	steps := []string{}
+	err := volume.replaceBrickInVolumeWithProgress(app.db, app.executor,
+		app.Allocator(), brick.Info.Id, func(step string) {
+			steps = append(steps, step)
+		})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(steps) == 4, steps)
+	tests.Assert(t, steps[0] == api.BrickReplaceAllocated, steps)
+	tests.Assert(t, steps[1] == api.BrickReplaceCreated, steps)
+	tests.Assert(t, steps[2] == api.BrickReplaceReplaced, steps)
+	tests.Assert(t, steps[3] == api.BrickReplaceDestroyedOld, steps)
+}
+
+func TestBrickReplaceHttp(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	c := client.NewClientNoAuth(ts.URL)
+	tests.Assert(t, c != nil)
+
+	sampleNodeWithBricks(t, app, 4)
+	brick, volume := sampleBrick(t, app)
+
+	info, err := c.BrickReplace(brick.Info.Id)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, info.Id == volume.Info.Id)
+	tests.Assert(t, len(info.Bricks) == len(volume.Bricks), info.Bricks)
+	for _, b := range info.Bricks {
+		tests.Assert(t, b.Id != brick.Info.Id, b)
+	}
+
+	_, err = c.BrickReplace("12345")
+	tests.Assert(t, err != nil, "expected err != nil")
+}
+
+func TestBrickReplacePendingStep(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	sampleNodeWithBricks(t, app, 4)
+	brick, _ := sampleBrick(t, app)
+
+	// Hold the replace once the new brick is created
+	release := make(chan struct{})
+	app.xo.MockVolumeReplaceBrick = func(host string, volume string,
+		oldBrick *executors.BrickInfo, newBrick *executors.BrickInfo) error {
+		<-release
+		return nil
+	}
+
+	r, err := http.Post(ts.URL+"/bricks/"+brick.Info.Id+"/replace", "", nil)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, r.StatusCode == http.StatusAccepted)
+	location, err := r.Location()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// Wait for the replace to reach the created step
+	var step string
+	for i := 0; i < 100 && step != api.BrickReplaceCreated; i++ {
+		r, err = http.Get(location.String())
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, r.StatusCode == http.StatusOK)
+		tests.Assert(t, r.Header.Get("X-Pending") == "true")
+		step = r.Header.Get(api.HeaderPendingStep)
+		time.Sleep(10 * time.Millisecond)
+	}
+	tests.Assert(t, step == api.BrickReplaceCreated, step)
+	close(release)
+
+	// The replace completes with a redirect to the volume
+	for {
+		r, err = http.Get(location.String())
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		if r.Header.Get("X-Pending") != "true" {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	tests.Assert(t, r.StatusCode == http.StatusOK, r.StatusCode)
+	tests.Assert(t, len(app.asyncSteps.steps) == 0, app.asyncSteps.steps)
+}
+
+func TestBrickGc(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	c := client.NewClientNoAuth(ts.URL)
+	tests.Assert(t, c != nil)
+
+	err := setupSampleDbWithTopology(app,
+		1,      // clusters
+		3,      // nodes_per_cluster
+		1,      // devices_per_node,
+		500*GB, // disksize
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	vreq := &api.VolumeCreateRequest{}
+	vreq.Size = 100
+	vreq.Durability.Type = api.DurabilityReplicate
+	vreq.Durability.Replicate.Replica = 3
+	_, err = c.VolumeCreate(vreq)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	bricks := map[string]string{}
+	var devices []string
+	app.db.View(func(tx *bolt.Tx) error {
+		devices, err = DeviceList(tx)
+		tests.Assert(t, err == nil)
+		for _, id := range devices {
+			d, err := NewDeviceEntryFromId(tx, id)
+			tests.Assert(t, err == nil)
+			tests.Assert(t, len(d.Bricks) == 1, d.Bricks)
+			bricks[id] = d.Bricks[0]
+		}
+		return nil
+	})
+	tests.Assert(t, len(devices) == 3, devices)
+	sort.Strings(devices)
+
+	// The first device has the bricks of a create that failed halfway
+	// and the logical volumes of the second device were lost
+	orphan := utils.GenUUID()
+	app.xo.MockDeviceLvs = func(host, vgid string) ([]executors.LvInfo, error) {
+		lvs := []executors.LvInfo{}
+		if vgid == devices[1] {
+			return lvs, nil
+		}
+		lvs = append(lvs,
+			executors.LvInfo{Name: utils.BrickIdToThinPoolName(bricks[vgid])},
+			executors.LvInfo{Name: utils.BrickIdToName(bricks[vgid]),
+				ThinPool: utils.BrickIdToThinPoolName(bricks[vgid])})
+		if vgid == devices[0] {
+			lvs = append(lvs,
+				executors.LvInfo{Name: utils.BrickIdToThinPoolName(orphan)},
+				executors.LvInfo{Name: utils.BrickIdToName(orphan),
+					ThinPool: utils.BrickIdToThinPoolName(orphan)},
+				executors.LvInfo{Name: "manual"})
+		}
+		return lvs, nil
+	}
+	destroyed := []string{}
+	app.xo.MockBrickDestroy = func(host string, brick *executors.BrickRequest) error {
+		tests.Assert(t, brick.VgId == devices[0], brick.VgId)
+		destroyed = append(destroyed, brick.Name)
+		return nil
+	}
+
+	gc, err := c.BrickGc(&api.BrickGcRequest{})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(gc.Devices) == 3, gc.Devices)
+	d := gc.Devices[0]
+	tests.Assert(t, d.DeviceId == devices[0], d.DeviceId)
+	tests.Assert(t, reflect.DeepEqual(d.Orphaned, []string{
+		utils.BrickIdToName(orphan), "manual",
+		utils.BrickIdToThinPoolName(orphan)}), d.Orphaned)
+	tests.Assert(t, len(d.Missing) == 0, d.Missing)
+	tests.Assert(t, len(d.Removed) == 0, d.Removed)
+	d = gc.Devices[1]
+	tests.Assert(t, len(d.Orphaned) == 0, d.Orphaned)
+	tests.Assert(t, reflect.DeepEqual(d.Missing, []string{bricks[devices[1]]}),
+		d.Missing)
+	d = gc.Devices[2]
+	tests.Assert(t, len(d.Orphaned) == 0, d.Orphaned)
+	tests.Assert(t, len(d.Missing) == 0, d.Missing)
+	tests.Assert(t, len(destroyed) == 0, destroyed)
+
+	// Only the logical volumes named by heketi are deleted
+	gc, err = c.BrickGc(&api.BrickGcRequest{Action: api.BrickGcCleanup})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, reflect.DeepEqual(destroyed, []string{orphan}), destroyed)
+	d = gc.Devices[0]
+	tests.Assert(t, reflect.DeepEqual(d.Removed, []string{
+		utils.BrickIdToName(orphan),
+		utils.BrickIdToThinPoolName(orphan)}), d.Removed)
+	tests.Assert(t, len(gc.Devices[1].Removed) == 0, gc.Devices[1].Removed)
+
+	// Orphaned bricks in use are not deleted
+	destroyed = []string{}
+	app.xo.MockBrickDestroyCheck = func(host string, brick *executors.BrickRequest) error {
+		return fmt.Errorf("thin pool in use")
+	}
+	gc, err = c.BrickGc(&api.BrickGcRequest{Action: api.BrickGcCleanup})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(destroyed) == 0, destroyed)
+	tests.Assert(t, len(gc.Devices[0].Errors) == 1, gc.Devices[0].Errors)
+
+	_, err = c.BrickGc(&api.BrickGcRequest{Action: "bzzt"})
+	tests.Assert(t, err != nil, "expected err != nil")
+	tests.Assert(t, utils.GetStatusCodeFromError(err) == http.StatusBadRequest, err)
+}
@@ -11,7 +11,10 @@ package glusterfs
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/boltdb/bolt"
 	"github.com/gorilla/mux"
@@ -45,10 +48,14 @@ func (a *App) ClusterCreate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	info := entry.Info
+	info.Allocator = a.AllocatorName()
+	info.Capacity = &api.ClusterCapacity{}
+
 	// Send back we created it (as long as we did not fail)
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 	w.WriteHeader(http.StatusCreated)
-	if err := json.NewEncoder(w).Encode(entry.Info); err != nil {
+	if err := json.NewEncoder(w).Encode(info); err != nil {
 		panic(err)
 	}
 }
@@ -78,6 +85,9 @@ func (a *App) ClusterSetFlags(w http.ResponseWriter, r *http.Request) {
 
 		entry.Info.File = msg.File
 		entry.Info.Block = msg.Block
+		if msg.Selinux != nil {
+			entry.Info.Selinux = *msg.Selinux
+		}
 
 		err = entry.Save(tx)
 		if err != nil {
@@ -95,6 +105,52 @@ func (a *App) ClusterSetFlags(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
+// ClusterSetStandby marks the cluster as a standby cluster
+func (a *App) ClusterSetStandby(w http.ResponseWriter, r *http.Request) {
+	a.setClusterStandby(w, r, true)
+}
+
+// ClusterPromote makes the standby cluster an active cluster again
+func (a *App) ClusterPromote(w http.ResponseWriter, r *http.Request) {
+	a.setClusterStandby(w, r, false)
+}
+
+func (a *App) setClusterStandby(w http.ResponseWriter, r *http.Request,
+	standby bool) {
+
+	// Get the id from the URL
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	err := a.db.Update(func(tx *bolt.Tx) error {
+		entry, err := NewClusterEntryFromId(tx, id)
+		if err == ErrNotFound {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return err
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+
+		entry.Info.Standby = standby
+
+		err = entry.Save(tx)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		return
+	}
+	requestLogger(r).Info("Cluster %v standby set to %v", id, standby)
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+}
+
 func (a *App) ClusterList(w http.ResponseWriter, r *http.Request) {
 
 	var list api.ClusterListResponse
@@ -112,7 +168,7 @@ func (a *App) ClusterList(w http.ResponseWriter, r *http.Request) {
 	})
 
 	if err != nil {
-		logger.Err(err)
+		requestLogger(r).Err(err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -155,11 +211,20 @@ func (a *App) ClusterInfo(w http.ResponseWriter, r *http.Request) {
 			return err
 		}
 
+		// The capacity is informational, the rest of the information
+		// is still returned if it can not be computed
+		info.Capacity, err = entry.capacity(tx)
+		if err != nil {
+			requestLogger(r).Warning("Unable to compute capacity of cluster %v: %v",
+				id, err)
+		}
+
 		return nil
 	})
 	if err != nil {
 		return
 	}
+	info.Allocator = a.AllocatorName()
 
 	// Write msg
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
@@ -186,7 +251,7 @@ func (a *App) ClusterDelete(w http.ResponseWriter, r *http.Request) {
 			return err
 		} else if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return logger.Err(err)
+			return requestLogger(r).Err(err)
 		}
 
 		err = entry.Delete(tx)
@@ -206,8 +271,543 @@ func (a *App) ClusterDelete(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Show that the key has been deleted
-	logger.Info("Deleted cluster [%s]", id)
+	requestLogger(r).Info("Deleted cluster [%s]", id)
+
+	// Write msg
+	w.WriteHeader(http.StatusOK)
+}
+
+func (a *App) ClusterPeerRepair(w http.ResponseWriter, r *http.Request) {
+
+	// Get the id from the URL
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	// Check the cluster exists
+	err := a.db.View(func(tx *bolt.Tx) error {
+		_, err := NewClusterEntryFromId(tx, id)
+		if err == ErrNotFound {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return err
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	if !a.throttle.admit() {
+		tooManyOperations(w)
+		return
+	}
+
+	// The probes may take long, so the repair runs in the background
+	// and holds a slot of the cluster in the throttle
+	requestLogger(r).Info("Repairing peers of cluster [%s]", id)
+	clusters := []string{id}
+	a.asyncHttpRedirectWithStepsFunc(w, r, func(step func(string)) (string, error) {
+		if a.throttle != nil {
+			step(api.OperationStepQueued)
+			a.throttle.acquire(clusters, nil)
+			defer a.throttle.release(clusters, nil)
+		}
+		step(api.OperationStepRunning)
+		resp, err := RepairClusterPeers(a.db, a.requestExecutor(r), id)
+		if err != nil {
+			requestLogger(r).LogError("Failed to repair peers of cluster %v: %v", id, err)
+			return "", err
+		}
+		a.peerRepairs.set(id, resp)
+		requestLogger(r).Info("Repaired peers of cluster %v", id)
+		return "/clusters/" + id + "/peers/repair", nil
+	})
+}
+
+func (a *App) ClusterPeerRepairResult(w http.ResponseWriter, r *http.Request) {
+
+	// Get the id from the URL
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	resp := a.peerRepairs.get(id)
+	if resp == nil {
+		http.Error(w, "No peer repair of the cluster has completed", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		panic(err)
+	}
+}
+
+func (a *App) ClusterOptions(w http.ResponseWriter, r *http.Request) {
+
+	// Get the id from the URL
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	// Check the cluster exists
+	err := a.db.View(func(tx *bolt.Tx) error {
+		_, err := NewClusterEntryFromId(tx, id)
+		if err == ErrNotFound {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return err
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	resp, err := ClusterOptions(a.db, a.requestExecutor(r), id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Write msg
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		panic(err)
+	}
+}
+
+func (a *App) ClusterSetOptions(w http.ResponseWriter, r *http.Request) {
+
+	// Get the id from the URL
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	var msg api.ClusterOptionsRequest
+	err := utils.GetJsonFromRequest(r, &msg)
+	if err != nil {
+		http.Error(w, "request unable to be parsed", 422)
+		return
+	}
+	err = msg.Validate()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		requestLogger(r).LogError("validation failed: " + err.Error())
+		return
+	}
+
+	// Check the cluster exists
+	err = a.db.View(func(tx *bolt.Tx) error {
+		_, err := NewClusterEntryFromId(tx, id)
+		if err == ErrNotFound {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return err
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	requestLogger(r).Info("Changing options of cluster %v", id)
+	resp, err := SetClusterOptions(a.db, a.requestExecutor(r), id, &msg)
+	if _, ok := err.(*ClusterOptionError); ok {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Write msg
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		panic(err)
+	}
+}
+
+func (a *App) ClusterCanary(w http.ResponseWriter, r *http.Request) {
+
+	// Get the id from the URL
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	// Check the cluster exists
+	err := a.db.View(func(tx *bolt.Tx) error {
+		_, err := NewClusterEntryFromId(tx, id)
+		if err == ErrNotFound {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return err
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	a.asyncHttpRedirectFunc(w, r, func() (string, error) {
+		if _, err := RunCanary(a.db, a.requestExecutor(r), a.requestAllocator(r), id); err != nil {
+			return "", err
+		}
+		return "/clusters/" + id + "/canary", nil
+	})
+}
+
+func (a *App) ClusterCanaryResult(w http.ResponseWriter, r *http.Request) {
+
+	// Get the id from the URL
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	var result *api.CanaryResult
+	err := a.db.View(func(tx *bolt.Tx) error {
+		cluster, err := NewClusterEntryFromId(tx, id)
+		if err == ErrNotFound {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return err
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+		if cluster.Canary == nil {
+			http.Error(w, "No canary run on the cluster", http.StatusNotFound)
+			return ErrNotFound
+		}
+		result = cluster.Canary
+		return nil
+	})
+	if err != nil {
+		return
+	}
 
 	// Write msg
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		panic(err)
+	}
+}
+
+func (a *App) StorageClassReport(w http.ResponseWriter, r *http.Request) {
+	var msg api.StorageClassReportRequest
+	err := utils.GetJsonFromRequest(r, &msg)
+	if err != nil {
+		http.Error(w, "request unable to be parsed", 422)
+		return
+	}
+	err = msg.Validate()
+	if err == nil {
+		err = validateVolumeDurability(&msg.Durability)
+	}
+	if err != nil {
+		http.Error(w, "validation failed: "+err.Error(), http.StatusBadRequest)
+		requestLogger(r).LogError("validation failed: " + err.Error())
+		return
+	}
+	if msg.Snapshot.Enable {
+		if msg.Snapshot.Factor < 1 || msg.Snapshot.Factor > VOLUME_CREATE_MAX_SNAPSHOT_FACTOR {
+			http.Error(w, "Invalid snapshot factor", http.StatusBadRequest)
+			requestLogger(r).LogError("Invalid snapshot factor")
+			return
+		}
+	}
+
+	report, err := StorageClassReport(a.db, a.requestAllocator(r), &msg)
+	if err != nil {
+		requestLogger(r).Err(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		panic(err)
+	}
+}
+
+func (a *App) ClusterRebalance(w http.ResponseWriter, r *http.Request) {
+
+	// Get the id from the URL
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	var msg api.ClusterRebalanceRequest
+	err := utils.GetJsonFromRequest(r, &msg)
+	if err != nil {
+		http.Error(w, "request unable to be parsed", 422)
+		return
+	}
+	err = msg.Validate()
+	if err != nil {
+		http.Error(w, "validation failed: "+err.Error(), http.StatusBadRequest)
+		requestLogger(r).LogError("validation failed: " + err.Error())
+		return
+	}
+
+	band := msg.Band
+	if band == 0 {
+		band = ClusterRebalanceBand
+	}
+	maxMoves := msg.MaxMoves
+	if maxMoves == 0 {
+		maxMoves = ClusterRebalanceMaxMoves
+	}
+	interval := time.Duration(msg.Interval) * time.Second
+	if msg.Interval == 0 {
+		interval = ClusterRebalanceInterval
+	}
+
+	// Check the cluster exists
+	err = a.db.View(func(tx *bolt.Tx) error {
+		_, err := NewClusterEntryFromId(tx, id)
+		if err == ErrNotFound {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return err
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	// Bricks of pending operations can not be planned for
+	if HasPendingOperations(a.db) {
+		http.Error(w, "pending operations in progress", http.StatusConflict)
+		return
+	}
+
+	if msg.DryRun {
+		plan, err := PlanClusterRebalance(a.db, a.requestExecutor(r), id, band, maxMoves)
+		if err != nil {
+			requestLogger(r).Err(err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(w).Encode(plan.Response()); err != nil {
+			panic(err)
+		}
+		return
+	}
+
+	requestLogger(r).Info("Rebalancing cluster %v", id)
+	a.asyncHttpRedirectFunc(w, r, func() (string, error) {
+		plan, err := PlanClusterRebalance(a.db, a.requestExecutor(r), id, band, maxMoves)
+		if err != nil {
+			return "", err
+		}
+		requestLogger(r).Info("Moving %v bricks to rebalance cluster %v",
+			len(plan.planned), id)
+		if err := plan.Execute(a.db, a.requestExecutor(r), interval); err != nil {
+			return "", err
+		}
+		requestLogger(r).Info("Rebalanced cluster %v", id)
+		return "/clusters/" + id, nil
+	})
+}
+
+func (a *App) ClusterZoneRebalance(w http.ResponseWriter, r *http.Request) {
+
+	// Get the id from the URL
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	var msg api.ClusterZoneRebalanceRequest
+	err := utils.GetJsonFromRequest(r, &msg)
+	if err != nil {
+		http.Error(w, "request unable to be parsed", 422)
+		return
+	}
+	err = msg.Validate()
+	if err != nil {
+		http.Error(w, "validation failed: "+err.Error(), http.StatusBadRequest)
+		requestLogger(r).LogError("validation failed: " + err.Error())
+		return
+	}
+
+	maxMoves := msg.MaxMoves
+	if maxMoves == 0 {
+		maxMoves = ZoneRebalanceMaxMoves
+	}
+	interval := time.Duration(msg.Interval) * time.Second
+	if msg.Interval == 0 {
+		interval = ClusterRebalanceInterval
+	}
+
+	// Check the cluster exists
+	err = a.db.View(func(tx *bolt.Tx) error {
+		_, err := NewClusterEntryFromId(tx, id)
+		if err == ErrNotFound {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return err
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	// Bricks of pending operations can not be planned for
+	if HasPendingOperations(a.db) {
+		http.Error(w, "pending operations in progress", http.StatusConflict)
+		return
+	}
+
+	if msg.DryRun {
+		plan, err := PlanClusterZoneRebalance(a.db, a.requestExecutor(r), id, maxMoves)
+		if err != nil {
+			requestLogger(r).Err(err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(w).Encode(plan.Response()); err != nil {
+			panic(err)
+		}
+		return
+	}
+
+	requestLogger(r).Info("Rebalancing the zones of cluster %v", id)
+	a.asyncHttpRedirectFunc(w, r, func() (string, error) {
+		plan, err := PlanClusterZoneRebalance(a.db, a.requestExecutor(r), id, maxMoves)
+		if err != nil {
+			return "", err
+		}
+		requestLogger(r).Info("Moving %v bricks to spread the sets of cluster %v across its zones",
+			len(plan.planned), id)
+		if err := plan.Execute(a.db, a.requestExecutor(r), interval); err != nil {
+			return "", err
+		}
+		requestLogger(r).Info("Rebalanced the zones of cluster %v", id)
+		return "/clusters/" + id, nil
+	})
+}
+
+func (a *App) ClusterPlacementScores(w http.ResponseWriter, r *http.Request) {
+
+	// Get the id from the URL
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	size := 1
+	samples := PlacementScoreSamples
+	query := r.URL.Query()
+	if v := query.Get("size"); v != "" {
+		var err error
+		size, err = strconv.Atoi(v)
+		if err != nil || size < 1 {
+			http.Error(w, "invalid size: "+v, http.StatusBadRequest)
+			return
+		}
+	}
+	if v := query.Get("samples"); v != "" {
+		var err error
+		samples, err = strconv.Atoi(v)
+		if err != nil || samples < 1 || samples > PlacementScoreMaxSamples {
+			http.Error(w, fmt.Sprintf("invalid samples: %v, must be between 1 and %v",
+				v, PlacementScoreMaxSamples), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Check the cluster exists
+	err := a.db.View(func(tx *bolt.Tx) error {
+		_, err := NewClusterEntryFromId(tx, id)
+		if err == ErrNotFound {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return err
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	scores, err := ClusterPlacementScores(a.db, a.requestAllocator(r), id,
+		uint64(size)*GB, samples)
+	if err != nil {
+		requestLogger(r).Err(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	scores.Allocator = a.AllocatorName()
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(scores); err != nil {
+		panic(err)
+	}
+}
+
+func (a *App) ClusterCapacityForecast(w http.ResponseWriter, r *http.Request) {
+
+	// Get the id from the URL
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	days := CapacityForecastDays
+	if v := r.URL.Query().Get("days"); v != "" {
+		var err error
+		days, err = strconv.Atoi(v)
+		if err != nil || days < 1 {
+			http.Error(w, "invalid days: "+v, http.StatusBadRequest)
+			return
+		}
+	}
+
+	forecast, err := ClusterCapacityForecast(a.db, id, days)
+	if err == ErrNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		requestLogger(r).Err(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(forecast); err != nil {
+		panic(err)
+	}
+}
+
+func (a *App) CapacityReport(w http.ResponseWriter, r *http.Request) {
+	report, err := CapacityReport(a.db)
+	if err != nil {
+		requestLogger(r).Err(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		panic(err)
+	}
 }
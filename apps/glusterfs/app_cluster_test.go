@@ -16,10 +16,13 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"sync"
 	"testing"
 
 	"github.com/boltdb/bolt"
 	"github.com/gorilla/mux"
+	client "github.com/heketi/heketi/client/api/go-client"
+	"github.com/heketi/heketi/executors"
 	"github.com/heketi/heketi/pkg/glusterfs/api"
 	"github.com/heketi/heketi/pkg/utils"
 	"github.com/heketi/tests"
@@ -139,6 +142,30 @@ func TestClusterSetFlags(t *testing.T) {
 	tests.Assert(t, ce.Info.Id == clusterId)
 	tests.Assert(t, ce.Info.File == true)
 	tests.Assert(t, ce.Info.Block == false)
+
+	// The flags can be put too
+	request = []byte(`{
+"file": false,
+"block": true
+}`)
+	req, err := http.NewRequest("PUT", ts.URL+"/clusters/"+clusterId+"/flags",
+		bytes.NewBuffer(request))
+	tests.Assert(t, err == nil)
+	req.Header.Set("Content-Type", "application/json")
+	r, err = http.DefaultClient.Do(req)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusOK,
+		"Expected http status OK, got: ", http.StatusText(r.StatusCode))
+
+	ce = ClusterEntry{}
+	err = app.db.View(func(tx *bolt.Tx) error {
+		return ce.Unmarshal(
+			tx.Bucket([]byte(BOLTDB_BUCKET_CLUSTER)).
+				Get([]byte(clusterId)))
+	})
+	tests.Assert(t, err == nil)
+	tests.Assert(t, ce.Info.File == false)
+	tests.Assert(t, ce.Info.Block == true)
 }
 
 func TestClusterList(t *testing.T) {
@@ -294,6 +321,7 @@ func TestClusterInfo(t *testing.T) {
 	tests.Assert(t, entry.Info.Nodes[0] == msg.Nodes[0])
 	tests.Assert(t, entry.Info.Nodes[1] == msg.Nodes[1])
 	tests.Assert(t, entry.Info.Nodes[2] == msg.Nodes[2])
+	tests.Assert(t, msg.Allocator == DefaultAllocator, msg.Allocator)
 }
 
 func TestClusterDeleteBadId(t *testing.T) {
@@ -459,3 +487,332 @@ func TestClusterDelete(t *testing.T) {
 	tests.Assert(t, err == nil, err)
 
 }
+
+func TestClusterPeerRepair(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	// Setup the server
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	// Unknown cluster
+	r, err := http.Post(ts.URL+"/clusters/12345/peers/repair", "", nil)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusNotFound)
+
+	err = setupSampleDbWithTopology(app,
+		1,      // clusters
+		3,      // nodes_per_cluster
+		1,      // devices_per_node,
+		500*GB, // disksize)
+	)
+	tests.Assert(t, err == nil)
+	clusterId, nodes := sampleClusterNodes(t, app)
+
+	// Every peer is connected
+	app.xo.MockPeerStatus = func(host string) (*executors.PeerStatus, error) {
+		status := &executors.PeerStatus{}
+		for _, n := range nodes {
+			status.Peers = append(status.Peers, executors.Peer{
+				Hostname:  n.StorageHostName(),
+				Connected: 1,
+				StateStr:  "Peer in Cluster",
+			})
+		}
+		return status, nil
+	}
+	app.xo.MockPeerProbe = func(exec_host, newnode string) error {
+		t.Errorf("unexpected peer probe of %v", newnode)
+		return nil
+	}
+
+	// No repair has completed yet
+	r, err = http.Get(ts.URL + "/clusters/" + clusterId + "/peers/repair")
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusNotFound, r.StatusCode)
+
+	// The repair runs in the background
+	r, err = http.Post(ts.URL+"/clusters/"+clusterId+"/peers/repair", "", nil)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusAccepted, r.StatusCode)
+
+	c := client.NewClientNoAuth(ts.URL)
+	resp, err := c.ClusterPeerRepair(clusterId)
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, len(resp.Peers) == 2, resp.Peers)
+	for _, p := range resp.Peers {
+		tests.Assert(t, p.Before == api.PeerStateConnected, p.Before)
+		tests.Assert(t, p.After == api.PeerStateConnected, p.After)
+		tests.Assert(t, p.Action == api.PeerRepairActionNone, p.Action)
+	}
+
+	// The repair is rejected when the queue of the throttle is full
+	app.throttle = newOperationThrottle(0, 1, 0, 0)
+	r, err = http.Post(ts.URL+"/clusters/"+clusterId+"/peers/repair", "", nil)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusTooManyRequests, r.StatusCode)
+}
+
+func TestClusterOptions(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	// Setup the server
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	c := client.NewClientNoAuth(ts.URL)
+	tests.Assert(t, c != nil)
+
+	// Unknown cluster
+	_, err := c.ClusterOptions("12345")
+	tests.Assert(t, err != nil)
+
+	err = setupSampleDbWithTopology(app,
+		1,      // clusters
+		3,      // nodes_per_cluster
+		1,      // devices_per_node,
+		500*GB, // disksize)
+	)
+	tests.Assert(t, err == nil)
+	clusterId, _ := sampleClusterNodes(t, app)
+
+	options := map[string]string{
+		api.ClusterOptionOpVersion:         "31306",
+		api.ClusterOptionMaxOpVersion:      "70200",
+		api.ClusterOptionServerQuorumRatio: "51",
+	}
+	app.xo.MockClusterOptions = func(host string) (*executors.ClusterOptions, error) {
+		o := &executors.ClusterOptions{}
+		for name, value := range options {
+			o.Options = append(o.Options, executors.ClusterOption{
+				Name:  name,
+				Value: value,
+			})
+		}
+		return o, nil
+	}
+	var set []string
+	app.xo.MockClusterSetOptions = func(host string, o []string) error {
+		set = o
+		for _, option := range o {
+			var name, value string
+			fmt.Sscan(option, &name, &value)
+			options[name] = value
+		}
+		return nil
+	}
+
+	resp, err := c.ClusterOptions(clusterId)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, resp.Id == clusterId, resp)
+	tests.Assert(t, resp.Options[api.ClusterOptionOpVersion] == "31306", resp)
+
+	// Unknown, invalid and out of range options are rejected
+	for _, option := range []string{
+		"performance.cache-size 256MB",
+		"cluster.op-version latest",
+		"cluster.server-quorum-ratio 120",
+		"cluster.op-version 30000",
+		"cluster.op-version 80000",
+	} {
+		_, err = c.ClusterSetOptions(clusterId,
+			&api.ClusterOptionsRequest{Set: []string{option}})
+		tests.Assert(t, err != nil, "expected err != nil for", option)
+	}
+	tests.Assert(t, set == nil, set)
+
+	resp, err = c.ClusterSetOptions(clusterId, &api.ClusterOptionsRequest{
+		Set: []string{"cluster.op-version 70200", "cluster.server-quorum-ratio 60%"},
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(set) == 2, set)
+	tests.Assert(t, resp.Options[api.ClusterOptionOpVersion] == "70200", resp)
+	tests.Assert(t, resp.Options[api.ClusterOptionServerQuorumRatio] == "60%", resp)
+
+	// The change is recorded in the audit log
+	log, err := c.AuditLog(clusterId, 0, 0)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(log.Entries) == 6, log.Entries)
+	e := log.Entries[5]
+	tests.Assert(t, e.Operation == "ClusterSetOptions", e)
+	tests.Assert(t, e.Result == api.AuditResultSucceeded, e)
+}
+
+func TestClusterStandby(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	// Setup the server
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	err := setupSampleDbWithTopology(app,
+		2,    // clusters
+		3,    // nodes_per_cluster
+		1,    // devices_per_node,
+		2*TB, // disksize
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	var clusters []string
+	err = app.db.View(func(tx *bolt.Tx) error {
+		var err error
+		clusters, err = ClusterList(tx)
+		return err
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	standby := clusters[0]
+
+	r, err := http.Post(ts.URL+"/clusters/"+standby+"/standby", "", nil)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusOK, r.StatusCode)
+
+	r, err = http.Get(ts.URL + "/clusters/" + standby)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusOK)
+	var info api.ClusterInfoResponse
+	err = utils.GetJsonFromResponse(r, &info)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, info.Standby)
+
+	// Volumes are not placed on the standby cluster unless requested
+	for i := 0; i < 4; i++ {
+		req := &api.VolumeCreateRequest{}
+		req.Size = 10
+		v := NewVolumeEntryFromRequest(req)
+		err = v.Create(app.db, app.executor, app.Allocator())
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, v.Info.Cluster == clusters[1], v.Info.Cluster)
+	}
+
+	req := &api.VolumeCreateRequest{}
+	req.Size = 10
+	req.Clusters = []string{standby}
+	v := NewVolumeEntryFromRequest(req)
+	err = v.Create(app.db, app.executor, app.Allocator())
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, v.Info.Cluster == standby, v.Info.Cluster)
+
+	r, err = http.Post(ts.URL+"/clusters/"+standby+"/promote", "", nil)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusOK, r.StatusCode)
+
+	err = app.db.View(func(tx *bolt.Tx) error {
+		active, err := ActiveClusterList(tx)
+		tests.Assert(t, len(active) == 2, active)
+		return err
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	r, err = http.Post(ts.URL+"/clusters/12345678/promote", "", nil)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusNotFound, r.StatusCode)
+}
+
+func TestClusterSelinux(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	c := client.NewClientNoAuth(ts.URL)
+	tests.Assert(t, c != nil)
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		3,    // nodes_per_cluster
+		2,    // devices_per_node,
+		2*TB, // disksize
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	clusters, err := c.ClusterList()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	clusterId := clusters.Clusters[0]
+
+	var lock sync.Mutex
+	requests := []*executors.BrickRequest{}
+	app.xo.MockBrickCreate = func(host string,
+		brick *executors.BrickRequest) (*executors.BrickInfo, error) {
+
+		lock.Lock()
+		defer lock.Unlock()
+		requests = append(requests, brick)
+		return &executors.BrickInfo{Path: brick.Path}, nil
+	}
+
+	req := &api.VolumeCreateRequest{}
+	req.Size = 10
+	req.Durability.Type = api.DurabilityReplicate
+	req.Durability.Replicate.Replica = 3
+
+	// The bricks are not checked by default
+	_, err = c.VolumeCreate(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(requests) == 3, requests)
+	for _, b := range requests {
+		tests.Assert(t, !b.SelinuxCheck && b.SelinuxContext == "", b)
+		tests.Assert(t, len(b.SelinuxBooleans) == 0, b)
+	}
+
+	// Requests without SELinux settings leave them unchanged
+	err = c.ClusterSetFlags(clusterId, &api.ClusterSetFlagsRequest{
+		ClusterFlags: api.ClusterFlags{File: true, Block: true},
+		Selinux:      &api.ClusterSelinux{Check: true, Booleans: true},
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	err = c.ClusterSetFlags(clusterId, &api.ClusterSetFlagsRequest{
+		ClusterFlags: api.ClusterFlags{File: true, Block: true},
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	info, err := c.ClusterInfo(clusterId)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, info.Selinux.Check && info.Selinux.Booleans, info.Selinux)
+
+	// The bricks get the context of gluster bricks unless the volume
+	// sets its own
+	requests = requests[:0]
+	_, err = c.VolumeCreate(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	req.SelinuxContext = "system_u:object_r:container_file_t:s0"
+	_, err = c.VolumeCreate(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	tests.Assert(t, len(requests) == 6, requests)
+	for i, b := range requests {
+		tests.Assert(t, b.SelinuxCheck, b)
+		tests.Assert(t, len(b.SelinuxBooleans) == len(SelinuxBooleans), b)
+		if i < 3 {
+			tests.Assert(t, b.SelinuxContext == SelinuxBrickContext, b)
+		} else {
+			tests.Assert(t, b.SelinuxContext == req.SelinuxContext, b)
+		}
+	}
+}
@@ -14,6 +14,7 @@ import (
 	"io"
 	"os"
 
+	"github.com/heketi/heketi/executors/apiexec"
 	"github.com/heketi/heketi/executors/kubeexec"
 	"github.com/heketi/heketi/executors/sshexec"
 )
@@ -24,16 +25,140 @@ type GlusterFSConfig struct {
 	Allocator  string              `json:"allocator"`
 	SshConfig  sshexec.SshConfig   `json:"sshexec"`
 	KubeConfig kubeexec.KubeConfig `json:"kubeexec"`
+	ApiConfig  apiexec.ApiConfig   `json:"glusterd_api"`
 	Loglevel   string              `json:"loglevel"`
 
+	// format of the messages logged: text or json
+	LogFormat string `json:"log_format"`
+
 	// advanced settings
 	BrickMaxSize int `json:"brick_max_size_gb"`
 	BrickMinSize int `json:"brick_min_size_gb"`
 	BrickMaxNum  int `json:"max_bricks_per_volume"`
 
+	// minimum brick size in MB, used instead of brick_min_size_gb if set
+	BrickMinSizeMb int `json:"brick_min_size_mb"`
+
+	// minimum brick size in MB of the volumes of a durability type:
+	// replicate, disperse or none
+	BrickMinSizeMbByDurability map[string]int `json:"brick_min_size_mb_by_durability"`
+
+	// placement of the bricks of a set: none, best-effort or strict
+	BrickZonePolicy string `json:"brick_zone_policy"`
+
+	// order the clusters are tried in by the volume creates not
+	// listing clusters: ordered, free-capacity, least-volumes or
+	// round-robin
+	ClusterSelectionPolicy string `json:"cluster_selection_policy"`
+
 	//block settings
 	CreateBlockHostingVolumes bool `json:"auto_create_block_hosting_volume"`
 	BlockHostingVolumeSize    int  `json:"block_hosting_volume_size"`
+
+	// deletion of empty block hosting volumes after a grace period in seconds
+	DeleteBlockHostingVolumes     bool `json:"auto_delete_block_hosting_volume"`
+	BlockHostingVolumeDeleteGrace int  `json:"block_hosting_volume_delete_grace"`
+
+	// volume defaults
+	VolumeDefaultUid            int64  `json:"volume_default_uid"`
+	VolumeDefaultGid            int64  `json:"volume_default_gid"`
+	VolumeDefaultPermissions    string `json:"volume_default_permissions"`
+	VolumeDefaultSelinuxContext string `json:"volume_default_selinux_context"`
+
+	// SELinux context and booleans of the clusters checking the SELinux
+	// labels of their bricks
+	SelinuxBrickContext string   `json:"selinux_brick_context"`
+	SelinuxBooleans     []string `json:"selinux_booleans"`
+
+	// seconds between checks of the volume options, 0 disables them
+	VolumeOptionsCheckInterval int `json:"volume_options_check_interval"`
+
+	// seconds between samples of the io of every volume, 0 disables them,
+	// and the number of samples kept for each volume
+	VolumeIOStatsInterval int `json:"volume_io_stats_interval"`
+	VolumeIOStatsSamples  int `json:"volume_io_stats_samples"`
+
+	// seconds between canary runs on every cluster, 0 disables them
+	CanaryInterval int `json:"canary_interval"`
+
+	// seconds between scans of the devices for orphaned bricks, 0
+	// disables them, and whether the scans delete the orphaned bricks
+	BrickGcInterval int  `json:"brick_gc_interval"`
+	BrickGcCleanup  bool `json:"brick_gc_cleanup"`
+
+	// days completed operations are kept in the history
+	OperationHistoryDays int `json:"operation_history_days"`
+
+	// days the output of failed commands is kept
+	CommandOutputDays int `json:"command_output_days"`
+
+	// days the requests changing the state of the server are kept in
+	// the audit log
+	AuditLogDays int `json:"audit_log_days"`
+
+	// hours the idempotency keys of the creates are remembered
+	IdempotencyKeyHours int `json:"idempotency_key_hours"`
+
+	// endpoints the events of the cluster are posted to
+	Webhooks []WebhookConfig `json:"webhooks"`
+
+	// seconds each volume may take to heal when restarting the bricks
+	// of a node
+	BrickRestartHealTimeout int `json:"brick_restart_heal_timeout"`
+
+	// seconds a brick replace waiting for the heal of the volume waits
+	// when the request does not set a timeout
+	BrickReplaceHealTimeout int `json:"brick_replace_heal_timeout"`
+
+	// volumes and block volumes torn down at the same time by deletes
+	DeleteWorkers int `json:"delete_workers"`
+
+	// seconds between checks of glusterd on every online node, the
+	// operations using the nodes found healthy without checking them
+	// again, 0 disables them
+	NodeHealthCheckInterval int `json:"node_health_check_interval"`
+
+	// seconds between checks of the devices of every online node, 0
+	// disables them, the seconds a device may stay unreachable before
+	// it is taken offline, and whether its bricks are then replaced
+	DeviceHealthCheckInterval int  `json:"device_health_check_interval"`
+	DeviceFailureTimeout      int  `json:"device_failure_timeout"`
+	DeviceAutoFailover        bool `json:"device_auto_failover"`
+
+	// seconds between refreshes of the space held by snapshots on the
+	// devices of every online node, 0 disables them
+	SnapshotOverheadInterval int `json:"snapshot_overhead_interval"`
+
+	// seconds a volume delete waits for its confirmation before the
+	// volume is deleted, 0 deletes the volumes without confirmation
+	DeleteConfirmationTimeout int `json:"delete_confirmation_timeout"`
+
+	// volume creates and brick replaces running at the same time on
+	// the server, on each cluster and on each node, 0 is no limit, and
+	// the operations waiting before requests get 429 with a retry after
+	// the given seconds
+	MaxOperations        int `json:"max_concurrent_operations"`
+	MaxClusterOperations int `json:"max_concurrent_operations_per_cluster"`
+	MaxNodeOperations    int `json:"max_concurrent_operations_per_node"`
+	OperationQueueSize   int `json:"operation_queue_size"`
+	OperationRetryAfter  int `json:"operation_retry_after"`
+
+	// seconds between samples of the capacity of every cluster, 0
+	// disables them, and the days of samples kept
+	CapacitySampleInterval int `json:"capacity_sample_interval"`
+	CapacityHistoryDays    int `json:"capacity_history_days"`
+
+	// prefix of the names of the volume groups and logical volumes of a
+	// new db
+	LvmNamePrefix string `json:"lvm_name_prefix"`
+
+	// request limits
+	RequestMaxSize  int64 `json:"max_request_size"`
+	NameMaxLength   int   `json:"max_name_length"`
+	VolumeMaxSize   int   `json:"max_volume_size_gb"`
+	ClustersMaxNum  int   `json:"max_clusters_per_request"`
+	HostnamesMaxNum int   `json:"max_hostnames_per_node"`
+	DbImportMaxSize int64 `json:"max_db_import_size"`
 }
 
 type ConfigFile struct {
@@ -59,5 +184,9 @@ func loadConfiguration(configIo io.Reader) *GlusterFSConfig {
 	if env != "" {
 		config.GlusterFS.Loglevel = env
 	}
+	env = os.Getenv("HEKETI_GLUSTERAPP_LOGFORMAT")
+	if env != "" {
+		config.GlusterFS.LogFormat = env
+	}
 	return &config.GlusterFS
 }
@@ -14,10 +14,12 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/boltdb/bolt"
+	wdb "github.com/heketi/heketi/pkg/db"
 	"github.com/heketi/heketi/pkg/glusterfs/api"
 	"github.com/heketi/heketi/pkg/utils"
 )
@@ -31,6 +33,10 @@ type Db struct {
 	BlockVolumes      map[string]BlockVolumeEntry      `json:"blockvolumeentries"`
 	DbAttributes      map[string]DbAttributeEntry      `json:"dbattributeentries"`
 	PendingOperations map[string]PendingOperationEntry `json:"pendingoperations"`
+	Snapshots         map[string]SnapshotEntry         `json:"snapshotentries,omitempty"`
+	Replications      map[string]ReplicationEntry      `json:"replicationentries,omitempty"`
+	Tenants           map[string]TenantEntry           `json:"tenantentries,omitempty"`
+	StateReasons      map[string]StateReasonEntry      `json:"statereasonentries,omitempty"`
 }
 
 func dbDumpInternal(db *bolt.DB) (Db, error) {
@@ -43,6 +49,10 @@ func dbDumpInternal(db *bolt.DB) (Db, error) {
 	blockvolEntryList := make(map[string]BlockVolumeEntry, 0)
 	dbattributeEntryList := make(map[string]DbAttributeEntry, 0)
 	pendingOpEntryList := make(map[string]PendingOperationEntry, 0)
+	snapshotEntryList := make(map[string]SnapshotEntry, 0)
+	replicationEntryList := make(map[string]ReplicationEntry, 0)
+	tenantEntryList := make(map[string]TenantEntry, 0)
+	stateReasonEntryList := make(map[string]StateReasonEntry, 0)
 
 	err := db.View(func(tx *bolt.Tx) error {
 
@@ -202,6 +212,86 @@ func dbDumpInternal(db *bolt.DB) (Db, error) {
 			}
 		}
 
+		if b := tx.Bucket([]byte(BOLTDB_BUCKET_SNAPSHOT)); b == nil {
+			logger.Warning("unable to find snapshot bucket... skipping")
+		} else {
+			// Snapshot Bucket
+			logger.Debug("snapshot bucket")
+			snapshots, err := SnapshotList(tx)
+			if err != nil {
+				return err
+			}
+
+			for _, snapshot := range snapshots {
+				logger.Debug("adding snapshot entry %v", snapshot)
+				snapshotEntry, err := NewSnapshotEntryFromId(tx, snapshot)
+				if err != nil {
+					return err
+				}
+				snapshotEntryList[snapshotEntry.Info.Id] = *snapshotEntry
+			}
+		}
+
+		if b := tx.Bucket([]byte(BOLTDB_BUCKET_REPLICATION)); b == nil {
+			logger.Warning("unable to find replication bucket... skipping")
+		} else {
+			// Replication Bucket
+			logger.Debug("replication bucket")
+			replications, err := ReplicationList(tx)
+			if err != nil {
+				return err
+			}
+
+			for _, replication := range replications {
+				logger.Debug("adding replication entry %v", replication)
+				replicationEntry, err := NewReplicationEntryFromId(tx, replication)
+				if err != nil {
+					return err
+				}
+				replicationEntryList[replicationEntry.Info.Id] = *replicationEntry
+			}
+		}
+
+		if b := tx.Bucket([]byte(BOLTDB_BUCKET_TENANT)); b == nil {
+			logger.Warning("unable to find tenant bucket... skipping")
+		} else {
+			// Tenant Bucket
+			logger.Debug("tenant bucket")
+			tenants, err := TenantList(tx)
+			if err != nil {
+				return err
+			}
+
+			for _, tenant := range tenants {
+				logger.Debug("adding tenant entry %v", tenant)
+				tenantEntry, err := NewTenantEntryFromId(tx, tenant)
+				if err != nil {
+					return err
+				}
+				tenantEntryList[tenantEntry.Name] = *tenantEntry
+			}
+		}
+
+		if b := tx.Bucket([]byte(BOLTDB_BUCKET_STATE_REASON)); b == nil {
+			logger.Warning("unable to find state reason bucket... skipping")
+		} else {
+			// State Reason Bucket
+			logger.Debug("state reason bucket")
+			reasons, err := StateReasonList(tx)
+			if err != nil {
+				return err
+			}
+
+			for _, reason := range reasons {
+				logger.Debug("adding state reason entry %v", reason)
+				stateReasonEntry, err := NewStateReasonEntryFromId(tx, reason)
+				if err != nil {
+					return err
+				}
+				stateReasonEntryList[stateReasonEntry.Id] = *stateReasonEntry
+			}
+		}
+
 		return nil
 	})
 	if err != nil {
@@ -216,6 +306,10 @@ func dbDumpInternal(db *bolt.DB) (Db, error) {
 	dump.BlockVolumes = blockvolEntryList
 	dump.DbAttributes = dbattributeEntryList
 	dump.PendingOperations = pendingOpEntryList
+	dump.Snapshots = snapshotEntryList
+	dump.Replications = replicationEntryList
+	dump.Tenants = tenantEntryList
+	dump.StateReasons = stateReasonEntryList
 
 	return dump, nil
 }
@@ -267,6 +361,167 @@ func (a *App) DbDump(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+var (
+	// Default number of largest entries of each bucket reported by
+	// the db statistics
+	DbStatsLargestEntries = 5
+)
+
+// dbStats counts the entries of every bucket of the db whose key starts
+// with prefix and reports their size and the largest of them
+func dbStats(db wdb.RODB, prefix string, largest int) (*api.DbStatsResponse, error) {
+	resp := &api.DbStatsResponse{
+		Prefix:  prefix,
+		Buckets: []api.DbBucketStats{},
+	}
+	err := db.View(func(tx *bolt.Tx) error {
+		resp.DbSize = tx.Size()
+		for _, name := range wdb.BucketNames(tx) {
+			stats, err := wdb.GetBucketStats(tx, name, []byte(prefix), largest)
+			if err != nil {
+				return err
+			}
+			b := api.DbBucketStats{
+				Name:    stats.Name,
+				Entries: stats.Entries,
+				Size:    stats.Size,
+				Largest: []api.DbEntryStats{},
+			}
+			for _, e := range stats.Largest {
+				b.Largest = append(b.Largest, api.DbEntryStats{
+					Key:  e.Key,
+					Size: e.Size,
+				})
+			}
+			resp.Buckets = append(resp.Buckets, b)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// DbStats reports the number of entries and the size of every bucket of
+// the db, along with their largest entries
+func (a *App) DbStats(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	largest := DbStatsLargestEntries
+	if l := query.Get("largest"); l != "" {
+		var err error
+		largest, err = strconv.Atoi(l)
+		if err != nil || largest < 0 {
+			http.Error(w, "invalid number of largest entries: "+l,
+				http.StatusBadRequest)
+			return
+		}
+	}
+
+	stats, err := dbStats(a.db, query.Get("prefix"), largest)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Write msg
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(stats); err != nil {
+		panic(err)
+	}
+}
+
+// DbCheck reports the inconsistencies of the db of the running server.
+// The db is only repaired by the offline db check.
+func (a *App) DbCheck(w http.ResponseWriter, r *http.Request) {
+	var resp *api.DbCheckResponse
+	err := a.db.View(func(tx *bolt.Tx) error {
+		var err error
+		resp, err = dbCheck(tx, false)
+		return err
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Write msg
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		panic(err)
+	}
+}
+
+// dbImportable returns an error if the db already has entries that
+// a dump imported in it would mix with
+func dbImportable(tx *bolt.Tx) error {
+	for _, name := range []string{
+		BOLTDB_BUCKET_CLUSTER,
+		BOLTDB_BUCKET_NODE,
+		BOLTDB_BUCKET_DEVICE,
+		BOLTDB_BUCKET_VOLUME,
+		BOLTDB_BUCKET_BRICK,
+		BOLTDB_BUCKET_BLOCKVOLUME,
+		BOLTDB_BUCKET_PENDING_OPS,
+		BOLTDB_BUCKET_SNAPSHOT,
+		BOLTDB_BUCKET_REPLICATION,
+	} {
+		b := tx.Bucket([]byte(name))
+		if b == nil {
+			return ErrDbAccess
+		}
+		if k, _ := b.Cursor().First(); k != nil {
+			return fmt.Errorf("The db is not empty: %v entries found",
+				strings.ToLower(name))
+		}
+	}
+	return nil
+}
+
+// DbImport loads a dump of a db, as returned by the db dump, into the
+// empty db of the running server, such as a server started to replace
+// one whose db was lost. Dumps with pending operations are refused as
+// they are only cleaned up when the server starts.
+func (a *App) DbImport(w http.ResponseWriter, r *http.Request) {
+	var dump Db
+	err := utils.GetJsonFromRequest(r, &dump)
+	if err != nil {
+		http.Error(w, "request unable to be parsed", http.StatusUnprocessableEntity)
+		return
+	}
+	if len(dump.PendingOperations) != 0 {
+		http.Error(w, "Dumps with pending operations can only be imported "+
+			"with heketi db import", http.StatusBadRequest)
+		return
+	}
+
+	err = a.db.Update(func(tx *bolt.Tx) error {
+		if err := dbImportable(tx); err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return err
+		}
+		if err := dbImport(tx, &dump); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		requestLogger(r).LogError("Unable to import db: %v", err)
+		return
+	}
+	requestLogger(r).Info("Imported db with %v clusters, %v nodes and %v volumes",
+		len(dump.Clusters), len(dump.Nodes), len(dump.Volumes))
+
+	// Let the executor know about the imported nodes
+	a.setHostClusters()
+	a.setHostResolution()
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
 // DbCreate ... Creates a bolt db file based on JSON input
 func DbCreate(jsonfile string, dbfile string, debug bool) error {
 	if debug {
@@ -311,103 +566,136 @@ func DbCreate(jsonfile string, dbfile string, debug bool) error {
 	}
 
 	err = dbhandle.Update(func(tx *bolt.Tx) error {
-		for _, cluster := range dump.Clusters {
-			logger.Debug("adding cluster entry %v", cluster.Info.Id)
-			err := cluster.Save(tx)
-			if err != nil {
-				return fmt.Errorf("Could not save cluster bucket: %v", err.Error())
-			}
+		return dbImport(tx, &dump)
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// dbImport saves the entries of a dump of a db in the db
+func dbImport(tx *bolt.Tx, dump *Db) error {
+	for _, cluster := range dump.Clusters {
+		logger.Debug("adding cluster entry %v", cluster.Info.Id)
+		err := cluster.Save(tx)
+		if err != nil {
+			return fmt.Errorf("Could not save cluster bucket: %v", err.Error())
 		}
-		for _, volume := range dump.Volumes {
-			logger.Debug("adding volume entry %v", volume.Info.Id)
-			// When serializing to JSON we skipped volume.Durability
-			// Hence, while creating volume entry, we populate it
-			durability := volume.Info.Durability.Type
-			switch {
+	}
+	for _, volume := range dump.Volumes {
+		logger.Debug("adding volume entry %v", volume.Info.Id)
+		// When serializing to JSON we skipped volume.Durability
+		// Hence, while creating volume entry, we populate it
+		durability := volume.Info.Durability.Type
+		switch {
 
-			case durability == api.DurabilityReplicate:
-				volume.Durability = NewVolumeReplicaDurability(&volume.Info.Durability.Replicate)
+		case durability == api.DurabilityReplicate:
+			volume.Durability = NewVolumeReplicaDurability(&volume.Info.Durability.Replicate)
 
-			case durability == api.DurabilityEC:
-				volume.Durability = NewVolumeDisperseDurability(&volume.Info.Durability.Disperse)
+		case durability == api.DurabilityEC:
+			volume.Durability = NewVolumeDisperseDurability(&volume.Info.Durability.Disperse)
 
-			case durability == api.DurabilityDistributeOnly || durability == "":
-				volume.Durability = NewNoneDurability()
+		case durability == api.DurabilityDistributeOnly || durability == "":
+			volume.Durability = NewNoneDurability()
 
-			default:
-				return fmt.Errorf("Not a known volume type: %v", err.Error())
-			}
+		default:
+			return fmt.Errorf("Not a known volume type: %v", durability)
+		}
 
-			// Set the default values accordingly
-			volume.Durability.SetDurability()
-			err := volume.Save(tx)
-			if err != nil {
-				return fmt.Errorf("Could not save volume bucket: %v", err.Error())
-			}
+		// Set the default values accordingly
+		volume.Durability.SetDurability()
+		err := volume.Save(tx)
+		if err != nil {
+			return fmt.Errorf("Could not save volume bucket: %v", err.Error())
 		}
-		for _, brick := range dump.Bricks {
-			logger.Debug("adding brick entry %v", brick.Info.Id)
-			err := brick.Save(tx)
-			if err != nil {
-				return fmt.Errorf("Could not save brick bucket: %v", err.Error())
-			}
+	}
+	for _, brick := range dump.Bricks {
+		logger.Debug("adding brick entry %v", brick.Info.Id)
+		err := brick.Save(tx)
+		if err != nil {
+			return fmt.Errorf("Could not save brick bucket: %v", err.Error())
 		}
-		for _, node := range dump.Nodes {
-			logger.Debug("adding node entry %v", node.Info.Id)
-			err := node.Save(tx)
-			if err != nil {
-				return fmt.Errorf("Could not save node bucket: %v", err.Error())
-			}
-			logger.Debug("registering node entry %v", node.Info.Id)
-			err = node.Register(tx)
-			if err != nil {
-				return fmt.Errorf("Could not register node: %v", err.Error())
-			}
+	}
+	for _, node := range dump.Nodes {
+		logger.Debug("adding node entry %v", node.Info.Id)
+		err := node.Save(tx)
+		if err != nil {
+			return fmt.Errorf("Could not save node bucket: %v", err.Error())
 		}
-		for _, device := range dump.Devices {
-			logger.Debug("adding device entry %v", device.Info.Id)
-			err := device.Save(tx)
-			if err != nil {
-				return fmt.Errorf("Could not save device bucket: %v", err.Error())
-			}
-			logger.Debug("registering device entry %v", device.Info.Id)
-			err = device.Register(tx)
-			if err != nil {
-				return fmt.Errorf("Could not register device: %v", err.Error())
-			}
+		logger.Debug("registering node entry %v", node.Info.Id)
+		err = node.Register(tx)
+		if err != nil {
+			return fmt.Errorf("Could not register node: %v", err.Error())
 		}
-		for _, blockvolume := range dump.BlockVolumes {
-			logger.Debug("adding blockvolume entry %v", blockvolume.Info.Id)
-			err := blockvolume.Save(tx)
-			if err != nil {
-				return fmt.Errorf("Could not save blockvolume bucket: %v", err.Error())
-			}
+	}
+	for _, device := range dump.Devices {
+		logger.Debug("adding device entry %v", device.Info.Id)
+		err := device.Save(tx)
+		if err != nil {
+			return fmt.Errorf("Could not save device bucket: %v", err.Error())
 		}
-		for _, dbattribute := range dump.DbAttributes {
-			logger.Debug("adding dbattribute entry %v", dbattribute.Key)
-			err := dbattribute.Save(tx)
-			if err != nil {
-				return fmt.Errorf("Could not save dbattribute bucket: %v", err.Error())
-			}
+		logger.Debug("registering device entry %v", device.Info.Id)
+		err = device.Register(tx)
+		if err != nil {
+			return fmt.Errorf("Could not register device: %v", err.Error())
 		}
-		for _, pendingop := range dump.PendingOperations {
-			logger.Debug("adding pending operation entry %v", pendingop.Id)
-			err := pendingop.Save(tx)
-			if err != nil {
-				return fmt.Errorf("Could not save pending operation bucket: %v", err.Error())
-			}
+	}
+	for _, blockvolume := range dump.BlockVolumes {
+		logger.Debug("adding blockvolume entry %v", blockvolume.Info.Id)
+		err := blockvolume.Save(tx)
+		if err != nil {
+			return fmt.Errorf("Could not save blockvolume bucket: %v", err.Error())
 		}
-		// always record a new generation id on db import as the db contents
-		// were no longer fully under heketi's control
-		logger.Debug("recording new DB generation ID")
-		if err := recordNewDBGenerationID(tx); err != nil {
-			return fmt.Errorf("Could not record DB generation ID: %v", err.Error())
+	}
+	for _, dbattribute := range dump.DbAttributes {
+		logger.Debug("adding dbattribute entry %v", dbattribute.Key)
+		err := dbattribute.Save(tx)
+		if err != nil {
+			return fmt.Errorf("Could not save dbattribute bucket: %v", err.Error())
 		}
-		return nil
-	})
-	if err != nil {
-		return err
 	}
-
+	for _, pendingop := range dump.PendingOperations {
+		logger.Debug("adding pending operation entry %v", pendingop.Id)
+		err := pendingop.Save(tx)
+		if err != nil {
+			return fmt.Errorf("Could not save pending operation bucket: %v", err.Error())
+		}
+	}
+	for _, snapshot := range dump.Snapshots {
+		logger.Debug("adding snapshot entry %v", snapshot.Info.Id)
+		err := snapshot.Save(tx)
+		if err != nil {
+			return fmt.Errorf("Could not save snapshot bucket: %v", err.Error())
+		}
+	}
+	for _, replication := range dump.Replications {
+		logger.Debug("adding replication entry %v", replication.Info.Id)
+		err := replication.Save(tx)
+		if err != nil {
+			return fmt.Errorf("Could not save replication bucket: %v", err.Error())
+		}
+	}
+	for _, tenant := range dump.Tenants {
+		logger.Debug("adding tenant entry %v", tenant.Name)
+		err := tenant.Save(tx)
+		if err != nil {
+			return fmt.Errorf("Could not save tenant bucket: %v", err.Error())
+		}
+	}
+	for _, reason := range dump.StateReasons {
+		logger.Debug("adding state reason entry %v", reason.Id)
+		err := reason.Save(tx)
+		if err != nil {
+			return fmt.Errorf("Could not save state reason bucket: %v", err.Error())
+		}
+	}
+	// always record a new generation id on db import as the db contents
+	// were no longer fully under heketi's control
+	logger.Debug("recording new DB generation ID")
+	if err := recordNewDBGenerationID(tx); err != nil {
+		return fmt.Errorf("Could not record DB generation ID: %v", err.Error())
+	}
 	return nil
 }
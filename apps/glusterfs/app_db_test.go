@@ -0,0 +1,207 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	client "github.com/heketi/heketi/client/api/go-client"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/tests"
+)
+
+func TestDbStats(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	c := client.NewClientNoAuth(ts.URL)
+	tests.Assert(t, c != nil)
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		3,    // nodes_per_cluster
+		2,    // devices_per_node,
+		2*TB, // disksize
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	req := &api.VolumeCreateRequest{}
+	req.Size = 10
+	req.Durability.Type = api.DurabilityReplicate
+	req.Durability.Replicate.Replica = 3
+	vol, err := c.VolumeCreate(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	buckets := func(stats *api.DbStatsResponse) map[string]api.DbBucketStats {
+		m := map[string]api.DbBucketStats{}
+		for _, b := range stats.Buckets {
+			m[b.Name] = b
+		}
+		return m
+	}
+
+	stats, err := c.DbStats("", -1)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, stats.DbSize > 0, stats.DbSize)
+	b := buckets(stats)
+	tests.Assert(t, b[BOLTDB_BUCKET_NODE].Entries == 3, b[BOLTDB_BUCKET_NODE])
+	tests.Assert(t, b[BOLTDB_BUCKET_DEVICE].Entries == 6, b[BOLTDB_BUCKET_DEVICE])
+	tests.Assert(t, b[BOLTDB_BUCKET_VOLUME].Entries == 1, b[BOLTDB_BUCKET_VOLUME])
+	tests.Assert(t, b[BOLTDB_BUCKET_PENDING_OPS].Entries == 0, b[BOLTDB_BUCKET_PENDING_OPS])
+	brick := b[BOLTDB_BUCKET_BRICK]
+	tests.Assert(t, brick.Entries == 3, brick)
+	tests.Assert(t, len(brick.Largest) == 3, brick.Largest)
+	tests.Assert(t, brick.Largest[0].Size >= brick.Largest[2].Size, brick.Largest)
+	total := 0
+	for _, e := range brick.Largest {
+		total += e.Size
+	}
+	tests.Assert(t, brick.Size == total, brick.Size, total)
+
+	stats, err = c.DbStats("", 1)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	b = buckets(stats)
+	tests.Assert(t, len(b[BOLTDB_BUCKET_BRICK].Largest) == 1)
+
+	// Only the entries with the id of the volume
+	stats, err = c.DbStats(vol.Id, -1)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, stats.Prefix == vol.Id)
+	b = buckets(stats)
+	tests.Assert(t, b[BOLTDB_BUCKET_VOLUME].Entries == 1, b[BOLTDB_BUCKET_VOLUME])
+	tests.Assert(t, b[BOLTDB_BUCKET_VOLUME].Largest[0].Key == vol.Id)
+	tests.Assert(t, b[BOLTDB_BUCKET_NODE].Entries == 0, b[BOLTDB_BUCKET_NODE])
+
+	r, err := http.Get(ts.URL + "/db/stats?largest=many")
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusBadRequest, r.StatusCode)
+}
+
+func TestDbImport(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	c := client.NewClientNoAuth(ts.URL)
+	tests.Assert(t, c != nil)
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		3,    // nodes_per_cluster
+		2,    // devices_per_node,
+		2*TB, // disksize
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	req := &api.VolumeCreateRequest{}
+	req.Size = 10
+	req.Durability.Type = api.DurabilityReplicate
+	req.Durability.Replicate.Replica = 3
+	_, err = c.VolumeCreate(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	dump, err := c.DbDump()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// The db of the server is not empty
+	err = c.DbImport(strings.NewReader(dump))
+	tests.Assert(t, err != nil, "expected err != nil")
+	tests.Assert(t, strings.Contains(err.Error(), "not empty"), err)
+
+	tmpfile2 := tests.Tempfile()
+	defer os.Remove(tmpfile2)
+
+	app2 := NewTestApp(tmpfile2)
+	defer app2.Close()
+	router2 := mux.NewRouter()
+	app2.SetRoutes(router2)
+
+	ts2 := httptest.NewServer(router2)
+	defer ts2.Close()
+
+	c2 := client.NewClientNoAuth(ts2.URL)
+	tests.Assert(t, c2 != nil)
+
+	err = c2.DbImport(strings.NewReader("not json"))
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	err = c2.DbImport(strings.NewReader(dump))
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	dump2, err := c2.DbDump()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// The entries are the same, the generation id of the db is new
+	var db1, db2 Db
+	tests.Assert(t, json.Unmarshal([]byte(dump), &db1) == nil)
+	tests.Assert(t, json.Unmarshal([]byte(dump2), &db2) == nil)
+	tests.Assert(t, db1.DbAttributes[DB_GENERATION_ID].Value !=
+		db2.DbAttributes[DB_GENERATION_ID].Value)
+	db1.DbAttributes, db2.DbAttributes = nil, nil
+	tests.Assert(t, reflect.DeepEqual(db1, db2), db1, db2)
+
+	// The server uses the imported entries
+	_, err = c2.VolumeCreate(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	list, err := c2.VolumeList()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(list.Volumes) == 2, list.Volumes)
+}
+
+func TestDbImportPendingOperations(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	c := client.NewClientNoAuth(ts.URL)
+	tests.Assert(t, c != nil)
+
+	dump := Db{
+		PendingOperations: map[string]PendingOperationEntry{
+			"abc": *NewPendingOperationEntry("abc"),
+		},
+	}
+	b, err := json.Marshal(dump)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	err = c.DbImport(bytes.NewReader(b))
+	tests.Assert(t, err != nil, "expected err != nil")
+	tests.Assert(t, strings.Contains(err.Error(), "pending operations"), err)
+}
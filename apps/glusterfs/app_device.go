@@ -11,14 +11,107 @@ package glusterfs
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 
 	"github.com/boltdb/bolt"
 	"github.com/gorilla/mux"
+	"github.com/heketi/heketi/executors"
+	wdb "github.com/heketi/heketi/pkg/db"
 	"github.com/heketi/heketi/pkg/glusterfs/api"
 	"github.com/heketi/heketi/pkg/utils"
 )
 
+// registerDevice registers the device on its node and returns the node
+func registerDevice(db wdb.DB, device *DeviceEntry) (*NodeEntry, error) {
+	var node *NodeEntry
+	err := db.Update(func(tx *bolt.Tx) error {
+		var err error
+		node, err = NewNodeEntryFromId(tx, device.NodeId)
+		if err != nil {
+			return err
+		}
+		return device.Register(tx)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+// addDeviceToNode sets up the registered device on the node and saves
+// it with the tags and enclosure of the request. The device is torn
+// down and its registration removed if it could not be added.
+func addDeviceToNode(db wdb.DB,
+	executor executors.Executor,
+	node *NodeEntry,
+	device *DeviceEntry,
+	msg *api.DeviceAddRequest) (e error) {
+
+	defer func() {
+		if e != nil {
+			db.Update(func(tx *bolt.Tx) error {
+				err := device.Deregister(tx)
+				if err != nil {
+					logger.Err(err)
+					return err
+				}
+
+				return nil
+			})
+		}
+	}()
+
+	// Setup device on node
+	info, err := executor.DeviceSetup(node.ManageHostName(),
+		device.Info.Name, device.Info.Id)
+	if err != nil {
+		return err
+	}
+
+	// Create an entry for the device and set the size
+	device.StorageSet(info.Size)
+	device.SetExtentSize(info.ExtentSize)
+
+	// Setup garbage collector on error
+	defer func() {
+		if e != nil {
+			executor.DeviceTeardown(node.ManageHostName(),
+				device.Info.Name,
+				device.Info.Id)
+		}
+	}()
+
+	// Save on db
+	err = db.Update(func(tx *bolt.Tx) error {
+
+		nodeEntry, err := NewNodeEntryFromId(tx, node.Info.Id)
+		if err != nil {
+			return err
+		}
+
+		// Add device to node
+		nodeEntry.DeviceAdd(device.Info.Id)
+		nodeEntry.SetDeviceTags(device.Info.Id, msg.Tags)
+		nodeEntry.SetDeviceEnclosure(device.Info.Id, msg.Enclosure)
+
+		// Commit
+		err = nodeEntry.Save(tx)
+		if err != nil {
+			return err
+		}
+
+		// Save drive
+		return device.Save(tx)
+	})
+	if err != nil {
+		return err
+	}
+
+	logger.Info("Added device %v", msg.Name)
+	return nil
+}
+
 func (a *App) DeviceAdd(w http.ResponseWriter, r *http.Request) {
 
 	var msg api.DeviceAddRequest
@@ -29,9 +122,12 @@ func (a *App) DeviceAdd(w http.ResponseWriter, r *http.Request) {
 	}
 
 	err = msg.Validate()
+	if err == nil {
+		err = validateDeviceAddLimits(&msg)
+	}
 	if err != nil {
 		http.Error(w, "validation failed: "+err.Error(), http.StatusBadRequest)
-		logger.LogError("validation failed: " + err.Error())
+		requestLogger(r).LogError("validation failed: " + err.Error())
 		return
 	}
 
@@ -44,104 +140,26 @@ func (a *App) DeviceAdd(w http.ResponseWriter, r *http.Request) {
 	// Create device entry
 	device := NewDeviceEntryFromRequest(&msg)
 
-	// Check the node is in the db
-	var node *NodeEntry
-	err = a.db.Update(func(tx *bolt.Tx) error {
-		var err error
-		node, err = NewNodeEntryFromId(tx, msg.NodeId)
-		if err == ErrNotFound {
-			http.Error(w, "Node id does not exist", http.StatusNotFound)
-			return err
-		} else if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return err
-		}
-
-		// Register device
-		err = device.Register(tx)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusConflict)
-			return err
-		}
-
-		return nil
-	})
-	if err != nil {
+	// Check the node is in the db and register device
+	node, err := registerDevice(a.db, device)
+	if err == ErrNotFound {
+		http.Error(w, "Node id does not exist", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
 		return
 	}
 
 	// Log the devices are being added
-	logger.Info("Adding device %v to node %v", msg.Name, msg.NodeId)
+	requestLogger(r).Info("Adding device %v to node %v", msg.Name, msg.NodeId)
 
 	// Add device in an asynchronous function
-	a.asyncManager.AsyncHttpRedirectFunc(w, r, func() (seeOtherUrl string, e error) {
-
-		defer func() {
-			if e != nil {
-				a.db.Update(func(tx *bolt.Tx) error {
-					err := device.Deregister(tx)
-					if err != nil {
-						logger.Err(err)
-						return err
-					}
-
-					return nil
-				})
-			}
-		}()
-
-		// Setup device on node
-		info, err := a.executor.DeviceSetup(node.ManageHostName(),
-			device.Info.Name, device.Info.Id)
-		if err != nil {
-			return "", err
-		}
-
-		// Create an entry for the device and set the size
-		device.StorageSet(info.Size)
-		device.SetExtentSize(info.ExtentSize)
-
-		// Setup garbage collector on error
-		defer func() {
-			if e != nil {
-				a.executor.DeviceTeardown(node.ManageHostName(),
-					device.Info.Name,
-					device.Info.Id)
-			}
-		}()
-
-		// Save on db
-		err = a.db.Update(func(tx *bolt.Tx) error {
-
-			nodeEntry, err := NewNodeEntryFromId(tx, msg.NodeId)
-			if err != nil {
-				return err
-			}
-
-			// Add device to node
-			nodeEntry.DeviceAdd(device.Info.Id)
-
-			// Commit
-			err = nodeEntry.Save(tx)
-			if err != nil {
-				return err
-			}
-
-			// Save drive
-			err = device.Save(tx)
-			if err != nil {
-				return err
-			}
-
-			return nil
-
-		})
+	a.asyncHttpRedirectFunc(w, r, func() (string, error) {
+		err := addDeviceToNode(a.db, a.requestExecutor(r), node, device, &msg)
 		if err != nil {
 			return "", err
 		}
 
-		logger.Info("Added device %v", msg.Name)
-
 		// Done
 		// Returning a null string instructs the async manager
 		// to return http status of 204 (No Content)
@@ -208,13 +226,13 @@ func (a *App) DeviceDelete(w http.ResponseWriter, r *http.Request) {
 			return err
 		} else if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return logger.Err(err)
+			return requestLogger(r).Err(err)
 		}
 
 		// Check if we can delete the device
 		if device.HasBricks() {
 			http.Error(w, device.ConflictString(), http.StatusConflict)
-			logger.LogError(device.ConflictString())
+			requestLogger(r).LogError(device.ConflictString())
 			return ErrConflict
 		}
 
@@ -222,7 +240,7 @@ func (a *App) DeviceDelete(w http.ResponseWriter, r *http.Request) {
 		node, err = NewNodeEntryFromId(tx, device.NodeId)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return logger.Err(err)
+			return requestLogger(r).Err(err)
 		}
 
 		return nil
@@ -232,11 +250,11 @@ func (a *App) DeviceDelete(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Delete device
-	logger.Info("Deleting device %v on node %v", device.Info.Id, device.NodeId)
-	a.asyncManager.AsyncHttpRedirectFunc(w, r, func() (string, error) {
+	requestLogger(r).Info("Deleting device %v on node %v", device.Info.Id, device.NodeId)
+	a.asyncHttpRedirectFunc(w, r, func() (string, error) {
 
 		// Teardown device
-		err := a.executor.DeviceTeardown(node.ManageHostName(),
+		err := a.requestExecutor(r).DeviceTeardown(node.ManageHostName(),
 			device.Info.Name, device.Info.Id)
 		if err != nil {
 			return "", err
@@ -248,13 +266,13 @@ func (a *App) DeviceDelete(w http.ResponseWriter, r *http.Request) {
 			// Access node entry
 			node, err := NewNodeEntryFromId(tx, device.NodeId)
 			if err == ErrNotFound {
-				logger.Critical(
+				requestLogger(r).Critical(
 					"Node id %v pointed to by device %v, but it is not in the db",
 					device.NodeId,
 					device.Info.Id)
 				return err
 			} else if err != nil {
-				logger.Err(err)
+				requestLogger(r).Err(err)
 				return err
 			}
 
@@ -267,14 +285,14 @@ func (a *App) DeviceDelete(w http.ResponseWriter, r *http.Request) {
 			// Delete device from db
 			err = device.Delete(tx)
 			if err != nil {
-				logger.Err(err)
+				requestLogger(r).Err(err)
 				return err
 			}
 
 			// Deregister device
 			err = device.Deregister(tx)
 			if err != nil {
-				logger.Err(err)
+				requestLogger(r).Err(err)
 				return err
 			}
 
@@ -286,7 +304,7 @@ func (a *App) DeviceDelete(w http.ResponseWriter, r *http.Request) {
 		}
 
 		// Show that the key has been deleted
-		logger.Info("Deleted node [%s]", id)
+		requestLogger(r).Info("Deleted node [%s]", id)
 
 		return "", nil
 	})
@@ -309,7 +327,7 @@ func (a *App) DeviceSetState(w http.ResponseWriter, r *http.Request) {
 	err = msg.Validate()
 	if err != nil {
 		http.Error(w, "validation failed: "+err.Error(), http.StatusBadRequest)
-		logger.LogError("validation failed: " + err.Error())
+		requestLogger(r).LogError("validation failed: " + err.Error())
 		return
 	}
 
@@ -331,105 +349,338 @@ func (a *App) DeviceSetState(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Set state
-	a.asyncManager.AsyncHttpRedirectFunc(w, r, func() (string, error) {
-		err = device.SetState(a.db, a.executor, a.Allocator(), msg.State)
+	reason := newStateReason(msg.Reason, msg.Message, requestActor(r))
+	a.asyncHttpRedirectFunc(w, r, func() (string, error) {
+		err = device.SetStateWithReason(a.db, a.requestExecutor(r), a.requestAllocator(r),
+			msg.State, reason)
 		if err != nil {
 			return "", err
 		}
+		if msg.State == api.EntryStateFailed {
+			a.notify(api.EventDeviceFailed, device.Info.Id, "",
+				fmt.Sprintf("Device %v on node %v failed",
+					device.Info.Name, device.NodeId))
+		}
 		return "", nil
 	})
 }
 
-func (a *App) DeviceResync(w http.ResponseWriter, r *http.Request) {
+func (a *App) DeviceRemove(w http.ResponseWriter, r *http.Request) {
+	// Get the id from the URL
+	vars := mux.Vars(r)
+	id := vars["id"]
+	var device *DeviceEntry
+	var node *NodeEntry
+
+	// Check for valid id, return immediately if not valid
+	err := a.db.View(func(tx *bolt.Tx) error {
+		var err error
+		device, err = NewDeviceEntryFromId(tx, id)
+		if err == ErrNotFound {
+			http.Error(w, "Id not found", http.StatusNotFound)
+			return err
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+
+		node, err = NewNodeEntryFromId(tx, device.NodeId)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	allocator := a.replaceAllocator(w, r, node.Info.ClusterId, device.Bricks)
+	if allocator == nil {
+		return
+	}
+
+	// Migrate the bricks off the device
+	requestLogger(r).Info("Removing device %v on node %v", device.Info.Id, device.NodeId)
+	reason := newStateReason(api.StateReasonRemoved, "", requestActor(r))
+	a.asyncHttpRedirectFunc(w, r, func() (string, error) {
+		err := device.Drain(a.db, a.requestExecutor(r), allocator, reason)
+		if err != nil {
+			return "", err
+		}
+		requestLogger(r).Info("Removed device %v", device.Info.Id)
+		return "", nil
+	})
+}
 
+func (a *App) DeviceReplaceBricks(w http.ResponseWriter, r *http.Request) {
+	// Get the id from the URL
 	vars := mux.Vars(r)
-	deviceId := vars["id"]
+	id := vars["id"]
 
-	var (
-		device *DeviceEntry
-		node   *NodeEntry
-	)
+	var device *DeviceEntry
+	var node *NodeEntry
 
-	// Get device info from DB
+	// Check for valid id, return immediately if not valid
 	err := a.db.View(func(tx *bolt.Tx) error {
 		var err error
-		device, err = NewDeviceEntryFromId(tx, deviceId)
-		if err != nil {
+		device, err = NewDeviceEntryFromId(tx, id)
+		if err == ErrNotFound {
+			http.Error(w, "Id not found", http.StatusNotFound)
+			return err
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return err
 		}
 		node, err = NewNodeEntryFromId(tx, device.NodeId)
 		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return err
 		}
 		return nil
 	})
+	if err != nil {
+		return
+	}
+
+	// Bricks of pending operations can not be planned for
+	if p, err := PendingOperationsOnDevice(a.db, id); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	} else if p {
+		http.Error(w, "device is in use by a pending operation",
+			http.StatusConflict)
+		return
+	}
+
+	allocator := a.replaceAllocator(w, r, node.Info.ClusterId, device.Bricks)
+	if allocator == nil {
+		return
+	}
+
+	// Replace all the bricks of the device
+	requestLogger(r).Info("Replacing the bricks of device %v", id)
+	a.asyncHttpRedirectFunc(w, r, func() (string, error) {
+		err := ReplaceDeviceBricks(a.db, a.requestExecutor(r), allocator, id)
+		if err != nil {
+			return "", err
+		}
+		requestLogger(r).Info("Replaced the bricks of device %v", id)
+		return "/devices/" + id, nil
+	})
+}
+
+func (a *App) DeviceResync(w http.ResponseWriter, r *http.Request) {
+
+	vars := mux.Vars(r)
+	deviceId := vars["id"]
+
+	// Get device info from DB
+	err := a.db.View(func(tx *bolt.Tx) error {
+		_, err := NewDeviceEntryFromId(tx, deviceId)
+		return err
+	})
 	if err == ErrNotFound {
 		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	} else if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
-		logger.Err(err)
+		requestLogger(r).Err(err)
 		return
 	}
 
-	logger.Info("Checking for device %v changes", deviceId)
+	requestLogger(r).Info("Checking for device %v changes", deviceId)
 
 	// Check and update device in background
-	a.asyncManager.AsyncHttpRedirectFunc(w, r, func() (seeOtherUrl string, e error) {
+	a.asyncHttpRedirectFunc(w, r, func() (seeOtherUrl string, e error) {
+		_, err := ResyncDevice(a.db, a.requestExecutor(r), deviceId)
+		return "", err
+	})
+}
 
-		// Get actual device info from manage host
-		info, err := a.executor.GetDeviceInfo(node.ManageHostName(), device.Info.Name, device.Info.Id)
-		if err != nil {
-			return "", err
+// DeviceResyncReport resyncs the device like DeviceResync and returns
+// what was changed and the logical volumes no brick uses
+func (a *App) DeviceResyncReport(w http.ResponseWriter, r *http.Request) {
+
+	vars := mux.Vars(r)
+	deviceId := vars["id"]
+
+	requestLogger(r).Info("Checking for device %v changes", deviceId)
+	resp, err := ResyncDevice(a.db, a.requestExecutor(r), deviceId)
+	if err == ErrNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w,
+			fmt.Sprintf("Failed to resync device: %v", err),
+			http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		panic(err)
+	}
+}
+
+// DeviceLvm returns the names of the volume group and logical volumes
+// of the device
+func (a *App) DeviceLvm(w http.ResponseWriter, r *http.Request) {
+
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	var info *api.DeviceLvmResponse
+	err := a.db.View(func(tx *bolt.Tx) error {
+		entry, err := NewDeviceEntryFromId(tx, id)
+		if err == ErrNotFound {
+			http.Error(w, "Id not found", http.StatusNotFound)
+			return err
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
 		}
 
-		// Note that method GetDeviceInfo returns the free disk space available for allocation.
-		// The free disk space is equal to the total disk space only if we haven't already
-		// allocated space, because every allocation decreases the free disk space returned
-		// by method GetDeviceInfo. In order to calculate a new total space we need to sum
-		// the free disk space and the space used by heketi.
-		if device.Info.Storage.Total == info.Size+device.Info.Storage.Used {
-			logger.Info("Device %v is up to date", device.Info.Id)
-			return "", nil
+		info, err = entry.NewLvmResponse(tx)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
 		}
+		return err
+	})
+	if err != nil {
+		return
+	}
 
-		logger.Debug("Free space of '%v' (%v) has changed %v -> %v", device.Info.Name, device.Info.Id,
-			device.Info.Storage.Free, info.Size)
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(info); err != nil {
+		panic(err)
+	}
+}
 
-		// Update device
-		err = a.db.Update(func(tx *bolt.Tx) error {
+func (a *App) DeviceSetTags(w http.ResponseWriter, r *http.Request) {
+	// Get the id from the URL
+	vars := mux.Vars(r)
+	id := vars["id"]
 
-			// Reload device in current transaction
-			device, err := NewDeviceEntryFromId(tx, deviceId)
-			if err != nil {
-				logger.Err(err)
-				return err
-			}
+	// Unmarshal JSON
+	var msg api.TagsChangeRequest
+	err := utils.GetJsonFromRequest(r, &msg)
+	if err != nil {
+		http.Error(w, "request unable to be parsed", 422)
+		return
+	}
+	err = msg.Validate()
+	if err != nil {
+		http.Error(w, "validation failed: "+err.Error(), http.StatusBadRequest)
+		requestLogger(r).LogError("validation failed: " + err.Error())
+		return
+	}
+
+	var info *api.DeviceInfoResponse
+	err = a.db.Update(func(tx *bolt.Tx) error {
+		entry, err := NewDeviceEntryFromId(tx, id)
+		if err == ErrNotFound {
+			http.Error(w, "Id not found", http.StatusNotFound)
+			return err
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
 
-			newFreeSize := info.Size
-			newTotalSize := newFreeSize + device.Info.Storage.Used
+		node, err := NewNodeEntryFromId(tx, entry.NodeId)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+		node.SetDeviceTags(entry.Info.Id,
+			applyTagsChange(node.DeviceTags[entry.Info.Id], &msg))
+		err = node.Save(tx)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
 
-			logger.Info("Updating device %v, total: %v -> %v, free: %v -> %v", device.Info.Name,
-				device.Info.Storage.Total, newTotalSize, device.Info.Storage.Free, newFreeSize)
+		info, err = entry.NewInfoResponse(tx)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+	requestLogger(r).Info("Tags of device %v set to %v", id, info.Tags)
 
-			device.Info.Storage.Total = newTotalSize
-			device.Info.Storage.Free = newFreeSize
+	// Write msg
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(info); err != nil {
+		panic(err)
+	}
+}
 
-			// Save updated device
-			err = device.Save(tx)
-			if err != nil {
-				logger.Err(err)
-				return err
-			}
+func (a *App) DeviceSetEnclosure(w http.ResponseWriter, r *http.Request) {
+	// Get the id from the URL
+	vars := mux.Vars(r)
+	id := vars["id"]
 
-			return nil
-		})
-		if err != nil {
-			return "", err
+	// Unmarshal JSON
+	var msg api.DeviceEnclosureRequest
+	err := utils.GetJsonFromRequest(r, &msg)
+	if err != nil {
+		http.Error(w, "request unable to be parsed", 422)
+		return
+	}
+	err = msg.Validate()
+	if err != nil {
+		http.Error(w, "validation failed: "+err.Error(), http.StatusBadRequest)
+		requestLogger(r).LogError("validation failed: " + err.Error())
+		return
+	}
+
+	var info *api.DeviceInfoResponse
+	err = a.db.Update(func(tx *bolt.Tx) error {
+		entry, err := NewDeviceEntryFromId(tx, id)
+		if err == ErrNotFound {
+			http.Error(w, "Id not found", http.StatusNotFound)
+			return err
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
 		}
 
-		logger.Info("Updated device %v", deviceId)
+		node, err := NewNodeEntryFromId(tx, entry.NodeId)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+		node.SetDeviceEnclosure(entry.Info.Id, msg.Enclosure)
+		err = node.Save(tx)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
 
-		return "", err
+		info, err = entry.NewInfoResponse(tx)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+		return nil
 	})
+	if err != nil {
+		return
+	}
+	requestLogger(r).Info("Enclosure of device %v set to %q", id, info.Enclosure)
+
+	// Write msg
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(info); err != nil {
+		panic(err)
+	}
 }
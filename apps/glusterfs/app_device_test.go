@@ -11,6 +11,7 @@ package glusterfs
 
 import (
 	"bytes"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -264,7 +265,8 @@ func TestDeviceAddDelete(t *testing.T) {
 
 	// Set offline
 	request = []byte(`{
-				"state" : "offline"
+				"state" : "offline",
+				"reason" : "maintenance"
 				}`)
 	r, err = http.Post(ts.URL+"/devices/"+fakeid+"/state",
 		"application/json", bytes.NewBuffer(request))
@@ -298,7 +300,8 @@ func TestDeviceAddDelete(t *testing.T) {
 
 	// Set failed
 	request = []byte(`{
-				"state" : "failed"
+				"state" : "failed",
+				"reason" : "maintenance"
 				}`)
 	r, err = http.Post(ts.URL+"/devices/"+fakeid+"/state",
 		"application/json", bytes.NewBuffer(request))
@@ -566,6 +569,53 @@ func TestDeviceInfo(t *testing.T) {
 
 }
 
+func TestDeviceLvm(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	c := client.NewClientNoAuth(ts.URL)
+	tests.Assert(t, c != nil)
+
+	err := setupSampleDbWithTopology(app, 1, 3, 1, 500*GB)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	v := NewVolumeEntryFromRequest(&api.VolumeCreateRequest{Size: 10})
+	err = v.Create(app.db, app.executor, app.Allocator())
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	var brick *BrickEntry
+	app.db.View(func(tx *bolt.Tx) error {
+		brick, err = NewBrickEntryFromId(tx, v.Bricks[0])
+		return err
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	lvm, err := c.DeviceLvm(brick.Info.DeviceId)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, lvm.Id == brick.Info.DeviceId, lvm)
+	tests.Assert(t, lvm.NodeId == brick.Info.NodeId, lvm)
+	tests.Assert(t, lvm.Vg == "vg_"+brick.Info.DeviceId, lvm)
+	tests.Assert(t, len(lvm.Bricks) == 1, lvm.Bricks)
+	b := lvm.Bricks[0]
+	tests.Assert(t, b.Id == brick.Info.Id, b)
+	tests.Assert(t, b.VolumeId == v.Info.Id, b)
+	tests.Assert(t, b.ThinPool == "tp_"+brick.Info.Id, b)
+	tests.Assert(t, b.Lv == "brick_"+brick.Info.Id, b)
+	tests.Assert(t, b.Path == brick.Info.Path, b)
+
+	_, err = c.DeviceLvm("123")
+	tests.Assert(t, err != nil, "expected err != nil")
+	tests.Assert(t, utils.GetStatusCodeFromError(err) == http.StatusNotFound, err)
+}
+
 func TestDeviceDeleteErrors(t *testing.T) {
 	tmpfile := tests.Tempfile()
 	defer os.Remove(tmpfile)
@@ -672,7 +722,8 @@ func TestDeviceState(t *testing.T) {
 
 	// Set offline
 	request := []byte(`{
-				"state" : "offline"
+				"state" : "offline",
+				"reason" : "maintenance"
 				}`)
 	r, err := http.Post(ts.URL+"/devices/"+device.Id+"/state",
 		"application/json", bytes.NewBuffer(request))
@@ -882,3 +933,226 @@ func TestDeviceSyncIdNotFound(t *testing.T) {
 	tests.Assert(t, err == nil)
 	tests.Assert(t, r.StatusCode == http.StatusNotFound)
 }
+
+func TestDeviceRemove(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	// Setup the server
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	// Create a client
+	c := client.NewClientNoAuth(ts.URL)
+	tests.Assert(t, c != nil)
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		3,    // nodes_per_cluster
+		3,    // devices_per_node,
+		5*TB, // disksize
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	vreq := &api.VolumeCreateRequest{}
+	vreq.Size = 100
+	vreq.Durability.Type = api.DurabilityReplicate
+	vreq.Durability.Replicate.Replica = 3
+	for i := 0; i < 5; i++ {
+		v := NewVolumeEntryFromRequest(vreq)
+		err = v.Create(app.db, app.executor, app.Allocator())
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	}
+
+	// grab an online device that has bricks
+	var deviceId string
+	err = app.db.View(func(tx *bolt.Tx) error {
+		dl, err := DeviceList(tx)
+		if err != nil {
+			return err
+		}
+		for _, id := range dl {
+			d, err := NewDeviceEntryFromId(tx, id)
+			if err != nil {
+				return err
+			}
+			if len(d.Bricks) > 0 {
+				deviceId = id
+				return nil
+			}
+		}
+		t.Fatalf("should have at least one device with bricks")
+		return nil
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// The device can not be deleted while it has bricks
+	err = c.DeviceDelete(deviceId)
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	app.xo.MockVolumeInfo = func(host string, volume string) (*executors.Volume, error) {
+		return mockVolumeInfoFromDb(app.db, volume)
+	}
+	app.xo.MockHealInfo = func(host string, volume string) (*executors.HealInfo, error) {
+		return mockHealStatusFromDb(app.db, volume)
+	}
+
+	err = c.DeviceRemove(deviceId)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	info, err := c.DeviceInfo(deviceId)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, info.State == api.EntryStateFailed, info.State)
+	tests.Assert(t, len(info.Bricks) == 0,
+		"expected len(info.Bricks) == 0, got:", len(info.Bricks))
+
+	// Every volume still has all of its bricks
+	err = app.db.View(func(tx *bolt.Tx) error {
+		vl, err := VolumeList(tx)
+		tests.Assert(t, err == nil)
+		for _, id := range vl {
+			v, err := NewVolumeEntryFromId(tx, id)
+			tests.Assert(t, err == nil)
+			tests.Assert(t, len(v.Bricks) == 3, len(v.Bricks))
+		}
+		return nil
+	})
+	tests.Assert(t, err == nil)
+
+	// The drained device can now be deleted
+	err = c.DeviceDelete(deviceId)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	_, err = c.DeviceInfo(deviceId)
+	tests.Assert(t, err != nil, "expected err != nil")
+}
+
+func TestDeviceRemoveIdNotFound(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	// Setup the server
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	r, err := http.Post(ts.URL+"/devices/12345/remove", "application/json", nil)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusNotFound, r.StatusCode)
+}
+
+func TestDeviceResyncReport(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	// Setup the server
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	c := client.NewClientNoAuth(ts.URL)
+	tests.Assert(t, c != nil)
+
+	err := setupSampleDbWithTopology(app,
+		1,      // clusters
+		3,      // nodes_per_cluster
+		1,      // devices_per_node,
+		500*GB, // disksize
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	vreq := &api.VolumeCreateRequest{}
+	vreq.Size = 100
+	vreq.Durability.Type = api.DurabilityReplicate
+	vreq.Durability.Replicate.Replica = 3
+	_, err = c.VolumeCreate(vreq)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	var device *DeviceEntry
+	app.db.View(func(tx *bolt.Tx) error {
+		dl, err := DeviceList(tx)
+		tests.Assert(t, err == nil)
+		device, err = NewDeviceEntryFromId(tx, dl[0])
+		tests.Assert(t, err == nil)
+		return nil
+	})
+	tests.Assert(t, len(device.Bricks) == 1, device.Bricks)
+	brickId := device.Bricks[0]
+	used := device.Info.Storage.Used
+
+	// The volume group lost 10GiB to a logical volume made by hand
+	app.xo.MockDeviceSetup = func(host, dev, vgid string) (*executors.DeviceInfo, error) {
+		tests.Assert(t, vgid == device.Info.Id, vgid)
+		d := &executors.DeviceInfo{}
+		d.TotalSize = 500 * GB
+		d.ExtentSize = 4096
+		d.Size = 500*GB - used - 10*GB
+		d.FreeExtents = d.Size / d.ExtentSize
+		return d, nil
+	}
+	app.xo.MockDeviceLvs = func(host, vgid string) ([]executors.LvInfo, error) {
+		return []executors.LvInfo{
+			{Name: utils.BrickIdToThinPoolName(brickId), Size: used},
+			{Name: utils.BrickIdToName(brickId),
+				ThinPool: utils.BrickIdToThinPoolName(brickId)},
+			{Name: "snap_0", ThinPool: utils.BrickIdToThinPoolName(brickId)},
+			{Name: "tp_gone", Size: 5 * GB},
+			{Name: "brick_gone", ThinPool: "tp_gone"},
+			{Name: "manual", Size: 5 * GB},
+		}, nil
+	}
+
+	resp, err := c.DeviceResyncReport(device.Info.Id)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, resp.OldStorage == device.Info.Storage, resp.OldStorage)
+	tests.Assert(t, resp.Storage.Free == 500*GB-used-10*GB, resp.Storage)
+	tests.Assert(t, resp.Storage.Total == 500*GB-10*GB, resp.Storage)
+	tests.Assert(t, resp.Storage.Used == used, resp.Storage)
+	tests.Assert(t, resp.VgSize == 500*GB, resp.VgSize)
+	tests.Assert(t, resp.FreeExtents == resp.Storage.Free/4096, resp.FreeExtents)
+	tests.Assert(t, len(resp.OrphanedLvs) == 3, resp.OrphanedLvs)
+	tests.Assert(t, resp.OrphanedLvs[0] == "brick_gone", resp.OrphanedLvs)
+	tests.Assert(t, resp.OrphanedLvs[1] == "manual", resp.OrphanedLvs)
+	tests.Assert(t, resp.OrphanedLvs[2] == "tp_gone", resp.OrphanedLvs)
+
+	info, err := c.DeviceInfo(device.Info.Id)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, info.Storage == resp.Storage, info.Storage)
+
+	// A device in sync is not changed
+	resp, err = c.DeviceResyncReport(device.Info.Id)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, resp.OldStorage == resp.Storage, resp)
+
+	// The free space is resynced when the snapshots can not be listed
+	app.xo.MockDeviceSnapshotUsage = func(host, vgid string) ([]executors.ThinPoolUsage, error) {
+		return nil, fmt.Errorf("lvs failed")
+	}
+	resp, err = c.DeviceResyncReport(device.Info.Id)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, resp.OldStorage == resp.Storage, resp)
+
+	// The asynchronous resync is kept for older clients
+	err = c.DeviceResync(device.Info.Id)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	_, err = c.DeviceResyncReport("12345")
+	tests.Assert(t, err != nil, "expected err != nil")
+	tests.Assert(t, utils.GetStatusCodeFromError(err) == http.StatusNotFound, err)
+}
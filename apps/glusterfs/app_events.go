@@ -0,0 +1,59 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/boltdb/bolt"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+)
+
+func (a *App) EventList(w http.ResponseWriter, r *http.Request) {
+	filter := &EventFilter{}
+	if v := r.URL.Query().Get("since"); v != "" {
+		t, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || t < 0 {
+			http.Error(w, "invalid since time: "+v, http.StatusBadRequest)
+			return
+		}
+		filter.Since = t
+	}
+
+	// Users only see the events about the volumes of their tenant
+	if requestIssuer(r) == "user" {
+		filter.Scoped = true
+		err := a.db.View(func(tx *bolt.Tx) error {
+			tenant, err := UserTenant(tx, requestSubject(r))
+			if tenant != nil {
+				filter.Tenant = tenant.Name
+			}
+			return err
+		})
+		if err != nil {
+			requestLogger(r).Err(err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	resp := api.EventListResponse{
+		Events: a.events.list(filter),
+	}
+
+	// Send list back
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		panic(err)
+	}
+}
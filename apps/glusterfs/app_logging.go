@@ -0,0 +1,165 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+
+	"github.com/heketi/heketi/executors"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/heketi/pkg/utils"
+)
+
+// Request ids sent by the clients are kept only if they are short and
+// safe to put in the logs
+var requestIdRegexp = regexp.MustCompile(`^[a-zA-Z0-9_.:-]{1,64}$`)
+
+// requestIdHandler puts the id of the request in the context of the
+// request. The handlers pass it on to the operations, the allocator and
+// the executor so that the messages logged for the request are tagged
+// with the id. The id is returned in the response.
+func requestIdHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(api.HeaderRequestId)
+		if !requestIdRegexp.MatchString(id) {
+			id = utils.GenUUID()
+		}
+		w.Header().Set(api.HeaderRequestId, id)
+
+		next.ServeHTTP(w, r.WithContext(utils.WithRequestId(r.Context(), id)))
+	})
+}
+
+// requestId returns the id of the request set by requestIdHandler
+func requestId(r *http.Request) string {
+	return utils.RequestIdFrom(r.Context())
+}
+
+// requestLogger returns the logger tagging the messages with the id of
+// the request
+func requestLogger(r *http.Request) *utils.Logger {
+	return logger.WithRequestId(requestId(r))
+}
+
+// executorWithRequestId returns the executor running the commands for
+// the request with the id. Executors not tagging the messages with the
+// id of the request are returned unchanged.
+func executorWithRequestId(e executors.Executor, id string) executors.Executor {
+	if s, ok := e.(executors.RequestScoper); ok && id != "" {
+		return s.WithRequestId(id)
+	}
+	return e
+}
+
+// requestExecutor returns the executor of the app for the request
+func (a *App) requestExecutor(r *http.Request) executors.Executor {
+	return executorWithRequestId(a.executor, requestId(r))
+}
+
+// executorLogger returns the logger tagging the messages with the id of
+// the request the executor runs the commands for, if any
+func executorLogger(e executors.Executor) *utils.Logger {
+	if s, ok := e.(interface {
+		RequestId() string
+	}); ok {
+		return logger.WithRequestId(s.RequestId())
+	}
+	return logger
+}
+
+// requestAllocator is the allocator placing the bricks for a request
+type requestAllocator struct {
+	Allocator
+	requestId string
+}
+
+// allocatorWithRequestId returns the allocator placing the bricks for
+// the request with the id
+func allocatorWithRequestId(allocator Allocator, id string) Allocator {
+	if ra, ok := allocator.(*requestAllocator); ok {
+		allocator = ra.Allocator
+	}
+	if id == "" {
+		return allocator
+	}
+	return &requestAllocator{Allocator: allocator, requestId: id}
+}
+
+// requestAllocator returns the allocator of the app for the request
+func (a *App) requestAllocator(r *http.Request) Allocator {
+	return allocatorWithRequestId(a.Allocator(), requestId(r))
+}
+
+// allocatorLogger returns the logger tagging the messages with the id of
+// the request the allocator places the bricks for, if any
+func allocatorLogger(allocator Allocator) *utils.Logger {
+	if ra, ok := allocator.(*requestAllocator); ok {
+		return logger.WithRequestId(ra.requestId)
+	}
+	return logger
+}
+
+func logLevelName(level utils.LogLevel) string {
+	switch level {
+	case utils.LEVEL_NOLOG:
+		return api.LogLevelNone
+	case utils.LEVEL_CRITICAL:
+		return api.LogLevelCritical
+	case utils.LEVEL_ERROR:
+		return api.LogLevelError
+	case utils.LEVEL_WARNING:
+		return api.LogLevelWarning
+	case utils.LEVEL_INFO:
+		return api.LogLevelInfo
+	default:
+		return api.LogLevelDebug
+	}
+}
+
+func (a *App) logLevelResponse(w http.ResponseWriter) {
+	resp := &api.LogLevelResponse{
+		Level:  logLevelName(logger.Level()),
+		Format: utils.GetLogFormat(),
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		panic(err)
+	}
+}
+
+func (a *App) LogLevel(w http.ResponseWriter, r *http.Request) {
+	a.logLevelResponse(w)
+}
+
+func (a *App) LogLevelSet(w http.ResponseWriter, r *http.Request) {
+	var msg api.LogLevelRequest
+	err := utils.GetJsonFromRequest(r, &msg)
+	if err != nil {
+		http.Error(w, "request unable to be parsed", 422)
+		return
+	}
+	err = msg.Validate()
+	if err != nil {
+		http.Error(w, "validation failed: "+err.Error(), http.StatusBadRequest)
+		requestLogger(r).LogError("validation failed: " + err.Error())
+		return
+	}
+
+	// Logged before the change so that it is seen when lowering the level
+	requestLogger(r).Warning("Setting log level to %v", msg.Level)
+	a.setLogLevel(msg.Level)
+	a.executor.SetLogLevel(msg.Level)
+
+	a.logLevelResponse(w)
+}
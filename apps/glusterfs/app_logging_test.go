@@ -0,0 +1,121 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gorilla/mux"
+	client "github.com/heketi/heketi/client/api/go-client"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/heketi/pkg/utils"
+	"github.com/heketi/tests"
+)
+
+func TestLogLevel(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	c := client.NewClientNoAuth(ts.URL)
+	tests.Assert(t, c != nil)
+
+	defer logger.SetLevel(logger.Level())
+
+	resp, err := c.LogLevelSet(&api.LogLevelRequest{Level: api.LogLevelInfo})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, resp.Level == api.LogLevelInfo, resp)
+	tests.Assert(t, resp.Format == utils.LOG_FORMAT_TEXT, resp)
+	tests.Assert(t, logger.Level() == utils.LEVEL_INFO)
+
+	resp, err = c.LogLevel()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, resp.Level == api.LogLevelInfo, resp)
+
+	_, err = c.LogLevelSet(&api.LogLevelRequest{Level: "verbose"})
+	tests.Assert(t, err != nil)
+	tests.Assert(t, logger.Level() == utils.LEVEL_INFO)
+}
+
+func TestRequestIdHeader(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	// The id of the client is returned
+	req, err := http.NewRequest("GET", ts.URL+"/clusters", nil)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	req.Header.Set(api.HeaderRequestId, "client-id-1")
+	r, err := http.DefaultClient.Do(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	r.Body.Close()
+	tests.Assert(t, r.StatusCode == http.StatusOK, r.StatusCode)
+	tests.Assert(t, r.Header.Get(api.HeaderRequestId) == "client-id-1",
+		r.Header.Get(api.HeaderRequestId))
+
+	// An id is generated for the requests without a valid one
+	req, err = http.NewRequest("GET", ts.URL+"/clusters", nil)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	req.Header.Set(api.HeaderRequestId, "bad id")
+	r, err = http.DefaultClient.Do(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	r.Body.Close()
+	id := r.Header.Get(api.HeaderRequestId)
+	tests.Assert(t, id != "" && id != "bad id", id)
+}
+
+func TestAsyncRequestId(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	ids := make(chan string, 1)
+	router.Methods("POST").Path("/testasync").Handler(requestIdHandler(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			app.asyncHttpRedirectFunc(w, r, func() (string, error) {
+				ids <- allocatorLogger(app.requestAllocator(r)).RequestId()
+				return "", nil
+			})
+		})))
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	req, err := http.NewRequest("POST", ts.URL+"/testasync", nil)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	req.Header.Set(api.HeaderRequestId, "async-id")
+	r, err := http.DefaultClient.Do(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	r.Body.Close()
+
+	// The operation logs with the id of the request
+	tests.Assert(t, <-ids == "async-id")
+}
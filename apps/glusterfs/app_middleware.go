@@ -10,7 +10,9 @@
 package glusterfs
 
 import (
+	stdcontext "context"
 	"net/http"
+	"regexp"
 	"strings"
 
 	jwt "github.com/dgrijalva/jwt-go"
@@ -22,6 +24,8 @@ import (
 
 var (
 	kubeBackupDbToSecret = kubernetes.KubeBackupDbToSecret
+
+	tenantUsagePathRegexp = regexp.MustCompile(`^/tenants/[a-zA-Z0-9_.@-]+/usage$`)
 )
 
 // Authorization function
@@ -35,13 +39,28 @@ func (a *App) Auth(w http.ResponseWriter, r *http.Request, next http.HandlerFunc
 	claims := token.Claims.(jwt.MapClaims)
 
 	// Check access
-	if "user" == claims["iss"] && r.URL.Path != "/volumes" {
+	if "user" == claims["iss"] && !userAllowed(r) {
 		http.Error(w, "Administrator access required", http.StatusUnauthorized)
 		return
 	}
 
-	// Everything is clean
-	next(w, r)
+	// Everything is clean. The token is kept in the context of the
+	// request as well, since the requests derived from it by the
+	// router do not share the values of the JWT middleware.
+	next(w, r.WithContext(stdcontext.WithValue(r.Context(), jwtTokenKey{}, token)))
+}
+
+// userAllowed returns true if the tokens of the user role can make the
+// request. Users create volumes, see the usage of their tenant and the
+// events about its volumes, the handlers check that the tenant is
+// theirs.
+func userAllowed(r *http.Request) bool {
+	if r.URL.Path == "/volumes" {
+		return true
+	}
+	return r.Method == http.MethodGet &&
+		(r.URL.Path == "/events" ||
+			tenantUsagePathRegexp.MatchString(r.URL.Path))
 }
 
 // Backup database to a secret
@@ -66,9 +85,9 @@ func (a *App) BackupToKubernetesSecret(
 	// Backup database
 	err := kubeBackupDbToSecret(a.db)
 	if err != nil {
-		logger.Err(err)
+		requestLogger(r).Err(err)
 	} else {
-		logger.Info("Backup successful")
+		requestLogger(r).Info("Backup successful")
 	}
 }
 
@@ -11,14 +11,143 @@ package glusterfs
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 
 	"github.com/boltdb/bolt"
 	"github.com/gorilla/mux"
+	"github.com/heketi/heketi/executors"
+	wdb "github.com/heketi/heketi/pkg/db"
 	"github.com/heketi/heketi/pkg/glusterfs/api"
 	"github.com/heketi/heketi/pkg/utils"
 )
 
+// nodeAddressFamilyOk checks that the preferred address family of the
+// node has a storage hostname of that family
+func nodeAddressFamilyOk(msg *api.NodeAddRequest) error {
+	if msg.AddressFamily == "" {
+		return nil
+	}
+	for _, name := range msg.Hostnames.Storage {
+		if utils.AddressFamily(name) == msg.AddressFamily {
+			return nil
+		}
+	}
+	return fmt.Errorf("address_family: no storage hostname is an %v address",
+		msg.AddressFamily)
+}
+
+// registerNode registers the hostnames of the node and returns the
+// cluster it is added to
+func registerNode(db wdb.DB, node *NodeEntry) (*ClusterEntry, error) {
+	var cluster *ClusterEntry
+	err := db.Update(func(tx *bolt.Tx) error {
+		var err error
+		cluster, err = NewClusterEntryFromId(tx, node.Info.ClusterId)
+		if err != nil {
+			return err
+		}
+		return node.Register(tx)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cluster, nil
+}
+
+// deregisterNode removes the registration of a node that could not be
+// added
+func deregisterNode(db wdb.DB, node *NodeEntry) {
+	db.Update(func(tx *bolt.Tx) error {
+		node.Deregister(tx)
+		return nil
+	})
+}
+
+// nodeAddPeer sets up the executor for the new node and returns the
+// hostname of a node of the cluster running glusterd to peer probe it
+// from. It is empty for the first node of the cluster, which must run
+// glusterd itself.
+func nodeAddPeer(db wdb.RODB,
+	executor executors.Executor,
+	cluster *ClusterEntry,
+	node *NodeEntry) (string, error) {
+
+	// Commands for the new node use the environment of its cluster
+	if mapper, ok := executor.(executors.HostClusterMapper); ok {
+		mapper.SetHostCluster(node.ManageHostName(), cluster.Info.Id)
+	}
+	if resolver, ok := executor.(executors.HostResolver); ok {
+		resolver.SetHostAlternates(node.ManageHostName(),
+			node.Info.Hostnames.Manage[1:])
+	}
+
+	// Get a node's hostname in the cluster to execute the Gluster peer command
+	// only if there is more than one node
+	if len(cluster.Info.Nodes) > 0 {
+		peer, err := GetVerifiedManageHostname(db, executor, cluster.Info.Id)
+		if err != nil {
+			logger.Err(err)
+			return "", logger.LogError("None of the nodes in cluster has glusterd running")
+		}
+		return peer, nil
+	}
+	if err := executor.GlusterdCheck(node.ManageHostName()); err != nil {
+		logger.Err(err)
+		return "", logger.LogError("New Node doesn't have glusterd running")
+	}
+	return "", nil
+}
+
+// addNodeToCluster peer probes the registered node from the peer and
+// saves it in its cluster. The registration of the node is removed if
+// it could not be added.
+func addNodeToCluster(db wdb.DB,
+	executor executors.Executor,
+	node *NodeEntry,
+	peer string) (e error) {
+
+	// Cleanup in case of failure
+	defer func() {
+		if e != nil {
+			deregisterNode(db, node)
+		}
+	}()
+
+	// Peer probe if there is at least one other node
+	if peer != "" {
+		err := executor.PeerProbe(peer, node.StorageHostName())
+		if err != nil {
+			return err
+		}
+	}
+
+	// Add node entry into the db
+	err := db.Update(func(tx *bolt.Tx) error {
+		cluster, err := NewClusterEntryFromId(tx, node.Info.ClusterId)
+		if err != nil {
+			return err
+		}
+
+		// Add node to cluster
+		cluster.NodeAdd(node.Info.Id)
+
+		// Save cluster
+		err = cluster.Save(tx)
+		if err != nil {
+			return err
+		}
+
+		// Save node
+		return node.Save(tx)
+	})
+	if err != nil {
+		return err
+	}
+	logger.Info("Added node " + node.Info.Id)
+	return nil
+}
+
 func (a *App) NodeAdd(w http.ResponseWriter, r *http.Request) {
 	var msg api.NodeAddRequest
 
@@ -29,9 +158,12 @@ func (a *App) NodeAdd(w http.ResponseWriter, r *http.Request) {
 	}
 
 	err = msg.Validate()
+	if err == nil {
+		err = validateNodeAddLimits(&msg)
+	}
 	if err != nil {
 		http.Error(w, "validation failed: "+err.Error(), http.StatusBadRequest)
-		logger.LogError("validation failed: " + err.Error())
+		requestLogger(r).LogError("validation failed: " + err.Error())
 		return
 	}
 
@@ -61,114 +193,40 @@ func (a *App) NodeAdd(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// The preferred address family needs a storage address of that family
+	if err := nodeAddressFamilyOk(&msg); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// Create a node entry
 	node := NewNodeEntryFromRequest(&msg)
 
-	// Get cluster and peer node hostname
-	var cluster *ClusterEntry
-	var peer_node_hostname string
-	err = a.db.Update(func(tx *bolt.Tx) error {
-		var err error
-		cluster, err = NewClusterEntryFromId(tx, msg.ClusterId)
-		if err == ErrNotFound {
-			http.Error(w, "Cluster id does not exist", http.StatusNotFound)
-			return err
-		} else if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return err
-		}
-
-		// Register node
-		err = node.Register(tx)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusConflict)
-			return err
-		}
-		return nil
-	})
-	if err != nil {
+	// Get cluster and register node
+	cluster, err := registerNode(a.db, node)
+	if err == ErrNotFound {
+		http.Error(w, "Cluster id does not exist", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
 		return
 	}
 
-	// Get a node's hostname in the cluster to execute the Gluster peer command
-	// only if there is more than one node
-	if len(cluster.Info.Nodes) > 0 {
-		peer_node_hostname, err = GetVerifiedManageHostname(a.db, a.executor, cluster.Info.Id)
-		if err != nil {
-			logger.Err(err)
-			err := logger.LogError("None of the nodes in cluster has glusterd running")
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
-	} else {
-		err := a.executor.GlusterdCheck(node.ManageHostName())
-		if err != nil {
-			logger.Err(err)
-			err := logger.LogError("New Node doesn't have glusterd running")
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
+	// Get peer node hostname
+	peer_node_hostname, err := nodeAddPeer(a.db, a.requestExecutor(r), cluster, node)
+	if err != nil {
+		deregisterNode(a.db, node)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
 	// Add node
-	logger.Info("Adding node %v", node.ManageHostName())
-	a.asyncManager.AsyncHttpRedirectFunc(w, r, func() (seeother string, e error) {
-
-		// Cleanup in case of failure
-		defer func() {
-			if e != nil {
-				a.db.Update(func(tx *bolt.Tx) error {
-					node.Deregister(tx)
-					return nil
-				})
-			}
-		}()
-
-		// Peer probe if there is at least one other node
-		// TODO: What happens if the peer_node is not responding.. we need to choose another.
-		// It will only choose the working one now. Hence done.
-		if peer_node_hostname != "" {
-			err := a.executor.PeerProbe(peer_node_hostname, node.StorageHostName())
-			if err != nil {
-				return "", err
-			}
-		}
-
-		// Add node entry into the db
-		err = a.db.Update(func(tx *bolt.Tx) error {
-			cluster, err := NewClusterEntryFromId(tx, msg.ClusterId)
-			if err == ErrNotFound {
-				http.Error(w, "Cluster id does not exist", http.StatusNotFound)
-				return err
-			} else if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return err
-			}
-
-			// Add node to cluster
-			cluster.NodeAdd(node.Info.Id)
-
-			// Save cluster
-			err = cluster.Save(tx)
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return err
-			}
-
-			// Save node
-			err = node.Save(tx)
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return err
-			}
-
-			return nil
-
-		})
+	requestLogger(r).Info("Adding node %v", node.ManageHostName())
+	a.asyncHttpRedirectFunc(w, r, func() (string, error) {
+		err := addNodeToCluster(a.db, a.requestExecutor(r), node, peer_node_hostname)
 		if err != nil {
 			return "", err
 		}
-		logger.Info("Added node " + node.Info.Id)
 		return "/nodes/" + node.Info.Id, nil
 	})
 }
@@ -232,13 +290,13 @@ func (a *App) NodeDelete(w http.ResponseWriter, r *http.Request) {
 			return err
 		} else if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return logger.Err(err)
+			return requestLogger(r).Err(err)
 		}
 
 		// Check the node can be deleted
 		if !node.IsDeleteOk() {
 			http.Error(w, node.ConflictString(), http.StatusConflict)
-			logger.LogError(node.ConflictString())
+			requestLogger(r).LogError(node.ConflictString())
 			return ErrConflict
 		}
 
@@ -249,7 +307,7 @@ func (a *App) NodeDelete(w http.ResponseWriter, r *http.Request) {
 			return err
 		} else if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return logger.Err(err)
+			return requestLogger(r).Err(err)
 		}
 
 		// Get a node in the cluster to execute the Gluster peer command
@@ -259,7 +317,7 @@ func (a *App) NodeDelete(w http.ResponseWriter, r *http.Request) {
 			for index := range cluster.Info.Nodes {
 				peer_node, err = cluster.NodeEntryFromClusterIndex(tx, index)
 				if err != nil {
-					return logger.Err(err)
+					return requestLogger(r).Err(err)
 				}
 
 				// Cannot peer detach from the same node, we need to execute
@@ -276,12 +334,12 @@ func (a *App) NodeDelete(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Delete node asynchronously
-	logger.Info("Deleting node %v [%v]", node.ManageHostName(), node.Info.Id)
-	a.asyncManager.AsyncHttpRedirectFunc(w, r, func() (string, error) {
+	requestLogger(r).Info("Deleting node %v [%v]", node.ManageHostName(), node.Info.Id)
+	a.asyncHttpRedirectFunc(w, r, func() (string, error) {
 
 		// Remove from trusted pool
 		if peer_node != nil {
-			err := a.executor.PeerDetach(peer_node.ManageHostName(), node.StorageHostName())
+			err := a.requestExecutor(r).PeerDetach(peer_node.ManageHostName(), node.StorageHostName())
 			if err != nil {
 				return "", err
 			}
@@ -293,12 +351,12 @@ func (a *App) NodeDelete(w http.ResponseWriter, r *http.Request) {
 			// Get Cluster
 			cluster, err := NewClusterEntryFromId(tx, node.Info.ClusterId)
 			if err == ErrNotFound {
-				logger.Critical("Cluster id %v is expected be in db. Pointed to by node %v",
+				requestLogger(r).Critical("Cluster id %v is expected be in db. Pointed to by node %v",
 					node.Info.ClusterId,
 					node.Info.Id)
 				return err
 			} else if err != nil {
-				logger.Err(err)
+				requestLogger(r).Err(err)
 				return err
 			}
 			cluster.NodeDelete(node.Info.Id)
@@ -306,7 +364,7 @@ func (a *App) NodeDelete(w http.ResponseWriter, r *http.Request) {
 			// Save cluster
 			err = cluster.Save(tx)
 			if err != nil {
-				logger.Err(err)
+				requestLogger(r).Err(err)
 				return err
 			}
 
@@ -316,7 +374,7 @@ func (a *App) NodeDelete(w http.ResponseWriter, r *http.Request) {
 			// Delete node from db
 			err = node.Delete(tx)
 			if err != nil {
-				logger.Err(err)
+				requestLogger(r).Err(err)
 				return err
 			}
 
@@ -327,7 +385,7 @@ func (a *App) NodeDelete(w http.ResponseWriter, r *http.Request) {
 			return "", err
 		}
 		// Show that the key has been deleted
-		logger.Info("Deleted node [%s]", id)
+		requestLogger(r).Info("Deleted node [%s]", id)
 
 		return "", nil
 
@@ -350,7 +408,7 @@ func (a *App) NodeSetState(w http.ResponseWriter, r *http.Request) {
 	err = msg.Validate()
 	if err != nil {
 		http.Error(w, "validation failed: "+err.Error(), http.StatusBadRequest)
-		logger.LogError("validation failed: " + err.Error())
+		requestLogger(r).LogError("validation failed: " + err.Error())
 		return
 	}
 
@@ -372,8 +430,10 @@ func (a *App) NodeSetState(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Set state
-	a.asyncManager.AsyncHttpRedirectFunc(w, r, func() (string, error) {
-		err = node.SetState(a.db, a.executor, a.Allocator(), msg.State)
+	reason := newStateReason(msg.Reason, msg.Message, requestActor(r))
+	a.asyncHttpRedirectFunc(w, r, func() (string, error) {
+		err = node.SetStateWithReason(a.db, a.requestExecutor(r), a.requestAllocator(r),
+			msg.State, reason)
 		if err != nil {
 			return "", err
 		}
@@ -382,3 +442,215 @@ func (a *App) NodeSetState(w http.ResponseWriter, r *http.Request) {
 	})
 
 }
+
+func (a *App) NodeRemove(w http.ResponseWriter, r *http.Request) {
+	// Get the id from the URL
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	// Check the node exists
+	err := a.db.View(func(tx *bolt.Tx) error {
+		_, err := NewNodeEntryFromId(tx, id)
+		if err == ErrNotFound {
+			http.Error(w, "Id not found", http.StatusNotFound)
+			return err
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	// Evacuate the node
+	reason := newStateReason(api.StateReasonRemoved, "", requestActor(r))
+	a.asyncHttpRedirectFunc(w, r, func() (string, error) {
+		err := RemoveNode(a.db, a.requestExecutor(r), a.requestAllocator(r), id, reason)
+		if err != nil {
+			return "", err
+		}
+		return "/nodes/" + id + "/remove", nil
+	})
+}
+
+func (a *App) NodeRemoveStatus(w http.ResponseWriter, r *http.Request) {
+	// Get the id from the URL
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	var progress *api.NodeRemoveProgress
+	err := a.db.View(func(tx *bolt.Tx) error {
+		node, err := NewNodeEntryFromId(tx, id)
+		if err == ErrNotFound {
+			http.Error(w, "Id not found", http.StatusNotFound)
+			return err
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+		if node.Removal == nil {
+			http.Error(w, "Node has not been removed", http.StatusNotFound)
+			return ErrNotFound
+		}
+		progress = node.Removal
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	// Write msg
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(progress); err != nil {
+		panic(err)
+	}
+}
+
+func (a *App) NodeRestartBricks(w http.ResponseWriter, r *http.Request) {
+	// Get the id from the URL
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	var msg api.NodeBrickRestartRequest
+	err := utils.GetJsonFromRequest(r, &msg)
+	if err != nil {
+		http.Error(w, "request unable to be parsed", http.StatusUnprocessableEntity)
+		return
+	}
+	err = msg.Validate()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		requestLogger(r).LogError("validation failed: " + err.Error())
+		return
+	}
+
+	// Check the node exists and is not already restarting its bricks
+	err = a.db.View(func(tx *bolt.Tx) error {
+		node, err := NewNodeEntryFromId(tx, id)
+		if err == ErrNotFound {
+			http.Error(w, "Id not found", http.StatusNotFound)
+			return err
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+		if !node.isOnline() {
+			err := fmt.Errorf("Node %v is not online", id)
+			http.Error(w, err.Error(), http.StatusConflict)
+			return err
+		}
+		if node.BrickRestart != nil &&
+			node.BrickRestart.State == api.BrickRestartRunning {
+			err := fmt.Errorf("Bricks of node %v are already being restarted", id)
+			http.Error(w, err.Error(), http.StatusConflict)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	// Restart the bricks
+	a.asyncHttpRedirectFunc(w, r, func() (string, error) {
+		err := RestartNodeBricks(a.db, a.requestExecutor(r), id, msg.HealTimeout)
+		if err != nil {
+			return "", err
+		}
+		return "/nodes/" + id + "/restart-bricks", nil
+	})
+}
+
+func (a *App) NodeRestartBricksStatus(w http.ResponseWriter, r *http.Request) {
+	// Get the id from the URL
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	var progress *api.NodeBrickRestartProgress
+	err := a.db.View(func(tx *bolt.Tx) error {
+		node, err := NewNodeEntryFromId(tx, id)
+		if err == ErrNotFound {
+			http.Error(w, "Id not found", http.StatusNotFound)
+			return err
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+		if node.BrickRestart == nil {
+			http.Error(w, "Bricks of node have not been restarted", http.StatusNotFound)
+			return ErrNotFound
+		}
+		progress = node.BrickRestart
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	// Write msg
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(progress); err != nil {
+		panic(err)
+	}
+}
+
+func (a *App) NodeSetTags(w http.ResponseWriter, r *http.Request) {
+	// Get the id from the URL
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	// Unmarshal JSON
+	var msg api.TagsChangeRequest
+	err := utils.GetJsonFromRequest(r, &msg)
+	if err != nil {
+		http.Error(w, "request unable to be parsed", 422)
+		return
+	}
+	err = msg.Validate()
+	if err != nil {
+		http.Error(w, "validation failed: "+err.Error(), http.StatusBadRequest)
+		requestLogger(r).LogError("validation failed: " + err.Error())
+		return
+	}
+
+	var info *api.NodeInfoResponse
+	err = a.db.Update(func(tx *bolt.Tx) error {
+		entry, err := NewNodeEntryFromId(tx, id)
+		if err == ErrNotFound {
+			http.Error(w, "Id not found", http.StatusNotFound)
+			return err
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+
+		entry.Info.Tags = applyTagsChange(entry.Info.Tags, &msg)
+		err = entry.Save(tx)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+
+		info, err = entry.NewInfoReponse(tx)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+	requestLogger(r).Info("Tags of node %v set to %v", id, info.Tags)
+
+	// Write msg
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(info); err != nil {
+		panic(err)
+	}
+}
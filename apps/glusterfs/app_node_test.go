@@ -1084,7 +1084,8 @@ func TestNodeState(t *testing.T) {
 
 	// Set node offline
 	request := []byte(`{
-				"state" : "offline"
+				"state" : "offline",
+				"reason" : "maintenance"
 				}`)
 	r, err := http.Post(ts.URL+"/nodes/"+node.Id+"/state",
 		"application/json", bytes.NewBuffer(request))
@@ -1114,7 +1115,8 @@ func TestNodeState(t *testing.T) {
 
 	// Set offline again, should succeed
 	request = []byte(`{
-				"state" : "offline"
+				"state" : "offline",
+				"reason" : "maintenance"
 				}`)
 	r, err = http.Post(ts.URL+"/nodes/"+node.Id+"/state",
 		"application/json", bytes.NewBuffer(request))
@@ -1197,7 +1199,8 @@ func TestNodeState(t *testing.T) {
 
 	// Set device offline
 	request = []byte(`{
-				"state" : "offline"
+				"state" : "offline",
+				"reason" : "maintenance"
 				}`)
 	r, err = http.Post(ts.URL+"/devices/"+device.Id+"/state",
 		"application/json", bytes.NewBuffer(request))
@@ -1222,7 +1225,8 @@ func TestNodeState(t *testing.T) {
 
 	// Set Node offline
 	request = []byte(`{
-				"state" : "offline"
+				"state" : "offline",
+				"reason" : "maintenance"
 				}`)
 	r, err = http.Post(ts.URL+"/nodes/"+node.Id+"/state",
 		"application/json", bytes.NewBuffer(request))
@@ -1341,7 +1345,8 @@ func TestNodeInfoAfterDelete(t *testing.T) {
 
 	// Set node offline
 	request := []byte(`{
-				"state" : "offline"
+				"state" : "offline",
+				"reason" : "maintenance"
 				}`)
 	r, err := http.Post(ts.URL+"/nodes/"+node.Id+"/state",
 		"application/json", bytes.NewBuffer(request))
@@ -1408,7 +1413,8 @@ func TestNodeInfoAfterDelete(t *testing.T) {
 
 	// Set node offline
 	request = []byte(`{
-				"state" : "offline"
+				"state" : "offline",
+				"reason" : "maintenance"
 				}`)
 	r, err = http.Post(ts.URL+"/nodes/"+nodeid+"/state",
 		"application/json", bytes.NewBuffer(request))
@@ -1416,3 +1422,87 @@ func TestNodeInfoAfterDelete(t *testing.T) {
 	tests.Assert(t, r.StatusCode == http.StatusNotFound)
 
 }
+
+func TestNodeStateReason(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	c := client.NewClientNoAuth(ts.URL)
+	tests.Assert(t, c != nil)
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		3,    // nodes_per_cluster
+		1,    // devices_per_node,
+		2*TB, // disksize
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	clusters, err := c.ClusterList()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	cluster, err := c.ClusterInfo(clusters.Clusters[0])
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	nodeId := cluster.Nodes[0]
+
+	// A reason is required to take the node offline
+	err = c.NodeState(nodeId, &api.StateRequest{State: api.EntryStateOffline})
+	tests.Assert(t, err != nil, "expected err != nil")
+	err = c.NodeState(nodeId, &api.StateRequest{
+		State:  api.EntryStateOffline,
+		Reason: api.StateReasonOther,
+	})
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	start := time.Now().Unix()
+	err = c.NodeState(nodeId, &api.StateRequest{
+		State:   api.EntryStateOffline,
+		Reason:  api.StateReasonHardwareFailure,
+		Message: "bad controller",
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	node, err := c.NodeInfo(nodeId)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, node.State == api.EntryStateOffline, node.State)
+	tests.Assert(t, node.StateReason != nil)
+	tests.Assert(t, node.StateReason.Code == api.StateReasonHardwareFailure,
+		node.StateReason)
+	tests.Assert(t, node.StateReason.Message == "bad controller",
+		node.StateReason)
+	tests.Assert(t, node.StateReason.Time >= start, node.StateReason)
+
+	// The device keeps its own reason
+	deviceId := node.DevicesInfo[0].Id
+	tests.Assert(t, node.DevicesInfo[0].StateReason == nil)
+	err = c.DeviceState(deviceId, &api.StateRequest{
+		State:  api.EntryStateOffline,
+		Reason: api.StateReasonDecommissioned,
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	device, err := c.DeviceInfo(deviceId)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, device.StateReason != nil)
+	tests.Assert(t, device.StateReason.Code == api.StateReasonDecommissioned,
+		device.StateReason)
+
+	// The reasons are dropped once back online
+	err = c.DeviceState(deviceId, &api.StateRequest{State: api.EntryStateOnline})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	device, err = c.DeviceInfo(deviceId)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, device.StateReason == nil, device.StateReason)
+
+	err = c.NodeState(nodeId, &api.StateRequest{State: api.EntryStateOnline})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	node, err = c.NodeInfo(nodeId)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, node.StateReason == nil, node.StateReason)
+}
@@ -0,0 +1,204 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/boltdb/bolt"
+	"github.com/gorilla/mux"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+)
+
+func (a *App) OperationList(w http.ResponseWriter, r *http.Request) {
+
+	list := api.OperationListResponse{
+		Operations: []api.OperationInfo{},
+	}
+
+	// Get all the pending operations from the DB
+	err := a.db.View(func(tx *bolt.Tx) error {
+		ids, err := PendingOperationList(tx)
+		if err != nil {
+			return err
+		}
+
+		for _, id := range ids {
+			p, err := NewPendingOperationEntryFromId(tx, id)
+			if err != nil {
+				return err
+			}
+			list.Operations = append(list.Operations, *p.NewInfoResponse())
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		requestLogger(r).Err(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Send list back
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(list); err != nil {
+		panic(err)
+	}
+}
+
+func (a *App) OperationHistory(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := &OperationHistoryFilter{
+		Entity: query.Get("entity"),
+		Type:   query.Get("type"),
+	}
+	for _, param := range []struct {
+		name  string
+		value *int64
+	}{
+		{"since", &filter.Since},
+		{"until", &filter.Until},
+	} {
+		v := query.Get(param.name)
+		if v == "" {
+			continue
+		}
+		t, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || t < 0 {
+			http.Error(w, "invalid "+param.name+" time: "+v,
+				http.StatusBadRequest)
+			return
+		}
+		*param.value = t
+	}
+
+	entries, err := OperationHistory(a.db, filter)
+	if err != nil {
+		requestLogger(r).Err(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	history := api.OperationHistoryResponse{
+		Operations: []api.OperationHistoryInfo{},
+	}
+	for _, h := range entries {
+		history.Operations = append(history.Operations, *h.NewInfoResponse())
+	}
+
+	// Send list back
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(history); err != nil {
+		panic(err)
+	}
+}
+
+func (a *App) CommandOutputList(w http.ResponseWriter, r *http.Request) {
+	outputs, err := CommandOutputList(a.db)
+	if err != nil {
+		requestLogger(r).Err(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	list := api.CommandOutputListResponse{
+		Outputs: outputs,
+	}
+
+	// Send list back
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(list); err != nil {
+		panic(err)
+	}
+}
+
+func (a *App) CommandOutputInfo(w http.ResponseWriter, r *http.Request) {
+
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	var info *api.CommandOutputInfoResponse
+	err := a.db.View(func(tx *bolt.Tx) error {
+		entry, err := NewCommandOutputEntryFromId(tx, id)
+		if err == ErrNotFound {
+			http.Error(w, "Id not found", http.StatusNotFound)
+			return err
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+
+		info = entry.NewInfoResponse()
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	// Write msg
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(info); err != nil {
+		panic(err)
+	}
+}
+
+func (a *App) AuditLog(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := &AuditLogFilter{
+		ObjectId: query.Get("id"),
+	}
+	for _, param := range []struct {
+		name  string
+		value *int64
+	}{
+		{"since", &filter.Since},
+		{"until", &filter.Until},
+	} {
+		v := query.Get(param.name)
+		if v == "" {
+			continue
+		}
+		t, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || t < 0 {
+			http.Error(w, "invalid "+param.name+" time: "+v,
+				http.StatusBadRequest)
+			return
+		}
+		*param.value = t
+	}
+
+	entries, err := AuditLog(a.db, filter)
+	if err != nil {
+		requestLogger(r).Err(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp := api.AuditLogResponse{
+		Entries: []api.AuditLogEntryInfo{},
+	}
+	for _, e := range entries {
+		resp.Entries = append(resp.Entries, *e.NewInfoResponse())
+	}
+
+	// Send list back
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		panic(err)
+	}
+}
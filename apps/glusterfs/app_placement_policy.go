@@ -0,0 +1,67 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/heketi/pkg/utils"
+)
+
+func (a *App) PlacementPolicyExport(w http.ResponseWriter, r *http.Request) {
+	policy, err := ExportPlacementPolicy(a.db, a.AllocatorName())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(policy); err != nil {
+		panic(err)
+	}
+}
+
+func (a *App) PlacementPolicyImport(w http.ResponseWriter, r *http.Request) {
+	var msg api.PlacementPolicy
+	err := utils.GetJsonFromRequest(r, &msg)
+	if err != nil {
+		http.Error(w, "request unable to be parsed", 422)
+		return
+	}
+	err = msg.Validate()
+	if err != nil {
+		http.Error(w, "validation failed: "+err.Error(), http.StatusBadRequest)
+		requestLogger(r).LogError("validation failed: " + err.Error())
+		return
+	}
+
+	resp, err := ImportPlacementPolicy(a.db, &msg, a.AllocatorName())
+	if _, ok := err.(*policyMismatchError); ok {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		requestLogger(r).LogError("Placement policy not imported: %v", err)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	requestLogger(r).Info("Imported placement policy of %v clusters", len(msg.Clusters))
+	for _, warning := range resp.Warnings {
+		requestLogger(r).Warning("%v", warning)
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		panic(err)
+	}
+}
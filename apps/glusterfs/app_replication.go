@@ -0,0 +1,269 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/boltdb/bolt"
+	"github.com/gorilla/mux"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/heketi/pkg/utils"
+)
+
+func (a *App) ReplicationCreate(w http.ResponseWriter, r *http.Request) {
+	requestLogger(r).Debug("In ReplicationCreate")
+
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	var msg api.ReplicationCreateRequest
+	err := utils.GetJsonFromRequest(r, &msg)
+	if err != nil {
+		http.Error(w, "request unable to be parsed", 422)
+		return
+	}
+	err = msg.Validate()
+	if err != nil {
+		http.Error(w, "validation failed: "+err.Error(), http.StatusBadRequest)
+		requestLogger(r).LogError("validation failed: " + err.Error())
+		return
+	}
+
+	var volume *VolumeEntry
+	err = a.db.View(func(tx *bolt.Tx) error {
+		var err error
+		volume, err = NewVolumeEntryFromId(tx, id)
+		if err == ErrNotFound {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return err
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+
+		if !volume.Visible() {
+			// treat an invisible volume like it doesn't exist
+			http.Error(w, "Id not found", http.StatusNotFound)
+			return ErrNotFound
+		}
+
+		if volume.Info.Block {
+			err := requestLogger(r).LogError("Cannot replicate a block hosting volume")
+			http.Error(w, err.Error(), http.StatusConflict)
+			return err
+		}
+
+		if _, err := NewClusterEntryFromId(tx, msg.Cluster); err != nil {
+			http.Error(w, fmt.Sprintf("Cluster id %v not found", msg.Cluster),
+				http.StatusBadRequest)
+			requestLogger(r).LogError("Cluster id %v not found", msg.Cluster)
+			return err
+		}
+
+		if msg.Cluster == volume.Info.Cluster {
+			err := requestLogger(r).LogError("Cannot replicate volume %v to its own cluster",
+				volume.Info.Id)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	rc := NewReplicationCreateOperation(volume, msg.Cluster, a.db)
+	if err := AsyncHttpOperation(a, w, r, rc); err != nil {
+		if err == ErrConflict {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		http.Error(w,
+			fmt.Sprintf("Failed to set up replication create: %v", err),
+			http.StatusInternalServerError)
+		return
+	}
+}
+
+func (a *App) ReplicationList(w http.ResponseWriter, r *http.Request) {
+
+	var list api.ReplicationListResponse
+	err := a.db.View(func(tx *bolt.Tx) error {
+		ids, err := ReplicationList(tx)
+		if err != nil {
+			return err
+		}
+
+		list.Replications = []string{}
+		for _, id := range ids {
+			repl, err := NewReplicationEntryFromId(tx, id)
+			if err != nil {
+				return err
+			}
+			if repl.Visible() {
+				list.Replications = append(list.Replications, id)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		requestLogger(r).Err(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Send list back
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(list); err != nil {
+		panic(err)
+	}
+}
+
+func (a *App) ReplicationInfo(w http.ResponseWriter, r *http.Request) {
+
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	var info *api.ReplicationInfoResponse
+	err := a.db.View(func(tx *bolt.Tx) error {
+		entry, err := NewReplicationEntryFromId(tx, id)
+		if err == ErrNotFound {
+			http.Error(w, "Id not found", http.StatusNotFound)
+			return err
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+
+		if !entry.Visible() {
+			http.Error(w, "Id not found", http.StatusNotFound)
+			return ErrNotFound
+		}
+
+		info, err = entry.NewInfoResponse(tx)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	// Write msg
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(info); err != nil {
+		panic(err)
+	}
+}
+
+// replicationError sends the error of a change of a replication
+func replicationError(w http.ResponseWriter, err error) {
+	switch err {
+	case ErrNotFound:
+		http.Error(w, "Id not found", http.StatusNotFound)
+	case ErrConflict:
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (a *App) ReplicationFailover(w http.ResponseWriter, r *http.Request) {
+	requestLogger(r).Debug("In ReplicationFailover")
+
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	var msg api.ReplicationFailoverRequest
+	err := utils.GetJsonFromRequest(r, &msg)
+	if err != nil {
+		http.Error(w, "request unable to be parsed", 422)
+		return
+	}
+
+	repl, err := FailoverReplication(a.db, a.requestExecutor(r), id, msg.Force)
+	if err != nil {
+		replicationError(w, err)
+		return
+	}
+
+	var info *api.ReplicationInfoResponse
+	err = a.db.View(func(tx *bolt.Tx) error {
+		var err error
+		info, err = repl.NewInfoResponse(tx)
+		return err
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Write msg
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(info); err != nil {
+		panic(err)
+	}
+}
+
+func (a *App) ReplicationPromote(w http.ResponseWriter, r *http.Request) {
+	requestLogger(r).Debug("In ReplicationPromote")
+
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	vol, err := PromoteReplication(a.db, a.requestExecutor(r), id)
+	if err != nil {
+		replicationError(w, err)
+		return
+	}
+
+	var info *api.VolumeInfoResponse
+	err = a.db.View(func(tx *bolt.Tx) error {
+		var err error
+		info, err = vol.NewInfoResponse(tx)
+		return err
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Write msg
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(info); err != nil {
+		panic(err)
+	}
+}
+
+func (a *App) ReplicationDelete(w http.ResponseWriter, r *http.Request) {
+
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	if err := DeleteReplication(a.db, a.requestExecutor(r), id); err != nil {
+		replicationError(w, err)
+		return
+	}
+	requestLogger(r).Info("Deleted replication [%s]", id)
+
+	// Write msg
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,255 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/gorilla/mux"
+	client "github.com/heketi/heketi/client/api/go-client"
+	"github.com/heketi/heketi/executors"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/tests"
+)
+
+// setupReplicationClusters creates two clusters and returns their ids
+func setupReplicationClusters(t *testing.T, app *App) []string {
+	err := setupSampleDbWithTopology(app,
+		2,    // clusters
+		3,    // nodes_per_cluster
+		2,    // devices_per_node,
+		2*TB, // disksize
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	var clusters []string
+	err = app.db.View(func(tx *bolt.Tx) error {
+		var err error
+		clusters, err = ClusterList(tx)
+		return err
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(clusters) == 2, clusters)
+	return clusters
+}
+
+func TestReplicationCreateFailoverPromote(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	c := client.NewClientNoAuth(ts.URL)
+	tests.Assert(t, c != nil)
+
+	clusters := setupReplicationClusters(t, app)
+
+	req := &api.VolumeCreateRequest{}
+	req.Size = 10
+	req.Clusters = []string{clusters[0]}
+	req.Durability.Type = api.DurabilityReplicate
+	req.Durability.Replicate.Replica = 3
+	req.GlusterVolumeOptions = []string{"performance.cache-size 256MB"}
+	vol, err := c.VolumeCreate(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	actions := []string{}
+	var session *executors.GeoReplicationRequest
+	app.xo.MockGeoReplicationCreate = func(host string, s *executors.GeoReplicationRequest) error {
+		session = s
+		actions = append(actions, "create")
+		return nil
+	}
+	app.xo.MockGeoReplicationAction = func(host string, s *executors.GeoReplicationRequest,
+		action string, force bool) error {
+
+		actions = append(actions, fmt.Sprintf("%v %v", action, force))
+		return nil
+	}
+
+	// The DR cluster must be another cluster
+	_, err = c.ReplicationCreate(vol.Id, &api.ReplicationCreateRequest{
+		Cluster: clusters[0],
+	})
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	repl, err := c.ReplicationCreate(vol.Id, &api.ReplicationCreateRequest{
+		Cluster: clusters[1],
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, repl.PrimaryVolume == vol.Id, repl.PrimaryVolume)
+	tests.Assert(t, repl.PrimaryCluster == clusters[0], repl.PrimaryCluster)
+	tests.Assert(t, repl.SecondaryCluster == clusters[1], repl.SecondaryCluster)
+	tests.Assert(t, repl.State == api.ReplicationActive, repl.State)
+	tests.Assert(t, strings.Join(actions, ",") == "create,start false", actions)
+
+	// The secondary volume has the layout of the primary volume
+	secondary, err := c.VolumeInfo(repl.SecondaryVolume)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, secondary.Cluster == clusters[1], secondary.Cluster)
+	tests.Assert(t, secondary.Size == vol.Size, secondary.Size)
+	tests.Assert(t, secondary.Durability.Replicate.Replica == 3,
+		secondary.Durability)
+	tests.Assert(t, len(secondary.Bricks) == len(vol.Bricks), secondary.Bricks)
+	tests.Assert(t, len(secondary.GlusterVolumeOptions) == 1,
+		secondary.GlusterVolumeOptions)
+	tests.Assert(t, session.PrimaryVolume == vol.Name, session)
+	tests.Assert(t, session.SecondaryVolume == secondary.Name, session)
+
+	// A volume is replicated once
+	_, err = c.ReplicationCreate(vol.Id, &api.ReplicationCreateRequest{
+		Cluster: clusters[1],
+	})
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	list, err := c.ReplicationList()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(list.Replications) == 1, list.Replications)
+
+	// Neither volume can be deleted
+	err = c.VolumeDelete(vol.Id)
+	tests.Assert(t, err != nil, "expected err != nil")
+	err = c.VolumeDelete(secondary.Id)
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	// Only a failed over replication is promoted
+	_, err = c.ReplicationPromote(repl.Id)
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	// The primary cluster is lost
+	actions = []string{}
+	app.xo.MockGeoReplicationAction = func(host string, s *executors.GeoReplicationRequest,
+		action string, force bool) error {
+
+		actions = append(actions, fmt.Sprintf("%v %v", action, force))
+		return fmt.Errorf("host unreachable")
+	}
+	_, err = c.ReplicationFailover(repl.Id, &api.ReplicationFailoverRequest{})
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	info, err := c.ReplicationFailover(repl.Id, &api.ReplicationFailoverRequest{
+		Force: true,
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, info.State == api.ReplicationFailedOver, info.State)
+	tests.Assert(t, strings.Join(actions, ",") == "stop false,stop true", actions)
+
+	_, err = c.ReplicationFailover(repl.Id, &api.ReplicationFailoverRequest{})
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	promoted, err := c.ReplicationPromote(repl.Id)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, promoted.Id == secondary.Id, promoted.Id)
+
+	_, err = c.ReplicationInfo(repl.Id)
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	err = c.VolumeDelete(vol.Id)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	err = c.VolumeDelete(secondary.Id)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+}
+
+func TestReplicationDelete(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	c := client.NewClientNoAuth(ts.URL)
+	tests.Assert(t, c != nil)
+
+	clusters := setupReplicationClusters(t, app)
+
+	req := &api.VolumeCreateRequest{}
+	req.Size = 10
+	req.Clusters = []string{clusters[0]}
+	vol, err := c.VolumeCreate(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	repl, err := c.ReplicationCreate(vol.Id, &api.ReplicationCreateRequest{
+		Cluster: clusters[1],
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	actions := []string{}
+	app.xo.MockGeoReplicationAction = func(host string, s *executors.GeoReplicationRequest,
+		action string, force bool) error {
+
+		actions = append(actions, action)
+		return nil
+	}
+	err = c.ReplicationDelete(repl.Id)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, strings.Join(actions, ",") == "stop,delete", actions)
+
+	err = c.ReplicationDelete(repl.Id)
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	// Both volumes are kept
+	_, err = c.VolumeInfo(repl.SecondaryVolume)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	err = c.VolumeDelete(vol.Id)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+}
+
+func TestReplicationCreateRollback(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	clusters := setupReplicationClusters(t, app)
+
+	vol := createSampleReplicaVolumeEntry(10, 3)
+	vol.Info.Clusters = []string{clusters[0]}
+	err := vol.Create(app.db, app.executor, app.Allocator())
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	app.xo.MockGeoReplicationCreate = func(host string, s *executors.GeoReplicationRequest) error {
+		return fmt.Errorf("no ssh access to secondary host")
+	}
+
+	rc := NewReplicationCreateOperation(vol, clusters[1], app.db)
+	err = RunOperation(rc, app.Allocator(), app.executor)
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	err = app.db.View(func(tx *bolt.Tx) error {
+		replications, err := ReplicationList(tx)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, len(replications) == 0, replications)
+		volumes, err := VolumeList(tx)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, len(volumes) == 1, volumes)
+		pendingops, err := PendingOperationList(tx)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, len(pendingops) == 0, pendingops)
+		return nil
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+}
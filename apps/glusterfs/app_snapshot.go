@@ -0,0 +1,260 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/boltdb/bolt"
+	"github.com/gorilla/mux"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/heketi/pkg/utils"
+)
+
+func (a *App) SnapshotCreate(w http.ResponseWriter, r *http.Request) {
+	requestLogger(r).Debug("In SnapshotCreate")
+
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	var msg api.SnapshotCreateRequest
+	err := utils.GetJsonFromRequest(r, &msg)
+	if err != nil {
+		http.Error(w, "request unable to be parsed", 422)
+		return
+	}
+	err = msg.Validate()
+	if err != nil {
+		http.Error(w, "validation failed: "+err.Error(), http.StatusBadRequest)
+		requestLogger(r).LogError("validation failed: " + err.Error())
+		return
+	}
+
+	var snap *SnapshotEntry
+	err = a.db.View(func(tx *bolt.Tx) error {
+		volume, err := NewVolumeEntryFromId(tx, id)
+		if err == ErrNotFound {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return err
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+
+		if !volume.Visible() {
+			// treat an invisible volume like it doesn't exist
+			http.Error(w, "Id not found", http.StatusNotFound)
+			return ErrNotFound
+		}
+
+		if volume.Info.Block {
+			err := requestLogger(r).LogError("Cannot snapshot a block hosting volume")
+			http.Error(w, err.Error(), http.StatusConflict)
+			return err
+		}
+
+		snap = NewSnapshotEntryFromRequest(&msg, volume)
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	sc := NewSnapshotCreateOperation(snap, a.db)
+	if err := AsyncHttpOperation(a, w, r, sc); err != nil {
+		if err == ErrConflict {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		http.Error(w,
+			fmt.Sprintf("Failed to set up snapshot create: %v", err),
+			http.StatusInternalServerError)
+		return
+	}
+}
+
+func (a *App) VolumeSnapshotList(w http.ResponseWriter, r *http.Request) {
+
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	var list api.SnapshotListResponse
+	err := a.db.View(func(tx *bolt.Tx) error {
+		volume, err := NewVolumeEntryFromId(tx, id)
+		if err == ErrNotFound {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return err
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+
+		snapshots, err := VolumeSnapshots(tx, volume.Info.Id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+
+		list.Snapshots = []string{}
+		for _, s := range snapshots {
+			if s.Visible() {
+				list.Snapshots = append(list.Snapshots, s.Info.Id)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	// Send list back
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(list); err != nil {
+		panic(err)
+	}
+}
+
+func (a *App) SnapshotInfo(w http.ResponseWriter, r *http.Request) {
+
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	var info *api.SnapshotInfoResponse
+	err := a.db.View(func(tx *bolt.Tx) error {
+		entry, err := NewSnapshotEntryFromId(tx, id)
+		if err == ErrNotFound {
+			http.Error(w, "Id not found", http.StatusNotFound)
+			return err
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+
+		if !entry.Visible() {
+			http.Error(w, "Id not found", http.StatusNotFound)
+			return ErrNotFound
+		}
+
+		info, err = entry.NewInfoResponse(tx)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	// Write msg
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(info); err != nil {
+		panic(err)
+	}
+}
+
+func (a *App) SnapshotDelete(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	var snap *SnapshotEntry
+	err := a.db.View(func(tx *bolt.Tx) error {
+		var err error
+		snap, err = NewSnapshotEntryFromId(tx, id)
+		if err == ErrNotFound {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return err
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	sdel := NewSnapshotDeleteOperation(snap, a.db)
+	if err := AsyncHttpOperation(a, w, r, sdel); err != nil {
+		if err == ErrConflict {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		http.Error(w,
+			fmt.Sprintf("Failed to set up snapshot delete: %v", err),
+			http.StatusInternalServerError)
+		return
+	}
+}
+
+func (a *App) SnapshotClone(w http.ResponseWriter, r *http.Request) {
+	requestLogger(r).Debug("In SnapshotClone")
+
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	var msg api.SnapshotCloneRequest
+	err := utils.GetJsonFromRequest(r, &msg)
+	if err != nil {
+		http.Error(w, "request unable to be parsed", 422)
+		return
+	}
+	err = msg.Validate()
+	if err != nil {
+		http.Error(w, "validation failed: "+err.Error(), http.StatusBadRequest)
+		requestLogger(r).LogError("validation failed: " + err.Error())
+		return
+	}
+
+	var sc *SnapshotCloneOperation
+	err = a.db.View(func(tx *bolt.Tx) error {
+		snap, err := NewSnapshotEntryFromId(tx, id)
+		if err == ErrNotFound {
+			http.Error(w, "Id not found", http.StatusNotFound)
+			return err
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+
+		if !snap.Visible() {
+			http.Error(w, "Id not found", http.StatusNotFound)
+			return ErrNotFound
+		}
+
+		origin, err := NewVolumeEntryFromId(tx, snap.Info.OriginVolume)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+
+		sc = NewSnapshotCloneOperation(snap, origin, &msg, a.db)
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	if err := AsyncHttpOperation(a, w, r, sc); err != nil {
+		if err == ErrConflict {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		http.Error(w,
+			fmt.Sprintf("Failed to set up snapshot clone: %v", err),
+			http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,607 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/gorilla/mux"
+	client "github.com/heketi/heketi/client/api/go-client"
+	"github.com/heketi/heketi/executors"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/tests"
+)
+
+func TestSnapshotCreateListDelete(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	c := client.NewClientNoAuth(ts.URL)
+	tests.Assert(t, c != nil)
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		3,    // nodes_per_cluster
+		2,    // devices_per_node,
+		2*TB, // disksize
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	req := &api.VolumeCreateRequest{}
+	req.Size = 10
+	req.Durability.Type = api.DurabilityReplicate
+	req.Durability.Replicate.Replica = 3
+	vol, err := c.VolumeCreate(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// gluster keeps the snapshots created by the executor
+	glusterSnaps := map[string]string{}
+	app.xo.MockSnapshotCreate = func(host string, s *executors.SnapshotRequest) error {
+		glusterSnaps[s.Name] = s.Volume
+		return nil
+	}
+	app.xo.MockSnapshotDestroy = func(host string, snapshot string) error {
+		delete(glusterSnaps, snapshot)
+		return nil
+	}
+	app.xo.MockSnapshotList = func(host string, volume string) ([]string, error) {
+		names := []string{}
+		for name, v := range glusterSnaps {
+			if v == volume {
+				names = append(names, name)
+			}
+		}
+		return names, nil
+	}
+
+	snap, err := c.SnapshotCreate(vol.Id, &api.SnapshotCreateRequest{
+		Name:        "nightly",
+		Description: "before the upgrade",
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, snap.Name == "nightly", snap.Name)
+	tests.Assert(t, snap.Description == "before the upgrade", snap.Description)
+	tests.Assert(t, snap.OriginVolume == vol.Id, snap.OriginVolume)
+	tests.Assert(t, snap.Cluster == vol.Cluster, snap.Cluster)
+	tests.Assert(t, snap.Created != 0)
+	tests.Assert(t, glusterSnaps["nightly"] == vol.Name, glusterSnaps)
+
+	// Without a name the snapshot is named after its id
+	snap2, err := c.SnapshotCreate(vol.Id, &api.SnapshotCreateRequest{})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, snap2.Name == "snap_"+snap2.Id, snap2.Name)
+
+	// The name of a snapshot is unique in the cluster
+	_, err = c.SnapshotCreate(vol.Id, &api.SnapshotCreateRequest{
+		Name: "nightly",
+	})
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	// Invalid name
+	_, err = c.SnapshotCreate(vol.Id, &api.SnapshotCreateRequest{
+		Name: "night ly",
+	})
+	tests.Assert(t, err != nil, "expected err != nil")
+	tests.Assert(t, strings.Contains(err.Error(), "name: must be in a valid format"),
+		err.Error())
+
+	list, err := c.VolumeSnapshotList(vol.Id)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(list.Snapshots) == 2, list.Snapshots)
+
+	info, err := c.SnapshotInfo(snap.Id)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, info.Name == "nightly", info.Name)
+
+	// A volume with snapshots can not be deleted
+	err = c.VolumeDelete(vol.Id)
+	tests.Assert(t, err != nil, "expected err != nil")
+	tests.Assert(t, strings.Contains(err.Error(), "snapshot"), err.Error())
+
+	for _, id := range list.Snapshots {
+		err = c.SnapshotDelete(id)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	}
+	tests.Assert(t, len(glusterSnaps) == 0, glusterSnaps)
+
+	list, err = c.VolumeSnapshotList(vol.Id)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(list.Snapshots) == 0, list.Snapshots)
+
+	_, err = c.SnapshotInfo(snap.Id)
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	err = c.SnapshotDelete(snap.Id)
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	err = c.VolumeDelete(vol.Id)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	_, err = c.VolumeSnapshotList(vol.Id)
+	tests.Assert(t, err != nil, "expected err != nil")
+}
+
+func TestSnapshotCreateRollback(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		3,    // nodes_per_cluster
+		2,    // devices_per_node,
+		2*TB, // disksize
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	vol := createSampleReplicaVolumeEntry(10, 3)
+	err = vol.Create(app.db, app.executor, app.Allocator())
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// The snapshot is created in gluster but the command fails
+	destroyed := ""
+	app.xo.MockSnapshotCreate = func(host string, s *executors.SnapshotRequest) error {
+		return fmt.Errorf("command timed out")
+	}
+	app.xo.MockSnapshotList = func(host string, volume string) ([]string, error) {
+		return []string{"snap1"}, nil
+	}
+	app.xo.MockSnapshotDestroy = func(host string, snapshot string) error {
+		destroyed = snapshot
+		return nil
+	}
+
+	snap := NewSnapshotEntryFromRequest(
+		&api.SnapshotCreateRequest{Name: "snap1"}, vol)
+	sc := NewSnapshotCreateOperation(snap, app.db)
+	err = RunOperation(sc, app.Allocator(), app.executor)
+	tests.Assert(t, err != nil, "expected err != nil")
+	tests.Assert(t, destroyed == "snap1", destroyed)
+
+	err = app.db.View(func(tx *bolt.Tx) error {
+		snapshots, err := SnapshotList(tx)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, len(snapshots) == 0, snapshots)
+		pendingops, err := PendingOperationList(tx)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, len(pendingops) == 0, pendingops)
+		return nil
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+}
+
+func TestSnapshotDeleteRollback(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		3,    // nodes_per_cluster
+		2,    // devices_per_node,
+		2*TB, // disksize
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	vol := createSampleReplicaVolumeEntry(10, 3)
+	err = vol.Create(app.db, app.executor, app.Allocator())
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	snap := NewSnapshotEntryFromRequest(
+		&api.SnapshotCreateRequest{Name: "snap1"}, vol)
+	sc := NewSnapshotCreateOperation(snap, app.db)
+	err = RunOperation(sc, app.Allocator(), app.executor)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// The snapshot is still in gluster after the failed delete
+	app.xo.MockSnapshotDestroy = func(host string, snapshot string) error {
+		return fmt.Errorf("snapshot is busy")
+	}
+	app.xo.MockSnapshotList = func(host string, volume string) ([]string, error) {
+		return []string{"snap1"}, nil
+	}
+
+	sdel := NewSnapshotDeleteOperation(snap, app.db)
+	err = RunOperation(sdel, app.Allocator(), app.executor)
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	err = app.db.View(func(tx *bolt.Tx) error {
+		s, err := NewSnapshotEntryFromId(tx, snap.Info.Id)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, s.Visible(), "expected snapshot to be visible")
+		pendingops, err := PendingOperationList(tx)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, len(pendingops) == 0, pendingops)
+		return nil
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+}
+
+func TestSnapshotClone(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	c := client.NewClientNoAuth(ts.URL)
+	tests.Assert(t, c != nil)
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		3,    // nodes_per_cluster
+		2,    // devices_per_node,
+		2*TB, // disksize
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	req := &api.VolumeCreateRequest{}
+	req.Size = 10
+	req.Durability.Type = api.DurabilityReplicate
+	req.Durability.Replicate.Replica = 3
+	req.Snapshot.Enable = true
+	req.Snapshot.Factor = 1.5
+	vol, err := c.VolumeCreate(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	snap, err := c.SnapshotCreate(vol.Id, &api.SnapshotCreateRequest{})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// gluster lists the bricks of the origin volume and creates the
+	// bricks of the clone in the same order
+	glusterBricks := []executors.Brick{}
+	originDevices := map[string]bool{}
+	free := map[string]uint64{}
+	for _, b := range vol.Bricks {
+		node, err := c.NodeInfo(b.NodeId)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		glusterBricks = append(glusterBricks, executors.Brick{
+			Name: node.Hostnames.Storage[0] + ":" + b.Path,
+		})
+		originDevices[b.DeviceId] = true
+		device, err := c.DeviceInfo(b.DeviceId)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		free[b.DeviceId] = device.Storage.Free
+	}
+	app.xo.MockVolumeInfo = func(host string, volume string) (*executors.Volume, error) {
+		v := &executors.Volume{VolumeName: volume}
+		if volume == vol.Name {
+			v.Bricks.BrickList = glusterBricks
+		}
+		return v, nil
+	}
+	cloned := ""
+	app.xo.MockSnapshotClone = func(host string,
+		clone *executors.SnapshotCloneRequest) (*executors.Volume, error) {
+
+		cloned = clone.Snapshot
+		v := &executors.Volume{VolumeName: clone.Volume, ID: "gluster-" + clone.Volume}
+		for i, b := range glusterBricks {
+			host := strings.SplitN(b.Name, ":", 2)[0]
+			v.Bricks.BrickList = append(v.Bricks.BrickList, executors.Brick{
+				Name: fmt.Sprintf("%v:/run/gluster/snaps/%v/brick%v/brick",
+					host, clone.Volume, i+1),
+			})
+		}
+		return v, nil
+	}
+
+	clone, err := c.SnapshotClone(snap.Id, &api.SnapshotCloneRequest{
+		Name: "restored",
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, cloned == snap.Name, cloned)
+	tests.Assert(t, clone.Id != vol.Id)
+	tests.Assert(t, clone.Name == "restored", clone.Name)
+	tests.Assert(t, clone.GlusterId == "gluster-restored", clone.GlusterId)
+	tests.Assert(t, clone.Cluster == vol.Cluster, clone.Cluster)
+	tests.Assert(t, clone.Size == vol.Size, clone.Size)
+	tests.Assert(t, clone.Durability.Replicate.Replica == 3, clone.Durability)
+	tests.Assert(t, clone.Snapshot.Enable, clone.Snapshot)
+	tests.Assert(t, clone.Mount.GlusterFS.MountPoint != "", clone.Mount)
+	tests.Assert(t, len(clone.Bricks) == len(vol.Bricks), clone.Bricks)
+	for _, b := range clone.Bricks {
+		tests.Assert(t, originDevices[b.DeviceId], "brick on new device", b)
+		tests.Assert(t, strings.HasPrefix(b.Path, "/run/gluster/snaps/restored/"),
+			b.Path)
+	}
+
+	// The bricks of the clone use no space of their devices
+	for id, f := range free {
+		device, err := c.DeviceInfo(id)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, device.Storage.Free == f, device.Storage.Free, f)
+	}
+
+	// Without a name the clone is named after its id
+	clone2, err := c.SnapshotClone(snap.Id, &api.SnapshotCloneRequest{})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, clone2.Name == "vol_"+clone2.Id, clone2.Name)
+
+	// Invalid name
+	_, err = c.SnapshotClone(snap.Id, &api.SnapshotCloneRequest{
+		Name: "re stored",
+	})
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	_, err = c.SnapshotClone("12345678901234567890123456789012",
+		&api.SnapshotCloneRequest{})
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	// Deleting the clone removes the LVs gluster created
+	destroyed := []string{}
+	app.xo.MockBrickDestroy = func(host string, brick *executors.BrickRequest) error {
+		destroyed = append(destroyed, brick.Path)
+		return nil
+	}
+	err = c.VolumeDelete(clone.Id)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(destroyed) == len(clone.Bricks), destroyed)
+	for _, p := range destroyed {
+		tests.Assert(t, strings.HasPrefix(p, "/run/gluster/snaps/restored/"), p)
+	}
+	for id, f := range free {
+		device, err := c.DeviceInfo(id)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, device.Storage.Free == f, device.Storage.Free, f)
+	}
+}
+
+func TestSnapshotCloneRollback(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		3,    // nodes_per_cluster
+		2,    // devices_per_node,
+		2*TB, // disksize
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	vol := createSampleReplicaVolumeEntry(10, 3)
+	err = vol.Create(app.db, app.executor, app.Allocator())
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	snap := NewSnapshotEntryFromRequest(
+		&api.SnapshotCreateRequest{Name: "snap1"}, vol)
+	err = RunOperation(NewSnapshotCreateOperation(snap, app.db),
+		app.Allocator(), app.executor)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	app.xo.MockSnapshotClone = func(host string,
+		clone *executors.SnapshotCloneRequest) (*executors.Volume, error) {
+		return nil, fmt.Errorf("snapshot is not activated")
+	}
+	volumeDestroyed := ""
+	app.xo.MockVolumeDestroy = func(host string, volume string) error {
+		volumeDestroyed = volume
+		return nil
+	}
+
+	sc := NewSnapshotCloneOperation(snap, vol,
+		&api.SnapshotCloneRequest{Name: "clone1"}, app.db)
+	err = RunOperation(sc, app.Allocator(), app.executor)
+	tests.Assert(t, err != nil, "expected err != nil")
+	tests.Assert(t, volumeDestroyed == "clone1", volumeDestroyed)
+
+	err = app.db.View(func(tx *bolt.Tx) error {
+		volumes, err := VolumeList(tx)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, len(volumes) == 1, volumes)
+		bricks, err := BrickList(tx)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, len(bricks) == 3, bricks)
+		cluster, err := NewClusterEntryFromId(tx, vol.Info.Cluster)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, len(cluster.Info.Volumes) == 1, cluster.Info.Volumes)
+		for _, id := range cluster.Info.Nodes {
+			node, err := NewNodeEntryFromId(tx, id)
+			tests.Assert(t, err == nil, "expected err == nil, got:", err)
+			for _, d := range node.Devices {
+				device, err := NewDeviceEntryFromId(tx, d)
+				tests.Assert(t, err == nil, "expected err == nil, got:", err)
+				tests.Assert(t, len(device.Bricks) <= 1, device.Bricks)
+			}
+		}
+		pendingops, err := PendingOperationList(tx)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, len(pendingops) == 0, pendingops)
+		return nil
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	c := client.NewClientNoAuth(ts.URL)
+	tests.Assert(t, c != nil)
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		3,    // nodes_per_cluster
+		2,    // devices_per_node,
+		2*TB, // disksize
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	req := &api.VolumeCreateRequest{}
+	req.Size = 10
+	req.Durability.Type = api.DurabilityReplicate
+	req.Durability.Replicate.Replica = 3
+	req.Snapshot.Enable = true
+	req.Snapshot.Factor = 1.5
+	vol, err := c.VolumeCreate(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	snap, err := c.SnapshotCreate(vol.Id, &api.SnapshotCreateRequest{})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// gluster replaces the bricks of the volume with the bricks of the
+	// snapshot, in the same order
+	glusterBricks := []executors.Brick{}
+	restoredBricks := []executors.Brick{}
+	for i, b := range vol.Bricks {
+		node, err := c.NodeInfo(b.NodeId)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		host := node.Hostnames.Storage[0]
+		glusterBricks = append(glusterBricks, executors.Brick{
+			Name: host + ":" + b.Path,
+		})
+		restoredBricks = append(restoredBricks, executors.Brick{
+			Name: fmt.Sprintf("%v:/run/gluster/snaps/%v/brick%v/brick",
+				host, snap.Id, i+1),
+		})
+	}
+	restored := ""
+	app.xo.MockSnapshotRestore = func(host string, snapshot string) error {
+		restored = snapshot
+		return nil
+	}
+	app.xo.MockVolumeInfo = func(host string, volume string) (*executors.Volume, error) {
+		v := &executors.Volume{VolumeName: volume}
+		if restored == "" {
+			v.Bricks.BrickList = glusterBricks
+		} else {
+			v.Bricks.BrickList = restoredBricks
+		}
+		return v, nil
+	}
+
+	info, err := c.VolumeRestore(vol.Id, &api.VolumeRestoreRequest{
+		Snapshot: snap.Id,
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, restored == snap.Name, restored)
+
+	// The brick entries follow the bricks of the snapshot
+	paths := map[string]string{}
+	for i, b := range vol.Bricks {
+		paths[b.Id] = strings.SplitN(restoredBricks[i].Name, ":", 2)[1]
+	}
+	tests.Assert(t, len(info.Bricks) == len(vol.Bricks), info.Bricks)
+	for _, b := range info.Bricks {
+		tests.Assert(t, b.Path == paths[b.Id], b.Path, paths[b.Id])
+	}
+
+	// gluster removed the restored snapshot
+	_, err = c.SnapshotInfo(snap.Id)
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	// Deleting the volume removes the LVs of the snapshot
+	destroyed := []string{}
+	app.xo.MockBrickDestroy = func(host string, brick *executors.BrickRequest) error {
+		destroyed = append(destroyed, brick.Path)
+		return nil
+	}
+	err = c.VolumeDelete(vol.Id)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(destroyed) == len(vol.Bricks), destroyed)
+	for _, p := range destroyed {
+		tests.Assert(t, strings.HasPrefix(p, "/run/gluster/snaps/"+snap.Id), p)
+	}
+}
+
+func TestSnapshotRestoreOtherVolume(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	c := client.NewClientNoAuth(ts.URL)
+	tests.Assert(t, c != nil)
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		3,    // nodes_per_cluster
+		2,    // devices_per_node,
+		2*TB, // disksize
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	req := &api.VolumeCreateRequest{}
+	req.Size = 10
+	req.Snapshot.Enable = true
+	req.Snapshot.Factor = 1.5
+	vol, err := c.VolumeCreate(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	other, err := c.VolumeCreate(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	snap, err := c.SnapshotCreate(vol.Id, &api.SnapshotCreateRequest{})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// gluster would restore the volume the snapshot was taken of
+	restored := ""
+	app.xo.MockSnapshotRestore = func(host string, snapshot string) error {
+		restored = snapshot
+		return nil
+	}
+	_, err = c.VolumeRestore(other.Id, &api.VolumeRestoreRequest{
+		Snapshot: snap.Id,
+	})
+	tests.Assert(t, err != nil, "expected err != nil")
+	_, err = c.VolumeRestore(other.Id, &api.VolumeRestoreRequest{
+		Snapshot: snap.Name,
+	})
+	tests.Assert(t, err != nil, "expected err != nil")
+	tests.Assert(t, restored == "", restored)
+
+	_, err = c.SnapshotInfo(snap.Id)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// Snapshots unknown to heketi are restored by their gluster name
+	_, err = c.VolumeRestore(other.Id, &api.VolumeRestoreRequest{
+		Snapshot: "manual_snap",
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, restored == "manual_snap", restored)
+}
@@ -0,0 +1,244 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/boltdb/bolt"
+	"github.com/gorilla/mux"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/heketi/pkg/utils"
+)
+
+func (a *App) TenantSet(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	name := vars["name"]
+
+	var msg api.TenantRequest
+	err := utils.GetJsonFromRequest(r, &msg)
+	if err != nil {
+		http.Error(w, "request unable to be parsed", 422)
+		return
+	}
+	err = api.ValidateTenantName(name)
+	if err == nil {
+		err = msg.Validate()
+	}
+	if err != nil {
+		http.Error(w, "validation failed: "+err.Error(), http.StatusBadRequest)
+		requestLogger(r).LogError("validation failed: " + err.Error())
+		return
+	}
+
+	var info *api.TenantInfoResponse
+	err = a.db.Update(func(tx *bolt.Tx) error {
+		for id := range msg.Clusters {
+			if _, err := NewClusterEntryFromId(tx, id); err != nil {
+				http.Error(w, fmt.Sprintf("Cluster id %v not found", id),
+					http.StatusBadRequest)
+				requestLogger(r).LogError("Cluster id %v not found", id)
+				return err
+			}
+		}
+
+		// A user is in one tenant at most
+		for _, user := range msg.Users {
+			t, err := UserTenant(tx, user)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return err
+			}
+			if t != nil && t.Name != name {
+				err := requestLogger(r).LogError("User %v is in tenant %v", user, t.Name)
+				http.Error(w, err.Error(), http.StatusConflict)
+				return err
+			}
+		}
+
+		tenant := NewTenantEntryFromRequest(name, &msg)
+		if err := tenant.Save(tx); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+		info, err = tenant.NewInfoResponse(tx)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return err
+	})
+	if err != nil {
+		return
+	}
+	requestLogger(r).Info("Set tenant %v", name)
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(info); err != nil {
+		panic(err)
+	}
+}
+
+func (a *App) TenantList(w http.ResponseWriter, r *http.Request) {
+
+	var list api.TenantListResponse
+	err := a.db.View(func(tx *bolt.Tx) error {
+		var err error
+		list.Tenants, err = TenantList(tx)
+		return err
+	})
+	if err != nil {
+		requestLogger(r).Err(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Send list back
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(list); err != nil {
+		panic(err)
+	}
+}
+
+func (a *App) TenantInfo(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	name := vars["name"]
+
+	var info *api.TenantInfoResponse
+	err := a.db.View(func(tx *bolt.Tx) error {
+		tenant, err := NewTenantEntryFromId(tx, name)
+		if err == ErrNotFound {
+			http.Error(w, "Tenant not found", http.StatusNotFound)
+			return err
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+
+		info, err = tenant.NewInfoResponse(tx)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return err
+	})
+	if err != nil {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(info); err != nil {
+		panic(err)
+	}
+}
+
+func (a *App) TenantUsage(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	name := vars["name"]
+
+	var usage *api.TenantUsageResponse
+	err := a.db.View(func(tx *bolt.Tx) error {
+		tenant, err := NewTenantEntryFromId(tx, name)
+		if err == ErrNotFound {
+			http.Error(w, "Tenant not found", http.StatusNotFound)
+			return err
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+
+		// Users only see the usage of their own tenant
+		if requestIssuer(r) == "user" && !tenant.hasUser(requestSubject(r)) {
+			err := requestLogger(r).LogError("User %v is not in tenant %v",
+				requestSubject(r), name)
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return err
+		}
+
+		usage, err = tenant.NewUsageResponse(tx)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return err
+	})
+	if err != nil {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(usage); err != nil {
+		panic(err)
+	}
+}
+
+func (a *App) TenantDelete(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	name := vars["name"]
+
+	// The volumes of the tenant are kept and are no longer limited
+	err := a.db.Update(func(tx *bolt.Tx) error {
+		tenant, err := NewTenantEntryFromId(tx, name)
+		if err == ErrNotFound {
+			http.Error(w, "Tenant not found", http.StatusNotFound)
+			return err
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+
+		if err := tenant.Delete(tx); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+	requestLogger(r).Info("Deleted tenant %v", name)
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// requestTenant returns the name of the tenant of the user of the
+// request, or "" if the user is in no tenant. The limits of the tenant
+// are checked by the operation creating the volumes, in the transaction
+// saving them. False is returned once the error has been sent to the
+// client.
+func (a *App) requestTenant(w http.ResponseWriter, r *http.Request) (string, bool) {
+	var tenant *TenantEntry
+	err := a.db.View(func(tx *bolt.Tx) error {
+		var err error
+		tenant, err = UserTenant(tx, requestSubject(r))
+		return err
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return "", false
+	}
+	if tenant == nil {
+		return "", true
+	}
+	return tenant.Name, true
+}
+
+// tenantQuotaExceeded sends the error to the client, and returns true,
+// if the operation was refused for the limits of a tenant
+func tenantQuotaExceeded(w http.ResponseWriter, err error) bool {
+	if _, ok := err.(*TenantQuotaError); !ok {
+		return false
+	}
+	http.Error(w, err.Error(), http.StatusForbidden)
+	return true
+}
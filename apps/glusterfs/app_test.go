@@ -284,3 +284,52 @@ func TestCannotStartWhenPendingOperations(t *testing.T) {
 
 	t.Fatalf("Test should not reach this line")
 }
+
+func TestAppLvmNamePrefix(t *testing.T) {
+	dbfile := tests.Tempfile()
+	defer os.Remove(dbfile)
+	defer utils.SetLvmNamePrefix("")
+
+	config := func(prefix string) *bytes.Buffer {
+		return bytes.NewBufferString(`{
+			"glusterfs" : {
+				"executor" : "mock",
+				"allocator" : "simple",
+				"db" : "` + dbfile + `",
+				"lvm_name_prefix" : "` + prefix + `"
+			}
+		}`)
+	}
+
+	// A new db takes the prefix of the configuration
+	app := NewApp(config("hk1_"))
+	tests.Assert(t, app != nil)
+	tests.Assert(t, utils.VgIdToName("a") == "hk1_vg_a", utils.VgIdToName("a"))
+	app.Close()
+
+	// and keeps it
+	app = NewApp(config("hk2_"))
+	tests.Assert(t, app != nil)
+	tests.Assert(t, utils.VgIdToName("a") == "hk1_vg_a", utils.VgIdToName("a"))
+	app.Close()
+
+	// A db with devices and no prefix keeps the names without prefix
+	dbfile2 := tests.Tempfile()
+	defer os.Remove(dbfile2)
+	app = NewTestApp(dbfile2)
+	err := setupSampleDbWithTopology(app, 1, 1, 1, 500*GB)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	err = app.db.Update(func(tx *bolt.Tx) error {
+		entry, err := NewDbAttributeEntryFromKey(tx, DB_LVM_NAME_PREFIX)
+		tests.Assert(t, err == nil)
+		return entry.Delete(tx)
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	app.Close()
+
+	dbfile = dbfile2
+	app = NewApp(config("hk1_"))
+	tests.Assert(t, app != nil)
+	defer app.Close()
+	tests.Assert(t, utils.VgIdToName("a") == "vg_a", utils.VgIdToName("a"))
+}
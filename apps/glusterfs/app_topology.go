@@ -0,0 +1,119 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/heketi/pkg/utils"
+)
+
+func (a *App) TopologyLoad(w http.ResponseWriter, r *http.Request) {
+	var msg api.TopologyLoadRequest
+	err := utils.GetJsonFromRequest(r, &msg)
+	if err != nil {
+		http.Error(w, "request unable to be parsed", 422)
+		return
+	}
+	err = msg.Validate()
+	if err != nil {
+		http.Error(w, "validation failed: "+err.Error(), http.StatusBadRequest)
+		requestLogger(r).LogError("validation failed: " + err.Error())
+		return
+	}
+
+	if !a.topologyLoad.start() {
+		http.Error(w, "A topology load is in progress", http.StatusConflict)
+		return
+	}
+
+	requestLogger(r).Info("Loading topology of %v clusters", len(msg.Clusters))
+	a.asyncHttpRedirectWithStepsFunc(w, r, func(step func(string)) (string, error) {
+		resp := LoadTopology(a.db, a.requestExecutor(r), &msg, step)
+		a.topologyLoad.finish(resp)
+		requestLogger(r).Info("Loaded topology of %v clusters", len(msg.Clusters))
+		return "/topology/load", nil
+	})
+}
+
+func (a *App) TopologyLoadResult(w http.ResponseWriter, r *http.Request) {
+	resp := a.topologyLoad.last()
+	if resp == nil {
+		http.Error(w, "No topology load has completed", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		panic(err)
+	}
+}
+
+func (a *App) TopologyDiff(w http.ResponseWriter, r *http.Request) {
+	var msg api.TopologyDiffRequest
+	err := utils.GetJsonFromRequest(r, &msg)
+	if err != nil {
+		http.Error(w, "request unable to be parsed", 422)
+		return
+	}
+	err = msg.Validate()
+	if err != nil {
+		http.Error(w, "validation failed: "+err.Error(), http.StatusBadRequest)
+		requestLogger(r).LogError("validation failed: " + err.Error())
+		return
+	}
+
+	if !msg.Apply {
+		resp, err := DiffTopology(a.db, a.requestExecutor(r), &msg.Topology)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			panic(err)
+		}
+		return
+	}
+
+	if !a.topologyLoad.start() {
+		http.Error(w, "A topology load is in progress", http.StatusConflict)
+		return
+	}
+
+	requestLogger(r).Info("Applying topology of %v clusters", len(msg.Topology.Clusters))
+	a.asyncHttpRedirectWithStepsFunc(w, r, func(step func(string)) (string, error) {
+		resp, err := ApplyTopologyDiff(a.db, a.requestExecutor(r), &msg.Topology, step)
+		a.topologyLoad.finishDiff(resp)
+		if err != nil {
+			return "", err
+		}
+		requestLogger(r).Info("Applied topology of %v clusters", len(msg.Topology.Clusters))
+		return "/topology/diff", nil
+	})
+}
+
+func (a *App) TopologyDiffResult(w http.ResponseWriter, r *http.Request) {
+	resp := a.topologyLoad.lastDiff()
+	if resp == nil {
+		http.Error(w, "No topology diff has been applied", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		panic(err)
+	}
+}
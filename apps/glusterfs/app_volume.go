@@ -26,79 +26,128 @@ const (
 	VOLUME_CREATE_MAX_SNAPSHOT_FACTOR = 100
 )
 
+// validateVolumeDurability checks the durability requested for a volume
+// and sets the default durability type if none was requested
+func validateVolumeDurability(d *api.VolumeDurabilityInfo) error {
+	switch d.Type {
+	case api.DurabilityEC:
+	case api.DurabilityReplicate:
+	case api.DurabilityDistributeOnly:
+	case "":
+		d.Type = api.DurabilityDistributeOnly
+	default:
+		return fmt.Errorf("Unknown durability type")
+	}
+
+	if d.Type == api.DurabilityReplicate {
+		if d.Replicate.Replica > 3 {
+			return fmt.Errorf("Invalid replica value")
+		}
+	}
+
+	if d.Type == api.DurabilityEC {
+		// Place here correct combinations
+		switch {
+		case d.Disperse.Data == 2 && d.Disperse.Redundancy == 1:
+		case d.Disperse.Data == 4 && d.Disperse.Redundancy == 2:
+		case d.Disperse.Data == 8 && d.Disperse.Redundancy == 3:
+		case d.Disperse.Data == 8 && d.Disperse.Redundancy == 4:
+		default:
+			return fmt.Errorf("Invalid dispersion combination: %v+%v",
+				d.Disperse.Data, d.Disperse.Redundancy)
+		}
+	}
+	return nil
+}
+
 func (a *App) VolumeCreate(w http.ResponseWriter, r *http.Request) {
 
+	idem, ok := a.idempotentRequest(w, r, idempotentVolume)
+	if !ok {
+		return
+	}
+	defer idem.done()
+
+	vol := a.volumeFromCreateRequest(w, r)
+	if vol == nil {
+		return
+	}
+
+	// The volumes of the users of a tenant are created on the clusters
+	// where the limits of the tenant leave room for them
+	tenant, ok := a.requestTenant(w, r)
+	if !ok {
+		return
+	}
+	vol.Info.Tenant = tenant
+
+	if err := vol.checkNodesReachable(a.db, a.requestExecutor(r)); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	vc := NewVolumeCreateOperation(vol, a.db)
+	vc.selector = a.clusters
+	if err := asyncHttpThrottledOperation(a, w, r, vc); err != nil {
+		if tenantQuotaExceeded(w, err) {
+			return
+		}
+		http.Error(w,
+			fmt.Sprintf("Failed to allocate new volume: %v", err),
+			http.StatusInternalServerError)
+		return
+	}
+	idem.record(a.db, vol.Info.Id)
+}
+
+// volumeFromCreateRequest validates the volume create request and returns
+// the volume to create, or nil once the error has been sent to the client
+func (a *App) volumeFromCreateRequest(w http.ResponseWriter,
+	r *http.Request) *VolumeEntry {
+
 	var msg api.VolumeCreateRequest
 	err := utils.GetJsonFromRequest(r, &msg)
 	if err != nil {
 		http.Error(w, "request unable to be parsed", 422)
-		return
+		return nil
 	}
 	err = msg.Validate()
+	if err == nil {
+		err = validateVolumeCreateLimits(&msg)
+	}
 	if err != nil {
 		http.Error(w, "validation failed: "+err.Error(), http.StatusBadRequest)
-		logger.LogError("validation failed: " + err.Error())
-		return
+		requestLogger(r).LogError("validation failed: " + err.Error())
+		return nil
 	}
 
 	switch {
 	case msg.Gid < 0:
 		http.Error(w, "Bad group id less than zero", http.StatusBadRequest)
-		logger.LogError("Bad group id less than zero")
-		return
+		requestLogger(r).LogError("Bad group id less than zero")
+		return nil
 	case msg.Gid >= math.MaxInt32:
 		http.Error(w, "Bad group id equal or greater than 2**32", http.StatusBadRequest)
-		logger.LogError("Bad group id equal or greater than 2**32")
-		return
+		requestLogger(r).LogError("Bad group id equal or greater than 2**32")
+		return nil
 	}
 
-	switch msg.Durability.Type {
-	case api.DurabilityEC:
-	case api.DurabilityReplicate:
-	case api.DurabilityDistributeOnly:
-	case "":
-		msg.Durability.Type = api.DurabilityDistributeOnly
-	default:
-		http.Error(w, "Unknown durability type", http.StatusBadRequest)
-		logger.LogError("Unknown durability type")
-		return
+	if err := validateVolumeDurability(&msg.Durability); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		requestLogger(r).LogError(err.Error())
+		return nil
 	}
 
-	if msg.Size < 1 {
+	if msg.Size < 1 && msg.SizeMiB < 1 {
 		http.Error(w, "Invalid volume size", http.StatusBadRequest)
-		logger.LogError("Invalid volume size")
-		return
+		requestLogger(r).LogError("Invalid volume size")
+		return nil
 	}
 	if msg.Snapshot.Enable {
 		if msg.Snapshot.Factor < 1 || msg.Snapshot.Factor > VOLUME_CREATE_MAX_SNAPSHOT_FACTOR {
 			http.Error(w, "Invalid snapshot factor", http.StatusBadRequest)
-			logger.LogError("Invalid snapshot factor")
-			return
-		}
-	}
-
-	if msg.Durability.Type == api.DurabilityReplicate {
-		if msg.Durability.Replicate.Replica > 3 {
-			http.Error(w, "Invalid replica value", http.StatusBadRequest)
-			logger.LogError("Invalid replica value")
-			return
-		}
-	}
-
-	if msg.Durability.Type == api.DurabilityEC {
-		d := msg.Durability.Disperse
-		// Place here correct combinations
-		switch {
-		case d.Data == 2 && d.Redundancy == 1:
-		case d.Data == 4 && d.Redundancy == 2:
-		case d.Data == 8 && d.Redundancy == 3:
-		case d.Data == 8 && d.Redundancy == 4:
-		default:
-			http.Error(w,
-				fmt.Sprintf("Invalid dispersion combination: %v+%v", d.Data, d.Redundancy),
-				http.StatusBadRequest)
-			logger.LogError(fmt.Sprintf("Invalid dispersion combination: %v+%v", d.Data, d.Redundancy))
-			return
+			requestLogger(r).LogError("Invalid snapshot factor")
+			return nil
 		}
 	}
 
@@ -113,7 +162,7 @@ func (a *App) VolumeCreate(w http.ResponseWriter, r *http.Request) {
 		}
 		if len(clusters) == 0 {
 			http.Error(w, fmt.Sprintf("No clusters configured"), http.StatusBadRequest)
-			logger.LogError("No clusters configured")
+			requestLogger(r).LogError("No clusters configured")
 			return ErrNotFound
 		}
 
@@ -122,57 +171,114 @@ func (a *App) VolumeCreate(w http.ResponseWriter, r *http.Request) {
 			_, err := NewClusterEntryFromId(tx, clusterid)
 			if err != nil {
 				http.Error(w, fmt.Sprintf("Cluster id %v not found", clusterid), http.StatusBadRequest)
-				logger.LogError(fmt.Sprintf("Cluster id %v not found", clusterid))
+				requestLogger(r).LogError(fmt.Sprintf("Cluster id %v not found", clusterid))
 				return err
 			}
 		}
 
+		// Check the nodes of the hints are correct
+		for _, nodes := range [][]string{msg.IncludeNodes, msg.ExcludeNodes} {
+			for _, nodeid := range nodes {
+				_, err := NewNodeEntryFromId(tx, nodeid)
+				if err != nil {
+					http.Error(w, fmt.Sprintf("Node id %v not found", nodeid), http.StatusBadRequest)
+					requestLogger(r).LogError(fmt.Sprintf("Node id %v not found", nodeid))
+					return err
+				}
+			}
+		}
+
 		return nil
 	})
 	if err != nil {
-		return
+		return nil
 	}
 
 	vol := NewVolumeEntryFromRequest(&msg)
 
-	if uint64(msg.Size)*GB < vol.Durability.MinVolumeSize() {
-		http.Error(w, fmt.Sprintf("Requested volume size (%v GB) is "+
-			"smaller than the minimum supported volume size (%v)",
-			msg.Size, vol.Durability.MinVolumeSize()),
-			http.StatusBadRequest)
-		logger.LogError(fmt.Sprintf("Requested volume size (%v GB) is "+
-			"smaller than the minimum supported volume size (%v)",
-			msg.Size, vol.Durability.MinVolumeSize()))
+	if uint64(vol.sizeMiB())*MB < vol.Durability.MinVolumeSize() {
+		requested := fmt.Sprintf("%v GB", msg.Size)
+		if msg.SizeMiB != 0 {
+			requested = fmt.Sprintf("%v MiB", msg.SizeMiB)
+		}
+		durability := vol.Info.Durability.Type
+		if durability == "" {
+			durability = api.DurabilityDistributeOnly
+		}
+		reason := fmt.Sprintf("Requested volume size (%v) is smaller than "+
+			"the minimum supported volume size (%v MiB) of %v volumes, "+
+			"whose bricks are at least %v MiB",
+			requested, vol.Durability.MinVolumeSize()/MB,
+			durability, brickMinSize(durability)/MB)
+		http.Error(w, reason, http.StatusBadRequest)
+		requestLogger(r).LogError(reason)
+		return nil
+	}
+
+	return vol
+}
+
+func (a *App) VolumeSimulate(w http.ResponseWriter, r *http.Request) {
+
+	vol := a.volumeFromCreateRequest(w, r)
+	if vol == nil {
 		return
 	}
 
-	vc := NewVolumeCreateOperation(vol, a.db)
-	if err := AsyncHttpOperation(a, w, r, vc); err != nil {
-		http.Error(w,
-			fmt.Sprintf("Failed to allocate new volume: %v", err),
-			http.StatusInternalServerError)
+	resp, err := SimulateVolumeCreate(a.db, a.requestAllocator(r), a.clusters, vol)
+	switch err {
+	case nil:
+	case ErrNoSpace, ErrMaxBricks, ErrMinimumBrickSize:
+		http.Error(w, "Unable to place volume: "+err.Error(), http.StatusConflict)
+		requestLogger(r).LogError("Unable to place volume: %v", err)
 		return
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		requestLogger(r).LogError("Failed to simulate volume create: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		panic(err)
 	}
 }
 
 func (a *App) VolumeList(w http.ResponseWriter, r *http.Request) {
 
+	opts, err := listOptions(r, "cluster", "name", "durability", "block",
+		"expand")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	var list api.VolumeListResponse
 
-	// Get all the cluster ids from the DB
-	err := a.db.View(func(tx *bolt.Tx) error {
+	// Get the volume ids from the DB
+	err = a.db.View(func(tx *bolt.Tx) error {
 		var err error
 
-		list.Volumes, err = ListCompleteVolumes(tx)
+		if !opts.Expand {
+			list.Volumes, list.Total, err = ListVolumes(tx, opts)
+			return err
+		}
+
+		list.Infos, list.Total, err = ListVolumeInfos(tx, opts)
 		if err != nil {
 			return err
 		}
+		list.Volumes = make([]string, 0, len(list.Infos))
+		for _, info := range list.Infos {
+			list.Volumes = append(list.Volumes, info.Id)
+		}
 
 		return nil
 	})
 
 	if err != nil {
-		logger.Err(err)
+		requestLogger(r).Err(err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -185,14 +291,47 @@ func (a *App) VolumeList(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func (a *App) VolumeSearch(w http.ResponseWriter, r *http.Request) {
+
+	query := r.URL.Query()
+	req := api.VolumeSearchRequest{
+		Name:  query.Get("name"),
+		Match: query.Get("match"),
+	}
+	if err := req.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var list api.VolumeListResponse
+	err := a.db.View(func(tx *bolt.Tx) error {
+		var err error
+		list.Volumes, err = SearchVolumes(tx, req.Name,
+			req.Match == api.VolumeSearchPrefix)
+		return err
+	})
+	if err != nil {
+		requestLogger(r).Err(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(list); err != nil {
+		panic(err)
+	}
+}
+
 func (a *App) VolumeInfo(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
 
 	var info *api.VolumeInfoResponse
 	err := a.db.View(func(tx *bolt.Tx) error {
-		entry, err := NewVolumeEntryFromId(tx, id)
-		if err == ErrNotFound || !entry.Visible() {
+		// the volume may be looked up by its gluster id as well
+		entry, err := NewVolumeEntryFromAnyId(tx, id)
+		if err == ErrNotFound || (err == nil && !entry.Visible()) {
 			// treat an invisible entry like it doesn't exist
 			http.Error(w, "Id not found", http.StatusNotFound)
 			return ErrNotFound
@@ -244,6 +383,26 @@ func (a *App) VolumeDelete(w http.ResponseWriter, r *http.Request) {
 			return err
 		}
 
+		if snapshots, err := VolumeSnapshots(tx, volume.Info.Id); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		} else if len(snapshots) != 0 {
+			err := requestLogger(r).LogError("Cannot delete volume %v with %v snapshot(s)",
+				volume.Info.Id, len(snapshots))
+			http.Error(w, err.Error(), http.StatusConflict)
+			return err
+		}
+
+		if replications, err := VolumeReplications(tx, volume.Info.Id); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		} else if len(replications) != 0 {
+			err := requestLogger(r).LogError("Cannot delete volume %v of replication %v",
+				volume.Info.Id, replications[0].Info.Id)
+			http.Error(w, err.Error(), http.StatusConflict)
+			return err
+		}
+
 		if !volume.Info.Block {
 			// further checks only needed for block-hosting volumes
 			return nil
@@ -257,7 +416,7 @@ func (a *App) VolumeDelete(w http.ResponseWriter, r *http.Request) {
 			return nil
 		}
 
-		err = logger.LogError("Cannot delete a block hosting volume containing block volumes")
+		err = requestLogger(r).LogError("Cannot delete a block hosting volume containing block volumes")
 		http.Error(w, err.Error(), http.StatusConflict)
 		return err
 	})
@@ -265,8 +424,17 @@ func (a *App) VolumeDelete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	vdel := NewVolumeDeleteOperation(volume, a.db)
-	if err := AsyncHttpOperation(a, w, r, vdel); err != nil {
+	if DeleteConfirmationTimeout > 0 {
+		err = a.asyncHttpConfirmedDelete(w, r, volume.Info.Id)
+	} else {
+		vdel := NewVolumeDeleteOperation(volume, a.db)
+		err = a.asyncHttpQueuedDelete(w, r, volume.Info.Id, vdel)
+	}
+	if err != nil {
+		if err == ErrConflict {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
 		http.Error(w,
 			fmt.Sprintf("Failed to set up volume delete: %v", err),
 			http.StatusInternalServerError)
@@ -274,8 +442,66 @@ func (a *App) VolumeDelete(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func (a *App) VolumeDeleteConfirm(w http.ResponseWriter, r *http.Request) {
+	a.volumeDeleteAnswer(w, r, true)
+}
+
+func (a *App) VolumeDeleteCancel(w http.ResponseWriter, r *http.Request) {
+	a.volumeDeleteAnswer(w, r, false)
+}
+
+// volumeDeleteAnswer confirms or cancels the delete of a volume waiting
+// for its confirmation
+func (a *App) volumeDeleteAnswer(w http.ResponseWriter, r *http.Request,
+	confirmed bool) {
+
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	err := a.db.View(func(tx *bolt.Tx) error {
+		volume, err := NewVolumeEntryFromId(tx, id)
+		if err == ErrNotFound || (err == nil && !volume.Visible()) {
+			http.Error(w, "Id not found", http.StatusNotFound)
+			return ErrNotFound
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+		if volume.PendingDeleteSince == 0 {
+			err := fmt.Errorf("Volume %v is not waiting for the confirmation of its delete", id)
+			http.Error(w, err.Error(), http.StatusConflict)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	if !a.deletes.answer(id, confirmed) {
+		// The delete no longer waits for an answer, e.g. its resumed
+		// wait failed after a restart of the server
+		if confirmed {
+			http.Error(w, fmt.Sprintf("No delete of volume %v is running, "+
+				"the delete must be requested again", id), http.StatusConflict)
+			return
+		}
+		if err := clearPendingDelete(a.db, id); err != nil {
+			requestLogger(r).Err(err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	if confirmed {
+		requestLogger(r).Info("Delete of volume %v confirmed", id)
+	} else {
+		requestLogger(r).Info("Delete of volume %v cancelled", id)
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
 func (a *App) VolumeExpand(w http.ResponseWriter, r *http.Request) {
-	logger.Debug("In VolumeExpand")
+	requestLogger(r).Debug("In VolumeExpand")
 
 	vars := mux.Vars(r)
 	id := vars["id"]
@@ -286,11 +512,14 @@ func (a *App) VolumeExpand(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "request unable to be parsed", 422)
 		return
 	}
-	logger.Debug("Msg: %v", msg)
+	requestLogger(r).Debug("Msg: %v", msg)
 	err = msg.Validate()
+	if err == nil {
+		err = validateVolumeExpandLimits(&msg)
+	}
 	if err != nil {
 		http.Error(w, "validation failed: "+err.Error(), http.StatusBadRequest)
-		logger.LogError("validation failed: " + err.Error())
+		requestLogger(r).LogError("validation failed: " + err.Error())
 		return
 	}
 
@@ -298,7 +527,7 @@ func (a *App) VolumeExpand(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid volume size", http.StatusBadRequest)
 		return
 	}
-	logger.Debug("Size: %v", msg.Size)
+	requestLogger(r).Debug("Size: %v", msg.Size)
 
 	var volume *VolumeEntry
 	err = a.db.View(func(tx *bolt.Tx) error {
@@ -320,11 +549,413 @@ func (a *App) VolumeExpand(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Set the new maximum number of bricks of the volume
+	if msg.MaxBricks != 0 {
+		err = a.db.Update(func(tx *bolt.Tx) error {
+			var err error
+			volume, err = NewVolumeEntryFromId(tx, id)
+			if err != nil {
+				return err
+			}
+			volume.Info.MaxBricks = msg.MaxBricks
+			return volume.Save(tx)
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
 	ve := NewVolumeExpandOperation(volume, a.db, msg.Size)
 	if err := AsyncHttpOperation(a, w, r, ve); err != nil {
+		if tenantQuotaExceeded(w, err) {
+			return
+		}
+		if err == ErrConflict {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if err == ErrMaxBricks {
+			w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+			w.WriteHeader(http.StatusConflict)
+			e := volume.brickLimitError(msg.Size)
+			if err := json.NewEncoder(w).Encode(e); err != nil {
+				panic(err)
+			}
+			return
+		}
 		http.Error(w,
 			fmt.Sprintf("Failed to allocate volume expansion: %v", err),
 			http.StatusInternalServerError)
 		return
 	}
 }
+
+func (a *App) VolumeRestore(w http.ResponseWriter, r *http.Request) {
+	requestLogger(r).Debug("In VolumeRestore")
+
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	var msg api.VolumeRestoreRequest
+	err := utils.GetJsonFromRequest(r, &msg)
+	if err != nil {
+		http.Error(w, "request unable to be parsed", 422)
+		return
+	}
+	requestLogger(r).Debug("Msg: %v", msg)
+	err = msg.Validate()
+	if err != nil {
+		http.Error(w, "validation failed: "+err.Error(), http.StatusBadRequest)
+		requestLogger(r).LogError("validation failed: " + err.Error())
+		return
+	}
+
+	var volume *VolumeEntry
+	var snap *SnapshotEntry
+	err = a.db.View(func(tx *bolt.Tx) error {
+
+		var err error
+		volume, err = NewVolumeEntryFromId(tx, id)
+		if err == ErrNotFound {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return err
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+
+		if !volume.Visible() {
+			// treat an invisible volume like it doesn't exist
+			http.Error(w, "Id not found", http.StatusNotFound)
+			return ErrNotFound
+		}
+
+		if volume.Info.Name == db.HeketiStorageVolumeName {
+			err := fmt.Errorf("Cannot restore volume containing the Heketi database")
+			http.Error(w, err.Error(), http.StatusConflict)
+			return err
+		}
+
+		if volume.Info.Block {
+			err := requestLogger(r).LogError("Cannot restore a block hosting volume")
+			http.Error(w, err.Error(), http.StatusConflict)
+			return err
+		}
+
+		snap, err = volumeSnapshot(tx, volume.Info.Id, msg.Snapshot)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+		if snap != nil && !snap.Visible() {
+			err := requestLogger(r).LogError("Snapshot %v is being created or deleted",
+				snap.Info.Id)
+			http.Error(w, err.Error(), http.StatusConflict)
+			return err
+		}
+		if snap == nil {
+			// gluster restores a snapshot on the volume it was taken of
+			other, err := snapshotOfOtherVolume(tx, volume, msg.Snapshot)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return err
+			}
+			if other {
+				err := requestLogger(r).LogError("Snapshot %v is not a snapshot of volume %v",
+					msg.Snapshot, volume.Info.Id)
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	// Snapshots not managed by heketi are restored by their gluster name
+	var vr *VolumeRestoreOperation
+	if snap != nil {
+		vr = NewSnapshotRestoreOperation(volume, snap, a.db, msg.Force)
+	} else {
+		vr = NewVolumeRestoreOperation(volume, a.db, msg.Snapshot, msg.Force)
+	}
+	if err := AsyncHttpOperation(a, w, r, vr); err != nil {
+		if err == ErrConflict {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		http.Error(w,
+			fmt.Sprintf("Failed to set up volume restore: %v", err),
+			http.StatusInternalServerError)
+		return
+	}
+}
+
+func (a *App) VolumeOptionsCheck(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	var msg api.VolumeOptionsCheckRequest
+	err := utils.GetJsonFromRequest(r, &msg)
+	if err != nil {
+		http.Error(w, "request unable to be parsed", 422)
+		return
+	}
+
+	err = a.db.View(func(tx *bolt.Tx) error {
+		volume, err := NewVolumeEntryFromId(tx, id)
+		if err == ErrNotFound || (err == nil && !volume.Visible()) {
+			// treat an invisible volume like it doesn't exist
+			http.Error(w, "Id not found", http.StatusNotFound)
+			return ErrNotFound
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	requestLogger(r).Info("Checking options of volume %v [enforce: %v]", id, msg.Enforce)
+	resp, err := CheckVolumeOptions(a.db, a.requestExecutor(r), id, msg.Enforce)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		panic(err)
+	}
+}
+
+func (a *App) VolumeBrickOrderCheck(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	err := a.db.View(func(tx *bolt.Tx) error {
+		volume, err := NewVolumeEntryFromId(tx, id)
+		if err == ErrNotFound || (err == nil && !volume.Visible()) {
+			// treat an invisible volume like it doesn't exist
+			http.Error(w, "Id not found", http.StatusNotFound)
+			return ErrNotFound
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	requestLogger(r).Info("Checking brick order of volume %v", id)
+	resp, err := CheckVolumeBrickOrder(a.db, a.requestExecutor(r), id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		panic(err)
+	}
+}
+
+func (a *App) VolumeHealInfo(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	err := a.db.View(func(tx *bolt.Tx) error {
+		volume, err := NewVolumeEntryFromId(tx, id)
+		if err == ErrNotFound || (err == nil && !volume.Visible()) {
+			// treat an invisible volume like it doesn't exist
+			http.Error(w, "Id not found", http.StatusNotFound)
+			return ErrNotFound
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	resp, err := VolumeHealStatus(a.db, a.requestExecutor(r), id)
+	if err == ErrNoSelfHeal {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		panic(err)
+	}
+}
+
+func (a *App) VolumeSetOptions(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	var msg api.VolumeOptionsRequest
+	err := utils.GetJsonFromRequest(r, &msg)
+	if err != nil {
+		http.Error(w, "request unable to be parsed", 422)
+		return
+	}
+	err = msg.Validate()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		requestLogger(r).LogError("validation failed: " + err.Error())
+		return
+	}
+
+	err = a.db.View(func(tx *bolt.Tx) error {
+		volume, err := NewVolumeEntryFromId(tx, id)
+		if err == ErrNotFound || (err == nil && !volume.Visible()) {
+			// treat an invisible volume like it doesn't exist
+			http.Error(w, "Id not found", http.StatusNotFound)
+			return ErrNotFound
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	requestLogger(r).Info("Changing options of volume %v", id)
+	volume, err := UpdateVolumeOptions(a.db, a.requestExecutor(r), id, &msg)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var info *api.VolumeInfoResponse
+	err = a.db.View(func(tx *bolt.Tx) error {
+		var err error
+		info, err = volume.NewInfoResponse(tx)
+		return err
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(info); err != nil {
+		panic(err)
+	}
+}
+
+func (a *App) VolumeSetQuota(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	var msg api.VolumeQuota
+	err := utils.GetJsonFromRequest(r, &msg)
+	if err != nil {
+		http.Error(w, "request unable to be parsed", 422)
+		return
+	}
+	err = msg.Validate()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		requestLogger(r).LogError("validation failed: " + err.Error())
+		return
+	}
+
+	err = a.db.View(func(tx *bolt.Tx) error {
+		volume, err := NewVolumeEntryFromId(tx, id)
+		if err == ErrNotFound || (err == nil && !volume.Visible()) {
+			// treat an invisible volume like it doesn't exist
+			http.Error(w, "Id not found", http.StatusNotFound)
+			return ErrNotFound
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+		if volume.Info.Block && msg.Enable {
+			err := requestLogger(r).LogError("Cannot enable the quota of a block hosting volume")
+			http.Error(w, err.Error(), http.StatusConflict)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	requestLogger(r).Info("Changing quota of volume %v", id)
+	volume, err := UpdateVolumeQuota(a.db, a.requestExecutor(r), id, &msg)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var info *api.VolumeInfoResponse
+	err = a.db.View(func(tx *bolt.Tx) error {
+		var err error
+		info, err = volume.NewInfoResponse(tx)
+		return err
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(info); err != nil {
+		panic(err)
+	}
+}
+
+func (a *App) VolumeIOStats(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	resp := &api.VolumeIOStatsResponse{
+		Id:      id,
+		Samples: []api.VolumeIOSample{},
+	}
+	err := a.db.View(func(tx *bolt.Tx) error {
+		volume, err := NewVolumeEntryFromId(tx, id)
+		if err == ErrNotFound || (err == nil && !volume.Visible()) {
+			// treat an invisible volume like it doesn't exist
+			http.Error(w, "Id not found", http.StatusNotFound)
+			return ErrNotFound
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+		if volume.IOStats != nil {
+			resp.Samples = volume.IOStats.Samples()
+		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		panic(err)
+	}
+}
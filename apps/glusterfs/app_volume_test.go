@@ -27,6 +27,7 @@ import (
 	"github.com/boltdb/bolt"
 	"github.com/gorilla/mux"
 	client "github.com/heketi/heketi/client/api/go-client"
+	"github.com/heketi/heketi/executors"
 	"github.com/heketi/heketi/pkg/db"
 	"github.com/heketi/heketi/pkg/glusterfs/api"
 	"github.com/heketi/heketi/pkg/utils"
@@ -106,6 +107,83 @@ func TestVolumeCreateBadJson(t *testing.T) {
 	tests.Assert(t, r.StatusCode == 422)
 }
 
+func TestVolumeCreateLimits(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	// Setup the server
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	defer func(size, name, clusters int) {
+		VolumeMaxSize, NameMaxLength, ClustersMaxNum = size, name, clusters
+	}(VolumeMaxSize, NameMaxLength, ClustersMaxNum)
+	VolumeMaxSize = 100
+	NameMaxLength = 8
+	ClustersMaxNum = 1
+
+	// Size over the limit
+	request := []byte(`{
+        "size" : 101
+    }`)
+	r, err := http.Post(ts.URL+"/volumes", "application/json", bytes.NewBuffer(request))
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusBadRequest)
+	body, err := utils.GetStringFromResponse(r)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, strings.Contains(body, "size: must be no greater than 100"), body)
+
+	// Name and cluster list over the limit
+	request = []byte(`{
+        "size" : 100,
+        "name" : "longvolumename",
+        "clusters" : [
+            "a1e0e6a5f7d0e8b0b1bc9da5af3c3d2e",
+            "b1e0e6a5f7d0e8b0b1bc9da5af3c3d2e"
+        ]
+    }`)
+	r, err = http.Post(ts.URL+"/volumes", "application/json", bytes.NewBuffer(request))
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusBadRequest)
+	body, err = utils.GetStringFromResponse(r)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, strings.Contains(body, "name: the length must be no more than 8"), body)
+	tests.Assert(t, strings.Contains(body, "clusters: the length must be no more than 1"), body)
+}
+
+func TestVolumeCreateRequestTooLarge(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	// Setup the server
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	defer func(size int64) {
+		RequestMaxSize = size
+	}(RequestMaxSize)
+	RequestMaxSize = 16
+
+	request := []byte(`{
+        "size" : 100
+    }`)
+	r, err := http.Post(ts.URL+"/volumes", "application/json", bytes.NewBuffer(request))
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusRequestEntityTooLarge, r.StatusCode)
+}
+
 func TestVolumeCreateNoTopology(t *testing.T) {
 	tmpfile := tests.Tempfile()
 	defer os.Remove(tmpfile)
@@ -214,6 +292,245 @@ func TestVolumeCreateSmallSize(t *testing.T) {
 		"is smaller than the minimum supported volume size"), body)
 }
 
+func TestVolumeCreateSmallSizeByDurability(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	os.Setenv("HEKETI_EXECUTOR", "mock")
+	defer os.Unsetenv("HEKETI_EXECUTOR")
+
+	data := []byte(`{
+		"glusterfs" : {
+			"db" : "` + tmpfile + `",
+			"brick_min_size_mb_by_durability" : {
+				"disperse" : 4096,
+				"stripe" : 1024
+			}
+		}
+	}`)
+
+	defer func(sizes map[api.DurabilityType]uint64) {
+		BrickMinSizeByDurability = sizes
+	}(BrickMinSizeByDurability)
+
+	app := NewApp(bytes.NewReader(data))
+	defer app.Close()
+	tests.Assert(t, len(BrickMinSizeByDurability) == 1, BrickMinSizeByDurability)
+	tests.Assert(t, BrickMinSizeByDurability[api.DurabilityEC] == 4*GB,
+		BrickMinSizeByDurability)
+
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	// Setup the server
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	// Setup database
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		10,   // nodes_per_cluster
+		10,   // devices_per_node,
+		5*TB, // disksize)
+	)
+	tests.Assert(t, err == nil)
+
+	// Bricks of 2 GB for a disperse volume of 4 data bricks
+	request := []byte(`{
+        "size" : 8,
+        "durability" : {
+            "type" : "disperse",
+            "disperse" : {
+                "data" : 4,
+                "redundancy" : 2
+            }
+        }
+    }`)
+	r, err := http.Post(ts.URL+"/volumes", "application/json",
+		bytes.NewBuffer(request))
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusBadRequest)
+	body, err := utils.GetStringFromResponse(r)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, strings.Contains(body, "Requested volume size (8 GB) "+
+		"is smaller than the minimum supported volume size (16384 MiB) "+
+		"of disperse volumes, whose bricks are at least 4096 MiB"), body)
+
+	// The same size is fine for a replicate volume
+	request = []byte(`{
+        "size" : 8,
+        "durability" : {
+            "type" : "replicate",
+            "replicate" : {
+                "replica" : 3
+            }
+        }
+    }`)
+	r, err = http.Post(ts.URL+"/volumes", "application/json",
+		bytes.NewBuffer(request))
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusAccepted, r.StatusCode)
+}
+
+func TestVolumeCreateSizeMiB(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	os.Setenv("HEKETI_EXECUTOR", "mock")
+	defer os.Unsetenv("HEKETI_EXECUTOR")
+
+	data := []byte(`{
+		"glusterfs" : {
+			"db" : "` + tmpfile + `",
+			"brick_min_size_mb" : 256
+		}
+	}`)
+
+	bmin := BrickMinSize
+	defer func() {
+		BrickMinSize = bmin
+	}()
+
+	app := NewApp(bytes.NewReader(data))
+	defer app.Close()
+	tests.Assert(t, BrickMinSize == 256*MB, BrickMinSize)
+
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	c := client.NewClientNoAuth(ts.URL)
+	tests.Assert(t, c != nil)
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		3,    // nodes_per_cluster
+		1,    // devices_per_node,
+		1*TB, // disksize)
+	)
+	tests.Assert(t, err == nil)
+
+	req := &api.VolumeCreateRequest{}
+	req.SizeMiB = 512
+	req.Durability.Type = api.DurabilityReplicate
+	req.Durability.Replicate.Replica = 3
+
+	info, err := c.VolumeCreate(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, info.Size == 1, info.Size)
+	tests.Assert(t, info.SizeMiB == 512, info.SizeMiB)
+	tests.Assert(t, len(info.Bricks) == 3, info.Bricks)
+	for _, b := range info.Bricks {
+		tests.Assert(t, b.Size == 512*MB, b.Size)
+	}
+
+	// Expanding keeps the size in MiB in step
+	info, err = c.VolumeExpand(info.Id, &api.VolumeExpandRequest{Size: 1})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, info.Size == 2, info.Size)
+	tests.Assert(t, info.SizeMiB == 1536, info.SizeMiB)
+
+	// Fractional GiB
+	req.SizeMiB = 1536
+	info, err = c.VolumeCreate(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, info.Size == 2, info.Size)
+	tests.Assert(t, info.SizeMiB == 1536, info.SizeMiB)
+	for _, b := range info.Bricks {
+		tests.Assert(t, b.Size == 1536*MB, b.Size)
+	}
+
+	// Smaller than the minimum brick size
+	req.SizeMiB = 128
+	_, err = c.VolumeCreate(req)
+	tests.Assert(t, err != nil)
+	tests.Assert(t, strings.Contains(err.Error(), "(128 MiB)"), err)
+
+	// A size is required
+	req.SizeMiB = 0
+	_, err = c.VolumeCreate(req)
+	tests.Assert(t, err != nil)
+
+	req.SizeMiB = -1
+	_, err = c.VolumeCreate(req)
+	tests.Assert(t, err != nil)
+}
+
+func TestVolumeSimulate(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	c := client.NewClientNoAuth(ts.URL)
+	tests.Assert(t, c != nil)
+
+	err := setupSampleDbWithTopology(app,
+		1,      // clusters
+		3,      // nodes_per_cluster
+		2,      // devices_per_node,
+		500*GB, // disksize)
+	)
+	tests.Assert(t, err == nil)
+
+	req := &api.VolumeCreateRequest{}
+	req.Size = 100
+	req.Durability.Type = api.DurabilityReplicate
+	req.Durability.Replicate.Replica = 3
+
+	sim, err := c.VolumeSimulate(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, sim.Cluster != "")
+	tests.Assert(t, sim.Size == 100, sim.Size)
+	tests.Assert(t, len(sim.Bricks) == 3, sim.Bricks)
+	nodes := map[string]bool{}
+	for _, b := range sim.Bricks {
+		tests.Assert(t, b.Set == 0, b.Set)
+		tests.Assert(t, b.Size == 100*GB, b.Size)
+		tests.Assert(t, b.Hostname != "" && b.DeviceName != "", b)
+		nodes[b.NodeId] = true
+	}
+	tests.Assert(t, len(nodes) == 3, nodes)
+
+	// Nothing was saved
+	app.db.View(func(tx *bolt.Tx) error {
+		vl, err := VolumeList(tx)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, len(vl) == 0, vl)
+		bl, err := BrickList(tx)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, len(bl) == 0, bl)
+		dl, err := DeviceList(tx)
+		tests.Assert(t, err == nil)
+		for _, id := range dl {
+			d, err := NewDeviceEntryFromId(tx, id)
+			tests.Assert(t, err == nil)
+			tests.Assert(t, len(d.Bricks) == 0, d.Bricks)
+			tests.Assert(t, d.Info.Storage.Used == 0, d.Info.Storage)
+		}
+		return nil
+	})
+
+	// Too large for the cluster
+	req.Size = 5000
+	_, err = c.VolumeSimulate(req)
+	tests.Assert(t, err != nil, "expected err != nil")
+	tests.Assert(t, strings.Contains(err.Error(), "Unable to place volume"), err)
+
+	// Invalid requests are rejected as on create
+	req.Size = 0
+	_, err = c.VolumeSimulate(req)
+	tests.Assert(t, err != nil, "expected err != nil")
+}
+
 func TestVolumeHeketiDbStorage(t *testing.T) {
 	tmpfile := tests.Tempfile()
 	defer os.Remove(tmpfile)
@@ -669,6 +986,77 @@ func TestVolumeInfo(t *testing.T) {
 	}
 }
 
+func TestVolumeInfoByGlusterId(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	// Setup the server
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	// Setup database
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		3,    // nodes_per_cluster
+		1,    // devices_per_node,
+		1*TB, // disksize)
+	)
+	tests.Assert(t, err == nil)
+
+	// Gluster assigns its own id to the volume
+	glusterId := "4c6ff4e2-6a7b-4f0e-8d0e-2f3a6b1d9c01"
+	app.xo.MockVolumeInfo = func(host string, volume string) (*executors.Volume, error) {
+		return &executors.Volume{VolumeName: volume, ID: glusterId}, nil
+	}
+
+	// Create a volume
+	req := &api.VolumeCreateRequest{}
+	req.Size = 100
+	req.Durability.Type = api.DurabilityReplicate
+	v := NewVolumeEntryFromRequest(req)
+	err = v.Create(app.db, app.executor, app.Allocator())
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, v.Info.GlusterId == glusterId, v.Info.GlusterId)
+
+	// The volume can be found using either id
+	for _, id := range []string{v.Info.Id, glusterId} {
+		r, err := http.Get(ts.URL + "/volumes/" + id)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, r.StatusCode == http.StatusOK, r.StatusCode)
+
+		var msg api.VolumeInfoResponse
+		err = utils.GetJsonFromResponse(r, &msg)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, msg.Id == v.Info.Id)
+		tests.Assert(t, msg.GlusterId == glusterId, msg.GlusterId)
+	}
+
+	r, err := http.Get(ts.URL + "/volumes/4c6ff4e2-0000-0000-0000-000000000000")
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusNotFound, r.StatusCode)
+
+	// The other volume routes take the gluster id as well
+	c := client.NewClientNoAuth(ts.URL)
+	tests.Assert(t, c != nil)
+	err = c.VolumeDelete(glusterId)
+	tests.Assert(t, err == nil, err)
+	app.db.View(func(tx *bolt.Tx) error {
+		_, err := NewVolumeEntryFromId(tx, v.Info.Id)
+		tests.Assert(t, err == ErrNotFound, err)
+
+		// and the deleted volume is dropped from the index
+		_, err = NewVolumeEntryFromGlusterId(tx, glusterId)
+		tests.Assert(t, err == ErrNotFound, err)
+		return nil
+	})
+}
+
 func TestVolumeListEmpty(t *testing.T) {
 	tmpfile := tests.Tempfile()
 	defer os.Remove(tmpfile)
@@ -1058,6 +1446,200 @@ func TestVolumeExpand(t *testing.T) {
 	tests.Assert(t, len(vc.Bricks) < len(info.Bricks))
 }
 
+func TestVolumeExpandBrickLimit(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	// Setup the server
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	c := client.NewClientNoAuth(ts.URL)
+	tests.Assert(t, c != nil)
+
+	// Create a cluster
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		4,    // nodes_per_cluster
+		2,    // devices_per_node,
+		5*TB, // disksize)
+	)
+	tests.Assert(t, err == nil)
+
+	// Create a volume that can not have more bricks
+	req := &api.VolumeCreateRequest{}
+	req.Size = 100
+	req.Durability.Type = api.DurabilityReplicate
+	req.Durability.Replicate.Replica = 2
+	req.MaxBricks = 2
+	volume, err := c.VolumeCreate(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, volume.MaxBricks == 2, volume.MaxBricks)
+	tests.Assert(t, len(volume.Bricks) == 2, volume.Bricks)
+
+	expandReq := &api.VolumeExpandRequest{}
+	expandReq.Size = 100
+	_, err = c.VolumeExpand(volume.Id, expandReq)
+	tests.Assert(t, err != nil, "expected err != nil")
+	limitErr, ok := err.(*api.BrickLimitError)
+	tests.Assert(t, ok, "expected *api.BrickLimitError, got:", err)
+	tests.Assert(t, limitErr.Volume == volume.Id, limitErr)
+	tests.Assert(t, limitErr.Bricks == 2, limitErr)
+	tests.Assert(t, limitErr.Limit == 2, limitErr)
+	tests.Assert(t, len(limitErr.Hints) > 0, limitErr)
+	tests.Assert(t, strings.Contains(err.Error(), "max_bricks"), err)
+
+	// Raising the limit of the volume allows the expansion
+	expandReq.MaxBricks = 4
+	volume, err = c.VolumeExpand(volume.Id, expandReq)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, volume.Size == 200, volume.Size)
+	tests.Assert(t, volume.MaxBricks == 4, volume.MaxBricks)
+	tests.Assert(t, len(volume.Bricks) == 4, volume.Bricks)
+}
+
+func TestVolumeCreateBrickLimits(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	c := client.NewClientNoAuth(ts.URL)
+	tests.Assert(t, c != nil)
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		4,    // nodes_per_cluster
+		2,    // devices_per_node,
+		5*TB, // disksize)
+	)
+	tests.Assert(t, err == nil)
+
+	req := &api.VolumeCreateRequest{}
+	req.Size = 100
+	req.Durability.Type = api.DurabilityReplicate
+	req.Durability.Replicate.Replica = 2
+
+	// Smaller bricks than the server limits
+	req.BrickLimits.MaxSize = 25
+	volume, err := c.VolumeCreate(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(volume.Bricks) == 8, volume.Bricks)
+	tests.Assert(t, volume.BrickLimits.MaxSize == 25, volume.BrickLimits)
+
+	// Bricks can not be smaller than the minimum of the volume
+	req.BrickLimits = api.VolumeBrickLimits{MinSize: 200}
+	_, err = c.VolumeCreate(req)
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	req.BrickLimits = api.VolumeBrickLimits{MinSize: 50, MaxSize: 25}
+	_, err = c.VolumeCreate(req)
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	// The distribute count is kept when the volume is expanded
+	req.BrickLimits = api.VolumeBrickLimits{MaxDistribute: 1}
+	volume, err = c.VolumeCreate(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(volume.Bricks) == 2, volume.Bricks)
+
+	expandReq := &api.VolumeExpandRequest{}
+	expandReq.Size = 100
+	_, err = c.VolumeExpand(volume.Id, expandReq)
+	tests.Assert(t, err != nil, "expected err != nil")
+	limitErr, ok := err.(*api.BrickLimitError)
+	tests.Assert(t, ok, "expected *api.BrickLimitError, got:", err)
+	tests.Assert(t, strings.Contains(strings.Join(limitErr.Hints, " "),
+		"max_distribute"), limitErr.Hints)
+}
+
+func TestVolumeCreateNodeHints(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	c := client.NewClientNoAuth(ts.URL)
+	tests.Assert(t, c != nil)
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		4,    // nodes_per_cluster
+		1,    // devices_per_node,
+		5*TB, // disksize)
+	)
+	tests.Assert(t, err == nil)
+
+	var nodes []string
+	app.db.View(func(tx *bolt.Tx) error {
+		nodes, err = NodeList(tx)
+		tests.Assert(t, err == nil)
+		return nil
+	})
+	tests.Assert(t, len(nodes) == 4, nodes)
+
+	req := &api.VolumeCreateRequest{}
+	req.Size = 100
+	req.Durability.Type = api.DurabilityReplicate
+	req.Durability.Replicate.Replica = 3
+
+	// No brick is placed on the excluded node
+	for i := 0; i < 4; i++ {
+		req.ExcludeNodes = []string{nodes[0]}
+		volume, err := c.VolumeCreate(req)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, len(volume.Bricks) == 3, volume.Bricks)
+		for _, b := range volume.Bricks {
+			tests.Assert(t, b.NodeId != nodes[0], b)
+		}
+
+		// The hints are not kept with the volume
+		tests.Assert(t, len(volume.ExcludeNodes) == 0, volume.ExcludeNodes)
+	}
+
+	// Only the included nodes get bricks
+	req.ExcludeNodes = nil
+	req.IncludeNodes = nodes[1:]
+	volume, err := c.VolumeCreate(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	for _, b := range volume.Bricks {
+		tests.Assert(t, b.NodeId != nodes[0], b)
+	}
+
+	// Too few nodes for the sets of the volume
+	req.IncludeNodes = nodes[:2]
+	_, err = c.VolumeCreate(req)
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	req.IncludeNodes = nodes[:3]
+	req.ExcludeNodes = nodes[2:]
+	_, err = c.VolumeCreate(req)
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	req.IncludeNodes = nil
+	req.ExcludeNodes = []string{"12345678901234567890123456789012"}
+	_, err = c.VolumeCreate(req)
+	tests.Assert(t, err != nil, "expected err != nil")
+	tests.Assert(t, strings.Contains(err.Error(), "not found"), err)
+}
+
 func TestVolumeClusterResizeByAddingDevices(t *testing.T) {
 	tmpfile := tests.Tempfile()
 	defer os.Remove(tmpfile)
@@ -1274,3 +1856,132 @@ func TestVolumeCreateWithOptions(t *testing.T) {
 	tests.Assert(t, info.GlusterVolumeOptions[0] == "test-option")
 
 }
+
+func TestVolumeRestoreIdNotFound(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	// Setup the server
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	// JSON Request
+	request := []byte(`{
+        "snapshot" : "snap1"
+    }`)
+
+	r, err := http.Post(ts.URL+"/volumes/12345/restore",
+		"application/json",
+		bytes.NewBuffer(request))
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusNotFound, r.StatusCode)
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, r.ContentLength))
+	tests.Assert(t, err == nil)
+	r.Body.Close()
+	tests.Assert(t, strings.Contains(string(body), "Id not found"))
+}
+
+func TestVolumeRestoreBadSnapshot(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	// Setup the server
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	// JSON Request
+	request := []byte(`{
+        "snapshot" : "snap 1"
+    }`)
+
+	r, err := http.Post(ts.URL+"/volumes/12345/restore",
+		"application/json",
+		bytes.NewBuffer(request))
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusBadRequest, r.StatusCode)
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, r.ContentLength))
+	tests.Assert(t, err == nil)
+	r.Body.Close()
+	tests.Assert(t, strings.Contains(string(body), "snapshot: must be in a valid format"), string(body))
+}
+
+func TestVolumeRestore(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	// Setup the server
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	// Create a cluster
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		3,    // nodes_per_cluster
+		2,    // devices_per_node,
+		5*TB, // disksize)
+	)
+	tests.Assert(t, err == nil)
+
+	// Create a volume
+	v := createSampleReplicaVolumeEntry(100, 3)
+	tests.Assert(t, v != nil)
+	err = v.Create(app.db, app.executor, app.Allocator())
+	tests.Assert(t, err == nil)
+
+	restored := ""
+	app.xo.MockSnapshotRestore = func(host string, snapshot string) error {
+		restored = snapshot
+		return nil
+	}
+
+	// JSON Request
+	request := []byte(`{
+        "snapshot" : "snap1_GMT-2018.01.01-10.10.10"
+    }`)
+
+	// Send request
+	r, err := http.Post(ts.URL+"/volumes/"+v.Info.Id+"/restore",
+		"application/json",
+		bytes.NewBuffer(request))
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusAccepted)
+	location, err := r.Location()
+	tests.Assert(t, err == nil)
+
+	// Query queue until finished
+	var info api.VolumeInfoResponse
+	for {
+		r, err := http.Get(location.String())
+		tests.Assert(t, err == nil)
+		tests.Assert(t, r.StatusCode == http.StatusOK)
+		if r.Header.Get("X-Pending") == "true" {
+			time.Sleep(time.Millisecond * 10)
+			continue
+		} else {
+			err = utils.GetJsonFromResponse(r, &info)
+			tests.Assert(t, err == nil)
+			break
+		}
+	}
+
+	tests.Assert(t, info.Id == v.Info.Id)
+	tests.Assert(t, restored == "snap1_GMT-2018.01.01-10.10.10", restored)
+}
@@ -0,0 +1,123 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"net/http"
+	"path"
+	"sync"
+
+	"github.com/gorilla/mux"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+)
+
+// asyncStep holds the step reached by an asynchronous operation
+type asyncStep struct {
+	lock sync.Mutex
+	step string
+	done bool
+}
+
+func (s *asyncStep) set(step string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.step = step
+}
+
+func (s *asyncStep) finish() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.done = true
+}
+
+func (s *asyncStep) get() (string, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.step, s.done
+}
+
+// asyncStepManager keeps the steps of the asynchronous operations
+// by the id of the operation in the async manager
+type asyncStepManager struct {
+	lock  sync.Mutex
+	steps map[string]*asyncStep
+}
+
+func newAsyncStepManager() *asyncStepManager {
+	return &asyncStepManager{
+		steps: map[string]*asyncStep{},
+	}
+}
+
+func (m *asyncStepManager) add(id string, s *asyncStep) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.steps[id] = s
+}
+
+// step returns the step reached by the operation. Operations are
+// forgotten once their completion has been reported.
+func (m *asyncStepManager) step(id string) string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	s, ok := m.steps[id]
+	if !ok {
+		return ""
+	}
+	step, done := s.get()
+	if done {
+		delete(m.steps, id)
+	}
+	return step
+}
+
+// asyncHttpRedirectFunc runs fn like AsyncHttpRedirectFunc of the async
+// manager. The result of the operation completes the audit log entry of
+// the request.
+func (a *App) asyncHttpRedirectFunc(w http.ResponseWriter,
+	r *http.Request,
+	fn func() (string, error)) {
+
+	rec := auditRecordFromRequest(r)
+	a.asyncManager.AsyncHttpRedirectFunc(w, r, func() (string, error) {
+		url, err := fn()
+		if rec != nil {
+			rec.completed(url, err)
+		}
+		return url, err
+	})
+}
+
+// asyncHttpRedirectWithStepsFunc runs fn like AsyncHttpRedirectFunc of
+// the async manager. The steps reported by fn are returned by the async
+// operation endpoint while the operation is pending.
+func (a *App) asyncHttpRedirectWithStepsFunc(w http.ResponseWriter,
+	r *http.Request,
+	fn func(step func(string)) (string, error)) {
+
+	s := &asyncStep{}
+	a.asyncHttpRedirectFunc(w, r, func() (string, error) {
+		defer s.finish()
+		return fn(s.set)
+	})
+
+	// The id of the operation is the last part of its url
+	a.asyncSteps.add(path.Base(w.Header().Get("Location")), s)
+}
+
+func (a *App) AsyncStatus(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	if step := a.asyncSteps.step(id); step != "" {
+		w.Header().Set(api.HeaderPendingStep, step)
+	}
+	a.asyncManager.HandlerStatus(w, r)
+}
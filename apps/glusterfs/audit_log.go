@@ -0,0 +1,346 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/gorilla/mux"
+	wdb "github.com/heketi/heketi/pkg/db"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/heketi/pkg/utils"
+	"github.com/lpabon/godbc"
+)
+
+const (
+	BOLTDB_BUCKET_AUDIT_LOG = "AUDIT_LOG"
+)
+
+var (
+	// Days the requests are kept in the audit log
+	AuditLogDays = 90
+
+	// Bytes of the payload of a request and of the error of a failed
+	// request kept in the audit log
+	AuditLogMaxPayload = 4096
+	AuditLogMaxError   = 1024
+)
+
+// AuditLogEntry records a request changing the state of the server.
+// The entries are keyed by the time the request was received so that
+// they are kept in that order.
+type AuditLogEntry struct {
+	Id        string
+	RequestId string
+	// Seconds since the epoch
+	Time     int64
+	Finished int64
+	// Issuer of the token of the request, if any
+	User      string
+	Method    string
+	Path      string
+	Operation string
+	// Id of the object of the request, from the path of the request or
+	// the created object
+	ObjectId string
+	Payload  string
+	Status   int
+	Result   string
+	Error    string
+	// Order of the entry among the entries of the log
+	Seq uint64
+}
+
+func (e *AuditLogEntry) BucketName() string {
+	return BOLTDB_BUCKET_AUDIT_LOG
+}
+
+func (e *AuditLogEntry) Save(tx *bolt.Tx) error {
+	godbc.Require(tx != nil)
+	godbc.Require(e.Id != "")
+
+	if e.Seq == 0 {
+		b := tx.Bucket([]byte(e.BucketName()))
+		if b == nil {
+			return ErrDbAccess
+		}
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		e.Seq = seq
+	}
+	// The keys sort as the keys of the operation history
+	return EntrySave(tx, e, historyKey(e.Time, e.Seq))
+}
+
+func (e *AuditLogEntry) Marshal() ([]byte, error) {
+	var buffer bytes.Buffer
+	enc := gob.NewEncoder(&buffer)
+	err := enc.Encode(*e)
+
+	return buffer.Bytes(), err
+}
+
+func (e *AuditLogEntry) Unmarshal(buffer []byte) error {
+	dec := gob.NewDecoder(bytes.NewReader(buffer))
+	err := dec.Decode(e)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (e *AuditLogEntry) NewInfoResponse() *api.AuditLogEntryInfo {
+	return &api.AuditLogEntryInfo{
+		Id:        e.Id,
+		RequestId: e.RequestId,
+		Time:      e.Time,
+		Finished:  e.Finished,
+		User:      e.User,
+		Method:    e.Method,
+		Path:      e.Path,
+		Operation: e.Operation,
+		ObjectId:  e.ObjectId,
+		Payload:   e.Payload,
+		Status:    e.Status,
+		Result:    e.Result,
+		Error:     e.Error,
+	}
+}
+
+// auditRecord is the entry of a request being handled. The entry is
+// completed by the handler of the request and, for the requests
+// starting an asynchronous operation, once the operation is done,
+// which may happen first.
+type auditRecord struct {
+	lock  sync.Mutex
+	db    wdb.DB
+	entry *AuditLogEntry
+}
+
+type auditRecordKey struct{}
+
+func (rec *auditRecord) save() {
+	err := rec.db.Update(func(tx *bolt.Tx) error {
+		return rec.entry.Save(tx)
+	})
+	if err != nil {
+		logger.LogError("Unable to record request %v in the audit log: %v",
+			rec.entry.Id, err)
+	}
+}
+
+// responded completes the entry with the response to the request
+func (rec *auditRecord) responded(status int, body string) {
+	rec.lock.Lock()
+	defer rec.lock.Unlock()
+
+	if status == 0 {
+		status = http.StatusOK
+	}
+	rec.entry.Status = status
+	switch {
+	case status == http.StatusAccepted:
+		// Completed by the operation
+	case status >= 400:
+		rec.entry.Result = api.AuditResultFailed
+		rec.entry.Error = truncate(strings.TrimSpace(body), AuditLogMaxError)
+		rec.entry.Finished = time.Now().Unix()
+	default:
+		rec.entry.Result = api.AuditResultSucceeded
+		rec.entry.Finished = time.Now().Unix()
+	}
+	rec.save()
+}
+
+// completed completes the entry with the result of the asynchronous
+// operation started by the request
+func (rec *auditRecord) completed(url string, err error) {
+	rec.lock.Lock()
+	defer rec.lock.Unlock()
+
+	rec.entry.Finished = time.Now().Unix()
+	if err != nil {
+		rec.entry.Result = api.AuditResultFailed
+		rec.entry.Error = truncate(err.Error(), AuditLogMaxError)
+	} else {
+		rec.entry.Result = api.AuditResultSucceeded
+		if rec.entry.ObjectId == "" && url != "" {
+			rec.entry.ObjectId = path.Base(url)
+		}
+	}
+	rec.save()
+}
+
+// auditRecordFromRequest returns the audit record of the request, if
+// the request is recorded in the audit log
+func auditRecordFromRequest(r *http.Request) *auditRecord {
+	rec, _ := r.Context().Value(auditRecordKey{}).(*auditRecord)
+	return rec
+}
+
+func truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	return s[:max] + "...(truncated)"
+}
+
+// auditResponseWriter keeps the status and the start of the body of
+// the response
+type auditResponseWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *auditResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *auditResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if w.body.Len() < AuditLogMaxError {
+		w.body.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// auditHandler records the requests handled by next in the audit log.
+// The payload of the request is kept unless keepPayload is false.
+func (a *App) auditHandler(operation string,
+	keepPayload bool,
+	next http.Handler) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if a.dbReadOnly {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		entry := &AuditLogEntry{
+			Id:        utils.GenUUID(),
+			RequestId: requestId(r),
+			Time:      time.Now().Unix(),
+			User:      requestIssuer(r),
+			Method:    r.Method,
+			Path:      r.URL.Path,
+			Operation: operation,
+			ObjectId:  mux.Vars(r)["id"],
+			Result:    api.AuditResultPending,
+		}
+		if keepPayload && r.Body != nil {
+			// A read failing on a too large body fails again when the
+			// handler reads past the part already read
+			body, _ := ioutil.ReadAll(r.Body)
+			entry.Payload = truncate(string(body), AuditLogMaxPayload)
+			r.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+		}
+
+		rec := &auditRecord{
+			db:    a.db,
+			entry: entry,
+		}
+		if err := recordAuditLog(a.db, entry); err != nil {
+			logger.LogError("Unable to record request %v in the audit log: %v",
+				entry.Id, err)
+		}
+
+		aw := &auditResponseWriter{ResponseWriter: w}
+		next.ServeHTTP(aw,
+			r.WithContext(context.WithValue(r.Context(), auditRecordKey{}, rec)))
+		rec.responded(aw.status, aw.body.String())
+	})
+}
+
+// recordAuditLog saves a new entry of the audit log and removes the
+// entries older than the retention period
+func recordAuditLog(db wdb.DB, e *AuditLogEntry) error {
+	cutoff := []byte(historyKey(e.Time-int64(AuditLogDays)*24*3600, 0))
+	return db.Update(func(tx *bolt.Tx) error {
+		if err := e.Save(tx); err != nil {
+			return err
+		}
+
+		b := tx.Bucket([]byte(BOLTDB_BUCKET_AUDIT_LOG))
+		c := b.Cursor()
+		for k, _ := c.First(); k != nil && bytes.Compare(k, cutoff) < 0; k, _ = c.First() {
+			if err := c.Delete(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// AuditLogFilter selects the entries of the audit log. Empty fields
+// select every entry.
+type AuditLogFilter struct {
+	ObjectId string
+	// Seconds since the epoch the request was received in, inclusive
+	Since int64
+	Until int64
+}
+
+// AuditLog returns the entries of the audit log selected by the
+// filter, oldest first
+func AuditLog(db wdb.RODB, f *AuditLogFilter) ([]*AuditLogEntry, error) {
+	entries := []*AuditLogEntry{}
+	err := db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(BOLTDB_BUCKET_AUDIT_LOG))
+		if b == nil {
+			return ErrDbAccess
+		}
+
+		var end []byte
+		if f.Until != 0 {
+			end = []byte(historyKey(f.Until+1, 0))
+		}
+		c := b.Cursor()
+		for k, v := c.Seek([]byte(historyKey(f.Since, 0))); k != nil; k, v = c.Next() {
+			if end != nil && bytes.Compare(k, end) >= 0 {
+				break
+			}
+			e := &AuditLogEntry{}
+			if err := e.Unmarshal(v); err != nil {
+				return err
+			}
+			if f.ObjectId != "" && e.ObjectId != f.ObjectId {
+				continue
+			}
+			entries = append(entries, e)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
@@ -0,0 +1,145 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	client "github.com/heketi/heketi/client/api/go-client"
+	"github.com/heketi/heketi/executors"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/tests"
+)
+
+func TestAuditLog(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	c := client.NewClientNoAuth(ts.URL)
+	tests.Assert(t, c != nil)
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		3,    // nodes_per_cluster
+		2,    // devices_per_node,
+		2*TB, // disksize
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	start := time.Now().Unix()
+
+	req := &api.VolumeCreateRequest{}
+	req.Size = 10
+	req.Durability.Type = api.DurabilityReplicate
+	req.Durability.Replicate.Replica = 3
+	vol, err := c.VolumeCreate(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	app.xo.MockVolumeExpand = func(host string,
+		volume *executors.VolumeRequest) (*executors.Volume, error) {
+		return nil, fmt.Errorf("expand failed")
+	}
+	_, err = c.VolumeExpand(vol.Id, &api.VolumeExpandRequest{Size: 10})
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	err = c.ClusterDelete("abc123")
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	// Requests not changing the state are not recorded
+	_, err = c.VolumeInfo(vol.Id)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	log, err := c.AuditLog("", 0, 0)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(log.Entries) == 3, log.Entries)
+
+	e := log.Entries[0]
+	tests.Assert(t, e.Method == "POST" && e.Path == "/volumes", e)
+	tests.Assert(t, e.Operation == "VolumeCreate", e)
+	tests.Assert(t, e.Time >= start, e)
+	tests.Assert(t, e.Status == http.StatusAccepted, e)
+	tests.Assert(t, e.Result == api.AuditResultSucceeded, e)
+	tests.Assert(t, e.ObjectId == vol.Id, e)
+	tests.Assert(t, strings.Contains(e.Payload, `"size":10`), e.Payload)
+	tests.Assert(t, e.RequestId != "", e)
+
+	e = log.Entries[1]
+	tests.Assert(t, e.Operation == "VolumeExpand", e)
+	tests.Assert(t, e.ObjectId == vol.Id, e)
+	tests.Assert(t, e.Result == api.AuditResultFailed, e)
+	tests.Assert(t, strings.Contains(e.Error, "expand failed"), e.Error)
+
+	e = log.Entries[2]
+	tests.Assert(t, e.Method == "DELETE" && e.Operation == "ClusterDelete", e)
+	tests.Assert(t, e.ObjectId == "abc123", e)
+	tests.Assert(t, e.Status == http.StatusNotFound, e)
+	tests.Assert(t, e.Result == api.AuditResultFailed, e)
+
+	// By object
+	log, err = c.AuditLog(vol.Id, 0, 0)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(log.Entries) == 2, log.Entries)
+
+	// By time range
+	log, err = c.AuditLog("", start-3600, start-1)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(log.Entries) == 0, log.Entries)
+
+	log, err = c.AuditLog("", start, time.Now().Unix())
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(log.Entries) == 3, log.Entries)
+
+	r, err := http.Get(ts.URL + "/auditlog?until=tomorrow")
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusBadRequest, r.StatusCode)
+}
+
+func TestAuditLogRetention(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	defer func(days int) {
+		AuditLogDays = days
+	}(AuditLogDays)
+	AuditLogDays = 2
+
+	now := time.Now().Unix()
+	for _, age := range []int64{5, 1} {
+		err := recordAuditLog(app.db, &AuditLogEntry{
+			Id:   fmt.Sprintf("req%v", age),
+			Time: now - age*24*3600,
+		})
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	}
+
+	// Recording a request removes the entries past the retention
+	entries, err := AuditLog(app.db, &AuditLogFilter{})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(entries) == 1, entries)
+	tests.Assert(t, entries[0].Id == "req1", entries[0])
+}
@@ -0,0 +1,113 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/heketi/heketi/executors"
+	wdb "github.com/heketi/heketi/pkg/db"
+)
+
+// blockHostingVolumeInUse returns true if the block hosting volume has
+// block volumes, including block volumes being created or deleted
+func blockHostingVolumeInUse(tx *bolt.Tx, volumeId string) (bool, error) {
+	vol, err := NewVolumeEntryFromId(tx, volumeId)
+	if err != nil {
+		return false, err
+	}
+	if len(vol.Info.BlockInfo.BlockVolumes) != 0 {
+		return true, nil
+	}
+
+	ids, err := BlockVolumeList(tx)
+	if err != nil {
+		return false, err
+	}
+	for _, id := range ids {
+		bv, err := NewBlockVolumeEntryFromId(tx, id)
+		if err != nil {
+			return false, err
+		}
+		if bv.Info.BlockHostingVolume == volumeId {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// expiredBlockHostingVolumes returns the block hosting volumes whose last
+// block volume was removed more than grace seconds before now
+func expiredBlockHostingVolumes(tx *bolt.Tx,
+	now time.Time, grace int) ([]*VolumeEntry, error) {
+
+	ids, err := VolumeList(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := now.Add(-time.Duration(grace) * time.Second).Unix()
+	volumes := []*VolumeEntry{}
+	for _, id := range ids {
+		vol, err := NewVolumeEntryFromId(tx, id)
+		if err != nil {
+			return nil, err
+		}
+		if !vol.Info.Block || !vol.Visible() ||
+			vol.BlockEmptySince == 0 || vol.BlockEmptySince > deadline {
+			continue
+		}
+		if inUse, err := blockHostingVolumeInUse(tx, id); err != nil {
+			return nil, err
+		} else if inUse {
+			continue
+		}
+		volumes = append(volumes, vol)
+	}
+	return volumes, nil
+}
+
+// reapBlockHostingVolumes deletes the block hosting volumes left empty
+// for more than the grace period
+func reapBlockHostingVolumes(db wdb.DB, executor executors.Executor, grace int) {
+	var volumes []*VolumeEntry
+	err := db.View(func(tx *bolt.Tx) error {
+		var err error
+		volumes, err = expiredBlockHostingVolumes(tx, time.Now(), grace)
+		return err
+	})
+	if err != nil {
+		logger.LogError("Unable to list empty block hosting volumes: %v", err)
+		return
+	}
+
+	for _, vol := range volumes {
+		logger.Info("Deleting block hosting volume %v empty since %v",
+			vol.Info.Id, time.Unix(vol.BlockEmptySince, 0))
+		if err := vol.Destroy(db, executor); err != nil {
+			logger.LogError("Unable to delete empty block hosting volume %v: %v",
+				vol.Info.Id, err)
+		}
+	}
+}
+
+// startBlockHostingVolumeReaper deletes the empty block hosting volumes
+// every BlockHostingVolumeReaperInterval seconds until the app is closed
+func (a *App) startBlockHostingVolumeReaper() {
+	if !DeleteBlockHostingVolumes ||
+		BlockHostingVolumeReaperInterval <= 0 || a.dbReadOnly {
+		return
+	}
+
+	a.runPeriodically(BlockHostingVolumeReaperInterval, func() {
+		reapBlockHostingVolumes(a.db, a.executor, BlockHostingVolumeDeleteGrace)
+	})
+}
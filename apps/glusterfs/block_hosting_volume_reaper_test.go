@@ -0,0 +1,126 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/heketi/tests"
+)
+
+func TestReapBlockHostingVolumes(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	err := setupSampleDbWithTopology(app,
+		1,      // clusters
+		4,      // nodes_per_cluster
+		4,      // devices_per_node,
+		500*GB, // disksize)
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	bv := createSampleBlockVolumeEntry(100)
+	err = bv.Create(app.db, app.executor, app.Allocator())
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	hostingId := bv.Info.BlockHostingVolume
+
+	expired := func(now time.Time, grace int) []*VolumeEntry {
+		var volumes []*VolumeEntry
+		err := app.db.View(func(tx *bolt.Tx) error {
+			var err error
+			volumes, err = expiredBlockHostingVolumes(tx, now, grace)
+			return err
+		})
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		return volumes
+	}
+
+	// The hosting volume has a block volume
+	tests.Assert(t, len(expired(time.Now().Add(2*time.Hour), 3600)) == 0)
+	reapBlockHostingVolumes(app.db, app.executor, 0)
+
+	err = bv.Destroy(app.db, app.executor)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	err = app.db.View(func(tx *bolt.Tx) error {
+		vol, err := NewVolumeEntryFromId(tx, hostingId)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, vol.BlockEmptySince != 0)
+		return nil
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// Empty but still in the grace period
+	tests.Assert(t, len(expired(time.Now(), 3600)) == 0)
+	volumes := expired(time.Now().Add(2*time.Hour), 3600)
+	tests.Assert(t, len(volumes) == 1, volumes)
+	tests.Assert(t, volumes[0].Info.Id == hostingId)
+
+	reapBlockHostingVolumes(app.db, app.executor, 0)
+	err = app.db.View(func(tx *bolt.Tx) error {
+		_, err := NewVolumeEntryFromId(tx, hostingId)
+		tests.Assert(t, err == ErrNotFound, "expected ErrNotFound, got:", err)
+
+		bricks, err := BrickList(tx)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, len(bricks) == 0, bricks)
+		return nil
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+}
+
+func TestVolumeDeleteBlockHostingVolumeInUse(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	err := setupSampleDbWithTopology(app,
+		1,      // clusters
+		4,      // nodes_per_cluster
+		4,      // devices_per_node,
+		500*GB, // disksize)
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	bv := createSampleBlockVolumeEntry(100)
+	err = bv.Create(app.db, app.executor, app.Allocator())
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// A volume loaded before a block volume was placed on it
+	var vol *VolumeEntry
+	err = app.db.Update(func(tx *bolt.Tx) error {
+		var err error
+		vol, err = NewVolumeEntryFromId(tx, bv.Info.BlockHostingVolume)
+		if err != nil {
+			return err
+		}
+		stale := *vol
+		vol.BlockVolumeDelete(bv.Info.Id)
+		if err := vol.Save(tx); err != nil {
+			return err
+		}
+		vol = &stale
+		return nil
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// The block volume entry still uses the hosting volume
+	err = vol.Destroy(app.db, app.executor)
+	tests.Assert(t, err == ErrConflict, "expected ErrConflict, got:", err)
+}
@@ -14,4 +14,10 @@ var (
 	CreateBlockHostingVolumes = false
 	// Default 1 TB
 	BlockHostingVolumeSize = 1024
+
+	// Delete block hosting volumes once their last block volume is
+	// removed and they stayed empty for the grace period in seconds
+	DeleteBlockHostingVolumes        = false
+	BlockHostingVolumeDeleteGrace    = 3600
+	BlockHostingVolumeReaperInterval = 60
 )
@@ -0,0 +1,77 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"github.com/boltdb/bolt"
+	"github.com/heketi/heketi/executors"
+	wdb "github.com/heketi/heketi/pkg/db"
+)
+
+// RotateBlockVolumeAuth gives the block volume new CHAP credentials in
+// gluster-block and saves them
+func RotateBlockVolumeAuth(db wdb.DB,
+	executor executors.Executor,
+	id string) (*BlockVolumeEntry, error) {
+
+	var bv *BlockVolumeEntry
+	err := db.View(func(tx *bolt.Tx) error {
+		var err error
+		bv, err = NewBlockVolumeEntryFromId(tx, id)
+		if err != nil {
+			return err
+		}
+		if !bv.Info.Auth {
+			return ErrAuthDisabled
+		}
+		if p, err := PendingOperationsOnVolume(wdb.WrapTx(tx), id); err != nil {
+			return err
+		} else if p {
+			logger.LogError("Found operations still pending on block volume."+
+				" Can not rotate credentials of block volume %v at this time.",
+				id)
+			return ErrConflict
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	hvname, err := bv.blockHostingVolumeName(db)
+	if err != nil {
+		return nil, err
+	}
+	host, err := GetVerifiedManageHostname(db, executor, bv.Info.Cluster)
+	if err != nil {
+		return nil, err
+	}
+	info, err := executor.BlockVolumeAuthRotate(host, hvname, bv.Info.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		var err error
+		bv, err = NewBlockVolumeEntryFromId(tx, id)
+		if err != nil {
+			return err
+		}
+		bv.Info.BlockVolume.Username = info.Username
+		bv.Info.BlockVolume.Password = info.Password
+		return bv.Save(tx)
+	})
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("Rotated credentials of block volume %v", bv.Info.Name)
+
+	return bv, nil
+}
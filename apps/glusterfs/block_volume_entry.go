@@ -60,12 +60,26 @@ func NewBlockVolumeEntry() *BlockVolumeEntry {
 	return entry
 }
 
+// sizeMiB returns the size of the block volume in MiB. Block volumes
+// created with a size in GiB only record the size in GiB.
+func (v *BlockVolumeEntry) sizeMiB() int {
+	if v.Info.SizeMiB != 0 {
+		return v.Info.SizeMiB
+	}
+	return v.Info.Size * 1024
+}
+
 func NewBlockVolumeEntryFromRequest(req *api.BlockVolumeCreateRequest) *BlockVolumeEntry {
 	godbc.Require(req != nil)
 
 	vol := NewBlockVolumeEntry()
 	vol.Info.Id = utils.GenUUID()
 	vol.Info.Size = req.Size
+	if req.SizeMiB != 0 {
+		// The space of block hosting volumes is accounted in GiB
+		vol.Info.Size = api.SizeGiB(req.SizeMiB)
+		vol.Info.SizeMiB = req.SizeMiB
+	}
 	vol.Info.Auth = req.Auth
 
 	if req.Name == "" {
@@ -120,9 +134,12 @@ func (v *BlockVolumeEntry) NewInfoResponse(tx *bolt.Tx) (*api.BlockVolumeInfoRes
 	info.Cluster = v.Info.Cluster
 	info.BlockVolume = v.Info.BlockVolume
 	info.Size = v.Info.Size
+	info.SizeMiB = v.Info.SizeMiB
 	info.Name = v.Info.Name
 	info.Hacount = v.Info.Hacount
+	info.Tenant = v.Info.Tenant
 	info.BlockHostingVolume = v.Info.BlockHostingVolume
+	info.CloneOf = v.Info.CloneOf
 
 	return info, nil
 }
@@ -151,7 +168,7 @@ func (v *BlockVolumeEntry) eligibleClustersAndVolumes(db wdb.RODB) (
 	if len(v.Info.Clusters) == 0 {
 		err := db.View(func(tx *bolt.Tx) error {
 			var err error
-			possibleClusters, err = ClusterList(tx)
+			possibleClusters, err = ActiveClusterList(tx)
 			return err
 		})
 		if err != nil {
@@ -185,7 +202,8 @@ func (v *BlockVolumeEntry) eligibleClustersAndVolumes(db wdb.RODB) (
 				if err != nil {
 					return err
 				}
-				if volEntry.Info.Block {
+				// skip hosting volumes being created or deleted
+				if volEntry.Info.Block && volEntry.Visible() {
 					possibleVolumes = append(possibleVolumes, vol)
 				}
 			}
@@ -313,6 +331,44 @@ func (v *BlockVolumeEntry) deleteBlockVolumeExec(db wdb.RODB,
 	return nil
 }
 
+// reserveExpandSize takes the size the block volume grows by from the
+// free size of its block hosting volume. A negative size gives the
+// reserved size back.
+func (v *BlockVolumeEntry) reserveExpandSize(tx *bolt.Tx, sizeGB int) error {
+	volume, err := NewVolumeEntryFromId(tx, v.Info.BlockHostingVolume)
+	if err != nil {
+		return err
+	}
+	if sizeGB > 0 && volume.Info.BlockInfo.FreeSize < sizeGB {
+		logger.LogError("Block hosting volume %v has %v GiB free, "+
+			"block volume %v needs %v GiB more",
+			volume.Info.Id, volume.Info.BlockInfo.FreeSize, v.Info.Id, sizeGB)
+		return ErrNoSpace
+	}
+	volume.Info.BlockInfo.FreeSize -= sizeGB
+	return volume.Save(tx)
+}
+
+func (v *BlockVolumeEntry) expandBlockVolumeExec(db wdb.RODB,
+	hvname string,
+	executor executors.Executor,
+	sizeGB int) error {
+
+	executorhost, err := GetVerifiedManageHostname(db, executor, v.Info.Cluster)
+	if err != nil {
+		return err
+	}
+
+	logger.Debug("Using executor host [%v]", executorhost)
+
+	err = executor.BlockVolumeExpand(executorhost, hvname, v.Info.Name, sizeGB)
+	if err != nil {
+		logger.LogError("Unable to expand block volume: %v", err)
+		return err
+	}
+	return nil
+}
+
 func (v *BlockVolumeEntry) removeComponents(db wdb.DB) error {
 	return db.Update(func(tx *bolt.Tx) error {
 		// Remove volume from cluster
@@ -38,13 +38,45 @@ func (v *BlockVolumeEntry) createBlockVolume(db wdb.RODB,
 		return err
 	}
 
+	v.setBlockVolumeInfo(blockVolumeInfo)
+	return nil
+}
+
+// cloneBlockVolume creates the block volume with a copy of the data of
+// the source block volume, on the block hosting volume of the source
+func (v *BlockVolumeEntry) cloneBlockVolume(db wdb.RODB,
+	executor executors.Executor, source string) error {
+
+	godbc.Require(db != nil)
+	godbc.Require(v.Info.BlockHostingVolume != "")
+
+	vr, host, err := v.createBlockVolumeRequest(db, executor,
+		v.Info.BlockHostingVolume)
+	if err != nil {
+		return err
+	}
+
+	blockVolumeInfo, err := executor.BlockVolumeClone(host,
+		&executors.BlockVolumeCloneRequest{
+			BlockVolumeRequest: *vr,
+			Source:             source,
+		})
+	if err != nil {
+		return err
+	}
+
+	v.setBlockVolumeInfo(blockVolumeInfo)
+	return nil
+}
+
+// setBlockVolumeInfo sets the target of the block volume to the one
+// the executor created
+func (v *BlockVolumeEntry) setBlockVolumeInfo(blockVolumeInfo *executors.BlockVolumeInfo) {
 	v.Info.BlockVolume.Iqn = blockVolumeInfo.Iqn
 	v.Info.BlockVolume.Hosts = blockVolumeInfo.BlockHosts
 	v.Info.BlockVolume.Lun = 0
 	v.Info.BlockVolume.Username = blockVolumeInfo.Username
 	v.Info.BlockVolume.Password = blockVolumeInfo.Password
-
-	return nil
 }
 
 func (v *BlockVolumeEntry) createBlockVolumeRequest(db wdb.RODB,
@@ -106,6 +138,7 @@ func (v *BlockVolumeEntry) createBlockVolumeRequest(db wdb.RODB,
 	vr.GlusterVolumeName = blockHostingVolumeName
 	vr.Hacount = v.Info.Hacount
 	vr.Size = v.Info.Size
+	vr.SizeMiB = v.Info.SizeMiB
 	vr.Auth = v.Info.Auth
 
 	return vr, executorhost, nil
@@ -0,0 +1,201 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/boltdb/bolt"
+	"github.com/heketi/heketi/executors"
+	wdb "github.com/heketi/heketi/pkg/db"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+)
+
+// blockHostsError is returned when the portals requested for a block
+// volume can not be used
+type blockHostsError struct {
+	msg string
+}
+
+func (e *blockHostsError) Error() string {
+	return e.msg
+}
+
+func blockHostsInvalid(format string, args ...interface{}) error {
+	return &blockHostsError{msg: fmt.Sprintf(format, args...)}
+}
+
+// blockPortal is a node a block volume can be exported on
+type blockPortal struct {
+	storage string
+	manage  string
+}
+
+// blockPortalCandidates returns the online nodes of the cluster of the
+// block volume that can be its portals. The requested hosts must all
+// be usable, otherwise the current portals of the block volume come
+// first, followed by the hosts of the block hosting volume and then by
+// the other nodes of the cluster.
+func blockPortalCandidates(tx *bolt.Tx, bv *BlockVolumeEntry,
+	hosts []string) ([]blockPortal, error) {
+
+	cluster, err := NewClusterEntryFromId(tx, bv.Info.Cluster)
+	if err != nil {
+		return nil, err
+	}
+	nodes := []*NodeEntry{}
+	for _, id := range cluster.Info.Nodes {
+		node, err := NewNodeEntryFromId(tx, id)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+	findNode := func(host string) *NodeEntry {
+		for _, node := range nodes {
+			if node.IsStorageHost(host) {
+				return node
+			}
+		}
+		return nil
+	}
+
+	candidates := []blockPortal{}
+	if len(hosts) != 0 {
+		for _, host := range hosts {
+			node := findNode(host)
+			if node == nil {
+				return nil, blockHostsInvalid(
+					"Host %v is not a node of cluster %v",
+					host, bv.Info.Cluster)
+			}
+			if !node.isOnline() {
+				return nil, blockHostsInvalid("Node of host %v is not online",
+					host)
+			}
+			candidates = append(candidates,
+				blockPortal{storage: host, manage: node.ManageHostName()})
+		}
+		return candidates, nil
+	}
+
+	bhvol, err := NewVolumeEntryFromId(tx, bv.Info.BlockHostingVolume)
+	if err != nil {
+		return nil, err
+	}
+	ordered := []string{}
+	ordered = append(ordered, bv.Info.BlockVolume.Hosts...)
+	ordered = append(ordered, bhvol.Info.Mount.GlusterFS.Hosts...)
+	for _, node := range nodes {
+		ordered = append(ordered, node.StorageHostName())
+	}
+	seen := map[string]bool{}
+	for _, host := range ordered {
+		node := findNode(host)
+		if node == nil || seen[node.Info.Id] || !node.isOnline() {
+			continue
+		}
+		seen[node.Info.Id] = true
+		candidates = append(candidates,
+			blockPortal{storage: host, manage: node.ManageHostName()})
+	}
+	return candidates, nil
+}
+
+// UpdateBlockVolumeHaCount exports the block volume on hacount portals,
+// either the hosts of the request or the healthy nodes selected from
+// the cluster of the block volume, and saves them
+func UpdateBlockVolumeHaCount(db wdb.DB,
+	executor executors.Executor,
+	id string,
+	req *api.BlockVolumeHaCountRequest) (*BlockVolumeEntry, error) {
+
+	var bv *BlockVolumeEntry
+	var candidates []blockPortal
+	err := db.View(func(tx *bolt.Tx) error {
+		var err error
+		bv, err = NewBlockVolumeEntryFromId(tx, id)
+		if err != nil {
+			return err
+		}
+		if p, err := PendingOperationsOnVolume(wdb.WrapTx(tx), id); err != nil {
+			return err
+		} else if p {
+			logger.LogError("Found operations still pending on block volume."+
+				" Can not change hacount of block volume %v at this time.",
+				id)
+			return ErrConflict
+		}
+		candidates, err = blockPortalCandidates(tx, bv, req.Hosts)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Only nodes with glusterd running can be portals
+	hosts := []string{}
+	for _, c := range candidates {
+		if len(hosts) == req.Hacount {
+			break
+		}
+		if err := executor.GlusterdCheck(c.manage); err != nil {
+			if len(req.Hosts) != 0 {
+				return nil, blockHostsInvalid("Node of host %v is not healthy: %v",
+					c.storage, err)
+			}
+			logger.Warning("Skipping unhealthy node %v as portal of block volume %v",
+				c.manage, id)
+			continue
+		}
+		hosts = append(hosts, c.storage)
+	}
+	if len(hosts) < req.Hacount {
+		return nil, blockHostsInvalid(
+			"Only %v healthy nodes found for hacount %v of block volume %v",
+			len(hosts), req.Hacount, id)
+	}
+	if req.Hacount == bv.Info.Hacount &&
+		reflect.DeepEqual(hosts, bv.Info.BlockVolume.Hosts) {
+		return bv, nil
+	}
+
+	hvname, err := bv.blockHostingVolumeName(db)
+	if err != nil {
+		return nil, err
+	}
+	host, err := GetVerifiedManageHostname(db, executor, bv.Info.Cluster)
+	if err != nil {
+		return nil, err
+	}
+	err = executor.BlockVolumeModifyHa(host, hvname, bv.Info.Name,
+		req.Hacount, hosts)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		var err error
+		bv, err = NewBlockVolumeEntryFromId(tx, id)
+		if err != nil {
+			return err
+		}
+		bv.Info.Hacount = req.Hacount
+		bv.Info.BlockVolume.Hosts = hosts
+		return bv.Save(tx)
+	})
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("Block volume %v exported on %v", bv.Info.Name, hosts)
+
+	return bv, nil
+}
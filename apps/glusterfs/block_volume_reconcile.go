@@ -0,0 +1,334 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/boltdb/bolt"
+	"github.com/heketi/heketi/executors"
+	wdb "github.com/heketi/heketi/pkg/db"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/heketi/pkg/utils"
+)
+
+// blockReconcileState tracks the running reconcile and the result of
+// the last one
+type blockReconcileState struct {
+	lock    sync.Mutex
+	running bool
+	result  *api.BlockVolumeReconcileResponse
+}
+
+// start returns false if a reconcile is already running
+func (s *blockReconcileState) start() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.running {
+		return false
+	}
+	s.running = true
+	return true
+}
+
+// finish keeps the previous result if the reconcile failed
+func (s *blockReconcileState) finish(result *api.BlockVolumeReconcileResponse) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.running = false
+	if result != nil {
+		s.result = result
+	}
+}
+
+func (s *blockReconcileState) last() *api.BlockVolumeReconcileResponse {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.result
+}
+
+// ReconcileBlockVolumes compares the block volumes on every block hosting
+// volume with the block volumes heketi knows about. Block volumes that
+// only exist in gluster-block are reported as orphaned and block volumes
+// that only exist in heketi are reported as missing. Depending on the
+// action, orphaned block volumes are adopted into heketi or deleted, and
+// missing block volumes are removed from heketi.
+func ReconcileBlockVolumes(db wdb.DB,
+	executor executors.Executor,
+	action string) (*api.BlockVolumeReconcileResponse, error) {
+
+	var volumes []*VolumeEntry
+	err := db.View(func(tx *bolt.Tx) error {
+		ids, err := VolumeList(tx)
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			vol, err := NewVolumeEntryFromId(tx, id)
+			if err != nil {
+				return err
+			}
+			// Volumes being created or deleted are not reconciled
+			if vol.Info.Block && vol.Visible() {
+				volumes = append(volumes, vol)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &api.BlockVolumeReconcileResponse{
+		Volumes: []api.BlockHostingVolumeReconcile{},
+	}
+	for _, vol := range volumes {
+		r, err := reconcileBlockHostingVolume(db, executor, vol, action)
+		if err != nil {
+			return nil, err
+		}
+		resp.Volumes = append(resp.Volumes, *r)
+	}
+	return resp, nil
+}
+
+// blockVolumeListing holds the block volumes of a block hosting volume
+// as found by gluster-block and as known to heketi
+type blockVolumeListing struct {
+	blocks  []string
+	found   map[string]bool
+	known   map[string]*BlockVolumeEntry
+	pending map[string]bool
+}
+
+// orphaned returns true if the block volume only exists in gluster-block
+func (l *blockVolumeListing) orphaned(name string) bool {
+	_, ok := l.known[name]
+	return l.found[name] && !ok && !l.pending[name]
+}
+
+// missing returns true if the block volume only exists in heketi
+func (l *blockVolumeListing) missing(bv *BlockVolumeEntry) bool {
+	known, ok := l.known[bv.Info.Name]
+	return ok && known.Info.Id == bv.Info.Id && !l.found[bv.Info.Name]
+}
+
+func listBlockHostingVolume(db wdb.RODB,
+	executor executors.Executor,
+	host string,
+	vol *VolumeEntry) (*blockVolumeListing, error) {
+
+	// List the block volumes before reading the db so that block volumes
+	// created in the mean time show up as pending and are skipped
+	blocks, err := executor.BlockVolumeList(host, vol.Info.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &blockVolumeListing{
+		blocks:  blocks,
+		found:   map[string]bool{},
+		known:   map[string]*BlockVolumeEntry{},
+		pending: map[string]bool{},
+	}
+	for _, name := range blocks {
+		l.found[name] = true
+	}
+	err = db.View(func(tx *bolt.Tx) error {
+		// Block volumes being expanded or having their ha count
+		// changed are visible but used in a pending operation
+		inUse, err := mapPendingItems(tx,
+			func(op *PendingOperationEntry, a PendingOperationAction) bool {
+				return true
+			})
+		if err != nil {
+			return err
+		}
+
+		// Block volumes being created are only added to the block
+		// hosting volume once done, so look at every block volume
+		ids, err := BlockVolumeList(tx)
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			bv, err := NewBlockVolumeEntryFromId(tx, id)
+			if err != nil {
+				return err
+			}
+			if bv.Info.BlockHostingVolume != vol.Info.Id {
+				continue
+			}
+			if _, ok := inUse[bv.Info.Id]; ok || !bv.Visible() {
+				l.pending[bv.Info.Name] = true
+			} else {
+				l.known[bv.Info.Name] = bv
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func reconcileBlockHostingVolume(db wdb.DB,
+	executor executors.Executor,
+	vol *VolumeEntry,
+	action string) (*api.BlockHostingVolumeReconcile, error) {
+
+	r := &api.BlockHostingVolumeReconcile{
+		VolumeId: vol.Info.Id,
+		Orphaned: []string{},
+		Missing:  []string{},
+	}
+
+	host, err := GetVerifiedManageHostname(db, executor, vol.Info.Cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	l, err := listBlockHostingVolume(db, executor, host, vol)
+	if err != nil {
+		return nil, err
+	}
+
+	orphaned := []string{}
+	for _, name := range l.blocks {
+		if !l.orphaned(name) {
+			continue
+		}
+		logger.Warning("Block volume %v on volume %v is unknown to heketi",
+			name, vol.Info.Name)
+		r.Orphaned = append(r.Orphaned, name)
+		orphaned = append(orphaned, name)
+	}
+
+	missing := []*BlockVolumeEntry{}
+	for _, bv := range l.known {
+		if !l.missing(bv) {
+			continue
+		}
+		logger.Warning("Block volume %v not found on volume %v",
+			bv.Info.Id, vol.Info.Name)
+		r.Missing = append(r.Missing, bv.Info.Id)
+		missing = append(missing, bv)
+	}
+
+	if action != api.BlockReconcileAdopt && action != api.BlockReconcileCleanup {
+		return r, nil
+	}
+	if len(orphaned) == 0 && len(missing) == 0 {
+		return r, nil
+	}
+
+	// List again and only act on the block volumes that still do not
+	// match, so that block volumes created or deleted while listing
+	// are left alone
+	again, err := listBlockHostingVolume(db, executor, host, vol)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range orphaned {
+		if !again.orphaned(name) {
+			logger.Info("Block volume %v on volume %v changed, skipping",
+				name, vol.Info.Name)
+			continue
+		}
+
+		switch action {
+		case api.BlockReconcileAdopt:
+			id, err := adoptBlockVolume(db, executor, host, vol, name)
+			if err != nil {
+				r.Errors = append(r.Errors,
+					fmt.Sprintf("Unable to adopt block volume %v: %v", name, err))
+				continue
+			}
+			r.Adopted = append(r.Adopted, id)
+		case api.BlockReconcileCleanup:
+			err := executor.BlockVolumeDestroy(host, vol.Info.Name, name)
+			if err != nil {
+				r.Errors = append(r.Errors,
+					fmt.Sprintf("Unable to delete block volume %v: %v", name, err))
+				continue
+			}
+			r.Removed = append(r.Removed, name)
+		}
+	}
+
+	if action != api.BlockReconcileCleanup {
+		return r, nil
+	}
+	for _, bv := range missing {
+		if !again.missing(bv) {
+			logger.Info("Block volume %v on volume %v changed, skipping",
+				bv.Info.Id, vol.Info.Name)
+			continue
+		}
+		if err := bv.removeComponents(db); err != nil {
+			r.Errors = append(r.Errors,
+				fmt.Sprintf("Unable to remove block volume %v: %v", bv.Info.Id, err))
+			continue
+		}
+		r.Removed = append(r.Removed, bv.Info.Id)
+	}
+
+	return r, nil
+}
+
+// adoptBlockVolume creates a heketi entry for a block volume that only
+// exists in gluster-block and returns the id of the new entry. Block
+// volumes larger than the free size of the block hosting volume are not
+// adopted.
+func adoptBlockVolume(db wdb.DB,
+	executor executors.Executor,
+	host string,
+	vol *VolumeEntry,
+	name string) (string, error) {
+
+	info, err := executor.BlockVolumeInfo(host, vol.Info.Name, name)
+	if err != nil {
+		return "", err
+	}
+
+	bv := NewBlockVolumeEntry()
+	bv.Info.Id = utils.GenUUID()
+	bv.Info.Name = name
+	bv.Info.Size = info.Size
+	bv.Info.Hacount = info.Hacount
+	bv.Info.Auth = info.Password != ""
+	bv.Info.Cluster = vol.Info.Cluster
+	bv.Info.BlockHostingVolume = vol.Info.Id
+	bv.Info.BlockVolume.Hosts = info.BlockHosts
+	bv.Info.BlockVolume.Iqn = info.Iqn
+	bv.Info.BlockVolume.Username = info.Username
+	bv.Info.BlockVolume.Password = info.Password
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		vol, err := NewVolumeEntryFromId(tx, vol.Info.Id)
+		if err != nil {
+			return err
+		}
+		if vol.Info.BlockInfo.FreeSize < bv.Info.Size {
+			return fmt.Errorf("block hosting volume %v has %v GiB free, "+
+				"the block volume uses %v GiB",
+				vol.Info.Id, vol.Info.BlockInfo.FreeSize, bv.Info.Size)
+		}
+		return bv.saveCreateBlockVolume(wdb.WrapTx(tx))
+	})
+	if err != nil {
+		return "", err
+	}
+	logger.Info("Adopted block volume %v as %v", name, bv.Info.Id)
+	return bv.Info.Id, nil
+}
@@ -0,0 +1,347 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/gorilla/mux"
+	client "github.com/heketi/heketi/client/api/go-client"
+	"github.com/heketi/heketi/executors"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/tests"
+)
+
+// sampleBlockVolume creates a block volume, and the block hosting
+// volume it is placed on, in the app
+func sampleBlockVolume(t *testing.T, app *App) *BlockVolumeEntry {
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		3,    // nodes_per_cluster
+		1,    // devices_per_node,
+		2*TB, // disksize)
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	req := &api.BlockVolumeCreateRequest{}
+	req.Size = 10
+	bv := NewBlockVolumeEntryFromRequest(req)
+	err = RunOperation(
+		NewBlockVolumeCreateOperation(bv, app.db),
+		app.Allocator(),
+		app.executor)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	return bv
+}
+
+func TestReconcileBlockVolumesMatch(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	bv := sampleBlockVolume(t, app)
+	app.xo.MockBlockVolumeList = func(host, volume string) ([]string, error) {
+		return []string{bv.Info.Name}, nil
+	}
+
+	r, err := ReconcileBlockVolumes(app.db, app.executor, api.BlockReconcileReport)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(r.Volumes) == 1, r.Volumes)
+	tests.Assert(t, r.Volumes[0].VolumeId == bv.Info.BlockHostingVolume)
+	tests.Assert(t, len(r.Volumes[0].Orphaned) == 0, r.Volumes[0].Orphaned)
+	tests.Assert(t, len(r.Volumes[0].Missing) == 0, r.Volumes[0].Missing)
+}
+
+func TestReconcileBlockVolumesReport(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	bv := sampleBlockVolume(t, app)
+	app.xo.MockBlockVolumeList = func(host, volume string) ([]string, error) {
+		return []string{"orphan"}, nil
+	}
+	destroyed := 0
+	app.xo.MockBlockVolumeDestroy = func(host, volume, name string) error {
+		destroyed++
+		return nil
+	}
+
+	r, err := ReconcileBlockVolumes(app.db, app.executor, api.BlockReconcileReport)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(r.Volumes) == 1, r.Volumes)
+	v := r.Volumes[0]
+	tests.Assert(t, len(v.Orphaned) == 1 && v.Orphaned[0] == "orphan", v.Orphaned)
+	tests.Assert(t, len(v.Missing) == 1 && v.Missing[0] == bv.Info.Id, v.Missing)
+	tests.Assert(t, len(v.Adopted) == 0)
+	tests.Assert(t, len(v.Removed) == 0)
+
+	// Nothing is changed when only reporting
+	tests.Assert(t, destroyed == 0)
+	app.db.View(func(tx *bolt.Tx) error {
+		bvl, err := BlockVolumeList(tx)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, len(bvl) == 1, bvl)
+		return nil
+	})
+}
+
+func TestReconcileBlockVolumesCleanup(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	bv := sampleBlockVolume(t, app)
+	app.xo.MockBlockVolumeList = func(host, volume string) ([]string, error) {
+		return []string{"orphan"}, nil
+	}
+	destroyed := []string{}
+	app.xo.MockBlockVolumeDestroy = func(host, volume, name string) error {
+		destroyed = append(destroyed, name)
+		return nil
+	}
+
+	r, err := ReconcileBlockVolumes(app.db, app.executor, api.BlockReconcileCleanup)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	v := r.Volumes[0]
+	tests.Assert(t, len(v.Errors) == 0, v.Errors)
+	tests.Assert(t, len(v.Removed) == 2, v.Removed)
+	tests.Assert(t, len(destroyed) == 1 && destroyed[0] == "orphan", destroyed)
+
+	app.db.View(func(tx *bolt.Tx) error {
+		bvl, err := BlockVolumeList(tx)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, len(bvl) == 0, bvl)
+
+		vol, err := NewVolumeEntryFromId(tx, bv.Info.BlockHostingVolume)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, len(vol.Info.BlockInfo.BlockVolumes) == 0)
+		return nil
+	})
+}
+
+func TestReconcileBlockVolumesAdopt(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	bv := sampleBlockVolume(t, app)
+	app.xo.MockBlockVolumeList = func(host, volume string) ([]string, error) {
+		return []string{bv.Info.Name, "orphan"}, nil
+	}
+	app.xo.MockBlockVolumeInfo = func(host, volume, name string) (*executors.BlockVolumeInfo, error) {
+		return &executors.BlockVolumeInfo{
+			Name:              name,
+			GlusterVolumeName: volume,
+			Size:              5,
+			Hacount:           3,
+			BlockHosts:        []string{"a", "b", "c"},
+			Iqn:               "iqn.2016-12.org.gluster-block:1234",
+		}, nil
+	}
+
+	r, err := ReconcileBlockVolumes(app.db, app.executor, api.BlockReconcileAdopt)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	v := r.Volumes[0]
+	tests.Assert(t, len(v.Errors) == 0, v.Errors)
+	tests.Assert(t, len(v.Orphaned) == 1, v.Orphaned)
+	tests.Assert(t, len(v.Adopted) == 1, v.Adopted)
+
+	app.db.View(func(tx *bolt.Tx) error {
+		adopted, err := NewBlockVolumeEntryFromId(tx, v.Adopted[0])
+		tests.Assert(t, err == nil)
+		tests.Assert(t, adopted.Info.Name == "orphan")
+		tests.Assert(t, adopted.Info.Size == 5)
+		tests.Assert(t, adopted.Info.Hacount == 3)
+		tests.Assert(t, adopted.Info.BlockHostingVolume == bv.Info.BlockHostingVolume)
+		tests.Assert(t, adopted.Info.BlockVolume.Iqn == "iqn.2016-12.org.gluster-block:1234")
+
+		vol, err := NewVolumeEntryFromId(tx, bv.Info.BlockHostingVolume)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, len(vol.Info.BlockInfo.BlockVolumes) == 2)
+		return nil
+	})
+
+	// The adopted block volume is no longer orphaned
+	r, err = ReconcileBlockVolumes(app.db, app.executor, api.BlockReconcileReport)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(r.Volumes[0].Orphaned) == 0, r.Volumes[0].Orphaned)
+}
+
+func TestReconcileBlockVolumesSkipsPending(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	bv := sampleBlockVolume(t, app)
+
+	// Start creating a second block volume without finishing it
+	req := &api.BlockVolumeCreateRequest{}
+	req.Size = 10
+	pending := NewBlockVolumeEntryFromRequest(req)
+	bco := NewBlockVolumeCreateOperation(pending, app.db)
+	err := bco.Build(app.Allocator())
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	app.xo.MockBlockVolumeList = func(host, volume string) ([]string, error) {
+		return []string{bv.Info.Name, pending.Info.Name}, nil
+	}
+
+	r, err := ReconcileBlockVolumes(app.db, app.executor, api.BlockReconcileCleanup)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(r.Volumes[0].Orphaned) == 0, r.Volumes[0].Orphaned)
+	tests.Assert(t, len(r.Volumes[0].Missing) == 0, r.Volumes[0].Missing)
+}
+
+func TestReconcileBlockVolumesAdoptNoSpace(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	bv := sampleBlockVolume(t, app)
+	app.xo.MockBlockVolumeList = func(host, volume string) ([]string, error) {
+		return []string{bv.Info.Name, "orphan"}, nil
+	}
+	app.xo.MockBlockVolumeInfo = func(host, volume, name string) (*executors.BlockVolumeInfo, error) {
+		return &executors.BlockVolumeInfo{
+			Name:              name,
+			GlusterVolumeName: volume,
+			Size:              100000,
+			Hacount:           3,
+		}, nil
+	}
+
+	// The orphan does not fit in the block hosting volume so it is
+	// only reported
+	r, err := ReconcileBlockVolumes(app.db, app.executor, api.BlockReconcileAdopt)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	v := r.Volumes[0]
+	tests.Assert(t, len(v.Orphaned) == 1, v.Orphaned)
+	tests.Assert(t, len(v.Adopted) == 0, v.Adopted)
+	tests.Assert(t, len(v.Errors) == 1, v.Errors)
+
+	app.db.View(func(tx *bolt.Tx) error {
+		bvl, err := BlockVolumeList(tx)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, len(bvl) == 1, bvl)
+
+		vol, err := NewVolumeEntryFromId(tx, bv.Info.BlockHostingVolume)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, vol.Info.BlockInfo.FreeSize >= 0, vol.Info.BlockInfo)
+		return nil
+	})
+}
+
+func TestReconcileBlockVolumesSkipsInUse(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	bv := sampleBlockVolume(t, app)
+
+	// Start expanding the block volume without finishing it
+	bve := NewBlockVolumeExpandOperation(bv, app.db, 20)
+	err := bve.Build(app.Allocator())
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	app.xo.MockBlockVolumeList = func(host, volume string) ([]string, error) {
+		return []string{}, nil
+	}
+
+	r, err := ReconcileBlockVolumes(app.db, app.executor, api.BlockReconcileCleanup)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(r.Volumes[0].Missing) == 0, r.Volumes[0].Missing)
+	tests.Assert(t, len(r.Volumes[0].Removed) == 0, r.Volumes[0].Removed)
+}
+
+func TestReconcileBlockVolumesRelists(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	bv := sampleBlockVolume(t, app)
+
+	// The block volume shows up and the orphan goes away between the
+	// two listings
+	listed := 0
+	app.xo.MockBlockVolumeList = func(host, volume string) ([]string, error) {
+		listed++
+		if listed == 1 {
+			return []string{"orphan"}, nil
+		}
+		return []string{bv.Info.Name}, nil
+	}
+	destroyed := []string{}
+	app.xo.MockBlockVolumeDestroy = func(host, volume, name string) error {
+		destroyed = append(destroyed, name)
+		return nil
+	}
+
+	r, err := ReconcileBlockVolumes(app.db, app.executor, api.BlockReconcileCleanup)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	v := r.Volumes[0]
+	tests.Assert(t, len(v.Orphaned) == 1, v.Orphaned)
+	tests.Assert(t, len(v.Missing) == 1, v.Missing)
+	tests.Assert(t, len(v.Removed) == 0, v.Removed)
+	tests.Assert(t, len(destroyed) == 0, destroyed)
+	tests.Assert(t, listed == 2, listed)
+
+	app.db.View(func(tx *bolt.Tx) error {
+		_, err := NewBlockVolumeEntryFromId(tx, bv.Info.Id)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		return nil
+	})
+}
+
+func TestReconcileBlockVolumesAsync(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	c := client.NewClientNoAuth(ts.URL)
+	tests.Assert(t, c != nil)
+
+	bv := sampleBlockVolume(t, app)
+	app.xo.MockBlockVolumeList = func(host, volume string) ([]string, error) {
+		return []string{bv.Info.Name, "orphan"}, nil
+	}
+
+	r, err := c.BlockVolumeReconcile(&api.BlockVolumeReconcileRequest{})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(r.Volumes) == 1, r.Volumes)
+	tests.Assert(t, len(r.Volumes[0].Orphaned) == 1, r.Volumes[0].Orphaned)
+	tests.Assert(t, r.Volumes[0].Orphaned[0] == "orphan", r.Volumes[0].Orphaned)
+}
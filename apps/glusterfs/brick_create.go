@@ -22,7 +22,7 @@ const (
 	CREATOR_DESTROY
 )
 
-func createDestroyConcurrently(db wdb.RODB,
+func createDestroyConcurrently(db wdb.DB,
 	executor executors.Executor,
 	brick_entries []*BrickEntry,
 	create_type CreateType) error {
@@ -32,14 +32,15 @@ func createDestroyConcurrently(db wdb.RODB,
 	// Create a goroutine for each brick
 	for _, brick := range brick_entries {
 		sg.Add(1)
-		go func(b *BrickEntry) {
+		b := brick
+		go func() {
 			defer sg.Done()
 			if create_type == CREATOR_CREATE {
 				sg.Err(b.Create(db, executor))
 			} else {
 				sg.Err(b.Destroy(db, executor))
 			}
-		}(brick)
+		}()
 	}
 
 	// Wait here until all goroutines have returned.  If
@@ -56,10 +57,10 @@ func createDestroyConcurrently(db wdb.RODB,
 	return err
 }
 
-func CreateBricks(db wdb.RODB, executor executors.Executor, brick_entries []*BrickEntry) error {
+func CreateBricks(db wdb.DB, executor executors.Executor, brick_entries []*BrickEntry) error {
 	return createDestroyConcurrently(db, executor, brick_entries, CREATOR_CREATE)
 }
 
-func DestroyBricks(db wdb.RODB, executor executors.Executor, brick_entries []*BrickEntry) error {
+func DestroyBricks(db wdb.DB, executor executors.Executor, brick_entries []*BrickEntry) error {
 	return createDestroyConcurrently(db, executor, brick_entries, CREATOR_DESTROY)
 }
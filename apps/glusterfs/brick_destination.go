@@ -0,0 +1,205 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/boltdb/bolt"
+	wdb "github.com/heketi/heketi/pkg/db"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+)
+
+// destinationAllocator proposes the online devices of the destination
+// requested for the new bricks replacing bricks, such as newly added
+// hardware, instead of the devices of the ring
+type destinationAllocator struct {
+	dest    *api.BrickDestination
+	devices []*DeviceEntry
+}
+
+func (d *destinationAllocator) GetNodes(db wdb.RODB, clusterId,
+	brickId string) (<-chan string, chan<- struct{}, <-chan error) {
+
+	device, done := make(chan string), make(chan struct{})
+	errc := make(chan error, 1)
+
+	go func() {
+		defer func() {
+			errc <- nil
+			close(device)
+		}()
+
+		for _, d := range d.devices {
+			select {
+			case device <- d.Info.Id:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return device, done, errc
+}
+
+func (d *destinationAllocator) String() string {
+	if d.dest.Device != "" {
+		return "device " + d.dest.Device
+	}
+	return "node " + d.dest.Node
+}
+
+// newDestinationAllocator loads the online devices of the destination,
+// which must be in the cluster
+func newDestinationAllocator(tx *bolt.Tx,
+	dest *api.BrickDestination,
+	clusterId string) (*destinationAllocator, error) {
+
+	d := &destinationAllocator{dest: dest}
+
+	nodeId := dest.Node
+	if dest.Device != "" {
+		device, err := NewDeviceEntryFromId(tx, dest.Device)
+		if err == ErrNotFound {
+			return nil, fmt.Errorf("Destination device %v not found", dest.Device)
+		} else if err != nil {
+			return nil, err
+		}
+		if !device.isOnline() {
+			return nil, fmt.Errorf("Destination device %v is not online", dest.Device)
+		}
+		d.devices = append(d.devices, device)
+		nodeId = device.NodeId
+	}
+
+	node, err := NewNodeEntryFromId(tx, nodeId)
+	if err == ErrNotFound {
+		return nil, fmt.Errorf("Destination node %v not found", nodeId)
+	} else if err != nil {
+		return nil, err
+	}
+	if node.Info.ClusterId != clusterId {
+		return nil, fmt.Errorf("Destination %v is not in cluster %v", d, clusterId)
+	}
+	if !node.isOnline() {
+		return nil, fmt.Errorf("Destination node %v is not online", nodeId)
+	}
+
+	if dest.Device == "" {
+		for _, deviceId := range node.Devices {
+			device, err := NewDeviceEntryFromId(tx, deviceId)
+			if err != nil {
+				return nil, err
+			}
+			if device.isOnline() {
+				d.devices = append(d.devices, device)
+			}
+		}
+		if len(d.devices) == 0 {
+			return nil, fmt.Errorf("Destination node %v has no online device", nodeId)
+		}
+	}
+	return d, nil
+}
+
+// checkBricks checks that each brick can be replaced on the destination,
+// on a device other than its own and on a node holding no brick of its
+// set, and that the destination has room for all the bricks
+func (d *destinationAllocator) checkBricks(tx *bolt.Tx, brickIds []string) error {
+	var needed, available uint64
+	for _, device := range d.devices {
+		available += device.StorageAvailable()
+	}
+
+	for _, brickId := range brickIds {
+		brick, err := NewBrickEntryFromId(tx, brickId)
+		if err != nil {
+			return err
+		}
+		if brick.Info.Path == "" {
+			continue
+		}
+		needed += brick.TotalSize()
+
+		// The set is only known to the db for the volumes with
+		// a recorded brick order
+		setNodes := map[string]bool{brick.Info.NodeId: true}
+		v, err := NewVolumeEntryFromId(tx, brick.Info.VolumeId)
+		if err != nil {
+			return err
+		}
+		if order := v.brickOrder(); order != nil {
+			for _, id := range brickSetOf(order, v.Durability.BricksInSet(), brickId) {
+				b, err := NewBrickEntryFromId(tx, id)
+				if err != nil {
+					return err
+				}
+				setNodes[b.Info.NodeId] = true
+			}
+		}
+
+		ok := false
+		for _, device := range d.devices {
+			if device.Info.Id != brick.Info.DeviceId && !setNodes[device.NodeId] {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return fmt.Errorf("Destination %v is on a node holding a brick "+
+				"of the set of brick %v", d, brickId)
+		}
+	}
+
+	if needed > available {
+		return fmt.Errorf("Destination %v has %v KiB available, the bricks need %v KiB",
+			d, available, needed)
+	}
+	return nil
+}
+
+// replaceAllocator returns the allocator placing the new bricks replacing
+// the bricks of the cluster: the devices of the destination set in the
+// query of the request, if any, or the allocator of the app. It returns
+// nil once an error has been sent to the client.
+func (a *App) replaceAllocator(w http.ResponseWriter, r *http.Request,
+	clusterId string, brickIds []string) Allocator {
+
+	query := r.URL.Query()
+	dest := &api.BrickDestination{
+		Device: query.Get("destination_device"),
+		Node:   query.Get("destination_node"),
+	}
+	if dest.Device == "" && dest.Node == "" {
+		return a.requestAllocator(r)
+	}
+	if err := dest.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil
+	}
+
+	var allocator *destinationAllocator
+	err := a.db.View(func(tx *bolt.Tx) error {
+		var err error
+		allocator, err = newDestinationAllocator(tx, dest, clusterId)
+		if err != nil {
+			return err
+		}
+		return allocator.checkBricks(tx, brickIds)
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		requestLogger(r).LogError("Invalid brick destination: %v", err)
+		return nil
+	}
+	requestLogger(r).Info("Replacing bricks on %v", allocator)
+	return allocatorWithRequestId(allocator, requestId(r))
+}
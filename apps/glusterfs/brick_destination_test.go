@@ -0,0 +1,160 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/gorilla/mux"
+	client "github.com/heketi/heketi/client/api/go-client"
+	"github.com/heketi/heketi/executors"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/tests"
+)
+
+func TestBrickReplaceDestination(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	c := client.NewClientNoAuth(ts.URL)
+	tests.Assert(t, c != nil)
+
+	err := setupSampleDbWithTopology(app,
+		1,      // clusters
+		4,      // nodes_per_cluster
+		1,      // devices_per_node,
+		500*GB, // disksize
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	req := &api.VolumeCreateRequest{}
+	req.Size = 100
+	req.Durability.Type = api.DurabilityReplicate
+	req.Durability.Replicate.Replica = 3
+	vol, err := c.VolumeCreate(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(vol.Bricks) == 3, vol.Bricks)
+
+	app.xo.MockVolumeInfo = func(host string, volume string) (*executors.Volume, error) {
+		return mockVolumeInfoFromDb(app.db, volume)
+	}
+	app.xo.MockHealInfo = func(host string, volume string) (*executors.HealInfo, error) {
+		return mockHealStatusFromDb(app.db, volume)
+	}
+
+	// The device of the node without a brick of the volume
+	freeDevice := func() string {
+		info, err := c.VolumeInfo(vol.Id)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		used := map[string]bool{}
+		for _, b := range info.Bricks {
+			used[b.NodeId] = true
+		}
+		var id string
+		app.db.View(func(tx *bolt.Tx) error {
+			devices, err := DeviceList(tx)
+			tests.Assert(t, err == nil)
+			for _, deviceId := range devices {
+				d, err := NewDeviceEntryFromId(tx, deviceId)
+				tests.Assert(t, err == nil)
+				if !used[d.NodeId] {
+					id = deviceId
+				}
+			}
+			return nil
+		})
+		return id
+	}
+
+	brick := vol.Bricks[0]
+	dest := freeDevice()
+	info, err := c.BrickReplaceTo(brick.Id, &api.BrickDestination{Device: dest})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	found := false
+	for _, b := range info.Bricks {
+		tests.Assert(t, b.Id != brick.Id, b)
+		found = found || b.DeviceId == dest
+	}
+	tests.Assert(t, found, info.Bricks)
+
+	// Nodes holding a brick of the set are refused
+	brick = info.Bricks[0]
+	other := info.Bricks[1]
+	for _, d := range []*api.BrickDestination{
+		{Device: brick.DeviceId},
+		{Device: other.DeviceId},
+		{Node: other.NodeId},
+		{Device: "12345678901234567890123456789012"},
+		{Device: freeDevice(), Node: other.NodeId},
+	} {
+		_, err = c.BrickReplaceTo(brick.Id, d)
+		tests.Assert(t, err != nil, "expected err != nil", d)
+	}
+
+	// Offline destinations are refused
+	dest = freeDevice()
+	app.db.Update(func(tx *bolt.Tx) error {
+		d, err := NewDeviceEntryFromId(tx, dest)
+		tests.Assert(t, err == nil)
+		d.State = api.EntryStateOffline
+		return d.Save(tx)
+	})
+	_, err = c.BrickReplaceTo(brick.Id, &api.BrickDestination{Device: dest})
+	tests.Assert(t, err != nil, "expected err != nil")
+	app.db.Update(func(tx *bolt.Tx) error {
+		d, err := NewDeviceEntryFromId(tx, dest)
+		tests.Assert(t, err == nil)
+		d.State = api.EntryStateOnline
+		return d.Save(tx)
+	})
+
+	// The bricks of a device are moved to the node
+	var node string
+	app.db.View(func(tx *bolt.Tx) error {
+		d, err := NewDeviceEntryFromId(tx, dest)
+		tests.Assert(t, err == nil)
+		node = d.NodeId
+		return nil
+	})
+	_, err = c.DeviceReplaceBricksTo(brick.DeviceId, &api.BrickDestination{Node: node})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	info, err = c.VolumeInfo(vol.Id)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	found = false
+	for _, b := range info.Bricks {
+		tests.Assert(t, b.DeviceId != brick.DeviceId, b)
+		found = found || b.NodeId == node
+	}
+	tests.Assert(t, found, info.Bricks)
+
+	// So are the bricks of a removed device
+	brick = info.Bricks[0]
+	dest = freeDevice()
+	err = c.DeviceRemoveTo(brick.DeviceId, &api.BrickDestination{Device: dest})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	info, err = c.VolumeInfo(vol.Id)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	found = false
+	for _, b := range info.Bricks {
+		found = found || b.DeviceId == dest
+	}
+	tests.Assert(t, found, info.Bricks)
+}
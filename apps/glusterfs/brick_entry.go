@@ -16,6 +16,7 @@ import (
 	"github.com/boltdb/bolt"
 	"github.com/heketi/heketi/executors"
 	wdb "github.com/heketi/heketi/pkg/db"
+	"github.com/heketi/heketi/pkg/faults"
 	"github.com/heketi/heketi/pkg/glusterfs/api"
 	"github.com/heketi/heketi/pkg/utils"
 	"github.com/lpabon/godbc"
@@ -66,6 +67,29 @@ func NewBrickEntry(size, tpsize, poolMetadataSize uint64,
 	return entry
 }
 
+// NewClonedBrickEntry returns the entry of a brick of a volume cloned
+// from a snapshot of the volume of the origin brick. Gluster creates the
+// brick as a thin LV in the thin pool of the origin brick, so the brick
+// has no thin pool of its own and consumes no space of the device beyond
+// the space reserved for the origin brick. The path of the brick is only
+// known once gluster has created it.
+func NewClonedBrickEntry(origin *BrickEntry, gid int64, volumeid string) *BrickEntry {
+	godbc.Require(origin != nil)
+
+	entry := &BrickEntry{}
+	entry.gidRequested = gid
+	entry.Info.Id = utils.GenUUID()
+	entry.Info.Size = origin.Info.Size
+	entry.Info.NodeId = origin.Info.NodeId
+	entry.Info.DeviceId = origin.Info.DeviceId
+	entry.Info.VolumeId = volumeid
+
+	godbc.Ensure(entry.Info.Id != "")
+	godbc.Ensure(entry.cloned())
+
+	return entry
+}
+
 func NewBrickEntryFromId(tx *bolt.Tx, id string) (*BrickEntry, error) {
 	godbc.Require(tx != nil)
 
@@ -95,6 +119,9 @@ func (b *BrickEntry) Save(tx *bolt.Tx) error {
 	godbc.Require(tx != nil)
 	godbc.Require(len(b.Info.Id) > 0)
 
+	if err := faults.Check(FaultBrickSave); err != nil {
+		return err
+	}
 	return EntrySave(tx, b, b.Info.Id)
 }
 
@@ -106,9 +133,34 @@ func (b *BrickEntry) NewInfoResponse(tx *bolt.Tx) (*api.BrickInfo, error) {
 	info := &api.BrickInfo{}
 	*info = b.Info
 
+	device, err := NewDeviceEntryFromId(tx, b.Info.DeviceId)
+	if err != nil && err != ErrNotFound {
+		return nil, err
+	}
+	info.Lvm = b.lvmInfo()
+	if device != nil {
+		info.Lvm.Device = device.Info.Name
+	}
+
 	return info, nil
 }
 
+// lvmInfo returns the names of the volume group, thin pool and logical
+// volume of the brick. They are left out when named by gluster.
+func (b *BrickEntry) lvmInfo() *api.BrickLvmInfo {
+	lvm := &api.BrickLvmInfo{
+		Vg: utils.VgIdToName(b.Info.DeviceId),
+	}
+	if !b.cloned() {
+		lvm.ThinPool = utils.BrickIdToThinPoolName(b.Info.Id)
+		if !b.restored() {
+			lvm.Lv = utils.BrickIdToName(b.Info.Id)
+			lvm.LvDevice = utils.BrickDevNode(b.Info.DeviceId, b.Info.Id)
+		}
+	}
+	return lvm
+}
+
 func (b *BrickEntry) Marshal() ([]byte, error) {
 	var buffer bytes.Buffer
 	enc := gob.NewEncoder(&buffer)
@@ -134,7 +186,13 @@ func (b *BrickEntry) Create(db wdb.RODB, executor executors.Executor) error {
 	godbc.Require(b.Info.Path != "")
 
 	// Get node hostname
-	var host string
+	var (
+		host           string
+		uid            int64
+		permissions    string
+		selinuxContext string
+		selinux        api.ClusterSelinux
+	)
 	err := db.View(func(tx *bolt.Tx) error {
 		node, err := NewNodeEntryFromId(tx, b.Info.NodeId)
 		if err != nil {
@@ -143,6 +201,30 @@ func (b *BrickEntry) Create(db wdb.RODB, executor executors.Executor) error {
 
 		host = node.ManageHostName()
 		godbc.Check(host != "")
+
+		if node.Info.ClusterId != "" {
+			cluster, err := NewClusterEntryFromId(tx, node.Info.ClusterId)
+			if err != nil && err != ErrNotFound {
+				return err
+			} else if err == nil {
+				selinux = cluster.Info.Selinux
+			}
+		}
+
+		// The ownership and permissions of the brick root
+		// are part of the volume the brick belongs to
+		if b.Info.VolumeId == "" {
+			return nil
+		}
+		volume, err := NewVolumeEntryFromId(tx, b.Info.VolumeId)
+		if err == ErrNotFound {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		uid = volume.Info.Uid
+		permissions = volume.Info.Permissions
+		selinuxContext = volume.Info.SelinuxContext
 		return nil
 	})
 	if err != nil {
@@ -152,6 +234,18 @@ func (b *BrickEntry) Create(db wdb.RODB, executor executors.Executor) error {
 	// Create request
 	req := &executors.BrickRequest{}
 	req.Gid = b.gidRequested
+	req.Uid = uid
+	req.Permissions = permissions
+	req.SelinuxContext = selinuxContext
+	if selinux.Check {
+		req.SelinuxCheck = true
+		if req.SelinuxContext == "" {
+			req.SelinuxContext = SelinuxBrickContext
+		}
+	}
+	if selinux.Booleans {
+		req.SelinuxBooleans = SelinuxBooleans
+	}
 	req.Name = b.Info.Id
 	req.Size = b.Info.Size
 	req.TpSize = b.TpSize
@@ -170,12 +264,17 @@ func (b *BrickEntry) Create(db wdb.RODB, executor executors.Executor) error {
 	return nil
 }
 
-func (b *BrickEntry) Destroy(db wdb.RODB, executor executors.Executor) error {
+func (b *BrickEntry) Destroy(db wdb.DB, executor executors.Executor) error {
 
 	godbc.Require(db != nil)
-	godbc.Require(b.TpSize > 0)
+	godbc.Require(b.TpSize > 0 || b.cloned())
 	godbc.Require(b.Info.Size > 0)
 
+	if b.cloned() && b.Info.Path == "" {
+		// gluster never created the brick
+		return nil
+	}
+
 	// Get node hostname
 	var host string
 	err := db.View(func(tx *bolt.Tx) error {
@@ -198,10 +297,18 @@ func (b *BrickEntry) Destroy(db wdb.RODB, executor executors.Executor) error {
 	req.Size = b.Info.Size
 	req.TpSize = b.TpSize
 	req.VgId = b.Info.DeviceId
+	if b.cloned() || b.restored() {
+		// the path locates the LV gluster created for the brick
+		req.Path = b.Info.Path
+	}
 
 	// Delete brick on node
 	logger.Info("Deleting brick %v", b.Info.Id)
-	err = executor.BrickDestroy(host, req)
+	intent := NewIntentEntry(IntentBrickDestroy, host)
+	intent.Brick = *req
+	err = withIntent(db, intent, func() error {
+		return executor.BrickDestroy(host, req)
+	})
 	if err != nil {
 		return err
 	}
@@ -211,9 +318,14 @@ func (b *BrickEntry) Destroy(db wdb.RODB, executor executors.Executor) error {
 
 func (b *BrickEntry) DestroyCheck(db wdb.RODB, executor executors.Executor) error {
 	godbc.Require(db != nil)
-	godbc.Require(b.TpSize > 0)
+	godbc.Require(b.TpSize > 0 || b.cloned())
 	godbc.Require(b.Info.Size > 0)
 
+	if b.cloned() {
+		// no thin pool of its own that others could be using
+		return nil
+	}
+
 	// Get node hostname
 	var host string
 	err := db.View(func(tx *bolt.Tx) error {
@@ -246,6 +358,19 @@ func (b *BrickEntry) TotalSize() uint64 {
 	return b.TpSize + b.PoolMetadataSize
 }
 
+// cloned returns true if the brick was created by gluster when cloning
+// a snapshot, in the thin pool of a brick of another volume
+func (b *BrickEntry) cloned() bool {
+	return b.TpSize == 0
+}
+
+// restored returns true if the brick was replaced by the brick of a
+// snapshot the volume was restored from, in the thin pool of the brick
+func (b *BrickEntry) restored() bool {
+	return !b.cloned() && b.Info.Path != "" &&
+		b.Info.Path != utils.BrickPath(b.Info.DeviceId, b.Info.Id)
+}
+
 func BrickEntryUpgrade(tx *bolt.Tx) error {
 	err := addVolumeIdInBrickEntry(tx)
 	if err != nil {
@@ -182,7 +182,19 @@ func TestNewBrickEntryNewInfoResponse(t *testing.T) {
 		return err
 	})
 	tests.Assert(t, err == nil)
+
+	// The LVM objects are only in the response
+	lvm := info.Lvm
+	tests.Assert(t, lvm != nil)
+	info.Lvm = nil
 	tests.Assert(t, reflect.DeepEqual(*info, b.Info))
+
+	// The device of the brick is not in the db
+	tests.Assert(t, lvm.Device == "", lvm)
+	tests.Assert(t, lvm.Vg == "vg_abc", lvm)
+	tests.Assert(t, lvm.ThinPool == "tp_"+b.Id(), lvm)
+	tests.Assert(t, lvm.Lv == "brick_"+b.Id(), lvm)
+	tests.Assert(t, lvm.LvDevice == "/dev/mapper/vg_abc-brick_"+b.Id(), lvm)
 }
 
 func TestBrickEntryDestroyCheck(t *testing.T) {
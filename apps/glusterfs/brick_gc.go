@@ -0,0 +1,259 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/boltdb/bolt"
+	"github.com/heketi/heketi/executors"
+	wdb "github.com/heketi/heketi/pkg/db"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/heketi/pkg/utils"
+)
+
+var (
+	// Seconds between the scans of the devices for orphaned bricks.
+	// Zero disables the periodic scans.
+	BrickGcInterval = 0
+
+	// Delete the orphaned bricks found by the periodic scans instead
+	// of only reporting them
+	BrickGcCleanup = false
+)
+
+// GcBricks compares the logical volumes on every device of the online
+// nodes with the bricks heketi knows about. Logical volumes no brick
+// uses, such as the bricks left behind by a create that failed halfway,
+// are reported as orphaned and bricks whose logical volumes were not
+// found are reported as missing. With the cleanup action the orphaned
+// bricks are deleted. Missing bricks are only reported.
+func GcBricks(db wdb.DB,
+	executor executors.Executor,
+	action string) (*api.BrickGcResponse, error) {
+
+	hosts := map[string]string{}
+	err := db.View(func(tx *bolt.Tx) error {
+		ids, err := DeviceList(tx)
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			device, err := NewDeviceEntryFromId(tx, id)
+			if err != nil {
+				return err
+			}
+			if device.State == api.EntryStateFailed {
+				continue
+			}
+			node, err := NewNodeEntryFromId(tx, device.NodeId)
+			if err != nil {
+				return err
+			}
+			if node.isOnline() {
+				hosts[id] = node.ManageHostName()
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ids := []string{}
+	for id := range hosts {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	resp := &api.BrickGcResponse{
+		Devices: []api.DeviceBrickGc{},
+	}
+	for _, id := range ids {
+		r, err := gcDeviceBricks(db, executor, id, hosts[id], action)
+		if err != nil {
+			return nil, err
+		}
+		resp.Devices = append(resp.Devices, *r)
+	}
+	return resp, nil
+}
+
+// deviceBricks returns the bricks of the device by id
+func deviceBricks(db wdb.RODB, id string) (map[string]*BrickEntry, error) {
+	bricks := map[string]*BrickEntry{}
+	err := db.View(func(tx *bolt.Tx) error {
+		device, err := NewDeviceEntryFromId(tx, id)
+		if err != nil {
+			return err
+		}
+		for _, brickId := range device.Bricks {
+			brick, err := NewBrickEntryFromId(tx, brickId)
+			if err != nil {
+				return err
+			}
+			bricks[brickId] = brick
+		}
+		return nil
+	})
+	return bricks, err
+}
+
+// orphanedBrickId returns the id of the brick a logical volume named
+// by heketi was created for
+func orphanedBrickId(lv string) (string, bool) {
+	for _, prefix := range []string{
+		utils.BrickIdToName(""),
+		utils.BrickIdToThinPoolName(""),
+	} {
+		if !strings.HasPrefix(lv, prefix) {
+			continue
+		}
+		id := strings.TrimPrefix(lv, prefix)
+		return id, api.ValidateUUID(id) == nil
+	}
+	return "", false
+}
+
+func gcDeviceBricks(db wdb.DB,
+	executor executors.Executor,
+	id string,
+	host string,
+	action string) (*api.DeviceBrickGc, error) {
+
+	r := &api.DeviceBrickGc{
+		DeviceId: id,
+		Orphaned: []string{},
+		Missing:  []string{},
+	}
+
+	// Read the bricks of the device before and after listing the logical
+	// volumes so that the bricks created or deleted in the mean time are
+	// neither orphaned nor missing
+	before, err := deviceBricks(db, id)
+	if err != nil {
+		return nil, err
+	}
+	lvs, err := executor.GetDeviceLvs(host, id)
+	if err != nil {
+		r.Errors = append(r.Errors,
+			fmt.Sprintf("Unable to list logical volumes: %v", err))
+		return r, nil
+	}
+	after, err := deviceBricks(db, id)
+	if err != nil {
+		return nil, err
+	}
+
+	known := NewDeviceEntry()
+	for brickId := range before {
+		known.BrickAdd(brickId)
+	}
+	for brickId := range after {
+		if _, ok := before[brickId]; !ok {
+			known.BrickAdd(brickId)
+		}
+	}
+	r.Orphaned = known.orphanedLvs(lvs)
+	for _, lv := range r.Orphaned {
+		logger.Warning("Logical volume %v of device %v is not used by any brick",
+			lv, id)
+	}
+
+	found := map[string]bool{}
+	for _, lv := range lvs {
+		found[lv.Name] = true
+	}
+	for brickId, brick := range after {
+		if _, ok := before[brickId]; !ok || brick.Pending.Id != "" {
+			continue
+		}
+		// Bricks of clones have no thin pool created by heketi
+		if brick.TpSize == 0 {
+			continue
+		}
+		if found[utils.BrickIdToThinPoolName(brickId)] {
+			continue
+		}
+		logger.Warning("Brick %v not found on device %v", brickId, id)
+		r.Missing = append(r.Missing, brickId)
+	}
+	sort.Strings(r.Missing)
+
+	if action != api.BrickGcCleanup {
+		return r, nil
+	}
+
+	// Only the logical volumes named by heketi are deleted, together
+	// with the other logical volume of the same brick
+	removable := map[string][]string{}
+	brickIds := []string{}
+	for _, lv := range r.Orphaned {
+		brickId, ok := orphanedBrickId(lv)
+		if !ok {
+			continue
+		}
+		if _, ok := removable[brickId]; !ok {
+			brickIds = append(brickIds, brickId)
+		}
+		removable[brickId] = append(removable[brickId], lv)
+	}
+	for _, brickId := range brickIds {
+		req := &executors.BrickRequest{
+			VgId: id,
+			Name: brickId,
+		}
+		if err := executor.BrickDestroyCheck(host, req); err != nil {
+			r.Errors = append(r.Errors,
+				fmt.Sprintf("Unable to delete brick %v: %v", brickId, err))
+			continue
+		}
+		if err := executor.BrickDestroy(host, req); err != nil {
+			r.Errors = append(r.Errors,
+				fmt.Sprintf("Unable to delete brick %v: %v", brickId, err))
+			continue
+		}
+		logger.Info("Deleted orphaned brick %v of device %v", brickId, id)
+		r.Removed = append(r.Removed, removable[brickId]...)
+	}
+	return r, nil
+}
+
+// gcBricks scans the devices for orphaned bricks and logs the result
+func gcBricks(db wdb.DB, executor executors.Executor, cleanup bool) {
+	action := api.BrickGcReport
+	if cleanup {
+		action = api.BrickGcCleanup
+	}
+	resp, err := GcBricks(db, executor, action)
+	if err != nil {
+		logger.LogError("Unable to scan devices for orphaned bricks: %v", err)
+		return
+	}
+	for _, d := range resp.Devices {
+		for _, e := range d.Errors {
+			logger.LogError("Device %v: %v", d.DeviceId, e)
+		}
+	}
+}
+
+// startBrickGc scans the devices for orphaned bricks every
+// BrickGcInterval seconds until the app is closed
+func (a *App) startBrickGc() {
+	if BrickGcInterval <= 0 || a.dbReadOnly {
+		return
+	}
+
+	a.runPeriodically(BrickGcInterval, func() {
+		gcBricks(a.db, a.executor, BrickGcCleanup)
+	})
+}
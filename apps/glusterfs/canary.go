@@ -0,0 +1,183 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/heketi/heketi/executors"
+	wdb "github.com/heketi/heketi/pkg/db"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/heketi/pkg/utils"
+)
+
+var (
+	// Seconds between the canary runs on every cluster.
+	// Zero disables the periodic runs.
+	CanaryInterval = 0
+
+	// Size of the canary volume in GiB
+	CanaryVolumeSize = 1
+)
+
+// RunCanary checks the provisioning path of the cluster end to end. It
+// creates a small volume, mounts it on one of the nodes to write and read
+// a file, and deletes the volume. The result is saved in the cluster and
+// an error is returned when any of the stages failed.
+func RunCanary(db wdb.DB,
+	executor executors.Executor,
+	allocator Allocator,
+	clusterId string) (*api.CanaryResult, error) {
+
+	var nodes int
+	err := db.View(func(tx *bolt.Tx) error {
+		cluster, err := NewClusterEntryFromId(tx, clusterId)
+		if err != nil {
+			return err
+		}
+		if !cluster.Info.File {
+			return fmt.Errorf("Cluster %v does not allow file volumes", clusterId)
+		}
+		nodes = len(cluster.Info.Nodes)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	r := &api.CanaryResult{
+		ClusterId: clusterId,
+		Started:   start.Unix(),
+	}
+	logger.Info("Running canary on cluster %v", clusterId)
+	runErr := runCanary(db, executor, allocator, clusterId, nodes, r)
+	r.Duration = int64(time.Since(start) / time.Millisecond)
+	if runErr != nil {
+		r.Message = runErr.Error()
+		logger.LogError("Canary on cluster %v failed at %v: %v",
+			clusterId, r.Stage, runErr)
+	} else {
+		r.Success = true
+		logger.Info("Canary on cluster %v succeeded in %v ms", clusterId, r.Duration)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		cluster, err := NewClusterEntryFromId(tx, clusterId)
+		if err != nil {
+			return err
+		}
+		cluster.Canary = r
+		return cluster.Save(tx)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return r, runErr
+}
+
+func runCanary(db wdb.DB,
+	executor executors.Executor,
+	allocator Allocator,
+	clusterId string,
+	nodes int,
+	r *api.CanaryResult) error {
+
+	req := &api.VolumeCreateRequest{}
+	req.Size = CanaryVolumeSize
+	req.Clusters = []string{clusterId}
+	req.Name = "heketi_canary_" + utils.GenUUID()[:8]
+	if nodes > 1 {
+		req.Durability.Type = api.DurabilityReplicate
+		req.Durability.Replicate.Replica = 3
+		if nodes < 3 {
+			req.Durability.Replicate.Replica = nodes
+		}
+	}
+
+	r.Stage = api.CanaryStageCreate
+	vol := NewVolumeEntryFromRequest(req)
+	r.VolumeId = vol.Info.Id
+	if err := vol.Create(db, executor, allocator); err != nil {
+		return err
+	}
+
+	// Delete the volume even if it could not be used
+	r.Stage = api.CanaryStageIO
+	ioErr := canaryIO(db, executor, vol)
+
+	if err := vol.Destroy(db, executor); err != nil {
+		if ioErr == nil {
+			r.Stage = api.CanaryStageDelete
+			return err
+		}
+		logger.LogError("Unable to delete canary volume %v: %v", vol.Info.Id, err)
+	}
+	if ioErr != nil {
+		return ioErr
+	}
+
+	r.Stage = ""
+	return nil
+}
+
+func canaryIO(db wdb.DB, executor executors.Executor, vol *VolumeEntry) error {
+	host, err := GetVerifiedManageHostname(db, executor, vol.Info.Cluster)
+	if err != nil {
+		return err
+	}
+	return executor.VolumeIOCheck(host, vol.Info.Name)
+}
+
+// runCanaryOnClusters runs the canary on every cluster allowing
+// file volumes
+func runCanaryOnClusters(db wdb.DB, executor executors.Executor, allocator Allocator) {
+	var ids []string
+	err := db.View(func(tx *bolt.Tx) error {
+		clusters, err := ClusterList(tx)
+		if err != nil {
+			return err
+		}
+		for _, id := range clusters {
+			cluster, err := NewClusterEntryFromId(tx, id)
+			if err != nil {
+				return err
+			}
+			if cluster.Info.File && len(cluster.Info.Nodes) > 0 {
+				ids = append(ids, id)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logger.LogError("Unable to list clusters for the canary: %v", err)
+		return
+	}
+
+	for _, id := range ids {
+		// Failures are logged and saved in the cluster
+		RunCanary(db, executor, allocator, id)
+	}
+}
+
+// startCanary runs the canary on the clusters every CanaryInterval
+// seconds until the app is closed
+func (a *App) startCanary() {
+	if CanaryInterval <= 0 || a.dbReadOnly {
+		return
+	}
+
+	a.runPeriodically(CanaryInterval, func() {
+		runCanaryOnClusters(a.db, a.executor, a.Allocator())
+	})
+}
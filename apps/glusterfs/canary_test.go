@@ -0,0 +1,142 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/tests"
+)
+
+func canaryCluster(t *testing.T, app *App) string {
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		3,    // nodes_per_cluster
+		1,    // devices_per_node,
+		2*TB, // disksize)
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	var clusterId string
+	app.db.View(func(tx *bolt.Tx) error {
+		clusters, err := ClusterList(tx)
+		tests.Assert(t, err == nil)
+		clusterId = clusters[0]
+		return nil
+	})
+	return clusterId
+}
+
+func assertNoVolumes(t *testing.T, app *App) {
+	app.db.View(func(tx *bolt.Tx) error {
+		vols, err := VolumeList(tx)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, len(vols) == 0, vols)
+		bricks, err := BrickList(tx)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, len(bricks) == 0, bricks)
+		return nil
+	})
+}
+
+func TestRunCanary(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	clusterId := canaryCluster(t, app)
+
+	checked := ""
+	app.xo.MockVolumeIOCheck = func(host string, volume string) error {
+		checked = volume
+		return nil
+	}
+
+	r, err := RunCanary(app.db, app.executor, app.Allocator(), clusterId)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, r.Success)
+	tests.Assert(t, r.Stage == "", r.Stage)
+	tests.Assert(t, r.ClusterId == clusterId)
+	tests.Assert(t, checked != "")
+
+	// The canary volume is gone and the result saved
+	assertNoVolumes(t, app)
+	app.db.View(func(tx *bolt.Tx) error {
+		cluster, err := NewClusterEntryFromId(tx, clusterId)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, cluster.Canary != nil)
+		tests.Assert(t, *cluster.Canary == *r, cluster.Canary)
+		return nil
+	})
+}
+
+func TestRunCanaryIOFailure(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	clusterId := canaryCluster(t, app)
+
+	app.xo.MockVolumeIOCheck = func(host string, volume string) error {
+		return errors.New("mount failed")
+	}
+
+	r, err := RunCanary(app.db, app.executor, app.Allocator(), clusterId)
+	tests.Assert(t, err != nil)
+	tests.Assert(t, !r.Success)
+	tests.Assert(t, r.Stage == api.CanaryStageIO, r.Stage)
+	tests.Assert(t, r.Message == "mount failed", r.Message)
+
+	// The canary volume is deleted anyway
+	assertNoVolumes(t, app)
+}
+
+func TestRunCanaryNoSpace(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	clusterId := canaryCluster(t, app)
+	defer tests.Patch(&CanaryVolumeSize, 100*1024).Restore()
+
+	r, err := RunCanary(app.db, app.executor, app.Allocator(), clusterId)
+	tests.Assert(t, err != nil)
+	tests.Assert(t, r.Stage == api.CanaryStageCreate, r.Stage)
+	assertNoVolumes(t, app)
+}
+
+func TestRunCanaryBlockCluster(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	clusterId := canaryCluster(t, app)
+	app.db.Update(func(tx *bolt.Tx) error {
+		cluster, err := NewClusterEntryFromId(tx, clusterId)
+		tests.Assert(t, err == nil)
+		cluster.Info.File = false
+		return cluster.Save(tx)
+	})
+
+	_, err := RunCanary(app.db, app.executor, app.Allocator(), clusterId)
+	tests.Assert(t, err != nil)
+}
@@ -0,0 +1,145 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"github.com/boltdb/bolt"
+	wdb "github.com/heketi/heketi/pkg/db"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+)
+
+// maxBrickSize returns the size of the largest brick, without
+// snapshot space, the device can hold once the thin pool and its
+// metadata are aligned to extents
+func (d *DeviceEntry) maxBrickSize() uint64 {
+	avail := d.StorageAvailable()
+	reserved := d.poolMetadataSize(avail) + 2*d.ExtentSize
+	if avail <= reserved {
+		return 0
+	}
+	return avail - reserved
+}
+
+// maxReplica3Size returns the largest size whose three copies fit in
+// the space of the nodes, no node holding two copies of the same data
+func maxReplica3Size(nodes []uint64) uint64 {
+	var total uint64
+	for _, n := range nodes {
+		total += n
+	}
+	fits := func(size uint64) bool {
+		var placed uint64
+		for _, n := range nodes {
+			if n < size {
+				placed += n
+			} else {
+				placed += size
+			}
+		}
+		return placed >= 3*size
+	}
+
+	low, high := uint64(0), total/3
+	for low < high {
+		mid := high - (high-low)/2
+		if fits(mid) {
+			low = mid
+		} else {
+			high = mid - 1
+		}
+	}
+	return low
+}
+
+// nodeCapacity returns the capacity of the devices of the node and the
+// space its online devices have for bricks
+func nodeCapacity(tx *bolt.Tx, node *NodeEntry) (*api.NodeCapacityReport, uint64, error) {
+	report := &api.NodeCapacityReport{
+		Id:       node.Info.Id,
+		Hostname: node.ManageHostName(),
+		Zone:     node.Info.Zone,
+		State:    node.State,
+	}
+	var space uint64
+	for _, deviceId := range node.Devices {
+		device, err := NewDeviceEntryFromId(tx, deviceId)
+		if err != nil {
+			return nil, 0, err
+		}
+		report.Raw += device.Info.Storage.Total
+		report.Allocated += device.Info.Storage.Used
+		for _, brickId := range device.Bricks {
+			brick, err := NewBrickEntryFromId(tx, brickId)
+			if err != nil {
+				return nil, 0, err
+			}
+			report.MetadataReserved += brick.PoolMetadataSize
+		}
+
+		if !node.isOnline() || !device.isOnline() {
+			continue
+		}
+		report.Free += device.StorageAvailable()
+		size := device.maxBrickSize()
+		space += size
+		if size > report.MaxBrickSize {
+			report.MaxBrickSize = size
+		}
+	}
+	return report, space, nil
+}
+
+// CapacityReport returns the capacity of the devices of every cluster
+// and of their nodes, read in a single transaction
+func CapacityReport(db wdb.RODB) (*api.CapacityReportResponse, error) {
+	resp := &api.CapacityReportResponse{
+		Clusters: []api.ClusterCapacityReport{},
+	}
+	err := db.View(func(tx *bolt.Tx) error {
+		clusters, err := ClusterList(tx)
+		if err != nil {
+			return err
+		}
+		for _, clusterId := range clusters {
+			cluster, err := NewClusterEntryFromId(tx, clusterId)
+			if err != nil {
+				return err
+			}
+			report := api.ClusterCapacityReport{
+				Id:    cluster.Info.Id,
+				Nodes: []api.NodeCapacityReport{},
+			}
+			space := []uint64{}
+			for _, nodeId := range cluster.Info.Nodes {
+				node, err := NewNodeEntryFromId(tx, nodeId)
+				if err != nil {
+					return err
+				}
+				n, nodeSpace, err := nodeCapacity(tx, node)
+				if err != nil {
+					return err
+				}
+				report.Raw += n.Raw
+				report.Allocated += n.Allocated
+				report.MetadataReserved += n.MetadataReserved
+				report.Free += n.Free
+				report.Nodes = append(report.Nodes, *n)
+				space = append(space, nodeSpace)
+			}
+			report.MaxReplica3VolumeSize = maxReplica3Size(space)
+			resp.Clusters = append(resp.Clusters, report)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
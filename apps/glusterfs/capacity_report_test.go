@@ -0,0 +1,110 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/gorilla/mux"
+	client "github.com/heketi/heketi/client/api/go-client"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/tests"
+)
+
+func TestMaxReplica3Size(t *testing.T) {
+	for _, c := range []struct {
+		nodes []uint64
+		size  uint64
+	}{
+		{[]uint64{}, 0},
+		{[]uint64{10, 10}, 0},
+		{[]uint64{10, 10, 10}, 10},
+		{[]uint64{30, 5, 5}, 5},
+		{[]uint64{10, 10, 10, 10}, 13},
+		{[]uint64{100, 10, 10, 10}, 15},
+	} {
+		size := maxReplica3Size(c.nodes)
+		tests.Assert(t, size == c.size, c.nodes, size)
+	}
+}
+
+func TestCapacityReport(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	c := client.NewClientNoAuth(ts.URL)
+	tests.Assert(t, c != nil)
+
+	err := setupSampleDbWithTopology(app,
+		1,      // clusters
+		3,      // nodes_per_cluster
+		1,      // devices_per_node,
+		500*GB, // disksize
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	report, err := c.CapacityReport()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(report.Clusters) == 1, report.Clusters)
+	cr := report.Clusters[0]
+	tests.Assert(t, len(cr.Nodes) == 3, cr.Nodes)
+	tests.Assert(t, cr.Raw == 3*500*GB, cr.Raw)
+	tests.Assert(t, cr.Allocated == 0 && cr.MetadataReserved == 0, cr)
+	tests.Assert(t, cr.Free == cr.Raw, cr)
+	empty := cr.MaxReplica3VolumeSize
+	tests.Assert(t, empty < 500*GB && empty > 490*GB, empty)
+	for _, n := range cr.Nodes {
+		tests.Assert(t, n.Raw == 500*GB, n)
+		tests.Assert(t, n.MaxBrickSize == empty, n, empty)
+	}
+
+	req := &api.VolumeCreateRequest{}
+	req.Size = 100
+	req.Durability.Type = api.DurabilityReplicate
+	req.Durability.Replicate.Replica = 3
+	_, err = c.VolumeCreate(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	report, err = c.CapacityReport()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	cr = report.Clusters[0]
+	tests.Assert(t, cr.Allocated > 3*100*GB, cr)
+	tests.Assert(t, cr.MetadataReserved > 0 && cr.MetadataReserved < cr.Allocated, cr)
+	tests.Assert(t, cr.Free == cr.Raw-cr.Allocated, cr)
+	tests.Assert(t, cr.MaxReplica3VolumeSize < empty-99*GB, cr.MaxReplica3VolumeSize)
+	tests.Assert(t, cr.MaxReplica3VolumeSize > empty-101*GB, cr.MaxReplica3VolumeSize)
+
+	// Offline nodes have no space for new bricks, leaving too few
+	// nodes for replica 3 volumes
+	app.db.Update(func(tx *bolt.Tx) error {
+		n, err := NewNodeEntryFromId(tx, cr.Nodes[0].Id)
+		tests.Assert(t, err == nil)
+		n.State = api.EntryStateOffline
+		return n.Save(tx)
+	})
+	report, err = c.CapacityReport()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	cr = report.Clusters[0]
+	tests.Assert(t, cr.MaxReplica3VolumeSize == 0, cr.MaxReplica3VolumeSize)
+	tests.Assert(t, cr.Nodes[0].State == api.EntryStateOffline, cr.Nodes[0])
+	tests.Assert(t, cr.Nodes[0].Free == 0 && cr.Nodes[0].MaxBrickSize == 0, cr.Nodes[0])
+	tests.Assert(t, cr.Nodes[0].Allocated > 0, cr.Nodes[0])
+}
@@ -23,6 +23,12 @@ import (
 
 type ClusterEntry struct {
 	Info api.ClusterInfoResponse
+
+	// Result of the last canary run on the cluster
+	Canary *api.CanaryResult
+
+	// Daily samples of the used capacity of the devices
+	Capacity *ClusterCapacityHistory
 }
 
 func ClusterList(tx *bolt.Tx) ([]string, error) {
@@ -34,6 +40,30 @@ func ClusterList(tx *bolt.Tx) ([]string, error) {
 	return list, nil
 }
 
+// ActiveClusterList returns the clusters that may be selected for new
+// volumes when a request does not name the clusters, leaving out the
+// standby clusters
+func ActiveClusterList(tx *bolt.Tx) ([]string, error) {
+	clusters, err := ClusterList(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	active := []string{}
+	for _, id := range clusters {
+		c, err := NewClusterEntryFromId(tx, id)
+		if err != nil {
+			return nil, err
+		}
+		if c.Info.Standby {
+			logger.Debug("Skipping standby cluster %v", id)
+			continue
+		}
+		active = append(active, id)
+	}
+	return active, nil
+}
+
 func NewClusterEntry() *ClusterEntry {
 	entry := &ClusterEntry{}
 	entry.Info.Nodes = make(sort.StringSlice, 0)
@@ -52,6 +82,8 @@ func NewClusterEntryFromRequest(req *api.ClusterCreateRequest) *ClusterEntry {
 	entry.Info.Id = utils.GenUUID()
 	entry.Info.Block = req.Block
 	entry.Info.File = req.File
+	entry.Info.Standby = req.Standby
+	entry.Info.Selinux = req.Selinux
 
 	return entry
 }
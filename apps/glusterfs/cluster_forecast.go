@@ -0,0 +1,210 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"math"
+	"time"
+
+	"github.com/boltdb/bolt"
+	wdb "github.com/heketi/heketi/pkg/db"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+)
+
+const (
+	capacityDayFormat = "2006-01-02"
+	secondsPerDay     = 24 * 60 * 60
+)
+
+var (
+	// Seconds between the samples of the capacity of every cluster.
+	// Zero disables the sampling.
+	CapacitySampleInterval = 0
+
+	// Days of samples kept for each cluster
+	CapacityHistoryDays = 90
+
+	// Days of samples the forecast is based on when the request does
+	// not set them
+	CapacityForecastDays = 30
+)
+
+// ClusterCapacityHistory keeps a sample of the used capacity of the
+// devices of a cluster per day, oldest first. The last sample of a day
+// replaces the previous samples of the day.
+type ClusterCapacityHistory struct {
+	Samples []api.ClusterCapacitySample
+}
+
+func (h *ClusterCapacityHistory) add(sample api.ClusterCapacitySample, days int) {
+	n := len(h.Samples)
+	if n > 0 && h.Samples[n-1].Day == sample.Day {
+		h.Samples[n-1] = sample
+	} else {
+		h.Samples = append(h.Samples, sample)
+	}
+	if days > 0 && len(h.Samples) > days {
+		h.Samples = h.Samples[len(h.Samples)-days:]
+	}
+}
+
+// SampleClusterCapacity saves the used capacity of the devices of the
+// cluster at the given time
+func SampleClusterCapacity(db wdb.DB, id string, now time.Time) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		cluster, err := NewClusterEntryFromId(tx, id)
+		if err != nil {
+			return err
+		}
+		capacity, err := cluster.capacity(tx)
+		if err != nil {
+			return err
+		}
+		if cluster.Capacity == nil {
+			cluster.Capacity = &ClusterCapacityHistory{}
+		}
+		cluster.Capacity.add(api.ClusterCapacitySample{
+			Day:   now.UTC().Format(capacityDayFormat),
+			Time:  now.Unix(),
+			Total: capacity.Devices.Total,
+			Used:  capacity.Devices.Used,
+		}, CapacityHistoryDays)
+		return cluster.Save(tx)
+	})
+}
+
+func sampleAllClusterCapacity(db wdb.DB) {
+	var clusters []string
+	err := db.View(func(tx *bolt.Tx) error {
+		var err error
+		clusters, err = ClusterList(tx)
+		return err
+	})
+	if err != nil {
+		logger.LogError("Unable to list clusters to sample: %v", err)
+		return
+	}
+
+	now := time.Now()
+	for _, id := range clusters {
+		if err := SampleClusterCapacity(db, id, now); err != nil {
+			logger.LogError("Unable to sample capacity of cluster %v: %v", id, err)
+		}
+	}
+}
+
+// startCapacitySampler samples the capacity of the clusters every
+// CapacitySampleInterval seconds until the app is closed
+func (a *App) startCapacitySampler() {
+	if CapacitySampleInterval <= 0 || a.dbReadOnly {
+		return
+	}
+
+	a.runPeriodically(CapacitySampleInterval, func() {
+		sampleAllClusterCapacity(a.db)
+	})
+}
+
+// capacityGrowth returns the growth of the used capacity per day of the
+// least squares line through the samples, and false if the samples are
+// not spread over time
+func capacityGrowth(samples []api.ClusterCapacitySample) (float64, bool) {
+	if len(samples) < 2 {
+		return 0, false
+	}
+
+	// Times are taken from the first sample to keep the sums small
+	var sumX, sumY, sumXY, sumXX float64
+	for _, s := range samples {
+		x := float64(s.Time-samples[0].Time) / secondsPerDay
+		y := float64(s.Used)
+		sumX += x
+		sumY += y
+		sumXY += x * y
+		sumXX += x * x
+	}
+	n := float64(len(samples))
+	d := n*sumXX - sumX*sumX
+	if d == 0 {
+		return 0, false
+	}
+	return (n*sumXY - sumX*sumY) / d, true
+}
+
+// forecastCapacity projects when the used capacity reaches the total
+// capacity from the samples of the last days before now
+func forecastCapacity(id string,
+	history *ClusterCapacityHistory,
+	total, used uint64,
+	days int,
+	now time.Time) *api.ClusterCapacityForecastResponse {
+
+	resp := &api.ClusterCapacityForecastResponse{
+		Id:         id,
+		Total:      total,
+		Used:       used,
+		Days:       days,
+		Samples:    []api.ClusterCapacitySample{},
+		DaysToFull: -1,
+	}
+	if history != nil {
+		since := now.Unix() - int64(days)*secondsPerDay
+		for _, s := range history.Samples {
+			if s.Time >= since {
+				resp.Samples = append(resp.Samples, s)
+			}
+		}
+	}
+
+	growth, ok := capacityGrowth(resp.Samples)
+	if !ok {
+		return resp
+	}
+	resp.GrowthPerDay = int64(growth)
+
+	switch {
+	case used >= total:
+		resp.DaysToFull = 0
+	case growth <= 0:
+		return resp
+	default:
+		toFull := math.Ceil(float64(total-used) / growth)
+		if toFull > math.MaxInt32 {
+			return resp
+		}
+		resp.DaysToFull = int(toFull)
+	}
+	resp.FullDate = now.UTC().AddDate(0, 0, resp.DaysToFull).Format(capacityDayFormat)
+	return resp
+}
+
+// ClusterCapacityForecast projects the time until the devices of the
+// cluster are full from the growth of their used capacity in the
+// samples of the last days
+func ClusterCapacityForecast(db wdb.RODB,
+	id string,
+	days int) (*api.ClusterCapacityForecastResponse, error) {
+
+	var resp *api.ClusterCapacityForecastResponse
+	err := db.View(func(tx *bolt.Tx) error {
+		cluster, err := NewClusterEntryFromId(tx, id)
+		if err != nil {
+			return err
+		}
+		capacity, err := cluster.capacity(tx)
+		if err != nil {
+			return err
+		}
+		resp = forecastCapacity(id, cluster.Capacity,
+			capacity.Devices.Total, capacity.Devices.Used, days, time.Now())
+		return nil
+	})
+	return resp, err
+}
@@ -0,0 +1,150 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/gorilla/mux"
+	client "github.com/heketi/heketi/client/api/go-client"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/heketi/pkg/utils"
+	"github.com/heketi/tests"
+)
+
+func TestClusterCapacityHistoryAdd(t *testing.T) {
+	h := &ClusterCapacityHistory{}
+	h.add(api.ClusterCapacitySample{Day: "2018-10-01", Used: 1}, 2)
+	h.add(api.ClusterCapacitySample{Day: "2018-10-01", Used: 2}, 2)
+	tests.Assert(t, len(h.Samples) == 1, h.Samples)
+	tests.Assert(t, h.Samples[0].Used == 2, h.Samples)
+
+	h.add(api.ClusterCapacitySample{Day: "2018-10-02", Used: 3}, 2)
+	h.add(api.ClusterCapacitySample{Day: "2018-10-03", Used: 4}, 2)
+	tests.Assert(t, len(h.Samples) == 2, h.Samples)
+	tests.Assert(t, h.Samples[0].Day == "2018-10-02", h.Samples)
+	tests.Assert(t, h.Samples[1].Day == "2018-10-03", h.Samples)
+}
+
+func TestForecastCapacity(t *testing.T) {
+	now := time.Date(2018, 10, 10, 12, 0, 0, 0, time.UTC)
+	h := &ClusterCapacityHistory{}
+	for i := 9; i >= 0; i-- {
+		day := now.AddDate(0, 0, -i)
+		h.add(api.ClusterCapacitySample{
+			Day:   day.Format(capacityDayFormat),
+			Time:  day.Unix(),
+			Total: 1000,
+			Used:  uint64(100 + (9-i)*10),
+		}, 0)
+	}
+
+	// 190 used out of 1000 growing by 10 a day
+	f := forecastCapacity("c", h, 1000, 190, 30, now)
+	tests.Assert(t, len(f.Samples) == 10, f.Samples)
+	tests.Assert(t, f.GrowthPerDay == 10, f.GrowthPerDay)
+	tests.Assert(t, f.DaysToFull == 81, f.DaysToFull)
+	tests.Assert(t, f.FullDate == "2018-12-30", f.FullDate)
+
+	// Only the samples of the last days are used
+	f = forecastCapacity("c", h, 1000, 190, 3, now)
+	tests.Assert(t, len(f.Samples) == 4, f.Samples)
+	tests.Assert(t, f.GrowthPerDay == 10, f.GrowthPerDay)
+
+	// A single sample gives no growth
+	f = forecastCapacity("c", h, 1000, 190, 0, now)
+	tests.Assert(t, len(f.Samples) == 1, f.Samples)
+	tests.Assert(t, f.DaysToFull == -1, f.DaysToFull)
+	tests.Assert(t, f.FullDate == "", f.FullDate)
+
+	// Neither does a shrinking cluster
+	for i := range h.Samples {
+		h.Samples[i].Used = uint64(1000 - i*10)
+	}
+	f = forecastCapacity("c", h, 1000, 910, 30, now)
+	tests.Assert(t, f.GrowthPerDay == -10, f.GrowthPerDay)
+	tests.Assert(t, f.DaysToFull == -1, f.DaysToFull)
+
+	// A full cluster is full today
+	f = forecastCapacity("c", h, 1000, 1000, 30, now)
+	tests.Assert(t, f.DaysToFull == 0, f.DaysToFull)
+	tests.Assert(t, f.FullDate == "2018-10-10", f.FullDate)
+
+	f = forecastCapacity("c", nil, 1000, 190, 30, now)
+	tests.Assert(t, len(f.Samples) == 0, f.Samples)
+	tests.Assert(t, f.DaysToFull == -1, f.DaysToFull)
+}
+
+func TestClusterCapacityForecast(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	c := client.NewClientNoAuth(ts.URL)
+	tests.Assert(t, c != nil)
+
+	err := setupSampleDbWithTopology(app, 1, 3, 1, 500*GB)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	var clusterId string
+	app.db.View(func(tx *bolt.Tx) error {
+		clusters, err := ClusterList(tx)
+		tests.Assert(t, err == nil)
+		clusterId = clusters[0]
+		return nil
+	})
+
+	// Samples of the cluster before and after a volume was created
+	now := time.Now()
+	err = SampleClusterCapacity(app.db, clusterId, now.AddDate(0, 0, -2))
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	v := NewVolumeEntryFromRequest(&api.VolumeCreateRequest{Size: 100})
+	err = v.Create(app.db, app.executor, app.Allocator())
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	err = SampleClusterCapacity(app.db, clusterId, now)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	f, err := c.ClusterCapacityForecast(clusterId, 0)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, f.Id == clusterId, f)
+	tests.Assert(t, f.Days == CapacityForecastDays, f.Days)
+	tests.Assert(t, len(f.Samples) == 2, f.Samples)
+	tests.Assert(t, f.Total == 3*500*GB, f.Total)
+	tests.Assert(t, f.Used > 0 && f.Used == f.Samples[1].Used, f)
+	tests.Assert(t, f.Samples[0].Used == 0, f.Samples)
+	tests.Assert(t, f.GrowthPerDay > 0, f.GrowthPerDay)
+	tests.Assert(t, f.DaysToFull > 0, f.DaysToFull)
+
+	// The forecast of the last day has a single sample
+	f, err = c.ClusterCapacityForecast(clusterId, 1)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(f.Samples) == 1, f.Samples)
+	tests.Assert(t, f.DaysToFull == -1, f.DaysToFull)
+
+	_, err = c.ClusterCapacityForecast(clusterId, -1)
+	tests.Assert(t, err != nil, "expected err != nil")
+	tests.Assert(t, utils.GetStatusCodeFromError(err) == http.StatusBadRequest, err)
+
+	_, err = c.ClusterCapacityForecast("123", 0)
+	tests.Assert(t, err != nil, "expected err != nil")
+	tests.Assert(t, utils.GetStatusCodeFromError(err) == http.StatusNotFound, err)
+}
@@ -0,0 +1,122 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/heketi/heketi/executors"
+	wdb "github.com/heketi/heketi/pkg/db"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+)
+
+// ClusterOptionError is returned when an option can not be set to the
+// requested value given the current options of the cluster
+type ClusterOptionError struct {
+	Option string
+	Reason string
+}
+
+func (e *ClusterOptionError) Error() string {
+	return fmt.Sprintf("Unable to set %v: %v", e.Option, e.Reason)
+}
+
+func clusterOptions(executor executors.Executor,
+	host string) (map[string]string, error) {
+
+	options, err := executor.ClusterOptions(host)
+	if err != nil {
+		return nil, err
+	}
+	m := map[string]string{}
+	for _, o := range options.Options {
+		m[o.Name] = o.Value
+	}
+	return m, nil
+}
+
+// ClusterOptions returns the gluster options of the whole cluster
+func ClusterOptions(db wdb.RODB,
+	executor executors.Executor,
+	clusterId string) (*api.ClusterOptionsResponse, error) {
+
+	host, err := GetVerifiedManageHostname(db, executor, clusterId)
+	if err != nil {
+		return nil, err
+	}
+	options, err := clusterOptions(executor, host)
+	if err != nil {
+		return nil, err
+	}
+	return &api.ClusterOptionsResponse{
+		Id:      clusterId,
+		Options: options,
+	}, nil
+}
+
+// checkOpVersion checks that the op-version is not lowered, which
+// gluster does not support, and is supported by every node
+func checkOpVersion(current map[string]string, value string) error {
+	v, err := strconv.Atoi(value)
+	if err != nil {
+		return &ClusterOptionError{api.ClusterOptionOpVersion, "not a number"}
+	}
+	if c, err := strconv.Atoi(current[api.ClusterOptionOpVersion]); err == nil && v < c {
+		return &ClusterOptionError{api.ClusterOptionOpVersion,
+			fmt.Sprintf("%v is lower than the current op-version %v", v, c)}
+	}
+	if m, err := strconv.Atoi(current[api.ClusterOptionMaxOpVersion]); err == nil && v > m {
+		return &ClusterOptionError{api.ClusterOptionOpVersion,
+			fmt.Sprintf("%v is higher than the op-version %v supported by "+
+				"every node", v, m)}
+	}
+	return nil
+}
+
+// SetClusterOptions sets gluster options of the whole cluster and
+// returns the options of the cluster once set
+func SetClusterOptions(db wdb.RODB,
+	executor executors.Executor,
+	clusterId string,
+	req *api.ClusterOptionsRequest) (*api.ClusterOptionsResponse, error) {
+
+	host, err := GetVerifiedManageHostname(db, executor, clusterId)
+	if err != nil {
+		return nil, err
+	}
+	current, err := clusterOptions(executor, host)
+	if err != nil {
+		return nil, err
+	}
+	for _, option := range req.Set {
+		fields := strings.Fields(option)
+		if fields[0] == api.ClusterOptionOpVersion {
+			if err := checkOpVersion(current, fields[1]); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := executor.ClusterSetOptions(host, req.Set); err != nil {
+		return nil, err
+	}
+	logger.Info("Changed options of cluster %v: %v", clusterId, req.Set)
+
+	options, err := clusterOptions(executor, host)
+	if err != nil {
+		return nil, err
+	}
+	return &api.ClusterOptionsResponse{
+		Id:      clusterId,
+		Options: options,
+	}, nil
+}
@@ -0,0 +1,190 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/boltdb/bolt"
+	"github.com/heketi/heketi/executors"
+	wdb "github.com/heketi/heketi/pkg/db"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/heketi/pkg/utils"
+)
+
+// peerRepairResults keeps the result of the last peer repair of every
+// cluster
+type peerRepairResults struct {
+	lock    sync.Mutex
+	results map[string]*api.ClusterPeerRepairResponse
+}
+
+func (p *peerRepairResults) set(id string, resp *api.ClusterPeerRepairResponse) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.results == nil {
+		p.results = map[string]*api.ClusterPeerRepairResponse{}
+	}
+	p.results[id] = resp
+}
+
+func (p *peerRepairResults) get(id string) *api.ClusterPeerRepairResponse {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.results[id]
+}
+
+// peerState returns the state of the node in the peer status
+// reported by another node of the cluster.
+func peerState(status *executors.PeerStatus, node *NodeEntry) string {
+	isNode := func(host string) bool {
+		return utils.SameHost(host, node.ManageHostName()) ||
+			node.IsStorageHost(host)
+	}
+
+	for _, peer := range status.Peers {
+		found := isNode(peer.Hostname)
+		for _, h := range peer.Hostnames {
+			found = found || isNode(h)
+		}
+		if !found {
+			continue
+		}
+
+		switch {
+		case strings.Contains(peer.StateStr, "Rejected"):
+			return api.PeerStateRejected
+		case peer.Connected == 0:
+			return api.PeerStateDisconnected
+		default:
+			return api.PeerStateConnected
+		}
+	}
+
+	return api.PeerStateMissing
+}
+
+// RepairClusterPeers checks the peer status of every node of the cluster
+// from a node where glusterd is running. Missing and disconnected peers
+// are probed again when glusterd is running on them. Rejected peers and
+// peers without a running glusterd can not be fixed automatically and
+// are reported with the steps needed to resolve them.
+func RepairClusterPeers(db wdb.RODB,
+	executor executors.Executor,
+	clusterId string) (*api.ClusterPeerRepairResponse, error) {
+
+	var nodes []*NodeEntry
+	err := db.View(func(tx *bolt.Tx) error {
+		cluster, err := NewClusterEntryFromId(tx, clusterId)
+		if err != nil {
+			return err
+		}
+		for _, id := range cluster.Info.Nodes {
+			node, err := NewNodeEntryFromId(tx, id)
+			if err != nil {
+				return err
+			}
+			nodes = append(nodes, node)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Find a node to check the peer status from
+	var execNode *NodeEntry
+	for _, node := range nodes {
+		if !node.isOnline() {
+			continue
+		}
+		if err := executor.GlusterdCheck(node.ManageHostName()); err != nil {
+			logger.Info("Glusterd not running in %v", node.ManageHostName())
+			continue
+		}
+		execNode = node
+		break
+	}
+	if execNode == nil {
+		return nil, fmt.Errorf("None of the nodes in cluster has glusterd running")
+	}
+	host := execNode.ManageHostName()
+
+	status, err := executor.PeerStatus(host)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &api.ClusterPeerRepairResponse{
+		NodeId: execNode.Info.Id,
+		Peers:  []api.PeerRepairInfo{},
+	}
+	probed := false
+	for _, node := range nodes {
+		if node == execNode {
+			continue
+		}
+
+		info := api.PeerRepairInfo{
+			NodeId:   node.Info.Id,
+			Hostname: node.StorageHostName(),
+			Before:   peerState(status, node),
+			Action:   api.PeerRepairActionNone,
+		}
+
+		switch info.Before {
+		case api.PeerStateMissing, api.PeerStateDisconnected:
+			if err := executor.GlusterdCheck(node.ManageHostName()); err != nil {
+				info.Action = api.PeerRepairActionManual
+				info.Message = fmt.Sprintf(
+					"Glusterd is not running on %v. Start glusterd on the node.",
+					node.ManageHostName())
+				break
+			}
+			logger.Info("Probing peer %v from %v", node.StorageHostName(), host)
+			info.Action = api.PeerRepairActionProbe
+			probed = true
+			if err := executor.PeerProbe(host, node.StorageHostName()); err != nil {
+				info.Message = fmt.Sprintf("Peer probe failed: %v", err)
+			}
+
+		case api.PeerStateRejected:
+			info.Action = api.PeerRepairActionManual
+			info.Message = fmt.Sprintf(
+				"Peer %v was rejected by %v. Stop glusterd on the node, "+
+					"remove everything but glusterd.info from /var/lib/glusterd, "+
+					"start glusterd and repair the peers again.",
+				node.StorageHostName(), host)
+		}
+
+		resp.Peers = append(resp.Peers, info)
+	}
+
+	// Report the state of the peers after the probes
+	if probed {
+		status, err = executor.PeerStatus(host)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for i := range resp.Peers {
+		for _, node := range nodes {
+			if node.Info.Id == resp.Peers[i].NodeId {
+				resp.Peers[i].After = peerState(status, node)
+			}
+		}
+		logger.Info("Peer %v: %v -> %v",
+			resp.Peers[i].Hostname, resp.Peers[i].Before, resp.Peers[i].After)
+	}
+
+	return resp, nil
+}
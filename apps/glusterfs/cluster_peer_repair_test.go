@@ -0,0 +1,179 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/heketi/heketi/executors"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/tests"
+)
+
+func sampleClusterNodes(t *testing.T, app *App) (string, []*NodeEntry) {
+	var (
+		clusterId string
+		nodes     []*NodeEntry
+	)
+	err := app.db.View(func(tx *bolt.Tx) error {
+		clusters, err := ClusterList(tx)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, len(clusters) == 1)
+		clusterId = clusters[0]
+
+		cluster, err := NewClusterEntryFromId(tx, clusterId)
+		tests.Assert(t, err == nil)
+		for _, id := range cluster.Info.Nodes {
+			node, err := NewNodeEntryFromId(tx, id)
+			tests.Assert(t, err == nil)
+			nodes = append(nodes, node)
+		}
+		return nil
+	})
+	tests.Assert(t, err == nil)
+	return clusterId, nodes
+}
+
+func TestPeerState(t *testing.T) {
+	node := createSampleNodeEntry()
+	status := &executors.PeerStatus{}
+	tests.Assert(t, peerState(status, node) == api.PeerStateMissing)
+
+	status.Peers = []executors.Peer{
+		executors.Peer{
+			Hostname:  "10.0.0.1",
+			Hostnames: []string{"10.0.0.1", node.StorageHostName()},
+			Connected: 1,
+			StateStr:  "Peer in Cluster",
+		},
+	}
+	tests.Assert(t, peerState(status, node) == api.PeerStateConnected)
+
+	status.Peers[0].Connected = 0
+	tests.Assert(t, peerState(status, node) == api.PeerStateDisconnected)
+
+	status.Peers[0].StateStr = "Peer Rejected"
+	tests.Assert(t, peerState(status, node) == api.PeerStateRejected)
+}
+
+func TestRepairClusterPeers(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	err := setupSampleDbWithTopology(app,
+		1,      // clusters
+		4,      // nodes_per_cluster
+		1,      // devices_per_node,
+		500*GB, // disksize)
+	)
+	tests.Assert(t, err == nil)
+	clusterId, nodes := sampleClusterNodes(t, app)
+	tests.Assert(t, len(nodes) == 4)
+
+	// Glusterd is down on the first node, so the peers are checked from
+	// the second one. The third node is disconnected and the last one
+	// has been rejected.
+	execNode := nodes[1]
+	app.xo.MockGlusterdCheck = func(host string) error {
+		if host == nodes[0].ManageHostName() {
+			return errors.New("glusterd not running")
+		}
+		return nil
+	}
+	probed := false
+	app.xo.MockPeerProbe = func(exec_host, newnode string) error {
+		tests.Assert(t, exec_host == execNode.ManageHostName(), exec_host)
+		tests.Assert(t, newnode == nodes[2].StorageHostName(), newnode)
+		probed = true
+		return nil
+	}
+	app.xo.MockPeerStatus = func(host string) (*executors.PeerStatus, error) {
+		tests.Assert(t, host == execNode.ManageHostName(), host)
+		connected := 0
+		if probed {
+			connected = 1
+		}
+		return &executors.PeerStatus{
+			Peers: []executors.Peer{
+				executors.Peer{
+					Hostname:  nodes[2].StorageHostName(),
+					Connected: connected,
+					StateStr:  "Peer in Cluster",
+				},
+				executors.Peer{
+					Hostname:  nodes[3].StorageHostName(),
+					Connected: 1,
+					StateStr:  "Peer Rejected",
+				},
+			},
+		}, nil
+	}
+
+	resp, err := RepairClusterPeers(app.db, app.executor, clusterId)
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, probed)
+	tests.Assert(t, resp.NodeId == execNode.Info.Id)
+	tests.Assert(t, len(resp.Peers) == 3, resp.Peers)
+
+	// Glusterd is down on the first node, which also is not a peer
+	p := resp.Peers[0]
+	tests.Assert(t, p.NodeId == nodes[0].Info.Id)
+	tests.Assert(t, p.Before == api.PeerStateMissing, p.Before)
+	tests.Assert(t, p.After == api.PeerStateMissing, p.After)
+	tests.Assert(t, p.Action == api.PeerRepairActionManual, p.Action)
+	tests.Assert(t, strings.Contains(p.Message, "Start glusterd"), p.Message)
+
+	p = resp.Peers[1]
+	tests.Assert(t, p.NodeId == nodes[2].Info.Id)
+	tests.Assert(t, p.Before == api.PeerStateDisconnected, p.Before)
+	tests.Assert(t, p.After == api.PeerStateConnected, p.After)
+	tests.Assert(t, p.Action == api.PeerRepairActionProbe, p.Action)
+	tests.Assert(t, p.Message == "", p.Message)
+
+	p = resp.Peers[2]
+	tests.Assert(t, p.NodeId == nodes[3].Info.Id)
+	tests.Assert(t, p.Before == api.PeerStateRejected, p.Before)
+	tests.Assert(t, p.After == api.PeerStateRejected, p.After)
+	tests.Assert(t, p.Action == api.PeerRepairActionManual, p.Action)
+}
+
+func TestRepairClusterPeersNoGlusterd(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	err := setupSampleDbWithTopology(app,
+		1,      // clusters
+		2,      // nodes_per_cluster
+		1,      // devices_per_node,
+		500*GB, // disksize)
+	)
+	tests.Assert(t, err == nil)
+	clusterId, _ := sampleClusterNodes(t, app)
+
+	app.xo.MockGlusterdCheck = func(host string) error {
+		return errors.New("glusterd not running")
+	}
+
+	resp, err := RepairClusterPeers(app.db, app.executor, clusterId)
+	tests.Assert(t, err != nil)
+	tests.Assert(t, resp == nil)
+}
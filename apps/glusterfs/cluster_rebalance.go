@@ -0,0 +1,370 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/heketi/heketi/executors"
+	wdb "github.com/heketi/heketi/pkg/db"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/heketi/pkg/utils"
+)
+
+var (
+	// Default maximum distance, in percent, of the utilization of each
+	// device from the mean utilization of the cluster
+	ClusterRebalanceBand = 10.0
+
+	// Default maximum number of bricks moved by a rebalance
+	ClusterRebalanceMaxMoves = 20
+
+	// Default time to wait between two moves of a rebalance, giving
+	// the new brick time to heal before the next replace
+	ClusterRebalanceInterval = time.Minute
+)
+
+// rebalanceDevice is an online device of the cluster. The storage of
+// the device entry tracks the planned moves and is never saved.
+type rebalanceDevice struct {
+	device *DeviceEntry
+	before float64
+	bricks []*BrickEntry
+}
+
+func (d *rebalanceDevice) utilization() float64 {
+	return d.utilizationWith(0)
+}
+
+// utilizationWith returns the utilization in percent of the device
+// with extra KB allocated
+func (d *rebalanceDevice) utilizationWith(extra uint64) float64 {
+	total := d.device.Info.Storage.Total
+	if total == 0 {
+		return 0
+	}
+	return 100 * float64(d.device.Info.Storage.Used+extra) / float64(total)
+}
+
+// ClusterRebalancePlan holds the brick moves bringing the utilization
+// of the devices of a cluster within the band around their mean
+type ClusterRebalancePlan struct {
+	clusterId string
+	mean      float64
+	band      float64
+	devices   []*rebalanceDevice
+	volumes   map[string]*VolumeEntry
+
+	planned []*plannedBrickReplacement
+	// Destination device of each planned move
+	destinations []string
+
+	// Bricks planned to move along with the other bricks of their sets
+	moved map[string]bool
+	// Bricks that can not be replaced at this time
+	unmovable map[string]bool
+}
+
+// loadRebalanceDevices gathers the online devices of the online nodes
+// of the cluster and the bricks they hold that may be replaced
+func (p *ClusterRebalancePlan) loadRebalanceDevices(tx *bolt.Tx) error {
+	cluster, err := NewClusterEntryFromId(tx, p.clusterId)
+	if err != nil {
+		return err
+	}
+
+	var used, total uint64
+	for _, nodeId := range cluster.Info.Nodes {
+		node, err := NewNodeEntryFromId(tx, nodeId)
+		if err != nil {
+			return err
+		}
+		if !node.isOnline() {
+			continue
+		}
+		for _, deviceId := range node.Devices {
+			device, err := NewDeviceEntryFromId(tx, deviceId)
+			if err != nil {
+				return err
+			}
+			if !device.isOnline() {
+				continue
+			}
+
+			d := &rebalanceDevice{device: device}
+			for _, brickId := range device.Bricks {
+				brick, err := NewBrickEntryFromId(tx, brickId)
+				if err != nil {
+					return err
+				}
+				if brick.Info.Path == "" {
+					continue
+				}
+				v, ok := p.volumes[brick.Info.VolumeId]
+				if !ok {
+					v, err = NewVolumeEntryFromId(tx, brick.Info.VolumeId)
+					if err != nil {
+						return err
+					}
+					p.volumes[v.Info.Id] = v
+				}
+				if v.Info.Durability.Type == api.DurabilityDistributeOnly {
+					continue
+				}
+				d.bricks = append(d.bricks, brick)
+			}
+
+			// Move the largest bricks first
+			sort.Slice(d.bricks, func(i, j int) bool {
+				return d.bricks[i].TotalSize() > d.bricks[j].TotalSize()
+			})
+			d.before = d.utilization()
+			p.devices = append(p.devices, d)
+
+			used += device.Info.Storage.Used
+			total += device.Info.Storage.Total
+		}
+	}
+
+	if total != 0 {
+		p.mean = 100 * float64(used) / float64(total)
+	}
+	return nil
+}
+
+// Balanced returns true if the utilization of every device is within
+// the band around the mean utilization
+func (p *ClusterRebalancePlan) Balanced() bool {
+	for _, d := range p.devices {
+		if math.Abs(d.utilization()-p.mean) > p.band {
+			return false
+		}
+	}
+	return true
+}
+
+// setMoved returns true if a brick of the set of the replacement is
+// already planned to move. Only one brick of a set is moved by a
+// rebalance so that the set never has more than one healing brick.
+func (p *ClusterRebalancePlan) setMoved(r *brickReplacement) bool {
+	for _, b := range r.setlist {
+		if p.moved[b.Info.Id] {
+			return true
+		}
+	}
+	return false
+}
+
+// planMoveFrom plans the move of a brick of the device to the least
+// utilized device that can hold it without ending up more utilized
+// than the device is now. It returns false if no brick can be moved.
+func (p *ClusterRebalancePlan) planMoveFrom(db wdb.DB,
+	executor executors.Executor,
+	src *rebalanceDevice) bool {
+
+	dests := make([]*rebalanceDevice, 0, len(p.devices))
+	for _, d := range p.devices {
+		if d != src {
+			dests = append(dests, d)
+		}
+	}
+	sort.Slice(dests, func(i, j int) bool {
+		return dests[i].utilization() < dests[j].utilization()
+	})
+
+	for i, brick := range src.bricks {
+		if p.moved[brick.Info.Id] || p.unmovable[brick.Info.Id] {
+			continue
+		}
+		v := p.volumes[brick.Info.VolumeId]
+		size := brick.TotalSize()
+
+		var r *brickReplacement
+		for _, dst := range dests {
+			if !dst.device.StorageCheck(size) ||
+				dst.utilizationWith(size) >= src.utilization() {
+				continue
+			}
+
+			// Only check with the storage nodes that the brick can be
+			// replaced once a destination with room was found
+			if r == nil {
+				var err error
+				r, err = v.prepareBrickReplace(db, executor, brick.Info.Id)
+				if err != nil {
+					logger.Warning("Unable to move brick %v: %v", brick.Info.Id, err)
+					p.unmovable[brick.Info.Id] = true
+					break
+				}
+				if p.setMoved(r) {
+					break
+				}
+			}
+			if !r.deviceOk(dst.device) {
+				continue
+			}
+
+			logger.Debug("Planning move of brick %v from device %v to device %v",
+				brick.Info.Id, src.device.Info.Id, dst.device.Info.Id)
+			p.planned = append(p.planned, &plannedBrickReplacement{
+				brickReplacement: r,
+				volume:           v,
+			})
+			p.destinations = append(p.destinations, dst.device.Info.Id)
+			for _, b := range r.setlist {
+				p.moved[b.Info.Id] = true
+			}
+			src.device.StorageFree(size)
+			dst.device.StorageAllocate(size)
+			src.bricks = append(src.bricks[:i:i], src.bricks[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// PlanClusterRebalance plans the brick moves bringing the utilization
+// of the online devices of the cluster within the band around their
+// mean utilization, moving at most maxMoves bricks. The devices most
+// above the mean give up bricks first. Nothing is reserved until the
+// plan is executed.
+func PlanClusterRebalance(db wdb.DB,
+	executor executors.Executor,
+	clusterId string,
+	band float64,
+	maxMoves int) (*ClusterRebalancePlan, error) {
+
+	p := &ClusterRebalancePlan{
+		clusterId: clusterId,
+		band:      band,
+		volumes:   map[string]*VolumeEntry{},
+		moved:     map[string]bool{},
+		unmovable: map[string]bool{},
+	}
+	err := db.View(func(tx *bolt.Tx) error {
+		return p.loadRebalanceDevices(tx)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for len(p.planned) < maxMoves && !p.Balanced() {
+		srcs := make([]*rebalanceDevice, len(p.devices))
+		copy(srcs, p.devices)
+		sort.Slice(srcs, func(i, j int) bool {
+			return srcs[i].utilization() > srcs[j].utilization()
+		})
+
+		progress := false
+		for _, src := range srcs {
+			if src.utilization() <= p.mean {
+				break
+			}
+			if p.planMoveFrom(db, executor, src) {
+				progress = true
+				break
+			}
+		}
+		if !progress {
+			logger.Info("No more bricks can be moved to rebalance cluster %v",
+				clusterId)
+			break
+		}
+	}
+	return p, nil
+}
+
+// Response returns the plan as sent to the client
+func (p *ClusterRebalancePlan) Response() *api.ClusterRebalanceResponse {
+	resp := &api.ClusterRebalanceResponse{
+		Id:       p.clusterId,
+		Mean:     p.mean,
+		Band:     p.band,
+		Moves:    []api.ClusterRebalanceMove{},
+		Devices:  []api.ClusterRebalanceDevice{},
+		Balanced: p.Balanced(),
+	}
+	for i, planned := range p.planned {
+		resp.Moves = append(resp.Moves, api.ClusterRebalanceMove{
+			BrickId:  planned.oldBrick.Info.Id,
+			VolumeId: planned.volume.Info.Id,
+			From:     planned.oldDevice.Info.Id,
+			To:       p.destinations[i],
+			Size:     planned.oldBrick.TotalSize(),
+		})
+	}
+	for _, d := range p.devices {
+		resp.Devices = append(resp.Devices, api.ClusterRebalanceDevice{
+			Id:     d.device.Info.Id,
+			Before: d.before,
+			After:  d.utilization(),
+		})
+	}
+	return resp
+}
+
+// executeMoves reserves the storage of all the destination devices of
+// the planned moves, then replaces the bricks one at a time, waiting
+// for the interval between two replaces. It returns the failed
+// replaces, a failed replace not stopping the others.
+func executeMoves(db wdb.DB,
+	executor executors.Executor,
+	planned []*plannedBrickReplacement,
+	destinations []string,
+	interval time.Duration) ([]string, error) {
+
+	err := db.Update(func(tx *bolt.Tx) error {
+		devcache := map[string](*DeviceEntry){}
+		for i, p := range planned {
+			device, err := cachedDevice(tx, devcache, destinations[i])
+			if err != nil {
+				return err
+			}
+			if !p.allocate(device, utils.GenUUID()) {
+				return fmt.Errorf("Device %v no longer has room for brick %v",
+					device.Info.Id, p.oldBrick.Info.Id)
+			}
+		}
+		return saveReservations(tx, devcache, planned)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return replacePlanned(db, executor, planned, interval), nil
+}
+
+// Execute reserves the storage of all the destinations of the plan,
+// then replaces the bricks one at a time, waiting for the interval
+// between two replaces. A failed replace does not stop the others.
+func (p *ClusterRebalancePlan) Execute(db wdb.DB,
+	executor executors.Executor,
+	interval time.Duration) error {
+
+	if len(p.planned) == 0 {
+		return nil
+	}
+
+	failed, err := executeMoves(db, executor, p.planned, p.destinations,
+		interval)
+	if err != nil {
+		return logger.Err(err)
+	}
+	if len(failed) != 0 {
+		return fmt.Errorf("Failed to move %v of %v bricks of cluster %v: %v",
+			len(failed), len(p.planned), p.clusterId, strings.Join(failed, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/gorilla/mux"
+	client "github.com/heketi/heketi/client/api/go-client"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/tests"
+)
+
+func TestClusterRebalancePlan(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	// Three devices hold two bricks each while the spare is empty
+	_, spareId := sampleDeviceWithBricks(t, app, 0)
+
+	var clusterId string
+	app.db.View(func(tx *bolt.Tx) error {
+		cl, err := ClusterList(tx)
+		tests.Assert(t, err == nil)
+		clusterId = cl[0]
+		return nil
+	})
+
+	plan, err := PlanClusterRebalance(app.db, app.executor, clusterId, 10, 10)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	resp := plan.Response()
+	tests.Assert(t, resp.Mean > 50 && resp.Mean < 70, resp.Mean)
+
+	// Only one brick of a set moves, and the brick of the other volume
+	// would leave the spare as utilized as its device is now
+	tests.Assert(t, len(resp.Moves) == 1, resp.Moves)
+	tests.Assert(t, resp.Moves[0].To == spareId, resp.Moves[0])
+	tests.Assert(t, resp.Moves[0].From != spareId, resp.Moves[0])
+	tests.Assert(t, !resp.Balanced)
+	for _, d := range resp.Devices {
+		if d.Id == spareId {
+			tests.Assert(t, d.Before == 0, d)
+			tests.Assert(t, d.After > 30 && d.After < 50, d)
+		}
+	}
+
+	// Nothing is reserved by planning
+	app.db.View(func(tx *bolt.Tx) error {
+		spare, err := NewDeviceEntryFromId(tx, spareId)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, spare.Info.Storage.Used == 0, spare.Info.Storage)
+		return nil
+	})
+
+	// No moves needed within a wide band
+	plan, err = PlanClusterRebalance(app.db, app.executor, clusterId, 70, 10)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	resp = plan.Response()
+	tests.Assert(t, len(resp.Moves) == 0, resp.Moves)
+	tests.Assert(t, resp.Balanced)
+
+	// Limited number of moves
+	plan, err = PlanClusterRebalance(app.db, app.executor, clusterId, 10, 0)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(plan.Response().Moves) == 0)
+}
+
+func TestClusterRebalanceHttp(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	c := client.NewClientNoAuth(ts.URL)
+	tests.Assert(t, c != nil)
+
+	_, spareId := sampleDeviceWithBricks(t, app, 0)
+
+	var clusterId string
+	app.db.View(func(tx *bolt.Tx) error {
+		cl, err := ClusterList(tx)
+		tests.Assert(t, err == nil)
+		clusterId = cl[0]
+		return nil
+	})
+
+	req := &api.ClusterRebalanceRequest{Band: 10}
+	plan, err := c.ClusterRebalancePlan(clusterId, req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(plan.Moves) == 1, plan.Moves)
+	tests.Assert(t, plan.Id == clusterId)
+
+	err = c.ClusterRebalance(clusterId, req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	app.db.View(func(tx *bolt.Tx) error {
+		spare, err := NewDeviceEntryFromId(tx, spareId)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, len(spare.Bricks) == 1, spare.Bricks)
+		b, err := NewBrickEntryFromId(tx, spare.Bricks[0])
+		tests.Assert(t, err == nil)
+		tests.Assert(t, b.Info.VolumeId == plan.Moves[0].VolumeId, b.Info)
+
+		d, err := NewDeviceEntryFromId(tx, plan.Moves[0].From)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, len(d.Bricks) == 1, d.Bricks)
+		return nil
+	})
+
+	_, err = c.ClusterRebalancePlan("12345", req)
+	tests.Assert(t, err != nil)
+
+	_, err = c.ClusterRebalancePlan(clusterId,
+		&api.ClusterRebalanceRequest{Band: 200})
+	tests.Assert(t, err != nil)
+}
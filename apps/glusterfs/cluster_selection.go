@@ -0,0 +1,202 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/boltdb/bolt"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+)
+
+// Policies for choosing the cluster of a volume whose create request
+// does not list clusters
+const (
+	// Clusters are tried in the order they are listed in the db
+	ClusterSelectionOrdered = "ordered"
+
+	// Clusters with the most free space on their online devices are
+	// tried first
+	ClusterSelectionFreeCapacity = "free-capacity"
+
+	// Clusters with the fewest volumes are tried first
+	ClusterSelectionLeastVolumes = "least-volumes"
+
+	// Clusters are tried in turn, starting after the cluster of the
+	// last volume created
+	ClusterSelectionRoundRobin = "round-robin"
+)
+
+var (
+	// Default cluster selection policy
+	ClusterSelectionPolicy = ClusterSelectionOrdered
+)
+
+// clusterSelector ranks the clusters of the volume creates not listing
+// clusters. It keeps the cluster of the last volume created, where the
+// next round robin turn starts. A nil selector starts every turn from
+// the first cluster.
+type clusterSelector struct {
+	lock sync.Mutex
+	last string
+}
+
+func (s *clusterSelector) lastChosen() string {
+	if s == nil {
+		return ""
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.last
+}
+
+// chosen records the cluster a volume was created on
+func (s *clusterSelector) chosen(id string) {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.last = id
+}
+
+// rank orders the clusters by the selection policy
+func (s *clusterSelector) rank(tx *bolt.Tx, policy string,
+	clusters []string) ([]clusterRank, error) {
+
+	return rankClusters(tx, policy, clusters, s.lastChosen())
+}
+
+// clusterRank is a cluster ordered by a selection policy and why it
+// holds its place
+type clusterRank struct {
+	id     string
+	reason string
+}
+
+// clusterFree returns the space that can be allocated to new bricks on
+// the online devices of the online nodes of the cluster
+func clusterFree(tx *bolt.Tx, c *ClusterEntry) (uint64, error) {
+	var free uint64
+	for _, nodeId := range c.Info.Nodes {
+		node, err := NewNodeEntryFromId(tx, nodeId)
+		if err != nil {
+			return 0, err
+		}
+		if !node.isOnline() {
+			continue
+		}
+		for _, deviceId := range node.Devices {
+			device, err := NewDeviceEntryFromId(tx, deviceId)
+			if err != nil {
+				return 0, err
+			}
+			if device.isOnline() {
+				free += device.StorageAvailable()
+			}
+		}
+	}
+	return free, nil
+}
+
+// rankClusters orders the clusters by the selection policy, round
+// robin turns starting after the last cluster chosen. Clusters ranked
+// equal are kept in the order of their ids.
+func rankClusters(tx *bolt.Tx, policy string,
+	clusters []string, last string) ([]clusterRank, error) {
+
+	ids := make([]string, len(clusters))
+	copy(ids, clusters)
+	sort.Strings(ids)
+
+	ranks := []clusterRank{}
+	switch policy {
+	case ClusterSelectionFreeCapacity:
+		free := map[string]uint64{}
+		for _, id := range ids {
+			c, err := NewClusterEntryFromId(tx, id)
+			if err != nil {
+				return nil, err
+			}
+			if free[id], err = clusterFree(tx, c); err != nil {
+				return nil, err
+			}
+		}
+		sort.SliceStable(ids, func(i, j int) bool {
+			return free[ids[i]] > free[ids[j]]
+		})
+		for _, id := range ids {
+			ranks = append(ranks, clusterRank{id,
+				fmt.Sprintf("cluster with the most free capacity, %v GiB free", free[id]/GB)})
+		}
+
+	case ClusterSelectionLeastVolumes:
+		volumes := map[string]int{}
+		for _, id := range ids {
+			c, err := NewClusterEntryFromId(tx, id)
+			if err != nil {
+				return nil, err
+			}
+			volumes[id] = len(c.Info.Volumes)
+		}
+		sort.SliceStable(ids, func(i, j int) bool {
+			return volumes[ids[i]] < volumes[ids[j]]
+		})
+		for _, id := range ids {
+			ranks = append(ranks, clusterRank{id,
+				fmt.Sprintf("cluster with the fewest volumes, %v volumes", volumes[id])})
+		}
+
+	case ClusterSelectionRoundRobin:
+		start := sort.SearchStrings(ids, last)
+		if start < len(ids) && ids[start] == last {
+			start++
+		}
+		for i := range ids {
+			id := ids[(start+i)%len(ids)]
+			reason := "first cluster in turn"
+			if last != "" {
+				reason = fmt.Sprintf("next cluster in turn after cluster %v", last)
+			}
+			ranks = append(ranks, clusterRank{id, reason})
+		}
+
+	default:
+		for _, id := range clusters {
+			ranks = append(ranks, clusterRank{id, "first cluster in order"})
+		}
+	}
+	return ranks, nil
+}
+
+// clusterSelection returns why the cluster was chosen among the
+// clusters ranked by the policy, nil without ranks
+func clusterSelection(policy string, ranks []clusterRank,
+	cluster string) *api.ClusterSelection {
+
+	for index, rank := range ranks {
+		if rank.id != cluster {
+			continue
+		}
+		reason := "Chosen as the " + rank.reason
+		if index > 0 {
+			reason += fmt.Sprintf(", after %v clusters ranked before it "+
+				"could not hold the volume", index)
+		}
+		logger.Info("Volume to be created on cluster %v: %v", cluster, reason)
+		return &api.ClusterSelection{
+			Policy: policy,
+			Reason: reason,
+		}
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/tests"
+)
+
+func TestClusterSelectionPolicy(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	defer func(policy string) { ClusterSelectionPolicy = policy }(ClusterSelectionPolicy)
+
+	err := setupSampleDbWithTopology(app,
+		3,      // clusters
+		3,      // nodes_per_cluster
+		1,      // devices_per_node,
+		500*GB, // disksize
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	var clusters []string
+	app.db.View(func(tx *bolt.Tx) error {
+		clusters, err = ClusterList(tx)
+		return err
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(clusters) == 3, clusters)
+
+	create := func(size int, pinned ...string) *VolumeEntry {
+		req := &api.VolumeCreateRequest{}
+		req.Size = size
+		req.Clusters = pinned
+		req.Durability.Type = api.DurabilityReplicate
+		req.Durability.Replicate.Replica = 3
+		v := NewVolumeEntryFromRequest(req)
+		vc := NewVolumeCreateOperation(v, app.db)
+		vc.selector = app.clusters
+		err := RunOperation(vc, app.Allocator(), app.executor)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+		app.db.View(func(tx *bolt.Tx) error {
+			v, err = NewVolumeEntryFromId(tx, v.Info.Id)
+			return err
+		})
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		return v
+	}
+
+	// Clusters are tried in order by default, without reporting the
+	// selection
+	v := create(10)
+	tests.Assert(t, v.Info.Cluster == clusters[0], v.Info.Cluster)
+	tests.Assert(t, v.ClusterSelection == nil, v.ClusterSelection)
+
+	// Nor do the volumes pinned to clusters
+	ClusterSelectionPolicy = ClusterSelectionLeastVolumes
+	v = create(10, clusters[2])
+	tests.Assert(t, v.Info.Cluster == clusters[2], v.Info.Cluster)
+	tests.Assert(t, v.ClusterSelection == nil, v.ClusterSelection)
+
+	// The cluster without volumes is chosen first
+	v = create(10)
+	tests.Assert(t, v.Info.Cluster == clusters[1], v.Info.Cluster)
+	tests.Assert(t, strings.Contains(v.ClusterSelection.Reason, "0 volumes"),
+		v.ClusterSelection)
+
+	// Then the cluster with the most free space, the volumes of the
+	// other clusters being larger
+	create(100, clusters[0])
+	create(100, clusters[1])
+	ClusterSelectionPolicy = ClusterSelectionFreeCapacity
+	v = create(10)
+	tests.Assert(t, v.Info.Cluster == clusters[2], v.Info.Cluster)
+	tests.Assert(t, v.ClusterSelection.Policy == ClusterSelectionFreeCapacity,
+		v.ClusterSelection)
+
+	// Round robin goes on after the cluster of the last volume
+	ClusterSelectionPolicy = ClusterSelectionRoundRobin
+	for _, next := range []string{clusters[0], clusters[1], clusters[2], clusters[0]} {
+		v = create(10)
+		tests.Assert(t, v.Info.Cluster == next, v.Info.Cluster, next)
+	}
+	tests.Assert(t, strings.Contains(v.ClusterSelection.Reason, clusters[2]),
+		v.ClusterSelection)
+
+	// Clusters that can not hold the volume are skipped
+	app.db.Update(func(tx *bolt.Tx) error {
+		c, err := NewClusterEntryFromId(tx, clusters[1])
+		tests.Assert(t, err == nil)
+		for _, nodeId := range c.Info.Nodes {
+			n, err := NewNodeEntryFromId(tx, nodeId)
+			tests.Assert(t, err == nil)
+			n.State = api.EntryStateOffline
+			tests.Assert(t, n.Save(tx) == nil)
+		}
+		return nil
+	})
+	v = create(10)
+	tests.Assert(t, v.Info.Cluster == clusters[2], v.Info.Cluster)
+	tests.Assert(t, strings.Contains(v.ClusterSelection.Reason, "after 1 clusters"),
+		v.ClusterSelection)
+
+	// The selection is reported in the volume information
+	app.db.View(func(tx *bolt.Tx) error {
+		info, err := v.NewInfoResponse(tx)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, info.ClusterSelection != nil)
+		tests.Assert(t, info.ClusterSelection.Policy == ClusterSelectionRoundRobin)
+		return nil
+	})
+}
@@ -0,0 +1,185 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"bytes"
+	"encoding/gob"
+	"sort"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/heketi/heketi/executors"
+	wdb "github.com/heketi/heketi/pkg/db"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/lpabon/godbc"
+)
+
+const (
+	BOLTDB_BUCKET_COMMAND_OUTPUT = "COMMAND_OUTPUT"
+)
+
+var (
+	// Days the output of failed commands is kept
+	CommandOutputDays = 7
+)
+
+// CommandOutputEntry keeps the output of a command that failed on a
+// node, as the executor captured it
+type CommandOutputEntry struct {
+	Info   api.CommandOutputInfo
+	Stdout string
+	Stderr string
+	// Set when the beginning of the output was cut to the capture size
+	Truncated bool
+}
+
+func NewCommandOutputEntryFromId(tx *bolt.Tx, id string) (*CommandOutputEntry, error) {
+	godbc.Require(tx != nil)
+
+	entry := &CommandOutputEntry{}
+	err := EntryLoad(tx, entry, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+func (c *CommandOutputEntry) BucketName() string {
+	return BOLTDB_BUCKET_COMMAND_OUTPUT
+}
+
+func (c *CommandOutputEntry) Save(tx *bolt.Tx) error {
+	godbc.Require(tx != nil)
+	godbc.Require(c.Info.Id != "")
+
+	return EntrySave(tx, c, c.Info.Id)
+}
+
+func (c *CommandOutputEntry) Marshal() ([]byte, error) {
+	var buffer bytes.Buffer
+	enc := gob.NewEncoder(&buffer)
+	err := enc.Encode(*c)
+
+	return buffer.Bytes(), err
+}
+
+func (c *CommandOutputEntry) Unmarshal(buffer []byte) error {
+	dec := gob.NewDecoder(bytes.NewReader(buffer))
+	err := dec.Decode(c)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (c *CommandOutputEntry) NewInfoResponse() *api.CommandOutputInfoResponse {
+	return &api.CommandOutputInfoResponse{
+		CommandOutputInfo: c.Info,
+		Stdout:            c.Stdout,
+		Stderr:            c.Stderr,
+		Truncated:         c.Truncated,
+	}
+}
+
+// recordCommandOutput saves the output of the failed command and
+// removes the outputs older than the retention period
+func recordCommandOutput(db wdb.DB, o *executors.CommandOutput) error {
+	entry := &CommandOutputEntry{
+		Info: api.CommandOutputInfo{
+			Id:      o.Id,
+			Host:    o.Host,
+			Command: o.Command,
+			Error:   o.Error,
+			Created: time.Now().Unix(),
+		},
+		Stdout:    o.Stdout,
+		Stderr:    o.Stderr,
+		Truncated: o.Truncated,
+	}
+
+	cutoff := entry.Info.Created - int64(CommandOutputDays)*24*3600
+	return db.Update(func(tx *bolt.Tx) error {
+		if err := entry.Save(tx); err != nil {
+			return err
+		}
+
+		expired := []string{}
+		err := forEachDbEntry(tx,
+			func() DbEntry { return &CommandOutputEntry{} },
+			func(id string, e DbEntry, err error) error {
+				if err != nil {
+					logger.Warning("Removing command output %v that can not be read: %v",
+						id, err)
+					expired = append(expired, id)
+				} else if e.(*CommandOutputEntry).Info.Created < cutoff {
+					expired = append(expired, id)
+				}
+				return nil
+			})
+		if err != nil {
+			return err
+		}
+		b := tx.Bucket([]byte(BOLTDB_BUCKET_COMMAND_OUTPUT))
+		for _, id := range expired {
+			if err := b.Delete([]byte(id)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// CommandOutputList returns the kept outputs of the failed commands,
+// oldest first
+func CommandOutputList(db wdb.RODB) ([]api.CommandOutputInfo, error) {
+	outputs := []api.CommandOutputInfo{}
+	err := db.View(func(tx *bolt.Tx) error {
+		return forEachDbEntry(tx,
+			func() DbEntry { return &CommandOutputEntry{} },
+			func(id string, e DbEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				outputs = append(outputs, e.(*CommandOutputEntry).Info)
+				return nil
+			})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(outputs, func(i, j int) bool {
+		return outputs[i].Created < outputs[j].Created
+	})
+	return outputs, nil
+}
+
+// setCommandOutputRecording lets the executor keep the output of the
+// commands that failed in the db
+func (a *App) setCommandOutputRecording() {
+	recorder, ok := a.executor.(executors.CommandOutputRecorder)
+	if !ok || a.dbReadOnly {
+		return
+	}
+
+	// The executor may be called while a db transaction is open, so
+	// the output is saved in the background
+	recorder.SetCommandOutputHandler(func(o *executors.CommandOutput) {
+		go func() {
+			if err := recordCommandOutput(a.db, o); err != nil {
+				logger.LogError("Unable to record output %v of command on %v: %v",
+					o.Id, o.Host, err)
+			}
+		}()
+	})
+}
@@ -0,0 +1,154 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/gorilla/mux"
+	client "github.com/heketi/heketi/client/api/go-client"
+	"github.com/heketi/heketi/executors"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/heketi/pkg/utils"
+	"github.com/heketi/tests"
+)
+
+func TestCommandOutput(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	c := client.NewClientNoAuth(ts.URL)
+	tests.Assert(t, c != nil)
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		3,    // nodes_per_cluster
+		2,    // devices_per_node,
+		2*TB, // disksize
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	req := &api.VolumeCreateRequest{}
+	req.Size = 10
+	req.Durability.Type = api.DurabilityReplicate
+	req.Durability.Replicate.Replica = 3
+	vol, err := c.VolumeCreate(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// The executor keeps the output of the failed command and the error
+	// of the operation refers to it
+	o := &executors.CommandOutput{
+		Id:      utils.GenUUID(),
+		Host:    "host0",
+		Command: "gluster volume add-brick",
+		Stdout:  "partial output",
+		Stderr:  "volume add-brick: failed",
+		Error:   "exit status 1",
+	}
+	app.xo.MockVolumeExpand = func(host string,
+		volume *executors.VolumeRequest) (*executors.Volume, error) {
+		err := recordCommandOutput(app.db, o)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		return nil, &utils.CommandError{
+			Message:  o.Stderr,
+			Command:  o.Command,
+			OutputId: o.Id,
+		}
+	}
+	_, err = c.VolumeExpand(vol.Id, &api.VolumeExpandRequest{Size: 10})
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	history, err := c.OperationHistory(vol.Id, "expand-volume", 0, 0)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(history.Operations) == 1, history.Operations)
+	tests.Assert(t, !history.Operations[0].Succeeded)
+	tests.Assert(t, history.Operations[0].Output == o.Id,
+		history.Operations[0])
+
+	output, err := c.CommandOutputInfo(o.Id)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, output.Host == o.Host, output)
+	tests.Assert(t, output.Command == o.Command, output)
+	tests.Assert(t, output.Stdout == o.Stdout, output)
+	tests.Assert(t, output.Stderr == o.Stderr, output)
+	tests.Assert(t, output.Error == o.Error, output)
+	tests.Assert(t, !output.Truncated, output)
+
+	list, err := c.CommandOutputList()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(list.Outputs) == 1, list.Outputs)
+	tests.Assert(t, list.Outputs[0] == output.CommandOutputInfo, list.Outputs)
+
+	_, err = c.CommandOutputInfo(utils.GenUUID())
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	// Operations failing with other errors are not linked to an output
+	app.xo.MockVolumeExpand = func(host string,
+		volume *executors.VolumeRequest) (*executors.Volume, error) {
+		return nil, ErrNotFound
+	}
+	_, err = c.VolumeExpand(vol.Id, &api.VolumeExpandRequest{Size: 10})
+	tests.Assert(t, err != nil, "expected err != nil")
+	history, err = c.OperationHistory(vol.Id, "expand-volume", 0, 0)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(history.Operations) == 2, history.Operations)
+	tests.Assert(t, history.Operations[1].Output == "", history.Operations[1])
+}
+
+func TestCommandOutputRetention(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	defer func(days int) { CommandOutputDays = days }(CommandOutputDays)
+	CommandOutputDays = 2
+
+	old := &CommandOutputEntry{
+		Info: api.CommandOutputInfo{
+			Id:      utils.GenUUID(),
+			Created: time.Now().Add(-3 * 24 * time.Hour).Unix(),
+		},
+	}
+	recent := &CommandOutputEntry{
+		Info: api.CommandOutputInfo{
+			Id:      utils.GenUUID(),
+			Created: time.Now().Add(-1 * 24 * time.Hour).Unix(),
+		},
+	}
+	err := app.db.Update(func(tx *bolt.Tx) error {
+		tests.Assert(t, old.Save(tx) == nil)
+		return recent.Save(tx)
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	o := &executors.CommandOutput{Id: utils.GenUUID(), Host: "host0"}
+	err = recordCommandOutput(app.db, o)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	outputs, err := CommandOutputList(app.db)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(outputs) == 2, outputs)
+	tests.Assert(t, outputs[0].Id == recent.Info.Id, outputs)
+	tests.Assert(t, outputs[1].Id == o.Id, outputs)
+}
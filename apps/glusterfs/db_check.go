@@ -0,0 +1,302 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/boltdb/bolt"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/heketi/pkg/utils"
+)
+
+// dbChecker keeps the entries of the db checked for consistency and
+// the entries changed to repair them
+type dbChecker struct {
+	clusters map[string]*ClusterEntry
+	nodes    map[string]*NodeEntry
+	devices  map[string]*DeviceEntry
+	volumes  map[string]*VolumeEntry
+	bricks   map[string]*BrickEntry
+
+	repair  bool
+	changed map[string]DbEntry
+	issues  []api.DbCheckIssue
+}
+
+// report records an issue of an entry. If fix is not nil and the check
+// repairs the db, fix is called to update the entry, which is saved.
+func (c *dbChecker) report(issueType string, entry DbEntry, id string,
+	fix func(), format string, args ...interface{}) {
+
+	issue := api.DbCheckIssue{
+		Type:    issueType,
+		Kind:    strings.ToLower(entry.BucketName()),
+		Id:      id,
+		Message: fmt.Sprintf(format, args...),
+	}
+	if c.repair && fix != nil {
+		fix()
+		c.changed[id] = entry
+		issue.Repaired = true
+	}
+	logger.Warning("%v %v: %v", issue.Kind, id, issue.Message)
+	c.issues = append(c.issues, issue)
+}
+
+// load reads the entries of the bucket of the kind of entry newEntry
+// returns. Entries that can not be read are reported and skipped.
+func (c *dbChecker) load(tx *bolt.Tx,
+	newEntry func() DbEntry,
+	add func(id string, entry DbEntry)) error {
+
+	return forEachDbEntry(tx, newEntry,
+		func(id string, entry DbEntry, err error) error {
+			if err != nil {
+				c.report(api.DbCheckCorruptEntry, entry, id, nil,
+					"entry can not be read: %v", err)
+				return nil
+			}
+			add(id, entry)
+			return nil
+		})
+}
+
+func (c *dbChecker) checkClusters() {
+	for id, cluster := range c.clusters {
+		for _, nodeId := range append([]string{}, cluster.Info.Nodes...) {
+			if _, ok := c.nodes[nodeId]; !ok {
+				c.report(api.DbCheckMissingEntry, cluster, id,
+					func() { cluster.NodeDelete(nodeId) },
+					"node %v not found", nodeId)
+			}
+		}
+		for _, volumeId := range append([]string{}, cluster.Info.Volumes...) {
+			if _, ok := c.volumes[volumeId]; !ok {
+				c.report(api.DbCheckMissingEntry, cluster, id,
+					func() { cluster.VolumeDelete(volumeId) },
+					"volume %v not found", volumeId)
+			}
+		}
+	}
+}
+
+func (c *dbChecker) checkNodes() {
+	for id, node := range c.nodes {
+		if cluster, ok := c.clusters[node.Info.ClusterId]; !ok {
+			c.report(api.DbCheckMissingEntry, node, id, nil,
+				"cluster %v not found", node.Info.ClusterId)
+		} else if !utils.SortedStringHas(cluster.Info.Nodes, id) {
+			c.report(api.DbCheckUnlinkedEntry, cluster, cluster.Info.Id,
+				func() { cluster.NodeAdd(id) },
+				"node %v of the cluster is not in its list of nodes", id)
+		}
+		for _, deviceId := range append([]string{}, node.Devices...) {
+			if _, ok := c.devices[deviceId]; !ok {
+				c.report(api.DbCheckMissingEntry, node, id,
+					func() { node.DeviceDelete(deviceId) },
+					"device %v not found", deviceId)
+			}
+		}
+	}
+}
+
+func (c *dbChecker) checkDevices() {
+	for id, device := range c.devices {
+		if node, ok := c.nodes[device.NodeId]; !ok {
+			c.report(api.DbCheckMissingEntry, device, id, nil,
+				"node %v not found", device.NodeId)
+		} else if !utils.SortedStringHas(node.Devices, id) {
+			c.report(api.DbCheckUnlinkedEntry, node, node.Info.Id,
+				func() { node.DeviceAdd(id) },
+				"device %v of the node is not in its list of devices", id)
+		}
+		for _, brickId := range append([]string{}, device.Bricks...) {
+			brick, ok := c.bricks[brickId]
+			if !ok {
+				c.report(api.DbCheckMissingEntry, device, id,
+					func() { device.BrickDelete(brickId) },
+					"brick %v not found", brickId)
+			} else if brick.Info.DeviceId != id {
+				c.report(api.DbCheckUnlinkedEntry, device, id,
+					func() { device.BrickDelete(brickId) },
+					"brick %v belongs to device %v", brickId, brick.Info.DeviceId)
+			}
+		}
+	}
+}
+
+func (c *dbChecker) checkVolumes() {
+	for id, volume := range c.volumes {
+		if cluster, ok := c.clusters[volume.Info.Cluster]; !ok {
+			c.report(api.DbCheckMissingEntry, volume, id, nil,
+				"cluster %v not found", volume.Info.Cluster)
+		} else if volume.Pending.Id == "" &&
+			!utils.SortedStringHas(cluster.Info.Volumes, id) {
+			c.report(api.DbCheckUnlinkedEntry, cluster, cluster.Info.Id,
+				func() { cluster.VolumeAdd(id) },
+				"volume %v of the cluster is not in its list of volumes", id)
+		}
+		for _, brickId := range volume.BricksIds() {
+			brick, ok := c.bricks[brickId]
+			if !ok {
+				c.report(api.DbCheckMissingEntry, volume, id,
+					func() { volume.BrickDelete(brickId) },
+					"brick %v not found", brickId)
+			} else if brick.Info.VolumeId != id {
+				c.report(api.DbCheckUnlinkedEntry, volume, id,
+					func() { volume.BrickDelete(brickId) },
+					"brick %v belongs to volume %v", brickId, brick.Info.VolumeId)
+			}
+		}
+	}
+}
+
+func (c *dbChecker) checkBricks() {
+	for id, brick := range c.bricks {
+		if _, ok := c.nodes[brick.Info.NodeId]; !ok {
+			c.report(api.DbCheckMissingEntry, brick, id, nil,
+				"node %v not found", brick.Info.NodeId)
+		}
+		if volume, ok := c.volumes[brick.Info.VolumeId]; !ok {
+			c.report(api.DbCheckMissingEntry, brick, id, nil,
+				"volume %v not found", brick.Info.VolumeId)
+		} else if !utils.SortedStringHas(volume.Bricks, id) {
+			c.report(api.DbCheckUnlinkedEntry, volume, volume.Info.Id,
+				func() { volume.BrickAdd(id) },
+				"brick %v of the volume is not in its list of bricks", id)
+		}
+		if device, ok := c.devices[brick.Info.DeviceId]; !ok {
+			c.report(api.DbCheckMissingEntry, brick, id, nil,
+				"device %v not found", brick.Info.DeviceId)
+		} else if !utils.SortedStringHas(device.Bricks, id) {
+			c.report(api.DbCheckUnlinkedEntry, device, device.Info.Id,
+				func() { device.BrickAdd(id) },
+				"brick %v of the device is not in its list of bricks", id)
+		}
+	}
+}
+
+// checkStorage compares the used storage of every device with the
+// space of its bricks. It runs after the lists of bricks of the devices
+// were repaired.
+func (c *dbChecker) checkStorage() {
+	for id, device := range c.devices {
+		var used uint64
+		for _, brickId := range device.Bricks {
+			if brick, ok := c.bricks[brickId]; ok {
+				used += brick.TotalSize()
+			}
+		}
+		if device.Info.Storage.Used == used {
+			continue
+		}
+		var fix func()
+		if used <= device.Info.Storage.Total {
+			fix = func() {
+				device.Info.Storage.Used = used
+				device.Info.Storage.Free = device.Info.Storage.Total - used
+			}
+		}
+		c.report(api.DbCheckStorageMismatch, device, id, fix,
+			"used storage %v differs from the %v of its bricks, total %v",
+			device.Info.Storage.Used, used, device.Info.Storage.Total)
+	}
+}
+
+// dbCheck checks that the entries of the db refer to each other: the
+// clusters, nodes, devices, volumes and bricks an entry refers to exist
+// and list the entry, and the used storage of every device is the
+// space of its bricks. With repair, references to missing entries are
+// removed, missing references are added and the storage of the devices
+// is updated. Entries referring to a missing entry they belong to can
+// not be repaired.
+func dbCheck(tx *bolt.Tx, repair bool) (*api.DbCheckResponse, error) {
+	c := &dbChecker{
+		clusters: map[string]*ClusterEntry{},
+		nodes:    map[string]*NodeEntry{},
+		devices:  map[string]*DeviceEntry{},
+		volumes:  map[string]*VolumeEntry{},
+		bricks:   map[string]*BrickEntry{},
+		repair:   repair,
+		changed:  map[string]DbEntry{},
+		issues:   []api.DbCheckIssue{},
+	}
+
+	loads := []struct {
+		newEntry func() DbEntry
+		add      func(id string, entry DbEntry)
+	}{
+		{func() DbEntry { return NewClusterEntry() },
+			func(id string, e DbEntry) { c.clusters[id] = e.(*ClusterEntry) }},
+		{func() DbEntry { return NewNodeEntry() },
+			func(id string, e DbEntry) { c.nodes[id] = e.(*NodeEntry) }},
+		{func() DbEntry { return NewDeviceEntry() },
+			func(id string, e DbEntry) { c.devices[id] = e.(*DeviceEntry) }},
+		{func() DbEntry { return NewVolumeEntry() },
+			func(id string, e DbEntry) { c.volumes[id] = e.(*VolumeEntry) }},
+		{func() DbEntry { return &BrickEntry{} },
+			func(id string, e DbEntry) { c.bricks[id] = e.(*BrickEntry) }},
+	}
+	for _, l := range loads {
+		if err := c.load(tx, l.newEntry, l.add); err != nil {
+			return nil, err
+		}
+	}
+
+	c.checkClusters()
+	c.checkNodes()
+	c.checkDevices()
+	c.checkVolumes()
+	c.checkBricks()
+	c.checkStorage()
+
+	sort.Slice(c.issues, func(i, j int) bool {
+		if c.issues[i].Kind != c.issues[j].Kind {
+			return c.issues[i].Kind < c.issues[j].Kind
+		}
+		if c.issues[i].Id != c.issues[j].Id {
+			return c.issues[i].Id < c.issues[j].Id
+		}
+		return c.issues[i].Message < c.issues[j].Message
+	})
+
+	if len(c.changed) != 0 {
+		if err := EntrySaveBatch(tx, c.changed); err != nil {
+			return nil, err
+		}
+	}
+	return &api.DbCheckResponse{Issues: c.issues}, nil
+}
+
+// DbCheck checks the consistency of a db file while the server is
+// stopped, repairing the inconsistencies if repair is set
+func DbCheck(dbfile string, repair bool, debug bool) (*api.DbCheckResponse, error) {
+	db, err := openDbFile(dbfile, !repair, debug)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	var resp *api.DbCheckResponse
+	check := func(tx *bolt.Tx) error {
+		var err error
+		resp, err = dbCheck(tx, repair)
+		return err
+	}
+	if repair {
+		err = db.Update(check)
+	} else {
+		err = db.View(check)
+	}
+	return resp, err
+}
@@ -0,0 +1,155 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/gorilla/mux"
+	client "github.com/heketi/heketi/client/api/go-client"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/heketi/pkg/utils"
+	"github.com/heketi/tests"
+)
+
+func TestDbCheck(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+	ts := httptest.NewServer(router)
+
+	c := client.NewClientNoAuth(ts.URL)
+	tests.Assert(t, c != nil)
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		3,    // nodes_per_cluster
+		1,    // devices_per_node,
+		1*TB, // disksize
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	vreq := &api.VolumeCreateRequest{}
+	vreq.Size = 100
+	vreq.Durability.Type = api.DurabilityReplicate
+	vreq.Durability.Replicate.Replica = 3
+	v, err := c.VolumeCreate(vreq)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	check, err := c.DbCheck()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(check.Issues) == 0, check.Issues)
+
+	// A volume missing one of its bricks, a device listing a brick that
+	// does not exist with the wrong used storage, a cluster listing a
+	// node that does not exist and a brick on a device that does not
+	// exist
+	unlinked := v.Bricks[0].Id
+	missing := utils.GenUUID()
+	orphan := utils.GenUUID()
+	var deviceId string
+	err = app.db.Update(func(tx *bolt.Tx) error {
+		volume, err := NewVolumeEntryFromId(tx, v.Id)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		volume.BrickDelete(unlinked)
+		tests.Assert(t, volume.Save(tx) == nil)
+
+		device, err := NewDeviceEntryFromId(tx, v.Bricks[1].DeviceId)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		deviceId = device.Info.Id
+		device.BrickAdd(missing)
+		device.StorageAllocate(1000)
+		tests.Assert(t, device.Save(tx) == nil)
+
+		cluster, err := NewClusterEntryFromId(tx, v.Cluster)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		cluster.NodeAdd("abc")
+		tests.Assert(t, cluster.Save(tx) == nil)
+
+		brick, err := NewBrickEntryFromId(tx, v.Bricks[2].Id)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		brick.Info.Id = orphan
+		brick.Info.DeviceId = "def"
+		return brick.Save(tx)
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	issues := func(check *api.DbCheckResponse) map[string]api.DbCheckIssue {
+		found := map[string]api.DbCheckIssue{}
+		for _, i := range check.Issues {
+			found[i.Type+" "+i.Kind+" "+i.Id] = i
+		}
+		return found
+	}
+
+	check, err = c.DbCheck()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	found := issues(check)
+	for _, key := range []string{
+		api.DbCheckMissingEntry + " cluster " + v.Cluster,
+		api.DbCheckMissingEntry + " device " + deviceId,
+		api.DbCheckStorageMismatch + " device " + deviceId,
+		api.DbCheckUnlinkedEntry + " volume " + v.Id,
+		api.DbCheckMissingEntry + " brick " + orphan,
+	} {
+		i, ok := found[key]
+		tests.Assert(t, ok, "issue not found:", key, check.Issues)
+		tests.Assert(t, !i.Repaired, i)
+	}
+	// The orphan brick is not on the list of its volume either
+	tests.Assert(t, len(check.Issues) == 6, check.Issues)
+
+	ts.Close()
+	app.Close()
+
+	// Only the issues that can be repaired are
+	check, err = DbCheck(tmpfile, true, false)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(check.Issues) == 6, check.Issues)
+	for _, i := range check.Issues {
+		tests.Assert(t, i.Repaired == (i.Kind != "brick"), i)
+	}
+
+	check, err = DbCheck(tmpfile, false, false)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(check.Issues) == 1, check.Issues)
+	tests.Assert(t, check.Issues[0].Id == orphan, check.Issues)
+
+	app = NewTestApp(tmpfile)
+	defer app.Close()
+	err = app.db.View(func(tx *bolt.Tx) error {
+		volume, err := NewVolumeEntryFromId(tx, v.Id)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, utils.SortedStringHas(volume.Bricks, unlinked),
+			volume.Bricks)
+		tests.Assert(t, utils.SortedStringHas(volume.Bricks, orphan),
+			volume.Bricks)
+
+		device, err := NewDeviceEntryFromId(tx, deviceId)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, !utils.SortedStringHas(device.Bricks, missing),
+			device.Bricks)
+		tests.Assert(t, device.Info.Storage.Used+device.Info.Storage.Free ==
+			device.Info.Storage.Total, device.Info.Storage)
+
+		cluster, err := NewClusterEntryFromId(tx, v.Cluster)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, !utils.SortedStringHas(cluster.Info.Nodes, "abc"),
+			cluster.Info.Nodes)
+		return nil
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+}
@@ -0,0 +1,106 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/boltdb/bolt"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+)
+
+// adoptDeviceStorage sets the storage of the device to the supplied
+// sizes. A total of zero is taken to be the sum of the free and used
+// sizes, otherwise the sizes must add up.
+func adoptDeviceStorage(tx *bolt.Tx, id string, storage api.StorageSize) error {
+	device, err := NewDeviceEntryFromId(tx, id)
+	if err == ErrNotFound {
+		return fmt.Errorf("No device entry with id %v", id)
+	} else if err != nil {
+		return err
+	}
+
+	if storage.Total == 0 {
+		storage.Total = storage.Free + storage.Used
+	}
+	if storage.Free+storage.Used != storage.Total {
+		return fmt.Errorf("Storage of device %v does not add up: "+
+			"free %v + used %v != total %v",
+			id, storage.Free, storage.Used, storage.Total)
+	}
+
+	var allocated uint64
+	for _, brickId := range device.Bricks {
+		brick, err := NewBrickEntryFromId(tx, brickId)
+		if err != nil {
+			return err
+		}
+		allocated += brick.TpSize + brick.PoolMetadataSize
+	}
+	if storage.Used < allocated {
+		logger.Warning("Used storage %v of device %v is less than the %v "+
+			"allocated to its bricks", storage.Used, id, allocated)
+	}
+
+	logger.Info("Adopting storage of device %v, total: %v -> %v, "+
+		"free: %v -> %v, used: %v -> %v",
+		id,
+		device.Info.Storage.Total, storage.Total,
+		device.Info.Storage.Free, storage.Free,
+		device.Info.Storage.Used, storage.Used)
+	device.Info.Storage = storage
+	return device.Save(tx)
+}
+
+// DbAdoptDeviceStorage sets the storage of devices of a db file to the
+// sizes read from a JSON file mapping device ids to their total, free
+// and used sizes in KB, without probing the nodes. It is meant for
+// rebuilding a db while the nodes can not be reached. Either all of the
+// devices are updated or none of them.
+func DbAdoptDeviceStorage(dbfile string, jsonfile string, debug bool) error {
+	fp, err := os.Open(jsonfile)
+	if err != nil {
+		return fmt.Errorf("Could not open input file: %v", err.Error())
+	}
+	defer fp.Close()
+
+	var sizes map[string]api.StorageSize
+	if err := json.NewDecoder(fp).Decode(&sizes); err != nil {
+		return fmt.Errorf("Could not decode input file as JSON: %v", err.Error())
+	}
+	if len(sizes) == 0 {
+		return fmt.Errorf("No device storage found in %v", jsonfile)
+	}
+
+	db, err := openDbFile(dbfile, false, debug)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ids := []string{}
+	for id := range sizes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	return db.Update(func(tx *bolt.Tx) error {
+		for _, id := range ids {
+			if err := adoptDeviceStorage(tx, id, sizes[id]); err != nil {
+				return err
+			}
+		}
+		// the storage of the devices was not reported by the nodes
+		return recordNewDBGenerationID(tx)
+	})
+}
@@ -0,0 +1,113 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/tests"
+)
+
+func TestDbAdoptDeviceStorage(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+	jsonfile := tests.Tempfile()
+	defer os.Remove(jsonfile)
+
+	app := NewTestApp(tmpfile)
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		2,    // nodes_per_cluster
+		1,    // devices_per_node,
+		1*TB, // disksize
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	var devices []string
+	var generation string
+	err = app.db.View(func(tx *bolt.Tx) error {
+		var err error
+		devices, err = DeviceList(tx)
+		if err != nil {
+			return err
+		}
+		entry, err := NewDbAttributeEntryFromKey(tx, DB_GENERATION_ID)
+		if err != nil {
+			return err
+		}
+		generation = entry.Value
+		return nil
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(devices) == 2, devices)
+	app.Close()
+
+	adopt := func(content string) error {
+		err := ioutil.WriteFile(jsonfile, []byte(content), 0600)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		return DbAdoptDeviceStorage(tmpfile, jsonfile, false)
+	}
+	storage := func() map[string]api.StorageSize {
+		db, err := bolt.Open(tmpfile, 0600, &bolt.Options{Timeout: 3 * time.Second})
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		defer db.Close()
+		sizes := map[string]api.StorageSize{}
+		err = db.View(func(tx *bolt.Tx) error {
+			for _, id := range devices {
+				d, err := NewDeviceEntryFromId(tx, id)
+				if err != nil {
+					return err
+				}
+				sizes[id] = d.Info.Storage
+			}
+			entry, err := NewDbAttributeEntryFromKey(tx, DB_GENERATION_ID)
+			if err != nil {
+				return err
+			}
+			generation = entry.Value
+			return nil
+		})
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		return sizes
+	}
+	before := storage()
+	oldGeneration := generation
+
+	// Sizes that do not add up are rejected and no device is updated
+	err = adopt(`{"` + devices[0] + `": {"total": 1000, "free": 600, "used": 300},
+		"` + devices[1] + `": {"free": 600, "used": 400}}`)
+	tests.Assert(t, err != nil, "expected err != nil")
+	tests.Assert(t, strings.Contains(err.Error(), "does not add up"), err)
+	err = adopt(`{"` + devices[0] + `": {"total": 1000, "free": 600, "used": 400},
+		"abc": {"total": 1000, "free": 600, "used": 400}}`)
+	tests.Assert(t, err != nil, "expected err != nil")
+	tests.Assert(t, strings.Contains(err.Error(), "No device entry with id abc"), err)
+	err = adopt(`{}`)
+	tests.Assert(t, err != nil, "expected err != nil")
+	tests.Assert(t, storage()[devices[0]] == before[devices[0]],
+		storage()[devices[0]], before[devices[0]])
+	tests.Assert(t, generation == oldGeneration, generation, oldGeneration)
+
+	err = adopt(`{"` + devices[0] + `": {"total": 1000, "free": 600, "used": 400},
+		"` + devices[1] + `": {"free": 700, "used": 100}}`)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	after := storage()
+	tests.Assert(t, after[devices[0]] == api.StorageSize{Total: 1000, Free: 600, Used: 400},
+		after[devices[0]])
+	tests.Assert(t, after[devices[1]] == api.StorageSize{Total: 800, Free: 700, Used: 100},
+		after[devices[1]])
+	tests.Assert(t, generation != oldGeneration, generation, oldGeneration)
+}
@@ -0,0 +1,348 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/heketi/heketi/pkg/utils"
+)
+
+// Kinds of the entries inspected by the offline db commands
+const (
+	DbKindVolume = "volume"
+	DbKindBrick  = "brick"
+	DbKindDevice = "device"
+)
+
+// newDbKindEntry returns an empty entry of the kind, plural names of
+// the kinds are accepted
+func newDbKindEntry(kind string) (DbEntry, error) {
+	switch strings.TrimSuffix(kind, "s") {
+	case DbKindVolume:
+		return NewVolumeEntry(), nil
+	case DbKindBrick:
+		return &BrickEntry{}, nil
+	case DbKindDevice:
+		return NewDeviceEntry(), nil
+	}
+	return nil, fmt.Errorf("Unknown kind of entry %v, must be one of %v, %v or %v",
+		kind, DbKindVolume, DbKindBrick, DbKindDevice)
+}
+
+// openDbFile opens the db file of a stopped server
+func openDbFile(dbfile string, readOnly bool, debug bool) (*bolt.DB, error) {
+	if debug {
+		logger.SetLevel(utils.LEVEL_DEBUG)
+	}
+	db, err := bolt.Open(dbfile, 0600, &bolt.Options{
+		Timeout:  3 * time.Second,
+		ReadOnly: readOnly,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Unable to open database: %v", err)
+	}
+	return db, nil
+}
+
+// forEachDbEntry calls f with every entry of the bucket of the kind of
+// entry newEntry returns. Entries that can not be read are passed to f
+// with the error reading them. Buckets missing in older dbs are empty.
+func forEachDbEntry(tx *bolt.Tx,
+	newEntry func() DbEntry,
+	f func(id string, entry DbEntry, err error) error) error {
+
+	b := tx.Bucket([]byte(newEntry().BucketName()))
+	if b == nil {
+		return nil
+	}
+	return b.ForEach(func(k, v []byte) error {
+		entry := newEntry()
+		err := entry.Unmarshal(v)
+		return f(string(k), entry, err)
+	})
+}
+
+// dbEntrySummary returns a line describing the entry
+func dbEntrySummary(entry DbEntry) string {
+	switch e := entry.(type) {
+	case *VolumeEntry:
+		s := fmt.Sprintf("Id:%v Name:%v Size:%v Cluster:%v Bricks:%v",
+			e.Info.Id, e.Info.Name, e.Info.Size, e.Info.Cluster, len(e.Bricks))
+		if e.Pending.Id != "" {
+			s += fmt.Sprintf(" Pending:%v", e.Pending.Id)
+		}
+		return s
+	case *BrickEntry:
+		s := fmt.Sprintf("Id:%v Path:%v Size:%v Device:%v Node:%v Volume:%v",
+			e.Info.Id, e.Info.Path, e.Info.Size, e.Info.DeviceId,
+			e.Info.NodeId, e.Info.VolumeId)
+		if e.Pending.Id != "" {
+			s += fmt.Sprintf(" Pending:%v", e.Pending.Id)
+		}
+		return s
+	case *DeviceEntry:
+		return fmt.Sprintf("Id:%v Name:%v Node:%v State:%v Size:%v Used:%v Bricks:%v",
+			e.Info.Id, e.Info.Name, e.NodeId, e.State,
+			e.Info.Storage.Total, e.Info.Storage.Used, len(e.Bricks))
+	}
+	return ""
+}
+
+// DbListEntries writes a line for every volume, brick or device entry
+// of a db file while the server is stopped. Entries that can not be
+// read are listed as corrupt.
+func DbListEntries(w io.Writer, dbfile string, kind string, debug bool) error {
+	if _, err := newDbKindEntry(kind); err != nil {
+		return err
+	}
+	db, err := openDbFile(dbfile, true, debug)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.View(func(tx *bolt.Tx) error {
+		return forEachDbEntry(tx,
+			func() DbEntry {
+				e, _ := newDbKindEntry(kind)
+				return e
+			},
+			func(id string, entry DbEntry, err error) error {
+				if err != nil {
+					fmt.Fprintf(w, "Id:%v Corrupt:%v\n", id, err)
+				} else {
+					fmt.Fprintln(w, dbEntrySummary(entry))
+				}
+				return nil
+			})
+	})
+}
+
+// DbShowEntry writes the volume, brick or device entry of a db file as
+// JSON while the server is stopped
+func DbShowEntry(w io.Writer, dbfile string, kind string, id string, debug bool) error {
+	entry, err := newDbKindEntry(kind)
+	if err != nil {
+		return err
+	}
+	db, err := openDbFile(dbfile, true, debug)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	err = db.View(func(tx *bolt.Tx) error {
+		return EntryLoad(tx, entry, id)
+	})
+	if err == ErrNotFound {
+		return fmt.Errorf("No %v entry with id %v", kind, id)
+	} else if err != nil {
+		return fmt.Errorf("Unable to read %v entry %v: %v", kind, id, err)
+	}
+
+	data, err := json.MarshalIndent(entry, "", "    ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(data))
+	return err
+}
+
+// dbEntryDependents returns the entries that would refer to a missing
+// entry if the entry was deleted
+func dbEntryDependents(tx *bolt.Tx, kind string, id string) ([]string, error) {
+	dependents := []string{}
+	var err error
+	switch strings.TrimSuffix(kind, "s") {
+	case DbKindVolume:
+		err = forEachDbEntry(tx,
+			func() DbEntry { return &BrickEntry{} },
+			func(bid string, entry DbEntry, err error) error {
+				if err == nil && entry.(*BrickEntry).Info.VolumeId == id {
+					dependents = append(dependents, "brick "+bid)
+				}
+				return nil
+			})
+		if err != nil {
+			return nil, err
+		}
+		err = forEachDbEntry(tx,
+			func() DbEntry { return NewBlockVolumeEntry() },
+			func(bvid string, entry DbEntry, err error) error {
+				if err == nil &&
+					entry.(*BlockVolumeEntry).Info.BlockHostingVolume == id {
+					dependents = append(dependents, "block volume "+bvid)
+				}
+				return nil
+			})
+		if err != nil {
+			return nil, err
+		}
+		err = forEachDbEntry(tx,
+			func() DbEntry { return NewSnapshotEntry() },
+			func(sid string, entry DbEntry, err error) error {
+				if err == nil && entry.(*SnapshotEntry).Info.OriginVolume == id {
+					dependents = append(dependents, "snapshot "+sid)
+				}
+				return nil
+			})
+	case DbKindDevice:
+		err = forEachDbEntry(tx,
+			func() DbEntry { return &BrickEntry{} },
+			func(bid string, entry DbEntry, err error) error {
+				if err == nil && entry.(*BrickEntry).Info.DeviceId == id {
+					dependents = append(dependents, "brick "+bid)
+				}
+				return nil
+			})
+	}
+	sort.Strings(dependents)
+	return dependents, err
+}
+
+// unlinkDbEntry removes the entry from the lists of the entries it
+// belongs to. A brick that can be read gives its space back to its
+// device.
+func unlinkDbEntry(tx *bolt.Tx, kind string, id string, entry DbEntry) error {
+	switch strings.TrimSuffix(kind, "s") {
+	case DbKindVolume:
+		return updateDbEntries(tx,
+			func() DbEntry { return NewClusterEntry() },
+			func(e DbEntry) bool {
+				c := e.(*ClusterEntry)
+				if utils.SortedStringHas(c.Info.Volumes, id) {
+					c.VolumeDelete(id)
+					return true
+				}
+				return false
+			})
+	case DbKindBrick:
+		err := updateDbEntries(tx,
+			func() DbEntry { return NewVolumeEntry() },
+			func(e DbEntry) bool {
+				v := e.(*VolumeEntry)
+				if utils.SortedStringHas(v.Bricks, id) {
+					v.BrickDelete(id)
+					return true
+				}
+				return false
+			})
+		if err != nil {
+			return err
+		}
+		return updateDbEntries(tx,
+			func() DbEntry { return NewDeviceEntry() },
+			func(e DbEntry) bool {
+				d := e.(*DeviceEntry)
+				if !utils.SortedStringHas(d.Bricks, id) {
+					return false
+				}
+				d.BrickDelete(id)
+				if b, ok := entry.(*BrickEntry); ok && b.Info.DeviceId == d.Info.Id {
+					d.StorageFree(b.TotalSize())
+				}
+				return true
+			})
+	case DbKindDevice:
+		return updateDbEntries(tx,
+			func() DbEntry { return NewNodeEntry() },
+			func(e DbEntry) bool {
+				n := e.(*NodeEntry)
+				if utils.SortedStringHas(n.Devices, id) {
+					n.DeviceDelete(id)
+					return true
+				}
+				return false
+			})
+	}
+	return nil
+}
+
+// updateDbEntries saves the entries of the bucket that update changed.
+// Entries that can not be read are skipped.
+func updateDbEntries(tx *bolt.Tx,
+	newEntry func() DbEntry,
+	update func(e DbEntry) bool) error {
+
+	changed := map[string]DbEntry{}
+	err := forEachDbEntry(tx, newEntry,
+		func(id string, entry DbEntry, err error) error {
+			if err != nil {
+				logger.Warning("Skipping entry %v that can not be read: %v",
+					id, err)
+				return nil
+			}
+			if update(entry) {
+				changed[id] = entry
+			}
+			return nil
+		})
+	if err != nil {
+		return err
+	}
+	for id, entry := range changed {
+		logger.Info("Removing reference from %v entry %v",
+			strings.ToLower(entry.BucketName()), id)
+	}
+	return EntrySaveBatch(tx, changed)
+}
+
+// DbDeleteEntry deletes a volume, brick or device entry, such as an
+// entry that can not be read, from a db file while the server is
+// stopped. The entry is removed from the lists of the entries it
+// belongs to. Entries still in use by other entries are not deleted.
+func DbDeleteEntry(dbfile string, kind string, id string, debug bool) error {
+	entry, err := newDbKindEntry(kind)
+	if err != nil {
+		return err
+	}
+	db, err := openDbFile(dbfile, false, debug)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(entry.BucketName()))
+		if b == nil {
+			return ErrDbAccess
+		}
+		val := b.Get([]byte(id))
+		if val == nil {
+			return fmt.Errorf("No %v entry with id %v", kind, id)
+		}
+		if err := entry.Unmarshal(val); err != nil {
+			logger.Warning("Deleting %v entry %v that can not be read: %v",
+				kind, id, err)
+			entry = nil
+		}
+
+		dependents, err := dbEntryDependents(tx, kind, id)
+		if err != nil {
+			return err
+		}
+		if len(dependents) > 0 {
+			return fmt.Errorf("Unable to delete %v %v, it is used by: %v",
+				kind, id, strings.Join(dependents, ", "))
+		}
+
+		if err := unlinkDbEntry(tx, kind, id, entry); err != nil {
+			return err
+		}
+		return b.Delete([]byte(id))
+	})
+}
@@ -0,0 +1,148 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/heketi/pkg/utils"
+	"github.com/heketi/tests"
+)
+
+func TestDbInspectEntries(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		3,    // nodes_per_cluster
+		1,    // devices_per_node,
+		5*TB, // disksize
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	vreq := &api.VolumeCreateRequest{}
+	vreq.Size = 100
+	vreq.Durability.Type = api.DurabilityReplicate
+	vreq.Durability.Replicate.Replica = 3
+	v := NewVolumeEntryFromRequest(vreq)
+	err = v.Create(app.db, app.executor, app.Allocator())
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// A corrupt brick entry and an unused device
+	corruptId := utils.GenUUID()
+	var unused *DeviceEntry
+	err = app.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(BOLTDB_BUCKET_BRICK))
+		if err := b.Put([]byte(corruptId), []byte("bzzt")); err != nil {
+			return err
+		}
+		brick, err := NewBrickEntryFromId(tx, v.Bricks[0])
+		if err != nil {
+			return err
+		}
+		d, err := NewDeviceEntryFromId(tx, brick.Info.DeviceId)
+		if err != nil {
+			return err
+		}
+		d.BrickAdd(corruptId)
+		if err := d.Save(tx); err != nil {
+			return err
+		}
+		node, err := NewNodeEntryFromId(tx, d.NodeId)
+		if err != nil {
+			return err
+		}
+		unused = createSampleDeviceEntry(node.Info.Id, 1*TB)
+		node.DeviceAdd(unused.Info.Id)
+		if err := node.Save(tx); err != nil {
+			return err
+		}
+		return unused.Save(tx)
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	app.Close()
+
+	var out bytes.Buffer
+	err = DbListEntries(&out, tmpfile, "bricks", false)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	tests.Assert(t, len(lines) == 4, lines)
+	tests.Assert(t, strings.Contains(out.String(), "Id:"+corruptId+" Corrupt:"),
+		out.String())
+	tests.Assert(t, strings.Contains(out.String(), "Volume:"+v.Info.Id),
+		out.String())
+
+	out.Reset()
+	err = DbListEntries(&out, tmpfile, "volume", false)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, strings.HasPrefix(out.String(), "Id:"+v.Info.Id+" "),
+		out.String())
+
+	err = DbListEntries(&out, tmpfile, "cluster", false)
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	out.Reset()
+	err = DbShowEntry(&out, tmpfile, "volume", v.Info.Id, false)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	shown := NewVolumeEntry()
+	err = json.Unmarshal(out.Bytes(), shown)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, shown.Info.Name == v.Info.Name, shown.Info.Name)
+
+	err = DbShowEntry(&out, tmpfile, "brick", corruptId, false)
+	tests.Assert(t, err != nil, "expected err != nil")
+	err = DbShowEntry(&out, tmpfile, "brick", "abc", false)
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	// Entries in use are not deleted
+	err = DbDeleteEntry(tmpfile, "volume", v.Info.Id, false)
+	tests.Assert(t, err != nil, "expected err != nil")
+	tests.Assert(t, strings.Contains(err.Error(), "brick "+v.Bricks[0]), err)
+
+	err = DbDeleteEntry(tmpfile, "brick", corruptId, false)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	err = DbDeleteEntry(tmpfile, "device", unused.Info.Id, false)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	err = DbDeleteEntry(tmpfile, "device", unused.Info.Id, false)
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	db, err := bolt.Open(tmpfile, 0600, &bolt.Options{Timeout: 3 * time.Second})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	err = db.View(func(tx *bolt.Tx) error {
+		_, err := NewBrickEntryFromId(tx, corruptId)
+		tests.Assert(t, err == ErrNotFound, err)
+		_, err = NewDeviceEntryFromId(tx, unused.Info.Id)
+		tests.Assert(t, err == ErrNotFound, err)
+
+		devices, err := DeviceList(tx)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		for _, id := range devices {
+			d, err := NewDeviceEntryFromId(tx, id)
+			tests.Assert(t, err == nil, "expected err == nil, got:", err)
+			tests.Assert(t, !utils.SortedStringHas(d.Bricks, corruptId), d.Bricks)
+			node, err := NewNodeEntryFromId(tx, d.NodeId)
+			tests.Assert(t, err == nil, "expected err == nil, got:", err)
+			tests.Assert(t, !utils.SortedStringHas(node.Devices, unused.Info.Id),
+				node.Devices)
+		}
+		return nil
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	db.Close()
+}
@@ -16,7 +16,8 @@ import (
 )
 
 const (
-	DB_GENERATION_ID = "DB_GENERATION_ID"
+	DB_GENERATION_ID   = "DB_GENERATION_ID"
+	DB_LVM_NAME_PREFIX = "DB_LVM_NAME_PREFIX"
 )
 
 func initializeBuckets(tx *bolt.Tx) error {
@@ -41,6 +42,24 @@ func initializeBuckets(tx *bolt.Tx) error {
 		return err
 	}
 
+	_, err = tx.CreateBucketIfNotExists([]byte(BOLTDB_BUCKET_VOLUME_NAME))
+	if err != nil {
+		logger.LogError("Unable to create volume name bucket in DB")
+		return err
+	}
+
+	_, err = tx.CreateBucketIfNotExists([]byte(BOLTDB_BUCKET_VOLUME_GLUSTER_ID))
+	if err != nil {
+		logger.LogError("Unable to create volume gluster id bucket in DB")
+		return err
+	}
+
+	_, err = tx.CreateBucketIfNotExists([]byte(BOLTDB_BUCKET_IDEMPOTENCY_KEY))
+	if err != nil {
+		logger.LogError("Unable to create idempotency key bucket in DB")
+		return err
+	}
+
 	// Create Device Bucket
 	_, err = tx.CreateBucketIfNotExists([]byte(BOLTDB_BUCKET_DEVICE))
 	if err != nil {
@@ -73,6 +92,54 @@ func initializeBuckets(tx *bolt.Tx) error {
 		return err
 	}
 
+	_, err = tx.CreateBucketIfNotExists([]byte(BOLTDB_BUCKET_INTENT))
+	if err != nil {
+		logger.LogError("Unable to create intent bucket in DB")
+		return err
+	}
+
+	_, err = tx.CreateBucketIfNotExists([]byte(BOLTDB_BUCKET_OPERATION_HISTORY))
+	if err != nil {
+		logger.LogError("Unable to create operation history bucket in DB")
+		return err
+	}
+
+	_, err = tx.CreateBucketIfNotExists([]byte(BOLTDB_BUCKET_COMMAND_OUTPUT))
+	if err != nil {
+		logger.LogError("Unable to create command output bucket in DB")
+		return err
+	}
+
+	_, err = tx.CreateBucketIfNotExists([]byte(BOLTDB_BUCKET_AUDIT_LOG))
+	if err != nil {
+		logger.LogError("Unable to create audit log bucket in DB")
+		return err
+	}
+
+	_, err = tx.CreateBucketIfNotExists([]byte(BOLTDB_BUCKET_SNAPSHOT))
+	if err != nil {
+		logger.LogError("Unable to create snapshot bucket in DB")
+		return err
+	}
+
+	_, err = tx.CreateBucketIfNotExists([]byte(BOLTDB_BUCKET_REPLICATION))
+	if err != nil {
+		logger.LogError("Unable to create replication bucket in DB")
+		return err
+	}
+
+	_, err = tx.CreateBucketIfNotExists([]byte(BOLTDB_BUCKET_TENANT))
+	if err != nil {
+		logger.LogError("Unable to create tenant bucket in DB")
+		return err
+	}
+
+	_, err = tx.CreateBucketIfNotExists([]byte(BOLTDB_BUCKET_STATE_REASON))
+	if err != nil {
+		logger.LogError("Unable to create state reason bucket in DB")
+		return err
+	}
+
 	return nil
 }
 
@@ -144,6 +211,29 @@ func recordNewDBGenerationID(tx *bolt.Tx) error {
 	return entry.Save(tx)
 }
 
+// recordLvmNamePrefix keeps the prefix of the names of the volume groups
+// and logical volumes in the db. A db without devices takes the prefix
+// of the configuration, a db with devices set up before the prefix was
+// recorded keeps the names without prefix.
+func recordLvmNamePrefix(tx *bolt.Tx, prefix string) (string, error) {
+	entry, err := NewDbAttributeEntryFromKey(tx, DB_LVM_NAME_PREFIX)
+	switch err {
+	case nil:
+		return entry.Value, nil
+	case ErrNotFound:
+	default:
+		return "", err
+	}
+
+	if len(EntryKeys(tx, BOLTDB_BUCKET_DEVICE)) > 0 {
+		prefix = ""
+	}
+	entry = NewDbAttributeEntry()
+	entry.Key = DB_LVM_NAME_PREFIX
+	entry.Value = prefix
+	return prefix, entry.Save(tx)
+}
+
 func DeleteBricksWithEmptyPath(db *bolt.DB, all bool, clusterIDs []string, nodeIDs []string, deviceIDs []string, debug bool) error {
 
 	if debug {
@@ -10,6 +10,8 @@
 package glusterfs
 
 import (
+	"sort"
+
 	"github.com/boltdb/bolt"
 	"github.com/lpabon/godbc"
 )
@@ -99,6 +101,53 @@ func EntrySave(tx *bolt.Tx, entry DbEntry, key string) error {
 	return nil
 }
 
+// EntrySaveBatch saves a set of entries, keyed by id, in a single pass.
+// Each entry is serialized only once and the entries are written in
+// key order, which keeps the number of pages touched by the transaction
+// low when a large number of entries are saved at once.
+func EntrySaveBatch(tx *bolt.Tx, entries map[string]DbEntry) error {
+	godbc.Require(tx != nil)
+
+	keys := make([]string, 0, len(entries))
+	for key := range entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	buckets := map[string]*bolt.Bucket{}
+	for _, key := range keys {
+		godbc.Require(len(key) > 0)
+		entry := entries[key]
+
+		// Access bucket
+		name := entry.BucketName()
+		b, ok := buckets[name]
+		if !ok {
+			b = tx.Bucket([]byte(name))
+			if b == nil {
+				err := ErrDbAccess
+				logger.Err(err)
+				return err
+			}
+			buckets[name] = b
+		}
+
+		buffer, err := entry.Marshal()
+		if err != nil {
+			logger.Err(err)
+			return err
+		}
+
+		err = b.Put([]byte(key), buffer)
+		if err != nil {
+			logger.Err(err)
+			return err
+		}
+	}
+
+	return nil
+}
+
 func EntryDelete(tx *bolt.Tx, entry DbEntry, key string) error {
 	godbc.Require(tx != nil)
 	godbc.Require(len(key) > 0)
@@ -77,3 +77,42 @@ func TestEntryRegister(t *testing.T) {
 	tests.Assert(t, err == nil)
 
 }
+
+func TestEntrySaveBatch(t *testing.T) {
+	tmpfile := tests.Tempfile()
+
+	// Setup BoltDB database
+	db, err := bolt.Open(tmpfile, 0600, &bolt.Options{Timeout: 3 * time.Second})
+	tests.Assert(t, err == nil)
+	defer os.Remove(tmpfile)
+
+	entries := map[string]DbEntry{
+		"key3": &testDbEntry{},
+		"key1": &testDbEntry{},
+		"key2": &testDbEntry{},
+	}
+
+	// Saving to a missing bucket fails
+	err = db.Update(func(tx *bolt.Tx) error {
+		return EntrySaveBatch(tx, entries)
+	})
+	tests.Assert(t, err == ErrDbAccess, err)
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte("TestBucket"))
+		tests.Assert(t, err == nil)
+
+		return EntrySaveBatch(tx, entries)
+	})
+	tests.Assert(t, err == nil, err)
+
+	err = db.View(func(tx *bolt.Tx) error {
+		keys := EntryKeys(tx, "TestBucket")
+		tests.Assert(t, len(keys) == 3, keys)
+		tests.Assert(t, keys[0] == "key1")
+		tests.Assert(t, keys[1] == "key2")
+		tests.Assert(t, keys[2] == "key3")
+		return nil
+	})
+	tests.Assert(t, err == nil)
+}
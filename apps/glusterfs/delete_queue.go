@@ -0,0 +1,366 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/boltdb/bolt"
+	wdb "github.com/heketi/heketi/pkg/db"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+)
+
+var (
+	// Number of volumes and block volumes torn down at the same time.
+	// The other deletes wait in the queue.
+	DeleteQueueWorkers = 4
+
+	// Seconds a volume delete waits for its confirmation before the
+	// volume is deleted. Zero deletes the volumes without waiting.
+	DeleteConfirmationTimeout = 0
+)
+
+// deleteQueue runs the teardown of the volumes and block volumes being
+// deleted, a limited number at a time. The queued deletes are kept by
+// the id of the entry being deleted so that a client retrying the
+// delete gets the operation already queued instead of a conflict.
+type deleteQueue struct {
+	lock    sync.Mutex
+	slots   chan struct{}
+	pending map[string]*queuedDelete
+	// Deletes waiting for their confirmation, true being sent on the
+	// channel to confirm the delete and false to cancel it
+	confirmations map[string]chan bool
+}
+
+// queuedDelete is a delete in the queue
+type queuedDelete struct {
+	// The url of the async operation of the delete, empty until the
+	// operation is started and for the deletes resumed at startup
+	url string
+	// Closed once the delete is done, err being its outcome
+	done chan struct{}
+	err  error
+}
+
+func newDeleteQueue(workers int) *deleteQueue {
+	if workers < 1 {
+		workers = 1
+	}
+	return &deleteQueue{
+		slots:         make(chan struct{}, workers),
+		pending:       map[string]*queuedDelete{},
+		confirmations: map[string]chan bool{},
+	}
+}
+
+// claim queues a new delete of the entry and returns it with true. If
+// the entry is already being deleted the queued delete is returned with
+// false. Checking and queueing in one step under the lock keeps two
+// concurrent deletes of the entry from both running.
+func (q *deleteQueue) claim(id string) (*queuedDelete, bool) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if d, ok := q.pending[id]; ok {
+		return d, false
+	}
+	d := &queuedDelete{done: make(chan struct{})}
+	q.pending[id] = d
+	return d, true
+}
+
+// setLocation records the url of the async operation of the delete
+func (q *deleteQueue) setLocation(d *queuedDelete, url string) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	d.url = url
+}
+
+// location returns the url of the async operation of the delete
+func (q *deleteQueue) location(d *queuedDelete) string {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return d.url
+}
+
+// finish removes the delete of the entry from the queue and lets the
+// requests following it know its outcome
+func (q *deleteQueue) finish(id string, err error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	d, ok := q.pending[id]
+	if !ok {
+		return
+	}
+	delete(q.pending, id)
+	d.err = err
+	close(d.done)
+}
+
+// awaitConfirmation returns the channel the answer to the delete of
+// the entry is sent on
+func (q *deleteQueue) awaitConfirmation(id string) <-chan bool {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	c := make(chan bool, 1)
+	q.confirmations[id] = c
+	return c
+}
+
+// answer confirms or cancels the delete of the entry. It returns false
+// if no delete of the entry waits for its confirmation.
+func (q *deleteQueue) answer(id string, confirmed bool) bool {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	c, ok := q.confirmations[id]
+	if !ok {
+		return false
+	}
+	delete(q.confirmations, id)
+	c <- confirmed
+	return true
+}
+
+// stopWaiting drops the delete of the entry from the deletes waiting
+// for their confirmation
+func (q *deleteQueue) stopWaiting(id string) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	delete(q.confirmations, id)
+}
+
+// asyncHttpQueuedDelete builds the delete operation of the entry with
+// the given id and queues its teardown. The response is sent once the
+// entry is marked as being deleted, the client following the async
+// operation to wait for the teardown. A delete of an entry already in
+// the queue is answered with the async operation of the queued delete.
+// If asyncHttpQueuedDelete returns nil the response has been sent.
+func (a *App) asyncHttpQueuedDelete(w http.ResponseWriter,
+	r *http.Request,
+	id string,
+	op Operation) error {
+
+	d, ok := a.deletes.claim(id)
+	if !ok {
+		a.followDelete(w, r, id, d)
+		return nil
+	}
+
+	reqId := requestId(r)
+	if err := buildOperation(a, reqId, op); err != nil {
+		a.deletes.finish(id, err)
+		return err
+	}
+
+	history := newOperationHistoryEntry(op, requestIssuer(r))
+	a.asyncHttpRedirectWithStepsFunc(w, r, func(step func(string)) (url string, err error) {
+		defer func() { a.deletes.finish(id, err) }()
+		return a.teardown(reqId, op, history, step)
+	})
+	a.deletes.setLocation(d, w.Header().Get("Location"))
+	return nil
+}
+
+// followDelete answers a delete of an entry already in the queue with
+// the async operation of the queued delete or, if the queued delete has
+// none yet, with an async operation waiting for it to be done
+func (a *App) followDelete(w http.ResponseWriter,
+	r *http.Request,
+	id string,
+	d *queuedDelete) {
+
+	requestLogger(r).Info("Delete of %v already queued", id)
+	if url := a.deletes.location(d); url != "" {
+		http.Redirect(w, r, url, http.StatusAccepted)
+		return
+	}
+	a.asyncHttpRedirectFunc(w, r, func() (string, error) {
+		<-d.done
+		return "", d.err
+	})
+}
+
+// teardown runs the delete operation built for the request with the id
+// once one of the workers of the queue is free
+func (a *App) teardown(reqId string,
+	op Operation,
+	history *OperationHistoryEntry,
+	step func(string)) (string, error) {
+
+	step(api.DeleteStepQueued)
+	a.deletes.slots <- struct{}{}
+	defer func() { <-a.deletes.slots }()
+
+	step(api.DeleteStepTeardown)
+	return execAsyncOperation(a, reqId, op, history)
+}
+
+// asyncHttpConfirmedDelete marks the volume as waiting for the
+// confirmation of its delete and posts the volume_delete_pending event
+// to the webhooks. The delete is queued once it is confirmed, or once
+// DeleteConfirmationTimeout seconds passed since it was first
+// requested, and fails if it is cancelled. The response is sent once
+// the volume is marked, the client following the async operation to
+// wait for the confirmation and the teardown. If
+// asyncHttpConfirmedDelete returns nil the response has been sent.
+func (a *App) asyncHttpConfirmedDelete(w http.ResponseWriter,
+	r *http.Request,
+	id string) error {
+
+	d, ok := a.deletes.claim(id)
+	if !ok {
+		a.followDelete(w, r, id, d)
+		return nil
+	}
+
+	var since int64
+	err := a.db.Update(func(tx *bolt.Tx) error {
+		v, err := NewVolumeEntryFromId(tx, id)
+		if err != nil {
+			return err
+		}
+		// A delete requested again, e.g. after its resumed wait
+		// failed, keeps the deadline of the first request
+		if v.PendingDeleteSince == 0 {
+			v.PendingDeleteSince = time.Now().Unix()
+		}
+		since = v.PendingDeleteSince
+		return v.Save(tx)
+	})
+	if err != nil {
+		a.deletes.finish(id, err)
+		return err
+	}
+
+	confirmation := a.deletes.awaitConfirmation(id)
+	requester := requestIssuer(r)
+	reqId := requestId(r)
+	a.asyncHttpRedirectWithStepsFunc(w, r, func(step func(string)) (url string, err error) {
+		defer func() { a.deletes.finish(id, err) }()
+		return a.confirmedDelete(reqId, id, since, confirmation, requester, step)
+	})
+	a.deletes.setLocation(d, w.Header().Get("Location"))
+	return nil
+}
+
+// confirmedDelete waits for the answer to the delete of the volume
+// marked as waiting for it since the given time, and queues the
+// teardown of the volume unless the delete is cancelled. The delete is
+// logged with the id of the request it was made by, if any.
+func (a *App) confirmedDelete(reqId string,
+	id string,
+	since int64,
+	confirmation <-chan bool,
+	requester string,
+	step func(string)) (string, error) {
+
+	log := logger.WithRequestId(reqId)
+	step(api.DeleteStepConfirmation)
+	deadline := time.Unix(since+int64(DeleteConfirmationTimeout), 0)
+	a.notify(api.EventVolumeDeletePending, id, volumeTenant(a.db, id),
+		fmt.Sprintf("Volume %v is deleted at %v unless the delete is cancelled",
+			id, deadline.UTC().Format(time.RFC3339)))
+
+	confirmed := true
+	select {
+	case confirmed = <-confirmation:
+	case <-time.After(time.Until(deadline)):
+		a.deletes.stopWaiting(id)
+		// An answer sent just before the deadline wins
+		select {
+		case confirmed = <-confirmation:
+		default:
+			log.Info("Delete of volume %v not confirmed in %v seconds",
+				id, DeleteConfirmationTimeout)
+		}
+	}
+
+	var volume *VolumeEntry
+	err := a.db.Update(func(tx *bolt.Tx) error {
+		var err error
+		volume, err = NewVolumeEntryFromId(tx, id)
+		if err != nil {
+			return err
+		}
+		volume.PendingDeleteSince = 0
+		return volume.Save(tx)
+	})
+	if err != nil {
+		return "", err
+	}
+	if !confirmed {
+		return "", log.LogError("Delete of volume %v cancelled", id)
+	}
+
+	op := NewVolumeDeleteOperation(volume, a.db)
+	if err := buildOperation(a, reqId, op); err != nil {
+		return "", err
+	}
+	return a.teardown(reqId, op, newOperationHistoryEntry(op, requester), step)
+}
+
+// resumePendingDeletes waits again for the confirmation of the deletes
+// of the volumes that were waiting for it when the server stopped. The
+// deletes keep the deadlines of their first request, they are queued
+// at once if their deadline passed while the server was down.
+func (a *App) resumePendingDeletes() error {
+	since := map[string]int64{}
+	err := a.db.View(func(tx *bolt.Tx) error {
+		volumes, err := VolumeList(tx)
+		if err != nil {
+			return err
+		}
+		for _, id := range volumes {
+			v, err := NewVolumeEntryFromId(tx, id)
+			if err != nil {
+				return err
+			}
+			if v.PendingDeleteSince != 0 {
+				since[v.Info.Id] = v.PendingDeleteSince
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for id, s := range since {
+		if _, ok := a.deletes.claim(id); !ok {
+			continue
+		}
+		logger.Info("Resuming the delete of volume %v", id)
+		confirmation := a.deletes.awaitConfirmation(id)
+		go func(id string, s int64) {
+			_, err := a.confirmedDelete("", id, s, confirmation, "", func(string) {})
+			if err != nil {
+				logger.LogError("Resumed delete of volume %v failed: %v", id, err)
+			}
+			a.deletes.finish(id, err)
+		}(id, s)
+	}
+	return nil
+}
+
+// clearPendingDelete removes the mark of a volume waiting for the
+// confirmation of its delete
+func clearPendingDelete(db wdb.DB, id string) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		v, err := NewVolumeEntryFromId(tx, id)
+		if err != nil {
+			return err
+		}
+		v.PendingDeleteSince = 0
+		return v.Save(tx)
+	})
+}
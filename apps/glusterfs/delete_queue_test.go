@@ -0,0 +1,350 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/gorilla/mux"
+	client "github.com/heketi/heketi/client/api/go-client"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/tests"
+)
+
+func sendQueuedDelete(t *testing.T, u string) *url.URL {
+	req, err := http.NewRequest("DELETE", u, nil)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	r, err := http.DefaultClient.Do(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, r.StatusCode == http.StatusAccepted, r.StatusCode)
+	location, err := r.Location()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	return location
+}
+
+// waitPendingStep waits for the async operation to report the step and
+// returns the last step reported
+func waitPendingStep(t *testing.T, location *url.URL, step string) string {
+	var s string
+	for i := 0; i < 100 && s != step; i++ {
+		r, err := http.Get(location.String())
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, r.Header.Get("X-Pending") == "true")
+		s = r.Header.Get(api.HeaderPendingStep)
+		time.Sleep(10 * time.Millisecond)
+	}
+	return s
+}
+
+func waitQueuedDelete(t *testing.T, location *url.URL) *http.Response {
+	for {
+		r, err := http.Get(location.String())
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		if r.Header.Get("X-Pending") != "true" {
+			return r
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestVolumeDeleteQueued(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	c := client.NewClientNoAuth(ts.URL)
+	tests.Assert(t, c != nil)
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		3,    // nodes_per_cluster
+		1,    // devices_per_node,
+		2*TB, // disksize)
+	)
+	tests.Assert(t, err == nil)
+
+	req := &api.VolumeCreateRequest{}
+	req.Size = 10
+	vol1, err := c.VolumeCreate(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	vol2, err := c.VolumeCreate(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// A single teardown at a time, held until released
+	app.deletes = newDeleteQueue(1)
+	release := make(chan struct{})
+	destroyed := map[string]int{}
+	app.xo.MockVolumeDestroy = func(host string, volume string) error {
+		<-release
+		destroyed[volume]++
+		return nil
+	}
+
+	location1 := sendQueuedDelete(t, ts.URL+"/volumes/"+vol1.Id)
+	step := waitPendingStep(t, location1, api.DeleteStepTeardown)
+	tests.Assert(t, step == api.DeleteStepTeardown, step)
+
+	// The volume is hidden while it is deleted
+	_, err = c.VolumeInfo(vol1.Id)
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	// A retried delete gets the queued operation
+	location := sendQueuedDelete(t, ts.URL+"/volumes/"+vol1.Id)
+	tests.Assert(t, location.String() == location1.String(), location, location1)
+
+	// The next delete waits for the first one
+	location2 := sendQueuedDelete(t, ts.URL+"/volumes/"+vol2.Id)
+	step = waitPendingStep(t, location2, api.DeleteStepQueued)
+	tests.Assert(t, step == api.DeleteStepQueued, step)
+
+	close(release)
+	r := waitQueuedDelete(t, location1)
+	tests.Assert(t, r.StatusCode == http.StatusNoContent, r.StatusCode)
+	r = waitQueuedDelete(t, location2)
+	tests.Assert(t, r.StatusCode == http.StatusNoContent, r.StatusCode)
+	tests.Assert(t, destroyed[vol1.Name] == 1, destroyed)
+	tests.Assert(t, destroyed[vol2.Name] == 1, destroyed)
+	tests.Assert(t, len(app.deletes.pending) == 0, app.deletes.pending)
+
+	list, err := c.VolumeList()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(list.Volumes) == 0, list.Volumes)
+
+	app.db.View(func(tx *bolt.Tx) error {
+		ops, err := PendingOperationList(tx)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, len(ops) == 0, ops)
+		return nil
+	})
+
+	// Deleted volumes are not found any more
+	req2, err := http.NewRequest("DELETE", ts.URL+"/volumes/"+vol1.Id, nil)
+	tests.Assert(t, err == nil)
+	r, err = http.DefaultClient.Do(req2)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusNotFound, r.StatusCode)
+}
+
+func TestBlockVolumeDeleteTwice(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		3,    // nodes_per_cluster
+		1,    // devices_per_node,
+		2*TB, // disksize)
+	)
+	tests.Assert(t, err == nil)
+
+	req := &api.BlockVolumeCreateRequest{}
+	req.Size = 10
+	bv := NewBlockVolumeEntryFromRequest(req)
+	err = RunOperation(NewBlockVolumeCreateOperation(bv, app.db),
+		app.Allocator(), app.executor)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// A second delete of the block volume conflicts with the first one
+	bdel := NewBlockVolumeDeleteOperation(bv, app.db)
+	err = bdel.Build(app.Allocator())
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	err = NewBlockVolumeDeleteOperation(bv, app.db).Build(app.Allocator())
+	tests.Assert(t, err == ErrConflict, "expected err == ErrConflict, got:", err)
+
+	err = bdel.Exec(app.executor)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	err = bdel.Finalize()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	app.db.View(func(tx *bolt.Tx) error {
+		_, err := NewBlockVolumeEntryFromId(tx, bv.Info.Id)
+		tests.Assert(t, err == ErrNotFound, err)
+		ops, err := PendingOperationList(tx)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, len(ops) == 0, ops)
+		return nil
+	})
+}
+
+func TestVolumeDeleteConfirmation(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	c := client.NewClientNoAuth(ts.URL)
+	tests.Assert(t, c != nil)
+
+	h := &webhookReceiver{events: make(chan *api.Event, 10)}
+	hs := httptest.NewServer(h)
+	defer hs.Close()
+	app.webhooks = newWebhookNotifier([]WebhookConfig{
+		{Url: hs.URL, Events: []string{api.EventVolumeDeletePending}},
+	})
+
+	defer func(timeout int) {
+		DeleteConfirmationTimeout = timeout
+	}(DeleteConfirmationTimeout)
+	DeleteConfirmationTimeout = 3600
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		3,    // nodes_per_cluster
+		1,    // devices_per_node,
+		2*TB, // disksize)
+	)
+	tests.Assert(t, err == nil)
+
+	req := &api.VolumeCreateRequest{}
+	req.Size = 10
+	vol, err := c.VolumeCreate(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// Only the volumes waiting for their delete can be confirmed
+	err = c.VolumeDeleteConfirm(vol.Id)
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	// The delete waits, the volume being still available
+	location := sendQueuedDelete(t, ts.URL+"/volumes/"+vol.Id)
+	step := waitPendingStep(t, location, api.DeleteStepConfirmation)
+	tests.Assert(t, step == api.DeleteStepConfirmation, step)
+
+	e := h.next(t)
+	tests.Assert(t, e.Type == api.EventVolumeDeletePending, e)
+	tests.Assert(t, e.ObjectId == vol.Id, e)
+
+	info, err := c.VolumeInfo(vol.Id)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, info.PendingDelete != nil)
+	tests.Assert(t, info.PendingDelete.Deadline == info.PendingDelete.Since+3600,
+		info.PendingDelete)
+
+	// Cancelled, the volume is kept
+	err = c.VolumeDeleteCancel(vol.Id)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	r := waitQueuedDelete(t, location)
+	tests.Assert(t, r.StatusCode == http.StatusInternalServerError, r.StatusCode)
+
+	info, err = c.VolumeInfo(vol.Id)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, info.PendingDelete == nil, info.PendingDelete)
+
+	// Confirmed, the volume is deleted
+	location = sendQueuedDelete(t, ts.URL+"/volumes/"+vol.Id)
+	step = waitPendingStep(t, location, api.DeleteStepConfirmation)
+	tests.Assert(t, step == api.DeleteStepConfirmation, step)
+	err = c.VolumeDeleteConfirm(vol.Id)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	r = waitQueuedDelete(t, location)
+	tests.Assert(t, r.StatusCode == http.StatusNoContent, r.StatusCode)
+
+	_, err = c.VolumeInfo(vol.Id)
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	// Without an answer, the volume is deleted once the time is up
+	DeleteConfirmationTimeout = 1
+	vol, err = c.VolumeCreate(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	err = c.VolumeDelete(vol.Id)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	_, err = c.VolumeInfo(vol.Id)
+	tests.Assert(t, err != nil, "expected err != nil")
+}
+
+func TestVolumeDeleteConfirmationResumed(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	defer func(timeout int) {
+		DeleteConfirmationTimeout = timeout
+	}(DeleteConfirmationTimeout)
+	DeleteConfirmationTimeout = 3600
+
+	app := NewTestApp(tmpfile)
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		3,    // nodes_per_cluster
+		1,    // devices_per_node,
+		2*TB, // disksize)
+	)
+	tests.Assert(t, err == nil)
+
+	req := &api.VolumeCreateRequest{}
+	req.Size = 10
+	v := NewVolumeEntryFromRequest(req)
+	err = v.Create(app.db, app.executor, app.Allocator())
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// The server stops while the delete waits for its confirmation
+	err = app.db.Update(func(tx *bolt.Tx) error {
+		vol, err := NewVolumeEntryFromId(tx, v.Info.Id)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		vol.PendingDeleteSince = time.Now().Unix()
+		return vol.Save(tx)
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	app.Close()
+
+	app = NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	c := client.NewClientNoAuth(ts.URL)
+	tests.Assert(t, c != nil)
+
+	// The delete waits again, a retried delete following it
+	d, ok := app.deletes.claim(v.Info.Id)
+	tests.Assert(t, !ok, "expected the delete to be resumed")
+	tests.Assert(t, d.url == "", d.url)
+	location := sendQueuedDelete(t, ts.URL+"/volumes/"+v.Info.Id)
+
+	// The volume can not change while it waits for its delete
+	_, err = c.VolumeExpand(v.Info.Id, &api.VolumeExpandRequest{Size: 1})
+	tests.Assert(t, err != nil, "expected err != nil")
+	tests.Assert(t, err.Error() == ErrConflict.Error(), err)
+	_, err = c.SnapshotCreate(v.Info.Id, &api.SnapshotCreateRequest{})
+	tests.Assert(t, err != nil, "expected err != nil")
+	tests.Assert(t, err.Error() == ErrConflict.Error(), err)
+
+	err = c.VolumeDeleteConfirm(v.Info.Id)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	r := waitQueuedDelete(t, location)
+	tests.Assert(t, r.StatusCode == http.StatusNoContent, r.StatusCode)
+
+	_, err = c.VolumeInfo(v.Info.Id)
+	tests.Assert(t, err != nil, "expected err != nil")
+	tests.Assert(t, len(app.deletes.pending) == 0, app.deletes.pending)
+}
@@ -0,0 +1,222 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/heketi/heketi/executors"
+	wdb "github.com/heketi/heketi/pkg/db"
+	"github.com/heketi/heketi/pkg/utils"
+)
+
+// plannedBrickReplacement is a brick of the device to be replaced with
+// a destination brick allocated up front
+type plannedBrickReplacement struct {
+	*brickReplacement
+	volume   *VolumeEntry
+	newBrick *BrickEntry
+}
+
+// allocate deducts the storage of the destination brick from the
+// device. It returns false if the device has no room for the brick.
+func (p *plannedBrickReplacement) allocate(device *DeviceEntry,
+	newBrickId string) bool {
+
+	p.newBrick = device.NewBrickEntry(p.oldBrick.Info.Size,
+		float64(p.volume.Info.Snapshot.Factor),
+		p.volume.Info.Gid, p.volume.Info.Id)
+	if p.newBrick == nil {
+		return false
+	}
+	p.newBrick.SetId(newBrickId)
+	return true
+}
+
+// planBrickDestination allocates the destination brick of the
+// replacement on the first suitable device of the ring. The storage is
+// deducted from the cached device entries so that the destinations of
+// all the replacements planned in the transaction add up.
+func planBrickDestination(tx *bolt.Tx,
+	allocator Allocator,
+	devcache map[string](*DeviceEntry),
+	p *plannedBrickReplacement) error {
+
+	newBrickId := utils.GenUUID()
+	deviceCh, done, errc := allocator.GetNodes(wdb.WrapTx(tx),
+		p.volume.Info.Cluster, newBrickId)
+	defer func() {
+		close(done)
+	}()
+
+	fallbacks := []*DeviceEntry{}
+	for deviceId := range deviceCh {
+		device, err := cachedDevice(tx, devcache, deviceId)
+		if err != nil {
+			return err
+		}
+		if p.deviceOk(device) && p.allocate(device, newBrickId) {
+			return nil
+		}
+		if p.deviceFallbackOk(device) {
+			fallbacks = append(fallbacks, device)
+		}
+	}
+	if err := <-errc; err != nil {
+		return err
+	}
+	// With the best-effort zone policy, fall back to the devices in
+	// the zones already used by the set
+	for _, device := range fallbacks {
+		if p.allocate(device, newBrickId) {
+			return nil
+		}
+	}
+	return ErrNoReplacement
+}
+
+// planBrickReplacements allocates the destinations of all the planned
+// replacements in a single transaction. Either every brick gets a
+// destination and the storage of all of them is reserved, or nothing
+// is reserved.
+func planBrickReplacements(db wdb.DB,
+	allocator Allocator,
+	planned []*plannedBrickReplacement) error {
+
+	return db.Update(func(tx *bolt.Tx) error {
+		devcache := map[string](*DeviceEntry){}
+		for _, p := range planned {
+			err := planBrickDestination(tx, allocator, devcache, p)
+			if err != nil {
+				return fmt.Errorf("Unable to find a destination for brick %v: %v",
+					p.oldBrick.Info.Id, err)
+			}
+		}
+
+		return saveReservations(tx, devcache, planned)
+	})
+}
+
+// saveReservations saves the devices holding the destinations of the
+// planned replacements
+func saveReservations(tx *bolt.Tx,
+	devcache map[string](*DeviceEntry),
+	planned []*plannedBrickReplacement) error {
+
+	reserved := map[string]bool{}
+	for _, p := range planned {
+		deviceId := p.newBrick.Info.DeviceId
+		if reserved[deviceId] {
+			continue
+		}
+		if err := devcache[deviceId].Save(tx); err != nil {
+			return err
+		}
+		reserved[deviceId] = true
+	}
+	return nil
+}
+
+// replacePlanned replaces the bricks of the planned replacements, one
+// at a time, waiting for the interval between two replaces. Each
+// replace releases the storage reserved for its destination if it
+// fails, so the remaining bricks are still replaced. It returns the
+// failed replaces.
+func replacePlanned(db wdb.DB,
+	executor executors.Executor,
+	planned []*plannedBrickReplacement,
+	interval time.Duration) (failed []string) {
+
+	for i, p := range planned {
+		if i > 0 && interval > 0 {
+			time.Sleep(interval)
+		}
+		logger.Info("Replacing brick %v on device %v with brick %v on device %v",
+			p.oldBrick.Info.Id, p.oldDevice.Info.Id,
+			p.newBrick.Info.Id, p.newBrick.Info.DeviceId)
+		err := p.volume.replaceBrickWith(db, executor, p.brickReplacement,
+			p.newBrick, nil)
+		if err != nil {
+			logger.LogError("Failed to replace brick %v: %v", p.oldBrick.Info.Id, err)
+			failed = append(failed, fmt.Sprintf("%v: %v", p.oldBrick.Info.Id, err))
+		}
+	}
+	return
+}
+
+// ReplaceDeviceBricks replaces every brick of the device. The
+// destinations of all the bricks are planned, and their storage
+// reserved, before any brick is replaced so that the replacements
+// cannot overcommit a destination device. If any brick cannot be
+// placed no brick is replaced.
+func ReplaceDeviceBricks(db wdb.DB,
+	executor executors.Executor,
+	allocator Allocator,
+	deviceId string) error {
+
+	var brickIds []string
+	var volumes []*VolumeEntry
+	err := db.View(func(tx *bolt.Tx) error {
+		d, err := NewDeviceEntryFromId(tx, deviceId)
+		if err != nil {
+			return err
+		}
+		for _, brickId := range d.Bricks {
+			brick, err := NewBrickEntryFromId(tx, brickId)
+			if err != nil {
+				return err
+			}
+			if brick.Info.Path == "" {
+				logger.Warning("Skipping brick with empty path, brickID: %v, volumeID: %v",
+					brick.Info.Id, brick.Info.VolumeId)
+				continue
+			}
+			volume, err := NewVolumeEntryFromId(tx, brick.Info.VolumeId)
+			if err != nil {
+				return err
+			}
+			brickIds = append(brickIds, brickId)
+			volumes = append(volumes, volume)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Check that each brick can be replaced before reserving anything
+	planned := make([]*plannedBrickReplacement, len(brickIds))
+	for i, brickId := range brickIds {
+		r, err := volumes[i].prepareBrickReplace(db, executor, brickId)
+		if err != nil {
+			return logger.Err(fmt.Errorf("Unable to replace brick %v: %v",
+				brickId, err))
+		}
+		planned[i] = &plannedBrickReplacement{
+			brickReplacement: r,
+			volume:           volumes[i],
+		}
+	}
+
+	err = planBrickReplacements(db, allocator, planned)
+	if err != nil {
+		return logger.Err(err)
+	}
+
+	failed := replacePlanned(db, executor, planned, 0)
+	if len(failed) != 0 {
+		return fmt.Errorf("Failed to replace %v of %v bricks of device %v: %v",
+			len(failed), len(planned), deviceId, strings.Join(failed, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,241 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/gorilla/mux"
+	client "github.com/heketi/heketi/client/api/go-client"
+	"github.com/heketi/heketi/executors"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/tests"
+)
+
+// sampleDeviceWithBricks creates two volumes on the devices of three
+// of the four nodes of the cluster. The bricks of the device returned
+// can only be replaced by bricks on the spare device, which has room
+// for only one of them unless the spare device is as large as the
+// others.
+func sampleDeviceWithBricks(t *testing.T, app *App,
+	spareFree uint64) (deviceId, spareId string) {
+
+	err := setupSampleDbWithTopology(app,
+		1,      // clusters
+		4,      // nodes_per_cluster
+		1,      // devices_per_node,
+		500*GB, // disksize
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	setSpare := func(state api.EntryState, free uint64) {
+		app.db.Update(func(tx *bolt.Tx) error {
+			d, err := NewDeviceEntryFromId(tx, spareId)
+			tests.Assert(t, err == nil)
+			d.State = state
+			if free != 0 {
+				d.Info.Storage.Free = free
+			}
+			return d.Save(tx)
+		})
+	}
+
+	app.db.View(func(tx *bolt.Tx) error {
+		dl, err := DeviceList(tx)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, len(dl) == 4, dl)
+		spareId = dl[3]
+		return nil
+	})
+	setSpare(api.EntryStateOffline, 0)
+
+	vreq := &api.VolumeCreateRequest{}
+	vreq.Size = 200
+	vreq.Durability.Type = api.DurabilityReplicate
+	vreq.Durability.Replicate.Replica = 3
+	for i := 0; i < 2; i++ {
+		v := NewVolumeEntryFromRequest(vreq)
+		err = v.Create(app.db, app.executor, app.Allocator())
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	}
+	setSpare(api.EntryStateOnline, spareFree)
+
+	app.xo.MockVolumeInfo = func(host string, volume string) (*executors.Volume, error) {
+		return mockVolumeInfoFromDb(app.db, volume)
+	}
+	app.xo.MockHealInfo = func(host string, volume string) (*executors.HealInfo, error) {
+		return mockHealStatusFromDb(app.db, volume)
+	}
+
+	app.db.View(func(tx *bolt.Tx) error {
+		dl, err := DeviceList(tx)
+		tests.Assert(t, err == nil)
+		for _, id := range dl {
+			if id != spareId {
+				deviceId = id
+				break
+			}
+		}
+		d, err := NewDeviceEntryFromId(tx, deviceId)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, len(d.Bricks) == 2, d.Bricks)
+		return nil
+	})
+	return
+}
+
+func TestReplaceDeviceBricks(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	deviceId, spareId := sampleDeviceWithBricks(t, app, 0)
+
+	err := ReplaceDeviceBricks(app.db, app.executor, app.Allocator(), deviceId)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	app.db.View(func(tx *bolt.Tx) error {
+		d, err := NewDeviceEntryFromId(tx, deviceId)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, len(d.Bricks) == 0, d.Bricks)
+		tests.Assert(t, d.Info.Storage.Used == 0, d.Info.Storage)
+		tests.Assert(t, d.State == api.EntryStateOnline, d.State)
+
+		spare, err := NewDeviceEntryFromId(tx, spareId)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, len(spare.Bricks) == 2, spare.Bricks)
+
+		vl, err := VolumeList(tx)
+		tests.Assert(t, err == nil)
+		for _, id := range vl {
+			v, err := NewVolumeEntryFromId(tx, id)
+			tests.Assert(t, err == nil)
+			tests.Assert(t, len(v.Bricks) == 3, v.Bricks)
+		}
+		return nil
+	})
+}
+
+func TestReplaceDeviceBricksNoRoom(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	// The spare device can take one brick, but not both
+	deviceId, spareId := sampleDeviceWithBricks(t, app, 300*GB)
+
+	replaced := 0
+	app.xo.MockVolumeReplaceBrick = func(host string, volume string,
+		oldBrick *executors.BrickInfo, newBrick *executors.BrickInfo) error {
+		replaced++
+		return nil
+	}
+
+	err := ReplaceDeviceBricks(app.db, app.executor, app.Allocator(), deviceId)
+	tests.Assert(t, err != nil, "expected err != nil")
+	tests.Assert(t, replaced == 0, "expected no brick replaced, got:", replaced)
+
+	// Nothing was reserved on the spare device
+	app.db.View(func(tx *bolt.Tx) error {
+		d, err := NewDeviceEntryFromId(tx, deviceId)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, len(d.Bricks) == 2, d.Bricks)
+
+		spare, err := NewDeviceEntryFromId(tx, spareId)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, len(spare.Bricks) == 0, spare.Bricks)
+		tests.Assert(t, spare.Info.Storage.Free == 300*GB, spare.Info.Storage)
+		tests.Assert(t, spare.Info.Storage.Used == 0, spare.Info.Storage)
+		return nil
+	})
+}
+
+func TestReplaceDeviceBricksReleasesFailed(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	deviceId, spareId := sampleDeviceWithBricks(t, app, 0)
+
+	// Fail the replace of the first brick only
+	calls := 0
+	app.xo.MockVolumeReplaceBrick = func(host string, volume string,
+		oldBrick *executors.BrickInfo, newBrick *executors.BrickInfo) error {
+		calls++
+		if calls == 1 {
+			return ErrNoReplacement
+		}
+		return nil
+	}
+
+	var spareFree uint64
+	app.db.View(func(tx *bolt.Tx) error {
+		spare, err := NewDeviceEntryFromId(tx, spareId)
+		tests.Assert(t, err == nil)
+		spareFree = spare.Info.Storage.Free
+		return nil
+	})
+
+	err := ReplaceDeviceBricks(app.db, app.executor, app.Allocator(), deviceId)
+	tests.Assert(t, err != nil, "expected err != nil")
+	tests.Assert(t, calls == 2, calls)
+
+	// The other brick was replaced and the reservation of the failed
+	// one released
+	app.db.View(func(tx *bolt.Tx) error {
+		d, err := NewDeviceEntryFromId(tx, deviceId)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, len(d.Bricks) == 1, d.Bricks)
+
+		spare, err := NewDeviceEntryFromId(tx, spareId)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, len(spare.Bricks) == 1, spare.Bricks)
+		b, err := NewBrickEntryFromId(tx, spare.Bricks[0])
+		tests.Assert(t, err == nil)
+		tests.Assert(t, spare.Info.Storage.Free == spareFree-b.TotalSize(),
+			spare.Info.Storage, b.TotalSize())
+		return nil
+	})
+}
+
+func TestReplaceDeviceBricksHttp(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	c := client.NewClientNoAuth(ts.URL)
+	tests.Assert(t, c != nil)
+
+	deviceId, _ := sampleDeviceWithBricks(t, app, 0)
+
+	info, err := c.DeviceReplaceBricks(deviceId)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, info.Id == deviceId)
+	tests.Assert(t, len(info.Bricks) == 0, info.Bricks)
+
+	_, err = c.DeviceReplaceBricks("12345")
+	tests.Assert(t, err != nil)
+}
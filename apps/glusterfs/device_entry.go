@@ -175,10 +175,15 @@ func (d *DeviceEntry) Delete(tx *bolt.Tx) error {
 		return ErrConflict
 	}
 
+	if err := deleteStateReason(tx, d.Info.Id); err != nil {
+		return err
+	}
 	return EntryDelete(tx, d, d.Info.Id)
 }
 
-func (d *DeviceEntry) modifyState(db wdb.DB, s api.EntryState) error {
+func (d *DeviceEntry) modifyState(db wdb.DB, s api.EntryState,
+	reason *api.StateReason) error {
+
 	return db.Update(func(tx *bolt.Tx) error {
 		// Save state
 		d.State = s
@@ -186,7 +191,7 @@ func (d *DeviceEntry) modifyState(db wdb.DB, s api.EntryState) error {
 		if err := d.Save(tx); err != nil {
 			return err
 		}
-		return nil
+		return updateStateReason(tx, d.Info.Id, s, reason)
 	})
 }
 
@@ -195,21 +200,33 @@ func (d *DeviceEntry) SetState(db wdb.DB,
 	a Allocator,
 	s api.EntryState) error {
 
+	return d.SetStateWithReason(db, e, a, s, nil)
+}
+
+// SetStateWithReason changes the state of the device like SetState,
+// saving the reason of the new state along with it
+func (d *DeviceEntry) SetStateWithReason(db wdb.DB,
+	e executors.Executor,
+	a Allocator,
+	s api.EntryState,
+	reason *api.StateReason) error {
+
 	if e := d.stateCheck(s); e != nil {
 		return e
 	}
 	if d.State == s {
-		return nil
+		return keepStateReason(db, d.Info.Id, s, reason)
 	}
 
 	switch s {
-	case api.EntryStateOffline, api.EntryStateOnline:
+	case api.EntryStateOffline, api.EntryStateOnline,
+		api.EntryStateDraining, api.EntryStateMaintenance:
 		// simply update the state and move on
-		if err := d.modifyState(db, s); err != nil {
+		if err := d.modifyState(db, s, reason); err != nil {
 			return err
 		}
 	case api.EntryStateFailed:
-		if err := d.Remove(db, e, a); err != nil {
+		if err := d.removeWithProgress(db, e, a, nil, reason); err != nil {
 			if err == ErrNoReplacement {
 				return logger.LogError("Unable to delete device [%v] as no device was found to replace it", d.Id())
 			}
@@ -219,6 +236,28 @@ func (d *DeviceEntry) SetState(db wdb.DB,
 	return nil
 }
 
+// Drain takes the device offline, so no new bricks are placed on it,
+// and migrates every brick on the device to other devices, leaving
+// the device in failed state and ready to be deleted.
+func (d *DeviceEntry) Drain(db wdb.DB,
+	e executors.Executor,
+	a Allocator,
+	reason *api.StateReason) error {
+
+	// The device is left offline, with the reason, if not every
+	// brick could be moved
+	if d.State == api.EntryStateOnline {
+		logger.Info("Disabling device %v before removing it", d.Info.Id)
+		err := d.SetStateWithReason(db, e, a, api.EntryStateOffline, reason)
+		if err != nil {
+			return err
+		}
+	} else if err := keepStateReason(db, d.Info.Id, d.State, reason); err != nil {
+		return err
+	}
+	return d.SetStateWithReason(db, e, a, api.EntryStateFailed, reason)
+}
+
 func (d *DeviceEntry) stateCheck(s api.EntryState) error {
 	// Check current state
 	switch d.State {
@@ -228,8 +267,8 @@ func (d *DeviceEntry) stateCheck(s api.EntryState) error {
 		switch s {
 		case api.EntryStateFailed:
 			return nil
-		case api.EntryStateOnline:
-			return fmt.Errorf("Cannot move a failed/removed device to online state")
+		case api.EntryStateOnline, api.EntryStateDraining, api.EntryStateMaintenance:
+			return fmt.Errorf("Cannot move a failed/removed device to %v state", s)
 		case api.EntryStateOffline:
 			return nil
 		default:
@@ -241,7 +280,7 @@ func (d *DeviceEntry) stateCheck(s api.EntryState) error {
 		switch s {
 		case api.EntryStateOnline:
 			return nil
-		case api.EntryStateOffline:
+		case api.EntryStateOffline, api.EntryStateDraining, api.EntryStateMaintenance:
 			return nil
 		case api.EntryStateFailed:
 			return fmt.Errorf("Device must be offline before remove operation is performed, device:%v", d.Id())
@@ -249,10 +288,10 @@ func (d *DeviceEntry) stateCheck(s api.EntryState) error {
 			return fmt.Errorf("Unknown state type: %v", s)
 		}
 
-	// Device is in disabled/offline state
-	case api.EntryStateOffline:
+	// Device is in disabled/offline, draining or maintenance state
+	case api.EntryStateOffline, api.EntryStateDraining, api.EntryStateMaintenance:
 		switch s {
-		case api.EntryStateOffline:
+		case api.EntryStateOffline, api.EntryStateDraining, api.EntryStateMaintenance:
 			return nil
 		case api.EntryStateOnline:
 			return nil
@@ -274,9 +313,20 @@ func (d *DeviceEntry) NewInfoResponse(tx *bolt.Tx) (*api.DeviceInfoResponse, err
 	info.Id = d.Info.Id
 	info.Name = d.Info.Name
 	info.Storage = d.Info.Storage
+	info.Storage.Free = d.StorageAvailable()
 	info.State = d.State
+	info.StateReason = stateReason(tx, d.Info.Id)
 	info.Bricks = make([]api.BrickInfo, 0)
 
+	// The tags of the device are kept in its node
+	node, err := NewNodeEntryFromId(tx, d.NodeId)
+	if err == nil {
+		info.Tags = copyTags(node.DeviceTags[d.Info.Id])
+		info.Enclosure = node.DeviceEnclosures[d.Info.Id]
+	} else if err != ErrNotFound {
+		return nil, err
+	}
+
 	// Add each drive information
 	for _, id := range d.Bricks {
 		brick, err := NewBrickEntryFromId(tx, id)
@@ -294,6 +344,38 @@ func (d *DeviceEntry) NewInfoResponse(tx *bolt.Tx) (*api.DeviceInfoResponse, err
 	return info, nil
 }
 
+// NewLvmResponse returns the names of the volume group of the device and
+// of the logical volumes of its bricks
+func (d *DeviceEntry) NewLvmResponse(tx *bolt.Tx) (*api.DeviceLvmResponse, error) {
+
+	godbc.Require(tx != nil)
+
+	resp := &api.DeviceLvmResponse{
+		Id:     d.Info.Id,
+		Name:   d.Info.Name,
+		NodeId: d.NodeId,
+		Vg:     utils.VgIdToName(d.Info.Id),
+		Bricks: []api.DeviceLvmBrick{},
+	}
+	for _, id := range d.Bricks {
+		brick, err := NewBrickEntryFromId(tx, id)
+		if err != nil {
+			return nil, err
+		}
+		lvm := brick.lvmInfo()
+		lvs := api.DeviceLvmBrick{
+			Id:       brick.Info.Id,
+			VolumeId: brick.Info.VolumeId,
+			ThinPool: lvm.ThinPool,
+			Lv:       lvm.Lv,
+			Path:     brick.Info.Path,
+		}
+		resp.Bricks = append(resp.Bricks, lvs)
+	}
+
+	return resp, nil
+}
+
 func (d *DeviceEntry) Marshal() ([]byte, error) {
 	var buffer bytes.Buffer
 	enc := gob.NewEncoder(&buffer)
@@ -344,7 +426,47 @@ func (d *DeviceEntry) StorageFree(amount uint64) {
 }
 
 func (d *DeviceEntry) StorageCheck(amount uint64) bool {
-	return d.Info.Storage.Free > amount
+	return d.StorageAvailable() > amount
+}
+
+// StorageAvailable returns the free space of the device that can be
+// allocated to new bricks. Thin pools whose snapshots outgrew the space
+// reserved for them by the snapshot factor will have to be extended into
+// the free space of the volume group, so that space is not available.
+func (d *DeviceEntry) StorageAvailable() uint64 {
+	if d.Info.Storage.SnapshotOverhead >= d.Info.Storage.Free {
+		return 0
+	}
+	return d.Info.Storage.Free - d.Info.Storage.SnapshotOverhead
+}
+
+// snapshotOverhead returns the amount of space used by snapshots in the
+// thin pools of the bricks on this device beyond the snapshot space
+// reserved when the bricks were created.
+func (d *DeviceEntry) snapshotOverhead(tx *bolt.Tx,
+	usage []executors.ThinPoolUsage) (uint64, error) {
+
+	pools := map[string]executors.ThinPoolUsage{}
+	for _, tp := range usage {
+		pools[tp.ThinPool] = tp
+	}
+
+	var overhead uint64
+	for _, id := range d.Bricks {
+		brick, err := NewBrickEntryFromId(tx, id)
+		if err != nil {
+			return 0, err
+		}
+		tp, ok := pools[utils.BrickIdToThinPoolName(brick.Info.Id)]
+		if !ok {
+			continue
+		}
+		reserved := brick.TpSize - brick.Info.Size
+		if used := tp.SnapshotUsed(); used > reserved {
+			overhead += used - reserved
+		}
+	}
+	return overhead, nil
 }
 
 func (d *DeviceEntry) SetExtentSize(amount uint64) {
@@ -411,10 +533,22 @@ func (d *DeviceEntry) Remove(db wdb.DB,
 	executor executors.Executor,
 	allocator Allocator) (e error) {
 
-	if e = RunOperation(
-		NewDeviceRemoveOperation(d.Info.Id, allocator, db),
-		allocator,
-		executor); e != nil {
+	return d.removeWithProgress(db, executor, allocator, nil, nil)
+}
+
+// removeWithProgress moves all the bricks from the device like Remove,
+// calling brickDone after each brick is handled. The reason, if any,
+// is saved when the device is marked failed.
+func (d *DeviceEntry) removeWithProgress(db wdb.DB,
+	executor executors.Executor,
+	allocator Allocator,
+	brickDone brickMigrationFunc,
+	reason *api.StateReason) (e error) {
+
+	dro := NewDeviceRemoveOperation(d.Info.Id, allocator, db)
+	dro.brickDone = brickDone
+	dro.reason = reason
+	if e = RunOperation(dro, allocator, executor); e != nil {
 		return e
 	}
 	// tests currently expect d to be updated to match db state
@@ -430,10 +564,19 @@ func (d *DeviceEntry) Remove(db wdb.DB,
 
 }
 
+// brickMigrationFunc is called with the state of a brick, and the
+// error that caused it to fail if any, once it has been moved off the
+// device being removed.
+type brickMigrationFunc func(brickId, state string, err error)
+
 func (d *DeviceEntry) removeBricksFromDevice(db wdb.DB,
 	executor executors.Executor,
-	allocator Allocator) (e error) {
+	allocator Allocator,
+	brickDone brickMigrationFunc) (e error) {
 
+	if brickDone == nil {
+		brickDone = func(brickId, state string, err error) {}
+	}
 	var errBrickWithEmptyPath error = fmt.Errorf("Brick has no path")
 
 	for _, brickId := range d.Bricks {
@@ -459,15 +602,19 @@ func (d *DeviceEntry) removeBricksFromDevice(db wdb.DB,
 		if err != nil {
 			if err == errBrickWithEmptyPath {
 				logger.Warning("Skipping brick with empty path, brickID: %v, volumeID: %v, error: %v", brickEntry.Info.Id, brickEntry.Info.VolumeId, err)
+				brickDone(brickId, api.BrickMigrationSkipped, nil)
 				continue
 			}
+			brickDone(brickId, api.BrickMigrationFailed, err)
 			return err
 		}
 		logger.Info("Replacing brick %v on device %v on node %v", brickEntry.Id(), d.Id(), d.NodeId)
 		err = volumeEntry.replaceBrickInVolume(db, executor, allocator, brickEntry.Id())
 		if err != nil {
+			brickDone(brickId, api.BrickMigrationFailed, err)
 			return logger.Err(fmt.Errorf("Failed to remove device, error: %v", err))
 		}
+		brickDone(brickId, api.BrickMigrationDone, nil)
 	}
 	return nil
 }
@@ -503,10 +650,10 @@ func PendingOperationsOnDevice(db wdb.RODB, deviceId string) (pdev bool, e error
 	return
 }
 
-func (d *DeviceEntry) markFailed(db wdb.DB) error {
+func (d *DeviceEntry) markFailed(db wdb.DB, reason *api.StateReason) error {
 	// this is done on the ID in order to force a full fetch-check
 	// inside one transaction
-	err := markEmptyDeviceFailed(db, d.Info.Id)
+	err := markEmptyDeviceFailed(db, d.Info.Id, reason)
 	if err == nil {
 		// update the in-memory device state to match
 		// that in the db
@@ -520,17 +667,19 @@ func (d *DeviceEntry) markFailed(db wdb.DB) error {
 // if so marks it failed. If the change was applied the function
 // returns nil. If ErrConflict is returned the device was not
 // empty. Any other error is a database failure.
-func markEmptyDeviceFailed(db wdb.DB, id string) error {
-	return markDeviceFailed(db, id, false)
+func markEmptyDeviceFailed(db wdb.DB, id string, reason *api.StateReason) error {
+	return markDeviceFailed(db, id, false, reason)
 }
 
-// markDeviceFailed takes a device id and a force flag,
-// and in one transaction, checks the status of the device
-// and if ready or force is set, sets the failed flag.
+// markDeviceFailed takes a device id, a force flag and the reason
+// of the failure, and in one transaction, checks the status of the
+// device and if ready or force is set, sets the failed flag.
 // If the change was applied the function
 // returns nil. If ErrConflict is returned the device was not
 // empty. Any other error is a database failure.
-func markDeviceFailed(db wdb.DB, id string, force bool) error {
+func markDeviceFailed(db wdb.DB, id string, force bool,
+	reason *api.StateReason) error {
+
 	return db.Update(func(tx *bolt.Tx) error {
 		d, err := NewDeviceEntryFromId(tx, id)
 		if err != nil {
@@ -540,7 +689,10 @@ func markDeviceFailed(db wdb.DB, id string, force bool) error {
 			return ErrConflict
 		}
 		d.State = api.EntryStateFailed
-		return d.Save(tx)
+		if err := d.Save(tx); err != nil {
+			return err
+		}
+		return updateStateReason(tx, id, d.State, reason)
 	})
 }
 
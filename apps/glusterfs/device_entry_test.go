@@ -621,6 +621,119 @@ func TestDeviceEntryStorage(t *testing.T) {
 	tests.Assert(t, d.Info.Storage.Used == 0)
 }
 
+func TestDeviceEntryStorageSnapshotOverhead(t *testing.T) {
+	d := NewDeviceEntry()
+	d.StorageSet(2000)
+	d.StorageAllocate(1000)
+	tests.Assert(t, d.StorageAvailable() == 1000)
+	tests.Assert(t, d.StorageCheck(900))
+
+	d.Info.Storage.SnapshotOverhead = 200
+	tests.Assert(t, d.Info.Storage.Free == 1000)
+	tests.Assert(t, d.StorageAvailable() == 800)
+	tests.Assert(t, !d.StorageCheck(900))
+
+	d.Info.Storage.SnapshotOverhead = 1500
+	tests.Assert(t, d.StorageAvailable() == 0)
+	tests.Assert(t, !d.StorageCheck(1))
+}
+
+func TestDeviceEntrySnapshotOverhead(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	d := NewDeviceEntry()
+	d.Info.Id = "abc"
+	d.NodeId = "def"
+	d.StorageSet(10 * GB)
+
+	// two bricks reserving 50% extra for snapshots
+	b1 := d.NewBrickEntry(1*GB, 1.5, 1000, "1")
+	tests.Assert(t, b1 != nil)
+	d.BrickAdd(b1.Info.Id)
+	b2 := d.NewBrickEntry(1*GB, 1.5, 1000, "1")
+	tests.Assert(t, b2 != nil)
+	d.BrickAdd(b2.Info.Id)
+
+	err := app.db.Update(func(tx *bolt.Tx) error {
+		if err := d.Save(tx); err != nil {
+			return err
+		}
+		if err := b1.Save(tx); err != nil {
+			return err
+		}
+		return b2.Save(tx)
+	})
+	tests.Assert(t, err == nil, err)
+
+	usage := []executors.ThinPoolUsage{
+		// snapshots hold less than the reserved space
+		executors.ThinPoolUsage{
+			ThinPool:  utils.BrickIdToThinPoolName(b1.Info.Id),
+			Used:      1*GB + 256*MB,
+			BrickUsed: 1 * GB,
+			Snapshots: 1,
+		},
+		// snapshots hold 256MB more than the reserved space
+		executors.ThinPoolUsage{
+			ThinPool:  utils.BrickIdToThinPoolName(b2.Info.Id),
+			Used:      1*GB + 768*MB,
+			BrickUsed: 1 * GB,
+			Snapshots: 2,
+		},
+		// thin pool not managed by heketi
+		executors.ThinPoolUsage{
+			ThinPool:  "tp_unknown",
+			Used:      5 * GB,
+			Snapshots: 1,
+		},
+	}
+
+	err = app.db.View(func(tx *bolt.Tx) error {
+		overhead, err := d.snapshotOverhead(tx, usage)
+		tests.Assert(t, err == nil, err)
+		tests.Assert(t, overhead == 256*MB, "expected overhead == 256MB, got:", overhead)
+		return nil
+	})
+	tests.Assert(t, err == nil, err)
+
+	// the overhead is reported as not free
+	d.Info.Storage.SnapshotOverhead = 256 * MB
+	err = app.db.View(func(tx *bolt.Tx) error {
+		info, err := d.NewInfoResponse(tx)
+		tests.Assert(t, err == nil, err)
+		tests.Assert(t, info.Storage.SnapshotOverhead == 256*MB)
+		tests.Assert(t, info.Storage.Free == d.Info.Storage.Free-256*MB)
+		return nil
+	})
+	tests.Assert(t, err == nil, err)
+
+	// the overhead is refreshed without a resync, and kept when the
+	// snapshots can not be listed
+	app.xo.MockDeviceSnapshotUsage = func(host, vgid string) ([]executors.ThinPoolUsage, error) {
+		return usage, nil
+	}
+	err = RefreshSnapshotOverhead(app.db, app.executor, "host", d.Info.Id)
+	tests.Assert(t, err == nil, err)
+	app.xo.MockDeviceSnapshotUsage = func(host, vgid string) ([]executors.ThinPoolUsage, error) {
+		return nil, fmt.Errorf("lvs failed")
+	}
+	err = RefreshSnapshotOverhead(app.db, app.executor, "host", d.Info.Id)
+	tests.Assert(t, err != nil)
+	err = app.db.View(func(tx *bolt.Tx) error {
+		device, err := NewDeviceEntryFromId(tx, d.Info.Id)
+		tests.Assert(t, err == nil, err)
+		tests.Assert(t, device.Info.Storage.SnapshotOverhead == 256*MB,
+			device.Info.Storage.SnapshotOverhead)
+		return nil
+	})
+	tests.Assert(t, err == nil, err)
+}
+
 func TestDeviceSetStateFailed(t *testing.T) {
 	tmpfile := tests.Tempfile()
 	defer os.Remove(tmpfile)
@@ -758,6 +871,111 @@ func TestDeviceSetStateOfflineOnline(t *testing.T) {
 	tests.Assert(t, err == nil)
 }
 
+func TestDeviceSetStateDrainingMaintenance(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	err := setupSampleDbWithTopology(app,
+		1,      // clusters
+		5,      // nodes_per_cluster
+		1,      // devices_per_node,
+		500*GB, // disksize
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	createVolume := func() *VolumeEntry {
+		req := &api.VolumeCreateRequest{}
+		req.Size = 10
+		req.Durability.Type = api.DurabilityReplicate
+		req.Durability.Replicate.Replica = 3
+		v := NewVolumeEntryFromRequest(req)
+		err := v.Create(app.db, app.executor, app.Allocator())
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		return v
+	}
+	v := createVolume()
+
+	var d *DeviceEntry
+	var n *NodeEntry
+	app.db.View(func(tx *bolt.Tx) error {
+		b, err := NewBrickEntryFromId(tx, v.Bricks[0])
+		tests.Assert(t, err == nil)
+		d, err = NewDeviceEntryFromId(tx, b.Info.DeviceId)
+		tests.Assert(t, err == nil)
+
+		// A node without a brick of the volume
+		nodes, err := NodeList(tx)
+		tests.Assert(t, err == nil)
+		used := map[string]bool{}
+		for _, id := range v.Bricks {
+			b, err := NewBrickEntryFromId(tx, id)
+			tests.Assert(t, err == nil)
+			used[b.Info.NodeId] = true
+		}
+		for _, id := range nodes {
+			if !used[id] {
+				n, err = NewNodeEntryFromId(tx, id)
+				tests.Assert(t, err == nil)
+			}
+		}
+		return nil
+	})
+	tests.Assert(t, n != nil)
+
+	// Draining devices and nodes in maintenance keep their bricks
+	err = d.SetState(app.db, app.executor, app.Allocator(), api.EntryStateDraining)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, d.State == api.EntryStateDraining)
+	tests.Assert(t, len(d.Bricks) == 1, d.Bricks)
+	err = n.SetState(app.db, app.executor, app.Allocator(), api.EntryStateMaintenance)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, n.State == api.EntryStateMaintenance)
+
+	// but get no new bricks
+	v = createVolume()
+	app.db.View(func(tx *bolt.Tx) error {
+		for _, id := range v.Bricks {
+			b, err := NewBrickEntryFromId(tx, id)
+			tests.Assert(t, err == nil)
+			tests.Assert(t, b.Info.DeviceId != d.Info.Id, b.Info)
+			tests.Assert(t, b.Info.NodeId != n.Info.Id, b.Info)
+		}
+		return nil
+	})
+
+	// Devices and nodes leave draining and maintenance for any state
+	err = d.SetState(app.db, app.executor, app.Allocator(), api.EntryStateMaintenance)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	err = d.SetState(app.db, app.executor, app.Allocator(), api.EntryStateOnline)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, d.State == api.EntryStateOnline)
+	err = n.SetState(app.db, app.executor, app.Allocator(), api.EntryStateOnline)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, n.State == api.EntryStateOnline)
+
+	// Online devices are failed through maintenance, and failed devices
+	// can not go back to maintenance
+	app.db.View(func(tx *bolt.Tx) error {
+		var err error
+		d, err = NewDeviceEntryFromId(tx, n.Devices[0])
+		tests.Assert(t, err == nil)
+		return nil
+	})
+	err = d.SetState(app.db, app.executor, app.Allocator(), api.EntryStateFailed)
+	tests.Assert(t, err != nil)
+	err = d.SetState(app.db, app.executor, app.Allocator(), api.EntryStateMaintenance)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	err = d.SetState(app.db, app.executor, app.Allocator(), api.EntryStateFailed)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	err = d.SetState(app.db, app.executor, app.Allocator(), api.EntryStateMaintenance)
+	tests.Assert(t, err != nil)
+	tests.Assert(t, d.State == api.EntryStateFailed)
+}
+
 func TestDeviceSetStateFailedWithBricks(t *testing.T) {
 	tmpfile := tests.Tempfile()
 	defer os.Remove(tmpfile)
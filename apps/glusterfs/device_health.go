@@ -0,0 +1,302 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/heketi/heketi/executors"
+	wdb "github.com/heketi/heketi/pkg/db"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/heketi/pkg/utils"
+)
+
+var (
+	// Seconds between the checks of the devices of every online node.
+	// Zero disables the checks.
+	DeviceHealthCheckInterval = 0
+
+	// Seconds a device may stay unreachable before the checks take it
+	// offline
+	DeviceFailureTimeout = 600
+
+	// Whether the devices taken offline by the checks are failed, their
+	// bricks being replaced on healthy devices
+	DeviceAutoFailover = false
+
+	deviceHealth = &deviceHealthTracker{since: map[string]time.Time{}}
+
+	// Output of the lvm commands showing that the volume group of a
+	// device is missing or that the device is failing
+	deviceFailureOutputs = []string{
+		"not found",
+		"couldn't find device",
+		"input/output error",
+		"i/o error",
+	}
+)
+
+// deviceFailed returns true if the error of the check of the volume
+// group of a device shows that the device is missing or failing. The
+// command must have run and failed: connection errors and timeouts
+// say nothing about the device.
+func deviceFailed(err error) bool {
+	cerr, ok := err.(*utils.CommandError)
+	if !ok {
+		return false
+	}
+	output := strings.ToLower(cerr.Stderr + cerr.Stdout)
+	for _, o := range deviceFailureOutputs {
+		if strings.Contains(output, o) {
+			return true
+		}
+	}
+	return false
+}
+
+// deviceHealthTracker keeps the time the devices found unreachable by
+// the checks were first found unreachable
+type deviceHealthTracker struct {
+	lock  sync.Mutex
+	since map[string]time.Time
+}
+
+// unreachable records the device as unreachable and returns how long
+// it has been unreachable
+func (t *deviceHealthTracker) unreachable(id string) time.Duration {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	since, ok := t.since[id]
+	if !ok {
+		since = time.Now()
+		t.since[id] = since
+	}
+	return time.Since(since)
+}
+
+// forget drops the device, found reachable again or taken offline
+func (t *deviceHealthTracker) forget(id string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	delete(t.since, id)
+}
+
+// reset forgets the devices not in the set
+func (t *deviceHealthTracker) reset(keep map[string]bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	for id := range t.since {
+		if !keep[id] {
+			delete(t.since, id)
+		}
+	}
+}
+
+// unreachableDevice is a device unreachable for longer than the
+// failure timeout
+type unreachableDevice struct {
+	id    string
+	cause error
+}
+
+// checkDevicesHealth checks the online devices of every online node
+// and returns the devices unreachable for longer than the failure
+// timeout. The devices of a node whose glusterd can not be reached are
+// not checked, node outages being left to the node health checks, and
+// the time they were unreachable before the outage is forgotten.
+func checkDevicesHealth(db wdb.RODB, e executors.Executor) []unreachableDevice {
+	nodes := map[string][]*DeviceEntry{}
+	ids := map[string]bool{}
+	err := db.View(func(tx *bolt.Tx) error {
+		nodeIds, err := NodeList(tx)
+		if err != nil {
+			return err
+		}
+		for _, nodeId := range nodeIds {
+			node, err := NewNodeEntryFromId(tx, nodeId)
+			if err != nil {
+				return err
+			}
+			if !node.isOnline() {
+				continue
+			}
+			host := node.ManageHostName()
+			for _, deviceId := range node.Devices {
+				device, err := NewDeviceEntryFromId(tx, deviceId)
+				if err != nil {
+					return err
+				}
+				if device.isOnline() {
+					nodes[host] = append(nodes[host], device)
+					ids[deviceId] = true
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logger.LogError("Unable to list the devices to check: %v", err)
+		return nil
+	}
+
+	var lock sync.Mutex
+	failed := []unreachableDevice{}
+	check := func(device *DeviceEntry, cause error) {
+		if cause == nil {
+			deviceHealth.forget(device.Info.Id)
+			return
+		}
+		if !deviceFailed(cause) {
+			logger.Warning("Unable to check device %v on node %v, "+
+				"not counted as unreachable: %v",
+				device.Info.Name, device.NodeId, cause)
+			return
+		}
+		down := deviceHealth.unreachable(device.Info.Id)
+		logger.Warning("Device %v on node %v unreachable for %v: %v",
+			device.Info.Name, device.NodeId, down.Truncate(time.Second), cause)
+		if down >= time.Duration(DeviceFailureTimeout)*time.Second {
+			lock.Lock()
+			defer lock.Unlock()
+			failed = append(failed, unreachableDevice{
+				id:    device.Info.Id,
+				cause: cause,
+			})
+		}
+	}
+
+	var wg sync.WaitGroup
+	workers := make(chan struct{}, NodeHealthCheckWorkers)
+	for host, devices := range nodes {
+		wg.Add(1)
+		workers <- struct{}{}
+		go func(host string, devices []*DeviceEntry) {
+			defer wg.Done()
+			defer func() { <-workers }()
+			err := e.GlusterdCheck(host)
+			nodeHealth.record(host, err)
+			if err != nil {
+				logger.Warning("Skipping the devices of node %v, glusterd "+
+					"unreachable: %v", host, err)
+				for _, device := range devices {
+					deviceHealth.forget(device.Info.Id)
+				}
+				return
+			}
+			for _, device := range devices {
+				_, cause := e.GetDeviceInfo(host, device.Info.Name, device.Info.Id)
+				check(device, cause)
+			}
+		}(host, devices)
+	}
+	wg.Wait()
+
+	// The devices removed or taken offline are not tracked any more
+	deviceHealth.reset(ids)
+	return failed
+}
+
+// failUnreachableDevice takes offline the device unreachable for longer
+// than the failure timeout and, with automatic failover, queues the
+// failure of the device, replacing its bricks on healthy devices, in the
+// operation throttle. When the queue is full the device is left online
+// to be failed by a later check.
+func (a *App) failUnreachableDevice(id string, cause error) {
+	var (
+		device  *DeviceEntry
+		cluster string
+	)
+	err := a.db.View(func(tx *bolt.Tx) error {
+		var err error
+		device, err = NewDeviceEntryFromId(tx, id)
+		if err != nil {
+			return err
+		}
+		node, err := NewNodeEntryFromId(tx, device.NodeId)
+		if err != nil {
+			return err
+		}
+		cluster = node.Info.ClusterId
+		return nil
+	})
+	if err != nil {
+		logger.LogError("Unable to load unreachable device %v: %v", id, err)
+		return
+	}
+	if DeviceAutoFailover && !a.throttle.admit() {
+		logger.Warning("Operation queue full, failover of unreachable "+
+			"device %v postponed", id)
+		return
+	}
+	deviceHealth.forget(id)
+
+	reason := newStateReason(api.StateReasonUnreachable,
+		fmt.Sprintf("Unreachable for more than %v seconds: %v",
+			DeviceFailureTimeout, cause), "")
+	logger.Warning("Taking unreachable device %v on node %v offline",
+		device.Info.Name, device.NodeId)
+	err = device.SetStateWithReason(a.db, a.executor, a.Allocator(),
+		api.EntryStateOffline, reason)
+	if err != nil {
+		logger.LogError("Unable to take device %v offline: %v", id, err)
+		if DeviceAutoFailover {
+			a.throttle.cancel()
+		}
+		return
+	}
+	a.notify(api.EventDeviceFailed, id, "",
+		fmt.Sprintf("Device %v on node %v unreachable, taken offline",
+			device.Info.Name, device.NodeId))
+
+	if !DeviceAutoFailover {
+		return
+	}
+
+	// The bricks are replaced in the background, once the throttle
+	// lets the replaces run on the cluster and node of the device
+	clusters := []string{cluster}
+	nodes := []string{device.NodeId}
+	a.failovers.Add(1)
+	go func() {
+		defer a.failovers.Done()
+		a.throttle.acquire(clusters, nodes)
+		defer a.throttle.release(clusters, nodes)
+
+		logger.Info("Replacing the bricks of unreachable device %v", id)
+		err := device.SetStateWithReason(a.db, a.executor, a.Allocator(),
+			api.EntryStateFailed, reason)
+		if err != nil {
+			logger.LogError("Unable to replace the bricks of device %v: %v", id, err)
+			return
+		}
+		logger.Info("Replaced the bricks of unreachable device %v", id)
+		a.notify(api.EventDeviceFailed, id, "",
+			fmt.Sprintf("Device %v on node %v failed, its bricks replaced",
+				device.Info.Name, device.NodeId))
+	}()
+}
+
+// startDeviceHealthChecker checks the devices every
+// DeviceHealthCheckInterval seconds until the app is closed
+func (a *App) startDeviceHealthChecker() {
+	if DeviceHealthCheckInterval <= 0 || a.dbReadOnly {
+		return
+	}
+
+	a.runPeriodically(DeviceHealthCheckInterval, func() {
+		for _, d := range checkDevicesHealth(a.db, a.executor) {
+			a.failUnreachableDevice(d.id, d.cause)
+		}
+	})
+}
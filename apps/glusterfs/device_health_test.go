@@ -0,0 +1,211 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/heketi/heketi/executors"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/heketi/pkg/utils"
+	"github.com/heketi/tests"
+)
+
+func mockDeviceFailure(host, vgid string) error {
+	return &utils.CommandError{
+		Message: "Failed to run command",
+		Host:    host,
+		Stderr:  fmt.Sprintf("Volume group \"vg_%v\" not found", vgid),
+		Err:     fmt.Errorf("Process exited with status 5"),
+	}
+}
+
+func TestDeviceHealthFailover(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	defer func(timeout int, failover bool) {
+		DeviceFailureTimeout = timeout
+		DeviceAutoFailover = failover
+	}(DeviceFailureTimeout, DeviceAutoFailover)
+	defer deviceHealth.reset(nil)
+
+	err := setupSampleDbWithTopology(app,
+		1,      // clusters
+		4,      // nodes_per_cluster
+		1,      // devices_per_node,
+		500*GB, // disksize
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	req := &api.VolumeCreateRequest{}
+	req.Size = 100
+	req.Durability.Type = api.DurabilityReplicate
+	req.Durability.Replicate.Replica = 3
+	v := NewVolumeEntryFromRequest(req)
+	err = v.Create(app.db, app.executor, app.Allocator())
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	app.xo.MockVolumeInfo = func(host string, volume string) (*executors.Volume, error) {
+		return mockVolumeInfoFromDb(app.db, volume)
+	}
+	app.xo.MockHealInfo = func(host string, volume string) (*executors.HealInfo, error) {
+		return mockHealStatusFromDb(app.db, volume)
+	}
+
+	brick, _ := sampleBrick(t, app)
+	loadDevice := func(id string) *DeviceEntry {
+		var d *DeviceEntry
+		app.db.View(func(tx *bolt.Tx) error {
+			var err error
+			d, err = NewDeviceEntryFromId(tx, id)
+			tests.Assert(t, err == nil, "expected err == nil, got:", err)
+			return nil
+		})
+		return d
+	}
+	badDevice := loadDevice(brick.Info.DeviceId)
+
+	// Errors not showing the device failed are not counted
+	deviceSetup := app.xo.MockDeviceSetup
+	app.xo.MockDeviceSetup = func(host, device, vgid string) (*executors.DeviceInfo, error) {
+		if vgid == badDevice.Info.Id {
+			return nil, &utils.CommandError{
+				Message: "SSH command timeout",
+				Host:    host,
+				Err:     fmt.Errorf("SSH command timeout"),
+			}
+		}
+		return deviceSetup(host, device, vgid)
+	}
+	failed := checkDevicesHealth(app.db, app.executor)
+	tests.Assert(t, len(failed) == 0, failed)
+	tests.Assert(t, len(deviceHealth.since) == 0, deviceHealth.since)
+
+	// The volume group of the device is missing
+	app.xo.MockDeviceSetup = func(host, device, vgid string) (*executors.DeviceInfo, error) {
+		if vgid == badDevice.Info.Id {
+			return nil, mockDeviceFailure(host, vgid)
+		}
+		return deviceSetup(host, device, vgid)
+	}
+
+	// Devices are only failed once unreachable for the timeout
+	failed = checkDevicesHealth(app.db, app.executor)
+	tests.Assert(t, len(failed) == 0, failed)
+	tests.Assert(t, len(deviceHealth.since) == 1, deviceHealth.since)
+
+	DeviceFailureTimeout = 0
+	failed = checkDevicesHealth(app.db, app.executor)
+	tests.Assert(t, len(failed) == 1, failed)
+	tests.Assert(t, failed[0].id == badDevice.Info.Id, failed)
+	cause := failed[0].cause
+
+	// Without failover the device is only taken offline
+	DeviceAutoFailover = false
+	app.failUnreachableDevice(failed[0].id, cause)
+	d := loadDevice(badDevice.Info.Id)
+	tests.Assert(t, d.State == api.EntryStateOffline, d.State)
+	tests.Assert(t, len(d.Bricks) == 1, d.Bricks)
+	app.db.View(func(tx *bolt.Tx) error {
+		r := stateReason(tx, d.Info.Id)
+		tests.Assert(t, r != nil && r.Code == api.StateReasonUnreachable, r)
+		return nil
+	})
+	tests.Assert(t, len(deviceHealth.since) == 0, deviceHealth.since)
+
+	// Offline devices are not checked
+	failed = checkDevicesHealth(app.db, app.executor)
+	tests.Assert(t, len(failed) == 0, failed)
+
+	// With failover the device is left alone when the operation
+	// queue is full
+	DeviceAutoFailover = true
+	app.throttle = newOperationThrottle(0, 0, 0, 0)
+	app.failUnreachableDevice(d.Info.Id, cause)
+	app.failovers.Wait()
+	d = loadDevice(badDevice.Info.Id)
+	tests.Assert(t, d.State == api.EntryStateOffline, d.State)
+	tests.Assert(t, len(d.Bricks) == 1, d.Bricks)
+
+	// Otherwise the bricks of the device are replaced in the background
+	app.throttle = newOperationThrottle(0, 1, 0, 1)
+	app.failUnreachableDevice(d.Info.Id, cause)
+	app.failovers.Wait()
+	d = loadDevice(badDevice.Info.Id)
+	tests.Assert(t, d.State == api.EntryStateFailed, d.State)
+	tests.Assert(t, len(d.Bricks) == 0, d.Bricks)
+	app.db.View(func(tx *bolt.Tx) error {
+		v, err := NewVolumeEntryFromId(tx, v.Info.Id)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, len(v.Bricks) == 3, v.Bricks)
+		for _, id := range v.Bricks {
+			tests.Assert(t, id != brick.Info.Id, v.Bricks)
+		}
+		return nil
+	})
+
+	// The devices of a node whose glusterd is unreachable are not
+	// failed, however long the node is down
+	var node *NodeEntry
+	app.db.View(func(tx *bolt.Tx) error {
+		ids, err := NodeList(tx)
+		tests.Assert(t, err == nil)
+		for _, id := range ids {
+			n, err := NewNodeEntryFromId(tx, id)
+			tests.Assert(t, err == nil)
+			if n.Info.Id != badDevice.NodeId {
+				node = n
+			}
+		}
+		return nil
+	})
+	app.xo.MockGlusterdCheck = func(host string) error {
+		if host == node.ManageHostName() {
+			return fmt.Errorf("Mock glusterd failure")
+		}
+		return nil
+	}
+	failed = checkDevicesHealth(app.db, app.executor)
+	tests.Assert(t, len(failed) == 0, failed)
+	tests.Assert(t, len(deviceHealth.since) == 0, deviceHealth.since)
+
+	// Nor are the devices found unreachable before their node went down
+	app.xo.MockGlusterdCheck = func(host string) error { return nil }
+	DeviceFailureTimeout = 600
+	app.xo.MockDeviceSetup = func(host, device, vgid string) (*executors.DeviceInfo, error) {
+		if vgid == node.Devices[0] {
+			return nil, mockDeviceFailure(host, vgid)
+		}
+		return deviceSetup(host, device, vgid)
+	}
+	failed = checkDevicesHealth(app.db, app.executor)
+	tests.Assert(t, len(failed) == 0, failed)
+	tests.Assert(t, len(deviceHealth.since) == 1, deviceHealth.since)
+
+	DeviceFailureTimeout = 0
+	app.xo.MockGlusterdCheck = func(host string) error {
+		if host == node.ManageHostName() {
+			return fmt.Errorf("Mock glusterd failure")
+		}
+		return nil
+	}
+	failed = checkDevicesHealth(app.db, app.executor)
+	tests.Assert(t, len(failed) == 0, failed)
+	tests.Assert(t, len(deviceHealth.since) == 0, deviceHealth.since)
+	d = loadDevice(node.Devices[0])
+	tests.Assert(t, d.State == api.EntryStateOnline, d.State)
+}
@@ -0,0 +1,262 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"sort"
+
+	"github.com/boltdb/bolt"
+	"github.com/heketi/heketi/executors"
+	wdb "github.com/heketi/heketi/pkg/db"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/heketi/pkg/utils"
+)
+
+var (
+	// Seconds between the refreshes of the snapshot overhead of the
+	// online devices of every online node. Zero disables the refreshes.
+	SnapshotOverheadInterval = 0
+)
+
+// orphanedLvs returns the names of the logical volumes that are not the
+// brick, the thin pool or the snapshots of a brick of the device
+func (d *DeviceEntry) orphanedLvs(lvs []executors.LvInfo) []string {
+	known := map[string]bool{}
+	pools := map[string]bool{}
+	for _, id := range d.Bricks {
+		known[utils.BrickIdToName(id)] = true
+		known[utils.BrickIdToThinPoolName(id)] = true
+		pools[utils.BrickIdToThinPoolName(id)] = true
+	}
+
+	orphaned := []string{}
+	for _, lv := range lvs {
+		if known[lv.Name] {
+			continue
+		}
+		// Snapshots created by gluster in the thin pool of a brick
+		if pools[lv.ThinPool] {
+			continue
+		}
+		orphaned = append(orphaned, lv.Name)
+	}
+	sort.Strings(orphaned)
+	return orphaned
+}
+
+// ResyncDevice updates the storage of the device with the free space of
+// its volume group and the space held by snapshots, and reports the
+// logical volumes of the volume group no brick of the device uses.
+// Orphaned logical volumes are left for the administrator to remove.
+func ResyncDevice(db wdb.DB,
+	executor executors.Executor,
+	id string) (*api.DeviceResyncResponse, error) {
+
+	var (
+		device *DeviceEntry
+		node   *NodeEntry
+	)
+	err := db.View(func(tx *bolt.Tx) error {
+		var err error
+		device, err = NewDeviceEntryFromId(tx, id)
+		if err != nil {
+			return err
+		}
+		node, err = NewNodeEntryFromId(tx, device.NodeId)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Get actual device info from manage host
+	host := node.ManageHostName()
+	info, err := executor.GetDeviceInfo(host, device.Info.Name, device.Info.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get the space held by snapshots in the thin pools of the device.
+	// The free space is still worth updating when the snapshots can not
+	// be listed, so the previous overhead is kept.
+	usage, err := executor.GetDeviceSnapshotUsage(host, device.Info.Id)
+	if err != nil {
+		logger.Warning("Unable to get the snapshot usage of device %v, "+
+			"keeping the previous snapshot overhead: %v", id, err)
+		usage = nil
+	}
+
+	lvs, err := executor.GetDeviceLvs(host, device.Info.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &api.DeviceResyncResponse{
+		Id:          id,
+		VgSize:      info.TotalSize,
+		ExtentSize:  info.ExtentSize,
+		FreeExtents: info.FreeExtents,
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+
+		// Reload device in current transaction
+		device, err := NewDeviceEntryFromId(tx, id)
+		if err != nil {
+			logger.Err(err)
+			return err
+		}
+		resp.OldStorage = device.Info.Storage
+		resp.Storage = device.Info.Storage
+		resp.OrphanedLvs = device.orphanedLvs(lvs)
+
+		overhead := device.Info.Storage.SnapshotOverhead
+		if usage != nil {
+			overhead, err = device.snapshotOverhead(tx, usage)
+			if err != nil {
+				logger.Err(err)
+				return err
+			}
+		}
+
+		// Note that method GetDeviceInfo returns the free disk space available for allocation.
+		// The free disk space is equal to the total disk space only if we haven't already
+		// allocated space, because every allocation decreases the free disk space returned
+		// by method GetDeviceInfo. In order to calculate a new total space we need to sum
+		// the free disk space and the space used by heketi.
+		if device.Info.Storage.Total == info.Size+device.Info.Storage.Used &&
+			device.Info.Storage.SnapshotOverhead == overhead {
+			logger.Info("Device %v is up to date", device.Info.Id)
+			return nil
+		}
+
+		logger.Debug("Free space of '%v' (%v) has changed %v -> %v", device.Info.Name, device.Info.Id,
+			device.Info.Storage.Free, info.Size)
+
+		newFreeSize := info.Size
+		newTotalSize := newFreeSize + device.Info.Storage.Used
+
+		logger.Info("Updating device %v, total: %v -> %v, free: %v -> %v, snapshot overhead: %v -> %v",
+			device.Info.Name,
+			device.Info.Storage.Total, newTotalSize,
+			device.Info.Storage.Free, newFreeSize,
+			device.Info.Storage.SnapshotOverhead, overhead)
+
+		device.Info.Storage.Total = newTotalSize
+		device.Info.Storage.Free = newFreeSize
+		device.Info.Storage.SnapshotOverhead = overhead
+		resp.Storage = device.Info.Storage
+
+		// Save updated device
+		err = device.Save(tx)
+		if err != nil {
+			logger.Err(err)
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, lv := range resp.OrphanedLvs {
+		logger.Warning("Logical volume %v of device %v is not used by any brick",
+			lv, id)
+	}
+	logger.Info("Updated device %v", id)
+
+	return resp, nil
+}
+
+// RefreshSnapshotOverhead updates the space held by snapshots beyond
+// the space reserved for them on the device, leaving the rest of the
+// storage of the device unchanged
+func RefreshSnapshotOverhead(db wdb.DB,
+	executor executors.Executor,
+	host string,
+	id string) error {
+
+	usage, err := executor.GetDeviceSnapshotUsage(host, id)
+	if err != nil {
+		return err
+	}
+
+	return db.Update(func(tx *bolt.Tx) error {
+		device, err := NewDeviceEntryFromId(tx, id)
+		if err != nil {
+			return err
+		}
+		overhead, err := device.snapshotOverhead(tx, usage)
+		if err != nil {
+			return err
+		}
+		if device.Info.Storage.SnapshotOverhead == overhead {
+			return nil
+		}
+		logger.Info("Snapshot overhead of device %v changed %v -> %v",
+			id, device.Info.Storage.SnapshotOverhead, overhead)
+		device.Info.Storage.SnapshotOverhead = overhead
+		return device.Save(tx)
+	})
+}
+
+func refreshAllSnapshotOverhead(db wdb.DB, executor executors.Executor) {
+	devices := map[string]string{}
+	err := db.View(func(tx *bolt.Tx) error {
+		nodeIds, err := NodeList(tx)
+		if err != nil {
+			return err
+		}
+		for _, nodeId := range nodeIds {
+			node, err := NewNodeEntryFromId(tx, nodeId)
+			if err != nil {
+				return err
+			}
+			if !node.isOnline() {
+				continue
+			}
+			for _, deviceId := range node.Devices {
+				device, err := NewDeviceEntryFromId(tx, deviceId)
+				if err != nil {
+					return err
+				}
+				if device.isOnline() {
+					devices[deviceId] = node.ManageHostName()
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logger.LogError("Unable to list the devices to refresh: %v", err)
+		return
+	}
+
+	for id, host := range devices {
+		if err := RefreshSnapshotOverhead(db, executor, host, id); err != nil {
+			logger.Warning("Unable to refresh the snapshot overhead of "+
+				"device %v, keeping the previous one: %v", id, err)
+		}
+	}
+}
+
+// startSnapshotOverheadRefresher refreshes the snapshot overhead of the
+// devices every SnapshotOverheadInterval seconds until the app is
+// closed, so that the space taken by growing snapshots is not allocated
+// between resyncs
+func (a *App) startSnapshotOverheadRefresher() {
+	if SnapshotOverheadInterval <= 0 || a.dbReadOnly {
+		return
+	}
+
+	a.runPeriodically(SnapshotOverheadInterval, func() {
+		refreshAllSnapshotOverhead(a.db, a.executor)
+	})
+}
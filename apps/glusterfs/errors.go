@@ -24,4 +24,6 @@ var (
 	ErrAccessList       = errors.New("Unable to access list")
 	ErrKeyExists        = errors.New("Key already exists in the database")
 	ErrNoReplacement    = errors.New("No Replacement was found for resource requested to be removed")
+	ErrAuthDisabled     = errors.New("Block volume does not have auth enabled")
+	ErrNoSelfHeal       = errors.New("Volume has no replica or disperse sets to heal")
 )
@@ -0,0 +1,74 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"sync"
+
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+)
+
+var (
+	// Events kept for the event feed. The oldest events are dropped
+	// once there are more.
+	EventFeedSize = 1000
+)
+
+// eventFeed keeps the last events raised since the server started
+type eventFeed struct {
+	lock   sync.Mutex
+	size   int
+	events []api.Event
+}
+
+func newEventFeed(size int) *eventFeed {
+	return &eventFeed{
+		size:   size,
+		events: []api.Event{},
+	}
+}
+
+func (f *eventFeed) add(e api.Event) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.events = append(f.events, e)
+	if len(f.events) > f.size {
+		f.events = f.events[len(f.events)-f.size:]
+	}
+}
+
+// EventFilter selects the events of the feed
+type EventFilter struct {
+	// Only the events raised at or after this time, if set
+	Since int64
+	// Only the events about the volumes of the tenant when Scoped is
+	// set, as for the users. A user in no tenant sees no event.
+	Scoped bool
+	Tenant string
+}
+
+// list returns the events of the feed selected by the filter, oldest
+// first
+func (f *eventFeed) list(filter *EventFilter) []api.Event {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	events := []api.Event{}
+	for _, e := range f.events {
+		if e.Time < filter.Since {
+			continue
+		}
+		if filter.Scoped && (filter.Tenant == "" || e.Tenant != filter.Tenant) {
+			continue
+		}
+		events = append(events, e)
+	}
+	return events
+}
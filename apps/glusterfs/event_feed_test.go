@@ -0,0 +1,42 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"testing"
+
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/tests"
+)
+
+func TestEventFeed(t *testing.T) {
+	f := newEventFeed(3)
+	f.add(api.Event{Id: "e1", Time: 10, Tenant: "team-a"})
+	f.add(api.Event{Id: "e2", Time: 20})
+	f.add(api.Event{Id: "e3", Time: 30, Tenant: "team-b"})
+	f.add(api.Event{Id: "e4", Time: 40, Tenant: "team-a"})
+
+	// The oldest events are dropped
+	events := f.list(&EventFilter{})
+	tests.Assert(t, len(events) == 3, events)
+	tests.Assert(t, events[0].Id == "e2", events)
+	tests.Assert(t, events[2].Id == "e4", events)
+
+	events = f.list(&EventFilter{Since: 30})
+	tests.Assert(t, len(events) == 2, events)
+	tests.Assert(t, events[0].Id == "e3", events)
+
+	// Scoped filters only select the events of the tenant
+	events = f.list(&EventFilter{Scoped: true, Tenant: "team-a"})
+	tests.Assert(t, len(events) == 1, events)
+	tests.Assert(t, events[0].Id == "e4", events)
+	events = f.list(&EventFilter{Scoped: true})
+	tests.Assert(t, len(events) == 0, events)
+}
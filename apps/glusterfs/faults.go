@@ -0,0 +1,20 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+// Code points faults can be injected at, see pkg/faults
+const (
+	// Saving a brick entry to the db
+	FaultBrickSave = "brick-save"
+	// Replacing a brick of a volume with the executor
+	FaultVolumeReplaceBrick = "executor-volume-replace-brick"
+	// The allocator closing its generator of devices with an error
+	FaultAllocatorClose = "allocator-close"
+)
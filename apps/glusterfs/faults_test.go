@@ -0,0 +1,129 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/heketi/heketi/pkg/faults"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/tests"
+)
+
+func TestFaultBrickSaveVolumeCreate(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	faults.SetEnabled(true)
+	defer faults.SetEnabled(false)
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		3,    // nodes_per_cluster
+		2,    // devices_per_node,
+		1*TB, // disksize
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// Fail saving the second brick of the volume
+	err = faults.Inject(FaultBrickSave, faults.Fault{Skip: 1, Count: 1})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	vreq := &api.VolumeCreateRequest{}
+	vreq.Size = 100
+	vreq.Durability.Type = api.DurabilityReplicate
+	vreq.Durability.Replicate.Replica = 3
+	v := NewVolumeEntryFromRequest(vreq)
+	err = v.Create(app.db, app.executor, app.Allocator())
+	tests.Assert(t, err == faults.ErrInjected, "expected err == ErrInjected, got:", err)
+	tests.Assert(t, faults.Hits(FaultBrickSave) == 2, faults.Hits(FaultBrickSave))
+
+	app.db.View(func(tx *bolt.Tx) error {
+		vl, err := VolumeList(tx)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, len(vl) == 0, vl)
+		bl, err := BrickList(tx)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, len(bl) == 0, bl)
+		dl, err := DeviceList(tx)
+		tests.Assert(t, err == nil)
+		for _, id := range dl {
+			d, err := NewDeviceEntryFromId(tx, id)
+			tests.Assert(t, err == nil)
+			tests.Assert(t, d.Info.Storage.Used == 0, d.Info.Storage)
+		}
+		return nil
+	})
+
+	// The volume is created once the fault is spent
+	v = NewVolumeEntryFromRequest(vreq)
+	err = v.Create(app.db, app.executor, app.Allocator())
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+}
+
+func TestFaultReplaceDeviceBricks(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	faults.SetEnabled(true)
+	defer faults.SetEnabled(false)
+
+	deviceId, spareId := sampleDeviceWithBricks(t, app, 0)
+
+	checkUnchanged := func() {
+		app.db.View(func(tx *bolt.Tx) error {
+			d, err := NewDeviceEntryFromId(tx, deviceId)
+			tests.Assert(t, err == nil)
+			tests.Assert(t, len(d.Bricks) == 2, d.Bricks)
+
+			spare, err := NewDeviceEntryFromId(tx, spareId)
+			tests.Assert(t, err == nil)
+			tests.Assert(t, len(spare.Bricks) == 0, spare.Bricks)
+			tests.Assert(t, spare.Info.Storage.Used == 0, spare.Info.Storage)
+
+			bl, err := BrickList(tx)
+			tests.Assert(t, err == nil)
+			tests.Assert(t, len(bl) == 6, bl)
+			return nil
+		})
+	}
+
+	// The reservation of the new brick is released
+	err := faults.Inject(FaultVolumeReplaceBrick, faults.Fault{})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	err = ReplaceDeviceBricks(app.db, app.executor, app.Allocator(), deviceId)
+	tests.Assert(t, err != nil, "expected err != nil")
+	tests.Assert(t, strings.Contains(err.Error(), faults.ErrInjected.Error()), err)
+	tests.Assert(t, faults.Hits(FaultVolumeReplaceBrick) == 2,
+		faults.Hits(FaultVolumeReplaceBrick))
+	checkUnchanged()
+	faults.Remove(FaultVolumeReplaceBrick)
+
+	// No brick is reserved when the allocator fails
+	err = faults.Inject(FaultAllocatorClose, faults.Fault{})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	err = ReplaceDeviceBricks(app.db, app.executor, app.Allocator(), deviceId)
+	tests.Assert(t, err != nil, "expected err != nil")
+	tests.Assert(t, strings.Contains(err.Error(), faults.ErrInjected.Error()), err)
+	checkUnchanged()
+	faults.Remove(FaultAllocatorClose)
+
+	err = ReplaceDeviceBricks(app.db, app.executor, app.Allocator(), deviceId)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+}
@@ -0,0 +1,156 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"sync"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/heketi/heketi/executors"
+	wdb "github.com/heketi/heketi/pkg/db"
+)
+
+var (
+	// Seconds between the checks of glusterd on every online node.
+	// Zero disables the checks, the nodes being checked when an
+	// operation needs one.
+	NodeHealthCheckInterval = 0
+
+	// Nodes checked at the same time
+	NodeHealthCheckWorkers = 8
+
+	nodeHealth = &nodeHealthCache{checks: map[string]nodeHealthCheck{}}
+)
+
+type nodeHealthCheck struct {
+	healthy bool
+	time    time.Time
+}
+
+// nodeHealthCache keeps the results of the last checks of glusterd on
+// the management hosts of the nodes, so that operations use a node
+// found healthy by the periodic checks instead of checking the nodes
+// one after the other before they start.
+type nodeHealthCache struct {
+	lock   sync.Mutex
+	checks map[string]nodeHealthCheck
+}
+
+func (c *nodeHealthCache) enabled() bool {
+	return NodeHealthCheckInterval > 0
+}
+
+// healthy returns true if glusterd was found running on the host by a
+// check recent enough to be trusted, one missed periodic check being
+// tolerated
+func (c *nodeHealthCache) healthy(host string) bool {
+	if !c.enabled() {
+		return false
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	check, ok := c.checks[host]
+	maxAge := 2 * time.Duration(NodeHealthCheckInterval) * time.Second
+	return ok && check.healthy && time.Since(check.time) <= maxAge
+}
+
+// record keeps the result of a check of glusterd on the host
+func (c *nodeHealthCache) record(host string, err error) {
+	if !c.enabled() {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.checks[host] = nodeHealthCheck{
+		healthy: err == nil,
+		time:    time.Now(),
+	}
+}
+
+// reset forgets the results of the checks of the hosts not in the set
+func (c *nodeHealthCache) reset(keep map[string]bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for host := range c.checks {
+		if !keep[host] {
+			delete(c.checks, host)
+		}
+	}
+}
+
+// glusterdCheck checks that glusterd runs on the host, unless a recent
+// periodic check found it running
+func glusterdCheck(e executors.Executor, host string) error {
+	if nodeHealth.healthy(host) {
+		return nil
+	}
+	err := e.GlusterdCheck(host)
+	nodeHealth.record(host, err)
+	return err
+}
+
+// checkNodesHealth checks glusterd on the management hosts of every
+// online node and keeps the results in the health cache
+func checkNodesHealth(db wdb.RODB, e executors.Executor) {
+	hosts := map[string]bool{}
+	err := db.View(func(tx *bolt.Tx) error {
+		ids, err := NodeList(tx)
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			node, err := NewNodeEntryFromId(tx, id)
+			if err != nil {
+				return err
+			}
+			if node.isOnline() {
+				hosts[node.ManageHostName()] = true
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logger.LogError("Unable to list the nodes to check: %v", err)
+		return
+	}
+
+	var wg sync.WaitGroup
+	workers := make(chan struct{}, NodeHealthCheckWorkers)
+	for host := range hosts {
+		wg.Add(1)
+		workers <- struct{}{}
+		go func(host string) {
+			defer wg.Done()
+			defer func() { <-workers }()
+			err := e.GlusterdCheck(host)
+			if err != nil {
+				logger.Warning("Glusterd not running in %v: %v", host, err)
+			}
+			nodeHealth.record(host, err)
+		}(host)
+	}
+	wg.Wait()
+
+	// The nodes removed or taken offline are not used any more
+	nodeHealth.reset(hosts)
+}
+
+func (a *App) startNodeHealthChecker() {
+	if NodeHealthCheckInterval <= 0 {
+		return
+	}
+
+	// The cache is filled before the first period
+	go checkNodesHealth(a.db, a.executor)
+	a.runPeriodically(NodeHealthCheckInterval, func() {
+		checkNodesHealth(a.db, a.executor)
+	})
+}
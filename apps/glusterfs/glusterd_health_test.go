@@ -0,0 +1,105 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/heketi/tests"
+)
+
+func TestNodeHealthCache(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		3,    // nodes_per_cluster
+		1,    // devices_per_node,
+		2*TB, // disksize
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	var clusterId string
+	hosts := map[string]bool{}
+	app.db.View(func(tx *bolt.Tx) error {
+		clusters, err := ClusterList(tx)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		clusterId = clusters[0]
+		nodes, err := NodeList(tx)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		for _, id := range nodes {
+			node, err := NewNodeEntryFromId(tx, id)
+			tests.Assert(t, err == nil, "expected err == nil, got:", err)
+			hosts[node.ManageHostName()] = true
+		}
+		return nil
+	})
+
+	var lock sync.Mutex
+	checked := map[string]int{}
+	down := ""
+	app.xo.MockGlusterdCheck = func(host string) error {
+		lock.Lock()
+		defer lock.Unlock()
+		checked[host]++
+		if host == down {
+			return fmt.Errorf("glusterd down")
+		}
+		return nil
+	}
+
+	// Disabled, the nodes are checked by the operations
+	host, err := GetVerifiedManageHostname(app.db, app.executor, clusterId)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, checked[host] == 1, checked)
+	tests.Assert(t, !nodeHealth.healthy(host))
+
+	defer func(interval int) {
+		NodeHealthCheckInterval = interval
+		nodeHealth.reset(nil)
+	}(NodeHealthCheckInterval)
+	NodeHealthCheckInterval = 3600
+
+	// Every online node is checked once
+	down = host
+	checkNodesHealth(app.db, app.executor)
+	for h := range hosts {
+		tests.Assert(t, checked[h] >= 1, checked)
+	}
+	tests.Assert(t, !nodeHealth.healthy(down))
+
+	// A node found healthy is used without checking it again
+	checked = map[string]int{}
+	host, err = GetVerifiedManageHostname(app.db, app.executor, clusterId)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, host != down, host, down)
+	tests.Assert(t, len(checked) == 0, checked)
+
+	err = glusterdCheck(app.executor, host)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(checked) == 0, checked)
+
+	// A node found down is checked again
+	err = glusterdCheck(app.executor, down)
+	tests.Assert(t, err != nil, "expected err != nil")
+	tests.Assert(t, checked[down] == 1, checked)
+
+	// The nodes not checked any more are forgotten
+	nodeHealth.reset(map[string]bool{down: true})
+	tests.Assert(t, !nodeHealth.healthy(host))
+}
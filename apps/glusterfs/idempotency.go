@@ -0,0 +1,331 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/boltdb/bolt"
+	wdb "github.com/heketi/heketi/pkg/db"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/lpabon/godbc"
+)
+
+const (
+	BOLTDB_BUCKET_IDEMPOTENCY_KEY = "IDEMPOTENCY_KEY"
+
+	// Kinds of the objects created by idempotent requests
+	idempotentVolume      = "volume"
+	idempotentBlockVolume = "blockvolume"
+)
+
+var (
+	// Hours an idempotency key is remembered after the request
+	IdempotencyKeyHours = 24
+
+	// Time between two checks of a create still in progress by a
+	// request repeated with its idempotency key
+	IdempotencyPollInterval = time.Second
+
+	idempotencyKeyRe = regexp.MustCompile("^[\x21-\x7e]{1,255}$")
+
+	// Keys of the requests being handled, until their object is built
+	idempotencyInFlight = &inFlightKeys{keys: map[string]bool{}}
+)
+
+// IdempotencyKeyEntry records the object created by a request carrying
+// an idempotency key, so that the request repeated with the same key
+// returns the object instead of creating another one. The entries are
+// keyed by the idempotency key.
+type IdempotencyKeyEntry struct {
+	Key string
+	// Issuer of the token of the request, if any
+	User     string
+	Kind     string
+	ObjectId string
+	// SHA-256 digest of the body of the request
+	Digest string
+	// Seconds since the epoch
+	Created int64
+}
+
+func NewIdempotencyKeyEntryFromId(tx *bolt.Tx, key string) (*IdempotencyKeyEntry, error) {
+	godbc.Require(tx != nil)
+
+	entry := &IdempotencyKeyEntry{}
+	err := EntryLoad(tx, entry, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+func (e *IdempotencyKeyEntry) BucketName() string {
+	return BOLTDB_BUCKET_IDEMPOTENCY_KEY
+}
+
+func (e *IdempotencyKeyEntry) Save(tx *bolt.Tx) error {
+	godbc.Require(tx != nil)
+	godbc.Require(e.Key != "")
+
+	return EntrySave(tx, e, e.Key)
+}
+
+func (e *IdempotencyKeyEntry) Delete(tx *bolt.Tx) error {
+	return EntryDelete(tx, e, e.Key)
+}
+
+func (e *IdempotencyKeyEntry) Marshal() ([]byte, error) {
+	var buffer bytes.Buffer
+	enc := gob.NewEncoder(&buffer)
+	err := enc.Encode(*e)
+
+	return buffer.Bytes(), err
+}
+
+func (e *IdempotencyKeyEntry) Unmarshal(buffer []byte) error {
+	dec := gob.NewDecoder(bytes.NewReader(buffer))
+	err := dec.Decode(e)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (e *IdempotencyKeyEntry) expired() bool {
+	return time.Now().Unix()-e.Created > int64(IdempotencyKeyHours)*3600
+}
+
+func (e *IdempotencyKeyEntry) resourceUrl() string {
+	if e.Kind == idempotentBlockVolume {
+		return "/blockvolumes/" + e.ObjectId
+	}
+	return "/volumes/" + e.ObjectId
+}
+
+// created returns whether the object of the entry was created and
+// whether it is still being created. A missing object failed to be
+// created.
+func (e *IdempotencyKeyEntry) created(tx *bolt.Tx) (done, pending bool, err error) {
+	var visible bool
+	switch e.Kind {
+	case idempotentBlockVolume:
+		var bv *BlockVolumeEntry
+		bv, err = NewBlockVolumeEntryFromId(tx, e.ObjectId)
+		if err == nil {
+			visible = bv.Visible()
+		}
+	default:
+		var v *VolumeEntry
+		v, err = NewVolumeEntryFromId(tx, e.ObjectId)
+		if err == nil {
+			visible = v.Visible()
+		}
+	}
+	if err == ErrNotFound {
+		return false, false, nil
+	} else if err != nil {
+		return false, false, err
+	}
+	return visible, !visible, nil
+}
+
+// inFlightKeys are the idempotency keys of the requests whose objects
+// are not built yet. The same key sent again meanwhile is refused.
+type inFlightKeys struct {
+	lock sync.Mutex
+	keys map[string]bool
+}
+
+func (f *inFlightKeys) begin(key string) bool {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.keys[key] {
+		return false
+	}
+	f.keys[key] = true
+	return true
+}
+
+func (f *inFlightKeys) end(key string) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	delete(f.keys, key)
+}
+
+// idempotentCreate is a create request carrying an idempotency key
+type idempotentCreate struct {
+	entry *IdempotencyKeyEntry
+}
+
+// idempotentRequest handles the idempotency key of a create request of
+// an object of the kind. If the key was already used by the same
+// request the response sends the client to the object created by that
+// request, waiting for the object to be created, and false is returned.
+// False is also returned once an error has been sent to the client.
+// Otherwise the request must create its object, record it and call done.
+// The returned create is nil for requests without a key.
+func (a *App) idempotentRequest(w http.ResponseWriter, r *http.Request,
+	kind string) (*idempotentCreate, bool) {
+
+	key := r.Header.Get(api.IdempotencyKeyHeader)
+	if key == "" {
+		return nil, true
+	}
+	if !idempotencyKeyRe.MatchString(key) {
+		http.Error(w, "Invalid idempotency key", http.StatusBadRequest)
+		return nil, false
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "request unable to be parsed", 422)
+		return nil, false
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	digest := sha256.Sum256(body)
+
+	c := &idempotentCreate{entry: &IdempotencyKeyEntry{
+		Key:    key,
+		User:   requestIssuer(r),
+		Kind:   kind,
+		Digest: hex.EncodeToString(digest[:]),
+	}}
+	if !idempotencyInFlight.begin(key) {
+		http.Error(w, fmt.Sprintf("A request with idempotency key %v is in progress", key),
+			http.StatusConflict)
+		return nil, false
+	}
+
+	var prev *IdempotencyKeyEntry
+	var done, pending bool
+	err = a.db.View(func(tx *bolt.Tx) error {
+		var err error
+		prev, err = NewIdempotencyKeyEntryFromId(tx, key)
+		if err == ErrNotFound {
+			prev = nil
+			return nil
+		} else if err != nil {
+			return err
+		}
+		done, pending, err = prev.created(tx)
+		return err
+	})
+	switch {
+	case err != nil:
+		c.done()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	case prev == nil || prev.expired() || (!done && !pending):
+		// The key is new, forgotten or its create failed
+		return c, true
+	case prev.User != c.entry.User || prev.Kind != kind || prev.Digest != c.entry.Digest:
+		c.done()
+		http.Error(w, fmt.Sprintf("Idempotency key %v was used by another request", key),
+			http.StatusConflict)
+		return nil, false
+	}
+	c.done()
+
+	logger.Info("Request with idempotency key %v already created %v %v",
+		key, kind, prev.ObjectId)
+	a.asyncHttpRedirectFunc(w, r, func() (string, error) {
+		return waitIdempotentCreate(a.db, prev)
+	})
+	return nil, false
+}
+
+// record remembers the object created by the request
+func (c *idempotentCreate) record(db wdb.DB, objectId string) {
+	if c == nil {
+		return
+	}
+	c.entry.ObjectId = objectId
+	c.entry.Created = time.Now().Unix()
+	err := db.Update(func(tx *bolt.Tx) error {
+		if err := c.entry.Save(tx); err != nil {
+			return err
+		}
+		return removeExpiredIdempotencyKeys(tx)
+	})
+	if err != nil {
+		logger.LogError("Unable to record idempotency key %v: %v",
+			c.entry.Key, err)
+	}
+}
+
+// done lets the key be used by other requests
+func (c *idempotentCreate) done() {
+	if c == nil {
+		return
+	}
+	idempotencyInFlight.end(c.entry.Key)
+}
+
+// waitIdempotentCreate waits for the object of the entry to be created
+// and returns its url
+func waitIdempotentCreate(db wdb.RODB, e *IdempotencyKeyEntry) (string, error) {
+	for {
+		var done, pending bool
+		err := db.View(func(tx *bolt.Tx) error {
+			var err error
+			done, pending, err = e.created(tx)
+			return err
+		})
+		switch {
+		case err != nil:
+			return "", err
+		case done:
+			return e.resourceUrl(), nil
+		case !pending:
+			return "", fmt.Errorf("Create of %v %v with idempotency key %v failed",
+				e.Kind, e.ObjectId, e.Key)
+		}
+		time.Sleep(IdempotencyPollInterval)
+	}
+}
+
+func removeExpiredIdempotencyKeys(tx *bolt.Tx) error {
+	b := tx.Bucket([]byte(BOLTDB_BUCKET_IDEMPOTENCY_KEY))
+	if b == nil {
+		return ErrDbAccess
+	}
+	expired := [][]byte{}
+	err := b.ForEach(func(k, v []byte) error {
+		e := &IdempotencyKeyEntry{}
+		if err := e.Unmarshal(v); err != nil {
+			return err
+		}
+		if e.expired() {
+			expired = append(expired, k)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, k := range expired {
+		if err := b.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/gorilla/mux"
+	client "github.com/heketi/heketi/client/api/go-client"
+	"github.com/heketi/heketi/executors"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/tests"
+)
+
+func TestVolumeCreateIdempotencyKey(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	c := client.NewClientNoAuth(ts.URL)
+	tests.Assert(t, c != nil)
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		3,    // nodes_per_cluster
+		2,    // devices_per_node,
+		2*TB, // disksize
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	volumes := func() int {
+		var ids []string
+		app.db.View(func(tx *bolt.Tx) error {
+			var err error
+			ids, err = VolumeList(tx)
+			tests.Assert(t, err == nil)
+			return nil
+		})
+		return len(ids)
+	}
+
+	req := &api.VolumeCreateRequest{}
+	req.Size = 10
+	req.Durability.Type = api.DurabilityReplicate
+	req.Durability.Replicate.Replica = 3
+
+	// The request repeated with the key returns the same volume
+	vol, err := c.VolumeCreateWithKey(req, "create-1")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	again, err := c.VolumeCreateWithKey(req, "create-1")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, again.Id == vol.Id, again.Id, vol.Id)
+	tests.Assert(t, volumes() == 1, volumes())
+
+	// Another request can not reuse the key
+	other := *req
+	other.Size = 20
+	_, err = c.VolumeCreateWithKey(&other, "create-1")
+	tests.Assert(t, err != nil)
+	tests.Assert(t, volumes() == 1, volumes())
+
+	// Nor can a block volume create
+	breq := &api.BlockVolumeCreateRequest{}
+	breq.Size = 1
+	_, err = c.BlockVolumeCreateWithKey(breq, "create-1")
+	tests.Assert(t, err != nil)
+
+	// Requests without a key are not affected
+	_, err = c.VolumeCreate(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, volumes() == 2, volumes())
+
+	// The key of a failed create can be used again
+	mockCreate := app.xo.MockVolumeCreate
+	app.xo.MockVolumeCreate = func(host string,
+		volume *executors.VolumeRequest) (*executors.Volume, error) {
+		return nil, fmt.Errorf("Mock failure")
+	}
+	_, err = c.VolumeCreateWithKey(req, "create-2")
+	tests.Assert(t, err != nil)
+	tests.Assert(t, volumes() == 2, volumes())
+	app.xo.MockVolumeCreate = mockCreate
+	vol, err = c.VolumeCreateWithKey(req, "create-2")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, volumes() == 3, volumes())
+
+	// So can the key of a deleted volume
+	err = c.VolumeDelete(vol.Id)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	again, err = c.VolumeCreateWithKey(req, "create-2")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, again.Id != vol.Id)
+
+	// The expired keys are removed by the next create with a key
+	app.db.Update(func(tx *bolt.Tx) error {
+		e, err := NewIdempotencyKeyEntryFromId(tx, "create-1")
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		e.Created -= int64(IdempotencyKeyHours)*3600 + 1
+		return e.Save(tx)
+	})
+	_, err = c.VolumeCreateWithKey(req, "create-3")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	app.db.View(func(tx *bolt.Tx) error {
+		_, err := NewIdempotencyKeyEntryFromId(tx, "create-1")
+		tests.Assert(t, err == ErrNotFound, err)
+		return nil
+	})
+
+	for _, key := range []string{"a b", strings.Repeat("k", 256)} {
+		r, err := http.NewRequest("POST", ts.URL+"/volumes",
+			bytes.NewBufferString(`{"size": 10}`))
+		tests.Assert(t, err == nil)
+		r.Header.Set(api.IdempotencyKeyHeader, key)
+		resp, err := http.DefaultClient.Do(r)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, resp.StatusCode == http.StatusBadRequest, resp.StatusCode)
+	}
+}
+
+func TestBlockVolumeCreateIdempotencyKey(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	c := client.NewClientNoAuth(ts.URL)
+	tests.Assert(t, c != nil)
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		3,    // nodes_per_cluster
+		1,    // devices_per_node,
+		5*TB, // disksize
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	req := &api.BlockVolumeCreateRequest{}
+	req.Size = 1
+	bv, err := c.BlockVolumeCreateWithKey(req, "block-1")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	again, err := c.BlockVolumeCreateWithKey(req, "block-1")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, again.Id == bv.Id, again.Id, bv.Id)
+
+	list, err := c.BlockVolumeList()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(list.BlockVolumes) == 1, list.BlockVolumes)
+
+	// A volume create can not reuse the key
+	vreq := &api.VolumeCreateRequest{}
+	vreq.Size = 10
+	_, err = c.VolumeCreateWithKey(vreq, "block-1")
+	tests.Assert(t, err != nil)
+}
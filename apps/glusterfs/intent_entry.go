@@ -0,0 +1,251 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+
+	"github.com/boltdb/bolt"
+	"github.com/heketi/heketi/executors"
+	wdb "github.com/heketi/heketi/pkg/db"
+	"github.com/heketi/heketi/pkg/utils"
+	"github.com/lpabon/godbc"
+)
+
+const (
+	BOLTDB_BUCKET_INTENT = "INTENT"
+)
+
+type IntentAction int
+
+const (
+	IntentBrickDestroy IntentAction = iota + 1
+	IntentVolumeDestroy
+	IntentBrickReplace
+)
+
+func (a IntentAction) String() string {
+	switch a {
+	case IntentBrickDestroy:
+		return "brick destroy"
+	case IntentVolumeDestroy:
+		return "volume destroy"
+	case IntentBrickReplace:
+		return "brick replace"
+	default:
+		return fmt.Sprintf("unknown intent action (%d)", int(a))
+	}
+}
+
+// IntentEntry records a destructive executor call before it is made,
+// with enough context to finish or verify the call if heketi terminates
+// before the call returns. The entry is removed once the call returns,
+// whether it succeeded or not.
+type IntentEntry struct {
+	Id        string
+	Action    IntentAction
+	Timestamp int64
+
+	// Manage host name of the node the call is made on
+	Host string
+
+	// Brick of a brick destroy
+	Brick executors.BrickRequest
+
+	// Gluster volume of a volume destroy or brick replace
+	VolumeName string
+
+	// Bricks of a brick replace
+	OldBrick executors.BrickInfo
+	NewBrick executors.BrickInfo
+}
+
+// IntentList returns the ids of all the intent entries in the db
+func IntentList(tx *bolt.Tx) ([]string, error) {
+	list := EntryKeys(tx, BOLTDB_BUCKET_INTENT)
+	if list == nil {
+		return nil, ErrAccessList
+	}
+	return list, nil
+}
+
+func NewIntentEntry(action IntentAction, host string) *IntentEntry {
+	return &IntentEntry{
+		Id:        utils.GenUUID(),
+		Action:    action,
+		Timestamp: operationTimestamp(),
+		Host:      host,
+	}
+}
+
+func NewIntentEntryFromId(tx *bolt.Tx, id string) (*IntentEntry, error) {
+	godbc.Require(tx != nil)
+
+	entry := &IntentEntry{}
+	err := EntryLoad(tx, entry, id)
+	if err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+func (i *IntentEntry) BucketName() string {
+	return BOLTDB_BUCKET_INTENT
+}
+
+func (i *IntentEntry) Save(tx *bolt.Tx) error {
+	godbc.Require(tx != nil)
+	godbc.Require(i.Id != "")
+
+	return EntrySave(tx, i, i.Id)
+}
+
+func (i *IntentEntry) Delete(tx *bolt.Tx) error {
+	return EntryDelete(tx, i, i.Id)
+}
+
+func (i *IntentEntry) Marshal() ([]byte, error) {
+	var buffer bytes.Buffer
+	enc := gob.NewEncoder(&buffer)
+	err := enc.Encode(*i)
+
+	return buffer.Bytes(), err
+}
+
+func (i *IntentEntry) Unmarshal(buffer []byte) error {
+	dec := gob.NewDecoder(bytes.NewReader(buffer))
+	err := dec.Decode(i)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// withIntent saves the intent, makes the executor call and removes the
+// intent once the call returned
+func withIntent(db wdb.DB, intent *IntentEntry, call func() error) error {
+	err := db.Update(func(tx *bolt.Tx) error {
+		return intent.Save(tx)
+	})
+	if err != nil {
+		return logger.LogError("Unable to record %v intent: %v",
+			intent.Action, err)
+	}
+
+	callErr := call()
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		return intent.Delete(tx)
+	})
+	if err != nil {
+		// the intent will be resolved again on the next start
+		logger.LogError("Unable to remove %v intent %v: %v",
+			intent.Action, intent.Id, err)
+	}
+	return callErr
+}
+
+// brickInVolume returns true if the brick is one of the bricks of the
+// gluster volume
+func brickInVolume(vol *executors.Volume, brick executors.BrickInfo) bool {
+	name := brick.Host + ":" + brick.Path
+	for _, b := range vol.Bricks.BrickList {
+		if b.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// resolve finishes or verifies the executor call of the intent
+func (i *IntentEntry) resolve(executor executors.Executor) error {
+	switch i.Action {
+	case IntentBrickDestroy:
+		// Destroying a brick tolerates the steps already done
+		return executor.BrickDestroy(i.Host, &i.Brick)
+
+	case IntentVolumeDestroy:
+		if err := executor.GlusterdCheck(i.Host); err != nil {
+			return err
+		}
+		if _, err := executor.VolumeInfo(i.Host, i.VolumeName); err != nil {
+			// The volume is gone
+			return nil
+		}
+		return executor.VolumeDestroy(i.Host, i.VolumeName)
+
+	case IntentBrickReplace:
+		if err := executor.GlusterdCheck(i.Host); err != nil {
+			return err
+		}
+		vol, err := executor.VolumeInfo(i.Host, i.VolumeName)
+		if err != nil {
+			return err
+		}
+		if brickInVolume(vol, i.NewBrick) {
+			return nil
+		}
+		if !brickInVolume(vol, i.OldBrick) {
+			return fmt.Errorf("Neither brick %v:%v nor brick %v:%v is in volume %v",
+				i.OldBrick.Host, i.OldBrick.Path,
+				i.NewBrick.Host, i.NewBrick.Path, i.VolumeName)
+		}
+		return executor.VolumeReplaceBrick(i.Host, i.VolumeName,
+			&i.OldBrick, &i.NewBrick)
+	}
+	return fmt.Errorf("Unable to resolve %v", i.Action)
+}
+
+// ResolveIntents finishes or verifies the executor calls of the intents
+// left in the db by an unclean termination of heketi. The intents that
+// were resolved are removed. It returns the number of intents that
+// remain.
+func ResolveIntents(db wdb.DB, executor executors.Executor) (int, error) {
+	var intents []*IntentEntry
+	err := db.View(func(tx *bolt.Tx) error {
+		ids, err := IntentList(tx)
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			intent, err := NewIntentEntryFromId(tx, id)
+			if err != nil {
+				return err
+			}
+			intents = append(intents, intent)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	remaining := 0
+	for _, intent := range intents {
+		logger.Info("Resolving %v intent %v on %v",
+			intent.Action, intent.Id, intent.Host)
+		if err := intent.resolve(executor); err != nil {
+			logger.LogError("Unable to resolve %v intent %v: %v",
+				intent.Action, intent.Id, err)
+			remaining++
+			continue
+		}
+		err := db.Update(func(tx *bolt.Tx) error {
+			return intent.Delete(tx)
+		})
+		if err != nil {
+			return remaining, err
+		}
+	}
+	return remaining, nil
+}
@@ -0,0 +1,171 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/heketi/heketi/executors"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/tests"
+)
+
+func intentCount(t *testing.T, app *App) int {
+	var count int
+	app.db.View(func(tx *bolt.Tx) error {
+		l, err := IntentList(tx)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		count = len(l)
+		return nil
+	})
+	return count
+}
+
+func TestIntentRecordedDuringCall(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		3,    // nodes_per_cluster
+		1,    // devices_per_node,
+		1*TB, // disksize
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	req := &api.VolumeCreateRequest{}
+	req.Size = 10
+	req.Durability.Type = api.DurabilityReplicate
+	req.Durability.Replicate.Replica = 3
+	v := NewVolumeEntryFromRequest(req)
+	err = v.Create(app.db, app.executor, app.Allocator())
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	volumeIntents := 0
+	app.xo.MockVolumeDestroy = func(host string, volume string) error {
+		volumeIntents = intentCount(t, app)
+		return nil
+	}
+	brickIntents := 0
+	app.xo.MockBrickDestroy = func(host string, brick *executors.BrickRequest) error {
+		if n := intentCount(t, app); n > brickIntents {
+			brickIntents = n
+		}
+		return nil
+	}
+
+	err = v.Destroy(app.db, app.executor)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, volumeIntents == 1, volumeIntents)
+	tests.Assert(t, brickIntents >= 1, brickIntents)
+	tests.Assert(t, intentCount(t, app) == 0)
+}
+
+func TestIntentRemovedAfterFailedCall(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	intent := NewIntentEntry(IntentVolumeDestroy, "host1")
+	intent.VolumeName = "vol_1"
+	err := withIntent(app.db, intent, func() error {
+		return errors.New("failed")
+	})
+	tests.Assert(t, err != nil && err.Error() == "failed", err)
+	tests.Assert(t, intentCount(t, app) == 0)
+}
+
+func TestResolveIntents(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	oldBrick := executors.BrickInfo{Host: "storage1", Path: "/old"}
+	newBrick := executors.BrickInfo{Host: "storage2", Path: "/new"}
+
+	destroy := NewIntentEntry(IntentBrickDestroy, "host1")
+	destroy.Brick = executors.BrickRequest{Name: "b1", VgId: "d1"}
+	gone := NewIntentEntry(IntentVolumeDestroy, "host1")
+	gone.VolumeName = "vol_gone"
+	replace := NewIntentEntry(IntentBrickReplace, "host1")
+	replace.VolumeName = "vol_old"
+	replace.OldBrick = oldBrick
+	replace.NewBrick = newBrick
+	done := NewIntentEntry(IntentBrickReplace, "host1")
+	done.VolumeName = "vol_new"
+	done.OldBrick = oldBrick
+	done.NewBrick = newBrick
+	lost := NewIntentEntry(IntentBrickReplace, "host1")
+	lost.VolumeName = "vol_lost"
+	lost.OldBrick = oldBrick
+	lost.NewBrick = newBrick
+
+	err := app.db.Update(func(tx *bolt.Tx) error {
+		for _, i := range []*IntentEntry{destroy, gone, replace, done, lost} {
+			if err := i.Save(tx); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	destroyed := []string{}
+	app.xo.MockBrickDestroy = func(host string, brick *executors.BrickRequest) error {
+		destroyed = append(destroyed, brick.Name)
+		return nil
+	}
+	app.xo.MockVolumeDestroy = func(host string, volume string) error {
+		t.Errorf("unexpected destroy of volume %v", volume)
+		return nil
+	}
+	app.xo.MockVolumeInfo = func(host string, volume string) (*executors.Volume, error) {
+		vol := &executors.Volume{VolumeName: volume}
+		switch volume {
+		case "vol_gone":
+			return nil, errors.New("volume does not exist")
+		case "vol_old":
+			vol.Bricks.BrickList = []executors.Brick{{Name: "storage1:/old"}}
+		case "vol_new":
+			vol.Bricks.BrickList = []executors.Brick{{Name: "storage2:/new"}}
+		}
+		return vol, nil
+	}
+	replaced := []string{}
+	app.xo.MockVolumeReplaceBrick = func(host string, volume string,
+		oldBrick *executors.BrickInfo, newBrick *executors.BrickInfo) error {
+		replaced = append(replaced, volume)
+		return nil
+	}
+
+	remaining, err := ResolveIntents(app.db, app.executor)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, remaining == 1, remaining)
+	tests.Assert(t, len(destroyed) == 1 && destroyed[0] == "b1", destroyed)
+	tests.Assert(t, len(replaced) == 1 && replaced[0] == "vol_old", replaced)
+
+	// Only the intent whose bricks are missing from the volume is left
+	app.db.View(func(tx *bolt.Tx) error {
+		l, err := IntentList(tx)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, len(l) == 1 && l[0] == lost.Id, l)
+		return nil
+	})
+}
@@ -9,9 +9,130 @@
 
 package glusterfs
 
+import (
+	"net/http"
+
+	"github.com/go-ozzo/ozzo-validation"
+
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+)
+
 var (
 	// Default limits
 	BrickMinSize = uint64(1 * GB)
 	BrickMaxSize = uint64(4 * TB)
 	BrickMaxNum  = 32
+
+	// Minimum brick size of the volumes of a durability type, in KB.
+	// BrickMinSize is used for the types not set.
+	BrickMinSizeByDurability = map[api.DurabilityType]uint64{}
+
+	// Default request limits
+	RequestMaxSize  = int64(1024 * 1024) // bytes
+	NameMaxLength   = 255
+	VolumeMaxSize   = 1024 * 1024 // GiB
+	ClustersMaxNum  = 32
+	HostnamesMaxNum = 8
+
+	// Largest dump of a db accepted by the db import
+	DbImportMaxSize = int64(256 * 1024 * 1024) // bytes
 )
+
+// brickMinSize returns the minimum size of the bricks of the volumes of
+// the durability type, in KB
+func brickMinSize(t api.DurabilityType) uint64 {
+	if t == "" {
+		t = api.DurabilityDistributeOnly
+	}
+	if size, ok := BrickMinSizeByDurability[t]; ok {
+		return size
+	}
+	return BrickMinSize
+}
+
+// brickLimits are the limits of the bricks of a volume, in KB, used
+// instead of the limits of the server where set
+type brickLimits struct {
+	minSize uint64
+	maxSize uint64
+	// Maximum number of sets, unlimited if zero
+	maxSets int
+}
+
+func newBrickLimits(l *api.VolumeBrickLimits) brickLimits {
+	return brickLimits{
+		minSize: uint64(l.MinSize) * GB,
+		maxSize: uint64(l.MaxSize) * GB,
+		maxSets: l.MaxDistribute,
+	}
+}
+
+// limitRequestSize rejects request bodies larger than the limit, in
+// bytes, such as RequestMaxSize
+func limitRequestSize(next http.Handler, limit *int64) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > *limit {
+			http.Error(w, "request body is too large",
+				http.StatusRequestEntityTooLarge)
+			return
+		}
+		if r.Body != nil {
+			r.Body = http.MaxBytesReader(w, r.Body, *limit)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func validateVolumeCreateLimits(msg *api.VolumeCreateRequest) error {
+	return validation.ValidateStruct(msg,
+		validation.Field(&msg.Size, validation.Max(VolumeMaxSize)),
+		validation.Field(&msg.SizeMiB, validation.Max(VolumeMaxSize*1024)),
+		validation.Field(&msg.Clusters, validation.Length(0, ClustersMaxNum)),
+		validation.Field(&msg.Name, validation.RuneLength(0, NameMaxLength)),
+	)
+}
+
+func validateVolumeExpandLimits(msg *api.VolumeExpandRequest) error {
+	return validation.ValidateStruct(msg,
+		validation.Field(&msg.Size, validation.Max(VolumeMaxSize)),
+	)
+}
+
+func validateBlockVolumeCreateLimits(msg *api.BlockVolumeCreateRequest) error {
+	return validation.ValidateStruct(msg,
+		validation.Field(&msg.Size, validation.Max(VolumeMaxSize)),
+		validation.Field(&msg.SizeMiB, validation.Max(VolumeMaxSize*1024)),
+		validation.Field(&msg.Clusters, validation.Length(0, ClustersMaxNum)),
+		validation.Field(&msg.Name, validation.RuneLength(0, NameMaxLength)),
+	)
+}
+
+func validateBlockVolumeExpandLimits(msg *api.BlockVolumeExpandRequest) error {
+	return validation.ValidateStruct(msg,
+		validation.Field(&msg.NewSize, validation.Max(VolumeMaxSize)),
+	)
+}
+
+func validateBlockVolumeCloneLimits(msg *api.BlockVolumeCloneRequest) error {
+	return validation.ValidateStruct(msg,
+		validation.Field(&msg.Name, validation.RuneLength(0, NameMaxLength)),
+	)
+}
+
+func validateNodeAddLimits(msg *api.NodeAddRequest) error {
+	h := &msg.Hostnames
+	return validation.ValidateStruct(msg,
+		validation.Field(&msg.Hostnames, validation.By(func(interface{}) error {
+			return validation.ValidateStruct(h,
+				validation.Field(&h.Manage, validation.Length(0, HostnamesMaxNum)),
+				validation.Field(&h.Storage, validation.Length(0, HostnamesMaxNum)),
+			)
+		})),
+	)
+}
+
+func validateDeviceAddLimits(msg *api.DeviceAddRequest) error {
+	return validation.ValidateStruct(msg,
+		validation.Field(&msg.Name, validation.RuneLength(0, NameMaxLength)),
+	)
+}
@@ -10,6 +10,11 @@
 package glusterfs
 
 import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
 	"github.com/boltdb/bolt"
 
 	"github.com/heketi/heketi/pkg/glusterfs/api"
@@ -84,7 +89,9 @@ func MapPendingVolumes(tx *bolt.Tx) (map[string]string, error) {
 // an error if the db cannot be read.
 func MapPendingBlockVolumes(tx *bolt.Tx) (map[string]string, error) {
 	return mapPendingItems(tx, func(op *PendingOperationEntry, a PendingOperationAction) bool {
-		return (op.Type == OperationCreateBlockVolume && a.Change == OpAddBlockVolume)
+		return ((op.Type == OperationCreateBlockVolume ||
+			op.Type == OperationCloneBlockVolume) &&
+			a.Change == OpAddBlockVolume)
 	})
 }
 
@@ -131,3 +138,291 @@ func removeKeysFromList(l []string, m map[string]string) []string {
 	}
 	return out
 }
+
+// listOptions returns the options in the query of a list request.
+// Besides the limit and the offset, only the given filters are accepted.
+func listOptions(r *http.Request, filters ...string) (*api.ListOptions, error) {
+	query := r.URL.Query()
+	opts := &api.ListOptions{}
+
+	for _, param := range []struct {
+		name  string
+		value *int
+	}{
+		{"limit", &opts.Limit},
+		{"offset", &opts.Offset},
+	} {
+		v := query.Get(param.name)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid %v: %v", param.name, v)
+		}
+		*param.value = n
+	}
+
+	accepted := map[string]bool{}
+	for _, f := range filters {
+		accepted[f] = true
+	}
+	for _, f := range []string{"cluster", "name", "durability", "block",
+		"volume", "node", "device", "expand"} {
+
+		v := query.Get(f)
+		if v == "" {
+			continue
+		}
+		if !accepted[f] {
+			return nil, fmt.Errorf("filter %v is not supported by this list", f)
+		}
+		switch f {
+		case "cluster":
+			opts.Cluster = v
+		case "name":
+			opts.NamePrefix = v
+		case "durability":
+			opts.Durability = api.DurabilityType(v)
+		case "block":
+			block, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid block: %v", v)
+			}
+			opts.Block = &block
+		case "expand":
+			expand, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid expand: %v", v)
+			}
+			opts.Expand = expand
+		case "volume":
+			opts.Volume = v
+		case "node":
+			opts.Node = v
+		case "device":
+			opts.Device = v
+		}
+	}
+
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	return opts, nil
+}
+
+// pageBounds returns the bounds of the page selected by the options
+// in a list of n entries
+func pageBounds(n int, opts *api.ListOptions) (start, end int) {
+	if opts.Offset >= n {
+		return n, n
+	}
+	end = n
+	if opts.Limit > 0 && opts.Offset+opts.Limit < n {
+		end = opts.Offset + opts.Limit
+	}
+	return opts.Offset, end
+}
+
+// page returns the ids of the page selected by the options
+func page(ids []string, opts *api.ListOptions) []string {
+	start, end := pageBounds(len(ids), opts)
+	return ids[start:end]
+}
+
+// keepIds returns the ids of the list that are in keep, in the order
+// of the list
+func keepIds(ids []string, keep []string) []string {
+	set := map[string]bool{}
+	for _, id := range keep {
+		set[id] = true
+	}
+	out := []string{}
+	for _, id := range ids {
+		if set[id] {
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+// clusterIds returns the ids of the list that belong to the cluster,
+// the ids of the cluster given by list
+func clusterIds(tx *bolt.Tx, ids []string, clusterId string,
+	list func(c *ClusterEntry) []string) ([]string, error) {
+
+	c, err := NewClusterEntryFromId(tx, clusterId)
+	if err == ErrNotFound {
+		return []string{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return keepIds(ids, list(c)), nil
+}
+
+// ListVolumes returns the page of the ids of the complete volumes
+// matching the options, and the number of volumes matching them.
+func ListVolumes(tx *bolt.Tx, opts *api.ListOptions) ([]string, int, error) {
+	ids, err := listVolumeIds(tx, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	return page(ids, opts), len(ids), nil
+}
+
+// ListVolumeInfos returns the information of the page of the complete
+// volumes matching the options, and the number of volumes matching them.
+func ListVolumeInfos(tx *bolt.Tx, opts *api.ListOptions) (
+	[]api.VolumeInfoResponse, int, error) {
+
+	ids, err := listVolumeIds(tx, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	infos := []api.VolumeInfoResponse{}
+	for _, id := range page(ids, opts) {
+		v, err := NewVolumeEntryFromId(tx, id)
+		if err != nil {
+			return nil, 0, err
+		}
+		info, err := v.NewInfoResponse(tx)
+		if err != nil {
+			return nil, 0, err
+		}
+		infos = append(infos, *info)
+	}
+	return infos, len(ids), nil
+}
+
+// listVolumeIds returns the ids of the complete volumes matching the
+// options. The names are matched with the index of the volume names
+// and the cluster with the volumes of the cluster, the volumes being
+// read only for the filters on their durability or block flag.
+func listVolumeIds(tx *bolt.Tx, opts *api.ListOptions) ([]string, error) {
+	ids, err := ListCompleteVolumes(tx)
+	if err != nil {
+		return nil, err
+	}
+	if opts.NamePrefix != "" {
+		named, err := SearchVolumes(tx, opts.NamePrefix, true)
+		if err != nil {
+			return nil, err
+		}
+		ids = keepIds(ids, named)
+	}
+	if opts.Cluster != "" {
+		ids, err = clusterIds(tx, ids, opts.Cluster, func(c *ClusterEntry) []string {
+			return c.Info.Volumes
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if opts.Durability == "" && opts.Block == nil {
+		return ids, nil
+	}
+
+	matching := []string{}
+	for _, id := range ids {
+		v, err := NewVolumeEntryFromId(tx, id)
+		if err != nil {
+			return nil, err
+		}
+		if (opts.Durability != "" && v.Info.Durability.Type != opts.Durability) ||
+			(opts.Block != nil && v.Info.Block != *opts.Block) {
+			continue
+		}
+		matching = append(matching, id)
+	}
+	return matching, nil
+}
+
+// ListBlockVolumes returns the page of the ids of the complete block
+// volumes matching the options, and the number of block volumes
+// matching them. The cluster and the block hosting volume are matched
+// with their lists of block volumes, the block volumes being read only
+// to match their names.
+func ListBlockVolumes(tx *bolt.Tx, opts *api.ListOptions) ([]string, int, error) {
+	ids, err := ListCompleteBlockVolumes(tx)
+	if err != nil {
+		return nil, 0, err
+	}
+	if opts.Cluster != "" {
+		ids, err = clusterIds(tx, ids, opts.Cluster, func(c *ClusterEntry) []string {
+			return c.Info.BlockVolumes
+		})
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+	if opts.Volume != "" {
+		v, err := NewVolumeEntryFromId(tx, opts.Volume)
+		if err == ErrNotFound {
+			ids = []string{}
+		} else if err != nil {
+			return nil, 0, err
+		} else {
+			ids = keepIds(ids, v.Info.BlockInfo.BlockVolumes)
+		}
+	}
+	if opts.NamePrefix == "" {
+		return page(ids, opts), len(ids), nil
+	}
+
+	matching := []string{}
+	for _, id := range ids {
+		bv, err := NewBlockVolumeEntryFromId(tx, id)
+		if err != nil {
+			return nil, 0, err
+		}
+		if strings.HasPrefix(bv.Info.Name, opts.NamePrefix) {
+			matching = append(matching, id)
+		}
+	}
+	return page(matching, opts), len(matching), nil
+}
+
+// ListBricks returns the page of the ids of the complete bricks
+// matching the options, and the number of bricks matching them.
+func ListBricks(tx *bolt.Tx, opts *api.ListOptions) ([]string, int, error) {
+	p, err := MapPendingBricks(tx)
+	if err != nil {
+		return nil, 0, err
+	}
+	ids, err := BrickList(tx)
+	if err != nil {
+		return nil, 0, err
+	}
+	ids = removeKeysFromList(ids, p)
+
+	// Cluster of each node of the bricks
+	clusters := map[string]string{}
+	matching := []string{}
+	for _, id := range ids {
+		b, err := NewBrickEntryFromId(tx, id)
+		if err != nil {
+			return nil, 0, err
+		}
+		if (opts.Volume != "" && b.Info.VolumeId != opts.Volume) ||
+			(opts.Node != "" && b.Info.NodeId != opts.Node) ||
+			(opts.Device != "" && b.Info.DeviceId != opts.Device) {
+			continue
+		}
+		if opts.Cluster != "" {
+			cluster, ok := clusters[b.Info.NodeId]
+			if !ok {
+				node, err := NewNodeEntryFromId(tx, b.Info.NodeId)
+				if err != nil {
+					return nil, 0, err
+				}
+				cluster = node.Info.ClusterId
+				clusters[b.Info.NodeId] = cluster
+			}
+			if cluster != opts.Cluster {
+				continue
+			}
+		}
+		matching = append(matching, id)
+	}
+	return page(matching, opts), len(matching), nil
+}
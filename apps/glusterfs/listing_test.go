@@ -10,12 +10,18 @@
 package glusterfs
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"reflect"
+	"strings"
 	"testing"
 
+	client "github.com/heketi/heketi/client/api/go-client"
 	"github.com/heketi/heketi/pkg/glusterfs/api"
 
 	"github.com/boltdb/bolt"
+	"github.com/gorilla/mux"
 	"github.com/heketi/tests"
 )
 
@@ -328,3 +334,172 @@ func TestUpdateClusterInfoCompleteFakedPending(t *testing.T) {
 		return nil
 	})
 }
+
+func TestListOptions(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	c := client.NewClientNoAuth(ts.URL)
+	tests.Assert(t, c != nil)
+
+	err := setupSampleDbWithTopology(app,
+		2,    // clusters
+		3,    // nodes_per_cluster
+		2,    // devices_per_node,
+		2*TB, // disksize
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	clusters, err := c.ClusterList()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	cluster := clusters.Clusters[0]
+
+	for _, name := range []string{"app_a", "app_b", "app_c"} {
+		req := &api.VolumeCreateRequest{}
+		req.Size = 10
+		req.Name = name
+		req.Clusters = []string{cluster}
+		req.Durability.Type = api.DurabilityReplicate
+		req.Durability.Replicate.Replica = 3
+		_, err := c.VolumeCreate(req)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	}
+	req := &api.VolumeCreateRequest{}
+	req.Size = 10
+	req.Name = "db"
+	req.Clusters = []string{clusters.Clusters[1]}
+	req.Durability.Type = api.DurabilityDistributeOnly
+	db, err := c.VolumeCreate(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	all, err := c.VolumeList()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(all.Volumes) == 4, all)
+	tests.Assert(t, all.Total == 4, all)
+
+	// Pages
+	list, err := c.VolumeListWithOptions(&api.ListOptions{Limit: 3, Offset: 1})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, reflect.DeepEqual(list.Volumes, all.Volumes[1:4]), list)
+	tests.Assert(t, list.Total == 4, list)
+
+	list, err = c.VolumeListWithOptions(&api.ListOptions{Offset: 4})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(list.Volumes) == 0, list)
+
+	// Filters
+	list, err = c.VolumeListWithOptions(&api.ListOptions{
+		Cluster:    cluster,
+		NamePrefix: "app_",
+		Limit:      2,
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(list.Volumes) == 2, list)
+	tests.Assert(t, list.Total == 3, list)
+
+	list, err = c.VolumeListWithOptions(&api.ListOptions{NamePrefix: "app_b"})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(list.Volumes) == 1 && list.Total == 1, list)
+
+	list, err = c.VolumeListWithOptions(&api.ListOptions{
+		Cluster: clusters.Clusters[1],
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(list.Volumes) == 1 && list.Volumes[0] == db.Id, list)
+
+	list, err = c.VolumeListWithOptions(&api.ListOptions{
+		Durability: api.DurabilityDistributeOnly,
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(list.Volumes) == 1 && list.Volumes[0] == db.Id, list)
+
+	block := true
+	list, err = c.VolumeListWithOptions(&api.ListOptions{Block: &block})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(list.Volumes) == 0, list)
+
+	// Bricks
+	bricks, err := c.BrickList(&api.ListOptions{Volume: db.Id})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(bricks.Bricks) == len(db.Bricks), bricks)
+
+	bricks, err = c.BrickList(&api.ListOptions{Cluster: cluster})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, bricks.Total == 9, bricks)
+
+	// Invalid options and filters not applying to the list
+	_, err = c.VolumeListWithOptions(&api.ListOptions{Cluster: "abc"})
+	tests.Assert(t, err != nil)
+	_, err = c.BrickList(&api.ListOptions{NamePrefix: "app"})
+	tests.Assert(t, err != nil)
+	tests.Assert(t, strings.Contains(err.Error(), "not supported"), err)
+
+	r, err := http.Get(ts.URL + "/volumes?limit=-1")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	r.Body.Close()
+	tests.Assert(t, r.StatusCode == http.StatusBadRequest, r.StatusCode)
+}
+
+func TestVolumeListExpand(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	c := client.NewClientNoAuth(ts.URL)
+	tests.Assert(t, c != nil)
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		3,    // nodes_per_cluster
+		2,    // devices_per_node,
+		2*TB, // disksize
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	for i := 0; i < 3; i++ {
+		req := &api.VolumeCreateRequest{}
+		req.Size = 10
+		req.Durability.Type = api.DurabilityReplicate
+		req.Durability.Replicate.Replica = 3
+		_, err := c.VolumeCreate(req)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	}
+
+	list, err := c.VolumeList()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(list.Infos) == 0, list.Infos)
+
+	expanded, err := c.VolumeListWithOptions(&api.ListOptions{
+		Expand: true,
+		Offset: 1,
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, reflect.DeepEqual(expanded.Volumes, list.Volumes[1:]),
+		expanded.Volumes)
+	tests.Assert(t, expanded.Total == 3, expanded.Total)
+	tests.Assert(t, len(expanded.Infos) == 2, expanded.Infos)
+	for i, info := range expanded.Infos {
+		vol, err := c.VolumeInfo(expanded.Volumes[i])
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, reflect.DeepEqual(&info, vol), info, vol)
+	}
+
+	// Only the volumes can be expanded
+	_, err = c.BrickList(&api.ListOptions{Expand: true})
+	tests.Assert(t, err != nil, "expected err != nil")
+}
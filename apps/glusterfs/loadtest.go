@@ -0,0 +1,258 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+)
+
+// LoadTestConfig describes the work generated by RunLoadTest
+type LoadTestConfig struct {
+	// Number of concurrent workers
+	Workers int
+
+	// Number of volumes each worker creates and then deletes
+	Volumes int
+
+	// Size of each volume in GB
+	VolumeSize int
+
+	// Replica count of each volume. Zero creates distribute only volumes.
+	Replica int
+
+	// Interval between probes of the db write lock
+	ProbeInterval time.Duration
+}
+
+// LatencyStats summarizes a set of latency samples
+type LatencyStats struct {
+	Count int
+	Min   time.Duration
+	Max   time.Duration
+	Mean  time.Duration
+	P50   time.Duration
+	P90   time.Duration
+	P99   time.Duration
+}
+
+// LoadTestResult is the report produced by RunLoadTest
+type LoadTestResult struct {
+	Duration   time.Duration
+	Failures   int
+	Throughput float64
+
+	// Time for the full create and delete operations
+	Creates LatencyStats
+	Deletes LatencyStats
+
+	// Time spent allocating bricks, the Build stage of volume creates
+	Allocation LatencyStats
+
+	// Time spent waiting for the db write lock by an idle probe
+	DbLockWait LatencyStats
+}
+
+// timedOperation records how long the Build stage of an operation takes
+type timedOperation struct {
+	Operation
+	build time.Duration
+}
+
+func (t *timedOperation) Build(allocator Allocator) error {
+	start := time.Now()
+	defer func() {
+		t.build = time.Since(start)
+	}()
+	return t.Operation.Build(allocator)
+}
+
+type latencySamples struct {
+	lock    sync.Mutex
+	samples []time.Duration
+}
+
+func (l *latencySamples) add(d time.Duration) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.samples = append(l.samples, d)
+}
+
+func (l *latencySamples) stats() LatencyStats {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return NewLatencyStats(l.samples)
+}
+
+// NewLatencyStats computes the summary of the given latency samples
+func NewLatencyStats(samples []time.Duration) LatencyStats {
+	s := LatencyStats{Count: len(samples)}
+	if len(samples) == 0 {
+		return s
+	}
+
+	sorted := make([]time.Duration, len(samples))
+	copy(sorted, samples)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] < sorted[j]
+	})
+
+	var total time.Duration
+	for _, d := range sorted {
+		total += d
+	}
+	percentile := func(p int) time.Duration {
+		return sorted[(len(sorted)-1)*p/100]
+	}
+
+	s.Min = sorted[0]
+	s.Max = sorted[len(sorted)-1]
+	s.Mean = total / time.Duration(len(sorted))
+	s.P50 = percentile(50)
+	s.P90 = percentile(90)
+	s.P99 = percentile(99)
+	return s
+}
+
+func (s LatencyStats) String() string {
+	return fmt.Sprintf("count=%v min=%v mean=%v p50=%v p90=%v p99=%v max=%v",
+		s.Count, s.Min, s.Mean, s.P50, s.P90, s.P99, s.Max)
+}
+
+func (r *LoadTestResult) String() string {
+	return fmt.Sprintf("Duration: %v\n"+
+		"Failures: %v\n"+
+		"Throughput: %.2f ops/s\n"+
+		"Create: %v\n"+
+		"Delete: %v\n"+
+		"Allocation: %v\n"+
+		"Db Lock Wait: %v\n",
+		r.Duration,
+		r.Failures,
+		r.Throughput,
+		r.Creates,
+		r.Deletes,
+		r.Allocation,
+		r.DbLockWait)
+}
+
+// RunLoadTest drives concurrent volume creates and deletes through
+// the operations of the given app and reports their latencies. It is
+// meant to be run against an app using the mock executor so that the
+// results reflect the cost of allocation and db access in heketi only.
+func RunLoadTest(app *App, config LoadTestConfig) *LoadTestResult {
+	if config.Workers < 1 {
+		config.Workers = 1
+	}
+	if config.VolumeSize < 1 {
+		config.VolumeSize = 1
+	}
+	if config.ProbeInterval == 0 {
+		config.ProbeInterval = 10 * time.Millisecond
+	}
+
+	var (
+		creates, deletes, allocation, lockWait latencySamples
+		failures                               int
+		failuresLock                           sync.Mutex
+		wg                                     sync.WaitGroup
+	)
+
+	fail := func(err error) {
+		failuresLock.Lock()
+		defer failuresLock.Unlock()
+		logger.Warning("Load test operation failed: %v", err)
+		failures++
+	}
+
+	// Measure how long an empty write transaction waits for the db lock
+	// while the workers are running
+	stop := make(chan struct{})
+	probeDone := make(chan struct{})
+	go func() {
+		defer close(probeDone)
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(config.ProbeInterval):
+			}
+			start := time.Now()
+			app.db.Update(func(tx *bolt.Tx) error {
+				lockWait.add(time.Since(start))
+				return nil
+			})
+		}
+	}()
+
+	start := time.Now()
+	for w := 0; w < config.Workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < config.Volumes; i++ {
+				req := &api.VolumeCreateRequest{}
+				req.Size = config.VolumeSize
+				if config.Replica > 0 {
+					req.Durability.Type = api.DurabilityReplicate
+					req.Durability.Replicate.Replica = config.Replica
+				} else {
+					req.Durability.Type = api.DurabilityDistributeOnly
+				}
+				vol := NewVolumeEntryFromRequest(req)
+
+				op := &timedOperation{
+					Operation: NewVolumeCreateOperation(vol, app.db),
+				}
+				opStart := time.Now()
+				err := RunOperation(op, app.Allocator(), app.executor)
+				if err != nil {
+					fail(err)
+					continue
+				}
+				creates.add(time.Since(opStart))
+				allocation.add(op.build)
+
+				opStart = time.Now()
+				err = RunOperation(NewVolumeDeleteOperation(vol, app.db),
+					app.Allocator(), app.executor)
+				if err != nil {
+					fail(err)
+					continue
+				}
+				deletes.add(time.Since(opStart))
+			}
+		}()
+	}
+	wg.Wait()
+	duration := time.Since(start)
+
+	close(stop)
+	<-probeDone
+
+	r := &LoadTestResult{
+		Duration:   duration,
+		Failures:   failures,
+		Creates:    creates.stats(),
+		Deletes:    deletes.stats(),
+		Allocation: allocation.stats(),
+		DbLockWait: lockWait.stats(),
+	}
+	if duration > 0 {
+		r.Throughput = float64(r.Creates.Count+r.Deletes.Count) /
+			duration.Seconds()
+	}
+	return r
+}
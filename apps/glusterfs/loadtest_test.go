@@ -0,0 +1,118 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/heketi/tests"
+)
+
+func TestNewLatencyStats(t *testing.T) {
+	s := NewLatencyStats([]time.Duration{})
+	tests.Assert(t, s.Count == 0)
+	tests.Assert(t, s.Max == 0)
+
+	samples := []time.Duration{}
+	for i := 100; i > 0; i-- {
+		samples = append(samples, time.Duration(i)*time.Millisecond)
+	}
+	s = NewLatencyStats(samples)
+	tests.Assert(t, s.Count == 100)
+	tests.Assert(t, s.Min == time.Millisecond, s.Min)
+	tests.Assert(t, s.Max == 100*time.Millisecond, s.Max)
+	tests.Assert(t, s.P50 == 50*time.Millisecond, s.P50)
+	tests.Assert(t, s.P90 == 90*time.Millisecond, s.P90)
+	tests.Assert(t, s.P99 == 99*time.Millisecond, s.P99)
+	tests.Assert(t, s.Mean == 50500*time.Microsecond, s.Mean)
+
+	// the samples must be left in their original order
+	tests.Assert(t, samples[0] == 100*time.Millisecond)
+}
+
+func TestRunLoadTest(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		4,    // nodes_per_cluster
+		4,    // devices_per_node,
+		1*TB, // disksize)
+	)
+	tests.Assert(t, err == nil)
+
+	r := RunLoadTest(app, LoadTestConfig{
+		Workers:    4,
+		Volumes:    3,
+		VolumeSize: 10,
+		Replica:    3,
+	})
+	tests.Assert(t, r.Failures == 0, r.Failures)
+	tests.Assert(t, r.Creates.Count == 12, r.Creates.Count)
+	tests.Assert(t, r.Deletes.Count == 12, r.Deletes.Count)
+	tests.Assert(t, r.Allocation.Count == 12, r.Allocation.Count)
+	tests.Assert(t, r.Throughput > 0)
+	tests.Assert(t, r.String() != "")
+
+	// Every volume created by the test has been removed
+	err = app.db.View(func(tx *bolt.Tx) error {
+		volumes, err := VolumeList(tx)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, len(volumes) == 0, volumes)
+
+		bricks, err := BrickList(tx)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, len(bricks) == 0, bricks)
+		return nil
+	})
+	tests.Assert(t, err == nil)
+}
+
+func BenchmarkVolumeCreateDelete(b *testing.B) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	err := setupSampleDbWithTopology(app,
+		1,     // clusters
+		10,    // nodes_per_cluster
+		10,    // devices_per_node,
+		10*TB, // disksize)
+	)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	// Spread b.N create/delete pairs over the workers
+	workers := 8
+	b.ResetTimer()
+	r := RunLoadTest(app, LoadTestConfig{
+		Workers:    workers,
+		Volumes:    (b.N + workers - 1) / workers,
+		VolumeSize: 10,
+		Replica:    3,
+	})
+	b.StopTimer()
+
+	if r.Failures != 0 {
+		b.Fatalf("%v operations failed", r.Failures)
+	}
+	b.Logf("\n%v", r)
+}
@@ -0,0 +1,302 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/heketi/heketi/executors"
+	wdb "github.com/heketi/heketi/pkg/db"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/heketi/pkg/utils"
+)
+
+var (
+	// Seconds to wait for the heals of a volume to complete after its
+	// bricks were restarted when the request does not set a timeout
+	BrickRestartHealTimeout = 600
+
+	// Time between the checks of the heal state of a volume
+	brickRestartPollInterval = 10 * time.Second
+)
+
+// brickRestartVolume is a volume with bricks on the node being restarted
+type brickRestartVolume struct {
+	id         string
+	name       string
+	durability api.DurabilityType
+	// Paths of the bricks of the volume on the node
+	paths map[string]bool
+}
+
+// updateNodeBrickRestart applies the update to the brick restart
+// progress saved on the node.
+func updateNodeBrickRestart(db wdb.DB, nodeId string,
+	update func(p *api.NodeBrickRestartProgress)) error {
+
+	return db.Update(func(tx *bolt.Tx) error {
+		node, err := NewNodeEntryFromId(tx, nodeId)
+		if err != nil {
+			return err
+		}
+		if node.BrickRestart == nil {
+			node.BrickRestart = &api.NodeBrickRestartProgress{NodeId: nodeId}
+		}
+		update(node.BrickRestart)
+		return node.Save(tx)
+	})
+}
+
+// nodeBrickRestartVolumes returns the volumes with bricks on the
+// devices of the node, ordered by name, and the host to manage the
+// node from
+func nodeBrickRestartVolumes(db wdb.RODB,
+	nodeId string) (string, []*brickRestartVolume, error) {
+
+	var host string
+	volumes := map[string]*brickRestartVolume{}
+	err := db.View(func(tx *bolt.Tx) error {
+		node, err := NewNodeEntryFromId(tx, nodeId)
+		if err != nil {
+			return err
+		}
+		if !node.isOnline() {
+			return fmt.Errorf("Node %v is not online", nodeId)
+		}
+		host = node.ManageHostName()
+		for _, id := range node.Devices {
+			device, err := NewDeviceEntryFromId(tx, id)
+			if err != nil {
+				return err
+			}
+			for _, brickId := range device.Bricks {
+				brick, err := NewBrickEntryFromId(tx, brickId)
+				if err != nil {
+					return err
+				}
+				v, ok := volumes[brick.Info.VolumeId]
+				if !ok {
+					volume, err := NewVolumeEntryFromId(tx, brick.Info.VolumeId)
+					if err != nil {
+						return err
+					}
+					v = &brickRestartVolume{
+						id:         volume.Info.Id,
+						name:       volume.Info.Name,
+						durability: volume.Info.Durability.Type,
+						paths:      map[string]bool{},
+					}
+					volumes[v.id] = v
+				}
+				v.paths[brick.Info.Path] = true
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	list := []*brickRestartVolume{}
+	for _, v := range volumes {
+		list = append(list, v)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].name < list[j].name
+	})
+	return host, list, nil
+}
+
+// brickPids returns the pids of the bricks of the volume on the node
+// as reported by volume status. Bricks that are not running have no pid
+// and are started by the forced volume start.
+func (v *brickRestartVolume) brickPids(status *executors.VolumeStatus) []int {
+	pids := []int{}
+	for _, b := range status.Bricks {
+		if v.paths[b.Path] && b.Status == 1 && b.Pid > 0 {
+			pids = append(pids, b.Pid)
+		}
+	}
+	return pids
+}
+
+// offlineBricks returns the bricks of the volume on the node that volume
+// status does not report online
+func (v *brickRestartVolume) offlineBricks(status *executors.VolumeStatus) []string {
+	online := map[string]bool{}
+	for _, b := range status.Bricks {
+		if v.paths[b.Path] && b.Status == 1 {
+			online[b.Path] = true
+		}
+	}
+	offline := []string{}
+	for path := range v.paths {
+		if !online[path] {
+			offline = append(offline, path)
+		}
+	}
+	sort.Strings(offline)
+	return offline
+}
+
+// healPending returns the bricks of the volume that still have entries
+// to heal. The bricks of the node are also pending until the self-heal
+// daemon reports their entries again.
+func (v *brickRestartVolume) healPending(healinfo *executors.HealInfo) []string {
+	pending := []string{}
+	for _, b := range healinfo.Bricks.BrickList {
+		if b.NumberOfEntries == "0" {
+			continue
+		}
+		_, path, err := utils.SplitBrickName(b.Name)
+		if b.NumberOfEntries == "-" && (err != nil || !v.paths[path]) {
+			continue
+		}
+		pending = append(pending, b.Name)
+	}
+	return pending
+}
+
+// restart restarts the bricks of the volume on the node and waits for
+// them to be online and for the volume to heal
+func (v *brickRestartVolume) restart(executor executors.Executor,
+	host string,
+	healTimeout time.Duration) error {
+
+	status, err := executor.VolumeStatus(host, v.name)
+	if err != nil {
+		return err
+	}
+	pids := v.brickPids(status)
+	if len(pids) == 0 {
+		logger.Warning("No running bricks of volume %v found on %v, starting them",
+			v.name, host)
+	}
+	if err := executor.VolumeRestartBricks(host, v.name, pids); err != nil {
+		return err
+	}
+
+	status, err = executor.VolumeStatus(host, v.name)
+	if err != nil {
+		return err
+	}
+	if offline := v.offlineBricks(status); len(offline) > 0 {
+		return fmt.Errorf("Bricks of volume %v are offline after the restart: %v",
+			v.name, strings.Join(offline, ", "))
+	}
+
+	// There is nothing to heal without redundancy
+	if v.durability == api.DurabilityDistributeOnly || v.durability == "" {
+		return nil
+	}
+	deadline := time.Now().Add(healTimeout)
+	for {
+		healinfo, err := executor.HealInfo(host, v.name)
+		if err != nil {
+			return err
+		}
+		pending := v.healPending(healinfo)
+		if len(pending) == 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("Heal of volume %v did not complete in %v, "+
+				"bricks with entries to heal: %v",
+				v.name, healTimeout, strings.Join(pending, ", "))
+		}
+		logger.Debug("Waiting for the heal of volume %v: %v",
+			v.name, strings.Join(pending, ", "))
+		time.Sleep(brickRestartPollInterval)
+	}
+}
+
+// RestartNodeBricks restarts the brick processes on a node one volume
+// at a time. The bricks of a volume are stopped and started again with
+// a forced volume start, and the bricks of the next volume are only
+// restarted once the bricks are back online and the volume has healed,
+// so that a single volume at most runs without the bricks of the node.
+// The restart stops at the first volume that fails. The state of each
+// volume is saved on the node so that the progress can be followed.
+func RestartNodeBricks(db wdb.DB,
+	executor executors.Executor,
+	nodeId string,
+	healTimeout int) error {
+
+	if healTimeout <= 0 {
+		healTimeout = BrickRestartHealTimeout
+	}
+
+	host, volumes, err := nodeBrickRestartVolumes(db, nodeId)
+	if err != nil {
+		return err
+	}
+	progress := &api.NodeBrickRestartProgress{
+		NodeId:  nodeId,
+		State:   api.BrickRestartRunning,
+		Started: time.Now().Unix(),
+		Volumes: []api.VolumeBrickRestartInfo{},
+	}
+	for _, v := range volumes {
+		progress.Volumes = append(progress.Volumes, api.VolumeBrickRestartInfo{
+			VolumeId: v.id,
+			Name:     v.name,
+			State:    api.BrickRestartPending,
+		})
+	}
+	err = updateNodeBrickRestart(db, nodeId, func(p *api.NodeBrickRestartProgress) {
+		*p = *progress
+	})
+	if err != nil {
+		return err
+	}
+	logger.Info("Restarting bricks of %v volumes on node %v", len(volumes), nodeId)
+
+	// Record the error on the progress before returning it
+	fail := func(err error) error {
+		logger.LogError("Unable to restart bricks on node %v: %v", nodeId, err)
+		updateNodeBrickRestart(db, nodeId, func(p *api.NodeBrickRestartProgress) {
+			p.State = api.BrickRestartFailed
+			p.Finished = time.Now().Unix()
+			p.Message = err.Error()
+		})
+		return err
+	}
+	volumeDone := func(i int, state string, err error) {
+		logger.Info("Bricks of volume %v on node %v: %v", volumes[i].name, nodeId, state)
+		updateNodeBrickRestart(db, nodeId, func(p *api.NodeBrickRestartProgress) {
+			p.Volumes[i].State = state
+			if err != nil {
+				p.Volumes[i].Message = err.Error()
+			}
+		})
+	}
+
+	if err := executor.GlusterdCheck(host); err != nil {
+		return fail(err)
+	}
+	for i, v := range volumes {
+		err := v.restart(executor, host, time.Duration(healTimeout)*time.Second)
+		if err != nil {
+			volumeDone(i, api.BrickRestartFailed, err)
+			return fail(err)
+		}
+		volumeDone(i, api.BrickRestartDone, nil)
+	}
+
+	logger.Info("Restarted bricks on node %v", nodeId)
+	return updateNodeBrickRestart(db, nodeId, func(p *api.NodeBrickRestartProgress) {
+		p.State = api.BrickRestartDone
+		p.Finished = time.Now().Unix()
+	})
+}
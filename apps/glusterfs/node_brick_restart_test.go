@@ -0,0 +1,235 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/gorilla/mux"
+	client "github.com/heketi/heketi/client/api/go-client"
+	"github.com/heketi/heketi/executors"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/tests"
+)
+
+// mockVolumeStatusFromDb reports every brick of the volume online with
+// a pid of its own
+func mockVolumeStatusFromDb(db *bolt.DB, volume string) (*executors.VolumeStatus, error) {
+	status := &executors.VolumeStatus{VolName: volume}
+	db.View(func(tx *bolt.Tx) error {
+		v, err := NewVolumeEntryFromId(tx, volume[4:])
+		if err != nil {
+			return err
+		}
+		for _, id := range v.BricksIds() {
+			b, err := NewBrickEntryFromId(tx, id)
+			if err != nil {
+				return err
+			}
+			status.Bricks = append(status.Bricks, executors.BrickStatus{
+				Path:   b.Info.Path,
+				Status: 1,
+				Pid:    1000 + len(status.Bricks),
+			})
+		}
+		return nil
+	})
+	return status, nil
+}
+
+// setupBrickRestartMocks reports the bricks online and returns the pids
+// restarted by volume
+func setupBrickRestartMocks(app *App) map[string][]int {
+	restarted := map[string][]int{}
+	app.xo.MockVolumeStatus = func(host string, volume string) (*executors.VolumeStatus, error) {
+		return mockVolumeStatusFromDb(app.db, volume)
+	}
+	app.xo.MockVolumeRestartBricks = func(host string, volume string, pids []int) error {
+		restarted[volume] = pids
+		return nil
+	}
+	return restarted
+}
+
+func TestRestartNodeBricks(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	defer func(d time.Duration) { brickRestartPollInterval = d }(brickRestartPollInterval)
+	brickRestartPollInterval = time.Millisecond
+
+	nodeId := sampleNodeWithBricks(t, app, 3)
+	restarted := setupBrickRestartMocks(app)
+
+	// Every volume has entries to heal on the first check
+	healChecks := map[string]int{}
+	app.xo.MockHealInfo = func(host string, volume string) (*executors.HealInfo, error) {
+		hi, err := mockHealStatusFromDb(app.db, volume)
+		if healChecks[volume] == 0 {
+			hi.Bricks.BrickList[0].NumberOfEntries = "5"
+		}
+		healChecks[volume]++
+		return hi, err
+	}
+
+	err := RestartNodeBricks(app.db, app.executor, nodeId, 0)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	tests.Assert(t, len(restarted) == 3, "expected 3 volumes, got:", restarted)
+	for volume, pids := range restarted {
+		tests.Assert(t, len(pids) == 1, volume, pids)
+		tests.Assert(t, healChecks[volume] == 2, volume, healChecks[volume])
+	}
+
+	app.db.View(func(tx *bolt.Tx) error {
+		node, err := NewNodeEntryFromId(tx, nodeId)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, node.State == api.EntryStateOnline, node.State)
+
+		p := node.BrickRestart
+		tests.Assert(t, p != nil)
+		tests.Assert(t, p.State == api.BrickRestartDone, p.State)
+		tests.Assert(t, p.Finished >= p.Started)
+		tests.Assert(t, len(p.Volumes) == 3, p.Volumes)
+		for i, v := range p.Volumes {
+			tests.Assert(t, v.State == api.BrickRestartDone, v)
+			if i > 0 {
+				tests.Assert(t, p.Volumes[i-1].Name < v.Name)
+			}
+		}
+		return nil
+	})
+}
+
+func TestRestartNodeBricksHealTimeout(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	defer func(d time.Duration) { brickRestartPollInterval = d }(brickRestartPollInterval)
+	brickRestartPollInterval = time.Millisecond
+
+	nodeId := sampleNodeWithBricks(t, app, 3)
+	restarted := setupBrickRestartMocks(app)
+
+	// The volume never heals
+	app.xo.MockHealInfo = func(host string, volume string) (*executors.HealInfo, error) {
+		hi, err := mockHealStatusFromDb(app.db, volume)
+		hi.Bricks.BrickList[0].NumberOfEntries = "5"
+		return hi, err
+	}
+
+	err := RestartNodeBricks(app.db, app.executor, nodeId, 1)
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	// The bricks of the other volumes were left alone
+	tests.Assert(t, len(restarted) == 1, "expected 1 volume, got:", restarted)
+
+	app.db.View(func(tx *bolt.Tx) error {
+		node, err := NewNodeEntryFromId(tx, nodeId)
+		tests.Assert(t, err == nil)
+
+		p := node.BrickRestart
+		tests.Assert(t, p != nil)
+		tests.Assert(t, p.State == api.BrickRestartFailed, p.State)
+		tests.Assert(t, p.Message != "")
+		tests.Assert(t, len(p.Volumes) == 3, p.Volumes)
+		tests.Assert(t, p.Volumes[0].State == api.BrickRestartFailed, p.Volumes[0])
+		tests.Assert(t, p.Volumes[0].Message != "")
+		tests.Assert(t, p.Volumes[1].State == api.BrickRestartPending, p.Volumes[1])
+		tests.Assert(t, p.Volumes[2].State == api.BrickRestartPending, p.Volumes[2])
+		return nil
+	})
+}
+
+func TestRestartNodeBricksOffline(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	nodeId := sampleNodeWithBricks(t, app, 3)
+	setupBrickRestartMocks(app)
+
+	// The bricks do not come back after the restart
+	app.xo.MockVolumeRestartBricks = func(host string, volume string, pids []int) error {
+		app.xo.MockVolumeStatus = func(host string, volume string) (*executors.VolumeStatus, error) {
+			return &executors.VolumeStatus{VolName: volume}, nil
+		}
+		return nil
+	}
+
+	err := RestartNodeBricks(app.db, app.executor, nodeId, 0)
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	app.db.View(func(tx *bolt.Tx) error {
+		node, err := NewNodeEntryFromId(tx, nodeId)
+		tests.Assert(t, err == nil)
+		p := node.BrickRestart
+		tests.Assert(t, p.State == api.BrickRestartFailed, p.State)
+		tests.Assert(t, p.Volumes[0].State == api.BrickRestartFailed, p.Volumes[0])
+		return nil
+	})
+}
+
+func TestNodeRestartBricksHttp(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	c := client.NewClientNoAuth(ts.URL)
+	tests.Assert(t, c != nil)
+
+	nodeId := sampleNodeWithBricks(t, app, 3)
+	setupBrickRestartMocks(app)
+
+	// Nothing to report before the bricks are restarted
+	_, err := c.NodeRestartBricksStatus(nodeId)
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	p, err := c.NodeRestartBricks(nodeId, &api.NodeBrickRestartRequest{})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, p.NodeId == nodeId)
+	tests.Assert(t, p.State == api.BrickRestartDone, p.State)
+	tests.Assert(t, len(p.Volumes) == 3, p.Volumes)
+
+	p, err = c.NodeRestartBricksStatus(nodeId)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, p.State == api.BrickRestartDone, p.State)
+
+	_, err = c.NodeRestartBricks(nodeId, &api.NodeBrickRestartRequest{HealTimeout: -1})
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	_, err = c.NodeRestartBricks("12345", &api.NodeBrickRestartRequest{})
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	// Offline nodes are not restarted
+	err = c.NodeState(nodeId, &api.StateRequest{State: api.EntryStateOffline, Reason: api.StateReasonMaintenance})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	_, err = c.NodeRestartBricks(nodeId, &api.NodeBrickRestartRequest{})
+	tests.Assert(t, err != nil, "expected err != nil")
+}
@@ -26,8 +26,24 @@ import (
 type NodeEntry struct {
 	Entry
 
-	Info    api.NodeInfo
-	Devices sort.StringSlice
+	Info         api.NodeInfo
+	Devices      sort.StringSlice
+	HealthEvents []api.NodeHealthEvent
+
+	// Tags of the devices of the node by device id. They are kept in
+	// the node so that the entries of devices, which can number in the
+	// thousands, stay small enough for the db to fit in a Kubernetes
+	// secret.
+	DeviceTags map[string]map[string]string
+
+	// Enclosures of the devices of the node by device id, kept in the
+	// node like the tags
+	DeviceEnclosures map[string]string
+
+	// Progress of the last removal of the node
+	Removal *api.NodeRemoveProgress
+	// Progress of the last rolling restart of the bricks on the node
+	BrickRestart *api.NodeBrickRestartProgress
 }
 
 func NewNodeEntry() *NodeEntry {
@@ -44,8 +60,19 @@ func NewNodeEntryFromRequest(req *api.NodeAddRequest) *NodeEntry {
 	node := NewNodeEntry()
 	node.Info.Id = utils.GenUUID()
 	node.Info.ClusterId = req.ClusterId
-	node.Info.Hostnames = req.Hostnames
 	node.Info.Zone = req.Zone
+	node.Info.AddressFamily = req.AddressFamily
+	node.Info.Tags = copyTags(req.Tags)
+
+	// Keep IPv6 addresses in the form gluster reports them
+	node.Info.Hostnames.Manage = make(sort.StringSlice, len(req.Hostnames.Manage))
+	for i, h := range req.Hostnames.Manage {
+		node.Info.Hostnames.Manage[i] = utils.CanonicalHost(h)
+	}
+	node.Info.Hostnames.Storage = make(sort.StringSlice, len(req.Hostnames.Storage))
+	for i, h := range req.Hostnames.Storage {
+		node.Info.Hostnames.Storage[i] = utils.CanonicalHost(h)
+	}
 
 	return node
 }
@@ -86,6 +113,7 @@ func GetVerifiedManageHostname(db wdb.RODB, e executors.Executor, clusterId stri
 		return "", err
 	}
 
+	nodes := []*NodeEntry{}
 	for _, n := range cluster.Info.Nodes {
 		var newNode *NodeEntry
 		err = db.View(func(tx *bolt.Tx) error {
@@ -103,7 +131,20 @@ func GetVerifiedManageHostname(db wdb.RODB, e executors.Executor, clusterId stri
 		if !newNode.isOnline() {
 			continue
 		}
+		nodes = append(nodes, newNode)
+	}
+
+	// Use a node found healthy by the periodic checks, if any, without
+	// checking the nodes again
+	for _, newNode := range nodes {
+		if nodeHealth.healthy(newNode.ManageHostName()) {
+			return newNode.ManageHostName(), nil
+		}
+	}
+
+	for _, newNode := range nodes {
 		err = e.GlusterdCheck(newNode.ManageHostName())
+		nodeHealth.record(newNode.ManageHostName(), err)
 		if err != nil {
 			logger.Info("Glusterd not running in %v", newNode.ManageHostName())
 			continue
@@ -140,7 +181,7 @@ func GetManageHostnameFromStorageHostname(tx *bolt.Tx, shostname string) (string
 			if err != nil {
 				return "", err
 			}
-			if newNode.StorageHostName() == shostname {
+			if newNode.IsStorageHost(shostname) {
 				node = newNode
 				break
 			}
@@ -248,13 +289,34 @@ func (n *NodeEntry) ManageHostName() string {
 	return n.Info.Hostnames.Manage[0]
 }
 
+// StorageHostName returns the storage hostname gluster uses for
+// the node. When an address family is set for the node, the first
+// storage address of that family is preferred.
 func (n *NodeEntry) StorageHostName() string {
 	godbc.Require(n.Info.Hostnames.Storage != nil)
 	godbc.Require(len(n.Info.Hostnames.Storage) > 0)
 
+	if n.Info.AddressFamily != "" {
+		for _, h := range n.Info.Hostnames.Storage {
+			if utils.AddressFamily(h) == n.Info.AddressFamily {
+				return h
+			}
+		}
+	}
 	return n.Info.Hostnames.Storage[0]
 }
 
+// IsStorageHost returns true if the host is one of the storage
+// hostnames of the node
+func (n *NodeEntry) IsStorageHost(host string) bool {
+	for _, h := range n.Info.Hostnames.Storage {
+		if utils.SameHost(h, host) {
+			return true
+		}
+	}
+	return false
+}
+
 func (n *NodeEntry) IsDeleteOk() bool {
 	// Check if the nodes still has drives
 	if len(n.Devices) > 0 {
@@ -276,6 +338,9 @@ func (n *NodeEntry) Delete(tx *bolt.Tx) error {
 		return ErrConflict
 	}
 
+	if err := deleteStateReason(tx, n.Info.Id); err != nil {
+		return err
+	}
 	return EntryDelete(tx, n, n.Info.Id)
 }
 
@@ -283,6 +348,20 @@ func (n *NodeEntry) SetState(db wdb.DB, e executors.Executor,
 	a Allocator,
 	s api.EntryState) error {
 
+	return n.SetStateWithReason(db, e, a, s, nil)
+}
+
+// SetStateWithReason changes the state of the node like SetState,
+// saving the reason of the new state along with it
+func (n *NodeEntry) SetStateWithReason(db wdb.DB, e executors.Executor,
+	a Allocator,
+	s api.EntryState,
+	reason *api.StateReason) error {
+
+	if n.State == s {
+		return keepStateReason(db, n.Info.Id, s, reason)
+	}
+
 	// Check current state
 	switch n.State {
 
@@ -293,8 +372,8 @@ func (n *NodeEntry) SetState(db wdb.DB, e executors.Executor,
 			return nil
 		case api.EntryStateOnline:
 			return fmt.Errorf("Cannot move a failed/removed node to online state")
-		case api.EntryStateOffline:
-			return fmt.Errorf("Cannot move a failed/removed node to offline state")
+		case api.EntryStateOffline, api.EntryStateDraining, api.EntryStateMaintenance:
+			return fmt.Errorf("Cannot move a failed/removed node to %v state", s)
 		default:
 			return fmt.Errorf("Unknown state type: %v", s)
 		}
@@ -304,7 +383,7 @@ func (n *NodeEntry) SetState(db wdb.DB, e executors.Executor,
 		switch s {
 		case api.EntryStateOnline:
 			return nil
-		case api.EntryStateOffline:
+		case api.EntryStateOffline, api.EntryStateDraining, api.EntryStateMaintenance:
 			err := db.Update(func(tx *bolt.Tx) error {
 				// Save state
 				n.State = s
@@ -313,7 +392,7 @@ func (n *NodeEntry) SetState(db wdb.DB, e executors.Executor,
 				if err != nil {
 					return err
 				}
-				return nil
+				return updateStateReason(tx, n.Info.Id, s, reason)
 			})
 			if err != nil {
 				return err
@@ -324,19 +403,20 @@ func (n *NodeEntry) SetState(db wdb.DB, e executors.Executor,
 			return fmt.Errorf("Unknown state type: %v", s)
 		}
 
-	// Node is in disabled/offline state
-	case api.EntryStateOffline:
+	// Node is in disabled/offline, draining or maintenance state
+	case api.EntryStateOffline, api.EntryStateDraining, api.EntryStateMaintenance:
 		switch s {
-		case api.EntryStateOffline:
+		case n.State:
 			return nil
-		case api.EntryStateOnline:
+		case api.EntryStateOnline, api.EntryStateOffline,
+			api.EntryStateDraining, api.EntryStateMaintenance:
 			err := db.Update(func(tx *bolt.Tx) error {
 				n.State = s
 				err := n.Save(tx)
 				if err != nil {
 					return err
 				}
-				return nil
+				return updateStateReason(tx, n.Info.Id, s, reason)
 			})
 			if err != nil {
 				return err
@@ -368,7 +448,7 @@ func (n *NodeEntry) SetState(db wdb.DB, e executors.Executor,
 				if err != nil {
 					return err
 				}
-				return nil
+				return updateStateReason(tx, n.Info.Id, s, reason)
 			})
 			if err != nil {
 				return err
@@ -390,7 +470,12 @@ func (n *NodeEntry) NewInfoReponse(tx *bolt.Tx) (*api.NodeInfoResponse, error) {
 	info.Hostnames = n.Info.Hostnames
 	info.Id = n.Info.Id
 	info.Zone = n.Info.Zone
+	info.AddressFamily = n.Info.AddressFamily
+	info.Tags = copyTags(n.Info.Tags)
+	info.ManageAddress = n.Info.ManageAddress
+	info.HealthEvents = n.HealthEvents
 	info.State = n.State
+	info.StateReason = stateReason(tx, n.Info.Id)
 	info.DevicesInfo = make([]api.DeviceInfoResponse, 0)
 
 	// Add each drive information
@@ -442,6 +527,38 @@ func (n *NodeEntry) DeviceAdd(id string) {
 
 func (n *NodeEntry) DeviceDelete(id string) {
 	n.Devices = utils.SortedStringsDelete(n.Devices, id)
+	delete(n.DeviceTags, id)
+	delete(n.DeviceEnclosures, id)
+}
+
+// SetDeviceTags replaces the tags of the device of the node
+func (n *NodeEntry) SetDeviceTags(id string, tags map[string]string) {
+	if len(tags) == 0 {
+		delete(n.DeviceTags, id)
+		return
+	}
+	if n.DeviceTags == nil {
+		n.DeviceTags = map[string]map[string]string{}
+	}
+	n.DeviceTags[id] = copyTags(tags)
+}
+
+// SetDeviceEnclosure sets the enclosure of the device of the node
+func (n *NodeEntry) SetDeviceEnclosure(id string, enclosure string) {
+	if enclosure == "" {
+		delete(n.DeviceEnclosures, id)
+		return
+	}
+	if n.DeviceEnclosures == nil {
+		n.DeviceEnclosures = map[string]string{}
+	}
+	n.DeviceEnclosures[id] = enclosure
+}
+
+// deviceTags returns the tags of the device of the node merged with
+// the tags of the node
+func (n *NodeEntry) deviceTags(id string) map[string]string {
+	return mergeTags(n.Info.Tags, n.DeviceTags[id])
 }
 
 func NodeEntryUpgrade(tx *bolt.Tx) error {
@@ -64,6 +64,45 @@ func TestNewNodeEntryFromRequest(t *testing.T) {
 
 }
 
+func TestNewNodeEntryFromRequestDualStack(t *testing.T) {
+	req := &api.NodeAddRequest{
+		ClusterId: "123",
+		Hostnames: api.HostAddresses{
+			Manage:  []string{"manage"},
+			Storage: []string{"192.168.10.100", "[FD00:0::10]"},
+		},
+		Zone: 99,
+	}
+
+	// The first storage address is used by default
+	n := NewNodeEntryFromRequest(req)
+	tests.Assert(t, n.Info.Hostnames.Storage[1] == "fd00::10", n.Info.Hostnames.Storage)
+	tests.Assert(t, n.StorageHostName() == "192.168.10.100")
+
+	req.AddressFamily = api.AddressFamilyInet6
+	n = NewNodeEntryFromRequest(req)
+	tests.Assert(t, n.Info.AddressFamily == api.AddressFamilyInet6)
+	tests.Assert(t, n.StorageHostName() == "fd00::10", n.StorageHostName())
+
+	tests.Assert(t, n.IsStorageHost("192.168.10.100"))
+	tests.Assert(t, n.IsStorageHost("fd00:0:0::10"))
+	tests.Assert(t, !n.IsStorageHost("fd00::11"))
+	tests.Assert(t, !n.IsStorageHost("manage"))
+
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	err := app.db.View(func(tx *bolt.Tx) error {
+		info, err := n.NewInfoReponse(tx)
+		tests.Assert(t, err == nil, err)
+		tests.Assert(t, info.AddressFamily == api.AddressFamilyInet6)
+		return nil
+	})
+	tests.Assert(t, err == nil)
+}
+
 func TestNewNodeEntryMarshal(t *testing.T) {
 	req := &api.NodeAddRequest{
 		ClusterId: "123",
@@ -0,0 +1,115 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/heketi/heketi/executors"
+	wdb "github.com/heketi/heketi/pkg/db"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+)
+
+var (
+	// Number of health events kept for each node
+	NodeHealthEventsMax = 20
+)
+
+// addHealthEvent records an event about the health of the node,
+// dropping the oldest events over NodeHealthEventsMax.
+func (n *NodeEntry) addHealthEvent(eventType, message string) {
+	n.HealthEvents = append(n.HealthEvents, api.NodeHealthEvent{
+		Time:    time.Now().Unix(),
+		Type:    eventType,
+		Message: message,
+	})
+	if over := len(n.HealthEvents) - NodeHealthEventsMax; over > 0 {
+		n.HealthEvents = n.HealthEvents[over:]
+	}
+}
+
+// recordHostResolution saves the result of the resolution of the
+// management hostname of a node done by the executor and records
+// failures, failovers and address changes as health events of the node.
+func recordHostResolution(db wdb.DB, host string, r executors.HostResolution) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		ids, err := NodeList(tx)
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			node, err := NewNodeEntryFromId(tx, id)
+			if err != nil {
+				return err
+			}
+			if node.ManageHostName() != host {
+				continue
+			}
+
+			switch {
+			case r.Error != nil:
+				node.addHealthEvent(api.NodeEventResolutionFailed, r.Error.Error())
+			case r.Hostname != host:
+				node.addHealthEvent(api.NodeEventHostnameFailover,
+					fmt.Sprintf("Unable to resolve %v, using %v at %v",
+						host, r.Hostname, r.Address))
+			case node.Info.ManageAddress != "" && node.Info.ManageAddress != r.Address:
+				node.addHealthEvent(api.NodeEventAddressChanged,
+					fmt.Sprintf("Address of %v changed from %v to %v",
+						host, node.Info.ManageAddress, r.Address))
+			}
+			if r.Error == nil {
+				node.Info.ManageAddress = r.Address
+			}
+			return node.Save(tx)
+		}
+		return nil
+	})
+}
+
+// setHostResolution lets the executor fail over to the other management
+// hostnames of the nodes and records the results of the resolutions.
+func (a *App) setHostResolution() {
+	resolver, ok := a.executor.(executors.HostResolver)
+	if !ok {
+		return
+	}
+
+	// The executor may be called while a db transaction is open, so
+	// the result is saved in the background
+	resolver.SetResolutionHandler(func(host string, r executors.HostResolution) {
+		go func() {
+			if err := recordHostResolution(a.db, host, r); err != nil {
+				logger.LogError("Unable to record resolution of %v: %v", host, err)
+			}
+		}()
+	})
+
+	err := a.db.View(func(tx *bolt.Tx) error {
+		nodes, err := NodeList(tx)
+		if err != nil {
+			return err
+		}
+		for _, id := range nodes {
+			node, err := NewNodeEntryFromId(tx, id)
+			if err != nil {
+				return err
+			}
+			resolver.SetHostAlternates(node.ManageHostName(),
+				node.Info.Hostnames.Manage[1:])
+		}
+		return nil
+	})
+	if err != nil {
+		logger.LogError("Unable to set alternate hostnames: %v", err)
+	}
+}
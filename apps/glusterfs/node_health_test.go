@@ -0,0 +1,118 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/heketi/heketi/executors"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/tests"
+)
+
+func TestRecordHostResolution(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		2,    // nodes_per_cluster
+		1,    // devices_per_node,
+		2*TB, // disksize)
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	var node *NodeEntry
+	app.db.View(func(tx *bolt.Tx) error {
+		ids, err := NodeList(tx)
+		tests.Assert(t, err == nil)
+		node, err = NewNodeEntryFromId(tx, ids[0])
+		tests.Assert(t, err == nil)
+		return nil
+	})
+	host := node.ManageHostName()
+
+	info := func() *api.NodeInfoResponse {
+		var info *api.NodeInfoResponse
+		app.db.View(func(tx *bolt.Tx) error {
+			n, err := NewNodeEntryFromId(tx, node.Info.Id)
+			tests.Assert(t, err == nil)
+			info, err = n.NewInfoReponse(tx)
+			tests.Assert(t, err == nil)
+			return nil
+		})
+		return info
+	}
+
+	// First resolution only records the address
+	err = recordHostResolution(app.db, host, executors.HostResolution{
+		Hostname: host,
+		Address:  "192.168.10.1",
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	i := info()
+	tests.Assert(t, i.ManageAddress == "192.168.10.1", i.ManageAddress)
+	tests.Assert(t, len(i.HealthEvents) == 0, i.HealthEvents)
+
+	err = recordHostResolution(app.db, host, executors.HostResolution{
+		Hostname: host,
+		Address:  "192.168.10.2",
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	i = info()
+	tests.Assert(t, i.ManageAddress == "192.168.10.2", i.ManageAddress)
+	tests.Assert(t, len(i.HealthEvents) == 1, i.HealthEvents)
+	tests.Assert(t, i.HealthEvents[0].Type == api.NodeEventAddressChanged)
+
+	// Failures keep the last known address
+	err = recordHostResolution(app.db, host, executors.HostResolution{
+		Error: errors.New("no such host"),
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	i = info()
+	tests.Assert(t, i.ManageAddress == "192.168.10.2", i.ManageAddress)
+	tests.Assert(t, len(i.HealthEvents) == 2, i.HealthEvents)
+	tests.Assert(t, i.HealthEvents[1].Type == api.NodeEventResolutionFailed)
+	tests.Assert(t, i.HealthEvents[1].Message == "no such host")
+
+	err = recordHostResolution(app.db, host, executors.HostResolution{
+		Hostname: "alternate",
+		Address:  "192.168.20.1",
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	i = info()
+	tests.Assert(t, i.ManageAddress == "192.168.20.1", i.ManageAddress)
+	tests.Assert(t, len(i.HealthEvents) == 3, i.HealthEvents)
+	tests.Assert(t, i.HealthEvents[2].Type == api.NodeEventHostnameFailover)
+
+	// Unknown hosts are ignored
+	err = recordHostResolution(app.db, "unknown", executors.HostResolution{
+		Error: errors.New("no such host"),
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+}
+
+func TestNodeHealthEventsMax(t *testing.T) {
+	defer tests.Patch(&NodeHealthEventsMax, 2).Restore()
+
+	n := NewNodeEntry()
+	n.addHealthEvent(api.NodeEventResolutionFailed, "a")
+	n.addHealthEvent(api.NodeEventResolutionFailed, "b")
+	n.addHealthEvent(api.NodeEventResolutionFailed, "c")
+	tests.Assert(t, len(n.HealthEvents) == 2, n.HealthEvents)
+	tests.Assert(t, n.HealthEvents[0].Message == "b")
+	tests.Assert(t, n.HealthEvents[1].Message == "c")
+}
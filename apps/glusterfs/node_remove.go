@@ -0,0 +1,180 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/heketi/heketi/executors"
+	wdb "github.com/heketi/heketi/pkg/db"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+)
+
+// updateNodeRemoval applies the update to the removal progress saved
+// on the node.
+func updateNodeRemoval(db wdb.DB, nodeId string,
+	update func(p *api.NodeRemoveProgress)) error {
+
+	return db.Update(func(tx *bolt.Tx) error {
+		node, err := NewNodeEntryFromId(tx, nodeId)
+		if err != nil {
+			return err
+		}
+		if node.Removal == nil {
+			node.Removal = &api.NodeRemoveProgress{NodeId: nodeId}
+		}
+		update(node.Removal)
+		return node.Save(tx)
+	})
+}
+
+// RemoveNode evacuates a node. The node is taken offline so no new bricks
+// are placed on it, every brick on its devices is migrated to other nodes
+// using the brick replace logic, and the node is then marked failed.
+// The state of each brick is saved on the node as it is migrated so that
+// the progress of the removal can be followed. The reason is saved with
+// the offline and failed states of the node.
+func RemoveNode(db wdb.DB,
+	executor executors.Executor,
+	allocator Allocator,
+	nodeId string,
+	reason *api.StateReason) error {
+
+	var devices []string
+	progress := &api.NodeRemoveProgress{
+		NodeId:  nodeId,
+		State:   api.NodeRemoveRunning,
+		Started: time.Now().Unix(),
+		Bricks:  []api.BrickMigrationInfo{},
+	}
+	err := db.View(func(tx *bolt.Tx) error {
+		node, err := NewNodeEntryFromId(tx, nodeId)
+		if err != nil {
+			return err
+		}
+		devices = node.Devices
+		for _, id := range node.Devices {
+			device, err := NewDeviceEntryFromId(tx, id)
+			if err != nil {
+				return err
+			}
+			for _, brickId := range device.Bricks {
+				brick, err := NewBrickEntryFromId(tx, brickId)
+				if err != nil {
+					return err
+				}
+				progress.Bricks = append(progress.Bricks, api.BrickMigrationInfo{
+					BrickId:  brickId,
+					VolumeId: brick.Info.VolumeId,
+					DeviceId: id,
+					State:    api.BrickMigrationPending,
+				})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	err = updateNodeRemoval(db, nodeId, func(p *api.NodeRemoveProgress) {
+		*p = *progress
+	})
+	if err != nil {
+		return err
+	}
+	logger.Info("Removing node %v with %v bricks", nodeId, len(progress.Bricks))
+
+	// Record the error on the progress before returning it
+	fail := func(err error) error {
+		logger.LogError("Unable to remove node %v: %v", nodeId, err)
+		updateNodeRemoval(db, nodeId, func(p *api.NodeRemoveProgress) {
+			p.State = api.NodeRemoveFailed
+			p.Finished = time.Now().Unix()
+			p.Message = err.Error()
+		})
+		return err
+	}
+	brickDone := func(brickId, state string, err error) {
+		logger.Info("Brick %v on node %v: %v", brickId, nodeId, state)
+		updateNodeRemoval(db, nodeId, func(p *api.NodeRemoveProgress) {
+			for i := range p.Bricks {
+				if p.Bricks[i].BrickId != brickId {
+					continue
+				}
+				p.Bricks[i].State = state
+				if err != nil {
+					p.Bricks[i].Message = err.Error()
+				}
+			}
+		})
+	}
+
+	// Nodes are loaded again before changing their state as the
+	// progress is saved on the node entry
+	var node *NodeEntry
+	loadNode := func() error {
+		return db.View(func(tx *bolt.Tx) error {
+			var err error
+			node, err = NewNodeEntryFromId(tx, nodeId)
+			return err
+		})
+	}
+
+	if err := loadNode(); err != nil {
+		return fail(err)
+	}
+	// The node is left offline, with the reason, if not every brick
+	// could be moved
+	if node.State == api.EntryStateOnline {
+		err := node.SetStateWithReason(db, executor, allocator,
+			api.EntryStateOffline, reason)
+		if err != nil {
+			return fail(err)
+		}
+	} else if err := keepStateReason(db, nodeId, node.State, reason); err != nil {
+		return fail(err)
+	}
+
+	for _, id := range devices {
+		var device *DeviceEntry
+		err := db.View(func(tx *bolt.Tx) error {
+			var err error
+			device, err = NewDeviceEntryFromId(tx, id)
+			return err
+		})
+		if err != nil {
+			return fail(err)
+		}
+		err = device.removeWithProgress(db, executor, allocator, brickDone, nil)
+		if err == ErrNoReplacement {
+			return fail(fmt.Errorf(
+				"No device was found to replace device [%v]", id))
+		} else if err != nil {
+			return fail(err)
+		}
+	}
+
+	// Every device is empty now, mark the node failed
+	if err := loadNode(); err != nil {
+		return fail(err)
+	}
+	err = node.SetStateWithReason(db, executor, allocator, api.EntryStateFailed, reason)
+	if err != nil {
+		return fail(err)
+	}
+
+	logger.Info("Removed node %v", nodeId)
+	return updateNodeRemoval(db, nodeId, func(p *api.NodeRemoveProgress) {
+		p.State = api.NodeRemoveDone
+		p.Finished = time.Now().Unix()
+	})
+}
@@ -0,0 +1,182 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/gorilla/mux"
+	client "github.com/heketi/heketi/client/api/go-client"
+	"github.com/heketi/heketi/executors"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/tests"
+)
+
+// sampleNodeWithBricks creates replica 3 volumes on the topology and
+// returns the id of a node holding bricks
+func sampleNodeWithBricks(t *testing.T, app *App, nodes int) string {
+	err := setupSampleDbWithTopology(app,
+		1,     // clusters
+		nodes, // nodes_per_cluster
+		2,     // devices_per_node,
+		5*TB,  // disksize
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	vreq := &api.VolumeCreateRequest{}
+	vreq.Size = 100
+	vreq.Durability.Type = api.DurabilityReplicate
+	vreq.Durability.Replicate.Replica = 3
+	for i := 0; i < 3; i++ {
+		v := NewVolumeEntryFromRequest(vreq)
+		err = v.Create(app.db, app.executor, app.Allocator())
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	}
+
+	app.xo.MockVolumeInfo = func(host string, volume string) (*executors.Volume, error) {
+		return mockVolumeInfoFromDb(app.db, volume)
+	}
+	app.xo.MockHealInfo = func(host string, volume string) (*executors.HealInfo, error) {
+		return mockHealStatusFromDb(app.db, volume)
+	}
+
+	var nodeId string
+	app.db.View(func(tx *bolt.Tx) error {
+		bl, err := BrickList(tx)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, len(bl) > 0)
+		b, err := NewBrickEntryFromId(tx, bl[0])
+		tests.Assert(t, err == nil)
+		nodeId = b.Info.NodeId
+		return nil
+	})
+	return nodeId
+}
+
+func TestRemoveNode(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	nodeId := sampleNodeWithBricks(t, app, 4)
+
+	err := RemoveNode(app.db, app.executor, app.Allocator(), nodeId, nil)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	app.db.View(func(tx *bolt.Tx) error {
+		node, err := NewNodeEntryFromId(tx, nodeId)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, node.State == api.EntryStateFailed, node.State)
+
+		p := node.Removal
+		tests.Assert(t, p != nil)
+		tests.Assert(t, p.State == api.NodeRemoveDone, p.State)
+		tests.Assert(t, p.Finished >= p.Started)
+		tests.Assert(t, len(p.Bricks) > 0)
+		for _, b := range p.Bricks {
+			tests.Assert(t, b.State == api.BrickMigrationDone, b)
+		}
+
+		for _, id := range node.Devices {
+			d, err := NewDeviceEntryFromId(tx, id)
+			tests.Assert(t, err == nil)
+			tests.Assert(t, d.State == api.EntryStateFailed, d.State)
+			tests.Assert(t, len(d.Bricks) == 0, d.Bricks)
+		}
+
+		// No brick is left on the node
+		bl, err := BrickList(tx)
+		tests.Assert(t, err == nil)
+		for _, id := range bl {
+			b, err := NewBrickEntryFromId(tx, id)
+			tests.Assert(t, err == nil)
+			tests.Assert(t, b.Info.NodeId != nodeId)
+		}
+		return nil
+	})
+}
+
+func TestRemoveNodeNoReplacement(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	// Every node already holds a brick of each volume
+	nodeId := sampleNodeWithBricks(t, app, 3)
+
+	err := RemoveNode(app.db, app.executor, app.Allocator(), nodeId, nil)
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	app.db.View(func(tx *bolt.Tx) error {
+		node, err := NewNodeEntryFromId(tx, nodeId)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, node.State == api.EntryStateOffline, node.State)
+
+		p := node.Removal
+		tests.Assert(t, p != nil)
+		tests.Assert(t, p.State == api.NodeRemoveFailed, p.State)
+		tests.Assert(t, p.Message != "")
+		failed := 0
+		for _, b := range p.Bricks {
+			tests.Assert(t, b.State != api.BrickMigrationDone, b)
+			if b.State == api.BrickMigrationFailed {
+				failed++
+			}
+		}
+		tests.Assert(t, failed == 1, "expected failed == 1, got:", failed)
+		return nil
+	})
+}
+
+func TestNodeRemoveHttp(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	c := client.NewClientNoAuth(ts.URL)
+	tests.Assert(t, c != nil)
+
+	nodeId := sampleNodeWithBricks(t, app, 4)
+
+	// Nothing to report before the node is removed
+	_, err := c.NodeRemoveStatus(nodeId)
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	p, err := c.NodeRemove(nodeId)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, p.NodeId == nodeId)
+	tests.Assert(t, p.State == api.NodeRemoveDone, p.State)
+	tests.Assert(t, len(p.Bricks) > 0)
+
+	p, err = c.NodeRemoveStatus(nodeId)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, p.State == api.NodeRemoveDone, p.State)
+
+	info, err := c.NodeInfo(nodeId)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, info.State == api.EntryStateFailed, info.State)
+
+	_, err = c.NodeRemove("12345")
+	tests.Assert(t, err != nil, "expected err != nil")
+}
@@ -0,0 +1,288 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/boltdb/bolt"
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/gorilla/context"
+	wdb "github.com/heketi/heketi/pkg/db"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/heketi/pkg/utils"
+	"github.com/lpabon/godbc"
+)
+
+const (
+	BOLTDB_BUCKET_OPERATION_HISTORY = "OPERATION_HISTORY"
+)
+
+var (
+	// Days completed operations are kept in the history
+	OperationHistoryDays = 30
+)
+
+// OperationHistoryEntry records an operation once it completed. The
+// entries are keyed by the time the operation finished so that they
+// are kept in that order.
+type OperationHistoryEntry struct {
+	Id    string
+	Type  string
+	Label string
+	// Issuer of the token of the request, if any
+	Requester string
+	// Seconds since the epoch
+	Started  int64
+	Finished int64
+	Changes  []api.OperationChangeInfo
+	Error    string
+	// Id of the output of the command the operation failed on, if kept
+	Output string
+	// Order of the entry among the entries of the history
+	Seq uint64
+}
+
+// historyKey returns the key of the entry of an operation that finished
+// at the given time, which sorts the keys in time order and the entries
+// that finished in the same second in the order they were saved
+func historyKey(finished int64, seq uint64) string {
+	return fmt.Sprintf("%016x-%016x", finished, seq)
+}
+
+func (h *OperationHistoryEntry) BucketName() string {
+	return BOLTDB_BUCKET_OPERATION_HISTORY
+}
+
+func (h *OperationHistoryEntry) Save(tx *bolt.Tx) error {
+	godbc.Require(tx != nil)
+	godbc.Require(h.Id != "")
+
+	if h.Seq == 0 {
+		b := tx.Bucket([]byte(h.BucketName()))
+		if b == nil {
+			return ErrDbAccess
+		}
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		h.Seq = seq
+	}
+	return EntrySave(tx, h, historyKey(h.Finished, h.Seq))
+}
+
+func (h *OperationHistoryEntry) Marshal() ([]byte, error) {
+	var buffer bytes.Buffer
+	enc := gob.NewEncoder(&buffer)
+	err := enc.Encode(*h)
+
+	return buffer.Bytes(), err
+}
+
+func (h *OperationHistoryEntry) Unmarshal(buffer []byte) error {
+	dec := gob.NewDecoder(bytes.NewReader(buffer))
+	err := dec.Decode(h)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// hasEntity returns true if the operation changed the entry with the id
+func (h *OperationHistoryEntry) hasEntity(id string) bool {
+	for _, c := range h.Changes {
+		if c.Id == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *OperationHistoryEntry) NewInfoResponse() *api.OperationHistoryInfo {
+	return &api.OperationHistoryInfo{
+		OperationInfo: api.OperationInfo{
+			Id:      h.Id,
+			Type:    h.Type,
+			Started: h.Started,
+			Changes: h.Changes,
+		},
+		Label:     h.Label,
+		Requester: h.Requester,
+		Finished:  h.Finished,
+		Duration:  h.Finished - h.Started,
+		Succeeded: h.Error == "",
+		Error:     h.Error,
+		Output:    h.Output,
+	}
+}
+
+type jwtTokenKey struct{}
+
+// requestToken returns the token of the request, or nil when the
+// request was not authenticated
+func requestToken(r *http.Request) *jwt.Token {
+	if token, ok := r.Context().Value(jwtTokenKey{}).(*jwt.Token); ok {
+		return token
+	}
+	token, _ := context.Get(r, "jwt").(*jwt.Token)
+	return token
+}
+
+// requestIssuer returns the issuer of the token of the request, or an
+// empty string when the request was not authenticated
+func requestIssuer(r *http.Request) string {
+	token := requestToken(r)
+	if token == nil {
+		return ""
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return ""
+	}
+	issuer, _ := claims["iss"].(string)
+	return issuer
+}
+
+// requestSubject returns the subject of the token of the request, the
+// user the token was issued to, or an empty string if it has none
+func requestSubject(r *http.Request) string {
+	token := requestToken(r)
+	if token == nil {
+		return ""
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return ""
+	}
+	subject, _ := claims["sub"].(string)
+	return subject
+}
+
+// requestActor returns who made the request, the subject of its token
+// or else the issuer
+func requestActor(r *http.Request) string {
+	if subject := requestSubject(r); subject != "" {
+		return subject
+	}
+	return requestIssuer(r)
+}
+
+// newOperationHistoryEntry starts the history entry of the operation.
+// The pending operation entry of the operation, if any, gives the id,
+// the type and the changes of the operation.
+func newOperationHistoryEntry(op Operation, requester string) *OperationHistoryEntry {
+	h := &OperationHistoryEntry{
+		Label:     op.Label(),
+		Requester: requester,
+		Started:   time.Now().Unix(),
+		Changes:   []api.OperationChangeInfo{},
+	}
+	if p, ok := op.(interface {
+		pendingOperation() *PendingOperationEntry
+	}); ok && p.pendingOperation() != nil {
+		info := p.pendingOperation().NewInfoResponse()
+		h.Id = info.Id
+		h.Type = info.Type
+		h.Changes = info.Changes
+	} else {
+		h.Id = utils.GenUUID()
+		h.Type = OperationUnknown.Name()
+	}
+	return h
+}
+
+// recordOperationHistory saves the entry of the completed operation
+// and removes the entries older than the retention period
+func recordOperationHistory(db wdb.DB, h *OperationHistoryEntry, opErr error) {
+	h.Finished = time.Now().Unix()
+	if opErr != nil {
+		h.Error = opErr.Error()
+	}
+	if cerr, ok := opErr.(*utils.CommandError); ok {
+		h.Output = cerr.OutputId
+	}
+
+	cutoff := []byte(historyKey(h.Finished-int64(OperationHistoryDays)*24*3600, 0))
+	err := db.Update(func(tx *bolt.Tx) error {
+		if err := h.Save(tx); err != nil {
+			return err
+		}
+
+		b := tx.Bucket([]byte(BOLTDB_BUCKET_OPERATION_HISTORY))
+		c := b.Cursor()
+		for k, _ := c.First(); k != nil && bytes.Compare(k, cutoff) < 0; k, _ = c.First() {
+			if err := c.Delete(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logger.LogError("Unable to record history of operation %v: %v", h.Id, err)
+	}
+}
+
+// OperationHistoryFilter selects the operations of the history. Empty
+// fields select every operation.
+type OperationHistoryFilter struct {
+	// Id of an entity changed by the operation, such as a volume
+	Entity string
+	Type   string
+	// Seconds since the epoch the operation finished in, inclusive
+	Since int64
+	Until int64
+}
+
+// OperationHistory returns the operations of the history selected by
+// the filter, oldest first
+func OperationHistory(db wdb.RODB,
+	f *OperationHistoryFilter) ([]*OperationHistoryEntry, error) {
+
+	entries := []*OperationHistoryEntry{}
+	err := db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(BOLTDB_BUCKET_OPERATION_HISTORY))
+		if b == nil {
+			return ErrDbAccess
+		}
+
+		var end []byte
+		if f.Until != 0 {
+			end = []byte(historyKey(f.Until+1, 0))
+		}
+		c := b.Cursor()
+		for k, v := c.Seek([]byte(historyKey(f.Since, 0))); k != nil; k, v = c.Next() {
+			if end != nil && bytes.Compare(k, end) >= 0 {
+				break
+			}
+			h := &OperationHistoryEntry{}
+			if err := h.Unmarshal(v); err != nil {
+				return err
+			}
+			if f.Type != "" && h.Type != f.Type {
+				continue
+			}
+			if f.Entity != "" && !h.hasEntity(f.Entity) {
+				continue
+			}
+			entries = append(entries, h)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
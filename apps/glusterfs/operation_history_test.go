@@ -0,0 +1,164 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/gorilla/mux"
+	client "github.com/heketi/heketi/client/api/go-client"
+	"github.com/heketi/heketi/executors"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/tests"
+)
+
+func TestOperationHistory(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	c := client.NewClientNoAuth(ts.URL)
+	tests.Assert(t, c != nil)
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		3,    // nodes_per_cluster
+		2,    // devices_per_node,
+		2*TB, // disksize
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	start := time.Now().Unix()
+
+	req := &api.VolumeCreateRequest{}
+	req.Size = 10
+	req.Durability.Type = api.DurabilityReplicate
+	req.Durability.Replicate.Replica = 3
+	vol, err := c.VolumeCreate(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	vol2, err := c.VolumeCreate(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	_, err = c.VolumeExpand(vol.Id, &api.VolumeExpandRequest{Size: 10})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	app.xo.MockVolumeExpand = func(host string,
+		volume *executors.VolumeRequest) (*executors.Volume, error) {
+		return nil, fmt.Errorf("expand failed")
+	}
+	_, err = c.VolumeExpand(vol.Id, &api.VolumeExpandRequest{Size: 10})
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	history, err := c.OperationHistory("", "", 0, 0)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(history.Operations) == 4, history.Operations)
+	for i, op := range history.Operations {
+		tests.Assert(t, op.Finished >= start, op)
+		tests.Assert(t, op.Duration == op.Finished-op.Started, op)
+		if i > 0 {
+			tests.Assert(t, op.Finished >= history.Operations[i-1].Finished)
+		}
+	}
+	tests.Assert(t, history.Operations[0].Type == "create-volume")
+	tests.Assert(t, history.Operations[0].Label == "Create Volume")
+	tests.Assert(t, history.Operations[0].Succeeded)
+
+	// By volume
+	history, err = c.OperationHistory(vol.Id, "", 0, 0)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(history.Operations) == 3, history.Operations)
+
+	history, err = c.OperationHistory(vol2.Id, "", 0, 0)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(history.Operations) == 1, history.Operations)
+
+	// By type
+	history, err = c.OperationHistory(vol.Id, "expand-volume", 0, 0)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(history.Operations) == 2, history.Operations)
+	tests.Assert(t, history.Operations[0].Succeeded)
+	tests.Assert(t, !history.Operations[1].Succeeded)
+	tests.Assert(t, history.Operations[1].Error != "")
+
+	// By time range
+	history, err = c.OperationHistory("", "", start-3600, start-1)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(history.Operations) == 0, history.Operations)
+
+	history, err = c.OperationHistory("", "", start, time.Now().Unix())
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(history.Operations) == 4, history.Operations)
+
+	r, err := http.Get(ts.URL + "/operations/history?since=yesterday")
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusBadRequest, r.StatusCode)
+}
+
+func TestOperationHistoryRetention(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	defer func(days int) {
+		OperationHistoryDays = days
+	}(OperationHistoryDays)
+	OperationHistoryDays = 2
+
+	now := time.Now().Unix()
+	err := app.db.Update(func(tx *bolt.Tx) error {
+		for _, age := range []int64{3, 1} {
+			h := &OperationHistoryEntry{
+				Id:       fmt.Sprintf("op%v", age),
+				Type:     "create-volume",
+				Started:  now - age*24*3600,
+				Finished: now - age*24*3600,
+			}
+			if err := h.Save(tx); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	entries, err := OperationHistory(app.db, &OperationHistoryFilter{})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(entries) == 2, entries)
+
+	// Recording an operation removes the entries past the retention
+	recordOperationHistory(app.db, &OperationHistoryEntry{
+		Id:      "op0",
+		Type:    "delete-volume",
+		Started: now,
+	}, fmt.Errorf("failed"))
+
+	entries, err = OperationHistory(app.db, &OperationHistoryFilter{})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(entries) == 2, entries)
+	tests.Assert(t, entries[0].Id == "op1", entries[0])
+	tests.Assert(t, entries[1].Id == "op0", entries[1])
+	tests.Assert(t, entries[1].Error == "failed", entries[1])
+}
@@ -15,6 +15,8 @@ import (
 
 	"github.com/heketi/heketi/executors"
 	wdb "github.com/heketi/heketi/pkg/db"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/heketi/pkg/utils"
 
 	"github.com/boltdb/bolt"
 )
@@ -47,6 +49,9 @@ type Operation interface {
 type OperationManager struct {
 	db wdb.DB
 	op *PendingOperationEntry
+
+	// Id of the request the operation is run for, if any
+	requestId string
 }
 
 // Id returns the id of this operation's pending operation entry.
@@ -54,11 +59,30 @@ func (om *OperationManager) Id() string {
 	return om.op.Id
 }
 
+// pendingOperation returns this operation's pending operation entry.
+func (om *OperationManager) pendingOperation() *PendingOperationEntry {
+	return om.op
+}
+
+// setRequestId sets the id of the request the operation is run for
+func (om *OperationManager) setRequestId(id string) {
+	om.requestId = id
+}
+
+// log returns the logger tagging the messages of the operation with
+// the id of the request it is run for
+func (om *OperationManager) log() *utils.Logger {
+	return logger.WithRequestId(om.requestId)
+}
+
 // VolumeCreateOperation implements the operation functions used to
 // create a new volume.
 type VolumeCreateOperation struct {
 	OperationManager
 	vol *VolumeEntry
+
+	// Orders the clusters when the volume does not list clusters
+	selector *clusterSelector
 }
 
 // NewVolumeCreateOperation returns a new VolumeCreateOperation populated
@@ -84,12 +108,40 @@ func (vc *VolumeCreateOperation) ResourceUrl() string {
 	return fmt.Sprintf("/volumes/%v", vc.vol.Info.Id)
 }
 
+// placement returns the cluster and the nodes of the new bricks
+func (vc *VolumeCreateOperation) placement() ([]string, []string, error) {
+	clusters := []string{vc.vol.Info.Cluster}
+	brick_entries, err := bricksFromOp(vc.db, vc.op, vc.vol.Info.Gid)
+	if err != nil {
+		return clusters, nil, err
+	}
+	nodes := []string{}
+	seen := map[string]bool{}
+	for _, brick := range brick_entries {
+		if !seen[brick.Info.NodeId] {
+			seen[brick.Info.NodeId] = true
+			nodes = append(nodes, brick.Info.NodeId)
+		}
+	}
+	return clusters, nodes, nil
+}
+
 // Build allocates and saves new volume and brick entries (tagged as pending)
 // in the db.
 func (vc *VolumeCreateOperation) Build(allocator Allocator) error {
 	return vc.db.Update(func(tx *bolt.Tx) error {
 		txdb := wdb.WrapTx(tx)
-		brick_entries, err := vc.vol.createVolumeComponents(txdb, allocator)
+		// The volume of a tenant goes on a cluster where its limits
+		// leave room for it
+		if vc.vol.Info.Tenant != "" {
+			clusters, err := tenantClustersWithRoom(tx, vc.vol.Info.Tenant,
+				vc.vol.Info.Clusters, vc.vol.sizeMiB(), 1, 0)
+			if err != nil {
+				return err
+			}
+			vc.vol.Info.Clusters = clusters
+		}
+		brick_entries, err := vc.vol.createVolumeComponents(txdb, allocator, vc.selector)
 		if err != nil {
 			return err
 		}
@@ -99,6 +151,10 @@ func (vc *VolumeCreateOperation) Build(allocator Allocator) error {
 				return e
 			}
 		}
+		vc.vol.Warnings, err = volumeCreateWarnings(tx, vc.vol, brick_entries)
+		if err != nil {
+			return err
+		}
 		vc.op.RecordAddVolume(vc.vol)
 		if e := vc.vol.Save(tx); e != nil {
 			return e
@@ -114,12 +170,12 @@ func (vc *VolumeCreateOperation) Build(allocator Allocator) error {
 func (vc *VolumeCreateOperation) Exec(executor executors.Executor) error {
 	brick_entries, err := bricksFromOp(vc.db, vc.op, vc.vol.Info.Gid)
 	if err != nil {
-		logger.LogError("Failed to get bricks from op: %v", err)
+		vc.log().LogError("Failed to get bricks from op: %v", err)
 		return err
 	}
 	err = vc.vol.createVolumeExec(vc.db, executor, brick_entries)
 	if err != nil {
-		logger.LogError("Error executing create volume: %v", err)
+		vc.log().LogError("Error executing create volume: %v", err)
 	}
 	return err
 }
@@ -129,7 +185,7 @@ func (vc *VolumeCreateOperation) Finalize() error {
 	return vc.db.Update(func(tx *bolt.Tx) error {
 		brick_entries, err := bricksFromOp(wdb.WrapTx(tx), vc.op, vc.vol.Info.Gid)
 		if err != nil {
-			logger.LogError("Failed to get bricks from op: %v", err)
+			vc.log().LogError("Failed to get bricks from op: %v", err)
 			return err
 		}
 		for _, brick := range brick_entries {
@@ -155,12 +211,12 @@ func (vc *VolumeCreateOperation) Rollback(executor executors.Executor) error {
 	// TODO make this into one transaction too
 	brick_entries, err := bricksFromOp(vc.db, vc.op, vc.vol.Info.Gid)
 	if err != nil {
-		logger.LogError("Failed to get bricks from op: %v", err)
+		vc.log().LogError("Failed to get bricks from op: %v", err)
 		return err
 	}
 	err = vc.vol.cleanupCreateVolume(vc.db, executor, brick_entries)
 	if err != nil {
-		logger.LogError("Error on create volume rollback: %v", err)
+		vc.log().LogError("Error on create volume rollback: %v", err)
 		return err
 	}
 	err = vc.db.Update(func(tx *bolt.Tx) error {
@@ -208,6 +264,29 @@ func (ve *VolumeExpandOperation) ResourceUrl() string {
 func (ve *VolumeExpandOperation) Build(allocator Allocator) error {
 	return ve.db.Update(func(tx *bolt.Tx) error {
 		txdb := wdb.WrapTx(tx)
+		if p, err := PendingOperationsOnVolume(txdb, ve.vol.Info.Id); err != nil {
+			return err
+		} else if p {
+			ve.log().LogError("Found operations still pending on volume."+
+				" Can not expand volume %v at this time.",
+				ve.vol.Info.Id)
+			return ErrConflict
+		}
+		if v, err := NewVolumeEntryFromId(tx, ve.vol.Info.Id); err != nil {
+			return err
+		} else if v.PendingDeleteSince != 0 {
+			ve.log().LogError("Volume %v waits for the confirmation of its delete."+
+				" Can not expand it at this time.",
+				v.Info.Id)
+			return ErrConflict
+		}
+		if ve.vol.Info.Tenant != "" {
+			_, err := tenantClustersWithRoom(tx, ve.vol.Info.Tenant,
+				[]string{ve.vol.Info.Cluster}, ve.ExpandSize*1024, 0, 0)
+			if err != nil {
+				return err
+			}
+		}
 		brick_entries, err := ve.vol.expandVolumeComponents(
 			txdb, allocator, ve.ExpandSize, false)
 		if err != nil {
@@ -231,12 +310,12 @@ func (ve *VolumeExpandOperation) Build(allocator Allocator) error {
 func (ve *VolumeExpandOperation) Exec(executor executors.Executor) error {
 	brick_entries, err := bricksFromOp(ve.db, ve.op, ve.vol.Info.Gid)
 	if err != nil {
-		logger.LogError("Failed to get bricks from op: %v", err)
+		ve.log().LogError("Failed to get bricks from op: %v", err)
 		return err
 	}
 	err = ve.vol.expandVolumeExec(ve.db, executor, brick_entries)
 	if err != nil {
-		logger.LogError("Error executing expand volume: %v", err)
+		ve.log().LogError("Error executing expand volume: %v", err)
 	}
 	return err
 }
@@ -247,13 +326,13 @@ func (ve *VolumeExpandOperation) Rollback(executor executors.Executor) error {
 	// TODO make this into one transaction too
 	brick_entries, err := bricksFromOp(ve.db, ve.op, ve.vol.Info.Gid)
 	if err != nil {
-		logger.LogError("Failed to get bricks from op: %v", err)
+		ve.log().LogError("Failed to get bricks from op: %v", err)
 		return err
 	}
 	err = ve.vol.cleanupExpandVolume(
 		ve.db, executor, brick_entries, ve.vol.Info.Size)
 	if err != nil {
-		logger.LogError("Error on create volume rollback: %v", err)
+		ve.log().LogError("Error on create volume rollback: %v", err)
 		return err
 	}
 	err = ve.db.Update(func(tx *bolt.Tx) error {
@@ -268,12 +347,12 @@ func (ve *VolumeExpandOperation) Finalize() error {
 	return ve.db.Update(func(tx *bolt.Tx) error {
 		brick_entries, err := bricksFromOp(wdb.WrapTx(tx), ve.op, ve.vol.Info.Gid)
 		if err != nil {
-			logger.LogError("Failed to get bricks from op: %v", err)
+			ve.log().LogError("Failed to get bricks from op: %v", err)
 			return err
 		}
 		sizeDelta, err := expandSizeFromOp(ve.op)
 		if err != nil {
-			logger.LogError("Failed to get expansion size from op: %v", err)
+			ve.log().LogError("Failed to get expansion size from op: %v", err)
 			return err
 		}
 
@@ -283,7 +362,7 @@ func (ve *VolumeExpandOperation) Finalize() error {
 				return e
 			}
 		}
-		ve.vol.Info.Size += sizeDelta
+		ve.vol.addSize(sizeDelta)
 		ve.op.FinalizeVolume(ve.vol)
 		if e := ve.vol.Save(tx); e != nil {
 			return e
@@ -326,6 +405,42 @@ func (vdel *VolumeDeleteOperation) ResourceUrl() string {
 func (vdel *VolumeDeleteOperation) Build(allocator Allocator) error {
 	return vdel.db.Update(func(tx *bolt.Tx) error {
 		txdb := wdb.WrapTx(tx)
+		if p, err := PendingOperationsOnVolume(txdb, vdel.vol.Info.Id); err != nil {
+			return err
+		} else if p {
+			vdel.log().LogError("Found operations still pending on volume."+
+				" Can not delete volume %v at this time.",
+				vdel.vol.Info.Id)
+			return ErrConflict
+		}
+		if snapshots, err := VolumeSnapshots(tx, vdel.vol.Info.Id); err != nil {
+			return err
+		} else if len(snapshots) != 0 {
+			vdel.log().LogError("Found snapshots of volume."+
+				" Can not delete volume %v at this time.",
+				vdel.vol.Info.Id)
+			return ErrConflict
+		}
+		if replications, err := VolumeReplications(tx, vdel.vol.Info.Id); err != nil {
+			return err
+		} else if len(replications) != 0 {
+			vdel.log().LogError("Found replication of volume."+
+				" Can not delete volume %v at this time.",
+				vdel.vol.Info.Id)
+			return ErrConflict
+		}
+		if vdel.vol.Info.Block {
+			// a block volume may have been placed on the volume since
+			// it was loaded
+			if inUse, err := blockHostingVolumeInUse(tx, vdel.vol.Info.Id); err != nil {
+				return err
+			} else if inUse {
+				vdel.log().LogError("Found block volumes on volume."+
+					" Can not delete volume %v at this time.",
+					vdel.vol.Info.Id)
+				return ErrConflict
+			}
+		}
 		brick_entries, err := vdel.vol.deleteVolumeComponents(txdb)
 		if err != nil {
 			return err
@@ -336,7 +451,11 @@ func (vdel *VolumeDeleteOperation) Build(allocator Allocator) error {
 				return e
 			}
 		}
+		// the volume is marked as being deleted
 		vdel.op.RecordDeleteVolume(vdel.vol)
+		if e := vdel.vol.Save(tx); e != nil {
+			return e
+		}
 		if e := vdel.op.Save(tx); e != nil {
 			return e
 		}
@@ -348,7 +467,7 @@ func (vdel *VolumeDeleteOperation) Build(allocator Allocator) error {
 func (vdel *VolumeDeleteOperation) Exec(executor executors.Executor) error {
 	brick_entries, err := bricksFromOp(vdel.db, vdel.op, vdel.vol.Info.Gid)
 	if err != nil {
-		logger.LogError("Failed to get bricks from op: %v", err)
+		vdel.log().LogError("Failed to get bricks from op: %v", err)
 		return err
 	}
 	sshhost, err := vdel.vol.manageHostFromBricks(vdel.db, brick_entries)
@@ -357,7 +476,7 @@ func (vdel *VolumeDeleteOperation) Exec(executor executors.Executor) error {
 	}
 	err = vdel.vol.deleteVolumeExec(vdel.db, executor, brick_entries, sshhost)
 	if err != nil {
-		logger.LogError("Error executing delete volume: %v", err)
+		vdel.log().LogError("Error executing delete volume: %v", err)
 	}
 	return err
 }
@@ -370,7 +489,7 @@ func (vdel *VolumeDeleteOperation) Rollback(executor executors.Executor) error {
 		txdb := wdb.WrapTx(tx)
 		brick_entries, err := bricksFromOp(txdb, vdel.op, vdel.vol.Info.Gid)
 		if err != nil {
-			logger.LogError("Failed to get bricks from op: %v", err)
+			vdel.log().LogError("Failed to get bricks from op: %v", err)
 			return err
 		}
 
@@ -397,7 +516,7 @@ func (vdel *VolumeDeleteOperation) Finalize() error {
 		txdb := wdb.WrapTx(tx)
 		brick_entries, err := bricksFromOp(txdb, vdel.op, vdel.vol.Info.Gid)
 		if err != nil {
-			logger.LogError("Failed to get bricks from op: %v", err)
+			vdel.log().LogError("Failed to get bricks from op: %v", err)
 			return err
 		}
 		if err := vdel.vol.saveDeleteVolume(txdb, brick_entries); err != nil {
@@ -409,6 +528,226 @@ func (vdel *VolumeDeleteOperation) Finalize() error {
 	})
 }
 
+// VolumeRestoreOperation implements the operation functions used to
+// restore an existing volume, in place, from one of its snapshots.
+type VolumeRestoreOperation struct {
+	OperationManager
+	vol *VolumeEntry
+
+	// snapshot entry the volume is restored from, if managed by heketi
+	snap *SnapshotEntry
+
+	// modification values
+	Snapshot string
+	Force    bool
+}
+
+// NewVolumeRestoreOperation returns a new VolumeRestoreOperation populated
+// with the given volume entry, db connection and snapshot name and
+// allocates a new pending operation entry.
+func NewVolumeRestoreOperation(
+	vol *VolumeEntry, db wdb.DB, snapshot string, force bool) *VolumeRestoreOperation {
+
+	return &VolumeRestoreOperation{
+		OperationManager: OperationManager{
+			db: db,
+			op: NewPendingOperationEntry(NEW_ID),
+		},
+		vol:      vol,
+		Snapshot: snapshot,
+		Force:    force,
+	}
+}
+
+// NewSnapshotRestoreOperation returns a new VolumeRestoreOperation
+// restoring the volume from a snapshot entry, the entry being removed
+// once it is restored.
+func NewSnapshotRestoreOperation(
+	vol *VolumeEntry, snap *SnapshotEntry, db wdb.DB, force bool) *VolumeRestoreOperation {
+
+	vr := NewVolumeRestoreOperation(vol, db, snap.Info.Name, force)
+	vr.snap = snap
+	return vr
+}
+
+func (vr *VolumeRestoreOperation) Label() string {
+	return "Restore Volume"
+}
+
+func (vr *VolumeRestoreOperation) ResourceUrl() string {
+	return fmt.Sprintf("/volumes/%v", vr.vol.Info.Id)
+}
+
+// Build fences the volume from other operations by saving the pending
+// restore operation in the db.
+func (vr *VolumeRestoreOperation) Build(allocator Allocator) error {
+	return vr.db.Update(func(tx *bolt.Tx) error {
+		txdb := wdb.WrapTx(tx)
+		if p, err := PendingOperationsOnVolume(txdb, vr.vol.Info.Id); err != nil {
+			return err
+		} else if p {
+			vr.log().LogError("Found operations still pending on volume."+
+				" Can not restore volume %v at this time.",
+				vr.vol.Info.Id)
+			return ErrConflict
+		}
+		vr.op.RecordRestoreVolume(vr.vol, vr.Snapshot)
+		if vr.snap != nil {
+			snap, err := NewSnapshotEntryFromId(tx, vr.snap.Info.Id)
+			if err != nil {
+				return err
+			}
+			if !snap.Visible() || snap.Info.OriginVolume != vr.vol.Info.Id {
+				vr.log().LogError("Snapshot %v can not be restored on volume %v"+
+					" at this time.", snap.Info.Id, vr.vol.Info.Id)
+				return ErrConflict
+			}
+			vr.op.RecordRestoreSnapshot(snap)
+			if e := snap.Save(tx); e != nil {
+				return e
+			}
+			vr.snap = snap
+		}
+		if e := vr.op.Save(tx); e != nil {
+			return e
+		}
+		return nil
+	})
+}
+
+// Exec stops the volume, restores the snapshot, restarts the volume and
+// checks that all the bricks came back online. Each step is recorded in
+// the pending operation as it completes so that calling Exec again resumes
+// the restore rather than repeating it. The bricks of the volume being
+// replaced by the bricks of the snapshot, their new paths are saved in
+// the brick entries.
+func (vr *VolumeRestoreOperation) Exec(executor executors.Executor) error {
+	snapshot, stage, err := restoreFromOp(vr.op)
+	if err != nil {
+		return err
+	}
+	brick_entries, err := vr.vol.deleteVolumeComponents(vr.db)
+	if err != nil {
+		return err
+	}
+	sshhost, err := vr.vol.manageHostFromBricks(vr.db, brick_entries)
+	if err != nil {
+		return err
+	}
+
+	if stage == RestoreStageCheckClients || stage == RestoreStageStopVolume {
+		order, err := vr.vol.glusterBrickOrder(vr.db, executor, sshhost)
+		if err != nil {
+			vr.log().Warning("Paths of the bricks of volume %v will not be"+
+				" updated after the restore: %v", vr.vol.Info.Name, err)
+			order = nil
+		}
+		err = vr.db.Update(func(tx *bolt.Tx) error {
+			vr.op.RecordRestoreBricks(order)
+			return vr.op.Save(tx)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for stage != RestoreStageDone {
+		vr.log().Info("Restore volume %v from snapshot %v: %v",
+			vr.vol.Info.Name, snapshot, stage)
+		stage, err = vr.vol.restoreVolumeStep(
+			executor, sshhost, snapshot, vr.Force, stage)
+		if err != nil {
+			vr.log().LogError("Error executing restore volume: %v", err)
+			return err
+		}
+		err = vr.db.Update(func(tx *bolt.Tx) error {
+			vr.op.RecordRestoreStage(stage)
+			return vr.op.Save(tx)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if order := restoreBricksFromOp(vr.op); len(order) != 0 {
+		return vr.vol.updateRestoredBrickPaths(vr.db, executor, sshhost, order)
+	}
+	return nil
+}
+
+// Rollback brings the volume back online if it was stopped and removes
+// the pending operation. A snapshot that has already been restored can
+// not be undone.
+func (vr *VolumeRestoreOperation) Rollback(executor executors.Executor) error {
+	_, stage, err := restoreFromOp(vr.op)
+	if err != nil {
+		return err
+	}
+	// gluster removed the snapshot if it was restored
+	restored := stage != RestoreStageCheckClients &&
+		stage != RestoreStageStopVolume &&
+		stage != RestoreStageRestore
+	switch stage {
+	case RestoreStageRestore, RestoreStageStartVolume:
+		brick_entries, err := vr.vol.deleteVolumeComponents(vr.db)
+		if err != nil {
+			return err
+		}
+		sshhost, err := vr.vol.manageHostFromBricks(vr.db, brick_entries)
+		if err != nil {
+			return err
+		}
+		if err := executor.VolumeStart(sshhost, vr.vol.Info.Name); err != nil {
+			return err
+		}
+	}
+	return vr.db.Update(func(tx *bolt.Tx) error {
+		if err := vr.finalizeSnapshots(tx, restored); err != nil {
+			return err
+		}
+		return vr.op.Delete(tx)
+	})
+}
+
+// Finalize removes the pending operation, lifting the fence on the volume,
+// and the entry of the restored snapshot.
+func (vr *VolumeRestoreOperation) Finalize() error {
+	return vr.db.Update(func(tx *bolt.Tx) error {
+		if err := vr.finalizeSnapshots(tx, true); err != nil {
+			return err
+		}
+		return vr.op.Delete(tx)
+	})
+}
+
+// finalizeSnapshots removes the entry of the snapshot the volume was
+// restored from, or makes it visible again if it was not restored.
+func (vr *VolumeRestoreOperation) finalizeSnapshots(tx *bolt.Tx,
+	restored bool) error {
+
+	for _, a := range vr.op.Actions {
+		if a.Change != OpDeleteSnapshot {
+			continue
+		}
+		snap, err := NewSnapshotEntryFromId(tx, a.Id)
+		if err == ErrNotFound {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if restored {
+			err = snap.Delete(tx)
+		} else {
+			vr.op.FinalizeSnapshot(snap)
+			err = snap.Save(tx)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // BlockVolumeCreateOperation  implements the operation functions used to
 // create a new volume.
 type BlockVolumeCreateOperation struct {
@@ -445,19 +784,32 @@ func (bvc *BlockVolumeCreateOperation) ResourceUrl() string {
 func (bvc *BlockVolumeCreateOperation) Build(allocator Allocator) error {
 	return bvc.db.Update(func(tx *bolt.Tx) error {
 		txdb := wdb.WrapTx(tx)
+		if bvc.bvol.Info.Tenant != "" {
+			clusters, err := tenantClustersWithRoom(tx, bvc.bvol.Info.Tenant,
+				bvc.bvol.Info.Clusters, bvc.bvol.sizeMiB(), 0, 1)
+			if err != nil {
+				return err
+			}
+			bvc.bvol.Info.Clusters = clusters
+		}
 		clusters, volumes, err := bvc.bvol.eligibleClustersAndVolumes(txdb)
 		if err != nil {
 			return err
 		}
 
 		if len(volumes) > 0 {
-			bvc.bvol.Info.BlockHostingVolume = volumes[0]
+			bhvol, err := NewVolumeEntryFromId(tx, volumes[0])
+			if err != nil {
+				return err
+			}
+			bvc.bvol.Info.BlockHostingVolume = bhvol.Info.Id
+			bvc.bvol.Info.Cluster = bhvol.Info.Cluster
 		} else {
 			vol, err := NewVolumeEntryForBlockHosting(clusters)
 			if err != nil {
 				return err
 			}
-			brick_entries, err := vol.createVolumeComponents(txdb, allocator)
+			brick_entries, err := vol.createVolumeComponents(txdb, allocator, nil)
 			if err != nil {
 				return err
 			}
@@ -474,6 +826,7 @@ func (bvc *BlockVolumeCreateOperation) Build(allocator Allocator) error {
 				return e
 			}
 			bvc.bvol.Info.BlockHostingVolume = vol.Info.Id
+			bvc.bvol.Info.Cluster = vol.Info.Cluster
 		}
 
 		// we've figured out what block-volume, hosting volume, and bricks we
@@ -498,7 +851,7 @@ func (bvc *BlockVolumeCreateOperation) volAndBricks(db wdb.RODB) (
 	vol = nil
 	volume_entries, err := volumesFromOp(db, bvc.op)
 	if err != nil {
-		logger.LogError("Failed to get volumes from op: %v", err)
+		bvc.log().LogError("Failed to get volumes from op: %v", err)
 		return
 	}
 	// try to get gid now even though we haven't done any sanity checks
@@ -509,21 +862,21 @@ func (bvc *BlockVolumeCreateOperation) volAndBricks(db wdb.RODB) (
 	}
 	brick_entries, err = bricksFromOp(db, bvc.op, brickGid)
 	if err != nil {
-		logger.LogError("Failed to get bricks from op: %v", err)
+		bvc.log().LogError("Failed to get bricks from op: %v", err)
 		return
 	}
 
 	if len(volume_entries) > 1 {
-		err = logger.LogError("Unexpected number of new volume entries (%v)",
+		err = bvc.log().LogError("Unexpected number of new volume entries (%v)",
 			len(volume_entries))
 		return
 	}
 	if len(volume_entries) > 0 && len(brick_entries) == 0 {
-		err = logger.LogError("Cannot create a new block hosting volume without bricks")
+		err = bvc.log().LogError("Cannot create a new block hosting volume without bricks")
 		return
 	}
 	if len(volume_entries) == 0 && len(brick_entries) > 0 {
-		err = logger.LogError("Cannot create bricks without a hosting volume")
+		err = bvc.log().LogError("Cannot create bricks without a hosting volume")
 		return
 	}
 
@@ -543,7 +896,7 @@ func (bvc *BlockVolumeCreateOperation) Exec(executor executors.Executor) error {
 	if vol != nil {
 		err = vol.createVolumeExec(bvc.db, executor, brick_entries)
 		if err != nil {
-			logger.LogError("Error executing create volume: %v", err)
+			bvc.log().LogError("Error executing create volume: %v", err)
 			return err
 		}
 	}
@@ -553,7 +906,7 @@ func (bvc *BlockVolumeCreateOperation) Exec(executor executors.Executor) error {
 	// resumeable if we ever add resume support to normal volume create.
 	err = bvc.bvol.createBlockVolume(bvc.db, executor, bvc.bvol.Info.BlockHostingVolume)
 	if err != nil {
-		logger.LogError("Error executing create block volume: %v", err)
+		bvc.log().LogError("Error executing create block volume: %v", err)
 	}
 	return err
 }
@@ -612,7 +965,7 @@ func (bvc *BlockVolumeCreateOperation) Rollback(executor executors.Executor) err
 	if vol != nil {
 		err = vol.cleanupCreateVolume(bvc.db, executor, brick_entries)
 		if err != nil {
-			logger.LogError("Error on create volume rollback: %v", err)
+			bvc.log().LogError("Error on create volume rollback: %v", err)
 			return err
 		}
 	}
@@ -653,7 +1006,23 @@ func (vdel *BlockVolumeDeleteOperation) ResourceUrl() string {
 // marks the db entries as such.
 func (vdel *BlockVolumeDeleteOperation) Build(allocator Allocator) error {
 	return vdel.db.Update(func(tx *bolt.Tx) error {
+		// the block volume may have been deleted by another request
+		// since it was loaded
+		bvol, err := NewBlockVolumeEntryFromId(tx, vdel.bvol.Info.Id)
+		if err != nil {
+			return err
+		}
+		if bvol.Pending.Id != "" {
+			vdel.log().LogError("Found operations still pending on block volume."+
+				" Can not delete block volume %v at this time.",
+				vdel.bvol.Info.Id)
+			return ErrConflict
+		}
+		vdel.bvol = bvol
 		vdel.op.RecordDeleteBlockVolume(vdel.bvol)
+		if e := vdel.bvol.Save(tx); e != nil {
+			return e
+		}
 		if e := vdel.op.Save(tx); e != nil {
 			return e
 		}
@@ -693,7 +1062,7 @@ func (vdel *BlockVolumeDeleteOperation) Finalize() error {
 	return vdel.db.Update(func(tx *bolt.Tx) error {
 		txdb := wdb.WrapTx(tx)
 		if e := vdel.bvol.removeComponents(txdb); e != nil {
-			logger.LogError("Failed to remove block volume from db")
+			vdel.log().LogError("Failed to remove block volume from db")
 			return e
 		}
 
@@ -702,111 +1071,375 @@ func (vdel *BlockVolumeDeleteOperation) Finalize() error {
 	})
 }
 
-// DeviceRemoveOperation is a phony-ish operation that exists
-// primarily to a) know that set state was being performed
-// and b) to serve as a starting point for a more proper
-// operation in the future.
-type DeviceRemoveOperation struct {
+// BlockVolumeExpandOperation implements the operation functions used to
+// grow an existing block volume.
+type BlockVolumeExpandOperation struct {
 	OperationManager
-	DeviceId  string
-	allocator Allocator
+	bvol *BlockVolumeEntry
+
+	// modification values
+	ExpandSize int
 }
 
-// Note: passing this allocator here a big hack, but its a temporary
-// workaround for how brick relocation currently works
-func NewDeviceRemoveOperation(
-	deviceId string, allocator Allocator, db wdb.DB) *DeviceRemoveOperation {
+// NewBlockVolumeExpandOperation returns a new BlockVolumeExpandOperation
+// populated with the given block volume entry, db connection and size
+// (in GB) that the block volume is to be expanded by.
+func NewBlockVolumeExpandOperation(
+	bvol *BlockVolumeEntry, db wdb.DB, sizeGB int) *BlockVolumeExpandOperation {
 
-	return &DeviceRemoveOperation{
+	return &BlockVolumeExpandOperation{
 		OperationManager: OperationManager{
 			db: db,
 			op: NewPendingOperationEntry(NEW_ID),
 		},
-		DeviceId:  deviceId,
-		allocator: allocator,
+		bvol:       bvol,
+		ExpandSize: sizeGB,
 	}
 }
 
-func (dro *DeviceRemoveOperation) Label() string {
-	return "Remove Device"
+func (bve *BlockVolumeExpandOperation) Label() string {
+	return "Expand Block Volume"
 }
 
-func (dro *DeviceRemoveOperation) ResourceUrl() string {
-	return ""
+func (bve *BlockVolumeExpandOperation) ResourceUrl() string {
+	return fmt.Sprintf("/blockvolumes/%v", bve.bvol.Info.Id)
 }
 
-func (dro *DeviceRemoveOperation) Build(allocator Allocator) error {
-	return dro.db.Update(func(tx *bolt.Tx) error {
-		d, err := NewDeviceEntryFromId(tx, dro.DeviceId)
-		if err != nil {
-			return err
-		}
+// Build reserves the space the block volume grows by on the block
+// hosting volume.
+func (bve *BlockVolumeExpandOperation) Build(allocator Allocator) error {
+	return bve.db.Update(func(tx *bolt.Tx) error {
 		txdb := wdb.WrapTx(tx)
-
-		// If the device has no bricks, just change the state and we are done
-		if err := d.markFailed(txdb); err == nil {
-			// device was empty and is now marked failed
-			return nil
-		} else if err != ErrConflict {
-			// we hit some sort of unexpected error
-			return err
-		}
-		// if we're here markFailed couldn't apply due to conflicts
-		// we don't need to actually record anything in the db
-		// because this is not a long running operation
-
-		if p, err := PendingOperationsOnDevice(txdb, d.Info.Id); err != nil {
+		if p, err := PendingOperationsOnVolume(txdb, bve.bvol.Info.Id); err != nil {
 			return err
 		} else if p {
-			logger.LogError("Found operations still pending on device."+
-				" Can not remove device %v at this time.",
-				d.Info.Id)
+			bve.log().LogError("Found operations still pending on block volume."+
+				" Can not expand block volume %v at this time.",
+				bve.bvol.Info.Id)
 			return ErrConflict
 		}
-
-		dro.op.RecordRemoveDevice(d)
-		if e := dro.op.Save(tx); e != nil {
+		if bve.bvol.Info.Tenant != "" {
+			sizeMiB := (bve.bvol.Info.Size+bve.ExpandSize)*1024 - bve.bvol.sizeMiB()
+			_, err := tenantClustersWithRoom(tx, bve.bvol.Info.Tenant,
+				[]string{bve.bvol.Info.Cluster}, sizeMiB, 0, 0)
+			if err != nil {
+				return err
+			}
+		}
+		if e := bve.bvol.reserveExpandSize(tx, bve.ExpandSize); e != nil {
+			return e
+		}
+		bve.op.RecordExpandBlockVolume(bve.bvol, bve.ExpandSize)
+		if e := bve.op.Save(tx); e != nil {
 			return e
 		}
 		return nil
 	})
 }
 
-func (dro *DeviceRemoveOperation) deviceId() (string, error) {
-	if len(dro.op.Actions) == 0 {
-		// we intentionally avoid recording any actions when all needed bits
-		// were taken care of in Build. There's nothing more to do here.
-		return "", nil
-	}
-	if dro.op.Actions[0].Change != OpRemoveDevice {
-		return "", fmt.Errorf("Unexpected action (%v) on DeviceRemoveOperation pending op",
-			dro.op.Actions[0].Change)
-	}
-	return dro.op.Actions[0].Id, nil
-}
-
-func (dro *DeviceRemoveOperation) Exec(executor executors.Executor) error {
-	id, err := dro.deviceId()
+// Exec grows the block volume on the block hosting volume.
+func (bve *BlockVolumeExpandOperation) Exec(executor executors.Executor) error {
+	hvname, err := bve.bvol.blockHostingVolumeName(bve.db)
 	if err != nil {
 		return err
 	}
-	if id == "" {
-		return nil
-	}
-
-	var d *DeviceEntry
-	if e := dro.db.View(func(tx *bolt.Tx) error {
-		d, err = NewDeviceEntryFromId(tx, id)
-		return err
-	}); e != nil {
-		return e
+	err = bve.bvol.expandBlockVolumeExec(bve.db, hvname, executor,
+		bve.bvol.Info.Size+bve.ExpandSize)
+	if err != nil {
+		bve.log().LogError("Error executing expand block volume: %v", err)
 	}
+	return err
+}
 
-	// pulling the allocator from the operation is a huge hack.
-	// its basically an intentional violation of the Operation model that
-	// we need to do if for now because the remove bricks code is an
-	// extra big tangle
-	return d.removeBricksFromDevice(dro.db, executor, dro.allocator)
+// Rollback gives the reserved space back to the block hosting volume.
+func (bve *BlockVolumeExpandOperation) Rollback(executor executors.Executor) error {
+	return bve.db.Update(func(tx *bolt.Tx) error {
+		if e := bve.bvol.reserveExpandSize(tx, -bve.ExpandSize); e != nil {
+			return e
+		}
+		return bve.op.Delete(tx)
+	})
+}
+
+// Finalize updates the size of the block volume entry.
+func (bve *BlockVolumeExpandOperation) Finalize() error {
+	return bve.db.Update(func(tx *bolt.Tx) error {
+		sizeDelta, err := expandSizeFromOp(bve.op)
+		if err != nil {
+			bve.log().LogError("Failed to get expansion size from op: %v", err)
+			return err
+		}
+
+		bvol, err := NewBlockVolumeEntryFromId(tx, bve.bvol.Info.Id)
+		if err != nil {
+			return err
+		}
+		// the block volume now has a size of whole GiB
+		bvol.Info.Size += sizeDelta
+		bvol.Info.SizeMiB = 0
+		if e := bvol.Save(tx); e != nil {
+			return e
+		}
+		bve.bvol = bvol
+
+		bve.op.Delete(tx)
+		return nil
+	})
+}
+
+// BlockVolumeCloneOperation implements the operation functions used to
+// clone a block volume into a new block volume.
+type BlockVolumeCloneOperation struct {
+	OperationManager
+	bvol   *BlockVolumeEntry
+	source *BlockVolumeEntry
+}
+
+// NewBlockVolumeCloneOperation returns a new BlockVolumeCloneOperation
+// cloning the source block volume into a new block volume of the same
+// size and authentication and allocates a new pending operation entry.
+func NewBlockVolumeCloneOperation(
+	source *BlockVolumeEntry, req *api.BlockVolumeCloneRequest,
+	db wdb.DB) *BlockVolumeCloneOperation {
+
+	bvol := NewBlockVolumeEntryFromRequest(&api.BlockVolumeCreateRequest{
+		Size:     source.Info.Size,
+		SizeMiB:  source.Info.SizeMiB,
+		Clusters: []string{source.Info.Cluster},
+		Name:     req.Name,
+		Hacount:  req.Hacount,
+		Auth:     source.Info.Auth,
+	})
+	if bvol.Info.Hacount == 0 {
+		bvol.Info.Hacount = source.Info.Hacount
+	}
+	bvol.Info.Cluster = source.Info.Cluster
+	bvol.Info.CloneOf = source.Info.Id
+	bvol.Info.Tenant = source.Info.Tenant
+
+	return &BlockVolumeCloneOperation{
+		OperationManager: OperationManager{
+			db: db,
+			op: NewPendingOperationEntry(NEW_ID),
+		},
+		bvol:   bvol,
+		source: source,
+	}
+}
+
+func (bvc *BlockVolumeCloneOperation) Label() string {
+	return "Clone Block Volume"
+}
+
+func (bvc *BlockVolumeCloneOperation) ResourceUrl() string {
+	return fmt.Sprintf("/blockvolumes/%v", bvc.bvol.Info.Id)
+}
+
+// Build saves the new block volume, tagged as pending, in the db. The
+// clone is placed on the block hosting volume of the source, which must
+// have space for another block volume of the size of the source.
+func (bvc *BlockVolumeCloneOperation) Build(allocator Allocator) error {
+	return bvc.db.Update(func(tx *bolt.Tx) error {
+		txdb := wdb.WrapTx(tx)
+		source, err := NewBlockVolumeEntryFromId(tx, bvc.source.Info.Id)
+		if err != nil {
+			return err
+		}
+		if p, err := PendingOperationsOnVolume(txdb, source.Info.Id); err != nil {
+			return err
+		} else if p || !source.Visible() {
+			bvc.log().LogError("Found operations still pending on block volume."+
+				" Can not clone block volume %v at this time.",
+				source.Info.Id)
+			return ErrConflict
+		}
+		hostingVolume, err := NewVolumeEntryFromId(tx, source.Info.BlockHostingVolume)
+		if err != nil {
+			return err
+		}
+		if hostingVolume.Info.BlockInfo.FreeSize < bvc.bvol.Info.Size {
+			bvc.log().LogError("Block hosting volume %v has %v GiB free, "+
+				"clone of block volume %v needs %v GiB",
+				hostingVolume.Info.Id, hostingVolume.Info.BlockInfo.FreeSize,
+				source.Info.Id, bvc.bvol.Info.Size)
+			return ErrNoSpace
+		}
+		// the clone is charged to the tenant of the source
+		if bvc.bvol.Info.Tenant != "" {
+			_, err := tenantClustersWithRoom(tx, bvc.bvol.Info.Tenant,
+				[]string{source.Info.Cluster}, source.sizeMiB(), 0, 1)
+			if err != nil {
+				return err
+			}
+		}
+		// with enough space the hosting volume can only be refused for
+		// already hosting a block volume of the same name
+		if ok, err := canHostBlockVolume(tx, bvc.bvol, hostingVolume); err != nil {
+			return err
+		} else if !ok {
+			return ErrConflict
+		}
+
+		bvc.source = source
+		bvc.bvol.Info.BlockHostingVolume = hostingVolume.Info.Id
+		bvc.op.RecordAddBlockVolume(bvc.bvol)
+		bvc.op.RecordCloneBlockVolume(source)
+		if e := bvc.bvol.Save(tx); e != nil {
+			return e
+		}
+		return bvc.op.Save(tx)
+	})
+}
+
+// Exec creates the clone on the block hosting volume and copies the data
+// of the source into it.
+func (bvc *BlockVolumeCloneOperation) Exec(executor executors.Executor) error {
+	err := bvc.bvol.cloneBlockVolume(bvc.db, executor, bvc.source.Info.Name)
+	if err != nil {
+		bvc.log().LogError("Error executing clone block volume: %v", err)
+	}
+	return err
+}
+
+// Rollback removes the clone from the block hosting volume, if it was
+// created, and removes the pending block volume entry from the db.
+func (bvc *BlockVolumeCloneOperation) Rollback(executor executors.Executor) error {
+	hvname, err := bvc.bvol.blockHostingVolumeName(bvc.db)
+	if err != nil {
+		return err
+	}
+	// the clone may not exist, errors are only logged
+	bvc.bvol.deleteBlockVolumeExec(bvc.db, hvname, executor)
+
+	return bvc.db.Update(func(tx *bolt.Tx) error {
+		if e := bvc.bvol.Delete(tx); e != nil {
+			return e
+		}
+		return bvc.op.Delete(tx)
+	})
+}
+
+// Finalize accounts the clone on its cluster and block hosting volume and
+// marks the block volume entry as no longer pending.
+func (bvc *BlockVolumeCloneOperation) Finalize() error {
+	create := &BlockVolumeCreateOperation{
+		OperationManager: bvc.OperationManager,
+		bvol:             bvc.bvol,
+	}
+	return create.Finalize()
+}
+
+// DeviceRemoveOperation is a phony-ish operation that exists
+// primarily to a) know that set state was being performed
+// and b) to serve as a starting point for a more proper
+// operation in the future.
+type DeviceRemoveOperation struct {
+	OperationManager
+	DeviceId  string
+	allocator Allocator
+
+	// optional, called after each brick on the device is handled
+	brickDone brickMigrationFunc
+
+	// optional, reason saved when the device is marked failed
+	reason *api.StateReason
+}
+
+// Note: passing this allocator here a big hack, but its a temporary
+// workaround for how brick relocation currently works
+func NewDeviceRemoveOperation(
+	deviceId string, allocator Allocator, db wdb.DB) *DeviceRemoveOperation {
+
+	return &DeviceRemoveOperation{
+		OperationManager: OperationManager{
+			db: db,
+			op: NewPendingOperationEntry(NEW_ID),
+		},
+		DeviceId:  deviceId,
+		allocator: allocator,
+	}
+}
+
+func (dro *DeviceRemoveOperation) Label() string {
+	return "Remove Device"
+}
+
+func (dro *DeviceRemoveOperation) ResourceUrl() string {
+	return ""
+}
+
+func (dro *DeviceRemoveOperation) Build(allocator Allocator) error {
+	return dro.db.Update(func(tx *bolt.Tx) error {
+		d, err := NewDeviceEntryFromId(tx, dro.DeviceId)
+		if err != nil {
+			return err
+		}
+		txdb := wdb.WrapTx(tx)
+
+		// If the device has no bricks, just change the state and we are done
+		if err := d.markFailed(txdb, dro.reason); err == nil {
+			// device was empty and is now marked failed
+			return nil
+		} else if err != ErrConflict {
+			// we hit some sort of unexpected error
+			return err
+		}
+		// if we're here markFailed couldn't apply due to conflicts
+		// we don't need to actually record anything in the db
+		// because this is not a long running operation
+
+		if p, err := PendingOperationsOnDevice(txdb, d.Info.Id); err != nil {
+			return err
+		} else if p {
+			dro.log().LogError("Found operations still pending on device."+
+				" Can not remove device %v at this time.",
+				d.Info.Id)
+			return ErrConflict
+		}
+
+		dro.op.RecordRemoveDevice(d)
+		if e := dro.op.Save(tx); e != nil {
+			return e
+		}
+		return nil
+	})
+}
+
+func (dro *DeviceRemoveOperation) deviceId() (string, error) {
+	if len(dro.op.Actions) == 0 {
+		// we intentionally avoid recording any actions when all needed bits
+		// were taken care of in Build. There's nothing more to do here.
+		return "", nil
+	}
+	if dro.op.Actions[0].Change != OpRemoveDevice {
+		return "", fmt.Errorf("Unexpected action (%v) on DeviceRemoveOperation pending op",
+			dro.op.Actions[0].Change)
+	}
+	return dro.op.Actions[0].Id, nil
+}
+
+func (dro *DeviceRemoveOperation) Exec(executor executors.Executor) error {
+	id, err := dro.deviceId()
+	if err != nil {
+		return err
+	}
+	if id == "" {
+		return nil
+	}
+
+	var d *DeviceEntry
+	if e := dro.db.View(func(tx *bolt.Tx) error {
+		d, err = NewDeviceEntryFromId(tx, id)
+		return err
+	}); e != nil {
+		return e
+	}
+
+	// pulling the allocator from the operation is a huge hack.
+	// its basically an intentional violation of the Operation model that
+	// we need to do if for now because the remove bricks code is an
+	// extra big tangle
+	return d.removeBricksFromDevice(dro.db, executor, dro.allocator, dro.brickDone)
 }
 
 func (dro *DeviceRemoveOperation) Rollback(executor executors.Executor) error {
@@ -816,20 +1449,640 @@ func (dro *DeviceRemoveOperation) Rollback(executor executors.Executor) error {
 	})
 }
 
-func (dro *DeviceRemoveOperation) Finalize() error {
-	id, err := dro.deviceId()
+func (dro *DeviceRemoveOperation) Finalize() error {
+	id, err := dro.deviceId()
+	if err != nil {
+		return err
+	}
+	if id == "" {
+		return nil
+	}
+	return dro.db.Update(func(tx *bolt.Tx) error {
+		txdb := wdb.WrapTx(tx)
+		if e := markDeviceFailed(txdb, id, true, dro.reason); e != nil {
+			return e
+		}
+		return dro.op.Delete(tx)
+	})
+}
+
+// SnapshotCreateOperation implements the operation functions used to
+// take a gluster snapshot of an existing volume.
+type SnapshotCreateOperation struct {
+	OperationManager
+	snap *SnapshotEntry
+}
+
+// NewSnapshotCreateOperation returns a new SnapshotCreateOperation populated
+// with the given snapshot entry and db connection and allocates a new
+// pending operation entry.
+func NewSnapshotCreateOperation(
+	snap *SnapshotEntry, db wdb.DB) *SnapshotCreateOperation {
+
+	return &SnapshotCreateOperation{
+		OperationManager: OperationManager{
+			db: db,
+			op: NewPendingOperationEntry(NEW_ID),
+		},
+		snap: snap,
+	}
+}
+
+func (sc *SnapshotCreateOperation) Label() string {
+	return "Create Snapshot"
+}
+
+func (sc *SnapshotCreateOperation) ResourceUrl() string {
+	return fmt.Sprintf("/snapshots/%v", sc.snap.Info.Id)
+}
+
+// Build checks that the snapshot can be taken and saves the pending
+// snapshot entry in the db.
+func (sc *SnapshotCreateOperation) Build(allocator Allocator) error {
+	return sc.db.Update(func(tx *bolt.Tx) error {
+		txdb := wdb.WrapTx(tx)
+		vol, err := NewVolumeEntryFromId(tx, sc.snap.Info.OriginVolume)
+		if err != nil {
+			return err
+		}
+		if !vol.Visible() {
+			return ErrNotFound
+		}
+		if p, err := PendingOperationsOnVolume(txdb, vol.Info.Id); err != nil {
+			return err
+		} else if p {
+			sc.log().LogError("Found operations still pending on volume."+
+				" Can not snapshot volume %v at this time.",
+				vol.Info.Id)
+			return ErrConflict
+		}
+		if vol.PendingDeleteSince != 0 {
+			sc.log().LogError("Volume %v waits for the confirmation of its delete."+
+				" Can not snapshot it at this time.",
+				vol.Info.Id)
+			return ErrConflict
+		}
+		if exists, err := snapshotNameExistsInCluster(tx,
+			sc.snap.Info.Cluster, sc.snap.Info.Name); err != nil {
+			return err
+		} else if exists {
+			sc.log().LogError("Snapshot name %v is already used in cluster %v",
+				sc.snap.Info.Name, sc.snap.Info.Cluster)
+			return ErrConflict
+		}
+		sc.op.RecordAddSnapshot(sc.snap)
+		if e := sc.snap.Save(tx); e != nil {
+			return e
+		}
+		return sc.op.Save(tx)
+	})
+}
+
+// Exec creates the snapshot in gluster.
+func (sc *SnapshotCreateOperation) Exec(executor executors.Executor) error {
+	vol, host, err := snapshotVolumeAndHost(sc.db, executor, sc.snap)
+	if err != nil {
+		return err
+	}
+	err = executor.SnapshotCreate(host, &executors.SnapshotRequest{
+		Volume: vol.Info.Name,
+		Name:   sc.snap.Info.Name,
+	})
+	if err != nil {
+		sc.log().LogError("Error executing create snapshot: %v", err)
+	}
+	return err
+}
+
+// Rollback removes the snapshot from gluster if it was created and
+// removes the snapshot entry and the pending operation from the db.
+func (sc *SnapshotCreateOperation) Rollback(executor executors.Executor) error {
+	vol, host, err := snapshotVolumeAndHost(sc.db, executor, sc.snap)
+	if err != nil {
+		return err
+	}
+	exists, err := snapshotExists(executor, host, vol, sc.snap)
+	if err != nil {
+		return err
+	}
+	if exists {
+		if err := executor.SnapshotDestroy(host, sc.snap.Info.Name); err != nil {
+			return err
+		}
+	}
+	return sc.db.Update(func(tx *bolt.Tx) error {
+		if e := sc.snap.Delete(tx); e != nil {
+			return e
+		}
+		return sc.op.Delete(tx)
+	})
+}
+
+// Finalize marks the snapshot entry as created.
+func (sc *SnapshotCreateOperation) Finalize() error {
+	return sc.db.Update(func(tx *bolt.Tx) error {
+		sc.op.FinalizeSnapshot(sc.snap)
+		if e := sc.snap.Save(tx); e != nil {
+			return e
+		}
+		return sc.op.Delete(tx)
+	})
+}
+
+// SnapshotDeleteOperation implements the operation functions used to
+// delete a snapshot of a volume.
+type SnapshotDeleteOperation struct {
+	OperationManager
+	snap *SnapshotEntry
+}
+
+// NewSnapshotDeleteOperation returns a new SnapshotDeleteOperation populated
+// with the given snapshot entry and db connection and allocates a new
+// pending operation entry.
+func NewSnapshotDeleteOperation(
+	snap *SnapshotEntry, db wdb.DB) *SnapshotDeleteOperation {
+
+	return &SnapshotDeleteOperation{
+		OperationManager: OperationManager{
+			db: db,
+			op: NewPendingOperationEntry(NEW_ID),
+		},
+		snap: snap,
+	}
+}
+
+func (sdel *SnapshotDeleteOperation) Label() string {
+	return "Delete Snapshot"
+}
+
+func (sdel *SnapshotDeleteOperation) ResourceUrl() string {
+	return ""
+}
+
+// Build marks the snapshot entry as being deleted.
+func (sdel *SnapshotDeleteOperation) Build(allocator Allocator) error {
+	return sdel.db.Update(func(tx *bolt.Tx) error {
+		snap, err := NewSnapshotEntryFromId(tx, sdel.snap.Info.Id)
+		if err != nil {
+			return err
+		}
+		if !snap.Visible() {
+			sdel.log().LogError("Found operation still pending on snapshot."+
+				" Can not delete snapshot %v at this time.",
+				snap.Info.Id)
+			return ErrConflict
+		}
+		sdel.snap = snap
+		sdel.op.RecordDeleteSnapshot(sdel.snap)
+		if e := sdel.snap.Save(tx); e != nil {
+			return e
+		}
+		return sdel.op.Save(tx)
+	})
+}
+
+// Exec deletes the snapshot in gluster.
+func (sdel *SnapshotDeleteOperation) Exec(executor executors.Executor) error {
+	_, host, err := snapshotVolumeAndHost(sdel.db, executor, sdel.snap)
+	if err != nil {
+		return err
+	}
+	err = executor.SnapshotDestroy(host, sdel.snap.Info.Name)
+	if err != nil {
+		sdel.log().LogError("Error executing delete snapshot: %v", err)
+	}
+	return err
+}
+
+// Rollback removes the pending operation, keeping the snapshot entry
+// unless the snapshot is already gone from gluster.
+func (sdel *SnapshotDeleteOperation) Rollback(executor executors.Executor) error {
+	vol, host, err := snapshotVolumeAndHost(sdel.db, executor, sdel.snap)
+	if err != nil {
+		return err
+	}
+	exists, err := snapshotExists(executor, host, vol, sdel.snap)
+	if err != nil {
+		return err
+	}
+	return sdel.db.Update(func(tx *bolt.Tx) error {
+		if exists {
+			sdel.op.FinalizeSnapshot(sdel.snap)
+			if e := sdel.snap.Save(tx); e != nil {
+				return e
+			}
+		} else if e := sdel.snap.Delete(tx); e != nil {
+			return e
+		}
+		return sdel.op.Delete(tx)
+	})
+}
+
+// Finalize removes the snapshot entry from the db.
+func (sdel *SnapshotDeleteOperation) Finalize() error {
+	return sdel.db.Update(func(tx *bolt.Tx) error {
+		if e := sdel.snap.Delete(tx); e != nil {
+			return e
+		}
+		return sdel.op.Delete(tx)
+	})
+}
+
+// SnapshotCloneOperation implements the operation functions used to
+// clone a snapshot into a new volume.
+type SnapshotCloneOperation struct {
+	OperationManager
+	snap *SnapshotEntry
+	vol  *VolumeEntry
+}
+
+// NewSnapshotCloneOperation returns a new SnapshotCloneOperation cloning
+// the snapshot into a new volume with the layout of the origin volume and
+// allocates a new pending operation entry.
+func NewSnapshotCloneOperation(
+	snap *SnapshotEntry, origin *VolumeEntry,
+	req *api.SnapshotCloneRequest, db wdb.DB) *SnapshotCloneOperation {
+
+	vol := NewVolumeEntryFromRequest(cloneVolumeRequest(origin, req))
+	vol.Info.Cluster = origin.Info.Cluster
+	return &SnapshotCloneOperation{
+		OperationManager: OperationManager{
+			db: db,
+			op: NewPendingOperationEntry(NEW_ID),
+		},
+		snap: snap,
+		vol:  vol,
+	}
+}
+
+func (sc *SnapshotCloneOperation) Label() string {
+	return "Clone Snapshot"
+}
+
+func (sc *SnapshotCloneOperation) ResourceUrl() string {
+	return fmt.Sprintf("/volumes/%v", sc.vol.Info.Id)
+}
+
+// Build saves the new volume and its bricks, tagged as pending, in the
+// db. The bricks are registered on the devices of the bricks of the
+// origin volume without allocating space, as gluster creates them in the
+// thin pools of the origin bricks.
+func (sc *SnapshotCloneOperation) Build(allocator Allocator) error {
+	return sc.db.Update(func(tx *bolt.Tx) error {
+		txdb := wdb.WrapTx(tx)
+		snap, err := NewSnapshotEntryFromId(tx, sc.snap.Info.Id)
+		if err != nil {
+			return err
+		}
+		if !snap.Visible() {
+			sc.log().LogError("Found operation still pending on snapshot."+
+				" Can not clone snapshot %v at this time.",
+				snap.Info.Id)
+			return ErrConflict
+		}
+		origin, err := NewVolumeEntryFromId(tx, snap.Info.OriginVolume)
+		if err != nil {
+			return err
+		}
+		if p, err := PendingOperationsOnVolume(txdb, origin.Info.Id); err != nil {
+			return err
+		} else if p {
+			sc.log().LogError("Found operations still pending on volume."+
+				" Can not clone snapshot of volume %v at this time.",
+				origin.Info.Id)
+			return ErrConflict
+		}
+		if origin.PendingDeleteSince != 0 {
+			sc.log().LogError("Volume %v waits for the confirmation of its delete."+
+				" Can not clone its snapshots at this time.",
+				origin.Info.Id)
+			return ErrConflict
+		}
+
+		for _, id := range origin.BricksIds() {
+			brick, err := NewBrickEntryFromId(tx, id)
+			if err != nil {
+				return err
+			}
+			clone := NewClonedBrickEntry(brick, sc.vol.Info.Gid, sc.vol.Info.Id)
+			device, err := NewDeviceEntryFromId(tx, clone.Info.DeviceId)
+			if err != nil {
+				return err
+			}
+			device.BrickAdd(clone.Info.Id)
+			if e := device.Save(tx); e != nil {
+				return e
+			}
+			sc.vol.BrickAdd(clone.Info.Id)
+			sc.op.RecordAddBrick(clone)
+			if e := clone.Save(tx); e != nil {
+				return e
+			}
+		}
+
+		if e := sc.vol.updateMountInfo(txdb); e != nil {
+			return e
+		}
+		cluster, err := NewClusterEntryFromId(tx, sc.vol.Info.Cluster)
+		if err != nil {
+			return err
+		}
+		cluster.VolumeAdd(sc.vol.Info.Id)
+		if e := cluster.Save(tx); e != nil {
+			return e
+		}
+		sc.op.RecordAddVolume(sc.vol)
+		if e := sc.vol.Save(tx); e != nil {
+			return e
+		}
+		sc.op.RecordCloneSnapshot(snap)
+		return sc.op.Save(tx)
+	})
+}
+
+// Exec clones the snapshot in gluster and records the paths of the
+// bricks gluster created for the new volume.
+func (sc *SnapshotCloneOperation) Exec(executor executors.Executor) error {
+	origin, host, err := snapshotVolumeAndHost(sc.db, executor, sc.snap)
 	if err != nil {
 		return err
 	}
-	if id == "" {
-		return nil
+	cloneInfo, err := executor.SnapshotClone(host, &executors.SnapshotCloneRequest{
+		Snapshot: sc.snap.Info.Name,
+		Volume:   sc.vol.Info.Name,
+	})
+	if err != nil {
+		sc.log().LogError("Error executing clone snapshot: %v", err)
+		return err
 	}
-	return dro.db.Update(func(tx *bolt.Tx) error {
+	originInfo, err := executor.VolumeInfo(host, origin.Info.Name)
+	if err != nil {
+		return err
+	}
+	return sc.db.Update(func(tx *bolt.Tx) error {
+		brick_entries, err := bricksFromOp(wdb.WrapTx(tx), sc.op, sc.vol.Info.Gid)
+		if err != nil {
+			sc.log().LogError("Failed to get bricks from op: %v", err)
+			return err
+		}
+		order, err := assignClonedBrickPaths(tx, origin, brick_entries, originInfo, cloneInfo)
+		if err != nil {
+			sc.log().LogError("Unable to match bricks of clone %v: %v",
+				sc.vol.Info.Name, err)
+			return err
+		}
+		sc.vol.BrickOrder = order
+		sc.vol.Info.GlusterId = cloneInfo.ID
+		return sc.vol.Save(tx)
+	})
+}
+
+// Rollback removes the clone from gluster, if it was created, and removes
+// the pending volume and brick entries from the db.
+func (sc *SnapshotCloneOperation) Rollback(executor executors.Executor) error {
+	host, err := GetVerifiedManageHostname(sc.db, executor, sc.vol.Info.Cluster)
+	if err != nil {
+		return err
+	}
+	// the clone may not exist, errors are only logged
+	executor.VolumeDestroy(host, sc.vol.Info.Name)
+
+	brick_entries, err := bricksFromOp(sc.db, sc.op, sc.vol.Info.Gid)
+	if err != nil {
+		sc.log().LogError("Failed to get bricks from op: %v", err)
+		return err
+	}
+	err = sc.vol.cleanupCreateVolume(sc.db, executor, brick_entries)
+	if err != nil {
+		sc.log().LogError("Error on clone snapshot rollback: %v", err)
+		return err
+	}
+	return sc.db.Update(func(tx *bolt.Tx) error {
+		return sc.op.Delete(tx)
+	})
+}
+
+// Finalize marks the new volume and brick entries as no longer pending.
+func (sc *SnapshotCloneOperation) Finalize() error {
+	vc := &VolumeCreateOperation{OperationManager: sc.OperationManager, vol: sc.vol}
+	return vc.Finalize()
+}
+
+// snapshotVolumeAndHost returns the origin volume of the snapshot and a
+// verified host of its cluster to run the snapshot commands on.
+func snapshotVolumeAndHost(db wdb.RODB,
+	executor executors.Executor,
+	snap *SnapshotEntry) (*VolumeEntry, string, error) {
+
+	var vol *VolumeEntry
+	err := db.View(func(tx *bolt.Tx) error {
+		var err error
+		vol, err = NewVolumeEntryFromId(tx, snap.Info.OriginVolume)
+		return err
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	host, err := GetVerifiedManageHostname(db, executor, snap.Info.Cluster)
+	if err != nil {
+		return nil, "", err
+	}
+	return vol, host, nil
+}
+
+// snapshotExists returns true if gluster lists the snapshot among the
+// snapshots of the volume.
+func snapshotExists(executor executors.Executor,
+	host string,
+	vol *VolumeEntry,
+	snap *SnapshotEntry) (bool, error) {
+
+	names, err := executor.SnapshotList(host, vol.Info.Name)
+	if err != nil {
+		return false, err
+	}
+	for _, name := range names {
+		if name == snap.Info.Name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ReplicationCreateOperation implements the operation functions used to
+// create a secondary volume on a DR cluster and replicate a volume to it.
+type ReplicationCreateOperation struct {
+	OperationManager
+	repl      *ReplicationEntry
+	primary   *VolumeEntry
+	secondary *VolumeEntry
+}
+
+// NewReplicationCreateOperation returns a new ReplicationCreateOperation
+// replicating the primary volume to a new volume of the same layout on
+// the cluster and allocates a new pending operation entry.
+func NewReplicationCreateOperation(
+	primary *VolumeEntry, clusterId string, db wdb.DB) *ReplicationCreateOperation {
+
+	secondary := NewVolumeEntryFromRequest(secondaryVolumeRequest(primary, clusterId))
+	return &ReplicationCreateOperation{
+		OperationManager: OperationManager{
+			db: db,
+			op: NewPendingOperationEntry(NEW_ID),
+		},
+		primary:   primary,
+		secondary: secondary,
+	}
+}
+
+func (rc *ReplicationCreateOperation) Label() string {
+	return "Create Replication"
+}
+
+func (rc *ReplicationCreateOperation) ResourceUrl() string {
+	return fmt.Sprintf("/replications/%v", rc.repl.Info.Id)
+}
+
+// Build allocates the secondary volume and saves it, its bricks and the
+// replication entry, tagged as pending, in the db.
+func (rc *ReplicationCreateOperation) Build(allocator Allocator) error {
+	return rc.db.Update(func(tx *bolt.Tx) error {
 		txdb := wdb.WrapTx(tx)
-		if e := markDeviceFailed(txdb, id, true); e != nil {
+		if p, err := PendingOperationsOnVolume(txdb, rc.primary.Info.Id); err != nil {
+			return err
+		} else if p {
+			rc.log().LogError("Found operations still pending on volume."+
+				" Can not replicate volume %v at this time.",
+				rc.primary.Info.Id)
+			return ErrConflict
+		}
+		if r, err := VolumeReplications(tx, rc.primary.Info.Id); err != nil {
+			return err
+		} else if len(r) != 0 {
+			rc.log().LogError("Volume %v is already replicated by %v",
+				rc.primary.Info.Id, r[0].Info.Id)
+			return ErrConflict
+		}
+
+		brick_entries, err := rc.secondary.createVolumeComponents(txdb, allocator, nil)
+		if err != nil {
+			return err
+		}
+		for _, brick := range brick_entries {
+			rc.op.RecordAddBrick(brick)
+			if e := brick.Save(tx); e != nil {
+				return e
+			}
+		}
+		rc.op.RecordAddVolume(rc.secondary)
+		if e := rc.secondary.Save(tx); e != nil {
 			return e
 		}
-		return dro.op.Delete(tx)
+		rc.repl = NewReplicationEntryFromVolumes(rc.primary, rc.secondary)
+		rc.op.RecordAddReplication(rc.repl)
+		if e := rc.repl.Save(tx); e != nil {
+			return e
+		}
+		return rc.op.Save(tx)
+	})
+}
+
+// Exec creates the secondary volume and starts the geo-replication
+// session of the primary volume to it.
+func (rc *ReplicationCreateOperation) Exec(executor executors.Executor) error {
+	vc := &VolumeCreateOperation{OperationManager: rc.OperationManager, vol: rc.secondary}
+	if err := vc.Exec(executor); err != nil {
+		return err
+	}
+
+	var session *executors.GeoReplicationRequest
+	err := rc.db.View(func(tx *bolt.Tx) error {
+		var err error
+		session, err = rc.repl.geoReplicationRequest(tx)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	host, err := GetVerifiedManageHostname(rc.db, executor, rc.primary.Info.Cluster)
+	if err != nil {
+		return err
+	}
+	err = executor.GeoReplicationCreate(host, session)
+	if err != nil {
+		rc.log().LogError("Error executing create replication: %v", err)
+		return err
+	}
+	err = executor.GeoReplicationAction(host, session,
+		executors.GeoReplicationStart, false)
+	if err != nil {
+		rc.log().LogError("Error executing start replication: %v", err)
+	}
+	return err
+}
+
+// Rollback deletes the geo-replication session, if any, and the secondary
+// volume and removes the pending entries from the db.
+func (rc *ReplicationCreateOperation) Rollback(executor executors.Executor) error {
+	var session *executors.GeoReplicationRequest
+	err := rc.db.View(func(tx *bolt.Tx) error {
+		var err error
+		session, err = rc.repl.geoReplicationRequest(tx)
+		return err
+	})
+	if err == nil {
+		host, err := GetVerifiedManageHostname(rc.db, executor, rc.primary.Info.Cluster)
+		if err == nil {
+			// the session may not exist, errors are only logged
+			executor.GeoReplicationAction(host, session,
+				executors.GeoReplicationStop, true)
+			executor.GeoReplicationAction(host, session,
+				executors.GeoReplicationDelete, false)
+		}
+	}
+
+	brick_entries, err := bricksFromOp(rc.db, rc.op, rc.secondary.Info.Gid)
+	if err != nil {
+		rc.log().LogError("Failed to get bricks from op: %v", err)
+		return err
+	}
+	err = rc.secondary.cleanupCreateVolume(rc.db, executor, brick_entries)
+	if err != nil {
+		rc.log().LogError("Error on create replication rollback: %v", err)
+		return err
+	}
+	return rc.db.Update(func(tx *bolt.Tx) error {
+		if e := rc.repl.Delete(tx); e != nil {
+			return e
+		}
+		return rc.op.Delete(tx)
+	})
+}
+
+// Finalize marks the secondary volume, its bricks and the replication
+// entry as no longer pending.
+func (rc *ReplicationCreateOperation) Finalize() error {
+	return rc.db.Update(func(tx *bolt.Tx) error {
+		brick_entries, err := bricksFromOp(wdb.WrapTx(tx), rc.op, rc.secondary.Info.Gid)
+		if err != nil {
+			rc.log().LogError("Failed to get bricks from op: %v", err)
+			return err
+		}
+		for _, brick := range brick_entries {
+			rc.op.FinalizeBrick(brick)
+			if e := brick.Save(tx); e != nil {
+				return e
+			}
+		}
+		rc.op.FinalizeVolume(rc.secondary)
+		if e := rc.secondary.Save(tx); e != nil {
+			return e
+		}
+		rc.op.FinalizeReplication(rc.repl)
+		if e := rc.repl.Save(tx); e != nil {
+			return e
+		}
+		return rc.op.Delete(tx)
 	})
 }
 
@@ -883,7 +2136,7 @@ func volumesFromOp(db wdb.RODB,
 // If the operation is of the wrong type error will be non-nil.
 func expandSizeFromOp(op *PendingOperationEntry) (sizeGB int, e error) {
 	for _, a := range op.Actions {
-		if a.Change == OpExpandVolume {
+		if a.Change == OpExpandVolume || a.Change == OpExpandBlockVolume {
 			sizeGB, e = a.ExpandSize()
 			return
 		}
@@ -893,6 +2146,44 @@ func expandSizeFromOp(op *PendingOperationEntry) (sizeGB int, e error) {
 	return
 }
 
+// restoreFromOp returns the snapshot name and the next stage of a volume
+// restore operation assuming the given pending operation entry includes
+// the restore change items. If the operation is of the wrong type error
+// will be non-nil.
+func restoreFromOp(op *PendingOperationEntry) (
+	snapshot string, stage VolumeRestoreStage, e error) {
+
+	for _, a := range op.Actions {
+		switch a.Change {
+		case OpRestoreVolume:
+			snapshot, e = a.RestoreSnapshot()
+		case OpRestoreVolumeStage:
+			stage, e = a.RestoreStage()
+		}
+		if e != nil {
+			return
+		}
+	}
+	if snapshot == "" || stage == "" {
+		e = fmt.Errorf("no OpRestoreVolume action in pending op: %v",
+			op.Id)
+	}
+	return
+}
+
+// restoreBricksFromOp returns the ids of the bricks of the volume being
+// restored in the order gluster lists them, if they were recorded in
+// the pending operation entry.
+func restoreBricksFromOp(op *PendingOperationEntry) []string {
+	ids := []string{}
+	for _, a := range op.Actions {
+		if a.Change == OpRestoreVolumeBrick {
+			ids = append(ids, a.Id)
+		}
+	}
+	return ids
+}
+
 // AsyncHttpOperation runs all the steps of an operation with the long-running
 // parts wrapped in an async http function. If AsyncHttpOperation returns nil
 // then it has started the async function and the caller should respond to the
@@ -904,31 +2195,75 @@ func AsyncHttpOperation(app *App,
 	r *http.Request,
 	op Operation) error {
 
-	label := op.Label()
-	if err := op.Build(app.Allocator()); err != nil {
-		logger.LogError("%v Build Failed: %v", label, err)
+	id := requestId(r)
+	if err := buildOperation(app, id, op); err != nil {
 		return err
 	}
 
-	app.asyncManager.AsyncHttpRedirectFunc(w, r, func() (string, error) {
-		logger.Info("Started async operation: %v", label)
-		if err := op.Exec(app.executor); err != nil {
-			if rerr := op.Rollback(app.executor); rerr != nil {
-				logger.LogError("%v Rollback error: %v", label, rerr)
-			}
-			logger.LogError("%v Failed: %v", label, err)
-			return "", err
-		}
-		if err := op.Finalize(); err != nil {
-			logger.LogError("%v Finalize failed: %v", label, err)
-			return "", err
-		}
-		logger.Info("%v succeeded", label)
-		return op.ResourceUrl(), nil
+	history := newOperationHistoryEntry(op, requestIssuer(r))
+	app.asyncHttpRedirectFunc(w, r, func() (string, error) {
+		return execAsyncOperation(app, id, op, history)
 	})
 	return nil
 }
 
+// buildOperation performs the Build step of an operation requested
+// over http by the request with the id
+func buildOperation(app *App, id string, op Operation) error {
+	if o, ok := op.(interface {
+		setRequestId(id string)
+	}); ok {
+		o.setRequestId(id)
+	}
+
+	label := op.Label()
+	log := logger.WithRequestId(id)
+	if err := op.Build(allocatorWithRequestId(app.Allocator(), id)); err != nil {
+		log.LogError("%v Build Failed: %v", label, err)
+		if err == ErrNoSpace || err == ErrMinimumBrickSize {
+			app.notify(api.EventNoSpace, "", operationTenant(op),
+				fmt.Sprintf("%v: %v", label, err))
+		}
+		return err
+	}
+	return nil
+}
+
+// execAsyncOperation performs the Exec and Finalize or Rollback steps of
+// an operation built by the http request with the id and records the
+// outcome in the operation history.
+func execAsyncOperation(app *App,
+	id string,
+	op Operation,
+	history *OperationHistoryEntry) (url string, e error) {
+
+	defer func() {
+		recordOperationHistory(app.db, history, e)
+	}()
+
+	label := op.Label()
+	log := logger.WithRequestId(id)
+	executor := executorWithRequestId(app.executor, id)
+	log.Info("Started async operation: %v", label)
+	if err := op.Exec(executor); err != nil {
+		if rerr := op.Rollback(executor); rerr != nil {
+			log.LogError("%v Rollback error: %v", label, rerr)
+		}
+		log.LogError("%v Failed: %v", label, err)
+		return "", err
+	}
+	if err := op.Finalize(); err != nil {
+		log.LogError("%v Finalize failed: %v", label, err)
+		return "", err
+	}
+	log.Info("%v succeeded", label)
+	if vc, ok := op.(*VolumeCreateOperation); ok {
+		app.notify(api.EventVolumeCreated, vc.vol.Info.Id, vc.vol.Info.Tenant,
+			fmt.Sprintf("Created volume %v", vc.vol.Info.Name))
+	}
+	return op.ResourceUrl(), nil
+}
+
 // RunOperation performs all steps of an Operation and returns
 // an error if any of those steps fail. This function is meant to
 // make it easy to run an operation outside of the rest endpoints
@@ -1888,3 +1888,269 @@ func TestExpandSizeFromOpErrorHandling(t *testing.T) {
 		`expected strings.Contains(e.Error(), "no OpExpandVolume action"), got:`,
 		e)
 }
+
+func TestVolumeRestoreOperation(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		3,    // nodes_per_cluster
+		4,    // devices_per_node,
+		6*TB, // disksize)
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	req := &api.VolumeCreateRequest{}
+	req.Size = 1024
+	req.Durability.Type = api.DurabilityReplicate
+	req.Durability.Replicate.Replica = 3
+
+	vol := NewVolumeEntryFromRequest(req)
+	vc := NewVolumeCreateOperation(vol, app.db)
+	e := RunOperation(vc, app.Allocator(), app.executor)
+	tests.Assert(t, e == nil, "expected e == nil, got:", e)
+
+	steps := []string{}
+	app.xo.MockVolumeStatus = func(host string, volume string) (*executors.VolumeStatus, error) {
+		steps = append(steps, "status")
+		return &executors.VolumeStatus{VolName: volume}, nil
+	}
+	app.xo.MockVolumeStop = func(host string, volume string) error {
+		tests.Assert(t, volume == vol.Info.Name)
+		steps = append(steps, "stop")
+		return nil
+	}
+	app.xo.MockSnapshotRestore = func(host string, snapshot string) error {
+		tests.Assert(t, snapshot == "snap1")
+		steps = append(steps, "restore")
+		return nil
+	}
+	app.xo.MockVolumeStart = func(host string, volume string) error {
+		tests.Assert(t, volume == vol.Info.Name)
+		steps = append(steps, "start")
+		return nil
+	}
+
+	vr := NewVolumeRestoreOperation(vol, app.db, "snap1", false)
+	e = vr.Build(app.Allocator())
+	tests.Assert(t, e == nil, "expected e == nil, got:", e)
+
+	// the volume must remain visible while it is being restored
+	app.db.View(func(tx *bolt.Tx) error {
+		po, e := PendingOperationList(tx)
+		tests.Assert(t, e == nil, "expected e == nil, got", e)
+		tests.Assert(t, len(po) == 1, "expected len(po) == 1, got:", len(po))
+		vl, e := ListCompleteVolumes(tx)
+		tests.Assert(t, e == nil, "expected e == nil, got", e)
+		tests.Assert(t, len(vl) == 1, "expected len(vl) == 1, got:", len(vl))
+		return nil
+	})
+
+	e = vr.Exec(app.executor)
+	tests.Assert(t, e == nil, "expected e == nil, got:", e)
+	e = vr.Finalize()
+	tests.Assert(t, e == nil, "expected e == nil, got:", e)
+
+	expected := "status,stop,restore,start,status"
+	tests.Assert(t, strings.Join(steps, ",") == expected,
+		"expected steps == ", expected, "got:", steps)
+
+	app.db.View(func(tx *bolt.Tx) error {
+		po, e := PendingOperationList(tx)
+		tests.Assert(t, e == nil, "expected e == nil, got", e)
+		tests.Assert(t, len(po) == 0, "expected len(po) == 0, got:", len(po))
+		return nil
+	})
+}
+
+func TestVolumeRestoreOperationClientsConnected(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		3,    // nodes_per_cluster
+		4,    // devices_per_node,
+		6*TB, // disksize)
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	req := &api.VolumeCreateRequest{}
+	req.Size = 1024
+
+	vol := NewVolumeEntryFromRequest(req)
+	vc := NewVolumeCreateOperation(vol, app.db)
+	e := RunOperation(vc, app.Allocator(), app.executor)
+	tests.Assert(t, e == nil, "expected e == nil, got:", e)
+
+	stopped := 0
+	app.xo.MockVolumeStatus = func(host string, volume string) (*executors.VolumeStatus, error) {
+		b := executors.BrickStatus{
+			Hostname: host,
+			Path:     "/mockpath",
+			Status:   1,
+		}
+		b.ClientsStatus.ClientCount = 1
+		return &executors.VolumeStatus{
+			VolName: volume,
+			Bricks:  []executors.BrickStatus{b},
+		}, nil
+	}
+	app.xo.MockVolumeStop = func(host string, volume string) error {
+		stopped++
+		return nil
+	}
+
+	vr := NewVolumeRestoreOperation(vol, app.db, "snap1", false)
+	e = RunOperation(vr, app.Allocator(), app.executor)
+	tests.Assert(t, e != nil, "expected e != nil, got:", e)
+	tests.Assert(t, strings.Contains(e.Error(), "connected client"),
+		`expected strings.Contains(e.Error(), "connected client"), got:`, e)
+	tests.Assert(t, stopped == 0, "expected stopped == 0, got:", stopped)
+
+	// rollback removed the pending op
+	app.db.View(func(tx *bolt.Tx) error {
+		po, e := PendingOperationList(tx)
+		tests.Assert(t, e == nil, "expected e == nil, got", e)
+		tests.Assert(t, len(po) == 0, "expected len(po) == 0, got:", len(po))
+		return nil
+	})
+
+	// forcing the restore skips the client check
+	vr = NewVolumeRestoreOperation(vol, app.db, "snap1", true)
+	e = RunOperation(vr, app.Allocator(), app.executor)
+	tests.Assert(t, e == nil, "expected e == nil, got:", e)
+	tests.Assert(t, stopped == 1, "expected stopped == 1, got:", stopped)
+}
+
+func TestVolumeRestoreOperationResume(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		3,    // nodes_per_cluster
+		4,    // devices_per_node,
+		6*TB, // disksize)
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	req := &api.VolumeCreateRequest{}
+	req.Size = 1024
+
+	vol := NewVolumeEntryFromRequest(req)
+	vc := NewVolumeCreateOperation(vol, app.db)
+	e := RunOperation(vc, app.Allocator(), app.executor)
+	tests.Assert(t, e == nil, "expected e == nil, got:", e)
+
+	stopped, restored, started := 0, 0, 0
+	app.xo.MockVolumeStop = func(host string, volume string) error {
+		stopped++
+		return nil
+	}
+	app.xo.MockSnapshotRestore = func(host string, snapshot string) error {
+		restored++
+		return nil
+	}
+	app.xo.MockVolumeStart = func(host string, volume string) error {
+		started++
+		if started == 1 {
+			return fmt.Errorf("start failed")
+		}
+		return nil
+	}
+
+	vr := NewVolumeRestoreOperation(vol, app.db, "snap1", false)
+	e = vr.Build(app.Allocator())
+	tests.Assert(t, e == nil, "expected e == nil, got:", e)
+	e = vr.Exec(app.executor)
+	tests.Assert(t, e != nil, "expected e != nil, got:", e)
+
+	// the stage of the restore was saved in the db
+	app.db.View(func(tx *bolt.Tx) error {
+		op, e := NewPendingOperationEntryFromId(tx, vr.Id())
+		tests.Assert(t, e == nil, "expected e == nil, got", e)
+		snapshot, stage, e := restoreFromOp(op)
+		tests.Assert(t, e == nil, "expected e == nil, got", e)
+		tests.Assert(t, snapshot == "snap1", "expected snapshot == snap1, got:", snapshot)
+		tests.Assert(t, stage == RestoreStageStartVolume,
+			"expected stage == RestoreStageStartVolume, got:", stage)
+		return nil
+	})
+
+	// the volume is fenced from other operations
+	ve := NewVolumeExpandOperation(vol, app.db, 100)
+	e = ve.Build(app.Allocator())
+	tests.Assert(t, e == ErrConflict, "expected e == ErrConflict, got:", e)
+	vr2 := NewVolumeRestoreOperation(vol, app.db, "snap2", true)
+	e = vr2.Build(app.Allocator())
+	tests.Assert(t, e == ErrConflict, "expected e == ErrConflict, got:", e)
+
+	// running exec again resumes the restore
+	e = vr.Exec(app.executor)
+	tests.Assert(t, e == nil, "expected e == nil, got:", e)
+	e = vr.Finalize()
+	tests.Assert(t, e == nil, "expected e == nil, got:", e)
+
+	tests.Assert(t, stopped == 1, "expected stopped == 1, got:", stopped)
+	tests.Assert(t, restored == 1, "expected restored == 1, got:", restored)
+	tests.Assert(t, started == 2, "expected started == 2, got:", started)
+}
+
+func TestVolumeRestoreOperationOfflineBricks(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		3,    // nodes_per_cluster
+		4,    // devices_per_node,
+		6*TB, // disksize)
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	req := &api.VolumeCreateRequest{}
+	req.Size = 1024
+
+	vol := NewVolumeEntryFromRequest(req)
+	vc := NewVolumeCreateOperation(vol, app.db)
+	e := RunOperation(vc, app.Allocator(), app.executor)
+	tests.Assert(t, e == nil, "expected e == nil, got:", e)
+
+	app.xo.MockVolumeStatus = func(host string, volume string) (*executors.VolumeStatus, error) {
+		return &executors.VolumeStatus{
+			VolName: volume,
+			Bricks: []executors.BrickStatus{
+				executors.BrickStatus{Hostname: "host1", Path: "/b1", Status: 1},
+				executors.BrickStatus{Hostname: "host2", Path: "/b2", Status: 0},
+				// self-heal daemons are not bricks
+				executors.BrickStatus{Hostname: "Self-heal Daemon", Path: "host2", Status: 0},
+			},
+		}, nil
+	}
+
+	vr := NewVolumeRestoreOperation(vol, app.db, "snap1", true)
+	e = RunOperation(vr, app.Allocator(), app.executor)
+	tests.Assert(t, e != nil, "expected e != nil, got:", e)
+	tests.Assert(t, strings.Contains(e.Error(), "host2:/b2"),
+		`expected strings.Contains(e.Error(), "host2:/b2"), got:`, e)
+	tests.Assert(t, !strings.Contains(e.Error(), "Self-heal"),
+		`expected !strings.Contains(e.Error(), "Self-heal"), got:`, e)
+}
@@ -35,8 +35,39 @@ const (
 	OperationCreateBlockVolume
 	OperationDeleteBlockVolume
 	OperationRemoveDevice
+	OperationRestoreVolume
+	OperationCreateSnapshot
+	OperationDeleteSnapshot
+	OperationCreateReplication
+	OperationCloneSnapshot
+	OperationExpandBlockVolume
+	OperationCloneBlockVolume
 )
 
+var pendingOperationNames = map[PendingOperationType]string{
+	OperationCreateVolume:      "create-volume",
+	OperationDeleteVolume:      "delete-volume",
+	OperationExpandVolume:      "expand-volume",
+	OperationCreateBlockVolume: "create-block-volume",
+	OperationDeleteBlockVolume: "delete-block-volume",
+	OperationRemoveDevice:      "remove-device",
+	OperationRestoreVolume:     "restore-volume",
+	OperationCreateSnapshot:    "create-snapshot",
+	OperationDeleteSnapshot:    "delete-snapshot",
+	OperationCreateReplication: "create-replication",
+	OperationCloneSnapshot:     "clone-snapshot",
+	OperationExpandBlockVolume: "expand-block-volume",
+	OperationCloneBlockVolume:  "clone-block-volume",
+}
+
+// Name returns the name of the operation type as reported by the api.
+func (t PendingOperationType) Name() string {
+	if name, ok := pendingOperationNames[t]; ok {
+		return name
+	}
+	return "unknown"
+}
+
 // PendingChangeType identifies what kind of lower-level new item or change
 // is being made to the system as part of a higher-level pending operation.
 type PendingChangeType int
@@ -51,8 +82,45 @@ const (
 	OpAddBlockVolume
 	OpDeleteBlockVolume
 	OpRemoveDevice
+	OpRestoreVolume
+	OpRestoreVolumeStage
+	OpAddSnapshot
+	OpDeleteSnapshot
+	OpAddReplication
+	OpCloneSnapshot
+	OpRestoreVolumeBrick
+	OpExpandBlockVolume
+	OpCloneBlockVolume
 )
 
+var pendingChangeNames = map[PendingChangeType]string{
+	OpAddBrick:           "add-brick",
+	OpAddVolume:          "add-volume",
+	OpDeleteBrick:        "delete-brick",
+	OpDeleteVolume:       "delete-volume",
+	OpExpandVolume:       "expand-volume",
+	OpAddBlockVolume:     "add-block-volume",
+	OpDeleteBlockVolume:  "delete-block-volume",
+	OpRemoveDevice:       "remove-device",
+	OpRestoreVolume:      "restore-volume",
+	OpRestoreVolumeStage: "restore-volume-stage",
+	OpAddSnapshot:        "add-snapshot",
+	OpDeleteSnapshot:     "delete-snapshot",
+	OpAddReplication:     "add-replication",
+	OpCloneSnapshot:      "clone-snapshot",
+	OpRestoreVolumeBrick: "restore-volume-brick",
+	OpExpandBlockVolume:  "expand-block-volume",
+	OpCloneBlockVolume:   "clone-block-volume",
+}
+
+// Name returns the name of the change type as reported by the api.
+func (c PendingChangeType) Name() string {
+	if name, ok := pendingChangeNames[c]; ok {
+		return name
+	}
+	return "unknown"
+}
+
 // PendingOperationAction tracks individual changes to entries within the
 // heketi db. It consists of a required change type and (heketi uuid) id,
 // as well as an optional delta object for extra metadata.
@@ -80,10 +148,34 @@ type PendingOperation struct {
 // PendingOperationAction if the change type is correct. If the type is
 // not correct error will be non-nil.
 func (a PendingOperationAction) ExpandSize() (int, error) {
-	if a.Change == OpExpandVolume {
+	if a.Change == OpExpandVolume || a.Change == OpExpandBlockVolume {
 		if v, ok := a.Delta.(int); ok {
 			return v, nil
 		}
 	}
 	return 0, fmt.Errorf("Action delta for ExpandSize is missing/invalid")
 }
+
+// RestoreSnapshot extracts the name of the snapshot a volume is being
+// restored from if the change type is correct. If the type is not correct
+// error will be non-nil.
+func (a PendingOperationAction) RestoreSnapshot() (string, error) {
+	if a.Change == OpRestoreVolume {
+		if v, ok := a.Delta.(string); ok && v != "" {
+			return v, nil
+		}
+	}
+	return "", fmt.Errorf("Action delta for RestoreSnapshot is missing/invalid")
+}
+
+// RestoreStage extracts the next step of a volume restore from the
+// PendingOperationAction if the change type is correct. If the type is
+// not correct error will be non-nil.
+func (a PendingOperationAction) RestoreStage() (VolumeRestoreStage, error) {
+	if a.Change == OpRestoreVolumeStage {
+		if v, ok := a.Delta.(string); ok && v != "" {
+			return VolumeRestoreStage(v), nil
+		}
+	}
+	return "", fmt.Errorf("Action delta for RestoreStage is missing/invalid")
+}
@@ -0,0 +1,233 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"fmt"
+
+	"github.com/boltdb/bolt"
+	"github.com/heketi/heketi/executors"
+	wdb "github.com/heketi/heketi/pkg/db"
+)
+
+// actionId returns the id of the first action of the given change type
+// recorded in the pending operation.
+func actionId(p *PendingOperationEntry, c PendingChangeType) (string, error) {
+	for _, a := range p.Actions {
+		if a.Change == c {
+			return a.Id, nil
+		}
+	}
+	return "", fmt.Errorf("Pending operation %v has no %v action",
+		p.Id, c.Name())
+}
+
+// loadOperation rebuilds the operation that saved the pending operation
+// entry so that the operation can be rolled back or completed.
+func loadOperation(db wdb.DB, p *PendingOperationEntry) (Operation, error) {
+	om := OperationManager{db: db, op: p}
+
+	var change PendingChangeType
+	switch p.Type {
+	case OperationCreateVolume:
+		change = OpAddVolume
+	case OperationDeleteVolume:
+		change = OpDeleteVolume
+	case OperationExpandVolume:
+		change = OpExpandVolume
+	case OperationRestoreVolume:
+		change = OpRestoreVolume
+	case OperationCreateBlockVolume, OperationCloneBlockVolume:
+		change = OpAddBlockVolume
+	case OperationDeleteBlockVolume:
+		change = OpDeleteBlockVolume
+	case OperationExpandBlockVolume:
+		change = OpExpandBlockVolume
+	case OperationRemoveDevice:
+		change = OpRemoveDevice
+	case OperationCreateSnapshot:
+		change = OpAddSnapshot
+	case OperationDeleteSnapshot:
+		change = OpDeleteSnapshot
+	case OperationCreateReplication:
+		change = OpAddReplication
+	case OperationCloneSnapshot:
+		change = OpAddVolume
+	default:
+		return nil, fmt.Errorf("Unable to load pending operation %v of type %v",
+			p.Id, p.Type.Name())
+	}
+	id, err := actionId(p, change)
+	if err != nil {
+		return nil, err
+	}
+
+	switch p.Type {
+	case OperationRemoveDevice:
+		return &DeviceRemoveOperation{OperationManager: om, DeviceId: id}, nil
+	case OperationCreateBlockVolume, OperationDeleteBlockVolume,
+		OperationExpandBlockVolume, OperationCloneBlockVolume:
+
+		var bvol *BlockVolumeEntry
+		err := db.View(func(tx *bolt.Tx) error {
+			var err error
+			bvol, err = NewBlockVolumeEntryFromId(tx, id)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		if p.Type == OperationCreateBlockVolume {
+			return &BlockVolumeCreateOperation{OperationManager: om, bvol: bvol}, nil
+		}
+		if p.Type == OperationCloneBlockVolume {
+			return &BlockVolumeCloneOperation{OperationManager: om, bvol: bvol}, nil
+		}
+		if p.Type == OperationExpandBlockVolume {
+			size, err := expandSizeFromOp(p)
+			if err != nil {
+				return nil, err
+			}
+			return &BlockVolumeExpandOperation{OperationManager: om,
+				bvol: bvol, ExpandSize: size}, nil
+		}
+		return &BlockVolumeDeleteOperation{OperationManager: om, bvol: bvol}, nil
+	case OperationCreateSnapshot, OperationDeleteSnapshot:
+		var snap *SnapshotEntry
+		err := db.View(func(tx *bolt.Tx) error {
+			var err error
+			snap, err = NewSnapshotEntryFromId(tx, id)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		if p.Type == OperationCreateSnapshot {
+			return &SnapshotCreateOperation{OperationManager: om, snap: snap}, nil
+		}
+		return &SnapshotDeleteOperation{OperationManager: om, snap: snap}, nil
+	case OperationCreateReplication:
+		rc := &ReplicationCreateOperation{OperationManager: om}
+		err := db.View(func(tx *bolt.Tx) error {
+			var err error
+			rc.repl, err = NewReplicationEntryFromId(tx, id)
+			if err != nil {
+				return err
+			}
+			rc.primary, err = NewVolumeEntryFromId(tx, rc.repl.Info.PrimaryVolume)
+			if err != nil {
+				return err
+			}
+			rc.secondary, err = NewVolumeEntryFromId(tx, rc.repl.Info.SecondaryVolume)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		return rc, nil
+	}
+
+	var vol *VolumeEntry
+	err = db.View(func(tx *bolt.Tx) error {
+		var err error
+		vol, err = NewVolumeEntryFromId(tx, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	switch p.Type {
+	case OperationCreateVolume:
+		return &VolumeCreateOperation{OperationManager: om, vol: vol}, nil
+	case OperationDeleteVolume:
+		return &VolumeDeleteOperation{OperationManager: om, vol: vol}, nil
+	case OperationExpandVolume:
+		size, err := expandSizeFromOp(p)
+		if err != nil {
+			return nil, err
+		}
+		return &VolumeExpandOperation{OperationManager: om, vol: vol, ExpandSize: size}, nil
+	case OperationCloneSnapshot:
+		return &SnapshotCloneOperation{OperationManager: om, vol: vol}, nil
+	default:
+		snapshot, _, err := restoreFromOp(p)
+		if err != nil {
+			return nil, err
+		}
+		return &VolumeRestoreOperation{OperationManager: om, vol: vol, Snapshot: snapshot}, nil
+	}
+}
+
+// cleanupOperation rolls back an operation interrupted by a restart of
+// heketi. Volume restores record each step they complete and are resumed
+// instead, falling back to a rollback if the restore fails. Volume and
+// block volume deletes may have destroyed the storage already, so they
+// are always completed. A delete that can not be completed is left
+// pending rather than bringing back the deleted volume.
+func cleanupOperation(op Operation, executor executors.Executor) error {
+	switch op.(type) {
+	case *VolumeDeleteOperation, *BlockVolumeDeleteOperation:
+		if err := op.Exec(executor); err != nil {
+			return err
+		}
+		return op.Finalize()
+	case *VolumeRestoreOperation:
+		err := op.Exec(executor)
+		if err == nil {
+			return op.Finalize()
+		}
+		logger.LogError("Unable to resume %v: %v", op.Label(), err)
+	}
+	return op.Rollback(executor)
+}
+
+// CleanupPendingOperations rolls back or completes the operations left
+// pending in the db when heketi was terminated while performing them.
+// It returns the number of pending operations that could not be cleaned
+// up, which are left in the db.
+func CleanupPendingOperations(db wdb.DB, executor executors.Executor) (int, error) {
+	var pending []*PendingOperationEntry
+	err := db.View(func(tx *bolt.Tx) error {
+		ids, err := PendingOperationList(tx)
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			p, err := NewPendingOperationEntryFromId(tx, id)
+			if err != nil {
+				return err
+			}
+			pending = append(pending, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	remaining := 0
+	for _, p := range pending {
+		op, err := loadOperation(db, p)
+		if err != nil {
+			logger.LogError("Unable to clean up pending operation %v: %v", p.Id, err)
+			remaining++
+			continue
+		}
+		logger.Info("Cleaning up pending operation %v: %v", p.Id, op.Label())
+		if err := cleanupOperation(op, executor); err != nil {
+			logger.LogError("Unable to clean up pending operation %v: %v", p.Id, err)
+			remaining++
+			continue
+		}
+		logger.Info("Cleaned up pending operation %v", p.Id)
+	}
+	return remaining, nil
+}
@@ -0,0 +1,196 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/gorilla/mux"
+	client "github.com/heketi/heketi/client/api/go-client"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/tests"
+)
+
+func TestCleanupPendingVolumeCreate(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	c := client.NewClientNoAuth(ts.URL)
+	tests.Assert(t, c != nil)
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		3,    // nodes_per_cluster
+		1,    // devices_per_node,
+		2*TB, // disksize
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// Save the pending operation without running it, as if heketi
+	// was terminated while creating the volume
+	req := &api.VolumeCreateRequest{}
+	req.Size = 10
+	req.Durability.Type = api.DurabilityReplicate
+	req.Durability.Replicate.Replica = 3
+	v := NewVolumeEntryFromRequest(req)
+	vc := NewVolumeCreateOperation(v, app.db)
+	err = vc.Build(app.Allocator())
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	list, err := c.OperationList()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(list.Operations) == 1, list.Operations)
+	op := list.Operations[0]
+	tests.Assert(t, op.Type == "create-volume", op.Type)
+	tests.Assert(t, op.Started > 0)
+	bricks := 0
+	for _, change := range op.Changes {
+		switch change.Change {
+		case "add-volume":
+			tests.Assert(t, change.Id == v.Info.Id, change)
+		case "add-brick":
+			bricks++
+		default:
+			t.Fatalf("unexpected change %v", change)
+		}
+	}
+	tests.Assert(t, bricks == 3, "expected bricks == 3, got:", bricks)
+
+	remaining, err := CleanupPendingOperations(app.db, app.executor)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, remaining == 0, "expected remaining == 0, got:", remaining)
+
+	app.db.View(func(tx *bolt.Tx) error {
+		pol, err := PendingOperationList(tx)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, len(pol) == 0, pol)
+		vl, err := VolumeList(tx)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, len(vl) == 0, vl)
+		bl, err := BrickList(tx)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, len(bl) == 0, bl)
+		return nil
+	})
+
+	list, err = c.OperationList()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(list.Operations) == 0, list.Operations)
+}
+
+func TestCleanupPendingVolumeDelete(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		3,    // nodes_per_cluster
+		1,    // devices_per_node,
+		2*TB, // disksize
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	req := &api.VolumeCreateRequest{}
+	req.Size = 10
+	req.Durability.Type = api.DurabilityReplicate
+	req.Durability.Replicate.Replica = 3
+	v := NewVolumeEntryFromRequest(req)
+	err = RunOperation(NewVolumeCreateOperation(v, app.db),
+		app.Allocator(), app.executor)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// Save the pending delete without running it, as if heketi was
+	// terminated while deleting the volume
+	vdel := NewVolumeDeleteOperation(v, app.db)
+	err = vdel.Build(app.Allocator())
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// A delete that can not be completed is left pending, the volume
+	// not coming back
+	app.xo.MockVolumeDestroy = func(host string, volume string) error {
+		return fmt.Errorf("glusterd unreachable")
+	}
+	remaining, err := CleanupPendingOperations(app.db, app.executor)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, remaining == 1, "expected remaining == 1, got:", remaining)
+	app.db.View(func(tx *bolt.Tx) error {
+		pol, err := PendingOperationList(tx)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, len(pol) == 1, pol)
+		vol, err := NewVolumeEntryFromId(tx, v.Info.Id)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, vol.Pending.Id == pol[0], vol.Pending.Id)
+		return nil
+	})
+
+	// The delete is completed once the volume can be destroyed
+	destroyed := ""
+	app.xo.MockVolumeDestroy = func(host string, volume string) error {
+		destroyed = volume
+		return nil
+	}
+	remaining, err = CleanupPendingOperations(app.db, app.executor)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, remaining == 0, "expected remaining == 0, got:", remaining)
+	tests.Assert(t, destroyed == v.Info.Name, destroyed)
+	app.db.View(func(tx *bolt.Tx) error {
+		pol, err := PendingOperationList(tx)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, len(pol) == 0, pol)
+		vl, err := VolumeList(tx)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, len(vl) == 0, vl)
+		bl, err := BrickList(tx)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, len(bl) == 0, bl)
+		return nil
+	})
+}
+
+func TestCleanupPendingOperationUnknown(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	p := NewPendingOperationEntry(NEW_ID)
+	err := app.db.Update(func(tx *bolt.Tx) error {
+		return p.Save(tx)
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// Operations that can not be loaded are left in the db
+	remaining, err := CleanupPendingOperations(app.db, app.executor)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, remaining == 1, "expected remaining == 1, got:", remaining)
+
+	app.db.View(func(tx *bolt.Tx) error {
+		pol, err := PendingOperationList(tx)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, len(pol) == 1, pol)
+		return nil
+	})
+}
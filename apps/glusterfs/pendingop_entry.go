@@ -16,6 +16,7 @@ import (
 
 	"github.com/boltdb/bolt"
 	wdb "github.com/heketi/heketi/pkg/db"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
 	"github.com/heketi/heketi/pkg/utils"
 	"github.com/lpabon/godbc"
 )
@@ -162,6 +163,22 @@ func (p *PendingOperationEntry) recordSizeChange(c PendingChangeType,
 		})
 }
 
+// recordStringChange is a helper function to reduce some of the boilerplate
+// around adding a new change action item that includes a string value.
+func (p *PendingOperationEntry) recordStringChange(c PendingChangeType,
+	id string,
+	value string) {
+
+	godbc.Require(p.Id != "")
+	godbc.Require(id != "")
+	p.Actions = append(p.Actions,
+		PendingOperationAction{
+			Change: c,
+			Id:     id,
+			Delta:  value,
+		})
+}
+
 // RecordAddVolume adds tracking metadata for a new volume to the
 // PendingOperationEntry and VolumeEntry.
 func (p *PendingOperationEntry) RecordAddVolume(v *VolumeEntry) {
@@ -243,6 +260,24 @@ func (p *PendingOperationEntry) RecordDeleteBlockVolume(bv *BlockVolumeEntry) {
 	bv.Pending.Id = p.Id
 }
 
+// RecordExpandBlockVolume adds tracking metadata for a block volume that
+// is being expanded. The block volume remains visible while it is expanded.
+func (p *PendingOperationEntry) RecordExpandBlockVolume(bv *BlockVolumeEntry,
+	sizeGB int) {
+
+	p.recordSizeChange(OpExpandBlockVolume, bv.Info.Id, sizeGB)
+	p.Type = OperationExpandBlockVolume
+}
+
+// RecordCloneBlockVolume adds tracking metadata for the block volume a
+// new block volume is cloned from. The source is not changed by the
+// clone and remains visible, the tracking keeps other operations from
+// changing it while it is copied.
+func (p *PendingOperationEntry) RecordCloneBlockVolume(bv *BlockVolumeEntry) {
+	p.recordChange(OpCloneBlockVolume, bv.Info.Id)
+	p.Type = OperationCloneBlockVolume
+}
+
 // RecordRemoveDevice adds tracking metadata for a long-running device
 // removal operation.
 func (p *PendingOperationEntry) RecordRemoveDevice(d *DeviceEntry) {
@@ -250,6 +285,97 @@ func (p *PendingOperationEntry) RecordRemoveDevice(d *DeviceEntry) {
 	p.Type = OperationRemoveDevice
 }
 
+// RecordRestoreVolume adds tracking metadata for a volume that is being
+// restored from a snapshot. The volume entry is not linked back to the
+// op because the volume remains visible while it is being restored.
+func (p *PendingOperationEntry) RecordRestoreVolume(v *VolumeEntry,
+	snapshot string) {
+
+	p.recordStringChange(OpRestoreVolume, v.Info.Id, snapshot)
+	p.recordStringChange(OpRestoreVolumeStage, v.Info.Id,
+		string(RestoreStageCheckClients))
+	p.Type = OperationRestoreVolume
+}
+
+// RecordRestoreStage updates the tracking metadata of a volume restore
+// with the next step to be performed. This allows an interrupted restore
+// to be resumed without repeating steps that were already completed.
+func (p *PendingOperationEntry) RecordRestoreStage(stage VolumeRestoreStage) {
+	for i, a := range p.Actions {
+		if a.Change == OpRestoreVolumeStage {
+			p.Actions[i].Delta = string(stage)
+			return
+		}
+	}
+	godbc.Check(false, "no restore stage recorded in pending op", p.Id)
+}
+
+// RecordRestoreSnapshot adds tracking metadata for the snapshot entry a
+// volume is being restored from. Gluster removes the snapshot once it is
+// restored.
+func (p *PendingOperationEntry) RecordRestoreSnapshot(s *SnapshotEntry) {
+	p.recordChange(OpDeleteSnapshot, s.Info.Id)
+	s.Pending.Id = p.Id
+}
+
+// RecordRestoreBricks updates the tracking metadata of a volume restore
+// with the ids of the bricks of the volume in the order gluster lists
+// them, used to match the bricks of the snapshot to the brick entries.
+func (p *PendingOperationEntry) RecordRestoreBricks(ids []string) {
+	actions := []PendingOperationAction{}
+	for _, a := range p.Actions {
+		if a.Change != OpRestoreVolumeBrick {
+			actions = append(actions, a)
+		}
+	}
+	p.Actions = actions
+	for _, id := range ids {
+		p.recordChange(OpRestoreVolumeBrick, id)
+	}
+}
+
+// RecordAddSnapshot adds tracking metadata for a new snapshot to the
+// PendingOperationEntry and SnapshotEntry.
+func (p *PendingOperationEntry) RecordAddSnapshot(s *SnapshotEntry) {
+	p.recordChange(OpAddSnapshot, s.Info.Id)
+	p.Type = OperationCreateSnapshot
+	s.Pending.Id = p.Id
+}
+
+// RecordDeleteSnapshot adds tracking metadata for a to-be-deleted
+// snapshot to the PendingOperationEntry and SnapshotEntry.
+func (p *PendingOperationEntry) RecordDeleteSnapshot(s *SnapshotEntry) {
+	p.recordChange(OpDeleteSnapshot, s.Info.Id)
+	p.Type = OperationDeleteSnapshot
+	s.Pending.Id = p.Id
+}
+
+// FinalizeSnapshot removes tracking metadata from the snapshot entry.
+func (p *PendingOperationEntry) FinalizeSnapshot(s *SnapshotEntry) {
+	s.Pending.Id = ""
+}
+
+// RecordCloneSnapshot adds tracking metadata for the snapshot a new
+// volume is cloned from to the PendingOperationEntry. The snapshot is not
+// changed by the clone and remains visible.
+func (p *PendingOperationEntry) RecordCloneSnapshot(s *SnapshotEntry) {
+	p.recordChange(OpCloneSnapshot, s.Info.Id)
+	p.Type = OperationCloneSnapshot
+}
+
+// RecordAddReplication adds tracking metadata for a new replication of
+// a volume to the PendingOperationEntry and ReplicationEntry.
+func (p *PendingOperationEntry) RecordAddReplication(r *ReplicationEntry) {
+	p.recordChange(OpAddReplication, r.Info.Id)
+	p.Type = OperationCreateReplication
+	r.Pending.Id = p.Id
+}
+
+// FinalizeReplication removes tracking metadata from the replication entry.
+func (p *PendingOperationEntry) FinalizeReplication(r *ReplicationEntry) {
+	r.Pending.Id = ""
+}
+
 // PendingOperationUpgrade updates the heketi db with metadata needed to
 // support pending operation entries.
 func PendingOperationUpgrade(tx *bolt.Tx) error {
@@ -269,3 +395,21 @@ func PendingOperationUpgrade(tx *bolt.Tx) error {
 	// so simply save the entry to record that this db now has them
 	return entry.Save(tx)
 }
+
+// NewInfoResponse returns the information about the pending operation
+// reported by the api.
+func (p *PendingOperationEntry) NewInfoResponse() *api.OperationInfo {
+	info := &api.OperationInfo{
+		Id:      p.Id,
+		Type:    p.Type.Name(),
+		Started: p.Timestamp,
+		Changes: []api.OperationChangeInfo{},
+	}
+	for _, a := range p.Actions {
+		info.Changes = append(info.Changes, api.OperationChangeInfo{
+			Change: a.Change.Name(),
+			Id:     a.Id,
+		})
+	}
+	return info
+}
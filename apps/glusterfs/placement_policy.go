@@ -0,0 +1,225 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/boltdb/bolt"
+	wdb "github.com/heketi/heketi/pkg/db"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+)
+
+// policyMismatchError is returned when a placement policy names nodes,
+// devices or clusters that are not in the topology
+type policyMismatchError struct {
+	msg string
+}
+
+func (e *policyMismatchError) Error() string {
+	return e.msg
+}
+
+func policyMismatch(format string, args ...interface{}) error {
+	return &policyMismatchError{msg: fmt.Sprintf(format, args...)}
+}
+
+// nodeManageHostname returns the hostname a node is found by in a
+// placement policy
+func nodeManageHostname(node *NodeEntry) string {
+	if len(node.Info.Hostnames.Manage) == 0 {
+		return ""
+	}
+	return node.Info.Hostnames.Manage[0]
+}
+
+// ExportPlacementPolicy returns the placement policy of the topology.
+// Clusters, nodes and devices are sorted so that the same policy is
+// always exported the same way.
+func ExportPlacementPolicy(db wdb.RODB,
+	allocator string) (*api.PlacementPolicy, error) {
+
+	policy := &api.PlacementPolicy{
+		Allocator: allocator,
+		Clusters:  []api.ClusterPlacementPolicy{},
+	}
+	err := db.View(func(tx *bolt.Tx) error {
+		clusters, err := ClusterList(tx)
+		if err != nil {
+			return err
+		}
+		sort.Strings(clusters)
+		for _, id := range clusters {
+			cluster, err := NewClusterEntryFromId(tx, id)
+			if err != nil {
+				return err
+			}
+			cp := api.ClusterPlacementPolicy{
+				Id:      id,
+				Standby: cluster.Info.Standby,
+			}
+			for _, nodeId := range cluster.Info.Nodes {
+				node, err := NewNodeEntryFromId(tx, nodeId)
+				if err != nil {
+					return err
+				}
+				np := api.NodePlacementPolicy{
+					Hostname: nodeManageHostname(node),
+					Zone:     node.Info.Zone,
+					Tags:     copyTags(node.Info.Tags),
+				}
+				for _, deviceId := range node.Devices {
+					device, err := NewDeviceEntryFromId(tx, deviceId)
+					if err != nil {
+						return err
+					}
+					np.Devices = append(np.Devices, api.DevicePlacementPolicy{
+						Name:      device.Info.Name,
+						Tags:      copyTags(node.DeviceTags[deviceId]),
+						Enclosure: node.DeviceEnclosures[deviceId],
+					})
+				}
+				sort.Slice(np.Devices, func(i, j int) bool {
+					return np.Devices[i].Name < np.Devices[j].Name
+				})
+				cp.Nodes = append(cp.Nodes, np)
+			}
+			sort.Slice(cp.Nodes, func(i, j int) bool {
+				return cp.Nodes[i].Hostname < cp.Nodes[j].Hostname
+			})
+			policy.Clusters = append(policy.Clusters, cp)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+// applyPlacementPolicy sets the placement policy on the clusters, nodes
+// and devices of the policy. Nothing is saved unless every part of the
+// policy is found in the topology. Nodes and devices not in the policy
+// are not changed.
+func applyPlacementPolicy(tx *bolt.Tx, policy *api.PlacementPolicy) error {
+	nodeIds, err := NodeList(tx)
+	if err != nil {
+		return err
+	}
+	nodes := map[string]*NodeEntry{}
+	for _, id := range nodeIds {
+		node, err := NewNodeEntryFromId(tx, id)
+		if err != nil {
+			return err
+		}
+		nodes[nodeManageHostname(node)] = node
+	}
+
+	changedNodes := map[string]*NodeEntry{}
+	changedClusters := map[string]*ClusterEntry{}
+	for _, cp := range policy.Clusters {
+		// The id of the cluster is only used without nodes, the ids
+		// of another environment being different
+		clusterId := ""
+		if len(cp.Nodes) == 0 {
+			clusterId = cp.Id
+		}
+		for _, np := range cp.Nodes {
+			node, ok := nodes[np.Hostname]
+			if !ok {
+				return policyMismatch("Node %v not found", np.Hostname)
+			}
+			if clusterId == "" {
+				clusterId = node.Info.ClusterId
+			} else if clusterId != node.Info.ClusterId {
+				return policyMismatch("Nodes %v and %v are in different clusters",
+					cp.Nodes[0].Hostname, np.Hostname)
+			}
+
+			devices := map[string]string{}
+			for _, deviceId := range node.Devices {
+				device, err := NewDeviceEntryFromId(tx, deviceId)
+				if err != nil {
+					return err
+				}
+				devices[device.Info.Name] = deviceId
+			}
+			if np.Zone != 0 {
+				node.Info.Zone = np.Zone
+			}
+			node.Info.Tags = copyTags(np.Tags)
+			for _, dp := range np.Devices {
+				deviceId, ok := devices[dp.Name]
+				if !ok {
+					return policyMismatch("Device %v not found on node %v",
+						dp.Name, np.Hostname)
+				}
+				node.SetDeviceTags(deviceId, copyTags(dp.Tags))
+				node.SetDeviceEnclosure(deviceId, dp.Enclosure)
+			}
+			changedNodes[node.Info.Id] = node
+		}
+
+		if _, ok := changedClusters[clusterId]; ok {
+			return policyMismatch("Cluster %v is listed more than once",
+				clusterId)
+		}
+		cluster, err := NewClusterEntryFromId(tx, clusterId)
+		if err == ErrNotFound {
+			return policyMismatch("Cluster %v not found", clusterId)
+		} else if err != nil {
+			return err
+		}
+		cluster.Info.Standby = cp.Standby
+		changedClusters[clusterId] = cluster
+	}
+
+	for _, node := range changedNodes {
+		if err := node.Save(tx); err != nil {
+			return err
+		}
+	}
+	for _, cluster := range changedClusters {
+		if err := cluster.Save(tx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ImportPlacementPolicy applies the placement policy to the topology,
+// all of it or none of it, and returns the resulting policy. A policy
+// exported by a server with another allocator is applied with a
+// warning, the allocator being set in the configuration of the server.
+func ImportPlacementPolicy(db wdb.DB,
+	policy *api.PlacementPolicy,
+	allocator string) (*api.PlacementPolicyImportResponse, error) {
+
+	err := db.Update(func(tx *bolt.Tx) error {
+		return applyPlacementPolicy(tx, policy)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &api.PlacementPolicyImportResponse{}
+	if policy.Allocator != "" && policy.Allocator != allocator {
+		resp.Warnings = append(resp.Warnings, fmt.Sprintf(
+			"Policy uses allocator %v, the server is configured with %v",
+			policy.Allocator, allocator))
+	}
+	exported, err := ExportPlacementPolicy(db, allocator)
+	if err != nil {
+		return nil, err
+	}
+	resp.PlacementPolicy = *exported
+	return resp, nil
+}
@@ -0,0 +1,181 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	client "github.com/heketi/heketi/client/api/go-client"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/tests"
+)
+
+func TestPlacementPolicyValidate(t *testing.T) {
+	node := api.NodePlacementPolicy{
+		Hostname: "host1",
+		Zone:     1,
+		Devices:  []api.DevicePlacementPolicy{{Name: "/dev/sdb"}},
+	}
+	policy := api.PlacementPolicy{
+		Clusters: []api.ClusterPlacementPolicy{
+			{Nodes: []api.NodePlacementPolicy{node}},
+		},
+	}
+	tests.Assert(t, policy.Validate() == nil, policy.Validate())
+
+	policy.Clusters[0].Nodes = []api.NodePlacementPolicy{node, node}
+	tests.Assert(t, policy.Validate() != nil)
+
+	bad := node
+	bad.Zone = -1
+	policy.Clusters[0].Nodes = []api.NodePlacementPolicy{bad}
+	tests.Assert(t, policy.Validate() != nil)
+
+	bad = node
+	bad.Devices = []api.DevicePlacementPolicy{{Name: "/dev/sdb", Enclosure: "a b"}}
+	policy.Clusters[0].Nodes = []api.NodePlacementPolicy{bad}
+	tests.Assert(t, policy.Validate() != nil)
+
+	bad = node
+	bad.Devices = append(bad.Devices, bad.Devices[0])
+	policy.Clusters[0].Nodes = []api.NodePlacementPolicy{bad}
+	tests.Assert(t, policy.Validate() != nil)
+
+	policy.Clusters[0] = api.ClusterPlacementPolicy{Standby: true}
+	tests.Assert(t, policy.Validate() != nil)
+}
+
+func TestPlacementPolicyExportImport(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	c := client.NewClientNoAuth(ts.URL)
+	tests.Assert(t, c != nil)
+
+	err := setupSampleDbWithTopology(app,
+		2,    // clusters
+		2,    // nodes_per_cluster
+		2,    // devices_per_node,
+		1*TB, // disksize
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	policy, err := c.PlacementPolicyExport()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, policy.Allocator == app.AllocatorName(), policy.Allocator)
+	tests.Assert(t, len(policy.Clusters) == 2, policy.Clusters)
+	for _, cp := range policy.Clusters {
+		tests.Assert(t, len(cp.Nodes) == 2, cp.Nodes)
+		tests.Assert(t, cp.Nodes[0].Hostname < cp.Nodes[1].Hostname, cp.Nodes)
+		for _, np := range cp.Nodes {
+			tests.Assert(t, len(np.Devices) == 2, np.Devices)
+		}
+	}
+
+	// Apply a policy as another environment would, without ids
+	edited := *policy
+	edited.Clusters = nil
+	for _, cp := range policy.Clusters {
+		cp.Id = ""
+		edited.Clusters = append(edited.Clusters, cp)
+	}
+	cp := &edited.Clusters[1]
+	cp.Standby = true
+	cp.Nodes[0].Zone = 7
+	cp.Nodes[0].Tags = map[string]string{"rack": "r1"}
+	cp.Nodes[0].Devices[1].Tags = map[string]string{"media": "ssd"}
+	cp.Nodes[0].Devices[1].Enclosure = "jbod1"
+
+	resp, err := c.PlacementPolicyImport(&edited)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(resp.Warnings) == 0, resp.Warnings)
+	tests.Assert(t, resp.Clusters[1].Standby)
+	tests.Assert(t, resp.Clusters[1].Nodes[0].Zone == 7, resp.Clusters[1].Nodes[0])
+
+	exported, err := c.PlacementPolicyExport()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, reflect.DeepEqual(exported, &resp.PlacementPolicy))
+	np := exported.Clusters[1].Nodes[0]
+	tests.Assert(t, np.Tags["rack"] == "r1", np.Tags)
+	tests.Assert(t, np.Devices[1].Tags["media"] == "ssd", np.Devices[1].Tags)
+	tests.Assert(t, np.Devices[1].Enclosure == "jbod1", np.Devices[1])
+
+	node, err := c.NodeInfo(getNodeIdByHostname(t, c, np.Hostname))
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, node.Zone == 7, node.Zone)
+	cluster, err := c.ClusterInfo(exported.Clusters[1].Id)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, cluster.Standby)
+
+	// Nothing is changed if a node is not found
+	edited.Clusters[0].Nodes[0].Zone = 9
+	edited.Clusters[1].Nodes[1].Hostname = "missing.example.com"
+	_, err = c.PlacementPolicyImport(&edited)
+	tests.Assert(t, err != nil, "expected err != nil")
+	tests.Assert(t, strings.Contains(err.Error(), "missing.example.com"), err)
+	after, err := c.PlacementPolicyExport()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, reflect.DeepEqual(after, exported))
+
+	// Nor if a device is not found
+	edited = *exported
+	edited.Clusters = []api.ClusterPlacementPolicy{exported.Clusters[0]}
+	edited.Clusters[0].Nodes = []api.NodePlacementPolicy{exported.Clusters[0].Nodes[0]}
+	edited.Clusters[0].Nodes[0].Zone = 9
+	edited.Clusters[0].Nodes[0].Devices = []api.DevicePlacementPolicy{{Name: "/dev/missing"}}
+	_, err = c.PlacementPolicyImport(&edited)
+	tests.Assert(t, err != nil, "expected err != nil")
+	after, err = c.PlacementPolicyExport()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, reflect.DeepEqual(after, exported))
+
+	// Nodes of different clusters can not be in one cluster policy
+	edited.Clusters[0].Nodes = []api.NodePlacementPolicy{
+		exported.Clusters[0].Nodes[0], exported.Clusters[1].Nodes[0]}
+	_, err = c.PlacementPolicyImport(&edited)
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	// A cluster without nodes is found by id
+	edited.Clusters = []api.ClusterPlacementPolicy{
+		{Id: exported.Clusters[1].Id, Standby: false}}
+	edited.Allocator = "other"
+	resp, err = c.PlacementPolicyImport(&edited)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, !resp.Clusters[1].Standby)
+	tests.Assert(t, len(resp.Warnings) == 1, resp.Warnings)
+	tests.Assert(t, resp.Clusters[1].Nodes[0].Zone == 7, resp.Clusters[1].Nodes[0])
+}
+
+func getNodeIdByHostname(t *testing.T, c *client.Client, hostname string) string {
+	topology, err := c.TopologyInfo()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	for _, cluster := range topology.ClusterList {
+		for _, node := range cluster.Nodes {
+			if node.Hostnames.Manage[0] == hostname {
+				return node.Id
+			}
+		}
+	}
+	t.Fatalf("node %v not found", hostname)
+	return ""
+}
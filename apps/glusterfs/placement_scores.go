@@ -0,0 +1,189 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"github.com/boltdb/bolt"
+	wdb "github.com/heketi/heketi/pkg/db"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/heketi/pkg/utils"
+)
+
+var (
+	// Default number of bricks sampled to score the devices of a cluster
+	PlacementScoreSamples = 100
+
+	// Maximum number of bricks sampled to score the devices of a cluster
+	PlacementScoreMaxSamples = 10000
+)
+
+// placementDevice tracks the scores of a device while sampling
+type placementDevice struct {
+	score       *api.DevicePlacementScore
+	firstChoice int
+	placed      int
+}
+
+// percentOf returns n in percent of total
+func percentOf(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return 100 * float64(n) / float64(total)
+}
+
+// loadPlacementScores fills the response with the nodes and devices of
+// the cluster, marking the devices that can not receive a brick of the
+// brick size as not eligible
+func loadPlacementScores(tx *bolt.Tx,
+	resp *api.ClusterPlacementScoresResponse) error {
+
+	cluster, err := NewClusterEntryFromId(tx, resp.Id)
+	if err != nil {
+		return err
+	}
+
+	for _, nodeId := range cluster.Info.Nodes {
+		node, err := NewNodeEntryFromId(tx, nodeId)
+		if err != nil {
+			return err
+		}
+		n := api.NodePlacementScore{
+			Id:           node.Info.Id,
+			Hostname:     node.StorageHostName(),
+			Zone:         node.Info.Zone,
+			State:        node.State,
+			HealthEvents: len(node.HealthEvents),
+			Devices:      []api.DevicePlacementScore{},
+		}
+		for _, deviceId := range node.Devices {
+			device, err := NewDeviceEntryFromId(tx, deviceId)
+			if err != nil {
+				return err
+			}
+			d := api.DevicePlacementScore{
+				Id:    device.Info.Id,
+				Name:  device.Info.Name,
+				State: device.State,
+				Free:  device.StorageAvailable(),
+				Total: device.Info.Storage.Total,
+			}
+			if d.Total != 0 {
+				d.FreePercent = 100 * float64(d.Free) / float64(d.Total)
+			}
+			switch {
+			case !node.isOnline():
+				d.Reason = "node is " + string(node.State)
+			case !device.isOnline():
+				d.Reason = "device is " + string(device.State)
+			case !device.StorageCheck(resp.BrickSize):
+				d.Reason = "not enough free space"
+			default:
+				d.Eligible = true
+			}
+			n.Free += d.Free
+			n.Total += d.Total
+			n.Devices = append(n.Devices, d)
+		}
+		resp.Free += n.Free
+		resp.Total += n.Total
+		resp.Nodes = append(resp.Nodes, n)
+	}
+	return nil
+}
+
+// samplePlacement asks the allocator for the devices of a new brick and
+// returns the device the allocator proposes first and the first eligible
+// device, which is where the brick would be placed. Either is nil if the
+// allocator proposes no such device.
+func samplePlacement(db wdb.RODB,
+	allocator Allocator,
+	clusterId string,
+	devices map[string]*placementDevice) (first, placed *placementDevice, err error) {
+
+	deviceCh, done, errc := allocator.GetNodes(db, clusterId, utils.GenUUID())
+	defer close(done)
+
+	for deviceId := range deviceCh {
+		d, ok := devices[deviceId]
+		if !ok {
+			continue
+		}
+		if first == nil {
+			first = d
+		}
+		if d.score.Eligible {
+			return first, d, nil
+		}
+	}
+	if err := <-errc; err != nil {
+		return nil, nil, err
+	}
+	return first, nil, nil
+}
+
+// ClusterPlacementScores samples the placement of bricks of the brick
+// size in the cluster to show how the allocator prefers its devices.
+// Nothing is allocated.
+func ClusterPlacementScores(db wdb.RODB,
+	allocator Allocator,
+	clusterId string,
+	brickSize uint64,
+	samples int) (*api.ClusterPlacementScoresResponse, error) {
+
+	resp := &api.ClusterPlacementScoresResponse{
+		Id:        clusterId,
+		BrickSize: brickSize,
+		Samples:   samples,
+		Nodes:     []api.NodePlacementScore{},
+	}
+	err := db.View(func(tx *bolt.Tx) error {
+		return loadPlacementScores(tx, resp)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	devices := map[string]*placementDevice{}
+	for i := range resp.Nodes {
+		for j := range resp.Nodes[i].Devices {
+			d := &resp.Nodes[i].Devices[j]
+			devices[d.Id] = &placementDevice{score: d}
+		}
+	}
+
+	unplaced := 0
+	for i := 0; i < samples; i++ {
+		first, placed, err := samplePlacement(db, allocator, clusterId, devices)
+		if err != nil {
+			return nil, err
+		}
+		if first != nil {
+			first.firstChoice++
+		}
+		if placed == nil {
+			unplaced++
+			continue
+		}
+		placed.placed++
+	}
+
+	resp.Unplaced = percentOf(unplaced, samples)
+	for i := range resp.Nodes {
+		n := &resp.Nodes[i]
+		for j := range n.Devices {
+			d := devices[n.Devices[j].Id]
+			d.score.FirstChoice = percentOf(d.firstChoice, samples)
+			d.score.Score = percentOf(d.placed, samples)
+			n.Score += d.score.Score
+		}
+	}
+	return resp, nil
+}
@@ -0,0 +1,151 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/gorilla/mux"
+	client "github.com/heketi/heketi/client/api/go-client"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/tests"
+)
+
+func TestClusterPlacementScores(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	c := client.NewClientNoAuth(ts.URL)
+	tests.Assert(t, c != nil)
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		3,    // nodes_per_cluster
+		2,    // devices_per_node,
+		2*TB, // disksize
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	var clusterId, offlineNode, offlineDevice, fullDevice string
+	err = app.db.Update(func(tx *bolt.Tx) error {
+		clusters, err := ClusterList(tx)
+		if err != nil {
+			return err
+		}
+		clusterId = clusters[0]
+		cluster, err := NewClusterEntryFromId(tx, clusterId)
+		if err != nil {
+			return err
+		}
+
+		// First node offline
+		node, err := NewNodeEntryFromId(tx, cluster.Info.Nodes[0])
+		if err != nil {
+			return err
+		}
+		node.State = api.EntryStateOffline
+		offlineNode = node.Info.Id
+		if err := node.Save(tx); err != nil {
+			return err
+		}
+
+		// A device of the second node offline, the other full
+		node, err = NewNodeEntryFromId(tx, cluster.Info.Nodes[1])
+		if err != nil {
+			return err
+		}
+		device, err := NewDeviceEntryFromId(tx, node.Devices[0])
+		if err != nil {
+			return err
+		}
+		device.State = api.EntryStateOffline
+		offlineDevice = device.Info.Id
+		if err := device.Save(tx); err != nil {
+			return err
+		}
+		device, err = NewDeviceEntryFromId(tx, node.Devices[1])
+		if err != nil {
+			return err
+		}
+		device.StorageAllocate(device.Info.Storage.Free - 10*MB)
+		fullDevice = device.Info.Id
+		return device.Save(tx)
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	scores, err := c.ClusterPlacementScores(clusterId, 0, 200)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, scores.Id == clusterId)
+	tests.Assert(t, scores.Allocator == DefaultAllocator, scores.Allocator)
+	tests.Assert(t, scores.BrickSize == 1*GB, scores.BrickSize)
+	tests.Assert(t, scores.Samples == 200, scores.Samples)
+	tests.Assert(t, scores.Unplaced == 0, scores.Unplaced)
+	tests.Assert(t, len(scores.Nodes) == 3, scores.Nodes)
+
+	var total, first float64
+	for _, n := range scores.Nodes {
+		tests.Assert(t, len(n.Devices) == 2, n.Devices)
+		var nodeScore float64
+		for _, d := range n.Devices {
+			switch {
+			case n.Id == offlineNode:
+				tests.Assert(t, !d.Eligible, d)
+				tests.Assert(t, d.Reason == "node is offline", d.Reason)
+				tests.Assert(t, d.FirstChoice == 0, d)
+			case d.Id == offlineDevice:
+				tests.Assert(t, !d.Eligible, d)
+				tests.Assert(t, d.Reason == "device is offline", d.Reason)
+				tests.Assert(t, d.FirstChoice == 0, d)
+			case d.Id == fullDevice:
+				tests.Assert(t, !d.Eligible, d)
+				tests.Assert(t, d.Reason == "not enough free space", d.Reason)
+				tests.Assert(t, d.FreePercent < 1, d)
+			default:
+				tests.Assert(t, d.Eligible, d)
+				tests.Assert(t, d.FreePercent == 100, d)
+				tests.Assert(t, d.Score > 0, d)
+			}
+			if !d.Eligible {
+				tests.Assert(t, d.Score == 0, d)
+			}
+			nodeScore += d.Score
+			first += d.FirstChoice
+		}
+		tests.Assert(t, n.Score == nodeScore, n.Score, nodeScore)
+		total += n.Score
+	}
+	tests.Assert(t, math.Abs(total-100) < 0.001, total)
+	tests.Assert(t, math.Abs(first-100) < 0.001, first)
+
+	// No device has room for bricks of 4TiB
+	scores, err = c.ClusterPlacementScores(clusterId, 4*1024, 10)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, scores.Unplaced == 100, scores.Unplaced)
+
+	r, err := http.Get(ts.URL + "/clusters/" + clusterId + "/scores?samples=0")
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusBadRequest, r.StatusCode)
+
+	_, err = c.ClusterPlacementScores("abc", 0, 0)
+	tests.Assert(t, err != nil)
+}
@@ -0,0 +1,169 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"github.com/boltdb/bolt"
+	"github.com/heketi/heketi/executors"
+	wdb "github.com/heketi/heketi/pkg/db"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+)
+
+// loadReplicationSession returns the replication and its geo-replication
+// session. Replications being created are not found.
+func loadReplicationSession(db wdb.RODB, id string) (
+	*ReplicationEntry, *executors.GeoReplicationRequest, error) {
+
+	var repl *ReplicationEntry
+	var session *executors.GeoReplicationRequest
+	err := db.View(func(tx *bolt.Tx) error {
+		var err error
+		repl, err = NewReplicationEntryFromId(tx, id)
+		if err != nil {
+			return err
+		}
+		if !repl.Visible() {
+			return ErrNotFound
+		}
+		session, err = repl.geoReplicationRequest(tx)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return repl, session, nil
+}
+
+// FailoverReplication stops the copy of the primary volume to the secondary
+// volume so that clients can use the secondary volume. With force the
+// replication fails over even if the session can not be stopped, as when
+// the primary cluster is lost.
+func FailoverReplication(db wdb.DB,
+	executor executors.Executor,
+	id string,
+	force bool) (*ReplicationEntry, error) {
+
+	repl, session, err := loadReplicationSession(db, id)
+	if err != nil {
+		return nil, err
+	}
+	if repl.Info.State != api.ReplicationActive {
+		logger.LogError("Replication %v is %v, not %v",
+			id, repl.Info.State, api.ReplicationActive)
+		return nil, ErrConflict
+	}
+
+	host, err := GetVerifiedManageHostname(db, executor, repl.Info.PrimaryCluster)
+	if err == nil {
+		err = executor.GeoReplicationAction(host, session,
+			executors.GeoReplicationStop, force)
+	}
+	if err != nil {
+		if !force {
+			return nil, err
+		}
+		logger.Warning("Failing over replication %v without stopping it: %v",
+			id, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		var err error
+		repl, err = NewReplicationEntryFromId(tx, id)
+		if err != nil {
+			return err
+		}
+		repl.Info.State = api.ReplicationFailedOver
+		return repl.Save(tx)
+	})
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("Replication %v failed over to volume %v",
+		id, repl.Info.SecondaryVolume)
+
+	return repl, nil
+}
+
+// PromoteReplication ends a failed over replication, the secondary volume
+// becoming a volume of its own. The geo-replication session is deleted
+// if the primary cluster can still be reached.
+func PromoteReplication(db wdb.DB,
+	executor executors.Executor,
+	id string) (*VolumeEntry, error) {
+
+	repl, session, err := loadReplicationSession(db, id)
+	if err != nil {
+		return nil, err
+	}
+	if repl.Info.State != api.ReplicationFailedOver {
+		logger.LogError("Replication %v must be failed over to be promoted", id)
+		return nil, ErrConflict
+	}
+
+	host, err := GetVerifiedManageHostname(db, executor, repl.Info.PrimaryCluster)
+	if err == nil {
+		err = executor.GeoReplicationAction(host, session,
+			executors.GeoReplicationDelete, false)
+	}
+	if err != nil {
+		logger.Warning("Unable to delete geo-replication session of %v: %v",
+			id, err)
+	}
+
+	var vol *VolumeEntry
+	err = db.Update(func(tx *bolt.Tx) error {
+		var err error
+		vol, err = NewVolumeEntryFromId(tx, repl.Info.SecondaryVolume)
+		if err != nil {
+			return err
+		}
+		return repl.Delete(tx)
+	})
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("Promoted volume %v of replication %v",
+		vol.Info.Id, id)
+
+	return vol, nil
+}
+
+// DeleteReplication stops and deletes the geo-replication session and
+// removes the replication. Both volumes are kept.
+func DeleteReplication(db wdb.DB,
+	executor executors.Executor,
+	id string) error {
+
+	repl, session, err := loadReplicationSession(db, id)
+	if err != nil {
+		return err
+	}
+
+	host, err := GetVerifiedManageHostname(db, executor, repl.Info.PrimaryCluster)
+	if err != nil {
+		return err
+	}
+	if repl.Info.State == api.ReplicationActive {
+		err := executor.GeoReplicationAction(host, session,
+			executors.GeoReplicationStop, false)
+		if err != nil {
+			return err
+		}
+	}
+	err = executor.GeoReplicationAction(host, session,
+		executors.GeoReplicationDelete, false)
+	if err != nil {
+		return err
+	}
+
+	return db.Update(func(tx *bolt.Tx) error {
+		return repl.Delete(tx)
+	})
+}
@@ -0,0 +1,199 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"bytes"
+	"encoding/gob"
+
+	"github.com/boltdb/bolt"
+	"github.com/heketi/heketi/executors"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/heketi/pkg/utils"
+	"github.com/lpabon/godbc"
+)
+
+const (
+	BOLTDB_BUCKET_REPLICATION = "REPLICATION"
+)
+
+// ReplicationEntry is the replication of a primary volume to a secondary
+// volume of the same layout on a DR cluster. Gluster geo-replication
+// copies the changes of the primary volume to the secondary volume.
+type ReplicationEntry struct {
+	Info    api.ReplicationInfo
+	Pending PendingItem
+}
+
+func ReplicationList(tx *bolt.Tx) ([]string, error) {
+	list := EntryKeys(tx, BOLTDB_BUCKET_REPLICATION)
+	if list == nil {
+		return nil, ErrAccessList
+	}
+	return list, nil
+}
+
+func NewReplicationEntry() *ReplicationEntry {
+	return &ReplicationEntry{}
+}
+
+// NewReplicationEntryFromVolumes returns a new replication of the primary
+// volume to the secondary volume. The secondary volume must have been
+// allocated on its cluster.
+func NewReplicationEntryFromVolumes(primary, secondary *VolumeEntry) *ReplicationEntry {
+	godbc.Require(primary != nil)
+	godbc.Require(secondary != nil)
+
+	entry := NewReplicationEntry()
+	entry.Info.Id = utils.GenUUID()
+	entry.Info.PrimaryVolume = primary.Info.Id
+	entry.Info.PrimaryCluster = primary.Info.Cluster
+	entry.Info.SecondaryVolume = secondary.Info.Id
+	entry.Info.SecondaryCluster = secondary.Info.Cluster
+	entry.Info.State = api.ReplicationActive
+	entry.Info.Created = operationTimestamp()
+
+	return entry
+}
+
+func NewReplicationEntryFromId(tx *bolt.Tx, id string) (*ReplicationEntry, error) {
+	godbc.Require(tx != nil)
+
+	entry := NewReplicationEntry()
+	err := EntryLoad(tx, entry, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+func (r *ReplicationEntry) BucketName() string {
+	return BOLTDB_BUCKET_REPLICATION
+}
+
+func (r *ReplicationEntry) Visible() bool {
+	return r.Pending.Id == ""
+}
+
+func (r *ReplicationEntry) Save(tx *bolt.Tx) error {
+	godbc.Require(tx != nil)
+	godbc.Require(len(r.Info.Id) > 0)
+
+	return EntrySave(tx, r, r.Info.Id)
+}
+
+func (r *ReplicationEntry) Delete(tx *bolt.Tx) error {
+	return EntryDelete(tx, r, r.Info.Id)
+}
+
+func (r *ReplicationEntry) NewInfoResponse(tx *bolt.Tx) (*api.ReplicationInfoResponse, error) {
+	godbc.Require(tx != nil)
+
+	info := &api.ReplicationInfoResponse{}
+	info.ReplicationInfo = r.Info
+
+	return info, nil
+}
+
+func (r *ReplicationEntry) Marshal() ([]byte, error) {
+	var buffer bytes.Buffer
+	enc := gob.NewEncoder(&buffer)
+	err := enc.Encode(*r)
+
+	return buffer.Bytes(), err
+}
+
+func (r *ReplicationEntry) Unmarshal(buffer []byte) error {
+	dec := gob.NewDecoder(bytes.NewReader(buffer))
+	err := dec.Decode(r)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// VolumeReplications returns the replications the volume is the primary
+// or the secondary volume of
+func VolumeReplications(tx *bolt.Tx, volumeId string) ([]*ReplicationEntry, error) {
+	ids, err := ReplicationList(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	replications := []*ReplicationEntry{}
+	for _, id := range ids {
+		r, err := NewReplicationEntryFromId(tx, id)
+		if err != nil {
+			return nil, err
+		}
+		if r.Info.PrimaryVolume == volumeId || r.Info.SecondaryVolume == volumeId {
+			replications = append(replications, r)
+		}
+	}
+	return replications, nil
+}
+
+// secondaryVolumeRequest returns the request of a volume with the layout
+// of the primary volume on the cluster. The placement tags of the primary
+// volume are not kept as the DR cluster has tags of its own.
+func secondaryVolumeRequest(primary *VolumeEntry, clusterId string) *api.VolumeCreateRequest {
+	req := &api.VolumeCreateRequest{}
+	req.Size = primary.Info.Size
+	req.SizeMiB = primary.Info.SizeMiB
+	req.Clusters = []string{clusterId}
+	req.Durability = primary.Info.Durability
+	req.Gid = primary.Info.Gid
+	req.Uid = primary.Info.Uid
+	req.Permissions = primary.Info.Permissions
+	req.SelinuxContext = primary.Info.SelinuxContext
+	req.Snapshot = primary.Info.Snapshot
+	req.MaxBricks = primary.Info.MaxBricks
+	req.BrickLimits = primary.Info.BrickLimits
+	req.GlusterVolumeOptions = append([]string{}, primary.GlusterVolumeOptions...)
+	return req
+}
+
+// geoReplicationRequest returns the geo-replication session of the
+// replication, the secondary volume being reached through the storage
+// hostname of an online node of its cluster.
+func (r *ReplicationEntry) geoReplicationRequest(tx *bolt.Tx) (
+	*executors.GeoReplicationRequest, error) {
+
+	primary, err := NewVolumeEntryFromId(tx, r.Info.PrimaryVolume)
+	if err != nil {
+		return nil, err
+	}
+	secondary, err := NewVolumeEntryFromId(tx, r.Info.SecondaryVolume)
+	if err != nil {
+		return nil, err
+	}
+	cluster, err := NewClusterEntryFromId(tx, r.Info.SecondaryCluster)
+	if err != nil {
+		return nil, err
+	}
+	for _, nodeId := range cluster.Info.Nodes {
+		node, err := NewNodeEntryFromId(tx, nodeId)
+		if err != nil {
+			return nil, err
+		}
+		if !node.isOnline() {
+			continue
+		}
+		return &executors.GeoReplicationRequest{
+			PrimaryVolume:   primary.Info.Name,
+			SecondaryHost:   node.StorageHostName(),
+			SecondaryVolume: secondary.Info.Name,
+		}, nil
+	}
+	return nil, logger.LogError("No online node in cluster %v of volume %v",
+		r.Info.SecondaryCluster, r.Info.SecondaryVolume)
+}
@@ -0,0 +1,299 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/boltdb/bolt"
+	"github.com/heketi/heketi/executors"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/heketi/pkg/utils"
+	"github.com/lpabon/godbc"
+)
+
+const (
+	BOLTDB_BUCKET_SNAPSHOT = "SNAPSHOT"
+)
+
+// SnapshotEntry is a gluster snapshot of a volume managed by heketi.
+// The snapshot uses the thin pools of the bricks of its volume, whose
+// space is already reserved by the snapshot factor of the volume.
+type SnapshotEntry struct {
+	Info    api.SnapshotInfo
+	Pending PendingItem
+}
+
+func SnapshotList(tx *bolt.Tx) ([]string, error) {
+	list := EntryKeys(tx, BOLTDB_BUCKET_SNAPSHOT)
+	if list == nil {
+		return nil, ErrAccessList
+	}
+	return list, nil
+}
+
+func NewSnapshotEntry() *SnapshotEntry {
+	return &SnapshotEntry{}
+}
+
+func NewSnapshotEntryFromRequest(req *api.SnapshotCreateRequest,
+	vol *VolumeEntry) *SnapshotEntry {
+
+	godbc.Require(req != nil)
+	godbc.Require(vol != nil)
+
+	entry := NewSnapshotEntry()
+	entry.Info.Id = utils.GenUUID()
+	entry.Info.Name = req.Name
+	if entry.Info.Name == "" {
+		entry.Info.Name = "snap_" + entry.Info.Id
+	}
+	entry.Info.Description = req.Description
+	entry.Info.OriginVolume = vol.Info.Id
+	entry.Info.Cluster = vol.Info.Cluster
+	entry.Info.Created = operationTimestamp()
+
+	return entry
+}
+
+func NewSnapshotEntryFromId(tx *bolt.Tx, id string) (*SnapshotEntry, error) {
+	godbc.Require(tx != nil)
+
+	entry := NewSnapshotEntry()
+	err := EntryLoad(tx, entry, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+func (s *SnapshotEntry) BucketName() string {
+	return BOLTDB_BUCKET_SNAPSHOT
+}
+
+func (s *SnapshotEntry) Visible() bool {
+	return s.Pending.Id == ""
+}
+
+func (s *SnapshotEntry) Save(tx *bolt.Tx) error {
+	godbc.Require(tx != nil)
+	godbc.Require(len(s.Info.Id) > 0)
+
+	return EntrySave(tx, s, s.Info.Id)
+}
+
+func (s *SnapshotEntry) Delete(tx *bolt.Tx) error {
+	return EntryDelete(tx, s, s.Info.Id)
+}
+
+func (s *SnapshotEntry) NewInfoResponse(tx *bolt.Tx) (*api.SnapshotInfoResponse, error) {
+	godbc.Require(tx != nil)
+
+	info := &api.SnapshotInfoResponse{}
+	info.SnapshotInfo = s.Info
+
+	return info, nil
+}
+
+func (s *SnapshotEntry) Marshal() ([]byte, error) {
+	var buffer bytes.Buffer
+	enc := gob.NewEncoder(&buffer)
+	err := enc.Encode(*s)
+
+	return buffer.Bytes(), err
+}
+
+func (s *SnapshotEntry) Unmarshal(buffer []byte) error {
+	dec := gob.NewDecoder(bytes.NewReader(buffer))
+	err := dec.Decode(s)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// VolumeSnapshots returns the snapshots of the volume, including the
+// snapshots being created or deleted
+func VolumeSnapshots(tx *bolt.Tx, volumeId string) ([]*SnapshotEntry, error) {
+	ids, err := SnapshotList(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots := []*SnapshotEntry{}
+	for _, id := range ids {
+		s, err := NewSnapshotEntryFromId(tx, id)
+		if err != nil {
+			return nil, err
+		}
+		if s.Info.OriginVolume == volumeId {
+			snapshots = append(snapshots, s)
+		}
+	}
+	return snapshots, nil
+}
+
+// volumeSnapshot returns the snapshot entry of the volume with the id
+// or the name, or nil if the volume has no such snapshot
+func volumeSnapshot(tx *bolt.Tx, volumeId, idOrName string) (*SnapshotEntry, error) {
+	snapshots, err := VolumeSnapshots(tx, volumeId)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range snapshots {
+		if s.Info.Id == idOrName {
+			return s, nil
+		}
+	}
+	for _, s := range snapshots {
+		if s.Info.Name == idOrName {
+			return s, nil
+		}
+	}
+	return nil, nil
+}
+
+// snapshotOfOtherVolume returns true if the id or the name is the one of
+// a snapshot of another volume of the cluster of the volume
+func snapshotOfOtherVolume(tx *bolt.Tx, vol *VolumeEntry, idOrName string) (bool, error) {
+	if s, err := NewSnapshotEntryFromId(tx, idOrName); err == nil {
+		return s.Info.OriginVolume != vol.Info.Id, nil
+	} else if err != ErrNotFound {
+		return false, err
+	}
+	return snapshotNameExistsInCluster(tx, vol.Info.Cluster, idOrName)
+}
+
+// snapshotNameExistsInCluster returns true if a snapshot of a volume of
+// the cluster has the name. Gluster requires the names of snapshots to
+// be unique in the trusted storage pool.
+func snapshotNameExistsInCluster(tx *bolt.Tx, clusterId, name string) (bool, error) {
+	ids, err := SnapshotList(tx)
+	if err != nil {
+		return false, err
+	}
+
+	for _, id := range ids {
+		s, err := NewSnapshotEntryFromId(tx, id)
+		if err != nil {
+			return false, err
+		}
+		if s.Info.Cluster == clusterId && s.Info.Name == name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// cloneVolumeRequest returns the request of a volume with the layout of
+// the origin volume of a snapshot, to be cloned from the snapshot
+func cloneVolumeRequest(origin *VolumeEntry,
+	req *api.SnapshotCloneRequest) *api.VolumeCreateRequest {
+
+	vreq := &api.VolumeCreateRequest{}
+	vreq.Name = req.Name
+	vreq.Size = origin.Info.Size
+	vreq.SizeMiB = origin.Info.SizeMiB
+	vreq.Clusters = []string{origin.Info.Cluster}
+	vreq.Durability = origin.Info.Durability
+	vreq.Gid = origin.Info.Gid
+	vreq.Uid = origin.Info.Uid
+	vreq.Permissions = origin.Info.Permissions
+	vreq.SelinuxContext = origin.Info.SelinuxContext
+	vreq.Snapshot = origin.Info.Snapshot
+	vreq.MaxBricks = origin.Info.MaxBricks
+	vreq.BrickLimits = origin.Info.BrickLimits
+	vreq.Placement.TagMatch = copyTags(origin.Info.Placement.TagMatch)
+	vreq.Placement.SpreadTag = origin.Info.Placement.SpreadTag
+	vreq.Placement.SpreadEnclosure = origin.Info.Placement.SpreadEnclosure
+	vreq.GlusterVolumeOptions = append([]string{}, origin.GlusterVolumeOptions...)
+	return vreq
+}
+
+// glusterBrickPath returns the path of a brick from the name gluster
+// gives to the brick, <host>:<path>
+func glusterBrickPath(name string) (string, error) {
+	sep := strings.Index(name, ":/")
+	if sep == -1 || path.Base(name[sep+1:]) != "brick" {
+		return "", fmt.Errorf("Unexpected brick %v", name)
+	}
+	return name[sep+1:], nil
+}
+
+// assignClonedBrickPaths sets the paths gluster gave to the bricks of a
+// volume cloned from a snapshot of the origin volume and returns the ids
+// of the bricks in the order of the clone. Gluster keeps the order of
+// the bricks of the origin volume, the brick of the clone at a position
+// being on the device of the origin brick at that position.
+func assignClonedBrickPaths(tx *bolt.Tx,
+	origin *VolumeEntry,
+	bricks []*BrickEntry,
+	originInfo, cloneInfo *executors.Volume) ([]string, error) {
+
+	originBricks := originInfo.Bricks.BrickList
+	cloneBricks := cloneInfo.Bricks.BrickList
+	if len(originBricks) != len(cloneBricks) ||
+		len(cloneBricks) != len(bricks) {
+		return nil, fmt.Errorf("Clone %v has %v bricks, expected %v",
+			cloneInfo.VolumeName, len(cloneBricks), len(bricks))
+	}
+
+	// Devices of the origin bricks by their gluster name
+	devices := map[string]string{}
+	for _, id := range origin.BricksIds() {
+		brick, err := NewBrickEntryFromId(tx, id)
+		if err != nil {
+			return nil, err
+		}
+		node, err := NewNodeEntryFromId(tx, brick.Info.NodeId)
+		if err != nil {
+			return nil, err
+		}
+		devices[node.StorageHostName()+":"+brick.Info.Path] = brick.Info.DeviceId
+	}
+
+	unassigned := map[string][]*BrickEntry{}
+	for _, brick := range bricks {
+		unassigned[brick.Info.DeviceId] = append(
+			unassigned[brick.Info.DeviceId], brick)
+	}
+
+	order := []string{}
+	for i, ob := range originBricks {
+		deviceId, ok := devices[ob.Name]
+		if !ok {
+			return nil, fmt.Errorf("Brick %v of volume %v is unknown",
+				ob.Name, origin.Info.Name)
+		}
+		if len(unassigned[deviceId]) == 0 {
+			return nil, fmt.Errorf("No brick of clone %v left on device %v",
+				cloneInfo.VolumeName, deviceId)
+		}
+		brick := unassigned[deviceId][0]
+		unassigned[deviceId] = unassigned[deviceId][1:]
+
+		p, err := glusterBrickPath(cloneBricks[i].Name)
+		if err != nil {
+			return nil, err
+		}
+		brick.Info.Path = p
+		if err := brick.Save(tx); err != nil {
+			return nil, err
+		}
+		order = append(order, brick.Info.Id)
+	}
+	return order, nil
+}
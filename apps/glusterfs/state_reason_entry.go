@@ -0,0 +1,157 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"bytes"
+	"encoding/gob"
+	"time"
+
+	"github.com/boltdb/bolt"
+	wdb "github.com/heketi/heketi/pkg/db"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/lpabon/godbc"
+)
+
+const (
+	BOLTDB_BUCKET_STATE_REASON = "STATE_REASON"
+)
+
+// StateReasonEntry records why a node or a device was taken out of the
+// online state. The entries are keyed by the id of the node or device.
+// They are kept apart from the nodes and devices so that the entries of
+// the nodes and devices which are online do not grow.
+type StateReasonEntry struct {
+	Id     string
+	Reason api.StateReason
+}
+
+func StateReasonList(tx *bolt.Tx) ([]string, error) {
+	list := EntryKeys(tx, BOLTDB_BUCKET_STATE_REASON)
+	if list == nil {
+		return nil, ErrAccessList
+	}
+	return list, nil
+}
+
+func NewStateReasonEntry() *StateReasonEntry {
+	return &StateReasonEntry{}
+}
+
+func NewStateReasonEntryFromId(tx *bolt.Tx, id string) (*StateReasonEntry, error) {
+	godbc.Require(tx != nil)
+
+	entry := NewStateReasonEntry()
+	err := EntryLoad(tx, entry, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+func newStateReason(code api.StateReasonCode, message, actor string) *api.StateReason {
+	return &api.StateReason{
+		Code:    code,
+		Message: message,
+		Actor:   actor,
+		Time:    time.Now().Unix(),
+	}
+}
+
+func (s *StateReasonEntry) BucketName() string {
+	return BOLTDB_BUCKET_STATE_REASON
+}
+
+func (s *StateReasonEntry) Save(tx *bolt.Tx) error {
+	godbc.Require(tx != nil)
+	godbc.Require(s.Id != "")
+
+	return EntrySave(tx, s, s.Id)
+}
+
+func (s *StateReasonEntry) Delete(tx *bolt.Tx) error {
+	return EntryDelete(tx, s, s.Id)
+}
+
+func (s *StateReasonEntry) Marshal() ([]byte, error) {
+	var buffer bytes.Buffer
+	enc := gob.NewEncoder(&buffer)
+	err := enc.Encode(*s)
+
+	return buffer.Bytes(), err
+}
+
+func (s *StateReasonEntry) Unmarshal(buffer []byte) error {
+	dec := gob.NewDecoder(bytes.NewReader(buffer))
+	err := dec.Decode(s)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// stateReason returns the reason of the current state of the node or
+// device, or nil if none was recorded
+func stateReason(tx *bolt.Tx, id string) *api.StateReason {
+	if tx.Bucket([]byte(BOLTDB_BUCKET_STATE_REASON)) == nil {
+		return nil
+	}
+	s, err := NewStateReasonEntryFromId(tx, id)
+	if err != nil {
+		return nil
+	}
+	return &s.Reason
+}
+
+// setStateReason keeps the reason of the state of the node or device.
+// The reason is dropped once the node or device is online again.
+func setStateReason(tx *bolt.Tx, id string,
+	state api.EntryState, reason *api.StateReason) error {
+
+	if state == api.EntryStateOnline || reason == nil {
+		return deleteStateReason(tx, id)
+	}
+	s := &StateReasonEntry{Id: id, Reason: *reason}
+	return s.Save(tx)
+}
+
+// updateStateReason saves the reason of a change of the state of the
+// node or device, in the transaction changing the state. Without a
+// reason the reason of the previous state is kept, unless the node or
+// device is online again.
+func updateStateReason(tx *bolt.Tx, id string,
+	state api.EntryState, reason *api.StateReason) error {
+
+	if reason == nil && state != api.EntryStateOnline {
+		return nil
+	}
+	return setStateReason(tx, id, state, reason)
+}
+
+// keepStateReason saves the reason of the state of the node or device
+// when the state does not change
+func keepStateReason(db wdb.DB, id string,
+	state api.EntryState, reason *api.StateReason) error {
+
+	if reason == nil {
+		return nil
+	}
+	return db.Update(func(tx *bolt.Tx) error {
+		return setStateReason(tx, id, state, reason)
+	})
+}
+
+// deleteStateReason drops the reason of the state of the node or device
+func deleteStateReason(tx *bolt.Tx, id string) error {
+	s := &StateReasonEntry{Id: id}
+	return s.Delete(tx)
+}
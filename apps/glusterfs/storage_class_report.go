@@ -0,0 +1,201 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/boltdb/bolt"
+	wdb "github.com/heketi/heketi/pkg/db"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+)
+
+var (
+	// Maximum number of volumes counted for each cluster by the
+	// storage class report
+	StorageClassReportMaxVolumes = 1000
+
+	// Returned to roll back the bricks allocated by the report
+	errStorageClassReportRollback = errors.New("storage class report rollback")
+)
+
+// clusterZones returns the number of zones of the cluster with online
+// nodes holding online devices
+func clusterZones(tx *bolt.Tx, c *ClusterEntry) (int, error) {
+	zones := map[int]bool{}
+	for _, nodeId := range c.Info.Nodes {
+		node, err := NewNodeEntryFromId(tx, nodeId)
+		if err != nil {
+			return 0, err
+		}
+		if !node.isOnline() {
+			continue
+		}
+		for _, deviceId := range node.Devices {
+			device, err := NewDeviceEntryFromId(tx, deviceId)
+			if err != nil {
+				return 0, err
+			}
+			if device.isOnline() {
+				zones[node.Info.Zone] = true
+				break
+			}
+		}
+	}
+	return len(zones), nil
+}
+
+// reportCluster counts the volumes of the spec that can be allocated
+// in the cluster. The bricks are allocated in the transaction, which
+// must be rolled back by the caller.
+func reportCluster(tx *bolt.Tx,
+	allocator Allocator,
+	req *api.StorageClassReportRequest,
+	zonePolicy string,
+	c *ClusterEntry) (*api.StorageClassClusterReport, error) {
+
+	report := &api.StorageClassClusterReport{Id: c.Info.Id}
+
+	zones, err := clusterZones(tx, c)
+	if err != nil {
+		return nil, err
+	}
+	report.Zones = zones
+
+	if !c.Info.File {
+		report.Reason = "Cluster does not allow file volumes"
+		return report, nil
+	}
+
+	vreq := &api.VolumeCreateRequest{}
+	vreq.Size = req.Size
+	vreq.Durability = req.Durability
+	vreq.Snapshot = req.Snapshot
+
+	txdb := wdb.WrapTx(tx)
+	for report.Volumes < StorageClassReportMaxVolumes {
+		v := NewVolumeEntryFromRequest(vreq)
+		v.brickZonePolicy = zonePolicy
+
+		_, err := v.allocBricksInCluster(txdb, allocator, c.Info.Id,
+			uint64(v.Info.Size)*GB)
+		if err == ErrNoSpace || err == ErrMaxBricks || err == ErrMinimumBrickSize {
+			if report.Volumes == 0 {
+				report.Reason = err.Error()
+				bricks := v.Durability.BricksInSet()
+				if zonePolicy == BrickZonePolicyStrict && zones < bricks {
+					report.Reason = fmt.Sprintf(
+						"Sets of %v bricks need %v zones, the cluster has %v",
+						bricks, bricks, zones)
+				}
+			}
+			return report, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		report.Conforms = true
+		report.Volumes++
+	}
+	report.Limited = true
+	return report, nil
+}
+
+// snapshotDb copies the db to a private temporary db. Only a read
+// transaction is held on the db while copying. The returned function
+// closes and removes the copy.
+func snapshotDb(db wdb.RODB) (*bolt.DB, func(), error) {
+	fp, err := ioutil.TempFile("", "heketi-report-")
+	if err != nil {
+		return nil, nil, err
+	}
+	dbfile := fp.Name()
+	err = db.View(func(tx *bolt.Tx) error {
+		_, err := tx.WriteTo(fp)
+		return err
+	})
+	if cerr := fp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(dbfile)
+		return nil, nil, err
+	}
+
+	snapshot, err := bolt.Open(dbfile, 0600, &bolt.Options{Timeout: 3 * time.Second})
+	if err != nil {
+		os.Remove(dbfile)
+		return nil, nil, err
+	}
+	return snapshot, func() {
+		snapshot.Close()
+		os.Remove(dbfile)
+	}, nil
+}
+
+// StorageClassReport evaluates every cluster against the volume spec of
+// the request and reports whether a volume of the spec can be created on
+// the cluster and how many fit. The volumes are counted on a private
+// copy of the db so the db is left unchanged and no write transaction
+// is held on it.
+func StorageClassReport(db wdb.RODB,
+	allocator Allocator,
+	req *api.StorageClassReportRequest) (*api.StorageClassReportResponse, error) {
+
+	resp := &api.StorageClassReportResponse{
+		StorageClassReportRequest: *req,
+		Clusters:                  []api.StorageClassClusterReport{},
+	}
+	if resp.ZonePolicy == "" {
+		resp.ZonePolicy = BrickZonePolicy
+	}
+
+	snapshot, cleanup, err := snapshotDb(db)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	var clusters []string
+	err = snapshot.View(func(tx *bolt.Tx) error {
+		var err error
+		clusters, err = ClusterList(tx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Each cluster is evaluated in its own transaction of the copy,
+	// rolled back once the volumes are counted
+	for _, id := range clusters {
+		var report *api.StorageClassClusterReport
+		err := snapshot.Update(func(tx *bolt.Tx) error {
+			c, err := NewClusterEntryFromId(tx, id)
+			if err != nil {
+				return err
+			}
+			report, err = reportCluster(tx, allocator, req, resp.ZonePolicy, c)
+			if err != nil {
+				return err
+			}
+			return errStorageClassReportRollback
+		})
+		if err != errStorageClassReportRollback {
+			return nil, err
+		}
+		resp.Clusters = append(resp.Clusters, *report)
+	}
+	return resp, nil
+}
@@ -0,0 +1,198 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/gorilla/mux"
+	client "github.com/heketi/heketi/client/api/go-client"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/tests"
+)
+
+func TestStorageClassReport(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	err := setupSampleDbWithTopology(app,
+		2,    // clusters
+		3,    // nodes_per_cluster
+		1,    // devices_per_node,
+		1*TB, // disksize
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// Block volumes only on the second cluster
+	var blockCluster string
+	app.db.Update(func(tx *bolt.Tx) error {
+		clusters, err := ClusterList(tx)
+		tests.Assert(t, err == nil)
+		c, err := NewClusterEntryFromId(tx, clusters[1])
+		tests.Assert(t, err == nil)
+		c.Info.File = false
+		blockCluster = c.Info.Id
+		return c.Save(tx)
+	})
+
+	req := &api.StorageClassReportRequest{}
+	req.Size = 200
+	req.Durability.Type = api.DurabilityReplicate
+	req.Durability.Replicate.Replica = 3
+
+	report, err := StorageClassReport(app.db, app.Allocator(), req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, report.ZonePolicy == BrickZonePolicyNone, report.ZonePolicy)
+	tests.Assert(t, len(report.Clusters) == 2, report.Clusters)
+	for _, c := range report.Clusters {
+		tests.Assert(t, c.Zones == 2, c)
+		if c.Id == blockCluster {
+			tests.Assert(t, !c.Conforms, c)
+			tests.Assert(t, c.Volumes == 0, c)
+			tests.Assert(t, c.Reason != "", c)
+			continue
+		}
+		// Each of the 3 devices of 1TB holds a brick of 200GB
+		// of 5 volumes
+		tests.Assert(t, c.Conforms, c)
+		tests.Assert(t, c.Volumes == 5, c)
+		tests.Assert(t, !c.Limited, c)
+	}
+
+	// Nothing was allocated
+	app.db.View(func(tx *bolt.Tx) error {
+		bl, err := BrickList(tx)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, len(bl) == 0, bl)
+		vl, err := VolumeList(tx)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, len(vl) == 0, vl)
+		dl, err := DeviceList(tx)
+		tests.Assert(t, err == nil)
+		for _, id := range dl {
+			d, err := NewDeviceEntryFromId(tx, id)
+			tests.Assert(t, err == nil)
+			tests.Assert(t, d.Info.Storage.Used == 0, d.Info.Storage)
+		}
+		return nil
+	})
+
+	// The sample nodes are spread over only two zones
+	req.ZonePolicy = BrickZonePolicyStrict
+	report, err = StorageClassReport(app.db, app.Allocator(), req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	for _, c := range report.Clusters {
+		tests.Assert(t, !c.Conforms, c)
+		if c.Id != blockCluster {
+			tests.Assert(t, strings.Contains(c.Reason, "zones"), c.Reason)
+		}
+	}
+
+	req.ZonePolicy = BrickZonePolicyBestEffort
+	report, err = StorageClassReport(app.db, app.Allocator(), req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	for _, c := range report.Clusters {
+		tests.Assert(t, c.Conforms == (c.Id != blockCluster), c)
+	}
+
+	// Volumes too large for the devices
+	req.ZonePolicy = ""
+	req.Size = 2000
+	report, err = StorageClassReport(app.db, app.Allocator(), req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	for _, c := range report.Clusters {
+		tests.Assert(t, !c.Conforms, c)
+		tests.Assert(t, c.Reason != "", c)
+	}
+}
+
+func TestStorageClassReportLimited(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		3,    // nodes_per_cluster
+		1,    // devices_per_node,
+		2*TB, // disksize
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	defer func(max int) {
+		StorageClassReportMaxVolumes = max
+	}(StorageClassReportMaxVolumes)
+	StorageClassReportMaxVolumes = 3
+
+	req := &api.StorageClassReportRequest{}
+	req.Size = 10
+
+	report, err := StorageClassReport(app.db, app.Allocator(), req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(report.Clusters) == 1, report.Clusters)
+	c := report.Clusters[0]
+	tests.Assert(t, c.Conforms, c)
+	tests.Assert(t, c.Volumes == 3, c)
+	tests.Assert(t, c.Limited, c)
+}
+
+func TestStorageClassReportHttp(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	c := client.NewClientNoAuth(ts.URL)
+	tests.Assert(t, c != nil)
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		3,    // nodes_per_cluster
+		1,    // devices_per_node,
+		2*TB, // disksize
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	req := &api.StorageClassReportRequest{}
+	req.Size = 500
+	req.Durability.Type = api.DurabilityReplicate
+	req.Durability.Replicate.Replica = 3
+
+	report, err := c.StorageClassReport(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, report.Size == 500)
+	tests.Assert(t, len(report.Clusters) == 1, report.Clusters)
+	tests.Assert(t, report.Clusters[0].Conforms, report.Clusters[0])
+	tests.Assert(t, report.Clusters[0].Volumes > 0, report.Clusters[0])
+
+	req.ZonePolicy = "everywhere"
+	_, err = c.StorageClassReport(req)
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	req.ZonePolicy = ""
+	req.Durability.Replicate.Replica = 5
+	_, err = c.StorageClassReport(req)
+	tests.Assert(t, err != nil, "expected err != nil")
+}
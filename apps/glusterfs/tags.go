@@ -0,0 +1,185 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"github.com/boltdb/bolt"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+)
+
+// copyTags returns a copy of the tags, or nil if there are none
+func copyTags(tags map[string]string) map[string]string {
+	if len(tags) == 0 {
+		return nil
+	}
+	c := make(map[string]string, len(tags))
+	for k, v := range tags {
+		c[k] = v
+	}
+	return c
+}
+
+// applyTagsChange returns the tags changed by the request
+func applyTagsChange(tags map[string]string,
+	req *api.TagsChangeRequest) map[string]string {
+
+	switch req.Change {
+	case api.SetTags:
+		return copyTags(req.Tags)
+	case api.UpdateTags:
+		c := copyTags(tags)
+		if c == nil {
+			c = map[string]string{}
+		}
+		for k, v := range req.Tags {
+			c[k] = v
+		}
+		return copyTags(c)
+	case api.DeleteTags:
+		c := copyTags(tags)
+		for k := range req.Tags {
+			delete(c, k)
+		}
+		return copyTags(c)
+	}
+	return tags
+}
+
+// mergeTags returns the tags of a device on a node with the node tags,
+// the device tags taking precedence
+func mergeTags(nodeTags, deviceTags map[string]string) map[string]string {
+	tags := make(map[string]string, len(nodeTags)+len(deviceTags))
+	for k, v := range nodeTags {
+		tags[k] = v
+	}
+	for k, v := range deviceTags {
+		tags[k] = v
+	}
+	return tags
+}
+
+// tagsMatch returns true if the tags have all the keys of match with
+// the same values
+func tagsMatch(tags, match map[string]string) bool {
+	for k, v := range match {
+		if value, ok := tags[k]; !ok || value != v {
+			return false
+		}
+	}
+	return true
+}
+
+// placementEmpty returns true if the placement does not restrict the
+// devices of the bricks
+func placementEmpty(p *api.VolumePlacement) bool {
+	return len(p.TagMatch) == 0 && p.SpreadTag == "" && !p.SpreadEnclosure
+}
+
+func cachedNode(tx *bolt.Tx,
+	nodecache map[string](*NodeEntry),
+	nodeId string) (*NodeEntry, error) {
+
+	node, ok := nodecache[nodeId]
+	if !ok {
+		var err error
+		node, err = NewNodeEntryFromId(tx, nodeId)
+		if err != nil {
+			return nil, err
+		}
+		nodecache[nodeId] = node
+	}
+	return node, nil
+}
+
+// cachedDeviceTags returns the tags of the device merged with the tags
+// of its node
+func cachedDeviceTags(tx *bolt.Tx,
+	nodecache map[string](*NodeEntry),
+	device *DeviceEntry) (map[string]string, error) {
+
+	node, err := cachedNode(tx, nodecache, device.NodeId)
+	if err != nil {
+		return nil, err
+	}
+	return node.deviceTags(device.Info.Id), nil
+}
+
+// cachedDeviceEnclosure returns the enclosure of the device, empty if
+// the device is not in an enclosure
+func cachedDeviceEnclosure(tx *bolt.Tx,
+	nodecache map[string](*NodeEntry),
+	device *DeviceEntry) (string, error) {
+
+	node, err := cachedNode(tx, nodecache, device.NodeId)
+	if err != nil {
+		return "", err
+	}
+	return node.DeviceEnclosures[device.Info.Id], nil
+}
+
+// devicePlacementOk returns false if the tags of the device do not
+// match the placement, or if the device has the same value of the
+// spread tag, or is in the same enclosure, as the device of a brick
+// of the set
+func devicePlacementOk(tx *bolt.Tx,
+	devcache map[string](*DeviceEntry),
+	nodecache map[string](*NodeEntry),
+	device *DeviceEntry,
+	setlist []*BrickEntry,
+	placement *api.VolumePlacement) (bool, error) {
+
+	if placementEmpty(placement) {
+		return true, nil
+	}
+
+	tags, err := cachedDeviceTags(tx, nodecache, device)
+	if err != nil {
+		return false, err
+	}
+	if !tagsMatch(tags, placement.TagMatch) {
+		return false, nil
+	}
+	enclosure := ""
+	if placement.SpreadEnclosure {
+		enclosure, err = cachedDeviceEnclosure(tx, nodecache, device)
+		if err != nil {
+			return false, err
+		}
+	}
+	if placement.SpreadTag == "" && enclosure == "" {
+		return true, nil
+	}
+
+	for _, brickInSet := range setlist {
+		d, err := cachedDevice(tx, devcache, brickInSet.Info.DeviceId)
+		if err != nil {
+			return false, err
+		}
+		if placement.SpreadTag != "" {
+			brickTags, err := cachedDeviceTags(tx, nodecache, d)
+			if err != nil {
+				return false, err
+			}
+			if brickTags[placement.SpreadTag] == tags[placement.SpreadTag] {
+				return false, nil
+			}
+		}
+		if enclosure != "" {
+			brickEnclosure, err := cachedDeviceEnclosure(tx, nodecache, d)
+			if err != nil {
+				return false, err
+			}
+			if brickEnclosure == enclosure {
+				return false, nil
+			}
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,355 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/gorilla/mux"
+	client "github.com/heketi/heketi/client/api/go-client"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/tests"
+)
+
+func TestApplyTagsChange(t *testing.T) {
+	tags := map[string]string{"rack": "r1", "media": "ssd"}
+
+	c := applyTagsChange(tags, &api.TagsChangeRequest{
+		Tags:   map[string]string{"rack": "r2", "chassis": "c1"},
+		Change: api.UpdateTags,
+	})
+	tests.Assert(t, reflect.DeepEqual(c, map[string]string{
+		"rack": "r2", "media": "ssd", "chassis": "c1"}), c)
+	tests.Assert(t, tags["rack"] == "r1", tags)
+
+	c = applyTagsChange(tags, &api.TagsChangeRequest{
+		Tags:   map[string]string{"rack": ""},
+		Change: api.DeleteTags,
+	})
+	tests.Assert(t, reflect.DeepEqual(c, map[string]string{"media": "ssd"}), c)
+
+	c = applyTagsChange(tags, &api.TagsChangeRequest{
+		Tags:   map[string]string{"zone": "a"},
+		Change: api.SetTags,
+	})
+	tests.Assert(t, reflect.DeepEqual(c, map[string]string{"zone": "a"}), c)
+
+	c = applyTagsChange(tags, &api.TagsChangeRequest{
+		Change: api.SetTags,
+	})
+	tests.Assert(t, c == nil, c)
+}
+
+func TestMergeTags(t *testing.T) {
+	tags := mergeTags(map[string]string{"rack": "r1", "media": "hdd"},
+		map[string]string{"media": "ssd"})
+	tests.Assert(t, reflect.DeepEqual(tags, map[string]string{
+		"rack": "r1", "media": "ssd"}), tags)
+	tests.Assert(t, tagsMatch(tags, map[string]string{"media": "ssd"}))
+	tests.Assert(t, tagsMatch(tags, nil))
+	tests.Assert(t, !tagsMatch(tags, map[string]string{"media": "hdd"}))
+	tests.Assert(t, !tagsMatch(tags, map[string]string{"chassis": ""}))
+}
+
+func TestNodeDeviceSetTags(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	c := client.NewClientNoAuth(ts.URL)
+	tests.Assert(t, c != nil)
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		3,    // nodes_per_cluster
+		1,    // devices_per_node,
+		2*TB, // disksize
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	var node *NodeEntry
+	err = app.db.View(func(tx *bolt.Tx) error {
+		nodes, err := NodeList(tx)
+		if err != nil {
+			return err
+		}
+		node, err = NewNodeEntryFromId(tx, nodes[0])
+		return err
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	info, err := c.NodeSetTags(node.Info.Id, &api.TagsChangeRequest{
+		Tags:   map[string]string{"rack": "r1", "chassis": "c1"},
+		Change: api.UpdateTags,
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(info.Tags) == 2, info.Tags)
+
+	info, err = c.NodeSetTags(node.Info.Id, &api.TagsChangeRequest{
+		Tags:   map[string]string{"chassis": ""},
+		Change: api.DeleteTags,
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, reflect.DeepEqual(info.Tags, map[string]string{"rack": "r1"}),
+		info.Tags)
+
+	// The tags are saved
+	info, err = c.NodeInfo(node.Info.Id)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, info.Tags["rack"] == "r1", info.Tags)
+
+	dinfo, err := c.DeviceSetTags(node.Devices[0], &api.TagsChangeRequest{
+		Tags:   map[string]string{"media": "ssd"},
+		Change: api.SetTags,
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, dinfo.Tags["media"] == "ssd", dinfo.Tags)
+
+	dinfo, err = c.DeviceInfo(node.Devices[0])
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, dinfo.Tags["media"] == "ssd", dinfo.Tags)
+
+	// Invalid tag key
+	_, err = c.NodeSetTags(node.Info.Id, &api.TagsChangeRequest{
+		Tags:   map[string]string{"rack id": "r1"},
+		Change: api.UpdateTags,
+	})
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	// Unknown change
+	_, err = c.DeviceSetTags(node.Devices[0], &api.TagsChangeRequest{
+		Tags:   map[string]string{"rack": "r1"},
+		Change: "merge",
+	})
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	_, err = c.NodeSetTags("12345678901234567890123456789012", &api.TagsChangeRequest{
+		Change: api.SetTags,
+	})
+	tests.Assert(t, err != nil, "expected err != nil")
+}
+
+func TestVolumeCreatePlacementTags(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	c := client.NewClientNoAuth(ts.URL)
+	tests.Assert(t, c != nil)
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		4,    // nodes_per_cluster
+		2,    // devices_per_node,
+		2*TB, // disksize
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// Two nodes in rack r1, one in r2 and one in r3. The first device
+	// of each node is an ssd, the node default being hdd.
+	racks := []string{"r1", "r1", "r2", "r3"}
+	ssd := map[string]bool{}
+	err = app.db.Update(func(tx *bolt.Tx) error {
+		clusters, err := ClusterList(tx)
+		if err != nil {
+			return err
+		}
+		cluster, err := NewClusterEntryFromId(tx, clusters[0])
+		if err != nil {
+			return err
+		}
+		for i, nodeId := range cluster.Info.Nodes {
+			node, err := NewNodeEntryFromId(tx, nodeId)
+			if err != nil {
+				return err
+			}
+			node.Info.Tags = map[string]string{"rack": racks[i], "media": "hdd"}
+			node.SetDeviceTags(node.Devices[0], map[string]string{"media": "ssd"})
+			if err := node.Save(tx); err != nil {
+				return err
+			}
+			ssd[node.Devices[0]] = true
+		}
+		return nil
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// With three racks, each set has a brick in every rack
+	checkBricks := func(vol *api.VolumeInfoResponse) {
+		rackBricks := map[string]int{}
+		err := app.db.View(func(tx *bolt.Tx) error {
+			for _, b := range vol.Bricks {
+				tests.Assert(t, ssd[b.DeviceId], "brick on hdd", b)
+				node, err := NewNodeEntryFromId(tx, b.NodeId)
+				if err != nil {
+					return err
+				}
+				rackBricks[node.Info.Tags["rack"]]++
+			}
+			return nil
+		})
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		sets := len(vol.Bricks) / 3
+		tests.Assert(t, len(rackBricks) == 3, rackBricks)
+		for rack, n := range rackBricks {
+			tests.Assert(t, n == sets, "rack", rack, "has", n, "bricks")
+		}
+	}
+
+	req := &api.VolumeCreateRequest{}
+	req.Size = 100
+	req.Durability.Type = api.DurabilityReplicate
+	req.Durability.Replicate.Replica = 3
+	req.Placement.TagMatch = map[string]string{"media": "ssd"}
+	req.Placement.SpreadTag = "rack"
+	for i := 0; i < 4; i++ {
+		vol, err := c.VolumeCreate(req)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, len(vol.Bricks) == 3, vol.Bricks)
+		tests.Assert(t, vol.Placement.SpreadTag == "rack", vol.Placement)
+		checkBricks(vol)
+
+		// Expanding the volume follows its placement
+		vol, err = c.VolumeExpand(vol.Id, &api.VolumeExpandRequest{Size: 100})
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, len(vol.Bricks) == 6, vol.Bricks)
+		checkBricks(vol)
+	}
+
+	// No device has the tag
+	req.Placement.TagMatch = map[string]string{"media": "nvme"}
+	_, err = c.VolumeCreate(req)
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	// Only three racks for four bricks in a set
+	req.Size = 1
+	req.Placement.TagMatch = nil
+	req.Durability.Type = api.DurabilityEC
+	req.Durability.Disperse.Data = 2
+	req.Durability.Disperse.Redundancy = 2
+	_, err = c.VolumeCreate(req)
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	// Invalid spread tag
+	req.Placement.SpreadTag = "rack id"
+	_, err = c.VolumeCreate(req)
+	tests.Assert(t, err != nil, "expected err != nil")
+}
+
+func TestVolumeCreateSpreadEnclosure(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	c := client.NewClientNoAuth(ts.URL)
+	tests.Assert(t, c != nil)
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		4,    // nodes_per_cluster
+		2,    // devices_per_node,
+		2*TB, // disksize
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	var clusterId string
+	err = app.db.View(func(tx *bolt.Tx) error {
+		clusters, err := ClusterList(tx)
+		if err != nil {
+			return err
+		}
+		clusterId = clusters[0]
+		return nil
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	cluster, err := c.ClusterInfo(clusterId)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	setEnclosure := func(nodeId, enclosure string) {
+		node, err := c.NodeInfo(nodeId)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		for _, d := range node.DevicesInfo {
+			info, err := c.DeviceSetEnclosure(d.Id, &api.DeviceEnclosureRequest{
+				Enclosure: enclosure,
+			})
+			tests.Assert(t, err == nil, "expected err == nil, got:", err)
+			tests.Assert(t, info.Enclosure == enclosure, info.Enclosure)
+		}
+	}
+
+	// The first two nodes share an enclosure
+	setEnclosure(cluster.Nodes[0], "jbod1")
+	setEnclosure(cluster.Nodes[1], "jbod1")
+	setEnclosure(cluster.Nodes[2], "jbod2")
+	setEnclosure(cluster.Nodes[3], "jbod3")
+
+	req := &api.VolumeCreateRequest{}
+	req.Size = 10
+	req.Durability.Type = api.DurabilityReplicate
+	req.Durability.Replicate.Replica = 3
+	req.Placement.SpreadEnclosure = true
+	for i := 0; i < 4; i++ {
+		vol, err := c.VolumeCreate(req)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, len(vol.Bricks) == 3, vol.Bricks)
+		tests.Assert(t, vol.Placement.SpreadEnclosure, vol.Placement)
+
+		seen := map[string]bool{}
+		for _, b := range vol.Bricks {
+			d, err := c.DeviceInfo(b.DeviceId)
+			tests.Assert(t, err == nil, "expected err == nil, got:", err)
+			tests.Assert(t, !seen[d.Enclosure], "enclosure used twice", d.Enclosure)
+			seen[d.Enclosure] = true
+		}
+	}
+
+	// Only two enclosures left for three bricks in a set
+	setEnclosure(cluster.Nodes[3], "jbod2")
+	_, err = c.VolumeCreate(req)
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	// Devices without an enclosure are not grouped
+	setEnclosure(cluster.Nodes[3], "")
+	vol, err := c.VolumeCreate(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(vol.Bricks) == 3, vol.Bricks)
+
+	// Invalid enclosure
+	node, err := c.NodeInfo(cluster.Nodes[0])
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	_, err = c.DeviceSetEnclosure(node.DevicesInfo[0].Id,
+		&api.DeviceEnclosureRequest{Enclosure: "jbod 1"})
+	tests.Assert(t, err != nil, "expected err != nil")
+}
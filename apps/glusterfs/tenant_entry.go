@@ -0,0 +1,408 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/boltdb/bolt"
+	wdb "github.com/heketi/heketi/pkg/db"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/lpabon/godbc"
+)
+
+const (
+	BOLTDB_BUCKET_TENANT = "TENANT"
+)
+
+// TenantEntry is a group of users whose volumes and block volumes are
+// limited on each cluster. The users are the subjects of the tokens
+// of the requests. The entries are keyed by the name of the tenant.
+type TenantEntry struct {
+	Name string
+	Info api.TenantRequest
+}
+
+func TenantList(tx *bolt.Tx) ([]string, error) {
+	list := EntryKeys(tx, BOLTDB_BUCKET_TENANT)
+	if list == nil {
+		return nil, ErrAccessList
+	}
+	return list, nil
+}
+
+func NewTenantEntry() *TenantEntry {
+	return &TenantEntry{}
+}
+
+func NewTenantEntryFromRequest(name string, req *api.TenantRequest) *TenantEntry {
+	godbc.Require(name != "")
+	godbc.Require(req != nil)
+
+	entry := NewTenantEntry()
+	entry.Name = name
+	entry.Info = *req
+
+	return entry
+}
+
+func NewTenantEntryFromId(tx *bolt.Tx, name string) (*TenantEntry, error) {
+	godbc.Require(tx != nil)
+
+	entry := NewTenantEntry()
+	err := EntryLoad(tx, entry, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+// UserTenant returns the tenant of the user, or nil if the user is in
+// no tenant
+func UserTenant(tx *bolt.Tx, user string) (*TenantEntry, error) {
+	if user == "" {
+		return nil, nil
+	}
+	names, err := TenantList(tx)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		t, err := NewTenantEntryFromId(tx, name)
+		if err != nil {
+			return nil, err
+		}
+		if t.hasUser(user) {
+			return t, nil
+		}
+	}
+	return nil, nil
+}
+
+func (t *TenantEntry) hasUser(user string) bool {
+	for _, u := range t.Info.Users {
+		if u == user {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *TenantEntry) BucketName() string {
+	return BOLTDB_BUCKET_TENANT
+}
+
+func (t *TenantEntry) Save(tx *bolt.Tx) error {
+	godbc.Require(tx != nil)
+	godbc.Require(t.Name != "")
+
+	return EntrySave(tx, t, t.Name)
+}
+
+func (t *TenantEntry) Delete(tx *bolt.Tx) error {
+	return EntryDelete(tx, t, t.Name)
+}
+
+func (t *TenantEntry) Marshal() ([]byte, error) {
+	var buffer bytes.Buffer
+	enc := gob.NewEncoder(&buffer)
+	err := enc.Encode(*t)
+
+	return buffer.Bytes(), err
+}
+
+func (t *TenantEntry) Unmarshal(buffer []byte) error {
+	dec := gob.NewDecoder(bytes.NewReader(buffer))
+	err := dec.Decode(t)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (t *TenantEntry) NewInfoResponse(tx *bolt.Tx) (*api.TenantInfoResponse, error) {
+	godbc.Require(tx != nil)
+
+	usage, err := t.Usage(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &api.TenantInfoResponse{
+		Name:          t.Name,
+		TenantRequest: t.Info,
+		Usage:         usage,
+	}
+	if info.Users == nil {
+		info.Users = []string{}
+	}
+	return info, nil
+}
+
+// NewUsageResponse returns the usage of the tenant on every cluster
+// against its limits there
+func (t *TenantEntry) NewUsageResponse(tx *bolt.Tx) (*api.TenantUsageResponse, error) {
+	godbc.Require(tx != nil)
+
+	usage, err := t.Usage(tx)
+	if err != nil {
+		return nil, err
+	}
+	clusters, err := ClusterList(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &api.TenantUsageResponse{
+		Name:     t.Name,
+		Clusters: map[string]api.TenantClusterUsage{},
+	}
+	for _, id := range clusters {
+		resp.Clusters[id] = api.TenantClusterUsage{
+			Limits: t.limits(id),
+			Usage:  usage[id],
+		}
+	}
+	return resp, nil
+}
+
+// limits returns the limits of the tenant on the cluster
+func (t *TenantEntry) limits(clusterId string) api.TenantLimits {
+	if l, ok := t.Info.Clusters[clusterId]; ok {
+		return l
+	}
+	return t.Info.Limits
+}
+
+// Usage returns the volumes and block volumes of the tenant on each
+// cluster holding some. Volumes still being created or expanded are
+// included.
+func (t *TenantEntry) Usage(tx *bolt.Tx) (map[string]api.TenantUsage, error) {
+	usage := map[string]api.TenantUsage{}
+
+	volumes, err := VolumeList(tx)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range volumes {
+		v, err := NewVolumeEntryFromId(tx, id)
+		if err != nil {
+			return nil, err
+		}
+		if v.Info.Tenant != t.Name || v.Info.Cluster == "" {
+			continue
+		}
+		u := usage[v.Info.Cluster]
+		u.SizeMiB += v.sizeMiB()
+		u.Volumes++
+		usage[v.Info.Cluster] = u
+	}
+
+	blockVolumes, err := BlockVolumeList(tx)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range blockVolumes {
+		bv, err := NewBlockVolumeEntryFromId(tx, id)
+		if err != nil {
+			return nil, err
+		}
+		if bv.Info.Tenant != t.Name || bv.Info.Cluster == "" {
+			continue
+		}
+		u := usage[bv.Info.Cluster]
+		u.SizeMiB += bv.sizeMiB()
+		u.BlockVolumes++
+		usage[bv.Info.Cluster] = u
+	}
+
+	// The sizes of the volumes only grow once their expansion is
+	// done, until then the expansion is only found in its operation
+	ops, err := PendingOperationList(tx)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ops {
+		op, err := NewPendingOperationEntryFromId(tx, id)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range op.Actions {
+			var tenant, cluster string
+			switch a.Change {
+			case OpExpandVolume:
+				v, err := NewVolumeEntryFromId(tx, a.Id)
+				if err != nil {
+					return nil, err
+				}
+				tenant, cluster = v.Info.Tenant, v.Info.Cluster
+			case OpExpandBlockVolume:
+				bv, err := NewBlockVolumeEntryFromId(tx, a.Id)
+				if err != nil {
+					return nil, err
+				}
+				tenant, cluster = bv.Info.Tenant, bv.Info.Cluster
+			default:
+				continue
+			}
+			if tenant != t.Name || cluster == "" {
+				continue
+			}
+			sizeGB, err := a.ExpandSize()
+			if err != nil {
+				return nil, err
+			}
+			u := usage[cluster]
+			u.SizeMiB += sizeGB * 1024
+			usage[cluster] = u
+		}
+	}
+
+	return usage, nil
+}
+
+// exceeded returns why adding the given volumes to the usage of the
+// tenant on the cluster exceeds the limits of the tenant, or "" if
+// they fit
+func (t *TenantEntry) exceeded(clusterId string, usage api.TenantUsage,
+	sizeMiB, volumes, blockVolumes int) string {
+
+	l := t.limits(clusterId)
+	switch {
+	case l.SizeGb > 0 && usage.SizeMiB+sizeMiB > l.SizeGb*1024:
+		return fmt.Sprintf("%v MiB more would provision %v MiB of the %v GiB limit",
+			sizeMiB, usage.SizeMiB+sizeMiB, l.SizeGb)
+	case l.Volumes > 0 && usage.Volumes+volumes > l.Volumes:
+		return fmt.Sprintf("the limit of %v volumes is reached", l.Volumes)
+	case l.BlockVolumes > 0 && usage.BlockVolumes+blockVolumes > l.BlockVolumes:
+		return fmt.Sprintf("the limit of %v block volumes is reached",
+			l.BlockVolumes)
+	}
+	return ""
+}
+
+// TenantQuotaError is returned when the limits of a tenant leave no
+// room for a request on any of the clusters it could use
+type TenantQuotaError struct {
+	Tenant string
+	// Why each cluster was rejected, by cluster id
+	Reasons map[string]string
+}
+
+func (e *TenantQuotaError) Error() string {
+	if len(e.Reasons) == 1 {
+		for id, reason := range e.Reasons {
+			return fmt.Sprintf("Tenant %v quota exceeded on cluster %v: %v",
+				e.Tenant, id, reason)
+		}
+	}
+	ids := make([]string, 0, len(e.Reasons))
+	for id := range e.Reasons {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	reasons := make([]string, 0, len(ids))
+	for _, id := range ids {
+		reasons = append(reasons, fmt.Sprintf("cluster %v: %v", id, e.Reasons[id]))
+	}
+	return fmt.Sprintf("Tenant %v quota exceeded on every cluster: %v",
+		e.Tenant, strings.Join(reasons, "; "))
+}
+
+// clustersWithRoom returns the clusters among the candidates, or among
+// the active clusters if there are none, where the limits of the tenant
+// leave room for the given volumes. A TenantQuotaError is returned if
+// there is room on none of them.
+func (t *TenantEntry) clustersWithRoom(tx *bolt.Tx, candidates []string,
+	sizeMiB, volumes, blockVolumes int) ([]string, error) {
+
+	if len(candidates) == 0 {
+		var err error
+		candidates, err = ActiveClusterList(tx)
+		if err != nil {
+			return nil, err
+		}
+	}
+	usage, err := t.Usage(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	clusters := []string{}
+	reasons := map[string]string{}
+	for _, id := range candidates {
+		if reason := t.exceeded(id, usage[id], sizeMiB, volumes, blockVolumes); reason != "" {
+			reasons[id] = reason
+			continue
+		}
+		clusters = append(clusters, id)
+	}
+	if len(clusters) == 0 && len(reasons) != 0 {
+		return nil, &TenantQuotaError{Tenant: t.Name, Reasons: reasons}
+	}
+	return clusters, nil
+}
+
+// tenantClustersWithRoom returns the clusters among the candidates
+// where the limits of the named tenant leave room for the given
+// volumes, see clustersWithRoom. The candidates are returned as they
+// are if there is no such tenant, the volumes of a deleted tenant are
+// not limited. It is called in the transaction saving the volumes so
+// that concurrent requests can not go over the limits together.
+func tenantClustersWithRoom(tx *bolt.Tx, name string, candidates []string,
+	sizeMiB, volumes, blockVolumes int) ([]string, error) {
+
+	t, err := NewTenantEntryFromId(tx, name)
+	if err == ErrNotFound {
+		return candidates, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return t.clustersWithRoom(tx, candidates, sizeMiB, volumes, blockVolumes)
+}
+
+// volumeTenant returns the tenant the volume is charged to, or "" if it
+// is charged to none or can not be read
+func volumeTenant(db wdb.RODB, id string) string {
+	var tenant string
+	db.View(func(tx *bolt.Tx) error {
+		v, err := NewVolumeEntryFromId(tx, id)
+		if err != nil {
+			return err
+		}
+		tenant = v.Info.Tenant
+		return nil
+	})
+	return tenant
+}
+
+// operationTenant returns the tenant the volumes of the operation are
+// charged to, if any
+func operationTenant(op Operation) string {
+	switch o := op.(type) {
+	case *VolumeCreateOperation:
+		return o.vol.Info.Tenant
+	case *VolumeExpandOperation:
+		return o.vol.Info.Tenant
+	case *BlockVolumeCreateOperation:
+		return o.bvol.Info.Tenant
+	case *BlockVolumeExpandOperation:
+		return o.bvol.Info.Tenant
+	case *BlockVolumeCloneOperation:
+		return o.bvol.Info.Tenant
+	}
+	return ""
+}
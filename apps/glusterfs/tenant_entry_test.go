@@ -0,0 +1,276 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/gorilla/mux"
+	client "github.com/heketi/heketi/client/api/go-client"
+	"github.com/heketi/heketi/middleware"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/tests"
+	"github.com/urfave/negroni"
+)
+
+func TestTenantQuota(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	// The users are only known with authentication enabled
+	n := negroni.New()
+	n.Use(middleware.NewJwtAuth(&middleware.JwtAuthConfig{
+		Admin: middleware.Issuer{PrivateKey: "adminkey"},
+		User:  middleware.Issuer{PrivateKey: "userkey"},
+	}))
+	n.UseFunc(app.Auth)
+	n.UseHandler(router)
+
+	ts := httptest.NewServer(n)
+	defer ts.Close()
+
+	admin := client.NewClient(ts.URL, "admin", "adminkey")
+	alice := client.NewClient(ts.URL, "admin", "adminkey")
+	alice.SetSubject("alice")
+	bob := client.NewClient(ts.URL, "admin", "adminkey")
+	bob.SetSubject("bob")
+
+	err := setupSampleDbWithTopology(app,
+		2,    // clusters
+		3,    // nodes_per_cluster
+		2,    // devices_per_node,
+		2*TB, // disksize
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	_, err = admin.TenantSet("team a", &api.TenantRequest{})
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	tenant, err := admin.TenantSet("team-a", &api.TenantRequest{
+		Users:  []string{"alice"},
+		Limits: api.TenantLimits{Volumes: 1},
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, tenant.Name == "team-a", tenant)
+	tests.Assert(t, len(tenant.Usage) == 0, tenant.Usage)
+
+	// A user is in one tenant at most
+	_, err = admin.TenantSet("team-b", &api.TenantRequest{
+		Users: []string{"alice"},
+	})
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	req := &api.VolumeCreateRequest{}
+	req.Size = 10
+	req.Durability.Type = api.DurabilityReplicate
+	req.Durability.Replicate.Replica = 3
+
+	// Once the limit is reached on a cluster the next one is used
+	clusters := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		vol, err := alice.VolumeCreate(req)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, vol.Tenant == "team-a", vol.Tenant)
+		clusters[vol.Cluster] = true
+	}
+	tests.Assert(t, len(clusters) == 2, clusters)
+
+	_, err = alice.VolumeCreate(req)
+	tests.Assert(t, err != nil, "expected err != nil")
+	tests.Assert(t, strings.Contains(err.Error(),
+		"Tenant team-a quota exceeded on every cluster"), err)
+
+	// The users of no tenant are not limited
+	vol, err := bob.VolumeCreate(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, vol.Tenant == "", vol.Tenant)
+
+	tenant, err = admin.TenantInfo("team-a")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(tenant.Usage) == 2, tenant.Usage)
+	for id, u := range tenant.Usage {
+		tests.Assert(t, u.Volumes == 1 && u.SizeMiB == 10*1024, id, u)
+	}
+
+	// The size of the volumes is limited on a given cluster
+	var cluster string
+	for id := range clusters {
+		cluster = id
+	}
+	_, err = admin.TenantSet("team-a", &api.TenantRequest{
+		Users: []string{"alice"},
+		Clusters: map[string]api.TenantLimits{
+			cluster: api.TenantLimits{SizeGb: 15},
+		},
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	var tenantVol string
+	list, err := admin.VolumeList()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	for _, id := range list.Volumes {
+		info, err := admin.VolumeInfo(id)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		if info.Tenant == "team-a" && info.Cluster == cluster {
+			tenantVol = id
+		}
+	}
+	_, err = admin.VolumeExpand(tenantVol, &api.VolumeExpandRequest{Size: 10})
+	tests.Assert(t, err != nil, "expected err != nil")
+	tests.Assert(t, strings.Contains(err.Error(),
+		"Tenant team-a quota exceeded on cluster "+cluster), err)
+	_, err = admin.VolumeExpand(tenantVol, &api.VolumeExpandRequest{Size: 5})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// The usage is shown on every cluster against the limits there
+	usage, err := admin.TenantUsage("team-a")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(usage.Clusters) == 2, usage.Clusters)
+	for id, c := range usage.Clusters {
+		tests.Assert(t, c.Usage.Volumes == 1, id, c)
+		if id == cluster {
+			tests.Assert(t, c.Limits.SizeGb == 15, id, c)
+			tests.Assert(t, c.Usage.SizeMiB == 15*1024, id, c)
+		} else {
+			tests.Assert(t, c.Limits.SizeGb == 0, id, c)
+		}
+	}
+
+	// Users only see the usage of their own tenant
+	aliceUser := client.NewClient(ts.URL, "user", "userkey")
+	aliceUser.SetSubject("alice")
+	usage, err = aliceUser.TenantUsage("team-a")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, usage.Name == "team-a", usage)
+	bobUser := client.NewClient(ts.URL, "user", "userkey")
+	bobUser.SetSubject("bob")
+	_, err = bobUser.TenantUsage("team-a")
+	tests.Assert(t, err != nil, "expected err != nil")
+	tests.Assert(t, strings.Contains(err.Error(), "not in tenant team-a"), err)
+	_, err = aliceUser.TenantInfo("team-a")
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	// As well as the events about the volumes of their tenant
+	events, err := admin.EventList(0)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(events.Events) == 3, events.Events)
+	events, err = aliceUser.EventList(0)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(events.Events) == 2, events.Events)
+	for _, e := range events.Events {
+		tests.Assert(t, e.Type == api.EventVolumeCreated, e)
+		tests.Assert(t, e.Tenant == "team-a", e)
+	}
+	events, err = bobUser.EventList(0)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(events.Events) == 0, events.Events)
+
+	// The volumes of a deleted tenant are no longer limited
+	err = admin.TenantDelete("team-a")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	_, err = admin.TenantInfo("team-a")
+	tests.Assert(t, err != nil, "expected err != nil")
+	_, err = alice.VolumeCreate(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+}
+
+func TestTenantQuotaPendingOperations(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		3,    // nodes_per_cluster
+		2,    // devices_per_node,
+		2*TB, // disksize
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	err = app.db.Update(func(tx *bolt.Tx) error {
+		return NewTenantEntryFromRequest("team-a", &api.TenantRequest{
+			Limits: api.TenantLimits{SizeGb: 25},
+		}).Save(tx)
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	req := &api.VolumeCreateRequest{}
+	req.Size = 10
+	req.Durability.Type = api.DurabilityReplicate
+	req.Durability.Replicate.Replica = 3
+
+	// The volumes still being created count against the limits, so
+	// of two creates built before either runs only one fits
+	vol := NewVolumeEntryFromRequest(req)
+	vol.Info.Tenant = "team-a"
+	vc := NewVolumeCreateOperation(vol, app.db)
+	err = vc.Build(app.Allocator())
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	vol2 := NewVolumeEntryFromRequest(req)
+	vol2.Info.Tenant = "team-a"
+	vc2 := NewVolumeCreateOperation(vol2, app.db)
+	err = vc2.Build(app.Allocator())
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	vol3 := NewVolumeEntryFromRequest(req)
+	vol3.Info.Tenant = "team-a"
+	vc3 := NewVolumeCreateOperation(vol3, app.db)
+	err = vc3.Build(app.Allocator())
+	_, ok := err.(*TenantQuotaError)
+	tests.Assert(t, ok, "expected TenantQuotaError, got:", err)
+
+	for _, op := range []*VolumeCreateOperation{vc, vc2} {
+		err = op.Exec(app.executor)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		err = op.Finalize()
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	}
+
+	// The same goes for the expansions still pending
+	ve := NewVolumeExpandOperation(vol, app.db, 5)
+	err = ve.Build(app.Allocator())
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	ve2 := NewVolumeExpandOperation(vol2, app.db, 1)
+	err = ve2.Build(app.Allocator())
+	_, ok = err.(*TenantQuotaError)
+	tests.Assert(t, ok, "expected TenantQuotaError, got:", err)
+
+	err = app.db.View(func(tx *bolt.Tx) error {
+		tenant, err := NewTenantEntryFromId(tx, "team-a")
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		usage, err := tenant.Usage(tx)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, len(usage) == 1, usage)
+		for id, u := range usage {
+			tests.Assert(t, u.Volumes == 2 && u.SizeMiB == 25*1024, id, u)
+		}
+		return nil
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// Once the expansion is undone there is room again
+	err = ve.Rollback(app.executor)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	err = ve2.Build(app.Allocator())
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+}
@@ -0,0 +1,224 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+)
+
+var (
+	// Volume creates and brick replaces running at the same time on
+	// the server, on each cluster and on each node. Zero is no limit.
+	ThrottleMaxOperations        = 0
+	ThrottleMaxClusterOperations = 0
+	ThrottleMaxNodeOperations    = 0
+
+	// Operations waiting for their turn. The requests finding the queue
+	// full are answered with 429 and a Retry-After of
+	// ThrottleRetryAfter seconds.
+	ThrottleQueueSize  = 100
+	ThrottleRetryAfter = 30
+)
+
+// operationThrottle limits the volume creates and brick replaces
+// running at the same time. An operation is admitted in the queue when
+// requested and runs once the limits of the server and of the
+// clusters and nodes it runs on allow it.
+type operationThrottle struct {
+	lock sync.Mutex
+	cond *sync.Cond
+
+	maxOperations, maxCluster, maxNode, queueSize int
+
+	waiting  int
+	running  int
+	clusters map[string]int
+	nodes    map[string]int
+}
+
+func newOperationThrottle(maxOperations, maxCluster, maxNode,
+	queueSize int) *operationThrottle {
+
+	t := &operationThrottle{
+		maxOperations: maxOperations,
+		maxCluster:    maxCluster,
+		maxNode:       maxNode,
+		queueSize:     queueSize,
+		clusters:      map[string]int{},
+		nodes:         map[string]int{},
+	}
+	t.cond = sync.NewCond(&t.lock)
+	return t
+}
+
+// admit queues a new operation, returning false if the queue is full
+func (t *operationThrottle) admit() bool {
+	if t == nil {
+		return true
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.waiting >= t.queueSize {
+		return false
+	}
+	t.waiting++
+	return true
+}
+
+// cancel removes an admitted operation which will not run
+func (t *operationThrottle) cancel() {
+	if t == nil {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.waiting--
+}
+
+func (t *operationThrottle) fits(clusters, nodes []string) bool {
+	if t.maxOperations > 0 && t.running >= t.maxOperations {
+		return false
+	}
+	if t.maxCluster > 0 {
+		for _, id := range clusters {
+			if t.clusters[id] >= t.maxCluster {
+				return false
+			}
+		}
+	}
+	if t.maxNode > 0 {
+		for _, id := range nodes {
+			if t.nodes[id] >= t.maxNode {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// acquire waits until the admitted operation may run on the clusters
+// and nodes. The ids must not be repeated.
+func (t *operationThrottle) acquire(clusters, nodes []string) {
+	if t == nil {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	for !t.fits(clusters, nodes) {
+		t.cond.Wait()
+	}
+	t.waiting--
+	t.running++
+	for _, id := range clusters {
+		t.clusters[id]++
+	}
+	for _, id := range nodes {
+		t.nodes[id]++
+	}
+}
+
+// release ends an operation started by acquire
+func (t *operationThrottle) release(clusters, nodes []string) {
+	if t == nil {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.running--
+	for _, id := range clusters {
+		if t.clusters[id]--; t.clusters[id] <= 0 {
+			delete(t.clusters, id)
+		}
+	}
+	for _, id := range nodes {
+		if t.nodes[id]--; t.nodes[id] <= 0 {
+			delete(t.nodes, id)
+		}
+	}
+	t.cond.Broadcast()
+}
+
+// setThrottle limits the operations running at the same time if any
+// limit is set
+func (a *App) setThrottle() {
+	if ThrottleMaxOperations <= 0 &&
+		ThrottleMaxClusterOperations <= 0 &&
+		ThrottleMaxNodeOperations <= 0 {
+		return
+	}
+	a.throttle = newOperationThrottle(ThrottleMaxOperations,
+		ThrottleMaxClusterOperations,
+		ThrottleMaxNodeOperations,
+		ThrottleQueueSize)
+}
+
+// tooManyOperations answers a request finding the queue of the
+// throttle full
+func tooManyOperations(w http.ResponseWriter) {
+	logger.Warning("Operation queue full, rejecting request")
+	w.Header().Set("Retry-After", strconv.Itoa(ThrottleRetryAfter))
+	http.Error(w, "Too many operations in progress, retry later",
+		http.StatusTooManyRequests)
+}
+
+// throttledOperation is an operation limited by the throttle. Its
+// placement is the clusters and nodes the operation runs on once built.
+type throttledOperation interface {
+	Operation
+	placement() (clusters []string, nodes []string, err error)
+}
+
+// asyncHttpThrottledOperation runs the operation as AsyncHttpOperation
+// does, waiting for the throttle of the app before it is executed. If
+// the queue of the throttle is full the request is answered with 429
+// and nil is returned.
+func asyncHttpThrottledOperation(app *App,
+	w http.ResponseWriter,
+	r *http.Request,
+	op throttledOperation) error {
+
+	if app.throttle == nil {
+		return AsyncHttpOperation(app, w, r, op)
+	}
+	if !app.throttle.admit() {
+		tooManyOperations(w)
+		return nil
+	}
+
+	id := requestId(r)
+	if err := buildOperation(app, id, op); err != nil {
+		app.throttle.cancel()
+		return err
+	}
+	clusters, nodes, err := op.placement()
+	if err != nil {
+		// Only the limit of the server applies
+		requestLogger(r).LogError("%v: unable to get the nodes of the operation: %v",
+			op.Label(), err)
+	}
+
+	history := newOperationHistoryEntry(op, requestIssuer(r))
+	app.asyncHttpRedirectWithStepsFunc(w, r, func(step func(string)) (string, error) {
+		step(api.OperationStepQueued)
+		app.throttle.acquire(clusters, nodes)
+		defer app.throttle.release(clusters, nodes)
+
+		step(api.OperationStepRunning)
+		return execAsyncOperation(app, id, op, history)
+	})
+	return nil
+}
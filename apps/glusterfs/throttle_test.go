@@ -0,0 +1,139 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	client "github.com/heketi/heketi/client/api/go-client"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/tests"
+)
+
+// throttleWaiting returns the operations waiting for the throttle
+func throttleWaiting(t *operationThrottle) int {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.waiting
+}
+
+func TestOperationThrottle(t *testing.T) {
+	th := newOperationThrottle(2, 0, 1, 1)
+
+	tests.Assert(t, th.admit())
+	tests.Assert(t, !th.admit(), "expected the queue to be full")
+	th.acquire([]string{"c1"}, []string{"n1"})
+
+	// The node runs an operation already
+	tests.Assert(t, th.admit())
+	started := make(chan struct{})
+	go func() {
+		th.acquire([]string{"c1"}, []string{"n1", "n2"})
+		close(started)
+	}()
+	select {
+	case <-started:
+		t.Fatal("expected the operation to wait for node n1")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// The waiting operation fills the queue
+	tests.Assert(t, !th.admit(), "expected the queue to be full")
+	th.release([]string{"c1"}, []string{"n1"})
+	<-started
+	tests.Assert(t, th.admit())
+	th.acquire([]string{"c1"}, []string{"n3"})
+
+	// The server runs two operations
+	tests.Assert(t, th.admit())
+	started = make(chan struct{})
+	go func() {
+		th.acquire([]string{"c2"}, []string{"n4"})
+		close(started)
+	}()
+	select {
+	case <-started:
+		t.Fatal("expected the operation to wait for the server")
+	case <-time.After(50 * time.Millisecond):
+	}
+	th.release([]string{"c1"}, []string{"n3"})
+	<-started
+}
+
+func TestVolumeCreateThrottled(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	c := client.NewClientNoAuth(ts.URL)
+	tests.Assert(t, c != nil)
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		3,    // nodes_per_cluster
+		2,    // devices_per_node,
+		2*TB, // disksize
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// One operation at a time, which is running
+	app.throttle = newOperationThrottle(1, 0, 0, 1)
+	tests.Assert(t, app.throttle.admit())
+	app.throttle.acquire(nil, nil)
+
+	req := &api.VolumeCreateRequest{}
+	req.Size = 10
+	req.Durability.Type = api.DurabilityReplicate
+	req.Durability.Replicate.Replica = 3
+
+	created := make(chan error, 1)
+	go func() {
+		_, err := c.VolumeCreate(req)
+		created <- err
+	}()
+	for i := 0; throttleWaiting(app.throttle) == 0; i++ {
+		tests.Assert(t, i < 500, "expected the create to be queued")
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// The queue is full
+	body, err := json.Marshal(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	r, err := http.Post(ts.URL+"/volumes", "application/json",
+		bytes.NewReader(body))
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	r.Body.Close()
+	tests.Assert(t, r.StatusCode == http.StatusTooManyRequests, r.StatusCode)
+	tests.Assert(t, r.Header.Get("Retry-After") == "30",
+		r.Header.Get("Retry-After"))
+
+	// The queued create runs once the running operation is done
+	app.throttle.release(nil, nil)
+	err = <-created
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	vols, err := c.VolumeList()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(vols.Volumes) == 1, vols.Volumes)
+}
@@ -0,0 +1,360 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"fmt"
+
+	"github.com/boltdb/bolt"
+	"github.com/heketi/heketi/executors"
+	wdb "github.com/heketi/heketi/pkg/db"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+)
+
+// topologyDiffDbNodes returns the nodes in the db in the order of their
+// clusters, and the devices of the nodes by node id
+func topologyDiffDbNodes(db wdb.RODB) ([]*NodeEntry, map[string][]*DeviceEntry, error) {
+	nodes := []*NodeEntry{}
+	devices := map[string][]*DeviceEntry{}
+	err := db.View(func(tx *bolt.Tx) error {
+		clusters, err := ClusterList(tx)
+		if err != nil {
+			return err
+		}
+		for _, clusterId := range clusters {
+			cluster, err := NewClusterEntryFromId(tx, clusterId)
+			if err != nil {
+				return err
+			}
+			for _, id := range cluster.Info.Nodes {
+				node, err := NewNodeEntryFromId(tx, id)
+				if err != nil {
+					return err
+				}
+				nodes = append(nodes, node)
+				for _, deviceId := range node.Devices {
+					device, err := NewDeviceEntryFromId(tx, deviceId)
+					if err != nil {
+						return err
+					}
+					devices[id] = append(devices[id], device)
+				}
+			}
+		}
+		return nil
+	})
+	return nodes, devices, err
+}
+
+// DiffTopology compares the topology with the nodes and devices in the
+// db. Nodes are matched by management hostname and devices by name on
+// their node. The nodes of the topology in the db are checked for a
+// running glusterd and their devices for their volume group, the ones
+// that fail the checks being reported as missing.
+func DiffTopology(db wdb.RODB,
+	executor executors.Executor,
+	req *api.TopologyLoadRequest) (*api.TopologyDiffResponse, error) {
+
+	nodes, devices, err := topologyDiffDbNodes(db)
+	if err != nil {
+		return nil, err
+	}
+	byHost := map[string]*NodeEntry{}
+	for _, node := range nodes {
+		for _, host := range node.Info.Hostnames.Manage {
+			byHost[host] = node
+		}
+	}
+
+	diff := &api.TopologyDiffResponse{
+		Changes: []api.TopologyDiffItem{},
+	}
+	change := func(item api.TopologyDiffItem) {
+		diff.Changes = append(diff.Changes, item)
+	}
+	matched := map[string]bool{}
+
+	for _, c := range req.Clusters {
+		for _, n := range c.Nodes {
+			host := n.Node.Hostnames.Manage[0]
+			node, ok := byHost[host]
+			if !ok {
+				change(api.TopologyDiffItem{
+					Type:   api.TopologyLoadNode,
+					Change: api.TopologyDiffAdd,
+					Name:   host,
+				})
+				for _, name := range n.Devices {
+					change(api.TopologyDiffItem{
+						Type:   api.TopologyLoadDevice,
+						Change: api.TopologyDiffAdd,
+						Name:   name,
+						Node:   host,
+					})
+				}
+				continue
+			}
+			matched[node.Info.Id] = true
+
+			reachable := true
+			if err := executor.GlusterdCheck(node.ManageHostName()); err != nil {
+				reachable = false
+				change(api.TopologyDiffItem{
+					Type:    api.TopologyLoadNode,
+					Change:  api.TopologyDiffMissing,
+					Name:    host,
+					Id:      node.Info.Id,
+					Message: err.Error(),
+				})
+			}
+
+			wanted := map[string]bool{}
+			for _, name := range n.Devices {
+				wanted[name] = true
+			}
+			found := map[string]bool{}
+			for _, device := range devices[node.Info.Id] {
+				found[device.Info.Name] = true
+				item := api.TopologyDiffItem{
+					Type: api.TopologyLoadDevice,
+					Name: device.Info.Name,
+					Id:   device.Info.Id,
+					Node: host,
+				}
+				if !wanted[device.Info.Name] {
+					item.Change = api.TopologyDiffRemove
+					change(item)
+					continue
+				}
+				if !reachable {
+					continue
+				}
+				_, err := executor.GetDeviceInfo(node.ManageHostName(),
+					device.Info.Name, device.Info.Id)
+				if err != nil {
+					item.Change = api.TopologyDiffMissing
+					item.Message = err.Error()
+					change(item)
+				}
+			}
+			for _, name := range n.Devices {
+				if !found[name] {
+					change(api.TopologyDiffItem{
+						Type:   api.TopologyLoadDevice,
+						Change: api.TopologyDiffAdd,
+						Name:   name,
+						Node:   host,
+					})
+				}
+			}
+		}
+	}
+
+	// Nodes in the db and not in the topology
+	for _, node := range nodes {
+		if matched[node.Info.Id] {
+			continue
+		}
+		host := node.ManageHostName()
+		for _, device := range devices[node.Info.Id] {
+			change(api.TopologyDiffItem{
+				Type:   api.TopologyLoadDevice,
+				Change: api.TopologyDiffRemove,
+				Name:   device.Info.Name,
+				Id:     device.Info.Id,
+				Node:   host,
+			})
+		}
+		change(api.TopologyDiffItem{
+			Type:   api.TopologyLoadNode,
+			Change: api.TopologyDiffRemove,
+			Name:   host,
+			Id:     node.Info.Id,
+		})
+	}
+
+	return diff, nil
+}
+
+// topologyDiffRemoveDevice tears down and deletes a device without
+// bricks the same way as a device removed and then deleted
+func topologyDiffRemoveDevice(db wdb.DB,
+	executor executors.Executor,
+	id string) error {
+
+	var (
+		device *DeviceEntry
+		node   *NodeEntry
+	)
+	err := db.View(func(tx *bolt.Tx) error {
+		var err error
+		device, err = NewDeviceEntryFromId(tx, id)
+		if err != nil {
+			return err
+		}
+		if device.HasBricks() {
+			return fmt.Errorf("%v", device.ConflictString())
+		}
+		node, err = NewNodeEntryFromId(tx, device.NodeId)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	err = executor.DeviceTeardown(node.ManageHostName(),
+		device.Info.Name, device.Info.Id)
+	if err != nil {
+		return err
+	}
+
+	return db.Update(func(tx *bolt.Tx) error {
+		device, err := NewDeviceEntryFromId(tx, id)
+		if err != nil {
+			return err
+		}
+		// Without bricks there is nothing to move off the device
+		// before it is failed
+		device.State = api.EntryStateFailed
+		node, err := NewNodeEntryFromId(tx, device.NodeId)
+		if err != nil {
+			return err
+		}
+		node.DeviceDelete(device.Info.Id)
+		if err := node.Save(tx); err != nil {
+			return err
+		}
+		if err := device.Delete(tx); err != nil {
+			return err
+		}
+		return device.Deregister(tx)
+	})
+}
+
+// topologyDiffRemoveNode detaches and deletes a node without devices
+// the same way as a node delete request
+func topologyDiffRemoveNode(db wdb.DB,
+	executor executors.Executor,
+	id string) error {
+
+	var node, peer *NodeEntry
+	err := db.View(func(tx *bolt.Tx) error {
+		var err error
+		node, err = NewNodeEntryFromId(tx, id)
+		if err != nil {
+			return err
+		}
+		if !node.IsDeleteOk() {
+			return fmt.Errorf("%v", node.ConflictString())
+		}
+		cluster, err := NewClusterEntryFromId(tx, node.Info.ClusterId)
+		if err != nil {
+			return err
+		}
+		for _, peerId := range cluster.Info.Nodes {
+			if peerId != id {
+				peer, err = NewNodeEntryFromId(tx, peerId)
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if peer != nil {
+		err := executor.PeerDetach(peer.ManageHostName(), node.StorageHostName())
+		if err != nil {
+			return err
+		}
+	}
+
+	return db.Update(func(tx *bolt.Tx) error {
+		cluster, err := NewClusterEntryFromId(tx, node.Info.ClusterId)
+		if err != nil {
+			return err
+		}
+		cluster.NodeDelete(node.Info.Id)
+		if err := cluster.Save(tx); err != nil {
+			return err
+		}
+		node.Deregister(tx)
+		return node.Delete(tx)
+	})
+}
+
+// ApplyTopologyDiff converges the db and the nodes to the topology. The
+// nodes and devices missing from the db are added as by LoadTopology,
+// then the devices and the nodes not in the topology are removed. Only
+// devices without bricks and nodes without devices can be removed, the
+// other removals failing. Nodes and devices missing on their node are
+// left as they are. The result of every change is set in the returned
+// diff.
+func ApplyTopologyDiff(db wdb.DB,
+	executor executors.Executor,
+	req *api.TopologyLoadRequest,
+	step func(string)) (*api.TopologyDiffResponse, error) {
+
+	diff, err := DiffTopology(db, executor, req)
+	if err != nil {
+		return nil, err
+	}
+	diff.Applied = true
+
+	adds := false
+	for _, item := range diff.Changes {
+		adds = adds || item.Change == api.TopologyDiffAdd
+	}
+	if adds {
+		loaded := LoadTopology(db, executor, req, step)
+		for i := range diff.Changes {
+			item := &diff.Changes[i]
+			if item.Change != api.TopologyDiffAdd {
+				continue
+			}
+			for _, r := range loaded.Results {
+				if r.Type == item.Type && r.Name == item.Name && r.Node == item.Node {
+					item.Id = r.Id
+					item.Result = r.Result
+					item.Message = r.Message
+				}
+			}
+		}
+	}
+
+	// Devices are removed before the nodes they are on
+	for _, t := range []string{api.TopologyLoadDevice, api.TopologyLoadNode} {
+		for i := range diff.Changes {
+			item := &diff.Changes[i]
+			if item.Change != api.TopologyDiffRemove || item.Type != t {
+				continue
+			}
+			var err error
+			if t == api.TopologyLoadDevice {
+				step(fmt.Sprintf("Removing device %v on node %v", item.Name, item.Node))
+				err = topologyDiffRemoveDevice(db, executor, item.Id)
+			} else {
+				step("Removing node " + item.Name)
+				err = topologyDiffRemoveNode(db, executor, item.Id)
+			}
+			if err != nil {
+				logger.LogError("Unable to remove %v %v: %v", t, item.Name, err)
+				item.Result = api.TopologyLoadFailed
+				item.Message = err.Error()
+				continue
+			}
+			logger.Info("Removed %v %v", t, item.Name)
+			item.Result = api.TopologyDiffRemoved
+		}
+	}
+
+	return diff, nil
+}
@@ -0,0 +1,242 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/gorilla/mux"
+	client "github.com/heketi/heketi/client/api/go-client"
+	"github.com/heketi/heketi/executors"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/tests"
+)
+
+func countTopologyDiffChanges(diff *api.TopologyDiffResponse) map[string]int {
+	counts := map[string]int{}
+	for _, c := range diff.Changes {
+		counts[c.Type+" "+c.Change]++
+		if c.Result != "" {
+			counts[c.Type+" "+c.Result]++
+		}
+	}
+	return counts
+}
+
+func sampleTopologyDiffRequest(nodes ...api.TopologyLoadNodeRequest) *api.TopologyLoadRequest {
+	return &api.TopologyLoadRequest{
+		Clusters: []api.TopologyLoadClusterRequest{
+			api.TopologyLoadClusterRequest{Nodes: nodes},
+		},
+	}
+}
+
+func TestDiffTopology(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	req := sampleTopologyDiffRequest(
+		sampleTopologyLoadNode("host1", "/dev/sda", "/dev/sdb"),
+		sampleTopologyLoadNode("host2", "/dev/sda", "/dev/sdb"),
+		sampleTopologyLoadNode("host3", "/dev/sda"))
+
+	// Everything is added to an empty db
+	diff, err := DiffTopology(app.db, app.executor, req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, !diff.Applied)
+	counts := countTopologyDiffChanges(diff)
+	tests.Assert(t, counts["node add"] == 3, counts)
+	tests.Assert(t, counts["device add"] == 5, counts)
+
+	LoadTopology(app.db, app.executor, req, func(string) {})
+	diff, err = DiffTopology(app.db, app.executor, req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(diff.Changes) == 0, diff.Changes)
+
+	// Devices and nodes missing on the nodes
+	app.xo.MockGlusterdCheck = func(host string) error {
+		if host == "host3" {
+			return fmt.Errorf("glusterd not running")
+		}
+		return nil
+	}
+	app.xo.MockDeviceSetup = func(host, device, vgid string) (*executors.DeviceInfo, error) {
+		if host == "host1" && device == "/dev/sdb" {
+			return nil, fmt.Errorf("no such device")
+		}
+		return &executors.DeviceInfo{Size: 500 * 1024 * 1024, ExtentSize: 4096}, nil
+	}
+	diff, err = DiffTopology(app.db, app.executor, req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(diff.Changes) == 2, diff.Changes)
+	tests.Assert(t, diff.Changes[0].Type == api.TopologyLoadDevice, diff.Changes[0])
+	tests.Assert(t, diff.Changes[0].Change == api.TopologyDiffMissing, diff.Changes[0])
+	tests.Assert(t, diff.Changes[0].Node == "host1", diff.Changes[0])
+	tests.Assert(t, diff.Changes[0].Message == "no such device", diff.Changes[0])
+	tests.Assert(t, diff.Changes[1].Type == api.TopologyLoadNode, diff.Changes[1])
+	tests.Assert(t, diff.Changes[1].Change == api.TopologyDiffMissing, diff.Changes[1])
+	tests.Assert(t, diff.Changes[1].Name == "host3", diff.Changes[1])
+
+	// Nodes and devices not in the topology are to be removed
+	app.xo.MockGlusterdCheck = func(host string) error { return nil }
+	req.Clusters[0].Nodes[0].Devices = []string{"/dev/sda", "/dev/sdc"}
+	req.Clusters[0].Nodes = req.Clusters[0].Nodes[:2]
+	diff, err = DiffTopology(app.db, app.executor, req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	counts = countTopologyDiffChanges(diff)
+	tests.Assert(t, len(diff.Changes) == 4, diff.Changes)
+	tests.Assert(t, counts["device remove"] == 2, counts)
+	tests.Assert(t, counts["device add"] == 1, counts)
+	tests.Assert(t, counts["node remove"] == 1, counts)
+	last := diff.Changes[len(diff.Changes)-1]
+	tests.Assert(t, last.Name == "host3" && last.Id != "", last)
+}
+
+func TestApplyTopologyDiff(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	req := sampleTopologyDiffRequest(
+		sampleTopologyLoadNode("host1", "/dev/sda", "/dev/sdb"),
+		sampleTopologyLoadNode("host2", "/dev/sda", "/dev/sdb"),
+		sampleTopologyLoadNode("host3", "/dev/sda", "/dev/sdb"))
+	LoadTopology(app.db, app.executor, req, func(string) {})
+
+	// The bricks of the volume are on the first three nodes
+	v := NewVolumeEntryFromRequest(&api.VolumeCreateRequest{Size: 10})
+	err := v.Create(app.db, app.executor, app.Allocator())
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	req.Clusters[0].Nodes = append(req.Clusters[0].Nodes,
+		sampleTopologyLoadNode("host4", "/dev/sda"))
+	LoadTopology(app.db, app.executor, req, func(string) {})
+
+	teardowns := 0
+	app.xo.MockDeviceTeardown = func(host, device, vgid string) error {
+		teardowns++
+		return nil
+	}
+	detached := ""
+	app.xo.MockPeerDetach = func(exec_host, detachnode string) error {
+		detached = detachnode
+		return nil
+	}
+
+	// host4 is removed, host5 added and a device added to host1
+	req.Clusters[0].Nodes[0].Devices = append(req.Clusters[0].Nodes[0].Devices, "/dev/sdc")
+	req.Clusters[0].Nodes[3] = sampleTopologyLoadNode("host5", "/dev/sda")
+	steps := 0
+	diff, err := ApplyTopologyDiff(app.db, app.executor, req, func(string) { steps++ })
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, diff.Applied)
+	counts := countTopologyDiffChanges(diff)
+	tests.Assert(t, counts["node created"] == 1, counts)
+	tests.Assert(t, counts["device created"] == 2, counts)
+	tests.Assert(t, counts["node removed"] == 1, counts)
+	tests.Assert(t, counts["device removed"] == 1, counts)
+	tests.Assert(t, teardowns == 1, teardowns)
+	tests.Assert(t, detached == "host4", detached)
+	for _, c := range diff.Changes {
+		tests.Assert(t, c.Id != "", c)
+	}
+
+	diff, err = DiffTopology(app.db, app.executor, req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(diff.Changes) == 0, diff.Changes)
+
+	// Devices with bricks and their nodes are not removed
+	var withBricks string
+	app.db.View(func(tx *bolt.Tx) error {
+		for _, id := range v.Bricks {
+			brick, err := NewBrickEntryFromId(tx, id)
+			tests.Assert(t, err == nil)
+			node, err := NewNodeEntryFromId(tx, brick.Info.NodeId)
+			tests.Assert(t, err == nil)
+			withBricks = node.ManageHostName()
+		}
+		return nil
+	})
+	nodes := []api.TopologyLoadNodeRequest{}
+	for _, n := range req.Clusters[0].Nodes {
+		if n.Node.Hostnames.Manage[0] != withBricks {
+			nodes = append(nodes, n)
+		}
+	}
+	req.Clusters[0].Nodes = nodes
+	diff, err = ApplyTopologyDiff(app.db, app.executor, req, func(string) {})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	counts = countTopologyDiffChanges(diff)
+	tests.Assert(t, counts["node remove"] == 1, counts)
+	tests.Assert(t, counts["node failed"] == 1, counts)
+	tests.Assert(t, counts["device failed"] >= 1, counts)
+
+	found, err := topologyLoadNodes(app.db)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	_, ok := found[withBricks]
+	tests.Assert(t, ok, found)
+}
+
+func TestTopologyDiffHttp(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	c := client.NewClientNoAuth(ts.URL)
+	tests.Assert(t, c != nil)
+
+	req := &api.TopologyDiffRequest{
+		Topology: *sampleTopologyDiffRequest(
+			sampleTopologyLoadNode("host1", "/dev/sda"),
+			sampleTopologyLoadNode("host2", "/dev/sda")),
+	}
+	diff, err := c.TopologyDiff(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, !diff.Applied)
+	tests.Assert(t, len(diff.Changes) == 4, diff.Changes)
+
+	// Nothing has been applied yet
+	topology, err := c.TopologyInfo()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(topology.ClusterList) == 0)
+
+	req.Apply = true
+	diff, err = c.TopologyDiff(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, diff.Applied)
+	counts := countTopologyDiffChanges(diff)
+	tests.Assert(t, counts["node created"] == 2, counts)
+	tests.Assert(t, counts["device created"] == 2, counts)
+
+	topology, err = c.TopologyInfo()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(topology.ClusterList) == 1)
+	tests.Assert(t, len(topology.ClusterList[0].Nodes) == 2)
+
+	req.Apply = false
+	diff, err = c.TopologyDiff(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(diff.Changes) == 0, diff.Changes)
+}
@@ -0,0 +1,353 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/boltdb/bolt"
+	"github.com/heketi/heketi/executors"
+	wdb "github.com/heketi/heketi/pkg/db"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+)
+
+// topologyLoadState keeps the results of the last topology load and the
+// last applied topology diff of the server. A single load or apply runs
+// at a time.
+type topologyLoadState struct {
+	lock    sync.Mutex
+	running bool
+	result  *api.TopologyLoadResponse
+	diff    *api.TopologyDiffResponse
+}
+
+// start returns false if a load is already running
+func (s *topologyLoadState) start() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.running {
+		return false
+	}
+	s.running = true
+	return true
+}
+
+func (s *topologyLoadState) finish(result *api.TopologyLoadResponse) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.running = false
+	s.result = result
+}
+
+func (s *topologyLoadState) last() *api.TopologyLoadResponse {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.result
+}
+
+// finishDiff keeps the previous diff if the apply failed
+func (s *topologyLoadState) finishDiff(diff *api.TopologyDiffResponse) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.running = false
+	if diff != nil {
+		s.diff = diff
+	}
+}
+
+func (s *topologyLoadState) lastDiff() *api.TopologyDiffResponse {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.diff
+}
+
+// topologyLoadNodes returns the nodes in the db by management hostname
+func topologyLoadNodes(db wdb.RODB) (map[string]*NodeEntry, error) {
+	nodes := map[string]*NodeEntry{}
+	err := db.View(func(tx *bolt.Tx) error {
+		clusters, err := ClusterList(tx)
+		if err != nil {
+			return err
+		}
+		for _, clusterId := range clusters {
+			cluster, err := NewClusterEntryFromId(tx, clusterId)
+			if err != nil {
+				return err
+			}
+			for _, id := range cluster.Info.Nodes {
+				node, err := NewNodeEntryFromId(tx, id)
+				if err != nil {
+					return err
+				}
+				for _, host := range node.Info.Hostnames.Manage {
+					nodes[host] = node
+				}
+			}
+		}
+		return nil
+	})
+	return nodes, err
+}
+
+// topologyLoadDevices returns the ids of the devices of the node by name
+func topologyLoadDevices(db wdb.RODB, nodeId string) (map[string]string, error) {
+	devices := map[string]string{}
+	err := db.View(func(tx *bolt.Tx) error {
+		node, err := NewNodeEntryFromId(tx, nodeId)
+		if err != nil {
+			return err
+		}
+		for _, id := range node.Devices {
+			device, err := NewDeviceEntryFromId(tx, id)
+			if err != nil {
+				return err
+			}
+			devices[device.Info.Name] = id
+		}
+		return nil
+	})
+	return devices, err
+}
+
+// topologyLoadCreateCluster creates the cluster of nodes of the topology
+// that are not in the db. File and block volumes are allowed unless the
+// topology disables them.
+func topologyLoadCreateCluster(db wdb.DB,
+	req *api.TopologyLoadClusterRequest) (*ClusterEntry, error) {
+
+	msg := &api.ClusterCreateRequest{}
+	msg.File = req.File == nil || *req.File
+	msg.Block = req.Block == nil || *req.Block
+	cluster := NewClusterEntryFromRequest(msg)
+	err := db.Update(func(tx *bolt.Tx) error {
+		return cluster.Save(tx)
+	})
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("Created cluster %v", cluster.Info.Id)
+	return cluster, nil
+}
+
+// topologyLoadAddNode adds the node to the cluster the same way as a
+// node add request
+func topologyLoadAddNode(db wdb.DB,
+	executor executors.Executor,
+	clusterId string,
+	msg api.NodeAddRequest) (*NodeEntry, error) {
+
+	msg.ClusterId = clusterId
+	err := msg.Validate()
+	if err == nil {
+		err = validateNodeAddLimits(&msg)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("validation failed: %v", err)
+	}
+	if err := nodeAddressFamilyOk(&msg); err != nil {
+		return nil, err
+	}
+
+	node := NewNodeEntryFromRequest(&msg)
+	cluster, err := registerNode(db, node)
+	if err != nil {
+		return nil, err
+	}
+	peer, err := nodeAddPeer(db, executor, cluster, node)
+	if err != nil {
+		deregisterNode(db, node)
+		return nil, err
+	}
+	if err := addNodeToCluster(db, executor, node, peer); err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+// topologyLoadAddDevice adds the device to the node the same way as a
+// device add request
+func topologyLoadAddDevice(db wdb.DB,
+	executor executors.Executor,
+	node *NodeEntry,
+	name string) (*DeviceEntry, error) {
+
+	msg := &api.DeviceAddRequest{NodeId: node.Info.Id}
+	msg.Name = name
+	err := msg.Validate()
+	if err == nil {
+		err = validateDeviceAddLimits(msg)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("validation failed: %v", err)
+	}
+
+	device := NewDeviceEntryFromRequest(msg)
+	node, err = registerDevice(db, device)
+	if err != nil {
+		return nil, err
+	}
+	if err := addDeviceToNode(db, executor, node, device, msg); err != nil {
+		return nil, err
+	}
+	return device, nil
+}
+
+// LoadTopology creates the clusters, nodes and devices of the topology
+// that are not in the db yet. Nodes are matched by management hostname
+// and devices by name on their node, so that loading the same topology
+// again only adds what is missing. The nodes of a cluster of the
+// topology are added to the cluster of the first of them already in the
+// db, or to a new cluster if there is none. A failed item is reported
+// in the results without stopping the load of the other items, a new
+// cluster being removed if none of its nodes could be added.
+func LoadTopology(db wdb.DB,
+	executor executors.Executor,
+	req *api.TopologyLoadRequest,
+	step func(string)) *api.TopologyLoadResponse {
+
+	resp := &api.TopologyLoadResponse{
+		Results: []api.TopologyLoadResult{},
+	}
+	result := func(r api.TopologyLoadResult, err error) {
+		if err != nil {
+			r.Result = api.TopologyLoadFailed
+			r.Message = err.Error()
+		}
+		resp.Results = append(resp.Results, r)
+	}
+
+	nodes, err := topologyLoadNodes(db)
+	if err != nil {
+		result(api.TopologyLoadResult{Type: api.TopologyLoadCluster}, err)
+		return resp
+	}
+
+	for i := range req.Clusters {
+		c := &req.Clusters[i]
+
+		// Nodes already in the db give the cluster
+		var clusterId string
+		for _, n := range c.Nodes {
+			if node, ok := nodes[n.Node.Hostnames.Manage[0]]; ok {
+				clusterId = node.Info.ClusterId
+				break
+			}
+		}
+		clusterResult := -1
+		if clusterId != "" {
+			result(api.TopologyLoadResult{
+				Type:   api.TopologyLoadCluster,
+				Id:     clusterId,
+				Result: api.TopologyLoadExists,
+			}, nil)
+		}
+
+		added := 0
+		for _, n := range c.Nodes {
+			host := n.Node.Hostnames.Manage[0]
+			node, ok := nodes[host]
+			if ok {
+				result(api.TopologyLoadResult{
+					Type:   api.TopologyLoadNode,
+					Name:   host,
+					Id:     node.Info.Id,
+					Result: api.TopologyLoadExists,
+				}, nil)
+			} else {
+				if clusterId == "" {
+					step("Creating cluster")
+					cluster, err := topologyLoadCreateCluster(db, c)
+					if err != nil {
+						result(api.TopologyLoadResult{Type: api.TopologyLoadCluster}, err)
+						break
+					}
+					clusterId = cluster.Info.Id
+					clusterResult = len(resp.Results)
+					result(api.TopologyLoadResult{
+						Type:   api.TopologyLoadCluster,
+						Id:     clusterId,
+						Result: api.TopologyLoadCreated,
+					}, nil)
+				}
+
+				step("Adding node " + host)
+				node, err = topologyLoadAddNode(db, executor, clusterId, n.Node)
+				r := api.TopologyLoadResult{
+					Type:   api.TopologyLoadNode,
+					Name:   host,
+					Result: api.TopologyLoadCreated,
+				}
+				if err == nil {
+					r.Id = node.Info.Id
+				}
+				result(r, err)
+				if err != nil {
+					logger.LogError("Unable to add node %v: %v", host, err)
+					continue
+				}
+				for _, name := range node.Info.Hostnames.Manage {
+					nodes[name] = node
+				}
+				added++
+			}
+
+			devices, err := topologyLoadDevices(db, node.Info.Id)
+			if err != nil {
+				result(api.TopologyLoadResult{Type: api.TopologyLoadDevice, Node: host}, err)
+				continue
+			}
+			for _, name := range n.Devices {
+				r := api.TopologyLoadResult{
+					Type: api.TopologyLoadDevice,
+					Name: name,
+					Node: host,
+				}
+				if id, ok := devices[name]; ok {
+					r.Id = id
+					r.Result = api.TopologyLoadExists
+					result(r, nil)
+					continue
+				}
+
+				step(fmt.Sprintf("Adding device %v on node %v", name, host))
+				device, err := topologyLoadAddDevice(db, executor, node, name)
+				if err != nil {
+					logger.LogError("Unable to add device %v on node %v: %v",
+						name, host, err)
+				} else {
+					r.Id = device.Info.Id
+					r.Result = api.TopologyLoadCreated
+					devices[name] = device.Info.Id
+				}
+				result(r, err)
+			}
+		}
+
+		// Remove the new cluster if none of its nodes were added
+		if clusterResult >= 0 && added == 0 {
+			err := db.Update(func(tx *bolt.Tx) error {
+				cluster, err := NewClusterEntryFromId(tx, clusterId)
+				if err != nil {
+					return err
+				}
+				return cluster.Delete(tx)
+			})
+			if err != nil {
+				logger.Err(err)
+			}
+			r := &resp.Results[clusterResult]
+			r.Result = api.TopologyLoadFailed
+			r.Message = "None of the nodes of the cluster could be added"
+		}
+	}
+
+	return resp
+}
@@ -0,0 +1,240 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/gorilla/mux"
+	client "github.com/heketi/heketi/client/api/go-client"
+	"github.com/heketi/heketi/executors"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/heketi/pkg/utils"
+	"github.com/heketi/tests"
+)
+
+func sampleTopologyLoadNode(host string, devices ...string) api.TopologyLoadNodeRequest {
+	n := api.TopologyLoadNodeRequest{Devices: devices}
+	n.Node.Zone = 1
+	n.Node.Hostnames.Manage = []string{host}
+	n.Node.Hostnames.Storage = []string{host}
+	return n
+}
+
+func countTopologyLoadResults(resp *api.TopologyLoadResponse) map[string]int {
+	counts := map[string]int{}
+	for _, r := range resp.Results {
+		counts[r.Type+" "+r.Result]++
+	}
+	return counts
+}
+
+func TestLoadTopology(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	f := false
+	req := &api.TopologyLoadRequest{
+		Clusters: []api.TopologyLoadClusterRequest{
+			api.TopologyLoadClusterRequest{
+				Block: &f,
+				Nodes: []api.TopologyLoadNodeRequest{
+					sampleTopologyLoadNode("host1", "/dev/sda", "/dev/sdb"),
+					sampleTopologyLoadNode("host2", "/dev/sda", "/dev/sdb"),
+				},
+			},
+		},
+	}
+
+	steps := 0
+	resp := LoadTopology(app.db, app.executor, req, func(string) { steps++ })
+	counts := countTopologyLoadResults(resp)
+	tests.Assert(t, len(resp.Results) == 7, resp.Results)
+	tests.Assert(t, counts["cluster created"] == 1, counts)
+	tests.Assert(t, counts["node created"] == 2, counts)
+	tests.Assert(t, counts["device created"] == 4, counts)
+	tests.Assert(t, steps == 7, steps)
+
+	clusterId := resp.Results[0].Id
+	app.db.View(func(tx *bolt.Tx) error {
+		clusters, err := ClusterList(tx)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, len(clusters) == 1, clusters)
+		cluster, err := NewClusterEntryFromId(tx, clusterId)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, cluster.Info.File)
+		tests.Assert(t, !cluster.Info.Block)
+		tests.Assert(t, len(cluster.Info.Nodes) == 2, cluster.Info.Nodes)
+		for _, id := range cluster.Info.Nodes {
+			node, err := NewNodeEntryFromId(tx, id)
+			tests.Assert(t, err == nil)
+			tests.Assert(t, len(node.Devices) == 2, node.Devices)
+		}
+		return nil
+	})
+
+	// Loading the topology again only adds what is missing
+	req.Clusters[0].Nodes[1].Devices = append(req.Clusters[0].Nodes[1].Devices, "/dev/sdc")
+	req.Clusters[0].Nodes = append(req.Clusters[0].Nodes,
+		sampleTopologyLoadNode("host3", "/dev/sda"))
+	resp = LoadTopology(app.db, app.executor, req, func(string) {})
+	counts = countTopologyLoadResults(resp)
+	tests.Assert(t, counts["cluster exists"] == 1, counts)
+	tests.Assert(t, resp.Results[0].Id == clusterId, resp.Results[0])
+	tests.Assert(t, counts["node exists"] == 2, counts)
+	tests.Assert(t, counts["node created"] == 1, counts)
+	tests.Assert(t, counts["device exists"] == 4, counts)
+	tests.Assert(t, counts["device created"] == 2, counts)
+
+	app.db.View(func(tx *bolt.Tx) error {
+		clusters, err := ClusterList(tx)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, len(clusters) == 1, clusters)
+		cluster, err := NewClusterEntryFromId(tx, clusterId)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, len(cluster.Info.Nodes) == 3, cluster.Info.Nodes)
+		devices := 0
+		for _, id := range cluster.Info.Nodes {
+			node, err := NewNodeEntryFromId(tx, id)
+			tests.Assert(t, err == nil)
+			devices += len(node.Devices)
+		}
+		tests.Assert(t, devices == 6, devices)
+		return nil
+	})
+}
+
+func TestLoadTopologyFailures(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	app.xo.MockGlusterdCheck = func(host string) error {
+		if host == "bad" {
+			return fmt.Errorf("glusterd is not running")
+		}
+		return nil
+	}
+	app.xo.MockDeviceSetup = func(host, device, vgid string) (*executors.DeviceInfo, error) {
+		if device == "/dev/bad" {
+			return nil, fmt.Errorf("device in use")
+		}
+		return &executors.DeviceInfo{Size: 500 * 1024 * 1024, ExtentSize: 4096}, nil
+	}
+
+	req := &api.TopologyLoadRequest{
+		Clusters: []api.TopologyLoadClusterRequest{
+			api.TopologyLoadClusterRequest{
+				Nodes: []api.TopologyLoadNodeRequest{
+					sampleTopologyLoadNode("host1", "/dev/sda", "/dev/bad"),
+				},
+			},
+			api.TopologyLoadClusterRequest{
+				Nodes: []api.TopologyLoadNodeRequest{
+					sampleTopologyLoadNode("bad", "/dev/sda"),
+				},
+			},
+		},
+	}
+	resp := LoadTopology(app.db, app.executor, req, func(string) {})
+	counts := countTopologyLoadResults(resp)
+	tests.Assert(t, counts["cluster created"] == 1, counts)
+	tests.Assert(t, counts["cluster failed"] == 1, counts)
+	tests.Assert(t, counts["node created"] == 1, counts)
+	tests.Assert(t, counts["node failed"] == 1, counts)
+	tests.Assert(t, counts["device created"] == 1, counts)
+	tests.Assert(t, counts["device failed"] == 1, counts)
+	for _, r := range resp.Results {
+		if r.Result == api.TopologyLoadFailed {
+			tests.Assert(t, r.Message != "", r)
+		}
+	}
+
+	// The cluster of the failed node was removed along with the
+	// registrations of the failed items
+	app.db.View(func(tx *bolt.Tx) error {
+		clusters, err := ClusterList(tx)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, len(clusters) == 1, clusters)
+		cluster, err := NewClusterEntryFromId(tx, clusters[0])
+		tests.Assert(t, err == nil)
+		tests.Assert(t, len(cluster.Info.Nodes) == 1, cluster.Info.Nodes)
+		node, err := NewNodeEntryFromId(tx, cluster.Info.Nodes[0])
+		tests.Assert(t, err == nil)
+		tests.Assert(t, len(node.Devices) == 1, node.Devices)
+		return nil
+	})
+
+	app.xo.MockGlusterdCheck = func(host string) error { return nil }
+	resp = LoadTopology(app.db, app.executor, req, func(string) {})
+	counts = countTopologyLoadResults(resp)
+	tests.Assert(t, counts["cluster created"] == 1, counts)
+	tests.Assert(t, counts["cluster exists"] == 1, counts)
+	tests.Assert(t, counts["node created"] == 1, counts)
+	tests.Assert(t, counts["device failed"] == 1, counts)
+}
+
+func TestTopologyLoadHttp(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	c := client.NewClientNoAuth(ts.URL)
+	tests.Assert(t, c != nil)
+
+	req := &api.TopologyLoadRequest{
+		Clusters: []api.TopologyLoadClusterRequest{
+			api.TopologyLoadClusterRequest{
+				Nodes: []api.TopologyLoadNodeRequest{
+					sampleTopologyLoadNode("host1", "/dev/sda"),
+					sampleTopologyLoadNode("host2", "/dev/sda"),
+				},
+			},
+		},
+	}
+	resp, err := c.TopologyLoad(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	counts := countTopologyLoadResults(resp)
+	tests.Assert(t, counts["node created"] == 2, counts)
+	tests.Assert(t, counts["device created"] == 2, counts)
+
+	topology, err := c.TopologyInfo()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(topology.ClusterList) == 1)
+	tests.Assert(t, len(topology.ClusterList[0].Nodes) == 2)
+	tests.Assert(t, topology.ClusterList[0].Block)
+
+	// Nodes need a zone and hostnames
+	req.Clusters[0].Nodes[0].Node.Zone = 0
+	_, err = c.TopologyLoad(req)
+	tests.Assert(t, err != nil, "expected err != nil")
+	tests.Assert(t, utils.GetStatusCodeFromError(err) == http.StatusBadRequest, err)
+
+	_, err = c.TopologyLoad(&api.TopologyLoadRequest{})
+	tests.Assert(t, err != nil, "expected err != nil")
+	tests.Assert(t, utils.GetStatusCodeFromError(err) == http.StatusBadRequest, err)
+}
@@ -0,0 +1,87 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"github.com/boltdb/bolt"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+)
+
+// durabilityDataBricks returns the number of bricks of a set of the
+// durability holding data and the number of bricks in the set
+func durabilityDataBricks(d api.VolumeDurabilityInfo) (uint64, uint64) {
+	switch d.Type {
+	case api.DurabilityReplicate:
+		if d.Replicate.Replica > 0 {
+			return 1, uint64(d.Replicate.Replica)
+		}
+	case api.DurabilityEC:
+		if d.Disperse.Data > 0 {
+			return uint64(d.Disperse.Data),
+				uint64(d.Disperse.Data + d.Disperse.Redundancy)
+		}
+	}
+	return 1, 1
+}
+
+// capacity returns the usable, raw and allocated space of the bricks
+// of the volume
+func (v *VolumeEntry) capacity(tx *bolt.Tx) (*api.VolumeCapacity, error) {
+	c := &api.VolumeCapacity{}
+	for _, id := range v.BricksIds() {
+		brick, err := NewBrickEntryFromId(tx, id)
+		if err != nil {
+			return nil, err
+		}
+		c.Raw += brick.Info.Size
+		// Bricks of clones use the thin pools of the origin bricks
+		c.Allocated += brick.TpSize + brick.PoolMetadataSize
+	}
+	data, set := durabilityDataBricks(v.Info.Durability)
+	c.Usable = c.Raw * data / set
+	return c, nil
+}
+
+// capacity returns the storage of the devices of the cluster and the
+// capacity of its volumes, the volumes being created included as the
+// space of their bricks is already used on the devices
+func (c *ClusterEntry) capacity(tx *bolt.Tx) (*api.ClusterCapacity, error) {
+	cc := &api.ClusterCapacity{}
+	for _, nodeId := range c.Info.Nodes {
+		node, err := NewNodeEntryFromId(tx, nodeId)
+		if err != nil {
+			return nil, err
+		}
+		for _, deviceId := range node.Devices {
+			device, err := NewDeviceEntryFromId(tx, deviceId)
+			if err != nil {
+				return nil, err
+			}
+			cc.Devices.Total += device.Info.Storage.Total
+			cc.Devices.Free += device.Info.Storage.Free
+			cc.Devices.Used += device.Info.Storage.Used
+			cc.Devices.SnapshotOverhead += device.Info.Storage.SnapshotOverhead
+		}
+	}
+	for _, volumeId := range c.Info.Volumes {
+		volume, err := NewVolumeEntryFromId(tx, volumeId)
+		if err != nil {
+			return nil, err
+		}
+		vc, err := volume.capacity(tx)
+		if err != nil {
+			return nil, err
+		}
+		cc.Volumes.Usable += vc.Usable
+		cc.Volumes.Raw += vc.Raw
+		cc.Volumes.Allocated += vc.Allocated
+	}
+	return cc, nil
+}
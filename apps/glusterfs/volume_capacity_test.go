@@ -0,0 +1,91 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gorilla/mux"
+	client "github.com/heketi/heketi/client/api/go-client"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/tests"
+)
+
+func TestVolumeCapacity(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	c := client.NewClientNoAuth(ts.URL)
+	tests.Assert(t, c != nil)
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		6,    // nodes_per_cluster
+		2,    // devices_per_node,
+		1*TB, // disksize
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	vreq := &api.VolumeCreateRequest{}
+	vreq.Size = 90
+	vreq.Durability.Type = api.DurabilityReplicate
+	vreq.Durability.Replicate.Replica = 3
+	replica, err := c.VolumeCreate(vreq)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, replica.Capacity != nil)
+	tests.Assert(t, replica.Capacity.Usable == 90*GB, replica.Capacity)
+	tests.Assert(t, replica.Capacity.Raw == 270*GB, replica.Capacity)
+	tests.Assert(t, replica.Capacity.Allocated >= replica.Capacity.Raw,
+		replica.Capacity)
+
+	vreq = &api.VolumeCreateRequest{}
+	vreq.Size = 80
+	vreq.Durability.Type = api.DurabilityEC
+	vreq.Durability.Disperse.Data = 4
+	vreq.Durability.Disperse.Redundancy = 2
+	vreq.Snapshot.Enable = true
+	vreq.Snapshot.Factor = 1.5
+	disperse, err := c.VolumeCreate(vreq)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, disperse.Capacity.Usable == 80*GB, disperse.Capacity)
+	tests.Assert(t, disperse.Capacity.Raw == 120*GB, disperse.Capacity)
+	tests.Assert(t, disperse.Capacity.Allocated >= 180*GB, disperse.Capacity)
+
+	info, err := c.VolumeInfo(disperse.Id)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, *info.Capacity == *disperse.Capacity, info.Capacity)
+
+	cluster, err := c.ClusterInfo(replica.Cluster)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, cluster.Capacity != nil)
+	tests.Assert(t, cluster.Capacity.Volumes.Usable == 170*GB,
+		cluster.Capacity.Volumes)
+	tests.Assert(t, cluster.Capacity.Volumes.Raw == 390*GB,
+		cluster.Capacity.Volumes)
+	tests.Assert(t, cluster.Capacity.Volumes.Allocated ==
+		replica.Capacity.Allocated+disperse.Capacity.Allocated,
+		cluster.Capacity.Volumes)
+	tests.Assert(t, cluster.Capacity.Devices.Total == 12*TB,
+		cluster.Capacity.Devices)
+	tests.Assert(t, cluster.Capacity.Devices.Used ==
+		cluster.Capacity.Volumes.Allocated, cluster.Capacity.Devices)
+	tests.Assert(t, cluster.Capacity.Devices.Free ==
+		12*TB-cluster.Capacity.Devices.Used, cluster.Capacity.Devices)
+}
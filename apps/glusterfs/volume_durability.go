@@ -14,10 +14,50 @@ import (
 )
 
 type VolumeDurability interface {
-	BrickSizeGenerator(size uint64) func() (int, uint64, error)
+	BrickSizeGenerator(size uint64, limits brickLimits) func() (int, uint64, error)
 	MinVolumeSize() uint64
 	BricksInSet() int
 	SetDurability()
 	SetExecutorVolumeRequest(v *executors.VolumeRequest)
 	QuorumBrickCount() int
 }
+
+// brickSizeGenerator returns a generator of decreasing brick sizes for
+// size KB of a volume, halving the size of the bricks by doubling the
+// number of sets until the bricks are at most BrickMaxSize, or the
+// maximum size of the limits. Each brick of a set holds a data part of
+// its size. The generator fails once the bricks would be smaller than
+// min KB, or the larger minimum size of the limits.
+func brickSizeGenerator(size uint64, data int, min uint64,
+	limits brickLimits) func() (int, uint64, error) {
+
+	if limits.minSize > min {
+		min = limits.minSize
+	}
+	max := BrickMaxSize
+	if limits.maxSize != 0 {
+		max = limits.maxSize
+	}
+
+	sets := 1
+	return func() (int, uint64, error) {
+
+		var brick_size uint64
+		var num_sets int
+
+		for {
+			num_sets = sets
+			sets *= 2
+			brick_size = size / uint64(num_sets)
+			brick_size /= uint64(data)
+
+			if brick_size < min {
+				return 0, 0, ErrMinimumBrickSize
+			} else if brick_size <= max {
+				break
+			}
+		}
+
+		return num_sets, brick_size, nil
+	}
+}
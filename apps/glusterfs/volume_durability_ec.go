@@ -47,36 +47,17 @@ func (d *VolumeDisperseDurability) SetDurability() {
 	}
 }
 
-func (d *VolumeDisperseDurability) BrickSizeGenerator(size uint64) func() (int, uint64, error) {
+func (d *VolumeDisperseDurability) BrickSizeGenerator(size uint64,
+	limits brickLimits) func() (int, uint64, error) {
 
-	sets := 1
-	return func() (int, uint64, error) {
-
-		var brick_size uint64
-		var num_sets int
-
-		for {
-			num_sets = sets
-			sets *= 2
-			brick_size = size / uint64(num_sets)
-
-			// Divide what would be the brick size for replica by the
-			// number of data drives in the disperse request
-			brick_size /= uint64(d.Data)
-
-			if brick_size < BrickMinSize {
-				return 0, 0, ErrMinimumBrickSize
-			} else if brick_size <= BrickMaxSize {
-				break
-			}
-		}
-
-		return num_sets, brick_size, nil
-	}
+	// Divide what would be the brick size for replica by the
+	// number of data drives in the disperse request
+	return brickSizeGenerator(size, d.Data, brickMinSize(api.DurabilityEC),
+		limits)
 }
 
 func (d *VolumeDisperseDurability) MinVolumeSize() uint64 {
-	return BrickMinSize * uint64(d.Data)
+	return brickMinSize(api.DurabilityEC) * uint64(d.Data)
 }
 
 func (d *VolumeDisperseDurability) BricksInSet() int {
@@ -13,6 +13,7 @@ import (
 	"encoding/gob"
 
 	"github.com/heketi/heketi/executors"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
 )
 
 func init() {
@@ -40,6 +41,17 @@ func (n *NoneDurability) SetDurability() {
 	n.Replica = 1
 }
 
+func (n *NoneDurability) BrickSizeGenerator(size uint64,
+	limits brickLimits) func() (int, uint64, error) {
+
+	return brickSizeGenerator(size, 1, brickMinSize(api.DurabilityDistributeOnly),
+		limits)
+}
+
+func (n *NoneDurability) MinVolumeSize() uint64 {
+	return brickMinSize(api.DurabilityDistributeOnly)
+}
+
 func (n *NoneDurability) BricksInSet() int {
 	return 1
 }
@@ -43,32 +43,15 @@ func (r *VolumeReplicaDurability) SetDurability() {
 	}
 }
 
-func (r *VolumeReplicaDurability) BrickSizeGenerator(size uint64) func() (int, uint64, error) {
+func (r *VolumeReplicaDurability) BrickSizeGenerator(size uint64,
+	limits brickLimits) func() (int, uint64, error) {
 
-	sets := 1
-	return func() (int, uint64, error) {
-
-		var brick_size uint64
-		var num_sets int
-
-		for {
-			num_sets = sets
-			sets *= 2
-			brick_size = size / uint64(num_sets)
-
-			if brick_size < BrickMinSize {
-				return 0, 0, ErrMinimumBrickSize
-			} else if brick_size <= BrickMaxSize {
-				break
-			}
-		}
-
-		return num_sets, brick_size, nil
-	}
+	return brickSizeGenerator(size, 1, brickMinSize(api.DurabilityReplicate),
+		limits)
 }
 
 func (r *VolumeReplicaDurability) MinVolumeSize() uint64 {
-	return BrickMinSize
+	return brickMinSize(api.DurabilityReplicate)
 }
 
 func (r *VolumeReplicaDurability) BricksInSet() int {
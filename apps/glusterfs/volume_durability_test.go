@@ -13,6 +13,7 @@ import (
 	"testing"
 
 	"github.com/heketi/heketi/executors"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
 	"github.com/heketi/tests"
 )
 
@@ -77,7 +78,7 @@ func TestNoneDurability(t *testing.T) {
 	r := &NoneDurability{}
 	r.SetDurability()
 
-	gen := r.BrickSizeGenerator(100 * GB)
+	gen := r.BrickSizeGenerator(100*GB, brickLimits{})
 
 	// Gen 1
 	sets, brick_size, err := gen()
@@ -150,7 +151,7 @@ func TestDisperseDurability(t *testing.T) {
 	r.Data = 8
 	r.Redundancy = 3
 
-	gen := r.BrickSizeGenerator(200 * GB)
+	gen := r.BrickSizeGenerator(200*GB, brickLimits{})
 
 	// Gen 1
 	sets, brick_size, err := gen()
@@ -204,7 +205,7 @@ func TestDisperseDurabilityLargeBrickGenerator(t *testing.T) {
 	r.Data = 8
 	r.Redundancy = 3
 
-	gen := r.BrickSizeGenerator(800 * TB)
+	gen := r.BrickSizeGenerator(800*TB, brickLimits{})
 
 	// Gen 1
 	sets, brick_size, err := gen()
@@ -219,7 +220,7 @@ func TestReplicaDurabilityGenerator(t *testing.T) {
 	r := &VolumeReplicaDurability{}
 	r.Replica = 2
 
-	gen := r.BrickSizeGenerator(100 * GB)
+	gen := r.BrickSizeGenerator(100*GB, brickLimits{})
 
 	// Gen 1
 	sets, brick_size, err := gen()
@@ -290,7 +291,7 @@ func TestReplicaDurabilityLargeBrickGenerator(t *testing.T) {
 	r := &VolumeReplicaDurability{}
 	r.Replica = 2
 
-	gen := r.BrickSizeGenerator(100 * TB)
+	gen := r.BrickSizeGenerator(100*TB, brickLimits{})
 
 	// Gen 1
 	sets, brick_size, err := gen()
@@ -301,11 +302,43 @@ func TestReplicaDurabilityLargeBrickGenerator(t *testing.T) {
 	tests.Assert(t, 2 == r.QuorumBrickCount())
 }
 
+func TestReplicaDurabilityBrickLimitsGenerator(t *testing.T) {
+	r := &VolumeReplicaDurability{}
+	r.Replica = 2
+
+	// Larger bricks than the server allows
+	gen := r.BrickSizeGenerator(100*TB, brickLimits{maxSize: 50 * TB})
+	sets, brick_size, err := gen()
+	tests.Assert(t, err == nil)
+	tests.Assert(t, sets == 2, sets)
+	tests.Assert(t, brick_size == 50*TB, brick_size)
+
+	// No bricks smaller than the minimum of the volume
+	gen = r.BrickSizeGenerator(100*GB, brickLimits{minSize: 50 * GB})
+	sets, brick_size, err = gen()
+	tests.Assert(t, err == nil)
+	tests.Assert(t, sets == 1, sets)
+	tests.Assert(t, brick_size == 100*GB, brick_size)
+	sets, brick_size, err = gen()
+	tests.Assert(t, err == nil)
+	tests.Assert(t, sets == 2, sets)
+	tests.Assert(t, brick_size == 50*GB, brick_size)
+	_, _, err = gen()
+	tests.Assert(t, err == ErrMinimumBrickSize, err)
+
+	// The minimum of the server still applies
+	gen = r.BrickSizeGenerator(1*GB, brickLimits{minSize: 1 * MB})
+	_, _, err = gen()
+	tests.Assert(t, err == nil)
+	_, _, err = gen()
+	tests.Assert(t, err == ErrMinimumBrickSize, err)
+}
+
 func TestReplicaDurabilityQuorumBrickCount3(t *testing.T) {
 	r := &VolumeReplicaDurability{}
 	r.Replica = 3
 
-	gen := r.BrickSizeGenerator(100 * TB)
+	gen := r.BrickSizeGenerator(100*TB, brickLimits{})
 
 	// Gen 1
 	sets, brick_size, err := gen()
@@ -343,3 +376,40 @@ func TestDisperseDurabilityMinVolumeSize(t *testing.T) {
 
 	tests.Assert(t, minvolsize == BrickMinSize*8)
 }
+
+func TestDurabilityBrickMinSizeByType(t *testing.T) {
+	defer func(sizes map[api.DurabilityType]uint64) {
+		BrickMinSizeByDurability = sizes
+	}(BrickMinSizeByDurability)
+	BrickMinSizeByDurability = map[api.DurabilityType]uint64{
+		api.DurabilityEC: 4 * GB,
+	}
+
+	d := &VolumeDisperseDurability{}
+	d.Data = 4
+	d.Redundancy = 2
+	tests.Assert(t, d.MinVolumeSize() == 16*GB, d.MinVolumeSize())
+
+	r := &VolumeReplicaDurability{}
+	r.Replica = 3
+	tests.Assert(t, r.MinVolumeSize() == BrickMinSize, r.MinVolumeSize())
+
+	n := NewNoneDurability()
+	tests.Assert(t, n.MinVolumeSize() == BrickMinSize, n.MinVolumeSize())
+
+	// Bricks of 2GB are too small for the disperse volume only
+	gen := d.BrickSizeGenerator(8*GB, brickLimits{})
+	_, _, err := gen()
+	tests.Assert(t, err == ErrMinimumBrickSize, err)
+
+	gen = r.BrickSizeGenerator(2*GB, brickLimits{})
+	sets, brick_size, err := gen()
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, sets == 1)
+	tests.Assert(t, brick_size == 2*GB)
+
+	// The minimum of a type applies to the volumes of the type only
+	BrickMinSizeByDurability[api.DurabilityDistributeOnly] = 8 * GB
+	tests.Assert(t, n.MinVolumeSize() == 8*GB, n.MinVolumeSize())
+	tests.Assert(t, r.MinVolumeSize() == BrickMinSize, r.MinVolumeSize())
+}
@@ -14,6 +14,7 @@ import (
 	"encoding/gob"
 	"fmt"
 	"sort"
+	"time"
 
 	"github.com/boltdb/bolt"
 	"github.com/heketi/heketi/executors"
@@ -52,6 +53,48 @@ type VolumeEntry struct {
 	Durability           VolumeDurability `json:"-"`
 	GlusterVolumeOptions []string
 	Pending              PendingItem
+
+	// Ids of the bricks in the order of the volume in gluster, every
+	// BricksInSet bricks forming a set. Empty for volumes created
+	// before the order was recorded.
+	BrickOrder []string
+
+	// Options found different from GlusterVolumeOptions by the
+	// last check
+	OptionsDrift []api.VolumeOptionDrift
+
+	// Latest samples of the io of the volume
+	IOStats *VolumeIOStats
+
+	// Non-fatal issues found when the volume was created
+	Warnings []api.Warning
+
+	// Time the last block volume was removed from the block
+	// hosting volume, zero if it has block volumes
+	BlockEmptySince int64
+
+	// Time the delete of the volume was requested while it waits for
+	// its confirmation, zero otherwise
+	PendingDeleteSince int64
+
+	// Policy and reason the cluster of the volume was chosen by, nil
+	// if the create request listed the clusters or for the default
+	// selection policy
+	ClusterSelection *api.ClusterSelection
+
+	// Brick zone policy used instead of BrickZonePolicy when
+	// allocating bricks. It is not saved in the db.
+	brickZonePolicy string
+
+	// Nodes found unreachable before allocating the bricks of the
+	// volume, no brick is placed on them. It is not saved in the db.
+	unreachableNodes map[string]bool
+
+	// Nodes the create request places the bricks of the volume on,
+	// any node if empty, and nodes it keeps the bricks off. They are
+	// not saved in the db.
+	includeNodes map[string]bool
+	excludeNodes map[string]bool
 }
 
 func VolumeList(tx *bolt.Tx) ([]string, error) {
@@ -63,6 +106,89 @@ func VolumeList(tx *bolt.Tx) ([]string, error) {
 	return list, nil
 }
 
+// zonePolicy returns the brick zone policy to allocate the bricks
+// of the volume with
+func (v *VolumeEntry) zonePolicy() string {
+	if v.brickZonePolicy != "" {
+		return v.brickZonePolicy
+	}
+	return BrickZonePolicy
+}
+
+// sizeMiB returns the size of the volume in MiB. Volumes created
+// with a size in GiB only record the size in GiB.
+func (v *VolumeEntry) sizeMiB() int {
+	if v.Info.SizeMiB != 0 {
+		return v.Info.SizeMiB
+	}
+	return v.Info.Size * 1024
+}
+
+// addSize grows the recorded size of the volume by sizeGB, keeping the
+// size in MiB, if any, in step
+func (v *VolumeEntry) addSize(sizeGB int) {
+	v.Info.Size += sizeGB
+	if v.Info.SizeMiB != 0 {
+		v.Info.SizeMiB += sizeGB * 1024
+	}
+}
+
+// nodeAllowed returns false if the create request of the volume keeps
+// its bricks off the node of the device
+func (v *VolumeEntry) nodeAllowed(device *DeviceEntry) bool {
+	if len(v.includeNodes) != 0 && !v.includeNodes[device.NodeId] {
+		return false
+	}
+	return !v.excludeNodes[device.NodeId]
+}
+
+func nodeSet(ids []string) map[string]bool {
+	if len(ids) == 0 {
+		return nil
+	}
+	set := map[string]bool{}
+	for _, id := range ids {
+		set[id] = true
+	}
+	return set
+}
+
+// maxBricks returns the maximum number of bricks of the volume
+func (v *VolumeEntry) maxBricks() int {
+	if v.Info.MaxBricks > 0 {
+		return v.Info.MaxBricks
+	}
+	return BrickMaxNum
+}
+
+// brickLimitError describes why expanding the volume by the given
+// size exceeds the maximum number of bricks and how to get the
+// storage otherwise
+func (v *VolumeEntry) brickLimitError(sizeGB int) *api.BrickLimitError {
+	limit := v.maxBricks()
+	e := &api.BrickLimitError{
+		Message: fmt.Sprintf("Expanding volume %v by %v GiB would exceed "+
+			"its limit of %v bricks, it has %v bricks",
+			v.Info.Id, sizeGB, limit, len(v.Bricks)),
+		Volume: v.Info.Id,
+		Bricks: len(v.Bricks),
+		Limit:  limit,
+		Hints: []string{
+			"Add devices with more free space so that larger bricks, " +
+				"up to brick_max_size_gb, can be allocated",
+			"Create a new volume for the additional storage",
+			"Raise the limit of the volume with max_bricks when " +
+				"expanding it, or max_bricks_per_volume in the configuration",
+		},
+	}
+	if v.Info.BrickLimits.MaxDistribute != 0 {
+		e.Hints = append(e.Hints, fmt.Sprintf("The volume is limited "+
+			"to %v replica or disperse sets by max_distribute",
+			v.Info.BrickLimits.MaxDistribute))
+	}
+	return e
+}
+
 func NewVolumeEntry() *VolumeEntry {
 	entry := &VolumeEntry{}
 	entry.Bricks = make(sort.StringSlice, 0)
@@ -75,18 +201,47 @@ func NewVolumeEntryFromRequest(req *api.VolumeCreateRequest) *VolumeEntry {
 
 	vol := NewVolumeEntry()
 	vol.Info.Gid = req.Gid
+	vol.Info.Uid = req.Uid
+	vol.Info.Permissions = req.Permissions
+	vol.Info.SelinuxContext = req.SelinuxContext
 	vol.Info.Id = utils.GenUUID()
 	vol.Info.Durability = req.Durability
 	vol.Info.Snapshot = req.Snapshot
 	vol.Info.Size = req.Size
+	if req.SizeMiB != 0 {
+		vol.Info.Size = api.SizeGiB(req.SizeMiB)
+		vol.Info.SizeMiB = req.SizeMiB
+	}
 	vol.Info.Block = req.Block
+	vol.Info.MaxBricks = req.MaxBricks
+	vol.Info.BrickLimits = req.BrickLimits
+	vol.Info.Placement.TagMatch = copyTags(req.Placement.TagMatch)
+	vol.Info.Placement.SpreadTag = req.Placement.SpreadTag
+	vol.Info.Placement.SpreadEnclosure = req.Placement.SpreadEnclosure
+	vol.Info.Quota = copyVolumeQuota(&req.Quota)
+	vol.includeNodes = nodeSet(req.IncludeNodes)
+	vol.excludeNodes = nodeSet(req.ExcludeNodes)
 
 	if vol.Info.Block {
-		vol.Info.BlockInfo.FreeSize = req.Size
+		vol.Info.BlockInfo.FreeSize = vol.sizeMiB() / 1024
 		vol.GlusterVolumeOptions = []string{"group gluster-block"}
 
 	}
 
+	// Set default brick root ownership and permissions
+	if vol.Info.Gid == 0 {
+		vol.Info.Gid = VolumeDefaultGid
+	}
+	if vol.Info.Uid == 0 {
+		vol.Info.Uid = VolumeDefaultUid
+	}
+	if vol.Info.Permissions == "" {
+		vol.Info.Permissions = VolumeDefaultPermissions
+	}
+	if vol.Info.SelinuxContext == "" {
+		vol.Info.SelinuxContext = VolumeDefaultSelinuxContext
+	}
+
 	// Set default durability values
 	durability := vol.Info.Durability.Type
 	switch {
@@ -150,6 +305,31 @@ func NewVolumeEntryFromId(tx *bolt.Tx, id string) (*VolumeEntry, error) {
 	return entry, nil
 }
 
+// NewVolumeEntryFromGlusterId returns the volume entry with the
+// given gluster volume id.
+func NewVolumeEntryFromGlusterId(tx *bolt.Tx, glusterId string) (*VolumeEntry, error) {
+	godbc.Require(tx != nil)
+
+	if glusterId == "" {
+		return nil, ErrNotFound
+	}
+	id, err := lookupVolumeGlusterId(tx, glusterId)
+	if err != nil {
+		return nil, err
+	}
+	return NewVolumeEntryFromId(tx, id)
+}
+
+// NewVolumeEntryFromAnyId returns the volume entry with the given heketi
+// id, or with the given gluster volume id if no heketi id matches.
+func NewVolumeEntryFromAnyId(tx *bolt.Tx, id string) (*VolumeEntry, error) {
+	entry, err := NewVolumeEntryFromId(tx, id)
+	if err == ErrNotFound {
+		return NewVolumeEntryFromGlusterId(tx, id)
+	}
+	return entry, err
+}
+
 func (v *VolumeEntry) BucketName() string {
 	return BOLTDB_BUCKET_VOLUME
 }
@@ -158,10 +338,22 @@ func (v *VolumeEntry) Save(tx *bolt.Tx) error {
 	godbc.Require(tx != nil)
 	godbc.Require(len(v.Info.Id) > 0)
 
+	if err := indexVolumeName(tx, v); err != nil {
+		return err
+	}
+	if err := indexVolumeGlusterId(tx, v); err != nil {
+		return err
+	}
 	return EntrySave(tx, v, v.Info.Id)
 }
 
 func (v *VolumeEntry) Delete(tx *bolt.Tx) error {
+	if err := unindexVolumeName(tx, v); err != nil {
+		return err
+	}
+	if err := unindexVolumeGlusterId(tx, v); err != nil {
+		return err
+	}
 	return EntryDelete(tx, v, v.Info.Id)
 }
 
@@ -171,14 +363,35 @@ func (v *VolumeEntry) NewInfoResponse(tx *bolt.Tx) (*api.VolumeInfoResponse, err
 	info := api.NewVolumeInfoResponse()
 	info.Id = v.Info.Id
 	info.Cluster = v.Info.Cluster
+	info.GlusterId = v.Info.GlusterId
 	info.Mount = v.Info.Mount
 	info.Snapshot = v.Info.Snapshot
 	info.Size = v.Info.Size
+	info.SizeMiB = v.Info.SizeMiB
 	info.Durability = v.Info.Durability
 	info.Name = v.Info.Name
 	info.GlusterVolumeOptions = v.GlusterVolumeOptions
 	info.Block = v.Info.Block
 	info.BlockInfo = v.Info.BlockInfo
+	info.Gid = v.Info.Gid
+	info.Uid = v.Info.Uid
+	info.Permissions = v.Info.Permissions
+	info.SelinuxContext = v.Info.SelinuxContext
+	info.MaxBricks = v.Info.MaxBricks
+	info.BrickLimits = v.Info.BrickLimits
+	info.Tenant = v.Info.Tenant
+	info.Placement = v.Info.Placement
+	info.Quota = v.Info.Quota
+	info.BrickOrder = v.brickOrder()
+	info.OptionsDrift = v.OptionsDrift
+	info.Warnings = v.Warnings
+	info.ClusterSelection = v.ClusterSelection
+	if v.PendingDeleteSince != 0 {
+		info.PendingDelete = &api.VolumePendingDelete{
+			Since:    v.PendingDeleteSince,
+			Deadline: v.PendingDeleteSince + int64(DeleteConfirmationTimeout),
+		}
+	}
 
 	for _, brickid := range v.BricksIds() {
 		brick, err := NewBrickEntryFromId(tx, brickid)
@@ -193,6 +406,12 @@ func (v *VolumeEntry) NewInfoResponse(tx *bolt.Tx) (*api.VolumeInfoResponse, err
 		info.Bricks = append(info.Bricks, *brickinfo)
 	}
 
+	capacity, err := v.capacity(tx)
+	if err != nil {
+		return nil, err
+	}
+	info.Capacity = capacity
+
 	return info, nil
 }
 
@@ -222,18 +441,55 @@ func (v *VolumeEntry) Unmarshal(buffer []byte) error {
 func (v *VolumeEntry) BrickAdd(id string) {
 	godbc.Require(!utils.SortedStringHas(v.Bricks, id))
 
+	// Gluster adds the bricks after the bricks of the volume
+	if len(v.BrickOrder) == len(v.Bricks) {
+		v.BrickOrder = append(v.BrickOrder, id)
+	}
 	v.Bricks = append(v.Bricks, id)
 	v.Bricks.Sort()
 }
 
+// BrickReplace adds the new brick to the volume at the position of the
+// old brick in the order of the bricks. The old brick is then deleted
+// with BrickDelete.
+func (v *VolumeEntry) BrickReplace(oldId, newId string) {
+	godbc.Require(!utils.SortedStringHas(v.Bricks, newId))
+
+	for i, id := range v.BrickOrder {
+		if id == oldId {
+			v.BrickOrder[i] = newId
+		}
+	}
+	v.Bricks = append(v.Bricks, newId)
+	v.Bricks.Sort()
+}
+
 func (v *VolumeEntry) BrickDelete(id string) {
 	v.Bricks = utils.SortedStringsDelete(v.Bricks, id)
+	for i, b := range v.BrickOrder {
+		if b == id {
+			v.BrickOrder = append(v.BrickOrder[:i], v.BrickOrder[i+1:]...)
+			break
+		}
+	}
+}
+
+// brickOrder returns the ids of the bricks of the volume in the order
+// of the volume in gluster, or nil if the order is not known
+func (v *VolumeEntry) brickOrder() []string {
+	if len(v.BrickOrder) == 0 || len(v.BrickOrder) != len(v.Bricks) {
+		return nil
+	}
+	return append([]string{}, v.BrickOrder...)
 }
 
 func (v *VolumeEntry) Create(db wdb.DB,
 	executor executors.Executor,
 	allocator Allocator) (e error) {
 
+	if err := v.checkNodesReachable(db, executor); err != nil {
+		return err
+	}
 	return RunOperation(
 		NewVolumeCreateOperation(v, db),
 		allocator,
@@ -245,9 +501,20 @@ func (v *VolumeEntry) tryAllocateBricks(
 	allocator Allocator,
 	possibleClusters []string) (brick_entries []*BrickEntry, err error) {
 
+	return v.tryClusters(possibleClusters, func(cluster string) ([]*BrickEntry, error) {
+		return v.allocBricksInCluster(db, allocator, cluster,
+			uint64(v.sizeMiB())*MB)
+	})
+}
+
+// tryClusters calls alloc with each cluster in turn until the bricks of
+// the volume are allocated in one of them
+func (v *VolumeEntry) tryClusters(possibleClusters []string,
+	alloc func(cluster string) ([]*BrickEntry, error)) (brick_entries []*BrickEntry, err error) {
+
 	for _, cluster := range possibleClusters {
 		// Check this cluster for space
-		brick_entries, err = v.allocBricksInCluster(db, allocator, cluster, v.Info.Size)
+		brick_entries, err = alloc(cluster)
 
 		if err == nil {
 			v.Info.Cluster = cluster
@@ -303,26 +570,26 @@ func (v *VolumeEntry) createOneShot(db wdb.DB,
 		}
 	}()
 
-	brick_entries, e = v.createVolumeComponents(db, allocator)
+	brick_entries, e = v.createVolumeComponents(db, allocator, nil)
 	if e != nil {
 		return e
 	}
 	return v.createVolumeExec(db, executor, brick_entries)
 }
 
-func (v *VolumeEntry) createVolumeComponents(db wdb.DB,
-	allocator Allocator) (brick_entries []*BrickEntry, e error) {
+// possibleClusters returns the clusters eligible to hold the volume
+func (v *VolumeEntry) possibleClusters(db wdb.RODB) ([]string, error) {
 
 	// Get list of clusters
 	var possibleClusters []string
 	if len(v.Info.Clusters) == 0 {
 		err := db.View(func(tx *bolt.Tx) error {
 			var err error
-			possibleClusters, err = ClusterList(tx)
+			possibleClusters, err = ActiveClusterList(tx)
 			return err
 		})
 		if err != nil {
-			return brick_entries, err
+			return nil, err
 		}
 	} else {
 		possibleClusters = v.Info.Clusters
@@ -331,15 +598,64 @@ func (v *VolumeEntry) createVolumeComponents(db wdb.DB,
 	cr := ClusterReq{v.Info.Block, v.Info.Name}
 	possibleClusters, err := eligibleClusters(db, cr, possibleClusters)
 	if err != nil {
-		return brick_entries, err
+		return nil, err
 	}
 	if len(possibleClusters) == 0 {
 		logger.LogError("No clusters eligible to satisfy create volume request")
-		return brick_entries, ErrNoSpace
+		return nil, ErrNoSpace
 	}
 	logger.Debug("Using the following clusters: %+v", possibleClusters)
+	return possibleClusters, nil
+}
+
+// rankedClusters orders the possible clusters of a volume whose create
+// request does not list clusters by the cluster selection policy. The
+// ranks are nil for the default policy.
+func (v *VolumeEntry) rankedClusters(db wdb.RODB,
+	selector *clusterSelector) ([]string, []clusterRank, error) {
+
+	possibleClusters, err := v.possibleClusters(db)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(v.Info.Clusters) != 0 ||
+		ClusterSelectionPolicy == ClusterSelectionOrdered {
+		return possibleClusters, nil, nil
+	}
 
-	return v.saveCreateVolume(db, allocator, possibleClusters)
+	var ranks []clusterRank
+	err = db.View(func(tx *bolt.Tx) error {
+		var err error
+		ranks, err = selector.rank(tx, ClusterSelectionPolicy, possibleClusters)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	possibleClusters = []string{}
+	for _, rank := range ranks {
+		possibleClusters = append(possibleClusters, rank.id)
+	}
+	return possibleClusters, ranks, nil
+}
+
+// createVolumeComponents allocates the bricks of the volume and saves
+// the volume. The selector orders the clusters when the volume does
+// not list clusters.
+func (v *VolumeEntry) createVolumeComponents(db wdb.DB,
+	allocator Allocator,
+	selector *clusterSelector) (brick_entries []*BrickEntry, e error) {
+
+	possibleClusters, ranks, err := v.rankedClusters(db, selector)
+	if err != nil {
+		return brick_entries, err
+	}
+
+	brick_entries, err = v.saveCreateVolume(db, allocator, possibleClusters, ranks)
+	if err == nil && ranks != nil {
+		selector.chosen(v.Info.Cluster)
+	}
+	return brick_entries, err
 }
 
 func (v *VolumeEntry) createVolumeExec(db wdb.DB,
@@ -358,7 +674,8 @@ func (v *VolumeEntry) createVolumeExec(db wdb.DB,
 
 func (v *VolumeEntry) saveCreateVolume(db wdb.DB,
 	allocator Allocator,
-	possibleClusters []string) (brick_entries []*BrickEntry, err error) {
+	possibleClusters []string,
+	ranks []clusterRank) (brick_entries []*BrickEntry, err error) {
 
 	err = db.Update(func(tx *bolt.Tx) error {
 		txdb := wdb.WrapTx(tx)
@@ -371,6 +688,8 @@ func (v *VolumeEntry) saveCreateVolume(db wdb.DB,
 			// But for other callers (Expand), we keep it.
 			return ErrNoSpace
 		}
+		v.ClusterSelection = clusterSelection(ClusterSelectionPolicy,
+			ranks, v.Info.Cluster)
 
 		err = v.updateMountInfo(txdb)
 		if err != nil {
@@ -379,7 +698,7 @@ func (v *VolumeEntry) saveCreateVolume(db wdb.DB,
 
 		// Save volume information
 		if v.Info.Block {
-			v.Info.BlockInfo.FreeSize = v.Info.Size
+			v.Info.BlockInfo.FreeSize = v.sizeMiB() / 1024
 		}
 		err := v.Save(tx)
 		if err != nil {
@@ -397,7 +716,7 @@ func (v *VolumeEntry) saveCreateVolume(db wdb.DB,
 	return
 }
 
-func (v *VolumeEntry) deleteVolumeExec(db wdb.RODB,
+func (v *VolumeEntry) deleteVolumeExec(db wdb.DB,
 	executor executors.Executor,
 	brick_entries []*BrickEntry,
 	sshhost string) error {
@@ -418,7 +737,11 @@ func (v *VolumeEntry) deleteVolumeExec(db wdb.RODB,
 
 	// :TODO: What if the host is no longer available, we may need to try others
 	// Stop volume
-	err = executor.VolumeDestroy(sshhost, v.Info.Name)
+	intent := NewIntentEntry(IntentVolumeDestroy, sshhost)
+	intent.VolumeName = v.Info.Name
+	err = withIntent(db, intent, func() error {
+		return executor.VolumeDestroy(sshhost, v.Info.Name)
+	})
 	if err != nil {
 		logger.LogError("Unable to delete volume: %v", err)
 		return err
@@ -521,14 +844,15 @@ func (v *VolumeEntry) expandVolumeComponents(db wdb.DB,
 		// Allocate new bricks in the cluster
 		txdb := wdb.WrapTx(tx)
 		var err error
-		brick_entries, err = v.allocBricksInCluster(txdb, allocator, v.Info.Cluster, sizeGB)
+		brick_entries, err = v.allocBricksInCluster(txdb, allocator, v.Info.Cluster,
+			uint64(sizeGB)*GB)
 		if err != nil {
 			return err
 		}
 
 		// Increase the recorded volume size
 		if setSize {
-			v.Info.Size += sizeGB
+			v.addSize(sizeGB)
 		}
 
 		// Save brick entries
@@ -617,10 +941,11 @@ func (v *VolumeEntry) checkBricksCanBeDestroyed(db wdb.RODB,
 	// Create a goroutine for each brick
 	for _, brick := range brick_entries {
 		sg.Add(1)
-		go func(b *BrickEntry) {
+		b := brick
+		go func() {
 			defer sg.Done()
 			sg.Err(b.DestroyCheck(db, executor))
-		}(brick)
+		}()
 	}
 
 	// Wait here until all goroutines have returned.  If
@@ -633,16 +958,24 @@ func (v *VolumeEntry) checkBricksCanBeDestroyed(db wdb.RODB,
 }
 
 func VolumeEntryUpgrade(tx *bolt.Tx) error {
-	return nil
+	if err := rebuildVolumeNameIndex(tx); err != nil {
+		return err
+	}
+	return rebuildVolumeGlusterIdIndex(tx)
 }
 
 func (v *VolumeEntry) BlockVolumeAdd(id string) {
 	v.Info.BlockInfo.BlockVolumes = append(v.Info.BlockInfo.BlockVolumes, id)
 	v.Info.BlockInfo.BlockVolumes.Sort()
+	v.BlockEmptySince = 0
 }
 
 func (v *VolumeEntry) BlockVolumeDelete(id string) {
+	hadBlockVolumes := len(v.Info.BlockInfo.BlockVolumes) != 0
 	v.Info.BlockInfo.BlockVolumes = utils.SortedStringsDelete(v.Info.BlockInfo.BlockVolumes, id)
+	if hadBlockVolumes && len(v.Info.BlockInfo.BlockVolumes) == 0 {
+		v.BlockEmptySince = time.Now().Unix()
+	}
 }
 
 // Visible returns true if this volume is meant to be visible to
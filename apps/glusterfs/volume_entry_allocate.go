@@ -11,10 +11,12 @@ package glusterfs
 
 import (
 	"fmt"
+	"sort"
 
 	"github.com/boltdb/bolt"
 	"github.com/heketi/heketi/executors"
 	wdb "github.com/heketi/heketi/pkg/db"
+	"github.com/heketi/heketi/pkg/faults"
 	"github.com/heketi/heketi/pkg/glusterfs/api"
 	"github.com/heketi/heketi/pkg/utils"
 )
@@ -42,26 +44,275 @@ func tryAllocateBrickOnDevice(v *VolumeEntry, device *DeviceEntry,
 	return brick
 }
 
+// brickSetDevices holds the devices the allocator proposes for the
+// bricks of a set. The generator is shared by all the bricks of the set.
+type brickSetDevices struct {
+	deviceCh <-chan string
+	errc     <-chan error
+	drained  bool
+
+	// Brick zone policy used to place the bricks of the set
+	zonePolicy string
+
+	// Devices passed over because their zone is already used by the
+	// set. They are used when the zone policy is best-effort and the
+	// generator has no more devices.
+	deferred []*DeviceEntry
+
+	// Set when expanding a volume. All the devices of the generator
+	// are then read into candidates and ordered by the scorer.
+	scorer     *brickPlacementScorer
+	candidates []*DeviceEntry
+
+	// Logger of the request the bricks are placed for
+	log *utils.Logger
+}
+
+// brickPlacementScorer scores devices by the number of bricks of the
+// volume already placed on their node. It is used when expanding a
+// volume so that new sets avoid the nodes that already hold more than
+// their share of the bricks of the volume.
+type brickPlacementScorer struct {
+	nodeBricks map[string]int
+}
+
+func newBrickPlacementScorer(tx *bolt.Tx, v *VolumeEntry) (*brickPlacementScorer, error) {
+	s := &brickPlacementScorer{
+		nodeBricks: map[string]int{},
+	}
+	for _, id := range v.Bricks {
+		brick, err := NewBrickEntryFromId(tx, id)
+		if err != nil {
+			return nil, err
+		}
+		s.nodeBricks[brick.Info.NodeId]++
+	}
+	return s, nil
+}
+
+// score returns the number of bricks of the volume on the node of
+// the device. Lower is better.
+func (s *brickPlacementScorer) score(device *DeviceEntry) int {
+	return s.nodeBricks[device.NodeId]
+}
+
+// add accounts for a new brick of the volume
+func (s *brickPlacementScorer) add(brick *BrickEntry) {
+	s.nodeBricks[brick.Info.NodeId]++
+}
+
+// rank returns the devices ordered by score, keeping the order of
+// the allocator for devices with the same score
+func (s *brickPlacementScorer) rank(devices []*DeviceEntry) []*DeviceEntry {
+	ranked := make([]*DeviceEntry, len(devices))
+	copy(ranked, devices)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return s.score(ranked[i]) < s.score(ranked[j])
+	})
+	return ranked
+}
+
+func cachedDevice(tx *bolt.Tx,
+	devcache map[string](*DeviceEntry),
+	deviceId string) (*DeviceEntry, error) {
+
+	// Get device entry from cache if possible
+	device, ok := devcache[deviceId]
+	if !ok {
+		// Get device entry from db otherwise
+		var err error
+		device, err = NewDeviceEntryFromId(tx, deviceId)
+		if err != nil {
+			return nil, err
+		}
+		devcache[deviceId] = device
+	}
+	return device, nil
+}
+
+// deviceZoneOk returns false if the node of the device is in a zone
+// already used by a brick of the set
+func deviceZoneOk(tx *bolt.Tx,
+	nodecache map[string](*NodeEntry),
+	device *DeviceEntry,
+	setlist []*BrickEntry,
+	zonePolicy string) (bool, error) {
+
+	if zonePolicy == BrickZonePolicyNone || len(setlist) == 0 {
+		return true, nil
+	}
+
+	zone := func(nodeId string) (int, error) {
+		node, err := cachedNode(tx, nodecache, nodeId)
+		if err != nil {
+			return 0, err
+		}
+		return node.Info.Zone, nil
+	}
+
+	deviceZone, err := zone(device.NodeId)
+	if err != nil {
+		return false, err
+	}
+	for _, brickInSet := range setlist {
+		brickZone, err := zone(brickInSet.Info.NodeId)
+		if err != nil {
+			return false, err
+		}
+		if brickZone == deviceZone {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// deviceCandidateOk returns whether a brick of the set may be placed on
+// the device: its node is reachable and allowed by the create request,
+// the tags of the volume place bricks on it and it keeps the bricks of
+// the set in different zones. With the best-effort zone policy, a
+// device failing only the zone check is returned as a fall back.
+func deviceCandidateOk(tx *bolt.Tx, v *VolumeEntry,
+	devcache map[string](*DeviceEntry),
+	nodecache map[string](*NodeEntry),
+	devices *brickSetDevices,
+	device *DeviceEntry,
+	setlist []*BrickEntry) (ok bool, fallback bool, err error) {
+
+	// Skip the nodes that could not be reached
+	if !v.nodeReachable(device) {
+		return false, false, nil
+	}
+
+	// Skip the nodes the create request keeps the bricks off
+	if !v.nodeAllowed(device) {
+		return false, false, nil
+	}
+
+	// Only use the devices the tags of the volume place bricks on
+	placementOk, err := devicePlacementOk(tx, devcache, nodecache,
+		device, setlist, &v.Info.Placement)
+	if err != nil || !placementOk {
+		return false, false, err
+	}
+
+	// Keep bricks of the set in different zones
+	zoneOk, err := deviceZoneOk(tx, nodecache, device, setlist,
+		devices.zonePolicy)
+	if err != nil {
+		return false, false, err
+	}
+	if !zoneOk {
+		return false, devices.zonePolicy == BrickZonePolicyBestEffort, nil
+	}
+	return true, false, nil
+}
+
 func findDeviceAndBrickForSet(tx *bolt.Tx, v *VolumeEntry,
 	devcache map[string](*DeviceEntry),
-	deviceCh <-chan string,
-	errc <-chan error,
+	nodecache map[string](*NodeEntry),
+	devices *brickSetDevices,
 	setlist []*BrickEntry,
 	brick_size uint64) (*BrickEntry, *DeviceEntry, error) {
 
+	if devices.scorer != nil {
+		return findScoredDeviceAndBrickForSet(tx, v, devcache, nodecache,
+			devices, setlist, brick_size)
+	}
+
 	// Check the ring for devices to place the brick
-	for deviceId := range deviceCh {
+	for !devices.drained {
+		deviceId, ok := <-devices.deviceCh
+		if !ok {
+			devices.drained = true
+
+			// Check if allocator returned an error
+			if err := <-devices.errc; err != nil {
+				return nil, nil, err
+			}
+			break
+		}
+
+		device, err := cachedDevice(tx, devcache, deviceId)
+		if err != nil {
+			return nil, nil, err
+		}
 
-		// Get device entry from cache if possible
-		device, ok := devcache[deviceId]
+		ok, fallback, err := deviceCandidateOk(tx, v, devcache, nodecache,
+			devices, device, setlist)
+		if err != nil {
+			return nil, nil, err
+		}
+		if fallback {
+			devices.deferred = append(devices.deferred, device)
+		}
 		if !ok {
-			// Get device entry from db otherwise
-			var err error
-			device, err = NewDeviceEntryFromId(tx, deviceId)
-			if err != nil {
+			continue
+		}
+
+		brick := tryAllocateBrickOnDevice(v, device, setlist, brick_size)
+		if brick == nil {
+			continue
+		}
+
+		return brick, device, nil
+	}
+
+	// Fall back to the devices in zones already used by the set
+	for _, device := range devices.deferred {
+		brick := tryAllocateBrickOnDevice(v, device, setlist, brick_size)
+		if brick == nil {
+			continue
+		}
+
+		devices.log.Warning("Brick %v placed in a zone already used by its set",
+			brick.Id())
+		return brick, device, nil
+	}
+
+	// No devices found
+	return nil, nil, ErrNoSpace
+}
+
+// findScoredDeviceAndBrickForSet places the brick on the device with the
+// best score among all the devices proposed by the allocator for the set
+func findScoredDeviceAndBrickForSet(tx *bolt.Tx, v *VolumeEntry,
+	devcache map[string](*DeviceEntry),
+	nodecache map[string](*NodeEntry),
+	devices *brickSetDevices,
+	setlist []*BrickEntry,
+	brick_size uint64) (*BrickEntry, *DeviceEntry, error) {
+
+	for !devices.drained {
+		deviceId, ok := <-devices.deviceCh
+		if !ok {
+			devices.drained = true
+
+			// Check if allocator returned an error
+			if err := <-devices.errc; err != nil {
 				return nil, nil, err
 			}
-			devcache[deviceId] = device
+			break
+		}
+
+		device, err := cachedDevice(tx, devcache, deviceId)
+		if err != nil {
+			return nil, nil, err
+		}
+		devices.candidates = append(devices.candidates, device)
+	}
+
+	deferred := []*DeviceEntry{}
+	for _, device := range devices.scorer.rank(devices.candidates) {
+		ok, fallback, err := deviceCandidateOk(tx, v, devcache, nodecache,
+			devices, device, setlist)
+		if err != nil {
+			return nil, nil, err
+		}
+		if fallback {
+			deferred = append(deferred, device)
+		}
+		if !ok {
+			continue
 		}
 
 		brick := tryAllocateBrickOnDevice(v, device, setlist, brick_size)
@@ -72,9 +323,16 @@ func findDeviceAndBrickForSet(tx *bolt.Tx, v *VolumeEntry,
 		return brick, device, nil
 	}
 
-	// Check if allocator returned an error
-	if err := <-errc; err != nil {
-		return nil, nil, err
+	// Fall back to the devices in zones already used by the set
+	for _, device := range deferred {
+		brick := tryAllocateBrickOnDevice(v, device, setlist, brick_size)
+		if brick == nil {
+			continue
+		}
+
+		devices.log.Warning("Brick %v placed in a zone already used by its set",
+			brick.Id())
+		return brick, device, nil
 	}
 
 	// No devices found
@@ -86,6 +344,25 @@ type BrickAllocation struct {
 	Devices []*DeviceEntry
 }
 
+// Save writes the bricks and devices of the allocation to the db.
+// A device that received more than one brick appears multiple times
+// in Devices but is only serialized and saved once.
+func (r *BrickAllocation) Save(tx *bolt.Tx) error {
+	bricks := make(map[string]DbEntry, len(r.Bricks))
+	for _, b := range r.Bricks {
+		bricks[b.Info.Id] = b
+	}
+	devices := make(map[string]DbEntry, len(r.Devices))
+	for _, d := range r.Devices {
+		devices[d.Info.Id] = d
+	}
+
+	if err := EntrySaveBatch(tx, bricks); err != nil {
+		return err
+	}
+	return EntrySaveBatch(tx, devices)
+}
+
 func allocateBricks(
 	db wdb.RODB,
 	allocator Allocator,
@@ -94,19 +371,32 @@ func allocateBricks(
 	bricksets int,
 	brick_size uint64) (*BrickAllocation, error) {
 
+	log := allocatorLogger(allocator)
 	r := &BrickAllocation{
 		Bricks:  []*BrickEntry{},
 		Devices: []*DeviceEntry{},
 	}
 
 	devcache := map[string](*DeviceEntry){}
+	nodecache := map[string](*NodeEntry){}
 
 	err := db.View(func(tx *bolt.Tx) error {
 		txdb := wdb.WrapTx(tx)
 
+		// When expanding, take the bricks the volume already has
+		// into account
+		var scorer *brickPlacementScorer
+		if len(v.Bricks) > 0 {
+			var err error
+			scorer, err = newBrickPlacementScorer(tx, v)
+			if err != nil {
+				return err
+			}
+		}
+
 		// Determine allocation for each brick required for this volume
 		for brick_num := 0; brick_num < bricksets; brick_num++ {
-			logger.Info("brick_num: %v", brick_num)
+			log.Info("brick_num: %v", brick_num)
 
 			// Create a brick set list to later make sure that the
 			// proposed bricks and devices are acceptable
@@ -122,12 +412,20 @@ func allocateBricks(
 				close(done)
 			}()
 
+			devices := &brickSetDevices{
+				deviceCh:   deviceCh,
+				errc:       errc,
+				zonePolicy: v.zonePolicy(),
+				scorer:     scorer,
+				log:        log,
+			}
+
 			// Check location has space for each brick and its replicas
 			for i := 0; i < v.Durability.BricksInSet(); i++ {
-				logger.Debug("%v / %v", i, v.Durability.BricksInSet())
+				log.Debug("%v / %v", i, v.Durability.BricksInSet())
 
 				brick, device, err := findDeviceAndBrickForSet(tx,
-					v, devcache, deviceCh, errc, setlist,
+					v, devcache, nodecache, devices, setlist,
 					brick_size)
 				if err != nil {
 					return err
@@ -145,6 +443,9 @@ func allocateBricks(
 				setlist = append(setlist, brick)
 
 				device.BrickAdd(brick.Id())
+				if scorer != nil {
+					scorer.add(brick)
+				}
 			}
 		}
 
@@ -156,54 +457,71 @@ func allocateBricks(
 
 	// Only assign bricks to the volume object on success
 	for _, brick := range r.Bricks {
-		logger.Debug("Adding brick %v to volume %v", brick.Id(), v.Info.Id)
+		log.Debug("Adding brick %v to volume %v", brick.Id(), v.Info.Id)
 		v.BrickAdd(brick.Id())
 	}
 
 	return r, nil
 }
 
+// allocBricksInCluster allocates bricks for size KB of the volume in the
+// cluster, trying smaller bricks until they fit
 func (v *VolumeEntry) allocBricksInCluster(db wdb.DB,
 	allocator Allocator,
 	cluster string,
-	gbsize int) ([]*BrickEntry, error) {
+	size uint64) ([]*BrickEntry, error) {
+
+	return v.tryBrickSizes(allocatorLogger(allocator), size, func(sets int, brick_size uint64) ([]*BrickEntry, error) {
+		return v.allocBricks(db, allocator, cluster, sets, brick_size)
+	})
+}
 
-	size := uint64(gbsize) * GB
+// tryBrickSizes calls alloc with decreasing brick sizes for size KB of
+// the volume until the bricks fit
+func (v *VolumeEntry) tryBrickSizes(log *utils.Logger,
+	size uint64,
+	alloc func(sets int, brick_size uint64) ([]*BrickEntry, error)) ([]*BrickEntry, error) {
 
 	// Setup a brick size generator
 	// Note: subsequent calls to gen need to return decreasing
 	//       brick sizes in order for the following code to work!
-	gen := v.Durability.BrickSizeGenerator(size)
+	limits := newBrickLimits(&v.Info.BrickLimits)
+	gen := v.Durability.BrickSizeGenerator(size, limits)
 
 	// Try decreasing possible brick sizes until space is found
 	for {
 		// Determine next possible brick size
 		sets, brick_size, err := gen()
 		if err != nil {
-			logger.Err(err)
+			log.Err(err)
 			return nil, err
 		}
 
 		num_bricks := sets * v.Durability.BricksInSet()
 
-		logger.Debug("brick_size = %v", brick_size)
-		logger.Debug("sets = %v", sets)
-		logger.Debug("num_bricks = %v", num_bricks)
+		log.Debug("brick_size = %v", brick_size)
+		log.Debug("sets = %v", sets)
+		log.Debug("num_bricks = %v", num_bricks)
 
 		// Check that the volume would not have too many bricks
-		if (num_bricks + len(v.Bricks)) > BrickMaxNum {
-			logger.Debug("Maximum number of bricks reached")
+		if (num_bricks + len(v.Bricks)) > v.maxBricks() {
+			log.Debug("Maximum number of bricks reached")
+			return nil, ErrMaxBricks
+		}
+		if limits.maxSets != 0 &&
+			sets+len(v.Bricks)/v.Durability.BricksInSet() > limits.maxSets {
+			log.Debug("Maximum distribute count reached")
 			return nil, ErrMaxBricks
 		}
 
 		// Allocate bricks in the cluster
-		brick_entries, err := v.allocBricks(db, allocator, cluster, sets, brick_size)
+		brick_entries, err := alloc(sets, brick_size)
 		if err == ErrNoSpace {
-			logger.Debug("No space, re-trying with smaller brick size")
+			log.Debug("No space, re-trying with smaller brick size")
 			continue
 		}
 		if err != nil {
-			logger.Err(err)
+			log.Err(err)
 			return nil, err
 		}
 
@@ -214,6 +532,11 @@ func (v *VolumeEntry) allocBricksInCluster(db wdb.DB,
 
 func (v *VolumeEntry) getBrickEntryfromBrickName(db wdb.RODB, brickname string) (brickEntry *BrickEntry, e error) {
 
+	host, path, err := utils.SplitBrickName(brickname)
+	if err != nil {
+		return nil, err
+	}
+
 	var nodeEntry *NodeEntry
 	for _, brickid := range v.BricksIds() {
 
@@ -233,7 +556,7 @@ func (v *VolumeEntry) getBrickEntryfromBrickName(db wdb.RODB, brickname string)
 			return nil, err
 		}
 
-		if brickname == fmt.Sprintf("%v:%v", nodeEntry.Info.Hostnames.Storage[0], brickEntry.Info.Path) {
+		if path == brickEntry.Info.Path && nodeEntry.IsStorageHost(host) {
 			return brickEntry, nil
 		}
 	}
@@ -245,12 +568,20 @@ func (v *VolumeEntry) getBrickSetForBrickId(db wdb.DB,
 	executor executors.Executor,
 	oldBrickId string, node string) ([]*BrickEntry, error) {
 
+	log := executorLogger(executor)
+
+	// Gluster keeps the order heketi created the bricks in, unless
+	// the volume was changed outside of heketi
+	if order := v.brickOrder(); order != nil {
+		return v.recordedBrickSet(db, order, oldBrickId)
+	}
+
 	setlist := make([]*BrickEntry, 0)
 
 	// Determine the setlist by getting data from Gluster
 	vinfo, err := executor.VolumeInfo(node, v.Info.Name)
 	if err != nil {
-		logger.LogError("Unable to get volume info from gluster node %v for volume %v: %v", node, v.Info.Name, err)
+		log.LogError("Unable to get volume info from gluster node %v for volume %v: %v", node, v.Info.Name, err)
 		return setlist, err
 	}
 
@@ -265,7 +596,7 @@ func (v *VolumeEntry) getBrickSetForBrickId(db wdb.DB,
 		for _, brick = range vinfo.Bricks.BrickList[slicestartindex : slicestartindex+v.Durability.BricksInSet()] {
 			brickentry, err := v.getBrickEntryfromBrickName(db, brick.Name)
 			if err != nil {
-				logger.LogError("Unable to create brick entry using brick name:%v, error: %v", brick.Name, err)
+				log.LogError("Unable to create brick entry using brick name:%v, error: %v", brick.Name, err)
 				return setlist, err
 			}
 			if brickentry.Id() == oldBrickId {
@@ -280,7 +611,7 @@ func (v *VolumeEntry) getBrickSetForBrickId(db wdb.DB,
 	}
 
 	if !foundbrickset {
-		logger.LogError("Unable to find brick set for brick %v, db is possibly corrupt", oldBrickId)
+		log.LogError("Unable to find brick set for brick %v, db is possibly corrupt", oldBrickId)
 		return setlist, ErrNotFound
 	}
 
@@ -340,57 +671,255 @@ func (v *VolumeEntry) canReplaceBrickInBrickSet(db wdb.DB,
 	return nil
 }
 
+// brickReplaceStepFunc is called with each step of a brick replace
+// as it is reached
+type brickReplaceStepFunc func(step string)
+
 func (v *VolumeEntry) replaceBrickInVolume(db wdb.DB, executor executors.Executor,
 	allocator Allocator,
-	oldBrickId string) (e error) {
+	oldBrickId string) error {
 
-	var oldBrickEntry *BrickEntry
-	var oldDeviceEntry *DeviceEntry
-	var newDeviceEntry *DeviceEntry
-	var oldBrickNodeEntry *NodeEntry
-	var newBrickNodeEntry *NodeEntry
-	var newBrickEntry *BrickEntry
+	return v.replaceBrickInVolumeWithProgress(db, executor, allocator,
+		oldBrickId, nil)
+}
+
+// brickReplacement holds the state needed to replace a brick of the
+// volume once a destination brick has been allocated
+type brickReplacement struct {
+	oldBrick  *BrickEntry
+	oldDevice *DeviceEntry
+	oldNode   *NodeEntry
+
+	// Manage host name of a node running glusterd
+	host    string
+	setlist []*BrickEntry
+
+	// Placement of the volume, with the nodes of the cluster holding
+	// the tags and the values of the spread tag used by the set
+	placement    *api.VolumePlacement
+	nodes        map[string](*NodeEntry)
+	spreadValues map[string]bool
+	enclosures   map[string]bool
+
+	// Zone policy of the volume, with the zones of the nodes of the
+	// cluster and the zones used by the set
+	zonePolicy string
+	nodeZones  map[string]int
+	setZones   map[int]bool
+}
+
+// deviceOk returns true if the device can hold the replacement brick,
+// which may neither be on the device of the old brick nor on a node
+// already holding a brick of the set, and must follow the placement
+// and the zone policy of the volume
+func (r *brickReplacement) deviceOk(device *DeviceEntry) bool {
+	return r.devicePlacementOk(device) && r.deviceZoneOk(device)
+}
+
+// deviceFallbackOk returns true if, with the best-effort zone policy,
+// the device fails only the zone check of deviceOk. Such a device is
+// used when no device passes deviceOk, as when creating the volume.
+func (r *brickReplacement) deviceFallbackOk(device *DeviceEntry) bool {
+	return r.zonePolicy == BrickZonePolicyBestEffort &&
+		r.devicePlacementOk(device) && !r.deviceZoneOk(device)
+}
+
+// deviceZoneOk returns false if the node of the device is in a zone
+// already used by a brick of the set
+func (r *brickReplacement) deviceZoneOk(device *DeviceEntry) bool {
+	if r.setZones == nil {
+		return true
+	}
+	zone, ok := r.nodeZones[device.NodeId]
+	return ok && !r.setZones[zone]
+}
+
+// devicePlacementOk runs the checks of deviceOk but the zone check
+func (r *brickReplacement) devicePlacementOk(device *DeviceEntry) bool {
+	if r.oldDevice.Info.Id == device.Info.Id {
+		return false
+	}
+	for _, brickInSet := range r.setlist {
+		if brickInSet.Info.NodeId == device.NodeId {
+			return false
+		}
+	}
+	if r.placement == nil {
+		return true
+	}
+	node, ok := r.nodes[device.NodeId]
+	if !ok {
+		return false
+	}
+	tags := node.deviceTags(device.Info.Id)
+	if !tagsMatch(tags, r.placement.TagMatch) {
+		return false
+	}
+	if enclosure := node.DeviceEnclosures[device.Info.Id]; enclosure != "" &&
+		r.enclosures[enclosure] {
+		return false
+	}
+	return r.placement.SpreadTag == "" ||
+		!r.spreadValues[tags[r.placement.SpreadTag]]
+}
+
+// loadPlacement gathers the tags deviceOk needs to follow the placement
+// of the volume, if any
+func (r *brickReplacement) loadPlacement(tx *bolt.Tx, v *VolumeEntry) error {
+	if placementEmpty(&v.Info.Placement) {
+		return nil
+	}
+	r.placement = &v.Info.Placement
+
+	cluster, err := NewClusterEntryFromId(tx, r.oldNode.Info.ClusterId)
+	if err != nil {
+		return err
+	}
+	r.nodes = map[string](*NodeEntry){}
+	for _, nodeId := range cluster.Info.Nodes {
+		if _, err := cachedNode(tx, r.nodes, nodeId); err != nil {
+			return err
+		}
+	}
+
+	r.spreadValues = map[string]bool{}
+	r.enclosures = map[string]bool{}
+	if r.placement.SpreadTag == "" && !r.placement.SpreadEnclosure {
+		return nil
+	}
+	devcache := map[string](*DeviceEntry){}
+	for _, brickInSet := range r.setlist {
+		device, err := cachedDevice(tx, devcache, brickInSet.Info.DeviceId)
+		if err != nil {
+			return err
+		}
+		if r.placement.SpreadTag != "" {
+			tags, err := cachedDeviceTags(tx, r.nodes, device)
+			if err != nil {
+				return err
+			}
+			r.spreadValues[tags[r.placement.SpreadTag]] = true
+		}
+		if r.placement.SpreadEnclosure {
+			enclosure, err := cachedDeviceEnclosure(tx, r.nodes, device)
+			if err != nil {
+				return err
+			}
+			if enclosure != "" {
+				r.enclosures[enclosure] = true
+			}
+		}
+	}
+	return nil
+}
+
+// loadZones gathers the zones deviceZoneOk needs to follow the zone
+// policy of the volume, unless the policy is none
+func (r *brickReplacement) loadZones(tx *bolt.Tx, v *VolumeEntry) error {
+	r.zonePolicy = v.zonePolicy()
+	r.nodeZones, r.setZones = nil, nil
+	if r.zonePolicy == BrickZonePolicyNone || len(r.setlist) == 0 {
+		return nil
+	}
+
+	cluster, err := NewClusterEntryFromId(tx, r.oldNode.Info.ClusterId)
+	if err != nil {
+		return err
+	}
+	nodecache := map[string](*NodeEntry){}
+	r.nodeZones = map[string]int{}
+	for _, nodeId := range cluster.Info.Nodes {
+		node, err := cachedNode(tx, nodecache, nodeId)
+		if err != nil {
+			return err
+		}
+		r.nodeZones[nodeId] = node.Info.Zone
+	}
+	r.setZones = map[int]bool{}
+	for _, brickInSet := range r.setlist {
+		node, err := cachedNode(tx, nodecache, brickInSet.Info.NodeId)
+		if err != nil {
+			return err
+		}
+		r.setZones[node.Info.Zone] = true
+	}
+	return nil
+}
+
+// prepareBrickReplace checks that the brick can be replaced and gathers
+// the entries and the brick set needed to replace it
+func (v *VolumeEntry) prepareBrickReplace(db wdb.DB,
+	executor executors.Executor,
+	oldBrickId string) (*brickReplacement, error) {
 
 	if api.DurabilityDistributeOnly == v.Info.Durability.Type {
-		return fmt.Errorf("replace brick is not supported for volume durability type %v", v.Info.Durability.Type)
+		return nil, fmt.Errorf("replace brick is not supported for volume durability type %v", v.Info.Durability.Type)
 	}
 
+	r := &brickReplacement{}
 	err := db.View(func(tx *bolt.Tx) error {
 		var err error
-		oldBrickEntry, err = NewBrickEntryFromId(tx, oldBrickId)
+		r.oldBrick, err = NewBrickEntryFromId(tx, oldBrickId)
 		if err != nil {
 			return err
 		}
 
-		oldDeviceEntry, err = NewDeviceEntryFromId(tx, oldBrickEntry.Info.DeviceId)
+		r.oldDevice, err = NewDeviceEntryFromId(tx, r.oldBrick.Info.DeviceId)
 		if err != nil {
 			return err
 		}
-		oldBrickNodeEntry, err = NewNodeEntryFromId(tx, oldBrickEntry.Info.NodeId)
+		r.oldNode, err = NewNodeEntryFromId(tx, r.oldBrick.Info.NodeId)
 		if err != nil {
 			return err
 		}
 		return nil
 	})
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	node := oldBrickNodeEntry.ManageHostName()
-	err = executor.GlusterdCheck(node)
+	r.host = r.oldNode.ManageHostName()
+	err = glusterdCheck(executor, r.host)
 	if err != nil {
-		node, err = GetVerifiedManageHostname(db, executor, oldBrickNodeEntry.Info.ClusterId)
+		r.host, err = GetVerifiedManageHostname(db, executor, r.oldNode.Info.ClusterId)
 		if err != nil {
-			return err
+			return nil, err
 		}
 	}
 
-	setlist, err := v.getBrickSetForBrickId(db, executor, oldBrickId, node)
+	r.setlist, err = v.getBrickSetForBrickId(db, executor, oldBrickId, r.host)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	err = v.canReplaceBrickInBrickSet(db, executor, r.oldBrick, r.host, r.setlist)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.View(func(tx *bolt.Tx) error {
+		if err := r.loadPlacement(tx, v); err != nil {
+			return err
+		}
+		return r.loadZones(tx, v)
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	err = v.canReplaceBrickInBrickSet(db, executor, oldBrickEntry, node, setlist)
+	return r, nil
+}
+
+// replaceBrickInVolumeWithProgress replaces the brick like
+// replaceBrickInVolume and reports the steps of the replace to
+// stepDone, if set
+func (v *VolumeEntry) replaceBrickInVolumeWithProgress(db wdb.DB,
+	executor executors.Executor,
+	allocator Allocator,
+	oldBrickId string,
+	stepDone brickReplaceStepFunc) error {
+
+	r, err := v.prepareBrickReplace(db, executor, oldBrickId)
 	if err != nil {
 		return err
 	}
@@ -398,15 +927,44 @@ func (v *VolumeEntry) replaceBrickInVolume(db wdb.DB, executor executors.Executo
 	//Create an Id for new brick
 	newBrickId := utils.GenUUID()
 
+	// Try to allocate a brick on the device
+	// NewBrickEntry would deduct storage from device entry
+	// which we will save to disk, hence reload the latest device
+	// entry to get latest storage state of device
+	allocate := func(deviceId string) (*BrickEntry, error) {
+		var newBrickEntry *BrickEntry
+		err := db.Update(func(tx *bolt.Tx) error {
+			newDeviceEntry, err := NewDeviceEntryFromId(tx, deviceId)
+			if err != nil {
+				return err
+			}
+			newBrickEntry = newDeviceEntry.NewBrickEntry(r.oldBrick.Info.Size,
+				float64(v.Info.Snapshot.Factor),
+				v.Info.Gid, v.Info.Id)
+			err = newDeviceEntry.Save(tx)
+			if err != nil {
+				return err
+			}
+			return nil
+		})
+		if err != nil || newBrickEntry == nil {
+			return nil, err
+		}
+		newBrickEntry.SetId(newBrickId)
+		return newBrickEntry, nil
+	}
+
 	// Check the ring for devices to place the brick
 	deviceCh, done, errc := allocator.GetNodes(db, v.Info.Cluster, newBrickId)
 	defer func() {
 		close(done)
 	}()
 
+	fallbacks := []string{}
 	for deviceId := range deviceCh {
 
 		// Get device entry
+		var newDeviceEntry *DeviceEntry
 		err = db.View(func(tx *bolt.Tx) error {
 			newDeviceEntry, err = NewDeviceEntryFromId(tx, deviceId)
 			if err != nil {
@@ -418,42 +976,14 @@ func (v *VolumeEntry) replaceBrickInVolume(db wdb.DB, executor executors.Executo
 			return err
 		}
 
-		// Skip same device
-		if oldDeviceEntry.Info.Id == newDeviceEntry.Info.Id {
-			continue
-		}
-
-		// Do not allow a device from the same node to be
-		// in the set
-		deviceOk := true
-		for _, brickInSet := range setlist {
-			if brickInSet.Info.NodeId == newDeviceEntry.NodeId {
-				deviceOk = false
+		if !r.deviceOk(newDeviceEntry) {
+			if r.deviceFallbackOk(newDeviceEntry) {
+				fallbacks = append(fallbacks, deviceId)
 			}
-		}
-
-		if !deviceOk {
 			continue
 		}
 
-		// Try to allocate a brick on this device
-		// NewBrickEntry would deduct storage from device entry
-		// which we will save to disk, hence reload the latest device
-		// entry to get latest storage state of device
-		err = db.Update(func(tx *bolt.Tx) error {
-			newDeviceEntry, err := NewDeviceEntryFromId(tx, deviceId)
-			if err != nil {
-				return err
-			}
-			newBrickEntry = newDeviceEntry.NewBrickEntry(oldBrickEntry.Info.Size,
-				float64(v.Info.Snapshot.Factor),
-				v.Info.Gid, v.Info.Id)
-			err = newDeviceEntry.Save(tx)
-			if err != nil {
-				return err
-			}
-			return nil
-		})
+		newBrickEntry, err := allocate(deviceId)
 		if err != nil {
 			return err
 		}
@@ -463,113 +993,159 @@ func (v *VolumeEntry) replaceBrickInVolume(db wdb.DB, executor executors.Executo
 			continue
 		}
 
-		defer func() {
-			if e != nil {
-				db.Update(func(tx *bolt.Tx) error {
-					newDeviceEntry, err = NewDeviceEntryFromId(tx, newBrickEntry.Info.DeviceId)
-					if err != nil {
-						return err
-					}
-					newDeviceEntry.StorageFree(newBrickEntry.TotalSize())
-					newDeviceEntry.Save(tx)
-					return nil
-				})
-			}
-		}()
+		return v.replaceBrickWith(db, executor, r, newBrickEntry, stepDone)
+	}
+	// Check if allocator returned an error
+	if err := <-errc; err != nil {
+		return err
+	}
 
-		err = db.View(func(tx *bolt.Tx) error {
-			newBrickNodeEntry, err = NewNodeEntryFromId(tx, newBrickEntry.Info.NodeId)
-			if err != nil {
-				return err
-			}
-			return nil
-		})
+	// With the best-effort zone policy, fall back to the devices in
+	// the zones already used by the set
+	for _, deviceId := range fallbacks {
+		newBrickEntry, err := allocate(deviceId)
 		if err != nil {
 			return err
 		}
-
-		newBrickEntry.SetId(newBrickId)
-		var brickEntries []*BrickEntry
-		brickEntries = append(brickEntries, newBrickEntry)
-		err = CreateBricks(db, executor, brickEntries)
-		if err != nil {
-			return err
+		if newBrickEntry != nil {
+			return v.replaceBrickWith(db, executor, r, newBrickEntry, stepDone)
 		}
+	}
 
-		defer func() {
-			if e != nil {
-				DestroyBricks(db, executor, brickEntries)
-			}
-		}()
+	// No device found
+	return ErrNoReplacement
+}
 
-		var oldBrick executors.BrickInfo
-		var newBrick executors.BrickInfo
+// replaceBrickWith replaces the old brick of the replacement with the
+// new brick, whose storage must already be reserved on its device. The
+// reservation is released if the replace fails.
+func (v *VolumeEntry) replaceBrickWith(db wdb.DB,
+	executor executors.Executor,
+	r *brickReplacement,
+	newBrickEntry *BrickEntry,
+	stepDone brickReplaceStepFunc) (e error) {
+
+	log := executorLogger(executor)
+	step := func(s string) {
+		if stepDone != nil {
+			stepDone(s)
+		}
+	}
+	step(api.BrickReplaceAllocated)
 
-		oldBrick.Path = oldBrickEntry.Info.Path
-		oldBrick.Host = oldBrickNodeEntry.StorageHostName()
-		newBrick.Path = newBrickEntry.Info.Path
-		newBrick.Host = newBrickNodeEntry.StorageHostName()
+	defer func() {
+		if e != nil {
+			db.Update(func(tx *bolt.Tx) error {
+				newDeviceEntry, err := NewDeviceEntryFromId(tx, newBrickEntry.Info.DeviceId)
+				if err != nil {
+					return err
+				}
+				newDeviceEntry.StorageFree(newBrickEntry.TotalSize())
+				newDeviceEntry.Save(tx)
+				return nil
+			})
+		}
+	}()
 
-		err = executor.VolumeReplaceBrick(node, v.Info.Name, &oldBrick, &newBrick)
+	var newBrickNodeEntry *NodeEntry
+	err := db.View(func(tx *bolt.Tx) error {
+		var err error
+		newBrickNodeEntry, err = NewNodeEntryFromId(tx, newBrickEntry.Info.NodeId)
 		if err != nil {
 			return err
 		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
 
-		// After this point we should not call any defer func()
-		// We don't have a *revert* of replace brick operation
+	var brickEntries []*BrickEntry
+	brickEntries = append(brickEntries, newBrickEntry)
+	err = CreateBricks(db, executor, brickEntries)
+	if err != nil {
+		return err
+	}
+	step(api.BrickReplaceCreated)
 
-		_ = oldBrickEntry.Destroy(db, executor)
+	defer func() {
+		if e != nil {
+			DestroyBricks(db, executor, brickEntries)
+		}
+	}()
 
-		// We must read entries from db again as state on disk might
-		// have changed
+	oldBrickEntry := r.oldBrick
+	var oldBrick executors.BrickInfo
+	var newBrick executors.BrickInfo
+
+	oldBrick.Path = oldBrickEntry.Info.Path
+	oldBrick.Host = r.oldNode.StorageHostName()
+	newBrick.Path = newBrickEntry.Info.Path
+	newBrick.Host = newBrickNodeEntry.StorageHostName()
+
+	intent := NewIntentEntry(IntentBrickReplace, r.host)
+	intent.VolumeName = v.Info.Name
+	intent.OldBrick = oldBrick
+	intent.NewBrick = newBrick
+	err = withIntent(db, intent, func() error {
+		if err := faults.Check(FaultVolumeReplaceBrick); err != nil {
+			return err
+		}
+		return executor.VolumeReplaceBrick(r.host, v.Info.Name, &oldBrick, &newBrick)
+	})
+	if err != nil {
+		return err
+	}
+	step(api.BrickReplaceReplaced)
 
-		err = db.Update(func(tx *bolt.Tx) error {
-			err = newBrickEntry.Save(tx)
-			if err != nil {
-				return err
-			}
-			reReadNewDeviceEntry, err := NewDeviceEntryFromId(tx, newBrickEntry.Info.DeviceId)
-			if err != nil {
-				return err
-			}
-			reReadNewDeviceEntry.BrickAdd(newBrickEntry.Id())
-			err = reReadNewDeviceEntry.Save(tx)
-			if err != nil {
-				return err
-			}
+	// After this point we should not call any defer func()
+	// We don't have a *revert* of replace brick operation
 
-			reReadVolEntry, err := NewVolumeEntryFromId(tx, newBrickEntry.Info.VolumeId)
-			if err != nil {
-				return err
-			}
-			reReadVolEntry.BrickAdd(newBrickEntry.Id())
-			err = reReadVolEntry.removeBrickFromDb(tx, oldBrickEntry)
-			if err != nil {
-				return err
-			}
-			err = reReadVolEntry.Save(tx)
-			if err != nil {
-				return err
-			}
-			return nil
-		})
+	_ = oldBrickEntry.Destroy(db, executor)
+	step(api.BrickReplaceDestroyedOld)
+
+	// We must read entries from db again as state on disk might
+	// have changed
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		err = newBrickEntry.Save(tx)
 		if err != nil {
-			logger.Err(err)
+			return err
+		}
+		reReadNewDeviceEntry, err := NewDeviceEntryFromId(tx, newBrickEntry.Info.DeviceId)
+		if err != nil {
+			return err
+		}
+		reReadNewDeviceEntry.BrickAdd(newBrickEntry.Id())
+		err = reReadNewDeviceEntry.Save(tx)
+		if err != nil {
+			return err
 		}
 
-		logger.Info("replaced brick:%v on node:%v at path:%v with brick:%v on node:%v at path:%v",
-			oldBrickEntry.Id(), oldBrickEntry.Info.NodeId, oldBrickEntry.Info.Path,
-			newBrickEntry.Id(), newBrickEntry.Info.NodeId, newBrickEntry.Info.Path)
-
+		reReadVolEntry, err := NewVolumeEntryFromId(tx, newBrickEntry.Info.VolumeId)
+		if err != nil {
+			return err
+		}
+		reReadVolEntry.BrickReplace(oldBrickEntry.Id(), newBrickEntry.Id())
+		err = reReadVolEntry.removeBrickFromDb(tx, oldBrickEntry)
+		if err != nil {
+			return err
+		}
+		err = reReadVolEntry.Save(tx)
+		if err != nil {
+			return err
+		}
 		return nil
-	}
-	// Check if allocator returned an error
-	if err := <-errc; err != nil {
-		return err
+	})
+	if err != nil {
+		log.Err(err)
 	}
 
-	// No device found
-	return ErrNoReplacement
+	log.Info("replaced brick:%v on node:%v at path:%v with brick:%v on node:%v at path:%v",
+		oldBrickEntry.Id(), oldBrickEntry.Info.NodeId, oldBrickEntry.Info.Path,
+		newBrickEntry.Id(), newBrickEntry.Info.NodeId, newBrickEntry.Info.Path)
+
+	return nil
 }
 
 func (v *VolumeEntry) allocBricks(
@@ -579,12 +1155,14 @@ func (v *VolumeEntry) allocBricks(
 	bricksets int,
 	brick_size uint64) (brick_entries []*BrickEntry, e error) {
 
+	log := allocatorLogger(allocator)
+
 	// Setup garbage collector function in case of error
 	defer func() {
 
 		// Check the named return value 'err'
 		if e != nil {
-			logger.Debug("Error detected.  Cleaning up volume %v: Len(%v) ", v.Info.Id, len(brick_entries))
+			log.Debug("Error detected.  Cleaning up volume %v: Len(%v) ", v.Info.Id, len(brick_entries))
 			db.Update(func(tx *bolt.Tx) error {
 				for _, brick := range brick_entries {
 					v.removeBrickFromDb(tx, brick)
@@ -601,17 +1179,8 @@ func (v *VolumeEntry) allocBricks(
 		if e != nil {
 			return e
 		}
-		for _, x := range r.Bricks {
-			err := x.Save(tx)
-			if err != nil {
-				return err
-			}
-		}
-		for _, x := range r.Devices {
-			err := x.Save(tx)
-			if err != nil {
-				return err
-			}
+		if err := r.Save(tx); err != nil {
+			return err
 		}
 		brick_entries = r.Bricks
 		return nil
@@ -0,0 +1,213 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"sort"
+
+	"github.com/boltdb/bolt"
+	"github.com/heketi/heketi/executors"
+	wdb "github.com/heketi/heketi/pkg/db"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+)
+
+// brickSetOf returns the other bricks of the set of the brick in the
+// order of the bricks, nil if the brick is not in the order
+func brickSetOf(order []string, setSize int, id string) []string {
+	for i, b := range order {
+		if b != id {
+			continue
+		}
+		start := i - i%setSize
+		end := start + setSize
+		if end > len(order) {
+			end = len(order)
+		}
+		set := []string{}
+		for _, other := range order[start:end] {
+			if other != id {
+				set = append(set, other)
+			}
+		}
+		return set
+	}
+	return nil
+}
+
+// recordedBrickSet returns the entries of the other bricks of the set
+// of the brick in the recorded order of the bricks of the volume
+func (v *VolumeEntry) recordedBrickSet(db wdb.RODB,
+	order []string, id string) ([]*BrickEntry, error) {
+
+	ids := brickSetOf(order, v.Durability.BricksInSet(), id)
+	if ids == nil {
+		logger.LogError("Brick %v is not in the order of the bricks of volume %v",
+			id, v.Info.Id)
+		return nil, ErrNotFound
+	}
+
+	setlist := []*BrickEntry{}
+	err := db.View(func(tx *bolt.Tx) error {
+		for _, b := range ids {
+			brick, err := NewBrickEntryFromId(tx, b)
+			if err != nil {
+				return err
+			}
+			setlist = append(setlist, brick)
+		}
+		return nil
+	})
+	return setlist, err
+}
+
+// glusterBrickNames returns the names gluster gives to the bricks of
+// the volume, <host>:<path>, by brick id
+func glusterBrickNames(tx *bolt.Tx, v *VolumeEntry) (map[string]string, error) {
+	names := map[string]string{}
+	for _, id := range v.BricksIds() {
+		brick, err := NewBrickEntryFromId(tx, id)
+		if err != nil {
+			return nil, err
+		}
+		node, err := NewNodeEntryFromId(tx, brick.Info.NodeId)
+		if err != nil {
+			return nil, err
+		}
+		names[id] = node.StorageHostName() + ":" + brick.Info.Path
+	}
+	return names, nil
+}
+
+// brickSetMismatches compares the sets of bricks in the recorded order
+// with the sets of bricks of the volume in gluster. The order of the
+// bricks within a set is not compared.
+func brickSetMismatches(expected, actual []string,
+	setSize int) []api.BrickSetMismatch {
+
+	sorted := func(names []string, start int) []string {
+		if start >= len(names) {
+			return []string{}
+		}
+		end := start + setSize
+		if end > len(names) {
+			end = len(names)
+		}
+		set := append([]string{}, names[start:end]...)
+		sort.Strings(set)
+		return set
+	}
+
+	mismatches := []api.BrickSetMismatch{}
+	for start := 0; start < len(expected) || start < len(actual); start += setSize {
+		e := sorted(expected, start)
+		a := sorted(actual, start)
+		same := len(e) == len(a)
+		for i := 0; same && i < len(e); i++ {
+			same = e[i] == a[i]
+		}
+		if !same {
+			mismatches = append(mismatches, api.BrickSetMismatch{
+				Set:      start / setSize,
+				Expected: e,
+				Actual:   a,
+			})
+		}
+	}
+	return mismatches
+}
+
+// CheckVolumeBrickOrder compares the sets of bricks of the volume in
+// gluster with the sets of the recorded order of its bricks, reporting
+// the sets changed outside of heketi. The order of gluster is recorded
+// for volumes without an order when it has all the bricks of the volume.
+func CheckVolumeBrickOrder(db wdb.DB,
+	executor executors.Executor,
+	id string) (*api.VolumeBrickOrderCheckResponse, error) {
+
+	var vol *VolumeEntry
+	err := db.View(func(tx *bolt.Tx) error {
+		var err error
+		vol, err = NewVolumeEntryFromId(tx, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	host, err := GetVerifiedManageHostname(db, executor, vol.Info.Cluster)
+	if err != nil {
+		return nil, err
+	}
+	vinfo, err := executor.VolumeInfo(host, vol.Info.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &api.VolumeBrickOrderCheckResponse{
+		Id:         vol.Info.Id,
+		Mismatches: []api.BrickSetMismatch{},
+	}
+	actual := []string{}
+	for _, b := range vinfo.Bricks.BrickList {
+		actual = append(actual, b.Name)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		vol, err := NewVolumeEntryFromId(tx, id)
+		if err != nil {
+			return err
+		}
+		names, err := glusterBrickNames(tx, vol)
+		if err != nil {
+			return err
+		}
+
+		if order := vol.brickOrder(); order != nil {
+			expected := []string{}
+			for _, b := range order {
+				expected = append(expected, names[b])
+			}
+			resp.Mismatches = brickSetMismatches(expected, actual,
+				vol.Durability.BricksInSet())
+			return nil
+		}
+
+		// Record the order of gluster if it has exactly the bricks
+		// of the volume
+		ids := map[string]string{}
+		for b, name := range names {
+			ids[name] = b
+		}
+		order := []string{}
+		for _, name := range actual {
+			if b, ok := ids[name]; ok {
+				order = append(order, b)
+				delete(ids, name)
+			}
+		}
+		if len(order) != len(actual) || len(order) != len(vol.Bricks) {
+			logger.Warning("Bricks of volume %v in gluster differ from its "+
+				"bricks, order not recorded", vol.Info.Name)
+			return nil
+		}
+		vol.BrickOrder = order
+		resp.Recorded = true
+		return vol.Save(tx)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, m := range resp.Mismatches {
+		logger.Warning("Set %v of volume %v has bricks %v in gluster instead of %v",
+			m.Set, vol.Info.Name, m.Actual, m.Expected)
+	}
+	return resp, nil
+}
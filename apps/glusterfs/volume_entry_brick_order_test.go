@@ -0,0 +1,205 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/gorilla/mux"
+	client "github.com/heketi/heketi/client/api/go-client"
+	"github.com/heketi/heketi/executors"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/tests"
+)
+
+func TestBrickSetOf(t *testing.T) {
+	order := []string{"a", "b", "c", "d", "e", "f"}
+	tests.Assert(t, reflect.DeepEqual(brickSetOf(order, 3, "a"), []string{"b", "c"}))
+	tests.Assert(t, reflect.DeepEqual(brickSetOf(order, 3, "e"), []string{"d", "f"}))
+	tests.Assert(t, reflect.DeepEqual(brickSetOf(order, 2, "d"), []string{"c"}))
+	tests.Assert(t, brickSetOf(order, 3, "g") == nil)
+}
+
+func TestBrickSetMismatches(t *testing.T) {
+	expected := []string{"h1:/a", "h2:/b", "h3:/c", "h1:/d", "h2:/e", "h3:/f"}
+
+	// The order within a set does not matter
+	m := brickSetMismatches(expected,
+		[]string{"h2:/b", "h1:/a", "h3:/c", "h1:/d", "h2:/e", "h3:/f"}, 3)
+	tests.Assert(t, len(m) == 0, m)
+
+	m = brickSetMismatches(expected,
+		[]string{"h1:/a", "h2:/e", "h3:/c", "h1:/d", "h2:/b", "h3:/f"}, 3)
+	tests.Assert(t, len(m) == 2, m)
+	tests.Assert(t, m[0].Set == 0, m[0])
+	tests.Assert(t, reflect.DeepEqual(m[0].Actual,
+		[]string{"h1:/a", "h2:/e", "h3:/c"}), m[0].Actual)
+	tests.Assert(t, reflect.DeepEqual(m[0].Expected,
+		[]string{"h1:/a", "h2:/b", "h3:/c"}), m[0].Expected)
+	tests.Assert(t, m[1].Set == 1, m[1])
+
+	// Sets missing in gluster
+	m = brickSetMismatches(expected, expected[:3], 3)
+	tests.Assert(t, len(m) == 1, m)
+	tests.Assert(t, m[0].Set == 1, m[0])
+	tests.Assert(t, len(m[0].Actual) == 0, m[0].Actual)
+}
+
+func TestVolumeBrickOrder(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	c := client.NewClientNoAuth(ts.URL)
+	tests.Assert(t, c != nil)
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		4,    // nodes_per_cluster
+		2,    // devices_per_node,
+		2*TB, // disksize
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	req := &api.VolumeCreateRequest{}
+	req.Size = 10
+	req.Durability.Type = api.DurabilityReplicate
+	req.Durability.Replicate.Replica = 3
+	vol, err := c.VolumeCreate(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(vol.BrickOrder) == 3, vol.BrickOrder)
+	vol, err = c.VolumeExpand(vol.Id, &api.VolumeExpandRequest{Size: 10})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(vol.BrickOrder) == 6, vol.BrickOrder)
+
+	// Every set is on three nodes
+	nodes := map[string]string{}
+	for _, b := range vol.Bricks {
+		nodes[b.Id] = b.NodeId
+	}
+	for set := 0; set < 2; set++ {
+		seen := map[string]bool{}
+		for _, id := range vol.BrickOrder[set*3 : set*3+3] {
+			tests.Assert(t, !seen[nodes[id]], "node used twice in set", set)
+			seen[nodes[id]] = true
+		}
+	}
+
+	// Gluster reports the bricks in the recorded order
+	gluster := func() []string {
+		names := []string{}
+		err := app.db.View(func(tx *bolt.Tx) error {
+			v, err := NewVolumeEntryFromId(tx, vol.Id)
+			if err != nil {
+				return err
+			}
+			byId, err := glusterBrickNames(tx, v)
+			if err != nil {
+				return err
+			}
+			for _, id := range v.BrickOrder {
+				names = append(names, byId[id])
+			}
+			return nil
+		})
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		return names
+	}
+	var glusterBricks []string
+	app.xo.MockVolumeInfo = func(host string, volume string) (*executors.Volume, error) {
+		vinfo := &executors.Volume{}
+		for _, name := range glusterBricks {
+			vinfo.Bricks.BrickList = append(vinfo.Bricks.BrickList,
+				executors.Brick{Name: name})
+		}
+		return vinfo, nil
+	}
+
+	glusterBricks = gluster()
+	check, err := c.VolumeBrickOrderCheck(vol.Id)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(check.Mismatches) == 0, check.Mismatches)
+	tests.Assert(t, !check.Recorded)
+
+	// A brick moved to another set outside of heketi
+	glusterBricks[1], glusterBricks[4] = glusterBricks[4], glusterBricks[1]
+	check, err = c.VolumeBrickOrderCheck(vol.Id)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(check.Mismatches) == 2, check.Mismatches)
+	tests.Assert(t, check.Mismatches[0].Set == 0, check.Mismatches[0])
+	tests.Assert(t, check.Mismatches[1].Set == 1, check.Mismatches[1])
+
+	// A replaced brick keeps the position of the old brick
+	glusterBricks = gluster()
+	app.xo.MockHealInfo = func(host string, volume string) (*executors.HealInfo, error) {
+		return mockHealStatusFromDb(app.db, volume)
+	}
+	old := vol.BrickOrder[4]
+	var v *VolumeEntry
+	err = app.db.View(func(tx *bolt.Tx) error {
+		var err error
+		v, err = NewVolumeEntryFromId(tx, vol.Id)
+		return err
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	setlist, err := v.getBrickSetForBrickId(app.db, app.executor, old, "")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(setlist) == 2, setlist)
+	tests.Assert(t, setlist[0].Info.Id == vol.BrickOrder[3], setlist[0].Info.Id)
+	tests.Assert(t, setlist[1].Info.Id == vol.BrickOrder[5], setlist[1].Info.Id)
+
+	err = v.replaceBrickInVolume(app.db, app.executor, app.Allocator(), old)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	info, err := c.VolumeInfo(vol.Id)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(info.BrickOrder) == 6, info.BrickOrder)
+	tests.Assert(t, info.BrickOrder[4] != old, info.BrickOrder)
+	for i, id := range info.BrickOrder {
+		if i != 4 {
+			tests.Assert(t, id == vol.BrickOrder[i], info.BrickOrder, vol.BrickOrder)
+		}
+	}
+
+	// The order of gluster is recorded for volumes without an order
+	glusterBricks = gluster()
+	err = app.db.Update(func(tx *bolt.Tx) error {
+		v, err := NewVolumeEntryFromId(tx, vol.Id)
+		if err != nil {
+			return err
+		}
+		v.BrickOrder = nil
+		return v.Save(tx)
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	info, err = c.VolumeInfo(vol.Id)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(info.BrickOrder) == 0, info.BrickOrder)
+
+	check, err = c.VolumeBrickOrderCheck(vol.Id)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, check.Recorded)
+	info, err = c.VolumeInfo(vol.Id)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(info.BrickOrder) == 6, info.BrickOrder)
+
+	_, err = c.VolumeBrickOrderCheck("abc")
+	tests.Assert(t, err != nil, "expected err != nil")
+}
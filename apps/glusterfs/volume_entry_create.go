@@ -16,6 +16,7 @@ import (
 	"github.com/boltdb/bolt"
 	"github.com/heketi/heketi/executors"
 	wdb "github.com/heketi/heketi/pkg/db"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
 	"github.com/lpabon/godbc"
 )
 
@@ -37,6 +38,16 @@ func (v *VolumeEntry) createVolume(db wdb.RODB,
 	if _, err := executor.VolumeCreate(host, vr); err != nil {
 		return err
 	}
+
+	// Record the id gluster assigned to the volume so that the volume
+	// can be correlated with its gluster side counterpart
+	vinfo, err := executor.VolumeInfo(host, v.Info.Name)
+	if err != nil {
+		logger.Warning("Unable to get gluster id of volume %v: %v",
+			v.Info.Name, err)
+		return nil
+	}
+	v.Info.GlusterId = vinfo.ID
 	return nil
 }
 
@@ -64,7 +75,8 @@ func (v *VolumeEntry) updateMountInfo(db wdb.RODB) error {
 
 	v.Info.Mount.GlusterFS.Hosts = hosts
 
-	// Save volume information
+	// Save volume information. IPv6 addresses are not enclosed in
+	// brackets as mount.glusterfs splits the host at the last colon.
 	v.Info.Mount.GlusterFS.MountPoint = fmt.Sprintf("%v:%v",
 		hosts[0], v.Info.Name)
 
@@ -115,6 +127,9 @@ func (v *VolumeEntry) createVolumeRequest(db wdb.RODB,
 	vr.Name = v.Info.Name
 	v.Durability.SetExecutorVolumeRequest(vr)
 	vr.GlusterVolumeOptions = v.GlusterVolumeOptions
+	if v.Info.Quota.Enable {
+		vr.Quota = volumeQuotaChange(v.Info.Name, &api.VolumeQuota{}, &v.Info.Quota)
+	}
 
 	return vr, sshhost, nil
 }
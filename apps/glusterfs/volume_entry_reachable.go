@@ -0,0 +1,122 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/boltdb/bolt"
+	"github.com/heketi/heketi/executors"
+	wdb "github.com/heketi/heketi/pkg/db"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+)
+
+// checkNodesReachable checks glusterd on the online nodes of the
+// clusters the volume can be created in, so that the bricks of the
+// volume are only placed on the nodes that can be reached. The volume
+// is still created if its sets can be placed on the other nodes.
+func (v *VolumeEntry) checkNodesReachable(db wdb.RODB,
+	executor executors.Executor) error {
+
+	clusters, err := v.possibleClusters(db)
+	if err != nil {
+		// Reported when the bricks are allocated
+		return nil
+	}
+
+	hosts := map[string]string{}
+	err = db.View(func(tx *bolt.Tx) error {
+		for _, clusterId := range clusters {
+			cluster, err := NewClusterEntryFromId(tx, clusterId)
+			if err != nil {
+				return err
+			}
+			for _, nodeId := range cluster.Info.Nodes {
+				node, err := NewNodeEntryFromId(tx, nodeId)
+				if err != nil {
+					return err
+				}
+				if node.isOnline() {
+					hosts[nodeId] = node.ManageHostName()
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	var unreachable map[string]bool
+	for nodeId, host := range hosts {
+		wg.Add(1)
+		nodeId, host := nodeId, host
+		go func() {
+			defer wg.Done()
+			if err := executor.GlusterdCheck(host); err != nil {
+				executorLogger(executor).Warning("Node %v is unreachable, no brick of volume %v "+
+					"is placed on it: %v", host, v.Info.Id, err)
+				lock.Lock()
+				if unreachable == nil {
+					unreachable = map[string]bool{}
+				}
+				unreachable[nodeId] = true
+				lock.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	v.unreachableNodes = unreachable
+	return nil
+}
+
+// nodeReachable returns false if the node of the device was found
+// unreachable before allocating the bricks of the volume
+func (v *VolumeEntry) nodeReachable(device *DeviceEntry) bool {
+	return !v.unreachableNodes[device.NodeId]
+}
+
+// unreachableNodesWarning returns the warning of a volume created
+// without the unreachable nodes of its cluster, nil if there were none
+func unreachableNodesWarning(tx *bolt.Tx, v *VolumeEntry) (*api.Warning, error) {
+	if len(v.unreachableNodes) == 0 {
+		return nil, nil
+	}
+	cluster, err := NewClusterEntryFromId(tx, v.Info.Cluster)
+	if err != nil {
+		return nil, err
+	}
+	hosts := []string{}
+	for _, nodeId := range cluster.Info.Nodes {
+		if !v.unreachableNodes[nodeId] {
+			continue
+		}
+		node, err := NewNodeEntryFromId(tx, nodeId)
+		if err != nil {
+			return nil, err
+		}
+		hosts = append(hosts, node.ManageHostName())
+	}
+	if len(hosts) == 0 {
+		return nil, nil
+	}
+	sort.Strings(hosts)
+	return &api.Warning{
+		Type: api.WarningNodesUnreachable,
+		Message: fmt.Sprintf("bricks placed without unreachable nodes %v",
+			strings.Join(hosts, ", ")),
+	}, nil
+}
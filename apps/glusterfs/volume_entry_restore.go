@@ -0,0 +1,224 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/boltdb/bolt"
+	"github.com/heketi/heketi/executors"
+	wdb "github.com/heketi/heketi/pkg/db"
+)
+
+// VolumeRestoreStage identifies the next step of an in-place volume
+// restore. The stage is recorded in the pending operation after every
+// step so that an interrupted restore can be picked up where it stopped.
+type VolumeRestoreStage string
+
+const (
+	RestoreStageCheckClients VolumeRestoreStage = "check-clients"
+	RestoreStageStopVolume   VolumeRestoreStage = "stop-volume"
+	RestoreStageRestore      VolumeRestoreStage = "restore"
+	RestoreStageStartVolume  VolumeRestoreStage = "start-volume"
+	RestoreStageVerifyBricks VolumeRestoreStage = "verify-bricks"
+	RestoreStageDone         VolumeRestoreStage = "done"
+)
+
+// PendingOperationsOnVolume returns true if any pending operation
+// references the given volume.
+func PendingOperationsOnVolume(db wdb.RODB, volumeId string) (pvol bool, e error) {
+	e = db.View(func(tx *bolt.Tx) error {
+		pv, err := mapPendingItems(tx,
+			func(op *PendingOperationEntry, a PendingOperationAction) bool {
+				return a.Id == volumeId
+			})
+		if err != nil {
+			return err
+		}
+		if opId, ok := pv[volumeId]; ok {
+			logger.Warning("Volume %v used in pending operation %v",
+				volumeId, opId)
+			pvol = true
+		}
+		return nil
+	})
+	return
+}
+
+// restoreVolumeStep performs a single step of restoring the volume from
+// the given snapshot and returns the stage that should be run next.
+func (v *VolumeEntry) restoreVolumeStep(executor executors.Executor,
+	host string,
+	snapshot string,
+	force bool,
+	stage VolumeRestoreStage) (VolumeRestoreStage, error) {
+
+	switch stage {
+	case RestoreStageCheckClients:
+		if force {
+			logger.Info("Skipping client check on volume %v", v.Info.Name)
+			return RestoreStageStopVolume, nil
+		}
+		status, err := executor.VolumeStatus(host, v.Info.Name)
+		if err != nil {
+			return stage, err
+		}
+		if clients := volumeStatusClients(status); clients > 0 {
+			return stage, logger.LogError(
+				"Unable to restore volume %v: %v connected client(s). "+
+					"Unmount the volume or force the restore.",
+				v.Info.Name, clients)
+		}
+		return RestoreStageStopVolume, nil
+
+	case RestoreStageStopVolume:
+		if err := executor.VolumeStop(host, v.Info.Name); err != nil {
+			return stage, err
+		}
+		return RestoreStageRestore, nil
+
+	case RestoreStageRestore:
+		if err := executor.SnapshotRestore(host, snapshot); err != nil {
+			return stage, err
+		}
+		return RestoreStageStartVolume, nil
+
+	case RestoreStageStartVolume:
+		if err := executor.VolumeStart(host, v.Info.Name); err != nil {
+			return stage, err
+		}
+		return RestoreStageVerifyBricks, nil
+
+	case RestoreStageVerifyBricks:
+		status, err := executor.VolumeStatus(host, v.Info.Name)
+		if err != nil {
+			return stage, err
+		}
+		if offline := volumeStatusOfflineBricks(status); len(offline) > 0 {
+			return stage, logger.LogError(
+				"Volume %v restored but bricks are offline: %v",
+				v.Info.Name, strings.Join(offline, ", "))
+		}
+		return RestoreStageDone, nil
+	}
+
+	return stage, fmt.Errorf("Unknown volume restore stage: %v", stage)
+}
+
+// volumeStatusClients returns the number of clients connected
+// to all the bricks of a volume.
+func volumeStatusClients(status *executors.VolumeStatus) int {
+	clients := 0
+	for _, b := range status.Bricks {
+		clients += b.ClientsStatus.ClientCount
+	}
+	return clients
+}
+
+// volumeStatusOfflineBricks returns the names of the bricks of a volume
+// that are not online. Daemons such as the self-heal daemon are also
+// listed by volume status but are not considered bricks.
+func volumeStatusOfflineBricks(status *executors.VolumeStatus) []string {
+	offline := []string{}
+	for _, b := range status.Bricks {
+		if !strings.HasPrefix(b.Path, "/") {
+			continue
+		}
+		if b.Status != 1 {
+			offline = append(offline, b.Hostname+":"+b.Path)
+		}
+	}
+	return offline
+}
+
+// glusterBrickOrder returns the ids of the bricks of the volume in the
+// order gluster lists the bricks of the volume
+func (v *VolumeEntry) glusterBrickOrder(db wdb.RODB,
+	executor executors.Executor,
+	host string) ([]string, error) {
+
+	vinfo, err := executor.VolumeInfo(host, v.Info.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := map[string]string{}
+	err = db.View(func(tx *bolt.Tx) error {
+		for _, id := range v.BricksIds() {
+			brick, err := NewBrickEntryFromId(tx, id)
+			if err != nil {
+				return err
+			}
+			node, err := NewNodeEntryFromId(tx, brick.Info.NodeId)
+			if err != nil {
+				return err
+			}
+			ids[node.StorageHostName()+":"+brick.Info.Path] = id
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	order := []string{}
+	for _, b := range vinfo.Bricks.BrickList {
+		id, ok := ids[b.Name]
+		if !ok {
+			return nil, fmt.Errorf("Brick %v of volume %v is unknown",
+				b.Name, v.Info.Name)
+		}
+		order = append(order, id)
+	}
+	return order, nil
+}
+
+// updateRestoredBrickPaths saves the paths of the bricks of the snapshot
+// the volume was restored from in the brick entries, gluster keeping the
+// order of the bricks of the volume
+func (v *VolumeEntry) updateRestoredBrickPaths(db wdb.DB,
+	executor executors.Executor,
+	host string,
+	order []string) error {
+
+	vinfo, err := executor.VolumeInfo(host, v.Info.Name)
+	if err != nil {
+		return err
+	}
+	bricks := vinfo.Bricks.BrickList
+	if len(bricks) != len(order) {
+		return fmt.Errorf("Restored volume %v has %v bricks, expected %v",
+			v.Info.Name, len(bricks), len(order))
+	}
+
+	return db.Update(func(tx *bolt.Tx) error {
+		for i, id := range order {
+			p, err := glusterBrickPath(bricks[i].Name)
+			if err != nil {
+				return err
+			}
+			brick, err := NewBrickEntryFromId(tx, id)
+			if err != nil {
+				return err
+			}
+			if brick.Info.Path == p {
+				continue
+			}
+			logger.Info("Brick %v of volume %v restored at %v",
+				id, v.Info.Name, p)
+			brick.Info.Path = p
+			if err := brick.Save(tx); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
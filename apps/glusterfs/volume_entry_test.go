@@ -282,6 +282,40 @@ func TestNewVolumeEntryFromRequestName(t *testing.T) {
 
 }
 
+func TestNewVolumeEntryFromRequestOwnerDefaults(t *testing.T) {
+	defer func() {
+		VolumeDefaultUid = 0
+		VolumeDefaultGid = 0
+		VolumeDefaultPermissions = ""
+		VolumeDefaultSelinuxContext = ""
+	}()
+	VolumeDefaultUid = 1000
+	VolumeDefaultGid = 2000
+	VolumeDefaultPermissions = "0770"
+	VolumeDefaultSelinuxContext = "system_u:object_r:container_file_t:s0"
+
+	req := &api.VolumeCreateRequest{}
+	req.Size = 1024
+
+	v := NewVolumeEntryFromRequest(req)
+	tests.Assert(t, v.Info.Uid == 1000, v.Info.Uid)
+	tests.Assert(t, v.Info.Gid == 2000, v.Info.Gid)
+	tests.Assert(t, v.Info.Permissions == "0770", v.Info.Permissions)
+	tests.Assert(t, v.Info.SelinuxContext == VolumeDefaultSelinuxContext)
+
+	// values in the request take precedence over the defaults
+	req.Uid = 10
+	req.Gid = 20
+	req.Permissions = "0700"
+	req.SelinuxContext = "user_u:object_r:svirt_sandbox_file_t:s0"
+
+	v = NewVolumeEntryFromRequest(req)
+	tests.Assert(t, v.Info.Uid == 10, v.Info.Uid)
+	tests.Assert(t, v.Info.Gid == 20, v.Info.Gid)
+	tests.Assert(t, v.Info.Permissions == "0700", v.Info.Permissions)
+	tests.Assert(t, v.Info.SelinuxContext == req.SelinuxContext)
+}
+
 func TestNewVolumeEntryMarshal(t *testing.T) {
 
 	req := &api.VolumeCreateRequest{}
@@ -1120,6 +1154,258 @@ func TestVolumeEntryCreateBrickCreationFailure(t *testing.T) {
 	tests.Assert(t, err == nil)
 }
 
+func TestVolumeEntryCreateBrickOwnerAndContext(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	err := setupSampleDbWithTopology(app,
+		1,      // clusters
+		4,      // nodes_per_cluster
+		4,      // devices_per_node,
+		500*GB, // disksize)
+	)
+	tests.Assert(t, err == nil)
+
+	calls := 0
+	app.xo.MockBrickCreate = func(host string, brick *executors.BrickRequest) (*executors.BrickInfo, error) {
+		calls++
+		tests.Assert(t, brick.Uid == 1000, brick.Uid)
+		tests.Assert(t, brick.Gid == 2000, brick.Gid)
+		tests.Assert(t, brick.Permissions == "0770", brick.Permissions)
+		tests.Assert(t, brick.SelinuxContext == "system_u:object_r:container_file_t:s0",
+			brick.SelinuxContext)
+		return &executors.BrickInfo{Path: brick.Path}, nil
+	}
+
+	req := &api.VolumeCreateRequest{}
+	req.Size = 100
+	req.Durability.Type = api.DurabilityReplicate
+	req.Durability.Replicate.Replica = 3
+	req.Uid = 1000
+	req.Gid = 2000
+	req.Permissions = "0770"
+	req.SelinuxContext = "system_u:object_r:container_file_t:s0"
+
+	v := NewVolumeEntryFromRequest(req)
+	err = v.Create(app.db, app.executor, app.Allocator())
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, calls == 3, calls)
+
+	err = app.db.View(func(tx *bolt.Tx) error {
+		info, err := v.NewInfoResponse(tx)
+		tests.Assert(t, err == nil, err)
+		tests.Assert(t, info.Uid == 1000, info.Uid)
+		tests.Assert(t, info.Gid == 2000, info.Gid)
+		tests.Assert(t, info.Permissions == "0770", info.Permissions)
+		tests.Assert(t, info.SelinuxContext == req.SelinuxContext)
+		return nil
+	})
+	tests.Assert(t, err == nil)
+}
+
+func TestVolumeEntryAllocBricksSharedDevice(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	// A single device receives every brick of the volume
+	err := setupSampleDbWithTopology(app,
+		1,      // clusters
+		1,      // nodes_per_cluster
+		1,      // devices_per_node,
+		500*GB, // disksize)
+	)
+	tests.Assert(t, err == nil)
+
+	var cluster string
+	err = app.db.View(func(tx *bolt.Tx) error {
+		clusters, err := ClusterList(tx)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, len(clusters) == 1)
+		cluster = clusters[0]
+		return nil
+	})
+	tests.Assert(t, err == nil)
+
+	req := &api.VolumeCreateRequest{}
+	req.Size = 40
+	req.Durability.Type = api.DurabilityDistributeOnly
+	v := NewVolumeEntryFromRequest(req)
+
+	bricks, err := v.allocBricks(app.db, app.Allocator(), cluster, 4, 10*GB)
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, len(bricks) == 4, len(bricks))
+
+	err = app.db.View(func(tx *bolt.Tx) error {
+		for _, b := range bricks {
+			brick, err := NewBrickEntryFromId(tx, b.Info.Id)
+			tests.Assert(t, err == nil, err)
+			tests.Assert(t, brick.Info.DeviceId == bricks[0].Info.DeviceId)
+		}
+
+		device, err := NewDeviceEntryFromId(tx, bricks[0].Info.DeviceId)
+		tests.Assert(t, err == nil, err)
+		tests.Assert(t, len(device.Bricks) == 4, device.Bricks)
+
+		var used uint64
+		for _, b := range bricks {
+			used += b.TotalSize()
+		}
+		tests.Assert(t, device.Info.Storage.Used == used,
+			device.Info.Storage.Used, used)
+		return nil
+	})
+	tests.Assert(t, err == nil)
+}
+
+// allocReplicaSetZones allocates two replica 3 sets on a single cluster
+// of four nodes in two zones and returns the zones of each set
+func allocReplicaSetZones(t *testing.T, policy string) ([][]int, error) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	defer func(p string) {
+		BrickZonePolicy = p
+	}(BrickZonePolicy)
+	BrickZonePolicy = policy
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		4,    // nodes_per_cluster
+		2,    // devices_per_node,
+		1*TB, // disksize)
+	)
+	tests.Assert(t, err == nil)
+
+	var cluster string
+	err = app.db.View(func(tx *bolt.Tx) error {
+		clusters, err := ClusterList(tx)
+		tests.Assert(t, err == nil)
+		cluster = clusters[0]
+		return nil
+	})
+	tests.Assert(t, err == nil)
+
+	req := &api.VolumeCreateRequest{}
+	req.Size = 20
+	req.Durability.Type = api.DurabilityReplicate
+	req.Durability.Replicate.Replica = 3
+	v := NewVolumeEntryFromRequest(req)
+
+	bricks, err := v.allocBricks(app.db, app.Allocator(), cluster, 2, 10*GB)
+	if err != nil {
+		return nil, err
+	}
+	tests.Assert(t, len(bricks) == 6, len(bricks))
+
+	zones := [][]int{}
+	err = app.db.View(func(tx *bolt.Tx) error {
+		for i := 0; i < len(bricks); i += 3 {
+			set := []int{}
+			for _, b := range bricks[i : i+3] {
+				node, err := NewNodeEntryFromId(tx, b.Info.NodeId)
+				tests.Assert(t, err == nil, err)
+				set = append(set, node.Info.Zone)
+			}
+			zones = append(zones, set)
+		}
+		return nil
+	})
+	tests.Assert(t, err == nil)
+	return zones, nil
+}
+
+func TestVolumeEntryAllocBricksZonePolicyBestEffort(t *testing.T) {
+	zones, err := allocReplicaSetZones(t, BrickZonePolicyBestEffort)
+	tests.Assert(t, err == nil, err)
+
+	// Three bricks in two zones, both zones must be used by every set
+	for _, set := range zones {
+		used := map[int]bool{}
+		for _, z := range set {
+			used[z] = true
+		}
+		tests.Assert(t, len(used) == 2, set)
+	}
+}
+
+func TestVolumeEntryAllocBricksZonePolicyStrict(t *testing.T) {
+	// Not enough zones for a replica 3 set
+	_, err := allocReplicaSetZones(t, BrickZonePolicyStrict)
+	tests.Assert(t, err == ErrNoSpace, err)
+}
+
+func TestVolumeEntryAllocBricksZonePolicyNone(t *testing.T) {
+	zones, err := allocReplicaSetZones(t, BrickZonePolicyNone)
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, len(zones) == 2, zones)
+}
+
+func TestVolumeEntryExpandBalancesNodes(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		4,    // nodes_per_cluster
+		2,    // devices_per_node,
+		1*TB, // disksize)
+	)
+	tests.Assert(t, err == nil)
+
+	var cluster string
+	err = app.db.View(func(tx *bolt.Tx) error {
+		clusters, err := ClusterList(tx)
+		tests.Assert(t, err == nil)
+		cluster = clusters[0]
+		return nil
+	})
+	tests.Assert(t, err == nil)
+
+	req := &api.VolumeCreateRequest{}
+	req.Size = 10
+	req.Durability.Type = api.DurabilityReplicate
+	req.Durability.Replicate.Replica = 3
+	v := NewVolumeEntryFromRequest(req)
+
+	// Add one replica set at a time, as expansions do
+	for i := 0; i < 4; i++ {
+		_, err := v.allocBricks(app.db, app.Allocator(), cluster, 1, 10*GB)
+		tests.Assert(t, err == nil, err)
+	}
+
+	// Every node holds the same share of the bricks
+	nodeBricks := map[string]int{}
+	err = app.db.View(func(tx *bolt.Tx) error {
+		for _, id := range v.Bricks {
+			brick, err := NewBrickEntryFromId(tx, id)
+			tests.Assert(t, err == nil, err)
+			nodeBricks[brick.Info.NodeId]++
+		}
+		return nil
+	})
+	tests.Assert(t, err == nil)
+	tests.Assert(t, len(nodeBricks) == 4, nodeBricks)
+	for _, n := range nodeBricks {
+		tests.Assert(t, n == 3, nodeBricks)
+	}
+}
+
 func TestVolumeEntryCreateVolumeCreationFailure(t *testing.T) {
 	tmpfile := tests.Tempfile()
 	defer os.Remove(tmpfile)
@@ -1728,6 +2014,60 @@ func TestNewVolumeEntryWithVolumeOptions(t *testing.T) {
 	tests.Assert(t, entry.GlusterVolumeOptions[0] == "test-option")
 
 }
+
+func TestVolumeEntryOptionsKeptOnExpand(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	err := setupSampleDbWithTopology(app,
+		1,      // clusters
+		3,      // nodes_per_cluster
+		2,      // devices_per_node,
+		500*GB, // disksize)
+	)
+	tests.Assert(t, err == nil)
+
+	var created []string
+	app.xo.MockVolumeCreate = func(host string,
+		volume *executors.VolumeRequest) (*executors.Volume, error) {
+		created = volume.GlusterVolumeOptions
+		return &executors.Volume{}, nil
+	}
+
+	req := &api.VolumeCreateRequest{}
+	req.Size = 100
+	req.Durability.Type = api.DurabilityReplicate
+	req.Durability.Replicate.Replica = 3
+	req.GlusterVolumeOptions = []string{"performance.read-ahead off",
+		"features.shard on"}
+
+	v := NewVolumeEntryFromRequest(req)
+	err = v.Create(app.db, app.executor, app.Allocator())
+	tests.Assert(t, err == nil, err)
+
+	// The executor sets the options of the request on the new volume
+	tests.Assert(t, reflect.DeepEqual(created, req.GlusterVolumeOptions),
+		created)
+
+	err = v.Expand(app.db, app.executor, app.Allocator(), 100)
+	tests.Assert(t, err == nil, err)
+
+	var entry *VolumeEntry
+	err = app.db.View(func(tx *bolt.Tx) error {
+		var err error
+		entry, err = NewVolumeEntryFromId(tx, v.Info.Id)
+		return err
+	})
+	tests.Assert(t, err == nil)
+	tests.Assert(t, len(entry.Bricks) == 6, entry.Bricks)
+	tests.Assert(t, reflect.DeepEqual(entry.GlusterVolumeOptions,
+		req.GlusterVolumeOptions), entry.GlusterVolumeOptions)
+}
+
 func TestNewVolumeEntryWithTSPForMountHosts(t *testing.T) {
 	tmpfile := tests.Tempfile()
 	defer os.Remove(tmpfile)
@@ -2271,3 +2611,76 @@ func TestVolumeCreateConcurrent(t *testing.T) {
 	tests.Assert(t, brickCount == 27,
 		"expected brickCount == 27, got:", brickCount)
 }
+
+func TestBrickReplacementZonePolicy(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	// Four nodes in two zones
+	err := setupSampleDbWithTopology(app,
+		1,      // clusters
+		4,      // nodes_per_cluster
+		1,      // devices_per_node,
+		500*GB, // disksize)
+	)
+	tests.Assert(t, err == nil)
+
+	v := createSampleReplicaVolumeEntry(100, 2)
+	err = v.Create(app.db, app.executor, app.Allocator())
+	tests.Assert(t, err == nil, err)
+
+	r := &brickReplacement{}
+	var devices []*DeviceEntry
+	err = app.db.View(func(tx *bolt.Tx) error {
+		bricks := []*BrickEntry{}
+		for _, id := range v.Bricks {
+			b, err := NewBrickEntryFromId(tx, id)
+			tests.Assert(t, err == nil, err)
+			bricks = append(bricks, b)
+		}
+		r.oldBrick = bricks[0]
+		r.setlist = bricks[1:]
+		r.oldDevice, err = NewDeviceEntryFromId(tx, r.oldBrick.Info.DeviceId)
+		tests.Assert(t, err == nil, err)
+		r.oldNode, err = NewNodeEntryFromId(tx, r.oldBrick.Info.NodeId)
+		tests.Assert(t, err == nil, err)
+
+		ids, err := DeviceList(tx)
+		tests.Assert(t, err == nil, err)
+		for _, id := range ids {
+			d, err := NewDeviceEntryFromId(tx, id)
+			tests.Assert(t, err == nil, err)
+			devices = append(devices, d)
+		}
+		return nil
+	})
+	tests.Assert(t, err == nil, err)
+
+	check := func(policy string) (ok, fallback int) {
+		v.brickZonePolicy = policy
+		err := app.db.View(func(tx *bolt.Tx) error {
+			return r.loadZones(tx, v)
+		})
+		tests.Assert(t, err == nil, err)
+		for _, d := range devices {
+			if r.deviceOk(d) {
+				ok++
+			}
+			if r.deviceFallbackOk(d) {
+				fallback++
+			}
+		}
+		return
+	}
+
+	// Of the two free nodes, one is in the zone of the other brick
+	ok, fallback := check(BrickZonePolicyNone)
+	tests.Assert(t, ok == 2 && fallback == 0, ok, fallback)
+	ok, fallback = check(BrickZonePolicyStrict)
+	tests.Assert(t, ok == 1 && fallback == 0, ok, fallback)
+	ok, fallback = check(BrickZonePolicyBestEffort)
+	tests.Assert(t, ok == 1 && fallback == 1, ok, fallback)
+}
@@ -0,0 +1,129 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/boltdb/bolt"
+	"github.com/gorilla/mux"
+)
+
+const (
+	// Index of the volumes by gluster volume id. The keys are the
+	// gluster volume ids and the values the heketi ids.
+	BOLTDB_BUCKET_VOLUME_GLUSTER_ID = "VOLUME_GLUSTER_ID"
+)
+
+// indexVolumeGlusterId adds the volume to the index of the volumes by
+// gluster volume id. Volumes without a gluster volume id yet are not
+// indexed.
+func indexVolumeGlusterId(tx *bolt.Tx, v *VolumeEntry) error {
+	if v.Info.GlusterId == "" {
+		return nil
+	}
+	b := tx.Bucket([]byte(BOLTDB_BUCKET_VOLUME_GLUSTER_ID))
+	if b == nil {
+		return ErrDbAccess
+	}
+	return b.Put([]byte(v.Info.GlusterId), []byte(v.Info.Id))
+}
+
+// unindexVolumeGlusterId removes the volume from the index of the
+// volumes by gluster volume id
+func unindexVolumeGlusterId(tx *bolt.Tx, v *VolumeEntry) error {
+	if v.Info.GlusterId == "" {
+		return nil
+	}
+	b := tx.Bucket([]byte(BOLTDB_BUCKET_VOLUME_GLUSTER_ID))
+	if b == nil {
+		return ErrDbAccess
+	}
+	return b.Delete([]byte(v.Info.GlusterId))
+}
+
+// rebuildVolumeGlusterIdIndex indexes every volume of the db, dropping
+// the index entries of the volumes saved by versions not maintaining it
+func rebuildVolumeGlusterIdIndex(tx *bolt.Tx) error {
+	if tx.Bucket([]byte(BOLTDB_BUCKET_VOLUME_GLUSTER_ID)) != nil {
+		if err := tx.DeleteBucket([]byte(BOLTDB_BUCKET_VOLUME_GLUSTER_ID)); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.CreateBucket([]byte(BOLTDB_BUCKET_VOLUME_GLUSTER_ID)); err != nil {
+		return err
+	}
+
+	ids, err := VolumeList(tx)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		v, err := NewVolumeEntryFromId(tx, id)
+		if err != nil {
+			return err
+		}
+		if err := indexVolumeGlusterId(tx, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lookupVolumeGlusterId returns the heketi id of the volume with the
+// gluster volume id, or ErrNotFound
+func lookupVolumeGlusterId(tx *bolt.Tx, glusterId string) (string, error) {
+	b := tx.Bucket([]byte(BOLTDB_BUCKET_VOLUME_GLUSTER_ID))
+	if b == nil {
+		// A db opened read-only may predate the index
+		return scanVolumeGlusterIds(tx, glusterId)
+	}
+	id := b.Get([]byte(glusterId))
+	if id == nil {
+		return "", ErrNotFound
+	}
+	return string(id), nil
+}
+
+func scanVolumeGlusterIds(tx *bolt.Tx, glusterId string) (string, error) {
+	ids, err := VolumeList(tx)
+	if err != nil {
+		return "", err
+	}
+	for _, id := range ids {
+		v, err := NewVolumeEntryFromId(tx, id)
+		if err != nil {
+			return "", err
+		}
+		if v.Info.GlusterId == glusterId {
+			return id, nil
+		}
+	}
+	return "", ErrNotFound
+}
+
+// withVolumeGlusterId lets the volume routes take the gluster volume id
+// of a volume in place of its heketi id. Heketi ids never contain
+// dashes, so only the ids with dashes are looked up in the index.
+func (a *App) withVolumeGlusterId(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		if id := vars["id"]; strings.Contains(id, "-") {
+			a.db.View(func(tx *bolt.Tx) error {
+				if heketiId, err := lookupVolumeGlusterId(tx, id); err == nil {
+					vars["id"] = heketiId
+				}
+				return nil
+			})
+		}
+		h(w, r)
+	}
+}
@@ -0,0 +1,144 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/heketi/heketi/executors"
+	wdb "github.com/heketi/heketi/pkg/db"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+)
+
+// Name gluster gives to the bricks it can not reach
+const brickNameNotAvailable = "information not available"
+
+var (
+	// Seconds a brick replace waiting for the heal of the volume waits
+	// when the request does not set a timeout
+	BrickReplaceHealTimeout = 3600
+
+	// Time between the checks of the heal state of a volume by the
+	// brick replaces waiting for its heal
+	healWaitPollInterval = 10 * time.Second
+)
+
+// VolumeHealStatus returns the self-heal state of the bricks of the
+// volume, in the order gluster reports them. The bricks of the volume
+// missing from the report of gluster are reported offline last.
+func VolumeHealStatus(db wdb.RODB,
+	executor executors.Executor,
+	id string) (*api.VolumeHealInfoResponse, error) {
+
+	var vol *VolumeEntry
+	var names map[string]string
+	err := db.View(func(tx *bolt.Tx) error {
+		var err error
+		vol, err = NewVolumeEntryFromId(tx, id)
+		if err != nil {
+			return err
+		}
+		names, err = glusterBrickNames(tx, vol)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if vol.Info.Durability.Type == api.DurabilityDistributeOnly {
+		return nil, ErrNoSelfHeal
+	}
+
+	host, err := GetVerifiedManageHostname(db, executor, vol.Info.Cluster)
+	if err != nil {
+		return nil, err
+	}
+	healinfo, err := executor.HealInfo(host, vol.Info.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &api.VolumeHealInfoResponse{
+		Id:     vol.Info.Id,
+		Bricks: []api.BrickHealInfo{},
+	}
+	reported := map[string]bool{}
+	for _, status := range healinfo.Bricks.BrickList {
+		b := api.BrickHealInfo{
+			Name:           status.Name,
+			Status:         status.Status,
+			PendingEntries: -1,
+		}
+		if status.Name != brickNameNotAvailable {
+			brick, err := vol.getBrickEntryfromBrickName(db, status.Name)
+			if err == nil {
+				b.Id = brick.Id()
+				reported[b.Id] = true
+			} else if err != ErrNotFound {
+				return nil, err
+			}
+			// Gluster sends "-" as the entries of the bricks it
+			// can not reach
+			b.Online = status.NumberOfEntries != "-"
+		}
+		if b.Online {
+			if n, err := strconv.Atoi(status.NumberOfEntries); err == nil {
+				b.PendingEntries = n
+				resp.PendingEntries += n
+			}
+		}
+		resp.Bricks = append(resp.Bricks, b)
+	}
+
+	for _, brickId := range vol.BricksIds() {
+		if !reported[brickId] {
+			resp.Bricks = append(resp.Bricks, api.BrickHealInfo{
+				Id:             brickId,
+				Name:           names[brickId],
+				PendingEntries: -1,
+			})
+		}
+	}
+	return resp, nil
+}
+
+// waitVolumeHeal polls the heal state of the volume until no entries of
+// its bricks are pending heal, reporting the entries still pending as
+// the step reached
+func waitVolumeHeal(db wdb.RODB,
+	executor executors.Executor,
+	id string,
+	timeout time.Duration,
+	step func(string)) error {
+
+	deadline := time.Now().Add(timeout)
+	for {
+		heal, err := VolumeHealStatus(db, executor, id)
+		if err != nil {
+			return err
+		}
+		if heal.PendingEntries == 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("Heal of volume %v did not complete in %v, "+
+				"%v entries pending heal", id, timeout, heal.PendingEntries)
+		}
+		logger.Debug("Waiting for the heal of volume %v: %v entries pending",
+			id, heal.PendingEntries)
+		if step != nil {
+			step(fmt.Sprintf("%v: %v", api.BrickReplaceWaitingHeal,
+				heal.PendingEntries))
+		}
+		time.Sleep(healWaitPollInterval)
+	}
+}
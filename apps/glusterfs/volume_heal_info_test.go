@@ -0,0 +1,199 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/gorilla/mux"
+	client "github.com/heketi/heketi/client/api/go-client"
+	"github.com/heketi/heketi/executors"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/tests"
+)
+
+func TestVolumeHealInfo(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	c := client.NewClientNoAuth(ts.URL)
+	tests.Assert(t, c != nil)
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		3,    // nodes_per_cluster
+		1,    // devices_per_node,
+		2*TB, // disksize
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	req := &api.VolumeCreateRequest{}
+	req.Size = 10
+	req.Durability.Type = api.DurabilityReplicate
+	req.Durability.Replicate.Replica = 3
+	vol, err := c.VolumeCreate(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(vol.Bricks) == 3, vol.Bricks)
+
+	// The first brick has entries pending heal and gluster can not
+	// reach the last one
+	app.xo.MockHealInfo = func(host string, volume string) (*executors.HealInfo, error) {
+		hi, err := mockHealStatusFromDb(app.db, volume)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, len(hi.Bricks.BrickList) == 3, hi.Bricks.BrickList)
+		hi.Bricks.BrickList[0].Status = "Connected"
+		hi.Bricks.BrickList[0].NumberOfEntries = "7"
+		hi.Bricks.BrickList[2] = executors.BrickHealStatus{
+			Name:            "information not available",
+			Status:          "Transport endpoint is not connected",
+			NumberOfEntries: "-",
+		}
+		return hi, nil
+	}
+
+	heal, err := c.VolumeHealInfo(vol.Id)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, heal.Id == vol.Id)
+	tests.Assert(t, heal.PendingEntries == 7, heal.PendingEntries)
+	tests.Assert(t, len(heal.Bricks) == 4, heal.Bricks)
+
+	known := map[string]bool{}
+	for _, b := range vol.Bricks {
+		known[b.Id] = true
+	}
+	b := heal.Bricks[0]
+	tests.Assert(t, known[b.Id] && b.Online, b)
+	tests.Assert(t, b.Status == "Connected" && b.PendingEntries == 7, b)
+	b = heal.Bricks[1]
+	tests.Assert(t, known[b.Id] && b.Online && b.PendingEntries == 0, b)
+	b = heal.Bricks[2]
+	tests.Assert(t, b.Id == "" && !b.Online && b.PendingEntries == -1, b)
+
+	// The brick gluster did not name is reported by heketi
+	b = heal.Bricks[3]
+	tests.Assert(t, known[b.Id] && !b.Online && b.PendingEntries == -1, b)
+	tests.Assert(t, b.Name != "", b)
+
+	_, err = c.VolumeHealInfo("12345")
+	tests.Assert(t, err != nil)
+
+	// Distributed volumes have nothing to heal
+	req = &api.VolumeCreateRequest{}
+	req.Size = 10
+	req.Durability.Type = api.DurabilityDistributeOnly
+	vol, err = c.VolumeCreate(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	_, err = c.VolumeHealInfo(vol.Id)
+	tests.Assert(t, err != nil)
+}
+
+func TestBrickReplaceWaitHeal(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	c := client.NewClientNoAuth(ts.URL)
+	tests.Assert(t, c != nil)
+
+	defer func(d time.Duration) { healWaitPollInterval = d }(healWaitPollInterval)
+	healWaitPollInterval = time.Millisecond
+
+	sampleNodeWithBricks(t, app, 4)
+	brick, volume := sampleBrick(t, app)
+
+	// Entries are pending heal once the brick is replaced, until the
+	// volume is healed
+	var healed int32
+	app.xo.MockHealInfo = func(host string, vol string) (*executors.HealInfo, error) {
+		hi, err := mockHealStatusFromDb(app.db, vol)
+		tests.Assert(t, err == nil)
+		replaced := false
+		app.db.View(func(tx *bolt.Tx) error {
+			_, err := NewBrickEntryFromId(tx, brick.Info.Id)
+			replaced = err == ErrNotFound
+			return nil
+		})
+		if replaced && atomic.LoadInt32(&healed) == 0 {
+			hi.Bricks.BrickList[0].NumberOfEntries = "5"
+		}
+		return hi, nil
+	}
+
+	r, err := http.Post(ts.URL+"/bricks/"+brick.Info.Id+"/replace?wait_for_heal=true",
+		"", nil)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, r.StatusCode == http.StatusAccepted, r.StatusCode)
+	location, err := r.Location()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// The replace reports the entries pending heal
+	var step string
+	for i := 0; i < 100 && !strings.HasPrefix(step, api.BrickReplaceWaitingHeal); i++ {
+		r, err = http.Get(location.String())
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, r.Header.Get("X-Pending") == "true")
+		step = r.Header.Get(api.HeaderPendingStep)
+		time.Sleep(10 * time.Millisecond)
+	}
+	tests.Assert(t, step == api.BrickReplaceWaitingHeal+": 5", step)
+	atomic.StoreInt32(&healed, 1)
+
+	for {
+		r, err = http.Get(location.String())
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		if r.Header.Get("X-Pending") != "true" {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	tests.Assert(t, r.StatusCode == http.StatusOK, r.StatusCode)
+
+	// The replace fails if the volume does not heal in time
+	atomic.StoreInt32(&healed, 0)
+	info, err := c.VolumeInfo(volume.Info.Id)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	app.db.View(func(tx *bolt.Tx) error {
+		brick, err = NewBrickEntryFromId(tx, info.Bricks[1].Id)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		return nil
+	})
+	_, err = c.BrickReplaceWaitHeal(brick.Info.Id, nil, 1)
+	tests.Assert(t, err != nil)
+	tests.Assert(t, strings.Contains(err.Error(), "did not complete"), err)
+
+	for _, query := range []string{"wait_for_heal=maybe", "heal_timeout=0"} {
+		r, err := http.Post(ts.URL+"/bricks/"+info.Bricks[0].Id+"/replace?"+query,
+			"", nil)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, r.StatusCode == http.StatusBadRequest, r.StatusCode)
+	}
+}
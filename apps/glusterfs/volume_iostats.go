@@ -0,0 +1,190 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/heketi/heketi/executors"
+	wdb "github.com/heketi/heketi/pkg/db"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+)
+
+var (
+	// Seconds between the samples of the io of every volume.
+	// Zero disables the sampling.
+	VolumeIOStatsInterval = 0
+
+	// Number of samples kept for each volume
+	VolumeIOStatsSamples = 60
+)
+
+// VolumeIOStats keeps the latest io samples of a volume in a ring
+// of fixed size. The samples are the difference between two reads of
+// the cumulative profile counters of the volume.
+type VolumeIOStats struct {
+	Ring []api.VolumeIOSample
+	// Index of the oldest sample once the ring is full
+	Next int
+
+	// Counters of the last profile read
+	Last api.VolumeIOSample
+}
+
+// Samples returns the samples in the ring, oldest first
+func (s *VolumeIOStats) Samples() []api.VolumeIOSample {
+	samples := make([]api.VolumeIOSample, 0, len(s.Ring))
+	samples = append(samples, s.Ring[s.Next:]...)
+	return append(samples, s.Ring[:s.Next]...)
+}
+
+func (s *VolumeIOStats) add(sample api.VolumeIOSample, max int) {
+	if max <= 0 {
+		return
+	}
+
+	// Keep the latest samples when the size of the ring was lowered
+	if len(s.Ring) > max {
+		samples := s.Samples()
+		s.Ring = samples[len(samples)-max:]
+		s.Next = 0
+	}
+
+	if len(s.Ring) < max {
+		s.Ring = append(s.Ring, sample)
+		s.Next = len(s.Ring) % max
+		return
+	}
+	s.Ring[s.Next] = sample
+	s.Next = (s.Next + 1) % max
+}
+
+// counterDelta returns the increase of a counter. Counters going back
+// were reset, when profiling was restarted, and count from zero.
+func counterDelta(last, current uint64) uint64 {
+	if current < last {
+		return current
+	}
+	return current - last
+}
+
+// update saves the counters read from the profile of the volume at the
+// given time and adds a sample of the io since the previous read.
+func (s *VolumeIOStats) update(counters api.VolumeIOSample, max int) {
+	if s.Last.Time != 0 && counters.Time > s.Last.Time {
+		s.add(api.VolumeIOSample{
+			Time:       counters.Time,
+			Interval:   counters.Time - s.Last.Time,
+			ReadBytes:  counterDelta(s.Last.ReadBytes, counters.ReadBytes),
+			WriteBytes: counterDelta(s.Last.WriteBytes, counters.WriteBytes),
+			Fops:       counterDelta(s.Last.Fops, counters.Fops),
+		}, max)
+	}
+	s.Last = counters
+}
+
+// profileCounters sums the cumulative counters of the bricks
+func profileCounters(profile *executors.VolumeProfile) api.VolumeIOSample {
+	counters := api.VolumeIOSample{}
+	for _, b := range profile.Bricks {
+		counters.ReadBytes += b.CumulativeStats.TotalRead
+		counters.WriteBytes += b.CumulativeStats.TotalWrite
+		for _, fop := range b.CumulativeStats.Fops {
+			counters.Fops += fop.Hits
+		}
+	}
+	return counters
+}
+
+// SampleVolumeIOStats reads the profile counters of the volume and saves
+// a sample of its io since the previous read. Profiling must have been
+// started on the volume.
+func SampleVolumeIOStats(db wdb.DB,
+	executor executors.Executor,
+	id string) error {
+
+	var vol *VolumeEntry
+	err := db.View(func(tx *bolt.Tx) error {
+		var err error
+		vol, err = NewVolumeEntryFromId(tx, id)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	host, err := GetVerifiedManageHostname(db, executor, vol.Info.Cluster)
+	if err != nil {
+		return err
+	}
+
+	profile, err := executor.VolumeProfileInfo(host, vol.Info.Name)
+	if err != nil {
+		return err
+	}
+	counters := profileCounters(profile)
+	counters.Time = time.Now().Unix()
+
+	return db.Update(func(tx *bolt.Tx) error {
+		vol, err := NewVolumeEntryFromId(tx, id)
+		if err != nil {
+			return err
+		}
+		if vol.IOStats == nil {
+			vol.IOStats = &VolumeIOStats{}
+		}
+		vol.IOStats.update(counters, VolumeIOStatsSamples)
+		return vol.Save(tx)
+	})
+}
+
+func sampleAllVolumeIOStats(db wdb.DB, executor executors.Executor) {
+	var ids []string
+	err := db.View(func(tx *bolt.Tx) error {
+		vols, err := VolumeList(tx)
+		if err != nil {
+			return err
+		}
+		for _, id := range vols {
+			vol, err := NewVolumeEntryFromId(tx, id)
+			if err != nil {
+				return err
+			}
+			if vol.Visible() {
+				ids = append(ids, id)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logger.LogError("Unable to list volumes to sample: %v", err)
+		return
+	}
+
+	for _, id := range ids {
+		// Volumes without profiling enabled can not be sampled
+		if err := SampleVolumeIOStats(db, executor, id); err != nil {
+			logger.Debug("Unable to sample io of volume %v: %v", id, err)
+		}
+	}
+}
+
+// startVolumeIOStatsSampler samples the io of the volumes every
+// VolumeIOStatsInterval seconds until the app is closed
+func (a *App) startVolumeIOStatsSampler() {
+	if VolumeIOStatsInterval <= 0 || a.dbReadOnly {
+		return
+	}
+
+	a.runPeriodically(VolumeIOStatsInterval, func() {
+		sampleAllVolumeIOStats(a.db, a.executor)
+	})
+}
@@ -0,0 +1,167 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"errors"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/gorilla/mux"
+	client "github.com/heketi/heketi/client/api/go-client"
+	"github.com/heketi/heketi/executors"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/tests"
+)
+
+func TestVolumeIOStatsRing(t *testing.T) {
+	s := &VolumeIOStats{}
+	for i := int64(1); i <= 3; i++ {
+		s.add(api.VolumeIOSample{Time: i}, 5)
+	}
+	samples := s.Samples()
+	tests.Assert(t, len(samples) == 3, samples)
+	tests.Assert(t, samples[0].Time == 1 && samples[2].Time == 3, samples)
+
+	// The oldest samples are dropped once the ring is full
+	for i := int64(4); i <= 7; i++ {
+		s.add(api.VolumeIOSample{Time: i}, 5)
+	}
+	samples = s.Samples()
+	tests.Assert(t, len(s.Ring) == 5, s.Ring)
+	tests.Assert(t, len(samples) == 5, samples)
+	for i, sample := range samples {
+		tests.Assert(t, sample.Time == int64(i+3), samples)
+	}
+
+	// Lowering the size keeps the latest samples
+	s.add(api.VolumeIOSample{Time: 8}, 3)
+	samples = s.Samples()
+	tests.Assert(t, len(samples) == 3, samples)
+	tests.Assert(t, samples[0].Time == 6, samples)
+	tests.Assert(t, samples[1].Time == 7, samples)
+	tests.Assert(t, samples[2].Time == 8, samples)
+}
+
+func TestVolumeIOStatsUpdate(t *testing.T) {
+	s := &VolumeIOStats{}
+
+	// The first read only saves the counters
+	s.update(api.VolumeIOSample{Time: 100, ReadBytes: 1000, WriteBytes: 50, Fops: 10}, 10)
+	tests.Assert(t, len(s.Samples()) == 0)
+
+	s.update(api.VolumeIOSample{Time: 160, ReadBytes: 1500, WriteBytes: 50, Fops: 30}, 10)
+	samples := s.Samples()
+	tests.Assert(t, len(samples) == 1, samples)
+	tests.Assert(t, samples[0].Time == 160)
+	tests.Assert(t, samples[0].Interval == 60)
+	tests.Assert(t, samples[0].ReadBytes == 500)
+	tests.Assert(t, samples[0].WriteBytes == 0)
+	tests.Assert(t, samples[0].Fops == 20)
+
+	// Counters going back were reset
+	s.update(api.VolumeIOSample{Time: 220, ReadBytes: 200, WriteBytes: 70, Fops: 5}, 10)
+	samples = s.Samples()
+	tests.Assert(t, len(samples) == 2, samples)
+	tests.Assert(t, samples[1].ReadBytes == 200)
+	tests.Assert(t, samples[1].WriteBytes == 20)
+	tests.Assert(t, samples[1].Fops == 5)
+}
+
+func TestSampleVolumeIOStats(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	c := client.NewClientNoAuth(ts.URL)
+	tests.Assert(t, c != nil)
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		3,    // nodes_per_cluster
+		1,    // devices_per_node,
+		2*TB, // disksize
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	req := &api.VolumeCreateRequest{}
+	req.Size = 10
+	v := NewVolumeEntryFromRequest(req)
+	err = v.Create(app.db, app.executor, app.Allocator())
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	var written uint64
+	app.xo.MockVolumeProfileInfo = func(host, volume string) (*executors.VolumeProfile, error) {
+		tests.Assert(t, volume == v.Info.Name, volume)
+		written += 4096
+		profile := &executors.VolumeProfile{VolName: volume}
+		for i := 0; i < 2; i++ {
+			b := executors.BrickProfile{}
+			b.CumulativeStats.TotalWrite = written
+			b.CumulativeStats.Fops = []executors.ProfileFopStats{
+				{Name: "WRITE", Hits: written / 1024},
+			}
+			profile.Bricks = append(profile.Bricks, b)
+		}
+		return profile, nil
+	}
+
+	// No samples before the volume is sampled
+	stats, err := c.VolumeIOStats(v.Info.Id)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(stats.Samples) == 0, stats.Samples)
+
+	err = SampleVolumeIOStats(app.db, app.executor, v.Info.Id)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// Make the second read look like it happened later
+	app.db.Update(func(tx *bolt.Tx) error {
+		vol, err := NewVolumeEntryFromId(tx, v.Info.Id)
+		tests.Assert(t, err == nil)
+		vol.IOStats.Last.Time -= 60
+		return vol.Save(tx)
+	})
+
+	err = SampleVolumeIOStats(app.db, app.executor, v.Info.Id)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	stats, err = c.VolumeIOStats(v.Info.Id)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, stats.Id == v.Info.Id)
+	tests.Assert(t, len(stats.Samples) == 1, stats.Samples)
+	sample := stats.Samples[0]
+	tests.Assert(t, sample.Interval >= 60, sample)
+	tests.Assert(t, sample.WriteBytes == 2*4096, sample)
+	tests.Assert(t, sample.Fops == 2*4, sample)
+
+	// Volumes without profiling are not sampled
+	app.xo.MockVolumeProfileInfo = func(host, volume string) (*executors.VolumeProfile, error) {
+		return nil, errors.New("Profile on Volume is not started")
+	}
+	err = SampleVolumeIOStats(app.db, app.executor, v.Info.Id)
+	tests.Assert(t, err != nil)
+	sampleAllVolumeIOStats(app.db, app.executor)
+
+	stats, err = c.VolumeIOStats(v.Info.Id)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(stats.Samples) == 1, stats.Samples)
+
+	_, err = c.VolumeIOStats("12345")
+	tests.Assert(t, err != nil)
+}
@@ -0,0 +1,126 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+
+	"github.com/boltdb/bolt"
+)
+
+const (
+	// Index of the volumes by name. The keys are the name and the id
+	// of the volumes separated by a slash, which volume names can not
+	// contain, as volumes on different clusters may have the same name.
+	BOLTDB_BUCKET_VOLUME_NAME = "VOLUME_NAME"
+)
+
+func volumeNameKey(name, id string) []byte {
+	return []byte(name + "/" + id)
+}
+
+// indexVolumeName adds the volume to the index of the volumes by name
+func indexVolumeName(tx *bolt.Tx, v *VolumeEntry) error {
+	b := tx.Bucket([]byte(BOLTDB_BUCKET_VOLUME_NAME))
+	if b == nil {
+		return ErrDbAccess
+	}
+	return b.Put(volumeNameKey(v.Info.Name, v.Info.Id), []byte(v.Info.Id))
+}
+
+// unindexVolumeName removes the volume from the index of the volumes
+// by name
+func unindexVolumeName(tx *bolt.Tx, v *VolumeEntry) error {
+	b := tx.Bucket([]byte(BOLTDB_BUCKET_VOLUME_NAME))
+	if b == nil {
+		return ErrDbAccess
+	}
+	return b.Delete(volumeNameKey(v.Info.Name, v.Info.Id))
+}
+
+// rebuildVolumeNameIndex indexes every volume of the db, dropping the
+// index entries of the volumes saved by versions not maintaining it
+func rebuildVolumeNameIndex(tx *bolt.Tx) error {
+	if tx.Bucket([]byte(BOLTDB_BUCKET_VOLUME_NAME)) != nil {
+		if err := tx.DeleteBucket([]byte(BOLTDB_BUCKET_VOLUME_NAME)); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.CreateBucket([]byte(BOLTDB_BUCKET_VOLUME_NAME)); err != nil {
+		return err
+	}
+
+	ids, err := VolumeList(tx)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		v, err := NewVolumeEntryFromId(tx, id)
+		if err != nil {
+			return err
+		}
+		if err := indexVolumeName(tx, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SearchVolumes returns the ids of the complete volumes named name or,
+// if prefix is true, with a name starting with name, ordered by name
+func SearchVolumes(tx *bolt.Tx, name string, prefix bool) ([]string, error) {
+	b := tx.Bucket([]byte(BOLTDB_BUCKET_VOLUME_NAME))
+	if b == nil {
+		// A db opened read-only may predate the index
+		return scanVolumeNames(tx, name, prefix)
+	}
+	pending, err := MapPendingVolumes(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	start := []byte(name)
+	if !prefix {
+		start = volumeNameKey(name, "")
+	}
+	ids := []string{}
+	c := b.Cursor()
+	for k, v := c.Seek(start); k != nil && bytes.HasPrefix(k, start); k, v = c.Next() {
+		if _, ok := pending[string(v)]; ok {
+			continue
+		}
+		ids = append(ids, string(v))
+	}
+	return ids, nil
+}
+
+func scanVolumeNames(tx *bolt.Tx, name string, prefix bool) ([]string, error) {
+	ids, err := ListCompleteVolumes(tx)
+	if err != nil {
+		return nil, err
+	}
+	keys := []string{}
+	for _, id := range ids {
+		v, err := NewVolumeEntryFromId(tx, id)
+		if err != nil {
+			return nil, err
+		}
+		if v.Info.Name == name || (prefix && strings.HasPrefix(v.Info.Name, name)) {
+			keys = append(keys, string(volumeNameKey(v.Info.Name, v.Info.Id)))
+		}
+	}
+	sort.Strings(keys)
+	for i, key := range keys {
+		keys[i] = key[strings.LastIndex(key, "/")+1:]
+	}
+	return keys, nil
+}
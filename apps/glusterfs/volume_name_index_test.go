@@ -0,0 +1,113 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/gorilla/mux"
+	client "github.com/heketi/heketi/client/api/go-client"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/tests"
+)
+
+func TestVolumeSearch(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	c := client.NewClientNoAuth(ts.URL)
+	tests.Assert(t, c != nil)
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		3,    // nodes_per_cluster
+		2,    // devices_per_node,
+		2*TB, // disksize
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	ids := map[string]string{}
+	for _, name := range []string{"pvc-b", "pvc-a", "pvcx", "other"} {
+		req := &api.VolumeCreateRequest{}
+		req.Size = 10
+		req.Name = name
+		req.Durability.Type = api.DurabilityReplicate
+		req.Durability.Replicate.Replica = 3
+		vol, err := c.VolumeCreate(req)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		ids[name] = vol.Id
+	}
+
+	search := func(name, match string) []string {
+		list, err := c.VolumeSearch(&api.VolumeSearchRequest{
+			Name:  name,
+			Match: match,
+		})
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		return list.Volumes
+	}
+
+	found := search("pvc-a", "")
+	tests.Assert(t, reflect.DeepEqual(found, []string{ids["pvc-a"]}), found)
+	found = search("pvc-", api.VolumeSearchExact)
+	tests.Assert(t, len(found) == 0, found)
+
+	// Ordered by name
+	found = search("pvc-", api.VolumeSearchPrefix)
+	tests.Assert(t, reflect.DeepEqual(found,
+		[]string{ids["pvc-a"], ids["pvc-b"]}), found)
+	found = search("pvc", api.VolumeSearchPrefix)
+	tests.Assert(t, len(found) == 3, found)
+
+	// Deleted volumes are removed from the index
+	err = c.VolumeDelete(ids["pvc-a"])
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	found = search("pvc-", api.VolumeSearchPrefix)
+	tests.Assert(t, reflect.DeepEqual(found, []string{ids["pvc-b"]}), found)
+
+	// The index is rebuilt from the volumes
+	err = app.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(BOLTDB_BUCKET_VOLUME_NAME))
+		tests.Assert(t, b.Put([]byte("stale/abc"), []byte("abc")) == nil)
+		return VolumeEntryUpgrade(tx)
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	app.db.View(func(tx *bolt.Tx) error {
+		keys := EntryKeys(tx, BOLTDB_BUCKET_VOLUME_NAME)
+		tests.Assert(t, len(keys) == 3, keys)
+
+		// Dbs predating the index are searched without it
+		scanned, err := scanVolumeNames(tx, "pvc", true)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		indexed, err := SearchVolumes(tx, "pvc", true)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, reflect.DeepEqual(scanned, indexed), scanned, indexed)
+		return nil
+	})
+
+	for _, query := range []string{"", "?name=a/b", "?name=a&match=any"} {
+		r, err := http.Get(ts.URL + "/volumes/search" + query)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, r.StatusCode == http.StatusBadRequest, query, r.StatusCode)
+	}
+}
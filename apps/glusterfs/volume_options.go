@@ -0,0 +1,279 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"strings"
+
+	"github.com/boltdb/bolt"
+	"github.com/heketi/heketi/executors"
+	wdb "github.com/heketi/heketi/pkg/db"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+)
+
+var (
+	// Seconds between the checks of the options of every volume.
+	// Zero disables the periodic checks.
+	VolumeOptionsCheckInterval = 0
+)
+
+// parseVolumeOption splits an option, as passed to gluster volume set,
+// into its name and value
+func parseVolumeOption(option string) (string, string) {
+	fields := strings.Fields(option)
+	if len(fields) == 0 {
+		return "", ""
+	}
+	return fields[0], strings.Join(fields[1:], " ")
+}
+
+// volumeOptionsDrift compares the options set by heketi on the volume
+// with the options reported by gluster. Option groups are not checked
+// because gluster reports the options of the group instead.
+func volumeOptionsDrift(options []string, vinfo *executors.Volume) []api.VolumeOptionDrift {
+	actual := map[string]string{}
+	for _, o := range vinfo.Options.OptionList {
+		actual[o.Name] = o.Value
+	}
+
+	// The last value of an option set more than once is the one in use
+	names := []string{}
+	expected := map[string]string{}
+	for _, option := range options {
+		name, value := parseVolumeOption(option)
+		if name == "" || name == "group" {
+			continue
+		}
+		if _, ok := expected[name]; !ok {
+			names = append(names, name)
+		}
+		expected[name] = value
+	}
+
+	drift := []api.VolumeOptionDrift{}
+	for _, name := range names {
+		value, ok := actual[name]
+		if !ok {
+			// Gluster reports the options by their full name
+			for full, v := range actual {
+				if strings.HasSuffix(full, "."+name) {
+					value, ok = v, true
+					break
+				}
+			}
+		}
+		if ok && strings.EqualFold(value, expected[name]) {
+			continue
+		}
+		drift = append(drift, api.VolumeOptionDrift{
+			Option:   name,
+			Expected: expected[name],
+			Actual:   value,
+		})
+	}
+	return drift
+}
+
+// CheckVolumeOptions compares the options of the volume in gluster with
+// the options heketi set on it and saves the differences found in the
+// volume entry. When enforce is set, the options that drifted are set
+// back to the values set by heketi.
+func CheckVolumeOptions(db wdb.DB,
+	executor executors.Executor,
+	id string,
+	enforce bool) (*api.VolumeOptionsCheckResponse, error) {
+
+	var vol *VolumeEntry
+	err := db.View(func(tx *bolt.Tx) error {
+		var err error
+		vol, err = NewVolumeEntryFromId(tx, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	host, err := GetVerifiedManageHostname(db, executor, vol.Info.Cluster)
+	if err != nil {
+		return nil, err
+	}
+	vinfo, err := executor.VolumeInfo(host, vol.Info.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &api.VolumeOptionsCheckResponse{
+		Id:    vol.Info.Id,
+		Drift: volumeOptionsDrift(vol.GlusterVolumeOptions, vinfo),
+	}
+	for _, d := range resp.Drift {
+		logger.Warning("Option %v of volume %v is %q instead of %q",
+			d.Option, vol.Info.Name, d.Actual, d.Expected)
+	}
+
+	drift := resp.Drift
+	if enforce && len(resp.Drift) > 0 {
+		options := []string{}
+		for _, d := range resp.Drift {
+			options = append(options, d.Option+" "+d.Expected)
+		}
+		if err := executor.VolumeSetOptions(host, vol.Info.Name, options); err != nil {
+			return nil, err
+		}
+		logger.Info("Enforced %v options of volume %v", len(options), vol.Info.Name)
+		resp.Enforced = true
+		drift = nil
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		vol, err := NewVolumeEntryFromId(tx, id)
+		if err != nil {
+			return err
+		}
+		vol.OptionsDrift = drift
+		return vol.Save(tx)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// changedOptionNames returns the names of the options the request
+// resets or sets
+func changedOptionNames(req *api.VolumeOptionsRequest) map[string]bool {
+	changed := map[string]bool{}
+	for _, name := range req.Reset {
+		changed[name] = true
+	}
+	for _, option := range req.Set {
+		name, _ := parseVolumeOption(option)
+		changed[name] = true
+	}
+	return changed
+}
+
+// changeVolumeOptions returns the options set on a volume once the
+// options of the request are reset and set. The options the request
+// resets or sets again are removed and the options it sets are added.
+func changeVolumeOptions(options []string,
+	req *api.VolumeOptionsRequest) []string {
+
+	changed := changedOptionNames(req)
+	result := []string{}
+	for _, option := range options {
+		name, _ := parseVolumeOption(option)
+		if !changed[name] {
+			result = append(result, option)
+		}
+	}
+	return append(result, req.Set...)
+}
+
+// UpdateVolumeOptions resets and sets the options of the request on the
+// volume and records the options now set on the volume in its entry
+func UpdateVolumeOptions(db wdb.DB,
+	executor executors.Executor,
+	id string,
+	req *api.VolumeOptionsRequest) (*VolumeEntry, error) {
+
+	var vol *VolumeEntry
+	err := db.View(func(tx *bolt.Tx) error {
+		var err error
+		vol, err = NewVolumeEntryFromId(tx, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	host, err := GetVerifiedManageHostname(db, executor, vol.Info.Cluster)
+	if err != nil {
+		return nil, err
+	}
+	if err := executor.VolumeResetOptions(host, vol.Info.Name, req.Reset); err != nil {
+		return nil, err
+	}
+	if err := executor.VolumeSetOptions(host, vol.Info.Name, req.Set); err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		var err error
+		vol, err = NewVolumeEntryFromId(tx, id)
+		if err != nil {
+			return err
+		}
+		vol.GlusterVolumeOptions = changeVolumeOptions(vol.GlusterVolumeOptions, req)
+
+		// The options changed no longer drift
+		changed := changedOptionNames(req)
+		drift := []api.VolumeOptionDrift{}
+		for _, d := range vol.OptionsDrift {
+			if !changed[d.Option] {
+				drift = append(drift, d)
+			}
+		}
+		vol.OptionsDrift = drift
+		return vol.Save(tx)
+	})
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("Changed options of volume %v: set %v, reset %v",
+		vol.Info.Name, req.Set, req.Reset)
+
+	return vol, nil
+}
+
+// checkAllVolumeOptions checks the options of every volume that is not
+// being created or deleted
+func checkAllVolumeOptions(db wdb.DB, executor executors.Executor) {
+	var ids []string
+	err := db.View(func(tx *bolt.Tx) error {
+		vols, err := VolumeList(tx)
+		if err != nil {
+			return err
+		}
+		for _, id := range vols {
+			vol, err := NewVolumeEntryFromId(tx, id)
+			if err != nil {
+				return err
+			}
+			if vol.Visible() {
+				ids = append(ids, id)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logger.LogError("Unable to list volumes to check: %v", err)
+		return
+	}
+
+	for _, id := range ids {
+		if _, err := CheckVolumeOptions(db, executor, id, false); err != nil {
+			logger.LogError("Unable to check options of volume %v: %v", id, err)
+		}
+	}
+}
+
+// startVolumeOptionsChecker checks the options of the volumes every
+// VolumeOptionsCheckInterval seconds until the app is closed
+func (a *App) startVolumeOptionsChecker() {
+	if VolumeOptionsCheckInterval <= 0 || a.dbReadOnly {
+		return
+	}
+
+	a.runPeriodically(VolumeOptionsCheckInterval, func() {
+		checkAllVolumeOptions(a.db, a.executor)
+	})
+}
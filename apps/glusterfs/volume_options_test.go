@@ -0,0 +1,249 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/gorilla/mux"
+	client "github.com/heketi/heketi/client/api/go-client"
+	"github.com/heketi/heketi/executors"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/tests"
+)
+
+func volumeWithOptions(options ...string) *executors.Volume {
+	vinfo := &executors.Volume{}
+	for i := 0; i < len(options); i += 2 {
+		vinfo.Options.OptionList = append(vinfo.Options.OptionList,
+			executors.Option{Name: options[i], Value: options[i+1]})
+	}
+	return vinfo
+}
+
+func TestVolumeOptionsDrift(t *testing.T) {
+	vinfo := volumeWithOptions(
+		"performance.readdir-ahead", "on",
+		"server.tcp-user-timeout", "42",
+		"cluster.quorum-type", "fixed")
+
+	drift := volumeOptionsDrift([]string{
+		"group gluster-block",
+		"performance.readdir-ahead ON",
+		"tcp-user-timeout 42",
+		"cluster.quorum-type auto",
+		"features.shard on",
+		"",
+	}, vinfo)
+	tests.Assert(t, len(drift) == 2, drift)
+	tests.Assert(t, drift[0] == api.VolumeOptionDrift{
+		Option:   "cluster.quorum-type",
+		Expected: "auto",
+		Actual:   "fixed",
+	}, drift[0])
+	tests.Assert(t, drift[1] == api.VolumeOptionDrift{
+		Option:   "features.shard",
+		Expected: "on",
+	}, drift[1])
+
+	// The last value of an option is the one expected
+	drift = volumeOptionsDrift([]string{
+		"cluster.quorum-type auto",
+		"cluster.quorum-type fixed",
+	}, vinfo)
+	tests.Assert(t, len(drift) == 0, drift)
+}
+
+func TestCheckVolumeOptions(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		3,    // nodes_per_cluster
+		1,    // devices_per_node,
+		2*TB, // disksize)
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	req := &api.VolumeCreateRequest{}
+	req.Size = 10
+	req.GlusterVolumeOptions = []string{"cluster.quorum-type auto"}
+	v := NewVolumeEntryFromRequest(req)
+	err = v.Create(app.db, app.executor, app.Allocator())
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	app.xo.MockVolumeInfo = func(host string, volume string) (*executors.Volume, error) {
+		return volumeWithOptions("cluster.quorum-type", "fixed"), nil
+	}
+	var set []string
+	app.xo.MockVolumeSetOptions = func(host string, volume string, options []string) error {
+		tests.Assert(t, volume == v.Info.Name)
+		set = options
+		return nil
+	}
+
+	drift := func() []api.VolumeOptionDrift {
+		var drift []api.VolumeOptionDrift
+		app.db.View(func(tx *bolt.Tx) error {
+			vol, err := NewVolumeEntryFromId(tx, v.Info.Id)
+			tests.Assert(t, err == nil)
+			info, err := vol.NewInfoResponse(tx)
+			tests.Assert(t, err == nil)
+			drift = info.OptionsDrift
+			return nil
+		})
+		return drift
+	}
+
+	// Reporting saves the drift in the volume
+	r, err := CheckVolumeOptions(app.db, app.executor, v.Info.Id, false)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(r.Drift) == 1, r.Drift)
+	tests.Assert(t, !r.Enforced)
+	tests.Assert(t, set == nil, set)
+	tests.Assert(t, len(drift()) == 1, drift())
+
+	// Enforcing sets the options back and clears the drift
+	r, err = CheckVolumeOptions(app.db, app.executor, v.Info.Id, true)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(r.Drift) == 1, r.Drift)
+	tests.Assert(t, r.Enforced)
+	tests.Assert(t, len(set) == 1 && set[0] == "cluster.quorum-type auto", set)
+	tests.Assert(t, len(drift()) == 0, drift())
+
+	// The periodic check reports the drift again
+	checkAllVolumeOptions(app.db, app.executor)
+	tests.Assert(t, len(drift()) == 1, drift())
+}
+
+func TestChangeVolumeOptions(t *testing.T) {
+	options := changeVolumeOptions([]string{
+		"group gluster-block",
+		"performance.cache-size 128MB",
+		"performance.read-ahead off",
+	}, &api.VolumeOptionsRequest{
+		Set:   []string{"performance.cache-size 256MB", "server.tcp-user-timeout 42"},
+		Reset: []string{"performance.read-ahead"},
+	})
+	tests.Assert(t, reflect.DeepEqual(options, []string{
+		"group gluster-block",
+		"performance.cache-size 256MB",
+		"server.tcp-user-timeout 42",
+	}), options)
+}
+
+func TestUpdateVolumeOptions(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	c := client.NewClientNoAuth(ts.URL)
+	tests.Assert(t, c != nil)
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		3,    // nodes_per_cluster
+		1,    // devices_per_node,
+		2*TB, // disksize)
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	req := &api.VolumeCreateRequest{}
+	req.Size = 10
+	req.GlusterVolumeOptions = []string{
+		"cluster.quorum-type auto",
+		"performance.read-ahead off",
+	}
+	vol, err := c.VolumeCreate(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	var set, reset []string
+	app.xo.MockVolumeSetOptions = func(host string, volume string, options []string) error {
+		tests.Assert(t, volume == vol.Name)
+		set = options
+		return nil
+	}
+	app.xo.MockVolumeResetOptions = func(host string, volume string, options []string) error {
+		tests.Assert(t, volume == vol.Name)
+		reset = options
+		return nil
+	}
+
+	// A drift of the option set is cleared
+	err = app.db.Update(func(tx *bolt.Tx) error {
+		v, err := NewVolumeEntryFromId(tx, vol.Id)
+		if err != nil {
+			return err
+		}
+		v.OptionsDrift = []api.VolumeOptionDrift{
+			{Option: "cluster.quorum-type", Expected: "auto", Actual: "fixed"},
+		}
+		return v.Save(tx)
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	info, err := c.VolumeSetOptions(vol.Id, &api.VolumeOptionsRequest{
+		Set:   []string{"cluster.quorum-type fixed", "performance.cache-size 256MB"},
+		Reset: []string{"performance.read-ahead"},
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, reflect.DeepEqual(set, []string{
+		"cluster.quorum-type fixed", "performance.cache-size 256MB"}), set)
+	tests.Assert(t, reflect.DeepEqual(reset, []string{"performance.read-ahead"}), reset)
+	tests.Assert(t, reflect.DeepEqual(info.GlusterVolumeOptions, []string{
+		"cluster.quorum-type fixed", "performance.cache-size 256MB"}),
+		info.GlusterVolumeOptions)
+	tests.Assert(t, len(info.OptionsDrift) == 0, info.OptionsDrift)
+
+	// Options set by the executor are not recorded if it fails
+	app.xo.MockVolumeSetOptions = func(host string, volume string, options []string) error {
+		return fmt.Errorf("set failed")
+	}
+	_, err = c.VolumeSetOptions(vol.Id, &api.VolumeOptionsRequest{
+		Set: []string{"performance.cache-size 512MB"},
+	})
+	tests.Assert(t, err != nil, "expected err != nil")
+	info, err = c.VolumeInfo(vol.Id)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, info.GlusterVolumeOptions[1] == "performance.cache-size 256MB",
+		info.GlusterVolumeOptions)
+
+	// Invalid requests
+	_, err = c.VolumeSetOptions(vol.Id, &api.VolumeOptionsRequest{})
+	tests.Assert(t, err != nil, "expected err != nil")
+	_, err = c.VolumeSetOptions(vol.Id, &api.VolumeOptionsRequest{
+		Set: []string{"performance.cache-size"},
+	})
+	tests.Assert(t, err != nil, "expected err != nil")
+	_, err = c.VolumeSetOptions(vol.Id, &api.VolumeOptionsRequest{
+		Reset: []string{"performance cache"},
+	})
+	tests.Assert(t, err != nil, "expected err != nil")
+	_, err = c.VolumeSetOptions("12345678", &api.VolumeOptionsRequest{
+		Reset: []string{"performance.cache-size"},
+	})
+	tests.Assert(t, err != nil, "expected err != nil")
+}
@@ -0,0 +1,102 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"github.com/boltdb/bolt"
+	"github.com/heketi/heketi/executors"
+	wdb "github.com/heketi/heketi/pkg/db"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+)
+
+// copyVolumeQuota returns a copy of the quota that does not share the
+// limits of the quota
+func copyVolumeQuota(q *api.VolumeQuota) api.VolumeQuota {
+	c := api.VolumeQuota{Enable: q.Enable}
+	if len(q.Limits) > 0 {
+		c.Limits = append([]api.VolumeQuotaLimit{}, q.Limits...)
+	}
+	return c
+}
+
+// volumeQuotaChange returns the request changing the quota of the volume
+// from one quota to the other. Limits that did not change are set
+// again, gluster replacing the limit of a directory.
+func volumeQuotaChange(volume string,
+	from, to *api.VolumeQuota) *executors.VolumeQuotaRequest {
+
+	req := &executors.VolumeQuotaRequest{Volume: volume}
+	if !to.Enable {
+		req.Disable = from.Enable
+		return req
+	}
+	req.Enable = !from.Enable
+
+	paths := map[string]bool{}
+	for _, l := range to.Limits {
+		paths[l.Path] = true
+		req.Limits = append(req.Limits, executors.QuotaLimit{
+			Path:         l.Path,
+			HardLimitMiB: l.HardLimitMiB,
+		})
+	}
+	if from.Enable {
+		for _, l := range from.Limits {
+			if !paths[l.Path] {
+				req.Remove = append(req.Remove, l.Path)
+			}
+		}
+	}
+	return req
+}
+
+// UpdateVolumeQuota changes the quota of the volume in gluster to the
+// quota of the request and records the new quota in the volume entry
+func UpdateVolumeQuota(db wdb.DB,
+	executor executors.Executor,
+	id string,
+	quota *api.VolumeQuota) (*VolumeEntry, error) {
+
+	var vol *VolumeEntry
+	err := db.View(func(tx *bolt.Tx) error {
+		var err error
+		vol, err = NewVolumeEntryFromId(tx, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	host, err := GetVerifiedManageHostname(db, executor, vol.Info.Cluster)
+	if err != nil {
+		return nil, err
+	}
+	req := volumeQuotaChange(vol.Info.Name, &vol.Info.Quota, quota)
+	if err := executor.VolumeSetQuota(host, req); err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		var err error
+		vol, err = NewVolumeEntryFromId(tx, id)
+		if err != nil {
+			return err
+		}
+		vol.Info.Quota = copyVolumeQuota(quota)
+		return vol.Save(tx)
+	})
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("Changed quota of volume %v: enabled %v, %v limits",
+		vol.Info.Name, quota.Enable, len(quota.Limits))
+
+	return vol, nil
+}
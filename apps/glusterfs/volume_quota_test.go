@@ -0,0 +1,181 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/gorilla/mux"
+	client "github.com/heketi/heketi/client/api/go-client"
+	"github.com/heketi/heketi/executors"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/tests"
+)
+
+func TestVolumeQuotaChange(t *testing.T) {
+	none := &api.VolumeQuota{}
+	enabled := &api.VolumeQuota{
+		Enable: true,
+		Limits: []api.VolumeQuotaLimit{
+			{Path: "/", HardLimitMiB: 1024},
+			{Path: "/a", HardLimitMiB: 10},
+		},
+	}
+
+	req := volumeQuotaChange("vol1", none, enabled)
+	tests.Assert(t, reflect.DeepEqual(req, &executors.VolumeQuotaRequest{
+		Volume: "vol1",
+		Enable: true,
+		Limits: []executors.QuotaLimit{
+			{Path: "/", HardLimitMiB: 1024},
+			{Path: "/a", HardLimitMiB: 10},
+		},
+	}), req)
+
+	// Limits of other directories are removed
+	changed := &api.VolumeQuota{
+		Enable: true,
+		Limits: []api.VolumeQuotaLimit{{Path: "/b", HardLimitMiB: 20}},
+	}
+	req = volumeQuotaChange("vol1", enabled, changed)
+	tests.Assert(t, reflect.DeepEqual(req, &executors.VolumeQuotaRequest{
+		Volume: "vol1",
+		Limits: []executors.QuotaLimit{{Path: "/b", HardLimitMiB: 20}},
+		Remove: []string{"/", "/a"},
+	}), req)
+
+	// Disabling the quota removes all the limits
+	req = volumeQuotaChange("vol1", enabled, none)
+	tests.Assert(t, reflect.DeepEqual(req, &executors.VolumeQuotaRequest{
+		Volume:  "vol1",
+		Disable: true,
+	}), req)
+
+	req = volumeQuotaChange("vol1", none, none)
+	tests.Assert(t, reflect.DeepEqual(req, &executors.VolumeQuotaRequest{
+		Volume: "vol1",
+	}), req)
+}
+
+func TestVolumeSetQuota(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	c := client.NewClientNoAuth(ts.URL)
+	tests.Assert(t, c != nil)
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		3,    // nodes_per_cluster
+		1,    // devices_per_node,
+		2*TB, // disksize
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	var created *executors.VolumeQuotaRequest
+	app.xo.MockVolumeCreate = func(host string,
+		volume *executors.VolumeRequest) (*executors.Volume, error) {
+
+		created = volume.Quota
+		return &executors.Volume{}, nil
+	}
+	var set *executors.VolumeQuotaRequest
+	app.xo.MockVolumeSetQuota = func(host string,
+		quota *executors.VolumeQuotaRequest) error {
+
+		set = quota
+		return nil
+	}
+
+	req := &api.VolumeCreateRequest{}
+	req.Size = 10
+	req.Quota.Enable = true
+	req.Quota.Limits = []api.VolumeQuotaLimit{{Path: "/", HardLimitMiB: 1024}}
+	vol, err := c.VolumeCreate(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, reflect.DeepEqual(vol.Quota, req.Quota), vol.Quota)
+	tests.Assert(t, created != nil)
+	tests.Assert(t, created.Volume == vol.Name, created.Volume)
+	tests.Assert(t, created.Enable)
+	tests.Assert(t, len(created.Limits) == 1, created.Limits)
+
+	quota := &api.VolumeQuota{
+		Enable: true,
+		Limits: []api.VolumeQuotaLimit{{Path: "/a", HardLimitMiB: 10}},
+	}
+	info, err := c.VolumeSetQuota(vol.Id, quota)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, reflect.DeepEqual(info.Quota, *quota), info.Quota)
+	tests.Assert(t, !set.Enable && !set.Disable, set)
+	tests.Assert(t, reflect.DeepEqual(set.Remove, []string{"/"}), set.Remove)
+
+	info, err = c.VolumeInfo(vol.Id)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, reflect.DeepEqual(info.Quota, *quota), info.Quota)
+
+	info, err = c.VolumeSetQuota(vol.Id, &api.VolumeQuota{})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, !info.Quota.Enable, info.Quota)
+	tests.Assert(t, set.Disable, set)
+
+	// Volumes without quota do not set it on create
+	created = nil
+	req = &api.VolumeCreateRequest{}
+	req.Size = 10
+	_, err = c.VolumeCreate(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, created == nil, created)
+
+	// Limits require the quota
+	_, err = c.VolumeSetQuota(vol.Id, &api.VolumeQuota{
+		Limits: []api.VolumeQuotaLimit{{Path: "/", HardLimitMiB: 10}},
+	})
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	_, err = c.VolumeSetQuota(vol.Id, &api.VolumeQuota{
+		Enable: true,
+		Limits: []api.VolumeQuotaLimit{{Path: "a", HardLimitMiB: 10}},
+	})
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	_, err = c.VolumeSetQuota(vol.Id, &api.VolumeQuota{
+		Enable: true,
+		Limits: []api.VolumeQuotaLimit{{Path: "/", HardLimitMiB: 0}},
+	})
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	_, err = c.VolumeSetQuota("abc", quota)
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	// Not on block hosting volumes
+	req = &api.VolumeCreateRequest{}
+	req.Size = 10
+	req.Block = true
+	req.Quota.Enable = true
+	_, err = c.VolumeCreate(req)
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	req.Quota.Enable = false
+	bhv, err := c.VolumeCreate(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	_, err = c.VolumeSetQuota(bhv.Id, &api.VolumeQuota{Enable: true})
+	tests.Assert(t, err != nil, "expected err != nil")
+}
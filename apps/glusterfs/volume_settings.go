@@ -0,0 +1,47 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+var (
+	// Default ownership, permissions and SELinux context of the brick
+	// root of new volumes. These are used when the volume create request
+	// does not provide its own values. Zero ids and empty strings leave
+	// the brick root as created.
+	VolumeDefaultUid            int64 = 0
+	VolumeDefaultGid            int64 = 0
+	VolumeDefaultPermissions          = ""
+	VolumeDefaultSelinuxContext       = ""
+
+	// SELinux context of the brick root of the volumes without a
+	// context of their own, in the clusters checking the SELinux labels
+	SelinuxBrickContext = "system_u:object_r:glusterd_brick_t:s0"
+
+	// SELinux booleans turned on in the clusters setting them, which
+	// let containers use the fuse mounts of the volumes
+	SelinuxBooleans = []string{"virt_sandbox_use_fusefs", "virt_use_fusefs"}
+)
+
+// Policies for placing the bricks of a set in different zones
+const (
+	// Zones are not considered, only nodes
+	BrickZonePolicyNone = "none"
+
+	// Bricks of a set are placed in different zones when possible,
+	// otherwise on different nodes of the same zone
+	BrickZonePolicyBestEffort = "best-effort"
+
+	// Bricks of a set are always placed in different zones
+	BrickZonePolicyStrict = "strict"
+)
+
+var (
+	// Default brick zone policy
+	BrickZonePolicy = BrickZonePolicyNone
+)
@@ -0,0 +1,88 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"github.com/boltdb/bolt"
+	wdb "github.com/heketi/heketi/pkg/db"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+)
+
+// simulateBricksInCluster returns the bricks the volume would get in
+// the cluster. Unlike allocBricksInCluster nothing is saved to the db.
+func (v *VolumeEntry) simulateBricksInCluster(db wdb.RODB,
+	allocator Allocator,
+	cluster string,
+	size uint64) ([]*BrickEntry, error) {
+
+	return v.tryBrickSizes(allocatorLogger(allocator), size, func(sets int, brick_size uint64) ([]*BrickEntry, error) {
+		r, err := allocateBricks(db, allocator, cluster, v, sets, brick_size)
+		if err != nil {
+			return nil, err
+		}
+		return r.Bricks, nil
+	})
+}
+
+// SimulateVolumeCreate returns the layout of the bricks that creating
+// the volume would allocate, without saving anything to the db or
+// creating anything on the storage nodes.
+func SimulateVolumeCreate(db wdb.RODB,
+	allocator Allocator,
+	selector *clusterSelector,
+	v *VolumeEntry) (*api.VolumeSimulateResponse, error) {
+
+	possibleClusters, _, err := v.rankedClusters(db, selector)
+	if err != nil {
+		return nil, err
+	}
+
+	bricks, err := v.tryClusters(possibleClusters, func(cluster string) ([]*BrickEntry, error) {
+		return v.simulateBricksInCluster(db, allocator, cluster,
+			uint64(v.sizeMiB())*MB)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &api.VolumeSimulateResponse{
+		Cluster:    v.Info.Cluster,
+		Size:       v.Info.Size,
+		SizeMiB:    v.sizeMiB(),
+		Durability: v.Info.Durability,
+		Bricks:     []api.VolumeSimulateBrick{},
+	}
+	err = db.View(func(tx *bolt.Tx) error {
+		for i, brick := range bricks {
+			node, err := NewNodeEntryFromId(tx, brick.Info.NodeId)
+			if err != nil {
+				return err
+			}
+			device, err := NewDeviceEntryFromId(tx, brick.Info.DeviceId)
+			if err != nil {
+				return err
+			}
+			resp.Bricks = append(resp.Bricks, api.VolumeSimulateBrick{
+				NodeId:     node.Info.Id,
+				Hostname:   node.StorageHostName(),
+				Zone:       node.Info.Zone,
+				DeviceId:   device.Info.Id,
+				DeviceName: device.Info.Name,
+				Set:        i / v.Durability.BricksInSet(),
+				Size:       brick.Info.Size,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
@@ -0,0 +1,93 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/boltdb/bolt"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+)
+
+var (
+	// Used space of a device, in percent, above which a create warns
+	DeviceUsedWarningPercent uint64 = 90
+)
+
+// volumeCreateWarnings returns the non-fatal issues of the bricks just
+// allocated to the volume: bricks of a set in fewer zones than the set
+// size, devices filled above DeviceUsedWarningPercent, nodes left out
+// because they were unreachable and replica 2 without an arbiter.
+func volumeCreateWarnings(tx *bolt.Tx,
+	v *VolumeEntry,
+	bricks []*BrickEntry) ([]api.Warning, error) {
+
+	warnings := []api.Warning{}
+
+	setSize := v.Durability.BricksInSet()
+	zones := map[int]bool{}
+	devices := map[string]bool{}
+	for _, brick := range bricks {
+		node, err := NewNodeEntryFromId(tx, brick.Info.NodeId)
+		if err != nil {
+			return nil, err
+		}
+		zones[node.Info.Zone] = true
+		devices[brick.Info.DeviceId] = true
+	}
+	if setSize > 1 && len(zones) < setSize {
+		warnings = append(warnings, api.Warning{
+			Type: api.WarningFewZones,
+			Message: fmt.Sprintf("volume spans only %v zones for sets of %v bricks",
+				len(zones), setSize),
+		})
+	}
+
+	ids := make([]string, 0, len(devices))
+	for id := range devices {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		device, err := NewDeviceEntryFromId(tx, id)
+		if err != nil {
+			return nil, err
+		}
+		storage := device.Info.Storage
+		if storage.Total == 0 ||
+			storage.Used*100 <= storage.Total*DeviceUsedWarningPercent {
+			continue
+		}
+		warnings = append(warnings, api.Warning{
+			Type: api.WarningDeviceFull,
+			Message: fmt.Sprintf("device %v above %v%% after this allocation",
+				device.Info.Id, DeviceUsedWarningPercent),
+		})
+	}
+
+	if w, err := unreachableNodesWarning(tx, v); err != nil {
+		return nil, err
+	} else if w != nil {
+		warnings = append(warnings, *w)
+	}
+
+	if v.Info.Durability.Type == api.DurabilityReplicate && setSize == 2 {
+		warnings = append(warnings, api.Warning{
+			Type:    api.WarningNoArbiter,
+			Message: "replica 2 without arbiter is prone to split-brain",
+		})
+	}
+
+	if len(warnings) == 0 {
+		return nil, nil
+	}
+	return warnings, nil
+}
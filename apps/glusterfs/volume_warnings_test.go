@@ -0,0 +1,157 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gorilla/mux"
+	client "github.com/heketi/heketi/client/api/go-client"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/tests"
+)
+
+func warningTypes(warnings []api.Warning) map[string]int {
+	types := map[string]int{}
+	for _, w := range warnings {
+		types[w.Type]++
+	}
+	return types
+}
+
+func TestVolumeCreateWarnings(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	c := client.NewClientNoAuth(ts.URL)
+	tests.Assert(t, c != nil)
+
+	// Three nodes in two zones
+	err := setupSampleDbWithTopology(app,
+		1,      // clusters
+		3,      // nodes_per_cluster
+		1,      // devices_per_node,
+		100*GB, // disksize
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// Nothing to warn about
+	req := &api.VolumeCreateRequest{}
+	req.Size = 1
+	req.Durability.Type = api.DurabilityDistributeOnly
+	req.Durability.Replicate.Replica = 2
+	vol, err := c.VolumeCreate(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(vol.Warnings) == 0, vol.Warnings)
+
+	// Replica 2, its bricks may share a zone
+	req.Durability.Type = api.DurabilityReplicate
+	vol, err = c.VolumeCreate(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	types := warningTypes(vol.Warnings)
+	tests.Assert(t, types[api.WarningNoArbiter] == 1, vol.Warnings)
+	tests.Assert(t, types[api.WarningDeviceFull] == 0, vol.Warnings)
+
+	// Replica 3 in two zones filling the devices
+	req.Size = 95
+	req.Durability.Replicate.Replica = 3
+	vol, err = c.VolumeCreate(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	types = warningTypes(vol.Warnings)
+	tests.Assert(t, len(types) == 2, vol.Warnings)
+	tests.Assert(t, types[api.WarningFewZones] == 1, vol.Warnings)
+	tests.Assert(t, types[api.WarningDeviceFull] == 3, vol.Warnings)
+
+	// The warnings are kept with the volume
+	info, err := c.VolumeInfo(vol.Id)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(info.Warnings) == len(vol.Warnings), info.Warnings)
+}
+
+func TestVolumeCreateUnreachableNode(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	c := client.NewClientNoAuth(ts.URL)
+	tests.Assert(t, c != nil)
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		4,    // nodes_per_cluster
+		1,    // devices_per_node,
+		1*TB, // disksize
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	topology, err := c.TopologyInfo()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	down := topology.ClusterList[0].Nodes[0]
+	app.xo.MockGlusterdCheck = func(host string) error {
+		if host == down.Hostnames.Manage[0] {
+			return fmt.Errorf("connection refused")
+		}
+		return nil
+	}
+
+	// Replica 3 fits on the three other nodes
+	req := &api.VolumeCreateRequest{}
+	req.Size = 10
+	req.Durability.Type = api.DurabilityReplicate
+	req.Durability.Replicate.Replica = 3
+	for i := 0; i < 4; i++ {
+		vol, err := c.VolumeCreate(req)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		types := warningTypes(vol.Warnings)
+		tests.Assert(t, types[api.WarningNodesUnreachable] == 1, vol.Warnings)
+		for _, brick := range vol.Bricks {
+			tests.Assert(t, brick.NodeId != down.Id, brick)
+		}
+	}
+
+	// Sets of four bricks can not be placed without the node
+	req.Durability.Type = api.DurabilityEC
+	req.Durability.Disperse.Data = 2
+	req.Durability.Disperse.Redundancy = 1
+	_, err = c.VolumeCreate(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	req.Durability.Disperse.Data = 4
+	req.Durability.Disperse.Redundancy = 2
+	_, err = c.VolumeCreate(req)
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	// No warning once the node is back
+	app.xo.MockGlusterdCheck = func(host string) error {
+		return nil
+	}
+	req.Durability.Type = api.DurabilityReplicate
+	vol, err := c.VolumeCreate(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	types := warningTypes(vol.Warnings)
+	tests.Assert(t, types[api.WarningNodesUnreachable] == 0, vol.Warnings)
+}
@@ -0,0 +1,233 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/heketi/pkg/utils"
+)
+
+var (
+	// Retries of an event the endpoint failed to receive, waiting
+	// twice as long before each retry
+	WebhookRetries    = 3
+	WebhookRetryDelay = 5 * time.Second
+
+	// Time an endpoint has to answer
+	WebhookTimeout = 10 * time.Second
+
+	// Events waiting to be posted. The events raised while the queue
+	// is full are dropped.
+	WebhookQueueSize = 100
+)
+
+// WebhookConfig is an endpoint the events are posted to
+type WebhookConfig struct {
+	Url string `json:"url"`
+	// Key of the HMAC-SHA256 signature of the events, if any
+	Secret string `json:"secret"`
+	// Types of the events posted to the endpoint. Empty posts every
+	// event.
+	Events []string `json:"events"`
+}
+
+func (h *WebhookConfig) wants(eventType string) bool {
+	if len(h.Events) == 0 {
+		return true
+	}
+	for _, t := range h.Events {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+func validWebhook(h *WebhookConfig) error {
+	u, err := url.Parse(h.Url)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported url %v", h.Url)
+	}
+	for _, t := range h.Events {
+		switch t {
+		case api.EventVolumeCreated, api.EventVolumeDeletePending,
+			api.EventBrickReplaced, api.EventDeviceFailed, api.EventNoSpace:
+		default:
+			return fmt.Errorf("unknown event %v", t)
+		}
+	}
+	return nil
+}
+
+// webhookSignature returns the signature of the body of an event
+func webhookSignature(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookNotifier posts the events to the endpoints, one event at a
+// time, so that each endpoint receives them in order
+type webhookNotifier struct {
+	hooks  []WebhookConfig
+	client *http.Client
+	queue  chan *api.Event
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+func newWebhookNotifier(hooks []WebhookConfig) *webhookNotifier {
+	n := &webhookNotifier{
+		hooks:  hooks,
+		client: &http.Client{Timeout: WebhookTimeout},
+		queue:  make(chan *api.Event, WebhookQueueSize),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go n.run()
+	return n
+}
+
+// notify queues the event without waiting for it to be posted
+func (n *webhookNotifier) notify(e *api.Event) {
+	select {
+	case n.queue <- e:
+	default:
+		logger.Warning("Webhook queue full, dropped event %v %v",
+			e.Type, e.ObjectId)
+	}
+}
+
+// close stops posting the events. The events still queued are dropped.
+func (n *webhookNotifier) close() {
+	close(n.stop)
+	<-n.done
+}
+
+func (n *webhookNotifier) run() {
+	defer close(n.done)
+	for {
+		select {
+		case <-n.stop:
+			return
+		case e := <-n.queue:
+			body, err := json.Marshal(e)
+			if err != nil {
+				logger.LogError("Unable to encode event %v: %v", e.Id, err)
+				continue
+			}
+			for i := range n.hooks {
+				if n.hooks[i].wants(e.Type) {
+					n.deliver(&n.hooks[i], e, body)
+				}
+			}
+		}
+	}
+}
+
+// deliver posts the event to the endpoint, retrying while it fails
+func (n *webhookNotifier) deliver(h *WebhookConfig, e *api.Event, body []byte) {
+	delay := WebhookRetryDelay
+	for attempt := 0; ; attempt++ {
+		err := n.post(h, e, body)
+		if err == nil {
+			logger.Debug("Posted event %v to %v", e.Id, h.Url)
+			return
+		}
+		if attempt >= WebhookRetries {
+			logger.LogError("Unable to post event %v to %v: %v",
+				e.Id, h.Url, err)
+			return
+		}
+		logger.Warning("Unable to post event %v to %v, retrying in %v: %v",
+			e.Id, h.Url, delay, err)
+		select {
+		case <-n.stop:
+			return
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+func (n *webhookNotifier) post(h *WebhookConfig, e *api.Event, body []byte) error {
+	req, err := http.NewRequest("POST", h.Url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(api.HeaderEventType, e.Type)
+	if h.Secret != "" {
+		req.Header.Set(api.HeaderEventSignature, webhookSignature(h.Secret, body))
+	}
+
+	r, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+	io.Copy(ioutil.Discard, r.Body)
+	if r.StatusCode < 200 || r.StatusCode >= 300 {
+		return fmt.Errorf("endpoint returned %v", r.Status)
+	}
+	return nil
+}
+
+// setWebhooks starts posting the events to the endpoints of the
+// configuration. Invalid endpoints are logged and ignored.
+func (a *App) setWebhooks() {
+	hooks := []WebhookConfig{}
+	for _, h := range a.conf.Webhooks {
+		if err := validWebhook(&h); err != nil {
+			logger.LogError("Ignoring webhook %v: %v", h.Url, err)
+			continue
+		}
+		logger.Info("Adv: Posting events to %v", h.Url)
+		hooks = append(hooks, h)
+	}
+	if len(hooks) > 0 {
+		a.webhooks = newWebhookNotifier(hooks)
+	}
+}
+
+// notify adds an event to the event feed and posts it to the webhooks,
+// if any. The tenant is the tenant of the volume the event is about, if
+// any, whose users see the event in the feed.
+func (a *App) notify(eventType, objectId, tenant, message string) {
+	e := api.Event{
+		Id:       utils.GenUUID(),
+		Type:     eventType,
+		Time:     time.Now().Unix(),
+		ObjectId: objectId,
+		Tenant:   tenant,
+		Message:  message,
+	}
+	if a.events != nil {
+		a.events.add(e)
+	}
+	if a.webhooks != nil {
+		a.webhooks.notify(&e)
+	}
+}
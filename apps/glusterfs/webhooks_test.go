@@ -0,0 +1,163 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	client "github.com/heketi/heketi/client/api/go-client"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/tests"
+)
+
+// webhookReceiver keeps the events posted to it, failing the first
+// posts
+type webhookReceiver struct {
+	lock     sync.Mutex
+	failures int
+	posts    int
+	events   chan *api.Event
+	secret   string
+	badSigs  int
+}
+
+func (h *webhookReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.posts++
+	if h.posts <= h.failures {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	body, _ := ioutil.ReadAll(r.Body)
+	if r.Header.Get(api.HeaderEventSignature) != webhookSignature(h.secret, body) {
+		h.badSigs++
+	}
+	e := &api.Event{}
+	if err := json.Unmarshal(body, e); err != nil ||
+		r.Header.Get(api.HeaderEventType) != e.Type {
+		http.Error(w, "bad event", http.StatusBadRequest)
+		return
+	}
+	h.events <- e
+}
+
+func (h *webhookReceiver) next(t *testing.T) *api.Event {
+	select {
+	case e := <-h.events:
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event received")
+	}
+	return nil
+}
+
+func TestWebhookRetries(t *testing.T) {
+	defer func(d time.Duration) {
+		WebhookRetryDelay = d
+	}(WebhookRetryDelay)
+	WebhookRetryDelay = time.Millisecond
+
+	h := &webhookReceiver{
+		failures: 2,
+		events:   make(chan *api.Event, 10),
+		secret:   "s3cret",
+	}
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	n := newWebhookNotifier([]WebhookConfig{
+		{Url: ts.URL, Secret: h.secret},
+		// Not receiving the events of the test
+		{Url: ts.URL + "/other", Events: []string{api.EventNoSpace}},
+	})
+	defer n.close()
+
+	n.notify(&api.Event{Id: "e1", Type: api.EventDeviceFailed, ObjectId: "d1"})
+	n.notify(&api.Event{Id: "e2", Type: api.EventBrickReplaced, ObjectId: "b1"})
+
+	// The events are posted in order once the endpoint recovers
+	e := h.next(t)
+	tests.Assert(t, e.Id == "e1" && e.ObjectId == "d1", e)
+	e = h.next(t)
+	tests.Assert(t, e.Id == "e2" && e.Type == api.EventBrickReplaced, e)
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	tests.Assert(t, h.posts == 4, h.posts)
+	tests.Assert(t, h.badSigs == 0, h.badSigs)
+}
+
+func TestWebhookValidate(t *testing.T) {
+	tests.Assert(t, validWebhook(&WebhookConfig{Url: "https://example.com/x"}) == nil)
+	tests.Assert(t, validWebhook(&WebhookConfig{Url: "ftp://example.com"}) != nil)
+	tests.Assert(t, validWebhook(&WebhookConfig{
+		Url:    "http://example.com",
+		Events: []string{api.EventVolumeCreated, "volume_deleted"},
+	}) != nil)
+}
+
+func TestWebhookEvents(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	c := client.NewClientNoAuth(ts.URL)
+	tests.Assert(t, c != nil)
+
+	h := &webhookReceiver{events: make(chan *api.Event, 10)}
+	hs := httptest.NewServer(h)
+	defer hs.Close()
+	app.webhooks = newWebhookNotifier([]WebhookConfig{{Url: hs.URL}})
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		3,    // nodes_per_cluster
+		2,    // devices_per_node,
+		2*TB, // disksize
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	req := &api.VolumeCreateRequest{}
+	req.Size = 10
+	req.Durability.Type = api.DurabilityReplicate
+	req.Durability.Replicate.Replica = 3
+	vol, err := c.VolumeCreate(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	e := h.next(t)
+	tests.Assert(t, e.Type == api.EventVolumeCreated, e)
+	tests.Assert(t, e.ObjectId == vol.Id, e)
+	tests.Assert(t, e.Id != "" && e.Time != 0, e)
+
+	req.Size = 100 * 1024
+	_, err = c.VolumeCreate(req)
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	e = h.next(t)
+	tests.Assert(t, e.Type == api.EventNoSpace, e)
+}
@@ -0,0 +1,321 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/heketi/heketi/executors"
+	wdb "github.com/heketi/heketi/pkg/db"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+)
+
+var (
+	// Default maximum number of bricks moved by a zone rebalance
+	ZoneRebalanceMaxMoves = 20
+)
+
+// zoneBrickSet is a replica or disperse set of bricks of a volume with
+// the zones of the bricks, which follow the planned moves
+type zoneBrickSet struct {
+	volume *VolumeEntry
+	index  int
+	bricks []*BrickEntry
+	zones  []int
+	before []int
+}
+
+// spread returns the number of zones the bricks of the set are in
+func (s *zoneBrickSet) spread() int {
+	zones := map[int]bool{}
+	for _, z := range s.zones {
+		zones[z] = true
+	}
+	return len(zones)
+}
+
+// ClusterZonePlan holds the brick moves spreading the bricks of each
+// set of the volumes of a cluster over as many zones as the set has
+// bricks, or over every zone if there are fewer zones than bricks
+type ClusterZonePlan struct {
+	clusterId string
+	zones     map[int]bool
+	devices   []*rebalanceDevice
+	// Zone of each online device
+	deviceZones map[string]int
+
+	sets    []*zoneBrickSet
+	skipped []string
+
+	planned []*plannedBrickReplacement
+	// Destination device of each planned move
+	destinations []string
+}
+
+// desired returns the number of zones the set should span
+func (p *ClusterZonePlan) desired(s *zoneBrickSet) int {
+	if len(s.bricks) < len(p.zones) {
+		return len(s.bricks)
+	}
+	return len(p.zones)
+}
+
+func (p *ClusterZonePlan) violates(s *zoneBrickSet) bool {
+	return s.spread() < p.desired(s)
+}
+
+// loadZoneSets gathers the online devices of the online nodes of the
+// cluster, with their zones, and the sets of bricks of the volumes of
+// the cluster that are spread over too few zones
+func (p *ClusterZonePlan) loadZoneSets(tx *bolt.Tx) error {
+	cluster, err := NewClusterEntryFromId(tx, p.clusterId)
+	if err != nil {
+		return err
+	}
+
+	nodeZones := map[string]int{}
+	for _, nodeId := range cluster.Info.Nodes {
+		node, err := NewNodeEntryFromId(tx, nodeId)
+		if err != nil {
+			return err
+		}
+		nodeZones[nodeId] = node.Info.Zone
+		if !node.isOnline() {
+			continue
+		}
+		for _, deviceId := range node.Devices {
+			device, err := NewDeviceEntryFromId(tx, deviceId)
+			if err != nil {
+				return err
+			}
+			if !device.isOnline() {
+				continue
+			}
+			p.devices = append(p.devices, &rebalanceDevice{device: device})
+			p.deviceZones[deviceId] = node.Info.Zone
+			p.zones[node.Info.Zone] = true
+		}
+	}
+
+	for _, volumeId := range cluster.Info.Volumes {
+		v, err := NewVolumeEntryFromId(tx, volumeId)
+		if err != nil {
+			return err
+		}
+		if v.Info.Durability.Type == api.DurabilityDistributeOnly {
+			continue
+		}
+		order := v.brickOrder()
+		if order == nil {
+			p.skipped = append(p.skipped, volumeId)
+			continue
+		}
+
+		setSize := v.Durability.BricksInSet()
+		for start := 0; start < len(order); start += setSize {
+			end := start + setSize
+			if end > len(order) {
+				end = len(order)
+			}
+			s := &zoneBrickSet{volume: v, index: start / setSize}
+			for _, brickId := range order[start:end] {
+				brick, err := NewBrickEntryFromId(tx, brickId)
+				if err != nil {
+					return err
+				}
+				s.bricks = append(s.bricks, brick)
+				s.zones = append(s.zones, nodeZones[brick.Info.NodeId])
+			}
+			s.before = append([]int{}, s.zones...)
+			if p.violates(s) {
+				p.sets = append(p.sets, s)
+			}
+		}
+	}
+	return nil
+}
+
+// planSetMove plans the move of a brick of the set sharing its zone
+// with another brick of the set to the least utilized device of a zone
+// without bricks of the set. Only one brick of a set is moved by a
+// rebalance so that the set never has more than one healing brick.
+// It returns false if no brick of the set can be moved.
+func (p *ClusterZonePlan) planSetMove(db wdb.DB,
+	executor executors.Executor,
+	s *zoneBrickSet) bool {
+
+	counts := map[int]int{}
+	for _, z := range s.zones {
+		counts[z]++
+	}
+	dests := []*rebalanceDevice{}
+	for _, d := range p.devices {
+		if counts[p.deviceZones[d.device.Info.Id]] == 0 {
+			dests = append(dests, d)
+		}
+	}
+	sort.Slice(dests, func(i, j int) bool {
+		return dests[i].utilization() < dests[j].utilization()
+	})
+
+	for i, brick := range s.bricks {
+		if counts[s.zones[i]] < 2 || brick.Info.Path == "" {
+			continue
+		}
+		size := brick.TotalSize()
+
+		var r *brickReplacement
+		for _, dst := range dests {
+			if !dst.device.StorageCheck(size) {
+				continue
+			}
+
+			// Only check with the storage nodes that the brick can be
+			// replaced once a destination with room was found
+			if r == nil {
+				var err error
+				r, err = s.volume.prepareBrickReplace(db, executor, brick.Info.Id)
+				if err != nil {
+					logger.Warning("Unable to move brick %v: %v", brick.Info.Id, err)
+					break
+				}
+			}
+			if !r.deviceOk(dst.device) {
+				continue
+			}
+
+			zone := p.deviceZones[dst.device.Info.Id]
+			logger.Debug("Planning move of brick %v from zone %v to device %v in zone %v",
+				brick.Info.Id, s.zones[i], dst.device.Info.Id, zone)
+			p.planned = append(p.planned, &plannedBrickReplacement{
+				brickReplacement: r,
+				volume:           s.volume,
+			})
+			p.destinations = append(p.destinations, dst.device.Info.Id)
+			dst.device.StorageAllocate(size)
+			s.zones[i] = zone
+			return true
+		}
+	}
+	return false
+}
+
+// PlanClusterZoneRebalance reports the sets of bricks of the volumes of
+// the cluster spread over fewer zones than they could be, as happens
+// once zones are added to a cluster, and plans the brick moves spreading
+// them, moving at most maxMoves bricks. A set needing more than one
+// move gets the next one from a later rebalance, once the moved brick
+// healed. Nothing is reserved until the plan is executed.
+func PlanClusterZoneRebalance(db wdb.DB,
+	executor executors.Executor,
+	clusterId string,
+	maxMoves int) (*ClusterZonePlan, error) {
+
+	p := &ClusterZonePlan{
+		clusterId:   clusterId,
+		zones:       map[int]bool{},
+		deviceZones: map[string]int{},
+	}
+	err := db.View(func(tx *bolt.Tx) error {
+		return p.loadZoneSets(tx)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, s := range p.sets {
+		if len(p.planned) >= maxMoves {
+			break
+		}
+		if !p.planSetMove(db, executor, s) {
+			logger.Info("No brick of set %v of volume %v can be moved to another zone",
+				s.index, s.volume.Info.Id)
+		}
+	}
+	return p, nil
+}
+
+// Remaining returns the number of sets still spread over too few zones
+// once the planned moves are done
+func (p *ClusterZonePlan) Remaining() int {
+	remaining := 0
+	for _, s := range p.sets {
+		if p.violates(s) {
+			remaining++
+		}
+	}
+	return remaining
+}
+
+// Response returns the report and the plan as sent to the client
+func (p *ClusterZonePlan) Response() *api.ClusterZoneRebalanceResponse {
+	resp := &api.ClusterZoneRebalanceResponse{
+		Id:         p.clusterId,
+		Zones:      len(p.zones),
+		Violations: []api.ZoneSpreadViolation{},
+		Moves:      []api.ClusterZoneRebalanceMove{},
+		Remaining:  p.Remaining(),
+		Skipped:    append([]string{}, p.skipped...),
+	}
+	resp.Balanced = resp.Remaining == 0
+	for _, s := range p.sets {
+		violation := api.ZoneSpreadViolation{
+			VolumeId: s.volume.Info.Id,
+			Set:      s.index,
+			Zones:    s.before,
+			Desired:  p.desired(s),
+		}
+		for _, b := range s.bricks {
+			violation.Bricks = append(violation.Bricks, b.Info.Id)
+		}
+		resp.Violations = append(resp.Violations, violation)
+	}
+	for i, planned := range p.planned {
+		resp.Moves = append(resp.Moves, api.ClusterZoneRebalanceMove{
+			ClusterRebalanceMove: api.ClusterRebalanceMove{
+				BrickId:  planned.oldBrick.Info.Id,
+				VolumeId: planned.volume.Info.Id,
+				From:     planned.oldDevice.Info.Id,
+				To:       p.destinations[i],
+				Size:     planned.oldBrick.TotalSize(),
+			},
+			FromZone: planned.oldNode.Info.Zone,
+			ToZone:   p.deviceZones[p.destinations[i]],
+		})
+	}
+	return resp
+}
+
+// Execute reserves the storage of all the destinations of the plan,
+// then replaces the bricks one at a time, waiting for the interval
+// between two replaces. A failed replace does not stop the others.
+func (p *ClusterZonePlan) Execute(db wdb.DB,
+	executor executors.Executor,
+	interval time.Duration) error {
+
+	if len(p.planned) == 0 {
+		return nil
+	}
+
+	failed, err := executeMoves(db, executor, p.planned, p.destinations,
+		interval)
+	if err != nil {
+		return logger.Err(err)
+	}
+	if len(failed) != 0 {
+		return fmt.Errorf("Failed to move %v of %v bricks across the zones of cluster %v: %v",
+			len(failed), len(p.planned), p.clusterId, strings.Join(failed, "; "))
+	}
+	return nil
+}
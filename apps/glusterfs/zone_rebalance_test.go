@@ -0,0 +1,171 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/gorilla/mux"
+	client "github.com/heketi/heketi/client/api/go-client"
+	"github.com/heketi/heketi/executors"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/tests"
+)
+
+func TestClusterZoneRebalance(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	c := client.NewClientNoAuth(ts.URL)
+	tests.Assert(t, c != nil)
+
+	err := setupSampleDbWithTopology(app,
+		1,      // clusters
+		5,      // nodes_per_cluster
+		1,      // devices_per_node,
+		500*GB, // disksize
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	var clusterId string
+	setZones := func(zone func(n *NodeEntry) int) {
+		err := app.db.Update(func(tx *bolt.Tx) error {
+			cl, err := ClusterList(tx)
+			tests.Assert(t, err == nil)
+			clusterId = cl[0]
+			nodes, err := NodeList(tx)
+			tests.Assert(t, err == nil)
+			for _, id := range nodes {
+				n, err := NewNodeEntryFromId(tx, id)
+				tests.Assert(t, err == nil)
+				n.Info.Zone = zone(n)
+				tests.Assert(t, n.Save(tx) == nil)
+			}
+			return nil
+		})
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	}
+
+	// The volume is created while the cluster has a single zone
+	setZones(func(n *NodeEntry) int { return 1 })
+	vreq := &api.VolumeCreateRequest{}
+	vreq.Size = 100
+	vreq.Durability.Type = api.DurabilityReplicate
+	vreq.Durability.Replicate.Replica = 3
+	vol, err := c.VolumeCreate(vreq)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(vol.Bricks) == 3, vol.Bricks)
+
+	app.xo.MockVolumeInfo = func(host string, volume string) (*executors.Volume, error) {
+		return mockVolumeInfoFromDb(app.db, volume)
+	}
+	app.xo.MockHealInfo = func(host string, volume string) (*executors.HealInfo, error) {
+		return mockHealStatusFromDb(app.db, volume)
+	}
+
+	// Then the nodes without bricks are moved to new zones
+	zone := 1
+	setZones(func(n *NodeEntry) int {
+		if len(n.Devices) == 0 {
+			return 1
+		}
+		for _, b := range vol.Bricks {
+			if b.NodeId == n.Info.Id {
+				return 1
+			}
+		}
+		zone++
+		return zone
+	})
+
+	req := &api.ClusterZoneRebalanceRequest{}
+	plan, err := c.ClusterZoneRebalancePlan(clusterId, req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, plan.Id == clusterId)
+	tests.Assert(t, plan.Zones == 3, plan.Zones)
+	tests.Assert(t, len(plan.Violations) == 1, plan.Violations)
+	v := plan.Violations[0]
+	tests.Assert(t, v.VolumeId == vol.Id && v.Set == 0, v)
+	tests.Assert(t, len(v.Bricks) == 3 && v.Desired == 3, v)
+	for _, z := range v.Zones {
+		tests.Assert(t, z == 1, v.Zones)
+	}
+
+	// Only one brick of the set moves at a time
+	tests.Assert(t, len(plan.Moves) == 1, plan.Moves)
+	m := plan.Moves[0]
+	tests.Assert(t, m.VolumeId == vol.Id, m)
+	tests.Assert(t, m.FromZone == 1 && m.ToZone > 1, m)
+	tests.Assert(t, plan.Remaining == 1, plan.Remaining)
+	tests.Assert(t, !plan.Balanced)
+
+	// Nothing is reserved by planning
+	app.db.View(func(tx *bolt.Tx) error {
+		d, err := NewDeviceEntryFromId(tx, m.To)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, len(d.Bricks) == 0, d.Bricks)
+		return nil
+	})
+
+	// Each rebalance moves a brick of the set to a new zone
+	for i := 0; i < 2; i++ {
+		err = c.ClusterZoneRebalance(clusterId, req)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	}
+	plan, err = c.ClusterZoneRebalancePlan(clusterId, req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(plan.Violations) == 0, plan.Violations)
+	tests.Assert(t, len(plan.Moves) == 0, plan.Moves)
+	tests.Assert(t, plan.Balanced)
+
+	info, err := c.VolumeInfo(vol.Id)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(info.Bricks) == 3, info.Bricks)
+	app.db.View(func(tx *bolt.Tx) error {
+		zones := map[int]bool{}
+		for _, b := range info.Bricks {
+			n, err := NewNodeEntryFromId(tx, b.NodeId)
+			tests.Assert(t, err == nil)
+			zones[n.Info.Zone] = true
+		}
+		tests.Assert(t, len(zones) == 3, zones)
+		return nil
+	})
+
+	// Volumes without a recorded order of their bricks are skipped
+	app.db.Update(func(tx *bolt.Tx) error {
+		v, err := NewVolumeEntryFromId(tx, vol.Id)
+		tests.Assert(t, err == nil)
+		v.BrickOrder = nil
+		return v.Save(tx)
+	})
+	plan, err = c.ClusterZoneRebalancePlan(clusterId, req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(plan.Skipped) == 1 && plan.Skipped[0] == vol.Id,
+		plan.Skipped)
+
+	_, err = c.ClusterZoneRebalancePlan("12345", req)
+	tests.Assert(t, err != nil)
+
+	_, err = c.ClusterZoneRebalancePlan(clusterId,
+		&api.ClusterZoneRebalanceRequest{MaxMoves: -1})
+	tests.Assert(t, err != nil)
+}
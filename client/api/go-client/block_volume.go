@@ -25,6 +25,15 @@ import (
 func (c *Client) BlockVolumeCreate(request *api.BlockVolumeCreateRequest) (
 	*api.BlockVolumeInfoResponse, error) {
 
+	return c.BlockVolumeCreateWithKey(request, "")
+}
+
+// BlockVolumeCreateWithKey creates a block volume with the idempotency
+// key. The request repeated with the same key returns the block volume
+// created by the first one instead of creating another block volume.
+func (c *Client) BlockVolumeCreateWithKey(request *api.BlockVolumeCreateRequest,
+	idempotencyKey string) (*api.BlockVolumeInfoResponse, error) {
+
 	buffer, err := json.Marshal(request)
 	if err != nil {
 		return nil, err
@@ -37,6 +46,9 @@ func (c *Client) BlockVolumeCreate(request *api.BlockVolumeCreateRequest) (
 		return nil, err
 	}
 	req.Header.Set("Content-Type", "application/json")
+	if idempotencyKey != "" {
+		req.Header.Set(api.IdempotencyKeyHeader, idempotencyKey)
+	}
 
 	err = c.setToken(req)
 	if err != nil {
@@ -71,7 +83,16 @@ func (c *Client) BlockVolumeCreate(request *api.BlockVolumeCreateRequest) (
 }
 
 func (c *Client) BlockVolumeList() (*api.BlockVolumeListResponse, error) {
-	req, err := http.NewRequest("GET", c.host+"/blockvolumes", nil)
+	return c.BlockVolumeListWithOptions(nil)
+}
+
+// BlockVolumeListWithOptions returns the page of the block volumes
+// matching the filters of the options
+func (c *Client) BlockVolumeListWithOptions(opts *api.ListOptions) (
+	*api.BlockVolumeListResponse, error) {
+
+	req, err := http.NewRequest("GET",
+		listPath(c.host+"/blockvolumes", opts), nil)
 	if err != nil {
 		return nil, err
 	}
@@ -158,3 +179,213 @@ func (c *Client) BlockVolumeDelete(id string) error {
 
 	return nil
 }
+
+func (c *Client) BlockVolumeExpand(id string,
+	request *api.BlockVolumeExpandRequest) (*api.BlockVolumeInfoResponse, error) {
+
+	buffer, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("PUT",
+		c.host+"/blockvolumes/"+id+"/expand",
+		bytes.NewBuffer(buffer))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	err = c.setToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusAccepted {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	r, err = c.waitForResponseWithTimer(r, time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if r.StatusCode != http.StatusOK {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	var blockvolume api.BlockVolumeInfoResponse
+	err = utils.GetJsonFromResponse(r, &blockvolume)
+	if err != nil {
+		return nil, err
+	}
+
+	return &blockvolume, nil
+}
+
+func (c *Client) BlockVolumeClone(id string,
+	request *api.BlockVolumeCloneRequest) (*api.BlockVolumeInfoResponse, error) {
+
+	buffer, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST",
+		c.host+"/blockvolumes/"+id+"/clone",
+		bytes.NewBuffer(buffer))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	err = c.setToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusAccepted {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	r, err = c.waitForResponseWithTimer(r, time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if r.StatusCode != http.StatusOK {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	var blockvolume api.BlockVolumeInfoResponse
+	err = utils.GetJsonFromResponse(r, &blockvolume)
+	if err != nil {
+		return nil, err
+	}
+
+	return &blockvolume, nil
+}
+
+func (c *Client) BlockVolumeReconcile(request *api.BlockVolumeReconcileRequest) (
+	*api.BlockVolumeReconcileResponse, error) {
+
+	buffer, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST",
+		c.host+"/blockvolumes/reconcile",
+		bytes.NewBuffer(buffer))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	err = c.setToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusAccepted {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	r, err = c.waitForResponseWithTimer(r, time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if r.StatusCode != http.StatusOK {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	var reconcile api.BlockVolumeReconcileResponse
+	err = utils.GetJsonFromResponse(r, &reconcile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &reconcile, nil
+}
+
+func (c *Client) BlockVolumeAuthRotate(id string) (*api.BlockVolumeInfoResponse, error) {
+	req, err := http.NewRequest("POST",
+		c.host+"/blockvolumes/"+id+"/auth/rotate", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.setToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	var blockvolume api.BlockVolumeInfoResponse
+	err = utils.GetJsonFromResponse(r, &blockvolume)
+	if err != nil {
+		return nil, err
+	}
+
+	return &blockvolume, nil
+}
+
+func (c *Client) BlockVolumeHaCount(id string,
+	request *api.BlockVolumeHaCountRequest) (*api.BlockVolumeInfoResponse, error) {
+
+	buffer, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST",
+		c.host+"/blockvolumes/"+id+"/hacount",
+		bytes.NewBuffer(buffer))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	err = c.setToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	var blockvolume api.BlockVolumeInfoResponse
+	err = utils.GetJsonFromResponse(r, &blockvolume)
+	if err != nil {
+		return nil, err
+	}
+
+	return &blockvolume, nil
+}
@@ -0,0 +1,198 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), as published by the Free Software Foundation,
+// or under the Apache License, Version 2.0 <LICENSE-APACHE2 or
+// http://www.apache.org/licenses/LICENSE-2.0>.
+//
+// You may not use this file except in compliance with those terms.
+//
+
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/heketi/pkg/utils"
+)
+
+// BrickList returns the page of the bricks matching the filters of the
+// options, all the bricks if opts is nil
+func (c *Client) BrickList(opts *api.ListOptions) (*api.BrickListResponse, error) {
+
+	// Create request
+	req, err := http.NewRequest("GET", listPath(c.host+"/bricks", opts), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get info
+	r, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	// Read JSON response
+	var bricks api.BrickListResponse
+	err = utils.GetJsonFromResponse(r, &bricks)
+	if err != nil {
+		return nil, err
+	}
+
+	return &bricks, nil
+}
+
+// BrickReplace replaces the brick with a new brick on another device
+// and returns the information of the volume of the brick
+func (c *Client) BrickReplace(id string) (*api.VolumeInfoResponse, error) {
+	return c.BrickReplaceTo(id, nil)
+}
+
+// BrickReplaceTo replaces the brick like BrickReplace with a new brick
+// on the destination, if set
+func (c *Client) BrickReplaceTo(id string,
+	dest *api.BrickDestination) (*api.VolumeInfoResponse, error) {
+
+	return c.brickReplace(destinationPath("/bricks/"+id+"/replace", dest))
+}
+
+// BrickReplaceWaitHeal replaces the brick like BrickReplaceTo and returns
+// once no entries of the volume are pending heal. It fails if the volume
+// did not heal in timeout seconds, 0 for the timeout of the server.
+func (c *Client) BrickReplaceWaitHeal(id string,
+	dest *api.BrickDestination,
+	timeout int) (*api.VolumeInfoResponse, error) {
+
+	query := destinationQuery(dest)
+	query.Set("wait_for_heal", "true")
+	if timeout > 0 {
+		query.Set("heal_timeout", strconv.Itoa(timeout))
+	}
+	return c.brickReplace("/bricks/" + id + "/replace?" + query.Encode())
+}
+
+func (c *Client) brickReplace(path string) (*api.VolumeInfoResponse, error) {
+
+	// Create a request
+	req, err := http.NewRequest("POST", c.host+path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Send request
+	r, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusAccepted {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	// Wait for response
+	r, err = c.waitForResponseWithTimer(r, time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if r.StatusCode != http.StatusOK {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	// Read JSON response
+	var volume api.VolumeInfoResponse
+	err = utils.GetJsonFromResponse(r, &volume)
+	if err != nil {
+		return nil, err
+	}
+
+	return &volume, nil
+}
+
+// destinationPath returns the path of a replace request with the
+// destination of the new bricks in its query
+func destinationPath(path string, dest *api.BrickDestination) string {
+	query := destinationQuery(dest)
+	if len(query) == 0 {
+		return path
+	}
+	return path + "?" + query.Encode()
+}
+
+func destinationQuery(dest *api.BrickDestination) url.Values {
+	query := url.Values{}
+	if dest == nil {
+		return query
+	}
+	if dest.Device != "" {
+		query.Set("destination_device", dest.Device)
+	}
+	if dest.Node != "" {
+		query.Set("destination_node", dest.Node)
+	}
+	return query
+}
+
+// BrickGc scans the devices for logical volumes not used by any brick
+// and for bricks whose logical volumes are missing
+func (c *Client) BrickGc(request *api.BrickGcRequest) (
+	*api.BrickGcResponse, error) {
+
+	buffer, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST",
+		c.host+"/bricks/gc",
+		bytes.NewBuffer(buffer))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	err = c.setToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	var gc api.BrickGcResponse
+	err = utils.GetJsonFromResponse(r, &gc)
+	if err != nil {
+		return nil, err
+	}
+
+	return &gc, nil
+}
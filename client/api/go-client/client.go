@@ -14,6 +14,7 @@ package client
 
 import (
 	"crypto/sha256"
+	"crypto/tls"
 	"encoding/hex"
 	"net/http"
 	"time"
@@ -31,7 +32,11 @@ type Client struct {
 	host     string
 	key      string
 	user     string
+	subject  string
 	throttle chan bool
+
+	// Transport of the requests, the default one if nil
+	transport *http.Transport
 }
 
 // Creates a new client to access a Heketi server
@@ -53,6 +58,23 @@ func NewClientNoAuth(host string) *Client {
 	return NewClient(host, "", "")
 }
 
+// SetSubject sets the subject of the tokens of the requests, the user
+// the requests are made for. The volumes created for a user in a tenant
+// are limited by the quotas of the tenant.
+func (c *Client) SetSubject(subject string) {
+	c.subject = subject
+}
+
+// SetTLSConfig sets the TLS configuration used to connect to a server
+// over HTTPS, such as the CAs the certificate of the server is verified
+// with and the certificate of the client
+func (c *Client) SetTLSConfig(config *tls.Config) {
+	c.transport = &http.Transport{
+		Proxy:           http.ProxyFromEnvironment,
+		TLSClientConfig: config,
+	}
+}
+
 // Simple Hello test to check if the server is up
 func (c *Client) Hello() error {
 	// Create request
@@ -88,6 +110,9 @@ func (c *Client) do(req *http.Request) (*http.Response, error) {
 	}()
 
 	httpClient := &http.Client{}
+	if c.transport != nil {
+		httpClient.Transport = c.transport
+	}
 	httpClient.CheckRedirect = c.checkRedirect
 	return httpClient.Do(req)
 }
@@ -150,7 +175,7 @@ func (c *Client) setToken(r *http.Request) error {
 	hash.Write([]byte(qshstring))
 
 	// Create Token
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+	claims := jwt.MapClaims{
 		// Set issuer
 		"iss": c.user,
 
@@ -162,7 +187,11 @@ func (c *Client) setToken(r *http.Request) error {
 
 		// Set qsh
 		"qsh": hex.EncodeToString(hash.Sum(nil)),
-	})
+	}
+	if c.subject != "" {
+		claims["sub"] = c.subject
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
 	// Sign the token
 	signedtoken, err := token.SignedString([]byte(c.key))
@@ -208,7 +208,7 @@ func TestTopology(t *testing.T) {
 			sg.Add(1)
 			go func(i int) {
 				defer sg.Done()
-				sg.Err(c.DeviceState(nodeInfo.DevicesInfo[i].Id, &api.StateRequest{State: api.EntryStateOffline}))
+				sg.Err(c.DeviceState(nodeInfo.DevicesInfo[i].Id, &api.StateRequest{State: api.EntryStateOffline, Reason: api.StateReasonMaintenance}))
 			}(index)
 		}
 		err = sg.Result()
@@ -220,7 +220,7 @@ func TestTopology(t *testing.T) {
 			sg.Add(1)
 			go func(i int) {
 				defer sg.Done()
-				sg.Err(c.DeviceState(nodeInfo.DevicesInfo[i].Id, &api.StateRequest{State: api.EntryStateFailed}))
+				sg.Err(c.DeviceState(nodeInfo.DevicesInfo[i].Id, &api.StateRequest{State: api.EntryStateFailed, Reason: api.StateReasonMaintenance}))
 			}(index)
 		}
 		err = sg.Result()
@@ -385,7 +385,8 @@ func TestClientNode(t *testing.T) {
 
 	// Set offline
 	err = c.NodeState(node.Id, &api.StateRequest{
-		State: api.EntryStateOffline,
+		State:  api.EntryStateOffline,
+		Reason: api.StateReasonMaintenance,
 	})
 	tests.Assert(t, err == nil)
 
@@ -489,7 +490,8 @@ func TestClientDevice(t *testing.T) {
 
 	// Set offline
 	err = c.DeviceState(deviceId, &api.StateRequest{
-		State: api.EntryStateOffline,
+		State:  api.EntryStateOffline,
+		Reason: api.StateReasonMaintenance,
 	})
 	tests.Assert(t, err == nil, err)
 	deviceInfo, err = c.DeviceInfo(deviceId)
@@ -523,10 +525,10 @@ func TestClientDevice(t *testing.T) {
 	tests.Assert(t, err != nil)
 
 	// Offline Device
-	err = c.DeviceState(deviceInfo.Id, &api.StateRequest{State: api.EntryStateOffline})
+	err = c.DeviceState(deviceInfo.Id, &api.StateRequest{State: api.EntryStateOffline, Reason: api.StateReasonMaintenance})
 	tests.Assert(t, err == nil)
 	// Fail Device
-	err = c.DeviceState(deviceInfo.Id, &api.StateRequest{State: api.EntryStateFailed})
+	err = c.DeviceState(deviceInfo.Id, &api.StateRequest{State: api.EntryStateFailed, Reason: api.StateReasonMaintenance})
 	tests.Assert(t, err == nil)
 
 	// Delete device
@@ -639,6 +641,18 @@ func TestClientVolume(t *testing.T) {
 	tests.Assert(t, err == nil)
 	tests.Assert(t, volumeInfo.Size == 20)
 
+	// Restore volume with a bad id
+	restoreReq := &api.VolumeRestoreRequest{}
+	restoreReq.Snapshot = "snap1"
+	volumeInfo, err = c.VolumeRestore("badid", restoreReq)
+	tests.Assert(t, err != nil)
+
+	// Restore volume
+	volumeInfo, err = c.VolumeRestore(volume.Id, restoreReq)
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, volumeInfo.Id == volume.Id)
+	tests.Assert(t, volumeInfo.Size == 20)
+
 	// Delete bad id
 	err = c.VolumeDelete("badid")
 	tests.Assert(t, err != nil)
@@ -659,7 +673,7 @@ func TestClientVolume(t *testing.T) {
 			sg.Add(1)
 			go func(i int) {
 				defer sg.Done()
-				sg.Err(c.DeviceState(nodeInfo.DevicesInfo[i].Id, &api.StateRequest{State: api.EntryStateOffline}))
+				sg.Err(c.DeviceState(nodeInfo.DevicesInfo[i].Id, &api.StateRequest{State: api.EntryStateOffline, Reason: api.StateReasonMaintenance}))
 			}(index)
 		}
 		err = sg.Result()
@@ -671,7 +685,7 @@ func TestClientVolume(t *testing.T) {
 			sg.Add(1)
 			go func(i int) {
 				defer sg.Done()
-				sg.Err(c.DeviceState(nodeInfo.DevicesInfo[i].Id, &api.StateRequest{State: api.EntryStateFailed}))
+				sg.Err(c.DeviceState(nodeInfo.DevicesInfo[i].Id, &api.StateRequest{State: api.EntryStateFailed, Reason: api.StateReasonMaintenance}))
 			}(index)
 		}
 		err = sg.Result()
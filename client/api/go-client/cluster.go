@@ -16,6 +16,9 @@ import (
 	"bytes"
 	"encoding/json"
 	"net/http"
+	"net/url"
+	"strconv"
+	"time"
 
 	"github.com/heketi/heketi/pkg/glusterfs/api"
 	"github.com/heketi/heketi/pkg/utils"
@@ -96,6 +99,44 @@ func (c *Client) ClusterSetFlags(id string, request *api.ClusterSetFlagsRequest)
 	return nil
 }
 
+// ClusterSetStandby marks the cluster as a standby cluster, which is
+// not selected for new volumes unless requested by id
+func (c *Client) ClusterSetStandby(id string) error {
+	return c.clusterStandbyAction(id, "standby")
+}
+
+// ClusterPromote makes the standby cluster an active cluster
+func (c *Client) ClusterPromote(id string) error {
+	return c.clusterStandbyAction(id, "promote")
+}
+
+func (c *Client) clusterStandbyAction(id, action string) error {
+
+	// Create a request
+	req, err := http.NewRequest("POST", c.host+"/clusters/"+id+"/"+action, nil)
+	if err != nil {
+		return err
+	}
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return err
+	}
+
+	// Send request
+	r, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return utils.GetErrorFromResponse(r)
+	}
+
+	return nil
+}
+
 func (c *Client) ClusterInfo(id string) (*api.ClusterInfoResponse, error) {
 
 	// Create request
@@ -190,3 +231,568 @@ func (c *Client) ClusterDelete(id string) error {
 
 	return nil
 }
+
+func (c *Client) ClusterPeerRepair(id string) (*api.ClusterPeerRepairResponse, error) {
+
+	// Create a request
+	req, err := http.NewRequest("POST", c.host+"/clusters/"+id+"/peers/repair", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Send request
+	r, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusAccepted {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	// Wait for the repair
+	r, err = c.waitForResponseWithTimer(r, time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if r.StatusCode != http.StatusOK {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	// Read JSON response
+	var repair api.ClusterPeerRepairResponse
+	err = utils.GetJsonFromResponse(r, &repair)
+	if err != nil {
+		return nil, err
+	}
+
+	return &repair, nil
+}
+
+func (c *Client) ClusterOptions(id string) (*api.ClusterOptionsResponse, error) {
+
+	// Create a request
+	req, err := http.NewRequest("GET", c.host+"/clusters/"+id+"/options", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Send request
+	r, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	// Read JSON response
+	var options api.ClusterOptionsResponse
+	err = utils.GetJsonFromResponse(r, &options)
+	if err != nil {
+		return nil, err
+	}
+
+	return &options, nil
+}
+
+func (c *Client) ClusterSetOptions(id string, request *api.ClusterOptionsRequest) (
+	*api.ClusterOptionsResponse, error) {
+
+	// Marshal request to JSON
+	buffer, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create a request
+	req, err := http.NewRequest("PUT",
+		c.host+"/clusters/"+id+"/options",
+		bytes.NewBuffer(buffer))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Send request
+	r, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	// Read JSON response
+	var options api.ClusterOptionsResponse
+	err = utils.GetJsonFromResponse(r, &options)
+	if err != nil {
+		return nil, err
+	}
+
+	return &options, nil
+}
+
+func (c *Client) ClusterCanary(id string) (*api.CanaryResult, error) {
+
+	// Create a request
+	req, err := http.NewRequest("POST", c.host+"/clusters/"+id+"/canary", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Send request
+	r, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusAccepted {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	// Wait for response
+	r, err = c.waitForResponseWithTimer(r, time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if r.StatusCode != http.StatusOK {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	// Read JSON response
+	var result api.CanaryResult
+	err = utils.GetJsonFromResponse(r, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func (c *Client) ClusterCanaryResult(id string) (*api.CanaryResult, error) {
+
+	// Create a request
+	req, err := http.NewRequest("GET", c.host+"/clusters/"+id+"/canary", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Send request
+	r, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	// Read JSON response
+	var result api.CanaryResult
+	err = utils.GetJsonFromResponse(r, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// StorageClassReport evaluates every cluster against the volume spec of
+// the request
+func (c *Client) StorageClassReport(request *api.StorageClassReportRequest) (
+	*api.StorageClassReportResponse, error) {
+
+	buffer, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create a request
+	req, err := http.NewRequest("POST",
+		c.host+"/storageclass/report",
+		bytes.NewBuffer(buffer))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Send request
+	r, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	// Read JSON response
+	var report api.StorageClassReportResponse
+	err = utils.GetJsonFromResponse(r, &report)
+	if err != nil {
+		return nil, err
+	}
+
+	return &report, nil
+}
+
+// ClusterRebalancePlan returns the brick moves a rebalance of the
+// cluster would make without moving any brick
+func (c *Client) ClusterRebalancePlan(id string,
+	request *api.ClusterRebalanceRequest) (*api.ClusterRebalanceResponse, error) {
+
+	plan := *request
+	plan.DryRun = true
+
+	// Marshal request to JSON
+	buffer, err := json.Marshal(plan)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create a request
+	req, err := http.NewRequest("POST", c.host+"/clusters/"+id+"/rebalance",
+		bytes.NewBuffer(buffer))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Send request
+	r, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	// Read JSON response
+	var result api.ClusterRebalanceResponse
+	err = utils.GetJsonFromResponse(r, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// ClusterRebalance moves bricks between the devices of the cluster to
+// even out their utilization and waits for the moves to complete
+func (c *Client) ClusterRebalance(id string,
+	request *api.ClusterRebalanceRequest) error {
+
+	// Marshal request to JSON
+	buffer, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	// Create a request
+	req, err := http.NewRequest("POST", c.host+"/clusters/"+id+"/rebalance",
+		bytes.NewBuffer(buffer))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return err
+	}
+
+	// Send request
+	r, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusAccepted {
+		return utils.GetErrorFromResponse(r)
+	}
+
+	// Wait for response
+	r, err = c.waitForResponseWithTimer(r, time.Second)
+	if err != nil {
+		return err
+	}
+	if r.StatusCode != http.StatusOK {
+		return utils.GetErrorFromResponse(r)
+	}
+
+	return nil
+}
+
+// ClusterZoneRebalancePlan returns the sets of bricks of the cluster
+// spread over too few zones and the brick moves a zone rebalance would
+// make without moving any brick
+func (c *Client) ClusterZoneRebalancePlan(id string,
+	request *api.ClusterZoneRebalanceRequest) (
+	*api.ClusterZoneRebalanceResponse, error) {
+
+	plan := *request
+	plan.DryRun = true
+
+	// Marshal request to JSON
+	buffer, err := json.Marshal(plan)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create a request
+	req, err := http.NewRequest("POST", c.host+"/clusters/"+id+"/zones/rebalance",
+		bytes.NewBuffer(buffer))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Send request
+	r, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	// Read JSON response
+	var result api.ClusterZoneRebalanceResponse
+	err = utils.GetJsonFromResponse(r, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// ClusterZoneRebalance moves bricks between the zones of the cluster to
+// spread the sets of bricks across the zones and waits for the moves to
+// complete
+func (c *Client) ClusterZoneRebalance(id string,
+	request *api.ClusterZoneRebalanceRequest) error {
+
+	// Marshal request to JSON
+	buffer, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	// Create a request
+	req, err := http.NewRequest("POST", c.host+"/clusters/"+id+"/zones/rebalance",
+		bytes.NewBuffer(buffer))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return err
+	}
+
+	// Send request
+	r, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusAccepted {
+		return utils.GetErrorFromResponse(r)
+	}
+
+	// Wait for response
+	r, err = c.waitForResponseWithTimer(r, time.Second)
+	if err != nil {
+		return err
+	}
+	if r.StatusCode != http.StatusOK {
+		return utils.GetErrorFromResponse(r)
+	}
+
+	return nil
+}
+
+// ClusterPlacementScores samples the placement of bricks of the size,
+// in GiB, to show how the allocator prefers the devices of the cluster.
+// Zero arguments use the defaults of the server.
+func (c *Client) ClusterPlacementScores(id string,
+	size, samples int) (*api.ClusterPlacementScoresResponse, error) {
+
+	query := url.Values{}
+	if size != 0 {
+		query.Set("size", strconv.Itoa(size))
+	}
+	if samples != 0 {
+		query.Set("samples", strconv.Itoa(samples))
+	}
+	path := c.host + "/clusters/" + id + "/scores"
+	if len(query) != 0 {
+		path += "?" + query.Encode()
+	}
+
+	// Create request
+	req, err := http.NewRequest("GET", path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get info
+	r, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	// Read JSON response
+	var scores api.ClusterPlacementScoresResponse
+	err = utils.GetJsonFromResponse(r, &scores)
+	if err != nil {
+		return nil, err
+	}
+
+	return &scores, nil
+}
+
+// ClusterCapacityForecast projects the time until the devices of the
+// cluster are full from the capacity samples of the last days. Zero
+// days use the default of the server.
+func (c *Client) ClusterCapacityForecast(id string,
+	days int) (*api.ClusterCapacityForecastResponse, error) {
+
+	path := c.host + "/clusters/" + id + "/forecast"
+	if days != 0 {
+		path += "?days=" + strconv.Itoa(days)
+	}
+
+	// Create request
+	req, err := http.NewRequest("GET", path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get info
+	r, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	// Read JSON response
+	var forecast api.ClusterCapacityForecastResponse
+	err = utils.GetJsonFromResponse(r, &forecast)
+	if err != nil {
+		return nil, err
+	}
+
+	return &forecast, nil
+}
+
+// CapacityReport returns the capacity of the devices of every cluster
+// and of their nodes
+func (c *Client) CapacityReport() (*api.CapacityReportResponse, error) {
+
+	// Create request
+	req, err := http.NewRequest("GET", c.host+"/capacity", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get info
+	r, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	// Read JSON response
+	var report api.CapacityReportResponse
+	err = utils.GetJsonFromResponse(r, &report)
+	if err != nil {
+		return nil, err
+	}
+
+	return &report, nil
+}
@@ -13,9 +13,13 @@
 package client
 
 import (
+	"io"
 	"io/ioutil"
 	"net/http"
+	"net/url"
+	"strconv"
 
+	"github.com/heketi/heketi/pkg/glusterfs/api"
 	"github.com/heketi/heketi/pkg/utils"
 )
 
@@ -50,3 +54,112 @@ func (c *Client) DbDump() (string, error) {
 	respJSON := string(respBytes)
 	return respJSON, nil
 }
+
+// DbImport loads a JSON dump of a db, as returned by DbDump, into the
+// empty db of the server
+func (c *Client) DbImport(dump io.Reader) error {
+	req, err := http.NewRequest("POST", c.host+"/db/import", dump)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return err
+	}
+
+	// Send request
+	r, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusNoContent {
+		return utils.GetErrorFromResponse(r)
+	}
+
+	return nil
+}
+
+// DbStats returns the number of entries and the size of every bucket
+// of the db, counting only the entries whose key starts with prefix if
+// set, along with the given number of largest entries of each bucket.
+// The server default number of largest entries is used if negative.
+func (c *Client) DbStats(prefix string, largest int) (*api.DbStatsResponse, error) {
+	query := url.Values{}
+	if prefix != "" {
+		query.Set("prefix", prefix)
+	}
+	if largest >= 0 {
+		query.Set("largest", strconv.Itoa(largest))
+	}
+	path := c.host + "/db/stats"
+	if len(query) != 0 {
+		path += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequest("GET", path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Send request
+	r, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	// Read JSON response
+	var stats api.DbStatsResponse
+	err = utils.GetJsonFromResponse(r, &stats)
+	if err != nil {
+		return nil, err
+	}
+
+	return &stats, nil
+}
+
+// DbCheck reports the inconsistencies between the entries of the db
+func (c *Client) DbCheck() (*api.DbCheckResponse, error) {
+	req, err := http.NewRequest("GET", c.host+"/db/check", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Send request
+	r, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	// Read JSON response
+	var check api.DbCheckResponse
+	err = utils.GetJsonFromResponse(r, &check)
+	if err != nil {
+		return nil, err
+	}
+
+	return &check, nil
+}
@@ -98,6 +98,42 @@ func (c *Client) DeviceInfo(id string) (*api.DeviceInfoResponse, error) {
 	return &device, nil
 }
 
+// DeviceLvm returns the names of the volume group of the device and of
+// the logical volumes of its bricks.
+func (c *Client) DeviceLvm(id string) (*api.DeviceLvmResponse, error) {
+
+	// Create request
+	req, err := http.NewRequest("GET", c.host+"/devices/"+id+"/lvm", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get info
+	r, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	// Read JSON response
+	var lvm api.DeviceLvmResponse
+	err = utils.GetJsonFromResponse(r, &lvm)
+	if err != nil {
+		return nil, err
+	}
+
+	return &lvm, nil
+}
+
 func (c *Client) DeviceDelete(id string) error {
 
 	// Create a request
@@ -134,6 +170,102 @@ func (c *Client) DeviceDelete(id string) error {
 	return nil
 }
 
+func (c *Client) DeviceRemove(id string) error {
+	return c.DeviceRemoveTo(id, nil)
+}
+
+// DeviceRemoveTo removes the device like DeviceRemove, moving its bricks
+// to the destination, if set
+func (c *Client) DeviceRemoveTo(id string, dest *api.BrickDestination) error {
+
+	// Create a request
+	req, err := http.NewRequest("POST",
+		c.host+destinationPath("/devices/"+id+"/remove", dest), nil)
+	if err != nil {
+		return err
+	}
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return err
+	}
+
+	// Send request
+	r, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusAccepted {
+		return utils.GetErrorFromResponse(r)
+	}
+
+	// Wait for response
+	r, err = c.waitForResponseWithTimer(r, time.Second)
+	if err != nil {
+		return err
+	}
+	if r.StatusCode != http.StatusNoContent {
+		return utils.GetErrorFromResponse(r)
+	}
+
+	return nil
+}
+
+// DeviceReplaceBricks replaces all the bricks of the device with new
+// bricks on other devices and returns the information of the device
+func (c *Client) DeviceReplaceBricks(id string) (*api.DeviceInfoResponse, error) {
+	return c.DeviceReplaceBricksTo(id, nil)
+}
+
+// DeviceReplaceBricksTo replaces the bricks of the device like
+// DeviceReplaceBricks with new bricks on the destination, if set
+func (c *Client) DeviceReplaceBricksTo(id string,
+	dest *api.BrickDestination) (*api.DeviceInfoResponse, error) {
+
+	// Create a request
+	req, err := http.NewRequest("POST",
+		c.host+destinationPath("/devices/"+id+"/bricks/replace", dest), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Send request
+	r, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusAccepted {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	// Wait for response
+	r, err = c.waitForResponseWithTimer(r, time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if r.StatusCode != http.StatusOK {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	// Read JSON response
+	var device api.DeviceInfoResponse
+	err = utils.GetJsonFromResponse(r, &device)
+	if err != nil {
+		return nil, err
+	}
+
+	return &device, nil
+}
+
 func (c *Client) DeviceState(id string,
 	request *api.StateRequest) error {
 
@@ -215,3 +347,130 @@ func (c *Client) DeviceResync(id string) error {
 
 	return nil
 }
+
+// DeviceSetTags changes the tags of the device and returns the
+// device with its new tags
+func (c *Client) DeviceSetTags(id string,
+	request *api.TagsChangeRequest) (*api.DeviceInfoResponse, error) {
+
+	// Marshal request to JSON
+	buffer, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create a request
+	req, err := http.NewRequest("POST",
+		c.host+"/devices/"+id+"/tags",
+		bytes.NewBuffer(buffer))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Send request
+	r, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	// Read JSON response
+	var info api.DeviceInfoResponse
+	err = utils.GetJsonFromResponse(r, &info)
+	if err != nil {
+		return nil, err
+	}
+
+	return &info, nil
+}
+
+// DeviceSetEnclosure sets the enclosure of the device and returns the
+// device with its new enclosure
+func (c *Client) DeviceSetEnclosure(id string,
+	request *api.DeviceEnclosureRequest) (*api.DeviceInfoResponse, error) {
+
+	// Marshal request to JSON
+	buffer, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create a request
+	req, err := http.NewRequest("POST",
+		c.host+"/devices/"+id+"/enclosure",
+		bytes.NewBuffer(buffer))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Send request
+	r, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	// Read JSON response
+	var info api.DeviceInfoResponse
+	err = utils.GetJsonFromResponse(r, &info)
+	if err != nil {
+		return nil, err
+	}
+
+	return &info, nil
+}
+
+// DeviceResyncReport resyncs the device and returns the changes made to
+// its storage and the logical volumes no brick uses
+func (c *Client) DeviceResyncReport(id string) (*api.DeviceResyncResponse, error) {
+
+	// Create a request
+	req, err := http.NewRequest("POST", c.host+"/devices/"+id+"/resync", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Send request
+	r, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	var resp api.DeviceResyncResponse
+	err = utils.GetJsonFromResponse(r, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
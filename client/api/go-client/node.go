@@ -185,3 +185,213 @@ func (c *Client) NodeState(id string, request *api.StateRequest) error {
 
 	return nil
 }
+
+func (c *Client) NodeRemove(id string) (*api.NodeRemoveProgress, error) {
+
+	// Create a request
+	req, err := http.NewRequest("POST", c.host+"/nodes/"+id+"/remove", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Send request
+	r, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusAccepted {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	// Wait for response
+	r, err = c.waitForResponseWithTimer(r, time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if r.StatusCode != http.StatusOK {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	// Read JSON response
+	var progress api.NodeRemoveProgress
+	err = utils.GetJsonFromResponse(r, &progress)
+	if err != nil {
+		return nil, err
+	}
+
+	return &progress, nil
+}
+
+func (c *Client) NodeRestartBricks(id string,
+	request *api.NodeBrickRestartRequest) (*api.NodeBrickRestartProgress, error) {
+
+	// Marshal request to JSON
+	buffer, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create a request
+	req, err := http.NewRequest("POST",
+		c.host+"/nodes/"+id+"/restart-bricks",
+		bytes.NewBuffer(buffer))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Send request
+	r, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusAccepted {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	// Wait for response
+	r, err = c.waitForResponseWithTimer(r, time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if r.StatusCode != http.StatusOK {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	// Read JSON response
+	var progress api.NodeBrickRestartProgress
+	err = utils.GetJsonFromResponse(r, &progress)
+	if err != nil {
+		return nil, err
+	}
+
+	return &progress, nil
+}
+
+func (c *Client) NodeRestartBricksStatus(id string) (*api.NodeBrickRestartProgress, error) {
+
+	// Create a request
+	req, err := http.NewRequest("GET", c.host+"/nodes/"+id+"/restart-bricks", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Send request
+	r, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	// Read JSON response
+	var progress api.NodeBrickRestartProgress
+	err = utils.GetJsonFromResponse(r, &progress)
+	if err != nil {
+		return nil, err
+	}
+
+	return &progress, nil
+}
+
+func (c *Client) NodeRemoveStatus(id string) (*api.NodeRemoveProgress, error) {
+
+	// Create a request
+	req, err := http.NewRequest("GET", c.host+"/nodes/"+id+"/remove", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Send request
+	r, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	// Read JSON response
+	var progress api.NodeRemoveProgress
+	err = utils.GetJsonFromResponse(r, &progress)
+	if err != nil {
+		return nil, err
+	}
+
+	return &progress, nil
+}
+
+// NodeSetTags changes the tags of the node and returns the
+// node with its new tags
+func (c *Client) NodeSetTags(id string,
+	request *api.TagsChangeRequest) (*api.NodeInfoResponse, error) {
+
+	// Marshal request to JSON
+	buffer, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create a request
+	req, err := http.NewRequest("POST",
+		c.host+"/nodes/"+id+"/tags",
+		bytes.NewBuffer(buffer))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Send request
+	r, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	// Read JSON response
+	var info api.NodeInfoResponse
+	err = utils.GetJsonFromResponse(r, &info)
+	if err != nil {
+		return nil, err
+	}
+
+	return &info, nil
+}
@@ -0,0 +1,280 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), as published by the Free Software Foundation,
+// or under the Apache License, Version 2.0 <LICENSE-APACHE2 or
+// http://www.apache.org/licenses/LICENSE-2.0>.
+//
+// You may not use this file except in compliance with those terms.
+//
+
+package client
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/heketi/pkg/utils"
+)
+
+// OperationList returns the operations the server has not finished
+func (c *Client) OperationList() (*api.OperationListResponse, error) {
+
+	// Create request
+	req, err := http.NewRequest("GET", c.host+"/operations", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get info
+	r, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	// Read JSON response
+	var ops api.OperationListResponse
+	err = utils.GetJsonFromResponse(r, &ops)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ops, nil
+}
+
+// OperationHistory returns the completed operations that changed the
+// entity, of the type, that finished between since and until, in
+// seconds since the epoch. Empty or zero arguments select every
+// operation.
+func (c *Client) OperationHistory(entity, opType string,
+	since, until int64) (*api.OperationHistoryResponse, error) {
+
+	query := url.Values{}
+	if entity != "" {
+		query.Set("entity", entity)
+	}
+	if opType != "" {
+		query.Set("type", opType)
+	}
+	if since != 0 {
+		query.Set("since", strconv.FormatInt(since, 10))
+	}
+	if until != 0 {
+		query.Set("until", strconv.FormatInt(until, 10))
+	}
+	path := c.host + "/operations/history"
+	if len(query) != 0 {
+		path += "?" + query.Encode()
+	}
+
+	// Create request
+	req, err := http.NewRequest("GET", path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get info
+	r, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	// Read JSON response
+	var history api.OperationHistoryResponse
+	err = utils.GetJsonFromResponse(r, &history)
+	if err != nil {
+		return nil, err
+	}
+
+	return &history, nil
+}
+
+// CommandOutputList returns the kept outputs of the commands that
+// failed on the nodes
+func (c *Client) CommandOutputList() (*api.CommandOutputListResponse, error) {
+
+	// Create request
+	req, err := http.NewRequest("GET", c.host+"/operations/outputs", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get info
+	r, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	// Read JSON response
+	var outputs api.CommandOutputListResponse
+	err = utils.GetJsonFromResponse(r, &outputs)
+	if err != nil {
+		return nil, err
+	}
+
+	return &outputs, nil
+}
+
+// CommandOutputInfo returns the stdout and stderr of a command that
+// failed on a node
+func (c *Client) CommandOutputInfo(id string) (*api.CommandOutputInfoResponse, error) {
+
+	// Create request
+	req, err := http.NewRequest("GET", c.host+"/operations/outputs/"+id, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get info
+	r, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	// Read JSON response
+	var output api.CommandOutputInfoResponse
+	err = utils.GetJsonFromResponse(r, &output)
+	if err != nil {
+		return nil, err
+	}
+
+	return &output, nil
+}
+
+func (c *Client) AuditLog(objectId string,
+	since, until int64) (*api.AuditLogResponse, error) {
+
+	query := url.Values{}
+	if objectId != "" {
+		query.Set("id", objectId)
+	}
+	if since != 0 {
+		query.Set("since", strconv.FormatInt(since, 10))
+	}
+	if until != 0 {
+		query.Set("until", strconv.FormatInt(until, 10))
+	}
+	path := c.host + "/auditlog"
+	if len(query) != 0 {
+		path += "?" + query.Encode()
+	}
+
+	// Create request
+	req, err := http.NewRequest("GET", path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get info
+	r, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	// Read JSON response
+	var log api.AuditLogResponse
+	err = utils.GetJsonFromResponse(r, &log)
+	if err != nil {
+		return nil, err
+	}
+
+	return &log, nil
+}
+
+// EventList returns the last events of the server raised at or after
+// the given time, oldest first. Users only get the events about the
+// volumes of their tenant.
+func (c *Client) EventList(since int64) (*api.EventListResponse, error) {
+
+	path := c.host + "/events"
+	if since != 0 {
+		query := url.Values{}
+		query.Set("since", strconv.FormatInt(since, 10))
+		path += "?" + query.Encode()
+	}
+
+	// Create request
+	req, err := http.NewRequest("GET", path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get info
+	r, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	// Read JSON response
+	var events api.EventListResponse
+	err = utils.GetJsonFromResponse(r, &events)
+	if err != nil {
+		return nil, err
+	}
+
+	return &events, nil
+}
@@ -0,0 +1,197 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), as published by the Free Software Foundation,
+// or under the Apache License, Version 2.0 <LICENSE-APACHE2 or
+// http://www.apache.org/licenses/LICENSE-2.0>.
+//
+// You may not use this file except in compliance with those terms.
+//
+
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/heketi/pkg/utils"
+)
+
+// TenantSet creates the tenant or replaces its users and limits
+func (c *Client) TenantSet(name string, request *api.TenantRequest) (
+	*api.TenantInfoResponse, error) {
+
+	// Marshal request to JSON
+	buffer, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create a request
+	req, err := http.NewRequest("PUT", c.host+"/tenants/"+name,
+		bytes.NewBuffer(buffer))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Send request
+	r, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	// Read JSON response
+	var tenant api.TenantInfoResponse
+	err = utils.GetJsonFromResponse(r, &tenant)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tenant, nil
+}
+
+func (c *Client) TenantList() (*api.TenantListResponse, error) {
+
+	// Create request
+	req, err := http.NewRequest("GET", c.host+"/tenants", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get info
+	r, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	// Read JSON response
+	var tenants api.TenantListResponse
+	err = utils.GetJsonFromResponse(r, &tenants)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tenants, nil
+}
+
+func (c *Client) TenantInfo(name string) (*api.TenantInfoResponse, error) {
+
+	// Create request
+	req, err := http.NewRequest("GET", c.host+"/tenants/"+name, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get info
+	r, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	// Read JSON response
+	var tenant api.TenantInfoResponse
+	err = utils.GetJsonFromResponse(r, &tenant)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tenant, nil
+}
+
+// TenantUsage returns the usage of the tenant on every cluster against
+// its limits. Users can only get the usage of their own tenant.
+func (c *Client) TenantUsage(name string) (*api.TenantUsageResponse, error) {
+
+	// Create request
+	req, err := http.NewRequest("GET", c.host+"/tenants/"+name+"/usage", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get usage
+	r, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	// Read JSON response
+	var usage api.TenantUsageResponse
+	err = utils.GetJsonFromResponse(r, &usage)
+	if err != nil {
+		return nil, err
+	}
+
+	return &usage, nil
+}
+
+func (c *Client) TenantDelete(name string) error {
+
+	// Create DELETE request
+	req, err := http.NewRequest("DELETE", c.host+"/tenants/"+name, nil)
+	if err != nil {
+		return err
+	}
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return err
+	}
+
+	// Send request
+	r, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return utils.GetErrorFromResponse(r)
+	}
+
+	return nil
+}
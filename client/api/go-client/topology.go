@@ -13,7 +13,13 @@
 package client
 
 import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"time"
+
 	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/heketi/pkg/utils"
 )
 
 func (c *Client) TopologyInfo() (*api.TopologyInfoResponse, error) {
@@ -64,3 +70,97 @@ func (c *Client) TopologyInfo() (*api.TopologyInfoResponse, error) {
 	return topo, nil
 
 }
+
+// TopologyLoad has the server create the clusters, nodes and devices of
+// the topology that do not exist yet and returns the result of each of
+// them
+func (c *Client) TopologyLoad(request *api.TopologyLoadRequest) (
+	*api.TopologyLoadResponse, error) {
+
+	buffer, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", c.host+"/topology", bytes.NewBuffer(buffer))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	err = c.setToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusAccepted {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	r, err = c.waitForResponseWithTimer(r, time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if r.StatusCode != http.StatusOK {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	var result api.TopologyLoadResponse
+	err = utils.GetJsonFromResponse(r, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// TopologyDiff compares the topology with the clusters, nodes and devices
+// known to the server. If the request is to apply the diff, the server
+// converges to the topology and the applied diff is returned.
+func (c *Client) TopologyDiff(request *api.TopologyDiffRequest) (
+	*api.TopologyDiffResponse, error) {
+
+	buffer, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", c.host+"/topology/diff", bytes.NewBuffer(buffer))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	err = c.setToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode == http.StatusAccepted {
+		r, err = c.waitForResponseWithTimer(r, time.Second)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if r.StatusCode != http.StatusOK {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	var result api.TopologyDiffResponse
+	err = utils.GetJsonFromResponse(r, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
@@ -16,6 +16,9 @@ import (
 	"bytes"
 	"encoding/json"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/heketi/heketi/pkg/glusterfs/api"
@@ -25,6 +28,15 @@ import (
 func (c *Client) VolumeCreate(request *api.VolumeCreateRequest) (
 	*api.VolumeInfoResponse, error) {
 
+	return c.VolumeCreateWithKey(request, "")
+}
+
+// VolumeCreateWithKey creates a volume with the idempotency key. The
+// request repeated with the same key returns the volume created by the
+// first one instead of creating another volume.
+func (c *Client) VolumeCreateWithKey(request *api.VolumeCreateRequest,
+	idempotencyKey string) (*api.VolumeInfoResponse, error) {
+
 	// Marshal request to JSON
 	buffer, err := json.Marshal(request)
 	if err != nil {
@@ -39,6 +51,9 @@ func (c *Client) VolumeCreate(request *api.VolumeCreateRequest) (
 		return nil, err
 	}
 	req.Header.Set("Content-Type", "application/json")
+	if idempotencyKey != "" {
+		req.Header.Set(api.IdempotencyKeyHeader, idempotencyKey)
+	}
 
 	// Set token
 	err = c.setToken(req)
@@ -75,6 +90,53 @@ func (c *Client) VolumeCreate(request *api.VolumeCreateRequest) (
 	return &volume, nil
 
 }
+
+// VolumeSimulate returns the bricks that creating the volume would
+// allocate without creating it
+func (c *Client) VolumeSimulate(request *api.VolumeCreateRequest) (
+	*api.VolumeSimulateResponse, error) {
+
+	// Marshal request to JSON
+	buffer, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create a request
+	req, err := http.NewRequest("POST",
+		c.host+"/volumes/simulate",
+		bytes.NewBuffer(buffer))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Send request
+	r, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	// Read JSON response
+	var simulation api.VolumeSimulateResponse
+	err = utils.GetJsonFromResponse(r, &simulation)
+	if err != nil {
+		return nil, err
+	}
+
+	return &simulation, nil
+}
+
 func (c *Client) VolumeExpand(id string, request *api.VolumeExpandRequest) (
 	*api.VolumeInfoResponse, error) {
 
@@ -105,6 +167,16 @@ func (c *Client) VolumeExpand(id string, request *api.VolumeExpandRequest) (
 		return nil, err
 	}
 	defer r.Body.Close()
+	if r.StatusCode == http.StatusConflict &&
+		strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		// The volume would have too many bricks
+		var limitErr api.BrickLimitError
+		err = utils.GetJsonFromResponse(r, &limitErr)
+		if err != nil {
+			return nil, err
+		}
+		return nil, &limitErr
+	}
 	if r.StatusCode != http.StatusAccepted {
 		return nil, utils.GetErrorFromResponse(r)
 	}
@@ -129,10 +201,390 @@ func (c *Client) VolumeExpand(id string, request *api.VolumeExpandRequest) (
 
 }
 
+func (c *Client) VolumeRestore(id string, request *api.VolumeRestoreRequest) (
+	*api.VolumeInfoResponse, error) {
+
+	// Marshal request to JSON
+	buffer, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create a request
+	req, err := http.NewRequest("POST",
+		c.host+"/volumes/"+id+"/restore",
+		bytes.NewBuffer(buffer))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Send request
+	r, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusAccepted {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	// Wait for response
+	r, err = c.waitForResponseWithTimer(r, time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if r.StatusCode != http.StatusOK {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	// Read JSON response
+	var volume api.VolumeInfoResponse
+	err = utils.GetJsonFromResponse(r, &volume)
+	if err != nil {
+		return nil, err
+	}
+
+	return &volume, nil
+
+}
+
+func (c *Client) VolumeOptionsCheck(id string, request *api.VolumeOptionsCheckRequest) (
+	*api.VolumeOptionsCheckResponse, error) {
+
+	// Marshal request to JSON
+	buffer, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create a request
+	req, err := http.NewRequest("POST",
+		c.host+"/volumes/"+id+"/options/check",
+		bytes.NewBuffer(buffer))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Send request
+	r, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	// Read JSON response
+	var check api.VolumeOptionsCheckResponse
+	err = utils.GetJsonFromResponse(r, &check)
+	if err != nil {
+		return nil, err
+	}
+
+	return &check, nil
+}
+
+func (c *Client) VolumeBrickOrderCheck(id string) (
+	*api.VolumeBrickOrderCheckResponse, error) {
+
+	// Create a request
+	req, err := http.NewRequest("POST",
+		c.host+"/volumes/"+id+"/bricks/check",
+		bytes.NewBuffer([]byte("{}")))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Send request
+	r, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	// Read JSON response
+	var check api.VolumeBrickOrderCheckResponse
+	err = utils.GetJsonFromResponse(r, &check)
+	if err != nil {
+		return nil, err
+	}
+
+	return &check, nil
+}
+
+func (c *Client) VolumeHealInfo(id string) (*api.VolumeHealInfoResponse, error) {
+
+	// Create a request
+	req, err := http.NewRequest("GET", c.host+"/volumes/"+id+"/healinfo", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Send request
+	r, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	// Read JSON response
+	var heal api.VolumeHealInfoResponse
+	err = utils.GetJsonFromResponse(r, &heal)
+	if err != nil {
+		return nil, err
+	}
+
+	return &heal, nil
+}
+
+func (c *Client) VolumeSetOptions(id string, request *api.VolumeOptionsRequest) (
+	*api.VolumeInfoResponse, error) {
+
+	// Marshal request to JSON
+	buffer, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create a request
+	req, err := http.NewRequest("PUT",
+		c.host+"/volumes/"+id+"/options",
+		bytes.NewBuffer(buffer))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Send request
+	r, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	// Read JSON response
+	var volume api.VolumeInfoResponse
+	err = utils.GetJsonFromResponse(r, &volume)
+	if err != nil {
+		return nil, err
+	}
+
+	return &volume, nil
+}
+
+func (c *Client) VolumeSetQuota(id string, request *api.VolumeQuota) (
+	*api.VolumeInfoResponse, error) {
+
+	// Marshal request to JSON
+	buffer, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create a request
+	req, err := http.NewRequest("PUT",
+		c.host+"/volumes/"+id+"/quota",
+		bytes.NewBuffer(buffer))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Send request
+	r, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	// Read JSON response
+	var volume api.VolumeInfoResponse
+	err = utils.GetJsonFromResponse(r, &volume)
+	if err != nil {
+		return nil, err
+	}
+
+	return &volume, nil
+}
+
+func (c *Client) VolumeIOStats(id string) (*api.VolumeIOStatsResponse, error) {
+
+	// Create a request
+	req, err := http.NewRequest("GET", c.host+"/volumes/"+id+"/iostats", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Send request
+	r, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	// Read JSON response
+	var stats api.VolumeIOStatsResponse
+	err = utils.GetJsonFromResponse(r, &stats)
+	if err != nil {
+		return nil, err
+	}
+
+	return &stats, nil
+}
+
+// listPath returns the path of a list request with the options in its
+// query
+func listPath(path string, opts *api.ListOptions) string {
+	if opts == nil {
+		return path
+	}
+	query := url.Values{}
+	for name, value := range map[string]string{
+		"cluster":    opts.Cluster,
+		"name":       opts.NamePrefix,
+		"durability": string(opts.Durability),
+		"volume":     opts.Volume,
+		"node":       opts.Node,
+		"device":     opts.Device,
+	} {
+		if value != "" {
+			query.Set(name, value)
+		}
+	}
+	if opts.Limit != 0 {
+		query.Set("limit", strconv.Itoa(opts.Limit))
+	}
+	if opts.Offset != 0 {
+		query.Set("offset", strconv.Itoa(opts.Offset))
+	}
+	if opts.Block != nil {
+		query.Set("block", strconv.FormatBool(*opts.Block))
+	}
+	if opts.Expand {
+		query.Set("expand", "true")
+	}
+	if len(query) != 0 {
+		path += "?" + query.Encode()
+	}
+	return path
+}
+
 func (c *Client) VolumeList() (*api.VolumeListResponse, error) {
+	return c.VolumeListWithOptions(nil)
+}
+
+// VolumeListWithOptions returns the page of the volumes matching the
+// filters of the options
+func (c *Client) VolumeListWithOptions(opts *api.ListOptions) (
+	*api.VolumeListResponse, error) {
 
 	// Create request
-	req, err := http.NewRequest("GET", c.host+"/volumes", nil)
+	req, err := http.NewRequest("GET", listPath(c.host+"/volumes", opts), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get info
+	r, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	// Read JSON response
+	var volumes api.VolumeListResponse
+	err = utils.GetJsonFromResponse(r, &volumes)
+	if err != nil {
+		return nil, err
+	}
+
+	return &volumes, nil
+}
+
+// VolumeSearch returns the ids of the volumes named as requested, or
+// with names starting with the requested name, ordered by name
+func (c *Client) VolumeSearch(request *api.VolumeSearchRequest) (
+	*api.VolumeListResponse, error) {
+
+	query := url.Values{}
+	query.Set("name", request.Name)
+	if request.Match != "" {
+		query.Set("match", request.Match)
+	}
+
+	// Create request
+	req, err := http.NewRequest("GET",
+		c.host+"/volumes/search?"+query.Encode(), nil)
 	if err != nil {
 		return nil, err
 	}
@@ -232,3 +684,43 @@ func (c *Client) VolumeDelete(id string) error {
 
 	return nil
 }
+
+// VolumeDeleteConfirm confirms the delete of a volume waiting for its
+// confirmation
+func (c *Client) VolumeDeleteConfirm(id string) error {
+	return c.volumeDeleteAnswer(id, "confirm")
+}
+
+// VolumeDeleteCancel cancels the delete of a volume waiting for its
+// confirmation
+func (c *Client) VolumeDeleteCancel(id string) error {
+	return c.volumeDeleteAnswer(id, "cancel")
+}
+
+func (c *Client) volumeDeleteAnswer(id, answer string) error {
+
+	// Create a request
+	req, err := http.NewRequest("POST",
+		c.host+"/volumes/"+id+"/delete/"+answer, nil)
+	if err != nil {
+		return err
+	}
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return err
+	}
+
+	// Send request
+	r, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return utils.GetErrorFromResponse(r)
+	}
+
+	return nil
+}
@@ -158,6 +158,12 @@ class HeketiClient(object):
         return req.status_code == requests.codes.ok
         '''
 
+    def node_remove(self, node_id):
+        uri = '/nodes/' + node_id + '/remove'
+        req = self._make_request('POST', uri)
+        if req.status_code == requests.codes.ok:
+            return req.json()
+
     def device_add(self, device_options={}):
         ''' device_options is a dict with parameters to be passed \
             in the json request: \
@@ -187,6 +193,11 @@ class HeketiClient(object):
         return req.status_code == requests.codes.ok
         '''
 
+    def device_remove(self, device_id):
+        uri = '/devices/' + device_id + '/remove'
+        req = self._make_request('POST', uri)
+        return req.status_code == requests.codes.NO_CONTENT
+
     def device_resync(self, device_id):
         uri = '/devices/' + device_id + '/resync'
         req = self._make_request('GET', uri)
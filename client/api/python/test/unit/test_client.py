@@ -113,6 +113,7 @@ class test_heketi(unittest.TestCase):
         # Set offline
         state = {}
         state['state'] = 'offline'
+        state['reason'] = 'maintenance'
         self.assertTrue(c.node_state(node['id'], state))
 
         # Get node info
@@ -191,6 +192,7 @@ class test_heketi(unittest.TestCase):
         # Set offline
         state = {}
         state['state'] = 'offline'
+        state['reason'] = 'maintenance'
         self.assertTrue(c.device_state(device_id, state))
 
         # Get device info
@@ -218,11 +220,13 @@ class test_heketi(unittest.TestCase):
         # Set device to offline
         state = {}
         state['state'] = 'offline'
+        state['reason'] = 'maintenance'
         self.assertTrue(c.device_state(device_id, state))
 
         # Set device to failed
         state = {}
         state['state'] = 'failed'
+        state['reason'] = 'maintenance'
         self.assertTrue(c.device_state(device_id, state))
 
         # Delete device
@@ -326,8 +330,10 @@ class test_heketi(unittest.TestCase):
             # Delete all devices
             for device in nodeInfo['devices']:
                 devid = device['id']
-                self.assertTrue(c.device_state(devid, {'state': 'offline'}))
-                self.assertTrue(c.device_state(devid, {'state': 'failed'}))
+                self.assertTrue(c.device_state(
+                    devid, {'state': 'offline', 'reason': 'maintenance'}))
+                self.assertTrue(c.device_state(
+                    devid, {'state': 'failed', 'reason': 'maintenance'}))
                 device_delete = c.device_delete(devid)
                 self.assertTrue(device_delete)
 
@@ -10,7 +10,6 @@
 package cmds
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
 	//	"os"
@@ -22,11 +21,14 @@ import (
 )
 
 var (
-	bv_size     int
+	bv_size     string
 	bv_volname  string
 	bv_auth     bool
 	bv_clusters string
 	bv_ha       int
+	bv_action   string
+	bv_new_size int
+	bv_hosts    string
 )
 
 func init() {
@@ -35,25 +37,66 @@ func init() {
 	blockVolumeCommand.AddCommand(blockVolumeDeleteCommand)
 	blockVolumeCommand.AddCommand(blockVolumeInfoCommand)
 	blockVolumeCommand.AddCommand(blockVolumeListCommand)
-
-	blockVolumeCreateCommand.Flags().IntVar(&bv_size, "size", -1,
-		"\n\tSize of volume in GiB")
+	blockVolumeCommand.AddCommand(blockVolumeReconcileCommand)
+	blockVolumeCommand.AddCommand(blockVolumeExpandCommand)
+	blockVolumeCommand.AddCommand(blockVolumeRotateAuthCommand)
+	blockVolumeCommand.AddCommand(blockVolumeHaCountCommand)
+	blockVolumeCommand.AddCommand(blockVolumeCloneCommand)
+
+	blockVolumeCreateCommand.Flags().StringVar(&bv_size, "size", "",
+		"\n\tSize of volume in GiB, or with a unit such as 512MiB or 1.5GiB")
 	blockVolumeCreateCommand.Flags().IntVar(&bv_ha, "ha", 0,
 		"\n\tHA count for block volume")
 	blockVolumeCreateCommand.Flags().BoolVar(&bv_auth, "auth", false,
 		"\n\tOptional: Enable Authentication for block volume access")
 	blockVolumeCreateCommand.Flags().StringVar(&bv_volname, "name", "",
 		"\n\tOptional: Name of volume. Only set if really necessary")
+	blockVolumeCreateCommand.Flags().StringVar(&idempotencyKey, "idempotency-key", "",
+		"\n\tOptional: Key of the create. The create repeated with the same"+
+			"\n\tkey returns the block volume created by the first one")
 	blockVolumeCreateCommand.Flags().StringVar(&bv_clusters, "clusters", "",
 		"\n\tOptional: Comma separated list of cluster ids where this volume"+
 			"\n\tmust be allocated. If omitted, Heketi will allocate the volume"+
 			"\n\ton any of the configured clusters which have the available space."+
 			"\n\tProviding a set of clusters will ensure Heketi allocates storage"+
 			"\n\tfor this volume only in the clusters specified.")
+	blockVolumeReconcileCommand.Flags().StringVar(&bv_action, "action", "",
+		"\n\tOptional: Action taken on the block volumes that do not match."+
+			"\n\tadopt creates heketi entries for block volumes only known to"+
+			"\n\tgluster-block, cleanup deletes them and removes the heketi"+
+			"\n\tentries of block volumes missing from gluster-block."+
+			"\n\tIf omitted, the block volumes are only reported.")
+	blockVolumeExpandCommand.Flags().IntVar(&bv_new_size, "new-size", 0,
+		"\n\tNew size of the block volume in GiB. Must be larger than"+
+			"\n\tthe size of the block volume.")
+	blockVolumeHaCountCommand.Flags().IntVar(&bv_ha, "ha", 0,
+		"\n\tNew HA count of the block volume")
+	blockVolumeHaCountCommand.Flags().StringVar(&bv_hosts, "hosts", "",
+		"\n\tOptional: Comma separated list of the storage hostnames of"+
+			"\n\tthe nodes exporting the block volume, as many as the HA count."+
+			"\n\tIf omitted, Heketi keeps the healthy nodes exporting the"+
+			"\n\tblock volume and selects others from its cluster.")
+	blockVolumeCloneCommand.Flags().StringVar(&bv_volname, "name", "",
+		"\n\tOptional: Name of the clone")
+	blockVolumeCloneCommand.Flags().IntVar(&bv_ha, "ha", 0,
+		"\n\tOptional: HA count of the clone. If omitted, the HA count"+
+			"\n\tof the block volume is used.")
+	addListPageFlags(blockVolumeListCommand)
+	blockVolumeListCommand.Flags().StringVar(&listOpts.Cluster, "cluster", "",
+		"\n\tOptional: Only list the block volumes of the cluster")
+	blockVolumeListCommand.Flags().StringVar(&listOpts.NamePrefix, "name-prefix", "",
+		"\n\tOptional: Only list the block volumes whose names start with the prefix")
+	blockVolumeListCommand.Flags().StringVar(&listOpts.Volume, "volume", "",
+		"\n\tOptional: Only list the block volumes of the block hosting volume")
 	blockVolumeCreateCommand.SilenceUsage = true
 	blockVolumeDeleteCommand.SilenceUsage = true
 	blockVolumeInfoCommand.SilenceUsage = true
 	blockVolumeListCommand.SilenceUsage = true
+	blockVolumeReconcileCommand.SilenceUsage = true
+	blockVolumeExpandCommand.SilenceUsage = true
+	blockVolumeRotateAuthCommand.SilenceUsage = true
+	blockVolumeHaCountCommand.SilenceUsage = true
+	blockVolumeCloneCommand.SilenceUsage = true
 }
 
 var blockVolumeCommand = &cobra.Command{
@@ -82,12 +125,17 @@ var blockVolumeCreateCommand = &cobra.Command{
         --clusters=0995098e1284ddccb46c7752d142c832,60d46d518074b13a04ce1022c8c7193c
 `,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		if bv_size == -1 {
+		if bv_size == "" {
 			return errors.New("Missing volume size")
 		}
+		sizeGiB, sizeMiB, err := requestSize(bv_size)
+		if err != nil {
+			return err
+		}
 
 		req := &api.BlockVolumeCreateRequest{}
-		req.Size = bv_size
+		req.Size = sizeGiB
+		req.SizeMiB = sizeMiB
 		req.Auth = bv_auth
 		if bv_clusters != "" {
 			req.Clusters = strings.Split(bv_clusters, ",")
@@ -105,17 +153,15 @@ var blockVolumeCreateCommand = &cobra.Command{
 
 		heketi := client.NewClient(options.Url, options.User, options.Key)
 
-		blockvolume, err := heketi.BlockVolumeCreate(req)
+		blockvolume, err := heketi.BlockVolumeCreateWithKey(req, idempotencyKey)
 		if err != nil {
 			return err
 		}
 
-		if options.Json {
-			data, err := json.Marshal(blockvolume)
-			if err != nil {
+		if structuredOutput() {
+			if err := printOutput(blockvolume); err != nil {
 				return err
 			}
-			fmt.Fprintf(stdout, string(data))
 		} else {
 			fmt.Fprintf(stdout, "%v", blockvolume)
 		}
@@ -146,13 +192,165 @@ var blockVolumeDeleteCommand = &cobra.Command{
 		//set url
 		err := heketi.BlockVolumeDelete(volumeId)
 		if err == nil {
-			fmt.Fprintf(stdout, "Volume %v deleted\n", volumeId)
+			fmt.Fprintf(statusOut(), "Volume %v deleted\n", volumeId)
 		}
 
 		return err
 	},
 }
 
+var blockVolumeExpandCommand = &cobra.Command{
+	Use:   "expand [volume_id]",
+	Short: "Expand a block volume",
+	Long:  "Expand a block volume on its block hosting volume",
+	Example: `  * Grow a block volume to 20GiB
+    $ heketi-cli blockvolume expand 886a86a868711bef83001 --new-size=20
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		s := cmd.Flags().Args()
+		if len(s) < 1 {
+			return errors.New("Volume id missing")
+		}
+		if bv_new_size < 1 {
+			return errors.New("Missing new size of the block volume")
+		}
+		volumeId := cmd.Flags().Arg(0)
+
+		req := &api.BlockVolumeExpandRequest{
+			NewSize: bv_new_size,
+		}
+
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+		blockvolume, err := heketi.BlockVolumeExpand(volumeId, req)
+		if err != nil {
+			return err
+		}
+
+		if structuredOutput() {
+			if err := printOutput(blockvolume); err != nil {
+				return err
+			}
+		} else {
+			fmt.Fprintf(stdout, "%v", blockvolume)
+		}
+		return nil
+	},
+}
+
+var blockVolumeCloneCommand = &cobra.Command{
+	Use:   "clone [volume_id]",
+	Short: "Clone a block volume",
+	Long: "Create a block volume with a copy of the data of a block volume\n" +
+		"on its block hosting volume. Stop writing to the block volume\n" +
+		"while it is cloned for the copy to be consistent.",
+	Example: `  * Clone a block volume
+    $ heketi-cli blockvolume clone 886a86a868711bef83001 --name=test-copy
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		s := cmd.Flags().Args()
+		if len(s) < 1 {
+			return errors.New("Volume id missing")
+		}
+		volumeId := cmd.Flags().Arg(0)
+
+		req := &api.BlockVolumeCloneRequest{
+			Name:    bv_volname,
+			Hacount: bv_ha,
+		}
+
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+		blockvolume, err := heketi.BlockVolumeClone(volumeId, req)
+		if err != nil {
+			return err
+		}
+
+		if structuredOutput() {
+			if err := printOutput(blockvolume); err != nil {
+				return err
+			}
+		} else {
+			fmt.Fprintf(stdout, "%v", blockvolume)
+		}
+		return nil
+	},
+}
+
+var blockVolumeRotateAuthCommand = &cobra.Command{
+	Use:   "rotate-auth [volume_id]",
+	Short: "Rotate the CHAP credentials of a block volume",
+	Long:  "Give a block volume created with auth enabled new CHAP credentials",
+	Example: `  * Rotate the credentials of a block volume
+    $ heketi-cli blockvolume rotate-auth 886a86a868711bef83001
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		s := cmd.Flags().Args()
+		if len(s) < 1 {
+			return errors.New("Volume id missing")
+		}
+		volumeId := cmd.Flags().Arg(0)
+
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+		blockvolume, err := heketi.BlockVolumeAuthRotate(volumeId)
+		if err != nil {
+			return err
+		}
+
+		if structuredOutput() {
+			if err := printOutput(blockvolume); err != nil {
+				return err
+			}
+		} else {
+			fmt.Fprintf(stdout, "%v", blockvolume)
+		}
+		return nil
+	},
+}
+
+var blockVolumeHaCountCommand = &cobra.Command{
+	Use:   "set-ha [volume_id]",
+	Short: "Change the HA count of a block volume",
+	Long:  "Change the number of nodes exporting a block volume",
+	Example: `  * Export a block volume on 3 nodes selected by Heketi
+    $ heketi-cli blockvolume set-ha 886a86a868711bef83001 --ha=3
+
+  * Export a block volume on the given nodes
+    $ heketi-cli blockvolume set-ha 886a86a868711bef83001 --ha=2 \
+        --hosts=192.168.10.100,192.168.10.101
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		s := cmd.Flags().Args()
+		if len(s) < 1 {
+			return errors.New("Volume id missing")
+		}
+		if bv_ha < 1 {
+			return errors.New("Missing HA count of the block volume")
+		}
+		volumeId := cmd.Flags().Arg(0)
+
+		req := &api.BlockVolumeHaCountRequest{
+			Hacount: bv_ha,
+		}
+		if bv_hosts != "" {
+			req.Hosts = strings.Split(bv_hosts, ",")
+		}
+
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+		blockvolume, err := heketi.BlockVolumeHaCount(volumeId, req)
+		if err != nil {
+			return err
+		}
+
+		if structuredOutput() {
+			if err := printOutput(blockvolume); err != nil {
+				return err
+			}
+		} else {
+			fmt.Fprintf(stdout, "%v", blockvolume)
+		}
+		return nil
+	},
+}
+
 var blockVolumeInfoCommand = &cobra.Command{
 	Use:     "info",
 	Short:   "Retreives information about the volume",
@@ -177,12 +375,10 @@ var blockVolumeInfoCommand = &cobra.Command{
 			return err
 		}
 
-		if options.Json {
-			data, err := json.Marshal(info)
-			if err != nil {
+		if structuredOutput() {
+			if err := printOutput(info); err != nil {
 				return err
 			}
-			fmt.Fprintf(stdout, string(data))
 		} else {
 			fmt.Fprintf(stdout, "%v", info)
 		}
@@ -201,17 +397,15 @@ var blockVolumeListCommand = &cobra.Command{
 		heketi := client.NewClient(options.Url, options.User, options.Key)
 
 		// List volumes
-		list, err := heketi.BlockVolumeList()
+		list, err := heketi.BlockVolumeListWithOptions(&listOpts)
 		if err != nil {
 			return err
 		}
 
-		if options.Json {
-			data, err := json.Marshal(list)
-			if err != nil {
+		if structuredOutput() {
+			if err := printOutput(list); err != nil {
 				return err
 			}
-			fmt.Fprintf(stdout, string(data))
 		} else {
 			for _, id := range list.BlockVolumes {
 				volume, err := heketi.BlockVolumeInfo(id)
@@ -229,3 +423,54 @@ var blockVolumeListCommand = &cobra.Command{
 		return nil
 	},
 }
+
+var blockVolumeReconcileCommand = &cobra.Command{
+	Use:   "reconcile",
+	Short: "Compares the block volumes with gluster-block",
+	Long:  "Reports block volumes unknown to heketi and heketi block volumes missing from gluster-block",
+	Example: `  * Report the block volumes that do not match
+      $ heketi-cli blockvolume reconcile
+
+  * Create heketi entries for the block volumes unknown to heketi
+      $ heketi-cli blockvolume reconcile --action=adopt
+
+  * Delete the block volumes unknown to heketi and remove the missing ones
+      $ heketi-cli blockvolume reconcile --action=cleanup
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		req := &api.BlockVolumeReconcileRequest{
+			Action: bv_action,
+		}
+
+		// Create a client to talk to Heketi
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+
+		reconcile, err := heketi.BlockVolumeReconcile(req)
+		if err != nil {
+			return err
+		}
+
+		if structuredOutput() {
+			if err := printOutput(reconcile); err != nil {
+				return err
+			}
+		} else {
+			for _, v := range reconcile.Volumes {
+				fmt.Fprintf(stdout, "Block Hosting Volume: %v\n", v.VolumeId)
+				fmt.Fprintf(stdout, "    Orphaned: %v\n", strings.Join(v.Orphaned, " "))
+				fmt.Fprintf(stdout, "    Missing: %v\n", strings.Join(v.Missing, " "))
+				if len(v.Adopted) > 0 {
+					fmt.Fprintf(stdout, "    Adopted: %v\n", strings.Join(v.Adopted, " "))
+				}
+				if len(v.Removed) > 0 {
+					fmt.Fprintf(stdout, "    Removed: %v\n", strings.Join(v.Removed, " "))
+				}
+				for _, e := range v.Errors {
+					fmt.Fprintf(stdout, "    Error: %v\n", e)
+				}
+			}
+		}
+
+		return nil
+	},
+}
@@ -10,9 +10,9 @@
 package cmds
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -26,6 +26,26 @@ var (
 	cl_file      bool
 	cl_block_str string
 	cl_file_str  string
+	cl_last      bool
+	cl_standby   bool
+
+	cl_selinux_check        bool
+	cl_selinux_booleans     bool
+	cl_selinux_check_str    string
+	cl_selinux_booleans_str string
+
+	cl_zone_policy string
+
+	cl_band      float64
+	cl_max_moves int
+	cl_interval  int
+	cl_dry_run   bool
+
+	cl_size    int
+	cl_samples int
+	cl_days    int
+
+	cl_set_options string
 )
 
 func init() {
@@ -35,6 +55,18 @@ func init() {
 	clusterCommand.AddCommand(clusterListCommand)
 	clusterCommand.AddCommand(clusterInfoCommand)
 	clusterCommand.AddCommand(clusterSetFlagsCommand)
+	clusterCommand.AddCommand(clusterStandbyCommand)
+	clusterCommand.AddCommand(clusterPromoteCommand)
+	clusterCommand.AddCommand(clusterRepairPeersCommand)
+	clusterCommand.AddCommand(clusterOptionsCommand)
+	clusterCommand.AddCommand(clusterSetOptionsCommand)
+	clusterCommand.AddCommand(clusterCanaryCommand)
+	clusterCommand.AddCommand(clusterStorageClassReportCommand)
+	clusterCommand.AddCommand(clusterRebalanceCommand)
+	clusterCommand.AddCommand(clusterZoneRebalanceCommand)
+	clusterCommand.AddCommand(clusterScoresCommand)
+	clusterCommand.AddCommand(clusterForecastCommand)
+	clusterCommand.AddCommand(clusterCapacityCommand)
 
 	clusterCreateCommand.Flags().BoolVar(&cl_block, "block", true,
 		"\n\tOptional: Allow the user to control the possibility of creating"+
@@ -46,6 +78,17 @@ func init() {
 			"\n\tregular file volumes on the cluster to be created."+
 			"\n\tThis is enabled by default. Use '--file=false' to"+
 			"\n\tdisable creation of file volumes on this cluster.")
+	clusterCreateCommand.Flags().BoolVar(&cl_standby, "standby", false,
+		"\n\tOptional: Create a standby cluster, such as the cluster of"+
+			"\n\ta disaster recovery site. Volumes are only created on a"+
+			"\n\tstandby cluster when requested with its id.")
+	clusterCreateCommand.Flags().BoolVar(&cl_selinux_check, "selinux-check", false,
+		"\n\tOptional: Label the root of the new bricks with the SELinux"+
+			"\n\tcontext of gluster bricks and check the label, on the nodes"+
+			"\n\twith SELinux enabled.")
+	clusterCreateCommand.Flags().BoolVar(&cl_selinux_booleans, "selinux-booleans", false,
+		"\n\tOptional: Turn on the SELinux booleans of the server settings"+
+			"\n\ton the nodes the bricks are created on.")
 
 	clusterSetFlagsCommand.Flags().StringVar(&cl_block_str, "block", "",
 		"\n\tOptional: Allow the user to control the possibility of creating"+
@@ -57,12 +100,93 @@ func init() {
 			"\n\tregular file volumes on the cluster. Use '--file=true'"+
 			"\n\tto enable and '--file=false' to disable creation of"+
 			"\n\tfile volumes on this cluster.")
-
+	clusterSetFlagsCommand.Flags().StringVar(&cl_selinux_check_str, "selinux-check", "",
+		"\n\tOptional: Use '--selinux-check=true' to label the root of the"+
+			"\n\tnew bricks with the SELinux context of gluster bricks and"+
+			"\n\tcheck the label, and '--selinux-check=false' to stop.")
+	clusterSetFlagsCommand.Flags().StringVar(&cl_selinux_booleans_str, "selinux-booleans", "",
+		"\n\tOptional: Use '--selinux-booleans=true' to turn on the SELinux"+
+			"\n\tbooleans of the server settings on the nodes the bricks are"+
+			"\n\tcreated on, and '--selinux-booleans=false' to stop.")
+
+	clusterCanaryCommand.Flags().BoolVar(&cl_last, "last", false,
+		"\n\tOptional: Show the result of the last canary run instead of"+
+			"\n\trunning the canary")
+	clusterStorageClassReportCommand.Flags().IntVar(&size, "size", -1,
+		"\n\tSize of the volumes in GiB")
+	clusterStorageClassReportCommand.Flags().StringVar(&durability, "durability", "replicate",
+		"\n\tOptional: Durability type.  Values are:"+
+			"\n\t\tnone: No durability.  Distributed volume only."+
+			"\n\t\treplicate: (Default) Distributed-Replica volume."+
+			"\n\t\tdisperse: Distributed-Erasure Coded volume.")
+	clusterStorageClassReportCommand.Flags().IntVar(&replica, "replica", 3,
+		"\n\tReplica value for durability type 'replicate'."+
+			"\n\tDefault is 3")
+	clusterStorageClassReportCommand.Flags().IntVar(&disperseData, "disperse-data", 4,
+		"\n\tOptional: Dispersion value for durability type 'disperse'."+
+			"\n\tDefault is 4")
+	clusterStorageClassReportCommand.Flags().IntVar(&redundancy, "redundancy", 2,
+		"\n\tOptional: Redundancy value for durability type 'disperse'."+
+			"\n\tDefault is 2")
+	clusterStorageClassReportCommand.Flags().Float64Var(&snapshotFactor, "snapshot-factor", 1.0,
+		"\n\tOptional: Amount of storage to allocate for snapshot support."+
+			"\n\tMust be greater 1.0")
+	clusterStorageClassReportCommand.Flags().StringVar(&cl_zone_policy, "zone-policy", "",
+		"\n\tOptional: Placement of the bricks of a set in zones. Values are:"+
+			"\n\t\tnone: Zones are not considered."+
+			"\n\t\tbest-effort: Different zones when possible."+
+			"\n\t\tstrict: Always different zones."+
+			"\n\tDefault is the policy of the server")
+	clusterRebalanceCommand.Flags().Float64Var(&cl_band, "band", 0,
+		"\n\tOptional: Maximum distance, in percent, of the utilization of"+
+			"\n\teach device from the mean utilization of the cluster."+
+			"\n\tDefault is the band of the server")
+	clusterRebalanceCommand.Flags().IntVar(&cl_max_moves, "max-moves", 0,
+		"\n\tOptional: Maximum number of bricks moved."+
+			"\n\tDefault is the limit of the server")
+	clusterRebalanceCommand.Flags().IntVar(&cl_interval, "interval", 0,
+		"\n\tOptional: Seconds to wait between two moves."+
+			"\n\tDefault is the interval of the server")
+	clusterRebalanceCommand.Flags().BoolVar(&cl_dry_run, "dry-run", false,
+		"\n\tOptional: Show the bricks that would be moved without"+
+			"\n\tmoving them")
+	clusterZoneRebalanceCommand.Flags().IntVar(&cl_max_moves, "max-moves", 0,
+		"\n\tOptional: Maximum number of bricks moved."+
+			"\n\tDefault is the limit of the server")
+	clusterZoneRebalanceCommand.Flags().IntVar(&cl_interval, "interval", 0,
+		"\n\tOptional: Seconds to wait between two moves."+
+			"\n\tDefault is the interval of the server")
+	clusterZoneRebalanceCommand.Flags().BoolVar(&cl_dry_run, "dry-run", false,
+		"\n\tOptional: Show the sets spread over too few zones and the"+
+			"\n\tbricks that would be moved without moving them")
+	clusterScoresCommand.Flags().IntVar(&cl_size, "size", 0,
+		"\n\tOptional: Size of the sampled bricks in GiB."+
+			"\n\tDefault is 1")
+	clusterScoresCommand.Flags().IntVar(&cl_samples, "samples", 0,
+		"\n\tOptional: Number of bricks sampled."+
+			"\n\tDefault is the number of samples of the server")
+	clusterForecastCommand.Flags().IntVar(&cl_days, "days", 0,
+		"\n\tOptional: Days of capacity samples the forecast is based on."+
+			"\n\tDefault is the number of days of the server")
+	clusterSetOptionsCommand.Flags().StringVar(&cl_set_options, "set", "",
+		"\n\tComma-separated list of options to set, each an option name"+
+			"\n\tand a value separated by a space")
 	clusterCreateCommand.SilenceUsage = true
 	clusterDeleteCommand.SilenceUsage = true
 	clusterInfoCommand.SilenceUsage = true
 	clusterListCommand.SilenceUsage = true
 	clusterSetFlagsCommand.SilenceUsage = true
+	clusterStandbyCommand.SilenceUsage = true
+	clusterPromoteCommand.SilenceUsage = true
+	clusterCanaryCommand.SilenceUsage = true
+	clusterStorageClassReportCommand.SilenceUsage = true
+	clusterRebalanceCommand.SilenceUsage = true
+	clusterZoneRebalanceCommand.SilenceUsage = true
+	clusterScoresCommand.SilenceUsage = true
+	clusterForecastCommand.SilenceUsage = true
+	clusterCapacityCommand.SilenceUsage = true
+	clusterOptionsCommand.SilenceUsage = true
+	clusterSetOptionsCommand.SilenceUsage = true
 }
 
 var clusterCommand = &cobra.Command{
@@ -83,11 +207,17 @@ var clusterCreateCommand = &cobra.Command{
 
   * Create a cluster only for block columes:
       $ heketi-cli cluster create --file=false
+
+  * Create a standby cluster for disaster recovery:
+      $ heketi-cli cluster create --standby
 `,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		req := &api.ClusterCreateRequest{}
 		req.File = cl_file
 		req.Block = cl_block
+		req.Standby = cl_standby
+		req.Selinux.Check = cl_selinux_check
+		req.Selinux.Booleans = cl_selinux_booleans
 
 		// Create a client to talk to Heketi
 		heketi := client.NewClient(options.Url, options.User, options.Key)
@@ -98,12 +228,10 @@ var clusterCreateCommand = &cobra.Command{
 		}
 
 		// Check if JSON should be printed
-		if options.Json {
-			data, err := json.Marshal(cluster)
-			if err != nil {
+		if structuredOutput() {
+			if err := printOutput(cluster); err != nil {
 				return err
 			}
-			fmt.Fprintf(stdout, string(data))
 		} else {
 			fmt.Fprintf(stdout, "Cluster id: %v\n", cluster.Id)
 		}
@@ -121,6 +249,9 @@ var clusterSetFlagsCommand = &cobra.Command{
 
   * Enable the creation of block volumes on a cluster:
       $ heketi-cli cluster set --block=true 886a86a868711bef83001
+
+  * Check the SELinux labels of the new bricks of a cluster:
+      $ heketi-cli cluster setflags --selinux-check=true 886a86a868711bef83001
 `,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		s := cmd.Flags().Args()
@@ -128,8 +259,10 @@ var clusterSetFlagsCommand = &cobra.Command{
 			return errors.New("Cluster id missing")
 		}
 
-		if cl_block_str == "" && cl_file_str == "" {
-			return errors.New("At least one of --file or --block must be specified.")
+		if cl_block_str == "" && cl_file_str == "" &&
+			cl_selinux_check_str == "" && cl_selinux_booleans_str == "" {
+			return errors.New("At least one of --file, --block, --selinux-check" +
+				" or --selinux-booleans must be specified.")
 		}
 
 		clusterId := cmd.Flags().Arg(0)
@@ -161,6 +294,22 @@ var clusterSetFlagsCommand = &cobra.Command{
 			}
 		}
 
+		if cl_selinux_check_str != "" || cl_selinux_booleans_str != "" {
+			req.Selinux = &info.Selinux
+			if cl_selinux_check_str != "" {
+				req.Selinux.Check, err = strconv.ParseBool(cl_selinux_check_str)
+				if err != nil {
+					return err
+				}
+			}
+			if cl_selinux_booleans_str != "" {
+				req.Selinux.Booleans, err = strconv.ParseBool(cl_selinux_booleans_str)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
 		err = heketi.ClusterSetFlags(clusterId, req)
 		if err != nil {
 			return err
@@ -170,6 +319,51 @@ var clusterSetFlagsCommand = &cobra.Command{
 	},
 }
 
+var clusterStandbyCommand = &cobra.Command{
+	Use:   "standby [cluster_id]",
+	Short: "Mark a cluster as a standby cluster",
+	Long: "Mark a cluster as a standby cluster. A standby cluster is not\n" +
+		"selected for new volumes unless the request names the cluster.",
+	Example: "  $ heketi-cli cluster standby 886a86a868711bef83001",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		s := cmd.Flags().Args()
+		if len(s) < 1 {
+			return errors.New("Cluster id missing")
+		}
+		clusterId := cmd.Flags().Arg(0)
+
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+		err := heketi.ClusterSetStandby(clusterId)
+		if err == nil {
+			fmt.Fprintf(statusOut(), "Cluster %v is now a standby cluster\n", clusterId)
+		}
+
+		return err
+	},
+}
+
+var clusterPromoteCommand = &cobra.Command{
+	Use:     "promote [cluster_id]",
+	Short:   "Promote a standby cluster to an active cluster",
+	Long:    "Promote a standby cluster to an active cluster",
+	Example: "  $ heketi-cli cluster promote 886a86a868711bef83001",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		s := cmd.Flags().Args()
+		if len(s) < 1 {
+			return errors.New("Cluster id missing")
+		}
+		clusterId := cmd.Flags().Arg(0)
+
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+		err := heketi.ClusterPromote(clusterId)
+		if err == nil {
+			fmt.Fprintf(statusOut(), "Cluster %v is now an active cluster\n", clusterId)
+		}
+
+		return err
+	},
+}
+
 var clusterDeleteCommand = &cobra.Command{
 	Use:     "delete [cluster_id]",
 	Short:   "Delete the cluster",
@@ -192,7 +386,7 @@ var clusterDeleteCommand = &cobra.Command{
 		//set url
 		err := heketi.ClusterDelete(clusterId)
 		if err == nil {
-			fmt.Fprintf(stdout, "Cluster %v deleted\n", clusterId)
+			fmt.Fprintf(statusOut(), "Cluster %v deleted\n", clusterId)
 		}
 
 		return err
@@ -222,18 +416,36 @@ var clusterInfoCommand = &cobra.Command{
 		}
 
 		// Check if JSON should be printed
-		if options.Json {
-			data, err := json.Marshal(info)
-			if err != nil {
+		if structuredOutput() {
+			if err := printOutput(info); err != nil {
 				return err
 			}
-			fmt.Fprintf(stdout, string(data))
 		} else {
 			fmt.Fprintf(stdout, "Cluster id: %v\n", info.Id)
 			fmt.Fprintf(stdout, "Nodes:\n%v", strings.Join(info.Nodes, "\n"))
 			fmt.Fprintf(stdout, "\nVolumes:\n%v", strings.Join(info.Volumes, "\n"))
 			fmt.Fprintf(stdout, "\nBlock: %v\n", info.Block)
 			fmt.Fprintf(stdout, "\nFile: %v\n", info.File)
+			if info.Standby {
+				fmt.Fprintf(stdout, "Standby: true\n")
+			}
+			if info.Allocator != "" {
+				fmt.Fprintf(stdout, "Allocator: %v\n", info.Allocator)
+			}
+			if info.Selinux.Check || info.Selinux.Booleans {
+				fmt.Fprintf(stdout, "SELinux: check %v, booleans %v\n",
+					info.Selinux.Check, info.Selinux.Booleans)
+			}
+			if info.Capacity != nil {
+				fmt.Fprintf(stdout, "Devices (GiB): total %v, free %v, used %v\n",
+					info.Capacity.Devices.Total/(1024*1024),
+					info.Capacity.Devices.Free/(1024*1024),
+					info.Capacity.Devices.Used/(1024*1024))
+				fmt.Fprintf(stdout, "Volumes (GiB): usable %v, raw %v, allocated %v\n",
+					info.Capacity.Volumes.Usable/(1024*1024),
+					info.Capacity.Volumes.Raw/(1024*1024),
+					info.Capacity.Volumes.Allocated/(1024*1024))
+			}
 		}
 
 		return nil
@@ -255,12 +467,10 @@ var clusterListCommand = &cobra.Command{
 			return err
 		}
 
-		if options.Json {
-			data, err := json.Marshal(list)
-			if err != nil {
+		if structuredOutput() {
+			if err := printOutput(list); err != nil {
 				return err
 			}
-			fmt.Fprintf(stdout, string(data))
 		} else {
 			fmt.Fprintf(stdout, "Clusters:\n")
 			for _, clusterid := range list.Clusters {
@@ -279,6 +489,9 @@ var clusterListCommand = &cobra.Command{
 				if usagestr == "" {
 					usagestr = "[]"
 				}
+				if cluster.Standby {
+					usagestr = usagestr + "[standby]"
+				}
 
 				fmt.Fprintf(stdout, "Id:%v %v\n", clusterid, usagestr)
 			}
@@ -287,3 +500,517 @@ var clusterListCommand = &cobra.Command{
 		return nil
 	},
 }
+
+var clusterRepairPeersCommand = &cobra.Command{
+	Use:     "repair-peers [cluster_id]",
+	Short:   "Detects and repairs the gluster peers of a cluster",
+	Long:    "Probes again missing or disconnected gluster peers of a cluster and reports peers that need manual repair",
+	Example: "  $ heketi-cli cluster repair-peers 886a86a868711bef83001",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		s := cmd.Flags().Args()
+		if len(s) < 1 {
+			return errors.New("Cluster id missing")
+		}
+
+		//set clusterId
+		clusterId := cmd.Flags().Arg(0)
+
+		// Create a client to talk to Heketi
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+
+		repair, err := heketi.ClusterPeerRepair(clusterId)
+		if err != nil {
+			return err
+		}
+
+		// Check if JSON should be printed
+		if structuredOutput() {
+			if err := printOutput(repair); err != nil {
+				return err
+			}
+		} else {
+			fmt.Fprintf(stdout, "Peer status checked from node %v\n", repair.NodeId)
+			for _, p := range repair.Peers {
+				fmt.Fprintf(stdout, "Node: %v Hostname: %v State: %v -> %v Action: %v\n",
+					p.NodeId, p.Hostname, p.Before, p.After, p.Action)
+				if p.Message != "" {
+					fmt.Fprintf(stdout, "    %v\n", p.Message)
+				}
+			}
+		}
+
+		return nil
+	},
+}
+
+func printClusterOptions(options *api.ClusterOptionsResponse) error {
+	if structuredOutput() {
+		return printOutput(options)
+	}
+	names := make([]string, 0, len(options.Options))
+	for name := range options.Options {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(stdout, "%v: %v\n", name, options.Options[name])
+	}
+	return nil
+}
+
+var clusterOptionsCommand = &cobra.Command{
+	Use:     "options [cluster_id]",
+	Short:   "Shows the gluster options of a cluster",
+	Long:    "Shows the gluster options applying to every volume of a cluster",
+	Example: "  $ heketi-cli cluster options 886a86a868711bef83001",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		s := cmd.Flags().Args()
+		if len(s) < 1 {
+			return errors.New("Cluster id missing")
+		}
+
+		//set clusterId
+		clusterId := cmd.Flags().Arg(0)
+
+		// Create a client to talk to Heketi
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+
+		clusterOptions, err := heketi.ClusterOptions(clusterId)
+		if err != nil {
+			return err
+		}
+		return printClusterOptions(clusterOptions)
+	},
+}
+
+var clusterSetOptionsCommand = &cobra.Command{
+	Use:   "set-options [cluster_id]",
+	Short: "Sets gluster options of a cluster",
+	Long: "Sets gluster options applying to every volume of a cluster,\n" +
+		"such as the op-version or the server quorum ratio",
+	Example: `  * Bump the op-version of a cluster
+    $ heketi-cli cluster set-options 886a86a868711bef83001 \
+      --set="cluster.op-version 70200"
+
+  * Change the server quorum ratio of a cluster
+    $ heketi-cli cluster set-options 886a86a868711bef83001 \
+      --set="cluster.server-quorum-ratio 60%"
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		s := cmd.Flags().Args()
+		if len(s) < 1 {
+			return errors.New("Cluster id missing")
+		}
+		if cl_set_options == "" {
+			return errors.New("Options to set missing")
+		}
+
+		//set clusterId
+		clusterId := cmd.Flags().Arg(0)
+
+		req := &api.ClusterOptionsRequest{
+			Set: strings.Split(cl_set_options, ","),
+		}
+
+		// Create a client to talk to Heketi
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+
+		clusterOptions, err := heketi.ClusterSetOptions(clusterId, req)
+		if err != nil {
+			return err
+		}
+		return printClusterOptions(clusterOptions)
+	},
+}
+
+var clusterCanaryCommand = &cobra.Command{
+	Use:   "canary [cluster_id]",
+	Short: "Checks the provisioning of volumes on a cluster",
+	Long: "Creates a small volume on the cluster, writes and reads a file\n" +
+		"on it from one of the nodes and deletes it",
+	Example: `  * Run the canary
+    $ heketi-cli cluster canary 886a86a868711bef83001
+
+  * Show the result of the last canary run
+    $ heketi-cli cluster canary 886a86a868711bef83001 --last
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		s := cmd.Flags().Args()
+		if len(s) < 1 {
+			return errors.New("Cluster id missing")
+		}
+
+		//set clusterId
+		clusterId := cmd.Flags().Arg(0)
+
+		// Create a client to talk to Heketi
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+
+		var result *api.CanaryResult
+		var err error
+		if cl_last {
+			result, err = heketi.ClusterCanaryResult(clusterId)
+		} else {
+			result, err = heketi.ClusterCanary(clusterId)
+		}
+		if err != nil {
+			return err
+		}
+
+		// Check if JSON should be printed
+		if structuredOutput() {
+			if err := printOutput(result); err != nil {
+				return err
+			}
+		} else if result.Success {
+			fmt.Fprintf(stdout, "Canary succeeded in %v ms\n", result.Duration)
+		} else {
+			fmt.Fprintf(stdout, "Canary failed at %v: %v\n",
+				result.Stage, result.Message)
+		}
+
+		return nil
+	},
+}
+
+var clusterStorageClassReportCommand = &cobra.Command{
+	Use:   "storageclass-report",
+	Short: "Reports the clusters able to hold volumes of a spec",
+	Long: "Evaluates every cluster against the size, durability and zone\n" +
+		"placement of a volume and reports how many such volumes fit",
+	Example: `  * Report the clusters able to hold 100GiB replica 3 volumes
+    with the bricks of each set in different zones
+    $ heketi-cli cluster storageclass-report --size=100 --replica=3 \
+      --zone-policy=strict
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Check volume size
+		if size == -1 {
+			return errors.New("Missing volume size")
+		}
+
+		// Create request blob
+		req := &api.StorageClassReportRequest{}
+		req.Size = size
+		req.Durability.Type = api.DurabilityType(durability)
+		req.Durability.Replicate.Replica = replica
+		req.Durability.Disperse.Data = disperseData
+		req.Durability.Disperse.Redundancy = redundancy
+		req.ZonePolicy = cl_zone_policy
+		if snapshotFactor > 1.0 {
+			req.Snapshot.Factor = float32(snapshotFactor)
+			req.Snapshot.Enable = true
+		}
+
+		// Create a client to talk to Heketi
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+
+		report, err := heketi.StorageClassReport(req)
+		if err != nil {
+			return err
+		}
+
+		// Check if JSON should be printed
+		if structuredOutput() {
+			if err := printOutput(report); err != nil {
+				return err
+			}
+			return nil
+		}
+
+		fmt.Fprintf(stdout, "Zone policy: %v\n", report.ZonePolicy)
+		for _, c := range report.Clusters {
+			volumes := strconv.Itoa(c.Volumes)
+			if c.Limited {
+				volumes = "at least " + volumes
+			}
+			if c.Conforms {
+				fmt.Fprintf(stdout, "Id:%v Zones:%v Volumes:%v\n",
+					c.Id, c.Zones, volumes)
+			} else {
+				fmt.Fprintf(stdout, "Id:%v Zones:%v Does not conform: %v\n",
+					c.Id, c.Zones, c.Reason)
+			}
+		}
+
+		return nil
+	},
+}
+
+var clusterRebalanceCommand = &cobra.Command{
+	Use:   "rebalance [cluster_id]",
+	Short: "Evens out the utilization of the devices of a cluster",
+	Long: "Moves bricks from the most utilized devices of the cluster to\n" +
+		"the least utilized ones until every device is within the band\n" +
+		"around the mean utilization",
+	Example: `  * Show the bricks that would be moved
+    $ heketi-cli cluster rebalance 886a86a868711bef83001 --dry-run
+
+  * Rebalance within 5% of the mean, moving at most 10 bricks
+    $ heketi-cli cluster rebalance 886a86a868711bef83001 --band=5 --max-moves=10
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		s := cmd.Flags().Args()
+		if len(s) < 1 {
+			return errors.New("Cluster id missing")
+		}
+
+		//set clusterId
+		clusterId := cmd.Flags().Arg(0)
+
+		req := &api.ClusterRebalanceRequest{
+			Band:     cl_band,
+			MaxMoves: cl_max_moves,
+			Interval: cl_interval,
+		}
+
+		// Create a client to talk to Heketi
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+
+		if !cl_dry_run {
+			err := heketi.ClusterRebalance(clusterId, req)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(statusOut(), "Cluster %v rebalanced\n", clusterId)
+			return nil
+		}
+
+		plan, err := heketi.ClusterRebalancePlan(clusterId, req)
+		if err != nil {
+			return err
+		}
+
+		// Check if JSON should be printed
+		if structuredOutput() {
+			if err := printOutput(plan); err != nil {
+				return err
+			}
+			return nil
+		}
+
+		fmt.Fprintf(stdout, "Mean utilization: %.1f%% Band: %.1f%%\n",
+			plan.Mean, plan.Band)
+		for _, m := range plan.Moves {
+			fmt.Fprintf(stdout, "Brick:%v Volume:%v From:%v To:%v Size (KiB):%v\n",
+				m.BrickId, m.VolumeId, m.From, m.To, m.Size)
+		}
+		for _, d := range plan.Devices {
+			fmt.Fprintf(stdout, "Device:%v Utilization:%.1f%% -> %.1f%%\n",
+				d.Id, d.Before, d.After)
+		}
+		if !plan.Balanced {
+			fmt.Fprintf(stdout, "Some devices remain outside of the band\n")
+		}
+		return nil
+	},
+}
+
+var clusterZoneRebalanceCommand = &cobra.Command{
+	Use:   "zone-rebalance [cluster_id]",
+	Short: "Spreads the bricks of the sets of a cluster across its zones",
+	Long: "Moves bricks of the replica and disperse sets of the cluster\n" +
+		"sharing a zone with other bricks of their set to the zones without\n" +
+		"bricks of the set, as needed once zones are added to the cluster.\n" +
+		"A single brick of a set is moved at a time, so a set needing more\n" +
+		"moves gets them from the next rebalances",
+	Example: `  * Show the sets spread over too few zones and the bricks that would be moved
+    $ heketi-cli cluster zone-rebalance 886a86a868711bef83001 --dry-run
+
+  * Move at most 10 bricks, waiting 10 minutes between two moves
+    $ heketi-cli cluster zone-rebalance 886a86a868711bef83001 --max-moves=10 --interval=600
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		s := cmd.Flags().Args()
+		if len(s) < 1 {
+			return errors.New("Cluster id missing")
+		}
+
+		//set clusterId
+		clusterId := cmd.Flags().Arg(0)
+
+		req := &api.ClusterZoneRebalanceRequest{
+			MaxMoves: cl_max_moves,
+			Interval: cl_interval,
+		}
+
+		// Create a client to talk to Heketi
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+
+		if !cl_dry_run {
+			err := heketi.ClusterZoneRebalance(clusterId, req)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(statusOut(), "Zones of cluster %v rebalanced\n", clusterId)
+			return nil
+		}
+
+		plan, err := heketi.ClusterZoneRebalancePlan(clusterId, req)
+		if err != nil {
+			return err
+		}
+
+		// Check if JSON should be printed
+		if structuredOutput() {
+			if err := printOutput(plan); err != nil {
+				return err
+			}
+			return nil
+		}
+
+		fmt.Fprintf(stdout, "Zones: %v\n", plan.Zones)
+		for _, v := range plan.Violations {
+			fmt.Fprintf(stdout, "Volume:%v Set:%v Zones:%v Desired zones:%v\n",
+				v.VolumeId, v.Set, v.Zones, v.Desired)
+		}
+		for _, m := range plan.Moves {
+			fmt.Fprintf(stdout, "Brick:%v Volume:%v From:%v (zone %v) To:%v (zone %v)\n",
+				m.BrickId, m.VolumeId, m.From, m.FromZone, m.To, m.ToZone)
+		}
+		for _, id := range plan.Skipped {
+			fmt.Fprintf(stdout, "Volume %v skipped, the order of its bricks is not recorded\n", id)
+		}
+		if !plan.Balanced {
+			fmt.Fprintf(stdout, "%v sets remain spread over too few zones\n",
+				plan.Remaining)
+		}
+		return nil
+	},
+}
+
+var clusterScoresCommand = &cobra.Command{
+	Use:   "scores [cluster_id]",
+	Short: "Shows how the allocator prefers the devices of a cluster",
+	Long: "Samples the placement of new bricks in the cluster and shows\n" +
+		"the share of the bricks each device and node would receive,\n" +
+		"along with their free space and health. Nothing is allocated.",
+	Example: `  * Show the placement scores for bricks of 100GiB
+    $ heketi-cli cluster scores 886a86a868711bef83001 --size=100
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		s := cmd.Flags().Args()
+		if len(s) < 1 {
+			return errors.New("Cluster id missing")
+		}
+
+		//set clusterId
+		clusterId := cmd.Flags().Arg(0)
+
+		// Create a client to talk to Heketi
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+
+		scores, err := heketi.ClusterPlacementScores(clusterId, cl_size, cl_samples)
+		if err != nil {
+			return err
+		}
+
+		// Check if JSON should be printed
+		if structuredOutput() {
+			if err := printOutput(scores); err != nil {
+				return err
+			}
+			return nil
+		}
+
+		fmt.Fprintf(stdout, "Allocator: %v Brick size (KiB): %v Samples: %v Unplaced: %.1f%%\n",
+			scores.Allocator, scores.BrickSize, scores.Samples, scores.Unplaced)
+		for _, n := range scores.Nodes {
+			fmt.Fprintf(stdout, "Node:%v Hostname:%v Zone:%v State:%v Health events:%v Score:%.1f%%\n",
+				n.Id, n.Hostname, n.Zone, n.State, n.HealthEvents, n.Score)
+			for _, d := range n.Devices {
+				fmt.Fprintf(stdout, "    Device:%v Name:%v Free:%.1f%% First choice:%.1f%% Score:%.1f%%",
+					d.Id, d.Name, d.FreePercent, d.FirstChoice, d.Score)
+				if !d.Eligible {
+					fmt.Fprintf(stdout, " Not eligible:%v", d.Reason)
+				}
+				fmt.Fprintf(stdout, "\n")
+			}
+		}
+		return nil
+	},
+}
+
+var clusterForecastCommand = &cobra.Command{
+	Use:   "forecast [cluster_id]",
+	Short: "Projects when the devices of a cluster will be full",
+	Long: "Projects the days until the devices of a cluster are full from\n" +
+		"the growth of their used capacity in the daily samples taken by\n" +
+		"the server.",
+	Example: `  * Show the forecast based on the last 60 days
+    $ heketi-cli cluster forecast 886a86a868711bef83001 --days=60
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		s := cmd.Flags().Args()
+		if len(s) < 1 {
+			return errors.New("Cluster id missing")
+		}
+
+		//set clusterId
+		clusterId := cmd.Flags().Arg(0)
+
+		// Create a client to talk to Heketi
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+
+		forecast, err := heketi.ClusterCapacityForecast(clusterId, cl_days)
+		if err != nil {
+			return err
+		}
+
+		// Check if JSON should be printed
+		if structuredOutput() {
+			return printOutput(forecast)
+		}
+
+		fmt.Fprintf(stdout, "Total (GiB): %v Used (GiB): %v Samples: %v in %v days\n",
+			forecast.Total/(1024*1024), forecast.Used/(1024*1024),
+			len(forecast.Samples), forecast.Days)
+		fmt.Fprintf(stdout, "Growth (GiB/day): %.2f\n",
+			float64(forecast.GrowthPerDay)/(1024*1024))
+		if forecast.DaysToFull < 0 {
+			fmt.Fprintf(stdout, "Full: not projected\n")
+		} else {
+			fmt.Fprintf(stdout, "Full: in %v days, on %v\n",
+				forecast.DaysToFull, forecast.FullDate)
+		}
+		return nil
+	},
+}
+
+var clusterCapacityCommand = &cobra.Command{
+	Use:   "capacity",
+	Short: "Reports the capacity of the devices of every cluster",
+	Long: "Reports the raw, allocated and free capacity of the devices of\n" +
+		"every cluster and of their nodes, and the estimated size of the\n" +
+		"largest replica 3 volume each cluster can hold.",
+	Example: "  $ heketi-cli cluster capacity",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Create a client to talk to Heketi
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+
+		report, err := heketi.CapacityReport()
+		if err != nil {
+			return err
+		}
+
+		// Check if JSON should be printed
+		if structuredOutput() {
+			return printOutput(report)
+		}
+
+		gib := func(kb uint64) uint64 { return kb / (1024 * 1024) }
+		for _, c := range report.Clusters {
+			fmt.Fprintf(stdout, "Cluster: %v Raw (GiB): %v Allocated (GiB): %v "+
+				"Metadata (GiB): %v Free (GiB): %v Max replica 3 volume (GiB): %v\n",
+				c.Id, gib(c.Raw), gib(c.Allocated), gib(c.MetadataReserved),
+				gib(c.Free), gib(c.MaxReplica3VolumeSize))
+			for _, n := range c.Nodes {
+				fmt.Fprintf(stdout, "    Node: %v Hostname: %v State: %v Raw (GiB): %v "+
+					"Allocated (GiB): %v Free (GiB): %v Max brick (GiB): %v\n",
+					n.Id, n.Hostname, n.State, gib(n.Raw), gib(n.Allocated),
+					gib(n.Free), gib(n.MaxBrickSize))
+			}
+		}
+		return nil
+	},
+}
@@ -10,7 +10,10 @@
 package cmds
 
 import (
+	"encoding/json"
 	"fmt"
+	"os"
+	"strings"
 
 	client "github.com/heketi/heketi/client/api/go-client"
 	"github.com/spf13/cobra"
@@ -20,8 +23,23 @@ func init() {
 	RootCmd.AddCommand(dbCommand)
 	dbCommand.AddCommand(dumpDbCommand)
 	dumpDbCommand.SilenceUsage = true
+	dbCommand.AddCommand(statsDbCommand)
+	statsDbCommand.Flags().StringVar(&dbStatsPrefix, "prefix", "",
+		"\n\tOptional: Only count the entries with keys starting with the prefix")
+	statsDbCommand.Flags().IntVar(&dbStatsLargest, "largest", -1,
+		"\n\tOptional: Number of largest entries shown for each bucket")
+	statsDbCommand.SilenceUsage = true
+	dbCommand.AddCommand(checkDbCommand)
+	checkDbCommand.SilenceUsage = true
+	dbCommand.AddCommand(importDbCommand)
+	importDbCommand.SilenceUsage = true
 }
 
+var (
+	dbStatsPrefix  string
+	dbStatsLargest int
+)
+
 var dbCommand = &cobra.Command{
 	Use:   "db",
 	Short: "Heketi Database Management",
@@ -41,8 +59,106 @@ var dumpDbCommand = &cobra.Command{
 			return err
 		}
 
+		if structuredOutput() {
+			var db interface{}
+			d := json.NewDecoder(strings.NewReader(dump))
+			d.UseNumber()
+			if err := d.Decode(&db); err != nil {
+				return err
+			}
+			return printOutput(db)
+		}
 		fmt.Fprintf(stdout, dump)
 
 		return nil
 	},
 }
+
+var statsDbCommand = &cobra.Command{
+	Use:   "stats",
+	Short: "shows the number of entries and size of each bucket of the database",
+	Long: "shows the number of entries and size of each bucket of the database\n" +
+		"and its largest entries",
+	Example: `  $ heketi-cli db stats
+  $ heketi-cli db stats --largest=10
+  $ heketi-cli db stats --prefix=8d8e`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+
+		stats, err := heketi.DbStats(dbStatsPrefix, dbStatsLargest)
+		if err != nil {
+			return err
+		}
+
+		if structuredOutput() {
+			if err := printOutput(stats); err != nil {
+				return err
+			}
+		} else {
+			fmt.Fprintf(stdout, "Db Size: %v bytes\n", stats.DbSize)
+			for _, b := range stats.Buckets {
+				fmt.Fprintf(stdout, "Bucket:%v Entries:%v Size:%v\n",
+					b.Name, b.Entries, b.Size)
+				for _, e := range b.Largest {
+					fmt.Fprintf(stdout, "    %v %v\n", e.Key, e.Size)
+				}
+			}
+		}
+
+		return nil
+	},
+}
+
+var checkDbCommand = &cobra.Command{
+	Use:   "check",
+	Short: "reports the inconsistencies between the entries of the database",
+	Long: "reports the entries of the database referring to missing entries,\n" +
+		"missing from the lists of the entries they belong to, and the devices\n" +
+		"whose used storage differs from their bricks. Use heketi db check\n" +
+		"on the db file of the stopped server to repair them.",
+	Example: "  $ heketi-cli db check",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+
+		check, err := heketi.DbCheck()
+		if err != nil {
+			return err
+		}
+
+		if structuredOutput() {
+			return printOutput(check)
+		}
+		for _, i := range check.Issues {
+			fmt.Fprintf(stdout, "%v %v %v: %v\n", i.Type, i.Kind, i.Id, i.Message)
+		}
+		fmt.Fprintf(statusOut(), "%v issues found\n", len(check.Issues))
+		return nil
+	},
+}
+
+var importDbCommand = &cobra.Command{
+	Use:   "import <dump file>",
+	Short: "imports a dump of a database into the empty database of the server",
+	Long: "imports a dump of a database in json format, as written by\n" +
+		"heketi-cli db dump or heketi db export, into the empty database\n" +
+		"of the server",
+	Example: `  $ heketi-cli db dump > heketi-db.json
+  $ heketi-cli --server=http://new-server:8080 db import heketi-db.json`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return fmt.Errorf("Dump file missing")
+		}
+		fp, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer fp.Close()
+
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+		if err := heketi.DbImport(fp); err != nil {
+			return err
+		}
+		fmt.Fprintf(statusOut(), "Database imported\n")
+		return nil
+	},
+}
@@ -10,9 +10,9 @@
 package cmds
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/heketi/heketi/client/api/go-client"
 	"github.com/heketi/heketi/pkg/glusterfs/api"
@@ -20,7 +20,10 @@ import (
 )
 
 var (
-	device, nodeId string
+	device, nodeId  string
+	deviceEnclosure string
+	gcAction        string
+	brickDest       api.BrickDestination
 )
 
 func init() {
@@ -28,19 +31,49 @@ func init() {
 	deviceCommand.AddCommand(deviceAddCommand)
 	deviceCommand.AddCommand(deviceDeleteCommand)
 	deviceCommand.AddCommand(deviceRemoveCommand)
+	deviceCommand.AddCommand(deviceReplaceBricksCommand)
 	deviceCommand.AddCommand(deviceInfoCommand)
 	deviceCommand.AddCommand(deviceEnableCommand)
 	deviceCommand.AddCommand(deviceDisableCommand)
+	deviceCommand.AddCommand(deviceSetStateCommand)
 	deviceCommand.AddCommand(deviceResyncCommand)
+	deviceCommand.AddCommand(deviceGcCommand)
+	deviceCommand.AddCommand(deviceSetTagsCommand)
+	deviceCommand.AddCommand(deviceRmTagsCommand)
+	deviceCommand.AddCommand(deviceSetEnclosureCommand)
+	deviceCommand.AddCommand(deviceLvmCommand)
 	deviceAddCommand.Flags().StringVar(&device, "name", "",
 		"Name of device to add")
 	deviceAddCommand.Flags().StringVar(&nodeId, "node", "",
 		"Id of the node which has this device")
+	deviceAddCommand.Flags().StringVar(&deviceEnclosure, "enclosure", "",
+		"Optional: Id of the enclosure, such as an external JBOD, of the device")
 	deviceAddCommand.SilenceUsage = true
 	deviceDeleteCommand.SilenceUsage = true
 	deviceRemoveCommand.SilenceUsage = true
+	deviceReplaceBricksCommand.SilenceUsage = true
+	for _, cmd := range []*cobra.Command{deviceRemoveCommand, deviceReplaceBricksCommand} {
+		cmd.Flags().StringVar(&brickDest.Device, "destination-device", "",
+			"Optional: Id of the device the new bricks are placed on")
+		cmd.Flags().StringVar(&brickDest.Node, "destination-node", "",
+			"Optional: Id of the node whose devices the new bricks are placed on")
+	}
 	deviceInfoCommand.SilenceUsage = true
 	deviceResyncCommand.SilenceUsage = true
+	deviceGcCommand.Flags().StringVar(&gcAction, "action", "",
+		"Optional: Action taken on the orphaned bricks, cleanup to delete them")
+	deviceGcCommand.SilenceUsage = true
+	deviceSetTagsCommand.Flags().BoolVar(&tagsExact, "exact", false,
+		"Replace all the tags of the device with the given tags")
+	deviceRmTagsCommand.Flags().BoolVar(&tagsAll, "all", false,
+		"Remove all the tags of the device")
+	deviceSetTagsCommand.SilenceUsage = true
+	deviceRmTagsCommand.SilenceUsage = true
+	deviceSetEnclosureCommand.SilenceUsage = true
+	deviceLvmCommand.SilenceUsage = true
+	addStateReasonFlags(deviceDisableCommand)
+	addStateFlags(deviceSetStateCommand)
+	deviceSetStateCommand.SilenceUsage = true
 }
 
 var deviceCommand = &cobra.Command{
@@ -69,6 +102,7 @@ var deviceAddCommand = &cobra.Command{
 		req := &api.DeviceAddRequest{}
 		req.Name = device
 		req.NodeId = nodeId
+		req.Enclosure = deviceEnclosure
 
 		// Create a client
 		heketi := client.NewClient(options.Url, options.User, options.Key)
@@ -78,7 +112,7 @@ var deviceAddCommand = &cobra.Command{
 		if err != nil {
 			return err
 		} else {
-			fmt.Fprintf(stdout, "Device added successfully\n")
+			fmt.Fprintf(statusOut(), "Device added successfully\n")
 		}
 
 		return nil
@@ -107,7 +141,7 @@ var deviceDeleteCommand = &cobra.Command{
 		//set url
 		err := heketi.DeviceDelete(deviceId)
 		if err == nil {
-			fmt.Fprintf(stdout, "Device %v deleted\n", deviceId)
+			fmt.Fprintf(statusOut(), "Device %v deleted\n", deviceId)
 		}
 
 		return err
@@ -117,7 +151,7 @@ var deviceDeleteCommand = &cobra.Command{
 var deviceRemoveCommand = &cobra.Command{
 	Use:     "remove [device_id]",
 	Short:   "Removes a device from Heketi node",
-	Long:    "Removes a device from Heketi node",
+	Long:    "Moves all bricks off a device so that it can be deleted",
 	Example: "  $ heketi-cli device remove 886a86a868711bef83001",
 	RunE: func(cmd *cobra.Command, args []string) error {
 		s := cmd.Flags().Args()
@@ -133,13 +167,40 @@ var deviceRemoveCommand = &cobra.Command{
 		// Create a client
 		heketi := client.NewClient(options.Url, options.User, options.Key)
 
-		//set url
-		req := &api.StateRequest{
-			State: "failed",
+		// Migrate the bricks off the device
+		err := heketi.DeviceRemoveTo(deviceId, &brickDest)
+		if err == nil {
+			fmt.Fprintf(statusOut(), "Device %v is now removed\n", deviceId)
 		}
-		err := heketi.DeviceState(deviceId, req)
+
+		return err
+	},
+}
+
+var deviceReplaceBricksCommand = &cobra.Command{
+	Use:   "replace-bricks [device_id]",
+	Short: "Replaces all the bricks of a device",
+	Long: "Replaces all the bricks of a device with bricks on other devices. " +
+		"The destinations of all the bricks are planned before any brick " +
+		"is replaced",
+	Example: "  $ heketi-cli device replace-bricks 886a86a868711bef83001",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		s := cmd.Flags().Args()
+
+		//ensure proper number of args
+		if len(s) < 1 {
+			return errors.New("Device id missing")
+		}
+
+		deviceId := cmd.Flags().Arg(0)
+
+		// Create a client
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+
+		// Replace the bricks of the device
+		_, err := heketi.DeviceReplaceBricksTo(deviceId, &brickDest)
 		if err == nil {
-			fmt.Fprintf(stdout, "Device %v is now removed\n", deviceId)
+			fmt.Fprintf(statusOut(), "Bricks of device %v are now replaced\n", deviceId)
 		}
 
 		return err
@@ -175,12 +236,10 @@ var deviceInfoCommand = &cobra.Command{
 			info.State = entryStateRemoved
 		}
 
-		if options.Json {
-			data, err := json.Marshal(info)
-			if err != nil {
+		if structuredOutput() {
+			if err := printOutput(info); err != nil {
 				return err
 			}
-			fmt.Fprintf(stdout, string(data))
 		} else {
 			fmt.Fprintf(stdout, "Device Id: %v\n"+
 				"Name: %v\n"+
@@ -194,6 +253,19 @@ var deviceInfoCommand = &cobra.Command{
 				info.Storage.Total/(1024*1024),
 				info.Storage.Used/(1024*1024),
 				info.Storage.Free/(1024*1024))
+			if info.Storage.SnapshotOverhead > 0 {
+				fmt.Fprintf(stdout, "Snapshot Overhead (GiB): %v\n",
+					info.Storage.SnapshotOverhead/(1024*1024))
+			}
+			if len(info.Tags) > 0 {
+				fmt.Fprintf(stdout, "Tags: %v\n", formatTags(info.Tags))
+			}
+			if info.Enclosure != "" {
+				fmt.Fprintf(stdout, "Enclosure: %v\n", info.Enclosure)
+			}
+			if info.StateReason != nil {
+				fmt.Fprintf(stdout, "State Reason: %v\n", formatStateReason(info.StateReason))
+			}
 
 			fmt.Fprintf(stdout, "Bricks:\n")
 			for _, d := range info.Bricks {
@@ -235,7 +307,7 @@ var deviceEnableCommand = &cobra.Command{
 		}
 		err := heketi.DeviceState(deviceId, req)
 		if err == nil {
-			fmt.Fprintf(stdout, "Device %v is now online\n", deviceId)
+			fmt.Fprintf(statusOut(), "Device %v is now online\n", deviceId)
 		}
 
 		return err
@@ -246,7 +318,7 @@ var deviceDisableCommand = &cobra.Command{
 	Use:     "disable [device_id]",
 	Short:   "Disallow usage of a device by placing it offline",
 	Long:    "Disallow usage of a device by placing it offline",
-	Example: "  $ heketi-cli device disable 886a86a868711bef83001",
+	Example: "  $ heketi-cli device disable 886a86a868711bef83001 --reason=hardware-failure",
 	RunE: func(cmd *cobra.Command, args []string) error {
 		s := cmd.Flags().Args()
 
@@ -261,23 +333,99 @@ var deviceDisableCommand = &cobra.Command{
 		// Create a client
 		heketi := client.NewClient(options.Url, options.User, options.Key)
 
+		if stateReason == "" {
+			return errors.New("Reason missing")
+		}
+
 		//set url
 		req := &api.StateRequest{
-			State: "offline",
+			State:   "offline",
+			Reason:  api.StateReasonCode(stateReason),
+			Message: stateMessage,
 		}
 		err := heketi.DeviceState(deviceId, req)
 		if err == nil {
-			fmt.Fprintf(stdout, "Device %v is now offline\n", deviceId)
+			fmt.Fprintf(statusOut(), "Device %v is now offline\n", deviceId)
+		}
+
+		return err
+	},
+}
+
+var deviceSetStateCommand = &cobra.Command{
+	Use:   "set-state [device_id]",
+	Short: "Sets the state of a device",
+	Long: "Sets the state of a device. Draining and maintenance devices, like " +
+		"offline devices, keep their bricks but get no new bricks",
+	Example: "  $ heketi-cli device set-state 886a86a868711bef83001 --state=draining --reason=decommissioned",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(cmd.Flags().Args()) < 1 {
+			return errors.New("device id missing")
+		}
+		deviceId := cmd.Flags().Arg(0)
+
+		req, err := stateRequest()
+		if err != nil {
+			return err
 		}
 
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+		err = heketi.DeviceState(deviceId, req)
+		if err == nil {
+			fmt.Fprintf(statusOut(), "Device %v is now %v\n", deviceId, req.State)
+		}
 		return err
 	},
 }
 
+var deviceLvmCommand = &cobra.Command{
+	Use:     "lvm [device_id]",
+	Short:   "Shows the volume group and logical volumes of the device",
+	Long:    "Shows the volume group and logical volumes of the device",
+	Example: "  $ heketi-cli device lvm 886a86a868711bef83001",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		s := cmd.Flags().Args()
+		if len(s) < 1 {
+			return errors.New("Device id missing")
+		}
+		deviceId := cmd.Flags().Arg(0)
+
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+		lvm, err := heketi.DeviceLvm(deviceId)
+		if err != nil {
+			return err
+		}
+
+		if structuredOutput() {
+			return printOutput(lvm)
+		}
+		fmt.Fprintf(stdout, "Device Id: %v\n"+
+			"Name: %v\n"+
+			"Volume Group: %v\n"+
+			"Bricks:\n",
+			lvm.Id,
+			lvm.Name,
+			lvm.Vg)
+		for _, b := range lvm.Bricks {
+			tp, lv := b.ThinPool, b.Lv
+			if tp == "" {
+				tp = "(gluster)"
+			}
+			if lv == "" {
+				lv = "(gluster)"
+			}
+			fmt.Fprintf(stdout, "Id:%-35v Volume:%-35v ThinPool:%-40v Lv:%-40v Path:%v\n",
+				b.Id, b.VolumeId, tp, lv, b.Path)
+		}
+		return nil
+	},
+}
+
 var deviceResyncCommand = &cobra.Command{
-	Use:     "resync [device_id]",
-	Short:   "Resync storage information about the device with operation system",
-	Long:    "Resync storage information about the device with operation system",
+	Use:   "resync [device_id]",
+	Short: "Resync storage information about the device with operation system",
+	Long: "Resync storage information about the device with operation system" +
+		"\nand report the logical volumes of the device not used by any brick",
 	Example: "  $ heketi-cli device resync 886a86a868711bef83001",
 	RunE: func(cmd *cobra.Command, args []string) error {
 		//ensure proper number of args
@@ -292,12 +440,182 @@ var deviceResyncCommand = &cobra.Command{
 		// Create a client
 		heketi := client.NewClient(options.Url, options.User, options.Key)
 
-		//set url
-		err := heketi.DeviceResync(deviceId)
-		if err == nil {
-			fmt.Fprintf(stdout, "Device %v updated\n", nodeId)
+		resp, err := heketi.DeviceResyncReport(deviceId)
+		if err != nil {
+			return err
+		}
+
+		if structuredOutput() {
+			return printOutput(resp)
+		}
+		fmt.Fprintf(statusOut(), "Device %v updated\n", deviceId)
+		if resp.OldStorage != resp.Storage {
+			fmt.Fprintf(stdout, "Size (GiB): %v -> %v\n",
+				resp.OldStorage.Total/(1024*1024), resp.Storage.Total/(1024*1024))
+			fmt.Fprintf(stdout, "Free (GiB): %v -> %v\n",
+				resp.OldStorage.Free/(1024*1024), resp.Storage.Free/(1024*1024))
+		}
+		for _, lv := range resp.OrphanedLvs {
+			fmt.Fprintf(stdout, "Logical volume %v is not used by any brick\n", lv)
+		}
+		return nil
+	},
+}
+
+var deviceGcCommand = &cobra.Command{
+	Use:   "gc",
+	Short: "Compares the logical volumes of the devices with the bricks",
+	Long: "Reports the logical volumes of the devices not used by any brick" +
+		"\nand the bricks whose logical volumes are missing",
+	Example: `  * Report the orphaned and missing bricks
+      $ heketi-cli device gc
+
+  * Delete the orphaned bricks
+      $ heketi-cli device gc --action=cleanup
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		req := &api.BrickGcRequest{
+			Action: gcAction,
+		}
+
+		// Create a client
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+
+		gc, err := heketi.BrickGc(req)
+		if err != nil {
+			return err
+		}
+
+		if structuredOutput() {
+			return printOutput(gc)
+		}
+		for _, d := range gc.Devices {
+			fmt.Fprintf(stdout, "Device: %v\n", d.DeviceId)
+			fmt.Fprintf(stdout, "    Orphaned: %v\n", strings.Join(d.Orphaned, " "))
+			fmt.Fprintf(stdout, "    Missing: %v\n", strings.Join(d.Missing, " "))
+			if len(d.Removed) > 0 {
+				fmt.Fprintf(stdout, "    Removed: %v\n", strings.Join(d.Removed, " "))
+			}
+			for _, e := range d.Errors {
+				fmt.Fprintf(stdout, "    Error: %v\n", e)
+			}
+		}
+		return nil
+	},
+}
+
+var deviceSetTagsCommand = &cobra.Command{
+	Use:   "settags [device_id] [key:value]...",
+	Short: "Sets tags on the device",
+	Long:  "Adds tags to the device, replacing the values of existing keys",
+	Example: `  * Tag the device with its rack
+    $ heketi-cli device settags 886a86a868711bef83001 rack:r1
+
+  * Replace all the tags of the device
+    $ heketi-cli device settags 886a86a868711bef83001 rack:r2 media:ssd --exact
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		s := cmd.Flags().Args()
+		if len(s) < 1 {
+			return errors.New("Device id missing")
+		}
+		if len(s) < 2 && !tagsExact {
+			return errors.New("Tags missing")
+		}
+		deviceId := cmd.Flags().Arg(0)
+
+		req := &api.TagsChangeRequest{
+			Change: api.UpdateTags,
+		}
+		if tagsExact {
+			req.Change = api.SetTags
+		}
+		var err error
+		req.Tags, err = parseTags(s[1:], false)
+		if err != nil {
+			return err
+		}
+
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+		info, err := heketi.DeviceSetTags(deviceId, req)
+		if err != nil {
+			return err
+		}
+		if structuredOutput() {
+			return printOutput(info)
+		}
+		fmt.Fprintf(stdout, "Tags of device %v: %v\n", deviceId, formatTags(info.Tags))
+		return nil
+	},
+}
+
+var deviceRmTagsCommand = &cobra.Command{
+	Use:     "rmtags [device_id] [key]...",
+	Short:   "Removes tags from the device",
+	Long:    "Removes tags from the device",
+	Example: "  $ heketi-cli device rmtags 886a86a868711bef83001 rack",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		s := cmd.Flags().Args()
+		if len(s) < 1 {
+			return errors.New("Device id missing")
+		}
+		if len(s) < 2 && !tagsAll {
+			return errors.New("Tag keys missing")
+		}
+		deviceId := cmd.Flags().Arg(0)
+
+		req := &api.TagsChangeRequest{
+			Change: api.DeleteTags,
+		}
+		if tagsAll {
+			req.Change = api.SetTags
+		} else {
+			var err error
+			req.Tags, err = parseTags(s[1:], true)
+			if err != nil {
+				return err
+			}
 		}
 
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+		info, err := heketi.DeviceSetTags(deviceId, req)
+		if err != nil {
+			return err
+		}
+		if structuredOutput() {
+			return printOutput(info)
+		}
+		fmt.Fprintf(stdout, "Tags of device %v: %v\n", deviceId, formatTags(info.Tags))
+		return nil
+	},
+}
+
+var deviceSetEnclosureCommand = &cobra.Command{
+	Use:   "setenclosure [device_id] [enclosure]",
+	Short: "Sets the enclosure of the device",
+	Long: "Sets the enclosure, such as an external JBOD, of the device." +
+		" Without an enclosure the device is removed from its enclosure",
+	Example: "  $ heketi-cli device setenclosure 886a86a868711bef83001 jbod1",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		s := cmd.Flags().Args()
+		if len(s) < 1 {
+			return errors.New("Device id missing")
+		}
+		deviceId := cmd.Flags().Arg(0)
+
+		req := &api.DeviceEnclosureRequest{
+			Enclosure: cmd.Flags().Arg(1),
+		}
+
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+		info, err := heketi.DeviceSetEnclosure(deviceId, req)
+		if err != nil {
+			return err
+		}
+		if structuredOutput() {
+			return printOutput(info)
+		}
+		fmt.Fprintf(stdout, "Enclosure of device %v: %v\n", deviceId, info.Enclosure)
 		return nil
 	},
 }
@@ -339,7 +339,7 @@ var setupHeketiStorageCommand = &cobra.Command{
 		list.Items = append(list.Items, job)
 
 		// Save list
-		fmt.Fprintf(stdout, "Saving %v\n", heketiStorageListFilename)
+		fmt.Fprintf(statusOut(), "Saving %v\n", heketiStorageListFilename)
 		err = saveJson(list, heketiStorageListFilename)
 		if err != nil {
 			return err
@@ -0,0 +1,79 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package cmds
+
+import (
+	"errors"
+	"fmt"
+
+	client "github.com/heketi/heketi/client/api/go-client"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	RootCmd.AddCommand(logLevelCommand)
+	logLevelCommand.AddCommand(logLevelGetCommand)
+	logLevelCommand.AddCommand(logLevelSetCommand)
+	logLevelGetCommand.SilenceUsage = true
+	logLevelSetCommand.SilenceUsage = true
+}
+
+var logLevelCommand = &cobra.Command{
+	Use:   "loglevel",
+	Short: "Heketi Server Log Level Management",
+	Long:  "Show and change the log level of the server while it is running",
+}
+
+func printLogLevel(resp *api.LogLevelResponse) error {
+	if structuredOutput() {
+		return printOutput(resp)
+	}
+	fmt.Fprintf(stdout, "Level: %v\nFormat: %v\n", resp.Level, resp.Format)
+	return nil
+}
+
+var logLevelGetCommand = &cobra.Command{
+	Use:     "get",
+	Short:   "Show the log level of the server",
+	Long:    "Show the log level and the log format of the server",
+	Example: "  $ heketi-cli loglevel get",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+		resp, err := heketi.LogLevel()
+		if err != nil {
+			return err
+		}
+		return printLogLevel(resp)
+	},
+}
+
+var logLevelSetCommand = &cobra.Command{
+	Use:   "set [none|critical|error|warning|info|debug]",
+	Short: "Change the log level of the server",
+	Long: "Change the log level of the server and of its executor." +
+		"\nThe level is kept until the server is restarted.",
+	Example: "  $ heketi-cli loglevel set debug",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		s := cmd.Flags().Args()
+
+		//ensure proper number of args
+		if len(s) < 1 {
+			return errors.New("Log level missing")
+		}
+
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+		resp, err := heketi.LogLevelSet(&api.LogLevelRequest{Level: s[0]})
+		if err != nil {
+			return err
+		}
+		return printLogLevel(resp)
+	},
+}
@@ -10,9 +10,11 @@
 package cmds
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/heketi/heketi/client/api/go-client"
 	"github.com/heketi/heketi/pkg/glusterfs/api"
@@ -24,6 +26,15 @@ var (
 	managmentHostNames string
 	storageHostNames   string
 	clusterId          string
+	addressFamily      string
+	nodeRemoveStatus   bool
+	nodeRestartStatus  bool
+	nodeHealTimeout    int
+	tagsExact          bool
+	tagsAll            bool
+	stateReason        string
+	stateMessage       string
+	entryState         string
 )
 
 func init() {
@@ -33,17 +44,89 @@ func init() {
 	nodeCommand.AddCommand(nodeInfoCommand)
 	nodeCommand.AddCommand(nodeEnableCommand)
 	nodeCommand.AddCommand(nodeDisableCommand)
+	nodeCommand.AddCommand(nodeSetStateCommand)
 	nodeCommand.AddCommand(nodeListCommand)
 	nodeCommand.AddCommand(nodeRemoveCommand)
+	nodeCommand.AddCommand(nodeRestartBricksCommand)
+	nodeCommand.AddCommand(nodeSetTagsCommand)
+	nodeCommand.AddCommand(nodeRmTagsCommand)
 	nodeAddCommand.Flags().IntVar(&zone, "zone", -1, "The zone in which the node should reside")
 	nodeAddCommand.Flags().StringVar(&clusterId, "cluster", "", "The cluster in which the node should reside")
 	nodeAddCommand.Flags().StringVar(&managmentHostNames, "management-host-name", "", "Management host name")
-	nodeAddCommand.Flags().StringVar(&storageHostNames, "storage-host-name", "", "Storage host name")
+	nodeAddCommand.Flags().StringVar(&storageHostNames, "storage-host-name", "",
+		"Storage host name. Comma separated list of an IPv4 and an IPv6 address for dual-stack nodes")
+	nodeAddCommand.Flags().StringVar(&addressFamily, "address-family", "",
+		"Optional: Address family of the storage address used by gluster on dual-stack nodes: inet or inet6")
 	nodeAddCommand.SilenceUsage = true
 	nodeDeleteCommand.SilenceUsage = true
 	nodeInfoCommand.SilenceUsage = true
 	nodeListCommand.SilenceUsage = true
+	nodeRemoveCommand.Flags().BoolVar(&nodeRemoveStatus, "status", false,
+		"Show the progress of the last removal of the node")
 	nodeRemoveCommand.SilenceUsage = true
+	nodeRestartBricksCommand.Flags().BoolVar(&nodeRestartStatus, "status", false,
+		"Show the progress of the last restart of the bricks of the node")
+	nodeRestartBricksCommand.Flags().IntVar(&nodeHealTimeout, "heal-timeout", 0,
+		"Optional: Seconds to wait for the heal of each volume before the next "+
+			"volume is restarted. Defaults to the server setting")
+	nodeRestartBricksCommand.SilenceUsage = true
+	nodeSetTagsCommand.Flags().BoolVar(&tagsExact, "exact", false,
+		"Replace all the tags of the node with the given tags")
+	nodeRmTagsCommand.Flags().BoolVar(&tagsAll, "all", false,
+		"Remove all the tags of the node")
+	nodeSetTagsCommand.SilenceUsage = true
+	nodeRmTagsCommand.SilenceUsage = true
+	addStateReasonFlags(nodeDisableCommand)
+	addStateFlags(nodeSetStateCommand)
+	nodeSetStateCommand.SilenceUsage = true
+}
+
+// addStateReasonFlags adds the flags giving why a node or device is
+// taken offline
+func addStateReasonFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&stateReason, "reason", "",
+		"Why the state is changed: maintenance, hardware-failure, "+
+			"unreachable, decommissioned or other")
+	cmd.Flags().StringVar(&stateMessage, "message", "",
+		"Optional: Description of the reason, required for reason other")
+}
+
+// addStateFlags adds the flags of the commands setting the state of a
+// node or device
+func addStateFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&entryState, "state", "",
+		"New state: online, offline, draining, maintenance or failed")
+	addStateReasonFlags(cmd)
+}
+
+// stateRequest returns the request setting the state given by the flags
+func stateRequest() (*api.StateRequest, error) {
+	if entryState == "" {
+		return nil, errors.New("State missing")
+	}
+	state := api.EntryState(entryState)
+	if err := api.ValidateEntryState(state); err != nil {
+		return nil, err
+	}
+	if state != api.EntryStateOnline && stateReason == "" {
+		return nil, errors.New("Reason missing")
+	}
+	return &api.StateRequest{
+		State:   state,
+		Reason:  api.StateReasonCode(stateReason),
+		Message: stateMessage,
+	}, nil
+}
+
+func formatStateReason(r *api.StateReason) string {
+	s := fmt.Sprintf("%v at %v", r.Code, time.Unix(r.Time, 0).Format(time.RFC3339))
+	if r.Actor != "" {
+		s += " by " + r.Actor
+	}
+	if r.Message != "" {
+		s += ": " + r.Message
+	}
+	return s
 }
 
 var nodeCommand = &cobra.Command{
@@ -61,6 +144,14 @@ var nodeAddCommand = &cobra.Command{
       --cluster=3e098cb4407d7109806bb196d9e8f095 \
       --management-host-name=node1-manage.gluster.lab.com \
       --storage-host-name=node1-storage.gluster.lab.com
+
+  * Add a dual-stack node using its IPv6 storage address
+      $ heketi-cli node add \
+      --zone=3 \
+      --cluster=3e098cb4407d7109806bb196d9e8f095 \
+      --management-host-name=node1-manage.gluster.lab.com \
+      --storage-host-name=192.168.10.101,fd00::101 \
+      --address-family=inet6
 `,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		// Check arguments
@@ -81,8 +172,9 @@ var nodeAddCommand = &cobra.Command{
 		req := &api.NodeAddRequest{}
 		req.ClusterId = clusterId
 		req.Hostnames.Manage = []string{managmentHostNames}
-		req.Hostnames.Storage = []string{storageHostNames}
+		req.Hostnames.Storage = strings.Split(storageHostNames, ",")
 		req.Zone = zone
+		req.AddressFamily = addressFamily
 
 		// Create a client
 		heketi := client.NewClient(options.Url, options.User, options.Key)
@@ -93,12 +185,10 @@ var nodeAddCommand = &cobra.Command{
 			return err
 		}
 
-		if options.Json {
-			data, err := json.Marshal(node)
-			if err != nil {
+		if structuredOutput() {
+			if err := printOutput(node); err != nil {
 				return err
 			}
-			fmt.Fprintf(stdout, string(data))
 		} else {
 			fmt.Fprintf(stdout, "Node information:\n"+
 				"Id: %v\n"+
@@ -140,7 +230,7 @@ var nodeDeleteCommand = &cobra.Command{
 		//set url
 		err := heketi.NodeDelete(nodeId)
 		if err == nil {
-			fmt.Fprintf(stdout, "Node %v deleted\n", nodeId)
+			fmt.Fprintf(statusOut(), "Node %v deleted\n", nodeId)
 		}
 
 		return err
@@ -172,7 +262,7 @@ var nodeEnableCommand = &cobra.Command{
 		}
 		err := heketi.NodeState(nodeId, req)
 		if err == nil {
-			fmt.Fprintf(stdout, "Node %v is now online\n", nodeId)
+			fmt.Fprintf(statusOut(), "Node %v is now online\n", nodeId)
 		}
 
 		return err
@@ -183,7 +273,7 @@ var nodeDisableCommand = &cobra.Command{
 	Use:     "disable [node_id]",
 	Short:   "Disallow usage of a node by placing it offline",
 	Long:    "Disallow usage of a node by placing it offline",
-	Example: "  $ heketi-cli node disable 886a86a868711bef83001",
+	Example: "  $ heketi-cli node disable 886a86a868711bef83001 --reason=maintenance",
 	RunE: func(cmd *cobra.Command, args []string) error {
 		s := cmd.Flags().Args()
 
@@ -198,19 +288,57 @@ var nodeDisableCommand = &cobra.Command{
 		// Create a client
 		heketi := client.NewClient(options.Url, options.User, options.Key)
 
+		if stateReason == "" {
+			return errors.New("Reason missing")
+		}
+
 		//set url
 		req := &api.StateRequest{
-			State: "offline",
+			State:   "offline",
+			Reason:  api.StateReasonCode(stateReason),
+			Message: stateMessage,
 		}
 		err := heketi.NodeState(nodeId, req)
 		if err == nil {
-			fmt.Fprintf(stdout, "Node %v is now offline\n", nodeId)
+			fmt.Fprintf(statusOut(), "Node %v is now offline\n", nodeId)
+		}
+
+		return err
+	},
+}
+
+var nodeSetStateCommand = &cobra.Command{
+	Use:   "set-state [node_id]",
+	Short: "Sets the state of a node",
+	Long: "Sets the state of a node. Draining and maintenance nodes, like " +
+		"offline nodes, keep their bricks but get no new bricks",
+	Example: "  $ heketi-cli node set-state 886a86a868711bef83001 --state=maintenance --reason=maintenance",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(cmd.Flags().Args()) < 1 {
+			return errors.New("Node id missing")
+		}
+		nodeId := cmd.Flags().Arg(0)
+
+		req, err := stateRequest()
+		if err != nil {
+			return err
 		}
 
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+		err = heketi.NodeState(nodeId, req)
+		if err == nil {
+			fmt.Fprintf(statusOut(), "Node %v is now %v\n", nodeId, req.State)
+		}
 		return err
 	},
 }
 
+// nodeListEntry is a node in the output of node list
+type nodeListEntry struct {
+	Id      string `json:"id"`
+	Cluster string `json:"cluster"`
+}
+
 var nodeListCommand = &cobra.Command{
 	Use:     "list all nodes",
 	Short:   "List all nodes in cluster",
@@ -225,19 +353,30 @@ var nodeListCommand = &cobra.Command{
 			return err
 		}
 
+		list := []nodeListEntry{}
 		for _, clusterid := range clusters.Clusters {
 			clusterinfo, err := heketi.ClusterInfo(clusterid)
 			if err != nil {
 				return err
 			}
 			for _, nodeid := range clusterinfo.Nodes {
-				fmt.Fprintf(stdout,
-					"Id:%v\tCluster:%v\n",
-					nodeid,
-					clusterid)
+				list = append(list, nodeListEntry{
+					Id:      nodeid,
+					Cluster: clusterid,
+				})
 			}
 		}
 
+		if structuredOutput() {
+			return printOutput(list)
+		}
+		for _, n := range list {
+			fmt.Fprintf(stdout,
+				"Id:%v\tCluster:%v\n",
+				n.Id,
+				n.Cluster)
+		}
+
 		return err
 	},
 }
@@ -270,12 +409,10 @@ var nodeInfoCommand = &cobra.Command{
 			info.State = entryStateRemoved
 		}
 
-		if options.Json {
-			data, err := json.Marshal(info)
-			if err != nil {
+		if structuredOutput() {
+			if err := printOutput(info); err != nil {
 				return err
 			}
-			fmt.Fprintf(stdout, string(data))
 		} else {
 			fmt.Fprintf(stdout, "Node Id: %v\n"+
 				"State: %v\n"+
@@ -289,6 +426,22 @@ var nodeInfoCommand = &cobra.Command{
 				info.Zone,
 				info.Hostnames.Manage[0],
 				info.Hostnames.Storage[0])
+			if info.ManageAddress != "" {
+				fmt.Fprintf(stdout, "Management Address: %v\n", info.ManageAddress)
+			}
+			if info.StateReason != nil {
+				fmt.Fprintf(stdout, "State Reason: %v\n", formatStateReason(info.StateReason))
+			}
+			if len(info.Tags) > 0 {
+				fmt.Fprintf(stdout, "Tags: %v\n", formatTags(info.Tags))
+			}
+			if len(info.HealthEvents) > 0 {
+				fmt.Fprintf(stdout, "Health Events:\n")
+				for _, e := range info.HealthEvents {
+					fmt.Fprintf(stdout, "  %v %-20v%v\n",
+						time.Unix(e.Time, 0).Format(time.RFC3339), e.Type, e.Message)
+				}
+			}
 			fmt.Fprintf(stdout, "Devices:\n")
 			for _, d := range info.DevicesInfo {
 				fmt.Fprintf(stdout, "Id:%-35v"+
@@ -310,10 +463,16 @@ var nodeInfoCommand = &cobra.Command{
 }
 
 var nodeRemoveCommand = &cobra.Command{
-	Use:     "remove [node_id]",
-	Short:   "Removes a node and all its associated devices from Heketi",
-	Long:    "Removes a node and all its associated devices from Heketi",
-	Example: "  $ heketi-cli node remove 886a86a868711bef83001",
+	Use:   "remove [node_id]",
+	Short: "Removes a node and all its associated devices from Heketi",
+	Long: "Migrates every brick off the devices of a node and marks\n" +
+		"the node failed so that it can be deleted",
+	Example: `  * Remove the node
+    $ heketi-cli node remove 886a86a868711bef83001
+
+  * Show the progress of the removal of the node
+    $ heketi-cli node remove 886a86a868711bef83001 --status
+`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		s := cmd.Flags().Args()
 
@@ -328,15 +487,238 @@ var nodeRemoveCommand = &cobra.Command{
 		// Create a client
 		heketi := client.NewClient(options.Url, options.User, options.Key)
 
-		//set url
-		req := &api.StateRequest{
-			State: "failed",
+		var progress *api.NodeRemoveProgress
+		var err error
+		if nodeRemoveStatus {
+			progress, err = heketi.NodeRemoveStatus(nodeId)
+		} else {
+			progress, err = heketi.NodeRemove(nodeId)
+			if err != nil {
+				// Show which bricks were migrated before the failure
+				if p, e := heketi.NodeRemoveStatus(nodeId); e == nil {
+					printNodeRemoveProgress(p)
+				}
+			}
 		}
-		err := heketi.NodeState(nodeId, req)
-		if err == nil {
-			fmt.Fprintf(stdout, "Node %v is now removed\n", nodeId)
+		if err != nil {
+			return err
 		}
 
-		return err
+		if structuredOutput() {
+			if err := printOutput(progress); err != nil {
+				return err
+			}
+		} else {
+			printNodeRemoveProgress(progress)
+		}
+
+		return nil
 	},
 }
+
+func printNodeRemoveProgress(p *api.NodeRemoveProgress) {
+	for _, b := range p.Bricks {
+		fmt.Fprintf(statusOut(), "Brick:%v Volume:%v Device:%v State:%v",
+			b.BrickId, b.VolumeId, b.DeviceId, b.State)
+		if b.Message != "" {
+			fmt.Fprintf(statusOut(), " Error:%v", b.Message)
+		}
+		fmt.Fprintf(statusOut(), "\n")
+	}
+	switch p.State {
+	case api.NodeRemoveDone:
+		fmt.Fprintf(statusOut(), "Node %v is now removed\n", p.NodeId)
+	case api.NodeRemoveFailed:
+		fmt.Fprintf(statusOut(), "Removal of node %v failed: %v\n", p.NodeId, p.Message)
+	default:
+		fmt.Fprintf(statusOut(), "Removal of node %v is %v\n", p.NodeId, p.State)
+	}
+}
+
+var nodeRestartBricksCommand = &cobra.Command{
+	Use:   "restart-bricks [node_id]",
+	Short: "Restarts the brick processes of a node",
+	Long: "Restarts the bricks on a node one volume at a time, waiting\n" +
+		"for each volume to heal before restarting the next one",
+	Example: `  * Restart the bricks of the node
+    $ heketi-cli node restart-bricks 886a86a868711bef83001
+
+  * Allow each volume an hour to heal
+    $ heketi-cli node restart-bricks 886a86a868711bef83001 --heal-timeout=3600
+
+  * Show the progress of the restart
+    $ heketi-cli node restart-bricks 886a86a868711bef83001 --status
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		s := cmd.Flags().Args()
+		if len(s) < 1 {
+			return errors.New("Node id missing")
+		}
+		nodeId := cmd.Flags().Arg(0)
+
+		// Create a client
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+
+		var progress *api.NodeBrickRestartProgress
+		var err error
+		if nodeRestartStatus {
+			progress, err = heketi.NodeRestartBricksStatus(nodeId)
+		} else {
+			req := &api.NodeBrickRestartRequest{HealTimeout: nodeHealTimeout}
+			progress, err = heketi.NodeRestartBricks(nodeId, req)
+			if err != nil {
+				// Show which volumes were restarted before the failure
+				if p, e := heketi.NodeRestartBricksStatus(nodeId); e == nil {
+					printNodeBrickRestartProgress(p)
+				}
+			}
+		}
+		if err != nil {
+			return err
+		}
+
+		if structuredOutput() {
+			if err := printOutput(progress); err != nil {
+				return err
+			}
+		} else {
+			printNodeBrickRestartProgress(progress)
+		}
+
+		return nil
+	},
+}
+
+func printNodeBrickRestartProgress(p *api.NodeBrickRestartProgress) {
+	for _, v := range p.Volumes {
+		fmt.Fprintf(statusOut(), "Volume:%v Name:%v State:%v", v.VolumeId, v.Name, v.State)
+		if v.Message != "" {
+			fmt.Fprintf(statusOut(), " Error:%v", v.Message)
+		}
+		fmt.Fprintf(statusOut(), "\n")
+	}
+	switch p.State {
+	case api.BrickRestartDone:
+		fmt.Fprintf(statusOut(), "Bricks of node %v restarted\n", p.NodeId)
+	case api.BrickRestartFailed:
+		fmt.Fprintf(statusOut(), "Restart of the bricks of node %v failed: %v\n",
+			p.NodeId, p.Message)
+	default:
+		fmt.Fprintf(statusOut(), "Restart of the bricks of node %v is %v\n",
+			p.NodeId, p.State)
+	}
+}
+
+var nodeSetTagsCommand = &cobra.Command{
+	Use:   "settags [node_id] [key:value]...",
+	Short: "Sets tags on the node",
+	Long:  "Adds tags to the node, replacing the values of existing keys",
+	Example: `  * Tag the node with its rack
+    $ heketi-cli node settags 886a86a868711bef83001 rack:r1
+
+  * Replace all the tags of the node
+    $ heketi-cli node settags 886a86a868711bef83001 rack:r2 media:ssd --exact
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		s := cmd.Flags().Args()
+		if len(s) < 1 {
+			return errors.New("Node id missing")
+		}
+		if len(s) < 2 && !tagsExact {
+			return errors.New("Tags missing")
+		}
+		nodeId := cmd.Flags().Arg(0)
+
+		req := &api.TagsChangeRequest{
+			Change: api.UpdateTags,
+		}
+		if tagsExact {
+			req.Change = api.SetTags
+		}
+		var err error
+		req.Tags, err = parseTags(s[1:], false)
+		if err != nil {
+			return err
+		}
+
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+		info, err := heketi.NodeSetTags(nodeId, req)
+		if err != nil {
+			return err
+		}
+		if structuredOutput() {
+			return printOutput(info)
+		}
+		fmt.Fprintf(stdout, "Tags of node %v: %v\n", nodeId, formatTags(info.Tags))
+		return nil
+	},
+}
+
+var nodeRmTagsCommand = &cobra.Command{
+	Use:     "rmtags [node_id] [key]...",
+	Short:   "Removes tags from the node",
+	Long:    "Removes tags from the node",
+	Example: "  $ heketi-cli node rmtags 886a86a868711bef83001 rack",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		s := cmd.Flags().Args()
+		if len(s) < 1 {
+			return errors.New("Node id missing")
+		}
+		if len(s) < 2 && !tagsAll {
+			return errors.New("Tag keys missing")
+		}
+		nodeId := cmd.Flags().Arg(0)
+
+		req := &api.TagsChangeRequest{
+			Change: api.DeleteTags,
+		}
+		if tagsAll {
+			req.Change = api.SetTags
+		} else {
+			var err error
+			req.Tags, err = parseTags(s[1:], true)
+			if err != nil {
+				return err
+			}
+		}
+
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+		info, err := heketi.NodeSetTags(nodeId, req)
+		if err != nil {
+			return err
+		}
+		if structuredOutput() {
+			return printOutput(info)
+		}
+		fmt.Fprintf(stdout, "Tags of node %v: %v\n", nodeId, formatTags(info.Tags))
+		return nil
+	},
+}
+
+// parseTags converts key:value arguments to tags. Only keys are
+// expected when removing tags.
+func parseTags(args []string, keysOnly bool) (map[string]string, error) {
+	tags := map[string]string{}
+	for _, arg := range args {
+		if keysOnly {
+			tags[arg] = ""
+			continue
+		}
+		kv := strings.SplitN(arg, ":", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("Invalid tag %v, must be key:value", arg)
+		}
+		tags[kv[0]] = kv[1]
+	}
+	return tags, nil
+}
+
+// formatTags returns the tags as sorted key:value pairs
+func formatTags(tags map[string]string) string {
+	pairs := make([]string, 0, len(tags))
+	for k, v := range tags {
+		pairs = append(pairs, k+":"+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, " ")
+}
@@ -0,0 +1,339 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package cmds
+
+import (
+	"fmt"
+	"time"
+
+	client "github.com/heketi/heketi/client/api/go-client"
+	"github.com/spf13/cobra"
+)
+
+var (
+	historyEntity string
+	historyType   string
+	historySince  string
+	historyUntil  string
+	auditId       string
+	auditSince    string
+	auditUntil    string
+	eventsSince   string
+)
+
+func init() {
+	RootCmd.AddCommand(operationsCommand)
+	operationsCommand.AddCommand(operationsListCommand)
+	operationsCommand.AddCommand(operationsHistoryCommand)
+	operationsCommand.AddCommand(operationsOutputCommand)
+	operationsCommand.AddCommand(operationsAuditCommand)
+	operationsCommand.AddCommand(operationsEventsCommand)
+	operationsHistoryCommand.Flags().StringVar(&historyEntity, "entity", "",
+		"\n\tOptional: Only the operations that changed the volume,"+
+			"\n\tblock volume, brick or device with this id")
+	operationsHistoryCommand.Flags().StringVar(&historyType, "type", "",
+		"\n\tOptional: Only the operations of this type, such as expand-volume")
+	operationsHistoryCommand.Flags().StringVar(&historySince, "since", "",
+		"\n\tOptional: Only the operations finished since this time, given"+
+			"\n\tin RFC3339 format or as a duration before now, such as 24h")
+	operationsHistoryCommand.Flags().StringVar(&historyUntil, "until", "",
+		"\n\tOptional: Only the operations finished until this time, given"+
+			"\n\tin RFC3339 format or as a duration before now")
+	operationsAuditCommand.Flags().StringVar(&auditId, "id", "",
+		"\n\tOptional: Only the requests on the object with this id, or that"+
+			"\n\tcreated it")
+	operationsAuditCommand.Flags().StringVar(&auditSince, "since", "",
+		"\n\tOptional: Only the requests received since this time, given"+
+			"\n\tin RFC3339 format or as a duration before now, such as 24h")
+	operationsAuditCommand.Flags().StringVar(&auditUntil, "until", "",
+		"\n\tOptional: Only the requests received until this time, given"+
+			"\n\tin RFC3339 format or as a duration before now")
+	operationsListCommand.SilenceUsage = true
+	operationsHistoryCommand.SilenceUsage = true
+	operationsOutputCommand.SilenceUsage = true
+	operationsEventsCommand.Flags().StringVar(&eventsSince, "since", "",
+		"\n\tOptional: Only the events raised since this time, given"+
+			"\n\tin RFC3339 format or as a duration before now, such as 1h")
+	operationsAuditCommand.SilenceUsage = true
+	operationsEventsCommand.SilenceUsage = true
+}
+
+// historyTime converts a time given in RFC3339 format, or as a duration
+// before now, to seconds since the epoch
+func historyTime(s string) (int64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return time.Now().Add(-d).Unix(), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid time %v: %v", s, err)
+	}
+	return t.Unix(), nil
+}
+
+var operationsCommand = &cobra.Command{
+	Use:   "operations",
+	Short: "Heketi Pending Operations",
+	Long:  "Heketi Pending Operations",
+}
+
+var operationsListCommand = &cobra.Command{
+	Use:     "list",
+	Short:   "Lists the operations heketi has not finished",
+	Long:    "Lists the operations heketi has not finished",
+	Example: "  $ heketi-cli operations list",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Create a client
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+
+		// List operations
+		list, err := heketi.OperationList()
+		if err != nil {
+			return err
+		}
+
+		if structuredOutput() {
+			if err := printOutput(list); err != nil {
+				return err
+			}
+		} else {
+			fmt.Fprintf(stdout, "Operations:\n")
+			for _, op := range list.Operations {
+				fmt.Fprintf(stdout, "Id:%v Type:%v Started:%v\n",
+					op.Id,
+					op.Type,
+					time.Unix(op.Started, 0).Format(time.RFC3339))
+				for _, c := range op.Changes {
+					fmt.Fprintf(stdout, "    %v %v\n", c.Change, c.Id)
+				}
+			}
+		}
+
+		return nil
+	},
+}
+
+var operationsHistoryCommand = &cobra.Command{
+	Use:   "history",
+	Short: "Lists the operations heketi has completed",
+	Long:  "Lists the operations heketi has completed, oldest first",
+	Example: `  * List the operations of the last day
+    $ heketi-cli operations history --since=24h
+
+  * List the expansions of a volume
+    $ heketi-cli operations history --entity=886a86a868711bef83001 --type=expand-volume
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		since, err := historyTime(historySince)
+		if err != nil {
+			return err
+		}
+		until, err := historyTime(historyUntil)
+		if err != nil {
+			return err
+		}
+
+		// Create a client
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+
+		history, err := heketi.OperationHistory(historyEntity, historyType,
+			since, until)
+		if err != nil {
+			return err
+		}
+
+		if structuredOutput() {
+			if err := printOutput(history); err != nil {
+				return err
+			}
+			return nil
+		}
+
+		for _, op := range history.Operations {
+			result := "succeeded"
+			if !op.Succeeded {
+				result = "failed: " + op.Error
+				if op.Output != "" {
+					result += " Output:" + op.Output
+				}
+			}
+			fmt.Fprintf(stdout, "Id:%v Type:%v Finished:%v Duration:%vs Requester:%v Result:%v\n",
+				op.Id,
+				op.Type,
+				time.Unix(op.Finished, 0).Format(time.RFC3339),
+				op.Duration,
+				op.Requester,
+				result)
+			for _, c := range op.Changes {
+				fmt.Fprintf(stdout, "    %v %v\n", c.Change, c.Id)
+			}
+		}
+		return nil
+	},
+}
+
+var operationsOutputCommand = &cobra.Command{
+	Use:   "output [output_id]",
+	Short: "Shows the output of the commands that failed on the nodes",
+	Long: "Lists the kept outputs of the commands that failed on the nodes," +
+		" or shows the stdout and stderr of one of them",
+	Example: `  * List the outputs of the failed commands
+    $ heketi-cli operations output
+
+  * Show the output of the command a failed operation of the history failed on
+    $ heketi-cli operations output 3f5d8a0cb6e26b2f3b8b8c1b04fbb2a9
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) > 1 {
+			return fmt.Errorf("Too many arguments")
+		}
+
+		// Create a client
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+
+		if len(args) == 0 {
+			list, err := heketi.CommandOutputList()
+			if err != nil {
+				return err
+			}
+			if structuredOutput() {
+				return printOutput(list)
+			}
+			for _, o := range list.Outputs {
+				fmt.Fprintf(stdout, "Id:%v Host:%v Created:%v Command:%v\n",
+					o.Id,
+					o.Host,
+					time.Unix(o.Created, 0).Format(time.RFC3339),
+					o.Command)
+			}
+			return nil
+		}
+
+		output, err := heketi.CommandOutputInfo(args[0])
+		if err != nil {
+			return err
+		}
+		if structuredOutput() {
+			return printOutput(output)
+		}
+		fmt.Fprintf(stdout, "Id: %v\nHost: %v\nCreated: %v\nCommand: %v\nError: %v\n",
+			output.Id,
+			output.Host,
+			time.Unix(output.Created, 0).Format(time.RFC3339),
+			output.Command,
+			output.Error)
+		if output.Truncated {
+			fmt.Fprintf(stdout, "Output truncated to its end\n")
+		}
+		fmt.Fprintf(stdout, "Stdout:\n%v\nStderr:\n%v\n", output.Stdout, output.Stderr)
+		return nil
+	},
+}
+
+var operationsAuditCommand = &cobra.Command{
+	Use:   "audit",
+	Short: "Lists the requests that changed the state of heketi",
+	Long: "Lists the create, delete, expand, replace and other requests" +
+		"\nchanging the state of heketi from the audit log, oldest first",
+	Example: `  * List the requests of the last day
+    $ heketi-cli operations audit --since=24h
+
+  * List the requests on a volume
+    $ heketi-cli operations audit --id=886a86a868711bef83001
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		since, err := historyTime(auditSince)
+		if err != nil {
+			return err
+		}
+		until, err := historyTime(auditUntil)
+		if err != nil {
+			return err
+		}
+
+		// Create a client
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+
+		log, err := heketi.AuditLog(auditId, since, until)
+		if err != nil {
+			return err
+		}
+
+		if structuredOutput() {
+			if err := printOutput(log); err != nil {
+				return err
+			}
+			return nil
+		}
+
+		for _, e := range log.Entries {
+			result := e.Result
+			if e.Error != "" {
+				result += ": " + e.Error
+			}
+			fmt.Fprintf(stdout, "Id:%v Time:%v User:%v %v %v Object:%v Status:%v Result:%v\n",
+				e.Id,
+				time.Unix(e.Time, 0).Format(time.RFC3339),
+				e.User,
+				e.Method,
+				e.Path,
+				e.ObjectId,
+				e.Status,
+				result)
+			if e.Payload != "" {
+				fmt.Fprintf(stdout, "    %v\n", e.Payload)
+			}
+		}
+		return nil
+	},
+}
+
+var operationsEventsCommand = &cobra.Command{
+	Use:   "events",
+	Short: "Lists the last events of heketi",
+	Long: "Lists the last events of heketi, such as the volumes created or" +
+		"\nthe creates that found no space, oldest first. Users only see" +
+		"\nthe events about the volumes of their tenant.",
+	Example: `  * List the events of the last hour
+    $ heketi-cli operations events --since=1h
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		since, err := historyTime(eventsSince)
+		if err != nil {
+			return err
+		}
+
+		// Create a client
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+
+		list, err := heketi.EventList(since)
+		if err != nil {
+			return err
+		}
+
+		if structuredOutput() {
+			return printOutput(list)
+		}
+
+		for _, e := range list.Events {
+			fmt.Fprintf(stdout, "Id:%v Time:%v Type:%v Object:%v Tenant:%v %v\n",
+				e.Id,
+				time.Unix(e.Time, 0).Format(time.RFC3339),
+				e.Type,
+				e.ObjectId,
+				e.Tenant,
+				e.Message)
+		}
+		return nil
+	},
+}
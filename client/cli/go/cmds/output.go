@@ -0,0 +1,110 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package cmds
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/ghodss/yaml"
+	"github.com/heketi/heketi/pkg/utils"
+)
+
+// Formats of the output of the commands
+const (
+	OutputText = "text"
+	OutputJson = "json"
+	OutputYaml = "yaml"
+)
+
+// Exit codes of heketi-cli. Scripts can tell apart objects that do
+// not exist from failures of the server.
+const (
+	ExitSuccess     = 0
+	ExitNotFound    = 2
+	ExitServerError = 3
+	// Any other error, as always returned by earlier versions
+	ExitError = -1
+)
+
+// checkOutput validates the output format of the options. The --json
+// flag is the same as --output json.
+func checkOutput() error {
+	if options.Output == "" {
+		options.Output = OutputText
+		if options.Json {
+			options.Output = OutputJson
+		}
+	}
+	switch options.Output {
+	case OutputText, OutputJson, OutputYaml:
+	default:
+		return fmt.Errorf("Unknown output format %v, must be one of %v, %v or %v",
+			options.Output, OutputText, OutputJson, OutputYaml)
+	}
+	if options.Json && options.Output != OutputJson {
+		return fmt.Errorf("--json cannot be used with --output %v",
+			options.Output)
+	}
+	return nil
+}
+
+// structuredOutput returns true when the commands print their results
+// in a format for scripts instead of text for humans
+func structuredOutput() bool {
+	return options.Output == OutputJson || options.Output == OutputYaml
+}
+
+// statusOut returns where the commands print their status messages.
+// Messages go to stderr when the output is for scripts so that stdout
+// only has the results.
+func statusOut() io.Writer {
+	if structuredOutput() {
+		return stderr
+	}
+	return stdout
+}
+
+// printOutput prints the result of a command, an api type, in the
+// format of the output
+func printOutput(result interface{}) error {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	if options.Output == OutputYaml {
+		data, err = yaml.JSONToYAML(data)
+		if err != nil {
+			return err
+		}
+		_, err = stdout.Write(data)
+		return err
+	}
+	_, err = fmt.Fprintln(stdout, string(data))
+	return err
+}
+
+// ExitCode returns the exit code of heketi-cli for the error of
+// a command
+func ExitCode(err error) int {
+	if err == nil {
+		return ExitSuccess
+	}
+	code := utils.GetStatusCodeFromError(err)
+	switch {
+	case code == http.StatusNotFound:
+		return ExitNotFound
+	case code >= http.StatusInternalServerError:
+		return ExitServerError
+	}
+	return ExitError
+}
@@ -0,0 +1,75 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package cmds
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/heketi/pkg/utils"
+	"github.com/heketi/tests"
+)
+
+func TestPrintOutput(t *testing.T) {
+	defer func(o Options, w io.Writer) {
+		options = o
+		stdout = w
+	}(options, stdout)
+	var b bytes.Buffer
+	stdout = &b
+
+	info := &api.ClusterInfoResponse{Id: "c1"}
+	options = Options{Output: OutputJson}
+	tests.Assert(t, printOutput(info) == nil)
+	tests.Assert(t, bytes.HasPrefix(b.Bytes(), []byte(`{"id":"c1",`)), b.String())
+	tests.Assert(t, bytes.HasSuffix(b.Bytes(), []byte("}\n")), b.String())
+
+	b.Reset()
+	options = Options{Output: OutputYaml}
+	tests.Assert(t, printOutput(info) == nil)
+	tests.Assert(t, bytes.Contains(b.Bytes(), []byte("\nid: c1\n")), b.String())
+}
+
+func TestCheckOutput(t *testing.T) {
+	defer func(o Options) {
+		options = o
+	}(options)
+
+	options = Options{}
+	tests.Assert(t, checkOutput() == nil)
+	tests.Assert(t, options.Output == OutputText)
+	tests.Assert(t, !structuredOutput())
+
+	options = Options{Json: true}
+	tests.Assert(t, checkOutput() == nil)
+	tests.Assert(t, options.Output == OutputJson)
+	tests.Assert(t, structuredOutput())
+
+	options = Options{Output: OutputYaml}
+	tests.Assert(t, checkOutput() == nil)
+	tests.Assert(t, structuredOutput())
+
+	options = Options{Output: "xml"}
+	tests.Assert(t, checkOutput() != nil)
+
+	options = Options{Json: true, Output: OutputYaml}
+	tests.Assert(t, checkOutput() != nil)
+}
+
+func TestExitCode(t *testing.T) {
+	tests.Assert(t, ExitCode(nil) == ExitSuccess)
+	tests.Assert(t, ExitCode(errors.New("bzzt")) == ExitError)
+	tests.Assert(t, ExitCode(&utils.HttpError{StatusCode: 404}) == ExitNotFound)
+	tests.Assert(t, ExitCode(&utils.HttpError{StatusCode: 500}) == ExitServerError)
+	tests.Assert(t, ExitCode(&utils.HttpError{StatusCode: 409}) == ExitError)
+}
@@ -0,0 +1,109 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package cmds
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	client "github.com/heketi/heketi/client/api/go-client"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/spf13/cobra"
+)
+
+var policyFile string
+
+func init() {
+	RootCmd.AddCommand(placementPolicyCommand)
+	placementPolicyCommand.AddCommand(placementPolicyExportCommand)
+	placementPolicyCommand.AddCommand(placementPolicyImportCommand)
+
+	placementPolicyImportCommand.Flags().StringVarP(&policyFile, "json", "j", "",
+		"\n\tPlacement policy document, as exported, in JSON format.")
+	placementPolicyExportCommand.SilenceUsage = true
+	placementPolicyImportCommand.SilenceUsage = true
+}
+
+var placementPolicyCommand = &cobra.Command{
+	Use:   "placement-policy",
+	Short: "Heketi Placement Policy Management",
+	Long: "Export and import the zones and tags of the nodes, the tags and" +
+		"\nenclosures of the devices and the standby clusters as one document",
+}
+
+var placementPolicyExportCommand = &cobra.Command{
+	Use:   "export",
+	Short: "Export the placement policy as a JSON document",
+	Long:  "Export the placement policy as a JSON document",
+	Example: `  * Save the placement policy to a file
+    $ heketi-cli placement-policy export > policy.json
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+		policy, err := heketi.PlacementPolicyExport()
+		if err != nil {
+			return err
+		}
+
+		if structuredOutput() {
+			return printOutput(policy)
+		}
+		data, err := json.MarshalIndent(policy, "", "    ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(stdout, string(data))
+		return nil
+	},
+}
+
+var placementPolicyImportCommand = &cobra.Command{
+	Use:   "import",
+	Short: "Apply a placement policy document",
+	Long: "Apply a placement policy document to the nodes and devices found" +
+		"\nby hostname and device name. Nothing is changed if any of them" +
+		"\nis not found.",
+	Example: `  * Apply a placement policy
+    $ heketi-cli placement-policy import --json=policy.json
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if policyFile == "" {
+			return errors.New("Missing placement policy file")
+		}
+
+		fp, err := os.Open(policyFile)
+		if err != nil {
+			return errors.New("Unable to open placement policy file")
+		}
+		defer fp.Close()
+		var policy api.PlacementPolicy
+		if err := json.NewDecoder(fp).Decode(&policy); err != nil {
+			return errors.New("Unable to parse placement policy file")
+		}
+
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+		resp, err := heketi.PlacementPolicyImport(&policy)
+		if err != nil {
+			return err
+		}
+
+		for _, warning := range resp.Warnings {
+			fmt.Fprintf(stderr, "Warning: %v\n", warning)
+		}
+		if structuredOutput() {
+			return printOutput(resp)
+		}
+		fmt.Fprintf(stdout, "Placement policy of %v clusters imported\n",
+			len(policy.Clusters))
+		return nil
+	},
+}
@@ -0,0 +1,272 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package cmds
+
+import (
+	"errors"
+	"fmt"
+
+	client "github.com/heketi/heketi/client/api/go-client"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/spf13/cobra"
+)
+
+var (
+	replVolume    string
+	replCluster   string
+	failoverForce bool
+)
+
+func init() {
+	RootCmd.AddCommand(replicationCommand)
+	replicationCommand.AddCommand(replicationCreateCommand)
+	replicationCommand.AddCommand(replicationDeleteCommand)
+	replicationCommand.AddCommand(replicationInfoCommand)
+	replicationCommand.AddCommand(replicationListCommand)
+	replicationCommand.AddCommand(replicationFailoverCommand)
+	replicationCommand.AddCommand(replicationPromoteCommand)
+
+	replicationCreateCommand.Flags().StringVar(&replVolume, "volume", "",
+		"\n\tId of the volume to replicate")
+	replicationCreateCommand.Flags().StringVar(&replCluster, "cluster", "",
+		"\n\tId of the DR cluster the secondary volume is created on")
+	replicationFailoverCommand.Flags().BoolVar(&failoverForce, "force", false,
+		"\n\tOptional: Fail over even if the replication can not be stopped,"+
+			"\n\tfor example when the primary cluster is down")
+	replicationCreateCommand.SilenceUsage = true
+	replicationDeleteCommand.SilenceUsage = true
+	replicationInfoCommand.SilenceUsage = true
+	replicationListCommand.SilenceUsage = true
+	replicationFailoverCommand.SilenceUsage = true
+	replicationPromoteCommand.SilenceUsage = true
+}
+
+var replicationCommand = &cobra.Command{
+	Use:   "replication",
+	Short: "Heketi Volume Replication Management",
+	Long:  "Heketi Volume Replication Management",
+}
+
+var replicationCreateCommand = &cobra.Command{
+	Use:   "create",
+	Short: "Replicate a volume to a DR cluster",
+	Long: "Create a volume with the layout of the volume on the DR cluster" +
+		"\nand replicate the volume to it with geo-replication",
+	Example: `  * Replicate a volume to a DR cluster
+    $ heketi-cli replication create --volume=886a86a868711bef83001 \
+          --cluster=3b6d8a1e1f3c1e5e2ab04c2a0e8e2b1a
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if replVolume == "" {
+			return errors.New("Missing volume id")
+		}
+		if replCluster == "" {
+			return errors.New("Missing cluster id")
+		}
+
+		// Create request
+		req := &api.ReplicationCreateRequest{}
+		req.Cluster = replCluster
+
+		// Create a client
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+
+		// Create replication
+		replication, err := heketi.ReplicationCreate(replVolume, req)
+		if err != nil {
+			return err
+		}
+
+		if structuredOutput() {
+			if err := printOutput(replication); err != nil {
+				return err
+			}
+		} else {
+			fmt.Fprintf(stdout, "%v", replication)
+		}
+		return nil
+	},
+}
+
+var replicationDeleteCommand = &cobra.Command{
+	Use:     "delete",
+	Short:   "Stops and deletes the replication, keeping both volumes",
+	Long:    "Stops and deletes the replication, keeping both volumes",
+	Example: "  $ heketi-cli replication delete 886a86a868711bef83001",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		s := cmd.Flags().Args()
+
+		//ensure proper number of args
+		if len(s) < 1 {
+			return errors.New("Replication id missing")
+		}
+
+		//set replicationId
+		replicationId := cmd.Flags().Arg(0)
+
+		// Create a client
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+
+		err := heketi.ReplicationDelete(replicationId)
+		if err == nil {
+			fmt.Fprintf(statusOut(), "Replication %v deleted\n", replicationId)
+		}
+
+		return err
+	},
+}
+
+var replicationInfoCommand = &cobra.Command{
+	Use:     "info",
+	Short:   "Retrieves information about the replication",
+	Long:    "Retrieves information about the replication",
+	Example: "  $ heketi-cli replication info 886a86a868711bef83001",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		//ensure proper number of args
+		s := cmd.Flags().Args()
+		if len(s) < 1 {
+			return errors.New("Replication id missing")
+		}
+
+		// Set replication id
+		replicationId := cmd.Flags().Arg(0)
+
+		// Create a client to talk to Heketi
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+
+		info, err := heketi.ReplicationInfo(replicationId)
+		if err != nil {
+			return err
+		}
+
+		if structuredOutput() {
+			if err := printOutput(info); err != nil {
+				return err
+			}
+		} else {
+			fmt.Fprintf(stdout, "%v", info)
+		}
+		return nil
+	},
+}
+
+var replicationListCommand = &cobra.Command{
+	Use:     "list",
+	Short:   "Lists the replications managed by Heketi",
+	Long:    "Lists the replications managed by Heketi",
+	Example: "  $ heketi-cli replication list",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Create a client
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+
+		// List replications
+		list, err := heketi.ReplicationList()
+		if err != nil {
+			return err
+		}
+
+		if structuredOutput() {
+			if err := printOutput(list); err != nil {
+				return err
+			}
+		} else {
+			for _, id := range list.Replications {
+				replication, err := heketi.ReplicationInfo(id)
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(stdout, "Id:%-35v Primary:%-35v Secondary:%-35v State:%v\n",
+					id,
+					replication.PrimaryVolume,
+					replication.SecondaryVolume,
+					replication.State)
+			}
+		}
+
+		return nil
+	},
+}
+
+var replicationFailoverCommand = &cobra.Command{
+	Use:   "failover",
+	Short: "Stops the replication so that the secondary volume can be used",
+	Long:  "Stops the replication so that the secondary volume can be used",
+	Example: `  * Fail over to the secondary volume
+    $ heketi-cli replication failover 886a86a868711bef83001
+
+  * Fail over when the primary cluster is down
+    $ heketi-cli replication failover 886a86a868711bef83001 --force
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		//ensure proper number of args
+		s := cmd.Flags().Args()
+		if len(s) < 1 {
+			return errors.New("Replication id missing")
+		}
+
+		// Set replication id
+		replicationId := cmd.Flags().Arg(0)
+
+		// Create request
+		req := &api.ReplicationFailoverRequest{}
+		req.Force = failoverForce
+
+		// Create a client
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+
+		info, err := heketi.ReplicationFailover(replicationId, req)
+		if err != nil {
+			return err
+		}
+
+		if structuredOutput() {
+			if err := printOutput(info); err != nil {
+				return err
+			}
+		} else {
+			fmt.Fprintf(stdout, "%v", info)
+		}
+		return nil
+	},
+}
+
+var replicationPromoteCommand = &cobra.Command{
+	Use:     "promote",
+	Short:   "Makes the secondary volume of a failed over replication a volume of its own",
+	Long:    "Ends a failed over replication, the secondary volume becoming a volume of its own",
+	Example: "  $ heketi-cli replication promote 886a86a868711bef83001",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		//ensure proper number of args
+		s := cmd.Flags().Args()
+		if len(s) < 1 {
+			return errors.New("Replication id missing")
+		}
+
+		// Set replication id
+		replicationId := cmd.Flags().Arg(0)
+
+		// Create a client
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+
+		volume, err := heketi.ReplicationPromote(replicationId)
+		if err != nil {
+			return err
+		}
+
+		if structuredOutput() {
+			if err := printOutput(volume); err != nil {
+				return err
+			}
+		} else {
+			fmt.Fprintf(stdout, "%v", volume)
+		}
+		return nil
+	},
+}
@@ -33,6 +33,7 @@ const (
 type Options struct {
 	Url, Key, User string
 	Json           bool
+	Output         string
 }
 
 var RootCmd = &cobra.Command{
@@ -40,6 +41,9 @@ var RootCmd = &cobra.Command{
 	Short:   "Command line program for Heketi",
 	Long:    "Command line program for Heketi",
 	Example: `  $ heketi-cli volume list`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return checkOutput()
+	},
 	Run: func(cmd *cobra.Command, args []string) {
 		if version {
 			fmt.Printf("heketi-cli %v\n", HEKETI_CLI_VERSION)
@@ -61,7 +65,10 @@ func init() {
 		"\n\tHeketi user.  Can also be set using the"+
 			"\n\tenvironment variable HEKETI_CLI_USER")
 	RootCmd.PersistentFlags().BoolVar(&options.Json, "json", false,
-		"\n\tPrint response as JSON")
+		"\n\tPrint response as JSON, same as --output json")
+	RootCmd.PersistentFlags().StringVar(&options.Output, "output", "",
+		"\n\tFormat of the output: text, json or yaml. Structured"+
+			"\n\toutput has the schema of the API types (default text)")
 	RootCmd.Flags().BoolVarP(&version, "version", "v", false,
 		"\n\tPrint version")
 	RootCmd.SilenceUsage = true
@@ -0,0 +1,246 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package cmds
+
+import (
+	"errors"
+	"fmt"
+
+	client "github.com/heketi/heketi/client/api/go-client"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/spf13/cobra"
+)
+
+var (
+	snapVolume      string
+	snapName        string
+	snapDescription string
+	snapCloneName   string
+)
+
+func init() {
+	RootCmd.AddCommand(snapshotCommand)
+	snapshotCommand.AddCommand(snapshotCreateCommand)
+	snapshotCommand.AddCommand(snapshotDeleteCommand)
+	snapshotCommand.AddCommand(snapshotInfoCommand)
+	snapshotCommand.AddCommand(snapshotListCommand)
+	snapshotCommand.AddCommand(snapshotCloneCommand)
+
+	snapshotCreateCommand.Flags().StringVar(&snapVolume, "volume", "",
+		"\n\tId of the volume to snapshot")
+	snapshotCreateCommand.Flags().StringVar(&snapName, "name", "",
+		"\n\tOptional: Name of the snapshot in gluster."+
+			"\n\tThe name must be unique in the cluster of the volume."+
+			"\n\tIf omitted, the name is snap_<id>")
+	snapshotCreateCommand.Flags().StringVar(&snapDescription, "description", "",
+		"\n\tOptional: Description of the snapshot")
+	snapshotListCommand.Flags().StringVar(&snapVolume, "volume", "",
+		"\n\tId of the volume whose snapshots are listed")
+	snapshotCloneCommand.Flags().StringVar(&snapCloneName, "name", "",
+		"\n\tOptional: Name of the new volume."+
+			"\n\tIf omitted, the name is vol_<id>")
+	snapshotCreateCommand.SilenceUsage = true
+	snapshotDeleteCommand.SilenceUsage = true
+	snapshotInfoCommand.SilenceUsage = true
+	snapshotListCommand.SilenceUsage = true
+	snapshotCloneCommand.SilenceUsage = true
+}
+
+var snapshotCommand = &cobra.Command{
+	Use:   "snapshot",
+	Short: "Heketi Volume Snapshot Management",
+	Long:  "Heketi Volume Snapshot Management",
+}
+
+var snapshotCreateCommand = &cobra.Command{
+	Use:   "create",
+	Short: "Create a snapshot of a volume",
+	Long:  "Create a gluster snapshot of a volume",
+	Example: `  * Create a snapshot of a volume
+    $ heketi-cli snapshot create --volume=886a86a868711bef83001
+
+  * Create a named snapshot
+    $ heketi-cli snapshot create --volume=886a86a868711bef83001 --name=nightly
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if snapVolume == "" {
+			return errors.New("Missing volume id")
+		}
+
+		// Create request
+		req := &api.SnapshotCreateRequest{}
+		req.Name = snapName
+		req.Description = snapDescription
+
+		// Create a client
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+
+		// Create snapshot
+		snapshot, err := heketi.SnapshotCreate(snapVolume, req)
+		if err != nil {
+			return err
+		}
+
+		if structuredOutput() {
+			if err := printOutput(snapshot); err != nil {
+				return err
+			}
+		} else {
+			fmt.Fprintf(stdout, "%v", snapshot)
+		}
+		return nil
+	},
+}
+
+var snapshotDeleteCommand = &cobra.Command{
+	Use:     "delete",
+	Short:   "Deletes the snapshot",
+	Long:    "Deletes the snapshot",
+	Example: "  $ heketi-cli snapshot delete 886a86a868711bef83001",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		s := cmd.Flags().Args()
+
+		//ensure proper number of args
+		if len(s) < 1 {
+			return errors.New("Snapshot id missing")
+		}
+
+		//set snapshotId
+		snapshotId := cmd.Flags().Arg(0)
+
+		// Create a client
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+
+		err := heketi.SnapshotDelete(snapshotId)
+		if err == nil {
+			fmt.Fprintf(statusOut(), "Snapshot %v deleted\n", snapshotId)
+		}
+
+		return err
+	},
+}
+
+var snapshotInfoCommand = &cobra.Command{
+	Use:     "info",
+	Short:   "Retrieves information about the snapshot",
+	Long:    "Retrieves information about the snapshot",
+	Example: "  $ heketi-cli snapshot info 886a86a868711bef83001",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		//ensure proper number of args
+		s := cmd.Flags().Args()
+		if len(s) < 1 {
+			return errors.New("Snapshot id missing")
+		}
+
+		// Set snapshot id
+		snapshotId := cmd.Flags().Arg(0)
+
+		// Create a client to talk to Heketi
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+
+		info, err := heketi.SnapshotInfo(snapshotId)
+		if err != nil {
+			return err
+		}
+
+		if structuredOutput() {
+			if err := printOutput(info); err != nil {
+				return err
+			}
+		} else {
+			fmt.Fprintf(stdout, "%v", info)
+		}
+		return nil
+	},
+}
+
+var snapshotListCommand = &cobra.Command{
+	Use:     "list",
+	Short:   "Lists the snapshots of a volume",
+	Long:    "Lists the snapshots of a volume",
+	Example: "  $ heketi-cli snapshot list --volume=886a86a868711bef83001",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if snapVolume == "" {
+			return errors.New("Missing volume id")
+		}
+
+		// Create a client
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+
+		// List snapshots
+		list, err := heketi.VolumeSnapshotList(snapVolume)
+		if err != nil {
+			return err
+		}
+
+		if structuredOutput() {
+			if err := printOutput(list); err != nil {
+				return err
+			}
+		} else {
+			for _, id := range list.Snapshots {
+				snapshot, err := heketi.SnapshotInfo(id)
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(stdout, "Id:%-35v Name:%v\n",
+					id,
+					snapshot.Name)
+			}
+		}
+
+		return nil
+	},
+}
+
+var snapshotCloneCommand = &cobra.Command{
+	Use:   "clone",
+	Short: "Clones the snapshot into a new volume",
+	Long: "Clones the snapshot into a new volume with the layout of the " +
+		"volume the snapshot was taken of",
+	Example: `  * Clone a snapshot
+    $ heketi-cli snapshot clone 886a86a868711bef83001
+
+  * Clone a snapshot into a named volume
+    $ heketi-cli snapshot clone 886a86a868711bef83001 --name=restored
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		//ensure proper number of args
+		s := cmd.Flags().Args()
+		if len(s) < 1 {
+			return errors.New("Snapshot id missing")
+		}
+
+		// Set snapshot id
+		snapshotId := cmd.Flags().Arg(0)
+
+		// Create request
+		req := &api.SnapshotCloneRequest{}
+		req.Name = snapCloneName
+
+		// Create a client
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+
+		// Clone snapshot
+		volume, err := heketi.SnapshotClone(snapshotId, req)
+		if err != nil {
+			return err
+		}
+
+		if structuredOutput() {
+			if err := printOutput(volume); err != nil {
+				return err
+			}
+		} else {
+			fmt.Fprintf(stdout, "%v", volume)
+		}
+		return nil
+	},
+}
@@ -0,0 +1,298 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package cmds
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	client "github.com/heketi/heketi/client/api/go-client"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/spf13/cobra"
+)
+
+var (
+	tenantUsers           []string
+	tenantCluster         string
+	tenantMaxSizeGb       int
+	tenantMaxVolumes      int
+	tenantMaxBlockVolumes int
+)
+
+func init() {
+	RootCmd.AddCommand(tenantCommand)
+	tenantCommand.AddCommand(tenantSetCommand)
+	tenantCommand.AddCommand(tenantDeleteCommand)
+	tenantCommand.AddCommand(tenantInfoCommand)
+	tenantCommand.AddCommand(tenantListCommand)
+	tenantCommand.AddCommand(tenantUsageCommand)
+
+	tenantSetCommand.Flags().StringSliceVar(&tenantUsers, "users", nil,
+		"\n\tComma separated list of the users of the tenant, the subjects"+
+			"\n\tof the tokens of their requests. Replaces the users of the tenant")
+	tenantSetCommand.Flags().StringVar(&tenantCluster, "cluster", "",
+		"\n\tOptional: Id of the cluster the limits are set for. The limits"+
+			"\n\tof the tenant on the other clusters are left unchanged")
+	tenantSetCommand.Flags().IntVar(&tenantMaxSizeGb, "max-size-gb", 0,
+		"\n\tMaximum total size in GiB of the volumes and block volumes"+
+			"\n\tof the tenant on a cluster, 0 for no limit")
+	tenantSetCommand.Flags().IntVar(&tenantMaxVolumes, "max-volumes", 0,
+		"\n\tMaximum number of volumes of the tenant on a cluster, 0 for no limit")
+	tenantSetCommand.Flags().IntVar(&tenantMaxBlockVolumes, "max-block-volumes", 0,
+		"\n\tMaximum number of block volumes of the tenant on a cluster,"+
+			"\n\t0 for no limit")
+	tenantSetCommand.SilenceUsage = true
+	tenantDeleteCommand.SilenceUsage = true
+	tenantInfoCommand.SilenceUsage = true
+	tenantListCommand.SilenceUsage = true
+	tenantUsageCommand.SilenceUsage = true
+}
+
+var tenantCommand = &cobra.Command{
+	Use:   "tenant",
+	Short: "Heketi Tenant Quota Management",
+	Long: "Manage the tenants whose users have their volumes limited" +
+		"\non each cluster",
+}
+
+func printTenant(tenant *api.TenantInfoResponse) error {
+	if structuredOutput() {
+		return printOutput(tenant)
+	}
+
+	limits := func(l api.TenantLimits) string {
+		return fmt.Sprintf("Size: %v GiB Volumes: %v Block Volumes: %v",
+			l.SizeGb, l.Volumes, l.BlockVolumes)
+	}
+	fmt.Fprintf(stdout, "Name: %v\nUsers: %v\nLimits: %v\n",
+		tenant.Name, tenant.Users, limits(tenant.Limits))
+
+	clusters := []string{}
+	for id := range tenant.Clusters {
+		clusters = append(clusters, id)
+	}
+	sort.Strings(clusters)
+	for _, id := range clusters {
+		fmt.Fprintf(stdout, "Limits on cluster %v: %v\n",
+			id, limits(tenant.Clusters[id]))
+	}
+
+	clusters = []string{}
+	for id := range tenant.Usage {
+		clusters = append(clusters, id)
+	}
+	sort.Strings(clusters)
+	for _, id := range clusters {
+		u := tenant.Usage[id]
+		fmt.Fprintf(stdout, "Usage on cluster %v: Size: %v MiB Volumes: %v "+
+			"Block Volumes: %v\n", id, u.SizeMiB, u.Volumes, u.BlockVolumes)
+	}
+	return nil
+}
+
+var tenantSetCommand = &cobra.Command{
+	Use:   "set",
+	Short: "Create a tenant or change its users and limits",
+	Long: "Create a tenant or change its users and limits. The limits" +
+		"\napply to every cluster without limits of its own, or only" +
+		"\nto the cluster given with --cluster. A limit of 0 is no limit.",
+	Example: `  * Limit the users of a tenant to 100 GiB and 10 volumes on each cluster
+    $ heketi-cli tenant set team-a --users=alice,bob \
+          --max-size-gb=100 --max-volumes=10
+
+  * Allow the tenant 500 GiB on a given cluster
+    $ heketi-cli tenant set team-a --cluster=3b6d8a1e1f3c1e5e2ab04c2a0e8e2b1a \
+          --max-size-gb=500
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		s := cmd.Flags().Args()
+
+		//ensure proper number of args
+		if len(s) < 1 {
+			return errors.New("Tenant name missing")
+		}
+		name := s[0]
+
+		// Create a client
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+
+		// Start from the tenant, if it exists
+		req := &api.TenantRequest{}
+		list, err := heketi.TenantList()
+		if err != nil {
+			return err
+		}
+		for _, t := range list.Tenants {
+			if t == name {
+				info, err := heketi.TenantInfo(name)
+				if err != nil {
+					return err
+				}
+				req = &info.TenantRequest
+				break
+			}
+		}
+
+		if cmd.Flags().Changed("users") {
+			req.Users = tenantUsers
+		}
+		limits := req.Limits
+		if tenantCluster != "" {
+			limits = req.Clusters[tenantCluster]
+		}
+		if cmd.Flags().Changed("max-size-gb") {
+			limits.SizeGb = tenantMaxSizeGb
+		}
+		if cmd.Flags().Changed("max-volumes") {
+			limits.Volumes = tenantMaxVolumes
+		}
+		if cmd.Flags().Changed("max-block-volumes") {
+			limits.BlockVolumes = tenantMaxBlockVolumes
+		}
+		if tenantCluster != "" {
+			if req.Clusters == nil {
+				req.Clusters = map[string]api.TenantLimits{}
+			}
+			req.Clusters[tenantCluster] = limits
+		} else {
+			req.Limits = limits
+		}
+
+		tenant, err := heketi.TenantSet(name, req)
+		if err != nil {
+			return err
+		}
+		return printTenant(tenant)
+	},
+}
+
+var tenantDeleteCommand = &cobra.Command{
+	Use:   "delete",
+	Short: "Deletes the tenant",
+	Long: "Deletes the tenant. The volumes of the tenant are kept" +
+		"\nand are no longer limited.",
+	Example: "  $ heketi-cli tenant delete team-a",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		s := cmd.Flags().Args()
+
+		//ensure proper number of args
+		if len(s) < 1 {
+			return errors.New("Tenant name missing")
+		}
+		name := s[0]
+
+		// Create a client
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+
+		err := heketi.TenantDelete(name)
+		if err == nil {
+			fmt.Fprintf(statusOut(), "Tenant %v deleted\n", name)
+		}
+
+		return err
+	},
+}
+
+var tenantInfoCommand = &cobra.Command{
+	Use:     "info",
+	Short:   "Retrieves the limits and the usage of the tenant",
+	Long:    "Retrieves the users, the limits and the usage on each cluster of the tenant",
+	Example: "  $ heketi-cli tenant info team-a",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		s := cmd.Flags().Args()
+
+		//ensure proper number of args
+		if len(s) < 1 {
+			return errors.New("Tenant name missing")
+		}
+
+		// Create a client to talk to Heketi
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+
+		tenant, err := heketi.TenantInfo(s[0])
+		if err != nil {
+			return err
+		}
+		return printTenant(tenant)
+	},
+}
+
+var tenantListCommand = &cobra.Command{
+	Use:     "list",
+	Short:   "Lists the tenants",
+	Long:    "Lists the tenants",
+	Example: "  $ heketi-cli tenant list",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Create a client
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+
+		list, err := heketi.TenantList()
+		if err != nil {
+			return err
+		}
+
+		if structuredOutput() {
+			return printOutput(list)
+		}
+		for _, name := range list.Tenants {
+			fmt.Fprintf(stdout, "%v\n", name)
+		}
+		return nil
+	},
+}
+
+var tenantUsageCommand = &cobra.Command{
+	Use:   "usage",
+	Short: "Shows the usage of the tenant against its limits",
+	Long: "Shows the volumes of the tenant on each cluster against its limits" +
+		"\nthere. Users can see the usage of their own tenant.",
+	Example: "  $ heketi-cli tenant usage team-a",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		s := cmd.Flags().Args()
+
+		//ensure proper number of args
+		if len(s) < 1 {
+			return errors.New("Tenant name missing")
+		}
+
+		// Create a client to talk to Heketi
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+
+		usage, err := heketi.TenantUsage(s[0])
+		if err != nil {
+			return err
+		}
+		if structuredOutput() {
+			return printOutput(usage)
+		}
+
+		limit := func(used, limit int) string {
+			if limit == 0 {
+				return fmt.Sprintf("%v (no limit)", used)
+			}
+			return fmt.Sprintf("%v of %v", used, limit)
+		}
+		clusters := []string{}
+		for id := range usage.Clusters {
+			clusters = append(clusters, id)
+		}
+		sort.Strings(clusters)
+		for _, id := range clusters {
+			c := usage.Clusters[id]
+			fmt.Fprintf(stdout, "Cluster %v: Size: %v GiB Volumes: %v "+
+				"Block Volumes: %v\n", id,
+				limit((c.Usage.SizeMiB+1023)/1024, c.Limits.SizeGb),
+				limit(c.Usage.Volumes, c.Limits.Volumes),
+				limit(c.Usage.BlockVolumes, c.Limits.BlockVolumes))
+		}
+		return nil
+	},
+}
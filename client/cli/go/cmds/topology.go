@@ -13,11 +13,13 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
 	"os"
 	"strings"
 
 	client "github.com/heketi/heketi/client/api/go-client"
 	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/heketi/pkg/utils"
 	"github.com/spf13/cobra"
 )
 
@@ -27,21 +29,10 @@ const (
 	DURABILITY_STRING_EC              = "disperse"
 )
 
-var jsonConfigFile string
-
-// Config file
-type ConfigFileNode struct {
-	Devices []string           `json:"devices"`
-	Node    api.NodeAddRequest `json:"node"`
-}
-type ConfigFileCluster struct {
-	Nodes []ConfigFileNode `json:"nodes"`
-	Block *bool            `json:"block,omitempty"`
-	File  *bool            `json:"file,omitempty"`
-}
-type ConfigFile struct {
-	Clusters []ConfigFileCluster `json:"clusters"`
-}
+var (
+	jsonConfigFile string
+	topologyApply  bool
+)
 
 func init() {
 	RootCmd.AddCommand(topologyCommand)
@@ -50,8 +41,16 @@ func init() {
 	topologyLoadCommand.Flags().StringVarP(&jsonConfigFile, "json", "j", "",
 		"\n\tConfiguration containing devices, nodes, and clusters, in"+
 			"\n\tJSON format.")
+	topologyCommand.AddCommand(topologyDiffCommand)
+	topologyDiffCommand.Flags().StringVarP(&jsonConfigFile, "json", "j", "",
+		"\n\tConfiguration containing devices, nodes, and clusters, in"+
+			"\n\tJSON format.")
+	topologyDiffCommand.Flags().BoolVar(&topologyApply, "apply", false,
+		"\n\tAdd and remove the nodes and devices to match the"+
+			"\n\tconfiguration.")
 	topologyLoadCommand.SilenceUsage = true
 	topologyInfoCommand.SilenceUsage = true
+	topologyDiffCommand.SilenceUsage = true
 }
 
 var topologyCommand = &cobra.Command{
@@ -112,7 +111,7 @@ var topologyLoadCommand = &cobra.Command{
 		}
 		defer fp.Close()
 		configParser := json.NewDecoder(fp)
-		var topology ConfigFile
+		var topology api.TopologyLoadRequest
 		if err = configParser.Decode(&topology); err != nil {
 			return errors.New("Unable to parse config file")
 		}
@@ -120,117 +119,240 @@ var topologyLoadCommand = &cobra.Command{
 		// Create client
 		heketi := client.NewClient(options.Url, options.User, options.Key)
 
-		// Load current topolgy
-		heketiTopology, err := heketi.TopologyInfo()
-		if err != nil {
-			return fmt.Errorf("Unable to get topology information: %v", err)
+		// Servers without the topology endpoint get the items from
+		// the client
+		result, err := heketi.TopologyLoad(&topology)
+		if code := utils.GetStatusCodeFromError(err); code == http.StatusNotFound ||
+			code == http.StatusMethodNotAllowed {
+			return loadTopologyFromClient(heketi, &topology)
+		} else if err != nil {
+			return err
 		}
 
-		// Register topology
-		for _, cluster := range topology.Clusters {
-
-			// Register Nodes
-			var clusterInfo *api.ClusterInfoResponse
-			for _, node := range cluster.Nodes {
-				// Check node already exists
-				nodeInfo := getNodeIdFromHeketiTopology(heketiTopology, node.Node.Hostnames.Manage[0])
+		if structuredOutput() {
+			return printOutput(result)
+		}
+		for _, r := range result.Results {
+			printTopologyLoadResult(&r)
+		}
+		return nil
+	},
+}
 
-				if nodeInfo != nil {
-					var err error
-					fmt.Fprintf(stdout, "\tFound node %v on cluster %v\n",
-						node.Node.Hostnames.Manage[0], nodeInfo.ClusterId)
-					clusterInfo, err = heketi.ClusterInfo(nodeInfo.ClusterId)
-					if err != nil {
-						fmt.Fprintf(stdout, "Unable to get cluster information\n")
-						return fmt.Errorf("Unable to get cluster information")
-					}
-				} else {
-					var err error
+func printTopologyLoadResult(r *api.TopologyLoadResult) {
+	indent := ""
+	switch r.Type {
+	case api.TopologyLoadNode:
+		indent = "\t"
+	case api.TopologyLoadDevice:
+		indent = "\t\t"
+	}
+	item := r.Type
+	if r.Name != "" {
+		item += " " + r.Name
+	}
+	id := ""
+	if r.Id != "" {
+		id = " ID: " + r.Id
+	}
 
-					// See if we need to create a cluster
-					if clusterInfo == nil {
-						fmt.Fprintf(stdout, "Creating cluster ... ")
-						req := &api.ClusterCreateRequest{}
+	switch r.Result {
+	case api.TopologyLoadCreated:
+		fmt.Fprintf(statusOut(), "%vCreated %v%v\n", indent, item, id)
+	case api.TopologyLoadExists:
+		fmt.Fprintf(statusOut(), "%vFound %v%v\n", indent, item, id)
+	default:
+		fmt.Fprintf(statusOut(), "%vUnable to create %v: %v\n", indent, item, r.Message)
+	}
+}
 
-						if cluster.File == nil {
-							req.File = true
-						} else {
-							req.File = *cluster.File
-						}
+// loadTopologyFromClient adds the items of the topology missing from
+// the server one request at a time
+func loadTopologyFromClient(heketi *client.Client, topology *api.TopologyLoadRequest) error {
+	// Load current topolgy
+	heketiTopology, err := heketi.TopologyInfo()
+	if err != nil {
+		return fmt.Errorf("Unable to get topology information: %v", err)
+	}
 
-						if cluster.Block == nil {
-							req.Block = true
-						} else {
-							req.Block = *cluster.Block
-						}
+	// Register topology
+	for _, cluster := range topology.Clusters {
+
+		// Register Nodes
+		var clusterInfo *api.ClusterInfoResponse
+		for _, node := range cluster.Nodes {
+			// Check node already exists
+			nodeInfo := getNodeIdFromHeketiTopology(heketiTopology, node.Node.Hostnames.Manage[0])
+
+			if nodeInfo != nil {
+				var err error
+				fmt.Fprintf(statusOut(), "\tFound node %v on cluster %v\n",
+					node.Node.Hostnames.Manage[0], nodeInfo.ClusterId)
+				clusterInfo, err = heketi.ClusterInfo(nodeInfo.ClusterId)
+				if err != nil {
+					fmt.Fprintf(statusOut(), "Unable to get cluster information\n")
+					return fmt.Errorf("Unable to get cluster information")
+				}
+			} else {
+				var err error
 
-						clusterInfo, err = heketi.ClusterCreate(req)
-						if err != nil {
-							return err
-						}
-						fmt.Fprintf(stdout, "ID: %v\n", clusterInfo.Id)
+				// See if we need to create a cluster
+				if clusterInfo == nil {
+					fmt.Fprintf(statusOut(), "Creating cluster ... ")
+					req := &api.ClusterCreateRequest{}
 
-						if req.File {
-							fmt.Fprintf(stdout, "\tAllowing file volumes on cluster.\n")
-						}
-						if req.Block {
-							fmt.Fprintf(stdout, "\tAllowing block volumes on cluster.\n")
-						}
+					if cluster.File == nil {
+						req.File = true
+					} else {
+						req.File = *cluster.File
+					}
 
-						// Create a cleanup function in case no
-						// nodes or devices are created
-						defer func() {
-							// Get cluster information
-							info, err := heketi.ClusterInfo(clusterInfo.Id)
-
-							// Delete empty cluster
-							if err == nil && len(info.Nodes) == 0 && len(info.Volumes) == 0 {
-								heketi.ClusterDelete(clusterInfo.Id)
-							}
-						}()
+					if cluster.Block == nil {
+						req.Block = true
+					} else {
+						req.Block = *cluster.Block
 					}
 
-					// Create node
-					fmt.Fprintf(stdout, "\tCreating node %v ... ", node.Node.Hostnames.Manage[0])
-					node.Node.ClusterId = clusterInfo.Id
-					nodeInfo, err = heketi.NodeAdd(&node.Node)
+					clusterInfo, err = heketi.ClusterCreate(req)
 					if err != nil {
-						fmt.Fprintf(stdout, "Unable to create node: %v\n", err)
+						return err
+					}
+					fmt.Fprintf(statusOut(), "ID: %v\n", clusterInfo.Id)
 
-						// Go to next node
-						continue
-					} else {
-						fmt.Fprintf(stdout, "ID: %v\n", nodeInfo.Id)
+					if req.File {
+						fmt.Fprintf(statusOut(), "\tAllowing file volumes on cluster.\n")
 					}
+					if req.Block {
+						fmt.Fprintf(statusOut(), "\tAllowing block volumes on cluster.\n")
+					}
+
+					// Create a cleanup function in case no
+					// nodes or devices are created
+					defer func() {
+						// Get cluster information
+						info, err := heketi.ClusterInfo(clusterInfo.Id)
+
+						// Delete empty cluster
+						if err == nil && len(info.Nodes) == 0 && len(info.Volumes) == 0 {
+							heketi.ClusterDelete(clusterInfo.Id)
+						}
+					}()
 				}
 
-				// Add devices
-				for _, device := range node.Devices {
-					deviceInfo := getDeviceIdFromHeketiTopology(heketiTopology,
-						nodeInfo.Hostnames.Manage[0],
-						device)
-					if deviceInfo != nil {
-						fmt.Fprintf(stdout, "\t\tFound device %v\n", device)
+				// Create node
+				fmt.Fprintf(statusOut(), "\tCreating node %v ... ", node.Node.Hostnames.Manage[0])
+				node.Node.ClusterId = clusterInfo.Id
+				nodeInfo, err = heketi.NodeAdd(&node.Node)
+				if err != nil {
+					fmt.Fprintf(statusOut(), "Unable to create node: %v\n", err)
+
+					// Go to next node
+					continue
+				} else {
+					fmt.Fprintf(statusOut(), "ID: %v\n", nodeInfo.Id)
+				}
+			}
+
+			// Add devices
+			for _, device := range node.Devices {
+				deviceInfo := getDeviceIdFromHeketiTopology(heketiTopology,
+					nodeInfo.Hostnames.Manage[0],
+					device)
+				if deviceInfo != nil {
+					fmt.Fprintf(statusOut(), "\t\tFound device %v\n", device)
+				} else {
+					fmt.Fprintf(statusOut(), "\t\tAdding device %v ... ", device)
+
+					req := &api.DeviceAddRequest{}
+					req.Name = device
+					req.NodeId = nodeInfo.Id
+					err := heketi.DeviceAdd(req)
+					if err != nil {
+						fmt.Fprintf(statusOut(), "Unable to add device: %v\n", err)
 					} else {
-						fmt.Fprintf(stdout, "\t\tAdding device %v ... ", device)
-
-						req := &api.DeviceAddRequest{}
-						req.Name = device
-						req.NodeId = nodeInfo.Id
-						err := heketi.DeviceAdd(req)
-						if err != nil {
-							fmt.Fprintf(stdout, "Unable to add device: %v\n", err)
-						} else {
-							fmt.Fprintf(stdout, "OK\n")
-						}
+						fmt.Fprintf(statusOut(), "OK\n")
 					}
 				}
 			}
 		}
+	}
+	return nil
+}
+
+var topologyDiffCommand = &cobra.Command{
+	Use:   "diff",
+	Short: "Compare Heketi with a configuration file",
+	Long: "Compare the nodes and devices of Heketi with a configuration file,\n" +
+		"optionally adding and removing nodes and devices to match it",
+	Example: ` * Show the changes to match the configuration
+      $ heketi-cli topology diff --json=topo.json
+
+  * Add and remove nodes and devices to match the configuration
+      $ heketi-cli topology diff --json=topo.json --apply`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		// Check arguments
+		if jsonConfigFile == "" {
+			return errors.New("Missing configuration file")
+		}
+
+		// Load config file
+		fp, err := os.Open(jsonConfigFile)
+		if err != nil {
+			return errors.New("Unable to open config file")
+		}
+		defer fp.Close()
+		req := &api.TopologyDiffRequest{Apply: topologyApply}
+		if err = json.NewDecoder(fp).Decode(&req.Topology); err != nil {
+			return errors.New("Unable to parse config file")
+		}
+
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+		diff, err := heketi.TopologyDiff(req)
+		if err != nil {
+			return err
+		}
+
+		if structuredOutput() {
+			return printOutput(diff)
+		}
+		if len(diff.Changes) == 0 {
+			fmt.Fprintf(stdout, "Topology matches the configuration\n")
+		}
+		for _, c := range diff.Changes {
+			printTopologyDiffItem(&c)
+		}
 		return nil
 	},
 }
 
+func printTopologyDiffItem(c *api.TopologyDiffItem) {
+	mark := "!"
+	switch c.Change {
+	case api.TopologyDiffAdd:
+		mark = "+"
+	case api.TopologyDiffRemove:
+		mark = "-"
+	}
+	item := c.Type + " " + c.Name
+	if c.Node != "" {
+		item += " on node " + c.Node
+	}
+	if c.Id != "" {
+		item += " ID: " + c.Id
+	}
+	s := fmt.Sprintf("%v %v", mark, item)
+	switch {
+	case c.Change == api.TopologyDiffMissing:
+		s += fmt.Sprintf(" (missing: %v)", c.Message)
+	case c.Result == api.TopologyLoadFailed:
+		s += fmt.Sprintf(" (failed: %v)", c.Message)
+	case c.Result != "":
+		s += fmt.Sprintf(" (%v)", c.Result)
+	}
+	fmt.Fprintln(stdout, s)
+}
+
 var topologyInfoCommand = &cobra.Command{
 	Use:     "info",
 	Short:   "Retrieves information about the current Topology",
@@ -248,12 +370,10 @@ var topologyInfoCommand = &cobra.Command{
 		}
 
 		// Check if JSON should be printed
-		if options.Json {
-			data, err := json.Marshal(topoinfo)
-			if err != nil {
+		if structuredOutput() {
+			if err := printOutput(topoinfo); err != nil {
 				return err
 			}
-			fmt.Fprintf(stdout, string(data))
 		} else {
 
 			// Get the cluster list and iterate over
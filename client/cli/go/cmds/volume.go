@@ -14,7 +14,9 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	client "github.com/heketi/heketi/client/api/go-client"
 	"github.com/heketi/heketi/pkg/glusterfs/api"
@@ -30,6 +32,9 @@ var (
 	disperseData         int
 	redundancy           int
 	gid                  int64
+	uid                  int64
+	permissions          string
+	selinuxContext       string
 	snapshotFactor       float64
 	clusters             string
 	expandSize           int
@@ -39,20 +44,61 @@ var (
 	kubePv               bool
 	glusterVolumeOptions string
 	block                bool
+	restoreSnapshot      string
+	restoreForce         bool
+	enforceOptions       bool
+	setOptions           string
+	resetOptions         string
+	maxBricks            int
+	brickMinSize         int
+	brickMaxSize         int
+	maxDistribute        int
+	includeNodes         string
+	excludeNodes         string
+	volumeSize           string
+	dryRun               bool
+	tagMatch             string
+	spreadTag            string
+	spreadEnclosure      bool
+	quota                bool
+	quotaLimits          string
+	disableQuota         bool
+	listOpts             api.ListOptions
+	listDurability       string
+	listBlock            bool
+	searchPrefix         bool
+	idempotencyKey       string
 )
 
 func init() {
 	RootCmd.AddCommand(volumeCommand)
 	volumeCommand.AddCommand(volumeCreateCommand)
 	volumeCommand.AddCommand(volumeDeleteCommand)
+	volumeCommand.AddCommand(volumeConfirmDeleteCommand)
+	volumeCommand.AddCommand(volumeCancelDeleteCommand)
 	volumeCommand.AddCommand(volumeExpandCommand)
 	volumeCommand.AddCommand(volumeInfoCommand)
 	volumeCommand.AddCommand(volumeListCommand)
+	volumeCommand.AddCommand(volumeSearchCommand)
+	volumeCommand.AddCommand(volumeRestoreCommand)
+	volumeCommand.AddCommand(volumeCheckOptionsCommand)
+	volumeCommand.AddCommand(volumeCheckBricksCommand)
+	volumeCommand.AddCommand(volumeSetOptionsCommand)
+	volumeCommand.AddCommand(volumeSetQuotaCommand)
+	volumeCommand.AddCommand(volumeIOStatsCommand)
+	volumeCommand.AddCommand(volumeHealInfoCommand)
 
-	volumeCreateCommand.Flags().IntVar(&size, "size", -1,
-		"\n\tSize of volume in GiB")
+	volumeCreateCommand.Flags().StringVar(&volumeSize, "size", "",
+		"\n\tSize of volume in GiB, or with a unit such as 512MiB or 1.5GiB")
 	volumeCreateCommand.Flags().Int64Var(&gid, "gid", 0,
 		"\n\tOptional: Initialize volume with the specified group id")
+	volumeCreateCommand.Flags().Int64Var(&uid, "uid", 0,
+		"\n\tOptional: Initialize volume with the specified owner user id")
+	volumeCreateCommand.Flags().StringVar(&permissions, "permissions", "",
+		"\n\tOptional: Initialize volume with the specified octal permissions,"+
+			"\n\tfor example 0775. Default is 2775 when a group id is given")
+	volumeCreateCommand.Flags().StringVar(&selinuxContext, "selinux-context", "",
+		"\n\tOptional: Initialize volume with the specified SELinux context")
 	volumeCreateCommand.Flags().StringVar(&volname, "name", "",
 		"\n\tOptional: Name of volume. Only set if really necessary")
 	volumeCreateCommand.Flags().StringVar(&durability, "durability", "replicate",
@@ -95,14 +141,97 @@ func init() {
 		"\n\tAmount in GiB to add to the volume")
 	volumeExpandCommand.Flags().StringVar(&id, "volume", "",
 		"\n\tId of volume to expand")
+	volumeExpandCommand.Flags().IntVar(&maxBricks, "max-bricks", 0,
+		"\n\tOptional: New maximum number of bricks of the volume")
+	volumeCreateCommand.Flags().IntVar(&maxBricks, "max-bricks", 0,
+		"\n\tOptional: Maximum number of bricks of the volume."+
+			"\n\tDefault is the limit of the server")
+	volumeCreateCommand.Flags().IntVar(&brickMinSize, "brick-min-size", 0,
+		"\n\tOptional: Minimum size of the bricks in GiB, to get fewer,"+
+			"\n\tlarger bricks. Default is the limit of the server")
+	volumeCreateCommand.Flags().IntVar(&brickMaxSize, "brick-max-size", 0,
+		"\n\tOptional: Maximum size of the bricks in GiB."+
+			"\n\tDefault is the limit of the server")
+	volumeCreateCommand.Flags().IntVar(&maxDistribute, "max-distribute", 0,
+		"\n\tOptional: Maximum number of replica or disperse sets"+
+			"\n\tof the volume")
+	volumeCreateCommand.Flags().StringVar(&includeNodes, "include-nodes", "",
+		"\n\tOptional: Comma separated list of node ids the bricks"+
+			"\n\tof the volume are only placed on")
+	volumeCreateCommand.Flags().StringVar(&excludeNodes, "exclude-nodes", "",
+		"\n\tOptional: Comma separated list of node ids no brick of"+
+			"\n\tthe volume is placed on, such as nodes under maintenance")
 	volumeCreateCommand.Flags().BoolVar(&block, "block", false,
 		"\n\tOptional: Create a block-hosting volume. Intended to host"+
 			"\n\tloopback files to be exported as block devices.")
+	volumeCreateCommand.Flags().BoolVar(&dryRun, "dry-run", false,
+		"\n\tOptional: Show the bricks the volume would get without"+
+			"\n\tcreating it")
+	volumeCreateCommand.Flags().StringVar(&tagMatch, "tag-match", "",
+		"\n\tOptional: Comma separated list of key:value tags the devices"+
+			"\n\tof the bricks must have, e.g. media:ssd")
+	volumeCreateCommand.Flags().StringVar(&spreadTag, "spread-tag", "",
+		"\n\tOptional: Key of the tag whose values must differ between"+
+			"\n\tthe devices of the bricks of a set, e.g. rack")
+	volumeCreateCommand.Flags().BoolVar(&spreadEnclosure, "spread-enclosure", false,
+		"\n\tOptional: Place the bricks of a set on devices of different"+
+			"\n\tenclosures")
+	volumeCreateCommand.Flags().BoolVar(&quota, "quota", false,
+		"\n\tOptional: Enable the quota of the volume")
+	volumeCreateCommand.Flags().StringVar(&quotaLimits, "quota-limits", "",
+		"\n\tOptional: Comma separated list of path:MiB hard limits of"+
+			"\n\tdirectories of the volume, e.g. /:10240. Enables the quota")
+	volumeCreateCommand.Flags().StringVar(&idempotencyKey, "idempotency-key", "",
+		"\n\tOptional: Key of the create. The create repeated with the same"+
+			"\n\tkey returns the volume created by the first one")
+	volumeRestoreCommand.Flags().StringVar(&restoreSnapshot, "snapshot", "",
+		"\n\tId or name of the snapshot to restore the volume from")
+	volumeRestoreCommand.Flags().BoolVar(&restoreForce, "force", false,
+		"\n\tOptional: Restore the volume even if clients are connected to it")
+	volumeCheckOptionsCommand.Flags().BoolVar(&enforceOptions, "enforce", false,
+		"\n\tOptional: Set the options that drifted back to the values set by heketi")
+	volumeSetOptionsCommand.Flags().StringVar(&setOptions, "set", "",
+		"\n\tComma-separated list of options to set, each an option name"+
+			"\n\tand a value, e.g. \"performance.cache-size 256MB\"")
+	volumeSetOptionsCommand.Flags().StringVar(&resetOptions, "reset", "",
+		"\n\tComma-separated list of the names of options to reset to"+
+			"\n\ttheir default values")
+	volumeSetQuotaCommand.Flags().StringVar(&quotaLimits, "limits", "",
+		"\n\tComma separated list of path:MiB hard limits of directories"+
+			"\n\tof the volume, replacing the limits of the volume")
+	volumeSetQuotaCommand.Flags().BoolVar(&disableQuota, "disable", false,
+		"\n\tDisable the quota of the volume, removing all its limits")
+	addListPageFlags(volumeListCommand)
+	volumeListCommand.Flags().StringVar(&listOpts.Cluster, "cluster", "",
+		"\n\tOptional: Only list the volumes of the cluster")
+	volumeListCommand.Flags().StringVar(&listOpts.NamePrefix, "name-prefix", "",
+		"\n\tOptional: Only list the volumes whose names start with the prefix")
+	volumeListCommand.Flags().StringVar(&listDurability, "durability", "",
+		"\n\tOptional: Only list the volumes of the durability type,"+
+			"\n\tnone, replicate or disperse")
+	volumeListCommand.Flags().BoolVar(&listOpts.Expand, "expand", false,
+		"\n\tOptional: List the information of the volumes with their ids"+
+			"\n\tin the json output")
+	volumeListCommand.Flags().BoolVar(&listBlock, "block", false,
+		"\n\tOptional: Only list the block hosting volumes, or with"+
+			"\n\t--block=false only the other volumes")
+	volumeSearchCommand.Flags().BoolVar(&searchPrefix, "prefix", false,
+		"\n\tOptional: Find the volumes whose names start with the name")
 	volumeCreateCommand.SilenceUsage = true
 	volumeDeleteCommand.SilenceUsage = true
+	volumeConfirmDeleteCommand.SilenceUsage = true
+	volumeCancelDeleteCommand.SilenceUsage = true
 	volumeExpandCommand.SilenceUsage = true
 	volumeInfoCommand.SilenceUsage = true
 	volumeListCommand.SilenceUsage = true
+	volumeSearchCommand.SilenceUsage = true
+	volumeRestoreCommand.SilenceUsage = true
+	volumeCheckOptionsCommand.SilenceUsage = true
+	volumeCheckBricksCommand.SilenceUsage = true
+	volumeSetOptionsCommand.SilenceUsage = true
+	volumeSetQuotaCommand.SilenceUsage = true
+	volumeIOStatsCommand.SilenceUsage = true
+	volumeHealInfoCommand.SilenceUsage = true
 }
 
 var volumeCommand = &cobra.Command{
@@ -111,6 +240,27 @@ var volumeCommand = &cobra.Command{
 	Long:  "Heketi Volume Management",
 }
 
+// addListPageFlags adds the flags selecting a page of a list
+func addListPageFlags(cmd *cobra.Command) {
+	cmd.Flags().IntVar(&listOpts.Limit, "limit", 0,
+		"\n\tOptional: Maximum number of entries listed")
+	cmd.Flags().IntVar(&listOpts.Offset, "offset", 0,
+		"\n\tOptional: Number of entries skipped before the listed ones")
+}
+
+// requestSize converts the size given on the command line to the size
+// in GiB of a request, or to its size in MiB if not a whole GiB
+func requestSize(s string) (sizeGiB, sizeMiB int, err error) {
+	mib, err := api.ParseSizeMiB(s)
+	if err != nil {
+		return 0, 0, err
+	}
+	if mib%1024 == 0 {
+		return mib / 1024, 0, nil
+	}
+	return 0, mib, nil
+}
+
 var volumeCreateCommand = &cobra.Command{
 	Use:   "create",
 	Short: "Create a GlusterFS volume",
@@ -118,6 +268,9 @@ var volumeCreateCommand = &cobra.Command{
 	Example: `  * Create a 100GiB replica 3 volume:
       $ heketi-cli volume create --size=100
 
+  * Create a 512MiB replica 3 volume:
+      $ heketi-cli volume create --size=512MiB
+
   * Create a 100GiB replica 3 volume specifying two specific clusters:
       $ heketi-cli volume create --size=100 \
         --clusters=0995098e1284ddccb46c7752d142c832,60d46d518074b13a04ce1022c8c7193c
@@ -137,12 +290,22 @@ var volumeCreateCommand = &cobra.Command{
 
   * Create a 100GiB distributed volume which supports performance related volume options.
       $ heketi-cli volume create --size=100 --durability=none --gluster-volume-options="performance.rda-cache-limit 10MB","performance.nl-cache-positive-entry no"
+
+  * Show where the bricks of a 100GiB replica 3 volume would be placed:
+      $ heketi-cli volume create --size=100 --dry-run
+
+  * Create a 100GiB replica 3 volume on ssd devices in different racks:
+      $ heketi-cli volume create --size=100 --tag-match=media:ssd --spread-tag=rack
 `,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		// Check volume size
-		if size == -1 {
+		if volumeSize == "" {
 			return errors.New("Missing volume size")
 		}
+		sizeGiB, sizeMiB, err := requestSize(volumeSize)
+		if err != nil {
+			return err
+		}
 
 		if kubePv && kubePvEndpoint == "" {
 			fmt.Fprintf(stderr, "--persistent-volume-endpoint must be provided "+
@@ -152,28 +315,65 @@ var volumeCreateCommand = &cobra.Command{
 
 		// Create request blob
 		req := &api.VolumeCreateRequest{}
-		req.Size = size
+		req.Size = sizeGiB
+		req.SizeMiB = sizeMiB
 		req.Durability.Type = api.DurabilityType(durability)
 		req.Durability.Replicate.Replica = replica
 		req.Durability.Disperse.Data = disperseData
 		req.Durability.Disperse.Redundancy = redundancy
 		req.Block = block
+		req.MaxBricks = maxBricks
+		req.BrickLimits.MinSize = brickMinSize
+		req.BrickLimits.MaxSize = brickMaxSize
+		req.BrickLimits.MaxDistribute = maxDistribute
 
 		// Check clusters
 		if clusters != "" {
 			req.Clusters = strings.Split(clusters, ",")
 		}
+		if includeNodes != "" {
+			req.IncludeNodes = strings.Split(includeNodes, ",")
+		}
+		if excludeNodes != "" {
+			req.ExcludeNodes = strings.Split(excludeNodes, ",")
+		}
 
 		// Check volume options
 		if glusterVolumeOptions != "" {
 			req.GlusterVolumeOptions = strings.Split(glusterVolumeOptions, ",")
 		}
 
+		// Check placement tags
+		if tagMatch != "" {
+			req.Placement.TagMatch, err = parseTags(strings.Split(tagMatch, ","), false)
+			if err != nil {
+				return err
+			}
+		}
+		req.Placement.SpreadTag = spreadTag
+		req.Placement.SpreadEnclosure = spreadEnclosure
+
+		// Check quota
+		if quotaLimits != "" {
+			req.Quota.Limits, err = parseQuotaLimits(quotaLimits)
+			if err != nil {
+				return err
+			}
+		}
+		req.Quota.Enable = quota || len(req.Quota.Limits) > 0
+
 		// Set group id if specified
 		if gid != 0 {
 			req.Gid = gid
 		}
 
+		// Set owner, permissions and SELinux context if specified
+		if uid != 0 {
+			req.Uid = uid
+		}
+		req.Permissions = permissions
+		req.SelinuxContext = selinuxContext
+
 		if volname != "" {
 			req.Name = volname
 		}
@@ -186,8 +386,29 @@ var volumeCreateCommand = &cobra.Command{
 		// Create a client
 		heketi := client.NewClient(options.Url, options.User, options.Key)
 
+		if dryRun {
+			simulation, err := heketi.VolumeSimulate(req)
+			if err != nil {
+				return err
+			}
+			if structuredOutput() {
+				if err := printOutput(simulation); err != nil {
+					return err
+				}
+				return nil
+			}
+			fmt.Fprintf(stdout, "Cluster: %v\n", simulation.Cluster)
+			for _, b := range simulation.Bricks {
+				fmt.Fprintf(stdout, "Set:%v Node:%v Hostname:%v Zone:%v "+
+					"Device:%v Name:%v Size (KiB):%v\n",
+					b.Set, b.NodeId, b.Hostname, b.Zone,
+					b.DeviceId, b.DeviceName, b.Size)
+			}
+			return nil
+		}
+
 		// Add volume
-		volume, err := heketi.VolumeCreate(req)
+		volume, err := heketi.VolumeCreateWithKey(req, idempotencyKey)
 		if err != nil {
 			return err
 		}
@@ -218,12 +439,10 @@ var volumeCreateCommand = &cobra.Command{
 			}
 
 		} else {
-			if options.Json {
-				data, err := json.Marshal(volume)
-				if err != nil {
+			if structuredOutput() {
+				if err := printOutput(volume); err != nil {
 					return err
 				}
-				fmt.Fprintf(stdout, string(data))
 			} else {
 				fmt.Fprintf(stdout, "%v", volume)
 			}
@@ -255,9 +474,57 @@ var volumeDeleteCommand = &cobra.Command{
 		//set url
 		err := heketi.VolumeDelete(volumeId)
 		if err == nil {
-			fmt.Fprintf(stdout, "Volume %v deleted\n", volumeId)
+			fmt.Fprintf(statusOut(), "Volume %v deleted\n", volumeId)
+		}
+
+		return err
+	},
+}
+
+var volumeConfirmDeleteCommand = &cobra.Command{
+	Use:   "confirm-delete",
+	Short: "Confirms the delete of the volume",
+	Long: "Confirms the delete of a volume waiting for its confirmation." +
+		"\nThe delete waits when the server requires deletes to be confirmed.",
+	Example: "  $ heketi-cli volume confirm-delete 886a86a868711bef83001",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		s := cmd.Flags().Args()
+
+		//ensure proper number of args
+		if len(s) < 1 {
+			return errors.New("Volume id missing")
+		}
+		volumeId := cmd.Flags().Arg(0)
+
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+		err := heketi.VolumeDeleteConfirm(volumeId)
+		if err == nil {
+			fmt.Fprintf(statusOut(), "Delete of volume %v confirmed\n", volumeId)
 		}
+		return err
+	},
+}
 
+var volumeCancelDeleteCommand = &cobra.Command{
+	Use:   "cancel-delete",
+	Short: "Cancels the delete of the volume",
+	Long: "Cancels the delete of a volume waiting for its confirmation." +
+		"\nThe volume is kept.",
+	Example: "  $ heketi-cli volume cancel-delete 886a86a868711bef83001",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		s := cmd.Flags().Args()
+
+		//ensure proper number of args
+		if len(s) < 1 {
+			return errors.New("Volume id missing")
+		}
+		volumeId := cmd.Flags().Arg(0)
+
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+		err := heketi.VolumeDeleteCancel(volumeId)
+		if err == nil {
+			fmt.Fprintf(statusOut(), "Delete of volume %v cancelled\n", volumeId)
+		}
 		return err
 	},
 }
@@ -282,6 +549,7 @@ var volumeExpandCommand = &cobra.Command{
 		// Create request
 		req := &api.VolumeExpandRequest{}
 		req.Size = expandSize
+		req.MaxBricks = maxBricks
 
 		// Create client
 		heketi := client.NewClient(options.Url, options.User, options.Key)
@@ -292,12 +560,279 @@ var volumeExpandCommand = &cobra.Command{
 			return err
 		}
 
-		if options.Json {
-			data, err := json.Marshal(volume)
+		if structuredOutput() {
+			if err := printOutput(volume); err != nil {
+				return err
+			}
+		} else {
+			fmt.Fprintf(stdout, "%v", volume)
+		}
+		return nil
+	},
+}
+
+var volumeRestoreCommand = &cobra.Command{
+	Use:   "restore",
+	Short: "Restore a volume from a snapshot",
+	Long:  "Restore a volume, in place, from one of its snapshots",
+	Example: `  * Restore a volume from a snapshot
+    $ heketi-cli volume restore 886a86a868711bef83001 --snapshot=snap1
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		//ensure proper number of args
+		s := cmd.Flags().Args()
+		if len(s) < 1 {
+			return errors.New("Volume id missing")
+		}
+
+		if restoreSnapshot == "" {
+			return errors.New("Missing snapshot name")
+		}
+
+		// Set volume id
+		volumeId := cmd.Flags().Arg(0)
+
+		// Create request
+		req := &api.VolumeRestoreRequest{}
+		req.Snapshot = restoreSnapshot
+		req.Force = restoreForce
+
+		// Create client
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+
+		// Restore volume
+		volume, err := heketi.VolumeRestore(volumeId, req)
+		if err != nil {
+			return err
+		}
+
+		if structuredOutput() {
+			if err := printOutput(volume); err != nil {
+				return err
+			}
+		} else {
+			fmt.Fprintf(stdout, "%v", volume)
+		}
+		return nil
+	},
+}
+
+var volumeCheckOptionsCommand = &cobra.Command{
+	Use:   "check-options",
+	Short: "Compares the options of a volume with the ones set by heketi",
+	Long: "Compares the options of a volume in gluster with the options\n" +
+		"set by heketi and reports the options that drifted",
+	Example: `  * Report the options that drifted
+    $ heketi-cli volume check-options 886a86a868711bef83001
+
+  * Set the options that drifted back to the values set by heketi
+    $ heketi-cli volume check-options 886a86a868711bef83001 --enforce
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		//ensure proper number of args
+		s := cmd.Flags().Args()
+		if len(s) < 1 {
+			return errors.New("Volume id missing")
+		}
+
+		// Set volume id
+		volumeId := cmd.Flags().Arg(0)
+
+		// Create client
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+
+		check, err := heketi.VolumeOptionsCheck(volumeId,
+			&api.VolumeOptionsCheckRequest{Enforce: enforceOptions})
+		if err != nil {
+			return err
+		}
+
+		if structuredOutput() {
+			if err := printOutput(check); err != nil {
+				return err
+			}
+		} else {
+			if len(check.Drift) == 0 {
+				fmt.Fprintf(stdout, "No options drifted\n")
+			}
+			for _, d := range check.Drift {
+				fmt.Fprintf(stdout, "%v: %q instead of %q\n",
+					d.Option, d.Actual, d.Expected)
+			}
+			if check.Enforced {
+				fmt.Fprintf(stdout, "Options enforced\n")
+			}
+		}
+		return nil
+	},
+}
+
+var volumeCheckBricksCommand = &cobra.Command{
+	Use:   "check-bricks",
+	Short: "Compares the brick sets of a volume with the ones of heketi",
+	Long: "Compares the replica or disperse sets of the bricks of a volume\n" +
+		"in gluster with the sets recorded by heketi and reports the sets\n" +
+		"changed outside of heketi",
+	Example: `  * Report the sets whose bricks differ
+    $ heketi-cli volume check-bricks 886a86a868711bef83001
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		//ensure proper number of args
+		s := cmd.Flags().Args()
+		if len(s) < 1 {
+			return errors.New("Volume id missing")
+		}
+
+		// Set volume id
+		volumeId := cmd.Flags().Arg(0)
+
+		// Create client
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+
+		check, err := heketi.VolumeBrickOrderCheck(volumeId)
+		if err != nil {
+			return err
+		}
+
+		if structuredOutput() {
+			if err := printOutput(check); err != nil {
+				return err
+			}
+		} else {
+			if check.Recorded {
+				fmt.Fprintf(stdout, "Brick order recorded\n")
+			}
+			if len(check.Mismatches) == 0 {
+				fmt.Fprintf(stdout, "No brick sets differ\n")
+			}
+			for _, m := range check.Mismatches {
+				fmt.Fprintf(stdout, "Set %v: %v instead of %v\n",
+					m.Set, strings.Join(m.Actual, " "),
+					strings.Join(m.Expected, " "))
+			}
+		}
+		return nil
+	},
+}
+
+var volumeSetOptionsCommand = &cobra.Command{
+	Use:   "set-options",
+	Short: "Sets or resets gluster options of a volume",
+	Long:  "Sets or resets gluster options of a volume",
+	Example: `  * Set options of a volume
+    $ heketi-cli volume set-options 886a86a868711bef83001 \
+      --set="performance.cache-size 256MB,performance.read-ahead off"
+
+  * Reset an option of a volume to its default value
+    $ heketi-cli volume set-options 886a86a868711bef83001 \
+      --reset=performance.cache-size
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		//ensure proper number of args
+		s := cmd.Flags().Args()
+		if len(s) < 1 {
+			return errors.New("Volume id missing")
+		}
+		if setOptions == "" && resetOptions == "" {
+			return errors.New("At least one of --set or --reset must be specified.")
+		}
+
+		// Set volume id
+		volumeId := cmd.Flags().Arg(0)
+
+		req := &api.VolumeOptionsRequest{}
+		if setOptions != "" {
+			req.Set = strings.Split(setOptions, ",")
+		}
+		if resetOptions != "" {
+			req.Reset = strings.Split(resetOptions, ",")
+		}
+
+		// Create client
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+
+		volume, err := heketi.VolumeSetOptions(volumeId, req)
+		if err != nil {
+			return err
+		}
+
+		if structuredOutput() {
+			if err := printOutput(volume); err != nil {
+				return err
+			}
+		} else {
+			fmt.Fprintf(stdout, "%v", volume)
+		}
+		return nil
+	},
+}
+
+// parseQuotaLimits parses a comma separated list of path:MiB limits
+func parseQuotaLimits(arg string) ([]api.VolumeQuotaLimit, error) {
+	limits := []api.VolumeQuotaLimit{}
+	for _, l := range strings.Split(arg, ",") {
+		sep := strings.LastIndex(l, ":")
+		if sep <= 0 {
+			return nil, fmt.Errorf("Invalid quota limit %v, must be path:MiB", l)
+		}
+		mib, err := strconv.Atoi(l[sep+1:])
+		if err != nil {
+			return nil, fmt.Errorf("Invalid quota limit %v, must be path:MiB", l)
+		}
+		limits = append(limits, api.VolumeQuotaLimit{
+			Path:         l[:sep],
+			HardLimitMiB: mib,
+		})
+	}
+	return limits, nil
+}
+
+var volumeSetQuotaCommand = &cobra.Command{
+	Use:   "set-quota",
+	Short: "Enables or disables the quota of a volume and sets its limits",
+	Long:  "Enables or disables the quota of a volume and sets its limits",
+	Example: `  * Enable the quota of a volume and limit the volume to 10GiB
+    and one of its directories to 1GiB
+    $ heketi-cli volume set-quota 886a86a868711bef83001 \
+      --limits=/:10240,/tenants/a:1024
+
+  * Disable the quota of a volume
+    $ heketi-cli volume set-quota 886a86a868711bef83001 --disable
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		//ensure proper number of args
+		s := cmd.Flags().Args()
+		if len(s) < 1 {
+			return errors.New("Volume id missing")
+		}
+		if disableQuota && quotaLimits != "" {
+			return errors.New("--limits can not be used with --disable")
+		}
+
+		// Set volume id
+		volumeId := cmd.Flags().Arg(0)
+
+		req := &api.VolumeQuota{Enable: !disableQuota}
+		if quotaLimits != "" {
+			var err error
+			req.Limits, err = parseQuotaLimits(quotaLimits)
 			if err != nil {
 				return err
 			}
-			fmt.Fprintf(stdout, string(data))
+		}
+
+		// Create client
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+
+		volume, err := heketi.VolumeSetQuota(volumeId, req)
+		if err != nil {
+			return err
+		}
+
+		if structuredOutput() {
+			if err := printOutput(volume); err != nil {
+				return err
+			}
 		} else {
 			fmt.Fprintf(stdout, "%v", volume)
 		}
@@ -305,6 +840,93 @@ var volumeExpandCommand = &cobra.Command{
 	},
 }
 
+var volumeIOStatsCommand = &cobra.Command{
+	Use:   "iostats",
+	Short: "Shows the latest io samples of a volume",
+	Long: "Shows the io of a volume sampled by heketi from the profile of\n" +
+		"the volume. Profiling must be started on the volume in gluster.",
+	Example: "  $ heketi-cli volume iostats 886a86a868711bef83001",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		//ensure proper number of args
+		s := cmd.Flags().Args()
+		if len(s) < 1 {
+			return errors.New("Volume id missing")
+		}
+
+		// Set volume id
+		volumeId := cmd.Flags().Arg(0)
+
+		// Create client
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+
+		stats, err := heketi.VolumeIOStats(volumeId)
+		if err != nil {
+			return err
+		}
+
+		if structuredOutput() {
+			if err := printOutput(stats); err != nil {
+				return err
+			}
+		} else {
+			if len(stats.Samples) == 0 {
+				fmt.Fprintf(stdout, "No io samples\n")
+			}
+			for _, sample := range stats.Samples {
+				fmt.Fprintf(stdout, "%v Interval:%vs Read:%v Write:%v Fops:%v\n",
+					time.Unix(sample.Time, 0).Format(time.RFC3339),
+					sample.Interval,
+					sample.ReadBytes,
+					sample.WriteBytes,
+					sample.Fops)
+			}
+		}
+		return nil
+	},
+}
+
+var volumeHealInfoCommand = &cobra.Command{
+	Use:     "heal-info",
+	Short:   "Shows the self-heal state of the bricks of a volume",
+	Long:    "Shows the entries pending heal and the online state of each\nbrick of a volume as reported by gluster",
+	Example: "  $ heketi-cli volume heal-info 886a86a868711bef83001",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		//ensure proper number of args
+		s := cmd.Flags().Args()
+		if len(s) < 1 {
+			return errors.New("Volume id missing")
+		}
+
+		// Set volume id
+		volumeId := cmd.Flags().Arg(0)
+
+		// Create client
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+
+		heal, err := heketi.VolumeHealInfo(volumeId)
+		if err != nil {
+			return err
+		}
+
+		if structuredOutput() {
+			if err := printOutput(heal); err != nil {
+				return err
+			}
+		} else {
+			fmt.Fprintf(stdout, "Entries pending heal: %v\n", heal.PendingEntries)
+			for _, b := range heal.Bricks {
+				pending := "-"
+				if b.PendingEntries >= 0 {
+					pending = fmt.Sprintf("%v", b.PendingEntries)
+				}
+				fmt.Fprintf(stdout, "Id:%-35v Name:%v Online:%v Pending:%v\n",
+					b.Id, b.Name, b.Online, pending)
+			}
+		}
+		return nil
+	},
+}
+
 var volumeInfoCommand = &cobra.Command{
 	Use:     "info",
 	Short:   "Retrieves information about the volume",
@@ -329,12 +951,10 @@ var volumeInfoCommand = &cobra.Command{
 			return err
 		}
 
-		if options.Json {
-			data, err := json.Marshal(info)
-			if err != nil {
+		if structuredOutput() {
+			if err := printOutput(info); err != nil {
 				return err
 			}
-			fmt.Fprintf(stdout, string(data))
 		} else {
 			fmt.Fprintf(stdout, "%v", info)
 		}
@@ -344,39 +964,46 @@ var volumeInfoCommand = &cobra.Command{
 }
 
 var volumeListCommand = &cobra.Command{
-	Use:     "list",
-	Short:   "Lists the volumes managed by Heketi",
-	Long:    "Lists the volumes managed by Heketi",
-	Example: "  $ heketi-cli volume list",
+	Use:   "list",
+	Short: "Lists the volumes managed by Heketi",
+	Long:  "Lists the volumes managed by Heketi",
+	Example: `  * List all the volumes:
+      $ heketi-cli volume list
+
+  * List the first 100 block hosting volumes of a cluster:
+      $ heketi-cli volume list --block --limit=100 \
+        --cluster=0995098e1284ddccb46c7752d142c832`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		// Create a client
 		heketi := client.NewClient(options.Url, options.User, options.Key)
 
+		listOpts.Durability = api.DurabilityType(listDurability)
+		if cmd.Flags().Changed("block") {
+			listOpts.Block = &listBlock
+		}
+		// The volumes are listed with their information
+		if !structuredOutput() {
+			listOpts.Expand = true
+		}
+
 		// List volumes
-		list, err := heketi.VolumeList()
+		list, err := heketi.VolumeListWithOptions(&listOpts)
 		if err != nil {
 			return err
 		}
 
-		if options.Json {
-			data, err := json.Marshal(list)
-			if err != nil {
+		if structuredOutput() {
+			if err := printOutput(list); err != nil {
 				return err
 			}
-			fmt.Fprintf(stdout, string(data))
 		} else {
-			for _, id := range list.Volumes {
-				volume, err := heketi.VolumeInfo(id)
-				if err != nil {
-					return err
-				}
-
+			for _, volume := range list.Infos {
 				blockstr := ""
 				if volume.Block {
 					blockstr = " [block]"
 				}
 				fmt.Fprintf(stdout, "Id:%-35v Cluster:%-35v Name:%v%v\n",
-					id,
+					volume.Id,
 					volume.Cluster,
 					volume.Name,
 					blockstr)
@@ -386,3 +1013,41 @@ var volumeListCommand = &cobra.Command{
 		return nil
 	},
 }
+
+var volumeSearchCommand = &cobra.Command{
+	Use:   "search",
+	Short: "Finds the volumes by name",
+	Long:  "Finds the volumes with the name, or with names starting with it",
+	Example: `  * Find the volumes named myvol:
+      $ heketi-cli volume search myvol
+
+  * Find the volumes whose names start with pvc-:
+      $ heketi-cli volume search --prefix pvc-`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		s := cmd.Flags().Args()
+
+		//ensure proper number of args
+		if len(s) < 1 {
+			return errors.New("Volume name missing")
+		}
+
+		req := &api.VolumeSearchRequest{Name: cmd.Flags().Arg(0)}
+		if searchPrefix {
+			req.Match = api.VolumeSearchPrefix
+		}
+
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+		list, err := heketi.VolumeSearch(req)
+		if err != nil {
+			return err
+		}
+
+		if structuredOutput() {
+			return printOutput(list)
+		}
+		for _, id := range list.Volumes {
+			fmt.Fprintf(stdout, "Id:%v\n", id)
+		}
+		return nil
+	},
+}
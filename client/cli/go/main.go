@@ -27,6 +27,6 @@ func main() {
 	cmd := cmds.NewHeketiCli(HEKETI_CLI_VERSION, stderr, stdout)
 	if err := cmd.Execute(); err != nil {
 		//fmt.Println(err) //Should be used for logging
-		os.Exit(-1)
+		os.Exit(cmds.ExitCode(err))
 	}
 }
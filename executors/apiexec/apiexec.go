@@ -0,0 +1,263 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package apiexec
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/heketi/heketi/executors"
+	"github.com/heketi/heketi/pkg/utils"
+)
+
+const (
+	defaultScheme        = "http"
+	defaultPort          = "24007"
+	defaultTimeout       = 30
+	defaultRetryInterval = 300
+
+	// Header set by glusterd in its responses
+	peerIdHeader = "X-Gluster-Peer-Id"
+)
+
+var (
+	logger = utils.NewLogger("[apiexec]", utils.LEVEL_DEBUG)
+
+	// Returned when the api of a node is known to be unreachable
+	errApiUnavailable = errors.New("management api unavailable")
+)
+
+// ApiExecutor runs the operations supported by the management api of
+// glusterd over http and falls back to the executor it wraps, which
+// runs the gluster cli, for everything else or when the api of a node
+// can not be reached.
+type ApiExecutor struct {
+	executors.Executor
+
+	config *ApiConfig
+	client *http.Client
+
+	lock sync.Mutex
+	// Hosts whose api could not be reached, and when
+	unavailable map[string]time.Time
+}
+
+// apiError is an error reported by the api
+type apiError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("%v (%v)", e.Message, e.StatusCode)
+}
+
+func NewApiExecutor(config *ApiConfig, fallback executors.Executor) (*ApiExecutor, error) {
+	c := *config
+	if c.Scheme == "" {
+		c.Scheme = defaultScheme
+	}
+	if c.Scheme != "http" && c.Scheme != "https" {
+		return nil, fmt.Errorf("Invalid management api scheme: %v", c.Scheme)
+	}
+	if c.Port == "" {
+		c.Port = defaultPort
+	}
+	if c.Timeout == 0 {
+		c.Timeout = defaultTimeout
+	}
+	if c.RetryInterval == 0 {
+		c.RetryInterval = defaultRetryInterval
+	}
+
+	return &ApiExecutor{
+		Executor: fallback,
+		config:   &c,
+		client: &http.Client{
+			Timeout: time.Duration(c.Timeout) * time.Second,
+		},
+		unavailable: map[string]time.Time{},
+	}, nil
+}
+
+func (a *ApiExecutor) SetLogLevel(level string) {
+	a.Executor.SetLogLevel(level)
+
+	switch level {
+	case "none":
+		logger.SetLevel(utils.LEVEL_NOLOG)
+	case "critical":
+		logger.SetLevel(utils.LEVEL_CRITICAL)
+	case "error":
+		logger.SetLevel(utils.LEVEL_ERROR)
+	case "warning":
+		logger.SetLevel(utils.LEVEL_WARNING)
+	case "info":
+		logger.SetLevel(utils.LEVEL_INFO)
+	case "debug":
+		logger.SetLevel(utils.LEVEL_DEBUG)
+	}
+}
+
+// SetHostCluster passes the cluster of the host to the wrapped executor
+func (a *ApiExecutor) SetHostCluster(host, cluster string) {
+	if mapper, ok := a.Executor.(executors.HostClusterMapper); ok {
+		mapper.SetHostCluster(host, cluster)
+	}
+}
+
+// SetHostAlternates passes the alternates of the host to the
+// wrapped executor
+func (a *ApiExecutor) SetHostAlternates(host string, alternates []string) {
+	if resolver, ok := a.Executor.(executors.HostResolver); ok {
+		resolver.SetHostAlternates(host, alternates)
+	}
+}
+
+// SetResolutionHandler sets the resolution handler of the
+// wrapped executor
+func (a *ApiExecutor) SetResolutionHandler(handler func(host string, r executors.HostResolution)) {
+	if resolver, ok := a.Executor.(executors.HostResolver); ok {
+		resolver.SetResolutionHandler(handler)
+	}
+}
+
+// SetCommandOutputHandler sets the command output handler of the
+// wrapped executor
+func (a *ApiExecutor) SetCommandOutputHandler(handler func(o *executors.CommandOutput)) {
+	if recorder, ok := a.Executor.(executors.CommandOutputRecorder); ok {
+		recorder.SetCommandOutputHandler(handler)
+	}
+}
+
+func (a *ApiExecutor) available(host string) bool {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	since, ok := a.unavailable[host]
+	if !ok {
+		return true
+	}
+	if time.Since(since) < time.Duration(a.config.RetryInterval)*time.Second {
+		return false
+	}
+	delete(a.unavailable, host)
+	return true
+}
+
+func (a *ApiExecutor) setUnavailable(host string) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.unavailable[host] = time.Now()
+}
+
+// fallback logs why the api could not be used for the operation
+// before it is run by the wrapped executor
+func (a *ApiExecutor) fallback(host, op string, err error) {
+	if err != errApiUnavailable {
+		logger.Warning("Unable to %v on %v using the management api, "+
+			"falling back to the gluster cli: %v", op, host, err)
+	}
+}
+
+func (a *ApiExecutor) setToken(r *http.Request) error {
+	qsh := sha256.Sum256([]byte(r.Method + "&" + r.URL.Path))
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"iss": a.config.User,
+		"iat": time.Now().Unix(),
+		"exp": time.Now().Add(time.Second * 10).Unix(),
+		"qsh": hex.EncodeToString(qsh[:]),
+	})
+	signed, err := token.SignedString([]byte(a.config.Secret))
+	if err != nil {
+		return err
+	}
+	r.Header.Set("Authorization", "bearer "+signed)
+	return nil
+}
+
+// do sends a request to the api of the host and decodes the response
+// into result, when set. It returns the response so that its headers
+// can be inspected. Hosts that can not be reached are not tried again
+// for the retry interval.
+func (a *ApiExecutor) do(host, method, path string,
+	body, result interface{}) (*http.Response, error) {
+
+	if !a.available(host) {
+		return nil, errApiUnavailable
+	}
+
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(b)
+	}
+
+	url := fmt.Sprintf("%v://%v%v", a.config.Scheme,
+		net.JoinHostPort(host, a.config.Port), path)
+	req, err := http.NewRequest(method, url, reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if a.config.Secret != "" {
+		if err := a.setToken(req); err != nil {
+			return nil, err
+		}
+	}
+
+	r, err := a.client.Do(req)
+	if err != nil {
+		a.setUnavailable(host)
+		return nil, err
+	}
+	defer r.Body.Close()
+
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	if r.StatusCode < 200 || r.StatusCode >= 300 {
+		return nil, newApiError(r.StatusCode, data)
+	}
+	if result != nil {
+		if err := json.Unmarshal(data, result); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+func newApiError(status int, data []byte) error {
+	var e struct {
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	msg := http.StatusText(status)
+	if json.Unmarshal(data, &e) == nil && len(e.Errors) > 0 {
+		msg = e.Errors[0].Message
+	}
+	return &apiError{StatusCode: status, Message: msg}
+}
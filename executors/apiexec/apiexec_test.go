@@ -0,0 +1,165 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package apiexec
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/heketi/heketi/executors"
+	"github.com/heketi/heketi/executors/mockexec"
+	"github.com/heketi/tests"
+)
+
+// newTestApiExecutor returns an executor using the api served by
+// handler on the host it returns, falling back to a mock executor
+func newTestApiExecutor(t *testing.T,
+	handler http.HandlerFunc) (*ApiExecutor, *mockexec.MockExecutor, string, func()) {
+
+	ts := httptest.NewServer(handler)
+	host, port, err := net.SplitHostPort(strings.TrimPrefix(ts.URL, "http://"))
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	m, err := mockexec.NewMockExecutor()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	a, err := NewApiExecutor(&ApiConfig{Enabled: true, Port: port}, m)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	return a, m, host, ts.Close
+}
+
+func TestApiExecutorInvalidScheme(t *testing.T) {
+	m, err := mockexec.NewMockExecutor()
+	tests.Assert(t, err == nil)
+
+	_, err = NewApiExecutor(&ApiConfig{Scheme: "ftp"}, m)
+	tests.Assert(t, err != nil)
+}
+
+func TestApiExecutorPeerStatus(t *testing.T) {
+	a, m, host, done := newTestApiExecutor(t, func(w http.ResponseWriter, r *http.Request) {
+		tests.Assert(t, r.Method == http.MethodGet)
+		tests.Assert(t, r.URL.Path == "/v1/peers", r.URL.Path)
+		w.Header().Set(peerIdHeader, "self")
+		w.Write([]byte(`[
+			{"id": "self", "name": "a", "peer-addresses": ["a:24008"], "online": true},
+			{"id": "p2", "name": "b", "peer-addresses": ["b:24008", "b2"], "online": true},
+			{"id": "p3", "name": "c", "peer-addresses": ["[fd00::3]:24008"], "online": false}
+		]`))
+	})
+	defer done()
+	m.MockPeerStatus = func(host string) (*executors.PeerStatus, error) {
+		t.Fatal("unexpected fallback")
+		return nil, nil
+	}
+
+	status, err := a.PeerStatus(host)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(status.Peers) == 2, status.Peers)
+
+	p := status.Peers[0]
+	tests.Assert(t, p.Uuid == "p2")
+	tests.Assert(t, p.Hostname == "b", p.Hostname)
+	tests.Assert(t, len(p.Hostnames) == 2 && p.Hostnames[1] == "b2", p.Hostnames)
+	tests.Assert(t, p.Connected == 1)
+
+	p = status.Peers[1]
+	tests.Assert(t, p.Hostname == "fd00::3", p.Hostname)
+	tests.Assert(t, p.Connected == 0)
+	tests.Assert(t, strings.Contains(p.StateStr, "Disconnected"), p.StateStr)
+}
+
+func TestApiExecutorVolumeInfo(t *testing.T) {
+	a, _, host, done := newTestApiExecutor(t, func(w http.ResponseWriter, r *http.Request) {
+		tests.Assert(t, r.URL.Path == "/v1/volumes/vol1", r.URL.Path)
+		w.Write([]byte(`{
+			"id": "1234", "name": "vol1", "type": "Replicate", "state": "Started",
+			"replica-count": 3, "arbiter-count": 1,
+			"options": {"performance.readdir-ahead": "on", "cluster.quorum-type": "auto"},
+			"subvols": [{"bricks": [
+				{"id": "b1", "peer-id": "p1", "host": "a", "path": "/b1"},
+				{"id": "b2", "peer-id": "p2", "host": "b", "path": "/b2"},
+				{"id": "b3", "peer-id": "p3", "host": "c", "path": "/b3", "type": "Arbiter"}
+			]}]
+		}`))
+	})
+	defer done()
+
+	v, err := a.VolumeInfo(host, "vol1")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, v.VolumeName == "vol1")
+	tests.Assert(t, v.Status == 1 && v.StatusStr == "Started", v.Status)
+	tests.Assert(t, v.ReplicaCount == 3 && v.ArbiterCount == 1)
+	tests.Assert(t, v.BrickCount == 3, v.BrickCount)
+	tests.Assert(t, v.Bricks.BrickList[0].Name == "a:/b1", v.Bricks.BrickList[0].Name)
+	tests.Assert(t, v.Bricks.BrickList[0].HostUUID == "p1")
+	tests.Assert(t, v.Bricks.BrickList[2].IsArbiter == 1)
+	tests.Assert(t, v.OptCount == 2)
+	tests.Assert(t, v.Options.OptionList[0].Name == "cluster.quorum-type")
+}
+
+func TestApiExecutorFallback(t *testing.T) {
+	a, m, host, done := newTestApiExecutor(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"errors": [{"code": 1, "message": "volume start failed"}]}`))
+	})
+	defer done()
+
+	started := 0
+	m.MockVolumeStart = func(host string, volume string) error {
+		started++
+		return nil
+	}
+
+	err := a.VolumeStart(host, "vol1")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, started == 1)
+
+	// Errors of the api do not make the api unavailable
+	tests.Assert(t, a.available(host))
+}
+
+func TestApiExecutorUnreachable(t *testing.T) {
+	a, m, host, done := newTestApiExecutor(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("unexpected request")
+	})
+	done()
+
+	checked := 0
+	m.MockGlusterdCheck = func(host string) error {
+		checked++
+		return nil
+	}
+
+	err := a.GlusterdCheck(host)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, checked == 1)
+	tests.Assert(t, !a.available(host))
+
+	// The api is not tried again until the retry interval passes
+	_, err = a.do(host, http.MethodGet, "/ping", nil, nil)
+	tests.Assert(t, err == errApiUnavailable, err)
+}
+
+func TestApiExecutorToken(t *testing.T) {
+	a, _, host, done := newTestApiExecutor(t, func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		tests.Assert(t, strings.HasPrefix(auth, "bearer "), auth)
+	})
+	defer done()
+	a.config.User = "heketi"
+	a.config.Secret = "secret"
+
+	err := a.GlusterdCheck(host)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+}
@@ -0,0 +1,32 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package apiexec
+
+type ApiConfig struct {
+	// Use the management api of glusterd when available
+	Enabled bool `json:"enabled"`
+
+	// Scheme and port of the api on the management hostname of the
+	// nodes. Defaults to http and 24007.
+	Scheme string `json:"scheme"`
+	Port   string `json:"port"`
+
+	// User and secret signing the requests when authentication
+	// is enabled in glusterd
+	User   string `json:"user"`
+	Secret string `json:"secret"`
+
+	// Seconds to wait for a response. Defaults to 30.
+	Timeout int `json:"timeout"`
+
+	// Seconds before the api of a node is tried again after it
+	// could not be reached. Defaults to 300.
+	RetryInterval int `json:"retry_interval"`
+}
@@ -0,0 +1,84 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package apiexec
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/heketi/heketi/executors"
+	"github.com/lpabon/godbc"
+)
+
+// peer as reported by the api
+type apiPeer struct {
+	ID              string   `json:"id"`
+	Name            string   `json:"name"`
+	PeerAddresses   []string `json:"peer-addresses"`
+	ClientAddresses []string `json:"client-addresses"`
+	Online          bool     `json:"online"`
+}
+
+func (a *ApiExecutor) GlusterdCheck(host string) error {
+	godbc.Require(host != "")
+
+	_, err := a.do(host, http.MethodGet, "/ping", nil, nil)
+	if err != nil {
+		a.fallback(host, "check glusterd", err)
+		return a.Executor.GlusterdCheck(host)
+	}
+	return nil
+}
+
+func (a *ApiExecutor) PeerStatus(host string) (*executors.PeerStatus, error) {
+	godbc.Require(host != "")
+
+	var peers []apiPeer
+	r, err := a.do(host, http.MethodGet, "/v1/peers", nil, &peers)
+	if err != nil {
+		a.fallback(host, "get the peer status", err)
+		return a.Executor.PeerStatus(host)
+	}
+	return newPeerStatus(peers, r.Header.Get(peerIdHeader)), nil
+}
+
+// newPeerStatus converts the peers reported by the api to the peer
+// status of the cli, which does not include the peer it is run on.
+func newPeerStatus(peers []apiPeer, self string) *executors.PeerStatus {
+	status := &executors.PeerStatus{}
+	for _, p := range peers {
+		if p.ID == self {
+			continue
+		}
+
+		peer := executors.Peer{
+			Uuid:     p.ID,
+			Hostname: p.Name,
+			StateStr: "Peer in Cluster",
+			State:    3,
+		}
+		for _, addr := range p.PeerAddresses {
+			if h, _, err := net.SplitHostPort(addr); err == nil {
+				addr = h
+			}
+			peer.Hostnames = append(peer.Hostnames, addr)
+		}
+		if len(peer.Hostnames) > 0 {
+			peer.Hostname = peer.Hostnames[0]
+		}
+		if p.Online {
+			peer.Connected = 1
+		} else {
+			peer.StateStr += " (Disconnected)"
+		}
+		status.Peers = append(status.Peers, peer)
+	}
+	return status
+}
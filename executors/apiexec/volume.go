@@ -0,0 +1,132 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package apiexec
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/heketi/heketi/executors"
+	"github.com/lpabon/godbc"
+)
+
+// States of the volumes as numbered by the cli
+var volumeStates = map[string]int{
+	"Created": 0,
+	"Started": 1,
+	"Stopped": 2,
+}
+
+// volume as reported by the api
+type apiVolume struct {
+	ID              string            `json:"id"`
+	Name            string            `json:"name"`
+	Type            string            `json:"type"`
+	Transport       string            `json:"transport"`
+	DistCount       int               `json:"distribute-count"`
+	ReplicaCount    int               `json:"replica-count"`
+	ArbiterCount    int               `json:"arbiter-count"`
+	DisperseCount   int               `json:"disperse-count"`
+	RedundancyCount int               `json:"disperse-redundancy-count"`
+	State           string            `json:"state"`
+	Options         map[string]string `json:"options"`
+	Subvols         []struct {
+		Bricks []struct {
+			ID     string `json:"id"`
+			PeerID string `json:"peer-id"`
+			Host   string `json:"host"`
+			Path   string `json:"path"`
+			Type   string `json:"type"`
+		} `json:"bricks"`
+	} `json:"subvols"`
+}
+
+func (a *ApiExecutor) VolumeInfo(host string, volume string) (*executors.Volume, error) {
+	godbc.Require(volume != "")
+	godbc.Require(host != "")
+
+	var v apiVolume
+	_, err := a.do(host, http.MethodGet, "/v1/volumes/"+volume, nil, &v)
+	if err != nil {
+		a.fallback(host, "get volume info of "+volume, err)
+		return a.Executor.VolumeInfo(host, volume)
+	}
+	return newVolume(&v), nil
+}
+
+// newVolume converts a volume reported by the api to the volume info
+// of the cli
+func newVolume(v *apiVolume) *executors.Volume {
+	vol := &executors.Volume{
+		VolumeName:      v.Name,
+		ID:              v.ID,
+		Status:          volumeStates[v.State],
+		StatusStr:       v.State,
+		DistCount:       v.DistCount,
+		ReplicaCount:    v.ReplicaCount,
+		ArbiterCount:    v.ArbiterCount,
+		DisperseCount:   v.DisperseCount,
+		RedundancyCount: v.RedundancyCount,
+		TypeStr:         v.Type,
+	}
+
+	for _, s := range v.Subvols {
+		for _, b := range s.Bricks {
+			brick := executors.Brick{
+				UUID:     b.ID,
+				Name:     fmt.Sprintf("%v:%v", b.Host, b.Path),
+				HostUUID: b.PeerID,
+			}
+			if b.Type == "Arbiter" {
+				brick.IsArbiter = 1
+			}
+			vol.Bricks.BrickList = append(vol.Bricks.BrickList, brick)
+		}
+	}
+	vol.BrickCount = len(vol.Bricks.BrickList)
+
+	names := []string{}
+	for name := range v.Options {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		vol.Options.OptionList = append(vol.Options.OptionList,
+			executors.Option{Name: name, Value: v.Options[name]})
+	}
+	vol.OptCount = len(vol.Options.OptionList)
+
+	return vol
+}
+
+func (a *ApiExecutor) VolumeStart(host string, volume string) error {
+	godbc.Require(host != "")
+	godbc.Require(volume != "")
+
+	_, err := a.do(host, http.MethodPost, "/v1/volumes/"+volume+"/start", nil, nil)
+	if err != nil {
+		a.fallback(host, "start volume "+volume, err)
+		return a.Executor.VolumeStart(host, volume)
+	}
+	return nil
+}
+
+func (a *ApiExecutor) VolumeStop(host string, volume string) error {
+	godbc.Require(host != "")
+	godbc.Require(volume != "")
+
+	_, err := a.do(host, http.MethodPost, "/v1/volumes/"+volume+"/stop", nil, nil)
+	if err != nil {
+		a.fallback(host, "stop volume "+volume, err)
+		return a.Executor.VolumeStop(host, volume)
+	}
+	return nil
+}
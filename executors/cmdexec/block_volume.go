@@ -12,12 +12,23 @@ package cmdexec
 import (
 	"encoding/json"
 	"fmt"
+	"math"
+	"strconv"
 	"strings"
 
 	"github.com/heketi/heketi/executors"
 	"github.com/lpabon/godbc"
 )
 
+const (
+	// Directory where block hosting volumes are mounted to clone the
+	// block volumes they host
+	blockCloneMountDir = "/var/lib/heketi/clone"
+
+	// Minutes the copy of a block volume may take
+	blockCloneTimeout = 120
+)
+
 func (s *CmdExecutor) BlockVolumeCreate(host string,
 	volume *executors.BlockVolumeRequest) (*executors.BlockVolumeInfo, error) {
 
@@ -42,8 +53,13 @@ func (s *CmdExecutor) BlockVolumeCreate(host string,
 		auth_set = "disable"
 	}
 
-	cmd := fmt.Sprintf("gluster-block create %v/%v  ha %v auth %v prealloc full %v %vGiB --json",
-		volume.GlusterVolumeName, volume.Name, volume.Hacount, auth_set, strings.Join(volume.BlockHosts, ","), volume.Size)
+	size := fmt.Sprintf("%vGiB", volume.Size)
+	if volume.SizeMiB != 0 {
+		size = fmt.Sprintf("%vMiB", volume.SizeMiB)
+	}
+
+	cmd := fmt.Sprintf("gluster-block create %v/%v  ha %v auth %v prealloc full %v %v --json",
+		volume.GlusterVolumeName, volume.Name, volume.Hacount, auth_set, strings.Join(volume.BlockHosts, ","), size)
 
 	// Initialize the commands with the create command
 	commands := []string{cmd}
@@ -63,7 +79,7 @@ func (s *CmdExecutor) BlockVolumeCreate(host string,
 
 	if blockVolumeCreate.Result == "FAIL" {
 		s.BlockVolumeDestroy(host, volume.GlusterVolumeName, volume.Name)
-		logger.LogError("%v", blockVolumeCreate.ErrMsg)
+		s.Logger().LogError("%v", blockVolumeCreate.ErrMsg)
 		return nil, fmt.Errorf("%v", blockVolumeCreate.ErrMsg)
 	}
 
@@ -99,21 +115,345 @@ func (s *CmdExecutor) BlockVolumeDestroy(host string, blockHostingVolumeName str
 	}
 	output, err := s.RemoteExecutor.RemoteCommandExecute(host, commands, 10)
 	if err != nil {
-		logger.LogError("Unable to delete volume %v: %v", blockVolumeName, err)
+		s.Logger().LogError("Unable to delete volume %v: %v", blockVolumeName, err)
 		return err
 	}
 
 	var blockVolumeDelete CliOutput
 	err = json.Unmarshal([]byte(output[0]), &blockVolumeDelete)
 	if err != nil {
-		err := logger.LogError("Unable to get the block volume delete info for block volume %v", blockVolumeName)
+		err := s.Logger().LogError("Unable to get the block volume delete info for block volume %v", blockVolumeName)
 		return err
 	}
 
 	if blockVolumeDelete.Result == "FAIL" {
-		err := logger.LogError("%v", blockVolumeDelete.ErrMsg)
+		err := s.Logger().LogError("%v", blockVolumeDelete.ErrMsg)
+		return err
+	}
+
+	return nil
+}
+
+func (s *CmdExecutor) BlockVolumeExpand(host string, blockHostingVolumeName string,
+	blockVolumeName string, newSize int) error {
+
+	godbc.Require(host != "")
+	godbc.Require(blockHostingVolumeName != "")
+	godbc.Require(blockVolumeName != "")
+	godbc.Require(newSize > 0)
+
+	commands := []string{
+		fmt.Sprintf("gluster-block modify %v/%v size %vGiB --json",
+			blockHostingVolumeName, blockVolumeName, newSize),
+	}
+
+	type CliOutput struct {
+		Result  string `json:"RESULT"`
+		ErrCode int    `json:"errCode"`
+		ErrMsg  string `json:"errMsg"`
+	}
+	output, err := s.RemoteExecutor.RemoteCommandExecute(host, commands, 10)
+	if err != nil {
+		s.Logger().LogError("Unable to expand block volume %v: %v", blockVolumeName, err)
+		return err
+	}
+
+	var blockVolumeExpand CliOutput
+	err = json.Unmarshal([]byte(output[0]), &blockVolumeExpand)
+	if err != nil {
+		return s.Logger().LogError("Unable to get the block volume expand info for block volume %v", blockVolumeName)
+	}
+
+	if blockVolumeExpand.Result == "FAIL" {
+		return s.Logger().LogError("%v", blockVolumeExpand.ErrMsg)
+	}
+
+	return nil
+}
+
+// BlockVolumeAuthRotate gives the block volume new CHAP credentials.
+// gluster-block generates the credentials when auth is enabled, so auth
+// is disabled and enabled again.
+func (s *CmdExecutor) BlockVolumeAuthRotate(host string, blockHostingVolumeName string,
+	blockVolumeName string) (*executors.BlockVolumeInfo, error) {
+
+	godbc.Require(host != "")
+	godbc.Require(blockHostingVolumeName != "")
+	godbc.Require(blockVolumeName != "")
+
+	commands := []string{
+		fmt.Sprintf("gluster-block modify %v/%v auth disable --json",
+			blockHostingVolumeName, blockVolumeName),
+		fmt.Sprintf("gluster-block modify %v/%v auth enable --json",
+			blockHostingVolumeName, blockVolumeName),
+	}
+
+	type CliOutput struct {
+		Iqn      string `json:"IQN"`
+		Username string `json:"USERNAME"`
+		Password string `json:"PASSWORD"`
+		Result   string `json:"RESULT"`
+		ErrCode  int    `json:"errCode"`
+		ErrMsg   string `json:"errMsg"`
+	}
+	output, err := s.RemoteExecutor.RemoteCommandExecute(host, commands, 10)
+	if err != nil {
+		s.Logger().LogError("Unable to rotate credentials of block volume %v: %v",
+			blockVolumeName, err)
+		return nil, err
+	}
+
+	var blockVolumeAuth CliOutput
+	for _, out := range output {
+		blockVolumeAuth = CliOutput{}
+		err = json.Unmarshal([]byte(out), &blockVolumeAuth)
+		if err != nil {
+			return nil, s.Logger().LogError("Unable to get the block volume auth info for block volume %v", blockVolumeName)
+		}
+		if blockVolumeAuth.Result == "FAIL" {
+			return nil, s.Logger().LogError("%v", blockVolumeAuth.ErrMsg)
+		}
+	}
+
+	var blockVolumeInfo executors.BlockVolumeInfo
+	blockVolumeInfo.Name = blockVolumeName
+	blockVolumeInfo.GlusterVolumeName = blockHostingVolumeName
+	blockVolumeInfo.Iqn = blockVolumeAuth.Iqn
+	blockVolumeInfo.Username = blockVolumeAuth.Username
+	blockVolumeInfo.Password = blockVolumeAuth.Password
+
+	return &blockVolumeInfo, nil
+}
+
+// BlockVolumeModifyHa exports the block volume on the given portals,
+// adding the portals missing from it and removing the others
+func (s *CmdExecutor) BlockVolumeModifyHa(host string, blockHostingVolumeName string,
+	blockVolumeName string, hacount int, blockHosts []string) error {
+
+	godbc.Require(host != "")
+	godbc.Require(blockHostingVolumeName != "")
+	godbc.Require(blockVolumeName != "")
+	godbc.Require(hacount > 0)
+	godbc.Require(len(blockHosts) == hacount)
+
+	commands := []string{
+		fmt.Sprintf("gluster-block modify %v/%v ha %v %v --json",
+			blockHostingVolumeName, blockVolumeName, hacount,
+			strings.Join(blockHosts, ",")),
+	}
+
+	type CliOutput struct {
+		Result  string `json:"RESULT"`
+		ErrCode int    `json:"errCode"`
+		ErrMsg  string `json:"errMsg"`
+	}
+	output, err := s.RemoteExecutor.RemoteCommandExecute(host, commands, 10)
+	if err != nil {
+		s.Logger().LogError("Unable to change hacount of block volume %v: %v",
+			blockVolumeName, err)
 		return err
 	}
 
+	var blockVolumeModify CliOutput
+	err = json.Unmarshal([]byte(output[0]), &blockVolumeModify)
+	if err != nil {
+		return s.Logger().LogError("Unable to get the block volume modify info for block volume %v", blockVolumeName)
+	}
+
+	if blockVolumeModify.Result == "FAIL" {
+		return s.Logger().LogError("%v", blockVolumeModify.ErrMsg)
+	}
+
 	return nil
 }
+
+func (s *CmdExecutor) BlockVolumeList(host string, blockHostingVolumeName string) ([]string, error) {
+	godbc.Require(host != "")
+	godbc.Require(blockHostingVolumeName != "")
+
+	commands := []string{
+		fmt.Sprintf("gluster-block list %v --json", blockHostingVolumeName),
+	}
+
+	type CliOutput struct {
+		Blocks  []string `json:"blocks"`
+		Result  string   `json:"RESULT"`
+		ErrCode int      `json:"errCode"`
+		ErrMsg  string   `json:"errMsg"`
+	}
+	output, err := s.RemoteExecutor.RemoteCommandExecute(host, commands, 10)
+	if err != nil {
+		s.Logger().LogError("Unable to list block volumes of %v: %v", blockHostingVolumeName, err)
+		return nil, err
+	}
+
+	var blockVolumeList CliOutput
+	err = json.Unmarshal([]byte(output[0]), &blockVolumeList)
+	if err != nil {
+		return nil, s.Logger().LogError("Unable to get the block volume list of volume %v", blockHostingVolumeName)
+	}
+
+	if blockVolumeList.Result == "FAIL" {
+		return nil, s.Logger().LogError("%v", blockVolumeList.ErrMsg)
+	}
+
+	if blockVolumeList.Blocks == nil {
+		return []string{}, nil
+	}
+	return blockVolumeList.Blocks, nil
+}
+
+func (s *CmdExecutor) BlockVolumeInfo(host string, blockHostingVolumeName string,
+	blockVolumeName string) (*executors.BlockVolumeInfo, error) {
+
+	godbc.Require(host != "")
+	godbc.Require(blockHostingVolumeName != "")
+	godbc.Require(blockVolumeName != "")
+
+	commands := []string{
+		fmt.Sprintf("gluster-block info %v/%v --json", blockHostingVolumeName, blockVolumeName),
+	}
+
+	type CliOutput struct {
+		Name          string   `json:"NAME"`
+		Volume        string   `json:"VOLUME"`
+		Gbid          string   `json:"GBID"`
+		Size          string   `json:"SIZE"`
+		Hacount       int      `json:"HA"`
+		Password      string   `json:"PASSWORD"`
+		ExportedOn    []string `json:"EXPORTED ON"`
+		ExportedNodes []string `json:"EXPORTED NODE(S)"`
+		Result        string   `json:"RESULT"`
+		ErrCode       int      `json:"errCode"`
+		ErrMsg        string   `json:"errMsg"`
+	}
+	output, err := s.RemoteExecutor.RemoteCommandExecute(host, commands, 10)
+	if err != nil {
+		s.Logger().LogError("Unable to get info of block volume %v: %v", blockVolumeName, err)
+		return nil, err
+	}
+
+	var blockVolumeInfo CliOutput
+	err = json.Unmarshal([]byte(output[0]), &blockVolumeInfo)
+	if err != nil {
+		return nil, s.Logger().LogError("Unable to get the block volume info for block volume %v", blockVolumeName)
+	}
+
+	if blockVolumeInfo.Result == "FAIL" {
+		return nil, s.Logger().LogError("%v", blockVolumeInfo.ErrMsg)
+	}
+
+	size, err := parseBlockVolumeSize(blockVolumeInfo.Size)
+	if err != nil {
+		return nil, s.Logger().LogError("Unable to parse size of block volume %v: %v",
+			blockVolumeName, err)
+	}
+
+	info := &executors.BlockVolumeInfo{
+		Name:              blockVolumeName,
+		Size:              size,
+		GlusterVolumeName: blockHostingVolumeName,
+		GlusterNode:       host,
+		Hacount:           blockVolumeInfo.Hacount,
+		BlockHosts:        blockVolumeInfo.ExportedOn,
+		Iqn:               "iqn.2016-12.org.gluster-block:" + blockVolumeInfo.Gbid,
+		Password:          blockVolumeInfo.Password,
+		Gbid:              blockVolumeInfo.Gbid,
+	}
+	if len(info.BlockHosts) == 0 {
+		info.BlockHosts = blockVolumeInfo.ExportedNodes
+	}
+	return info, nil
+}
+
+// BlockVolumeClone creates the clone as a new block volume on the block
+// hosting volume of the source and copies the file backing the source
+// into the file backing the clone, on a mount of the block hosting
+// volume. Zeroed blocks are skipped. The source should not be written
+// to while it is copied for the clone to be consistent.
+func (s *CmdExecutor) BlockVolumeClone(host string,
+	clone *executors.BlockVolumeCloneRequest) (*executors.BlockVolumeInfo, error) {
+
+	godbc.Require(clone != nil)
+	godbc.Require(host != "")
+	godbc.Require(clone.Source != "")
+	godbc.Require(clone.Name != "")
+
+	hvname := clone.GlusterVolumeName
+	source, err := s.BlockVolumeInfo(host, hvname, clone.Source)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := s.BlockVolumeCreate(host, &clone.BlockVolumeRequest)
+	if err != nil {
+		return nil, err
+	}
+	target, err := s.BlockVolumeInfo(host, hvname, clone.Name)
+	if err != nil {
+		s.BlockVolumeDestroy(host, hvname, clone.Name)
+		return nil, err
+	}
+
+	mountPath := fmt.Sprintf("%v/%v", blockCloneMountDir, clone.Name)
+	commands := []string{
+		fmt.Sprintf("mkdir -p %v", mountPath),
+		fmt.Sprintf("mount -t glusterfs localhost:/%v %v", hvname, mountPath),
+		fmt.Sprintf("dd if=%v/block-store/%v of=%v/block-store/%v bs=1M conv=notrunc,sparse",
+			mountPath, source.Gbid, mountPath, target.Gbid),
+	}
+	_, err = s.RemoteExecutor.RemoteCommandExecute(host, commands, blockCloneTimeout)
+
+	// Always clean up the mount
+	cleanup := []string{
+		fmt.Sprintf("umount %v", mountPath),
+		fmt.Sprintf("rmdir %v", mountPath),
+	}
+	for _, command := range cleanup {
+		_, cerr := s.RemoteExecutor.RemoteCommandExecute(host, []string{command}, 5)
+		if cerr != nil {
+			s.Logger().Err(cerr)
+		}
+	}
+
+	if err != nil {
+		s.BlockVolumeDestroy(host, hvname, clone.Name)
+		return nil, s.Logger().Err(fmt.Errorf("Unable to copy block volume %v to %v: %v",
+			clone.Source, clone.Name, err))
+	}
+
+	info.Gbid = target.Gbid
+	return info, nil
+}
+
+// parseBlockVolumeSize converts the size reported by gluster-block,
+// such as "1.0 GiB" or a plain number of bytes, to GiB rounded up.
+func parseBlockVolumeSize(size string) (int, error) {
+	units := map[string]float64{
+		"":    1,
+		"B":   1,
+		"KiB": 1 << 10,
+		"MiB": 1 << 20,
+		"GiB": 1 << 30,
+		"TiB": 1 << 40,
+	}
+
+	fields := strings.Fields(size)
+	if len(fields) == 0 || len(fields) > 2 {
+		return 0, fmt.Errorf("invalid size: %v", size)
+	}
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, err
+	}
+	unit := ""
+	if len(fields) == 2 {
+		unit = fields[1]
+	}
+	multiplier, ok := units[unit]
+	if !ok {
+		return 0, fmt.Errorf("unknown size unit: %v", unit)
+	}
+
+	return int(math.Ceil(value * multiplier / (1 << 30))), nil
+}
@@ -0,0 +1,331 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package cmdexec
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/heketi/heketi/executors"
+	"github.com/heketi/tests"
+)
+
+func TestSshExecBlockVolumeList(t *testing.T) {
+	f := NewCommandFaker()
+	s, err := NewFakeExecutor(f)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, s != nil)
+
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+
+		tests.Assert(t, host == "host:22", host)
+		tests.Assert(t, len(commands) == 1)
+		tests.Assert(t, commands[0] == "gluster-block list hv --json", commands)
+
+		return []string{`{ "blocks":[ "blk1", "blk2" ], "RESULT":"SUCCESS" }`}, nil
+	}
+
+	blocks, err := s.BlockVolumeList("host", "hv")
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, len(blocks) == 2, blocks)
+	tests.Assert(t, blocks[0] == "blk1")
+	tests.Assert(t, blocks[1] == "blk2")
+
+	// No block volumes
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+		return []string{`{ "RESULT":"SUCCESS" }`}, nil
+	}
+	blocks, err = s.BlockVolumeList("host", "hv")
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, len(blocks) == 0, blocks)
+
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+		return []string{`{ "RESULT":"FAIL", "errCode":2, "errMsg":"volume hv does not exist" }`}, nil
+	}
+	blocks, err = s.BlockVolumeList("host", "hv")
+	tests.Assert(t, err != nil)
+	tests.Assert(t, blocks == nil)
+}
+
+func TestSshExecBlockVolumeInfo(t *testing.T) {
+	f := NewCommandFaker()
+	s, err := NewFakeExecutor(f)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, s != nil)
+
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+
+		tests.Assert(t, host == "host:22", host)
+		tests.Assert(t, len(commands) == 1)
+		tests.Assert(t, commands[0] == "gluster-block info hv/blk1 --json", commands)
+
+		return []string{`{ "NAME":"blk1", "VOLUME":"hv", ` +
+			`"GBID":"9e1f9c72-2d0b-4f6b-9a5a-5b1f1b8e1d2c", "SIZE":"2.5 GiB", ` +
+			`"HA":2, "PASSWORD":"", "EXPORTED ON":[ "10.0.0.1", "10.0.0.2" ] }`}, nil
+	}
+
+	info, err := s.BlockVolumeInfo("host", "hv", "blk1")
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, info.Name == "blk1")
+	tests.Assert(t, info.GlusterVolumeName == "hv")
+	tests.Assert(t, info.Size == 3, info.Size)
+	tests.Assert(t, info.Hacount == 2)
+	tests.Assert(t, len(info.BlockHosts) == 2)
+	tests.Assert(t, info.Iqn ==
+		"iqn.2016-12.org.gluster-block:9e1f9c72-2d0b-4f6b-9a5a-5b1f1b8e1d2c", info.Iqn)
+}
+
+func TestParseBlockVolumeSize(t *testing.T) {
+	for size, expected := range map[string]int{
+		"1.0 GiB":    1,
+		"1 TiB":      1024,
+		"512.0 MiB":  1,
+		"1073741824": 1,
+		"1073741825": 2,
+	} {
+		gb, err := parseBlockVolumeSize(size)
+		tests.Assert(t, err == nil, size, err)
+		tests.Assert(t, gb == expected, size, gb)
+	}
+
+	for _, size := range []string{"", "abc", "1 PB", "1 GiB x"} {
+		_, err := parseBlockVolumeSize(size)
+		tests.Assert(t, err != nil, size)
+	}
+}
+
+func TestSshExecBlockVolumeCreateSize(t *testing.T) {
+	f := NewCommandFaker()
+	s, err := NewFakeExecutor(f)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, s != nil)
+
+	var cmd string
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+
+		tests.Assert(t, len(commands) == 1)
+		cmd = commands[0]
+		return []string{`{ "IQN":"iqn.2016-12.org.gluster-block:blk1", "RESULT":"SUCCESS" }`}, nil
+	}
+
+	req := &executors.BlockVolumeRequest{
+		Name:              "blk1",
+		Size:              2,
+		GlusterVolumeName: "hv",
+		Hacount:           1,
+		BlockHosts:        []string{"host1"},
+	}
+	_, err = s.BlockVolumeCreate("host", req)
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, cmd == "gluster-block create hv/blk1  ha 1 auth disable "+
+		"prealloc full host1 2GiB --json", cmd)
+
+	// Sizes in MiB are passed as is
+	req.Size = 1
+	req.SizeMiB = 512
+	_, err = s.BlockVolumeCreate("host", req)
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, cmd == "gluster-block create hv/blk1  ha 1 auth disable "+
+		"prealloc full host1 512MiB --json", cmd)
+}
+
+func TestSshExecBlockVolumeExpand(t *testing.T) {
+	f := NewCommandFaker()
+	s, err := NewFakeExecutor(f)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, s != nil)
+
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+
+		tests.Assert(t, host == "host:22", host)
+		tests.Assert(t, len(commands) == 1)
+		tests.Assert(t,
+			commands[0] == "gluster-block modify hv/blk1 size 5GiB --json",
+			commands)
+
+		return []string{`{ "IQN":"iqn", "SIZE":"5.0 GiB", "RESULT":"SUCCESS" }`}, nil
+	}
+	err = s.BlockVolumeExpand("host", "hv", "blk1", 5)
+	tests.Assert(t, err == nil, err)
+
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+		return []string{`{ "RESULT":"FAIL", "errCode":255, "errMsg":"size is less than current" }`}, nil
+	}
+	err = s.BlockVolumeExpand("host", "hv", "blk1", 5)
+	tests.Assert(t, err != nil)
+	tests.Assert(t, err.Error() == "size is less than current", err)
+}
+
+func TestSshExecBlockVolumeAuthRotate(t *testing.T) {
+	f := NewCommandFaker()
+	s, err := NewFakeExecutor(f)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, s != nil)
+
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+
+		tests.Assert(t, host == "host:22", host)
+		tests.Assert(t, len(commands) == 2)
+		tests.Assert(t,
+			commands[0] == "gluster-block modify hv/blk1 auth disable --json",
+			commands)
+		tests.Assert(t,
+			commands[1] == "gluster-block modify hv/blk1 auth enable --json",
+			commands)
+
+		return []string{
+			`{ "IQN":"iqn", "RESULT":"SUCCESS" }`,
+			`{ "IQN":"iqn", "USERNAME":"user", "PASSWORD":"pass", "RESULT":"SUCCESS" }`,
+		}, nil
+	}
+	info, err := s.BlockVolumeAuthRotate("host", "hv", "blk1")
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, info.Iqn == "iqn", info.Iqn)
+	tests.Assert(t, info.Username == "user", info.Username)
+	tests.Assert(t, info.Password == "pass", info.Password)
+
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+		return []string{
+			`{ "IQN":"iqn", "RESULT":"SUCCESS" }`,
+			`{ "RESULT":"FAIL", "errCode":255, "errMsg":"auth failed" }`,
+		}, nil
+	}
+	_, err = s.BlockVolumeAuthRotate("host", "hv", "blk1")
+	tests.Assert(t, err != nil)
+	tests.Assert(t, err.Error() == "auth failed", err)
+}
+
+func TestSshExecBlockVolumeModifyHa(t *testing.T) {
+	f := NewCommandFaker()
+	s, err := NewFakeExecutor(f)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, s != nil)
+
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+
+		tests.Assert(t, host == "host:22", host)
+		tests.Assert(t, len(commands) == 1)
+		tests.Assert(t,
+			commands[0] == "gluster-block modify hv/blk1 ha 2 10.0.0.1,10.0.0.2 --json",
+			commands)
+
+		return []string{`{ "RESULT":"SUCCESS" }`}, nil
+	}
+	err = s.BlockVolumeModifyHa("host", "hv", "blk1", 2,
+		[]string{"10.0.0.1", "10.0.0.2"})
+	tests.Assert(t, err == nil, err)
+
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+		return []string{
+			`{ "RESULT":"FAIL", "errCode":255, "errMsg":"portal 10.0.0.2 is down" }`,
+		}, nil
+	}
+	err = s.BlockVolumeModifyHa("host", "hv", "blk1", 2,
+		[]string{"10.0.0.1", "10.0.0.2"})
+	tests.Assert(t, err != nil)
+	tests.Assert(t, err.Error() == "portal 10.0.0.2 is down", err)
+}
+
+func TestSshExecBlockVolumeClone(t *testing.T) {
+	f := NewCommandFaker()
+	s, err := NewFakeExecutor(f)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, s != nil)
+
+	var cmds []string
+	failCopy := false
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+
+		tests.Assert(t, len(commands) >= 1)
+		cmds = append(cmds, commands...)
+		switch {
+		case commands[0] == "gluster-block info hv/blk1 --json":
+			return []string{`{ "NAME":"blk1", "VOLUME":"hv", "GBID":"gbid1", ` +
+				`"SIZE":"2.0 GiB", "HA":1, "EXPORTED ON":[ "host1" ] }`}, nil
+		case commands[0] == "gluster-block info hv/blk2 --json":
+			return []string{`{ "NAME":"blk2", "VOLUME":"hv", "GBID":"gbid2", ` +
+				`"SIZE":"2.0 GiB", "HA":1, "EXPORTED ON":[ "host1" ] }`}, nil
+		case strings.HasPrefix(commands[0], "gluster-block create"),
+			strings.HasPrefix(commands[0], "gluster-block delete"):
+			return []string{`{ "IQN":"iqn.2016-12.org.gluster-block:gbid2", "RESULT":"SUCCESS" }`}, nil
+		case strings.HasPrefix(commands[0], "mkdir") && failCopy:
+			return nil, fmt.Errorf("dd failed")
+		}
+		return make([]string, len(commands)), nil
+	}
+
+	req := &executors.BlockVolumeCloneRequest{
+		BlockVolumeRequest: executors.BlockVolumeRequest{
+			Name:              "blk2",
+			Size:              2,
+			GlusterVolumeName: "hv",
+			Hacount:           1,
+			BlockHosts:        []string{"host1"},
+		},
+		Source: "blk1",
+	}
+	info, err := s.BlockVolumeClone("host", req)
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, info.Name == "blk2", info.Name)
+	tests.Assert(t, info.Gbid == "gbid2", info.Gbid)
+
+	mount := "/var/lib/heketi/clone/blk2"
+	tests.Assert(t, len(cmds) == 8, cmds)
+	tests.Assert(t, cmds[4] == "mount -t glusterfs localhost:/hv "+mount, cmds[4])
+	tests.Assert(t, cmds[5] == "dd if="+mount+"/block-store/gbid1 of="+
+		mount+"/block-store/gbid2 bs=1M conv=notrunc,sparse", cmds[5])
+	tests.Assert(t, cmds[6] == "umount "+mount, cmds[6])
+	tests.Assert(t, cmds[7] == "rmdir "+mount, cmds[7])
+
+	// The clone is removed when the copy fails
+	cmds = nil
+	failCopy = true
+	_, err = s.BlockVolumeClone("host", req)
+	tests.Assert(t, err != nil)
+	tests.Assert(t, cmds[len(cmds)-1] == "gluster-block delete hv/blk2 --json",
+		cmds)
+}
@@ -63,7 +63,8 @@ func (s *CmdExecutor) BrickCreate(host string,
 			utils.BrickIdToName(brick.Name)),
 
 		// Format
-		fmt.Sprintf("mkfs.xfs -i size=512 -n size=8192 %v", devnode),
+		s.wrapCommand(CommandClassFormat,
+			fmt.Sprintf("mkfs.xfs -i size=512 -n size=8192 %v", devnode)),
 
 		// Fstab
 		fmt.Sprintf("awk \"BEGIN {print \\\"%v %v xfs rw,inode64,noatime,nouuid 1 2\\\" >> \\\"%v\\\"}\"",
@@ -78,20 +79,48 @@ func (s *CmdExecutor) BrickCreate(host string,
 		fmt.Sprintf("mkdir %v", brickPath),
 	}
 
-	// Only set the GID if the value is other than root(gid 0).
+	// Only set the UID and GID if the values are other than root(0).
 	// When no gid is set, root is the only one that can write to the volume
+	owner := ""
+	if 0 != brick.Uid {
+		owner = fmt.Sprintf("%v", brick.Uid)
+	}
 	if 0 != brick.Gid {
-		commands = append(commands, []string{
-			// Set GID on brick
-			fmt.Sprintf("chown :%v %v", brick.Gid, brickPath),
+		owner += fmt.Sprintf(":%v", brick.Gid)
+	}
+	if owner != "" {
+		// Set UID and GID on brick
+		commands = append(commands, fmt.Sprintf("chown %v %v", owner, brickPath))
+	}
 
-			// Set writable by GID and UID
-			fmt.Sprintf("chmod 2775 %v", brickPath),
-		}...)
+	// Set writable by GID and UID unless other permissions were requested
+	mode := brick.Permissions
+	if mode == "" && 0 != brick.Gid {
+		mode = "2775"
+	}
+	if mode != "" {
+		commands = append(commands, fmt.Sprintf("chmod %v %v", mode, brickPath))
+	}
+
+	// The SELinux labels of checked bricks are only set on the hosts
+	// with SELinux enabled
+	selinux := true
+	if brick.SelinuxCheck || len(brick.SelinuxBooleans) > 0 {
+		selinux = s.selinuxEnabled(host)
+	}
+	if brick.SelinuxContext != "" && selinux {
+		commands = append(commands,
+			fmt.Sprintf("chcon %v %v", brick.SelinuxContext, brickPath))
 	}
 
 	// Execute commands
 	_, err := s.RemoteExecutor.RemoteCommandExecute(host, commands, 10)
+	if err == nil && selinux && brick.SelinuxCheck && brick.SelinuxContext != "" {
+		err = s.selinuxCheckContext(host, brickPath, brick.SelinuxContext)
+	}
+	if err == nil && selinux && len(brick.SelinuxBooleans) > 0 {
+		err = s.selinuxSetBooleans(host, brick.SelinuxBooleans)
+	}
 	if err != nil {
 		// Cleanup
 		s.BrickDestroy(host, brick)
@@ -113,6 +142,16 @@ func (s *CmdExecutor) BrickDestroy(host string,
 	godbc.Require(brick.Name != "")
 	godbc.Require(brick.VgId != "")
 
+	if brick.Path != "" && brick.Path != utils.BrickPath(brick.VgId, brick.Name) {
+		s.clonedBrickDestroy(host, brick)
+		if brick.TpSize == 0 {
+			// the brick of a clone has no LV created by heketi
+			return nil
+		}
+		// the brick of a restored snapshot replaced the LV created
+		// by heketi, which is still mounted
+	}
+
 	mp := utils.BrickMountPoint(brick.VgId, brick.Name)
 	// Try to unmount first
 	commands := []string{
@@ -120,7 +159,7 @@ func (s *CmdExecutor) BrickDestroy(host string,
 	}
 	_, err := s.RemoteExecutor.RemoteCommandExecute(host, commands, 5)
 	if err != nil {
-		logger.Err(err)
+		s.Logger().Err(err)
 	}
 
 	// Now try to remove the LV
@@ -129,7 +168,7 @@ func (s *CmdExecutor) BrickDestroy(host string,
 	}
 	_, err = s.RemoteExecutor.RemoteCommandExecute(host, commands, 5)
 	if err != nil {
-		logger.Err(err)
+		s.Logger().Err(err)
 	}
 
 	// Now cleanup the mount point
@@ -138,7 +177,7 @@ func (s *CmdExecutor) BrickDestroy(host string,
 	}
 	_, err = s.RemoteExecutor.RemoteCommandExecute(host, commands, 5)
 	if err != nil {
-		logger.Err(err)
+		s.Logger().Err(err)
 	}
 
 	// Remove from fstab
@@ -149,7 +188,54 @@ func (s *CmdExecutor) BrickDestroy(host string,
 	}
 	_, err = s.RemoteExecutor.RemoteCommandExecute(host, commands, 5)
 	if err != nil {
-		logger.Err(err)
+		s.Logger().Err(err)
+	}
+
+	return nil
+}
+
+// clonedBrickDestroy removes a brick that gluster created when cloning
+// or restoring a snapshot. The thin LV of the brick was named by gluster
+// and lives in the thin pool of a brick of the origin volume, so only the
+// LV itself is removed.
+func (s *CmdExecutor) clonedBrickDestroy(host string,
+	brick *executors.BrickRequest) error {
+
+	mp := utils.BrickMountFromPath(brick.Path)
+
+	// Find the LV before it is unmounted
+	commands := []string{
+		fmt.Sprintf("findmnt -n -o SOURCE %v", mp),
+	}
+	output, err := s.RemoteExecutor.RemoteCommandExecute(host, commands, 5)
+	if err != nil {
+		s.Logger().Err(err)
+	}
+
+	commands = []string{
+		fmt.Sprintf("umount %v", mp),
+	}
+	_, err = s.RemoteExecutor.RemoteCommandExecute(host, commands, 5)
+	if err != nil {
+		s.Logger().Err(err)
+	}
+
+	if len(output) > 0 && strings.TrimSpace(output[0]) != "" {
+		commands = []string{
+			fmt.Sprintf("lvremove -f %v", strings.TrimSpace(output[0])),
+		}
+		_, err = s.RemoteExecutor.RemoteCommandExecute(host, commands, 5)
+		if err != nil {
+			s.Logger().Err(err)
+		}
+	}
+
+	commands = []string{
+		fmt.Sprintf("rmdir %v", mp),
+	}
+	_, err = s.RemoteExecutor.RemoteCommandExecute(host, commands, 5)
+	if err != nil {
+		s.Logger().Err(err)
 	}
 
 	return nil
@@ -190,11 +276,17 @@ func (s *CmdExecutor) checkThinPoolUsage(host string,
 	// Send command
 	output, err := s.RemoteExecutor.RemoteCommandExecute(host, commands, 5)
 	if err != nil {
-		logger.Err(err)
+		s.Logger().Err(err)
 		return fmt.Errorf("Unable to determine number of logical volumes in "+
 			"thin pool %v on host %v", tp, host)
 	}
 
+	// A thin pool already removed, by a delete interrupted by a
+	// restart of heketi, is not used by anything
+	if !strings.Contains(output[0], tp+":") {
+		return nil
+	}
+
 	// Determine if do not have only one LV in the thin pool,
 	// we cannot delete the brick
 	lvs := strings.Index(output[0], tp+":1")
@@ -173,6 +173,135 @@ func TestSshExecBrickCreateWithGid(t *testing.T) {
 
 }
 
+func TestSshExecBrickCreateWithOwnerAndContext(t *testing.T) {
+	f := NewCommandFaker()
+	s, err := NewFakeExecutor(f)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, s != nil)
+	s.portStr = "100"
+
+	// Create a Brick
+	b := &executors.BrickRequest{
+		VgId:             "xvgid",
+		Name:             "id",
+		TpSize:           100,
+		Size:             10,
+		PoolMetadataSize: 5,
+		Uid:              1000,
+		Gid:              1234,
+		Permissions:      "0770",
+		SelinuxContext:   "system_u:object_r:container_file_t:s0",
+		Path:             utils.BrickPath("xvgid", "id"),
+	}
+
+	// Mock ssh function
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+
+		tests.Assert(t, host == "myhost:100", host)
+		tests.Assert(t, len(commands) == 9)
+
+		for i, cmd := range commands {
+			cmd = strings.Trim(cmd, " ")
+			switch i {
+			case 6:
+				tests.Assert(t,
+					cmd == "chown 1000:1234 "+
+						"/var/lib/heketi/mounts/vg_xvgid/brick_id/brick", cmd)
+
+			case 7:
+				tests.Assert(t,
+					cmd == "chmod 0770 "+
+						"/var/lib/heketi/mounts/vg_xvgid/brick_id/brick", cmd)
+
+			case 8:
+				tests.Assert(t,
+					cmd == "chcon system_u:object_r:container_file_t:s0 "+
+						"/var/lib/heketi/mounts/vg_xvgid/brick_id/brick", cmd)
+			}
+		}
+
+		return nil, nil
+	}
+
+	// Create Brick
+	_, err = s.BrickCreate("myhost", b)
+	tests.Assert(t, err == nil, err)
+}
+
+func TestSshExecBrickCreateSelinuxCheck(t *testing.T) {
+	f := NewCommandFaker()
+	s, err := NewFakeExecutor(f)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, s != nil)
+	s.portStr = "100"
+
+	b := &executors.BrickRequest{
+		VgId:             "xvgid",
+		Name:             "id",
+		TpSize:           100,
+		Size:             10,
+		PoolMetadataSize: 5,
+		SelinuxContext:   "system_u:object_r:glusterd_brick_t:s0",
+		SelinuxCheck:     true,
+		SelinuxBooleans:  []string{"virt_use_fusefs", "virt_sandbox_use_fusefs"},
+		Path:             utils.BrickPath("xvgid", "id"),
+	}
+	brickPath := "/var/lib/heketi/mounts/vg_xvgid/brick_id/brick"
+
+	mode := "Enforcing"
+	label := b.SelinuxContext
+	var executed []string
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+
+		executed = append(executed, commands...)
+		switch commands[0] {
+		case "getenforce":
+			return []string{mode + "\n"}, nil
+		case "stat -c %C " + brickPath:
+			return []string{label + "\n"}, nil
+		case "getsebool virt_use_fusefs":
+			return []string{"virt_use_fusefs --> off\n"}, nil
+		case "getsebool virt_sandbox_use_fusefs":
+			return []string{"virt_sandbox_use_fusefs --> on\n"}, nil
+		}
+		return make([]string, len(commands)), nil
+	}
+
+	// The context is set and checked, and the booleans turned on
+	_, err = s.BrickCreate("myhost", b)
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, executed[0] == "getenforce", executed)
+	all := strings.Join(executed, "\n")
+	tests.Assert(t, strings.Contains(all,
+		"chcon system_u:object_r:glusterd_brick_t:s0 "+brickPath), executed)
+	tests.Assert(t, strings.Contains(all, "setsebool -P virt_use_fusefs on"), executed)
+	tests.Assert(t, !strings.Contains(all, "setsebool -P virt_sandbox_use_fusefs"), executed)
+
+	// A brick whose context was not set is destroyed
+	executed = nil
+	label = "system_u:object_r:unlabeled_t:s0"
+	_, err = s.BrickCreate("myhost", b)
+	tests.Assert(t, err != nil)
+	tests.Assert(t, strings.Contains(err.Error(), "unlabeled_t"), err)
+	tests.Assert(t, strings.Contains(strings.Join(executed, "\n"), "lvremove"), executed)
+
+	// Nothing is labeled on hosts without SELinux
+	executed = nil
+	mode = "Disabled"
+	_, err = s.BrickCreate("myhost", b)
+	tests.Assert(t, err == nil, err)
+	all = strings.Join(executed, "\n")
+	tests.Assert(t, !strings.Contains(all, "chcon"), executed)
+	tests.Assert(t, !strings.Contains(all, "stat -c"), executed)
+	tests.Assert(t, !strings.Contains(all, "sebool"), executed)
+}
+
 func TestSshExecBrickCreateSudo(t *testing.T) {
 	f := NewCommandFaker()
 	s, err := NewFakeExecutor(f)
@@ -303,3 +432,89 @@ func TestSshExecBrickDestroy(t *testing.T) {
 	err = s.BrickDestroy("myhost", b)
 	tests.Assert(t, err == nil, err)
 }
+
+func TestSshExecClonedBrickDestroy(t *testing.T) {
+	f := NewCommandFaker()
+	s, err := NewFakeExecutor(f)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, s != nil)
+	s.portStr = "100"
+
+	// A brick of a volume cloned from a snapshot
+	b := &executors.BrickRequest{
+		VgId: "xvgid",
+		Name: "id",
+		Size: 10,
+		Path: "/run/gluster/snaps/d2ae2b32/brick1/brick",
+	}
+
+	executed := []string{}
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+
+		tests.Assert(t, host == "myhost:100", host)
+		tests.Assert(t, len(commands) == 1, commands)
+		executed = append(executed, commands[0])
+		if strings.HasPrefix(commands[0], "findmnt") {
+			return []string{"/dev/mapper/vg_xvgid-d2ae2b32_0\n"}, nil
+		}
+		return []string{""}, nil
+	}
+
+	err = s.BrickDestroy("myhost", b)
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, len(executed) == 4, executed)
+	tests.Assert(t, executed[0] ==
+		"findmnt -n -o SOURCE /run/gluster/snaps/d2ae2b32/brick1", executed)
+	tests.Assert(t, executed[1] ==
+		"umount /run/gluster/snaps/d2ae2b32/brick1", executed)
+	tests.Assert(t, executed[2] ==
+		"lvremove -f /dev/mapper/vg_xvgid-d2ae2b32_0", executed)
+	tests.Assert(t, executed[3] ==
+		"rmdir /run/gluster/snaps/d2ae2b32/brick1", executed)
+}
+
+func TestSshExecRestoredBrickDestroy(t *testing.T) {
+	f := NewCommandFaker()
+	s, err := NewFakeExecutor(f)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, s != nil)
+	s.portStr = "100"
+
+	// A brick replaced by the brick of a restored snapshot
+	b := &executors.BrickRequest{
+		VgId:   "xvgid",
+		Name:   "id",
+		Size:   10,
+		TpSize: 10,
+		Path:   "/run/gluster/snaps/d2ae2b32/brick1/brick",
+	}
+
+	executed := []string{}
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+
+		tests.Assert(t, len(commands) == 1, commands)
+		executed = append(executed, commands[0])
+		if strings.HasPrefix(commands[0], "findmnt") {
+			return []string{"/dev/mapper/vg_xvgid-d2ae2b32_0\n"}, nil
+		}
+		return []string{""}, nil
+	}
+
+	err = s.BrickDestroy("myhost", b)
+	tests.Assert(t, err == nil, err)
+
+	// The LV of the snapshot and the one created by heketi are removed
+	tests.Assert(t, len(executed) == 8, executed)
+	tests.Assert(t, executed[2] ==
+		"lvremove -f /dev/mapper/vg_xvgid-d2ae2b32_0", executed)
+	tests.Assert(t, executed[4] ==
+		"umount /var/lib/heketi/mounts/vg_xvgid/brick_id", executed)
+	tests.Assert(t, executed[5] ==
+		"lvremove -f vg_xvgid/tp_id", executed)
+}
@@ -0,0 +1,70 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package cmdexec
+
+import (
+	"encoding/xml"
+	"fmt"
+
+	"github.com/heketi/heketi/executors"
+	"github.com/lpabon/godbc"
+)
+
+// ClusterOptions returns the options of the whole trusted storage pool
+// of the host
+func (s *CmdExecutor) ClusterOptions(host string) (*executors.ClusterOptions, error) {
+	godbc.Require(host != "")
+
+	type CliOutput struct {
+		OpRet          int                      `xml:"opRet"`
+		OpErrno        int                      `xml:"opErrno"`
+		OpErrStr       string                   `xml:"opErrstr"`
+		ClusterOptions executors.ClusterOptions `xml:"volGetopts"`
+	}
+
+	commands := []string{
+		"gluster --mode=script volume get all all --xml",
+	}
+	output, err := s.RemoteExecutor.RemoteCommandExecute(host, commands, 10)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to get cluster options from host %v: %v", host, err)
+	}
+
+	var options CliOutput
+	err = xml.Unmarshal([]byte(output[0]), &options)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to determine cluster options from host %v", host)
+	}
+	s.Logger().Debug("%+v\n", options)
+	return &options.ClusterOptions, nil
+}
+
+// ClusterSetOptions sets options of the whole trusted storage pool of
+// the host, each a name and a value, in order
+func (s *CmdExecutor) ClusterSetOptions(host string, options []string) error {
+	godbc.Require(host != "")
+
+	commands := []string{}
+	for _, option := range options {
+		if option != "" {
+			commands = append(commands,
+				fmt.Sprintf("gluster --mode=script volume set all %v", option))
+		}
+	}
+	if len(commands) == 0 {
+		return nil
+	}
+	_, err := s.RemoteExecutor.RemoteCommandExecute(host, commands, 10)
+	if err != nil {
+		return s.Logger().Err(fmt.Errorf("Unable to set cluster options: %v", err))
+	}
+
+	return nil
+}
@@ -0,0 +1,90 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package cmdexec
+
+import (
+	"testing"
+
+	"github.com/heketi/tests"
+)
+
+func TestSshExecClusterOptions(t *testing.T) {
+	f := NewCommandFaker()
+	s, err := NewFakeExecutor(f)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, s != nil)
+
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+
+		tests.Assert(t, host == "host:22", host)
+		tests.Assert(t, len(commands) == 1)
+		tests.Assert(t,
+			commands[0] == "gluster --mode=script volume get all all --xml",
+			commands)
+
+		return []string{`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<cliOutput>
+  <opRet>0</opRet>
+  <opErrno>0</opErrno>
+  <opErrstr/>
+  <volGetopts>
+    <count>2</count>
+    <Opt>
+      <Option>cluster.server-quorum-ratio</Option>
+      <Value>51</Value>
+    </Opt>
+    <Opt>
+      <Option>cluster.op-version</Option>
+      <Value>31306</Value>
+    </Opt>
+  </volGetopts>
+</cliOutput>`}, nil
+	}
+
+	options, err := s.ClusterOptions("host")
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, len(options.Options) == 2, options.Options)
+	tests.Assert(t, options.Options[1].Name == "cluster.op-version",
+		options.Options[1])
+	tests.Assert(t, options.Options[1].Value == "31306", options.Options[1])
+}
+
+func TestSshExecClusterSetOptions(t *testing.T) {
+	f := NewCommandFaker()
+	s, err := NewFakeExecutor(f)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, s != nil)
+
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+
+		tests.Assert(t, host == "host:22", host)
+		tests.Assert(t, len(commands) == 2)
+		tests.Assert(t, commands[0] ==
+			"gluster --mode=script volume set all cluster.op-version 31306",
+			commands)
+		tests.Assert(t, commands[1] ==
+			"gluster --mode=script volume set all cluster.brick-multiplex on",
+			commands)
+
+		return nil, nil
+	}
+
+	err = s.ClusterSetOptions("host", []string{
+		"cluster.op-version 31306",
+		"cluster.brick-multiplex on",
+	})
+	tests.Assert(t, err == nil, err)
+}
@@ -12,6 +12,7 @@ package cmdexec
 import (
 	"sync"
 
+	"github.com/heketi/heketi/executors"
 	"github.com/heketi/heketi/pkg/utils"
 )
 
@@ -27,10 +28,20 @@ type RemoteCommandTransport interface {
 
 type CmdExecutor struct {
 	Throttlemap map[string]chan bool
-	Lock        sync.Mutex
+	Lock        *sync.Mutex
 
 	RemoteExecutor RemoteCommandTransport
 	Fstab          string
+
+	environment        CommandEnvironment
+	clusterEnvironment map[string]CommandEnvironment
+	hostClusters       map[string]string
+	commandWrappers    map[string]CommandWrapper
+	outputSize         int
+	outputHandler      func(o *executors.CommandOutput)
+
+	// Id of the request the commands are run for, if any
+	requestId string
 }
 
 func (s *CmdExecutor) AccessConnection(host string) {
@@ -74,6 +85,24 @@ func (s *CmdExecutor) SetLogLevel(level string) {
 	}
 }
 
+// ForRequest returns a copy of the executor tagging the messages logged
+// for the commands with the id of the request they are run for. The copy
+// shares the connections and the settings of the hosts with s.
+func (s *CmdExecutor) ForRequest(id string) CmdExecutor {
+	s.Lock.Lock()
+	defer s.Lock.Unlock()
+	if s.hostClusters == nil {
+		s.hostClusters = map[string]string{}
+	}
+	c := *s
+	c.requestId = id
+	return c
+}
+
+func (s *CmdExecutor) RequestId() string {
+	return s.requestId
+}
+
 func (s *CmdExecutor) Logger() *utils.Logger {
-	return logger
+	return logger.WithRequestId(s.requestId)
 }
@@ -10,8 +10,12 @@
 package cmdexec
 
 type CmdConfig struct {
-	Fstab                string `json:"fstab"`
-	Sudo                 bool   `json:"sudo"`
-	SnapShotLimit        int    `json:"snapshot_limit"`
-	RebalanceOnExpansion bool   `json:"rebalance_on_expansion"`
+	Fstab                string                        `json:"fstab"`
+	Sudo                 bool                          `json:"sudo"`
+	SnapShotLimit        int                           `json:"snapshot_limit"`
+	RebalanceOnExpansion bool                          `json:"rebalance_on_expansion"`
+	Environment          CommandEnvironment            `json:"environment"`
+	ClusterEnvironment   map[string]CommandEnvironment `json:"cluster_environment"`
+	CommandWrappers      map[string]CommandWrapper     `json:"command_wrappers"`
+	CommandOutputSize    int                           `json:"command_output_size"`
 }
@@ -33,16 +33,49 @@ const (
 
 func (s *CmdExecutor) DeviceSetup(host, device, vgid string) (d *executors.DeviceInfo, e error) {
 
-	// Setup commands
+	vg := utils.VgIdToName(vgid)
 	commands := []string{
 		fmt.Sprintf("pvcreate --metadatasize=128M --dataalignment=256K '%v'", device),
-		fmt.Sprintf("vgcreate %v %v", utils.VgIdToName(vgid), device),
+		fmt.Sprintf("vgcreate %v %v", vg, device),
+	}
+
+	// A device added again may still have the volume group of its
+	// previous setup
+	old, isPv := s.deviceVgName(host, device)
+	switch {
+	case !isPv:
+	case old == vg:
+		s.Logger().Info("Device %v on host %v already has volume group %v",
+			device, host, vg)
+		commands = []string{}
+	case old == "":
+		commands = commands[1:]
+	default:
+		if _, ok := utils.VgNameToId(old); !ok {
+			return nil, fmt.Errorf("Device %v is in volume group %v not created by heketi",
+				device, old)
+		}
+		lvs, err := s.vgLvCount(host, old)
+		if err != nil {
+			return nil, err
+		}
+		if lvs != 0 {
+			return nil, fmt.Errorf("Device %v is in volume group %v of a previous "+
+				"setup with %v logical volumes", device, old, lvs)
+		}
+		s.Logger().Info("Renaming empty volume group %v of device %v on host %v to %v",
+			old, device, host, vg)
+		commands = []string{
+			fmt.Sprintf("vgrename %v %v", old, vg),
+		}
 	}
 
 	// Execute command
-	_, err := s.RemoteExecutor.RemoteCommandExecute(host, commands, 5)
-	if err != nil {
-		return nil, err
+	if len(commands) > 0 {
+		_, err := s.RemoteExecutor.RemoteCommandExecute(host, commands, 5)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	// Create a cleanup function if anything fails
@@ -55,6 +88,35 @@ func (s *CmdExecutor) DeviceSetup(host, device, vgid string) (d *executors.Devic
 	return s.GetDeviceInfo(host, device, vgid)
 }
 
+// deviceVgName returns the name of the volume group of the device, empty
+// if the device is a physical volume of no volume group. It returns
+// false if the device is not a physical volume.
+func (s *CmdExecutor) deviceVgName(host, device string) (string, bool) {
+	commands := []string{
+		fmt.Sprintf("pvs --noheadings -o vg_name '%v'", device),
+	}
+	output, err := s.RemoteExecutor.RemoteCommandExecute(host, commands, 5)
+	if err != nil || len(output) == 0 {
+		return "", false
+	}
+	return strings.TrimSpace(output[0]), true
+}
+
+// vgLvCount returns the number of logical volumes of the volume group
+func (s *CmdExecutor) vgLvCount(host, vg string) (int, error) {
+	commands := []string{
+		fmt.Sprintf("vgs --noheadings -o lv_count %v", vg),
+	}
+	output, err := s.RemoteExecutor.RemoteCommandExecute(host, commands, 5)
+	if err != nil {
+		return 0, err
+	}
+	if len(output) == 0 {
+		return 0, errors.New("vgs returned no output")
+	}
+	return strconv.Atoi(strings.TrimSpace(output[0]))
+}
+
 func (s *CmdExecutor) GetDeviceInfo(host, device, vgid string) (d *executors.DeviceInfo, e error) {
 	// Vg info
 	d = &executors.DeviceInfo{}
@@ -76,7 +138,7 @@ func (s *CmdExecutor) DeviceTeardown(host, device, vgid string) error {
 	// Execute command
 	_, err := s.RemoteExecutor.RemoteCommandExecute(host, commands, 5)
 	if err != nil {
-		logger.LogError("Error while deleting device %v with id %v on host %v: %v",
+		s.Logger().LogError("Error while deleting device %v with id %v on host %v: %v",
 			device, vgid, host, err)
 	}
 
@@ -95,7 +157,7 @@ func (s *CmdExecutor) DeviceTeardown(host, device, vgid string) error {
 
 	_, err = s.RemoteExecutor.RemoteCommandExecute(host, commands, 5)
 	if err != nil {
-		logger.LogError("Error while removing the VG directory")
+		s.Logger().LogError("Error while removing the VG directory")
 		return nil
 	}
 
@@ -138,8 +200,133 @@ func (s *CmdExecutor) getVgSizeFromNode(
 		return err
 	}
 
+	total_size, err :=
+		strconv.ParseUint(vginfo[VGDISPLAY_SIZE_KB], 10, 64)
+	if err != nil {
+		return err
+	}
+
 	d.Size = free_extents * extent_size
 	d.ExtentSize = extent_size
-	logger.Debug("Size of %v in %v is %v", device, host, d.Size)
+	d.TotalSize = total_size
+	d.FreeExtents = free_extents
+	s.Logger().Debug("Size of %v in %v is %v", device, host, d.Size)
 	return nil
 }
+
+func (s *CmdExecutor) GetDeviceSnapshotUsage(host, vgid string) ([]executors.ThinPoolUsage, error) {
+
+	// Sample output:
+	//		# lvs --noheadings --units k --nosuffix --separator=: \
+	//		      -o lv_name,pool_lv,lv_size,data_percent vg_a17c621ade79017b48cc0042bea86510
+	//		  brick_3b9b3e07f06b93d94006ef272d3c10eb:tp_3b9b3e07f06b93d94006ef272d3c10eb:2097152.00:20.00
+	//		  tp_3b9b3e07f06b93d94006ef272d3c10eb::2097152.00:35.00
+	//		  b0fa2ea4d1e04d5a8a9c3b6a2e1d0c6f_0:tp_3b9b3e07f06b93d94006ef272d3c10eb:2097152.00:18.00
+
+	commands := []string{
+		fmt.Sprintf("lvs --noheadings --units k --nosuffix --separator=: "+
+			"-o lv_name,pool_lv,lv_size,data_percent %v", utils.VgIdToName(vgid)),
+	}
+
+	output, err := s.RemoteExecutor.RemoteCommandExecute(host, commands, 5)
+	if err != nil {
+		return nil, err
+	}
+
+	pools := map[string]*executors.ThinPoolUsage{}
+	pool := func(name string) *executors.ThinPoolUsage {
+		if _, ok := pools[name]; !ok {
+			pools[name] = &executors.ThinPoolUsage{ThinPool: name}
+		}
+		return pools[name]
+	}
+
+	for _, line := range strings.Split(output[0], "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		lvinfo := strings.Split(line, ":")
+		if len(lvinfo) < 4 {
+			return nil, fmt.Errorf("lvs returned an invalid string: %v", line)
+		}
+		name, poolName := lvinfo[0], lvinfo[1]
+
+		size, err := strconv.ParseFloat(lvinfo[2], 64)
+		if err != nil {
+			return nil, err
+		}
+		// data_percent is empty for logical volumes which are not thin
+		percent := 0.0
+		if lvinfo[3] != "" {
+			percent, err = strconv.ParseFloat(lvinfo[3], 64)
+			if err != nil {
+				return nil, err
+			}
+		}
+		used := uint64(size * percent / 100)
+
+		switch {
+		case poolName == "" && strings.HasPrefix(name, utils.BrickIdToThinPoolName("")):
+			tp := pool(name)
+			tp.Size = uint64(size)
+			tp.Used = used
+		case poolName == "":
+			// not part of a thin pool
+		case name == utils.BrickIdToName(
+			strings.TrimPrefix(poolName, utils.BrickIdToThinPoolName(""))):
+			pool(poolName).BrickUsed = used
+		default:
+			// every other logical volume in a brick's thin pool
+			// has been created by gluster for a snapshot
+			pool(poolName).Snapshots++
+		}
+	}
+
+	usage := []executors.ThinPoolUsage{}
+	for _, tp := range pools {
+		usage = append(usage, *tp)
+	}
+	return usage, nil
+}
+
+func (s *CmdExecutor) GetDeviceLvs(host, vgid string) ([]executors.LvInfo, error) {
+
+	// Sample output:
+	//		# lvs --noheadings --units k --nosuffix --separator=: \
+	//		      -o lv_name,pool_lv,lv_size vg_a17c621ade79017b48cc0042bea86510
+	//		  brick_3b9b3e07f06b93d94006ef272d3c10eb:tp_3b9b3e07f06b93d94006ef272d3c10eb:2097152.00
+	//		  tp_3b9b3e07f06b93d94006ef272d3c10eb::2097152.00
+
+	commands := []string{
+		fmt.Sprintf("lvs --noheadings --units k --nosuffix --separator=: "+
+			"-o lv_name,pool_lv,lv_size %v", utils.VgIdToName(vgid)),
+	}
+
+	output, err := s.RemoteExecutor.RemoteCommandExecute(host, commands, 5)
+	if err != nil {
+		return nil, err
+	}
+
+	lvs := []executors.LvInfo{}
+	for _, line := range strings.Split(output[0], "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		lvinfo := strings.Split(line, ":")
+		if len(lvinfo) < 3 {
+			return nil, fmt.Errorf("lvs returned an invalid string: %v", line)
+		}
+		size, err := strconv.ParseFloat(lvinfo[2], 64)
+		if err != nil {
+			return nil, err
+		}
+		lvs = append(lvs, executors.LvInfo{
+			Name:     lvinfo[0],
+			ThinPool: lvinfo[1],
+			Size:     uint64(size),
+		})
+	}
+	return lvs, nil
+}
@@ -0,0 +1,213 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package cmdexec
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/heketi/tests"
+)
+
+func TestSshExecGetDeviceSnapshotUsage(t *testing.T) {
+	f := NewCommandFaker()
+	s, err := NewFakeExecutor(f)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, s != nil)
+
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+
+		tests.Assert(t, host == "host:22", host)
+		tests.Assert(t, len(commands) == 1)
+		tests.Assert(t, commands[0] == "lvs --noheadings --units k --nosuffix "+
+			"--separator=: -o lv_name,pool_lv,lv_size,data_percent vg_xvgid",
+			commands)
+
+		return []string{`  brick_aaa:tp_aaa:1000.00:50.00
+  tp_aaa::1500.00:60.00
+  snap1_0:tp_aaa:1000.00:45.00
+  brick_bbb:tp_bbb:1000.00:10.00
+  tp_bbb::1500.00:10.00
+  lv_other::2000.00:
+`}, nil
+	}
+
+	usage, err := s.GetDeviceSnapshotUsage("host", "xvgid")
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, len(usage) == 2, usage)
+
+	for _, tp := range usage {
+		switch tp.ThinPool {
+		case "tp_aaa":
+			tests.Assert(t, tp.Size == 1500)
+			tests.Assert(t, tp.Used == 900, tp.Used)
+			tests.Assert(t, tp.BrickUsed == 500, tp.BrickUsed)
+			tests.Assert(t, tp.Snapshots == 1)
+			tests.Assert(t, tp.SnapshotUsed() == 400, tp.SnapshotUsed())
+		case "tp_bbb":
+			tests.Assert(t, tp.Snapshots == 0)
+			tests.Assert(t, tp.SnapshotUsed() == 0, tp.SnapshotUsed())
+		default:
+			tests.Assert(t, false, "unexpected thin pool", tp.ThinPool)
+		}
+	}
+}
+
+func TestSshExecGetDeviceInfo(t *testing.T) {
+	f := NewCommandFaker()
+	s, err := NewFakeExecutor(f)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, s != nil)
+
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+
+		tests.Assert(t, commands[0] == "vgdisplay -c vg_xvgid", commands)
+		return []string{
+			"  vg_xvgid:r/w:772:-1:0:0:0:-1:0:4:4:2097135616:4096:511996:11996:500000:rJ0bIG-3XNc-NoS0-fkKm-batK-dFyX-xbxHym",
+		}, nil
+	}
+
+	info, err := s.GetDeviceInfo("host", "/dev/sdb", "xvgid")
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, info.TotalSize == 2097135616, info.TotalSize)
+	tests.Assert(t, info.FreeExtents == 500000, info.FreeExtents)
+	tests.Assert(t, info.ExtentSize == 4096, info.ExtentSize)
+	tests.Assert(t, info.Size == 500000*4096, info.Size)
+}
+
+func TestSshExecGetDeviceLvs(t *testing.T) {
+	f := NewCommandFaker()
+	s, err := NewFakeExecutor(f)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, s != nil)
+
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+
+		tests.Assert(t, host == "host:22", host)
+		tests.Assert(t, len(commands) == 1)
+		tests.Assert(t, commands[0] == "lvs --noheadings --units k --nosuffix "+
+			"--separator=: -o lv_name,pool_lv,lv_size vg_xvgid",
+			commands)
+
+		return []string{`  brick_aaa:tp_aaa:1000.00
+  tp_aaa::1500.00
+  lv_other::2000.00
+`}, nil
+	}
+
+	lvs, err := s.GetDeviceLvs("host", "xvgid")
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, len(lvs) == 3, lvs)
+	tests.Assert(t, lvs[0].Name == "brick_aaa" && lvs[0].ThinPool == "tp_aaa", lvs[0])
+	tests.Assert(t, lvs[1].Name == "tp_aaa" && lvs[1].ThinPool == "", lvs[1])
+	tests.Assert(t, lvs[2].Size == 2000, lvs[2])
+
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+		return []string{"  bad\n"}, nil
+	}
+	_, err = s.GetDeviceLvs("host", "xvgid")
+	tests.Assert(t, err != nil)
+}
+
+func TestSshExecDeviceSetupVgCollision(t *testing.T) {
+	f := NewCommandFaker()
+	s, err := NewFakeExecutor(f)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, s != nil)
+
+	// Volume group found on the device and number of logical volumes
+	// in it
+	pvVg := ""
+	isPv := false
+	lvCount := "0"
+	executed := []string{}
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+
+		switch {
+		case strings.HasPrefix(commands[0], "pvs "):
+			tests.Assert(t, commands[0] == "pvs --noheadings -o vg_name '/dev/sdb'",
+				commands)
+			if !isPv {
+				return nil, fmt.Errorf("Failed to find physical volume")
+			}
+			return []string{"  " + pvVg + "\n"}, nil
+		case strings.HasPrefix(commands[0], "vgs "):
+			return []string{"  " + lvCount + "\n"}, nil
+		case strings.HasPrefix(commands[0], "vgdisplay "):
+			return []string{
+				"  vg_xvgid:r/w:772:-1:0:0:0:-1:0:4:4:2097135616:4096:511996:11996:500000:rJ0bIG-3XNc-NoS0-fkKm-batK-dFyX-xbxHym",
+			}, nil
+		}
+		executed = append(executed, commands...)
+		return make([]string, len(commands)), nil
+	}
+
+	// A new device is set up
+	_, err = s.DeviceSetup("host", "/dev/sdb", "xvgid")
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, len(executed) == 2, executed)
+	tests.Assert(t, strings.HasPrefix(executed[0], "pvcreate "), executed)
+	tests.Assert(t, executed[1] == "vgcreate vg_xvgid /dev/sdb", executed)
+
+	// A physical volume without volume group is reused
+	isPv = true
+	executed = []string{}
+	_, err = s.DeviceSetup("host", "/dev/sdb", "xvgid")
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, len(executed) == 1, executed)
+	tests.Assert(t, executed[0] == "vgcreate vg_xvgid /dev/sdb", executed)
+
+	// The volume group of the device is adopted
+	pvVg = "vg_xvgid"
+	executed = []string{}
+	_, err = s.DeviceSetup("host", "/dev/sdb", "xvgid")
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, len(executed) == 0, executed)
+
+	// An empty volume group of a previous setup is renamed
+	pvVg = "vg_oldvgid"
+	executed = []string{}
+	_, err = s.DeviceSetup("host", "/dev/sdb", "xvgid")
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, len(executed) == 1, executed)
+	tests.Assert(t, executed[0] == "vgrename vg_oldvgid vg_xvgid", executed)
+
+	// A volume group of a previous setup with logical volumes is kept
+	lvCount = "2"
+	executed = []string{}
+	_, err = s.DeviceSetup("host", "/dev/sdb", "xvgid")
+	tests.Assert(t, err != nil)
+	tests.Assert(t, strings.Contains(err.Error(), "vg_oldvgid"), err)
+	tests.Assert(t, len(executed) == 0, executed)
+
+	// So is a volume group not created by heketi
+	pvVg = "system"
+	lvCount = "0"
+	_, err = s.DeviceSetup("host", "/dev/sdb", "xvgid")
+	tests.Assert(t, err != nil)
+	tests.Assert(t, strings.Contains(err.Error(), "not created by heketi"), err)
+	tests.Assert(t, len(executed) == 0, executed)
+}
@@ -0,0 +1,146 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package cmdexec
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	envNameRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// CommandEnvironment holds the environment variables and PATH
+// prefixes applied to the commands run on the storage nodes.
+type CommandEnvironment struct {
+	Variables  map[string]string `json:"variables"`
+	PathPrefix []string          `json:"path_prefix"`
+}
+
+// Validate checks that the environment can be safely placed in front
+// of a command executed through a remote shell. The values are double
+// quoted inside the single quotes of the remote shell command, so
+// quotes, backslashes and the $ and ` expansions are rejected.
+func (e CommandEnvironment) Validate() error {
+	for name, value := range e.Variables {
+		if !envNameRe.MatchString(name) {
+			return fmt.Errorf("Invalid environment variable name: %v", name)
+		}
+		if name == "PATH" {
+			return fmt.Errorf("Use path_prefix to change the PATH variable")
+		}
+		if strings.ContainsAny(value, "'\"`\\$") {
+			return fmt.Errorf("Invalid value for environment variable %v: %v",
+				name, value)
+		}
+	}
+	for _, p := range e.PathPrefix {
+		if p == "" || strings.ContainsAny(p, ":'\"`\\ $") {
+			return fmt.Errorf("Invalid path prefix: %v", p)
+		}
+	}
+	return nil
+}
+
+func (e CommandEnvironment) empty() bool {
+	return len(e.Variables) == 0 && len(e.PathPrefix) == 0
+}
+
+// SetEnvironment sets the environment applied to the commands run on
+// every host and the per cluster environments that override it.
+func (s *CmdExecutor) SetEnvironment(env CommandEnvironment,
+	clusterEnv map[string]CommandEnvironment) error {
+
+	if err := env.Validate(); err != nil {
+		return err
+	}
+	for cluster, e := range clusterEnv {
+		if err := e.Validate(); err != nil {
+			return fmt.Errorf("Cluster %v: %v", cluster, err)
+		}
+	}
+
+	s.Lock.Lock()
+	defer s.Lock.Unlock()
+	s.environment = env
+	s.clusterEnvironment = clusterEnv
+	return nil
+}
+
+// SetHostCluster records the cluster the host belongs to so that the
+// environment configured for that cluster is applied to its commands.
+func (s *CmdExecutor) SetHostCluster(host, cluster string) {
+	s.Lock.Lock()
+	defer s.Lock.Unlock()
+	if s.hostClusters == nil {
+		s.hostClusters = map[string]string{}
+	}
+	s.hostClusters[host] = cluster
+}
+
+// hostEnvironment returns the environment for the commands run on the
+// host. Variables of the cluster override the global ones and the path
+// prefixes of the cluster are searched first.
+func (s *CmdExecutor) hostEnvironment(host string) CommandEnvironment {
+	s.Lock.Lock()
+	defer s.Lock.Unlock()
+
+	ce, ok := s.clusterEnvironment[s.hostClusters[host]]
+	if !ok {
+		return s.environment
+	}
+
+	env := CommandEnvironment{
+		Variables: map[string]string{},
+	}
+	for name, value := range s.environment.Variables {
+		env.Variables[name] = value
+	}
+	for name, value := range ce.Variables {
+		env.Variables[name] = value
+	}
+	env.PathPrefix = append(env.PathPrefix, ce.PathPrefix...)
+	env.PathPrefix = append(env.PathPrefix, s.environment.PathPrefix...)
+	return env
+}
+
+// PrepareCommands returns the commands with the environment configured
+// for the host placed in front of each of them.
+func (s *CmdExecutor) PrepareCommands(host string, commands []string) []string {
+	env := s.hostEnvironment(host)
+	if env.empty() {
+		return commands
+	}
+
+	names := make([]string, 0, len(env.Variables))
+	for name := range env.Variables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	prefix := []string{"env"}
+	for _, name := range names {
+		prefix = append(prefix,
+			fmt.Sprintf("%v=\"%v\"", name, env.Variables[name]))
+	}
+	if len(env.PathPrefix) > 0 {
+		prefix = append(prefix,
+			fmt.Sprintf("PATH=\"%v:$PATH\"", strings.Join(env.PathPrefix, ":")))
+	}
+
+	prepared := make([]string, len(commands))
+	for i, command := range commands {
+		prepared[i] = strings.Join(prefix, " ") + " " + command
+	}
+	return prepared
+}
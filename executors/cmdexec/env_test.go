@@ -0,0 +1,92 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package cmdexec
+
+import (
+	"testing"
+
+	"github.com/heketi/tests"
+)
+
+func TestCommandEnvironmentValidate(t *testing.T) {
+	e := CommandEnvironment{}
+	tests.Assert(t, e.Validate() == nil)
+
+	e.Variables = map[string]string{"LC_ALL": "C", "GLUSTER_HOME": "/opt/x y"}
+	e.PathPrefix = []string{"/opt/gluster/sbin"}
+	tests.Assert(t, e.Validate() == nil)
+
+	for _, name := range []string{"1ABC", "A-B", "A B", "", "PATH"} {
+		e := CommandEnvironment{Variables: map[string]string{name: "x"}}
+		tests.Assert(t, e.Validate() != nil, name)
+	}
+
+	for _, value := range []string{"a'b", "a\"b", "a`b", "a\\b", "$(id)", "$HOME"} {
+		e := CommandEnvironment{Variables: map[string]string{"X": value}}
+		tests.Assert(t, e.Validate() != nil, value)
+	}
+
+	for _, p := range []string{"", "/a:/b", "/a b", "/a'", "/a$(id)", "$HOME/bin"} {
+		e := CommandEnvironment{PathPrefix: []string{p}}
+		tests.Assert(t, e.Validate() != nil, p)
+	}
+}
+
+func TestCmdExecPrepareCommands(t *testing.T) {
+	f := NewCommandFaker()
+	s, err := NewFakeExecutor(f)
+	tests.Assert(t, err == nil)
+
+	// No environment leaves the commands unchanged
+	cmds := s.PrepareCommands("host1", []string{"lvs", "vgs"})
+	tests.Assert(t, len(cmds) == 2)
+	tests.Assert(t, cmds[0] == "lvs", cmds[0])
+	tests.Assert(t, cmds[1] == "vgs", cmds[1])
+
+	err = s.SetEnvironment(
+		CommandEnvironment{
+			Variables:  map[string]string{"LC_ALL": "C", "A": "1"},
+			PathPrefix: []string{"/usr/local/sbin"},
+		},
+		map[string]CommandEnvironment{
+			"c1": CommandEnvironment{
+				Variables:  map[string]string{"A": "2"},
+				PathPrefix: []string{"/opt/sbin"},
+			},
+		})
+	tests.Assert(t, err == nil, err)
+
+	cmds = s.PrepareCommands("host1", []string{"lvs"})
+	tests.Assert(t, cmds[0] == "env A=\"1\" LC_ALL=\"C\" "+
+		"PATH=\"/usr/local/sbin:$PATH\" lvs", cmds[0])
+
+	// Hosts of the cluster get the variables and path of the cluster first
+	s.SetHostCluster("host1", "c1")
+	cmds = s.PrepareCommands("host1", []string{"lvs"})
+	tests.Assert(t, cmds[0] == "env A=\"2\" LC_ALL=\"C\" "+
+		"PATH=\"/opt/sbin:/usr/local/sbin:$PATH\" lvs", cmds[0])
+
+	// Values the remote shell would expand are not applied
+	err = s.SetEnvironment(
+		CommandEnvironment{Variables: map[string]string{"A": "$(id)"}}, nil)
+	tests.Assert(t, err != nil)
+	cmds = s.PrepareCommands("host2", []string{"lvs"})
+	tests.Assert(t, cmds[0] == "env A=\"1\" LC_ALL=\"C\" "+
+		"PATH=\"/usr/local/sbin:$PATH\" lvs", cmds[0])
+
+	// Invalid environments are not applied
+	err = s.SetEnvironment(CommandEnvironment{},
+		map[string]CommandEnvironment{
+			"c1": CommandEnvironment{PathPrefix: []string{"/a:/b"}},
+		})
+	tests.Assert(t, err != nil)
+	cmds = s.PrepareCommands("host1", []string{"lvs"})
+	tests.Assert(t, cmds[0] != "lvs", cmds[0])
+}
@@ -9,6 +9,10 @@
 
 package cmdexec
 
+import (
+	"sync"
+)
+
 type CommandFaker struct {
 	FakeConnectAndExec func(host string,
 		commands []string,
@@ -39,6 +43,7 @@ func NewFakeExecutor(f *CommandFaker) (*FakeExecutor, error) {
 	t := &FakeExecutor{}
 	t.RemoteExecutor = t
 	t.Throttlemap = make(map[string]chan bool)
+	t.Lock = &sync.Mutex{}
 	t.fake = f
 	t.Fstab = "/my/fstab"
 	t.portStr = "22"
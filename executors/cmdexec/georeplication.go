@@ -0,0 +1,78 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package cmdexec
+
+import (
+	"fmt"
+
+	"github.com/heketi/heketi/executors"
+	"github.com/lpabon/godbc"
+)
+
+func geoReplicationSession(session *executors.GeoReplicationRequest) string {
+	return fmt.Sprintf("%v %v::%v",
+		session.PrimaryVolume,
+		session.SecondaryHost,
+		session.SecondaryVolume)
+}
+
+// GeoReplicationCreate creates the geo-replication session of the primary
+// volume to the secondary volume, distributing the ssh keys of the
+// primary cluster to the secondary cluster. The session is not started.
+func (s *CmdExecutor) GeoReplicationCreate(host string,
+	session *executors.GeoReplicationRequest) error {
+
+	godbc.Require(host != "")
+	godbc.Require(session != nil)
+	godbc.Require(session.PrimaryVolume != "")
+	godbc.Require(session.SecondaryHost != "")
+	godbc.Require(session.SecondaryVolume != "")
+
+	commands := []string{
+		"gluster --mode=script system:: execute gsec_create",
+		fmt.Sprintf("gluster --mode=script volume geo-replication %v create push-pem force",
+			geoReplicationSession(session)),
+	}
+	_, err := s.RemoteExecutor.RemoteCommandExecute(host, commands, 10)
+	if err != nil {
+		return s.Logger().Err(fmt.Errorf("Unable to create geo-replication session %v: %v",
+			geoReplicationSession(session), err))
+	}
+
+	return nil
+}
+
+// GeoReplicationAction starts, stops or deletes the geo-replication
+// session. Force stops the session even if the secondary volume is not
+// reachable.
+func (s *CmdExecutor) GeoReplicationAction(host string,
+	session *executors.GeoReplicationRequest,
+	action string,
+	force bool) error {
+
+	godbc.Require(host != "")
+	godbc.Require(session != nil)
+	godbc.Require(action == executors.GeoReplicationStart ||
+		action == executors.GeoReplicationStop ||
+		action == executors.GeoReplicationDelete)
+
+	command := fmt.Sprintf("gluster --mode=script volume geo-replication %v %v",
+		geoReplicationSession(session), action)
+	if force {
+		command += " force"
+	}
+	_, err := s.RemoteExecutor.RemoteCommandExecute(host, []string{command}, 10)
+	if err != nil {
+		return s.Logger().Err(fmt.Errorf("Unable to %v geo-replication session %v: %v",
+			action, geoReplicationSession(session), err))
+	}
+
+	return nil
+}
@@ -0,0 +1,68 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package cmdexec
+
+import (
+	"testing"
+
+	"github.com/heketi/heketi/executors"
+	"github.com/heketi/tests"
+)
+
+func TestSshExecGeoReplication(t *testing.T) {
+	f := NewCommandFaker()
+	s, err := NewFakeExecutor(f)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, s != nil)
+
+	var commands []string
+	f.FakeConnectAndExec = func(host string,
+		c []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+
+		tests.Assert(t, host == "host1:22", host)
+		commands = c
+		return make([]string, len(c)), nil
+	}
+
+	session := &executors.GeoReplicationRequest{
+		PrimaryVolume:   "vol1",
+		SecondaryHost:   "host2",
+		SecondaryVolume: "vol2",
+	}
+	err = s.GeoReplicationCreate("host1", session)
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, len(commands) == 2, commands)
+	tests.Assert(t,
+		commands[0] == "gluster --mode=script system:: execute gsec_create",
+		commands[0])
+	tests.Assert(t,
+		commands[1] == "gluster --mode=script volume geo-replication "+
+			"vol1 host2::vol2 create push-pem force",
+		commands[1])
+
+	err = s.GeoReplicationAction("host1", session,
+		executors.GeoReplicationStart, false)
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, len(commands) == 1, commands)
+	tests.Assert(t,
+		commands[0] == "gluster --mode=script volume geo-replication "+
+			"vol1 host2::vol2 start",
+		commands[0])
+
+	err = s.GeoReplicationAction("host1", session,
+		executors.GeoReplicationStop, true)
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t,
+		commands[0] == "gluster --mode=script volume geo-replication "+
+			"vol1 host2::vol2 stop force",
+		commands[0])
+}
@@ -0,0 +1,94 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package cmdexec
+
+import (
+	"fmt"
+
+	"github.com/heketi/heketi/executors"
+	"github.com/heketi/heketi/pkg/utils"
+)
+
+const (
+	// Bytes of the stdout and of the stderr of a failed command kept
+	// when no capture size is configured
+	DefaultCommandOutputSize = 64 * 1024
+)
+
+// SetCommandOutputSize sets the number of bytes of the stdout and of
+// the stderr of a failed command that are kept. Zero keeps the default.
+func (s *CmdExecutor) SetCommandOutputSize(size int) error {
+	if size < 0 {
+		return fmt.Errorf("Invalid command output size: %v", size)
+	}
+
+	s.Lock.Lock()
+	defer s.Lock.Unlock()
+	s.outputSize = size
+	return nil
+}
+
+// SetCommandOutputHandler sets the function called with the output of
+// every command that failed
+func (s *CmdExecutor) SetCommandOutputHandler(handler func(o *executors.CommandOutput)) {
+	s.Lock.Lock()
+	defer s.Lock.Unlock()
+	s.outputHandler = handler
+}
+
+// RecordCommandOutput passes the output of a command that failed on the
+// host to the command output handler, cut to the capture size, and sets
+// the id of the output in the error. Other errors are left untouched.
+func (s *CmdExecutor) RecordCommandOutput(host string, err error) error {
+	cerr, ok := err.(*utils.CommandError)
+	if !ok {
+		return err
+	}
+
+	s.Lock.Lock()
+	handler := s.outputHandler
+	size := s.outputSize
+	s.Lock.Unlock()
+
+	if handler == nil {
+		return err
+	}
+	if size == 0 {
+		size = DefaultCommandOutputSize
+	}
+
+	o := &executors.CommandOutput{
+		Id:      utils.GenUUID(),
+		Host:    host,
+		Command: cerr.Command,
+	}
+	var stdoutCut, stderrCut bool
+	o.Stdout, stdoutCut = lastBytes(cerr.Stdout, size)
+	o.Stderr, stderrCut = lastBytes(cerr.Stderr, size)
+	o.Truncated = stdoutCut || stderrCut
+	if cerr.Err != nil {
+		o.Error = cerr.Err.Error()
+	}
+
+	cerr.OutputId = o.Id
+	s.Logger().Info("Output of failed command [%v] on %v kept as %v",
+		cerr.Command, host, o.Id)
+	handler(o)
+	return err
+}
+
+// lastBytes returns the end of the output that fits in size bytes, as
+// the errors of a command usually come last
+func lastBytes(output string, size int) (string, bool) {
+	if len(output) <= size {
+		return output, false
+	}
+	return output[len(output)-size:], true
+}
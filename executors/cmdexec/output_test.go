@@ -0,0 +1,74 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package cmdexec
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/heketi/heketi/executors"
+	"github.com/heketi/heketi/pkg/utils"
+	"github.com/heketi/tests"
+)
+
+func TestCmdExecRecordCommandOutput(t *testing.T) {
+	f := NewCommandFaker()
+	s, err := NewFakeExecutor(f)
+	tests.Assert(t, err == nil)
+
+	cerr := &utils.CommandError{
+		Message: "failed",
+		Command: "mkfs.xfs /dev/x",
+		Stdout:  "out",
+		Stderr:  strings.Repeat("e", 10) + "the error",
+		Err:     errors.New("exit status 1"),
+	}
+
+	// Without a handler the output is not kept
+	err = s.RecordCommandOutput("host1", cerr)
+	tests.Assert(t, err == cerr, err)
+	tests.Assert(t, cerr.OutputId == "", cerr.OutputId)
+
+	var recorded []*executors.CommandOutput
+	s.SetCommandOutputHandler(func(o *executors.CommandOutput) {
+		recorded = append(recorded, o)
+	})
+
+	// Other errors are left untouched
+	other := errors.New("connection refused")
+	err = s.RecordCommandOutput("host1", other)
+	tests.Assert(t, err == other, err)
+	tests.Assert(t, s.RecordCommandOutput("host1", nil) == nil)
+	tests.Assert(t, len(recorded) == 0, recorded)
+
+	err = s.RecordCommandOutput("host1", cerr)
+	tests.Assert(t, err == cerr, err)
+	tests.Assert(t, len(recorded) == 1, recorded)
+	o := recorded[0]
+	tests.Assert(t, o.Id != "" && o.Id == cerr.OutputId, o.Id, cerr.OutputId)
+	tests.Assert(t, o.Host == "host1", o.Host)
+	tests.Assert(t, o.Command == cerr.Command, o.Command)
+	tests.Assert(t, o.Stdout == cerr.Stdout, o.Stdout)
+	tests.Assert(t, o.Stderr == cerr.Stderr, o.Stderr)
+	tests.Assert(t, o.Error == "exit status 1", o.Error)
+	tests.Assert(t, !o.Truncated)
+
+	// The end of the output is kept
+	tests.Assert(t, s.SetCommandOutputSize(-1) != nil)
+	tests.Assert(t, s.SetCommandOutputSize(9) == nil)
+	err = s.RecordCommandOutput("host1", cerr)
+	tests.Assert(t, err == cerr, err)
+	tests.Assert(t, len(recorded) == 2, recorded)
+	o = recorded[1]
+	tests.Assert(t, o.Stdout == "out", o.Stdout)
+	tests.Assert(t, o.Stderr == "the error", o.Stderr)
+	tests.Assert(t, o.Truncated)
+}
@@ -10,8 +10,10 @@
 package cmdexec
 
 import (
+	"encoding/xml"
 	"fmt"
 
+	"github.com/heketi/heketi/executors"
 	"github.com/lpabon/godbc"
 )
 
@@ -21,7 +23,7 @@ func (s *CmdExecutor) PeerProbe(host, newnode string) error {
 	godbc.Require(host != "")
 	godbc.Require(newnode != "")
 
-	logger.Info("Probing: %v -> %v", host, newnode)
+	s.Logger().Info("Probing: %v -> %v", host, newnode)
 	// create the commands
 	commands := []string{
 		fmt.Sprintf("gluster peer probe %v", newnode),
@@ -33,7 +35,7 @@ func (s *CmdExecutor) PeerProbe(host, newnode string) error {
 
 	// Determine if there is a snapshot limit configuration setting
 	if s.RemoteExecutor.SnapShotLimit() > 0 {
-		logger.Info("Setting snapshot limit")
+		s.Logger().Info("Setting snapshot limit")
 		commands = []string{
 			fmt.Sprintf("gluster --mode=script snapshot config snap-max-hard-limit %v",
 				s.RemoteExecutor.SnapShotLimit()),
@@ -52,28 +54,55 @@ func (s *CmdExecutor) PeerDetach(host, detachnode string) error {
 	godbc.Require(detachnode != "")
 
 	// create the commands
-	logger.Info("Detaching node %v", detachnode)
+	s.Logger().Info("Detaching node %v", detachnode)
 	commands := []string{
 		fmt.Sprintf("gluster peer detach %v", detachnode),
 	}
 	_, err := s.RemoteExecutor.RemoteCommandExecute(host, commands, 10)
 	if err != nil {
-		logger.Err(err)
+		s.Logger().Err(err)
 	}
 
 	return nil
 }
 
+func (s *CmdExecutor) PeerStatus(host string) (*executors.PeerStatus, error) {
+	godbc.Require(host != "")
+
+	type CliOutput struct {
+		OpRet      int                  `xml:"opRet"`
+		OpErrno    int                  `xml:"opErrno"`
+		OpErrStr   string               `xml:"opErrstr"`
+		PeerStatus executors.PeerStatus `xml:"peerStatus"`
+	}
+
+	commands := []string{
+		fmt.Sprintf("gluster --mode=script peer status --xml"),
+	}
+	output, err := s.RemoteExecutor.RemoteCommandExecute(host, commands, 10)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to get peer status from host %v", host)
+	}
+
+	var peerStatus CliOutput
+	err = xml.Unmarshal([]byte(output[0]), &peerStatus)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to determine peer status from host %v", host)
+	}
+	s.Logger().Debug("%+v\n", peerStatus)
+	return &peerStatus.PeerStatus, nil
+}
+
 func (s *CmdExecutor) GlusterdCheck(host string) error {
 	godbc.Require(host != "")
 
-	logger.Info("Check Glusterd service status in node %v", host)
+	s.Logger().Info("Check Glusterd service status in node %v", host)
 	commands := []string{
 		fmt.Sprintf("systemctl status glusterd"),
 	}
 	_, err := s.RemoteExecutor.RemoteCommandExecute(host, commands, 10)
 	if err != nil {
-		logger.Err(err)
+		s.Logger().Err(err)
 		return err
 	}
 
@@ -100,3 +100,61 @@ func TestSshExecGlusterdCheck(t *testing.T) {
 	err = s.GlusterdCheck("newhost")
 	tests.Assert(t, err == nil, err)
 }
+
+func TestSshExecPeerStatus(t *testing.T) {
+	f := NewCommandFaker()
+	s, err := NewFakeExecutor(f)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, s != nil)
+
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+
+		tests.Assert(t, host == "host:22", host)
+		tests.Assert(t, len(commands) == 1)
+		tests.Assert(t,
+			commands[0] == "gluster --mode=script peer status --xml", commands)
+
+		return []string{`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<cliOutput>
+  <opRet>0</opRet>
+  <opErrno>0</opErrno>
+  <opErrstr/>
+  <peerStatus>
+    <peer>
+      <uuid>6b1ad5a3-2fb0-4b4e-8cbd-4e2e1c2bde1f</uuid>
+      <hostname>192.168.10.101</hostname>
+      <hostnames>
+        <hostname>192.168.10.101</hostname>
+        <hostname>node1</hostname>
+      </hostnames>
+      <connected>1</connected>
+      <state>3</state>
+      <stateStr>Peer in Cluster</stateStr>
+    </peer>
+    <peer>
+      <uuid>c1d5b4b2-6e1e-4d4b-9ea9-7f7d7ab0fa21</uuid>
+      <hostname>192.168.10.102</hostname>
+      <hostnames>
+        <hostname>192.168.10.102</hostname>
+      </hostnames>
+      <connected>0</connected>
+      <state>6</state>
+      <stateStr>Peer Rejected</stateStr>
+    </peer>
+  </peerStatus>
+</cliOutput>`}, nil
+	}
+
+	status, err := s.PeerStatus("host")
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, len(status.Peers) == 2, status.Peers)
+	tests.Assert(t, status.Peers[0].Hostname == "192.168.10.101")
+	tests.Assert(t, len(status.Peers[0].Hostnames) == 2)
+	tests.Assert(t, status.Peers[0].Hostnames[1] == "node1")
+	tests.Assert(t, status.Peers[0].Connected == 1)
+	tests.Assert(t, status.Peers[1].Connected == 0)
+	tests.Assert(t, status.Peers[1].StateStr == "Peer Rejected")
+}
@@ -0,0 +1,62 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package cmdexec
+
+import (
+	"fmt"
+
+	"github.com/heketi/heketi/executors"
+	"github.com/lpabon/godbc"
+)
+
+// volumeQuotaCommands returns the commands changing the quota of the
+// volume. Gluster only enables the quota of a started volume.
+func volumeQuotaCommands(quota *executors.VolumeQuotaRequest) []string {
+	cmd := fmt.Sprintf("gluster --mode=script volume quota %v", quota.Volume)
+	if quota.Disable {
+		return []string{cmd + " disable"}
+	}
+
+	commands := []string{}
+	if quota.Enable {
+		commands = append(commands, cmd+" enable")
+	}
+	for _, path := range quota.Remove {
+		commands = append(commands, fmt.Sprintf("%v remove %v", cmd, path))
+	}
+	for _, l := range quota.Limits {
+		commands = append(commands, fmt.Sprintf("%v limit-usage %v %vMB",
+			cmd, l.Path, l.HardLimitMiB))
+	}
+	return commands
+}
+
+// VolumeSetQuota enables or disables the quota of the volume and sets
+// or removes the limits of its directories
+func (s *CmdExecutor) VolumeSetQuota(host string,
+	quota *executors.VolumeQuotaRequest) error {
+
+	godbc.Require(host != "")
+	godbc.Require(quota != nil)
+	godbc.Require(quota.Volume != "")
+	godbc.Require(!(quota.Enable && quota.Disable))
+
+	commands := volumeQuotaCommands(quota)
+	if len(commands) == 0 {
+		return nil
+	}
+	_, err := s.RemoteExecutor.RemoteCommandExecute(host, commands, 10)
+	if err != nil {
+		return s.Logger().Err(fmt.Errorf("Unable to set quota of volume %v: %v",
+			quota.Volume, err))
+	}
+
+	return nil
+}
@@ -0,0 +1,119 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package cmdexec
+
+import (
+	"testing"
+
+	"github.com/heketi/heketi/executors"
+	"github.com/heketi/tests"
+)
+
+func TestSshExecVolumeSetQuota(t *testing.T) {
+	f := NewCommandFaker()
+	s, err := NewFakeExecutor(f)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, s != nil)
+
+	var commands []string
+	f.FakeConnectAndExec = func(host string,
+		c []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+
+		commands = c
+		return make([]string, len(c)), nil
+	}
+
+	err = s.VolumeSetQuota("host", &executors.VolumeQuotaRequest{
+		Volume: "vol1",
+		Enable: true,
+		Limits: []executors.QuotaLimit{
+			{Path: "/", HardLimitMiB: 1024},
+			{Path: "/a", HardLimitMiB: 10},
+		},
+		Remove: []string{"/b"},
+	})
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, len(commands) == 4, commands)
+	tests.Assert(t,
+		commands[0] == "gluster --mode=script volume quota vol1 enable",
+		commands[0])
+	tests.Assert(t,
+		commands[1] == "gluster --mode=script volume quota vol1 remove /b",
+		commands[1])
+	tests.Assert(t,
+		commands[2] == "gluster --mode=script volume quota vol1 limit-usage / 1024MB",
+		commands[2])
+	tests.Assert(t,
+		commands[3] == "gluster --mode=script volume quota vol1 limit-usage /a 10MB",
+		commands[3])
+
+	// Disabling removes the limits
+	err = s.VolumeSetQuota("host", &executors.VolumeQuotaRequest{
+		Volume:  "vol1",
+		Disable: true,
+		Remove:  []string{"/", "/a"},
+	})
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, len(commands) == 1, commands)
+	tests.Assert(t,
+		commands[0] == "gluster --mode=script volume quota vol1 disable",
+		commands[0])
+
+	// Nothing to change
+	commands = nil
+	err = s.VolumeSetQuota("host", &executors.VolumeQuotaRequest{
+		Volume: "vol1",
+	})
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, commands == nil, commands)
+}
+
+func TestSshExecVolumeCreateQuota(t *testing.T) {
+	f := NewCommandFaker()
+	s, err := NewFakeExecutor(f)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, s != nil)
+
+	var commands []string
+	f.FakeConnectAndExec = func(host string,
+		c []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+
+		commands = c
+		return make([]string, len(c)), nil
+	}
+
+	_, err = s.VolumeCreate("host", &executors.VolumeRequest{
+		Name: "vol1",
+		Type: executors.DurabilityNone,
+		Bricks: []executors.BrickInfo{
+			{Host: "host1", Path: "/brick1"},
+		},
+		Quota: &executors.VolumeQuotaRequest{
+			Volume: "vol1",
+			Enable: true,
+			Limits: []executors.QuotaLimit{{Path: "/", HardLimitMiB: 512}},
+		},
+	})
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, len(commands) == 4, commands)
+	tests.Assert(t,
+		commands[1] == "gluster --mode=script volume start vol1",
+		commands[1])
+	tests.Assert(t,
+		commands[2] == "gluster --mode=script volume quota vol1 enable",
+		commands[2])
+	tests.Assert(t,
+		commands[3] == "gluster --mode=script volume quota vol1 limit-usage / 512MB",
+		commands[3])
+}
@@ -0,0 +1,67 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package cmdexec
+
+import (
+	"fmt"
+	"strings"
+)
+
+// selinuxEnabled returns true if SELinux is enforcing or permissive on
+// the host. Hosts without the SELinux tools have SELinux disabled.
+func (s *CmdExecutor) selinuxEnabled(host string) bool {
+	output, err := s.RemoteExecutor.RemoteCommandExecute(host,
+		[]string{"getenforce"}, 5)
+	if err != nil {
+		s.Logger().Warning("Unable to get the SELinux mode of host %v: %v",
+			host, err)
+		return false
+	}
+	mode := strings.TrimSpace(output[0])
+	return mode == "Enforcing" || mode == "Permissive"
+}
+
+// selinuxCheckContext returns an error if the path does not have the
+// SELinux context
+func (s *CmdExecutor) selinuxCheckContext(host, path, context string) error {
+	output, err := s.RemoteExecutor.RemoteCommandExecute(host,
+		[]string{fmt.Sprintf("stat -c %%C %v", path)}, 5)
+	if err != nil {
+		return err
+	}
+	if label := strings.TrimSpace(output[0]); label != context {
+		return fmt.Errorf("SELinux context of %v on host %v is %v instead of %v",
+			path, host, label, context)
+	}
+	return nil
+}
+
+// selinuxSetBooleans turns on the SELinux booleans of the host which
+// are off
+func (s *CmdExecutor) selinuxSetBooleans(host string, booleans []string) error {
+	for _, b := range booleans {
+		output, err := s.RemoteExecutor.RemoteCommandExecute(host,
+			[]string{fmt.Sprintf("getsebool %v", b)}, 5)
+		if err != nil {
+			return err
+		}
+		// The output is "<boolean> --> on" or "<boolean> --> off"
+		if strings.HasSuffix(strings.TrimSpace(output[0]), "on") {
+			continue
+		}
+		s.Logger().Info("Turning on SELinux boolean %v on host %v", b, host)
+		_, err = s.RemoteExecutor.RemoteCommandExecute(host,
+			[]string{fmt.Sprintf("setsebool -P %v on", b)}, 5)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
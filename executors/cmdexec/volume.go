@@ -12,11 +12,18 @@ package cmdexec
 import (
 	"encoding/xml"
 	"fmt"
+	"strings"
 
 	"github.com/heketi/heketi/executors"
+	"github.com/heketi/heketi/pkg/utils"
 	"github.com/lpabon/godbc"
 )
 
+const (
+	// Directory where volumes are mounted to check them
+	canaryMountDir = "/var/lib/heketi/canary"
+)
+
 func (s *CmdExecutor) VolumeCreate(host string,
 	volume *executors.VolumeRequest) (*executors.Volume, error) {
 
@@ -33,16 +40,16 @@ func (s *CmdExecutor) VolumeCreate(host string,
 	)
 	switch volume.Type {
 	case executors.DurabilityNone:
-		logger.Info("Creating volume %v with no durability", volume.Name)
+		s.Logger().Info("Creating volume %v with no durability", volume.Name)
 		inSet = 1
 		maxPerSet = 15
 	case executors.DurabilityReplica:
-		logger.Info("Creating volume %v replica %v", volume.Name, volume.Replica)
+		s.Logger().Info("Creating volume %v replica %v", volume.Name, volume.Replica)
 		cmd += fmt.Sprintf("replica %v ", volume.Replica)
 		inSet = volume.Replica
 		maxPerSet = 5
 	case executors.DurabilityDispersion:
-		logger.Info("Creating volume %v dispersion %v+%v",
+		s.Logger().Info("Creating volume %v dispersion %v+%v",
 			volume.Name, volume.Data, volume.Redundancy)
 		cmd += fmt.Sprintf("disperse-data %v redundancy %v ", volume.Data, volume.Redundancy)
 		inSet = volume.Data + volume.Redundancy
@@ -66,6 +73,10 @@ func (s *CmdExecutor) VolumeCreate(host string,
 
 	commands = append(commands, fmt.Sprintf("gluster --mode=script volume start %v", volume.Name))
 
+	if volume.Quota != nil {
+		commands = append(commands, volumeQuotaCommands(volume.Quota)...)
+	}
+
 	_, err := s.RemoteExecutor.RemoteCommandExecute(host, commands, 10)
 	if err != nil {
 		s.VolumeDestroy(host, volume.Name)
@@ -129,7 +140,7 @@ func (s *CmdExecutor) VolumeDestroy(host string, volume string) error {
 
 	_, err := s.RemoteExecutor.RemoteCommandExecute(host, commands, 10)
 	if err != nil {
-		logger.LogError("Unable to stop volume %v: %v", volume, err)
+		s.Logger().LogError("Unable to stop volume %v: %v", volume, err)
 	}
 
 	commands = []string{
@@ -137,13 +148,25 @@ func (s *CmdExecutor) VolumeDestroy(host string, volume string) error {
 	}
 
 	_, err = s.RemoteExecutor.RemoteCommandExecute(host, commands, 10)
-	if err != nil {
-		return logger.Err(fmt.Errorf("Unable to delete volume %v: %v", volume, err))
+	if err != nil && volumeMissing(err) {
+		// a delete interrupted by a restart of heketi may have
+		// removed the volume already
+		s.Logger().Warning("Volume %v already deleted", volume)
+		return nil
+	} else if err != nil {
+		return s.Logger().Err(fmt.Errorf("Unable to delete volume %v: %v", volume, err))
 	}
 
 	return nil
 }
 
+// volumeMissing returns true if the gluster command failed because the
+// volume does not exist
+func volumeMissing(err error) bool {
+	cmdErr, ok := err.(*utils.CommandError)
+	return ok && strings.Contains(cmdErr.Stdout+cmdErr.Stderr, "does not exist")
+}
+
 func (s *CmdExecutor) VolumeDestroyCheck(host, volume string) error {
 	godbc.Require(host != "")
 	godbc.Require(volume != "")
@@ -216,7 +239,9 @@ func (s *CmdExecutor) checkForSnapshots(host, volume string) error {
 	}
 
 	output, err := s.RemoteExecutor.RemoteCommandExecute(host, commands, 10)
-	if err != nil {
+	if err != nil && volumeMissing(err) {
+		return nil
+	} else if err != nil {
 		return fmt.Errorf("Unable to get snapshot information from volume %v: %v", volume, err)
 	}
 
@@ -260,7 +285,7 @@ func (s *CmdExecutor) VolumeInfo(host string, volume string) (*executors.Volume,
 	if err != nil {
 		return nil, fmt.Errorf("Unable to determine volume info of volume name: %v", volume)
 	}
-	logger.Debug("%+v\n", volumeInfo)
+	s.Logger().Debug("%+v\n", volumeInfo)
 	return &volumeInfo.VolInfo.Volumes.VolumeList[0], nil
 }
 
@@ -276,7 +301,7 @@ func (s *CmdExecutor) VolumeReplaceBrick(host string, volume string, oldBrick *e
 	}
 	_, err := s.RemoteExecutor.RemoteCommandExecute(host, command, 10)
 	if err != nil {
-		return logger.Err(fmt.Errorf("Unable to replace brick %v:%v with %v:%v for volume %v", oldBrick.Host, oldBrick.Path, newBrick.Host, newBrick.Path, volume))
+		return s.Logger().Err(fmt.Errorf("Unable to replace brick %v:%v with %v:%v for volume %v", oldBrick.Host, oldBrick.Path, newBrick.Host, newBrick.Path, volume))
 	}
 
 	return nil
@@ -308,6 +333,359 @@ func (s *CmdExecutor) HealInfo(host string, volume string) (*executors.HealInfo,
 	if err != nil {
 		return nil, fmt.Errorf("Unable to determine heal info of volume : %v", volume)
 	}
-	logger.Debug("%+v\n", healInfo)
+	s.Logger().Debug("%+v\n", healInfo)
 	return &healInfo.HealInfo, nil
 }
+
+func (s *CmdExecutor) VolumeStart(host string, volume string) error {
+	godbc.Require(host != "")
+	godbc.Require(volume != "")
+
+	command := []string{
+		fmt.Sprintf("gluster --mode=script volume start %v", volume),
+	}
+	_, err := s.RemoteExecutor.RemoteCommandExecute(host, command, 10)
+	if err != nil {
+		return s.Logger().Err(fmt.Errorf("Unable to start volume %v: %v", volume, err))
+	}
+
+	return nil
+}
+
+func (s *CmdExecutor) VolumeStop(host string, volume string) error {
+	godbc.Require(host != "")
+	godbc.Require(volume != "")
+
+	command := []string{
+		fmt.Sprintf("gluster --mode=script volume stop %v", volume),
+	}
+	_, err := s.RemoteExecutor.RemoteCommandExecute(host, command, 10)
+	if err != nil {
+		return s.Logger().Err(fmt.Errorf("Unable to stop volume %v: %v", volume, err))
+	}
+
+	return nil
+}
+
+func (s *CmdExecutor) VolumeSetOptions(host string, volume string, options []string) error {
+	godbc.Require(host != "")
+	godbc.Require(volume != "")
+
+	commands := s.createVolumeOptionsCommand(&executors.VolumeRequest{
+		Name:                 volume,
+		GlusterVolumeOptions: options,
+	})
+	if len(commands) == 0 {
+		return nil
+	}
+	_, err := s.RemoteExecutor.RemoteCommandExecute(host, commands, 10)
+	if err != nil {
+		return s.Logger().Err(fmt.Errorf("Unable to set options of volume %v: %v", volume, err))
+	}
+
+	return nil
+}
+
+// VolumeResetOptions resets the options of the volume, given by name,
+// to their default values
+func (s *CmdExecutor) VolumeResetOptions(host string, volume string, options []string) error {
+	godbc.Require(host != "")
+	godbc.Require(volume != "")
+
+	commands := []string{}
+	for _, option := range options {
+		if option != "" {
+			commands = append(commands,
+				fmt.Sprintf("gluster --mode=script volume reset %v %v", volume, option))
+		}
+	}
+	if len(commands) == 0 {
+		return nil
+	}
+	_, err := s.RemoteExecutor.RemoteCommandExecute(host, commands, 10)
+	if err != nil {
+		return s.Logger().Err(fmt.Errorf("Unable to reset options of volume %v: %v", volume, err))
+	}
+
+	return nil
+}
+
+// VolumeIOCheck mounts the volume on the host, writes a file to it and
+// reads it back before unmounting the volume
+func (s *CmdExecutor) VolumeIOCheck(host string, volume string) error {
+	godbc.Require(host != "")
+	godbc.Require(volume != "")
+
+	mountPath := fmt.Sprintf("%v/%v", canaryMountDir, volume)
+	file := mountPath + "/canary"
+	token := "heketi canary " + volume
+
+	commands := []string{
+		fmt.Sprintf("mkdir -p %v", mountPath),
+		fmt.Sprintf("mount -t glusterfs localhost:/%v %v", volume, mountPath),
+		fmt.Sprintf("awk \"BEGIN {print \\\"%v\\\" > \\\"%v\\\"}\"", token, file),
+		fmt.Sprintf("cat %v", file),
+	}
+	output, err := s.RemoteExecutor.RemoteCommandExecute(host, commands, 5)
+
+	// Always clean up the mount
+	cleanup := []string{
+		fmt.Sprintf("umount %v", mountPath),
+		fmt.Sprintf("rmdir %v", mountPath),
+	}
+	for _, command := range cleanup {
+		_, cerr := s.RemoteExecutor.RemoteCommandExecute(host, []string{command}, 5)
+		if cerr != nil {
+			s.Logger().Err(cerr)
+		}
+	}
+
+	if err != nil {
+		return s.Logger().Err(fmt.Errorf("Unable to write to volume %v: %v", volume, err))
+	}
+	if strings.TrimSpace(output[3]) != token {
+		return s.Logger().Err(fmt.Errorf("Unexpected content read from volume %v: %q",
+			volume, output[3]))
+	}
+
+	return nil
+}
+
+func (s *CmdExecutor) VolumeStatus(host string, volume string) (*executors.VolumeStatus, error) {
+
+	godbc.Require(volume != "")
+	godbc.Require(host != "")
+
+	type CliOutput struct {
+		OpRet     int                 `xml:"opRet"`
+		OpErrno   int                 `xml:"opErrno"`
+		OpErrStr  string              `xml:"opErrstr"`
+		VolStatus executors.VolStatus `xml:"volStatus"`
+	}
+
+	// The clients variant of volume status reports the online state of
+	// every brick as well as the number of clients connected to it
+	command := []string{
+		fmt.Sprintf("gluster --mode=script volume status %v clients --xml", volume),
+	}
+
+	output, err := s.RemoteExecutor.RemoteCommandExecute(host, command, 10)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to get volume status of volume name: %v", volume)
+	}
+	var volumeStatus CliOutput
+	err = xml.Unmarshal([]byte(output[0]), &volumeStatus)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to determine volume status of volume name: %v", volume)
+	}
+	if len(volumeStatus.VolStatus.Volumes.VolumeList) == 0 {
+		return nil, fmt.Errorf("Unable to find status of volume name: %v", volume)
+	}
+	s.Logger().Debug("%+v\n", volumeStatus)
+	return &volumeStatus.VolStatus.Volumes.VolumeList[0], nil
+}
+
+// VolumeProfileInfo returns the cumulative io counters of every brick
+// of the volume. Profiling must have been started on the volume.
+func (s *CmdExecutor) VolumeProfileInfo(host string, volume string) (*executors.VolumeProfile, error) {
+
+	godbc.Require(volume != "")
+	godbc.Require(host != "")
+
+	type CliOutput struct {
+		OpRet      int                     `xml:"opRet"`
+		OpErrno    int                     `xml:"opErrno"`
+		OpErrStr   string                  `xml:"opErrstr"`
+		VolProfile executors.VolumeProfile `xml:"volProfile"`
+	}
+
+	command := []string{
+		fmt.Sprintf("gluster --mode=script volume profile %v info cumulative --xml", volume),
+	}
+
+	output, err := s.RemoteExecutor.RemoteCommandExecute(host, command, 10)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to get profile of volume name: %v: %v", volume, err)
+	}
+	var profile CliOutput
+	err = xml.Unmarshal([]byte(output[0]), &profile)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to determine profile of volume name: %v", volume)
+	}
+	if profile.OpRet != 0 {
+		return nil, fmt.Errorf("Unable to get profile of volume name: %v: %v",
+			volume, profile.OpErrStr)
+	}
+	return &profile.VolProfile, nil
+}
+
+// VolumeRestartBricks stops the brick processes with the given pids,
+// which must be bricks of the volume on the host, waits for them to
+// exit and has glusterd start them again with a forced volume start.
+// Without pids the bricks of the volume that are not running are only
+// started. The bricks of the volume on the other hosts are left running.
+func (s *CmdExecutor) VolumeRestartBricks(host string, volume string, pids []int) error {
+	godbc.Require(host != "")
+	godbc.Require(volume != "")
+
+	commands := []string{}
+	for _, pid := range pids {
+		commands = append(commands, fmt.Sprintf("kill %v", pid))
+	}
+	for _, pid := range pids {
+		commands = append(commands,
+			fmt.Sprintf("timeout 60 tail --pid=%v -f /dev/null", pid))
+	}
+	commands = append(commands,
+		fmt.Sprintf("gluster --mode=script volume start %v force", volume))
+
+	_, err := s.RemoteExecutor.RemoteCommandExecute(host, commands, 10)
+	if err != nil {
+		return s.Logger().Err(fmt.Errorf("Unable to restart bricks of volume %v: %v",
+			volume, err))
+	}
+	return nil
+}
+
+func (s *CmdExecutor) SnapshotCreate(host string, snapshot *executors.SnapshotRequest) error {
+	godbc.Require(host != "")
+	godbc.Require(snapshot != nil)
+	godbc.Require(snapshot.Name != "")
+	godbc.Require(snapshot.Volume != "")
+
+	// Keep the name as given instead of having gluster append a timestamp
+	command := []string{
+		fmt.Sprintf("gluster --mode=script snapshot create %v %v no-timestamp",
+			snapshot.Name, snapshot.Volume),
+	}
+	_, err := s.RemoteExecutor.RemoteCommandExecute(host, command, 10)
+	if err != nil {
+		return s.Logger().Err(fmt.Errorf("Unable to create snapshot %v of volume %v: %v",
+			snapshot.Name, snapshot.Volume, err))
+	}
+
+	return nil
+}
+
+func (s *CmdExecutor) SnapshotDestroy(host string, snapshot string) error {
+	godbc.Require(host != "")
+	godbc.Require(snapshot != "")
+
+	command := []string{
+		fmt.Sprintf("gluster --mode=script snapshot delete %v", snapshot),
+	}
+	_, err := s.RemoteExecutor.RemoteCommandExecute(host, command, 10)
+	if err != nil {
+		return s.Logger().Err(fmt.Errorf("Unable to delete snapshot %v: %v", snapshot, err))
+	}
+
+	return nil
+}
+
+// SnapshotList returns the names of the snapshots of the volume
+func (s *CmdExecutor) SnapshotList(host string, volume string) ([]string, error) {
+	godbc.Require(host != "")
+	godbc.Require(volume != "")
+
+	type CliOutput struct {
+		OpRet    int    `xml:"opRet"`
+		OpErrno  int    `xml:"opErrno"`
+		OpErrStr string `xml:"opErrstr"`
+		SnapList struct {
+			Snapshots []string `xml:"snapshot"`
+		} `xml:"snapList"`
+	}
+
+	command := []string{
+		fmt.Sprintf("gluster --mode=script snapshot list %v --xml", volume),
+	}
+	output, err := s.RemoteExecutor.RemoteCommandExecute(host, command, 10)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to list snapshots of volume %v: %v", volume, err)
+	}
+
+	var snapList CliOutput
+	err = xml.Unmarshal([]byte(output[0]), &snapList)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to determine snapshots of volume %v: %v", volume, err)
+	}
+	if snapList.OpRet != 0 {
+		return nil, fmt.Errorf("Unable to list snapshots of volume %v: %v",
+			volume, snapList.OpErrStr)
+	}
+
+	snapshots := []string{}
+	for _, snapshot := range snapList.SnapList.Snapshots {
+		if snapshot = strings.TrimSpace(snapshot); snapshot != "" {
+			snapshots = append(snapshots, snapshot)
+		}
+	}
+	return snapshots, nil
+}
+
+// SnapshotClone creates and starts a new volume from the snapshot and
+// returns the gluster information of the new volume. The bricks of the
+// clone are thin LVs created by gluster in the thin pools of the bricks
+// of the origin volume.
+func (s *CmdExecutor) SnapshotClone(host string,
+	clone *executors.SnapshotCloneRequest) (*executors.Volume, error) {
+
+	godbc.Require(host != "")
+	godbc.Require(clone != nil)
+	godbc.Require(clone.Snapshot != "")
+	godbc.Require(clone.Volume != "")
+
+	// Only activated snapshots can be cloned
+	command := []string{
+		fmt.Sprintf("gluster --mode=script snapshot activate %v", clone.Snapshot),
+	}
+	_, err := s.RemoteExecutor.RemoteCommandExecute(host, command, 10)
+	if err != nil {
+		// the snapshot may already be activated
+		s.Logger().Warning("Unable to activate snapshot %v: %v", clone.Snapshot, err)
+	}
+
+	command = []string{
+		fmt.Sprintf("gluster --mode=script snapshot clone %v %v",
+			clone.Volume, clone.Snapshot),
+	}
+	_, err = s.RemoteExecutor.RemoteCommandExecute(host, command, 10)
+	if err != nil {
+		return nil, s.Logger().Err(fmt.Errorf("Unable to clone snapshot %v to volume %v: %v",
+			clone.Snapshot, clone.Volume, err))
+	}
+
+	command = []string{
+		fmt.Sprintf("gluster --mode=script snapshot deactivate %v", clone.Snapshot),
+	}
+	_, err = s.RemoteExecutor.RemoteCommandExecute(host, command, 10)
+	if err != nil {
+		s.Logger().Warning("Unable to deactivate snapshot %v: %v", clone.Snapshot, err)
+	}
+
+	command = []string{
+		fmt.Sprintf("gluster --mode=script volume start %v", clone.Volume),
+	}
+	_, err = s.RemoteExecutor.RemoteCommandExecute(host, command, 10)
+	if err != nil {
+		return nil, s.Logger().Err(fmt.Errorf("Unable to start volume %v: %v",
+			clone.Volume, err))
+	}
+
+	return s.VolumeInfo(host, clone.Volume)
+}
+
+func (s *CmdExecutor) SnapshotRestore(host string, snapshot string) error {
+	godbc.Require(host != "")
+	godbc.Require(snapshot != "")
+
+	command := []string{
+		fmt.Sprintf("gluster --mode=script snapshot restore %v", snapshot),
+	}
+	_, err := s.RemoteExecutor.RemoteCommandExecute(host, command, 10)
+	if err != nil {
+		return s.Logger().Err(fmt.Errorf("Unable to restore snapshot %v: %v", snapshot, err))
+	}
+
+	return nil
+}
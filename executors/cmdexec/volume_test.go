@@ -0,0 +1,506 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package cmdexec
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/heketi/heketi/executors"
+	"github.com/heketi/tests"
+)
+
+func TestSshExecVolumeStatus(t *testing.T) {
+	f := NewCommandFaker()
+	s, err := NewFakeExecutor(f)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, s != nil)
+
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+
+		tests.Assert(t, host == "host:22", host)
+		tests.Assert(t, len(commands) == 1)
+		tests.Assert(t,
+			commands[0] == "gluster --mode=script volume status vol1 clients --xml",
+			commands)
+
+		return []string{`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<cliOutput>
+  <opRet>0</opRet>
+  <opErrno>0</opErrno>
+  <opErrstr/>
+  <volStatus>
+    <volumes>
+      <volume>
+        <volName>vol1</volName>
+        <nodeCount>2</nodeCount>
+        <node>
+          <hostname>192.168.10.100</hostname>
+          <path>/var/lib/heketi/mounts/vg_1/brick_1/brick</path>
+          <peerid>b6d8cd9d-b7b1-4c4d-8a6b-e4d2ee6bd1b5</peerid>
+          <status>1</status>
+          <port>49152</port>
+          <pid>1234</pid>
+          <clientsStatus>
+            <clientCount>2</clientCount>
+          </clientsStatus>
+        </node>
+        <node>
+          <hostname>192.168.10.101</hostname>
+          <path>/var/lib/heketi/mounts/vg_2/brick_2/brick</path>
+          <peerid>5e0a6a5e-2ad3-4e08-a5a5-4ac0bd1b6a0c</peerid>
+          <status>0</status>
+          <port>N/A</port>
+          <pid>-1</pid>
+          <clientsStatus>
+            <clientCount>0</clientCount>
+          </clientsStatus>
+        </node>
+      </volume>
+    </volumes>
+  </volStatus>
+</cliOutput>`}, nil
+	}
+
+	status, err := s.VolumeStatus("host", "vol1")
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, status.VolName == "vol1", status.VolName)
+	tests.Assert(t, len(status.Bricks) == 2, status.Bricks)
+	tests.Assert(t, status.Bricks[0].Status == 1)
+	tests.Assert(t, status.Bricks[0].ClientsStatus.ClientCount == 2)
+	tests.Assert(t, status.Bricks[1].Status == 0)
+	tests.Assert(t, status.Bricks[1].ClientsStatus.ClientCount == 0)
+
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+		return nil, errors.New("Volume vol1 is not started")
+	}
+
+	_, err = s.VolumeStatus("host", "vol1")
+	tests.Assert(t, err != nil)
+}
+
+func TestSshExecSnapshotRestore(t *testing.T) {
+	f := NewCommandFaker()
+	s, err := NewFakeExecutor(f)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, s != nil)
+
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+
+		tests.Assert(t, host == "host:22", host)
+		tests.Assert(t, len(commands) == 1)
+		tests.Assert(t,
+			commands[0] == "gluster --mode=script snapshot restore snap1",
+			commands)
+
+		return nil, nil
+	}
+
+	err = s.SnapshotRestore("host", "snap1")
+	tests.Assert(t, err == nil, err)
+}
+
+func TestSshExecSnapshotCreateDestroy(t *testing.T) {
+	f := NewCommandFaker()
+	s, err := NewFakeExecutor(f)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, s != nil)
+
+	var command string
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+
+		tests.Assert(t, len(commands) == 1, commands)
+		command = commands[0]
+		return []string{""}, nil
+	}
+
+	err = s.SnapshotCreate("host", &executors.SnapshotRequest{
+		Volume: "vol1",
+		Name:   "snap1",
+	})
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t,
+		command == "gluster --mode=script snapshot create snap1 vol1 no-timestamp",
+		command)
+
+	err = s.SnapshotDestroy("host", "snap1")
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, command == "gluster --mode=script snapshot delete snap1",
+		command)
+}
+
+func TestSshExecSnapshotList(t *testing.T) {
+	f := NewCommandFaker()
+	s, err := NewFakeExecutor(f)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, s != nil)
+
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+
+		tests.Assert(t, len(commands) == 1, commands)
+		tests.Assert(t,
+			commands[0] == "gluster --mode=script snapshot list vol1 --xml",
+			commands)
+		return []string{`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<cliOutput>
+  <opRet>0</opRet>
+  <opErrno>0</opErrno>
+  <opErrstr/>
+  <snapList>
+    <count>2</count>
+    <snapshot>snap1</snapshot>
+    <snapshot>snap2</snapshot>
+  </snapList>
+</cliOutput>`}, nil
+	}
+
+	snapshots, err := s.SnapshotList("host", "vol1")
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, len(snapshots) == 2, snapshots)
+	tests.Assert(t, snapshots[0] == "snap1" && snapshots[1] == "snap2", snapshots)
+
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+
+		return []string{`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<cliOutput>
+  <opRet>-1</opRet>
+  <opErrno>30800</opErrno>
+  <opErrstr>Volume (vol1) does not exist</opErrstr>
+</cliOutput>`}, nil
+	}
+	_, err = s.SnapshotList("host", "vol1")
+	tests.Assert(t, err != nil)
+}
+
+func TestSshExecSnapshotClone(t *testing.T) {
+	f := NewCommandFaker()
+	s, err := NewFakeExecutor(f)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, s != nil)
+
+	executed := []string{}
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+
+		tests.Assert(t, len(commands) == 1, commands)
+		executed = append(executed, commands[0])
+		if strings.Contains(commands[0], "volume info") {
+			return []string{`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<cliOutput>
+  <opRet>0</opRet>
+  <opErrno>0</opErrno>
+  <opErrstr/>
+  <volInfo>
+    <volumes>
+      <volume>
+        <name>clone1</name>
+        <id>d2ae2b32-7a05-4b25-8f3a-9e1dbfa1a4c4</id>
+        <bricks>
+          <brick uuid="a1">host1:/run/gluster/snaps/d2ae2b32/brick1/brick<name>host1:/run/gluster/snaps/d2ae2b32/brick1/brick</name><hostUuid>a1</hostUuid><isArbiter>0</isArbiter></brick>
+        </bricks>
+      </volume>
+    </volumes>
+  </volInfo>
+</cliOutput>`}, nil
+		}
+		return []string{""}, nil
+	}
+
+	vol, err := s.SnapshotClone("host", &executors.SnapshotCloneRequest{
+		Snapshot: "snap1",
+		Volume:   "clone1",
+	})
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, vol.VolumeName == "clone1", vol)
+	tests.Assert(t, len(vol.Bricks.BrickList) == 1, vol.Bricks)
+	tests.Assert(t, vol.Bricks.BrickList[0].Name ==
+		"host1:/run/gluster/snaps/d2ae2b32/brick1/brick", vol.Bricks)
+	tests.Assert(t, len(executed) == 5, executed)
+	tests.Assert(t,
+		executed[0] == "gluster --mode=script snapshot activate snap1",
+		executed)
+	tests.Assert(t,
+		executed[1] == "gluster --mode=script snapshot clone clone1 snap1",
+		executed)
+	tests.Assert(t,
+		executed[2] == "gluster --mode=script snapshot deactivate snap1",
+		executed)
+	tests.Assert(t,
+		executed[3] == "gluster --mode=script volume start clone1",
+		executed)
+
+	// Failing to clone the snapshot is an error
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+
+		if strings.Contains(commands[0], "snapshot clone") {
+			return nil, errors.New("Clone failed")
+		}
+		return []string{""}, nil
+	}
+	_, err = s.SnapshotClone("host", &executors.SnapshotCloneRequest{
+		Snapshot: "snap1",
+		Volume:   "clone1",
+	})
+	tests.Assert(t, err != nil)
+}
+
+func TestSshExecVolumeSetOptions(t *testing.T) {
+	f := NewCommandFaker()
+	s, err := NewFakeExecutor(f)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, s != nil)
+
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+
+		tests.Assert(t, len(commands) == 2, commands)
+		tests.Assert(t,
+			commands[0] == "gluster --mode=script volume set vol1 performance.rda-cache-limit 10MB",
+			commands)
+		tests.Assert(t,
+			commands[1] == "gluster --mode=script volume set vol1 server.tcp-user-timeout 42",
+			commands)
+		return []string{"", ""}, nil
+	}
+
+	err = s.VolumeSetOptions("host", "vol1", []string{
+		"performance.rda-cache-limit 10MB",
+		"",
+		"server.tcp-user-timeout 42",
+	})
+	tests.Assert(t, err == nil, err)
+}
+
+func TestSshExecVolumeResetOptions(t *testing.T) {
+	f := NewCommandFaker()
+	s, err := NewFakeExecutor(f)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, s != nil)
+
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+
+		tests.Assert(t, len(commands) == 1, commands)
+		tests.Assert(t,
+			commands[0] == "gluster --mode=script volume reset vol1 performance.cache-size",
+			commands)
+		return []string{""}, nil
+	}
+
+	err = s.VolumeResetOptions("host", "vol1", []string{
+		"performance.cache-size",
+		"",
+	})
+	tests.Assert(t, err == nil, err)
+}
+
+func TestSshExecVolumeIOCheck(t *testing.T) {
+	f := NewCommandFaker()
+	s, err := NewFakeExecutor(f)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, s != nil)
+
+	content := "heketi canary vol1"
+	unmounted := false
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+
+		if len(commands) == 1 {
+			if commands[0] == "umount /var/lib/heketi/canary/vol1" {
+				unmounted = true
+			}
+			return []string{""}, nil
+		}
+
+		tests.Assert(t, len(commands) == 4, commands)
+		tests.Assert(t,
+			commands[1] == "mount -t glusterfs localhost:/vol1 /var/lib/heketi/canary/vol1",
+			commands)
+		tests.Assert(t,
+			commands[3] == "cat /var/lib/heketi/canary/vol1/canary",
+			commands)
+		return []string{"", "", "", content + "\n"}, nil
+	}
+
+	err = s.VolumeIOCheck("host", "vol1")
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, unmounted)
+
+	// Content that does not match is an error
+	unmounted = false
+	content = "garbage"
+	err = s.VolumeIOCheck("host", "vol1")
+	tests.Assert(t, err != nil)
+	tests.Assert(t, unmounted)
+
+	// The volume is unmounted when the commands fail
+	unmounted = false
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+
+		if len(commands) == 1 {
+			if commands[0] == "umount /var/lib/heketi/canary/vol1" {
+				unmounted = true
+			}
+			return []string{""}, nil
+		}
+		return nil, errors.New("mount failed")
+	}
+	err = s.VolumeIOCheck("host", "vol1")
+	tests.Assert(t, err != nil)
+	tests.Assert(t, unmounted)
+}
+
+func TestSshExecVolumeProfileInfo(t *testing.T) {
+	f := NewCommandFaker()
+	s, err := NewFakeExecutor(f)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, s != nil)
+
+	output := `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<cliOutput>
+  <opRet>0</opRet>
+  <opErrno>0</opErrno>
+  <opErrstr/>
+  <volProfile>
+    <volname>vol1</volname>
+    <profileOp>3</profileOp>
+    <brickCount>2</brickCount>
+    <brick>
+      <brickName>host1:/bricks/b1</brickName>
+      <cumulativeStats>
+        <fopStats>
+          <fop>
+            <name>WRITE</name>
+            <hits>12</hits>
+            <avgLatency>100.5</avgLatency>
+            <minLatency>10.0</minLatency>
+            <maxLatency>200.0</maxLatency>
+          </fop>
+          <fop>
+            <name>READ</name>
+            <hits>3</hits>
+            <avgLatency>50.0</avgLatency>
+            <minLatency>10.0</minLatency>
+            <maxLatency>90.0</maxLatency>
+          </fop>
+        </fopStats>
+        <duration>600</duration>
+        <totalRead>4096</totalRead>
+        <totalWrite>8192</totalWrite>
+      </cumulativeStats>
+    </brick>
+    <brick>
+      <brickName>host2:/bricks/b2</brickName>
+      <cumulativeStats>
+        <duration>600</duration>
+        <totalRead>0</totalRead>
+        <totalWrite>8192</totalWrite>
+      </cumulativeStats>
+    </brick>
+  </volProfile>
+</cliOutput>`
+
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+
+		tests.Assert(t, len(commands) == 1, commands)
+		tests.Assert(t,
+			commands[0] == "gluster --mode=script volume profile vol1 info cumulative --xml",
+			commands)
+		return []string{output}, nil
+	}
+
+	profile, err := s.VolumeProfileInfo("host", "vol1")
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, profile.VolName == "vol1")
+	tests.Assert(t, len(profile.Bricks) == 2, profile.Bricks)
+	b := profile.Bricks[0]
+	tests.Assert(t, b.BrickName == "host1:/bricks/b1")
+	tests.Assert(t, b.CumulativeStats.Duration == 600)
+	tests.Assert(t, b.CumulativeStats.TotalRead == 4096)
+	tests.Assert(t, b.CumulativeStats.TotalWrite == 8192)
+	tests.Assert(t, len(b.CumulativeStats.Fops) == 2)
+	tests.Assert(t, b.CumulativeStats.Fops[0].Name == "WRITE")
+	tests.Assert(t, b.CumulativeStats.Fops[0].Hits == 12)
+	tests.Assert(t, len(profile.Bricks[1].CumulativeStats.Fops) == 0)
+
+	// Profiling not started on the volume
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+
+		return nil, errors.New("Profile on Volume vol1 is not started")
+	}
+	_, err = s.VolumeProfileInfo("host", "vol1")
+	tests.Assert(t, err != nil)
+}
+
+func TestSshExecVolumeRestartBricks(t *testing.T) {
+	f := NewCommandFaker()
+	s, err := NewFakeExecutor(f)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, s != nil)
+
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+
+		tests.Assert(t, len(commands) == 5, commands)
+		tests.Assert(t, commands[0] == "kill 1234", commands)
+		tests.Assert(t, commands[1] == "kill 1235", commands)
+		tests.Assert(t,
+			commands[2] == "timeout 60 tail --pid=1234 -f /dev/null", commands)
+		tests.Assert(t,
+			commands[3] == "timeout 60 tail --pid=1235 -f /dev/null", commands)
+		tests.Assert(t,
+			commands[4] == "gluster --mode=script volume start vol1 force", commands)
+		return []string{"", "", "", "", ""}, nil
+	}
+
+	err = s.VolumeRestartBricks("host", "vol1", []int{1234, 1235})
+	tests.Assert(t, err == nil, err)
+}
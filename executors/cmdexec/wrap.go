@@ -0,0 +1,119 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package cmdexec
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Classes of expensive commands that can be run with a lower
+// cpu and io priority on the nodes.
+const (
+	// Creation of the file system of a brick
+	CommandClassFormat = "format"
+)
+
+var (
+	commandClasses = map[string]bool{
+		CommandClassFormat: true,
+	}
+	sliceNameRe = regexp.MustCompile(`^[A-Za-z0-9_.:@-]+$`)
+)
+
+// CommandWrapper describes how the commands of a class are run.
+// Zero values leave the corresponding setting untouched.
+type CommandWrapper struct {
+	// Niceness, from -20 to 19
+	Nice int `json:"nice"`
+
+	// IO scheduling class: 1 realtime, 2 best-effort, 3 idle
+	IoniceClass int `json:"ionice_class"`
+
+	// IO priority within the best-effort and realtime classes, 0 to 7
+	IoniceLevel int `json:"ionice_level"`
+
+	// Systemd slice the command is run in using systemd-run
+	Slice string `json:"systemd_slice"`
+}
+
+// Validate checks the values of the wrapper
+func (w CommandWrapper) Validate() error {
+	if w.Nice < -20 || w.Nice > 19 {
+		return fmt.Errorf("Invalid nice value: %v", w.Nice)
+	}
+	if w.IoniceClass < 0 || w.IoniceClass > 3 {
+		return fmt.Errorf("Invalid ionice class: %v", w.IoniceClass)
+	}
+	if w.IoniceLevel < 0 || w.IoniceLevel > 7 {
+		return fmt.Errorf("Invalid ionice level: %v", w.IoniceLevel)
+	}
+	if w.IoniceLevel != 0 && (w.IoniceClass == 0 || w.IoniceClass == 3) {
+		return fmt.Errorf("ionice level requires the realtime or best-effort class")
+	}
+	if w.Slice != "" && !sliceNameRe.MatchString(w.Slice) {
+		return fmt.Errorf("Invalid systemd slice: %v", w.Slice)
+	}
+	return nil
+}
+
+// Wrap returns the command prefixed with the systemd-run, nice and
+// ionice invocations configured in the wrapper.
+func (w CommandWrapper) Wrap(command string) string {
+	prefix := []string{}
+	if w.Slice != "" {
+		prefix = append(prefix,
+			fmt.Sprintf("systemd-run --scope --quiet --slice=%v", w.Slice))
+	}
+	if w.Nice != 0 {
+		prefix = append(prefix, fmt.Sprintf("nice -n %v", w.Nice))
+	}
+	if w.IoniceClass != 0 {
+		ionice := fmt.Sprintf("ionice -c %v", w.IoniceClass)
+		if w.IoniceClass != 3 {
+			ionice += fmt.Sprintf(" -n %v", w.IoniceLevel)
+		}
+		prefix = append(prefix, ionice)
+	}
+	if len(prefix) == 0 {
+		return command
+	}
+	return strings.Join(prefix, " ") + " " + command
+}
+
+// SetCommandWrappers sets how the commands of each class are run
+func (s *CmdExecutor) SetCommandWrappers(wrappers map[string]CommandWrapper) error {
+	for class, w := range wrappers {
+		if !commandClasses[class] {
+			return fmt.Errorf("Unknown command class: %v", class)
+		}
+		if err := w.Validate(); err != nil {
+			return fmt.Errorf("Command class %v: %v", class, err)
+		}
+	}
+
+	s.Lock.Lock()
+	defer s.Lock.Unlock()
+	s.commandWrappers = wrappers
+	return nil
+}
+
+// wrapCommand applies the wrapper configured for the class to the command
+func (s *CmdExecutor) wrapCommand(class, command string) string {
+	s.Lock.Lock()
+	w, ok := s.commandWrappers[class]
+	s.Lock.Unlock()
+
+	if !ok {
+		return command
+	}
+	return w.Wrap(command)
+}
@@ -0,0 +1,100 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package cmdexec
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/heketi/heketi/executors"
+	"github.com/heketi/heketi/pkg/utils"
+	"github.com/heketi/tests"
+)
+
+func TestCommandWrapperWrap(t *testing.T) {
+	w := CommandWrapper{}
+	tests.Assert(t, w.Validate() == nil)
+	tests.Assert(t, w.Wrap("mkfs.xfs /dev/x") == "mkfs.xfs /dev/x")
+
+	w = CommandWrapper{Nice: 10, IoniceClass: 2, IoniceLevel: 7}
+	tests.Assert(t, w.Validate() == nil)
+	tests.Assert(t, w.Wrap("mkfs.xfs /dev/x") ==
+		"nice -n 10 ionice -c 2 -n 7 mkfs.xfs /dev/x", w.Wrap("mkfs.xfs /dev/x"))
+
+	w = CommandWrapper{IoniceClass: 3, Slice: "heketi.slice"}
+	tests.Assert(t, w.Validate() == nil)
+	tests.Assert(t, w.Wrap("mkfs.xfs /dev/x") ==
+		"systemd-run --scope --quiet --slice=heketi.slice "+
+			"ionice -c 3 mkfs.xfs /dev/x", w.Wrap("mkfs.xfs /dev/x"))
+
+	for _, w := range []CommandWrapper{
+		CommandWrapper{Nice: 20},
+		CommandWrapper{Nice: -21},
+		CommandWrapper{IoniceClass: 4},
+		CommandWrapper{IoniceClass: 2, IoniceLevel: 8},
+		CommandWrapper{IoniceClass: 3, IoniceLevel: 1},
+		CommandWrapper{IoniceLevel: 1},
+		CommandWrapper{Slice: "a slice"},
+	} {
+		tests.Assert(t, w.Validate() != nil, w)
+	}
+}
+
+func TestCmdExecSetCommandWrappers(t *testing.T) {
+	f := NewCommandFaker()
+	s, err := NewFakeExecutor(f)
+	tests.Assert(t, err == nil)
+
+	err = s.SetCommandWrappers(map[string]CommandWrapper{
+		"unknown": CommandWrapper{Nice: 10},
+	})
+	tests.Assert(t, err != nil)
+
+	err = s.SetCommandWrappers(map[string]CommandWrapper{
+		CommandClassFormat: CommandWrapper{Nice: 100},
+	})
+	tests.Assert(t, err != nil)
+
+	err = s.SetCommandWrappers(map[string]CommandWrapper{
+		CommandClassFormat: CommandWrapper{Nice: 19, IoniceClass: 3},
+	})
+	tests.Assert(t, err == nil, err)
+
+	b := &executors.BrickRequest{
+		VgId:             "xvgid",
+		Name:             "id",
+		TpSize:           100,
+		Size:             10,
+		PoolMetadataSize: 5,
+		Path:             utils.BrickPath("xvgid", "id"),
+	}
+
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+
+		for _, cmd := range commands {
+			cmd = strings.Trim(cmd, " ")
+			if strings.Contains(cmd, "mkfs.xfs") {
+				tests.Assert(t,
+					cmd == "nice -n 19 ionice -c 3 mkfs.xfs -i size=512 "+
+						"-n size=8192 /dev/mapper/vg_xvgid-brick_id", cmd)
+			} else {
+				tests.Assert(t, !strings.HasPrefix(cmd, "nice"), cmd)
+			}
+		}
+
+		return nil, nil
+	}
+
+	_, err = s.BrickCreate("myhost", b)
+	tests.Assert(t, err == nil, err)
+}
@@ -15,9 +15,14 @@ type Executor interface {
 	GlusterdCheck(host string) error
 	PeerProbe(exec_host, newnode string) error
 	PeerDetach(exec_host, detachnode string) error
+	PeerStatus(host string) (*PeerStatus, error)
+	ClusterOptions(host string) (*ClusterOptions, error)
+	ClusterSetOptions(host string, options []string) error
 	DeviceSetup(host, device, vgid string) (*DeviceInfo, error)
 	GetDeviceInfo(host, device, vgid string) (*DeviceInfo, error)
 	DeviceTeardown(host, device, vgid string) error
+	GetDeviceSnapshotUsage(host, vgid string) ([]ThinPoolUsage, error)
+	GetDeviceLvs(host, vgid string) ([]LvInfo, error)
 	BrickCreate(host string, brick *BrickRequest) (*BrickInfo, error)
 	BrickDestroy(host string, brick *BrickRequest) error
 	BrickDestroyCheck(host string, brick *BrickRequest) error
@@ -28,9 +33,95 @@ type Executor interface {
 	VolumeReplaceBrick(host string, volume string, oldBrick *BrickInfo, newBrick *BrickInfo) error
 	VolumeInfo(host string, volume string) (*Volume, error)
 	HealInfo(host string, volume string) (*HealInfo, error)
+	VolumeStart(host string, volume string) error
+	VolumeStop(host string, volume string) error
+	VolumeSetOptions(host string, volume string, options []string) error
+	VolumeSetQuota(host string, quota *VolumeQuotaRequest) error
+	VolumeResetOptions(host string, volume string, options []string) error
+	VolumeIOCheck(host string, volume string) error
+	VolumeStatus(host string, volume string) (*VolumeStatus, error)
+	VolumeProfileInfo(host string, volume string) (*VolumeProfile, error)
+	VolumeRestartBricks(host string, volume string, pids []int) error
+	SnapshotCreate(host string, snapshot *SnapshotRequest) error
+	SnapshotDestroy(host string, snapshot string) error
+	SnapshotList(host string, volume string) ([]string, error)
+	SnapshotRestore(host string, snapshot string) error
+	SnapshotClone(host string, clone *SnapshotCloneRequest) (*Volume, error)
+	GeoReplicationCreate(host string, session *GeoReplicationRequest) error
+	GeoReplicationAction(host string, session *GeoReplicationRequest, action string, force bool) error
 	SetLogLevel(level string)
 	BlockVolumeCreate(host string, blockVolume *BlockVolumeRequest) (*BlockVolumeInfo, error)
 	BlockVolumeDestroy(host string, blockHostingVolumeName string, blockVolumeName string) error
+	BlockVolumeList(host string, blockHostingVolumeName string) ([]string, error)
+	BlockVolumeInfo(host string, blockHostingVolumeName string, blockVolumeName string) (*BlockVolumeInfo, error)
+	BlockVolumeExpand(host string, blockHostingVolumeName string, blockVolumeName string, newSize int) error
+	BlockVolumeAuthRotate(host string, blockHostingVolumeName string, blockVolumeName string) (*BlockVolumeInfo, error)
+	BlockVolumeModifyHa(host string, blockHostingVolumeName string, blockVolumeName string, hacount int, blockHosts []string) error
+	BlockVolumeClone(host string, clone *BlockVolumeCloneRequest) (*BlockVolumeInfo, error)
+}
+
+// HostClusterMapper is implemented by executors that apply settings
+// per cluster and need to know the cluster each host belongs to.
+type HostClusterMapper interface {
+	SetHostCluster(host, cluster string)
+}
+
+// RequestScoper is implemented by executors that tag the messages logged
+// for the commands with the id of the request they are run for.
+type RequestScoper interface {
+	// WithRequestId returns an executor running the commands like the
+	// executor, logging them with the id of the request
+	WithRequestId(id string) Executor
+}
+
+// HostResolution is the result of resolving the hostname of a
+// node before connecting to it.
+type HostResolution struct {
+	// Hostname resolved, the registered one or one of its alternates
+	Hostname string
+
+	// Address the hostname resolved to
+	Address string
+
+	// Set when none of the hostnames could be resolved
+	Error error
+}
+
+// HostResolver is implemented by executors that resolve the hostnames
+// of the nodes before connecting to them.
+type HostResolver interface {
+	// SetHostAlternates sets the hostnames tried in order when the
+	// host can not be resolved
+	SetHostAlternates(host string, alternates []string)
+
+	// SetResolutionHandler sets the function called when the address
+	// of a host changes, an alternate is used or the resolution fails
+	SetResolutionHandler(handler func(host string, r HostResolution))
+}
+
+// CommandOutput is the output of a command that failed on a node
+type CommandOutput struct {
+	Id      string
+	Host    string
+	Command string
+	Stdout  string
+	Stderr  string
+
+	// Error the command failed with
+	Error string
+
+	// Set when the beginning of the stdout or stderr of the command
+	// was cut to the capture size
+	Truncated bool
+}
+
+// CommandOutputRecorder is implemented by executors that keep the
+// output of the commands that failed.
+type CommandOutputRecorder interface {
+	// SetCommandOutputHandler sets the function called with the output
+	// of every command that failed. The error of the command refers to
+	// the output by its id.
+	SetCommandOutputHandler(handler func(o *CommandOutput))
 }
 
 // Enumerate durability types
@@ -47,6 +138,34 @@ type DeviceInfo struct {
 	// Size in KB
 	Size       uint64
 	ExtentSize uint64
+	// Size of the volume group in KB
+	TotalSize   uint64
+	FreeExtents uint64
+}
+
+// Logical volume of a device. Size is in KB.
+type LvInfo struct {
+	Name     string
+	ThinPool string
+	Size     uint64
+}
+
+// Returns the space used in a brick's thin pool. Sizes are in KB.
+type ThinPoolUsage struct {
+	ThinPool  string
+	Size      uint64
+	Used      uint64
+	BrickUsed uint64
+	Snapshots int
+}
+
+// SnapshotUsed returns the space of the thin pool that is held by
+// snapshots rather than by the brick itself.
+func (t *ThinPoolUsage) SnapshotUsed() uint64 {
+	if t.Snapshots == 0 || t.Used < t.BrickUsed {
+		return 0
+	}
+	return t.Used - t.BrickUsed
 }
 
 // Brick description
@@ -57,6 +176,13 @@ type BrickRequest struct {
 	Size             uint64
 	PoolMetadataSize uint64
 	Gid              int64
+	Uid              int64
+	Permissions      string
+	SelinuxContext   string
+	// Check the brick root got the SELinux context and turn on the
+	// SELinux booleans, on hosts with SELinux enabled
+	SelinuxCheck    bool
+	SelinuxBooleans []string
 	// Path is the brick mountpoint (named Path for symmetry with BrickInfo)
 	Path string
 }
@@ -67,12 +193,60 @@ type BrickInfo struct {
 	Host string
 }
 
+// SnapshotRequest describes a snapshot of a volume to create
+type SnapshotRequest struct {
+	Volume string
+	Name   string
+}
+
+// SnapshotCloneRequest describes a new volume to clone from a snapshot
+type SnapshotCloneRequest struct {
+	Snapshot string
+	Volume   string
+}
+
+// GeoReplicationRequest describes the geo-replication session of a
+// primary volume to a secondary volume on another cluster
+type GeoReplicationRequest struct {
+	PrimaryVolume   string
+	SecondaryHost   string
+	SecondaryVolume string
+}
+
+// Actions on a geo-replication session
+const (
+	GeoReplicationStart  = "start"
+	GeoReplicationStop   = "stop"
+	GeoReplicationDelete = "delete"
+)
+
+// QuotaLimit is the hard limit of the usage of a directory of a volume
+type QuotaLimit struct {
+	Path         string
+	HardLimitMiB int
+}
+
+// VolumeQuotaRequest describes the changes of the quota of a volume.
+// Disabling the quota removes all the limits of the volume.
+type VolumeQuotaRequest struct {
+	Volume  string
+	Enable  bool
+	Disable bool
+	// Limits to set, replacing the limits of the same directories
+	Limits []QuotaLimit
+	// Directories whose limits are removed
+	Remove []string
+}
+
 type VolumeRequest struct {
 	Bricks               []BrickInfo
 	Name                 string
 	Type                 DurabilityType
 	GlusterVolumeOptions []string
 
+	// Quota set once the volume is started, none if nil
+	Quota *VolumeQuotaRequest
+
 	// Dispersion
 	Data       int
 	Redundancy int
@@ -151,9 +325,90 @@ type HealInfo struct {
 	Bricks  HealInfoBricks `xml:"bricks"`
 }
 
+type BrickClientsStatus struct {
+	ClientCount int `xml:"clientCount"`
+}
+
+type BrickStatus struct {
+	Hostname      string             `xml:"hostname"`
+	Path          string             `xml:"path"`
+	PeerId        string             `xml:"peerid"`
+	Status        int                `xml:"status"`
+	Port          string             `xml:"port"`
+	Pid           int                `xml:"pid"`
+	ClientsStatus BrickClientsStatus `xml:"clientsStatus"`
+}
+
+type VolumeStatus struct {
+	XMLName   xml.Name      `xml:"volume"`
+	VolName   string        `xml:"volName"`
+	NodeCount int           `xml:"nodeCount"`
+	Bricks    []BrickStatus `xml:"node"`
+}
+
+type VolumeStatusVolumes struct {
+	VolumeList []VolumeStatus `xml:"volume"`
+}
+
+type VolStatus struct {
+	XMLName xml.Name            `xml:"volStatus"`
+	Volumes VolumeStatusVolumes `xml:"volumes"`
+}
+
+type ProfileFopStats struct {
+	Name string `xml:"name"`
+	Hits uint64 `xml:"hits"`
+}
+
+type ProfileStats struct {
+	Duration   uint64            `xml:"duration"`
+	TotalRead  uint64            `xml:"totalRead"`
+	TotalWrite uint64            `xml:"totalWrite"`
+	Fops       []ProfileFopStats `xml:"fopStats>fop"`
+}
+
+type BrickProfile struct {
+	BrickName       string       `xml:"brickName"`
+	CumulativeStats ProfileStats `xml:"cumulativeStats"`
+}
+
+type VolumeProfile struct {
+	XMLName xml.Name       `xml:"volProfile"`
+	VolName string         `xml:"volname"`
+	Bricks  []BrickProfile `xml:"brick"`
+}
+
+type Peer struct {
+	Uuid      string   `xml:"uuid"`
+	Hostname  string   `xml:"hostname"`
+	Hostnames []string `xml:"hostnames>hostname"`
+	Connected int      `xml:"connected"`
+	State     int      `xml:"state"`
+	StateStr  string   `xml:"stateStr"`
+}
+
+type PeerStatus struct {
+	XMLName xml.Name `xml:"peerStatus"`
+	Peers   []Peer   `xml:"peer"`
+}
+
+// Option of the cluster as reported by gluster volume get all all
+type ClusterOption struct {
+	Name  string `xml:"Option"`
+	Value string `xml:"Value"`
+}
+
+type ClusterOptions struct {
+	XMLName xml.Name        `xml:"volGetopts"`
+	Options []ClusterOption `xml:"Opt"`
+}
+
 type BlockVolumeRequest struct {
-	Name              string
-	Size              int
+	Name string
+	// Size in GiB
+	Size int
+	// Size in MiB, used instead of Size if set
+	SizeMiB           int
 	GlusterVolumeName string
 	GlusterNode       string
 	Hacount           int
@@ -161,6 +416,14 @@ type BlockVolumeRequest struct {
 	Auth              bool
 }
 
+// BlockVolumeCloneRequest creates a block volume on the block hosting
+// volume of the source block volume with a copy of its data
+type BlockVolumeCloneRequest struct {
+	BlockVolumeRequest
+	// Name of the block volume the data is copied from
+	Source string
+}
+
 type BlockVolumeInfo struct {
 	Name              string
 	Size              int
@@ -171,4 +434,6 @@ type BlockVolumeInfo struct {
 	Iqn               string
 	Username          string
 	Password          string
+	// Id gluster-block names the file of the block volume after
+	Gbid string
 }
@@ -15,6 +15,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 
 	"k8s.io/apimachinery/pkg/apis/meta/v1"
 	restclient "k8s.io/client-go/rest"
@@ -24,6 +25,7 @@ import (
 	"k8s.io/kubernetes/pkg/client/unversioned/remotecommand"
 	kubeletcmd "k8s.io/kubernetes/pkg/kubelet/server/remotecommand"
 
+	"github.com/heketi/heketi/executors"
 	"github.com/heketi/heketi/executors/cmdexec"
 	"github.com/heketi/heketi/pkg/kubernetes"
 	"github.com/heketi/heketi/pkg/utils"
@@ -108,6 +110,7 @@ func NewKubeExecutor(config *KubeConfig) (*KubeExecutor, error) {
 	k := &KubeExecutor{}
 	k.config = config
 	k.Throttlemap = make(map[string]chan bool)
+	k.Lock = &sync.Mutex{}
 	k.RemoteExecutor = k
 
 	if k.config.Fstab == "" {
@@ -116,8 +119,20 @@ func NewKubeExecutor(config *KubeConfig) (*KubeExecutor, error) {
 		k.Fstab = config.Fstab
 	}
 
+	err := k.SetEnvironment(config.Environment, config.ClusterEnvironment)
+	if err != nil {
+		return nil, logger.LogError("Invalid executor environment: %v", err)
+	}
+	err = k.SetCommandWrappers(config.CommandWrappers)
+	if err != nil {
+		return nil, logger.LogError("Invalid command wrappers: %v", err)
+	}
+	err = k.SetCommandOutputSize(config.CommandOutputSize)
+	if err != nil {
+		return nil, logger.LogError("Invalid command output size: %v", err)
+	}
+
 	// Get namespace
-	var err error
 	if k.config.Namespace == "" {
 		k.config.Namespace, err = kubernetes.GetNamespace()
 		if err != nil {
@@ -161,10 +176,11 @@ func (k *KubeExecutor) RemoteCommandExecute(host string,
 	defer k.FreeConnection(host)
 
 	// Execute
-	return k.ConnectAndExec(host,
+	output, err := k.ConnectAndExec(host,
 		"pods",
-		commands,
+		k.PrepareCommands(host, commands),
 		timeoutMinutes)
+	return output, k.RecordCommandOutput(host, err)
 }
 
 func (k *KubeExecutor) ConnectAndExec(host, resource string,
@@ -193,7 +209,7 @@ func (k *KubeExecutor) ConnectAndExec(host, resource string,
 	// Get container name
 	podSpec, err := k.kube.Core().Pods(k.namespace).Get(podName, v1.GetOptions{})
 	if err != nil {
-		return nil, logger.LogError("Unable to get pod spec for %v: %v",
+		return nil, k.kubeLogger().LogError("Unable to get pod spec for %v: %v",
 			podName, err)
 	}
 	containerName := podSpec.Spec.Containers[0].Name
@@ -222,7 +238,7 @@ func (k *KubeExecutor) ConnectAndExec(host, resource string,
 		// Create SPDY connection
 		exec, err := remotecommand.NewExecutor(k.kubeConfig, "POST", req.URL())
 		if err != nil {
-			logger.Err(err)
+			k.kubeLogger().Err(err)
 			return nil, fmt.Errorf("Unable to setup a session with %v", podName)
 		}
 
@@ -237,11 +253,19 @@ func (k *KubeExecutor) ConnectAndExec(host, resource string,
 			Stderr:             &berr,
 		})
 		if err != nil {
-			logger.LogError("Failed to run command [%v] on %v: Err[%v]: Stdout [%v]: Stderr [%v]",
+			k.kubeLogger().LogError("Failed to run command [%v] on %v: Err[%v]: Stdout [%v]: Stderr [%v]",
 				command, podName, err, b.String(), berr.String())
-			return nil, fmt.Errorf("Unable to execute command on %v: %v", podName, berr.String())
+			return nil, &utils.CommandError{
+				Message: fmt.Sprintf("Unable to execute command on %v: %v",
+					podName, berr.String()),
+				Host:    host,
+				Command: command,
+				Stdout:  b.String(),
+				Stderr:  berr.String(),
+				Err:     err,
+			}
 		}
-		logger.Debug("Host: %v Pod: %v Command: %v\nResult: %v", host, podName, command, b.String())
+		k.kubeLogger().Debug("Host: %v Pod: %v Command: %v\nResult: %v", host, podName, command, b.String())
 		buffers[index] = b.String()
 
 	}
@@ -249,6 +273,22 @@ func (k *KubeExecutor) ConnectAndExec(host, resource string,
 	return buffers, nil
 }
 
+// WithRequestId returns a copy of the executor logging the commands run
+// for the request with the id. The copy shares the connections and the
+// environment with k.
+func (k *KubeExecutor) WithRequestId(id string) executors.Executor {
+	c := *k
+	c.CmdExecutor = k.CmdExecutor.ForRequest(id)
+	c.RemoteExecutor = &c
+	return &c
+}
+
+// kubeLogger returns the logger of the package tagging the messages
+// with the id of the request of the executor
+func (k *KubeExecutor) kubeLogger() *utils.Logger {
+	return logger.WithRequestId(k.RequestId())
+}
+
 func (k *KubeExecutor) RebalanceOnExpansion() bool {
 	return k.config.RebalanceOnExpansion
 }
@@ -263,7 +303,7 @@ func (k *KubeExecutor) getPodNameByLabel(host string) (string, error) {
 		LabelSelector: KubeGlusterFSPodLabelKey + "==" + host,
 	})
 	if err != nil {
-		logger.Err(err)
+		k.kubeLogger().Err(err)
 		return "", fmt.Errorf("Failed to get list of pods")
 	}
 
@@ -272,14 +312,14 @@ func (k *KubeExecutor) getPodNameByLabel(host string) (string, error) {
 		// No pods found with that label
 		err := fmt.Errorf("No pods with the label '%v=%v' were found",
 			KubeGlusterFSPodLabelKey, host)
-		logger.Critical(err.Error())
+		k.kubeLogger().Critical(err.Error())
 		return "", err
 
 	} else if numPods > 1 {
 		// There are more than one pod with the same label
 		err := fmt.Errorf("Found %v pods with the sharing the same label '%v=%v'",
 			numPods, KubeGlusterFSPodLabelKey, host)
-		logger.Critical(err.Error())
+		k.kubeLogger().Critical(err.Error())
 		return "", err
 	}
 
@@ -293,8 +333,8 @@ func (k *KubeExecutor) getPodNameFromDaemonSet(host string) (string, error) {
 		LabelSelector: KubeGlusterFSPodLabelKey,
 	})
 	if err != nil {
-		logger.Err(err)
-		return "", logger.LogError("Failed to get list of pods")
+		k.kubeLogger().Err(err)
+		return "", k.kubeLogger().LogError("Failed to get list of pods")
 	}
 
 	// Go through the pods looking for the node
@@ -305,7 +345,7 @@ func (k *KubeExecutor) getPodNameFromDaemonSet(host string) (string, error) {
 		}
 	}
 	if glusterPod == "" {
-		return "", logger.LogError("Unable to find a GlusterFS pod on host %v "+
+		return "", k.kubeLogger().LogError("Unable to find a GlusterFS pod on host %v "+
 			"with a label key %v", host, KubeGlusterFSPodLabelKey)
 	}
 
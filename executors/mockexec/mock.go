@@ -15,23 +15,50 @@ import (
 
 type MockExecutor struct {
 	// These functions can be overwritten for testing
-	MockGlusterdCheck      func(host string) error
-	MockPeerProbe          func(exec_host, newnode string) error
-	MockPeerDetach         func(exec_host, newnode string) error
-	MockDeviceSetup        func(host, device, vgid string) (*executors.DeviceInfo, error)
-	MockDeviceTeardown     func(host, device, vgid string) error
-	MockBrickCreate        func(host string, brick *executors.BrickRequest) (*executors.BrickInfo, error)
-	MockBrickDestroy       func(host string, brick *executors.BrickRequest) error
-	MockBrickDestroyCheck  func(host string, brick *executors.BrickRequest) error
-	MockVolumeCreate       func(host string, volume *executors.VolumeRequest) (*executors.Volume, error)
-	MockVolumeExpand       func(host string, volume *executors.VolumeRequest) (*executors.Volume, error)
-	MockVolumeDestroy      func(host string, volume string) error
-	MockVolumeDestroyCheck func(host, volume string) error
-	MockVolumeReplaceBrick func(host string, volume string, oldBrick *executors.BrickInfo, newBrick *executors.BrickInfo) error
-	MockVolumeInfo         func(host string, volume string) (*executors.Volume, error)
-	MockHealInfo           func(host string, volume string) (*executors.HealInfo, error)
-	MockBlockVolumeCreate  func(host string, blockVolume *executors.BlockVolumeRequest) (*executors.BlockVolumeInfo, error)
-	MockBlockVolumeDestroy func(host string, blockHostingVolumeName string, blockVolumeName string) error
+	MockGlusterdCheck         func(host string) error
+	MockPeerProbe             func(exec_host, newnode string) error
+	MockPeerDetach            func(exec_host, newnode string) error
+	MockPeerStatus            func(host string) (*executors.PeerStatus, error)
+	MockClusterOptions        func(host string) (*executors.ClusterOptions, error)
+	MockClusterSetOptions     func(host string, options []string) error
+	MockDeviceSetup           func(host, device, vgid string) (*executors.DeviceInfo, error)
+	MockDeviceTeardown        func(host, device, vgid string) error
+	MockDeviceSnapshotUsage   func(host, vgid string) ([]executors.ThinPoolUsage, error)
+	MockDeviceLvs             func(host, vgid string) ([]executors.LvInfo, error)
+	MockBrickCreate           func(host string, brick *executors.BrickRequest) (*executors.BrickInfo, error)
+	MockBrickDestroy          func(host string, brick *executors.BrickRequest) error
+	MockBrickDestroyCheck     func(host string, brick *executors.BrickRequest) error
+	MockVolumeCreate          func(host string, volume *executors.VolumeRequest) (*executors.Volume, error)
+	MockVolumeExpand          func(host string, volume *executors.VolumeRequest) (*executors.Volume, error)
+	MockVolumeDestroy         func(host string, volume string) error
+	MockVolumeDestroyCheck    func(host, volume string) error
+	MockVolumeReplaceBrick    func(host string, volume string, oldBrick *executors.BrickInfo, newBrick *executors.BrickInfo) error
+	MockVolumeInfo            func(host string, volume string) (*executors.Volume, error)
+	MockHealInfo              func(host string, volume string) (*executors.HealInfo, error)
+	MockVolumeStart           func(host string, volume string) error
+	MockVolumeStop            func(host string, volume string) error
+	MockVolumeSetOptions      func(host string, volume string, options []string) error
+	MockVolumeSetQuota        func(host string, quota *executors.VolumeQuotaRequest) error
+	MockVolumeResetOptions    func(host string, volume string, options []string) error
+	MockVolumeIOCheck         func(host string, volume string) error
+	MockVolumeStatus          func(host string, volume string) (*executors.VolumeStatus, error)
+	MockVolumeProfileInfo     func(host string, volume string) (*executors.VolumeProfile, error)
+	MockVolumeRestartBricks   func(host string, volume string, pids []int) error
+	MockSnapshotCreate        func(host string, snapshot *executors.SnapshotRequest) error
+	MockSnapshotDestroy       func(host string, snapshot string) error
+	MockSnapshotList          func(host string, volume string) ([]string, error)
+	MockSnapshotRestore       func(host string, snapshot string) error
+	MockSnapshotClone         func(host string, clone *executors.SnapshotCloneRequest) (*executors.Volume, error)
+	MockGeoReplicationCreate  func(host string, session *executors.GeoReplicationRequest) error
+	MockGeoReplicationAction  func(host string, session *executors.GeoReplicationRequest, action string, force bool) error
+	MockBlockVolumeCreate     func(host string, blockVolume *executors.BlockVolumeRequest) (*executors.BlockVolumeInfo, error)
+	MockBlockVolumeDestroy    func(host string, blockHostingVolumeName string, blockVolumeName string) error
+	MockBlockVolumeList       func(host string, blockHostingVolumeName string) ([]string, error)
+	MockBlockVolumeInfo       func(host string, blockHostingVolumeName string, blockVolumeName string) (*executors.BlockVolumeInfo, error)
+	MockBlockVolumeExpand     func(host string, blockHostingVolumeName string, blockVolumeName string, newSize int) error
+	MockBlockVolumeAuthRotate func(host string, blockHostingVolumeName string, blockVolumeName string) (*executors.BlockVolumeInfo, error)
+	MockBlockVolumeModifyHa   func(host string, blockHostingVolumeName string, blockVolumeName string, hacount int, blockHosts []string) error
+	MockBlockVolumeClone      func(host string, clone *executors.BlockVolumeCloneRequest) (*executors.BlockVolumeInfo, error)
 }
 
 func NewMockExecutor() (*MockExecutor, error) {
@@ -49,10 +76,24 @@ func NewMockExecutor() (*MockExecutor, error) {
 		return nil
 	}
 
+	m.MockPeerStatus = func(host string) (*executors.PeerStatus, error) {
+		return &executors.PeerStatus{}, nil
+	}
+
+	m.MockClusterOptions = func(host string) (*executors.ClusterOptions, error) {
+		return &executors.ClusterOptions{}, nil
+	}
+
+	m.MockClusterSetOptions = func(host string, options []string) error {
+		return nil
+	}
+
 	m.MockDeviceSetup = func(host, device, vgid string) (*executors.DeviceInfo, error) {
 		d := &executors.DeviceInfo{}
 		d.Size = 500 * 1024 * 1024 // Size in KB
 		d.ExtentSize = 4096
+		d.TotalSize = d.Size
+		d.FreeExtents = d.Size / d.ExtentSize
 		return d, nil
 	}
 
@@ -60,6 +101,14 @@ func NewMockExecutor() (*MockExecutor, error) {
 		return nil
 	}
 
+	m.MockDeviceSnapshotUsage = func(host, vgid string) ([]executors.ThinPoolUsage, error) {
+		return []executors.ThinPoolUsage{}, nil
+	}
+
+	m.MockDeviceLvs = func(host, vgid string) ([]executors.LvInfo, error) {
+		return []executors.LvInfo{}, nil
+	}
+
 	m.MockBrickCreate = func(host string, brick *executors.BrickRequest) (*executors.BrickInfo, error) {
 		b := &executors.BrickInfo{
 			Path: "/mockpath",
@@ -116,6 +165,70 @@ func NewMockExecutor() (*MockExecutor, error) {
 		return &executors.HealInfo{}, nil
 	}
 
+	m.MockVolumeStart = func(host string, volume string) error {
+		return nil
+	}
+
+	m.MockVolumeStop = func(host string, volume string) error {
+		return nil
+	}
+
+	m.MockVolumeSetOptions = func(host string, volume string, options []string) error {
+		return nil
+	}
+
+	m.MockVolumeSetQuota = func(host string, quota *executors.VolumeQuotaRequest) error {
+		return nil
+	}
+
+	m.MockVolumeResetOptions = func(host string, volume string, options []string) error {
+		return nil
+	}
+
+	m.MockVolumeIOCheck = func(host string, volume string) error {
+		return nil
+	}
+
+	m.MockVolumeStatus = func(host string, volume string) (*executors.VolumeStatus, error) {
+		return &executors.VolumeStatus{VolName: volume}, nil
+	}
+
+	m.MockVolumeProfileInfo = func(host string, volume string) (*executors.VolumeProfile, error) {
+		return &executors.VolumeProfile{VolName: volume}, nil
+	}
+
+	m.MockVolumeRestartBricks = func(host string, volume string, pids []int) error {
+		return nil
+	}
+
+	m.MockSnapshotCreate = func(host string, snapshot *executors.SnapshotRequest) error {
+		return nil
+	}
+
+	m.MockSnapshotDestroy = func(host string, snapshot string) error {
+		return nil
+	}
+
+	m.MockSnapshotList = func(host string, volume string) ([]string, error) {
+		return []string{}, nil
+	}
+
+	m.MockSnapshotRestore = func(host string, snapshot string) error {
+		return nil
+	}
+
+	m.MockSnapshotClone = func(host string, clone *executors.SnapshotCloneRequest) (*executors.Volume, error) {
+		return &executors.Volume{VolumeName: clone.Volume}, nil
+	}
+
+	m.MockGeoReplicationCreate = func(host string, session *executors.GeoReplicationRequest) error {
+		return nil
+	}
+
+	m.MockGeoReplicationAction = func(host string, session *executors.GeoReplicationRequest, action string, force bool) error {
+		return nil
+	}
+
 	m.MockBlockVolumeCreate = func(host string, blockVolume *executors.BlockVolumeRequest) (*executors.BlockVolumeInfo, error) {
 		var blockVolumeInfo executors.BlockVolumeInfo
 		blockVolumeInfo.BlockHosts = blockVolume.BlockHosts
@@ -137,6 +250,43 @@ func NewMockExecutor() (*MockExecutor, error) {
 		return nil
 	}
 
+	m.MockBlockVolumeList = func(host string, blockHostingVolumeName string) ([]string, error) {
+		return []string{}, nil
+	}
+
+	m.MockBlockVolumeExpand = func(host string, blockHostingVolumeName string, blockVolumeName string, newSize int) error {
+		return nil
+	}
+
+	m.MockBlockVolumeAuthRotate = func(host string, blockHostingVolumeName string, blockVolumeName string) (*executors.BlockVolumeInfo, error) {
+		var blockVolumeInfo executors.BlockVolumeInfo
+		blockVolumeInfo.Name = blockVolumeName
+		blockVolumeInfo.GlusterVolumeName = blockHostingVolumeName
+		blockVolumeInfo.Username = blockVolumeName
+		blockVolumeInfo.Password = "rotated"
+		return &blockVolumeInfo, nil
+	}
+
+	m.MockBlockVolumeModifyHa = func(host string, blockHostingVolumeName string, blockVolumeName string, hacount int, blockHosts []string) error {
+		return nil
+	}
+
+	m.MockBlockVolumeClone = func(host string, clone *executors.BlockVolumeCloneRequest) (*executors.BlockVolumeInfo, error) {
+		return m.MockBlockVolumeCreate(host, &clone.BlockVolumeRequest)
+	}
+
+	m.MockBlockVolumeInfo = func(host string, blockHostingVolumeName string, blockVolumeName string) (*executors.BlockVolumeInfo, error) {
+		var blockVolumeInfo executors.BlockVolumeInfo
+		blockVolumeInfo.Name = blockVolumeName
+		blockVolumeInfo.GlusterVolumeName = blockHostingVolumeName
+		blockVolumeInfo.Size = 1
+		blockVolumeInfo.Hacount = 1
+		blockVolumeInfo.BlockHosts = []string{host}
+		blockVolumeInfo.Iqn = "fakeIQN"
+
+		return &blockVolumeInfo, nil
+	}
+
 	return m, nil
 }
 
@@ -156,6 +306,18 @@ func (m *MockExecutor) PeerDetach(exec_host, newnode string) error {
 	return m.MockPeerDetach(exec_host, newnode)
 }
 
+func (m *MockExecutor) PeerStatus(host string) (*executors.PeerStatus, error) {
+	return m.MockPeerStatus(host)
+}
+
+func (m *MockExecutor) ClusterOptions(host string) (*executors.ClusterOptions, error) {
+	return m.MockClusterOptions(host)
+}
+
+func (m *MockExecutor) ClusterSetOptions(host string, options []string) error {
+	return m.MockClusterSetOptions(host, options)
+}
+
 func (m *MockExecutor) DeviceSetup(host, device, vgid string) (*executors.DeviceInfo, error) {
 	return m.MockDeviceSetup(host, device, vgid)
 }
@@ -168,6 +330,14 @@ func (m *MockExecutor) DeviceTeardown(host, device, vgid string) error {
 	return m.MockDeviceTeardown(host, device, vgid)
 }
 
+func (m *MockExecutor) GetDeviceSnapshotUsage(host, vgid string) ([]executors.ThinPoolUsage, error) {
+	return m.MockDeviceSnapshotUsage(host, vgid)
+}
+
+func (m *MockExecutor) GetDeviceLvs(host, vgid string) ([]executors.LvInfo, error) {
+	return m.MockDeviceLvs(host, vgid)
+}
+
 func (m *MockExecutor) BrickCreate(host string, brick *executors.BrickRequest) (*executors.BrickInfo, error) {
 	return m.MockBrickCreate(host, brick)
 }
@@ -208,6 +378,70 @@ func (m *MockExecutor) HealInfo(host string, volume string) (*executors.HealInfo
 	return m.MockHealInfo(host, volume)
 }
 
+func (m *MockExecutor) VolumeStart(host string, volume string) error {
+	return m.MockVolumeStart(host, volume)
+}
+
+func (m *MockExecutor) VolumeStop(host string, volume string) error {
+	return m.MockVolumeStop(host, volume)
+}
+
+func (m *MockExecutor) VolumeSetOptions(host string, volume string, options []string) error {
+	return m.MockVolumeSetOptions(host, volume, options)
+}
+
+func (m *MockExecutor) VolumeSetQuota(host string, quota *executors.VolumeQuotaRequest) error {
+	return m.MockVolumeSetQuota(host, quota)
+}
+
+func (m *MockExecutor) VolumeResetOptions(host string, volume string, options []string) error {
+	return m.MockVolumeResetOptions(host, volume, options)
+}
+
+func (m *MockExecutor) VolumeIOCheck(host string, volume string) error {
+	return m.MockVolumeIOCheck(host, volume)
+}
+
+func (m *MockExecutor) VolumeStatus(host string, volume string) (*executors.VolumeStatus, error) {
+	return m.MockVolumeStatus(host, volume)
+}
+
+func (m *MockExecutor) VolumeProfileInfo(host string, volume string) (*executors.VolumeProfile, error) {
+	return m.MockVolumeProfileInfo(host, volume)
+}
+
+func (m *MockExecutor) VolumeRestartBricks(host string, volume string, pids []int) error {
+	return m.MockVolumeRestartBricks(host, volume, pids)
+}
+
+func (m *MockExecutor) SnapshotCreate(host string, snapshot *executors.SnapshotRequest) error {
+	return m.MockSnapshotCreate(host, snapshot)
+}
+
+func (m *MockExecutor) SnapshotDestroy(host string, snapshot string) error {
+	return m.MockSnapshotDestroy(host, snapshot)
+}
+
+func (m *MockExecutor) SnapshotList(host string, volume string) ([]string, error) {
+	return m.MockSnapshotList(host, volume)
+}
+
+func (m *MockExecutor) SnapshotRestore(host string, snapshot string) error {
+	return m.MockSnapshotRestore(host, snapshot)
+}
+
+func (m *MockExecutor) SnapshotClone(host string, clone *executors.SnapshotCloneRequest) (*executors.Volume, error) {
+	return m.MockSnapshotClone(host, clone)
+}
+
+func (m *MockExecutor) GeoReplicationCreate(host string, session *executors.GeoReplicationRequest) error {
+	return m.MockGeoReplicationCreate(host, session)
+}
+
+func (m *MockExecutor) GeoReplicationAction(host string, session *executors.GeoReplicationRequest, action string, force bool) error {
+	return m.MockGeoReplicationAction(host, session, action, force)
+}
+
 func (m *MockExecutor) BlockVolumeCreate(host string, blockVolume *executors.BlockVolumeRequest) (*executors.BlockVolumeInfo, error) {
 	return m.MockBlockVolumeCreate(host, blockVolume)
 }
@@ -215,3 +449,27 @@ func (m *MockExecutor) BlockVolumeCreate(host string, blockVolume *executors.Blo
 func (m *MockExecutor) BlockVolumeDestroy(host string, blockHostingVolumeName string, blockVolumeName string) error {
 	return m.MockBlockVolumeDestroy(host, blockHostingVolumeName, blockVolumeName)
 }
+
+func (m *MockExecutor) BlockVolumeList(host string, blockHostingVolumeName string) ([]string, error) {
+	return m.MockBlockVolumeList(host, blockHostingVolumeName)
+}
+
+func (m *MockExecutor) BlockVolumeInfo(host string, blockHostingVolumeName string, blockVolumeName string) (*executors.BlockVolumeInfo, error) {
+	return m.MockBlockVolumeInfo(host, blockHostingVolumeName, blockVolumeName)
+}
+
+func (m *MockExecutor) BlockVolumeExpand(host string, blockHostingVolumeName string, blockVolumeName string, newSize int) error {
+	return m.MockBlockVolumeExpand(host, blockHostingVolumeName, blockVolumeName, newSize)
+}
+
+func (m *MockExecutor) BlockVolumeAuthRotate(host string, blockHostingVolumeName string, blockVolumeName string) (*executors.BlockVolumeInfo, error) {
+	return m.MockBlockVolumeAuthRotate(host, blockHostingVolumeName, blockVolumeName)
+}
+
+func (m *MockExecutor) BlockVolumeModifyHa(host string, blockHostingVolumeName string, blockVolumeName string, hacount int, blockHosts []string) error {
+	return m.MockBlockVolumeModifyHa(host, blockHostingVolumeName, blockVolumeName, hacount, blockHosts)
+}
+
+func (m *MockExecutor) BlockVolumeClone(host string, clone *executors.BlockVolumeCloneRequest) (*executors.BlockVolumeInfo, error) {
+	return m.MockBlockVolumeClone(host, clone)
+}
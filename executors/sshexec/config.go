@@ -19,4 +19,8 @@ type SshConfig struct {
 	PrivateKeyFile string `json:"keyfile"`
 	User           string `json:"user"`
 	Port           string `json:"port"`
+
+	// Connect to the other management hostnames of a node when
+	// its first one can not be resolved
+	HostnameFailover bool `json:"hostname_failover"`
 }
@@ -0,0 +1,109 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package sshexec
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/heketi/heketi/executors"
+)
+
+var (
+	lookupHost = net.LookupHost
+)
+
+// SetHostAlternates sets the hostnames tried in order when the
+// host can not be resolved and hostname failover is enabled
+func (s *SshExecutor) SetHostAlternates(host string, alternates []string) {
+	s.Lock.Lock()
+	defer s.Lock.Unlock()
+	if s.alternates == nil {
+		s.alternates = map[string][]string{}
+	}
+	s.alternates[host] = alternates
+}
+
+// SetResolutionHandler sets the function called when the address of
+// a host changes, an alternate is used or the resolution fails
+func (s *SshExecutor) SetResolutionHandler(
+	handler func(host string, r executors.HostResolution)) {
+
+	s.Lock.Lock()
+	defer s.Lock.Unlock()
+	s.resolutionHandler = handler
+}
+
+// resolveHost resolves the host again before every connection and
+// returns the addresses to connect to. The result is recorded whether
+// or not hostname failover is enabled. When the host can not be
+// resolved its alternates are tried if failover is enabled, otherwise
+// the host itself is returned to be connected to directly.
+func (s *SshExecutor) resolveHost(host string) ([]string, error) {
+	candidates := []string{host}
+	if s.config.HostnameFailover {
+		s.Lock.Lock()
+		candidates = append(candidates, s.alternates[host]...)
+		s.Lock.Unlock()
+	}
+
+	var addrs []string
+	var r executors.HostResolution
+	var lastErr error
+	for _, candidate := range candidates {
+		var err error
+		addrs, err = lookupHost(candidate)
+		if err == nil && len(addrs) == 0 {
+			err = fmt.Errorf("no addresses found")
+		}
+		if err != nil {
+			s.Logger().Warning("Unable to resolve %v: %v", candidate, err)
+			lastErr = err
+			continue
+		}
+		r.Hostname = candidate
+		r.Address = addrs[0]
+		break
+	}
+	if r.Address == "" {
+		r.Error = fmt.Errorf("Unable to resolve %v: %v", host, lastErr)
+	}
+
+	s.recordResolution(host, r)
+	if r.Error != nil {
+		if !s.config.HostnameFailover {
+			return []string{host}, nil
+		}
+		return nil, r.Error
+	}
+	return addrs, nil
+}
+
+// recordResolution keeps the result of the resolution of the host and
+// calls the resolution handler when the result is not the same as the
+// previous one
+func (s *SshExecutor) recordResolution(host string, r executors.HostResolution) {
+	s.Lock.Lock()
+	if s.resolutions == nil {
+		s.resolutions = map[string]executors.HostResolution{}
+	}
+	last, known := s.resolutions[host]
+	s.resolutions[host] = r
+	handler := s.resolutionHandler
+	s.Lock.Unlock()
+
+	changed := !known ||
+		last.Hostname != r.Hostname ||
+		last.Address != r.Address ||
+		(last.Error == nil) != (r.Error == nil)
+	if changed && handler != nil {
+		handler(host, r)
+	}
+}
@@ -0,0 +1,155 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package sshexec
+
+import (
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/heketi/heketi/executors"
+	"github.com/heketi/heketi/pkg/utils"
+	"github.com/heketi/tests"
+)
+
+func TestSshExecResolveHost(t *testing.T) {
+
+	f := NewFakeSsh()
+	defer tests.Patch(&sshNew,
+		func(logger *utils.Logger, user string, file string) (Ssher, error) {
+			return f, nil
+		}).Restore()
+
+	addresses := map[string][]string{
+		"node1":     {"192.168.10.100"},
+		"node1-alt": {"fd00::100"},
+	}
+	defer tests.Patch(&lookupHost, func(host string) ([]string, error) {
+		if a, ok := addresses[host]; ok {
+			return a, nil
+		}
+		return nil, fmt.Errorf("no such host")
+	}).Restore()
+
+	config := &SshConfig{
+		PrivateKeyFile:   "xkeyfile",
+		User:             "xuser",
+		HostnameFailover: true,
+	}
+	s, err := NewSshExecutor(config)
+	tests.Assert(t, err == nil, err)
+	s.SetHostAlternates("node1", []string{"node1-alt"})
+
+	events := []executors.HostResolution{}
+	s.SetResolutionHandler(func(host string, r executors.HostResolution) {
+		tests.Assert(t, host == "node1", host)
+		events = append(events, r)
+	})
+
+	var connected string
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+		connected = host
+		return []string{""}, nil
+	}
+
+	// The address is reported the first time only
+	_, err = s.RemoteCommandExecute("node1", []string{"ls"}, 10)
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, connected == "192.168.10.100:22", connected)
+	_, err = s.RemoteCommandExecute("node1", []string{"ls"}, 10)
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, len(events) == 1, events)
+	tests.Assert(t, events[0].Hostname == "node1")
+	tests.Assert(t, events[0].Address == "192.168.10.100")
+
+	// Changes of address are reported
+	addresses["node1"] = []string{"192.168.10.200"}
+	_, err = s.RemoteCommandExecute("node1", []string{"ls"}, 10)
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, connected == "192.168.10.200:22", connected)
+	tests.Assert(t, len(events) == 2, events)
+
+	// The alternate is used when the hostname can not be resolved
+	delete(addresses, "node1")
+	_, err = s.RemoteCommandExecute("node1", []string{"ls"}, 10)
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, connected == "[fd00::100]:22", connected)
+	tests.Assert(t, len(events) == 3, events)
+	tests.Assert(t, events[2].Hostname == "node1-alt")
+
+	// Nothing is run when no hostname can be resolved
+	delete(addresses, "node1-alt")
+	connected = ""
+	_, err = s.RemoteCommandExecute("node1", []string{"ls"}, 10)
+	tests.Assert(t, err != nil)
+	tests.Assert(t, connected == "")
+	tests.Assert(t, len(events) == 4, events)
+	tests.Assert(t, events[3].Error != nil)
+
+	// Every address of the hostname is tried until one accepts the
+	// connection, failures of the commands not trying the others
+	addresses["node1"] = []string{"192.168.10.100", "192.168.10.200"}
+	tried := []string{}
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+		tried = append(tried, host)
+		if host == "192.168.10.100:22" {
+			return nil, &net.OpError{Op: "dial", Err: fmt.Errorf("refused")}
+		}
+		return []string{""}, nil
+	}
+	_, err = s.RemoteCommandExecute("node1", []string{"ls"}, 10)
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, len(tried) == 2 && tried[1] == "192.168.10.200:22", tried)
+
+	tried = []string{}
+	addresses["node1"] = []string{"192.168.10.200", "192.168.10.100"}
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+		tried = append(tried, host)
+		return nil, fmt.Errorf("command failed")
+	}
+	_, err = s.RemoteCommandExecute("node1", []string{"ls"}, 10)
+	tests.Assert(t, err != nil)
+	tests.Assert(t, len(tried) == 1, tried)
+
+	// Without failover the resolution is still recorded, but the
+	// hostname is connected to directly instead of the alternates when
+	// it can not be resolved
+	config.HostnameFailover = false
+	delete(addresses, "node1")
+	events = events[:0]
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+		connected = host
+		return []string{""}, nil
+	}
+	_, err = s.RemoteCommandExecute("node1", []string{"ls"}, 10)
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, connected == "node1:22", connected)
+	tests.Assert(t, len(events) == 1, events)
+	tests.Assert(t, events[0].Error != nil)
+
+	addresses["node1"] = []string{"192.168.10.100"}
+	_, err = s.RemoteCommandExecute("node1", []string{"ls"}, 10)
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, connected == "192.168.10.100:22", connected)
+	tests.Assert(t, len(events) == 2, events)
+	tests.Assert(t, events[1].Address == "192.168.10.100")
+}
@@ -12,9 +12,12 @@ package sshexec
 import (
 	"errors"
 	"fmt"
+	"net"
 	"os"
 	"strconv"
+	"sync"
 
+	"github.com/heketi/heketi/executors"
 	"github.com/heketi/heketi/executors/cmdexec"
 	"github.com/heketi/heketi/pkg/utils"
 	"github.com/heketi/heketi/pkg/utils/ssh"
@@ -34,6 +37,11 @@ type SshExecutor struct {
 	exec            Ssher
 	config          *SshConfig
 	port            string
+
+	// Hostname resolution
+	alternates        map[string][]string
+	resolutions       map[string]executors.HostResolution
+	resolutionHandler func(host string, r executors.HostResolution)
 }
 
 var (
@@ -87,6 +95,7 @@ func NewSshExecutor(config *SshConfig) (*SshExecutor, error) {
 	s := &SshExecutor{}
 	s.RemoteExecutor = s
 	s.Throttlemap = make(map[string]chan bool)
+	s.Lock = &sync.Mutex{}
 
 	// Set configuration
 	if config.PrivateKeyFile == "" {
@@ -115,8 +124,23 @@ func NewSshExecutor(config *SshConfig) (*SshExecutor, error) {
 	// Save the configuration
 	s.config = config
 
+	err := s.SetEnvironment(config.Environment, config.ClusterEnvironment)
+	if err != nil {
+		s.Logger().Err(err)
+		return nil, err
+	}
+	err = s.SetCommandWrappers(config.CommandWrappers)
+	if err != nil {
+		s.Logger().Err(err)
+		return nil, err
+	}
+	err = s.SetCommandOutputSize(config.CommandOutputSize)
+	if err != nil {
+		s.Logger().Err(err)
+		return nil, err
+	}
+
 	// Setup key
-	var err error
 	s.exec, err = sshNew(s.Logger(), s.user, s.private_keyfile)
 	if err != nil {
 		s.Logger().Err(err)
@@ -141,8 +165,41 @@ func (s *SshExecutor) RemoteCommandExecute(host string,
 	s.AccessConnection(host)
 	defer s.FreeConnection(host)
 
-	// Execute
-	return s.exec.ConnectAndExec(host+":"+s.port, commands, timeoutMinutes, s.config.Sudo)
+	commands = s.PrepareCommands(host, commands)
+	addrs, err := s.resolveHost(host)
+	if err != nil {
+		return nil, err
+	}
+
+	// Execute on the first address accepting the connection
+	var output []string
+	for _, address := range addrs {
+		output, err = s.exec.ConnectAndExec(net.JoinHostPort(address, s.port),
+			commands, timeoutMinutes, s.config.Sudo)
+		if _, unreachable := err.(net.Error); !unreachable {
+			break
+		}
+	}
+	return output, s.RecordCommandOutput(host, err)
+}
+
+// WithRequestId returns a copy of the executor logging the commands run
+// for the request with the id. The copy shares the connections, the
+// environment and the resolutions with s.
+func (s *SshExecutor) WithRequestId(id string) executors.Executor {
+	s.Lock.Lock()
+	if s.alternates == nil {
+		s.alternates = map[string][]string{}
+	}
+	if s.resolutions == nil {
+		s.resolutions = map[string]executors.HostResolution{}
+	}
+	c := *s
+	s.Lock.Unlock()
+
+	c.CmdExecutor = s.CmdExecutor.ForRequest(id)
+	c.RemoteExecutor = &c
+	return &c
 }
 
 func (s *SshExecutor) RebalanceOnExpansion() bool {
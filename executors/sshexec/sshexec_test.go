@@ -204,3 +204,114 @@ func TestSshExecutorEnvVariables(t *testing.T) {
 	tests.Assert(t, s.exec != nil)
 
 }
+
+func TestSshExecCommandEnvironment(t *testing.T) {
+
+	f := NewFakeSsh()
+	defer tests.Patch(&sshNew,
+		func(logger *utils.Logger, user string, file string) (Ssher, error) {
+			return f, nil
+		}).Restore()
+	defer tests.Patch(&lookupHost, func(host string) ([]string, error) {
+		return []string{"192.168.10.100"}, nil
+	}).Restore()
+
+	config := &SshConfig{
+		PrivateKeyFile: "xkeyfile",
+		User:           "xuser",
+		CmdConfig: cmdexec.CmdConfig{
+			Environment: cmdexec.CommandEnvironment{
+				Variables: map[string]string{"LC_ALL": "C"},
+			},
+			ClusterEnvironment: map[string]cmdexec.CommandEnvironment{
+				"c1": cmdexec.CommandEnvironment{
+					PathPrefix: []string{"/opt/gluster/sbin"},
+				},
+			},
+		},
+	}
+
+	s, err := NewSshExecutor(config)
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, s != nil)
+	s.SetHostCluster("host1", "c1")
+
+	var executed []string
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+		executed = commands
+		return []string{""}, nil
+	}
+
+	_, err = s.RemoteCommandExecute("host1", []string{"gluster volume list"}, 10)
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, executed[0] == "env LC_ALL=\"C\" "+
+		"PATH=\"/opt/gluster/sbin:$PATH\" gluster volume list", executed[0])
+
+	_, err = s.RemoteCommandExecute("host2", []string{"gluster volume list"}, 10)
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, executed[0] == "env LC_ALL=\"C\" gluster volume list",
+		executed[0])
+
+	// Environments that can not be passed through the shell are rejected
+	config.Environment.Variables["LC_ALL"] = "C'"
+	s, err = NewSshExecutor(config)
+	tests.Assert(t, err != nil)
+	tests.Assert(t, s == nil)
+}
+
+func TestSshExecWithRequestId(t *testing.T) {
+
+	f := NewFakeSsh()
+	defer tests.Patch(&sshNew,
+		func(logger *utils.Logger, user string, file string) (Ssher, error) {
+			return f, nil
+		}).Restore()
+	defer tests.Patch(&lookupHost, func(host string) ([]string, error) {
+		return []string{"192.168.10.100"}, nil
+	}).Restore()
+
+	config := &SshConfig{
+		PrivateKeyFile: "xkeyfile",
+		User:           "xuser",
+		CmdConfig: cmdexec.CmdConfig{
+			ClusterEnvironment: map[string]cmdexec.CommandEnvironment{
+				"c1": cmdexec.CommandEnvironment{
+					PathPrefix: []string{"/opt/gluster/sbin"},
+				},
+			},
+		},
+	}
+
+	s, err := NewSshExecutor(config)
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, s.RequestId() == "")
+	tests.Assert(t, s.Logger().RequestId() == "")
+
+	r, ok := s.WithRequestId("abc").(*SshExecutor)
+	tests.Assert(t, ok)
+	tests.Assert(t, r.RequestId() == "abc")
+	tests.Assert(t, r.Logger().RequestId() == "abc")
+	tests.Assert(t, r.RemoteExecutor == r)
+	tests.Assert(t, s.RequestId() == "")
+
+	// The copy shares the settings of the hosts with the executor,
+	// including the ones made after it was copied
+	s.SetHostCluster("host1", "c1")
+
+	var executed []string
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+		executed = commands
+		return []string{""}, nil
+	}
+
+	_, err = r.RemoteCommandExecute("host1", []string{"gluster volume list"}, 10)
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, executed[0] == "env "+
+		"PATH=\"/opt/gluster/sbin:$PATH\" gluster volume list", executed[0])
+}
@@ -33,6 +33,7 @@ type Config struct {
 	Port                 string                   `json:"port"`
 	AuthEnabled          bool                     `json:"use_auth"`
 	JwtConfig            middleware.JwtAuthConfig `json:"jwt"`
+	TlsConfig            middleware.TlsConfig     `json:"tls"`
 	BackupDbToKubeSecret bool                     `json:"backup_db_to_kube_secret"`
 }
 
@@ -44,6 +45,9 @@ var (
 	dbFile                       string
 	debugOutput                  bool
 	deleteAllBricksWithEmptyPath bool
+	entryKind                    string
+	entryId                      string
+	repairDb                     bool
 )
 
 var RootCmd = &cobra.Command{
@@ -169,6 +173,131 @@ var deleteBricksWithEmptyPath = &cobra.Command{
 	},
 }
 
+var listdbCmd = &cobra.Command{
+	Use:     "list",
+	Short:   "lists the volume, brick or device entries of a db file",
+	Long:    "lists the volume, brick or device entries of a db file, including entries that can not be read",
+	Example: "heketi db list --type=volume --dbfile=/db/file/path/",
+	Run: func(cmd *cobra.Command, args []string) {
+		if dbFile == "" {
+			fmt.Fprintln(os.Stderr, "Please provide path for db file")
+			os.Exit(1)
+		}
+		err := glusterfs.DbListEntries(os.Stdout, dbFile, entryKind, debugOutput)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to list entries: %v\n", err.Error())
+			os.Exit(1)
+		}
+		os.Exit(0)
+	},
+}
+
+var showdbCmd = &cobra.Command{
+	Use:     "show",
+	Short:   "shows a volume, brick or device entry of a db file as JSON",
+	Long:    "shows a volume, brick or device entry of a db file as JSON",
+	Example: "heketi db show --type=brick --id=<brick id> --dbfile=/db/file/path/",
+	Run: func(cmd *cobra.Command, args []string) {
+		if dbFile == "" {
+			fmt.Fprintln(os.Stderr, "Please provide path for db file")
+			os.Exit(1)
+		}
+		if entryId == "" {
+			fmt.Fprintln(os.Stderr, "Please provide id of the entry")
+			os.Exit(1)
+		}
+		err := glusterfs.DbShowEntry(os.Stdout, dbFile, entryKind, entryId, debugOutput)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to show entry: %v\n", err.Error())
+			os.Exit(1)
+		}
+		os.Exit(0)
+	},
+}
+
+var deleteEntrydbCmd = &cobra.Command{
+	Use:     "delete-entry",
+	Short:   "removes a volume, brick or device entry from a db file",
+	Long:    "removes a volume, brick or device entry, such as a corrupt entry, from a db file. Entries used by other entries are not removed.",
+	Example: "heketi db delete-entry --type=device --id=<device id> --dbfile=/db/file/path/",
+	Run: func(cmd *cobra.Command, args []string) {
+		if dbFile == "" {
+			fmt.Fprintln(os.Stderr, "Please provide path for db file")
+			os.Exit(1)
+		}
+		if entryId == "" {
+			fmt.Fprintln(os.Stderr, "Please provide id of the entry")
+			os.Exit(1)
+		}
+		err := glusterfs.DbDeleteEntry(dbFile, entryKind, entryId, debugOutput)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to delete entry: %v\n", err.Error())
+			os.Exit(1)
+		}
+		fmt.Fprintln(os.Stderr, entryKind, entryId, "removed")
+		os.Exit(0)
+	},
+}
+
+var checkdbCmd = &cobra.Command{
+	Use:     "check",
+	Short:   "checks the consistency of the entries of a db file",
+	Long:    "checks that the clusters, nodes, devices, volumes and bricks of a db file refer to each other and that the used storage of the devices matches their bricks, repairing the inconsistencies if requested",
+	Example: "heketi db check --dbfile=/db/file/path/ --repair",
+	Run: func(cmd *cobra.Command, args []string) {
+		if dbFile == "" {
+			fmt.Fprintln(os.Stderr, "Please provide path for db file")
+			os.Exit(1)
+		}
+		resp, err := glusterfs.DbCheck(dbFile, repairDb, debugOutput)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to check db: %v\n", err.Error())
+			os.Exit(1)
+		}
+		unrepaired := 0
+		for _, i := range resp.Issues {
+			repaired := ""
+			if i.Repaired {
+				repaired = " [repaired]"
+			} else {
+				unrepaired++
+			}
+			fmt.Fprintf(os.Stdout, "%v %v %v: %v%v\n",
+				i.Type, i.Kind, i.Id, i.Message, repaired)
+		}
+		fmt.Fprintf(os.Stderr, "%v issues found, %v repaired\n",
+			len(resp.Issues), len(resp.Issues)-unrepaired)
+		if unrepaired != 0 {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	},
+}
+
+var adoptDeviceStoragedbCmd = &cobra.Command{
+	Use:     "adopt-device-storage",
+	Short:   "sets the storage of devices of a db file from JSON input",
+	Long:    "sets the total, free and used storage of devices of a db file to the sizes in KB of a JSON file mapping device ids to their storage, without probing the nodes",
+	Example: "heketi db adopt-device-storage --jsonfile=/json/file/path/ --dbfile=/db/file/path/",
+	Run: func(cmd *cobra.Command, args []string) {
+		if jsonFile == "" {
+			fmt.Fprintln(os.Stderr, "Please provide file for input")
+			os.Exit(1)
+		}
+		if dbFile == "" {
+			fmt.Fprintln(os.Stderr, "Please provide path for db file")
+			os.Exit(1)
+		}
+		err := glusterfs.DbAdoptDeviceStorage(dbFile, jsonFile, debugOutput)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to adopt device storage: %v\n", err.Error())
+			os.Exit(1)
+		}
+		fmt.Fprintln(os.Stderr, "device storage updated")
+		os.Exit(0)
+	},
+}
+
 func init() {
 	RootCmd.Flags().StringVar(&configfile, "config", "", "Configuration file")
 	RootCmd.Flags().BoolVarP(&showVersion, "version", "v", false, "Show version")
@@ -197,6 +326,38 @@ func init() {
 	deleteBricksWithEmptyPath.Flags().StringSlice("nodes", []string{}, "comma separated list of node IDs")
 	deleteBricksWithEmptyPath.Flags().StringSlice("devices", []string{}, "comma separated list of device IDs")
 	deleteBricksWithEmptyPath.SilenceUsage = true
+
+	dbCmd.AddCommand(listdbCmd)
+	listdbCmd.Flags().StringVar(&dbFile, "dbfile", "", "File path for db to inspect")
+	listdbCmd.Flags().StringVar(&entryKind, "type", "volume", "Type of the entries: volume, brick or device")
+	listdbCmd.Flags().BoolVar(&debugOutput, "debug", false, "Show debug logs on stdout")
+	listdbCmd.SilenceUsage = true
+
+	dbCmd.AddCommand(showdbCmd)
+	showdbCmd.Flags().StringVar(&dbFile, "dbfile", "", "File path for db to inspect")
+	showdbCmd.Flags().StringVar(&entryKind, "type", "volume", "Type of the entry: volume, brick or device")
+	showdbCmd.Flags().StringVar(&entryId, "id", "", "Id of the entry")
+	showdbCmd.Flags().BoolVar(&debugOutput, "debug", false, "Show debug logs on stdout")
+	showdbCmd.SilenceUsage = true
+
+	dbCmd.AddCommand(deleteEntrydbCmd)
+	deleteEntrydbCmd.Flags().StringVar(&dbFile, "dbfile", "", "File path for db to operate on")
+	deleteEntrydbCmd.Flags().StringVar(&entryKind, "type", "volume", "Type of the entry: volume, brick or device")
+	deleteEntrydbCmd.Flags().StringVar(&entryId, "id", "", "Id of the entry")
+	deleteEntrydbCmd.Flags().BoolVar(&debugOutput, "debug", false, "Show debug logs on stdout")
+	deleteEntrydbCmd.SilenceUsage = true
+
+	dbCmd.AddCommand(adoptDeviceStoragedbCmd)
+	adoptDeviceStoragedbCmd.Flags().StringVar(&jsonFile, "jsonfile", "", "Input file with the storage of devices in JSON format")
+	adoptDeviceStoragedbCmd.Flags().StringVar(&dbFile, "dbfile", "", "File path for db to operate on")
+	adoptDeviceStoragedbCmd.Flags().BoolVar(&debugOutput, "debug", false, "Show debug logs on stdout")
+	adoptDeviceStoragedbCmd.SilenceUsage = true
+
+	dbCmd.AddCommand(checkdbCmd)
+	checkdbCmd.Flags().StringVar(&dbFile, "dbfile", "", "File path for db to check")
+	checkdbCmd.Flags().BoolVar(&repairDb, "repair", false, "Repair the inconsistencies found")
+	checkdbCmd.Flags().BoolVar(&debugOutput, "debug", false, "Show debug logs on stdout")
+	checkdbCmd.SilenceUsage = true
 }
 
 func setWithEnvVariables(options *Config) {
@@ -220,6 +381,16 @@ func setWithEnvVariables(options *Config) {
 		options.Port = env
 	}
 
+	env = os.Getenv("HEKETI_TLS_CERT_FILE")
+	if "" != env {
+		options.TlsConfig.CertFile = env
+	}
+
+	env = os.Getenv("HEKETI_TLS_KEY_FILE")
+	if "" != env {
+		options.TlsConfig.KeyFile = env
+	}
+
 	env = os.Getenv("HEKETI_BACKUP_DB_TO_KUBE_SECRET")
 	if "" != env {
 		options.BackupDbToKubeSecret = true
@@ -303,6 +474,12 @@ func main() {
 			os.Exit(1)
 		}
 
+		err = jwtauth.SetClientCertRoles(options.TlsConfig.ClientCertRoles)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+			os.Exit(1)
+		}
+
 		// Add Token parser
 		n.Use(jwtauth)
 
@@ -332,12 +509,49 @@ func main() {
 	signalch := make(chan os.Signal, 1)
 	signal.Notify(signalch, os.Interrupt, os.Kill, syscall.SIGINT, syscall.SIGTERM)
 
+	server := &http.Server{
+		Addr:    ":" + options.Port,
+		Handler: router,
+	}
+	if options.TlsConfig.Enabled() {
+		certs, err := middleware.NewCertReloader(options.TlsConfig.CertFile,
+			options.TlsConfig.KeyFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+			os.Exit(1)
+		}
+		server.TLSConfig, err = middleware.NewTlsServerConfig(&options.TlsConfig, certs)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+			os.Exit(1)
+		}
+
+		// Load the certificate again on SIGHUP, so that it can be
+		// renewed without restarting the server
+		hupch := make(chan os.Signal, 1)
+		signal.Notify(hupch, syscall.SIGHUP)
+		go func() {
+			for range hupch {
+				if err := certs.Reload(); err != nil {
+					fmt.Printf("ERROR: %v\n", err)
+				} else {
+					fmt.Println("Certificate reloaded")
+				}
+			}
+		}()
+	}
+
 	// Create a channel to know if the server was unable to start
 	done := make(chan bool)
 	go func() {
 		// Start the server.
-		fmt.Printf("Listening on port %v\n", options.Port)
-		err = http.ListenAndServe(":"+options.Port, router)
+		if server.TLSConfig != nil {
+			fmt.Printf("Listening on port %v with TLS\n", options.Port)
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			fmt.Printf("Listening on port %v\n", options.Port)
+			err = server.ListenAndServe()
+		}
 		if err != nil {
 			fmt.Printf("ERROR: HTTP Server error: %v\n", err)
 		}
@@ -27,6 +27,10 @@ var (
 type JwtAuth struct {
 	adminKey []byte
 	userKey  []byte
+
+	// Issuer of the requests of the clients authenticated by their
+	// certificate, by the common name of the certificate
+	certRoles map[string]string
 }
 
 type Issuer struct {
@@ -60,8 +64,48 @@ func NewJwtAuth(config *JwtAuthConfig) *JwtAuth {
 	return j
 }
 
+// SetClientCertRoles lets the clients with a verified certificate whose
+// common name has a role make requests as the admin or user without a
+// token. The common name is the subject of the requests.
+func (j *JwtAuth) SetClientCertRoles(roles map[string]string) error {
+	for cn, role := range roles {
+		if role != "admin" && role != "user" {
+			return fmt.Errorf("Unknown role %v of client certificate %v", role, cn)
+		}
+	}
+	j.certRoles = roles
+	return nil
+}
+
+// clientCertToken returns a token for the client of the request if it
+// was authenticated by a certificate with a role, nil otherwise
+func (j *JwtAuth) clientCertToken(r *http.Request) *jwt.Token {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return nil
+	}
+	cn := r.TLS.VerifiedChains[0][0].Subject.CommonName
+	role, ok := j.certRoles[cn]
+	if !ok {
+		return nil
+	}
+	return &jwt.Token{
+		Claims: jwt.MapClaims{
+			"iss": role,
+			"sub": cn,
+		},
+		Valid: true,
+	}
+}
+
 func (j *JwtAuth) ServeHTTP(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
 
+	// A client certificate with a role takes the place of a token
+	if token := j.clientCertToken(r); token != nil {
+		context.Set(r, "jwt", token)
+		next(w, r)
+		return
+	}
+
 	// Access token from header
 	rawtoken, err := jwtmiddleware.FromAuthHeader(r)
 	if err != nil {
@@ -0,0 +1,120 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package middleware
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sync"
+)
+
+type TlsConfig struct {
+	CertFile string `json:"cert_file"`
+	KeyFile  string `json:"key_file"`
+
+	// CA certificates the client certificates are verified with. The
+	// clients may then authenticate with a certificate.
+	ClientCAFile string `json:"client_ca_file"`
+
+	// Refuse the connections without a valid client certificate
+	RequireClientCert bool `json:"require_client_cert"`
+
+	// Role, admin or user, of the clients authenticated by the common
+	// name of their certificate when authorization is enabled
+	ClientCertRoles map[string]string `json:"client_cert_roles"`
+}
+
+// Enabled returns true if the server is to be served over HTTPS
+func (c *TlsConfig) Enabled() bool {
+	return c.CertFile != "" || c.KeyFile != ""
+}
+
+// CertReloader keeps the certificate of the server, which can be loaded
+// again from its files while the server is running
+type CertReloader struct {
+	lock     sync.RWMutex
+	certFile string
+	keyFile  string
+	cert     *tls.Certificate
+}
+
+func NewCertReloader(certFile, keyFile string) (*CertReloader, error) {
+	c := &CertReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+	if err := c.Reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Reload loads the certificate and the key from their files again. The
+// current certificate is kept if they can not be loaded.
+func (c *CertReloader) Reload() error {
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return fmt.Errorf("Unable to load certificate %v and key %v: %v",
+			c.certFile, c.keyFile, err)
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.cert = &cert
+	return nil
+}
+
+func (c *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.cert, nil
+}
+
+// NewTlsServerConfig returns the TLS configuration of the server, whose
+// certificate is the one of the reloader
+func NewTlsServerConfig(config *TlsConfig, certs *CertReloader) (*tls.Config, error) {
+	if config.CertFile == "" || config.KeyFile == "" {
+		return nil, errors.New("Both the certificate and the key files are required")
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: certs.GetCertificate,
+	}
+
+	if config.ClientCAFile == "" {
+		if config.RequireClientCert {
+			return nil, errors.New("Client certificates required without client CA file")
+		}
+		return tlsConfig, nil
+	}
+
+	pem, err := ioutil.ReadFile(config.ClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read client CA file %v: %v",
+			config.ClientCAFile, err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("No certificate found in client CA file %v",
+			config.ClientCAFile)
+	}
+	tlsConfig.ClientCAs = pool
+	if config.RequireClientCert {
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	} else {
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	return tlsConfig, nil
+}
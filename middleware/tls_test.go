@@ -0,0 +1,263 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/gorilla/context"
+	"github.com/heketi/tests"
+	"github.com/urfave/negroni"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *rsa.PrivateKey
+	pem  []byte
+}
+
+// newTestCert creates a certificate for the common name, signed by the
+// parent or self-signed if parent is nil
+func newTestCert(t *testing.T, cn string, serial int64, parent *testCert) *testCert {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	tests.Assert(t, err == nil, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth,
+			x509.ExtKeyUsageClientAuth},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer,
+		&key.PublicKey, signerKey)
+	tests.Assert(t, err == nil, err)
+	cert, err := x509.ParseCertificate(der)
+	tests.Assert(t, err == nil, err)
+
+	return &testCert{
+		cert: cert,
+		key:  key,
+		pem:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	}
+}
+
+func (c *testCert) keyPem() []byte {
+	return pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(c.key),
+	})
+}
+
+func (c *testCert) tlsCertificate() tls.Certificate {
+	return tls.Certificate{
+		Certificate: [][]byte{c.cert.Raw},
+		PrivateKey:  c.key,
+	}
+}
+
+func (c *testCert) write(t *testing.T, certFile, keyFile string) {
+	err := ioutil.WriteFile(certFile, c.pem, 0600)
+	tests.Assert(t, err == nil, err)
+	err = ioutil.WriteFile(keyFile, c.keyPem(), 0600)
+	tests.Assert(t, err == nil, err)
+}
+
+func TestNewTlsServerConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "heketi-tls")
+	tests.Assert(t, err == nil, err)
+	defer os.RemoveAll(dir)
+
+	ca := newTestCert(t, "ca", 1, nil)
+	serverCert := newTestCert(t, "server", 2, ca)
+	certFile := filepath.Join(dir, "server.crt")
+	keyFile := filepath.Join(dir, "server.key")
+	caFile := filepath.Join(dir, "ca.crt")
+	serverCert.write(t, certFile, keyFile)
+	err = ioutil.WriteFile(caFile, ca.pem, 0600)
+	tests.Assert(t, err == nil, err)
+
+	_, err = NewCertReloader(certFile, filepath.Join(dir, "missing.key"))
+	tests.Assert(t, err != nil)
+	certs, err := NewCertReloader(certFile, keyFile)
+	tests.Assert(t, err == nil, err)
+
+	// Without client certificates
+	config, err := NewTlsServerConfig(&TlsConfig{
+		CertFile: certFile,
+		KeyFile:  keyFile,
+	}, certs)
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, config.ClientAuth == tls.NoClientCert)
+
+	_, err = NewTlsServerConfig(&TlsConfig{
+		CertFile:          certFile,
+		KeyFile:           keyFile,
+		RequireClientCert: true,
+	}, certs)
+	tests.Assert(t, err != nil)
+
+	_, err = NewTlsServerConfig(&TlsConfig{
+		CertFile:     certFile,
+		KeyFile:      keyFile,
+		ClientCAFile: keyFile,
+	}, certs)
+	tests.Assert(t, err != nil)
+
+	config, err = NewTlsServerConfig(&TlsConfig{
+		CertFile:          certFile,
+		KeyFile:           keyFile,
+		ClientCAFile:      caFile,
+		RequireClientCert: true,
+	}, certs)
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, config.ClientAuth == tls.RequireAndVerifyClientCert)
+
+	// The certificate is replaced once reloaded
+	cert, err := config.GetCertificate(nil)
+	tests.Assert(t, err == nil, err)
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, leaf.SerialNumber.Int64() == 2, leaf.SerialNumber)
+	renewed := newTestCert(t, "server", 3, ca)
+	renewed.write(t, certFile, keyFile)
+	err = certs.Reload()
+	tests.Assert(t, err == nil, err)
+	cert, err = config.GetCertificate(nil)
+	tests.Assert(t, err == nil, err)
+	leaf, err = x509.ParseCertificate(cert.Certificate[0])
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, leaf.SerialNumber.Int64() == 3, leaf.SerialNumber)
+
+	// A failed reload keeps the current certificate
+	err = ioutil.WriteFile(keyFile, []byte("garbage"), 0600)
+	tests.Assert(t, err == nil, err)
+	err = certs.Reload()
+	tests.Assert(t, err != nil)
+	cert2, err := config.GetCertificate(nil)
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, cert2 == cert)
+}
+
+func TestJwtClientCert(t *testing.T) {
+	dir, err := ioutil.TempDir("", "heketi-tls")
+	tests.Assert(t, err == nil, err)
+	defer os.RemoveAll(dir)
+
+	ca := newTestCert(t, "ca", 1, nil)
+	serverCert := newTestCert(t, "server", 2, ca)
+	certFile := filepath.Join(dir, "server.crt")
+	keyFile := filepath.Join(dir, "server.key")
+	caFile := filepath.Join(dir, "ca.crt")
+	serverCert.write(t, certFile, keyFile)
+	err = ioutil.WriteFile(caFile, ca.pem, 0600)
+	tests.Assert(t, err == nil, err)
+
+	certs, err := NewCertReloader(certFile, keyFile)
+	tests.Assert(t, err == nil, err)
+	config, err := NewTlsServerConfig(&TlsConfig{
+		CertFile:     certFile,
+		KeyFile:      keyFile,
+		ClientCAFile: caFile,
+	}, certs)
+	tests.Assert(t, err == nil, err)
+
+	c := &JwtAuthConfig{}
+	c.Admin.PrivateKey = "Key"
+	c.User.PrivateKey = "UserKey"
+	j := NewJwtAuth(c)
+	tests.Assert(t, j != nil)
+	err = j.SetClientCertRoles(map[string]string{"alice": "superuser"})
+	tests.Assert(t, err != nil)
+	err = j.SetClientCertRoles(map[string]string{"alice": "admin"})
+	tests.Assert(t, err == nil, err)
+
+	n := negroni.New(j)
+	var claims jwt.MapClaims
+	n.UseHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := context.Get(r, "jwt").(*jwt.Token)
+		claims = token.Claims.(jwt.MapClaims)
+	})
+	// Served as by the server, the certificate coming from the reloader
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	tests.Assert(t, err == nil, err)
+	server := &http.Server{Handler: n, TLSConfig: config}
+	go server.ServeTLS(ln, "", "")
+	defer server.Close()
+	url := "https://" + ln.Addr().String()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	get := func(client *testCert) *http.Response {
+		clientConfig := &tls.Config{RootCAs: pool}
+		if client != nil {
+			clientConfig.Certificates = []tls.Certificate{client.tlsCertificate()}
+		}
+		httpClient := &http.Client{
+			Transport: &http.Transport{TLSClientConfig: clientConfig},
+		}
+		r, err := httpClient.Get(url)
+		tests.Assert(t, err == nil, err)
+		r.Body.Close()
+		return r
+	}
+
+	// A client certificate with a role replaces the token
+	r := get(newTestCert(t, "alice", 4, ca))
+	tests.Assert(t, r.StatusCode == http.StatusOK, r.StatusCode)
+	tests.Assert(t, claims["iss"] == "admin", claims)
+	tests.Assert(t, claims["sub"] == "alice", claims)
+
+	// Without a role or a certificate a token is still required
+	claims = nil
+	r = get(newTestCert(t, "bob", 5, ca))
+	tests.Assert(t, r.StatusCode == http.StatusUnauthorized, r.StatusCode)
+	r = get(nil)
+	tests.Assert(t, r.StatusCode == http.StatusUnauthorized, r.StatusCode)
+	tests.Assert(t, claims == nil, claims)
+
+	// Certificates of other CAs are refused
+	other := newTestCert(t, "ca", 6, nil)
+	clientConfig := &tls.Config{
+		RootCAs: pool,
+		Certificates: []tls.Certificate{
+			newTestCert(t, "alice", 7, other).tlsCertificate()},
+	}
+	httpClient := &http.Client{
+		Transport: &http.Transport{TLSClientConfig: clientConfig},
+	}
+	_, err = httpClient.Get(url)
+	tests.Assert(t, err != nil)
+}
@@ -0,0 +1,98 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package db
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/boltdb/bolt"
+)
+
+// ScanPrefix calls fn, in key order, with the key and value of each
+// entry of the bucket whose key starts with prefix. All the entries
+// are scanned if the prefix is empty. Nested buckets are skipped.
+func ScanPrefix(tx *bolt.Tx, bucket string, prefix []byte,
+	fn func(k, v []byte) error) error {
+
+	b := tx.Bucket([]byte(bucket))
+	if b == nil {
+		return fmt.Errorf("Bucket %v not found", bucket)
+	}
+
+	c := b.Cursor()
+	for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+		if v == nil {
+			continue
+		}
+		if err := fn(k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BucketNames returns the names of the top level buckets of the db
+func BucketNames(tx *bolt.Tx) []string {
+	names := []string{}
+	tx.ForEach(func(name []byte, _ *bolt.Bucket) error {
+		names = append(names, string(name))
+		return nil
+	})
+	return names
+}
+
+// EntrySize is the size in bytes of the key and value of a db entry
+type EntrySize struct {
+	Key  string
+	Size int
+}
+
+// BucketStats holds the number of entries of a bucket, their total
+// size in bytes and its largest entries
+type BucketStats struct {
+	Name    string
+	Entries int
+	Size    int
+	Largest []EntrySize
+}
+
+// GetBucketStats counts the entries of the bucket whose key starts with
+// prefix and keeps the given number of largest entries, largest first.
+func GetBucketStats(tx *bolt.Tx, bucket string, prefix []byte,
+	largest int) (*BucketStats, error) {
+
+	stats := &BucketStats{Name: bucket, Largest: []EntrySize{}}
+	err := ScanPrefix(tx, bucket, prefix, func(k, v []byte) error {
+		e := EntrySize{Key: string(k), Size: len(k) + len(v)}
+		stats.Entries++
+		stats.Size += e.Size
+
+		// Insert the entry in the largest entries, dropping the
+		// smallest one once there are enough
+		i := sort.Search(len(stats.Largest), func(i int) bool {
+			return stats.Largest[i].Size < e.Size
+		})
+		if i >= largest {
+			return nil
+		}
+		if len(stats.Largest) < largest {
+			stats.Largest = append(stats.Largest, EntrySize{})
+		}
+		copy(stats.Largest[i+1:], stats.Largest[i:])
+		stats.Largest[i] = e
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
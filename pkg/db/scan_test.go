@@ -0,0 +1,129 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package db
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/heketi/tests"
+)
+
+func sampleScanDb(t *testing.T, tmpfile string) *bolt.DB {
+	db, err := bolt.Open(tmpfile, 0600, &bolt.Options{Timeout: 3 * time.Second})
+	tests.Assert(t, err == nil, "expected (bolt.Open) err == nil, got:", err)
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket([]byte("FRUIT"))
+		tests.Assert(t, err == nil)
+		for k, v := range map[string]string{
+			"apple":   "1",
+			"apricot": "22",
+			"avocado": "333333",
+			"banana":  "4444",
+			"cherry":  "55555",
+		} {
+			err := b.Put([]byte(k), []byte(v))
+			tests.Assert(t, err == nil)
+		}
+		_, err = b.CreateBucket([]byte("anested"))
+		tests.Assert(t, err == nil)
+
+		_, err = tx.CreateBucket([]byte("EMPTY"))
+		tests.Assert(t, err == nil)
+		return nil
+	})
+	tests.Assert(t, err == nil)
+	return db
+}
+
+func TestScanPrefix(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	db := sampleScanDb(t, tmpfile)
+	defer db.Close()
+
+	db.View(func(tx *bolt.Tx) error {
+		keys := []string{}
+		err := ScanPrefix(tx, "FRUIT", []byte("a"), func(k, v []byte) error {
+			keys = append(keys, string(k))
+			return nil
+		})
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, strings.Join(keys, ",") == "apple,apricot,avocado", keys)
+
+		// Every entry without a prefix, nested buckets skipped
+		keys = []string{}
+		err = ScanPrefix(tx, "FRUIT", nil, func(k, v []byte) error {
+			keys = append(keys, string(k))
+			return nil
+		})
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, len(keys) == 5, keys)
+
+		// No match
+		err = ScanPrefix(tx, "FRUIT", []byte("z"), func(k, v []byte) error {
+			t.Errorf("unexpected key %s", k)
+			return nil
+		})
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+		err = ScanPrefix(tx, "VEGETABLE", nil, func(k, v []byte) error {
+			return nil
+		})
+		tests.Assert(t, err != nil, "expected err != nil")
+
+		names := BucketNames(tx)
+		tests.Assert(t, len(names) == 2, names)
+		tests.Assert(t, names[0] == "EMPTY" && names[1] == "FRUIT", names)
+		return nil
+	})
+}
+
+func TestGetBucketStats(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	db := sampleScanDb(t, tmpfile)
+	defer db.Close()
+
+	db.View(func(tx *bolt.Tx) error {
+		stats, err := GetBucketStats(tx, "FRUIT", nil, 2)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, stats.Name == "FRUIT")
+		tests.Assert(t, stats.Entries == 5, stats.Entries)
+		tests.Assert(t, stats.Size == 6+9+13+10+11, stats.Size)
+		tests.Assert(t, len(stats.Largest) == 2, stats.Largest)
+		tests.Assert(t, stats.Largest[0].Key == "avocado", stats.Largest)
+		tests.Assert(t, stats.Largest[0].Size == 13, stats.Largest)
+		tests.Assert(t, stats.Largest[1].Key == "cherry", stats.Largest)
+
+		stats, err = GetBucketStats(tx, "FRUIT", []byte("ap"), 5)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, stats.Entries == 2, stats.Entries)
+		tests.Assert(t, len(stats.Largest) == 2, stats.Largest)
+		tests.Assert(t, stats.Largest[0].Key == "apricot", stats.Largest)
+		tests.Assert(t, stats.Largest[1].Key == "apple", stats.Largest)
+
+		stats, err = GetBucketStats(tx, "EMPTY", nil, 5)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, stats.Entries == 0, stats.Entries)
+		tests.Assert(t, len(stats.Largest) == 0, stats.Largest)
+
+		stats, err = GetBucketStats(tx, "FRUIT", nil, 0)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, len(stats.Largest) == 0, stats.Largest)
+		return nil
+	})
+}
@@ -0,0 +1,29 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+// +build faults
+
+package faults
+
+import (
+	"os"
+	"sync/atomic"
+)
+
+// Binaries built with the faults tag can always inject faults, the
+// faults listed in HEKETI_FAULTS being injected at start. Without the
+// tag faults are never enabled, whatever the environment.
+func init() {
+	atomic.StoreInt32(&enabled, 1)
+	if spec := os.Getenv("HEKETI_FAULTS"); spec != "" {
+		if err := InjectSpec(spec); err != nil {
+			logger.LogError("Unable to inject faults of HEKETI_FAULTS: %v", err)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+// Package faults is a registry of faults injected at code points of
+// heketi to test how failures are handled, such as the rollbacks of
+// operations. Faults are only injected by binaries built with the
+// faults build tag, which inject the faults listed in HEKETI_FAULTS.
+// Otherwise checking a code point only loads a flag.
+package faults
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/heketi/heketi/pkg/utils"
+)
+
+var (
+	ErrInjected = errors.New("Injected fault")
+	ErrDisabled = errors.New("Fault injection is not enabled")
+
+	logger = utils.NewLogger("[faults]", utils.LEVEL_INFO)
+
+	// Non-zero when faults can be injected
+	enabled int32
+
+	lock   sync.Mutex
+	points = map[string]*point{}
+)
+
+// Fault makes a code point fail
+type Fault struct {
+	// Number of times the code point passes before it fails
+	Skip int
+	// Number of times the code point fails, every time if 0
+	Count int
+	// Error returned by the code point, ErrInjected if nil
+	Err error
+}
+
+type point struct {
+	fault  Fault
+	hits   int
+	failed int
+}
+
+// Enabled returns true if faults can be injected
+func Enabled() bool {
+	return atomic.LoadInt32(&enabled) != 0
+}
+
+// SetEnabled allows or forbids injecting faults, for the unit tests of
+// other packages. Faults already injected are removed when forbidden.
+func SetEnabled(e bool) {
+	if e {
+		atomic.StoreInt32(&enabled, 1)
+	} else {
+		atomic.StoreInt32(&enabled, 0)
+		Reset()
+	}
+}
+
+// Inject makes the code point fail, replacing any fault injected at it
+func Inject(name string, f Fault) error {
+	if !Enabled() {
+		return ErrDisabled
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	points[name] = &point{fault: f}
+	logger.Info("Fault injected at %v: skip %v, count %v", name, f.Skip, f.Count)
+	return nil
+}
+
+// InjectSpec injects the faults of a comma separated list of code
+// points. A code point followed by :N only fails the Nth time it is
+// reached, for example "brick-save:3,executor-volume-replace-brick".
+func InjectSpec(spec string) error {
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		f := Fault{}
+		name := item
+		if i := strings.Index(item, ":"); i >= 0 {
+			name = item[:i]
+			n, err := strconv.Atoi(item[i+1:])
+			if err != nil || n < 1 {
+				return fmt.Errorf("Invalid fault %q", item)
+			}
+			f.Skip = n - 1
+			f.Count = 1
+		}
+		if name == "" {
+			return fmt.Errorf("Invalid fault %q", item)
+		}
+		if err := Inject(name, f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Remove removes the fault injected at the code point
+func Remove(name string) {
+	lock.Lock()
+	defer lock.Unlock()
+	delete(points, name)
+}
+
+// Reset removes all the faults
+func Reset() {
+	lock.Lock()
+	defer lock.Unlock()
+	points = map[string]*point{}
+}
+
+// Hits returns the number of times the code point was reached since
+// its fault was injected
+func Hits(name string) int {
+	lock.Lock()
+	defer lock.Unlock()
+	if p, ok := points[name]; ok {
+		return p.hits
+	}
+	return 0
+}
+
+// Check is called by a code point when it is reached. It returns the
+// error of the fault injected at the code point, if it fails this time.
+func Check(name string) error {
+	if !Enabled() {
+		return nil
+	}
+	lock.Lock()
+	defer lock.Unlock()
+
+	p, ok := points[name]
+	if !ok {
+		return nil
+	}
+	p.hits++
+	if p.hits <= p.fault.Skip {
+		return nil
+	}
+	if p.fault.Count != 0 && p.failed >= p.fault.Count {
+		return nil
+	}
+	p.failed++
+	logger.Warning("Injecting fault at %v, hit %v", name, p.hits)
+	if p.fault.Err != nil {
+		return p.fault.Err
+	}
+	return ErrInjected
+}
@@ -0,0 +1,70 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package faults
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/heketi/tests"
+)
+
+func TestFaultsDisabled(t *testing.T) {
+	SetEnabled(false)
+
+	tests.Assert(t, !Enabled())
+	tests.Assert(t, Inject("a", Fault{}) == ErrDisabled)
+	tests.Assert(t, Check("a") == nil)
+	tests.Assert(t, Hits("a") == 0)
+}
+
+func TestFaultsCheck(t *testing.T) {
+	SetEnabled(true)
+	defer SetEnabled(false)
+
+	// Every time
+	tests.Assert(t, Inject("a", Fault{}) == nil)
+	tests.Assert(t, Check("a") == ErrInjected)
+	tests.Assert(t, Check("a") == ErrInjected)
+	tests.Assert(t, Hits("a") == 2)
+	tests.Assert(t, Check("b") == nil)
+
+	// Only the third time
+	bzzt := errors.New("bzzt")
+	tests.Assert(t, Inject("a", Fault{Skip: 2, Count: 1, Err: bzzt}) == nil)
+	tests.Assert(t, Check("a") == nil)
+	tests.Assert(t, Check("a") == nil)
+	tests.Assert(t, Check("a") == bzzt)
+	tests.Assert(t, Check("a") == nil)
+	tests.Assert(t, Hits("a") == 4)
+
+	Remove("a")
+	tests.Assert(t, Check("a") == nil)
+	tests.Assert(t, Hits("a") == 0)
+}
+
+func TestFaultsInjectSpec(t *testing.T) {
+	SetEnabled(true)
+	defer SetEnabled(false)
+
+	tests.Assert(t, InjectSpec("a:2, b") == nil)
+	tests.Assert(t, Check("a") == nil)
+	tests.Assert(t, Check("a") == ErrInjected)
+	tests.Assert(t, Check("a") == nil)
+	tests.Assert(t, Check("b") == ErrInjected)
+	tests.Assert(t, Check("b") == ErrInjected)
+
+	tests.Assert(t, InjectSpec("a:0") != nil)
+	tests.Assert(t, InjectSpec("a:x") != nil)
+	tests.Assert(t, InjectSpec(":1") != nil)
+
+	Reset()
+	tests.Assert(t, Check("b") == nil)
+}
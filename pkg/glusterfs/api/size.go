@@ -0,0 +1,65 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), as published by the Free Software Foundation,
+// or under the Apache License, Version 2.0 <LICENSE-APACHE2 or
+// http://www.apache.org/licenses/LICENSE-2.0>.
+//
+// You may not use this file except in compliance with those terms.
+//
+
+package api
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/go-ozzo/ozzo-validation"
+)
+
+// SizeGiB returns the size in MiB rounded up to whole GiB
+func SizeGiB(sizeMiB int) int {
+	return (sizeMiB + 1023) / 1024
+}
+
+// ParseSizeMiB converts a size such as "512MiB", "1.5GiB" or "2TiB"
+// to MiB. Sizes without a unit are in GiB and may be fractional.
+func ParseSizeMiB(size string) (int, error) {
+	units := []struct {
+		suffix string
+		mib    float64
+	}{
+		{"MiB", 1},
+		{"GiB", 1 << 10},
+		{"TiB", 1 << 20},
+	}
+
+	s := strings.TrimSpace(size)
+	multiplier := float64(1 << 10)
+	for _, u := range units {
+		if strings.HasSuffix(s, u.suffix) {
+			s = strings.TrimSpace(strings.TrimSuffix(s, u.suffix))
+			multiplier = u.mib
+			break
+		}
+	}
+
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil || value <= 0 {
+		return 0, fmt.Errorf("invalid size: %v", size)
+	}
+	return int(math.Ceil(value * multiplier)), nil
+}
+
+// sizeRules returns the validation rules of the size in GiB of a
+// request, which is only required if no size in MiB is given
+func sizeRules(sizeMiB int) []validation.Rule {
+	if sizeMiB != 0 {
+		return []validation.Rule{validation.Min(0)}
+	}
+	return []validation.Rule{validation.Required, validation.Min(1)}
+}
@@ -20,6 +20,9 @@ import (
 	"fmt"
 	"regexp"
 	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-ozzo/ozzo-validation"
 	"github.com/go-ozzo/ozzo-validation/is"
@@ -35,8 +38,45 @@ var (
 	volumeNameRe = regexp.MustCompile("^[a-zA-Z0-9_-]+$")
 
 	blockVolNameRe = regexp.MustCompile("^[a-zA-Z0-9_-]+$")
+
+	// Gluster appends a timestamp such as "_GMT-2018.01.01-10.10.10"
+	// to snapshot names by default so dots must be allowed as well
+	snapshotNameRe = regexp.MustCompile("^[a-zA-Z0-9_.-]+$")
+
+	// Octal file mode as accepted by chmod, e.g. "2775"
+	permissionsRe = regexp.MustCompile("^[0-7]{3,4}$")
+
+	// SELinux context such as "system_u:object_r:glusterd_brick_t:s0"
+	selinuxContextRe = regexp.MustCompile("^[a-zA-Z0-9_.:,-]+$")
+
+	// Tag keys such as "rack" or "example.com/media"
+	tagKeyRe = regexp.MustCompile("^[a-zA-Z0-9_./-]+$")
+
+	// Gluster volume option names such as "performance.cache-size"
+	volumeOptionNameRe = regexp.MustCompile("^[a-zA-Z0-9_.-]+$")
+
+	// Directories of a volume with a quota, relative to the root of the
+	// volume, e.g. "/" or "/tenants/a"
+	quotaPathRe = regexp.MustCompile("^/[a-zA-Z0-9_./-]*$")
+
+	// Names of the tenants and subjects of the tokens of their users
+	tenantNameRe = regexp.MustCompile("^[a-zA-Z0-9_.@-]{1,64}$")
 )
 
+// ValidateTags checks the keys and values of tags of nodes and devices
+func ValidateTags(value interface{}) error {
+	tags, _ := value.(map[string]string)
+	for k, v := range tags {
+		if !tagKeyRe.MatchString(k) {
+			return fmt.Errorf("invalid tag key %q", k)
+		}
+		if len(v) > 255 {
+			return fmt.Errorf("value of tag %q is longer than 255 characters", k)
+		}
+	}
+	return nil
+}
+
 // ValidateUUID is written this way because heketi UUID does not
 // conform to neither UUID v4 nor v5.
 func ValidateUUID(value interface{}) error {
@@ -56,11 +96,17 @@ const (
 	EntryStateOnline  EntryState = "online"
 	EntryStateOffline EntryState = "offline"
 	EntryStateFailed  EntryState = "failed"
+	// Like offline, the node or device keeping its bricks but getting
+	// no new bricks, while its bricks are moved away or while it is
+	// under maintenance
+	EntryStateDraining    EntryState = "draining"
+	EntryStateMaintenance EntryState = "maintenance"
 )
 
 func ValidateEntryState(value interface{}) error {
 	s, _ := value.(EntryState)
-	err := validation.Validate(s, validation.Required, validation.In(EntryStateOnline, EntryStateOffline, EntryStateFailed))
+	err := validation.Validate(s, validation.Required, validation.In(EntryStateOnline, EntryStateOffline, EntryStateFailed,
+		EntryStateDraining, EntryStateMaintenance))
 	if err != nil {
 		return fmt.Errorf("%v is not valid state", s)
 	}
@@ -84,14 +130,90 @@ func ValidateDurabilityType(value interface{}) error {
 	return nil
 }
 
+// Reasons a node or device was taken offline or failed
+type StateReasonCode string
+
+const (
+	StateReasonMaintenance     StateReasonCode = "maintenance"
+	StateReasonHardwareFailure StateReasonCode = "hardware-failure"
+	StateReasonUnreachable     StateReasonCode = "unreachable"
+	StateReasonDecommissioned  StateReasonCode = "decommissioned"
+	StateReasonOther           StateReasonCode = "other"
+	// Recorded by the server when the node or device is removed
+	StateReasonRemoved StateReasonCode = "removed"
+)
+
+func ValidateStateReasonCode(value interface{}) error {
+	s, _ := value.(StateReasonCode)
+	err := validation.Validate(s, validation.In(StateReasonMaintenance,
+		StateReasonHardwareFailure, StateReasonUnreachable,
+		StateReasonDecommissioned, StateReasonOther))
+	if err != nil {
+		return fmt.Errorf("%v is not a valid reason", s)
+	}
+	return nil
+}
+
+// Why, by whom and when a node or device was taken to its state
+type StateReason struct {
+	Code    StateReasonCode `json:"code"`
+	Message string          `json:"message,omitempty"`
+	// Subject, or else issuer, of the token of the request. Empty
+	// when authentication is disabled.
+	Actor string `json:"actor,omitempty"`
+	// Seconds since the epoch
+	Time int64 `json:"time"`
+}
+
 // Common
 type StateRequest struct {
 	State EntryState `json:"state"`
+	// Required unless the state is online
+	Reason StateReasonCode `json:"reason,omitempty"`
+	// Required if the reason is other
+	Message string `json:"message,omitempty"`
 }
 
 func (statereq StateRequest) Validate() error {
-	return validation.ValidateStruct(&statereq,
+	err := validation.ValidateStruct(&statereq,
 		validation.Field(&statereq.State, validation.Required, validation.By(ValidateEntryState)),
+		validation.Field(&statereq.Reason, validation.By(ValidateStateReasonCode)),
+		validation.Field(&statereq.Message, validation.Length(0, 1024)),
+	)
+	if err != nil {
+		return err
+	}
+	if statereq.State != EntryStateOnline && statereq.Reason == "" {
+		return fmt.Errorf("a reason is required to move to %v state", statereq.State)
+	}
+	if statereq.Reason == StateReasonOther && statereq.Message == "" {
+		return fmt.Errorf("a message is required for reason %v", StateReasonOther)
+	}
+	return nil
+}
+
+// Tags
+type TagsChangeType string
+
+const (
+	// Replace all the tags
+	SetTags TagsChangeType = "set"
+	// Add the tags, replacing the values of existing keys
+	UpdateTags TagsChangeType = "update"
+	// Remove the keys of the tags
+	DeleteTags TagsChangeType = "delete"
+)
+
+type TagsChangeRequest struct {
+	Tags   map[string]string `json:"tags"`
+	Change TagsChangeType    `json:"change_type"`
+}
+
+func (tcr TagsChangeRequest) Validate() error {
+	return validation.ValidateStruct(&tcr,
+		validation.Field(&tcr.Tags, validation.By(ValidateTags)),
+		validation.Field(&tcr.Change, validation.Required,
+			validation.In(SetTags, UpdateTags, DeleteTags)),
 	)
 }
 
@@ -100,6 +222,8 @@ type StorageSize struct {
 	Total uint64 `json:"total"`
 	Free  uint64 `json:"free"`
 	Used  uint64 `json:"used"`
+	// Space used by snapshots beyond what was reserved for them
+	SnapshotOverhead uint64 `json:"snapshot_overhead,omitempty"`
 }
 
 type HostAddresses struct {
@@ -146,6 +270,45 @@ type BrickInfo struct {
 
 	// Size in KB
 	Size uint64 `json:"size"`
+
+	// Set in the responses only
+	Lvm *BrickLvmInfo `json:"lvm,omitempty"`
+}
+
+type BrickListResponse struct {
+	Bricks []string `json:"bricks"`
+	// Bricks matching the filters of the request, before paging
+	Total int `json:"total,omitempty"`
+}
+
+// BrickDestination directs the new bricks replacing bricks to a device,
+// or to the online devices of a node, instead of the devices picked by
+// the allocator. It is set in the query of the replace requests.
+type BrickDestination struct {
+	Device string `json:"destination_device,omitempty"`
+	Node   string `json:"destination_node,omitempty"`
+}
+
+func (dest BrickDestination) Validate() error {
+	if dest.Device != "" && dest.Node != "" {
+		return fmt.Errorf("only one of destination_device and destination_node can be set")
+	}
+	return validation.ValidateStruct(&dest,
+		validation.Field(&dest.Device, validation.By(ValidateUUID)),
+		validation.Field(&dest.Node, validation.By(ValidateUUID)),
+	)
+}
+
+// LVM objects backing a brick. The logical volumes of the bricks of
+// clones and restored snapshots are named by gluster and left out.
+type BrickLvmInfo struct {
+	// Name of the device of the volume group, e.g. /dev/sdb
+	Device   string `json:"device"`
+	Vg       string `json:"vg"`
+	ThinPool string `json:"thinpool,omitempty"`
+	Lv       string `json:"lv,omitempty"`
+	// Device node of the logical volume of the brick
+	LvDevice string `json:"lv_device,omitempty"`
 }
 
 // Device
@@ -162,12 +325,22 @@ func (dev Device) Validate() error {
 type DeviceAddRequest struct {
 	Device
 	NodeId string `json:"node"`
+
+	// Tags of the device, overriding the tags of its node with the
+	// same keys
+	Tags map[string]string `json:"tags,omitempty"`
+
+	// Enclosure, such as an external JBOD, grouping the device with
+	// devices of the same or other nodes
+	Enclosure string `json:"enclosure,omitempty"`
 }
 
 func (devAddReq DeviceAddRequest) Validate() error {
 	return validation.ValidateStruct(&devAddReq,
 		validation.Field(&devAddReq.Device, validation.Required),
 		validation.Field(&devAddReq.NodeId, validation.Required, validation.By(ValidateUUID)),
+		validation.Field(&devAddReq.Tags, validation.By(ValidateTags)),
+		validation.Field(&devAddReq.Enclosure, validation.Match(tagKeyRe)),
 	)
 }
 
@@ -179,15 +352,79 @@ type DeviceInfo struct {
 
 type DeviceInfoResponse struct {
 	DeviceInfo
-	State  EntryState  `json:"state"`
-	Bricks []BrickInfo `json:"bricks"`
+	State EntryState `json:"state"`
+	// Why the device was taken offline or failed, unset while online
+	StateReason *StateReason      `json:"state_reason,omitempty"`
+	Bricks      []BrickInfo       `json:"bricks"`
+	Tags        map[string]string `json:"tags,omitempty"`
+	Enclosure   string            `json:"enclosure,omitempty"`
+}
+
+// Enclosure of a device, empty to remove the device from its enclosure
+type DeviceEnclosureRequest struct {
+	Enclosure string `json:"enclosure"`
+}
+
+func (req DeviceEnclosureRequest) Validate() error {
+	return validation.ValidateStruct(&req,
+		validation.Field(&req.Enclosure, validation.Match(tagKeyRe)),
+	)
+}
+
+// Result of resyncing a device with the volume group found by LVM
+type DeviceResyncResponse struct {
+	Id string `json:"id"`
+	// Storage of the device before and after the resync
+	OldStorage StorageSize `json:"old_storage"`
+	Storage    StorageSize `json:"storage"`
+	// Volume group of the device, sizes in KB
+	VgSize      uint64 `json:"vg_size"`
+	ExtentSize  uint64 `json:"extent_size"`
+	FreeExtents uint64 `json:"free_extents"`
+	// Logical volumes of the volume group not used by any brick
+	OrphanedLvs []string `json:"orphaned_lvs,omitempty"`
+}
+
+// Logical volumes of a brick in the volume group of its device. The
+// logical volumes of the bricks of clones and restored snapshots are
+// named by gluster.
+type DeviceLvmBrick struct {
+	Id       string `json:"id"`
+	VolumeId string `json:"volume"`
+	ThinPool string `json:"thinpool,omitempty"`
+	Lv       string `json:"lv,omitempty"`
+	Path     string `json:"path"`
+}
+
+// Volume group and logical volumes of a device
+type DeviceLvmResponse struct {
+	Id     string           `json:"id"`
+	Name   string           `json:"name"`
+	NodeId string           `json:"node"`
+	Vg     string           `json:"vg"`
+	Bricks []DeviceLvmBrick `json:"bricks"`
 }
 
 // Node
+
+// Address families of the storage address gluster uses for a node
+const (
+	AddressFamilyInet  = "inet"
+	AddressFamilyInet6 = "inet6"
+)
+
 type NodeAddRequest struct {
 	Zone      int           `json:"zone"`
 	Hostnames HostAddresses `json:"hostnames"`
 	ClusterId string        `json:"cluster"`
+
+	// Address family of the storage hostname used by gluster when the
+	// node has both IPv4 and IPv6 storage addresses
+	AddressFamily string `json:"address_family,omitempty"`
+
+	// Tags of the node, also applying to its devices unless a device
+	// has a tag with the same key
+	Tags map[string]string `json:"tags,omitempty"`
 }
 
 func (req NodeAddRequest) Validate() error {
@@ -195,18 +432,106 @@ func (req NodeAddRequest) Validate() error {
 		validation.Field(&req.Zone, validation.Required, validation.Min(1)),
 		validation.Field(&req.Hostnames, validation.Required),
 		validation.Field(&req.ClusterId, validation.Required, validation.By(ValidateUUID)),
+		validation.Field(&req.AddressFamily, validation.In(AddressFamilyInet, AddressFamilyInet6)),
+		validation.Field(&req.Tags, validation.By(ValidateTags)),
 	)
 }
 
 type NodeInfo struct {
 	NodeAddRequest
 	Id string `json:"id"`
+
+	// Address the management hostname last resolved to
+	ManageAddress string `json:"manage_address,omitempty"`
+}
+
+// Types of node health events
+const (
+	NodeEventResolutionFailed = "resolution_failed"
+	NodeEventHostnameFailover = "hostname_failover"
+	NodeEventAddressChanged   = "address_changed"
+)
+
+type NodeHealthEvent struct {
+	// Seconds since the epoch
+	Time    int64  `json:"time"`
+	Type    string `json:"type"`
+	Message string `json:"message"`
 }
 
 type NodeInfoResponse struct {
 	NodeInfo
-	State       EntryState           `json:"state"`
-	DevicesInfo []DeviceInfoResponse `json:"devices"`
+	State EntryState `json:"state"`
+	// Why the node was taken offline or failed, unset while online
+	StateReason  *StateReason         `json:"state_reason,omitempty"`
+	DevicesInfo  []DeviceInfoResponse `json:"devices"`
+	HealthEvents []NodeHealthEvent    `json:"health_events,omitempty"`
+}
+
+// States of a node removal and of the bricks migrated by it
+const (
+	NodeRemoveRunning = "running"
+	NodeRemoveDone    = "done"
+	NodeRemoveFailed  = "failed"
+
+	BrickMigrationPending = "pending"
+	BrickMigrationDone    = "done"
+	BrickMigrationSkipped = "skipped"
+	BrickMigrationFailed  = "failed"
+)
+
+type BrickMigrationInfo struct {
+	BrickId  string `json:"brick"`
+	VolumeId string `json:"volume"`
+	DeviceId string `json:"device"`
+	State    string `json:"state"`
+	Message  string `json:"message,omitempty"`
+}
+
+type NodeRemoveProgress struct {
+	NodeId string `json:"node"`
+	State  string `json:"state"`
+	// Seconds since the epoch
+	Started  int64                `json:"started"`
+	Finished int64                `json:"finished,omitempty"`
+	Message  string               `json:"message,omitempty"`
+	Bricks   []BrickMigrationInfo `json:"bricks"`
+}
+
+const (
+	BrickRestartRunning = "running"
+	BrickRestartDone    = "done"
+	BrickRestartFailed  = "failed"
+	BrickRestartPending = "pending"
+)
+
+type NodeBrickRestartRequest struct {
+	// Seconds to wait for the heals of each volume to complete before
+	// the bricks of the next volume are restarted, 0 for the default
+	HealTimeout int `json:"heal_timeout,omitempty"`
+}
+
+func (req NodeBrickRestartRequest) Validate() error {
+	return validation.ValidateStruct(&req,
+		validation.Field(&req.HealTimeout, validation.Min(0)),
+	)
+}
+
+type VolumeBrickRestartInfo struct {
+	VolumeId string `json:"volume"`
+	Name     string `json:"name"`
+	State    string `json:"state"`
+	Message  string `json:"message,omitempty"`
+}
+
+type NodeBrickRestartProgress struct {
+	NodeId string `json:"node"`
+	State  string `json:"state"`
+	// Seconds since the epoch
+	Started  int64                    `json:"started"`
+	Finished int64                    `json:"finished,omitempty"`
+	Message  string                   `json:"message,omitempty"`
+	Volumes  []VolumeBrickRestartInfo `json:"volumes"`
 }
 
 // Cluster
@@ -227,12 +552,154 @@ type TopologyInfoResponse struct {
 	ClusterList []Cluster `json:"clusters"`
 }
 
+// Topology load
+
+// Results of the clusters, nodes and devices of a topology load
+const (
+	TopologyLoadCreated = "created"
+	TopologyLoadExists  = "exists"
+	TopologyLoadFailed  = "failed"
+)
+
+// Types of the items of a topology load
+const (
+	TopologyLoadCluster = "cluster"
+	TopologyLoadNode    = "node"
+	TopologyLoadDevice  = "device"
+)
+
+// TopologyLoadRequest is the topology file loaded by heketi-cli
+type TopologyLoadRequest struct {
+	Clusters []TopologyLoadClusterRequest `json:"clusters"`
+}
+
+func (req TopologyLoadRequest) Validate() error {
+	return validation.ValidateStruct(&req,
+		validation.Field(&req.Clusters, validation.Required),
+	)
+}
+
+type TopologyLoadClusterRequest struct {
+	Nodes []TopologyLoadNodeRequest `json:"nodes"`
+	// File and block volumes are allowed unless set to false
+	Block *bool `json:"block,omitempty"`
+	File  *bool `json:"file,omitempty"`
+}
+
+func (req TopologyLoadClusterRequest) Validate() error {
+	return validation.ValidateStruct(&req,
+		validation.Field(&req.Nodes, validation.Required),
+	)
+}
+
+type TopologyLoadNodeRequest struct {
+	Devices []string `json:"devices"`
+	// The cluster of the node is set by the server
+	Node NodeAddRequest `json:"node"`
+}
+
+func (req TopologyLoadNodeRequest) Validate() error {
+	node := req.Node
+	err := validation.ValidateStruct(&node,
+		validation.Field(&node.Zone, validation.Required, validation.Min(1)),
+		validation.Field(&node.Hostnames, validation.Required),
+	)
+	if err != nil {
+		return err
+	}
+	for _, name := range req.Devices {
+		if err := (Device{Name: name}).Validate(); err != nil {
+			return fmt.Errorf("device %v: %v", name, err)
+		}
+	}
+	return nil
+}
+
+type TopologyLoadResult struct {
+	Type string `json:"type"`
+	// Management hostname of the nodes and name of the devices
+	Name string `json:"name,omitempty"`
+	Id   string `json:"id,omitempty"`
+	// Management hostname of the node of a device
+	Node    string `json:"node,omitempty"`
+	Result  string `json:"result"`
+	Message string `json:"message,omitempty"`
+}
+
+type TopologyLoadResponse struct {
+	Results []TopologyLoadResult `json:"results"`
+}
+
+// Topology diff
+
+// Differences between a topology and the nodes and devices in the db
+const (
+	// In the topology, not in the db
+	TopologyDiffAdd = "add"
+	// In the topology and in the db, not found on the node
+	TopologyDiffMissing = "missing"
+	// In the db, not in the topology
+	TopologyDiffRemove = "remove"
+
+	// Result of a node or device removed to converge to the topology
+	TopologyDiffRemoved = "removed"
+)
+
+type TopologyDiffRequest struct {
+	Topology TopologyLoadRequest `json:"topology"`
+	// Add the nodes and devices missing from the db and remove the
+	// ones not in the topology
+	Apply bool `json:"apply,omitempty"`
+}
+
+func (req TopologyDiffRequest) Validate() error {
+	return validation.ValidateStruct(&req,
+		validation.Field(&req.Topology),
+	)
+}
+
+type TopologyDiffItem struct {
+	Type   string `json:"type"`
+	Change string `json:"change"`
+	// Management hostname of the nodes and name of the devices
+	Name string `json:"name"`
+	Id   string `json:"id,omitempty"`
+	// Management hostname of the node of a device
+	Node string `json:"node,omitempty"`
+	// Result of the change when the diff is applied
+	Result  string `json:"result,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type TopologyDiffResponse struct {
+	Changes []TopologyDiffItem `json:"changes"`
+	Applied bool               `json:"applied"`
+}
+
+// SELinux handling of the bricks created in a cluster, on the nodes
+// with SELinux enabled
+type ClusterSelinux struct {
+	// Label the root of the bricks with the SELinux context of gluster
+	// bricks unless the volume sets one, and check the label was set
+	Check bool `json:"check"`
+	// Turn on the SELinux booleans of the server settings on the nodes
+	Booleans bool `json:"booleans"`
+}
+
 type ClusterCreateRequest struct {
 	ClusterFlags
+
+	// Create the cluster as a standby cluster
+	Standby bool `json:"standby,omitempty"`
+
+	Selinux ClusterSelinux `json:"selinux"`
 }
 
 type ClusterSetFlagsRequest struct {
 	ClusterFlags
+
+	// Unchanged if not set
+	Selinux *ClusterSelinux `json:"selinux,omitempty"`
 }
 
 type ClusterInfoResponse struct {
@@ -241,114 +708,1502 @@ type ClusterInfoResponse struct {
 	Volumes sort.StringSlice `json:"volumes"`
 	ClusterFlags
 	BlockVolumes sort.StringSlice `json:"blockvolumes"`
+
+	// Standby clusters, such as the clusters of a disaster recovery
+	// site, are not selected for new volumes unless requested by id
+	Standby bool `json:"standby"`
+
+	// Allocator used to place the bricks in the cluster
+	Allocator string `json:"allocator,omitempty"`
+
+	Selinux ClusterSelinux `json:"selinux"`
+
+	// Computed when the cluster information is requested
+	Capacity *ClusterCapacity `json:"capacity,omitempty"`
+}
+
+// Capacity of the devices and volumes of a cluster
+type ClusterCapacity struct {
+	// Storage of all the devices of the cluster
+	Devices StorageSize `json:"devices"`
+	// Sum of the capacities of the volumes of the cluster
+	Volumes VolumeCapacity `json:"volumes"`
 }
 
 type ClusterListResponse struct {
 	Clusters []string `json:"clusters"`
 }
 
-// Durabilities
-type ReplicaDurability struct {
-	Replica int `json:"replica,omitempty"`
+// Allocated capacity of the devices of a cluster on a day, sizes in KB
+type ClusterCapacitySample struct {
+	// Day of the sample, in UTC
+	Day string `json:"day"`
+	// Time of the last sample of the day
+	Time  int64  `json:"time"`
+	Total uint64 `json:"total"`
+	Used  uint64 `json:"used"`
 }
 
-type DisperseDurability struct {
-	Data       int `json:"data,omitempty"`
-	Redundancy int `json:"redundancy,omitempty"`
+// Projection of the time until the devices of a cluster are full,
+// sizes in KB
+type ClusterCapacityForecastResponse struct {
+	Id    string `json:"id"`
+	Total uint64 `json:"total"`
+	Used  uint64 `json:"used"`
+	// Days of history the forecast is based on, and their samples
+	Days    int                     `json:"days"`
+	Samples []ClusterCapacitySample `json:"samples"`
+	// Growth of the used capacity per day
+	GrowthPerDay int64 `json:"growth_per_day"`
+	// Days until the cluster is full, -1 when the used capacity is not
+	// growing or there are not enough samples
+	DaysToFull int    `json:"days_to_full"`
+	FullDate   string `json:"full_date,omitempty"`
 }
 
-// Volume
-type VolumeDurabilityInfo struct {
-	Type      DurabilityType     `json:"type,omitempty"`
-	Replicate ReplicaDurability  `json:"replicate,omitempty"`
-	Disperse  DisperseDurability `json:"disperse,omitempty"`
+// Capacity of the devices of a node or a cluster, sizes in KB
+type StorageCapacityReport struct {
+	// Size of the devices
+	Raw uint64 `json:"raw"`
+	// Space of the devices allocated to bricks, the thin pool
+	// metadata of the bricks included
+	Allocated uint64 `json:"allocated"`
+	// Space reserved for the thin pool metadata of the bricks
+	MetadataReserved uint64 `json:"metadata_reserved"`
+	// Space of the online devices that new bricks can use
+	Free uint64 `json:"free"`
 }
 
-type VolumeCreateRequest struct {
-	// Size in GiB
-	Size                 int                  `json:"size"`
-	Clusters             []string             `json:"clusters,omitempty"`
-	Name                 string               `json:"name"`
-	Durability           VolumeDurabilityInfo `json:"durability,omitempty"`
-	Gid                  int64                `json:"gid,omitempty"`
-	GlusterVolumeOptions []string             `json:"glustervolumeoptions,omitempty"`
-	Block                bool                 `json:"block,omitempty"`
-	Snapshot             struct {
-		Enable bool    `json:"enable"`
-		Factor float32 `json:"factor"`
-	} `json:"snapshot"`
+type NodeCapacityReport struct {
+	Id       string     `json:"id"`
+	Hostname string     `json:"hostname"`
+	Zone     int        `json:"zone"`
+	State    EntryState `json:"state"`
+	StorageCapacityReport
+	// Size of the largest brick the online devices of the node can
+	// hold, zero if the node is not online
+	MaxBrickSize uint64 `json:"max_brick_size"`
 }
 
-func (volCreateRequest VolumeCreateRequest) Validate() error {
-	return validation.ValidateStruct(&volCreateRequest,
-		validation.Field(&volCreateRequest.Size, validation.Required, validation.Min(1)),
-		validation.Field(&volCreateRequest.Clusters, validation.By(ValidateUUID)),
-		validation.Field(&volCreateRequest.Name, validation.Match(volumeNameRe)),
-		validation.Field(&volCreateRequest.Durability, validation.Skip),
-		validation.Field(&volCreateRequest.Gid, validation.Skip),
-		validation.Field(&volCreateRequest.GlusterVolumeOptions, validation.Skip),
-		validation.Field(&volCreateRequest.Block, validation.In(true, false)),
-		// This is possibly a bug in validation lib, ignore next two lines for now
-		// validation.Field(&volCreateRequest.Snapshot.Enable, validation.In(true, false)),
-		// validation.Field(&volCreateRequest.Snapshot.Factor, validation.Min(1.0)),
-	)
+type ClusterCapacityReport struct {
+	Id string `json:"id"`
+	StorageCapacityReport
+	// Estimated size of the largest replica 3 volume the online nodes
+	// of the cluster can hold, each set of the volume having its
+	// bricks on three different nodes
+	MaxReplica3VolumeSize uint64               `json:"max_replica3_volume_size"`
+	Nodes                 []NodeCapacityReport `json:"nodes"`
 }
 
-type VolumeInfo struct {
-	VolumeCreateRequest
-	Id      string `json:"id"`
-	Cluster string `json:"cluster"`
-	Mount   struct {
-		GlusterFS struct {
-			Hosts      []string          `json:"hosts"`
-			MountPoint string            `json:"device"`
-			Options    map[string]string `json:"options"`
-		} `json:"glusterfs"`
-	} `json:"mount"`
-	BlockInfo struct {
-		FreeSize     int              `json:"freesize,omitempty"`
-		BlockVolumes sort.StringSlice `json:"blockvolume,omitempty"`
-	} `json:"blockinfo,omitempty"`
+type CapacityReportResponse struct {
+	Clusters []ClusterCapacityReport `json:"clusters"`
 }
 
-type VolumeInfoResponse struct {
-	VolumeInfo
-	Bricks []BrickInfo `json:"bricks"`
-}
+// Peer states reported by a cluster peer repair
+const (
+	PeerStateConnected    = "connected"
+	PeerStateDisconnected = "disconnected"
+	PeerStateRejected     = "rejected"
+	PeerStateMissing      = "missing"
+)
 
-type VolumeListResponse struct {
-	Volumes []string `json:"volumes"`
-}
+// Actions taken by a cluster peer repair
+const (
+	PeerRepairActionNone   = "none"
+	PeerRepairActionProbe  = "probe"
+	PeerRepairActionManual = "manual"
+)
 
-type VolumeExpandRequest struct {
-	Size int `json:"expand_size"`
+type PeerRepairInfo struct {
+	NodeId   string `json:"node"`
+	Hostname string `json:"hostname"`
+	Before   string `json:"before"`
+	After    string `json:"after"`
+	Action   string `json:"action"`
+	Message  string `json:"message,omitempty"`
 }
 
-func (volExpandReq VolumeExpandRequest) Validate() error {
-	return validation.ValidateStruct(&volExpandReq,
-		validation.Field(&volExpandReq.Size, validation.Required, validation.Min(1)),
-	)
+type ClusterPeerRepairResponse struct {
+	// Node from which the peer status was checked
+	NodeId string           `json:"node"`
+	Peers  []PeerRepairInfo `json:"peers"`
 }
 
-// BlockVolume
+// Gluster options of the whole cluster, set with gluster volume set all
+const (
+	ClusterOptionOpVersion           = "cluster.op-version"
+	ClusterOptionMaxOpVersion        = "cluster.max-op-version"
+	ClusterOptionServerQuorumRatio   = "cluster.server-quorum-ratio"
+	ClusterOptionBrickMultiplex      = "cluster.brick-multiplex"
+	ClusterOptionMaxBricksPerProcess = "cluster.max-bricks-per-process"
+	ClusterOptionSharedStorage       = "cluster.enable-shared-storage"
+	ClusterOptionLocaltimeLogging    = "cluster.localtime-logging"
+	ClusterOptionDaemonLogLevel      = "cluster.daemon-log-level"
+)
 
-type BlockVolumeCreateRequest struct {
-	// Size in GiB
-	Size     int      `json:"size"`
-	Clusters []string `json:"clusters,omitempty"`
-	Name     string   `json:"name"`
-	Hacount  int      `json:"hacount,omitempty"`
-	Auth     bool     `json:"auth,omitempty"`
+// checks of the values of the cluster options which can be set
+var clusterOptionChecks = map[string]func(string) error{
+	ClusterOptionOpVersion:           checkPositiveInt,
+	ClusterOptionServerQuorumRatio:   checkPercentage,
+	ClusterOptionBrickMultiplex:      checkBool,
+	ClusterOptionMaxBricksPerProcess: checkNonNegativeInt,
+	ClusterOptionSharedStorage:       checkBool,
+	ClusterOptionLocaltimeLogging:    checkBool,
+	ClusterOptionDaemonLogLevel:      checkGlusterLogLevel,
 }
 
-func (blockVolCreateReq BlockVolumeCreateRequest) Validate() error {
-	return validation.ValidateStruct(&blockVolCreateReq,
-		validation.Field(&blockVolCreateReq.Size, validation.Required, validation.Min(1)),
-		validation.Field(&blockVolCreateReq.Clusters, validation.By(ValidateUUID)),
-		validation.Field(&blockVolCreateReq.Name, validation.Match(blockVolNameRe)),
-		validation.Field(&blockVolCreateReq.Hacount, validation.Min(1)),
-		validation.Field(&blockVolCreateReq.Auth, validation.Skip),
-	)
+func checkPositiveInt(s string) error {
+	if n, err := strconv.Atoi(s); err != nil || n <= 0 {
+		return fmt.Errorf("must be a positive number")
+	}
+	return nil
+}
+
+func checkNonNegativeInt(s string) error {
+	if n, err := strconv.Atoi(s); err != nil || n < 0 {
+		return fmt.Errorf("must be a number")
+	}
+	return nil
+}
+
+func checkPercentage(s string) error {
+	f, err := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+	if err != nil || f < 0 || f > 100 {
+		return fmt.Errorf("must be a percentage between 0 and 100")
+	}
+	return nil
+}
+
+func checkBool(s string) error {
+	switch strings.ToLower(s) {
+	case "on", "off", "enable", "disable", "true", "false", "yes", "no":
+		return nil
+	}
+	return fmt.Errorf("must be on or off")
+}
+
+func checkGlusterLogLevel(s string) error {
+	switch s {
+	case "INFO", "WARNING", "ERROR", "CRITICAL", "NONE", "DEBUG", "TRACE":
+		return nil
+	}
+	return fmt.Errorf("must be one of INFO, WARNING, ERROR, CRITICAL, " +
+		"NONE, DEBUG or TRACE")
+}
+
+// ClusterOptionsRequest changes the gluster options of a cluster
+type ClusterOptionsRequest struct {
+	// Options to set, each a name and a value as passed to gluster
+	// volume set all, e.g. "cluster.op-version 70200"
+	Set []string `json:"set"`
+}
+
+// ValidateClusterOptionsSet checks that each option to set is a cluster
+// option which can be changed, set at most once, with a valid value
+func ValidateClusterOptionsSet(value interface{}) error {
+	options, _ := value.([]string)
+	seen := map[string]bool{}
+	for _, option := range options {
+		fields := strings.Fields(option)
+		if len(fields) != 2 {
+			return fmt.Errorf("option %q must be a name and a value", option)
+		}
+		check, ok := clusterOptionChecks[fields[0]]
+		if !ok {
+			return fmt.Errorf("%q is not a cluster option which can be set",
+				fields[0])
+		}
+		if seen[fields[0]] {
+			return fmt.Errorf("option %q is set more than once", fields[0])
+		}
+		seen[fields[0]] = true
+		if err := check(fields[1]); err != nil {
+			return fmt.Errorf("value %q of option %q %v", fields[1], fields[0], err)
+		}
+	}
+	return nil
+}
+
+func (req ClusterOptionsRequest) Validate() error {
+	return validation.ValidateStruct(&req,
+		validation.Field(&req.Set, validation.Required,
+			validation.By(ValidateClusterOptionsSet)),
+	)
+}
+
+// Gluster options of a cluster, by name
+type ClusterOptionsResponse struct {
+	Id      string            `json:"id"`
+	Options map[string]string `json:"options"`
+}
+
+// Stages of a canary run
+const (
+	CanaryStageCreate = "create"
+	CanaryStageIO     = "io"
+	CanaryStageDelete = "delete"
+)
+
+type CanaryResult struct {
+	ClusterId string `json:"cluster"`
+	VolumeId  string `json:"volume,omitempty"`
+
+	// Seconds since the epoch
+	Started int64 `json:"started"`
+	// Milliseconds the run took
+	Duration int64 `json:"duration"`
+
+	Success bool `json:"success"`
+	// Stage that failed
+	Stage   string `json:"stage,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// Cluster rebalance
+
+type ClusterRebalanceRequest struct {
+	// Maximum distance, in percent, of the utilization of each device
+	// from the mean utilization of the cluster. Server default if zero.
+	Band float64 `json:"band,omitempty"`
+	// Maximum number of bricks moved, server default if zero
+	MaxMoves int `json:"max_moves,omitempty"`
+	// Seconds to wait between two moves, server default if zero
+	Interval int `json:"interval,omitempty"`
+	// Only return the plan
+	DryRun bool `json:"dry_run,omitempty"`
+}
+
+func (req ClusterRebalanceRequest) Validate() error {
+	return validation.ValidateStruct(&req,
+		validation.Field(&req.Band, validation.Min(0.0), validation.Max(100.0)),
+		validation.Field(&req.MaxMoves, validation.Min(0)),
+		validation.Field(&req.Interval, validation.Min(0)),
+	)
+}
+
+type ClusterRebalanceMove struct {
+	BrickId  string `json:"brick"`
+	VolumeId string `json:"volume"`
+	// Devices the brick is moved from and to
+	From string `json:"from"`
+	To   string `json:"to"`
+
+	// Size in KB
+	Size uint64 `json:"size"`
+}
+
+type ClusterRebalanceDevice struct {
+	Id string `json:"id"`
+	// Utilization in percent before and after the moves
+	Before float64 `json:"before"`
+	After  float64 `json:"after"`
+}
+
+type ClusterRebalanceResponse struct {
+	Id string `json:"id"`
+	// Mean utilization of the devices in percent
+	Mean     float64                  `json:"mean"`
+	Band     float64                  `json:"band"`
+	Moves    []ClusterRebalanceMove   `json:"moves"`
+	Devices  []ClusterRebalanceDevice `json:"devices"`
+	Balanced bool                     `json:"balanced"`
+}
+
+// Cluster zone rebalance
+
+type ClusterZoneRebalanceRequest struct {
+	// Maximum number of bricks moved, server default if zero
+	MaxMoves int `json:"max_moves,omitempty"`
+	// Seconds to wait between two moves, server default if zero
+	Interval int `json:"interval,omitempty"`
+	// Only return the report and the plan
+	DryRun bool `json:"dry_run,omitempty"`
+}
+
+func (req ClusterZoneRebalanceRequest) Validate() error {
+	return validation.ValidateStruct(&req,
+		validation.Field(&req.MaxMoves, validation.Min(0)),
+		validation.Field(&req.Interval, validation.Min(0)),
+	)
+}
+
+// Set of bricks of a volume spread over fewer zones than it could be
+type ZoneSpreadViolation struct {
+	VolumeId string `json:"volume"`
+	// Replica or disperse set of the volume, starting at zero
+	Set    int      `json:"set"`
+	Bricks []string `json:"bricks"`
+	// Zones of the bricks, in the order of the bricks
+	Zones []int `json:"zones"`
+	// Number of zones the set should span
+	Desired int `json:"desired"`
+}
+
+type ClusterZoneRebalanceMove struct {
+	ClusterRebalanceMove
+	// Zones the brick is moved from and to
+	FromZone int `json:"from_zone"`
+	ToZone   int `json:"to_zone"`
+}
+
+type ClusterZoneRebalanceResponse struct {
+	Id string `json:"id"`
+	// Number of zones with online devices
+	Zones      int                        `json:"zones"`
+	Violations []ZoneSpreadViolation      `json:"violations"`
+	Moves      []ClusterZoneRebalanceMove `json:"moves"`
+	// Number of sets still spread over too few zones after the moves
+	Remaining int `json:"remaining"`
+	// Volumes whose sets are not known, as the order of their bricks
+	// is not recorded
+	Skipped  []string `json:"skipped"`
+	Balanced bool     `json:"balanced"`
+}
+
+// Placement scores of a device for the bricks sampled by the allocator
+type DevicePlacementScore struct {
+	Id    string     `json:"id"`
+	Name  string     `json:"name"`
+	State EntryState `json:"state"`
+	// Space in KB that can be allocated to new bricks
+	Free  uint64 `json:"free"`
+	Total uint64 `json:"total"`
+	// Free space in percent of the total space
+	FreePercent float64 `json:"free_percent"`
+	// False if the device can not receive the sampled bricks
+	Eligible bool `json:"eligible"`
+	// Why the device is not eligible
+	Reason string `json:"reason,omitempty"`
+	// Percent of the sampled bricks the allocator proposes this
+	// device first for
+	FirstChoice float64 `json:"first_choice"`
+	// Percent of the sampled bricks that would be placed on this device
+	Score float64 `json:"score"`
+}
+
+type NodePlacementScore struct {
+	Id       string     `json:"id"`
+	Hostname string     `json:"hostname"`
+	Zone     int        `json:"zone"`
+	State    EntryState `json:"state"`
+	// Number of health events recorded for the node
+	HealthEvents int    `json:"health_events"`
+	Free         uint64 `json:"free"`
+	Total        uint64 `json:"total"`
+	// Sum of the scores of the devices of the node
+	Score   float64                `json:"score"`
+	Devices []DevicePlacementScore `json:"devices"`
+}
+
+type ClusterPlacementScoresResponse struct {
+	Id        string `json:"id"`
+	Allocator string `json:"allocator"`
+	// Size in KB of the sampled bricks
+	BrickSize uint64 `json:"brick_size"`
+	Samples   int    `json:"samples"`
+	// Percent of the sampled bricks no device has room for
+	Unplaced float64              `json:"unplaced"`
+	Free     uint64               `json:"free"`
+	Total    uint64               `json:"total"`
+	Nodes    []NodePlacementScore `json:"nodes"`
+}
+
+// Durabilities
+type ReplicaDurability struct {
+	Replica int `json:"replica,omitempty"`
+}
+
+type DisperseDurability struct {
+	Data       int `json:"data,omitempty"`
+	Redundancy int `json:"redundancy,omitempty"`
+}
+
+// Volume
+type VolumeDurabilityInfo struct {
+	Type      DurabilityType     `json:"type,omitempty"`
+	Replicate ReplicaDurability  `json:"replicate,omitempty"`
+	Disperse  DisperseDurability `json:"disperse,omitempty"`
+}
+
+type VolumeCreateRequest struct {
+	// Size in GiB
+	Size int `json:"size"`
+	// Size in MiB, used instead of Size if set
+	SizeMiB              int                  `json:"size_mib,omitempty"`
+	Clusters             []string             `json:"clusters,omitempty"`
+	Name                 string               `json:"name"`
+	Durability           VolumeDurabilityInfo `json:"durability,omitempty"`
+	Gid                  int64                `json:"gid,omitempty"`
+	GlusterVolumeOptions []string             `json:"glustervolumeoptions,omitempty"`
+	Block                bool                 `json:"block,omitempty"`
+	Uid                  int64                `json:"uid,omitempty"`
+	Permissions          string               `json:"permissions,omitempty"`
+	SelinuxContext       string               `json:"selinux_context,omitempty"`
+	Snapshot             struct {
+		Enable bool    `json:"enable"`
+		Factor float32 `json:"factor"`
+	} `json:"snapshot"`
+	// Maximum number of bricks, the limit of the server if zero
+	MaxBricks int `json:"max_bricks,omitempty"`
+	// Sizes and number of the sets of the bricks
+	BrickLimits VolumeBrickLimits `json:"brick_limits,omitempty"`
+	// Tags the devices of the bricks are selected by
+	Placement VolumePlacement `json:"placement,omitempty"`
+	// Quota of the directories of the volume
+	Quota VolumeQuota `json:"quota,omitempty"`
+	// Only place the bricks on these nodes when the volume is created
+	IncludeNodes []string `json:"include_nodes,omitempty"`
+	// Place no brick on these nodes when the volume is created
+	ExcludeNodes []string `json:"exclude_nodes,omitempty"`
+}
+
+// VolumeBrickLimits are the limits of the bricks of a volume, used
+// instead of the limits of the server. Volumes with a large minimum
+// brick size get fewer, larger bricks.
+type VolumeBrickLimits struct {
+	// Minimum size of the bricks in GiB, the limit of the server if zero
+	MinSize int `json:"min_size,omitempty"`
+	// Maximum size of the bricks in GiB, the limit of the server if zero
+	MaxSize int `json:"max_size,omitempty"`
+	// Maximum number of replica or disperse sets, unlimited if zero
+	MaxDistribute int `json:"max_distribute,omitempty"`
+}
+
+func (l VolumeBrickLimits) Validate() error {
+	if l.MinSize > 0 && l.MaxSize > 0 && l.MinSize > l.MaxSize {
+		return fmt.Errorf("minimum brick size %v GiB is larger than the maximum %v GiB",
+			l.MinSize, l.MaxSize)
+	}
+	return validation.ValidateStruct(&l,
+		validation.Field(&l.MinSize, validation.Min(0)),
+		validation.Field(&l.MaxSize, validation.Min(0)),
+		validation.Field(&l.MaxDistribute, validation.Min(0)),
+	)
+}
+
+// Placement of the bricks of a volume using the tags of the nodes and
+// devices. The tags of a device are the tags of its node, overridden
+// by the tags of the device itself.
+type VolumePlacement struct {
+	// Only place bricks on devices with all these tags
+	TagMatch map[string]string `json:"tag_match,omitempty"`
+	// Place the bricks of a set on devices with different values of
+	// this tag. Devices without the tag share the empty value.
+	SpreadTag string `json:"spread_tag,omitempty"`
+	// Place the bricks of a set on devices of different enclosures.
+	// Devices without an enclosure are not grouped.
+	SpreadEnclosure bool `json:"spread_enclosure,omitempty"`
+}
+
+func (p VolumePlacement) Validate() error {
+	return validation.ValidateStruct(&p,
+		validation.Field(&p.TagMatch, validation.By(ValidateTags)),
+		validation.Field(&p.SpreadTag, validation.Match(tagKeyRe)),
+	)
+}
+
+// VolumeQuotaLimit is the hard limit of the usage of a directory of
+// a volume
+type VolumeQuotaLimit struct {
+	// Path of the directory from the root of the volume. The directory
+	// must exist unless it is the root of the volume, "/".
+	Path string `json:"path"`
+	// Hard limit in MiB
+	HardLimitMiB int `json:"hard_limit_mib"`
+}
+
+// VolumeQuota is the gluster quota of a volume. The limits require
+// the quota to be enabled.
+type VolumeQuota struct {
+	Enable bool               `json:"enable"`
+	Limits []VolumeQuotaLimit `json:"limits,omitempty"`
+}
+
+// ValidateVolumeQuotaLimits checks the paths and the hard limits of the
+// directories, each directory having at most one limit
+func ValidateVolumeQuotaLimits(value interface{}) error {
+	limits, _ := value.([]VolumeQuotaLimit)
+	paths := map[string]bool{}
+	for _, l := range limits {
+		if !quotaPathRe.MatchString(l.Path) {
+			return fmt.Errorf("invalid path %q", l.Path)
+		}
+		if l.HardLimitMiB <= 0 {
+			return fmt.Errorf("hard limit of %v must be positive", l.Path)
+		}
+		if paths[l.Path] {
+			return fmt.Errorf("more than one limit for %v", l.Path)
+		}
+		paths[l.Path] = true
+	}
+	return nil
+}
+
+func (q VolumeQuota) Validate() error {
+	if !q.Enable && len(q.Limits) > 0 {
+		return fmt.Errorf("limits require the quota to be enabled")
+	}
+	return validation.ValidateStruct(&q,
+		validation.Field(&q.Limits, validation.By(ValidateVolumeQuotaLimits)),
+	)
+}
+
+func (volCreateRequest VolumeCreateRequest) Validate() error {
+	if volCreateRequest.Block && volCreateRequest.Quota.Enable {
+		return fmt.Errorf("quota can not be enabled on a block hosting volume")
+	}
+	for _, included := range volCreateRequest.IncludeNodes {
+		for _, excluded := range volCreateRequest.ExcludeNodes {
+			if included == excluded {
+				return fmt.Errorf("node %v is both included and excluded", included)
+			}
+		}
+	}
+	return validation.ValidateStruct(&volCreateRequest,
+		validation.Field(&volCreateRequest.Size, sizeRules(volCreateRequest.SizeMiB)...),
+		validation.Field(&volCreateRequest.SizeMiB, validation.Min(0)),
+		validation.Field(&volCreateRequest.Clusters, validation.By(ValidateUUID)),
+		validation.Field(&volCreateRequest.Name, validation.Match(volumeNameRe)),
+		validation.Field(&volCreateRequest.Durability, validation.Skip),
+		validation.Field(&volCreateRequest.Gid, validation.Skip),
+		validation.Field(&volCreateRequest.Uid, validation.Min(0)),
+		validation.Field(&volCreateRequest.Permissions, validation.Match(permissionsRe)),
+		validation.Field(&volCreateRequest.SelinuxContext, validation.Match(selinuxContextRe)),
+		validation.Field(&volCreateRequest.GlusterVolumeOptions, validation.Skip),
+		validation.Field(&volCreateRequest.Block, validation.In(true, false)),
+		validation.Field(&volCreateRequest.MaxBricks, validation.Min(0)),
+		validation.Field(&volCreateRequest.BrickLimits),
+		validation.Field(&volCreateRequest.Placement),
+		validation.Field(&volCreateRequest.Quota),
+		validation.Field(&volCreateRequest.IncludeNodes, validation.By(ValidateUUID)),
+		validation.Field(&volCreateRequest.ExcludeNodes, validation.By(ValidateUUID)),
+		// This is possibly a bug in validation lib, ignore next two lines for now
+		// validation.Field(&volCreateRequest.Snapshot.Enable, validation.In(true, false)),
+		// validation.Field(&volCreateRequest.Snapshot.Factor, validation.Min(1.0)),
+	)
+}
+
+type VolumeInfo struct {
+	VolumeCreateRequest
+	Id        string `json:"id"`
+	GlusterId string `json:"gluster_id,omitempty"`
+	Cluster   string `json:"cluster"`
+	// Tenant of the user who created the volume, if any
+	Tenant string `json:"tenant,omitempty"`
+	Mount  struct {
+		GlusterFS struct {
+			Hosts      []string          `json:"hosts"`
+			MountPoint string            `json:"device"`
+			Options    map[string]string `json:"options"`
+		} `json:"glusterfs"`
+	} `json:"mount"`
+	BlockInfo struct {
+		FreeSize     int              `json:"freesize,omitempty"`
+		BlockVolumes sort.StringSlice `json:"blockvolume,omitempty"`
+	} `json:"blockinfo,omitempty"`
+}
+
+type VolumeInfoResponse struct {
+	VolumeInfo
+	Bricks []BrickInfo `json:"bricks"`
+
+	// Ids of the bricks in the order of the volume in gluster, every
+	// replica or disperse count bricks forming a set. Omitted if the
+	// order is not known.
+	BrickOrder []string `json:"brick_order,omitempty"`
+
+	// Options that differed from the ones set by heketi when
+	// last checked
+	OptionsDrift []VolumeOptionDrift `json:"options_drift,omitempty"`
+
+	// Non-fatal issues found when the volume was created
+	Warnings []Warning `json:"warnings,omitempty"`
+
+	Capacity *VolumeCapacity `json:"capacity,omitempty"`
+
+	// Set while the delete of the volume waits for its confirmation
+	PendingDelete *VolumePendingDelete `json:"pending_delete,omitempty"`
+
+	// Why the cluster of the volume was chosen, omitted if the create
+	// request listed the clusters or for the default selection policy
+	ClusterSelection *ClusterSelection `json:"cluster_selection,omitempty"`
+}
+
+// Delete of a volume waiting for its confirmation, times in seconds
+// since the epoch
+type VolumePendingDelete struct {
+	Since int64 `json:"since"`
+	// Time the volume is deleted at unless the delete is confirmed
+	// or cancelled before
+	Deadline int64 `json:"deadline"`
+}
+
+// Capacity of a volume computed from the sizes of its bricks, sizes in KB
+type VolumeCapacity struct {
+	// Space usable by the clients of the volume, the space of the
+	// bricks without the replicas or the redundancy of the durability
+	Usable uint64 `json:"usable"`
+	// Space of the bricks, the replicas or the redundancy included
+	Raw uint64 `json:"raw"`
+	// Space reserved on the devices, the thin pools of the bricks
+	// sized by the snapshot factor and their metadata included
+	Allocated uint64 `json:"allocated"`
+}
+
+type VolumeListResponse struct {
+	Volumes []string `json:"volumes"`
+	// Volumes matching the filters of the request, before paging
+	Total int `json:"total,omitempty"`
+	// Information of the volumes, in the order of Volumes, when the
+	// list is expanded
+	Infos []VolumeInfoResponse `json:"infos,omitempty"`
+}
+
+// ListOptions select a page of the volumes, block volumes or bricks
+// matching the filters. They are passed in the query of the list
+// requests. Filters left empty select every entry.
+type ListOptions struct {
+	// Maximum number of ids returned, all of them if zero
+	Limit int `json:"limit,omitempty"`
+	// Number of ids skipped, in the order of the ids
+	Offset int `json:"offset,omitempty"`
+
+	Cluster string `json:"cluster,omitempty"`
+	// Prefix of the names of the volumes and block volumes
+	NamePrefix string `json:"name,omitempty"`
+	// Durability type of the volumes
+	Durability DurabilityType `json:"durability,omitempty"`
+	// Volumes hosting block volumes or not, both if nil
+	Block *bool `json:"block,omitempty"`
+
+	// Volume of the bricks, or block hosting volume of the block volumes
+	Volume string `json:"volume,omitempty"`
+	// Node and device of the bricks
+	Node   string `json:"node,omitempty"`
+	Device string `json:"device,omitempty"`
+
+	// Return the information of the volumes with their ids
+	Expand bool `json:"expand,omitempty"`
+}
+
+func (o ListOptions) Validate() error {
+	return validation.ValidateStruct(&o,
+		validation.Field(&o.Limit, validation.Min(0)),
+		validation.Field(&o.Offset, validation.Min(0)),
+		validation.Field(&o.Cluster, validation.By(ValidateUUID)),
+		validation.Field(&o.Durability, validation.In(DurabilityReplicate,
+			DurabilityDistributeOnly, DurabilityEC)),
+		validation.Field(&o.Volume, validation.By(ValidateUUID)),
+		validation.Field(&o.Node, validation.By(ValidateUUID)),
+		validation.Field(&o.Device, validation.By(ValidateUUID)),
+	)
+}
+
+// Matches of the names of the volumes searched
+const (
+	VolumeSearchExact  = "exact"
+	VolumeSearchPrefix = "prefix"
+)
+
+// VolumeSearchRequest selects the volumes by name. It is passed in the
+// query of the search request.
+type VolumeSearchRequest struct {
+	Name string `json:"name"`
+	// Exact name, the default, or prefix of the names
+	Match string `json:"match,omitempty"`
+}
+
+func (s VolumeSearchRequest) Validate() error {
+	return validation.ValidateStruct(&s,
+		validation.Field(&s.Name, validation.Required, validation.Match(volumeNameRe)),
+		validation.Field(&s.Match, validation.In(VolumeSearchExact, VolumeSearchPrefix)),
+	)
+}
+
+// Brick a volume create request would allocate
+type VolumeSimulateBrick struct {
+	NodeId     string `json:"node"`
+	Hostname   string `json:"hostname"`
+	Zone       int    `json:"zone"`
+	DeviceId   string `json:"device"`
+	DeviceName string `json:"device_name"`
+	// Replica or disperse set of the brick, starting at zero
+	Set int `json:"set"`
+
+	// Size in KB
+	Size uint64 `json:"size"`
+}
+
+type VolumeSimulateResponse struct {
+	Cluster    string                `json:"cluster"`
+	Size       int                   `json:"size"`
+	SizeMiB    int                   `json:"size_mib"`
+	Durability VolumeDurabilityInfo  `json:"durability"`
+	Bricks     []VolumeSimulateBrick `json:"bricks"`
+}
+
+type VolumeExpandRequest struct {
+	Size int `json:"expand_size"`
+	// New maximum number of bricks of the volume, unchanged if zero
+	MaxBricks int `json:"max_bricks,omitempty"`
+}
+
+func (volExpandReq VolumeExpandRequest) Validate() error {
+	return validation.ValidateStruct(&volExpandReq,
+		validation.Field(&volExpandReq.Size, validation.Required, validation.Min(1)),
+		validation.Field(&volExpandReq.MaxBricks, validation.Min(0)),
+	)
+}
+
+// BrickLimitError is returned when a volume would have more bricks
+// than allowed
+type BrickLimitError struct {
+	Message string `json:"message"`
+	Volume  string `json:"volume"`
+	// Bricks the volume has
+	Bricks int `json:"bricks"`
+	Limit  int `json:"limit"`
+	// Ways to get the storage without exceeding the limit
+	Hints []string `json:"hints"`
+}
+
+func (e *BrickLimitError) Error() string {
+	msg := e.Message
+	for _, hint := range e.Hints {
+		msg += "\n  * " + hint
+	}
+	return msg
+}
+
+type VolumeRestoreRequest struct {
+	Snapshot string `json:"snapshot"`
+	// Restore even if clients are still connected to the volume
+	Force bool `json:"force,omitempty"`
+}
+
+func (volRestoreReq VolumeRestoreRequest) Validate() error {
+	return validation.ValidateStruct(&volRestoreReq,
+		validation.Field(&volRestoreReq.Snapshot, validation.Required, validation.Match(snapshotNameRe)),
+		validation.Field(&volRestoreReq.Force, validation.In(true, false)),
+	)
+}
+
+// Snapshots
+
+type SnapshotCreateRequest struct {
+	// Name of the snapshot in gluster, "snap_<id>" if not given
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+func (snapCreateReq SnapshotCreateRequest) Validate() error {
+	return validation.ValidateStruct(&snapCreateReq,
+		validation.Field(&snapCreateReq.Name, validation.Match(snapshotNameRe)),
+		validation.Field(&snapCreateReq.Description, validation.Length(0, 1024)),
+	)
+}
+
+type SnapshotCloneRequest struct {
+	// Name of the new volume, "vol_<id>" if not given
+	Name string `json:"name,omitempty"`
+}
+
+func (snapCloneReq SnapshotCloneRequest) Validate() error {
+	return validation.ValidateStruct(&snapCloneReq,
+		validation.Field(&snapCloneReq.Name, validation.Match(volumeNameRe)),
+	)
+}
+
+type SnapshotInfo struct {
+	Id          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// Volume the snapshot was taken of
+	OriginVolume string `json:"originvolume"`
+	Cluster      string `json:"cluster"`
+	// Seconds since the epoch
+	Created int64 `json:"created"`
+}
+
+type SnapshotInfoResponse struct {
+	SnapshotInfo
+}
+
+type SnapshotListResponse struct {
+	Snapshots []string `json:"snapshots"`
+}
+
+func (s *SnapshotInfoResponse) String() string {
+	str := fmt.Sprintf("Id: %v\n"+
+		"Name: %v\n"+
+		"Origin Volume: %v\n"+
+		"Cluster Id: %v\n"+
+		"Created: %v\n",
+		s.Id,
+		s.Name,
+		s.OriginVolume,
+		s.Cluster,
+		time.Unix(s.Created, 0).Format(time.RFC3339))
+	if s.Description != "" {
+		str += fmt.Sprintf("Description: %v\n", s.Description)
+	}
+	return str
+}
+
+// Replication of a volume to a volume of a DR cluster
+type ReplicationState string
+
+const (
+	// Changes of the primary volume are copied to the secondary volume
+	ReplicationActive ReplicationState = "active"
+	// The copy stopped so that the secondary volume can be used instead
+	// of the primary volume
+	ReplicationFailedOver ReplicationState = "failed-over"
+)
+
+type ReplicationCreateRequest struct {
+	// DR cluster the secondary volume is created on
+	Cluster string `json:"cluster"`
+}
+
+func (req ReplicationCreateRequest) Validate() error {
+	return validation.ValidateStruct(&req,
+		validation.Field(&req.Cluster, validation.Required, validation.By(ValidateUUID)),
+	)
+}
+
+type ReplicationFailoverRequest struct {
+	// Fail over even if the geo-replication session can not be
+	// stopped, for example when the primary cluster is down
+	Force bool `json:"force,omitempty"`
+}
+
+type ReplicationInfo struct {
+	Id               string           `json:"id"`
+	PrimaryVolume    string           `json:"primary_volume"`
+	PrimaryCluster   string           `json:"primary_cluster"`
+	SecondaryVolume  string           `json:"secondary_volume"`
+	SecondaryCluster string           `json:"secondary_cluster"`
+	State            ReplicationState `json:"state"`
+	// Seconds since the epoch
+	Created int64 `json:"created"`
+}
+
+type ReplicationInfoResponse struct {
+	ReplicationInfo
+}
+
+type ReplicationListResponse struct {
+	Replications []string `json:"replications"`
+}
+
+func (r *ReplicationInfoResponse) String() string {
+	return fmt.Sprintf("Id: %v\n"+
+		"Primary Volume: %v\n"+
+		"Primary Cluster: %v\n"+
+		"Secondary Volume: %v\n"+
+		"Secondary Cluster: %v\n"+
+		"State: %v\n"+
+		"Created: %v\n",
+		r.Id,
+		r.PrimaryVolume,
+		r.PrimaryCluster,
+		r.SecondaryVolume,
+		r.SecondaryCluster,
+		r.State,
+		time.Unix(r.Created, 0).Format(time.RFC3339))
+}
+
+type VolumeOptionsCheckRequest struct {
+	// Set the options that drifted back to the values set by heketi
+	Enforce bool `json:"enforce,omitempty"`
+}
+
+// VolumeOptionsRequest changes the gluster options of a volume
+type VolumeOptionsRequest struct {
+	// Options to set, each a name and a value as passed to gluster
+	// volume set, e.g. "performance.cache-size 256MB"
+	Set []string `json:"set,omitempty"`
+	// Names of the options to reset to their default values
+	Reset []string `json:"reset,omitempty"`
+}
+
+// ValidateVolumeOptionsSet checks that each option to set is a valid
+// option name followed by a value
+func ValidateVolumeOptionsSet(value interface{}) error {
+	options, _ := value.([]string)
+	for _, option := range options {
+		fields := strings.Fields(option)
+		if len(fields) < 2 {
+			return fmt.Errorf("option %q must be a name and a value", option)
+		}
+		if !volumeOptionNameRe.MatchString(fields[0]) {
+			return fmt.Errorf("invalid option name %q", fields[0])
+		}
+	}
+	return nil
+}
+
+// ValidateVolumeOptionsReset checks the names of the options to reset
+func ValidateVolumeOptionsReset(value interface{}) error {
+	names, _ := value.([]string)
+	for _, name := range names {
+		if !volumeOptionNameRe.MatchString(name) {
+			return fmt.Errorf("invalid option name %q", name)
+		}
+	}
+	return nil
+}
+
+func (volOptionsReq VolumeOptionsRequest) Validate() error {
+	if len(volOptionsReq.Set) == 0 && len(volOptionsReq.Reset) == 0 {
+		return fmt.Errorf("no options to set or reset")
+	}
+	return validation.ValidateStruct(&volOptionsReq,
+		validation.Field(&volOptionsReq.Set, validation.By(ValidateVolumeOptionsSet)),
+		validation.Field(&volOptionsReq.Reset, validation.By(ValidateVolumeOptionsReset)),
+	)
+}
+
+// Types of the warnings of a successful create
+const (
+	WarningFewZones         = "few-zones"
+	WarningDeviceFull       = "device-full"
+	WarningNoArbiter        = "no-arbiter"
+	WarningNodesUnreachable = "nodes-unreachable"
+)
+
+// ClusterSelection is the policy the cluster of a volume was chosen by
+// and why it was chosen
+type ClusterSelection struct {
+	Policy string `json:"policy"`
+	Reason string `json:"reason"`
+}
+
+// Warning is a non-fatal issue found with a successful create
+type Warning struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+type VolumeOptionDrift struct {
+	Option   string `json:"option"`
+	Expected string `json:"expected"`
+	// Empty when the option is not set on the volume
+	Actual string `json:"actual"`
+}
+
+// BrickSetMismatch is a set of bricks of a volume whose bricks in
+// gluster are not the bricks heketi recorded for the set
+type BrickSetMismatch struct {
+	// Position of the set in the volume, starting at 0
+	Set int `json:"set"`
+	// Bricks recorded by heketi, each <host>:<path>
+	Expected []string `json:"expected"`
+	// Bricks of the set in gluster
+	Actual []string `json:"actual"`
+}
+
+type VolumeBrickOrderCheckResponse struct {
+	Id         string             `json:"id"`
+	Mismatches []BrickSetMismatch `json:"mismatches"`
+	// Set when heketi did not know the order of the bricks and
+	// recorded the order of the volume in gluster
+	Recorded bool `json:"recorded,omitempty"`
+}
+
+// BrickHealInfo is the self-heal state of a brick of a volume as
+// reported by gluster
+type BrickHealInfo struct {
+	// Empty for the bricks heketi does not know
+	Id string `json:"id"`
+	// <host>:<path>
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Online bool   `json:"online"`
+	// Entries of the brick pending heal, -1 when the brick is offline
+	PendingEntries int `json:"pending_entries"`
+}
+
+type VolumeHealInfoResponse struct {
+	Id     string          `json:"id"`
+	Bricks []BrickHealInfo `json:"bricks"`
+	// Entries pending heal on all the bricks
+	PendingEntries int `json:"pending_entries"`
+}
+
+type VolumeOptionsCheckResponse struct {
+	Id       string              `json:"id"`
+	Drift    []VolumeOptionDrift `json:"drift"`
+	Enforced bool                `json:"enforced,omitempty"`
+}
+
+// VolumeIOSample holds the io of a volume, summed over its bricks,
+// during the interval ending at the time of the sample
+type VolumeIOSample struct {
+	// Seconds since the epoch
+	Time int64 `json:"time"`
+	// Seconds covered by the sample
+	Interval   int64  `json:"interval"`
+	ReadBytes  uint64 `json:"read_bytes"`
+	WriteBytes uint64 `json:"write_bytes"`
+	Fops       uint64 `json:"fops"`
+}
+
+type VolumeIOStatsResponse struct {
+	Id string `json:"id"`
+	// Oldest sample first
+	Samples []VolumeIOSample `json:"samples"`
+}
+
+// Operations
+
+type OperationChangeInfo struct {
+	Change string `json:"change"`
+	Id     string `json:"id"`
+}
+
+type OperationInfo struct {
+	Id   string `json:"id"`
+	Type string `json:"type"`
+	// Seconds since the epoch
+	Started int64                 `json:"started"`
+	Changes []OperationChangeInfo `json:"changes"`
+}
+
+type OperationListResponse struct {
+	Operations []OperationInfo `json:"operations"`
+}
+
+// Completed operation kept in the operation history
+type OperationHistoryInfo struct {
+	OperationInfo
+	Label string `json:"label"`
+	// Issuer of the token of the request, empty without authentication
+	Requester string `json:"requester"`
+	// Seconds since the epoch
+	Finished int64 `json:"finished"`
+	// Seconds the operation took
+	Duration  int64  `json:"duration"`
+	Succeeded bool   `json:"succeeded"`
+	Error     string `json:"error,omitempty"`
+	// Id of the output of the command the operation failed on, if kept
+	Output string `json:"output,omitempty"`
+}
+
+type OperationHistoryResponse struct {
+	// Oldest first
+	Operations []OperationHistoryInfo `json:"operations"`
+}
+
+// Output of a command that failed on a node
+type CommandOutputInfo struct {
+	Id      string `json:"id"`
+	Host    string `json:"host"`
+	Command string `json:"command"`
+	Error   string `json:"error"`
+	// Seconds since the epoch
+	Created int64 `json:"created"`
+}
+
+type CommandOutputInfoResponse struct {
+	CommandOutputInfo
+	Stdout string `json:"stdout"`
+	Stderr string `json:"stderr"`
+	// Set when the beginning of the output was cut to the capture size
+	Truncated bool `json:"truncated"`
+}
+
+type CommandOutputListResponse struct {
+	// Oldest first
+	Outputs []CommandOutputInfo `json:"outputs"`
+}
+
+// Audit log of the requests changing the state of the server
+
+const (
+	AuditResultPending   = "pending"
+	AuditResultSucceeded = "succeeded"
+	AuditResultFailed    = "failed"
+)
+
+type AuditLogEntryInfo struct {
+	Id        string `json:"id"`
+	RequestId string `json:"request_id,omitempty"`
+	// Seconds since the epoch the request was received and completed
+	Time     int64 `json:"time"`
+	Finished int64 `json:"finished,omitempty"`
+	// Issuer of the token of the request, empty without authentication
+	User string `json:"user"`
+	// Method and path of the request, and name of its endpoint
+	Method    string `json:"method"`
+	Path      string `json:"path"`
+	Operation string `json:"operation"`
+	// Id of the object the request is on, or of the object it created
+	ObjectId string `json:"object_id,omitempty"`
+	Payload  string `json:"payload,omitempty"`
+	// Http status of the response to the request
+	Status int    `json:"status"`
+	Result string `json:"result"`
+	Error  string `json:"error,omitempty"`
+}
+
+type AuditLogResponse struct {
+	// Oldest first
+	Entries []AuditLogEntryInfo `json:"entries"`
+}
+
+// Events posted to the webhooks
+
+const (
+	EventVolumeCreated       = "volume_created"
+	EventVolumeDeletePending = "volume_delete_pending"
+	EventBrickReplaced       = "brick_replaced"
+	EventDeviceFailed        = "device_failed"
+	EventNoSpace             = "no_space"
+)
+
+// Headers of the requests posting the events
+const (
+	HeaderEventType      = "X-Heketi-Event"
+	HeaderEventSignature = "X-Heketi-Signature"
+)
+
+type Event struct {
+	Id   string `json:"id"`
+	Type string `json:"type"`
+	// Seconds since the epoch
+	Time     int64  `json:"time"`
+	ObjectId string `json:"object_id,omitempty"`
+	// Tenant of the volume the event is about, if any
+	Tenant  string `json:"tenant,omitempty"`
+	Message string `json:"message"`
+}
+
+type EventListResponse struct {
+	// Oldest first
+	Events []Event `json:"events"`
+}
+
+// Tenants
+
+// Limits of the volumes of a tenant on a cluster. Zero is no limit.
+type TenantLimits struct {
+	// Sum of the sizes of the volumes and block volumes in GiB
+	SizeGb       int `json:"size_gb"`
+	Volumes      int `json:"volumes"`
+	BlockVolumes int `json:"block_volumes"`
+}
+
+func (l TenantLimits) Validate() error {
+	return validation.ValidateStruct(&l,
+		validation.Field(&l.SizeGb, validation.Min(0)),
+		validation.Field(&l.Volumes, validation.Min(0)),
+		validation.Field(&l.BlockVolumes, validation.Min(0)),
+	)
+}
+
+type TenantRequest struct {
+	// Subjects, the sub claim of the tokens, of the users of the tenant
+	Users []string `json:"users"`
+	// Limits of every cluster but the clusters with their own limits
+	Limits   TenantLimits            `json:"limits"`
+	Clusters map[string]TenantLimits `json:"clusters,omitempty"`
+}
+
+func (req TenantRequest) Validate() error {
+	for id, l := range req.Clusters {
+		if err := l.Validate(); err != nil {
+			return fmt.Errorf("cluster %v: %v", id, err)
+		}
+	}
+	return validation.ValidateStruct(&req,
+		validation.Field(&req.Users, validation.Each(validation.Match(tenantNameRe))),
+		validation.Field(&req.Limits),
+	)
+}
+
+// ValidateTenantName returns an error if the name is not a valid name
+// of a tenant
+func ValidateTenantName(name string) error {
+	return validation.Validate(name, validation.Required, validation.Match(tenantNameRe))
+}
+
+// Volumes of a tenant on a cluster
+type TenantUsage struct {
+	// Sum of the sizes of the volumes and block volumes in MiB
+	SizeMiB      int `json:"size_mib"`
+	Volumes      int `json:"volumes"`
+	BlockVolumes int `json:"block_volumes"`
+}
+
+type TenantInfoResponse struct {
+	Name string `json:"name"`
+	TenantRequest
+	// Volumes of the tenant on each cluster holding some
+	Usage map[string]TenantUsage `json:"usage"`
+}
+
+type TenantListResponse struct {
+	Tenants []string `json:"tenants"`
+}
+
+// Volumes of a tenant on a cluster against its limits there
+type TenantClusterUsage struct {
+	// A limit of 0 is no limit
+	Limits TenantLimits `json:"limits"`
+	Usage  TenantUsage  `json:"usage"`
+}
+
+type TenantUsageResponse struct {
+	Name string `json:"name"`
+	// Usage of the tenant on every cluster, by cluster id
+	Clusters map[string]TenantClusterUsage `json:"clusters"`
+}
+
+// Db statistics
+
+type DbEntryStats struct {
+	Key string `json:"key"`
+	// Size of the key and value in bytes
+	Size int `json:"size"`
+}
+
+type DbBucketStats struct {
+	Name    string `json:"name"`
+	Entries int    `json:"entries"`
+	// Total size of the keys and values in bytes
+	Size    int            `json:"size"`
+	Largest []DbEntryStats `json:"largest"`
+}
+
+type DbStatsResponse struct {
+	// Size of the db in bytes
+	DbSize  int64           `json:"db_size"`
+	Prefix  string          `json:"prefix,omitempty"`
+	Buckets []DbBucketStats `json:"buckets"`
+}
+
+// Types of the inconsistencies found by a db check
+const (
+	// An entry refers to an entry that does not exist
+	DbCheckMissingEntry = "missing-entry"
+	// An entry is not in the list of the entry it belongs to
+	DbCheckUnlinkedEntry = "unlinked-entry"
+	// The used storage of a device differs from the space of its bricks
+	DbCheckStorageMismatch = "storage-mismatch"
+	// An entry can not be read
+	DbCheckCorruptEntry = "corrupt-entry"
+)
+
+type DbCheckIssue struct {
+	Type string `json:"type"`
+	// Kind and id of the entry the issue was found in
+	Kind    string `json:"kind"`
+	Id      string `json:"id"`
+	Message string `json:"message"`
+	// Whether the entry was updated to fix the issue
+	Repaired bool `json:"repaired,omitempty"`
+}
+
+type DbCheckResponse struct {
+	Issues []DbCheckIssue `json:"issues"`
+}
+
+// Brick replace
+
+const (
+	// Header set by the async operation endpoint to the step reached
+	// by an operation still pending, for operations reporting steps
+	HeaderPendingStep = "X-Pending-Step"
+
+	// Steps of a brick replace
+	BrickReplaceAllocated    = "allocated"
+	BrickReplaceCreated      = "created"
+	BrickReplaceReplaced     = "replaced"
+	BrickReplaceDestroyedOld = "destroyed-old"
+	// Followed by the number of entries pending heal
+	BrickReplaceWaitingHeal = "waiting-heal"
+)
+
+// Steps of a volume or block volume delete waiting in the queue of the
+// teardowns and being torn down. Volume deletes wait for their
+// confirmation first when the server requires it.
+const (
+	DeleteStepConfirmation = "confirmation"
+	DeleteStepQueued       = "queued"
+	DeleteStepTeardown     = "teardown"
+)
+
+// Steps of a volume create or brick replace waiting for the operations
+// running on the same server, clusters or nodes
+const (
+	OperationStepQueued  = "queued"
+	OperationStepRunning = "running"
+)
+
+// Storage class conformance
+
+// Volume spec evaluated against every cluster
+type StorageClassReportRequest struct {
+	// Size in GiB
+	Size       int                  `json:"size"`
+	Durability VolumeDurabilityInfo `json:"durability,omitempty"`
+	// Brick zone policy, the one of the server if empty
+	ZonePolicy string `json:"zone_policy,omitempty"`
+	Snapshot   struct {
+		Enable bool    `json:"enable"`
+		Factor float32 `json:"factor"`
+	} `json:"snapshot"`
+}
+
+func (req StorageClassReportRequest) Validate() error {
+	return validation.ValidateStruct(&req,
+		validation.Field(&req.Size, validation.Required, validation.Min(1)),
+		validation.Field(&req.Durability, validation.Skip),
+		validation.Field(&req.ZonePolicy, validation.In("none", "best-effort", "strict")),
+	)
+}
+
+type StorageClassClusterReport struct {
+	Id string `json:"id"`
+	// True if a volume of the spec can be created on the cluster
+	Conforms bool `json:"conforms"`
+	// Number of volumes of the spec that fit in the cluster
+	Volumes int `json:"volumes"`
+	// True if more volumes may fit than were counted
+	Limited bool `json:"limited,omitempty"`
+	// Number of zones with online devices
+	Zones  int    `json:"zones"`
+	Reason string `json:"reason,omitempty"`
+}
+
+type StorageClassReportResponse struct {
+	StorageClassReportRequest
+	Clusters []StorageClassClusterReport `json:"clusters"`
+}
+
+// Placement policy
+
+// Placement policy of a device, found by its name on its node
+type DevicePlacementPolicy struct {
+	Name      string            `json:"name"`
+	Tags      map[string]string `json:"tags,omitempty"`
+	Enclosure string            `json:"enclosure,omitempty"`
+}
+
+func (p DevicePlacementPolicy) Validate() error {
+	return validation.ValidateStruct(&p,
+		validation.Field(&p.Name, validation.Required),
+		validation.Field(&p.Tags, validation.By(ValidateTags)),
+		validation.Field(&p.Enclosure, validation.Match(tagKeyRe)),
+	)
+}
+
+// Placement policy of a node, found by its manage hostname
+type NodePlacementPolicy struct {
+	Hostname string `json:"hostname"`
+	// Zone of the node, not changed if not set
+	Zone    int                     `json:"zone,omitempty"`
+	Tags    map[string]string       `json:"tags,omitempty"`
+	Devices []DevicePlacementPolicy `json:"devices,omitempty"`
+}
+
+func (p NodePlacementPolicy) Validate() error {
+	err := validation.ValidateStruct(&p,
+		validation.Field(&p.Hostname, validation.Required),
+		validation.Field(&p.Zone, validation.Min(0)),
+		validation.Field(&p.Tags, validation.By(ValidateTags)),
+	)
+	if err != nil {
+		return err
+	}
+	names := map[string]bool{}
+	for _, d := range p.Devices {
+		if err := d.Validate(); err != nil {
+			return fmt.Errorf("device %v: %v", d.Name, err)
+		}
+		if names[d.Name] {
+			return fmt.Errorf("device %v of node %v is listed more than once",
+				d.Name, p.Hostname)
+		}
+		names[d.Name] = true
+	}
+	return nil
+}
+
+// Placement policy of a cluster, found by the nodes of the policy or by
+// its id if the policy has no nodes
+type ClusterPlacementPolicy struct {
+	Id      string                `json:"id,omitempty"`
+	Standby bool                  `json:"standby"`
+	Nodes   []NodePlacementPolicy `json:"nodes,omitempty"`
+}
+
+// Placement policy of the topology: the zones and tags of the nodes,
+// the tags and enclosures of the devices and the standby clusters.
+// Nodes and devices are found by name so that the policy of one
+// environment can be applied to another.
+type PlacementPolicy struct {
+	// Allocator of the server, set in its configuration
+	Allocator string                   `json:"allocator,omitempty"`
+	Clusters  []ClusterPlacementPolicy `json:"clusters"`
+}
+
+func (p PlacementPolicy) Validate() error {
+	hosts := map[string]bool{}
+	for _, c := range p.Clusters {
+		if len(c.Nodes) == 0 && c.Id == "" {
+			return fmt.Errorf("cluster without nodes must have an id")
+		}
+		if c.Id != "" {
+			if err := ValidateUUID(c.Id); err != nil {
+				return err
+			}
+		}
+		for _, n := range c.Nodes {
+			if err := n.Validate(); err != nil {
+				return fmt.Errorf("node %v: %v", n.Hostname, err)
+			}
+			if hosts[n.Hostname] {
+				return fmt.Errorf("node %v is listed more than once",
+					n.Hostname)
+			}
+			hosts[n.Hostname] = true
+		}
+	}
+	return nil
+}
+
+type PlacementPolicyImportResponse struct {
+	PlacementPolicy
+	// Parts of the policy that could not be applied, such as another
+	// allocator
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// BlockVolume
+
+type BlockVolumeCreateRequest struct {
+	// Size in GiB
+	Size int `json:"size"`
+	// Size in MiB, used instead of Size if set
+	SizeMiB  int      `json:"size_mib,omitempty"`
+	Clusters []string `json:"clusters,omitempty"`
+	Name     string   `json:"name"`
+	Hacount  int      `json:"hacount,omitempty"`
+	Auth     bool     `json:"auth,omitempty"`
+}
+
+func (blockVolCreateReq BlockVolumeCreateRequest) Validate() error {
+	return validation.ValidateStruct(&blockVolCreateReq,
+		validation.Field(&blockVolCreateReq.Size, sizeRules(blockVolCreateReq.SizeMiB)...),
+		validation.Field(&blockVolCreateReq.SizeMiB, validation.Min(0)),
+		validation.Field(&blockVolCreateReq.Clusters, validation.By(ValidateUUID)),
+		validation.Field(&blockVolCreateReq.Name, validation.Match(blockVolNameRe)),
+		validation.Field(&blockVolCreateReq.Hacount, validation.Min(1)),
+		validation.Field(&blockVolCreateReq.Auth, validation.Skip),
+	)
 }
 
 type BlockVolumeInfo struct {
@@ -366,6 +2221,10 @@ type BlockVolumeInfo struct {
 	} `json:"blockvolume"`
 	Cluster            string `json:"cluster,omitempty"`
 	BlockHostingVolume string `json:"blockhostingvolume,omitempty"`
+	// Id of the block volume the block volume was cloned from
+	CloneOf string `json:"clone_of,omitempty"`
+	// Tenant of the user who created the block volume, if any
+	Tenant string `json:"tenant,omitempty"`
 }
 
 type BlockVolumeInfoResponse struct {
@@ -374,6 +2233,177 @@ type BlockVolumeInfoResponse struct {
 
 type BlockVolumeListResponse struct {
 	BlockVolumes []string `json:"blockvolumes"`
+	// Block volumes matching the filters of the request, before paging
+	Total int `json:"total,omitempty"`
+}
+
+type BlockVolumeExpandRequest struct {
+	// New size of the block volume in GiB
+	NewSize int `json:"new_size"`
+}
+
+func (blockVolExpandReq BlockVolumeExpandRequest) Validate() error {
+	return validation.ValidateStruct(&blockVolExpandReq,
+		validation.Field(&blockVolExpandReq.NewSize, validation.Required, validation.Min(1)),
+	)
+}
+
+type BlockVolumeCloneRequest struct {
+	// Name of the clone, generated from its id if empty
+	Name string `json:"name,omitempty"`
+	// Number of portals of the clone, that of the block volume if zero
+	Hacount int `json:"hacount,omitempty"`
+}
+
+func (req BlockVolumeCloneRequest) Validate() error {
+	return validation.ValidateStruct(&req,
+		validation.Field(&req.Name, validation.Match(blockVolNameRe)),
+		validation.Field(&req.Hacount, validation.Min(1)),
+	)
+}
+
+type BlockVolumeHaCountRequest struct {
+	// New number of portals of the block volume
+	Hacount int `json:"hacount"`
+	// Storage hostnames of the portals, selected by the server if empty
+	Hosts []string `json:"hosts,omitempty"`
+}
+
+func (req BlockVolumeHaCountRequest) Validate() error {
+	return validation.ValidateStruct(&req,
+		validation.Field(&req.Hacount, validation.Required, validation.Min(1)),
+		validation.Field(&req.Hosts, validation.By(req.validateHosts)),
+	)
+}
+
+func (req BlockVolumeHaCountRequest) validateHosts(value interface{}) error {
+	hosts, _ := value.([]string)
+	if len(hosts) != 0 && len(hosts) != req.Hacount {
+		return fmt.Errorf("%v hosts given for hacount %v",
+			len(hosts), req.Hacount)
+	}
+	seen := map[string]bool{}
+	for _, host := range hosts {
+		if host == "" {
+			return fmt.Errorf("host must not be empty")
+		}
+		if seen[host] {
+			return fmt.Errorf("host %v given more than once", host)
+		}
+		seen[host] = true
+	}
+	return nil
+}
+
+// Actions of a block volume reconcile
+const (
+	BlockReconcileReport  = ""
+	BlockReconcileAdopt   = "adopt"
+	BlockReconcileCleanup = "cleanup"
+)
+
+type BlockVolumeReconcileRequest struct {
+	Action string `json:"action,omitempty"`
+}
+
+func (req BlockVolumeReconcileRequest) Validate() error {
+	return validation.ValidateStruct(&req,
+		validation.Field(&req.Action, validation.In(
+			BlockReconcileReport, BlockReconcileAdopt, BlockReconcileCleanup)),
+	)
+}
+
+type BlockHostingVolumeReconcile struct {
+	VolumeId string `json:"volume"`
+
+	// Block volumes found on the block hosting volume but unknown to heketi
+	Orphaned []string `json:"orphaned"`
+
+	// Ids of the block volumes known to heketi but not found on the
+	// block hosting volume
+	Missing []string `json:"missing"`
+
+	Adopted []string `json:"adopted,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+	Errors  []string `json:"errors,omitempty"`
+}
+
+type BlockVolumeReconcileResponse struct {
+	Volumes []BlockHostingVolumeReconcile `json:"volumes"`
+}
+
+// Actions of a brick garbage collection
+const (
+	BrickGcReport  = ""
+	BrickGcCleanup = "cleanup"
+)
+
+type BrickGcRequest struct {
+	Action string `json:"action,omitempty"`
+}
+
+func (req BrickGcRequest) Validate() error {
+	return validation.ValidateStruct(&req,
+		validation.Field(&req.Action, validation.In(
+			BrickGcReport, BrickGcCleanup)),
+	)
+}
+
+type DeviceBrickGc struct {
+	DeviceId string `json:"device"`
+
+	// Logical volumes of the device not used by any brick known to heketi
+	Orphaned []string `json:"orphaned"`
+
+	// Ids of the bricks known to heketi whose logical volumes were not
+	// found on the device
+	Missing []string `json:"missing"`
+
+	Removed []string `json:"removed,omitempty"`
+	Errors  []string `json:"errors,omitempty"`
+}
+
+type BrickGcResponse struct {
+	Devices []DeviceBrickGc `json:"devices"`
+}
+
+// Logging
+
+const (
+	// Header with the id of a request. The id sent by a client is kept,
+	// otherwise one is generated. It is set in the response and tags the
+	// messages logged by the server for the request.
+	HeaderRequestId = "X-Request-Id"
+
+	// Header with the idempotency key of a volume or block volume create.
+	// A create repeated with the same key returns the object created by
+	// the first request instead of creating another one.
+	IdempotencyKeyHeader = "Idempotency-Key"
+
+	// Log levels of the server
+	LogLevelNone     = "none"
+	LogLevelCritical = "critical"
+	LogLevelError    = "error"
+	LogLevelWarning  = "warning"
+	LogLevelInfo     = "info"
+	LogLevelDebug    = "debug"
+)
+
+type LogLevelRequest struct {
+	Level string `json:"level"`
+}
+
+func (req LogLevelRequest) Validate() error {
+	return validation.ValidateStruct(&req,
+		validation.Field(&req.Level, validation.Required, validation.In(
+			LogLevelNone, LogLevelCritical, LogLevelError,
+			LogLevelWarning, LogLevelInfo, LogLevelDebug)),
+	)
+}
+
+type LogLevelResponse struct {
+	Level  string `json:"level"`
+	Format string `json:"format"`
 }
 
 // Constructors
@@ -426,6 +2456,59 @@ func (v *VolumeInfoResponse) String() string {
 			v.Snapshot.Factor)
 	}
 
+	if v.Capacity != nil {
+		s += fmt.Sprintf("Capacity (GiB): usable %v, raw %v, allocated %v\n",
+			v.Capacity.Usable/(1024*1024),
+			v.Capacity.Raw/(1024*1024),
+			v.Capacity.Allocated/(1024*1024))
+	}
+
+	if v.GlusterId != "" {
+		s += fmt.Sprintf("Gluster Volume Id: %v\n", v.GlusterId)
+	}
+
+	if v.Uid != 0 || v.Gid != 0 {
+		s += fmt.Sprintf("Owner: %v:%v\n", v.Uid, v.Gid)
+	}
+	if v.Permissions != "" {
+		s += fmt.Sprintf("Permissions: %v\n", v.Permissions)
+	}
+	if v.SelinuxContext != "" {
+		s += fmt.Sprintf("SELinux Context: %v\n", v.SelinuxContext)
+	}
+	if v.SizeMiB != 0 {
+		s += fmt.Sprintf("Size (MiB): %v\n", v.SizeMiB)
+	}
+	if v.MaxBricks != 0 {
+		s += fmt.Sprintf("Max Bricks: %v\n", v.MaxBricks)
+	}
+	if v.BrickLimits.MinSize != 0 {
+		s += fmt.Sprintf("Min Brick Size (GiB): %v\n", v.BrickLimits.MinSize)
+	}
+	if v.BrickLimits.MaxSize != 0 {
+		s += fmt.Sprintf("Max Brick Size (GiB): %v\n", v.BrickLimits.MaxSize)
+	}
+	if v.BrickLimits.MaxDistribute != 0 {
+		s += fmt.Sprintf("Max Distribute: %v\n", v.BrickLimits.MaxDistribute)
+	}
+	if v.Quota.Enable {
+		s += "Quota: enabled\n"
+	}
+	for _, l := range v.Quota.Limits {
+		s += fmt.Sprintf("Quota Limit: %v %v MiB\n", l.Path, l.HardLimitMiB)
+	}
+	for _, d := range v.OptionsDrift {
+		s += fmt.Sprintf("Option Drift: %v is %q instead of %q\n",
+			d.Option, d.Actual, d.Expected)
+	}
+	if v.PendingDelete != nil {
+		s += fmt.Sprintf("Pending Delete: deleted at %v unless cancelled\n",
+			time.Unix(v.PendingDelete.Deadline, 0).Format(time.RFC3339))
+	}
+	for _, w := range v.Warnings {
+		s += fmt.Sprintf("Warning: %v\n", w.Message)
+	}
+
 	/*
 		s += "\nBricks:\n"
 		for _, b := range v.Bricks {
@@ -477,6 +2560,12 @@ func (v *BlockVolumeInfoResponse) String() string {
 		v.BlockVolume.Username,
 		v.BlockVolume.Password,
 		v.BlockHostingVolume)
+	if v.SizeMiB != 0 {
+		s += fmt.Sprintf("Size (MiB): %v\n", v.SizeMiB)
+	}
+	if v.CloneOf != "" {
+		s += fmt.Sprintf("Clone Of: %v\n", v.CloneOf)
+	}
 
 	/*
 		s += "\nBricks:\n"
@@ -10,7 +10,6 @@
 package utils
 
 import (
-	"errors"
 	"io"
 	"io/ioutil"
 	"net/http"
@@ -27,11 +26,34 @@ func GetStringFromResponse(r *http.Response) (string, error) {
 	return string(body), nil
 }
 
+// HttpError is the error returned by the server in the body of
+// a response, along with the status code of the response
+type HttpError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *HttpError) Error() string {
+	return e.Message
+}
+
 // Return the body from a response as an error
 func GetErrorFromResponse(r *http.Response) error {
 	s, err := GetStringFromResponse(r)
 	if err != nil {
 		return err
 	}
-	return errors.New(strings.TrimSpace(s))
+	return &HttpError{
+		StatusCode: r.StatusCode,
+		Message:    strings.TrimSpace(s),
+	}
+}
+
+// Return the status code of the response the error came from, zero
+// if the error was not returned by the server
+func GetStatusCodeFromError(err error) int {
+	if e, ok := err.(*HttpError); ok {
+		return e.StatusCode
+	}
+	return 0
 }
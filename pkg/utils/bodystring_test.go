@@ -117,3 +117,21 @@ func TestGetErrorFromResponseErrStringSpace(t *testing.T) {
 	tests.Assert(t, err.Error() == "whoa nellie",
 		`expected err.Error() == "whoa nellie", got:`, err.Error())
 }
+
+func TestGetErrorFromResponseStatusCode(t *testing.T) {
+	bodytext := "Id not found\n"
+	resp := &http.Response{
+		Status:        "404 Not Found",
+		StatusCode:    404,
+		Body:          dummyCloser{bytes.NewBufferString(bodytext)},
+		ContentLength: int64(len(bodytext)),
+	}
+	err := GetErrorFromResponse(resp)
+	tests.Assert(t, err != nil, "expected err != nil, got:", err)
+	tests.Assert(t, err.Error() == "Id not found",
+		`expected err.Error() == "Id not found", got:`, err.Error())
+	tests.Assert(t, GetStatusCodeFromError(err) == 404,
+		"expected status code 404, got:", GetStatusCodeFromError(err))
+
+	tests.Assert(t, GetStatusCodeFromError(errors.New("bzzt")) == 0)
+}
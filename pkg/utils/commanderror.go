@@ -0,0 +1,31 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package utils
+
+// CommandError is the error of a command that was run on a host and
+// failed. It keeps the complete output of the command so that it can be
+// stored while the message of the error stays short.
+type CommandError struct {
+	Message string
+	Host    string
+	Command string
+	Stdout  string
+	Stderr  string
+
+	// Error the command failed with
+	Err error
+
+	// Id the output of the command was stored with, if it was stored
+	OutputId string
+}
+
+func (e *CommandError) Error() string {
+	return e.Message
+}
@@ -0,0 +1,57 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package utils
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// AddressFamily returns "inet" or "inet6" when the host is an IPv4
+// or IPv6 address literal and an empty string for host names.
+func AddressFamily(host string) string {
+	ip := net.ParseIP(strings.Trim(host, "[]"))
+	switch {
+	case ip == nil:
+		return ""
+	case ip.To4() != nil:
+		return "inet"
+	default:
+		return "inet6"
+	}
+}
+
+// CanonicalHost returns IPv6 address literals in their canonical
+// form, without brackets, so that they can be compared with the
+// addresses reported by gluster. Other hosts are returned unchanged.
+func CanonicalHost(host string) string {
+	if AddressFamily(host) != "inet6" {
+		return host
+	}
+	return net.ParseIP(strings.Trim(host, "[]")).String()
+}
+
+// SameHost reports whether both hosts are the same host name or
+// the same address, whatever the notation of the address.
+func SameHost(a, b string) bool {
+	return CanonicalHost(a) == CanonicalHost(b)
+}
+
+// SplitBrickName splits a brick name of the form host:/path into its
+// host and path. IPv6 hosts can be enclosed in brackets or not, as
+// the path is the only part of the name starting with a slash.
+func SplitBrickName(name string) (host, path string, err error) {
+	i := strings.Index(name, ":/")
+	if i <= 0 {
+		return "", "", fmt.Errorf("Invalid brick name: %v", name)
+	}
+	return strings.Trim(name[:i], "[]"), name[i+1:], nil
+}
@@ -0,0 +1,55 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package utils
+
+import (
+	"testing"
+
+	"github.com/heketi/tests"
+)
+
+func TestAddressFamily(t *testing.T) {
+	tests.Assert(t, AddressFamily("192.168.10.100") == "inet")
+	tests.Assert(t, AddressFamily("fd00::10") == "inet6")
+	tests.Assert(t, AddressFamily("[fd00::10]") == "inet6")
+	tests.Assert(t, AddressFamily("node1.example.com") == "")
+}
+
+func TestCanonicalHost(t *testing.T) {
+	tests.Assert(t, CanonicalHost("FD00:0:0::0010") == "fd00::10")
+	tests.Assert(t, CanonicalHost("[fd00::10]") == "fd00::10")
+	tests.Assert(t, CanonicalHost("192.168.10.100") == "192.168.10.100")
+	tests.Assert(t, CanonicalHost("Node1") == "Node1")
+
+	tests.Assert(t, SameHost("fd00:0::10", "[fd00::10]"))
+	tests.Assert(t, !SameHost("fd00::10", "fd00::11"))
+}
+
+func TestSplitBrickName(t *testing.T) {
+	host, path, err := SplitBrickName("node1:/var/lib/heketi/mounts/brick")
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, host == "node1", host)
+	tests.Assert(t, path == "/var/lib/heketi/mounts/brick", path)
+
+	host, path, err = SplitBrickName("fd00::10:/var/lib/heketi/mounts/brick")
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, host == "fd00::10", host)
+	tests.Assert(t, path == "/var/lib/heketi/mounts/brick", path)
+
+	host, path, err = SplitBrickName("[fd00::10]:/brick")
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, host == "fd00::10", host)
+	tests.Assert(t, path == "/brick", path)
+
+	_, _, err = SplitBrickName("/brick")
+	tests.Assert(t, err != nil)
+	_, _, err = SplitBrickName("node1")
+	tests.Assert(t, err != nil)
+}
@@ -10,12 +10,15 @@
 package utils
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"os"
 	"runtime"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/lpabon/godbc"
 )
@@ -32,33 +35,116 @@ const (
 	LEVEL_DEBUG
 )
 
+// Log formats
+const (
+	LOG_FORMAT_TEXT = "text"
+	LOG_FORMAT_JSON = "json"
+)
+
 var (
 	stderr io.Writer = os.Stderr
 	stdout io.Writer = os.Stdout
+
+	// The format is shared by all the loggers
+	logFormat = struct {
+		sync.RWMutex
+		format string
+	}{
+		format: LOG_FORMAT_TEXT,
+	}
 )
 
 type Logger struct {
 	critlog, errorlog, infolog *log.Logger
 	debuglog, warninglog       *log.Logger
 
+	name  string
 	level LogLevel
+
+	// Loggers made for a request share the level of the logger they
+	// were made from and tag the messages with the id of the request
+	root      *Logger
+	requestId string
 }
 
-func logWithLongFile(l *log.Logger, format string, v ...interface{}) {
-	_, file, line, _ := runtime.Caller(2)
+// logEntry is a message logged in the json format
+type logEntry struct {
+	Time      string `json:"time"`
+	Level     string `json:"level"`
+	Logger    string `json:"logger"`
+	File      string `json:"file,omitempty"`
+	Line      int    `json:"line,omitempty"`
+	RequestId string `json:"request_id,omitempty"`
+	Msg       string `json:"msg"`
+}
 
-	// Shorten the path.
-	// From
-	// /builddir/build/BUILD/heketi-3f4a5b1b6edff87232e8b24533c53b4151ebd9c7/src/github.com/heketi/heketi/apps/glusterfs/volume_entry.go
-	// to
-	// src/github.com/heketi/heketi/apps/glusterfs/volume_entry.go
-	i := strings.Index(file, "/src/")
-	if i == -1 {
-		i = 0
+// Set the format of the messages of all the loggers, text or json
+func SetLogFormat(format string) error {
+	switch format {
+	case LOG_FORMAT_TEXT, LOG_FORMAT_JSON:
+	default:
+		return fmt.Errorf("Unknown log format %v", format)
 	}
+	logFormat.Lock()
+	defer logFormat.Unlock()
+	logFormat.format = format
+	return nil
+}
 
-	l.Print(fmt.Sprintf("%v:%v: ", file[i:], line) +
-		fmt.Sprintf(format, v...))
+// Return the format of the messages of the loggers
+func GetLogFormat() string {
+	logFormat.RLock()
+	defer logFormat.RUnlock()
+	return logFormat.format
+}
+
+// output logs the message, with the file and line of the caller of the
+// logger if long is set, and the request id of the logger
+func (l *Logger) output(lg *log.Logger, level string, long bool, msg string) {
+	var (
+		file string
+		line int
+	)
+	if long {
+		_, file, line, _ = runtime.Caller(2)
+
+		// Shorten the path.
+		// From
+		// /builddir/build/BUILD/heketi-3f4a5b1b6edff87232e8b24533c53b4151ebd9c7/src/github.com/heketi/heketi/apps/glusterfs/volume_entry.go
+		// to
+		// src/github.com/heketi/heketi/apps/glusterfs/volume_entry.go
+		i := strings.Index(file, "/src/")
+		if i == -1 {
+			i = 0
+		}
+		file = file[i:]
+	}
+	id := l.requestId
+
+	if GetLogFormat() == LOG_FORMAT_JSON {
+		b, err := json.Marshal(&logEntry{
+			Time:      time.Now().Format(time.RFC3339Nano),
+			Level:     level,
+			Logger:    l.name,
+			File:      file,
+			Line:      line,
+			RequestId: id,
+			Msg:       msg,
+		})
+		if err != nil {
+			return
+		}
+		lg.Writer().Write(append(b, '\n'))
+		return
+	}
+
+	if id != "" {
+		msg = "[req=" + id + "] " + msg
+	}
+	if long {
+		msg = fmt.Sprintf("%v:%v: ", file, line) + msg
+	}
+	lg.Print(msg)
 }
 
 // Create a new logger
@@ -66,7 +152,9 @@ func NewLogger(prefix string, level LogLevel) *Logger {
 	godbc.Require(level >= 0, level)
 	godbc.Require(level <= LEVEL_DEBUG, level)
 
-	l := &Logger{}
+	l := &Logger{
+		name: strings.Trim(prefix, "[]"),
+	}
 
 	if level == LEVEL_NOLOG {
 		l.level = LEVEL_DEBUG
@@ -89,27 +177,62 @@ func NewLogger(prefix string, level LogLevel) *Logger {
 	return l
 }
 
+// WithRequestId returns a logger tagging the messages with the id of
+// the request they are logged for. The level is shared with l. An
+// empty id returns the logger l was made from.
+func (l *Logger) WithRequestId(id string) *Logger {
+	base := l
+	if l.root != nil {
+		base = l.root
+	}
+	if id == "" {
+		return base
+	}
+	return &Logger{
+		critlog:    l.critlog,
+		errorlog:   l.errorlog,
+		infolog:    l.infolog,
+		debuglog:   l.debuglog,
+		warninglog: l.warninglog,
+		name:       l.name,
+		root:       base,
+		requestId:  id,
+	}
+}
+
+// Return the id of the request the messages are tagged with, if any
+func (l *Logger) RequestId() string {
+	return l.requestId
+}
+
 // Return current level
 func (l *Logger) Level() LogLevel {
+	if l.root != nil {
+		return l.root.level
+	}
 	return l.level
 }
 
 // Set level
 func (l *Logger) SetLevel(level LogLevel) {
+	if l.root != nil {
+		l.root.level = level
+		return
+	}
 	l.level = level
 }
 
 // Log critical information
 func (l *Logger) Critical(format string, v ...interface{}) {
-	if l.level >= LEVEL_CRITICAL {
-		logWithLongFile(l.critlog, format, v...)
+	if l.Level() >= LEVEL_CRITICAL {
+		l.output(l.critlog, "critical", true, fmt.Sprintf(format, v...))
 	}
 }
 
 // Log error string
 func (l *Logger) LogError(format string, v ...interface{}) error {
-	if l.level >= LEVEL_ERROR {
-		logWithLongFile(l.errorlog, format, v...)
+	if l.Level() >= LEVEL_ERROR {
+		l.output(l.errorlog, "error", true, fmt.Sprintf(format, v...))
 	}
 
 	return fmt.Errorf(format, v...)
@@ -117,8 +240,8 @@ func (l *Logger) LogError(format string, v ...interface{}) error {
 
 // Log error variable
 func (l *Logger) Err(err error) error {
-	if l.level >= LEVEL_ERROR {
-		logWithLongFile(l.errorlog, "%v", err)
+	if l.Level() >= LEVEL_ERROR {
+		l.output(l.errorlog, "error", true, fmt.Sprintf("%v", err))
 	}
 
 	return err
@@ -126,15 +249,15 @@ func (l *Logger) Err(err error) error {
 
 // Log warning information
 func (l *Logger) Warning(format string, v ...interface{}) {
-	if l.level >= LEVEL_WARNING {
-		l.warninglog.Printf(format, v...)
+	if l.Level() >= LEVEL_WARNING {
+		l.output(l.warninglog, "warning", false, fmt.Sprintf(format, v...))
 	}
 }
 
 // Log error variable as a warning
 func (l *Logger) WarnErr(err error) error {
-	if l.level >= LEVEL_WARNING {
-		logWithLongFile(l.warninglog, "%v", err)
+	if l.Level() >= LEVEL_WARNING {
+		l.output(l.warninglog, "warning", true, fmt.Sprintf("%v", err))
 	}
 
 	return err
@@ -142,14 +265,14 @@ func (l *Logger) WarnErr(err error) error {
 
 // Log string
 func (l *Logger) Info(format string, v ...interface{}) {
-	if l.level >= LEVEL_INFO {
-		l.infolog.Printf(format, v...)
+	if l.Level() >= LEVEL_INFO {
+		l.output(l.infolog, "info", false, fmt.Sprintf(format, v...))
 	}
 }
 
 // Log string as debug
 func (l *Logger) Debug(format string, v ...interface{}) {
-	if l.level >= LEVEL_DEBUG {
-		logWithLongFile(l.debuglog, format, v...)
+	if l.Level() >= LEVEL_DEBUG {
+		l.output(l.debuglog, "debug", true, fmt.Sprintf(format, v...))
 	}
 }
@@ -11,6 +11,8 @@ package utils
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/heketi/tests"
@@ -200,3 +202,78 @@ func TestLogErr(t *testing.T) {
 	l.Err(ErrSample)
 	tests.Assert(t, testbuffer.Len() == 0)
 }
+
+func TestLogJson(t *testing.T) {
+	var testbuffer bytes.Buffer
+
+	defer tests.Patch(&stdout, &testbuffer).Restore()
+
+	err := SetLogFormat("xml")
+	tests.Assert(t, err != nil)
+	tests.Assert(t, GetLogFormat() == LOG_FORMAT_TEXT)
+
+	err = SetLogFormat(LOG_FORMAT_JSON)
+	tests.Assert(t, err == nil, err)
+	defer SetLogFormat(LOG_FORMAT_TEXT)
+
+	l := NewLogger("[testing]", LEVEL_DEBUG)
+
+	l.Info("Hello %v", "World")
+	var entry logEntry
+	err = json.Unmarshal(testbuffer.Bytes(), &entry)
+	tests.Assert(t, err == nil, err, testbuffer.String())
+	tests.Assert(t, entry.Level == "info", entry.Level)
+	tests.Assert(t, entry.Logger == "testing", entry.Logger)
+	tests.Assert(t, entry.Msg == "Hello World", entry.Msg)
+	tests.Assert(t, entry.File == "")
+	tests.Assert(t, entry.RequestId == "")
+	tests.Assert(t, entry.Time != "")
+	testbuffer.Reset()
+
+	l.Debug("TEXT")
+	entry = logEntry{}
+	err = json.Unmarshal(testbuffer.Bytes(), &entry)
+	tests.Assert(t, err == nil, err, testbuffer.String())
+	tests.Assert(t, entry.Level == "debug", entry.Level)
+	tests.Assert(t, strings.HasSuffix(entry.File, "log_test.go"), entry.File)
+	tests.Assert(t, entry.Line != 0)
+}
+
+func TestLogRequestId(t *testing.T) {
+	var testbuffer bytes.Buffer
+
+	defer tests.Patch(&stdout, &testbuffer).Restore()
+
+	l := NewLogger("[testing]", LEVEL_DEBUG)
+
+	ctx := context.Background()
+	tests.Assert(t, RequestIdFrom(ctx) == "")
+	ctx = WithRequestId(ctx, "abc")
+	tests.Assert(t, RequestIdFrom(ctx) == "abc")
+
+	rl := l.WithRequestId(RequestIdFrom(ctx))
+	tests.Assert(t, rl.RequestId() == "abc")
+	rl.Info("Hello")
+	tests.Assert(t, strings.Contains(testbuffer.String(), "[req=abc] Hello"),
+		testbuffer.String())
+	testbuffer.Reset()
+
+	// The logger of the request is not changed
+	l.Info("Hello")
+	tests.Assert(t, !strings.Contains(testbuffer.String(), "req="),
+		testbuffer.String())
+	testbuffer.Reset()
+
+	// A logger made from the logger of a request replaces the id
+	tests.Assert(t, rl.WithRequestId("def").RequestId() == "def")
+	tests.Assert(t, rl.WithRequestId("") == l)
+	tests.Assert(t, l.WithRequestId("") == l)
+
+	// The level is shared with the logger the request logger was made from
+	l.SetLevel(LEVEL_WARNING)
+	tests.Assert(t, rl.Level() == LEVEL_WARNING)
+	rl.Info("Hidden")
+	tests.Assert(t, testbuffer.Len() == 0, testbuffer.String())
+	rl.SetLevel(LEVEL_DEBUG)
+	tests.Assert(t, l.Level() == LEVEL_DEBUG)
+}
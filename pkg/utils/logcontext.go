@@ -0,0 +1,31 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package utils
+
+import (
+	"context"
+)
+
+type requestIdKey struct{}
+
+// WithRequestId returns a copy of the context of a request carrying the
+// id of the request. The handlers pass the id on to the operations, the
+// allocator and the executor, which log with a logger tagged with it,
+// see Logger.WithRequestId.
+func WithRequestId(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIdKey{}, id)
+}
+
+// RequestIdFrom returns the id of the request carried by the context,
+// or an empty string if there is none
+func RequestIdFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIdKey{}).(string)
+	return id
+}
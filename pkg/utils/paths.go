@@ -11,7 +11,10 @@ package utils
 
 import (
 	"errors"
+	"fmt"
 	"path"
+	"regexp"
+	"strings"
 )
 
 const (
@@ -19,22 +22,64 @@ const (
 	deviceMapperRoot    = "/dev/mapper"
 )
 
+var (
+	// Prefix of the names of the VGs, thin pools and LVs, and of
+	// the directories the bricks are mounted on
+	lvmNamePrefix = ""
+
+	// Hyphens are left out as device mapper doubles them in the
+	// names of the device nodes
+	lvmNamePrefixRegexp = regexp.MustCompile(`^[a-zA-Z0-9_.]+$`)
+)
+
+// ValidateLvmNamePrefix returns an error if the prefix cannot
+// start the name of an LVM VG or LV.
+func ValidateLvmNamePrefix(prefix string) error {
+	if prefix != "" && !lvmNamePrefixRegexp.MatchString(prefix) {
+		return fmt.Errorf("invalid lvm name prefix %v", prefix)
+	}
+	return nil
+}
+
+// SetLvmNamePrefix sets the prefix of the names of the VGs and
+// LVs created for devices and bricks. The prefix must not be
+// changed once devices have been set up with it.
+func SetLvmNamePrefix(prefix string) {
+	lvmNamePrefix = prefix
+}
+
+// LvmNamePrefix returns the prefix of the names of the VGs and
+// LVs created for devices and bricks.
+func LvmNamePrefix() string {
+	return lvmNamePrefix
+}
+
 // VgIdToName return the string to be used for the name of
 // an LVM VG given the id of the vg.
 func VgIdToName(vgId string) string {
-	return "vg_" + vgId
+	return lvmNamePrefix + "vg_" + vgId
+}
+
+// VgNameToId returns the id of the vg given the name of an
+// LVM VG named with VgIdToName, and false for other names.
+func VgNameToId(name string) (string, bool) {
+	prefix := VgIdToName("")
+	if !strings.HasPrefix(name, prefix) || name == prefix {
+		return "", false
+	}
+	return strings.TrimPrefix(name, prefix), true
 }
 
 // BrickIdToName returns the string to be used for the
 // name of the brick when used in paths or lvm device names.
 func BrickIdToName(brickId string) string {
-	return "brick_" + brickId
+	return lvmNamePrefix + "brick_" + brickId
 }
 
 // BrickIdToThinPoolName returns the string to be used for
 // a LVM thin-pool name for a given brick id.
 func BrickIdToThinPoolName(brickId string) string {
-	return "tp_" + brickId
+	return lvmNamePrefix + "tp_" + brickId
 }
 
 // BrickPath returns the "full" path to a brick.
@@ -89,3 +89,28 @@ func TestBrickMountFromPathIsStrict(t *testing.T) {
 	BrickMountFromPath("asdf")
 	t.Fatalf("should not be reached")
 }
+
+func TestLvmNamePrefix(t *testing.T) {
+	defer SetLvmNamePrefix("")
+
+	SetLvmNamePrefix("hk1_")
+	tests.Assert(t, LvmNamePrefix() == "hk1_")
+	tests.Assert(t, VgIdToName("asdf") == "hk1_vg_asdf", VgIdToName("asdf"))
+	tests.Assert(t, BrickIdToName("fp") == "hk1_brick_fp", BrickIdToName("fp"))
+	tests.Assert(t, BrickIdToThinPoolName("fp") == "hk1_tp_fp",
+		BrickIdToThinPoolName("fp"))
+	tests.Assert(t, BrickDevNode("asdf", "fp") == "/dev/mapper/hk1_vg_asdf-hk1_brick_fp",
+		BrickDevNode("asdf", "fp"))
+
+	id, ok := VgNameToId("hk1_vg_asdf")
+	tests.Assert(t, ok && id == "asdf", id, ok)
+	_, ok = VgNameToId("vg_asdf")
+	tests.Assert(t, !ok)
+	_, ok = VgNameToId("hk1_vg_")
+	tests.Assert(t, !ok)
+
+	tests.Assert(t, ValidateLvmNamePrefix("") == nil)
+	tests.Assert(t, ValidateLvmNamePrefix("hk1_") == nil)
+	tests.Assert(t, ValidateLvmNamePrefix("hk-1") != nil)
+	tests.Assert(t, ValidateLvmNamePrefix("hk/1") != nil)
+}
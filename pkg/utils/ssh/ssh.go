@@ -169,7 +169,14 @@ func (s *SshExec) ConnectAndExec(host string, commands []string, timeoutMinutes
 			if err != nil {
 				s.logger.LogError("Failed to run command [%v] on %v: Err[%v]: Stdout [%v]: Stderr [%v]",
 					command, host, err, b.String(), berr.String())
-				return nil, fmt.Errorf("%s", berr.String())
+				return nil, &utils.CommandError{
+					Message: berr.String(),
+					Host:    host,
+					Command: command,
+					Stdout:  b.String(),
+					Stderr:  berr.String(),
+					Err:     err,
+				}
 			}
 			s.logger.Debug("Host: %v Command: %v\nResult: %v", host, command, b.String())
 			buffers[index] = b.String()
@@ -182,7 +189,14 @@ func (s *SshExec) ConnectAndExec(host string, commands []string, timeoutMinutes
 				s.logger.LogError("Unable to send kill signal to command [%v] on host [%v]: %v",
 					command, host, err)
 			}
-			return nil, errors.New("SSH command timeout")
+			return nil, &utils.CommandError{
+				Message: "SSH command timeout",
+				Host:    host,
+				Command: command,
+				Stdout:  b.String(),
+				Stderr:  berr.String(),
+				Err:     errors.New("SSH command timeout"),
+			}
 		}
 	}
 
@@ -0,0 +1,29 @@
+#!/bin/bash
+
+# Removes the gluster containers, their loop devices and the network
+# started by up.sh
+
+NETWORK=heketi-functest
+DISK_DIR=/var/tmp/heketi-functest
+
+for name in $(docker ps -a --filter "name=heketi-storage" --format '{{.Names}}') ; do
+    docker rm -f "${name}"
+done
+
+for img in "${DISK_DIR}"/*.img ; do
+    [ -e "${img}" ] || continue
+    for dev in $(losetup -j "${img}" | cut -d: -f1) ; do
+        # The volume groups created by heketi are left on the devices
+        dmsetup ls | awk '{print $1}' | while read -r dm ; do
+            if dmsetup deps -o devname "${dm}" 2>/dev/null | grep -q "(${dev#/dev/})" ; then
+                dmsetup remove -f "${dm}"
+            fi
+        done
+        losetup -d "${dev}"
+    done
+    rm -f "${img}"
+done
+
+docker network rm "${NETWORK}" > /dev/null 2>&1
+rm -f nodes
+exit 0
@@ -0,0 +1,78 @@
+#!/bin/bash
+
+# Starts the gluster containers used as storage nodes by the tests. Each
+# container gets loop devices backed by sparse files and an sshd on
+# port 2222 accepting the insecure key of the tests. The addresses and
+# the devices of the nodes are written to the nodes file, one node per
+# line.
+
+IMAGE="${HEKETI_TEST_GLUSTER_IMAGE:-docker.io/gluster/gluster-centos:latest}"
+NETWORK=heketi-functest
+SUBNET=172.30.10.0/24
+NODES=4
+DISKS=2
+DISK_SIZE=20G
+DISK_DIR=/var/tmp/heketi-functest
+SSH_PORT=2222
+
+fail() {
+    echo "==> ERROR: $*"
+    exit 1
+}
+
+pubkey="$(ssh-keygen -y -f ../config/insecure_private_key)" || \
+    fail "Unable to read the key of the tests"
+
+docker network create --subnet "${SUBNET}" "${NETWORK}" || \
+    fail "Unable to create network ${NETWORK}"
+mkdir -p "${DISK_DIR}" || fail "Unable to create ${DISK_DIR}"
+
+rm -f nodes
+for ((n = 0; n < NODES; n++)) ; do
+    name="heketi-storage${n}"
+    ip="172.30.10.$((100 + n))"
+
+    devices=()
+    for ((d = 0; d < DISKS; d++)) ; do
+        img="${DISK_DIR}/${name}-disk${d}.img"
+        truncate -s "${DISK_SIZE}" "${img}" || fail "Unable to create ${img}"
+        dev="$(losetup -f --show "${img}")" || fail "Unable to attach ${img}"
+        devices+=("${dev}")
+    done
+
+    docker run -d --privileged \
+        --name "${name}" --hostname "${name}" \
+        --network "${NETWORK}" --ip "${ip}" \
+        -v /dev:/dev \
+        -v /sys/fs/cgroup:/sys/fs/cgroup:ro \
+        "${IMAGE}" || fail "Unable to start ${name}"
+
+    # There is no udev in the container for lvm to wait for
+    docker exec "${name}" sed -i \
+        -e 's/udev_sync = 1/udev_sync = 0/' \
+        -e 's/udev_rules = 1/udev_rules = 0/' \
+        /etc/lvm/lvm.conf || fail "Unable to configure lvm in ${name}"
+
+    docker exec "${name}" sh -c "
+        mkdir -p /root/.ssh && chmod 700 /root/.ssh &&
+        echo '${pubkey}' > /root/.ssh/authorized_keys &&
+        chmod 600 /root/.ssh/authorized_keys &&
+        sed -i -e '/^#\?Port /d' /etc/ssh/sshd_config &&
+        echo 'Port ${SSH_PORT}' >> /etc/ssh/sshd_config &&
+        systemctl restart sshd" || fail "Unable to configure sshd in ${name}"
+
+    echo "${ip} ${devices[*]}" >> nodes
+done
+
+# Wait for glusterd on every node
+for ((n = 0; n < NODES; n++)) ; do
+    name="heketi-storage${n}"
+    for ((i = 0; i < 60; i++)) ; do
+        if docker exec "${name}" systemctl is-active -q glusterd ; then
+            break
+        fi
+        sleep 2
+    done
+    docker exec "${name}" systemctl is-active -q glusterd || \
+        fail "glusterd is not running in ${name}"
+done
@@ -0,0 +1,13 @@
+#!/bin/bash
+
+CURRENT_DIR="$(pwd)"
+export HEKETI_SERVER_BUILD_DIR=../../..
+FUNCTIONAL_DIR="${CURRENT_DIR}/.."
+export HEKETI_SERVER="${FUNCTIONAL_DIR}/heketi-server"
+
+export HEKETI_TEST_CONTAINERS=yes
+
+source "${FUNCTIONAL_DIR}/lib.sh"
+
+teardown
+
@@ -0,0 +1,215 @@
+// +build functional
+
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+package functional
+
+import (
+	"bufio"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	client "github.com/heketi/heketi/client/api/go-client"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/heketi/pkg/utils"
+	"github.com/heketi/heketi/pkg/utils/ssh"
+	"github.com/heketi/tests"
+)
+
+var (
+	// The heketi server must be running on the host
+	heketiUrl = "http://localhost:8080"
+
+	// Nodes started by containers/up.sh
+	nodesFile = "../containers/nodes"
+	portNum   = "2222"
+
+	// Heketi client
+	heketi = client.NewClientNoAuth(heketiUrl)
+	logger = utils.NewLogger("[test]", utils.LEVEL_DEBUG)
+)
+
+type storageNode struct {
+	host  string
+	disks []string
+}
+
+// storageNodes returns the address and the devices of each container
+func storageNodes(t *testing.T) []storageNode {
+	fp, err := os.Open(nodesFile)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	defer fp.Close()
+
+	nodes := []storageNode{}
+	s := bufio.NewScanner(fp)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		nodes = append(nodes, storageNode{
+			host:  fields[0],
+			disks: fields[1:],
+		})
+	}
+	tests.Assert(t, s.Err() == nil, s.Err())
+	tests.Assert(t, len(nodes) > 0, "no nodes in", nodesFile)
+	return nodes
+}
+
+// gluster runs the gluster command on the node and returns its output
+func gluster(t *testing.T, host string, command string) string {
+	exec := ssh.NewSshExecWithKeyFile(logger, "root", "../config/insecure_private_key")
+	tests.Assert(t, exec != nil)
+	out, err := exec.ConnectAndExec(host+":"+portNum,
+		[]string{"gluster --mode=script " + command}, 10, false)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	return out[0]
+}
+
+func setupCluster(t *testing.T) []storageNode {
+	tests.Assert(t, heketi != nil)
+
+	env := os.Getenv("HEKETI_TEST_STORAGEPORT")
+	if "" != env {
+		portNum = env
+	}
+
+	cluster, err := heketi.ClusterCreate(&api.ClusterCreateRequest{
+		ClusterFlags: api.ClusterFlags{
+			Block: true,
+			File:  true,
+		},
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	nodes := storageNodes(t)
+	for index, n := range nodes {
+		nodeReq := &api.NodeAddRequest{}
+		nodeReq.ClusterId = cluster.Id
+		nodeReq.Hostnames.Manage = []string{n.host}
+		nodeReq.Hostnames.Storage = []string{n.host}
+		nodeReq.Zone = index%2 + 1
+
+		node, err := heketi.NodeAdd(nodeReq)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+		for _, disk := range n.disks {
+			driveReq := &api.DeviceAddRequest{}
+			driveReq.Name = disk
+			driveReq.NodeId = node.Id
+
+			err := heketi.DeviceAdd(driveReq)
+			tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		}
+	}
+	return nodes
+}
+
+func teardownCluster(t *testing.T) {
+	clusters, err := heketi.ClusterList()
+	tests.Assert(t, err == nil, err)
+
+	for _, cluster := range clusters.Clusters {
+
+		clusterInfo, err := heketi.ClusterInfo(cluster)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+		for _, volume := range clusterInfo.Volumes {
+			err := heketi.VolumeDelete(volume)
+			tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		}
+
+		for _, node := range clusterInfo.Nodes {
+			nodeInfo, err := heketi.NodeInfo(node)
+			tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+			for _, device := range nodeInfo.DevicesInfo {
+				stateReq := &api.StateRequest{}
+				stateReq.State = api.EntryStateOffline
+				stateReq.Reason = api.StateReasonMaintenance
+				err := heketi.DeviceState(device.Id, stateReq)
+				tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+				stateReq.State = api.EntryStateFailed
+				err = heketi.DeviceState(device.Id, stateReq)
+				tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+				err = heketi.DeviceDelete(device.Id)
+				tests.Assert(t, err == nil, "expected err == nil, got:", err)
+			}
+
+			err = heketi.NodeDelete(node)
+			tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		}
+
+		err = heketi.ClusterDelete(cluster)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	}
+}
+
+func TestConnection(t *testing.T) {
+	r, err := http.Get(heketiUrl + "/hello")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, r.StatusCode == http.StatusOK)
+}
+
+func TestContainerVolumeLifecycle(t *testing.T) {
+	teardownCluster(t)
+	nodes := setupCluster(t)
+	defer teardownCluster(t)
+	host := nodes[0].host
+
+	// Create
+	volReq := &api.VolumeCreateRequest{}
+	volReq.Size = 2
+	volReq.Durability.Type = api.DurabilityReplicate
+	volReq.Durability.Replicate.Replica = 3
+
+	volInfo, err := heketi.VolumeCreate(volReq)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(volInfo.Bricks) == 3, len(volInfo.Bricks))
+
+	out := gluster(t, host, "volume info "+volInfo.Name)
+	tests.Assert(t, strings.Contains(out, "Status: Started"), out)
+	tests.Assert(t, strings.Contains(out, "Number of Bricks: 1 x 3 = 3"), out)
+	for _, b := range volInfo.Bricks {
+		tests.Assert(t, strings.Contains(out, b.Path), b.Path, out)
+	}
+
+	// Expand
+	volInfo, err = heketi.VolumeExpand(volInfo.Id, &api.VolumeExpandRequest{Size: 2})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, volInfo.Size == 4, volInfo.Size)
+	tests.Assert(t, len(volInfo.Bricks) == 6, len(volInfo.Bricks))
+
+	out = gluster(t, host, "volume info "+volInfo.Name)
+	tests.Assert(t, strings.Contains(out, "Number of Bricks: 2 x 3 = 6"), out)
+
+	// Replace a brick
+	old := volInfo.Bricks[0]
+	volInfo, err = heketi.BrickReplace(old.Id)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(volInfo.Bricks) == 6, len(volInfo.Bricks))
+
+	out = gluster(t, host, "volume info "+volInfo.Name)
+	tests.Assert(t, !strings.Contains(out, old.Path), old.Path, out)
+	for _, b := range volInfo.Bricks {
+		tests.Assert(t, b.Id != old.Id, b)
+		tests.Assert(t, strings.Contains(out, b.Path), b.Path, out)
+	}
+
+	// Delete
+	err = heketi.VolumeDelete(volInfo.Id)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	out = gluster(t, host, "volume list")
+	tests.Assert(t, !strings.Contains(out, volInfo.Name), out)
+}
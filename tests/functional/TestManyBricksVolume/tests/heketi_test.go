@@ -173,6 +173,7 @@ func teardownCluster(t *testing.T) {
 
 						stateReq := &api.StateRequest{}
 						stateReq.State = api.EntryStateOffline
+						stateReq.Reason = api.StateReasonMaintenance
 						err := heketi.DeviceState(id, stateReq)
 						if err != nil {
 							logger.Err(err)
@@ -180,6 +180,7 @@ func teardownCluster(t *testing.T) {
 
 					stateReq := &api.StateRequest{}
 					stateReq.State = api.EntryStateOffline
+					stateReq.Reason = api.StateReasonMaintenance
 					err := heketi.DeviceState(id, stateReq)
 					if err != nil {
 						sg.Err(err)
@@ -439,11 +440,13 @@ func TestRemoveDevice(t *testing.T) {
 
 	stateReq := &api.StateRequest{}
 	stateReq.State = api.EntryStateOffline
+	stateReq.Reason = api.StateReasonMaintenance
 	err = heketi.DeviceState(deviceToRemove, stateReq)
 	tests.Assert(t, err == nil, "expected err == nil, got:", err)
 
 	stateReq = &api.StateRequest{}
 	stateReq.State = api.EntryStateFailed
+	stateReq.Reason = api.StateReasonMaintenance
 	err = heketi.DeviceState(deviceToRemove, stateReq)
 	tests.Assert(t, err == nil, "expected err == nil, got:", err)
 
@@ -499,6 +502,7 @@ func TestRemoveDeviceVsVolumeCreate(t *testing.T) {
 
 	stateReq := &api.StateRequest{}
 	stateReq.State = api.EntryStateOffline
+	stateReq.Reason = api.StateReasonMaintenance
 	err = heketi.DeviceState(deviceToRemove, stateReq)
 	tests.Assert(t, err == nil, "expected err == nil, got:", err)
 
@@ -508,6 +512,7 @@ func TestRemoveDeviceVsVolumeCreate(t *testing.T) {
 		defer sgDeviceRemove.Done()
 		stateReq = &api.StateRequest{}
 		stateReq.State = api.EntryStateFailed
+		stateReq.Reason = api.StateReasonMaintenance
 		err = heketi.DeviceState(deviceToRemove, stateReq)
 		sgDeviceRemove.Err(err)
 	}()
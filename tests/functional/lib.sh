@@ -37,6 +37,18 @@ start_vagrant() {
     cd ..
 }
 
+start_containers() {
+    cd containers || fail "Unable to 'cd containers'."
+    _sudo ./up.sh || fail "unable to start gluster containers"
+    cd ..
+}
+
+teardown_containers() {
+    cd containers || fail "Unable to 'cd containers'."
+    _sudo ./down.sh
+    cd ..
+}
+
 teardown_vagrant() {
     cd vagrant || fail "Unable to 'cd vagrant'."
     _sudo vagrant destroy -f
@@ -58,7 +70,10 @@ force_cleanup_libvirt_disks() {
 }
 
 teardown() {
-    if [[ "$HEKETI_TEST_VAGRANT" != "no" ]]
+    if [[ "$HEKETI_TEST_CONTAINERS" == "yes" ]]
+    then
+        teardown_containers
+    elif [[ "$HEKETI_TEST_VAGRANT" != "no" ]]
     then
         teardown_vagrant
         force_cleanup_libvirt_disks
@@ -67,7 +82,10 @@ teardown() {
 }
 
 functional_tests() {
-    if [[ "$HEKETI_TEST_VAGRANT" != "no" ]]
+    if [[ "$HEKETI_TEST_CONTAINERS" == "yes" ]]
+    then
+        start_containers
+    elif [[ "$HEKETI_TEST_VAGRANT" != "no" ]]
     then
         start_vagrant
     fi
@@ -37,6 +37,7 @@ done
 
 if [[ "${#TESTS[@]}" -eq 0 ]]; then
 	TESTS+=("TestSmokeTest")
+	TESTS+=("TestContainerSmokeTest")
 	TESTS+=("TestVolumeNotDeletedWhenNodeIsDown")
 	TESTS+=("TestVolumeSnapshotBehavior")
 	TESTS+=("TestManyBricksVolume")